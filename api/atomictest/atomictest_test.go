@@ -0,0 +1,122 @@
+package atomictest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/atombasedev/atombase/data"
+	"github.com/atombasedev/atombase/platform"
+)
+
+func TestServer_DefinitionDatabaseAndData(t *testing.T) {
+	ctx := context.Background()
+	srv := NewServer(t)
+
+	srv.MustCreateDefinition(t, platform.CreateDefinitionRequest{
+		Name: "catalog",
+		Type: "global",
+		Schema: platform.Schema{Tables: []platform.Table{{Name: "products", Pk: []string{"id"}, Columns: map[string]platform.Col{
+			"id":   {Name: "id", Type: "INTEGER"},
+			"name": {Name: "name", Type: "TEXT"},
+		}}}},
+	})
+	srv.MustCreateDatabase(t, platform.CreateDatabaseRequest{ID: "catalog-1", Definition: "catalog"})
+	if _, err := os.Stat(filepath.Join(srv.TenantDir, "catalog-1.db")); err != nil {
+		t.Fatalf("expected a local tenant file: %v", err)
+	}
+
+	db := srv.Database("global:catalog-1")
+	if _, err := db.Insert(ctx, "products", data.InsertRequest{Data: data.RowData{
+		{"id": 1, "name": "lamp"},
+		{"id": 2, "name": "desk"},
+	}}); err != nil {
+		t.Fatalf("insert failed: %v", err)
+	}
+	if n, err := db.Update(ctx, "products", data.UpdateRequest{
+		Data:  map[string]any{"name": "chair"},
+		Where: []map[string]any{{"id": map[string]any{"eq": 2}}},
+	}); err != nil || n != 1 {
+		t.Fatalf("update = %d, %v", n, err)
+	}
+	rows, count, err := db.SelectCount(ctx, "products", data.SelectQuery{Order: map[string]string{"id": "asc"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 || len(rows) != 2 || rows[1]["name"] != "chair" {
+		raw, _ := json.Marshal(rows)
+		t.Fatalf("unexpected rows (count %d): %s", count, raw)
+	}
+	if n, err := db.Delete(ctx, "products", data.DeleteRequest{Where: []map[string]any{{"id": map[string]any{"eq": 1}}}}); err != nil || n != 1 {
+		t.Fatalf("delete = %d, %v", n, err)
+	}
+
+	if err := srv.DeleteDatabase(ctx, "catalog-1"); err != nil {
+		t.Fatalf("delete database failed: %v", err)
+	}
+	_, err = srv.GetDatabase(ctx, "catalog-1")
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusNotFound {
+		t.Fatalf("expected a 404 after deletion, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(srv.TenantDir, "catalog-1.db")); !os.IsNotExist(err) {
+		t.Fatalf("expected the tenant file to be removed, got %v", err)
+	}
+}
+
+func TestServer_RejectsWrongKey(t *testing.T) {
+	srv := NewServer(t)
+	client := NewClient(srv.BaseURL, "service.wrong")
+	_, err := client.GetDatabase(context.Background(), "anything")
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %v", err)
+	}
+}
+
+func TestServer_ContentRange(t *testing.T) {
+	ctx := context.Background()
+	srv := NewServer(t)
+	srv.MustCreateDefinition(t, platform.CreateDefinitionRequest{
+		Name: "ledger",
+		Type: "global",
+		Schema: platform.Schema{Tables: []platform.Table{{Name: "entries", Pk: []string{"id"}, Columns: map[string]platform.Col{
+			"id": {Name: "id", Type: "INTEGER"},
+		}}}},
+	})
+	srv.MustCreateDatabase(t, platform.CreateDatabaseRequest{ID: "ledger-1", Definition: "ledger"})
+	rows := make(data.RowData, 30)
+	for i := range rows {
+		rows[i] = map[string]any{"id": i + 1}
+	}
+	if _, err := srv.Database("global:ledger-1").Insert(ctx, "entries", data.InsertRequest{Data: rows}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		prefer, rangeHeader, want string
+		rows                      int
+	}{
+		{"operation=select, count=exact", "5-14", "5-14/30", 10},
+		{"operation=select", "25-", "25-29/*", 5},
+		{"operation=select, count=exact", "40-49", "*/30", 0},
+		{"operation=select, count=none", "", "0-29/*", 30},
+	} {
+		header := http.Header{"Database": {"global:ledger-1"}, "Prefer": {tt.prefer}}
+		if tt.rangeHeader != "" {
+			header.Set("Range", tt.rangeHeader)
+		}
+		var page []map[string]any
+		resp, err := srv.Do(ctx, http.MethodPost, "/data/query/entries", header, data.SelectQuery{Order: map[string]string{"id": "asc"}}, &page)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := resp.Header.Get("Content-Range"); got != tt.want || len(page) != tt.rows {
+			t.Errorf("%s / Range %q: Content-Range %q with %d rows, want %q with %d", tt.prefer, tt.rangeHeader, got, len(page), tt.want, tt.rows)
+		}
+	}
+}
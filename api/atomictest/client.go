@@ -0,0 +1,245 @@
+package atomictest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/atombasedev/atombase/data"
+	"github.com/atombasedev/atombase/platform"
+	"github.com/atombasedev/atombase/tools"
+)
+
+// Client issues typed requests to an atombase server.
+type Client struct {
+	BaseURL string
+	Token   string // Bearer token: "service.<key>" or a session token
+	HTTP    *http.Client
+}
+
+// NewClient returns a client for the server at baseURL authenticating with token.
+func NewClient(baseURL, token string) *Client {
+	return &Client{BaseURL: baseURL, Token: token, HTTP: http.DefaultClient}
+}
+
+// Error is an API error response.
+type Error struct {
+	Status int
+	tools.APIError
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.Status, e.Code, e.Message)
+}
+
+// Do sends a JSON request and decodes a JSON response into out, which may be
+// nil. Non-2xx responses are returned as *Error.
+func (c *Client) Do(ctx context.Context, method, path string, header http.Header, body, out any) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(raw)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp, err
+	}
+	if resp.StatusCode >= 300 {
+		apiErr := &Error{Status: resp.StatusCode}
+		if json.Unmarshal(raw, &apiErr.APIError) != nil || apiErr.Code == "" {
+			apiErr.Message = string(raw)
+		}
+		return resp, apiErr
+	}
+	if out != nil && len(raw) > 0 {
+		if err := json.Unmarshal(raw, out); err != nil {
+			return resp, fmt.Errorf("decode %s %s response: %w", method, path, err)
+		}
+	}
+	return resp, nil
+}
+
+// CreateDefinition creates a definition.
+func (c *Client) CreateDefinition(ctx context.Context, req platform.CreateDefinitionRequest) (*platform.Definition, error) {
+	var out platform.Definition
+	if _, err := c.Do(ctx, http.MethodPost, "/platform/definitions", nil, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// PushDefinition publishes a new version of a definition.
+func (c *Client) PushDefinition(ctx context.Context, name string, req platform.PushDefinitionRequest) (*platform.DefinitionVersion, error) {
+	var out platform.DefinitionVersion
+	if _, err := c.Do(ctx, http.MethodPost, "/platform/definitions/"+name+"/push", nil, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateDatabase creates a tenant database.
+func (c *Client) CreateDatabase(ctx context.Context, req platform.CreateDatabaseRequest) (*platform.DatabaseRecord, error) {
+	var out platform.DatabaseRecord
+	if _, err := c.Do(ctx, http.MethodPost, "/platform/databases", nil, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetDatabase returns a tenant database.
+func (c *Client) GetDatabase(ctx context.Context, id string) (*platform.DatabaseRecord, error) {
+	var out platform.DatabaseRecord
+	if _, err := c.Do(ctx, http.MethodGet, "/platform/databases/"+id, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteDatabase deletes a tenant database.
+func (c *Client) DeleteDatabase(ctx context.Context, id string) error {
+	_, err := c.Do(ctx, http.MethodDelete, "/platform/databases/"+id, nil, nil, nil)
+	return err
+}
+
+// MustCreateDefinition creates a definition or fails the test.
+func (c *Client) MustCreateDefinition(t testing.TB, req platform.CreateDefinitionRequest) *platform.Definition {
+	t.Helper()
+	def, err := c.CreateDefinition(context.Background(), req)
+	if err != nil {
+		t.Fatalf("atomictest: create definition %s: %v", req.Name, err)
+	}
+	return def
+}
+
+// MustCreateDatabase creates a tenant database or fails the test.
+func (c *Client) MustCreateDatabase(t testing.TB, req platform.CreateDatabaseRequest) *platform.DatabaseRecord {
+	t.Helper()
+	db, err := c.CreateDatabase(context.Background(), req)
+	if err != nil {
+		t.Fatalf("atomictest: create database %s: %v", req.ID, err)
+	}
+	return db
+}
+
+// Database returns a client for Data API requests routed by a Database header
+// value such as "global:<id>" or "org:<id>". An empty target uses the session
+// user's own database.
+func (c *Client) Database(target string) *DatabaseClient {
+	return &DatabaseClient{client: c, target: target}
+}
+
+// DatabaseClient issues Data API requests against one database.
+type DatabaseClient struct {
+	client *Client
+	target string
+}
+
+func (d *DatabaseClient) query(ctx context.Context, table, prefer string, body, out any) (*http.Response, error) {
+	header := http.Header{}
+	header.Set("Prefer", prefer)
+	if d.target != "" {
+		header.Set("Database", d.target)
+	}
+	return d.client.Do(ctx, http.MethodPost, "/data/query/"+table, header, body, out)
+}
+
+// Select returns the rows matching query.
+func (d *DatabaseClient) Select(ctx context.Context, table string, query data.SelectQuery) ([]map[string]any, error) {
+	rows := []map[string]any{}
+	_, err := d.query(ctx, table, data.PreferOperationSelect, query, &rows)
+	return rows, err
+}
+
+// SelectCount returns the rows matching query and the total count ignoring its limit.
+func (d *DatabaseClient) SelectCount(ctx context.Context, table string, query data.SelectQuery) ([]map[string]any, int64, error) {
+	rows := []map[string]any{}
+	resp, err := d.query(ctx, table, data.PreferOperationSelect+", "+data.PreferCountExact, query, &rows)
+	if err != nil {
+		return nil, 0, err
+	}
+	count, _ := strconv.ParseInt(resp.Header.Get("X-Total-Count"), 10, 64)
+	return rows, count, nil
+}
+
+// Insert inserts rows. The result holds the returned rows when req.Returning
+// is set, and last_insert_id otherwise.
+func (d *DatabaseClient) Insert(ctx context.Context, table string, req data.InsertRequest) (json.RawMessage, error) {
+	var out json.RawMessage
+	_, err := d.query(ctx, table, "operation=insert", req, &out)
+	return out, err
+}
+
+// Upsert inserts rows, replacing those whose key already exists. The key is
+// req.OnConflict, or the primary key; with req.IgnoreDuplicates existing rows
+// are kept instead.
+func (d *DatabaseClient) Upsert(ctx context.Context, table string, req data.UpsertRequest) (json.RawMessage, error) {
+	prefer := data.PreferResolutionMerge
+	if req.IgnoreDuplicates {
+		prefer = data.PreferResolutionIgnore
+	}
+	if len(req.OnConflict) > 0 {
+		table += "?on_conflict=" + url.QueryEscape(strings.Join(req.OnConflict, ","))
+	}
+	var out json.RawMessage
+	_, err := d.query(ctx, table, "operation=insert, "+prefer, req, &out)
+	return out, err
+}
+
+// Update updates the rows matching req.Where and returns how many changed.
+func (d *DatabaseClient) Update(ctx context.Context, table string, req data.UpdateRequest) (int64, error) {
+	var out struct {
+		RowsAffected int64 `json:"rows_affected"`
+	}
+	_, err := d.query(ctx, table, "operation=update", req, &out)
+	return out.RowsAffected, err
+}
+
+// Delete deletes the rows matching req.Where and returns how many were removed.
+func (d *DatabaseClient) Delete(ctx context.Context, table string, req data.DeleteRequest) (int64, error) {
+	var out struct {
+		RowsAffected int64 `json:"rows_affected"`
+	}
+	_, err := d.query(ctx, table, "operation=delete", req, &out)
+	return out.RowsAffected, err
+}
+
+// Batch runs operations in one transaction.
+func (d *DatabaseClient) Batch(ctx context.Context, req data.BatchRequest) (*data.BatchResponse, error) {
+	header := http.Header{}
+	if d.target != "" {
+		header.Set("Database", d.target)
+	}
+	var out data.BatchResponse
+	if _, err := d.client.Do(ctx, http.MethodPost, "/data/batch", header, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
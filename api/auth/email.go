@@ -3,10 +3,10 @@ package auth
 import (
 	"context"
 	"fmt"
-	"net/smtp"
 	"strings"
 
 	"github.com/atombasedev/atombase/config"
+	"github.com/atombasedev/atombase/tools"
 )
 
 type outboundEmail struct {
@@ -17,42 +17,8 @@ type outboundEmail struct {
 
 var sendEmailFn = sendEmail
 
-func sendEmail(_ context.Context, msg outboundEmail) error {
-	msg.To = strings.TrimSpace(msg.To)
-	msg.Subject = strings.TrimSpace(msg.Subject)
-	if msg.To == "" {
-		return fmt.Errorf("email recipient is required")
-	}
-	if msg.Subject == "" {
-		return fmt.Errorf("email subject is required")
-	}
-
-	from := strings.TrimSpace(config.Cfg.SMTPFrom)
-	host := strings.TrimSpace(config.Cfg.SMTPHost)
-	if from == "" || host == "" {
-		fmt.Printf("Outgoing email\nTo: %s\nSubject: %s\n\n%s\n", msg.To, msg.Subject, msg.Text)
-		return nil
-	}
-
-	addr := fmt.Sprintf("%s:%d", host, config.Cfg.SMTPPort)
-	body := strings.ReplaceAll(msg.Text, "\r\n", "\n")
-	body = strings.ReplaceAll(body, "\n", "\r\n")
-	raw := strings.Join([]string{
-		fmt.Sprintf("From: %s", from),
-		fmt.Sprintf("To: %s", msg.To),
-		fmt.Sprintf("Subject: %s", msg.Subject),
-		"MIME-Version: 1.0",
-		"Content-Type: text/plain; charset=UTF-8",
-		"",
-		body,
-	}, "\r\n")
-
-	var auth smtp.Auth
-	if config.Cfg.SMTPUsername != "" {
-		auth = smtp.PlainAuth("", config.Cfg.SMTPUsername, config.Cfg.SMTPPassword, host)
-	}
-
-	return smtp.SendMail(addr, auth, from, []string{msg.To}, []byte(raw))
+func sendEmail(ctx context.Context, msg outboundEmail) error {
+	return tools.SendEmail(ctx, tools.Email{To: msg.To, Subject: msg.Subject, Text: msg.Text})
 }
 
 func buildOrganizationInviteEmail(org *Organization, invite *OrganizationInvite) outboundEmail {
@@ -90,6 +56,31 @@ func buildOrganizationInviteEmail(org *Organization, invite *OrganizationInvite)
 	}
 }
 
+func buildOTPEmail(email, code string) outboundEmail {
+	lines := []string{
+		"Enter this code to sign in to Atomicbase:",
+		"",
+		code,
+		"",
+		fmt.Sprintf("This code expires in %s and can be used once.", expiryText(config.Cfg.AuthOTPTTL)),
+		"If you did not request this code, you can ignore this email.",
+	}
+
+	return outboundEmail{
+		To:      NormalizeEmail(email),
+		Subject: "Your Atomicbase sign-in code",
+		Text:    strings.Join(lines, "\n"),
+	}
+}
+
+// expiryText renders a lifetime in seconds for an email, in minutes.
+func expiryText(seconds int) string {
+	if minutes := max(seconds/60, 1); minutes != 1 {
+		return fmt.Sprintf("%d minutes", minutes)
+	}
+	return "1 minute"
+}
+
 func buildMagicLinkEmail(email, token string) outboundEmail {
 	url := buildMagicLinkURL(token)
 	lines := []string{
@@ -97,7 +88,7 @@ func buildMagicLinkEmail(email, token string) outboundEmail {
 		"",
 		url,
 		"",
-		"This link expires in 15 minutes.",
+		fmt.Sprintf("This link expires in %s.", expiryText(config.Cfg.AuthMagicLinkTTL)),
 		"If you did not request this login link, you can ignore this email.",
 	}
 
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"net/http"
 
+	"github.com/atombasedev/atombase/config"
 	"github.com/atombasedev/atombase/tools"
 )
 
@@ -35,8 +36,9 @@ type OrganizationResolver interface {
 }
 
 type API struct {
-	db    *sql.DB
-	store OrganizationResolver
+	db       *sql.DB
+	store    OrganizationResolver
+	attempts *attemptTracker
 }
 
 type orgActor struct {
@@ -47,14 +49,29 @@ type orgActor struct {
 
 func NewAPI(store OrganizationResolver) *API {
 	if store == nil {
-		return &API{}
+		return &API{attempts: newAttemptTracker()}
 	}
-	return &API{db: store.DB(), store: store}
+	return &API{db: store.DB(), store: store, attempts: newAttemptTracker()}
 }
 
 func (api *API) RegisterRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("POST /auth/magic-link/start", api.withBody(api.handleMagicLinkStart))
 	mux.HandleFunc("GET /auth/magic-link/complete", api.handleMagicLinkComplete)
+	mux.HandleFunc("POST /auth/otp/start", api.withBody(api.handleOTPStart))
+	mux.HandleFunc("POST /auth/otp/complete", api.withBody(api.handleOTPComplete))
+	mux.HandleFunc("GET /auth/oauth/{provider}/start", api.handleOAuthStart)
+	mux.HandleFunc("GET /auth/oauth/{provider}/callback", api.handleOAuthCallback)
+	mux.HandleFunc("POST /auth/oauth/{provider}/callback", api.withBody(api.handleOAuthCallback))
+	mux.HandleFunc("GET /auth/identities", api.handleListIdentities)
+	mux.HandleFunc("POST /auth/identities/{provider}", api.handleLinkIdentity)
+	mux.HandleFunc("DELETE /auth/identities/{identityID}", api.handleUnlinkIdentity)
+	mux.HandleFunc("POST /auth/mfa/verify", api.withBody(api.handleVerifyMFA))
+	mux.HandleFunc("GET /auth/mfa", api.handleGetMFA)
+	mux.HandleFunc("POST /auth/mfa/totp", api.handleBeginTOTP)
+	mux.HandleFunc("POST /auth/mfa/totp/confirm", api.withBody(api.handleConfirmTOTP))
+	mux.HandleFunc("POST /auth/mfa/totp/disable", api.withBody(api.handleDisableTOTP))
+	mux.HandleFunc("POST /auth/mfa/backup-codes", api.withBody(api.handleRegenerateBackupCodes))
+	mux.HandleFunc("DELETE /auth/users/{userID}/mfa", api.handleResetMFA)
 	mux.HandleFunc("POST /auth/signout", api.handleSignout)
 	mux.HandleFunc("GET /auth/me", api.handleMe)
 	mux.HandleFunc("POST /auth/me/database", api.withBody(api.handleCreateUserDatabase))
@@ -84,15 +101,39 @@ func (api *API) withBody(handler http.HandlerFunc) http.HandlerFunc {
 
 // POST /auth/magic-link/start
 func (api *API) handleMagicLinkStart(w http.ResponseWriter, r *http.Request) {
+	api.startEmailLogin(w, r, BeginMagicLogin, "magic link sent")
+}
+
+// POST /auth/otp/start
+func (api *API) handleOTPStart(w http.ResponseWriter, r *http.Request) {
+	api.startEmailLogin(w, r, BeginOTPLogin, "code sent")
+}
+
+// startEmailLogin emails a magic link or code. Every request counts against
+// the email and the client IP; once either passes its limit it is locked out
+// for a while.
+func (api *API) startEmailLogin(w http.ResponseWriter, r *http.Request, begin func(string, *sql.DB, context.Context) error, message string) {
 	var req struct {
-		Email string `json:"email"`
+		Email   string `json:"email"`
+		Captcha string `json:"captcha"`
 	}
 	if err := tools.DecodeJSON(r.Body, &req); err != nil {
 		tools.RespErr(w, tools.ErrInvalidJSON)
 		return
 	}
 
-	if err := BeginMagicLogin(req.Email, api.db, r.Context()); err != nil {
+	ipKey, emailKey := "ip:"+tools.ClientIP(r), "email:"+NormalizeEmail(req.Email)
+	if api.lockedOut(w, ipKey, emailKey) {
+		return
+	}
+	api.countAttempt(r.Context(), ipKey, config.Cfg.AuthMaxIPAttempts)
+	api.countAttempt(r.Context(), emailKey, config.Cfg.AuthMaxAttempts)
+	if err := verifyCaptcha(r.Context(), req.Captcha, tools.ClientIP(r)); err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+
+	if err := begin(req.Email, api.db, r.Context()); err != nil {
 		if err == ErrInvalidEmail {
 			tools.RespErr(w, tools.InvalidRequestErr("invalid email"))
 			return
@@ -102,27 +143,84 @@ func (api *API) handleMagicLinkStart(w http.ResponseWriter, r *http.Request) {
 	}
 
 	tools.RespondJSON(w, http.StatusOK, map[string]string{
-		"message": "magic link sent",
+		"message": message,
 	})
 }
 
 // GET /auth/magic-link/complete?token=...
+//
+// Invalid tokens count against the client IP, so guessing them locks it out.
 func (api *API) handleMagicLinkComplete(w http.ResponseWriter, r *http.Request) {
 	token := r.URL.Query().Get("token")
 	if token == "" {
 		tools.RespErr(w, tools.InvalidRequestErr("token is required"))
 		return
 	}
+	ipKey := "ip:" + tools.ClientIP(r)
+	if api.lockedOut(w, ipKey) {
+		return
+	}
 
 	user, session, isNew, err := CompleteMagicLink(token, api.db, r.Context())
-	if err != nil {
-		if err == ErrInvalidOrExpiredMagicLink {
-			tools.RespErr(w, tools.UnauthorizedErr("invalid or expired magic link"))
+	if err == ErrInvalidOrExpiredMagicLink {
+		api.countAttempt(r.Context(), ipKey, config.Cfg.AuthMaxIPAttempts)
+		tools.RespErr(w, tools.UnauthorizedErr("invalid or expired magic link"))
+		return
+	}
+	api.respondSignIn(w, r, user, session, isNew, err)
+}
+
+// POST /auth/otp/complete
+//
+// Wrong codes count against the client IP like invalid magic links.
+func (api *API) handleOTPComplete(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+		Code  string `json:"code"`
+	}
+	if err := tools.DecodeJSON(r.Body, &req); err != nil {
+		tools.RespErr(w, tools.ErrInvalidJSON)
+		return
+	}
+	if req.Email == "" || req.Code == "" {
+		tools.RespErr(w, tools.InvalidRequestErr("email and code are required"))
+		return
+	}
+	ipKey := "ip:" + tools.ClientIP(r)
+	if api.lockedOut(w, ipKey) {
+		return
+	}
+
+	user, session, isNew, err := CompleteOTPLogin(req.Email, req.Code, api.db, r.Context())
+	if err == ErrInvalidOrExpiredOTP {
+		api.countAttempt(r.Context(), ipKey, config.Cfg.AuthMaxIPAttempts)
+		tools.RespErr(w, tools.UnauthorizedErr("invalid or expired code"))
+		return
+	}
+	api.respondSignIn(w, r, user, session, isNew, err)
+}
+
+// respondSignIn answers a completed sign-in with the new session, or
+// with a challenge when the user has a second factor.
+func (api *API) respondSignIn(w http.ResponseWriter, r *http.Request, user *User, session *Session, isNew bool, err error) {
+	if err == ErrMFARequired {
+		challenge, expiresAt, err := createMFAChallenge(user.ID, api.db, r.Context())
+		if err != nil {
+			tools.RespErr(w, err)
 			return
 		}
+		tools.RespondJSON(w, http.StatusOK, map[string]any{
+			"mfa_required": true,
+			"challenge":    challenge,
+			"expires_at":   expiresAt,
+		})
+		return
+	}
+	if err != nil {
 		tools.RespErr(w, err)
 		return
 	}
+	api.attempts.reset("email:" + user.Email)
 
 	tools.RespondJSON(w, http.StatusOK, map[string]any{
 		"user":       user,
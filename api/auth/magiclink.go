@@ -38,7 +38,8 @@ func BeginMagicLogin(email string, db *sql.DB, ctx context.Context) error {
 	tokenHash := shaHash(token)
 	id := ID128()
 
-	_, err := db.ExecContext(ctx, SaveMagicLink, id, email, tokenHash, now.Unix(), now.Add(15*time.Minute).Unix())
+	ttl := time.Duration(config.Cfg.AuthMagicLinkTTL) * time.Second
+	_, err := db.ExecContext(ctx, SaveMagicLink, id, email, tokenHash, now.Unix(), now.Add(ttl).Unix())
 
 	if err != nil {
 		return err
@@ -88,12 +89,28 @@ func CompleteMagicLink(token string, db *sql.DB, ctx context.Context) (*User, *S
 	if err != nil {
 		return nil, nil, false, err
 	}
+	return signInEmail(email, db, ctx)
+}
 
+// signInEmail signs in the owner of a verified email, creating the user on
+// first sign-in.
+func signInEmail(email string, db *sql.DB, ctx context.Context) (*User, *Session, bool, error) {
 	// Find or create user
 	user, isNew, err := FindOrCreateUser(email, db, ctx)
 	if err != nil {
 		return nil, nil, false, err
 	}
+	return startSession(user, isNew, db, ctx)
+}
+
+// startSession opens a session for a user who passed the first factor.
+func startSession(user *User, isNew bool, db *sql.DB, ctx context.Context) (*User, *Session, bool, error) {
+	// A second factor turns the session into a challenge; see CompleteMFAChallenge.
+	if enabled, err := TOTPEnabled(user.ID, db, ctx); err != nil {
+		return nil, nil, false, err
+	} else if enabled {
+		return user, nil, isNew, ErrMFARequired
+	}
 
 	// Create and save session
 	session := CreateSession(user.ID)
@@ -0,0 +1,547 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/atombasedev/atombase/config"
+	"github.com/atombasedev/atombase/tools"
+)
+
+// TOTP parameters (RFC 6238 defaults, which every authenticator app accepts).
+const (
+	totpPeriod = 30 * time.Second
+	totpDigits = 6
+	totpSkew   = 1 // Periods accepted either side of now, for clock drift
+)
+
+const (
+	backupCodeCount       = 10
+	mfaChallengeExpiresIn = 5 * time.Minute
+	mfaChallengeAttempts  = 5
+)
+
+var (
+	ErrMFARequired         = errors.New("second factor required")
+	ErrInvalidMFACode      = errors.New("invalid code")
+	ErrInvalidMFAChallenge = errors.New("invalid or expired mfa challenge")
+	ErrTOTPNotEnrolled     = errors.New("totp is not enabled")
+	ErrTOTPAlreadyEnabled  = errors.New("totp is already enabled")
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// TOTPEnrollment is what an authenticator app needs to add the account.
+type TOTPEnrollment struct {
+	Secret     string `json:"secret"`      // Base32, for manual entry
+	OTPAuthURL string `json:"otpauth_url"` // For a QR code
+}
+
+// MFAStatus describes a user's second factors.
+type MFAStatus struct {
+	TOTPEnabled          bool `json:"totp_enabled"`
+	BackupCodesRemaining int  `json:"backup_codes_remaining"`
+}
+
+// totpCode returns the code of secret for counter (RFC 4226).
+func totpCode(secret []byte, counter uint64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1_000_000)
+}
+
+// matchTOTP returns the counter code matches at now, within the skew, and
+// whether it matched one after lastCounter. Accepting each counter once
+// stops a code that was seen from being replayed.
+func matchTOTP(secret []byte, code string, lastCounter int64, now time.Time) (int64, bool) {
+	current := now.Unix() / int64(totpPeriod/time.Second)
+	for counter := current - totpSkew; counter <= current+totpSkew; counter++ {
+		if counter <= lastCounter {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(totpCode(secret, uint64(counter))), []byte(code)) == 1 {
+			return counter, true
+		}
+	}
+	return 0, false
+}
+
+// sealTOTPSecret encrypts a secret with the platform key when one is set,
+// as database tokens are.
+func sealTOTPSecret(secret []byte) ([]byte, error) {
+	if !tools.EncryptionEnabled() {
+		return secret, nil
+	}
+	return tools.Encrypt(secret)
+}
+
+func openTOTPSecret(stored []byte) ([]byte, error) {
+	if !tools.EncryptionEnabled() {
+		return stored, nil
+	}
+	secret, err := tools.Decrypt(stored)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt totp secret: %w", err)
+	}
+	return secret, nil
+}
+
+// BeginTOTPEnrollment creates a new, unconfirmed TOTP secret for the user,
+// replacing an earlier unconfirmed one. It is not asked for at sign-in until
+// ConfirmTOTPEnrollment succeeds.
+func BeginTOTPEnrollment(user *User, db *sql.DB, ctx context.Context) (*TOTPEnrollment, error) {
+	if enabled, err := TOTPEnabled(user.ID, db, ctx); err != nil {
+		return nil, err
+	} else if enabled {
+		return nil, ErrTOTPAlreadyEnabled
+	}
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	stored, err := sealTOTPSecret(secret)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.ExecContext(ctx, `
+		INSERT INTO atombase_user_totp (user_id, secret_encrypted, created_at)
+		VALUES (?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET
+			secret_encrypted = excluded.secret_encrypted,
+			last_counter = 0,
+			created_at = excluded.created_at`,
+		user.ID, stored, time.Now().UTC().Format(time.RFC3339),
+	); err != nil {
+		return nil, err
+	}
+
+	encoded := totpEncoding.EncodeToString(secret)
+	issuer := config.Cfg.AuthTOTPIssuer
+	query := url.Values{
+		"secret": {encoded},
+		"issuer": {issuer},
+		"digits": {fmt.Sprint(totpDigits)},
+		"period": {fmt.Sprint(int(totpPeriod / time.Second))},
+	}
+	label := url.PathEscape(issuer + ":" + user.Email)
+	return &TOTPEnrollment{
+		Secret:     encoded,
+		OTPAuthURL: "otpauth://totp/" + label + "?" + query.Encode(),
+	}, nil
+}
+
+// ConfirmTOTPEnrollment enables TOTP once the user proves their app has the
+// secret, returning a fresh set of backup codes.
+func ConfirmTOTPEnrollment(userID, code string, db *sql.DB, ctx context.Context) ([]string, error) {
+	if err := verifyTOTP(userID, code, false, db, ctx); err != nil {
+		return nil, err
+	}
+	if _, err := db.ExecContext(ctx,
+		`UPDATE atombase_user_totp SET confirmed_at = ? WHERE user_id = ?`,
+		time.Now().UTC().Format(time.RFC3339), userID,
+	); err != nil {
+		return nil, err
+	}
+	return RegenerateBackupCodes(userID, db, ctx)
+}
+
+// TOTPEnabled reports whether sign-in asks the user for a second factor.
+func TOTPEnabled(userID string, db *sql.DB, ctx context.Context) (bool, error) {
+	var enabled bool
+	err := db.QueryRowContext(ctx,
+		`SELECT confirmed_at IS NOT NULL FROM atombase_user_totp WHERE user_id = ?`, userID,
+	).Scan(&enabled)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return enabled, err
+}
+
+// verifyTOTP checks code against the user's secret, confirmed or, when
+// confirmed is false, still awaiting confirmation.
+func verifyTOTP(userID, code string, confirmed bool, db *sql.DB, ctx context.Context) error {
+	var stored []byte
+	var lastCounter int64
+	var confirmedAt sql.NullString
+	err := db.QueryRowContext(ctx,
+		`SELECT secret_encrypted, last_counter, confirmed_at FROM atombase_user_totp WHERE user_id = ?`, userID,
+	).Scan(&stored, &lastCounter, &confirmedAt)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && confirmedAt.Valid != confirmed) {
+		return ErrTOTPNotEnrolled
+	}
+	if err != nil {
+		return err
+	}
+	secret, err := openTOTPSecret(stored)
+	if err != nil {
+		return err
+	}
+	counter, ok := matchTOTP(secret, strings.TrimSpace(code), lastCounter, time.Now())
+	if !ok {
+		return ErrInvalidMFACode
+	}
+	// The guard on last_counter makes two concurrent uses of one code race
+	// for the same row; only one wins.
+	result, err := db.ExecContext(ctx,
+		`UPDATE atombase_user_totp SET last_counter = ? WHERE user_id = ? AND last_counter < ?`,
+		counter, userID, counter,
+	)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+// VerifySecondFactor accepts a current TOTP code or an unused backup code,
+// which it uses up.
+func VerifySecondFactor(userID, code string, db *sql.DB, ctx context.Context) error {
+	err := verifyTOTP(userID, code, true, db, ctx)
+	if !errors.Is(err, ErrInvalidMFACode) {
+		return err
+	}
+	result, err := db.ExecContext(ctx,
+		`DELETE FROM atombase_user_backup_codes WHERE user_id = ? AND code_hash = ?`,
+		userID, shaHash(normalizeBackupCode(code)),
+	)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+// RegenerateBackupCodes replaces the user's backup codes. Only their hashes
+// are kept, so the codes are shown this once.
+func RegenerateBackupCodes(userID string, db *sql.DB, ctx context.Context) ([]string, error) {
+	codes := make([]string, backupCodeCount)
+	for i := range codes {
+		raw := make([]byte, 6)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(totpEncoding.EncodeToString(raw))[:10]
+		codes[i] = code[:5] + "-" + code[5:]
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `DELETE FROM atombase_user_backup_codes WHERE user_id = ?`, userID); err != nil {
+		return nil, err
+	}
+	for _, code := range codes {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO atombase_user_backup_codes (user_id, code_hash) VALUES (?, ?)`,
+			userID, shaHash(normalizeBackupCode(code)),
+		); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// normalizeBackupCode accepts codes typed with or without the dash, in any
+// case.
+func normalizeBackupCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+}
+
+// GetMFAStatus reports the user's second factors.
+func GetMFAStatus(userID string, db *sql.DB, ctx context.Context) (*MFAStatus, error) {
+	enabled, err := TOTPEnabled(userID, db, ctx)
+	if err != nil {
+		return nil, err
+	}
+	status := &MFAStatus{TOTPEnabled: enabled}
+	if err := db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM atombase_user_backup_codes WHERE user_id = ?`, userID,
+	).Scan(&status.BackupCodesRemaining); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// ResetMFA removes the user's TOTP secret and backup codes, so they sign in
+// with email alone until they enroll again.
+func ResetMFA(userID string, db *sql.DB, ctx context.Context) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `DELETE FROM atombase_user_totp WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM atombase_user_backup_codes WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// createMFAChallenge records that the user passed the first factor and
+// returns the token that completes sign-in with the second.
+func createMFAChallenge(userID string, db *sql.DB, ctx context.Context) (string, time.Time, error) {
+	token := ID256()
+	now := time.Now().UTC()
+	expiresAt := now.Add(mfaChallengeExpiresIn)
+	if _, err := db.ExecContext(ctx,
+		`INSERT INTO atombase_mfa_challenges (token_hash, user_id, attempts, expires_at) VALUES (?, ?, 0, ?)`,
+		shaHash(token), userID, expiresAt.Unix(),
+	); err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expiresAt, nil
+}
+
+// CompleteMFAChallenge checks code for the challenge's user and, when it is
+// right, ends the challenge with a session. A challenge allows a few wrong
+// codes before it is dropped and sign-in must start over.
+func CompleteMFAChallenge(challenge, code string, db *sql.DB, ctx context.Context) (*User, *Session, error) {
+	var userID string
+	err := db.QueryRowContext(ctx,
+		`UPDATE atombase_mfa_challenges SET attempts = attempts + 1
+		 WHERE token_hash = ? AND expires_at > ? AND attempts < ?
+		 RETURNING user_id`,
+		shaHash(challenge), time.Now().UTC().Unix(), mfaChallengeAttempts,
+	).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, ErrInvalidMFAChallenge
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := VerifySecondFactor(userID, code, db, ctx); err != nil {
+		return nil, nil, err
+	}
+	if _, err := db.ExecContext(ctx, `DELETE FROM atombase_mfa_challenges WHERE token_hash = ?`, shaHash(challenge)); err != nil {
+		return nil, nil, err
+	}
+
+	user, err := GetUserByID(userID, db, ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	session := CreateSession(user.ID)
+	if err := SaveSession(session, db, ctx); err != nil {
+		return nil, nil, err
+	}
+	if _, err := db.ExecContext(ctx, `UPDATE atombase_sessions SET mfa_verified = 1 WHERE id = ?`, session.Id); err != nil {
+		return nil, nil, err
+	}
+	return user, session, nil
+}
+
+// GET /auth/mfa
+func (api *API) handleGetMFA(w http.ResponseWriter, r *http.Request) {
+	session, err := api.getSession(r)
+	if err != nil {
+		tools.RespErr(w, tools.UnauthorizedErr("invalid session"))
+		return
+	}
+	status, err := GetMFAStatus(session.UserID, api.db, r.Context())
+	if err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	tools.RespondJSON(w, http.StatusOK, status)
+}
+
+// POST /auth/mfa/totp
+func (api *API) handleBeginTOTP(w http.ResponseWriter, r *http.Request) {
+	session, err := api.getSession(r)
+	if err != nil {
+		tools.RespErr(w, tools.UnauthorizedErr("invalid session"))
+		return
+	}
+	user, err := GetUserByID(session.UserID, api.db, r.Context())
+	if err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	enrollment, err := BeginTOTPEnrollment(user, api.db, r.Context())
+	if err != nil {
+		tools.RespErr(w, mfaErr(err))
+		return
+	}
+	tools.RespondJSON(w, http.StatusOK, enrollment)
+}
+
+// mfaCodeRequest is the body of the routes that take a code.
+type mfaCodeRequest struct {
+	Challenge string `json:"challenge"`
+	Code      string `json:"code"`
+}
+
+// decodeMFACode reads a code request and the caller's session.
+func (api *API) decodeMFACode(w http.ResponseWriter, r *http.Request) (*Session, string, bool) {
+	session, err := api.getSession(r)
+	if err != nil {
+		tools.RespErr(w, tools.UnauthorizedErr("invalid session"))
+		return nil, "", false
+	}
+	var req mfaCodeRequest
+	if err := tools.DecodeJSON(r.Body, &req); err != nil {
+		tools.RespErr(w, tools.ErrInvalidJSON)
+		return nil, "", false
+	}
+	if req.Code == "" {
+		tools.RespErr(w, tools.InvalidRequestErr("code is required"))
+		return nil, "", false
+	}
+	return session, req.Code, true
+}
+
+// POST /auth/mfa/totp/confirm
+func (api *API) handleConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	session, code, ok := api.decodeMFACode(w, r)
+	if !ok {
+		return
+	}
+	codes, err := ConfirmTOTPEnrollment(session.UserID, code, api.db, r.Context())
+	if err != nil {
+		tools.RespErr(w, mfaErr(err))
+		return
+	}
+	tools.RespondJSON(w, http.StatusOK, map[string]any{"backup_codes": codes})
+}
+
+// POST /auth/mfa/totp/disable
+func (api *API) handleDisableTOTP(w http.ResponseWriter, r *http.Request) {
+	session, code, ok := api.decodeMFACode(w, r)
+	if !ok {
+		return
+	}
+	if err := VerifySecondFactor(session.UserID, code, api.db, r.Context()); err != nil {
+		tools.RespErr(w, mfaErr(err))
+		return
+	}
+	if err := ResetMFA(session.UserID, api.db, r.Context()); err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// POST /auth/mfa/backup-codes
+func (api *API) handleRegenerateBackupCodes(w http.ResponseWriter, r *http.Request) {
+	session, code, ok := api.decodeMFACode(w, r)
+	if !ok {
+		return
+	}
+	if err := verifyTOTP(session.UserID, code, true, api.db, r.Context()); err != nil {
+		tools.RespErr(w, mfaErr(err))
+		return
+	}
+	codes, err := RegenerateBackupCodes(session.UserID, api.db, r.Context())
+	if err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	tools.RespondJSON(w, http.StatusOK, map[string]any{"backup_codes": codes})
+}
+
+// POST /auth/mfa/verify
+//
+// Wrong codes count against the client IP like invalid magic links.
+func (api *API) handleVerifyMFA(w http.ResponseWriter, r *http.Request) {
+	var req mfaCodeRequest
+	if err := tools.DecodeJSON(r.Body, &req); err != nil {
+		tools.RespErr(w, tools.ErrInvalidJSON)
+		return
+	}
+	if req.Challenge == "" || req.Code == "" {
+		tools.RespErr(w, tools.InvalidRequestErr("challenge and code are required"))
+		return
+	}
+	ipKey := "ip:" + tools.ClientIP(r)
+	if api.lockedOut(w, ipKey) {
+		return
+	}
+	user, session, err := CompleteMFAChallenge(req.Challenge, req.Code, api.db, r.Context())
+	if err != nil {
+		if errors.Is(err, ErrInvalidMFACode) || errors.Is(err, ErrInvalidMFAChallenge) {
+			api.countAttempt(r.Context(), ipKey, config.Cfg.AuthMaxIPAttempts)
+		}
+		tools.RespErr(w, mfaErr(err))
+		return
+	}
+	api.attempts.reset("email:" + user.Email)
+
+	tools.RespondJSON(w, http.StatusOK, map[string]any{
+		"user":       user,
+		"token":      session.Token(),
+		"expires_at": session.ExpiresAt,
+		"is_new":     false,
+	})
+}
+
+// DELETE /auth/users/{userID}/mfa
+//
+// Service only: lets an operator recover a user who lost both their
+// authenticator and backup codes.
+func (api *API) handleResetMFA(w http.ResponseWriter, r *http.Request) {
+	if tools.GetAuthContext(r.Context()).Role != tools.RoleService {
+		tools.RespErr(w, tools.UnauthorizedErr("service key required"))
+		return
+	}
+	userID := r.PathValue("userID")
+	if _, err := GetUserByID(userID, api.db, r.Context()); err != nil {
+		if errors.Is(err, ErrInvalidSession) {
+			tools.RespErr(w, tools.InvalidRequestErr("user not found"))
+			return
+		}
+		tools.RespErr(w, err)
+		return
+	}
+	if err := ResetMFA(userID, api.db, r.Context()); err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	if recorder, ok := api.store.(AuditRecorder); ok {
+		if err := recorder.RecordAudit(r.Context(), "auth.mfa_reset", "user:"+userID, map[string]any{}); err != nil {
+			log.Printf("mfa reset of %s not audited: %v", userID, err)
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// mfaErr maps second factor errors to API errors.
+func mfaErr(err error) error {
+	switch {
+	case errors.Is(err, ErrInvalidMFACode):
+		return tools.UnauthorizedErr("invalid code")
+	case errors.Is(err, ErrInvalidMFAChallenge):
+		return tools.UnauthorizedErr("invalid or expired mfa challenge; sign in again")
+	case errors.Is(err, ErrTOTPNotEnrolled), errors.Is(err, ErrTOTPAlreadyEnabled):
+		return tools.InvalidRequestErr(err.Error())
+	}
+	return err
+}
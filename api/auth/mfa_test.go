@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/atombasedev/atombase/config"
+	"github.com/atombasedev/atombase/tools"
+)
+
+// The SHA-1 test vector of RFC 6238, truncated to six digits.
+func TestTOTPCode(t *testing.T) {
+	if got := totpCode([]byte("12345678901234567890"), 59/30); got != "287082" {
+		t.Fatalf("got %s, want 287082", got)
+	}
+}
+
+func TestMFASignIn(t *testing.T) {
+	api, store := setupThrottleTest(t)
+	config.Cfg.APIKey = "service-key"
+	mux := http.NewServeMux()
+	api.RegisterRoutes(mux)
+	handler := tools.AuthMiddleware(mux)
+	call := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	ctx := context.Background()
+
+	user, _, err := FindOrCreateUser("ada@example.com", api.db, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := CreateSession(user.ID)
+	if err := SaveSession(session, api.db, ctx); err != nil {
+		t.Fatal(err)
+	}
+	token := string(session.Token())
+
+	rec := call(http.MethodPost, "/auth/mfa/totp", token, "")
+	var enrollment TOTPEnrollment
+	if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &enrollment) != nil ||
+		!strings.HasPrefix(enrollment.OTPAuthURL, "otpauth://totp/") {
+		t.Fatalf("enroll: %d %s", rec.Code, rec.Body.String())
+	}
+	secret, err := totpEncoding.DecodeString(enrollment.Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	counter := uint64(time.Now().Unix() / 30)
+
+	if rec := call(http.MethodPost, "/auth/mfa/totp/confirm", token, `{"code": "000000x"}`); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected a wrong code not to confirm, got %d %s", rec.Code, rec.Body.String())
+	}
+	rec = call(http.MethodPost, "/auth/mfa/totp/confirm", token, `{"code": "`+totpCode(secret, counter)+`"}`)
+	var confirmed struct {
+		BackupCodes []string `json:"backup_codes"`
+	}
+	if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &confirmed) != nil || len(confirmed.BackupCodes) != backupCodeCount {
+		t.Fatalf("confirm: %d %s", rec.Code, rec.Body.String())
+	}
+
+	// Sign-in now stops at a challenge.
+	signIn := func() string {
+		t.Helper()
+		if _, err := api.db.Exec(`INSERT INTO email_magic_links (id, email, token_hash, created_at, expires_at) VALUES ('ml', ?, ?, ?, ?)`,
+			user.Email, shaHash("link"), time.Now().Unix(), time.Now().Add(time.Minute).Unix()); err != nil {
+			t.Fatal(err)
+		}
+		rec := call(http.MethodGet, "/auth/magic-link/complete?token=link", "", "")
+		var pending struct {
+			MFARequired bool   `json:"mfa_required"`
+			Challenge   string `json:"challenge"`
+		}
+		if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &pending) != nil || !pending.MFARequired || pending.Challenge == "" {
+			t.Fatalf("expected an mfa challenge, got %d %s", rec.Code, rec.Body.String())
+		}
+		return pending.Challenge
+	}
+	verify := func(challenge, code string) *httptest.ResponseRecorder {
+		return call(http.MethodPost, "/auth/mfa/verify", "", `{"challenge": "`+challenge+`", "code": "`+code+`"}`)
+	}
+
+	challenge := signIn()
+	if rec := verify(challenge, totpCode(secret, counter)); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected the confirmation code not to be replayed, got %d %s", rec.Code, rec.Body.String())
+	}
+	rec = verify(challenge, totpCode(secret, counter+1))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"token"`) {
+		t.Fatalf("expected the next code to sign in, got %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := verify(challenge, confirmed.BackupCodes[0]); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected a used challenge to be refused, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	challenge = signIn()
+	if rec := verify(challenge, strings.ToUpper(confirmed.BackupCodes[0])); rec.Code != http.StatusOK {
+		t.Fatalf("expected a backup code to sign in, got %d %s", rec.Code, rec.Body.String())
+	}
+	challenge = signIn()
+	if rec := verify(challenge, confirmed.BackupCodes[0]); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected a used backup code to be refused, got %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := call(http.MethodGet, "/auth/mfa", token, ""); !strings.Contains(rec.Body.String(), `"backup_codes_remaining":9`) {
+		t.Fatalf("expected nine backup codes left, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	if rec := call(http.MethodDelete, "/auth/users/"+user.ID+"/mfa", token, ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected a user session not to reset mfa, got %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := call(http.MethodDelete, "/auth/users/"+user.ID+"/mfa", "service.service-key", ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("reset: %d %s", rec.Code, rec.Body.String())
+	}
+	if last := store.actions[len(store.actions)-1]; last != "auth.mfa_reset user:"+user.ID {
+		t.Fatalf("expected the reset to be audited, got %v", store.actions)
+	}
+	if enabled, err := TOTPEnabled(user.ID, api.db, ctx); err != nil || enabled {
+		t.Fatalf("expected totp to be off after the reset, got %v %v", enabled, err)
+	}
+}
@@ -0,0 +1,655 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/atombasedev/atombase/config"
+	"github.com/atombasedev/atombase/tools"
+)
+
+// Social sign-in providers.
+const (
+	ProviderGoogle = "google"
+	ProviderGitHub = "github"
+	ProviderApple  = "apple"
+)
+
+const oauthStateExpiresIn = 10 * time.Minute
+
+var (
+	ErrUnknownProvider            = errors.New("unknown or unconfigured sign-in provider")
+	ErrInvalidOrExpiredOAuthState = errors.New("invalid or expired oauth state")
+	ErrOAuthFailed                = errors.New("provider sign-in failed")
+	ErrUnverifiedEmail            = errors.New("provider did not confirm the account's email")
+	ErrIdentityNotFound           = errors.New("identity not found")
+)
+
+// Identity is a user's account at a social sign-in provider.
+type Identity struct {
+	ID           string     `json:"id"`
+	Provider     string     `json:"provider"`
+	Email        string     `json:"email,omitempty"`
+	LastSignInAt *time.Time `json:"last_sign_in_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// oauthProvider is how sign-in talks to one provider. The endpoints are
+// variables so tests can point them at a fake.
+type oauthProvider struct {
+	AuthURL  string
+	TokenURL string
+	Scope    string
+	Issuers  []string // Accepted ID token issuers; GitHub has no ID token and is asked for the profile instead
+	PKCE     bool
+	FormPost bool // Apple posts the callback when asked for the email
+
+	clientID     func() string
+	clientSecret func() (string, error)
+}
+
+var oauthProviders = map[string]*oauthProvider{
+	ProviderGoogle: {
+		AuthURL:      "https://accounts.google.com/o/oauth2/v2/auth",
+		TokenURL:     "https://oauth2.googleapis.com/token",
+		Scope:        "openid email",
+		Issuers:      []string{"https://accounts.google.com", "accounts.google.com"},
+		PKCE:         true,
+		clientID:     func() string { return config.Cfg.AuthGoogleClientID },
+		clientSecret: func() (string, error) { return config.Cfg.AuthGoogleClientSecret, nil },
+	},
+	ProviderGitHub: {
+		AuthURL:      "https://github.com/login/oauth/authorize",
+		TokenURL:     "https://github.com/login/oauth/access_token",
+		Scope:        "read:user user:email",
+		PKCE:         true,
+		clientID:     func() string { return config.Cfg.AuthGitHubClientID },
+		clientSecret: func() (string, error) { return config.Cfg.AuthGitHubClientSecret, nil },
+	},
+	ProviderApple: {
+		AuthURL:      "https://appleid.apple.com/auth/authorize",
+		TokenURL:     "https://appleid.apple.com/auth/token",
+		Scope:        "email",
+		Issuers:      []string{"https://appleid.apple.com"},
+		FormPost:     true,
+		clientID:     func() string { return config.Cfg.AuthAppleClientID },
+		clientSecret: appleClientSecret,
+	},
+}
+
+var githubAPIURL = "https://api.github.com"
+
+var oauthClient = &http.Client{Timeout: 10 * time.Second}
+
+// lookupProvider returns a provider that has a client ID configured.
+func lookupProvider(name string) (*oauthProvider, string, error) {
+	provider, ok := oauthProviders[name]
+	if !ok {
+		return nil, "", ErrUnknownProvider
+	}
+	clientID := provider.clientID()
+	if clientID == "" {
+		return nil, "", ErrUnknownProvider
+	}
+	return provider, clientID, nil
+}
+
+func oauthRedirectURI(provider string) string {
+	return strings.TrimRight(config.Cfg.ApiURL, "/") + "/auth/oauth/" + provider + "/callback"
+}
+
+// BeginOAuth returns the provider URL a sign-in starts at. With a userID the
+// callback links the provider account to that user instead of signing in.
+func BeginOAuth(provider, userID string, db *sql.DB, ctx context.Context) (string, error) {
+	p, clientID, err := lookupProvider(provider)
+	if err != nil {
+		return "", err
+	}
+	state, nonce, verifier := ID256(), ID256(), ID256()
+	var linkUserID any
+	if userID != "" {
+		linkUserID = userID
+	}
+	expiresAt := time.Now().Add(oauthStateExpiresIn).Unix()
+	if _, err := db.ExecContext(ctx,
+		`INSERT INTO atombase_oauth_states (state_hash, provider, nonce, code_verifier, user_id, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		shaHash(state), provider, nonce, verifier, linkUserID, expiresAt,
+	); err != nil {
+		return "", err
+	}
+
+	query := url.Values{
+		"response_type": {"code"},
+		"client_id":     {clientID},
+		"redirect_uri":  {oauthRedirectURI(provider)},
+		"scope":         {p.Scope},
+		"state":         {state},
+	}
+	if len(p.Issuers) > 0 {
+		query.Set("nonce", nonce)
+	}
+	if p.PKCE {
+		challenge := sha256.Sum256([]byte(verifier))
+		query.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+		query.Set("code_challenge_method", "S256")
+	}
+	if p.FormPost {
+		query.Set("response_mode", "form_post")
+	}
+	return p.AuthURL + "?" + query.Encode(), nil
+}
+
+// CompleteOAuth finishes a sign-in from the provider's callback. A sign-in
+// returns the user and a new session. A link returns the user and the linked
+// identity, and no session.
+func CompleteOAuth(provider, code, state string, db *sql.DB, ctx context.Context) (*User, *Session, bool, *Identity, error) {
+	p, clientID, err := lookupProvider(provider)
+	if err != nil {
+		return nil, nil, false, nil, err
+	}
+	now := time.Now().UTC()
+
+	var nonce, verifier string
+	var linkUserID sql.NullString
+	err = db.QueryRowContext(ctx,
+		`DELETE FROM atombase_oauth_states
+		WHERE state_hash = ? AND provider = ? AND expires_at > ?
+		RETURNING nonce, code_verifier, user_id`,
+		shaHash(state), provider, now.Unix(),
+	).Scan(&nonce, &verifier, &linkUserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, false, nil, ErrInvalidOrExpiredOAuthState
+	}
+	if err != nil {
+		return nil, nil, false, nil, err
+	}
+
+	profile, err := p.redeem(ctx, provider, clientID, code, nonce, verifier, now)
+	if err != nil {
+		return nil, nil, false, nil, err
+	}
+
+	if linkUserID.Valid {
+		identity, err := linkIdentity(linkUserID.String, provider, profile, db, ctx)
+		if err != nil {
+			return nil, nil, false, nil, err
+		}
+		user, err := GetUserByID(linkUserID.String, db, ctx)
+		if err != nil {
+			return nil, nil, false, nil, err
+		}
+		return user, nil, false, identity, nil
+	}
+	user, session, isNew, err := signInIdentity(provider, profile, db, ctx)
+	return user, session, isNew, nil, err
+}
+
+// oauthProfile is what sign-in needs to know about a provider account.
+type oauthProfile struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+}
+
+// redeem exchanges the callback's code and reads the account it signed in.
+func (p *oauthProvider) redeem(ctx context.Context, provider, clientID, code, nonce, verifier string, now time.Time) (oauthProfile, error) {
+	secret, err := p.clientSecret()
+	if err != nil {
+		return oauthProfile{}, err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {oauthRedirectURI(provider)},
+		"client_id":     {clientID},
+		"client_secret": {secret},
+	}
+	if p.PKCE {
+		form.Set("code_verifier", verifier)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return oauthProfile{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	res, err := oauthClient.Do(req)
+	if err != nil {
+		return oauthProfile{}, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return oauthProfile{}, fmt.Errorf("%w: %s token endpoint answered %s", ErrOAuthFailed, provider, res.Status)
+	}
+	// GitHub answers errors with 200 and an error field.
+	var tokens struct {
+		AccessToken string `json:"access_token"`
+		IDToken     string `json:"id_token"`
+		Error       string `json:"error"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&tokens); err != nil {
+		return oauthProfile{}, err
+	}
+	if tokens.Error != "" {
+		return oauthProfile{}, fmt.Errorf("%w: %s", ErrOAuthFailed, tokens.Error)
+	}
+	if len(p.Issuers) > 0 {
+		return idTokenProfile(tokens.IDToken, p.Issuers, clientID, nonce, now)
+	}
+	return githubProfile(ctx, tokens.AccessToken)
+}
+
+// jsonBool reads a boolean claim Apple may send as the string "true".
+type jsonBool bool
+
+func (b *jsonBool) UnmarshalJSON(data []byte) error {
+	*b = strings.Trim(string(data), `"`) == "true"
+	return nil
+}
+
+// idTokenProfile reads the account from an ID token. The token comes
+// straight from the provider's token endpoint over TLS, which OpenID Connect
+// accepts in place of checking its signature.
+func idTokenProfile(idToken string, issuers []string, clientID, nonce string, now time.Time) (oauthProfile, error) {
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return oauthProfile{}, fmt.Errorf("%w: no id token", ErrOAuthFailed)
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return oauthProfile{}, fmt.Errorf("%w: malformed id token", ErrOAuthFailed)
+	}
+	var claims struct {
+		Issuer        string          `json:"iss"`
+		Audience      json.RawMessage `json:"aud"` // A string or an array
+		ExpiresAt     int64           `json:"exp"`
+		Nonce         string          `json:"nonce"`
+		Subject       string          `json:"sub"`
+		Email         string          `json:"email"`
+		EmailVerified jsonBool        `json:"email_verified"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return oauthProfile{}, fmt.Errorf("%w: malformed id token", ErrOAuthFailed)
+	}
+	var audiences []string
+	if err := json.Unmarshal(claims.Audience, &audiences); err != nil {
+		var single string
+		json.Unmarshal(claims.Audience, &single)
+		audiences = []string{single}
+	}
+	switch {
+	case !slices.Contains(issuers, claims.Issuer):
+		return oauthProfile{}, fmt.Errorf("%w: id token from another issuer", ErrOAuthFailed)
+	case !slices.Contains(audiences, clientID):
+		return oauthProfile{}, fmt.Errorf("%w: id token for another client", ErrOAuthFailed)
+	case now.Unix() >= claims.ExpiresAt:
+		return oauthProfile{}, fmt.Errorf("%w: id token expired", ErrOAuthFailed)
+	case subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1:
+		return oauthProfile{}, fmt.Errorf("%w: nonce mismatch", ErrOAuthFailed)
+	case claims.Subject == "":
+		return oauthProfile{}, fmt.Errorf("%w: id token has no subject", ErrOAuthFailed)
+	}
+	return oauthProfile{Subject: claims.Subject, Email: claims.Email, EmailVerified: bool(claims.EmailVerified)}, nil
+}
+
+// githubProfile reads the GitHub account and its primary email, which counts
+// only once GitHub has verified it.
+func githubProfile(ctx context.Context, accessToken string) (oauthProfile, error) {
+	if accessToken == "" {
+		return oauthProfile{}, fmt.Errorf("%w: no access token", ErrOAuthFailed)
+	}
+	var account struct {
+		ID int64 `json:"id"`
+	}
+	if err := githubGet(ctx, accessToken, "/user", &account); err != nil {
+		return oauthProfile{}, err
+	}
+	if account.ID == 0 {
+		return oauthProfile{}, fmt.Errorf("%w: github account has no id", ErrOAuthFailed)
+	}
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := githubGet(ctx, accessToken, "/user/emails", &emails); err != nil {
+		return oauthProfile{}, err
+	}
+	profile := oauthProfile{Subject: strconv.FormatInt(account.ID, 10)}
+	for _, email := range emails {
+		if email.Primary {
+			profile.Email, profile.EmailVerified = email.Email, email.Verified
+		}
+	}
+	return profile, nil
+}
+
+func githubGet(ctx context.Context, accessToken, path string, target any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, githubAPIURL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	res, err := oauthClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: github %s answered %s", ErrOAuthFailed, path, res.Status)
+	}
+	return json.NewDecoder(res.Body).Decode(target)
+}
+
+// appleClientSecret signs the client secret Apple asks for: a short-lived
+// ES256 JWT from the team's key.
+func appleClientSecret() (string, error) {
+	cfg := config.Cfg
+	block, _ := pem.Decode([]byte(cfg.AuthApplePrivateKey))
+	if block == nil {
+		return "", fmt.Errorf("ATOMICBASE_AUTH_APPLE_PRIVATE_KEY is not a PEM key")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return "", fmt.Errorf("ATOMICBASE_AUTH_APPLE_PRIVATE_KEY: %w", err)
+	}
+	key, ok := parsed.(*ecdsa.PrivateKey)
+	if !ok {
+		return "", fmt.Errorf("ATOMICBASE_AUTH_APPLE_PRIVATE_KEY is not an EC key")
+	}
+
+	now := time.Now()
+	header, _ := json.Marshal(map[string]string{"alg": "ES256", "kid": cfg.AuthAppleKeyID})
+	claims, _ := json.Marshal(map[string]any{
+		"iss": cfg.AuthAppleTeamID,
+		"iat": now.Unix(),
+		"exp": now.Add(5 * time.Minute).Unix(),
+		"aud": "https://appleid.apple.com",
+		"sub": cfg.AuthAppleClientID,
+	})
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signingInput))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		return "", err
+	}
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// signInIdentity signs in the user a provider account belongs to. A new
+// account joins the user with its verified email, or a new user; with
+// AuthOAuthLinkByEmail off, an email that already has a user is refused and
+// its owner has to link the account while signed in.
+func signInIdentity(provider string, profile oauthProfile, db *sql.DB, ctx context.Context) (*User, *Session, bool, error) {
+	nowStr := time.Now().UTC().Format(time.RFC3339)
+
+	var userID string
+	err := db.QueryRowContext(ctx,
+		`UPDATE atombase_user_identities SET last_sign_in_at = ?
+		WHERE provider = ? AND subject = ?
+		RETURNING user_id`,
+		nowStr, provider, profile.Subject,
+	).Scan(&userID)
+	if err == nil {
+		user, err := GetUserByID(userID, db, ctx)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		if _, err := db.ExecContext(ctx, `UPDATE atombase_users SET last_sign_in_at = ? WHERE id = ?`, nowStr, userID); err != nil {
+			return nil, nil, false, err
+		}
+		return startSession(user, false, db, ctx)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, false, err
+	}
+
+	email := NormalizeEmail(profile.Email)
+	if !profile.EmailVerified || ValidateEmail(email) != nil {
+		return nil, nil, false, ErrUnverifiedEmail
+	}
+	if !config.Cfg.AuthOAuthLinkByEmail {
+		var exists bool
+		if err := db.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM atombase_users WHERE email = ?)`, email).Scan(&exists); err != nil {
+			return nil, nil, false, err
+		}
+		if exists {
+			return nil, nil, false, fmt.Errorf("%w: %s already has an account; sign in with email and link %s from it", tools.ErrIdentityConflict, email, provider)
+		}
+	}
+	user, isNew, err := FindOrCreateUser(email, db, ctx)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	if _, err := insertIdentity(user.ID, provider, profile, db, ctx); err != nil {
+		return nil, nil, false, err
+	}
+	return startSession(user, isNew, db, ctx)
+}
+
+// linkIdentity adds a provider account to a signed-in user. Linking an
+// account the user already has is a no-op.
+func linkIdentity(userID, provider string, profile oauthProfile, db *sql.DB, ctx context.Context) (*Identity, error) {
+	row := db.QueryRowContext(ctx,
+		`SELECT user_id, id, provider, email, last_sign_in_at, created_at
+		FROM atombase_user_identities WHERE provider = ? AND subject = ?`,
+		provider, profile.Subject,
+	)
+	var owner string
+	identity, err := scanIdentity(row, &owner)
+	if err == nil {
+		if owner != userID {
+			return nil, fmt.Errorf("%w: this %s account is linked to another user", tools.ErrIdentityConflict, provider)
+		}
+		return identity, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	return insertIdentity(userID, provider, profile, db, ctx)
+}
+
+func insertIdentity(userID, provider string, profile oauthProfile, db *sql.DB, ctx context.Context) (*Identity, error) {
+	now := time.Now().UTC()
+	identity := &Identity{ID: ID128(), Provider: provider, Email: NormalizeEmail(profile.Email), LastSignInAt: &now, CreatedAt: now}
+	nowStr := now.Format(time.RFC3339)
+	result, err := db.ExecContext(ctx,
+		`INSERT INTO atombase_user_identities (id, user_id, provider, subject, email, last_sign_in_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(provider, subject) DO NOTHING`,
+		identity.ID, userID, provider, profile.Subject, identity.Email, nowStr, nowStr,
+	)
+	if err != nil {
+		return nil, err
+	}
+	// Another callback for the same account got there first.
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return nil, fmt.Errorf("%w: this %s account is already linked", tools.ErrIdentityConflict, provider)
+	}
+	return identity, nil
+}
+
+type identityScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanIdentity(row identityScanner, userID *string) (*Identity, error) {
+	var identity Identity
+	var email, lastSignInAt sql.NullString
+	var createdAt string
+	if err := row.Scan(userID, &identity.ID, &identity.Provider, &email, &lastSignInAt, &createdAt); err != nil {
+		return nil, err
+	}
+	identity.Email = email.String
+	identity.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
+	if lastSignInAt.Valid {
+		if t, err := time.Parse(time.RFC3339, lastSignInAt.String); err == nil {
+			identity.LastSignInAt = &t
+		}
+	}
+	return &identity, nil
+}
+
+// ListIdentities returns the provider accounts linked to a user.
+func ListIdentities(userID string, db *sql.DB, ctx context.Context) ([]Identity, error) {
+	rows, err := db.QueryContext(ctx,
+		`SELECT user_id, id, provider, email, last_sign_in_at, created_at
+		FROM atombase_user_identities WHERE user_id = ?
+		ORDER BY created_at, id`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	identities := []Identity{}
+	for rows.Next() {
+		var owner string
+		identity, err := scanIdentity(rows, &owner)
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, *identity)
+	}
+	return identities, rows.Err()
+}
+
+// UnlinkIdentity removes a provider account from a user. The user keeps
+// signing in with their email.
+func UnlinkIdentity(userID, identityID string, db *sql.DB, ctx context.Context) error {
+	result, err := db.ExecContext(ctx,
+		`DELETE FROM atombase_user_identities WHERE id = ? AND user_id = ?`, identityID, userID)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrIdentityNotFound
+	}
+	return nil
+}
+
+// GET /auth/oauth/{provider}/start
+//
+// Sends the browser to the provider.
+func (api *API) handleOAuthStart(w http.ResponseWriter, r *http.Request) {
+	authURL, err := BeginOAuth(r.PathValue("provider"), "", api.db, r.Context())
+	if err != nil {
+		tools.RespErr(w, oauthErr(err))
+		return
+	}
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// GET and POST /auth/oauth/{provider}/callback
+//
+// Apple posts the callback as a form. Invalid states count against the
+// client IP like invalid magic links.
+func (api *API) handleOAuthCallback(w http.ResponseWriter, r *http.Request) {
+	if providerErr := r.FormValue("error"); providerErr != "" {
+		tools.RespErr(w, tools.UnauthorizedErr("provider sign-in failed: "+providerErr))
+		return
+	}
+	code, state := r.FormValue("code"), r.FormValue("state")
+	if code == "" || state == "" {
+		tools.RespErr(w, tools.InvalidRequestErr("code and state are required"))
+		return
+	}
+	ipKey := "ip:" + tools.ClientIP(r)
+	if api.lockedOut(w, ipKey) {
+		return
+	}
+
+	user, session, isNew, identity, err := CompleteOAuth(r.PathValue("provider"), code, state, api.db, r.Context())
+	if errors.Is(err, ErrInvalidOrExpiredOAuthState) {
+		api.countAttempt(r.Context(), ipKey, config.Cfg.AuthMaxIPAttempts)
+		tools.RespErr(w, tools.UnauthorizedErr("invalid or expired sign-in; start again"))
+		return
+	}
+	if err == nil && session == nil {
+		tools.RespondJSON(w, http.StatusOK, map[string]any{
+			"user":     user,
+			"identity": identity,
+		})
+		return
+	}
+	api.respondSignIn(w, r, user, session, isNew, oauthErr(err))
+}
+
+// GET /auth/identities
+func (api *API) handleListIdentities(w http.ResponseWriter, r *http.Request) {
+	session, err := api.getSession(r)
+	if err != nil {
+		tools.RespErr(w, tools.UnauthorizedErr("invalid session"))
+		return
+	}
+	identities, err := ListIdentities(session.UserID, api.db, r.Context())
+	if err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	tools.RespondJSON(w, http.StatusOK, identities)
+}
+
+// POST /auth/identities/{provider}
+//
+// Starts linking a provider account to the signed-in user. The client sends
+// the browser to the returned URL, and the callback links the account.
+func (api *API) handleLinkIdentity(w http.ResponseWriter, r *http.Request) {
+	session, err := api.getSession(r)
+	if err != nil {
+		tools.RespErr(w, tools.UnauthorizedErr("invalid session"))
+		return
+	}
+	authURL, err := BeginOAuth(r.PathValue("provider"), session.UserID, api.db, r.Context())
+	if err != nil {
+		tools.RespErr(w, oauthErr(err))
+		return
+	}
+	tools.RespondJSON(w, http.StatusOK, map[string]string{"url": authURL})
+}
+
+// DELETE /auth/identities/{identityID}
+func (api *API) handleUnlinkIdentity(w http.ResponseWriter, r *http.Request) {
+	session, err := api.getSession(r)
+	if err != nil {
+		tools.RespErr(w, tools.UnauthorizedErr("invalid session"))
+		return
+	}
+	if err := UnlinkIdentity(session.UserID, r.PathValue("identityID"), api.db, r.Context()); err != nil {
+		tools.RespErr(w, oauthErr(err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// oauthErr maps social sign-in errors to API errors.
+func oauthErr(err error) error {
+	switch {
+	case errors.Is(err, ErrUnknownProvider), errors.Is(err, ErrIdentityNotFound):
+		return tools.InvalidRequestErr(err.Error())
+	case errors.Is(err, ErrOAuthFailed), errors.Is(err, ErrUnverifiedEmail):
+		return tools.UnauthorizedErr(err.Error())
+	}
+	return err
+}
@@ -0,0 +1,218 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/atombasedev/atombase/config"
+	"github.com/atombasedev/atombase/tools"
+)
+
+// fakeGoogle answers the token endpoint with an ID token for the current
+// claims, after checking the PKCE verifier matches the challenge it was sent.
+func fakeGoogle(t *testing.T, claims map[string]any) {
+	t.Helper()
+	prevCfg, prevProvider := config.Cfg, *oauthProviders[ProviderGoogle]
+	t.Cleanup(func() {
+		config.Cfg = prevCfg
+		*oauthProviders[ProviderGoogle] = prevProvider
+	})
+	config.Cfg.AuthGoogleClientID = "client-1"
+	config.Cfg.AuthGoogleClientSecret = "secret-1"
+	config.Cfg.AuthOAuthLinkByEmail = true
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil || r.Form.Get("client_secret") != "secret-1" || r.Form.Get("code") != "code-1" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		challenge := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+		if base64.RawURLEncoding.EncodeToString(challenge[:]) != claims["challenge"] {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		payload, _ := json.Marshal(claims)
+		json.NewEncoder(w).Encode(map[string]string{
+			"id_token": "e30." + base64.RawURLEncoding.EncodeToString(payload) + ".sig",
+		})
+	}))
+	t.Cleanup(server.Close)
+	oauthProviders[ProviderGoogle].TokenURL = server.URL
+}
+
+func TestOAuthSignIn(t *testing.T) {
+	db := setupAuthTestDB(t)
+	ctx := context.Background()
+	claims := map[string]any{}
+	fakeGoogle(t, claims)
+
+	// signIn runs a whole sign-in as subject; begin with userID links instead.
+	signIn := func(userID, subject, email string, verified any) (*User, *Session, bool, *Identity, error) {
+		t.Helper()
+		authURL, err := BeginOAuth(ProviderGoogle, userID, db, ctx)
+		if err != nil {
+			t.Fatalf("begin oauth: %v", err)
+		}
+		parsed, _ := url.Parse(authURL)
+		query := parsed.Query()
+		if query.Get("redirect_uri") != oauthRedirectURI(ProviderGoogle) || query.Get("client_id") != "client-1" {
+			t.Fatalf("unexpected authorization url %s", authURL)
+		}
+		clear(claims)
+		for k, v := range map[string]any{
+			"iss": "https://accounts.google.com", "aud": "client-1", "exp": time.Now().Add(time.Minute).Unix(),
+			"nonce": query.Get("nonce"), "challenge": query.Get("code_challenge"),
+			"sub": subject, "email": email, "email_verified": verified,
+		} {
+			claims[k] = v
+		}
+		return CompleteOAuth(ProviderGoogle, "code-1", query.Get("state"), db, ctx)
+	}
+
+	user, session, isNew, _, err := signIn("", "g-1", "Ada@example.com", true)
+	if err != nil || !isNew || session == nil || user.Email != "ada@example.com" {
+		t.Fatalf("expected a new user, got %#v %#v %v %v", user, session, isNew, err)
+	}
+	again, _, isNew, _, err := signIn("", "g-1", "renamed@example.com", true)
+	if err != nil || isNew || again.ID != user.ID {
+		t.Fatalf("expected the identity to sign in its user, got %#v %v %v", again, isNew, err)
+	}
+	if _, _, _, _, err := CompleteOAuth(ProviderGoogle, "code-1", "replayed", db, ctx); !errors.Is(err, ErrInvalidOrExpiredOAuthState) {
+		t.Fatalf("expected an unknown state to fail, got %v", err)
+	}
+	if _, _, _, _, err := signIn("", "g-2", "eve@example.com", "false"); !errors.Is(err, ErrUnverifiedEmail) {
+		t.Fatalf("expected an unverified email to be refused, got %v", err)
+	}
+
+	// A new account with a verified email joins the user with that email.
+	grace, _, err := FindOrCreateUser("grace@example.com", db, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Cfg.AuthOAuthLinkByEmail = false
+	if _, _, _, _, err := signIn("", "g-3", "grace@example.com", true); !errors.Is(err, tools.ErrIdentityConflict) {
+		t.Fatalf("expected the email's user to be protected, got %v", err)
+	}
+	config.Cfg.AuthOAuthLinkByEmail = true
+	if linked, _, isNew, _, err := signIn("", "g-3", "grace@example.com", "true"); err != nil || isNew || linked.ID != grace.ID {
+		t.Fatalf("expected the identity to join the email's user, got %#v %v %v", linked, isNew, err)
+	}
+
+	// Linking while signed in.
+	if _, _, _, _, err := signIn(grace.ID, "g-1", "ada@example.com", true); !errors.Is(err, tools.ErrIdentityConflict) {
+		t.Fatalf("expected another user's identity not to link, got %v", err)
+	}
+	linkedUser, session, _, identity, err := signIn(grace.ID, "g-4", "", false)
+	if err != nil || session != nil || identity == nil || linkedUser.ID != grace.ID {
+		t.Fatalf("expected a link without a session, got %#v %#v %#v %v", linkedUser, session, identity, err)
+	}
+	identities, err := ListIdentities(grace.ID, db, ctx)
+	if err != nil || len(identities) != 2 {
+		t.Fatalf("expected two identities, got %#v %v", identities, err)
+	}
+	if err := UnlinkIdentity(user.ID, identity.ID, db, ctx); !errors.Is(err, ErrIdentityNotFound) {
+		t.Fatalf("expected another user's identity not to unlink, got %v", err)
+	}
+	if err := UnlinkIdentity(grace.ID, identity.ID, db, ctx); err != nil {
+		t.Fatalf("unlink identity: %v", err)
+	}
+}
+
+func TestBeginOAuth_Unconfigured(t *testing.T) {
+	db := setupAuthTestDB(t)
+	prevCfg := config.Cfg
+	t.Cleanup(func() { config.Cfg = prevCfg })
+	config.Cfg.AuthGitHubClientID = ""
+	for _, provider := range []string{ProviderGitHub, "myspace"} {
+		if _, err := BeginOAuth(provider, "", db, context.Background()); !errors.Is(err, ErrUnknownProvider) {
+			t.Errorf("%s: expected ErrUnknownProvider, got %v", provider, err)
+		}
+	}
+}
+
+func TestGitHubProfile(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token-1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/user":
+			w.Write([]byte(`{"id": 42, "login": "ada"}`))
+		case "/user/emails":
+			w.Write([]byte(`[{"email": "old@example.com", "primary": false, "verified": true}, {"email": "ada@example.com", "primary": true, "verified": true}]`))
+		}
+	}))
+	defer server.Close()
+	prevURL := githubAPIURL
+	githubAPIURL = server.URL
+	t.Cleanup(func() { githubAPIURL = prevURL })
+
+	profile, err := githubProfile(context.Background(), "token-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile != (oauthProfile{Subject: "42", Email: "ada@example.com", EmailVerified: true}) {
+		t.Errorf("unexpected profile %#v", profile)
+	}
+	if _, err := githubProfile(context.Background(), "wrong"); !errors.Is(err, ErrOAuthFailed) {
+		t.Errorf("expected a rejected token to fail, got %v", err)
+	}
+}
+
+func TestAppleClientSecret(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prevCfg := config.Cfg
+	t.Cleanup(func() { config.Cfg = prevCfg })
+	config.Cfg.AuthAppleClientID = "com.example.web"
+	config.Cfg.AuthAppleTeamID = "TEAM123"
+	config.Cfg.AuthAppleKeyID = "KEY123"
+	config.Cfg.AuthApplePrivateKey = string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+
+	secret, err := appleClientSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(secret, ".")
+	if len(parts) != 3 {
+		t.Fatalf("expected a JWT, got %q", secret)
+	}
+	var claims map[string]any
+	payload, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	if err := json.Unmarshal(payload, &claims); err != nil || claims["iss"] != "TEAM123" || claims["sub"] != "com.example.web" {
+		t.Fatalf("unexpected claims %s", payload)
+	}
+	signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	r, s := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+	if len(signature) != 64 || !ecdsa.Verify(&key.PublicKey, digest[:], r, s) {
+		t.Error("expected an ES256 signature by the configured key")
+	}
+
+	config.Cfg.AuthApplePrivateKey = "not a key"
+	if _, err := appleClientSecret(); err == nil {
+		t.Error("expected a malformed key to fail")
+	}
+}
@@ -4,11 +4,9 @@ import (
 	"context"
 	"database/sql"
 	"errors"
-	"fmt"
 	"net/http"
 	"strings"
 
-	"github.com/atombasedev/atombase/config"
 	"github.com/atombasedev/atombase/tools"
 	_ "github.com/mattn/go-sqlite3"
 	_ "github.com/tursodatabase/libsql-client-go/libsql"
@@ -35,14 +33,10 @@ type updateOrganizationMemberRequest struct {
 type tenantOpener func(databaseID, authToken string) (*sql.DB, error)
 
 var openOrganizationTenantDB tenantOpener = func(databaseID, authToken string) (*sql.DB, error) {
-	org := config.Cfg.TursoOrganization
-	if org == "" {
-		return nil, errors.New("TURSO_ORGANIZATION environment variable is not set but is required to access external databases")
-	}
 	if authToken == "" {
 		return nil, errors.New("database has no auth token configured")
 	}
-	return sql.Open("libsql", fmt.Sprintf("libsql://%s-%s.turso.io?authToken=%s", databaseID, org, authToken))
+	return tools.OpenTenantDB(databaseID, authToken)
 }
 
 func (api *API) handleListOrganizationMembers(w http.ResponseWriter, r *http.Request) {
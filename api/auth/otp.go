@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/atombasedev/atombase/config"
+)
+
+// otpAttempts is how many wrong guesses discard an emailed code.
+const otpAttempts = 5
+
+const SaveOTP = `
+INSERT INTO email_otps (id, email, code_hash, attempts, created_at, expires_at)
+VALUES (?, ?, ?, 0, ?, ?)
+ON CONFLICT(email) DO UPDATE SET
+  id = excluded.id,
+  code_hash = excluded.code_hash,
+  attempts = 0,
+  created_at = excluded.created_at,
+  expires_at = excluded.expires_at;`
+
+// BeginOTPLogin emails a six-digit sign-in code, replacing any code sent
+// to the same address before.
+func BeginOTPLogin(email string, db *sql.DB, ctx context.Context) error {
+	email = NormalizeEmail(email)
+	if err := ValidateEmail(email); err != nil {
+		return err
+	}
+
+	n, err := rand.Int(rand.Reader, big.NewInt(1_000_000))
+	if err != nil {
+		return err
+	}
+	code := fmt.Sprintf("%06d", n.Int64())
+	now := time.Now().UTC()
+	ttl := time.Duration(config.Cfg.AuthOTPTTL) * time.Second
+	id := ID128()
+
+	if _, err := db.ExecContext(ctx, SaveOTP, id, email, otpHash(email, code), now.Unix(), now.Add(ttl).Unix()); err != nil {
+		return err
+	}
+
+	if err := sendEmailFn(ctx, buildOTPEmail(email, code)); err != nil {
+		_, _ = db.ExecContext(ctx, `DELETE FROM email_otps WHERE id = ?`, id)
+		return err
+	}
+	return nil
+}
+
+// otpHash binds a code to its email, so equal codes sent to two addresses
+// hash differently.
+func otpHash(email, code string) []byte {
+	return shaHash(email + "\n" + code)
+}
+
+// CompleteOTPLogin signs in with an emailed code. A code works once; each
+// wrong guess uses up one of otpAttempts, after which the code is gone.
+func CompleteOTPLogin(email, code string, db *sql.DB, ctx context.Context) (*User, *Session, bool, error) {
+	email = NormalizeEmail(email)
+	now := time.Now().UTC().Unix()
+
+	var id string
+	var codeHash []byte
+	err := db.QueryRowContext(ctx,
+		`UPDATE email_otps SET attempts = attempts + 1
+		WHERE email = ? AND expires_at > ? AND attempts < ?
+		RETURNING id, code_hash`,
+		email, now, otpAttempts,
+	).Scan(&id, &codeHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, false, ErrInvalidOrExpiredOTP
+	}
+	if err != nil {
+		return nil, nil, false, err
+	}
+	if subtle.ConstantTimeCompare(otpHash(email, code), codeHash) != 1 {
+		return nil, nil, false, ErrInvalidOrExpiredOTP
+	}
+
+	// Only one of two racing requests with the right code deletes the row.
+	result, err := db.ExecContext(ctx, `DELETE FROM email_otps WHERE id = ?`, id)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return nil, nil, false, ErrInvalidOrExpiredOTP
+	}
+	return signInEmail(email, db, ctx)
+}
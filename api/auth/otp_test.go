@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+)
+
+var emailedCode = regexp.MustCompile(`(?m)^\d{6}$`)
+
+func TestOTPLogin(t *testing.T) {
+	db := setupAuthTestDB(t)
+	ctx := context.Background()
+	var sent outboundEmail
+	oldSendEmail := sendEmailFn
+	sendEmailFn = func(_ context.Context, msg outboundEmail) error {
+		sent = msg
+		return nil
+	}
+	t.Cleanup(func() { sendEmailFn = oldSendEmail })
+	begin := func() string {
+		t.Helper()
+		if err := BeginOTPLogin("User@example.com", db, ctx); err != nil {
+			t.Fatalf("begin otp login: %v", err)
+		}
+		code := emailedCode.FindString(sent.Text)
+		if sent.To != "user@example.com" || code == "" {
+			t.Fatalf("expected a code mailed to the normalized address, got %#v", sent)
+		}
+		return code
+	}
+	wrong := func(code string) string {
+		if code == "000000" {
+			return "000001"
+		}
+		return "000000"
+	}
+
+	code := begin()
+	if _, _, _, err := CompleteOTPLogin("user@example.com", wrong(code), db, ctx); !errors.Is(err, ErrInvalidOrExpiredOTP) {
+		t.Fatalf("expected a wrong code to fail, got %v", err)
+	}
+	user, session, isNew, err := CompleteOTPLogin(" USER@example.com", code, db, ctx)
+	if err != nil {
+		t.Fatalf("complete otp login: %v", err)
+	}
+	if !isNew || user.Email != "user@example.com" || session == nil || session.UserID != user.ID {
+		t.Fatalf("expected a session for a new user, got %#v %#v %v", user, session, isNew)
+	}
+	if _, _, _, err := CompleteOTPLogin("user@example.com", code, db, ctx); !errors.Is(err, ErrInvalidOrExpiredOTP) {
+		t.Fatalf("expected a used code to fail, got %v", err)
+	}
+
+	// Guessing uses the code up.
+	code = begin()
+	for range otpAttempts {
+		if _, _, _, err := CompleteOTPLogin("user@example.com", wrong(code), db, ctx); !errors.Is(err, ErrInvalidOrExpiredOTP) {
+			t.Fatalf("expected a wrong code to fail, got %v", err)
+		}
+	}
+	if _, _, _, err := CompleteOTPLogin("user@example.com", code, db, ctx); !errors.Is(err, ErrInvalidOrExpiredOTP) {
+		t.Fatalf("expected the code to be gone after %d wrong guesses, got %v", otpAttempts, err)
+	}
+
+	// A new code replaces the old one and resets its guesses.
+	code = begin()
+	if _, _, isNew, err := CompleteOTPLogin("user@example.com", code, db, ctx); err != nil || isNew {
+		t.Fatalf("expected the returning user to sign in, got %v %v", isNew, err)
+	}
+}
+
+func TestOTPLogin_Expired(t *testing.T) {
+	db := setupAuthTestDB(t)
+	if _, err := db.Exec(`INSERT INTO email_otps (id, email, code_hash, created_at, expires_at) VALUES ('otp', 'user@example.com', ?, 0, 1)`,
+		otpHash("user@example.com", "123456")); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := CompleteOTPLogin("user@example.com", "123456", db, context.Background()); !errors.Is(err, ErrInvalidOrExpiredOTP) {
+		t.Fatalf("expected an expired code to fail, got %v", err)
+	}
+}
+
+func TestExpiryText(t *testing.T) {
+	for seconds, want := range map[int]string{900: "15 minutes", 60: "1 minute", 30: "1 minute"} {
+		if got := expiryText(seconds); got != want {
+			t.Errorf("expiryText(%d) = %q, want %q", seconds, got, want)
+		}
+	}
+}
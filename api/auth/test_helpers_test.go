@@ -25,6 +25,7 @@ const (
 			id TEXT PRIMARY KEY NOT NULL,
 			secret_hash BLOB NOT NULL,
 			user_id TEXT NOT NULL,
+			mfa_verified INTEGER NOT NULL DEFAULT 0,
 			expires_at TEXT NOT NULL,
 			created_at TEXT NOT NULL
 		)
@@ -39,6 +40,59 @@ const (
 			expires_at INTEGER NOT NULL
 		)
 	`
+
+	createOTPsTable = `
+		CREATE TABLE email_otps (
+			id TEXT NOT NULL PRIMARY KEY,
+			email TEXT NOT NULL UNIQUE COLLATE NOCASE,
+			code_hash BLOB NOT NULL,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			created_at INTEGER NOT NULL,
+			expires_at INTEGER NOT NULL
+		)
+	`
+
+	createOAuthTables = `
+		CREATE TABLE atombase_user_identities (
+			id TEXT PRIMARY KEY NOT NULL,
+			user_id TEXT NOT NULL,
+			provider TEXT NOT NULL,
+			subject TEXT NOT NULL,
+			email TEXT,
+			last_sign_in_at TEXT,
+			created_at TEXT NOT NULL,
+			UNIQUE(provider, subject)
+		);
+		CREATE TABLE atombase_oauth_states (
+			state_hash BLOB PRIMARY KEY NOT NULL,
+			provider TEXT NOT NULL,
+			nonce TEXT NOT NULL,
+			code_verifier TEXT NOT NULL,
+			user_id TEXT,
+			expires_at INTEGER NOT NULL
+		);
+	`
+
+	createMFATables = `
+		CREATE TABLE atombase_user_totp (
+			user_id TEXT PRIMARY KEY NOT NULL,
+			secret_encrypted BLOB NOT NULL,
+			last_counter INTEGER NOT NULL DEFAULT 0,
+			confirmed_at TEXT,
+			created_at TEXT NOT NULL
+		);
+		CREATE TABLE atombase_user_backup_codes (
+			user_id TEXT NOT NULL,
+			code_hash BLOB NOT NULL,
+			PRIMARY KEY (user_id, code_hash)
+		);
+		CREATE TABLE atombase_mfa_challenges (
+			token_hash BLOB PRIMARY KEY NOT NULL,
+			user_id TEXT NOT NULL,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			expires_at INTEGER NOT NULL
+		);
+	`
 )
 
 func setupAuthTestDB(t *testing.T) *sql.DB {
@@ -49,7 +103,7 @@ func setupAuthTestDB(t *testing.T) *sql.DB {
 		t.Fatalf("open sqlite db: %v", err)
 	}
 
-	for _, stmt := range []string{createUsersTable, createSessionsTable, createMagicLinksTable} {
+	for _, stmt := range []string{createUsersTable, createSessionsTable, createMagicLinksTable, createOTPsTable, createOAuthTables, createMFATables} {
 		if _, err := db.Exec(stmt); err != nil {
 			_ = db.Close()
 			t.Fatalf("create schema: %v", err)
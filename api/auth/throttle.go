@@ -0,0 +1,200 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/atombasedev/atombase/config"
+	"github.com/atombasedev/atombase/tools"
+)
+
+// AuditRecorder is implemented by resolvers that can write to the platform
+// audit log. Sign-in lockouts are recorded there when it is available.
+type AuditRecorder interface {
+	RecordAudit(ctx context.Context, action, target string, detail any) error
+}
+
+// maxTrackedAttempts bounds how many emails and IPs the tracker remembers.
+const maxTrackedAttempts = 100_000
+
+// attemptCounter counts one email's or IP's sign-in attempts in the current
+// window.
+type attemptCounter struct {
+	count       int
+	windowStart time.Time
+	lockedUntil time.Time
+}
+
+// attemptTracker throttles sign-in per email and per client IP. State is per
+// process, so each replica counts on its own.
+type attemptTracker struct {
+	mu       sync.Mutex
+	counters map[string]*attemptCounter
+}
+
+func newAttemptTracker() *attemptTracker {
+	return &attemptTracker{counters: map[string]*attemptCounter{}}
+}
+
+// lockedFor reports how long key stays locked out, or zero.
+func (t *attemptTracker) lockedFor(key string, now time.Time) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if counter, ok := t.counters[key]; ok && now.Before(counter.lockedUntil) {
+		return counter.lockedUntil.Sub(now)
+	}
+	return 0
+}
+
+// fail counts an attempt against key and reports whether it just locked key
+// out. A limit of zero or less disables counting.
+func (t *attemptTracker) fail(key string, limit int, now time.Time) bool {
+	if limit <= 0 {
+		return false
+	}
+	window := time.Duration(config.Cfg.AuthAttemptWindow) * time.Second
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	counter, ok := t.counters[key]
+	if !ok {
+		if len(t.counters) >= maxTrackedAttempts {
+			t.sweep(now, window)
+		}
+		counter = &attemptCounter{windowStart: now}
+		t.counters[key] = counter
+	}
+	if now.Sub(counter.windowStart) >= window {
+		counter.count, counter.windowStart = 0, now
+	}
+	counter.count++
+	if counter.count < limit {
+		return false
+	}
+	counter.count, counter.windowStart = 0, now
+	counter.lockedUntil = now.Add(time.Duration(config.Cfg.AuthLockout) * time.Second)
+	return true
+}
+
+// reset forgets key, after a successful sign-in.
+func (t *attemptTracker) reset(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.counters, key)
+}
+
+// sweep drops counters whose window and lockout have passed. The caller holds
+// the lock.
+func (t *attemptTracker) sweep(now time.Time, window time.Duration) {
+	for key, counter := range t.counters {
+		if now.Sub(counter.windowStart) >= window && now.After(counter.lockedUntil) {
+			delete(t.counters, key)
+		}
+	}
+}
+
+// lockedOut answers 429 with Retry-After when any of keys is locked out.
+func (api *API) lockedOut(w http.ResponseWriter, keys ...string) bool {
+	now := time.Now()
+	var wait time.Duration
+	for _, key := range keys {
+		wait = max(wait, api.attempts.lockedFor(key, now))
+	}
+	if wait == 0 {
+		return false
+	}
+	w.Header().Set("Retry-After", fmt.Sprint(int((wait+time.Second-1)/time.Second)))
+	tools.RespErr(w, tools.ErrAuthLockedOut)
+	return true
+}
+
+// countAttempt counts a sign-in attempt against key and reports a lockout it
+// causes to the audit log and the alert webhook.
+func (api *API) countAttempt(ctx context.Context, key string, limit int) {
+	if !api.attempts.fail(key, limit, time.Now()) {
+		return
+	}
+	kind, value, _ := strings.Cut(key, ":")
+	detail := map[string]any{kind: value, "lockout_seconds": config.Cfg.AuthLockout}
+	if recorder, ok := api.store.(AuditRecorder); ok {
+		if err := recorder.RecordAudit(ctx, "auth.lockout", key, detail); err != nil {
+			log.Printf("auth lockout of %s not audited: %v", key, err)
+		}
+	}
+	if webhook := config.Cfg.AuthAlertWebhook; webhook != "" {
+		go notifyLockout(webhook, map[string]any{"event": "auth.lockout", "target": key, "detail": detail})
+	}
+}
+
+// notifyLockout POSTs a lockout to the alert webhook once, without retries.
+func notifyLockout(webhook string, payload any) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook, bytes.NewReader(body))
+	if err != nil {
+		log.Printf("auth alert webhook failed: %v", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Printf("auth alert webhook failed: %v", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("auth alert webhook failed: status %d", resp.StatusCode)
+	}
+}
+
+// captchaClient calls the CAPTCHA provider.
+var captchaClient = &http.Client{Timeout: 10 * time.Second}
+
+// verifyCaptcha checks a CAPTCHA response with the provider's siteverify
+// endpoint, as reCAPTCHA, hCaptcha and Turnstile all accept. It passes when
+// no provider is configured.
+func verifyCaptcha(ctx context.Context, response, remoteIP string) error {
+	verifyURL := config.Cfg.AuthCaptchaVerifyURL
+	if verifyURL == "" {
+		return nil
+	}
+	if response == "" {
+		return fmt.Errorf("%w: captcha is required", tools.ErrCaptchaFailed)
+	}
+	form := url.Values{
+		"secret":   {config.Cfg.AuthCaptchaSecret},
+		"response": {response},
+		"remoteip": {remoteIP},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, verifyURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := captchaClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var result struct {
+		Success bool `json:"success"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("captcha provider: %w", err)
+	}
+	if !result.Success {
+		return tools.ErrCaptchaFailed
+	}
+	return nil
+}
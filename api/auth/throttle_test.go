@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/atombasedev/atombase/config"
+)
+
+// auditingStore records audit entries and resolves nothing else.
+type auditingStore struct {
+	OrganizationResolver
+	actions []string
+}
+
+func (s *auditingStore) RecordAudit(_ context.Context, action, target string, _ any) error {
+	s.actions = append(s.actions, action+" "+target)
+	return nil
+}
+
+func setupThrottleTest(t *testing.T) (*API, *auditingStore) {
+	t.Helper()
+	prevCfg := config.Cfg
+	config.Cfg.AuthMaxAttempts = 2
+	config.Cfg.AuthMaxIPAttempts = 3
+	config.Cfg.AuthAttemptWindow = 60
+	config.Cfg.AuthLockout = 60
+	config.Cfg.AuthCaptchaVerifyURL = ""
+	config.Cfg.AuthAlertWebhook = ""
+	t.Cleanup(func() { config.Cfg = prevCfg })
+
+	oldSendEmail := sendEmailFn
+	sendEmailFn = func(context.Context, outboundEmail) error { return nil }
+	t.Cleanup(func() { sendEmailFn = oldSendEmail })
+
+	store := &auditingStore{}
+	return &API{db: setupAuthTestDB(t), store: store, attempts: newAttemptTracker()}, store
+}
+
+func startMagicLink(api *API, ip, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/auth/magic-link/start", strings.NewReader(body))
+	req.RemoteAddr = ip + ":1234"
+	rec := httptest.NewRecorder()
+	api.withBody(api.handleMagicLinkStart)(rec, req)
+	return rec
+}
+
+func TestMagicLinkStartLocksOutEmail(t *testing.T) {
+	api, store := setupThrottleTest(t)
+
+	for i := range 2 {
+		if rec := startMagicLink(api, "10.0.0.1", `{"email": "Ada@example.com"}`); rec.Code != http.StatusOK {
+			t.Fatalf("attempt %d: expected 200, got %d %s", i, rec.Code, rec.Body.String())
+		}
+	}
+	rec := startMagicLink(api, "10.0.0.2", `{"email": "ada@example.com"}`)
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "60" {
+		t.Fatalf("expected the email to be locked out from any IP, got %d %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if rec := startMagicLink(api, "10.0.0.2", `{"email": "grace@example.com"}`); rec.Code != http.StatusOK {
+		t.Fatalf("expected another email to pass, got %d %s", rec.Code, rec.Body.String())
+	}
+	if len(store.actions) != 1 || store.actions[0] != "auth.lockout email:ada@example.com" {
+		t.Fatalf("expected one audited lockout, got %v", store.actions)
+	}
+}
+
+func TestMagicLinkCompleteLocksOutIP(t *testing.T) {
+	api, _ := setupThrottleTest(t)
+	complete := func(ip string) int {
+		req := httptest.NewRequest(http.MethodGet, "/auth/magic-link/complete?token=guess", nil)
+		req.RemoteAddr = ip + ":1234"
+		rec := httptest.NewRecorder()
+		api.handleMagicLinkComplete(rec, req)
+		return rec.Code
+	}
+
+	for i := range 3 {
+		if code := complete("10.0.0.1"); code != http.StatusUnauthorized {
+			t.Fatalf("guess %d: expected 401, got %d", i, code)
+		}
+	}
+	if code := complete("10.0.0.1"); code != http.StatusTooManyRequests {
+		t.Fatalf("expected the IP to be locked out, got %d", code)
+	}
+	if code := complete("10.0.0.2"); code != http.StatusUnauthorized {
+		t.Fatalf("expected another IP to pass, got %d", code)
+	}
+}
+
+func TestMagicLinkStartRequiresCaptcha(t *testing.T) {
+	api, _ := setupThrottleTest(t)
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		ok := r.PostForm.Get("secret") == "captcha-secret" && r.PostForm.Get("response") == "solved"
+		w.Write([]byte(`{"success": ` + map[bool]string{true: "true", false: "false"}[ok] + `}`))
+	}))
+	defer provider.Close()
+	config.Cfg.AuthCaptchaVerifyURL = provider.URL
+	config.Cfg.AuthCaptchaSecret = "captcha-secret"
+
+	if rec := startMagicLink(api, "10.0.0.1", `{"email": "ada@example.com"}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected a missing captcha to be refused, got %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := startMagicLink(api, "10.0.0.2", `{"email": "grace@example.com", "captcha": "forged"}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected a wrong captcha to be refused, got %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := startMagicLink(api, "10.0.0.3", `{"email": "alan@example.com", "captcha": "solved"}`); rec.Code != http.StatusOK {
+		t.Fatalf("expected a solved captcha to pass, got %d %s", rec.Code, rec.Body.String())
+	}
+}
@@ -17,22 +17,55 @@ type Config struct {
 	PrimaryDBName           string   // Turso database name for external primary DB (empty = use local SQLite)
 	PrimaryDBPath           string   // Path to local SQLite database file (fallback when PrimaryDBName is empty)
 	DataDir                 string   // Directory for storing database files
+	TenantBackend           string   // Where tenant databases live: "turso", "d1" or "local" (empty picks local when LocalTenantDir is set)
+	LocalTenantDir          string   // Directory of the local backend's SQLite files (empty = tenants in DataDir)
 	MaxRequestBody          int64    // Maximum request body size in bytes
+	MaxBlobSize             int64    // Maximum size in bytes of a BLOB written through the blob endpoints
 	APIKey                  string   // API key for authentication (empty disables auth)
 	CORSOrigins             []string // Allowed CORS origins (empty allows none, "*" allows all)
 	TrustedProxyCIDRs       []string // Proxy CIDRs allowed to supply forwarded client IP headers
+	TenantDomain            string   // Domain whose subdomains name the organization a Data API request targets (empty disables)
 	RequestTimeout          int      // Request timeout in seconds (0 uses default of 30s)
 	MaxQueryDepth           int      // Maximum nesting depth for queries (default 5)
 	MaxQueryLimit           int      // Maximum rows per query (default 1000, 0 = unlimited)
 	DefaultLimit            int      // Default limit when not specified (default 100, 0 = unlimited)
 	MaxOrganizationsPerUser int      // Maximum organizations a non-service user can own (0 = unlimited)
+	MaxDefinitions          int      // Definitions the deployment may hold (0 = unlimited)
+	MaxDatabases            int      // Databases the deployment may hold (0 = unlimited)
+	RequireQueryAllowlist   bool     // Reject Data API queries of definitions without a query allowlist
+	QueryCostLimit          int      // Highest estimated cost of a single Data API query (0 = unlimited)
+	QueryCostBudget         int      // Query cost each non-service caller may spend per minute (0 = unlimited)
+	FullScanGuard           string   // "warn", "require" or "reject" filters that scan a large table in full (empty disables)
+	FullScanMinRows         int      // Rows from which a table counts as large for FullScanGuard
+	MaxConcurrentPerCaller  int      // In-flight requests allowed per session or anonymous client IP (0 = unlimited)
+	RateLimit               float64  // Requests per second allowed per session, API key or anonymous client IP (0 = unlimited)
+	RateLimitBurst          int      // Requests a caller may send at once before RateLimit applies (0 = one second's worth)
+	StreamFlushInterval     int      // Milliseconds between flushes of a streamed select (0 = flush every row)
+	EventHeartbeatInterval  int      // Seconds between heartbeat comments on table event streams
 
 	// Turso configuration (for external databases)
-	TursoOrganization  string // Turso organization name
-	TursoAPIKey        string // Turso API key for management operations
-	TursoGroup         string // Turso group name (default: "default")
-	PrimaryDBToken     string // Auth token for the primary Turso database (when using external primary)
-	TokenEncryptionKey string // 32-byte hex key for encrypting database tokens at rest
+	TursoOrganization  string            // Turso organization name
+	TursoAPIKey        string            // Turso API key for management operations
+	TursoGroup         string            // Turso group name (default: "default")
+	TursoGroupRegions  map[string]string // Region each Turso group places its databases in, by group name
+	PrimaryDBToken     string            // Auth token for the primary Turso database (when using external primary)
+	TursoCassette      string            // Fixture file of recorded Turso API interactions
+	TursoCassetteMode  string            // "record" captures Turso API calls into TursoCassette, "replay" serves them from it
+	TokenEncryptionKey string            // 32-byte hex key for encrypting database tokens at rest
+
+	// Cloudflare D1 configuration (for the d1 tenant backend)
+	CloudflareAccountID string // Cloudflare account tenant databases are created in
+	CloudflareAPIToken  string // API token with D1 edit permission on the account
+
+	// Tenant connection pool
+	TenantPoolSize           int // Tenant database handles kept open between requests (0 opens one per request)
+	TenantPoolMaxOpen        int // Connections each pooled handle may open (0 = unlimited)
+	TenantPoolIdleTimeout    int // Seconds an unused handle stays open
+	TenantPoolHealthInterval int // Seconds between pings of idle Turso handles (0 disables)
+
+	// Tenant read replicas
+	TenantReplicaDir    string // Directory of local replicas Turso tenant reads are served from (empty disables)
+	TenantReplicaMaxAge int    // Seconds a replica serves reads before it is synced again
 
 	// Email delivery
 	SMTPHost     string // SMTP host for transactional email
@@ -46,6 +79,51 @@ type Config struct {
 	ActivityLogPath      string // Path to activity log database
 	ActivityLogRetention int    // Days to retain logs (0 = forever)
 
+	// Log shipping to an external sink
+	LogShipSink        string // "syslog", "loki" or "s3" (empty = disabled)
+	LogShipURL         string // Syslog address (udp://host:514), Loki base URL or S3 bucket URL
+	LogShipBatchSize   int    // Entries per shipped batch
+	LogShipBufferSize  int    // Entries queued before new ones are dropped
+	LogShipInterval    int    // Seconds between flushes of a partial batch
+	LogShipS3Region    string // S3 signing region
+	LogShipS3AccessKey string // S3 access key ID
+	LogShipS3SecretKey string // S3 secret access key
+
+	// Async Data API exports to an S3-compatible bucket
+	ExportS3URL       string // Bucket URL exports are uploaded to, with optional key prefix (empty = exports disabled)
+	ExportS3Region    string // S3 signing region
+	ExportS3AccessKey string // S3 access key ID
+	ExportS3SecretKey string // S3 secret access key
+	ExportURLTTL      int    // Seconds a download link stays valid
+	ExportTimeout     int    // Seconds an export may run
+	ImportMaxSize     int64  // Maximum size in bytes of a database import
+
+	// Object storage for tenant files
+	StorageDir           string // Directory objects are kept in without a bucket (default <DATA_DIR>/storage)
+	StorageS3URL         string // Bucket URL objects are stored in, with optional key prefix (empty = local disk)
+	StorageS3Region      string // S3 signing region
+	StorageS3AccessKey   string // S3 access key ID
+	StorageS3SecretKey   string // S3 secret access key
+	StorageMaxObjectSize int64  // Maximum size in bytes of an uploaded object
+	StorageURLTTL        int    // Default seconds a signed URL stays valid
+
+	// Scheduled backups of tenant databases
+	BackupDir         string // Directory backups are kept in without a bucket (default <DATA_DIR>/backups)
+	BackupS3URL       string // Bucket URL backups are uploaded to, with optional key prefix (empty = local disk)
+	BackupS3Region    string // S3 signing region
+	BackupS3AccessKey string // S3 access key ID
+	BackupS3SecretKey string // S3 secret access key
+
+	// Webhooks on Data API writes
+	WebhookMaxAttempts int // Deliveries sent before a webhook call is marked failed
+	WebhookTimeout     int // Seconds a webhook endpoint has to answer
+
+	// Error reporting to a Sentry-compatible service
+	SentryDSN         string  // DSN of the project errors are reported to (empty = disabled)
+	SentryEnvironment string  // Environment tag on reported errors
+	SentryRelease     string  // Release tag on reported errors
+	SentrySampleRate  float64 // Fraction of errors reported, from 0 to 1
+
 	// Cache configuration
 	// Priority: Redis > SQLite > in-memory
 	CacheRedisURL      string // Redis connection URL (empty = try SQLite or in-memory)
@@ -53,6 +131,41 @@ type Config struct {
 	CacheSQLitePath    string // SQLite cache path for LiteFS (e.g., "/litefs/cache.db")
 	CacheKeyPrefix     string // Key prefix for cache entries (e.g., "atomhost:instance:myapp:")
 
+	// Brute-force defenses of end-user sign-in
+	AuthMaxAttempts      int    // Sign-in attempts per email within AuthAttemptWindow before a lockout
+	AuthMaxIPAttempts    int    // Sign-in attempts per client IP within AuthAttemptWindow before a lockout
+	AuthAttemptWindow    int    // Seconds attempts are counted over
+	AuthLockout          int    // Seconds a locked out email or IP waits
+	AuthCaptchaVerifyURL string // siteverify endpoint of a CAPTCHA provider (empty = no CAPTCHA)
+	AuthCaptchaSecret    string // Secret sent to the CAPTCHA provider
+	AuthAlertWebhook     string // URL lockouts are POSTed to (empty = audit log only)
+	AuthTOTPIssuer       string // Issuer shown in authenticator apps
+	AuthMagicLinkTTL     int    // Seconds a magic link stays valid
+	AuthOTPTTL           int    // Seconds an emailed sign-in code stays valid
+
+	// Social sign-in of end users; a provider is offered once its client ID is set
+	AuthGoogleClientID     string
+	AuthGoogleClientSecret string
+	AuthGitHubClientID     string
+	AuthGitHubClientSecret string
+	AuthAppleClientID      string // Services ID
+	AuthAppleTeamID        string
+	AuthAppleKeyID         string
+	AuthApplePrivateKey    string // PEM of the key Apple client secrets are signed with
+	AuthOAuthLinkByEmail   bool   // Link a new identity to the user with its verified email (false = refuse the sign-in)
+
+	// Browser sessions for the API explorer and admin pages
+	AdminSessions         bool     // Accept admin session cookies issued by /admin/login and the OIDC flow
+	AdminSessionTTL       int      // Minutes an admin session lasts
+	AdminOIDCIssuer       string   // OpenID Connect issuer admins sign in with (empty = service key login only)
+	AdminOIDCClientID     string   // OAuth client ID registered with the issuer
+	AdminOIDCClientSecret string   // OAuth client secret
+	AdminOIDCEmails       []string // Verified emails allowed to sign in through the issuer
+
+	// Diagnostics
+	DebugEndpoints bool // Expose pprof and runtime stats under /platform/debug/
+	SmokeInterval  int  // Minutes between scheduled end-to-end smoke tests (0 = on demand only)
+
 	// Startup behavior
 	InitSchema bool // Run schema initialization on startup (default: false for fast cold starts)
 }
@@ -69,6 +182,15 @@ func init() {
 	if Cfg.TursoOrganization != "" && Cfg.TokenEncryptionKey == "" {
 		panic("TOKEN_ENCRYPTION_KEY is required when TURSO_ORGANIZATION is set")
 	}
+	switch Cfg.TenantBackend {
+	case "", "turso", "local":
+	case "d1":
+		if Cfg.CloudflareAccountID == "" || Cfg.CloudflareAPIToken == "" {
+			panic("CLOUDFLARE_ACCOUNT_ID and CLOUDFLARE_API_TOKEN are required when ATOMICBASE_TENANT_BACKEND is d1")
+		}
+	default:
+		panic("ATOMICBASE_TENANT_BACKEND must be turso, d1 or local")
+	}
 }
 
 // Load reads configuration from environment variables with sensible defaults.
@@ -97,6 +219,33 @@ func Load() Config {
 		}
 	}
 
+	// TURSO_GROUP_REGIONS lists the groups databases may be placed in, e.g.
+	// "default=aws-us-east-1,eu=aws-eu-west-1".
+	tursoGroupRegions := map[string]string{}
+	if val := os.Getenv("TURSO_GROUP_REGIONS"); val != "" {
+		for _, pair := range strings.Split(val, ",") {
+			group, region, ok := strings.Cut(pair, "=")
+			group, region = strings.TrimSpace(group), strings.TrimSpace(region)
+			if ok && group != "" && region != "" {
+				tursoGroupRegions[group] = region
+			}
+		}
+	}
+
+	rateLimit := 0.0
+	if val := os.Getenv("ATOMICBASE_RATE_LIMIT"); val != "" {
+		if r, err := strconv.ParseFloat(val, 64); err == nil && r > 0 {
+			rateLimit = r
+		}
+	}
+
+	sentrySampleRate := 1.0
+	if val := os.Getenv("SENTRY_SAMPLE_RATE"); val != "" {
+		if r, err := strconv.ParseFloat(val, 64); err == nil && r >= 0 && r <= 1 {
+			sentrySampleRate = r
+		}
+	}
+
 	maxQueryDepth := 5
 	if val := os.Getenv("ATOMICBASE_MAX_QUERY_DEPTH"); val != "" {
 		if d, err := strconv.Atoi(val); err == nil && d > 0 {
@@ -118,6 +267,13 @@ func Load() Config {
 		}
 	}
 
+	var adminOIDCEmails []string
+	for _, email := range strings.Split(os.Getenv("ATOMICBASE_ADMIN_OIDC_EMAILS"), ",") {
+		if email = strings.ToLower(strings.TrimSpace(email)); email != "" {
+			adminOIDCEmails = append(adminOIDCEmails, email)
+		}
+	}
+
 	return Config{
 		ApiURL:                  getEnv("API_URL", "http://localhost:8080"),
 		AppURL:                  strings.TrimSpace(os.Getenv("APP_URL")),
@@ -125,23 +281,53 @@ func Load() Config {
 		PrimaryDBName:           os.Getenv("PRIMARY_DB_NAME"),
 		PrimaryDBPath:           getEnv("DB_PATH", "atomicdata/primary.db"),
 		DataDir:                 getEnv("DATA_DIR", "atomicdata"),
+		TenantBackend:           strings.ToLower(strings.TrimSpace(os.Getenv("ATOMICBASE_TENANT_BACKEND"))),
+		LocalTenantDir:          os.Getenv("ATOMICBASE_LOCAL_TENANT_DIR"),
 		MaxRequestBody:          1 << 20, // 1MB
+		MaxBlobSize:             int64(parseIntEnv("ATOMICBASE_MAX_BLOB_SIZE", 10<<20)),
 		APIKey:                  os.Getenv("ATOMICBASE_API_KEY"),
 		CORSOrigins:             corsOrigins,
 		TrustedProxyCIDRs:       trustedProxyCIDRs,
+		TenantDomain:            strings.ToLower(strings.Trim(strings.TrimSpace(os.Getenv("ATOMICBASE_TENANT_DOMAIN")), ".")),
 		RequestTimeout:          requestTimeout,
 		MaxQueryDepth:           maxQueryDepth,
 		MaxQueryLimit:           maxQueryLimit,
 		DefaultLimit:            defaultLimit,
 		MaxOrganizationsPerUser: parseIntEnv("ATOMICBASE_MAX_ORGANIZATIONS_PER_USER", 3),
+		MaxDefinitions:          parseIntEnv("ATOMICBASE_MAX_DEFINITIONS", 0),
+		MaxDatabases:            parseIntEnv("ATOMICBASE_MAX_DATABASES", 0),
+		RequireQueryAllowlist:   strings.ToLower(os.Getenv("ATOMICBASE_REQUIRE_QUERY_ALLOWLIST")) == "true",
+		QueryCostLimit:          parseIntEnv("ATOMICBASE_QUERY_COST_LIMIT", 0),
+		QueryCostBudget:         parseIntEnv("ATOMICBASE_QUERY_COST_BUDGET", 0),
+		FullScanGuard:           strings.ToLower(strings.TrimSpace(os.Getenv("ATOMICBASE_FULL_SCAN_GUARD"))),
+		FullScanMinRows:         parseIntEnv("ATOMICBASE_FULL_SCAN_MIN_ROWS", 10000),
+		MaxConcurrentPerCaller:  parseIntEnv("ATOMICBASE_MAX_CONCURRENT_PER_CALLER", 0),
+		RateLimit:               rateLimit,
+		RateLimitBurst:          parseIntEnv("ATOMICBASE_RATE_LIMIT_BURST", 0),
+		StreamFlushInterval:     parseIntEnv("ATOMICBASE_STREAM_FLUSH_INTERVAL", 100),
+		EventHeartbeatInterval:  parseIntEnv("ATOMICBASE_EVENT_HEARTBEAT_INTERVAL", 15),
 
 		// Turso configuration
 		TursoOrganization:  os.Getenv("TURSO_ORGANIZATION"),
 		TursoAPIKey:        os.Getenv("TURSO_API_KEY"),
 		TursoGroup:         getEnv("TURSO_GROUP", "default"),
+		TursoGroupRegions:  tursoGroupRegions,
 		PrimaryDBToken:     os.Getenv("PRIMARY_DB_TOKEN"),
+		TursoCassette:      os.Getenv("TURSO_CASSETTE"),
+		TursoCassetteMode:  strings.ToLower(strings.TrimSpace(os.Getenv("TURSO_CASSETTE_MODE"))),
 		TokenEncryptionKey: os.Getenv("TOKEN_ENCRYPTION_KEY"),
 
+		CloudflareAccountID: os.Getenv("CLOUDFLARE_ACCOUNT_ID"),
+		CloudflareAPIToken:  os.Getenv("CLOUDFLARE_API_TOKEN"),
+
+		TenantPoolSize:           parseIntEnv("ATOMICBASE_TENANT_POOL_SIZE", 256),
+		TenantPoolMaxOpen:        parseIntEnv("ATOMICBASE_TENANT_POOL_MAX_OPEN", 8),
+		TenantPoolIdleTimeout:    parseIntEnv("ATOMICBASE_TENANT_POOL_IDLE_TIMEOUT", 300),
+		TenantPoolHealthInterval: parseIntEnv("ATOMICBASE_TENANT_POOL_HEALTH_INTERVAL", 30),
+
+		TenantReplicaDir:    os.Getenv("ATOMICBASE_TENANT_REPLICA_DIR"),
+		TenantReplicaMaxAge: parseIntEnv("ATOMICBASE_TENANT_REPLICA_MAX_AGE", 300),
+
 		SMTPHost:     strings.TrimSpace(os.Getenv("SMTP_HOST")),
 		SMTPPort:     parseIntEnv("SMTP_PORT", 587),
 		SMTPUsername: strings.TrimSpace(os.Getenv("SMTP_USERNAME")),
@@ -152,12 +338,82 @@ func Load() Config {
 		ActivityLogPath:      getEnv("ATOMICBASE_ACTIVITY_LOG_PATH", "atomicdata/logs.db"),
 		ActivityLogRetention: parseIntEnv("ATOMICBASE_ACTIVITY_LOG_RETENTION", 30),
 
+		LogShipSink:        strings.ToLower(strings.TrimSpace(os.Getenv("ATOMICBASE_LOG_SHIP_SINK"))),
+		LogShipURL:         strings.TrimSpace(os.Getenv("ATOMICBASE_LOG_SHIP_URL")),
+		LogShipBatchSize:   parseIntEnv("ATOMICBASE_LOG_SHIP_BATCH_SIZE", 500),
+		LogShipBufferSize:  parseIntEnv("ATOMICBASE_LOG_SHIP_BUFFER_SIZE", 10000),
+		LogShipInterval:    parseIntEnv("ATOMICBASE_LOG_SHIP_INTERVAL", 5),
+		LogShipS3Region:    getEnv("ATOMICBASE_LOG_SHIP_S3_REGION", "us-east-1"),
+		LogShipS3AccessKey: os.Getenv("ATOMICBASE_LOG_SHIP_S3_ACCESS_KEY"),
+		LogShipS3SecretKey: os.Getenv("ATOMICBASE_LOG_SHIP_S3_SECRET_KEY"),
+
+		ExportS3URL:       strings.TrimSpace(os.Getenv("ATOMICBASE_EXPORT_S3_URL")),
+		ExportS3Region:    getEnv("ATOMICBASE_EXPORT_S3_REGION", "us-east-1"),
+		ExportS3AccessKey: os.Getenv("ATOMICBASE_EXPORT_S3_ACCESS_KEY"),
+		ExportS3SecretKey: os.Getenv("ATOMICBASE_EXPORT_S3_SECRET_KEY"),
+		ExportURLTTL:      parseIntEnv("ATOMICBASE_EXPORT_URL_TTL", 3600),
+		ExportTimeout:     parseIntEnv("ATOMICBASE_EXPORT_TIMEOUT", 3600),
+		ImportMaxSize:     int64(parseIntEnv("ATOMICBASE_IMPORT_MAX_SIZE", 100<<20)),
+
+		StorageDir:           os.Getenv("ATOMICBASE_STORAGE_DIR"),
+		StorageS3URL:         strings.TrimSpace(os.Getenv("ATOMICBASE_STORAGE_S3_URL")),
+		StorageS3Region:      getEnv("ATOMICBASE_STORAGE_S3_REGION", "us-east-1"),
+		StorageS3AccessKey:   os.Getenv("ATOMICBASE_STORAGE_S3_ACCESS_KEY"),
+		StorageS3SecretKey:   os.Getenv("ATOMICBASE_STORAGE_S3_SECRET_KEY"),
+		StorageMaxObjectSize: int64(parseIntEnv("ATOMICBASE_STORAGE_MAX_OBJECT_SIZE", 50<<20)),
+		StorageURLTTL:        parseIntEnv("ATOMICBASE_STORAGE_URL_TTL", 3600),
+
+		BackupDir:         os.Getenv("ATOMICBASE_BACKUP_DIR"),
+		BackupS3URL:       strings.TrimSpace(os.Getenv("ATOMICBASE_BACKUP_S3_URL")),
+		BackupS3Region:    getEnv("ATOMICBASE_BACKUP_S3_REGION", "us-east-1"),
+		BackupS3AccessKey: os.Getenv("ATOMICBASE_BACKUP_S3_ACCESS_KEY"),
+		BackupS3SecretKey: os.Getenv("ATOMICBASE_BACKUP_S3_SECRET_KEY"),
+
+		WebhookMaxAttempts: parseIntEnv("ATOMICBASE_WEBHOOK_MAX_ATTEMPTS", 8),
+		WebhookTimeout:     parseIntEnv("ATOMICBASE_WEBHOOK_TIMEOUT", 10),
+
+		SentryDSN:         strings.TrimSpace(os.Getenv("SENTRY_DSN")),
+		SentryEnvironment: os.Getenv("SENTRY_ENVIRONMENT"),
+		SentryRelease:     os.Getenv("SENTRY_RELEASE"),
+		SentrySampleRate:  sentrySampleRate,
+
 		// Cache configuration
 		CacheRedisURL:      os.Getenv("CACHE_REDIS_URL"),
 		CacheRedisPassword: os.Getenv("CACHE_REDIS_PASSWORD"),
 		CacheSQLitePath:    os.Getenv("CACHE_SQLITE_PATH"),
 		CacheKeyPrefix:     os.Getenv("CACHE_KEY_PREFIX"),
 
+		AuthMaxAttempts:      parseIntEnv("ATOMICBASE_AUTH_MAX_ATTEMPTS", 5),
+		AuthMaxIPAttempts:    parseIntEnv("ATOMICBASE_AUTH_MAX_IP_ATTEMPTS", 30),
+		AuthAttemptWindow:    parseIntEnv("ATOMICBASE_AUTH_ATTEMPT_WINDOW", 900),
+		AuthLockout:          parseIntEnv("ATOMICBASE_AUTH_LOCKOUT", 900),
+		AuthCaptchaVerifyURL: strings.TrimSpace(os.Getenv("ATOMICBASE_AUTH_CAPTCHA_VERIFY_URL")),
+		AuthCaptchaSecret:    os.Getenv("ATOMICBASE_AUTH_CAPTCHA_SECRET"),
+		AuthAlertWebhook:     strings.TrimSpace(os.Getenv("ATOMICBASE_AUTH_ALERT_WEBHOOK")),
+		AuthTOTPIssuer:       getEnv("ATOMICBASE_AUTH_TOTP_ISSUER", "Atomicbase"),
+		AuthMagicLinkTTL:     parseIntEnv("ATOMICBASE_AUTH_MAGIC_LINK_TTL", 900),
+		AuthOTPTTL:           parseIntEnv("ATOMICBASE_AUTH_OTP_TTL", 600),
+
+		AuthGoogleClientID:     os.Getenv("ATOMICBASE_AUTH_GOOGLE_CLIENT_ID"),
+		AuthGoogleClientSecret: os.Getenv("ATOMICBASE_AUTH_GOOGLE_CLIENT_SECRET"),
+		AuthGitHubClientID:     os.Getenv("ATOMICBASE_AUTH_GITHUB_CLIENT_ID"),
+		AuthGitHubClientSecret: os.Getenv("ATOMICBASE_AUTH_GITHUB_CLIENT_SECRET"),
+		AuthAppleClientID:      os.Getenv("ATOMICBASE_AUTH_APPLE_CLIENT_ID"),
+		AuthAppleTeamID:        os.Getenv("ATOMICBASE_AUTH_APPLE_TEAM_ID"),
+		AuthAppleKeyID:         os.Getenv("ATOMICBASE_AUTH_APPLE_KEY_ID"),
+		AuthApplePrivateKey:    os.Getenv("ATOMICBASE_AUTH_APPLE_PRIVATE_KEY"),
+		AuthOAuthLinkByEmail:   strings.ToLower(os.Getenv("ATOMICBASE_AUTH_OAUTH_LINK_BY_EMAIL")) != "false",
+
+		AdminSessions:         strings.ToLower(os.Getenv("ATOMICBASE_ADMIN_SESSIONS")) == "true",
+		AdminSessionTTL:       parseIntEnv("ATOMICBASE_ADMIN_SESSION_TTL", 720),
+		AdminOIDCIssuer:       strings.TrimRight(strings.TrimSpace(os.Getenv("ATOMICBASE_ADMIN_OIDC_ISSUER")), "/"),
+		AdminOIDCClientID:     os.Getenv("ATOMICBASE_ADMIN_OIDC_CLIENT_ID"),
+		AdminOIDCClientSecret: os.Getenv("ATOMICBASE_ADMIN_OIDC_CLIENT_SECRET"),
+		AdminOIDCEmails:       adminOIDCEmails,
+
+		DebugEndpoints: strings.ToLower(os.Getenv("ATOMICBASE_DEBUG_ENDPOINTS")) == "true",
+		SmokeInterval:  parseIntEnv("ATOMICBASE_SMOKE_INTERVAL", 0),
+
 		// Startup behavior
 		InitSchema: strings.ToLower(os.Getenv("INIT_SCHEMA")) != "false",
 	}
@@ -0,0 +1,5 @@
+package config
+
+// Version is the atombase release, set when building with
+// -ldflags "-X github.com/atombasedev/atombase/config.Version=v1.2.0".
+var Version = "dev"
@@ -0,0 +1,352 @@
+package data
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"hash/maphash"
+	"math"
+	"math/bits"
+	"math/rand/v2"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/atombasedev/atombase/tools"
+)
+
+const (
+	MaxAggregateFields = 8     // Aggregates one request may compute
+	hllPrecision       = 14    // 2^14 HyperLogLog registers, about 0.8% standard error
+	percentileSample   = 10000 // Values a percentile estimate keeps of each column
+)
+
+// hllError is the standard error of a HyperLogLog count.
+var hllError = 1.04 / math.Sqrt(1<<hllPrecision)
+
+// approxSeed seeds the hash of counted values. Counts are never merged across
+// processes, so a per-process seed is enough.
+var approxSeed = maphash.MakeSeed()
+
+// AggregateResult holds the aggregates of an aggregate request, each with how
+// it was approximated.
+type AggregateResult struct {
+	Data        map[string]any           `json:"data"`
+	Rows        int64                    `json:"rows"` // Rows the aggregates read
+	Approximate map[string]Approximation `json:"approximate"`
+}
+
+// Approximation describes how close an aggregate is to the exact answer.
+type Approximation struct {
+	Method string `json:"method"` // hyperloglog or sample
+	// Relative standard error of a hyperloglog count.
+	StandardError float64 `json:"standardError,omitempty"`
+	// Values a sample kept, of the non-null values read. A sample that kept
+	// every value is exact.
+	Sampled int64 `json:"sampled,omitempty"`
+	Of      int64 `json:"of,omitempty"`
+}
+
+// approxAggregate is one parsed aggregate: fn on column, with the fraction
+// of a percentile.
+type approxAggregate struct {
+	name, fn, column string
+	fraction         float64
+}
+
+// parseAggregate parses approx_count_distinct(col), approx_percentile(col, p)
+// or approx_median(col).
+func (table CacheTable) parseAggregate(name, expr string) (approxAggregate, error) {
+	if len(expr) > MaxComputedExprLength {
+		return approxAggregate{}, fmt.Errorf("expression is longer than %d characters", MaxComputedExprLength)
+	}
+	fn, rest, ok := strings.Cut(strings.TrimSpace(expr), "(")
+	fn = strings.ToLower(strings.TrimSpace(fn))
+	rawArgs, ok2 := strings.CutSuffix(strings.TrimSpace(rest), ")")
+	if !ok || !ok2 || fn == "" {
+		return approxAggregate{}, fmt.Errorf("expected fn(args)")
+	}
+	args := splitWindowList(rawArgs)
+	agg := approxAggregate{name: name, fn: fn}
+	switch fn {
+	case "approx_count_distinct", "approx_median":
+		if len(args) != 1 {
+			return approxAggregate{}, fmt.Errorf("%s takes one column", fn)
+		}
+		if fn == "approx_median" {
+			agg.fraction = 0.5
+		}
+	case "approx_percentile":
+		if len(args) != 2 {
+			return approxAggregate{}, fmt.Errorf("approx_percentile takes a column and a fraction between 0 and 1")
+		}
+		p, err := strconv.ParseFloat(args[1], 64)
+		if err != nil || p < 0 || p > 1 {
+			return approxAggregate{}, fmt.Errorf("%q must be a fraction between 0 and 1", args[1])
+		}
+		agg.fraction = p
+	default:
+		return approxAggregate{}, fmt.Errorf("aggregate %s is not allowed", fn)
+	}
+	colType, err := table.SearchCols(args[0])
+	if err != nil {
+		return approxAggregate{}, err
+	}
+	if fn != "approx_count_distinct" && (strings.EqualFold(colType, ColTypeText) || strings.EqualFold(colType, ColTypeBlob)) {
+		return approxAggregate{}, fmt.Errorf("%s needs a numeric column, %s is %s", fn, args[0], colType)
+	}
+	agg.column = args[0]
+	return agg, nil
+}
+
+// AggregateJSON computes approximate aggregates over the rows of relation the
+// caller may select. The rows are read once, in one scan: distinct counts go
+// into a HyperLogLog sketch, percentiles are read from a uniform sample of
+// each column, so neither needs the sort an exact answer would.
+func (dao *TenantConnection) AggregateJSON(ctx context.Context, relation string, query AggregateQuery) (AggregateResult, error) {
+	if err := tools.ValidateTableName(relation); err != nil {
+		return AggregateResult{}, err
+	}
+	shape := aggregateShape(relation, query)
+	tools.NoteQueryShape(ctx, shape)
+	if err := dao.Schema.checkQueryAllowed(shape); err != nil {
+		return AggregateResult{}, err
+	}
+	table, err := dao.Schema.SearchTbls(relation)
+	if err != nil {
+		return AggregateResult{}, err
+	}
+	if len(query.Aggregates) == 0 {
+		return AggregateResult{}, tools.InvalidRequestErr("aggregates are required")
+	}
+	if len(query.Aggregates) > MaxAggregateFields {
+		return AggregateResult{}, tools.InvalidRequestErr(fmt.Sprintf("at most %d aggregates are allowed", MaxAggregateFields))
+	}
+	names := make([]string, 0, len(query.Aggregates))
+	for name := range query.Aggregates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	aggs := make([]approxAggregate, 0, len(names))
+	var columns []string
+	for _, name := range names {
+		if err := tools.ValidateIdentifier(name); err != nil {
+			return AggregateResult{}, tools.InvalidRequestErr(fmt.Sprintf("aggregate %q: %v", name, err))
+		}
+		agg, err := table.parseAggregate(name, query.Aggregates[name])
+		if err != nil {
+			return AggregateResult{}, tools.InvalidRequestErr(fmt.Sprintf("aggregate %q: %v", name, err))
+		}
+		aggs = append(aggs, agg)
+		if !slices.Contains(columns, agg.column) {
+			columns = append(columns, agg.column)
+		}
+	}
+	if queryCostLimited() {
+		// Every row is read into Go, not just a page of them.
+		rows, err := dao.tableRows(ctx, dao.Client, relation)
+		if err != nil {
+			return AggregateResult{}, err
+		}
+		if err := dao.chargeQueryCost(1 + rows/rowsPerPoint); err != nil {
+			return AggregateResult{}, err
+		}
+	}
+
+	policy, err := dao.compilePolicy(ctx, relation, "select", nil)
+	if err != nil {
+		return AggregateResult{}, err
+	}
+	if err := dao.Schema.checkAllowedOperators(query.Where); err != nil {
+		return AggregateResult{}, err
+	}
+	where, args, err := table.BuildWhereFromJSON(query.Where, dao.Schema)
+	if err != nil {
+		return AggregateResult{}, err
+	}
+	where = dao.Schema.excludeSoftDeleted(where, relation)
+	where, args = appendPolicyWhere(where, args, policy)
+	selects := make([]string, len(columns))
+	for i, col := range columns {
+		selects[i] = fmt.Sprintf("[%s].[%s]", relation, col)
+	}
+	sqlQuery := fmt.Sprintf("SELECT %s FROM %s %s", strings.Join(selects, ", "), dao.Schema.source(relation), where)
+	sqlQuery, args = applyPolicyCTE(sqlQuery, args, dao, strings.Contains(sqlQuery, "__ab_membership"))
+
+	sketches := map[string]*hyperLogLog{}
+	samples := map[string]*reservoir{}
+	for _, agg := range aggs {
+		if agg.fn == "approx_count_distinct" {
+			sketches[agg.column] = &hyperLogLog{}
+		} else {
+			samples[agg.column] = &reservoir{}
+		}
+	}
+
+	rows, err := dao.Client.QueryContext(ctx, sqlQuery, args...)
+	if err != nil {
+		return AggregateResult{}, err
+	}
+	defer rows.Close()
+	values := make([]any, len(columns))
+	ptrs := make([]any, len(columns))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	var hash maphash.Hash
+	hash.SetSeed(approxSeed)
+	var n int64
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return AggregateResult{}, err
+		}
+		n++
+		for i, col := range columns {
+			if values[i] == nil {
+				continue
+			}
+			if sketch := sketches[col]; sketch != nil {
+				sketch.add(hashValue(&hash, values[i]))
+			}
+			if sample := samples[col]; sample != nil {
+				if v, ok := numericValue(values[i]); ok {
+					sample.add(v)
+				}
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return AggregateResult{}, err
+	}
+	recordQuery(ctx, shape, n)
+
+	result := AggregateResult{Data: map[string]any{}, Rows: n, Approximate: map[string]Approximation{}}
+	for _, agg := range aggs {
+		if agg.fn == "approx_count_distinct" {
+			result.Data[agg.name] = sketches[agg.column].estimate()
+			result.Approximate[agg.name] = Approximation{Method: "hyperloglog", StandardError: hllError}
+			continue
+		}
+		sample := samples[agg.column]
+		result.Data[agg.name] = sample.percentile(agg.fraction)
+		result.Approximate[agg.name] = Approximation{Method: "sample", Sampled: int64(len(sample.values)), Of: sample.seen}
+	}
+	return result, nil
+}
+
+// hashValue hashes a value so that values COUNT(DISTINCT) treats as equal
+// hash the same: a REAL holding an integer counts as that INTEGER.
+func hashValue(h *maphash.Hash, v any) uint64 {
+	h.Reset()
+	var buf [8]byte
+	switch v := v.(type) {
+	case int64:
+		h.WriteByte('i')
+		binary.LittleEndian.PutUint64(buf[:], uint64(v))
+		h.Write(buf[:])
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<63 {
+			return hashValue(h, int64(v))
+		}
+		h.WriteByte('r')
+		binary.LittleEndian.PutUint64(buf[:], math.Float64bits(v))
+		h.Write(buf[:])
+	case bool:
+		if v {
+			return hashValue(h, int64(1))
+		}
+		return hashValue(h, int64(0))
+	case string:
+		h.WriteByte('t')
+		h.WriteString(v)
+	case []byte:
+		h.WriteByte('b')
+		h.Write(v)
+	case time.Time:
+		h.WriteByte('t')
+		h.WriteString(v.Format(time.RFC3339Nano))
+	default:
+		h.WriteByte('t')
+		h.WriteString(fmt.Sprint(v))
+	}
+	return h.Sum64()
+}
+
+// numericValue returns a value a percentile can be taken of.
+func numericValue(v any) (float64, bool) {
+	switch v := v.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, !math.IsNaN(v)
+	}
+	return 0, false
+}
+
+// hyperLogLog estimates the number of distinct hashes added to it.
+type hyperLogLog struct {
+	registers [1 << hllPrecision]uint8
+}
+
+func (h *hyperLogLog) add(hash uint64) {
+	idx := hash >> (64 - hllPrecision)
+	// The remaining bits, with a stop bit so rho is at most 64-p+1.
+	rho := uint8(bits.LeadingZeros64(hash<<hllPrecision|1<<(hllPrecision-1))) + 1
+	if rho > h.registers[idx] {
+		h.registers[idx] = rho
+	}
+}
+
+func (h *hyperLogLog) estimate() int64 {
+	m := float64(len(h.registers))
+	var sum float64
+	var zeros int
+	for _, r := range h.registers {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+	estimate := 0.7213 / (1 + 1.079/m) * m * m / sum
+	// Small counts leave registers empty; linear counting is closer then.
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return int64(math.Round(estimate))
+}
+
+// reservoir keeps a uniform sample of up to percentileSample values.
+type reservoir struct {
+	values []float64
+	seen   int64
+	sorted bool
+}
+
+func (r *reservoir) add(v float64) {
+	r.seen++
+	if len(r.values) < percentileSample {
+		r.values = append(r.values, v)
+		return
+	}
+	if i := rand.Int64N(r.seen); i < percentileSample {
+		r.values[i] = v
+	}
+}
+
+// percentile interpolates the value at fraction p of the sample, or returns
+// nil when it holds no values.
+func (r *reservoir) percentile(p float64) any {
+	if len(r.values) == 0 {
+		return nil
+	}
+	if !r.sorted {
+		slices.Sort(r.values)
+		r.sorted = true
+	}
+	rank := p * float64(len(r.values)-1)
+	lo := int(math.Floor(rank))
+	hi := int(math.Ceil(rank))
+	return r.values[lo] + (r.values[hi]-r.values[lo])*(rank-float64(lo))
+}
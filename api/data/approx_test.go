@@ -0,0 +1,81 @@
+package data
+
+import (
+	"context"
+	"hash/maphash"
+	"math"
+	"testing"
+
+	"github.com/atombasedev/atombase/definitions"
+)
+
+func TestAggregateJSON(t *testing.T) {
+	db := setupTestDB(t, `CREATE TABLE hits (id INTEGER PRIMARY KEY, user_id TEXT, latency REAL, path TEXT);`)
+	defer db.Close()
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 30000; i++ {
+		if _, err := tx.Exec(`INSERT INTO hits (user_id, latency, path) VALUES (?, ?, ?)`, i%5000, i%1000, []string{"/", "/docs"}[i%2]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	dao := &TenantConnection{Client: db, Schema: loadSchema(t, db), Principal: definitions.Principal{IsService: true}}
+	ctx := context.Background()
+
+	result, err := dao.AggregateJSON(ctx, "hits", AggregateQuery{Aggregates: map[string]string{
+		"visitors": "approx_count_distinct(user_id)",
+		"p90":      "approx_percentile(latency, 0.9)",
+		"median":   "approx_median(latency)",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if visitors := result.Data["visitors"].(int64); math.Abs(float64(visitors)-5000) > 5000*4*hllError {
+		t.Errorf("expected about 5000 visitors, got %d", visitors)
+	}
+	if p90 := result.Data["p90"].(float64); math.Abs(p90-899) > 20 {
+		t.Errorf("expected p90 near 899, got %v", p90)
+	}
+	if median := result.Data["median"].(float64); math.Abs(median-499.5) > 20 {
+		t.Errorf("expected a median near 499.5, got %v", median)
+	}
+	if result.Rows != 30000 || result.Approximate["visitors"].Method != "hyperloglog" ||
+		result.Approximate["p90"].Sampled != percentileSample || result.Approximate["p90"].Of != 30000 {
+		t.Errorf("unexpected metadata %+v", result)
+	}
+
+	// Small inputs are counted and sampled whole.
+	result, err = dao.AggregateJSON(ctx, "hits", AggregateQuery{
+		Aggregates: map[string]string{"paths": "approx_count_distinct(path)", "median": "approx_median(latency)"},
+		Where:      []map[string]any{{"id": map[string]any{"lte": 3}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Data["paths"].(int64) != 2 || result.Data["median"].(float64) != 1 || result.Approximate["median"].Of != 3 {
+		t.Errorf("unexpected small aggregates %+v", result)
+	}
+
+	for _, expr := range []string{"approx_median(path)", "approx_percentile(latency, 2)", "sum(latency)", "approx_count_distinct(missing)"} {
+		if _, err := dao.AggregateJSON(ctx, "hits", AggregateQuery{Aggregates: map[string]string{"x": expr}}); err == nil {
+			t.Errorf("expected %q to be refused", expr)
+		}
+	}
+}
+
+func TestHashValue(t *testing.T) {
+	var h maphash.Hash
+	h.SetSeed(approxSeed)
+	// COUNT(DISTINCT) counts 1 and 1.0 once, and '1' apart from them.
+	if hashValue(&h, int64(1)) != hashValue(&h, 1.0) {
+		t.Error("expected an integral REAL to hash as its INTEGER")
+	}
+	if hashValue(&h, int64(1)) == hashValue(&h, "1") || hashValue(&h, 1.5) == hashValue(&h, "1.5") {
+		t.Error("expected TEXT to hash apart from numbers")
+	}
+}
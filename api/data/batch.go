@@ -18,25 +18,42 @@ func (dao *TenantConnection) Batch(ctx context.Context, req BatchRequest) (Batch
 		return BatchResponse{}, tools.ErrBatchTooLarge
 	}
 
+	if req.Snapshot {
+		for i, op := range req.Operations {
+			if op.Operation != "select" {
+				return BatchResponse{}, tools.InvalidRequestErr(fmt.Sprintf("operation %d (%s on %s): snapshot batches can only select", i, op.Operation, op.Table))
+			}
+		}
+	}
+
+	// SQLite pins a transaction's view of the database at its first read, so
+	// every select in the batch sees the same snapshot whatever commits
+	// alongside it.
 	tx, err := dao.Client.BeginTx(ctx, nil)
 	if err != nil {
 		return BatchResponse{}, fmt.Errorf("failed to begin transaction: %w", err)
 	}
 	defer tx.Rollback()
+	dao.pendingChanges = nil
 
 	results := make([]any, len(req.Operations))
 
 	for i, op := range req.Operations {
 		result, err := dao.executeOperation(ctx, tx, op)
 		if err != nil {
+			err = dao.describeConstraint(ctx, tx, err, op.Table, op.Operation)
 			return BatchResponse{}, fmt.Errorf("operation %d (%s on %s): %w", i, op.Operation, op.Table, err)
 		}
 		results[i] = result
 	}
 
+	if req.Snapshot {
+		return BatchResponse{Results: results}, nil
+	}
 	if err := tx.Commit(); err != nil {
 		return BatchResponse{}, fmt.Errorf("failed to commit transaction: %w", err)
 	}
+	dao.flushChanges(ctx)
 
 	return BatchResponse{Results: results}, nil
 }
@@ -57,6 +74,16 @@ func (dao *TenantConnection) executeOperation(ctx context.Context, tx Executor,
 		if err := json.Unmarshal(result.Data, &data); err != nil {
 			return nil, err
 		}
+		if query.Cursor != nil {
+			page := map[string]any{"data": data, "nextCursor": nil}
+			if result.NextCursor != "" {
+				page["nextCursor"] = result.NextCursor
+			}
+			if op.Count {
+				page["count"] = result.Count
+			}
+			return page, nil
+		}
 		// If count was requested, return an object with data and count
 		if op.Count {
 			return map[string]any{
@@ -75,7 +102,7 @@ func (dao *TenantConnection) executeOperation(ctx context.Context, tx Executor,
 		if err != nil {
 			return nil, err
 		}
-		var result map[string]any
+		var result any
 		if err := json.Unmarshal(data, &result); err != nil {
 			return nil, err
 		}
@@ -86,11 +113,11 @@ func (dao *TenantConnection) executeOperation(ctx context.Context, tx Executor,
 		if err := mapToStruct(op.Body, &req); err != nil {
 			return nil, err
 		}
-		data, err := dao.upsertJSON(ctx, tx, op.Table, req)
+		data, err := dao.upsertJSON(ctx, tx, op.Table, dao.withConflictRule(op.Table, req))
 		if err != nil {
 			return nil, err
 		}
-		var result map[string]any
+		var result any
 		if err := json.Unmarshal(data, &result); err != nil {
 			return nil, err
 		}
@@ -105,7 +132,7 @@ func (dao *TenantConnection) executeOperation(ctx context.Context, tx Executor,
 		if err != nil {
 			return nil, err
 		}
-		var result map[string]any
+		var result any
 		if err := json.Unmarshal(data, &result); err != nil {
 			return nil, err
 		}
@@ -120,7 +147,7 @@ func (dao *TenantConnection) executeOperation(ctx context.Context, tx Executor,
 		if err != nil {
 			return nil, err
 		}
-		var result map[string]any
+		var result any
 		if err := json.Unmarshal(data, &result); err != nil {
 			return nil, err
 		}
@@ -0,0 +1,138 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/atombasedev/atombase/config"
+	"github.com/atombasedev/atombase/tools"
+)
+
+// blobContentTypeSuffix names the optional TEXT column that records the
+// Content-Type of a BLOB column: avatar_content_type for avatar.
+const blobContentTypeSuffix = "_content_type"
+
+// blobTarget checks that relation has a primary key and that column holds
+// BLOBs, and turns pk into a where list. A composite key lists its values
+// comma separated, in primary key order.
+func blobTarget(schema SchemaCache, relation, column, pk string) (CacheTable, []map[string]any, error) {
+	if err := tools.ValidateTableName(relation); err != nil {
+		return CacheTable{}, nil, err
+	}
+	table, err := schema.SearchTbls(relation)
+	if err != nil {
+		return CacheTable{}, nil, err
+	}
+	colType, err := table.SearchCols(column)
+	if err != nil {
+		return CacheTable{}, nil, err
+	}
+	if !strings.EqualFold(colType, ColTypeBlob) {
+		return CacheTable{}, nil, tools.InvalidRequestErr(fmt.Sprintf("%s.%s is %s, not BLOB", relation, column, colType))
+	}
+	if len(table.Pk) == 0 {
+		return CacheTable{}, nil, tools.InvalidRequestErr(fmt.Sprintf("blob endpoints need a primary key, and %s has none", relation))
+	}
+	values := strings.Split(pk, ",")
+	if len(values) != len(table.Pk) {
+		return CacheTable{}, nil, tools.InvalidRequestErr(fmt.Sprintf("%s has a %d column primary key (%s), got %d values",
+			relation, len(table.Pk), strings.Join(table.Pk, ", "), len(values)))
+	}
+	where := make([]map[string]any, len(table.Pk))
+	for i, col := range table.Pk {
+		where[i] = map[string]any{col: map[string]any{OpEq: values[i]}}
+	}
+	return table, where, nil
+}
+
+// blobContentTypeColumn returns the TEXT column recording column's
+// Content-Type, or "" when the table has none.
+func blobContentTypeColumn(table CacheTable, column string) string {
+	if colType, ok := table.Columns[column+blobContentTypeSuffix]; ok && strings.EqualFold(colType, ColTypeText) {
+		return column + blobContentTypeSuffix
+	}
+	return ""
+}
+
+// ReadBlob returns the BLOB in column of the row of relation with primary key
+// pk, and its recorded Content-Type if any. A NULL blob returns nil content.
+// The caller's select policy and API key scope apply as for a query.
+func (dao *TenantConnection) ReadBlob(ctx context.Context, relation, column, pk string) ([]byte, string, error) {
+	table, whereList, err := blobTarget(dao.Schema, relation, column, pk)
+	if err != nil {
+		return nil, "", err
+	}
+	shape := fmt.Sprintf("select %s select=%s where=%s", relation, column, whereShape(whereList))
+	tools.NoteQueryShape(ctx, shape)
+	if err := dao.Schema.checkQueryAllowed(shape); err != nil {
+		return nil, "", err
+	}
+	where, args, err := table.BuildWhereFromJSON(whereList, dao.Schema)
+	if err != nil {
+		return nil, "", err
+	}
+	where = dao.Schema.excludeSoftDeleted(where, relation)
+	policy, err := dao.compilePolicy(ctx, relation, "select", nil)
+	if err != nil {
+		return nil, "", err
+	}
+	where, args = appendPolicyWhere(where, args, policy)
+
+	typeColumn := "NULL"
+	if name := blobContentTypeColumn(table, column); name != "" {
+		typeColumn = fmt.Sprintf("[%s]", name)
+	}
+	query := fmt.Sprintf("SELECT [%s], %s FROM [%s] %s", column, typeColumn, relation, where)
+	query, args = applyPolicyCTE(query, args, dao, policy.NeedsMembershipCTE)
+
+	var content []byte
+	var contentType sql.NullString
+	err = dao.Client.QueryRowContext(ctx, query, args...).Scan(&content, &contentType)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, "", tools.ErrRowNotFound
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	recordQuery(ctx, shape, 1)
+	return content, contentType.String, nil
+}
+
+// WriteBlob stores content in column of the row of relation with primary key
+// pk, recording contentType when the table has a column for it. It is an
+// update through the usual path, so policies, validation and change streams
+// apply.
+func (dao *TenantConnection) WriteBlob(ctx context.Context, relation, column, pk string, content []byte, contentType string) error {
+	table, where, err := blobTarget(dao.Schema, relation, column, pk)
+	if err != nil {
+		return err
+	}
+	if int64(len(content)) > config.Cfg.MaxBlobSize {
+		return tools.ErrBlobTooLarge
+	}
+	data := map[string]any{column: content}
+	if name := blobContentTypeColumn(table, column); name != "" {
+		data[name] = nil
+		if contentType != "" {
+			data[name] = contentType
+		}
+	}
+	result, err := dao.UpdateJSON(ctx, relation, UpdateRequest{Data: data, Where: where})
+	if err != nil {
+		return err
+	}
+	var affected struct {
+		RowsAffected int64 `json:"rows_affected"`
+	}
+	if err := json.Unmarshal(result, &affected); err != nil {
+		return err
+	}
+	if affected.RowsAffected == 0 {
+		return tools.ErrRowNotFound
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/atombasedev/atombase/config"
+	"github.com/atombasedev/atombase/tools"
+)
+
+func TestReadWriteBlob(t *testing.T) {
+	db := setupTestDB(t, `
+		CREATE TABLE files (id INTEGER PRIMARY KEY, name TEXT, data BLOB, data_content_type TEXT, raw BLOB);
+		CREATE TABLE tags (post INTEGER, tag TEXT, icon BLOB, PRIMARY KEY (post, tag));
+	`)
+	defer db.Close()
+	dao := &TenantConnection{Client: db, Schema: loadSchema(t, db)}
+	ctx := context.Background()
+	prevMax := config.Cfg.MaxBlobSize
+	config.Cfg.MaxBlobSize = 16
+	t.Cleanup(func() { config.Cfg.MaxBlobSize = prevMax })
+
+	if _, err := db.Exec(`INSERT INTO files (id, name) VALUES (1, 'logo'); INSERT INTO tags (post, tag) VALUES (7, 'go')`); err != nil {
+		t.Fatal(err)
+	}
+
+	content, contentType, err := dao.ReadBlob(ctx, "files", "data", "1")
+	if err != nil || content != nil || contentType != "" {
+		t.Fatalf("expected an empty blob, got %q %q, %v", content, contentType, err)
+	}
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x01")
+	if err := dao.WriteBlob(ctx, "files", "data", "1", png, "image/png"); err != nil {
+		t.Fatal(err)
+	}
+	content, contentType, err = dao.ReadBlob(ctx, "files", "data", "1")
+	if err != nil || !bytes.Equal(content, png) || contentType != "image/png" {
+		t.Fatalf("expected the stored png, got %q %q, %v", content, contentType, err)
+	}
+
+	// Without a content type column the type is not recorded.
+	if err := dao.WriteBlob(ctx, "files", "raw", "1", []byte("abc"), "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	if content, contentType, err := dao.ReadBlob(ctx, "files", "raw", "1"); err != nil || string(content) != "abc" || contentType != "" {
+		t.Fatalf("expected raw bytes without a type, got %q %q, %v", content, contentType, err)
+	}
+
+	if err := dao.WriteBlob(ctx, "tags", "icon", "7,go", []byte("icon"), ""); err != nil {
+		t.Fatal(err)
+	}
+	if content, _, err := dao.ReadBlob(ctx, "tags", "icon", "7,go"); err != nil || string(content) != "icon" {
+		t.Fatalf("expected the icon by composite key, got %q, %v", content, err)
+	}
+
+	for name, call := range map[string]func() error{
+		"missing row":    func() error { _, _, err := dao.ReadBlob(ctx, "files", "data", "2"); return err },
+		"missing update": func() error { return dao.WriteBlob(ctx, "files", "data", "2", []byte("x"), "") },
+	} {
+		if err := call(); !errors.Is(err, tools.ErrRowNotFound) {
+			t.Fatalf("%s: expected ErrRowNotFound, got %v", name, err)
+		}
+	}
+	if _, _, err := dao.ReadBlob(ctx, "files", "name", "1"); err == nil {
+		t.Fatal("expected a TEXT column to be refused")
+	}
+	if _, _, err := dao.ReadBlob(ctx, "tags", "icon", "7"); err == nil {
+		t.Fatal("expected a partial composite key to be refused")
+	}
+	if err := dao.WriteBlob(ctx, "files", "data", "1", make([]byte, 17), ""); !errors.Is(err, tools.ErrBlobTooLarge) {
+		t.Fatalf("expected a blob over the limit to be refused, got %v", err)
+	}
+}
+
+func TestOpenAPIBlobPaths(t *testing.T) {
+	schema, err := decodeSchemaCache([]byte(`{"tables": [
+		{"name": "files", "pk": ["id"], "columns": {"id": {"name": "id", "type": "INTEGER"}, "data": {"name": "data", "type": "BLOB"}}},
+		{"name": "logs", "columns": {"payload": {"name": "payload", "type": "BLOB"}}}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := schema.OpenAPISpec(1)["paths"].(map[string]any)
+	blob, ok := paths["/data/files/{pk}/data/blob"].(map[string]any)
+	if !ok || blob["get"] == nil || blob["put"] == nil {
+		t.Fatalf("expected blob routes for files.data, got %v", paths)
+	}
+	if len(paths) != 3 {
+		t.Fatalf("expected no blob routes for a table without a primary key, got %v", paths)
+	}
+}
@@ -0,0 +1,214 @@
+package data
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/atombasedev/atombase/config"
+	"github.com/atombasedev/atombase/tools"
+)
+
+const (
+	maxBroadcastPayload = 8192 // Bytes of JSON payload one message may carry
+	broadcastBuffer     = 64   // Messages a slow subscriber may fall behind before it misses some
+)
+
+// broadcastEventPattern is what a message's event name may be.
+var broadcastEventPattern = regexp.MustCompile(`^[A-Za-z0-9_.:-]{1,64}$`)
+
+// BroadcastRequest publishes a message to a broadcast channel.
+type BroadcastRequest struct {
+	Event   string          `json:"event,omitempty"` // Defaults to message
+	Payload json.RawMessage `json:"payload"`
+}
+
+// BroadcastMessage is a message as subscribers receive it.
+type BroadcastMessage struct {
+	ID      string          `json:"id"`
+	Event   string          `json:"event"`
+	Payload json.RawMessage `json:"payload"`
+	From    string          `json:"from,omitempty"` // The publishing user, empty for service callers
+	SentAt  time.Time       `json:"sentAt"`
+}
+
+// BroadcastResult reports how many subscribers a message was handed to.
+type BroadcastResult struct {
+	ID        string `json:"id"`
+	Delivered int    `json:"delivered"`
+}
+
+// broadcastHub passes messages between the subscribers of each broadcast
+// channel, per database, in server memory. Nothing is stored: a message only
+// reaches the streams open on this server when it is published.
+type broadcastHub struct {
+	mu       sync.Mutex
+	channels map[string]map[chan BroadcastMessage]struct{} // Keyed by database ID and channel
+}
+
+func newBroadcastHub() *broadcastHub {
+	return &broadcastHub{channels: map[string]map[chan BroadcastMessage]struct{}{}}
+}
+
+func (h *broadcastHub) subscribe(databaseID, channel string) chan BroadcastMessage {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	key := eventKey(databaseID, channel)
+	subs := h.channels[key]
+	if subs == nil {
+		subs = map[chan BroadcastMessage]struct{}{}
+		h.channels[key] = subs
+	}
+	ch := make(chan BroadcastMessage, broadcastBuffer)
+	subs[ch] = struct{}{}
+	return ch
+}
+
+func (h *broadcastHub) unsubscribe(databaseID, channel string, ch chan BroadcastMessage) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	key := eventKey(databaseID, channel)
+	delete(h.channels[key], ch)
+	if len(h.channels[key]) == 0 {
+		delete(h.channels, key)
+	}
+}
+
+// publish hands a message to every subscriber of a channel and returns how
+// many took it. Messages are ephemeral, so a subscriber whose buffer is full
+// misses this one rather than being disconnected.
+func (h *broadcastHub) publish(databaseID, channel string, msg BroadcastMessage) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delivered := 0
+	for ch := range h.channels[eventKey(databaseID, channel)] {
+		select {
+		case ch <- msg:
+			delivered++
+		default:
+		}
+	}
+	return delivered
+}
+
+// authorizeBroadcast checks that the caller may subscribe to or publish on a
+// channel.
+func (dao *TenantConnection) authorizeBroadcast(name string, publish bool) error {
+	if !presenceChannelPattern.MatchString(name) {
+		return tools.InvalidRequestErr("broadcast channel names are 1-128 letters, digits, _ . : or -")
+	}
+	if dao.Schema.Settings == nil {
+		return fmt.Errorf("%w: %s", tools.ErrBroadcastNotFound, name)
+	}
+	channel, ok := matchChannel(dao.Schema.Settings.Broadcast, name)
+	if !ok {
+		return fmt.Errorf("%w: %s", tools.ErrBroadcastNotFound, name)
+	}
+	// Channels are not tables, so a key limited to some can't be checked
+	// against them.
+	if scope := dao.Principal.KeyScope; scope != nil && !scope.FullAccess() {
+		return fmt.Errorf("%w: broadcast channel %s", tools.ErrAPIKeyScope, name)
+	}
+	if dao.Principal.IsService {
+		return nil
+	}
+	if dao.Principal.UserID == "" {
+		return tools.UnauthorizedErr("broadcast channels require a signed-in user")
+	}
+	rule, action := channel.Subscribe, "subscribe to"
+	if publish {
+		rule, action = channel.Publish, "publish on"
+	}
+	if claim, ok := dao.missingClaim(rule); ok {
+		return fmt.Errorf("%w: claim %s does not allow you to %s %s", tools.ErrBroadcastForbidden, claim, action, name)
+	}
+	return nil
+}
+
+// serveBroadcast streams a channel's messages as Server-Sent Events until the
+// client disconnects.
+func (api *API) serveBroadcast(w http.ResponseWriter, req *http.Request, dao *TenantConnection, channel string) error {
+	if err := dao.authorizeBroadcast(channel, false); err != nil {
+		return err
+	}
+	ch := api.broadcast.subscribe(dao.ID, channel)
+	defer api.broadcast.unsubscribe(dao.ID, channel, ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Time{})
+	tools.LiftRequestTimeout(req.Context())
+	if _, err := fmt.Fprint(w, ": connected\n\n"); err != nil {
+		return nil
+	}
+	_ = rc.Flush()
+
+	interval := time.Duration(config.Cfg.EventHeartbeatInterval) * time.Second
+	if interval <= 0 {
+		interval = 15 * time.Second
+	}
+	heartbeat := time.NewTicker(interval)
+	defer heartbeat.Stop()
+	ctx := req.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return nil
+			}
+			_ = rc.Flush()
+		case msg := <-ch:
+			data, err := json.Marshal(msg)
+			if err != nil {
+				return nil
+			}
+			if _, err := fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", msg.ID, msg.Event, data); err != nil {
+				return nil
+			}
+			_ = rc.Flush()
+		}
+	}
+}
+
+// publishBroadcast sends a message to the current subscribers of a channel.
+func (api *API) publishBroadcast(dao *TenantConnection, channel string, msg BroadcastRequest) (BroadcastResult, error) {
+	if err := dao.authorizeBroadcast(channel, true); err != nil {
+		return BroadcastResult{}, err
+	}
+	if msg.Event == "" {
+		msg.Event = "message"
+	}
+	if !broadcastEventPattern.MatchString(msg.Event) {
+		return BroadcastResult{}, tools.InvalidRequestErr("broadcast event names are 1-64 letters, digits, _ . : or -")
+	}
+	if len(msg.Payload) > maxBroadcastPayload {
+		return BroadcastResult{}, tools.InvalidRequestErr(fmt.Sprintf("broadcast payload is larger than %d bytes", maxBroadcastPayload))
+	}
+	var payload bytes.Buffer
+	if len(bytes.TrimSpace(msg.Payload)) == 0 {
+		payload.WriteString("null")
+	} else if err := json.Compact(&payload, msg.Payload); err != nil {
+		return BroadcastResult{}, tools.InvalidRequestErr("broadcast payload must be JSON")
+	}
+	id := make([]byte, 8)
+	_, _ = rand.Read(id)
+	out := BroadcastMessage{
+		ID:      hex.EncodeToString(id),
+		Event:   msg.Event,
+		Payload: payload.Bytes(),
+		From:    dao.Principal.UserID,
+		SentAt:  time.Now().UTC(),
+	}
+	return BroadcastResult{ID: out.ID, Delivered: api.broadcast.publish(dao.ID, channel, out)}, nil
+}
@@ -0,0 +1,94 @@
+package data
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/atombasedev/atombase/definitions"
+	"github.com/atombasedev/atombase/tools"
+)
+
+func TestPublishBroadcast(t *testing.T) {
+	api := &API{broadcast: newBroadcastHub()}
+	schema := SchemaCache{Settings: &APISettings{Broadcast: map[string]BroadcastChannel{
+		"room:*":  {},
+		"alerts":  {Publish: map[string]any{"role": "admin"}},
+		"team:hq": {Subscribe: map[string]any{"team": "hq"}},
+	}}}
+	conn := func(id string, principal definitions.Principal) *TenantConnection {
+		return &TenantConnection{ID: id, Schema: schema, Principal: principal}
+	}
+	ada := conn("db", definitions.Principal{UserID: "ada"})
+
+	room := api.broadcast.subscribe("db", "room:1")
+	other := api.broadcast.subscribe("other-db", "room:1")
+	result, err := api.publishBroadcast(ada, "room:1", BroadcastRequest{Event: "cursor", Payload: json.RawMessage(` {"x": 4} `)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Delivered != 1 {
+		t.Errorf("expected one subscriber, got %d", result.Delivered)
+	}
+	select {
+	case msg := <-room:
+		if msg.ID != result.ID || msg.Event != "cursor" || msg.From != "ada" || string(msg.Payload) != `{"x":4}` {
+			t.Errorf("got %+v", msg)
+		}
+	default:
+		t.Fatal("expected the subscriber to receive the message")
+	}
+	if len(other) != 0 {
+		t.Error("expected another database's channel to be separate")
+	}
+
+	// A slow subscriber misses messages rather than blocking the publisher.
+	for i := 0; i < broadcastBuffer+1; i++ {
+		if _, err := api.publishBroadcast(ada, "room:1", BroadcastRequest{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if msg := <-room; msg.Event != "message" || string(msg.Payload) != "null" {
+		t.Errorf("expected the default event and a null payload, got %+v", msg)
+	}
+	api.broadcast.unsubscribe("db", "room:1", room)
+	api.broadcast.unsubscribe("other-db", "room:1", other)
+	if len(api.broadcast.channels) != 0 {
+		t.Error("expected channels without subscribers to be dropped")
+	}
+
+	for name, tt := range map[string]struct {
+		dao     *TenantConnection
+		channel string
+		msg     BroadcastRequest
+		want    error // nil accepts any error
+	}{
+		"undeclared":    {ada, "kitchen", BroadcastRequest{}, tools.ErrBroadcastNotFound},
+		"publish claim": {ada, "alerts", BroadcastRequest{}, tools.ErrBroadcastForbidden},
+		"anonymous":     {conn("db", definitions.Principal{}), "room:1", BroadcastRequest{}, tools.ErrUnauthorized},
+		"scoped key":    {conn("db", definitions.Principal{IsService: true, KeyScope: &tools.APIKeyScope{KeyID: "k1", Tables: []string{"notes"}, Verbs: []string{tools.VerbWrite}}}), "room:1", BroadcastRequest{}, tools.ErrAPIKeyScope},
+		"invalid event": {ada, "room:1", BroadcastRequest{Event: "a\nb"}, nil},
+		"invalid JSON":  {ada, "room:1", BroadcastRequest{Payload: json.RawMessage(`{"x":`)}, nil},
+		"invalid name":  {ada, "room/1", BroadcastRequest{}, nil},
+		"large payload": {ada, "room:1", BroadcastRequest{Payload: make(json.RawMessage, maxBroadcastPayload+1)}, nil},
+	} {
+		_, err := api.publishBroadcast(tt.dao, tt.channel, tt.msg)
+		if err == nil || tt.want != nil && !errors.Is(err, tt.want) {
+			t.Errorf("%s: expected %v, got %v", name, tt.want, err)
+		}
+	}
+
+	admin := conn("db", definitions.Principal{UserID: "grace", Claims: map[string]any{"role": "admin"}})
+	if _, err := api.publishBroadcast(admin, "alerts", BroadcastRequest{}); err != nil {
+		t.Errorf("expected the claim to allow publishing, got %v", err)
+	}
+	if _, err := api.publishBroadcast(conn("db", definitions.Principal{IsService: true}), "alerts", BroadcastRequest{}); err != nil {
+		t.Errorf("expected service callers to publish, got %v", err)
+	}
+	if err := ada.authorizeBroadcast("team:hq", false); !errors.Is(err, tools.ErrBroadcastForbidden) {
+		t.Errorf("expected the subscribe claim to be required, got %v", err)
+	}
+	if err := ada.authorizeBroadcast("team:hq", true); err != nil {
+		t.Errorf("expected publishing without a publish rule, got %v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package data
 
 import (
+	"cmp"
 	"fmt"
 	"strings"
 
@@ -23,12 +24,21 @@ func sanitizeJSONKey(key string) (string, error) {
 
 // Relation represents a table with optional column selections and joins.
 type Relation struct {
-	name    string
-	alias   string
-	inner   bool
-	columns []column
-	joins   []*Relation
-	parent  *Relation
+	name     string
+	alias    string
+	inner    bool
+	one      bool // Embedded as an object or null rather than an array (relation!one)
+	columns  []column
+	joins    []*Relation
+	parent   *Relation
+	computed []computedColumn // Root relation only
+	search   *relationSearch  // Root relation only
+}
+
+// relationSearch joins the root relation to its full-text search matches.
+type relationSearch struct {
+	join string
+	args []any
 }
 
 type column struct {
@@ -44,6 +54,17 @@ func (schema SchemaCache) findForeignKey(table, references string) CacheFk {
 	return fk
 }
 
+// embedAggregate aggregates the rows of a relation joined on fk into a JSON
+// array, or into its row or null when it holds at most one: the foreign key
+// is unique or the select says so with relation!one.
+func embedAggregate(rel *Relation, fk CacheFk, aggs string) string {
+	agg := fmt.Sprintf("json_group_array(%s) FILTER (WHERE [%s].[%s] IS NOT NULL)", aggs, fk.Table, fk.From)
+	if rel.one || fk.Unique {
+		return fmt.Sprintf("json_extract(%s, '$[0]')", agg)
+	}
+	return agg
+}
+
 // relationDepth calculates the maximum nesting depth of a Relation tree.
 func relationDepth(rel *Relation) int {
 	if rel == nil || len(rel.joins) == 0 {
@@ -93,15 +114,19 @@ func buildJSONAggregation(pairs []string) string {
 }
 
 // buildSelect constructs a SELECT query with JSON aggregation for the root relation.
-func (schema SchemaCache) buildSelect(rel Relation, policies selectPolicySet) (string, string, []any, error) {
+// Returns: (selectQuery, groupByClause, jsonAggregation, policyArgs, error)
+// The caller must place WHERE, including the root relation's policy, between
+// selectQuery and groupByClause.
+func (schema SchemaCache) buildSelect(rel Relation, policies selectPolicySet) (string, string, string, []any, error) {
 	// Check query depth limit
 	if depth := relationDepth(&rel); depth > config.Cfg.MaxQueryDepth {
-		return "", "", nil, fmt.Errorf("%w: depth %d exceeds limit %d", tools.ErrQueryTooDeep, depth, config.Cfg.MaxQueryDepth)
+		return "", "", "", nil, fmt.Errorf("%w: depth %d exceeds limit %d", tools.ErrQueryTooDeep, depth, config.Cfg.MaxQueryDepth)
 	}
 
 	var aggPairs []string
 	sel := ""
 	joins := ""
+	groupBy := ""
 	var policyArgs []any
 
 	if rel.columns == nil && rel.joins == nil {
@@ -110,7 +135,7 @@ func (schema SchemaCache) buildSelect(rel Relation, policies selectPolicySet) (s
 
 	tbl, err := schema.SearchTbls(rel.name)
 	if err != nil {
-		return "", "", nil, err
+		return "", "", "", nil, err
 	}
 
 	for _, col := range rel.columns {
@@ -125,9 +150,22 @@ func (schema SchemaCache) buildSelect(rel Relation, policies selectPolicySet) (s
 			continue
 		}
 
+		if path, ok, err := tbl.jsonPathColumn(col.name); ok {
+			if err != nil {
+				return "", "", "", nil, err
+			}
+			key, err := sanitizeJSONKey(cmp.Or(col.alias, path.key))
+			if err != nil {
+				return "", "", "", nil, err
+			}
+			sel += fmt.Sprintf("%s AS [%s], ", path.selectSQL(rel.name), col.name)
+			aggPairs = append(aggPairs, fmt.Sprintf("'%s', %s", key, path.aggregated("["+col.name+"]")))
+			continue
+		}
+
 		column, err := tbl.SearchCols(col.name)
 		if err != nil {
-			return "", "", nil, err
+			return "", "", "", nil, err
 		}
 
 		if strings.EqualFold(column, ColTypeBlob) {
@@ -138,7 +176,7 @@ func (schema SchemaCache) buildSelect(rel Relation, policies selectPolicySet) (s
 		if col.alias != "" {
 			sanitized, err := sanitizeJSONKey(col.alias)
 			if err != nil {
-				return "", "", nil, err
+				return "", "", "", nil, err
 			}
 			aggPairs = append(aggPairs, fmt.Sprintf("'%s', [%s]", sanitized, col.name))
 		} else {
@@ -146,11 +184,16 @@ func (schema SchemaCache) buildSelect(rel Relation, policies selectPolicySet) (s
 		}
 	}
 
+	for _, col := range rel.computed {
+		sel += fmt.Sprintf("(%s) AS [%s], ", col.sql, col.name)
+		aggPairs = append(aggPairs, fmt.Sprintf("'%s', [%s]", col.name, col.name))
+	}
+
 	for _, joinTbl := range rel.joins {
 		if joinTbl.alias != "" {
 			sanitized, err := sanitizeJSONKey(joinTbl.alias)
 			if err != nil {
-				return "", "", nil, err
+				return "", "", "", nil, err
 			}
 			aggPairs = append(aggPairs, fmt.Sprintf("'%s', json([%s])", sanitized, joinTbl.name))
 		} else {
@@ -158,16 +201,16 @@ func (schema SchemaCache) buildSelect(rel Relation, policies selectPolicySet) (s
 		}
 		query, aggs, joinArgs, err := schema.buildSelCurr(*joinTbl, rel.name, policies)
 		if err != nil {
-			return "", "", nil, err
+			return "", "", "", nil, err
 		}
 		policyArgs = append(policyArgs, joinArgs...)
 
 		fk := schema.findForeignKey(joinTbl.name, rel.name)
 		if fk == (CacheFk{}) {
-			return "", "", nil, tools.NoRelationshipErr(rel.name, joinTbl.name)
+			return "", "", "", nil, tools.NoRelationshipErr(rel.name, joinTbl.name)
 		}
 
-		sel += fmt.Sprintf("json_group_array(%s) FILTER (WHERE [%s].[%s] IS NOT NULL) AS [%s], ", aggs, fk.Table, fk.From, joinTbl.name)
+		sel += fmt.Sprintf("%s AS [%s], ", embedAggregate(joinTbl, fk, aggs), joinTbl.name)
 
 		if joinTbl.inner {
 			joins += "INNER "
@@ -178,19 +221,22 @@ func (schema SchemaCache) buildSelect(rel Relation, policies selectPolicySet) (s
 		joins += fmt.Sprintf("JOIN (%s) AS [%s] ON [%s].[%s] = [%s].[%s] ", query, joinTbl.name, fk.References, fk.To, fk.Table, fk.From)
 	}
 
-	query := "SELECT " + sel[:len(sel)-2] + fmt.Sprintf(" FROM [%s] ", rel.name) + joins
-	if predicate, ok := policies[rel.name]; ok && predicate.SQL != "" {
-		query += "WHERE " + predicate.SQL + " "
-		policyArgs = append(policyArgs, predicate.Args...)
+	if rel.search != nil {
+		joins = rel.search.join + joins
+		policyArgs = append(append([]any(nil), rel.search.args...), policyArgs...)
 	}
+	query := "SELECT " + sel[:len(sel)-2] + " FROM " + schema.source(rel.name) + " " + joins
 
 	// When there are joins, we need GROUP BY on root table columns to properly aggregate nested relations
 	if len(rel.joins) > 0 {
 		var rootGroupBy string
 		for _, col := range rel.columns {
-			if col.name != "*" {
+			switch {
+			case strings.Contains(col.name, "->"):
+				// A JSON path is grouped through its row's key below.
+			case col.name != "*":
 				rootGroupBy += fmt.Sprintf("[%s].[%s], ", rel.name, col.name)
-			} else {
+			default:
 				// Group by all columns of the root table
 				for _, c := range tbl.Columns {
 					rootGroupBy += fmt.Sprintf("[%s].[%s], ", rel.name, c)
@@ -206,11 +252,11 @@ func (schema SchemaCache) buildSelect(rel Relation, policies selectPolicySet) (s
 			}
 		}
 		if rootGroupBy != "" {
-			query += "GROUP BY " + rootGroupBy[:len(rootGroupBy)-2] + " "
+			groupBy = "GROUP BY " + rootGroupBy[:len(rootGroupBy)-2] + " "
 		}
 	}
 
-	return query, buildJSONAggregation(aggPairs), policyArgs, nil
+	return query, groupBy, buildJSONAggregation(aggPairs), policyArgs, nil
 }
 
 // buildSelCurr constructs a SELECT query for a nested/joined relation.
@@ -251,6 +297,19 @@ func (schema SchemaCache) buildSelCurr(rel Relation, joinedOn string, policies s
 			continue
 		}
 
+		if path, ok, err := tbl.jsonPathColumn(col.name); ok {
+			if err != nil {
+				return "", "", nil, err
+			}
+			key, err := sanitizeJSONKey(cmp.Or(col.alias, path.key))
+			if err != nil {
+				return "", "", nil, err
+			}
+			sel += fmt.Sprintf("%s AS [%s], ", path.selectSQL(rel.name), col.name)
+			aggPairs = append(aggPairs, fmt.Sprintf("'%s', %s", key, path.aggregated(fmt.Sprintf("[%s].[%s]", rel.name, col.name))))
+			continue
+		}
+
 		colType, err := tbl.SearchCols(col.name)
 		if err != nil {
 			return "", "", nil, err
@@ -297,7 +356,7 @@ func (schema SchemaCache) buildSelCurr(rel Relation, joinedOn string, policies s
 			return "", "", nil, tools.NoRelationshipErr(rel.name, joinTbl.name)
 		}
 
-		sel += fmt.Sprintf("json_group_array(%s) FILTER (WHERE [%s].[%s] IS NOT NULL) AS [%s], ", aggs, nestedFk.Table, nestedFk.From, joinTbl.name)
+		sel += fmt.Sprintf("%s AS [%s], ", embedAggregate(joinTbl, nestedFk, aggs), joinTbl.name)
 
 		if joinTbl.inner {
 			joins += "INNER "
@@ -308,7 +367,7 @@ func (schema SchemaCache) buildSelCurr(rel Relation, joinedOn string, policies s
 		joins += fmt.Sprintf("JOIN (%s) AS [%s] ON [%s].[%s] = [%s].[%s] ", query, joinTbl.name, nestedFk.References, nestedFk.To, nestedFk.Table, nestedFk.From)
 	}
 
-	query := "SELECT " + sel[:len(sel)-2] + fmt.Sprintf(" FROM [%s] ", rel.name) + joins
+	query := "SELECT " + sel[:len(sel)-2] + " FROM " + schema.source(rel.name) + " " + joins
 	if predicate, ok := policies[rel.name]; ok && predicate.SQL != "" {
 		query += "WHERE " + predicate.SQL + " "
 		policyArgs = append(policyArgs, predicate.Args...)
@@ -510,8 +569,9 @@ func splitTableColumn(s string) []string {
 }
 
 // BuildCustomJoinSelect builds a SELECT query with custom joins.
-// Returns: (selectQuery, groupByClause, jsonAggregation, error)
-// The caller must place WHERE between selectQuery and groupByClause.
+// Returns: (selectQuery, groupByClause, jsonAggregation, policyArgs, error)
+// The caller must place WHERE, including the base table's policy, between
+// selectQuery and groupByClause.
 func (schema SchemaCache) BuildCustomJoinSelect(cjq *CustomJoinQuery, policies selectPolicySet) (string, string, string, []any, error) {
 	var aggPairs []string
 	sel := ""
@@ -586,12 +646,14 @@ func (schema SchemaCache) BuildCustomJoinSelect(cjq *CustomJoinQuery, policies s
 		} else {
 			joins += "LEFT "
 		}
-		joins += fmt.Sprintf("JOIN [%s] ", j.table)
-		if j.alias != j.table {
-			joins += fmt.Sprintf("AS [%s] ", j.alias)
-		}
+		joins += "JOIN " + schema.sourceAs(j.table, j.alias) + " "
 		if predicate, ok := policies[j.table]; ok && predicate.SQL != "" {
-			onClause = "(" + onClause + ") AND (" + predicate.SQL + ")"
+			predicateSQL := predicate.SQL
+			if j.alias != j.table {
+				// Qualified references name the table, which is only visible under its alias.
+				predicateSQL = strings.ReplaceAll(predicateSQL, "["+j.table+"].", "["+j.alias+"].")
+			}
+			onClause = "(" + onClause + ") AND (" + predicateSQL + ")"
 			args = append(args, predicate.Args...)
 		}
 		joins += fmt.Sprintf("ON %s ", onClause)
@@ -675,11 +737,7 @@ func (schema SchemaCache) BuildCustomJoinSelect(cjq *CustomJoinQuery, policies s
 	}
 	sel = sel[:len(sel)-2] // Remove trailing ", "
 
-	query := fmt.Sprintf("SELECT %s FROM [%s] %s", sel, cjq.BaseTable, joins)
-	if predicate, ok := policies[cjq.BaseTable]; ok && predicate.SQL != "" {
-		query += "WHERE " + predicate.SQL + " "
-		args = append(args, predicate.Args...)
-	}
+	query := fmt.Sprintf("SELECT %s FROM %s %s", sel, schema.source(cjq.BaseTable), joins)
 
 	// Build GROUP BY for nested output (returned separately so caller can place WHERE before it)
 	var groupByClause string
@@ -732,24 +790,29 @@ func opToSQL(op string) string {
 		return "<"
 	case OpLte:
 		return "<="
+	case OpLike:
+		return "LIKE"
+	case OpGlob:
+		return "GLOB"
 	default:
 		return "="
 	}
 }
 
 // parseSelect parses a select parameter string into a Relation tree.
-// Syntax: "col1,col2,related_table(col1,col2),other_table(!)"
+// Syntax: "col1,col2,related_table(col1,col2),other_table!(col1),single!one(col1)"
 //   - Parentheses denote related tables (joins) when preceded by a table name
-//   - ! marks an inner join
+//   - ! marks an inner join, and !one a relation embedded as an object
 //   - : provides an alias (e.g., "alias:column")
 //   - Quotes allow special characters in names
 //   - Backslash escapes the next character
 func parseSelect(param string, table string) Relation {
-	tbl := Relation{table, "", false, nil, nil, nil}
+	tbl := Relation{name: table}
 	currTbl := &tbl
 	currStr := ""
 	alias := ""
 	inner := false
+	hint, hinting := "", false
 	quoted := false
 	escaped := false
 
@@ -772,11 +835,13 @@ func parseSelect(param string, table string) Relation {
 			quoted = !quoted
 		case '(':
 			// It's a relation/join
-			currTbl = &Relation{currStr, alias, inner, nil, nil, currTbl}
+			one := hint == relationHintOne
+			currTbl = &Relation{name: currStr, alias: alias, inner: inner && !one, one: one, parent: currTbl}
 			currTbl.parent.joins = append(currTbl.parent.joins, currTbl)
 			currStr = ""
 			alias = ""
 			inner = false
+			hint, hinting = "", false
 		case ')':
 			if currStr != "" {
 				currTbl.columns = append(currTbl.columns, column{currStr, alias})
@@ -789,6 +854,7 @@ func parseSelect(param string, table string) Relation {
 			currStr = ""
 		case '!':
 			inner = true
+			hinting = currStr != ""
 		case ',':
 			if currStr == "" {
 				continue
@@ -797,7 +863,11 @@ func parseSelect(param string, table string) Relation {
 			alias = ""
 			currStr = ""
 		default:
-			currStr += string(v)
+			if hinting {
+				hint += string(v)
+			} else {
+				currStr += string(v)
+			}
 		}
 	}
 
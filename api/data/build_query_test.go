@@ -1,6 +1,8 @@
 package data
 
 import (
+	"context"
+	"encoding/json"
 	"strings"
 	"testing"
 )
@@ -90,6 +92,71 @@ func TestParseSelect_InnerJoin(t *testing.T) {
 	}
 }
 
+func TestParseSelect_OneHint(t *testing.T) {
+	rel := parseSelect("id,profile!one(bio),posts!(title)", "users")
+
+	if len(rel.joins) != 2 {
+		t.Fatalf("expected 2 joins, got %d", len(rel.joins))
+	}
+	if profile := rel.joins[0]; profile.name != "profile" || !profile.one || profile.inner {
+		t.Errorf("expected a left-joined profile embedded as one, got %+v", profile)
+	}
+	if posts := rel.joins[1]; posts.one || !posts.inner {
+		t.Errorf("expected an inner-joined posts array, got %+v", posts)
+	}
+}
+
+func TestSelectJSON_OneRelation(t *testing.T) {
+	db := setupTestDB(t, `
+		CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT);
+		CREATE TABLE profiles (id INTEGER PRIMARY KEY, user_id INTEGER UNIQUE REFERENCES users(id), bio TEXT);
+		CREATE TABLE posts (id INTEGER PRIMARY KEY, user_id INTEGER REFERENCES users(id), title TEXT);
+		INSERT INTO users (id, name) VALUES (1, 'Alice'), (2, 'Bob');
+		INSERT INTO profiles (user_id, bio) VALUES (1, 'hi');
+		INSERT INTO posts (user_id, title) VALUES (1, 'first');
+	`)
+	defer db.Close()
+	dao := &TenantConnection{Client: db, Schema: loadSchema(t, db)}
+
+	query := func(sel []any) []map[string]any {
+		t.Helper()
+		result, err := dao.SelectJSON(context.Background(), "users", SelectQuery{Select: sel, Order: map[string]string{"id": "asc"}}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var rows []map[string]any
+		if err := json.Unmarshal(result.Data, &rows); err != nil {
+			t.Fatal(err)
+		}
+		return rows
+	}
+
+	// profiles.user_id is unique, so it embeds as an object or null.
+	rows := query([]any{"id", map[string]any{"profiles": []any{"bio"}}, map[string]any{"posts": []any{"title"}}})
+	if profile, ok := rows[0]["profiles"].(map[string]any); !ok || profile["bio"] != "hi" {
+		t.Errorf("expected Alice's profile as an object, got %v", rows[0]["profiles"])
+	}
+	if rows[1]["profiles"] != nil {
+		t.Errorf("expected null for Bob's missing profile, got %v", rows[1]["profiles"])
+	}
+	if posts, ok := rows[0]["posts"].([]any); !ok || len(posts) != 1 {
+		t.Errorf("expected posts as an array, got %v", rows[0]["posts"])
+	}
+
+	// The hint embeds a relation as one without a unique key.
+	rows = query([]any{"id", map[string]any{"posts!one": []any{"title"}}})
+	if post, ok := rows[0]["posts"].(map[string]any); !ok || post["title"] != "first" {
+		t.Errorf("expected Alice's post as an object, got %v", rows[0]["posts"])
+	}
+	if rows[1]["posts"] != nil {
+		t.Errorf("expected null for Bob's missing post, got %v", rows[1]["posts"])
+	}
+
+	if _, err := ParseSelectFromJSON([]any{map[string]any{"posts!many": []any{"title"}}}, "users"); err == nil {
+		t.Error("expected an unknown hint to be refused")
+	}
+}
+
 func TestParseSelect_Alias(t *testing.T) {
 	rel := parseSelect("user_id:id,full_name:name", "users")
 
@@ -0,0 +1,153 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/atombasedev/atombase/tools"
+)
+
+// inTransaction runs fn in a transaction and publishes the changes it wrote
+// once it commits.
+func (dao *TenantConnection) inTransaction(ctx context.Context, fn func(tx Executor) ([]byte, error)) ([]byte, error) {
+	tx, err := dao.Client.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	dao.pendingChanges = nil
+
+	result, err := fn(tx)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	dao.flushChanges(ctx)
+	return result, nil
+}
+
+// updateRowsJSON updates each of req.Rows, found by the primary key columns
+// it holds, to its other columns. Every row is its own UPDATE through the
+// usual path, so validation, policies and change streams apply per row; exec
+// should be a transaction so the rows change together.
+func (dao *TenantConnection) updateRowsJSON(ctx context.Context, exec Executor, relation string, req UpdateRequest) ([]byte, error) {
+	if len(req.Data) > 0 || len(req.Where) > 0 {
+		return nil, tools.InvalidRequestErr("rows cannot be combined with data or where")
+	}
+	table, err := bulkTable(dao.Schema, relation, len(req.Rows))
+	if err != nil {
+		return nil, err
+	}
+	results := make([][]byte, 0, len(req.Rows))
+	for i, row := range req.Rows {
+		where, data, err := splitRowKey(table, row)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %w", i, err)
+		}
+		if len(data) == 0 {
+			return nil, tools.InvalidRequestErr(fmt.Sprintf("row %d has no columns to update besides its primary key", i))
+		}
+		result, err := dao.updateJSON(ctx, exec, relation, UpdateRequest{Data: data, Where: where, Returning: req.Returning})
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %w", i, err)
+		}
+		results = append(results, result)
+	}
+	return mergeRowResults(results, len(req.Returning) > 0)
+}
+
+// deleteRowsJSON deletes each of req.Rows, which hold only primary key
+// columns, like updateRowsJSON updates them.
+func (dao *TenantConnection) deleteRowsJSON(ctx context.Context, exec Executor, relation string, req DeleteRequest) ([]byte, error) {
+	if len(req.Where) > 0 {
+		return nil, tools.InvalidRequestErr("rows cannot be combined with where")
+	}
+	table, err := bulkTable(dao.Schema, relation, len(req.Rows))
+	if err != nil {
+		return nil, err
+	}
+	results := make([][]byte, 0, len(req.Rows))
+	for i, row := range req.Rows {
+		where, rest, err := splitRowKey(table, row)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %w", i, err)
+		}
+		if len(rest) > 0 {
+			return nil, tools.InvalidRequestErr(fmt.Sprintf("row %d of a bulk delete may only hold primary key columns", i))
+		}
+		result, err := dao.deleteJSON(ctx, exec, relation, DeleteRequest{Where: where, Returning: req.Returning})
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %w", i, err)
+		}
+		results = append(results, result)
+	}
+	return mergeRowResults(results, len(req.Returning) > 0)
+}
+
+func bulkTable(schema SchemaCache, relation string, rows int) (CacheTable, error) {
+	if err := tools.ValidateTableName(relation); err != nil {
+		return CacheTable{}, err
+	}
+	table, err := schema.SearchTbls(relation)
+	if err != nil {
+		return CacheTable{}, err
+	}
+	if len(table.Pk) == 0 {
+		return CacheTable{}, tools.InvalidRequestErr(fmt.Sprintf("bulk writes need a primary key, and %s has none", relation))
+	}
+	if rows == 0 {
+		return CacheTable{}, tools.InvalidRequestErr("rows must hold at least one row")
+	}
+	if rows > MaxBatchOperations {
+		return CacheTable{}, tools.ErrBatchTooLarge
+	}
+	return table, nil
+}
+
+// splitRowKey turns the primary key columns of row into a where list and
+// returns the remaining columns.
+func splitRowKey(table CacheTable, row map[string]any) ([]map[string]any, map[string]any, error) {
+	rest := make(map[string]any, len(row))
+	for col, val := range row {
+		rest[col] = val
+	}
+	where := make([]map[string]any, 0, len(table.Pk))
+	for _, col := range table.Pk {
+		val, ok := rest[col]
+		if !ok || val == nil {
+			return nil, nil, tools.InvalidRequestErr(fmt.Sprintf("primary key column %s is required", col))
+		}
+		where = append(where, map[string]any{col: map[string]any{OpEq: val}})
+		delete(rest, col)
+	}
+	return where, rest, nil
+}
+
+// mergeRowResults adds up rows_affected, or concatenates the returned rows.
+func mergeRowResults(results [][]byte, returning bool) ([]byte, error) {
+	if returning {
+		rows := []json.RawMessage{}
+		for _, result := range results {
+			var part []json.RawMessage
+			if err := json.Unmarshal(result, &part); err != nil {
+				return nil, err
+			}
+			rows = append(rows, part...)
+		}
+		return json.Marshal(rows)
+	}
+	var total int64
+	for _, result := range results {
+		var part struct {
+			RowsAffected int64 `json:"rows_affected"`
+		}
+		if err := json.Unmarshal(result, &part); err != nil {
+			return nil, err
+		}
+		total += part.RowsAffected
+	}
+	return json.Marshal(map[string]any{"rows_affected": total})
+}
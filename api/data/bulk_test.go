@@ -0,0 +1,63 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestBulkUpdateAndDelete(t *testing.T) {
+	db := setupTestDB(t, schemaUsers)
+	defer db.Close()
+	dao := &TenantConnection{Client: db, Schema: loadSchema(t, db)}
+	ctx := context.Background()
+
+	if _, err := db.Exec(`INSERT INTO users (id, name, age) VALUES (1, 'Alice', 30), (2, 'Bob', 40), (3, 'Carol', 50)`); err != nil {
+		t.Fatal(err)
+	}
+	names := func() string {
+		var out string
+		if err := db.QueryRow(`SELECT group_concat(id || ':' || name || ':' || age, ',') FROM (SELECT * FROM users ORDER BY id)`).Scan(&out); err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+
+	result, err := dao.UpdateJSON(ctx, "users", UpdateRequest{Rows: []map[string]any{
+		{"id": 1, "name": "Alicia"},
+		{"id": 2, "age": 41},
+	}})
+	if err != nil || string(result) != `{"rows_affected":2}` {
+		t.Fatalf("expected 2 rows updated, got %s, %v", result, err)
+	}
+	if got := names(); got != "1:Alicia:30,2:Bob:41,3:Carol:50" {
+		t.Fatalf("expected each row updated by id, got %s", got)
+	}
+
+	// A bad row rolls back the rows before it.
+	if _, err := dao.UpdateJSON(ctx, "users", UpdateRequest{Rows: []map[string]any{
+		{"id": 1, "name": "Changed"},
+		{"name": "No key"},
+	}}); err == nil || !strings.Contains(err.Error(), "row 1") {
+		t.Fatalf("expected the row without a key to fail, got %v", err)
+	}
+	if got := names(); got != "1:Alicia:30,2:Bob:41,3:Carol:50" {
+		t.Fatalf("expected the failed bulk update to roll back, got %s", got)
+	}
+
+	result, err = dao.DeleteJSON(ctx, "users", DeleteRequest{Rows: []map[string]any{{"id": 1}, {"id": 3}}, Returning: []string{"name"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var deleted []map[string]any
+	if err := json.Unmarshal(result, &deleted); err != nil || len(deleted) != 2 || deleted[0]["name"] != "Alicia" || deleted[1]["name"] != "Carol" {
+		t.Fatalf("expected the deleted rows returned in order, got %s, %v", result, err)
+	}
+	if got := names(); got != "2:Bob:41" {
+		t.Fatalf("expected rows 1 and 3 deleted, got %s", got)
+	}
+	if _, err := dao.DeleteJSON(ctx, "users", DeleteRequest{Rows: []map[string]any{{"id": 2, "name": "Bob"}}}); err == nil {
+		t.Fatal("expected a bulk delete row with non-key columns to fail")
+	}
+}
@@ -0,0 +1,343 @@
+package data
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/atombasedev/atombase/tools"
+)
+
+// Limits on computed select expressions.
+const (
+	MaxComputedFields     = 16
+	MaxComputedExprLength = 256
+	maxComputedDepth      = 16
+)
+
+// computedFunctions are the SQLite scalar functions a computed field may call.
+// Aggregates like min and max are left out: with one argument they would
+// collapse the select into a single row.
+var computedFunctions = map[string]bool{
+	"abs": true, "round": true, "lower": true, "upper": true, "length": true,
+	"trim": true, "ltrim": true, "rtrim": true, "substr": true, "replace": true, "instr": true,
+	"coalesce": true, "ifnull": true, "nullif": true,
+	"date": true, "datetime": true, "julianday": true, "strftime": true,
+}
+
+// computedColumn is a validated computed field, compiled to SQL over the root table.
+type computedColumn struct {
+	name string
+	sql  string
+}
+
+// parseComputedParam parses ?computed=total:price*quantity,label:upper(name)
+// into name-expression pairs.
+func parseComputedParam(param string) (map[string]string, error) {
+	items, err := splitFilterList(param)
+	if err != nil {
+		return nil, tools.InvalidRequestErr("computed: " + err.Error())
+	}
+	fields := make(map[string]string, len(items))
+	for _, item := range items {
+		name, expr, ok := strings.Cut(item, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, tools.InvalidRequestErr(fmt.Sprintf("computed field %q must be name:expression", item))
+		}
+		fields[strings.TrimSpace(name)] = expr
+	}
+	return fields, nil
+}
+
+// compileComputed validates computed fields against the table and the
+// expression allowlist and compiles them to SQL, ordered by name.
+func compileComputed(table CacheTable, fields map[string]string) ([]computedColumn, error) {
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	if len(fields) > MaxComputedFields {
+		return nil, tools.InvalidRequestErr(fmt.Sprintf("at most %d computed fields are allowed", MaxComputedFields))
+	}
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	columns := make([]computedColumn, 0, len(names))
+	for _, name := range names {
+		if err := tools.ValidateIdentifier(name); err != nil {
+			return nil, tools.InvalidRequestErr(fmt.Sprintf("computed field %q: %v", name, err))
+		}
+		if _, ok := table.Columns[name]; ok || strings.HasPrefix(name, "__ab_") {
+			return nil, tools.InvalidRequestErr(fmt.Sprintf("computed field %q conflicts with a column", name))
+		}
+		sql, err := compileComputedExpr(table, fields[name])
+		if err != nil {
+			return nil, tools.InvalidRequestErr(fmt.Sprintf("computed field %q: %v", name, err))
+		}
+		columns = append(columns, computedColumn{name: name, sql: sql})
+	}
+	return columns, nil
+}
+
+// compileComputedExpr parses an expression of columns, numbers, 'strings',
+// NULL, the operators + - * / % || = != <> < <= > >=, parentheses and
+// allowlisted function calls, and returns it as SQL. Only parsed tokens are
+// written back, so nothing from the request reaches SQL verbatim.
+func compileComputedExpr(table CacheTable, expr string) (string, error) {
+	if len(expr) > MaxComputedExprLength {
+		return "", fmt.Errorf("expression is longer than %d characters", MaxComputedExprLength)
+	}
+	tokens, err := lexComputed(expr)
+	if err != nil {
+		return "", err
+	}
+	if len(tokens) == 0 {
+		return "", fmt.Errorf("expression is empty")
+	}
+	p := &computedParser{table: table, tokens: tokens}
+	sql, err := p.comparison(0)
+	if err != nil {
+		return "", err
+	}
+	if p.pos < len(p.tokens) {
+		return "", fmt.Errorf("unexpected %q", p.tokens[p.pos].text)
+	}
+	return sql, nil
+}
+
+type computedTokenKind int
+
+const (
+	tokIdent computedTokenKind = iota
+	tokNumber
+	tokString
+	tokOp
+	tokLParen
+	tokRParen
+	tokComma
+)
+
+type computedToken struct {
+	kind computedTokenKind
+	text string
+}
+
+var computedOperators = []string{"||", "<=", ">=", "!=", "<>", "+", "-", "*", "/", "%", "=", "<", ">"}
+
+func lexComputed(expr string) ([]computedToken, error) {
+	var tokens []computedToken
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '(':
+			tokens = append(tokens, computedToken{tokLParen, "("})
+			i++
+		case c == ')':
+			tokens = append(tokens, computedToken{tokRParen, ")"})
+			i++
+		case c == ',':
+			tokens = append(tokens, computedToken{tokComma, ","})
+			i++
+		case c == '\'':
+			var b strings.Builder
+			i++
+			for {
+				if i >= len(expr) {
+					return nil, fmt.Errorf("unterminated string")
+				}
+				if expr[i] == '\'' {
+					if i+1 < len(expr) && expr[i+1] == '\'' {
+						b.WriteByte('\'')
+						i += 2
+						continue
+					}
+					i++
+					break
+				}
+				b.WriteByte(expr[i])
+				i++
+			}
+			tokens = append(tokens, computedToken{tokString, b.String()})
+		case c >= '0' && c <= '9' || c == '.':
+			start, dot := i, false
+			for i < len(expr) && (expr[i] >= '0' && expr[i] <= '9' || expr[i] == '.' && !dot) {
+				dot = dot || expr[i] == '.'
+				i++
+			}
+			if expr[start:i] == "." {
+				return nil, fmt.Errorf("unexpected %q", ".")
+			}
+			tokens = append(tokens, computedToken{tokNumber, expr[start:i]})
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			start := i
+			for i < len(expr) && (expr[i] == '_' || expr[i] >= 'a' && expr[i] <= 'z' || expr[i] >= 'A' && expr[i] <= 'Z' || expr[i] >= '0' && expr[i] <= '9') {
+				i++
+			}
+			tokens = append(tokens, computedToken{tokIdent, expr[start:i]})
+		default:
+			matched := false
+			for _, op := range computedOperators {
+				if strings.HasPrefix(expr[i:], op) {
+					tokens = append(tokens, computedToken{tokOp, op})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected %q", string(c))
+			}
+		}
+	}
+	return tokens, nil
+}
+
+// computedParser is a recursive descent parser over the usual precedence
+// levels: comparison, ||, + -, * / %, unary minus.
+type computedParser struct {
+	table  CacheTable
+	tokens []computedToken
+	pos    int
+}
+
+func (p *computedParser) peekOp(ops ...string) (string, bool) {
+	if p.pos >= len(p.tokens) || p.tokens[p.pos].kind != tokOp {
+		return "", false
+	}
+	for _, op := range ops {
+		if p.tokens[p.pos].text == op {
+			p.pos++
+			return op, true
+		}
+	}
+	return "", false
+}
+
+func (p *computedParser) comparison(depth int) (string, error) {
+	left, err := p.binary(depth, 0)
+	if err != nil {
+		return "", err
+	}
+	if op, ok := p.peekOp("=", "!=", "<>", "<", "<=", ">", ">="); ok {
+		right, err := p.binary(depth, 0)
+		if err != nil {
+			return "", err
+		}
+		return left + " " + op + " " + right, nil
+	}
+	return left, nil
+}
+
+var computedPrecedence = [][]string{{"||"}, {"+", "-"}, {"*", "/", "%"}}
+
+func (p *computedParser) binary(depth, level int) (string, error) {
+	if level == len(computedPrecedence) {
+		return p.unary(depth)
+	}
+	left, err := p.binary(depth, level+1)
+	if err != nil {
+		return "", err
+	}
+	for {
+		op, ok := p.peekOp(computedPrecedence[level]...)
+		if !ok {
+			return left, nil
+		}
+		right, err := p.binary(depth, level+1)
+		if err != nil {
+			return "", err
+		}
+		left = left + " " + op + " " + right
+	}
+}
+
+func (p *computedParser) unary(depth int) (string, error) {
+	if _, ok := p.peekOp("-"); ok {
+		operand, err := p.unary(depth)
+		if err != nil {
+			return "", err
+		}
+		return "- " + operand, nil
+	}
+	return p.primary(depth)
+}
+
+func (p *computedParser) primary(depth int) (string, error) {
+	if depth > maxComputedDepth {
+		return "", fmt.Errorf("expression is nested too deeply")
+	}
+	if p.pos >= len(p.tokens) {
+		return "", fmt.Errorf("expression ends unexpectedly")
+	}
+	tok := p.tokens[p.pos]
+	p.pos++
+	switch tok.kind {
+	case tokNumber:
+		return tok.text, nil
+	case tokString:
+		return "'" + strings.ReplaceAll(tok.text, "'", "''") + "'", nil
+	case tokLParen:
+		inner, err := p.comparison(depth + 1)
+		if err != nil {
+			return "", err
+		}
+		if err := p.expect(tokRParen); err != nil {
+			return "", err
+		}
+		return "(" + inner + ")", nil
+	case tokIdent:
+		if p.pos < len(p.tokens) && p.tokens[p.pos].kind == tokLParen {
+			p.pos++
+			return p.call(depth, strings.ToLower(tok.text))
+		}
+		if strings.EqualFold(tok.text, "null") {
+			return "NULL", nil
+		}
+		if _, err := p.table.SearchCols(tok.text); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("[%s].[%s]", p.table.Name, tok.text), nil
+	}
+	return "", fmt.Errorf("unexpected %q", tok.text)
+}
+
+func (p *computedParser) call(depth int, name string) (string, error) {
+	if !computedFunctions[name] {
+		return "", fmt.Errorf("function %s is not allowed", name)
+	}
+	var args []string
+	if p.pos < len(p.tokens) && p.tokens[p.pos].kind == tokRParen {
+		p.pos++
+		return name + "()", nil
+	}
+	for {
+		arg, err := p.comparison(depth + 1)
+		if err != nil {
+			return "", err
+		}
+		args = append(args, arg)
+		if p.pos < len(p.tokens) && p.tokens[p.pos].kind == tokComma {
+			p.pos++
+			continue
+		}
+		if err := p.expect(tokRParen); err != nil {
+			return "", err
+		}
+		return name + "(" + strings.Join(args, ", ") + ")", nil
+	}
+}
+
+func (p *computedParser) expect(kind computedTokenKind) error {
+	if p.pos >= len(p.tokens) {
+		return fmt.Errorf("expression ends unexpectedly")
+	}
+	if p.tokens[p.pos].kind != kind {
+		return fmt.Errorf("unexpected %q", p.tokens[p.pos].text)
+	}
+	p.pos++
+	return nil
+}
@@ -0,0 +1,90 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestCompileComputedExpr(t *testing.T) {
+	table := CacheTable{Name: "orders", Columns: map[string]string{"price": "REAL", "quantity": "INTEGER", "name": "TEXT"}}
+
+	tests := []struct {
+		expr, want string
+		wantErr    bool
+	}{
+		{"price*quantity", "[orders].[price] * [orders].[quantity]", false},
+		{"(price + 1.5) * -quantity", "([orders].[price] + 1.5) * - [orders].[quantity]", false},
+		{"upper(name) || ' x'", "upper([orders].[name]) || ' x'", false},
+		{"coalesce(name, 'it''s')", "coalesce([orders].[name], 'it''s')", false},
+		{"quantity >= 10", "[orders].[quantity] >= 10", false},
+		{"--1", "- - 1", false},
+		{"missing * 2", "", true},
+		{"load_extension('x')", "", true},
+		{"max(price)", "", true},
+		{"price; DROP TABLE orders", "", true},
+		{"price /* */", "", true},
+		{"name) FROM orders --", "", true},
+		{"'unterminated", "", true},
+		{"price price", "", true},
+		{"", "", true},
+	}
+	for _, tt := range tests {
+		got, err := compileComputedExpr(table, tt.expr)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %q", tt.expr, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%q: got %q, %v; want %q", tt.expr, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseComputedParam(t *testing.T) {
+	got, err := parseComputedParam("total:price*quantity, label:coalesce(name,'none')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["total"] != "price*quantity" || got["label"] != "coalesce(name,'none')" {
+		t.Errorf("got %v", got)
+	}
+	if _, err := parseComputedParam("price*quantity"); err == nil {
+		t.Error("expected an error for a field without a name")
+	}
+}
+
+func TestSelectJSON_Computed(t *testing.T) {
+	db := setupTestDB(t, schemaUsers)
+	if _, err := db.Exec(`INSERT INTO users (name, email, age) VALUES ('Alice', 'alice@example.com', 30)`); err != nil {
+		t.Fatal(err)
+	}
+	dao := &TenantConnection{Client: db, Schema: loadSchema(t, db)}
+	ctx := context.Background()
+
+	result, err := dao.SelectJSON(ctx, "users", SelectQuery{
+		Select:   []any{"name"},
+		Computed: map[string]string{"months": "age * 12", "label": "upper(name) || ' <' || email || '>'"},
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rows []map[string]any
+	if err := json.Unmarshal(result.Data, &rows); err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0]["months"] != float64(360) || rows[0]["label"] != "ALICE <alice@example.com>" {
+		t.Errorf("got %v", rows)
+	}
+
+	for name, computed := range map[string]map[string]string{
+		"column name": {"age": "age + 1"},
+		"bad expr":    {"x": "age +"},
+	} {
+		if _, err := dao.SelectJSON(ctx, "users", SelectQuery{Computed: computed}, false); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/atombasedev/atombase/tools"
+)
+
+// conflictRule returns a table's settings.conflicts entry.
+func (schema SchemaCache) conflictRule(table string) (ConflictRule, bool) {
+	if schema.Settings == nil {
+		return ConflictRule{}, false
+	}
+	rule, ok := schema.Settings.Conflicts[table]
+	return rule, ok
+}
+
+// conflictStrategy is how a sync push to a table settles conflicts: the
+// table's rule, or else the push's own policy.
+func (schema SchemaCache) conflictStrategy(table, pushed string) string {
+	if rule, ok := schema.conflictRule(table); ok {
+		return rule.Strategy
+	}
+	if pushed == SyncCustom {
+		return SyncCustom
+	}
+	return ConflictClientWins
+}
+
+// withConflictRule keeps existing rows on upserts to a table whose conflicts
+// are settled serverWins.
+func (dao *TenantConnection) withConflictRule(relation string, req UpsertRequest) UpsertRequest {
+	if rule, ok := dao.Schema.conflictRule(relation); ok && rule.Strategy == ConflictServerWins {
+		req.IgnoreDuplicates = true
+	}
+	return req
+}
+
+// applySyncChange writes one pushed change.
+func (dao *TenantConnection) applySyncChange(ctx context.Context, tx Executor, table CacheTable, op string, row map[string]any, pk any) error {
+	var err error
+	if op == "upsert" {
+		_, err = dao.upsertJSON(ctx, tx, table.Name, UpsertRequest{Data: RowData{row}})
+	} else {
+		_, err = dao.deleteJSON(ctx, tx, table.Name, DeleteRequest{Where: []map[string]any{{table.Pk[0]: map[string]any{"eq": pk}}}})
+	}
+	if err != nil {
+		return dao.describeConstraint(ctx, tx, err, table.Name, op)
+	}
+	return nil
+}
+
+// resolveConflict settles a pushed change to a row changed on the server by
+// conflict.Resolution and reports whether it wrote anything.
+func (dao *TenantConnection) resolveConflict(ctx context.Context, tx Executor, table CacheTable, change SyncPushChange, pk any, conflict *SyncConflict) (bool, error) {
+	switch conflict.Resolution {
+	case ConflictClientWins:
+		return true, dao.applySyncChange(ctx, tx, table, change.Op, change.Row, pk)
+
+	case ConflictMerge:
+		// A delete loses to the server's edits, and an upsert of a row the
+		// server deleted brings it back whole.
+		if change.Op == "delete" {
+			return false, nil
+		}
+		if conflict.Op == "delete" {
+			return true, dao.applySyncChange(ctx, tx, table, change.Op, change.Row, pk)
+		}
+		merged := map[string]any{table.Pk[0]: pk}
+		for col, value := range change.Row {
+			if base, ok := change.Base[col]; !ok || !reflect.DeepEqual(base, value) {
+				merged[col] = value
+			}
+		}
+		if len(merged) == 1 {
+			return false, nil
+		}
+		return true, dao.applySyncChange(ctx, tx, table, "upsert", merged, pk)
+
+	case ConflictRPC:
+		rule, _ := dao.Schema.conflictRule(table.Name)
+		row, ok, err := dao.callConflictResolver(ctx, tx, rule.Function, table, change, pk)
+		if err != nil || !ok {
+			return false, err
+		}
+		row[table.Pk[0]] = pk
+		return true, dao.applySyncChange(ctx, tx, table, "upsert", row, pk)
+	}
+	// serverWins, and custom, which leaves the conflict to the client.
+	return false, nil
+}
+
+// callConflictResolver runs an rpc strategy's function with the server's row
+// and the client's as JSON text, null when deleted, and the row's primary
+// key, each when the function declares it. Its first result row is the row to
+// write; without one the server's row stays.
+func (dao *TenantConnection) callConflictResolver(ctx context.Context, tx Executor, name string, table CacheTable, change SyncPushChange, pk any) (map[string]any, bool, error) {
+	fn, ok := dao.Schema.Settings.Functions[name]
+	if !ok {
+		return nil, false, fmt.Errorf("%w: %s", tools.ErrFunctionNotFound, name)
+	}
+	current, err := dao.syncRows(ctx, tx, table, []any{pk})
+	if err != nil {
+		return nil, false, err
+	}
+	values := map[string]any{"pk": pk}
+	if row, ok := current[syncKey(pk)]; ok {
+		values["server"] = string(row)
+	}
+	if change.Op == "upsert" {
+		client, err := json.Marshal(change.Row)
+		if err != nil {
+			return nil, false, err
+		}
+		values["client"] = string(client)
+	}
+	args := map[string]any{}
+	for param := range fn.Params {
+		args[param] = values[param]
+	}
+	stmt, bound, err := dao.bindFunction(name, fn, args)
+	if err != nil {
+		return nil, false, err
+	}
+	rows, err := tx.QueryContext(ctx, stmt, bound...)
+	if err != nil {
+		return nil, false, fmt.Errorf("conflict resolver %s: %w", name, err)
+	}
+	results, err := tools.ScanRows(rows)
+	rows.Close()
+	if err != nil {
+		return nil, false, fmt.Errorf("conflict resolver %s: %w", name, err)
+	}
+	if len(results) == 0 {
+		return nil, false, nil
+	}
+	return results[0], true, nil
+}
@@ -0,0 +1,101 @@
+package data
+
+import (
+	"context"
+	"testing"
+)
+
+func TestPushChanges_ConflictRules(t *testing.T) {
+	ctx := context.Background()
+	setup := func(t *testing.T, rule ConflictRule, functions map[string]Function) (*TenantConnection, int64) {
+		t.Helper()
+		db := setupTestDB(t, schemaSyncNotes+`ALTER TABLE notes ADD COLUMN body TEXT;`)
+		t.Cleanup(func() { db.Close() })
+		if _, err := db.Exec(`INSERT INTO notes (id, title, body) VALUES (1, 'title', 'body')`); err != nil {
+			t.Fatal(err)
+		}
+		schema := loadSchema(t, db)
+		schema.SyncTables = map[string]bool{"notes": true}
+		schema.Settings = &APISettings{Conflicts: map[string]ConflictRule{"notes": rule}, Functions: functions}
+		dao := &TenantConnection{Client: db, Schema: schema}
+		page, err := dao.PullChanges(ctx, "notes", 0, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Another client changes the title after this one pulled.
+		if _, err := db.Exec(`UPDATE notes SET title = 'server title' WHERE id = 1`); err != nil {
+			t.Fatal(err)
+		}
+		return dao, page.Cursor
+	}
+	row := func(t *testing.T, dao *TenantConnection) string {
+		t.Helper()
+		var title, body string
+		if err := dao.Client.QueryRow(`SELECT title, body FROM notes WHERE id = 1`).Scan(&title, &body); err != nil {
+			t.Fatal(err)
+		}
+		return title + "/" + body
+	}
+	edit := func(base int64) SyncPushChange {
+		return SyncPushChange{
+			Op:      "upsert",
+			Row:     map[string]any{"id": 1, "title": "title", "body": "client body"},
+			Base:    map[string]any{"id": 1, "title": "title", "body": "body"},
+			BaseSeq: base,
+		}
+	}
+
+	tests := []struct {
+		name      string
+		rule      ConflictRule
+		functions map[string]Function
+		applied   int
+		want      string
+	}{
+		{"server wins", ConflictRule{Strategy: ConflictServerWins}, nil, 0, "server title/body"},
+		{"client wins", ConflictRule{Strategy: ConflictClientWins}, nil, 1, "title/client body"},
+		{"merge", ConflictRule{Strategy: ConflictMerge}, nil, 1, "server title/client body"},
+		{"rpc", ConflictRule{Strategy: ConflictRPC, Function: "resolve"}, map[string]Function{"resolve": {
+			SQL:    "SELECT json_extract(:server, '$.title') || ' + ' || json_extract(:client, '$.title') AS title",
+			Params: map[string]FunctionParam{"server": {Type: "text"}, "client": {Type: "text"}},
+		}}, 1, "server title + title/body"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dao, base := setup(t, tt.rule, tt.functions)
+			// The table's rule applies whatever the push asks for.
+			result, err := dao.PushChanges(ctx, "notes", SyncPushRequest{Conflict: SyncCustom, Changes: []SyncPushChange{edit(base)}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Applied != tt.applied || len(result.Conflicts) != 1 || result.Conflicts[0].Resolution != tt.rule.Strategy {
+				t.Fatalf("unexpected result %+v", result)
+			}
+			if got := row(t, dao); got != tt.want {
+				t.Fatalf("row is %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpsertJSON_ServerWins(t *testing.T) {
+	db := setupTestDB(t, schemaSyncNotes)
+	defer db.Close()
+	if _, err := db.Exec(`INSERT INTO notes (id, title) VALUES (1, 'server')`); err != nil {
+		t.Fatal(err)
+	}
+	schema := loadSchema(t, db)
+	schema.Settings = &APISettings{Conflicts: map[string]ConflictRule{"notes": {Strategy: ConflictServerWins}}}
+	dao := &TenantConnection{Client: db, Schema: schema}
+
+	if _, err := dao.UpsertJSON(context.Background(), "notes", UpsertRequest{Data: RowData{{"id": 1, "title": "client"}, {"id": 2, "title": "new"}}}); err != nil {
+		t.Fatal(err)
+	}
+	var titles string
+	if err := db.QueryRow(`SELECT group_concat(title, ',') FROM (SELECT title FROM notes ORDER BY id)`).Scan(&titles); err != nil {
+		t.Fatal(err)
+	}
+	if titles != "server,new" {
+		t.Fatalf("expected the existing row to stay, got %s", titles)
+	}
+}
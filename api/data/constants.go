@@ -10,12 +10,78 @@ const (
 
 // Query parameter keys used in URL query strings.
 const (
-	ParamSelect = "select"
-	ParamOrder  = "order"
-	ParamOr     = "or"
-	ParamLimit  = "limit"
-	ParamOffset = "offset"
-	ParamCount  = "count"
+	ParamSelect   = "select"
+	ParamOrder    = "order"
+	ParamOr       = "or"
+	ParamLimit    = "limit"
+	ParamOffset   = "offset"
+	ParamCount    = "count"
+	ParamCursor   = "cursor"
+	ParamFormat   = "format"
+	ParamNested   = "nested"
+	ParamComputed = "computed"
+	ParamLang     = "lang"
+	ParamPage     = "page"
+	ParamPerPage  = "per_page"
+
+	ParamResolution    = "resolution"      // Rollup of a time-series table to select from
+	ParamAllowFullScan = "allow_full_scan" // Lets a filter scan a large table in full under the full scan guard
+
+	ParamFTS          = "fts"           // Table-wide full-text search
+	ParamFTSRank      = "fts.rank"      // Field for the search rank
+	ParamFTSSnippet   = "fts.snippet"   // Snippet fields: name:column,...
+	ParamFTSHighlight = "fts.highlight" // Highlight fields: name:column,...
+	ParamGeo          = "geo"           // Table-wide geospatial filter
+)
+
+// Values of ?nested= for CSV selects.
+const (
+	NestedFlatten = "flatten" // Nested relations become relation.column cells
+	NestedOmit    = "omit"    // Nested relations are left out
+)
+
+// Who may call a definition's function.
+const (
+	FunctionAccessService = "service" // The service key (default)
+	FunctionAccessUser    = "user"    // Any signed-in user
+	FunctionAccessPublic  = "public"  // Anyone, including anonymous callers
+)
+
+// How a table's settings.conflicts entry settles a conflicting write.
+const (
+	ConflictServerWins = "serverWins" // Keep the server's row
+	ConflictClientWins = "clientWins" // Write the client's change over it
+	ConflictMerge      = "merge"      // Write the columns the client changed, keep the server's others
+	ConflictRPC        = "rpc"        // Write the row a function returns, or keep the server's without one
+)
+
+// Export formats.
+const (
+	ExportCSV    = "csv"
+	ExportNDJSON = "ndjson"
+	ExportSQLite = "sqlite"
+)
+
+// Export job states.
+const (
+	ExportRunning = "running"
+	ExportDone    = "done"
+	ExportFailed  = "failed"
+)
+
+// Change event kinds sent to table event streams.
+const (
+	ChangeInsert = "insert"
+	ChangeUpsert = "upsert"
+	ChangeUpdate = "update"
+	ChangeDelete = "delete"
+)
+
+// Values of Prefer: count=.
+const (
+	CountExact   = "exact"
+	CountPlanned = "planned"
+	CountNone    = "none"
 )
 
 // Filter operators for WHERE clause conditions.
@@ -27,12 +93,15 @@ const (
 	OpGt      = "gt"
 	OpGte     = "gte"
 	OpLike    = "like"
+	OpIlike   = "ilike"
 	OpGlob    = "glob"
 	OpBetween = "between"
 	OpNot     = "not"
 	OpIn      = "in"
 	OpIs      = "is"
 	OpFts     = "fts"
+	OpNear    = "near" // Within a radius in meters of a point
+	OpBBox    = "bbox" // Inside a latitude/longitude box
 	OpAnd     = "and"
 	OpOr      = "or"
 )
@@ -61,6 +130,12 @@ const (
 	FTSSuffix = "_fts" // Suffix for FTS5 virtual table names
 )
 
+// Geospatial filter constants.
+const (
+	GeoSuffix = "_geo" // Suffix for R*Tree index names
+	geoFilter = "__geo"
+)
+
 // Foreign key referential actions.
 const (
 	FkNoAction   = "NO ACTION"
@@ -87,6 +162,9 @@ const (
 	MaxInArraySize     = 100 // Max elements in IN/NOT IN arrays
 	MaxSelectColumns   = 50  // Max columns in SELECT (SQLite json_object limit: 100 args / 2)
 	MaxBatchOperations = 100 // Max operations in a batch request
+	MaxFilterDepth     = 8   // Max nesting of or/and filter groups
+	MaxDedupeRules     = 8   // Max match rules in a dedupe request
+	MaxRunningExports  = 4   // Max exports running at once per server
 )
 
 // InternalTablePrefix is the prefix for internal atomicbase tables.
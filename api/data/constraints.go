@@ -0,0 +1,97 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/atombasedev/atombase/tools"
+)
+
+// describeConstraint fills in what SQLite's message leaves out of a
+// constraint failure from the schema: the table a write targeted, the unique
+// index that rejected it, and the foreign keys involved. Other errors are
+// returned unchanged.
+func (dao *TenantConnection) describeConstraint(ctx context.Context, exec Executor, err error, table, operation string) error {
+	c := tools.ParseConstraintError(err)
+	if c == nil {
+		return err
+	}
+	if c.Table == "" {
+		c.Table = table
+	}
+	switch c.Kind {
+	case tools.ConstraintUnique:
+		if c.Constraint == "" {
+			c.Constraint = dao.uniqueIndexName(ctx, exec, c.Table, c.Columns)
+		}
+	case tools.ConstraintForeignKey:
+		if c.Constraint != "" || c.Table == "" {
+			break
+		}
+		// A delete fails on the rows referencing it, anything else on the
+		// rows it references.
+		var refs []string
+		if operation == "delete" {
+			for _, fks := range dao.Schema.Fks {
+				for _, fk := range fks {
+					if fk.References == c.Table {
+						refs = append(refs, fmt.Sprintf("%s.%s references %s.%s", fk.Table, fk.From, fk.References, fk.To))
+					}
+				}
+			}
+		} else {
+			for _, fk := range dao.Schema.Fks[c.Table] {
+				c.Columns = append(c.Columns, fk.From)
+				refs = append(refs, fmt.Sprintf("%s references %s.%s", fk.From, fk.References, fk.To))
+			}
+		}
+		slices.Sort(refs)
+		c.Constraint = strings.Join(refs, ", ")
+	}
+	return c
+}
+
+// uniqueIndexName returns the name of the unique index on exactly columns,
+// "primary key" for the table's key, or "" when none is found.
+func (dao *TenantConnection) uniqueIndexName(ctx context.Context, exec Executor, table string, columns []string) string {
+	if table == "" || len(columns) == 0 {
+		return ""
+	}
+	// An INTEGER PRIMARY KEY is the rowid and has no index.
+	if tbl, ok := dao.Schema.Tables[table]; ok && slices.Equal(tbl.Pk, columns) {
+		return "primary key"
+	}
+	rows, err := exec.QueryContext(ctx, "SELECT name FROM pragma_index_list(?) WHERE [unique] = 1", table)
+	if err != nil {
+		return ""
+	}
+	var indexes []string
+	for rows.Next() {
+		var name string
+		if rows.Scan(&name) == nil {
+			indexes = append(indexes, name)
+		}
+	}
+	rows.Close()
+
+	for _, index := range indexes {
+		var indexed []string
+		cols, err := exec.QueryContext(ctx, "SELECT name FROM pragma_index_info(?) ORDER BY seqno", index)
+		if err != nil {
+			return ""
+		}
+		for cols.Next() {
+			var name string
+			if cols.Scan(&name) == nil {
+				indexed = append(indexed, name)
+			}
+		}
+		cols.Close()
+		if slices.Equal(indexed, columns) {
+			return index
+		}
+	}
+	return ""
+}
@@ -0,0 +1,59 @@
+package data
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/atombasedev/atombase/tools"
+)
+
+func TestDescribeConstraint(t *testing.T) {
+	db := setupTestDB(t, `
+		PRAGMA foreign_keys = ON;
+		CREATE TABLE users (id INTEGER PRIMARY KEY, email TEXT NOT NULL, age INTEGER CONSTRAINT adult CHECK (age >= 18));
+		CREATE UNIQUE INDEX idx_users_email ON users(email);
+		CREATE TABLE posts (id INTEGER PRIMARY KEY, author_id INTEGER REFERENCES users(id));
+		INSERT INTO users (id, email, age) VALUES (1, 'a@example.com', 30);
+		INSERT INTO posts (id, author_id) VALUES (1, 1);`)
+	db.SetMaxOpenConns(1)
+	dao := &TenantConnection{Client: db, Schema: loadSchema(t, db)}
+	ctx := context.Background()
+
+	describe := func(query, table, operation string) *tools.ConstraintError {
+		t.Helper()
+		_, err := db.Exec(query)
+		if err == nil {
+			t.Fatalf("%s: expected a constraint failure", query)
+		}
+		c := tools.ParseConstraintError(dao.describeConstraint(ctx, db, err, table, operation))
+		if c == nil {
+			t.Fatalf("%s: not a constraint error: %v", query, err)
+		}
+		c.Err = nil
+		return c
+	}
+
+	tests := []struct {
+		query, table, operation string
+		want                    tools.ConstraintError
+	}{
+		{"INSERT INTO users (email) VALUES ('a@example.com')", "users", "insert",
+			tools.ConstraintError{Kind: tools.ConstraintUnique, Table: "users", Columns: []string{"email"}, Constraint: "idx_users_email"}},
+		{"INSERT INTO users (id, email) VALUES (1, 'b@example.com')", "users", "insert",
+			tools.ConstraintError{Kind: tools.ConstraintUnique, Table: "users", Columns: []string{"id"}, Constraint: "primary key"}},
+		{"INSERT INTO users (email) VALUES (NULL)", "users", "insert",
+			tools.ConstraintError{Kind: tools.ConstraintNotNull, Table: "users", Columns: []string{"email"}}},
+		{"INSERT INTO users (email, age) VALUES ('c@example.com', 12)", "users", "insert",
+			tools.ConstraintError{Kind: tools.ConstraintCheck, Table: "users", Constraint: "adult"}},
+		{"INSERT INTO posts (author_id) VALUES (99)", "posts", "insert",
+			tools.ConstraintError{Kind: tools.ConstraintForeignKey, Table: "posts", Columns: []string{"author_id"}, Constraint: "author_id references users.id"}},
+		{"DELETE FROM users WHERE id = 1", "users", "delete",
+			tools.ConstraintError{Kind: tools.ConstraintForeignKey, Table: "users", Constraint: "posts.author_id references users.id"}},
+	}
+	for _, tt := range tests {
+		if got := describe(tt.query, tt.table, tt.operation); !reflect.DeepEqual(*got, tt.want) {
+			t.Errorf("%s:\ngot  %+v\nwant %+v", tt.query, *got, tt.want)
+		}
+	}
+}
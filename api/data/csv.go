@@ -0,0 +1,220 @@
+package data
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/atombasedev/atombase/tools"
+)
+
+// wantsCSV reports whether a select should be answered as CSV, asked for with
+// Accept: text/csv or ?format=csv.
+func wantsCSV(req *http.Request) bool {
+	return strings.EqualFold(req.URL.Query().Get(ParamFormat), "csv") || acceptsMediaType(req, "text/csv")
+}
+
+// csvNested returns the ?nested= mode, flatten unless omit is asked for.
+func csvNested(req *http.Request) (string, error) {
+	switch nested := req.URL.Query().Get(ParamNested); nested {
+	case "", NestedFlatten:
+		return NestedFlatten, nil
+	case NestedOmit:
+		return NestedOmit, nil
+	default:
+		return "", tools.InvalidRequestErr(fmt.Sprintf("nested must be %s or %s, got %q", NestedFlatten, NestedOmit, nested))
+	}
+}
+
+// csvField is one key and value of a row, kept in select order.
+type csvField struct {
+	key   string
+	value any
+}
+
+// writeCSV writes select rows as CSV with a header row. Columns keep the order
+// of the select list; a column missing from a row is left empty.
+//
+// With NestedFlatten, a nested relation holding at most one row, like a
+// foreign key's parent, spreads into relation.column cells, and one holding
+// several rows is written as JSON text in a single relation cell.
+func writeCSV(w io.Writer, data []byte, nested string) error {
+	rows, err := decodeCSVRows(data)
+	if err != nil {
+		return err
+	}
+
+	var header []string
+	index := map[string]int{}
+	flat := make([][]csvField, len(rows))
+	for i, row := range rows {
+		flat[i] = flattenCSVRow(nil, "", row, nested)
+		for _, field := range flat[i] {
+			if _, ok := index[field.key]; !ok {
+				index[field.key] = len(header)
+				header = append(header, field.key)
+			}
+		}
+	}
+
+	out := csv.NewWriter(w)
+	if err := out.Write(header); err != nil {
+		return err
+	}
+	record := make([]string, len(header))
+	for _, row := range flat {
+		clear(record)
+		for _, field := range row {
+			record[index[field.key]] = csvCell(field.value)
+		}
+		if err := out.Write(record); err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
+
+func flattenCSVRow(fields []csvField, prefix string, row []csvField, nested string) []csvField {
+	for _, field := range row {
+		key := prefix + field.key
+		switch value := field.value.(type) {
+		case []csvField:
+			if nested == NestedOmit {
+				continue
+			}
+			fields = flattenCSVRow(fields, key+".", value, nested)
+		case []any:
+			if nested == NestedOmit {
+				continue
+			}
+			if len(value) == 1 {
+				if object, ok := value[0].([]csvField); ok {
+					fields = flattenCSVRow(fields, key+".", object, nested)
+					continue
+				}
+			}
+			if len(value) == 0 {
+				continue
+			}
+			fields = append(fields, csvField{key: key, value: value})
+		default:
+			fields = append(fields, csvField{key: key, value: value})
+		}
+	}
+	return fields
+}
+
+func csvCell(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		if v {
+			return "true"
+		}
+		return "false"
+	default:
+		raw, _ := json.Marshal(csvJSON(v))
+		return string(raw)
+	}
+}
+
+// csvJSON turns decoded rows back into plain JSON values for nested cells.
+func csvJSON(value any) any {
+	switch v := value.(type) {
+	case []csvField:
+		object := make(map[string]any, len(v))
+		for _, field := range v {
+			object[field.key] = csvJSON(field.value)
+		}
+		return object
+	case []any:
+		items := make([]any, len(v))
+		for i, item := range v {
+			items[i] = csvJSON(item)
+		}
+		return items
+	default:
+		return v
+	}
+}
+
+// decodeCSVRows decodes a JSON array of objects, keeping each object's keys in
+// document order, which a map would lose.
+func decodeCSVRows(data []byte) ([][]csvField, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	value, err := decodeOrderedJSON(dec)
+	if err != nil {
+		return nil, err
+	}
+	items, ok := value.([]any)
+	if !ok {
+		return nil, fmt.Errorf("expected an array of rows")
+	}
+	rows := make([][]csvField, 0, len(items))
+	for _, item := range items {
+		row, ok := item.([]csvField)
+		if !ok {
+			return nil, fmt.Errorf("expected rows to be objects")
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func decodeOrderedJSON(dec *json.Decoder) (any, error) {
+	token, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	delim, ok := token.(json.Delim)
+	if !ok {
+		return token, nil
+	}
+	switch delim {
+	case '{':
+		var fields []csvField
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeOrderedJSON(dec)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, csvField{key: key.(string), value: value})
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		if fields == nil {
+			fields = []csvField{}
+		}
+		return fields, nil
+	case '[':
+		items := []any{}
+		for dec.More() {
+			item, err := decodeOrderedJSON(dec)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("unexpected JSON delimiter %q", delim)
+}
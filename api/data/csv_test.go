@@ -0,0 +1,79 @@
+package data
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWriteCSV(t *testing.T) {
+	rows := `[
+		{"id": 1, "name": "Alice, A.", "active": true, "owner": [{"name": "Org", "plan": null}], "posts": [{"title": "a"}, {"title": "b"}]},
+		{"id": 2, "name": "Bob", "active": false, "owner": [], "posts": []}
+	]`
+
+	tests := []struct {
+		nested, want string
+	}{
+		{NestedFlatten, "id,name,active,owner.name,owner.plan,posts\n" +
+			"1,\"Alice, A.\",true,Org,,\"[{\"\"title\"\":\"\"a\"\"},{\"\"title\"\":\"\"b\"\"}]\"\n" +
+			"2,Bob,false,,,\n"},
+		{NestedOmit, "id,name,active\n1,\"Alice, A.\",true\n2,Bob,false\n"},
+	}
+	for _, tt := range tests {
+		var out strings.Builder
+		if err := writeCSV(&out, []byte(rows), tt.nested); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != tt.want {
+			t.Errorf("%s:\n%s\nwant:\n%s", tt.nested, out.String(), tt.want)
+		}
+	}
+}
+
+func TestWriteCSV_SelectOrder(t *testing.T) {
+	db := setupTestDB(t, schemaUsers)
+	if _, err := db.Exec(`INSERT INTO users (name, email, age) VALUES ('Alice', 'alice@example.com', 30)`); err != nil {
+		t.Fatal(err)
+	}
+	dao := &TenantConnection{Client: db, Schema: loadSchema(t, db)}
+
+	result, err := dao.SelectJSON(context.Background(), "users", SelectQuery{Select: []any{"name", "age", "id"}}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	if err := writeCSV(&out, result.Data, NestedFlatten); err != nil {
+		t.Fatal(err)
+	}
+	if want := "name,age,id\nAlice,30,1\n"; out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+}
+
+func TestWantsCSV(t *testing.T) {
+	tests := []struct {
+		target, accept string
+		want           bool
+	}{
+		{"/data/query/users", "", false},
+		{"/data/query/users", "application/json", false},
+		{"/data/query/users", "application/json;q=0.5, text/csv", true},
+		{"/data/query/users?format=csv", "", true},
+		{"/data/query/users?format=json", "", false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", tt.target, nil)
+		if tt.accept != "" {
+			req.Header.Set("Accept", tt.accept)
+		}
+		if got := wantsCSV(req); got != tt.want {
+			t.Errorf("%s Accept %q: got %v, want %v", tt.target, tt.accept, got, tt.want)
+		}
+	}
+
+	if _, err := csvNested(httptest.NewRequest("POST", "/data/query/users?nested=json", nil)); err == nil {
+		t.Error("expected an error for an unknown nested mode")
+	}
+}
@@ -0,0 +1,161 @@
+package data
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/atombasedev/atombase/tools"
+)
+
+// cursorColumnPrefix names the key columns a cursor select adds to its inner
+// query so the last row's position can be read back.
+const cursorColumnPrefix = "__ab_cursor_"
+
+// selectCursor is the decoded form of the opaque token handed to clients. It
+// carries the keys it was issued for so a cursor reused with another order is
+// rejected instead of silently skipping rows.
+type selectCursor struct {
+	Keys   []string `json:"k"`
+	Desc   bool     `json:"d,omitempty"`
+	Values []any    `json:"v"`
+}
+
+// cursorKeys returns the columns a cursor pages over, the order column if any
+// followed by the primary key (or rowid) as a tiebreaker, and whether they run
+// descending. All keys share one direction so a single row-value comparison
+// finds the next page.
+func cursorKeys(table CacheTable, order map[string]string) ([]string, bool, error) {
+	if len(order) > 1 {
+		return nil, false, fmt.Errorf("%w: cursor pagination orders by at most one column", tools.ErrInvalidCursor)
+	}
+	var keys []string
+	desc := false
+	for col, dir := range order {
+		if _, err := table.SearchCols(col); err != nil {
+			return nil, false, err
+		}
+		switch strings.ToLower(dir) {
+		case OrderAsc:
+		case OrderDesc:
+			desc = true
+		default:
+			return nil, false, fmt.Errorf("invalid order direction: %s", dir)
+		}
+		keys = append(keys, col)
+	}
+	pk := table.Pk
+	if len(pk) == 0 {
+		pk = []string{"rowid"}
+	}
+	for _, col := range pk {
+		if !slices.Contains(keys, col) {
+			keys = append(keys, col)
+		}
+	}
+	return keys, desc, nil
+}
+
+// decodeCursor returns the key values a cursor points after, or nil for the
+// empty cursor that starts from the first row.
+func decodeCursor(token string, keys []string, desc bool) ([]any, error) {
+	if token == "" {
+		return nil, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, tools.ErrInvalidCursor
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var cursor selectCursor
+	if err := dec.Decode(&cursor); err != nil {
+		return nil, tools.ErrInvalidCursor
+	}
+	if !slices.Equal(cursor.Keys, keys) || cursor.Desc != desc || len(cursor.Values) != len(keys) {
+		return nil, fmt.Errorf("%w: it was issued for a different order", tools.ErrInvalidCursor)
+	}
+	for i, value := range cursor.Values {
+		n, ok := value.(json.Number)
+		if !ok {
+			continue
+		}
+		if i64, err := n.Int64(); err == nil {
+			cursor.Values[i] = i64
+		} else if f, err := n.Float64(); err == nil {
+			cursor.Values[i] = f
+		}
+	}
+	return cursor.Values, nil
+}
+
+func encodeCursor(keys []string, desc bool, values []any) string {
+	raw, _ := json.Marshal(selectCursor{Keys: keys, Desc: desc, Values: values})
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// cursorSelectColumns returns the aliased key columns to add to the inner select.
+func cursorSelectColumns(tableName string, keys []string) string {
+	cols := make([]string, len(keys))
+	for i, key := range keys {
+		cols[i] = fmt.Sprintf("[%s].[%s] AS [%s%d]", tableName, key, cursorColumnPrefix, i)
+	}
+	return strings.Join(cols, ", ")
+}
+
+// appendCursorWhere restricts where to the rows after the cursor position.
+func appendCursorWhere(where string, args []any, tableName string, keys []string, desc bool, after []any) (string, []any) {
+	cols := make([]string, len(keys))
+	marks := make([]string, len(keys))
+	for i, key := range keys {
+		cols[i] = fmt.Sprintf("[%s].[%s]", tableName, key)
+		marks[i] = "?"
+	}
+	op := ">"
+	if desc {
+		op = "<"
+	}
+	cond := fmt.Sprintf("(%s) %s (%s) ", strings.Join(cols, ", "), op, strings.Join(marks, ", "))
+	if where == "" {
+		return "WHERE " + cond, append(args, after...)
+	}
+	return where + "AND " + cond, append(args, after...)
+}
+
+func cursorOrder(tableName string, keys []string, desc bool) string {
+	dir := "ASC"
+	if desc {
+		dir = "DESC"
+	}
+	cols := make([]string, len(keys))
+	for i, key := range keys {
+		cols[i] = fmt.Sprintf("[%s].[%s] %s", tableName, key, dir)
+	}
+	return "ORDER BY " + strings.Join(cols, ", ") + " "
+}
+
+// cursorKeyArray aggregates each row's key columns in the outer query.
+func cursorKeyArray(keys []string) string {
+	cols := make([]string, len(keys))
+	for i := range keys {
+		cols[i] = fmt.Sprintf("[%s%d]", cursorColumnPrefix, i)
+	}
+	return "json_group_array(json_array(" + strings.Join(cols, ", ") + "))"
+}
+
+// lastCursorKeys returns the key values of the last row in an aggregated key array.
+func lastCursorKeys(raw []byte) ([]any, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var rows [][]any
+	if err := dec.Decode(&rows); err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	return rows[len(rows)-1], nil
+}
@@ -0,0 +1,97 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/atombasedev/atombase/tools"
+)
+
+func TestSelectJSON_CursorPagination(t *testing.T) {
+	db := setupTestDB(t, schemaUsers)
+	defer db.Close()
+	for i := 1; i <= 25; i++ {
+		// Ages repeat so the primary key has to break ties.
+		if _, err := db.Exec(`INSERT INTO users (id, name, age) VALUES (?, ?, ?)`, i, fmt.Sprintf("user%d", i), i%4); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dao := &TenantConnection{Client: db, Schema: loadSchema(t, db)}
+	ctx := context.Background()
+
+	limit := 10
+	cursor := ""
+	var seen []float64
+	pages := 0
+	for {
+		result, err := dao.SelectJSON(ctx, "users", SelectQuery{
+			Select: []any{"name"},
+			Where:  []map[string]any{{"id": map[string]any{"neq": 25}}},
+			Order:  map[string]string{"age": "desc"},
+			Limit:  &limit,
+			Cursor: &cursor,
+		}, true)
+		if err != nil {
+			t.Fatalf("page %d: %v", pages, err)
+		}
+		if result.Count != 24 {
+			t.Fatalf("expected the count to cover every matching row, got %d", result.Count)
+		}
+		var rows []map[string]any
+		if err := json.Unmarshal(result.Data, &rows); err != nil {
+			t.Fatal(err)
+		}
+		for _, row := range rows {
+			var id float64
+			fmt.Sscanf(row["name"].(string), "user%f", &id)
+			seen = append(seen, id)
+		}
+		pages++
+		if result.NextCursor == "" {
+			break
+		}
+		cursor = result.NextCursor
+	}
+
+	if pages != 3 || len(seen) != 24 {
+		t.Fatalf("expected 24 rows over 3 pages, got %d over %d", len(seen), pages)
+	}
+	for i := 1; i < len(seen); i++ {
+		prev, cur := int(seen[i-1]), int(seen[i])
+		if prev%4 < cur%4 || (prev%4 == cur%4 && prev <= cur) {
+			t.Fatalf("rows out of order or repeated at %d: %v", i, seen)
+		}
+	}
+}
+
+func TestSelectJSON_CursorRejectsMismatches(t *testing.T) {
+	db := setupTestDB(t, schemaUsers)
+	defer db.Close()
+	if _, err := db.Exec(`INSERT INTO users (id, name, age) VALUES (1, 'a', 1), (2, 'b', 2)`); err != nil {
+		t.Fatal(err)
+	}
+	dao := &TenantConnection{Client: db, Schema: loadSchema(t, db)}
+	ctx := context.Background()
+
+	limit, offset := 1, 1
+	start := ""
+	first, err := dao.SelectJSON(ctx, "users", SelectQuery{Order: map[string]string{"age": "asc"}, Limit: &limit, Cursor: &start}, false)
+	if err != nil || first.NextCursor == "" {
+		t.Fatalf("expected a next cursor, got %q (%v)", first.NextCursor, err)
+	}
+
+	garbage := "not-a-cursor"
+	for name, query := range map[string]SelectQuery{
+		"garbage":         {Limit: &limit, Cursor: &garbage},
+		"different order": {Order: map[string]string{"age": "desc"}, Limit: &limit, Cursor: &first.NextCursor},
+		"two orders":      {Order: map[string]string{"age": "asc", "name": "asc"}, Cursor: &start},
+		"offset":          {Limit: &limit, Offset: &offset, Cursor: &start},
+	} {
+		if _, err := dao.SelectJSON(ctx, "users", query, false); !errors.Is(err, tools.ErrInvalidCursor) {
+			t.Errorf("%s: expected ErrInvalidCursor, got %v", name, err)
+		}
+	}
+}
@@ -304,7 +304,7 @@ func TestBuildSelect_QueryDepthLimitAndRelationshipErrors(t *testing.T) {
 			},
 		}
 
-		_, _, _, err := schema.buildSelect(rel, nil)
+		_, _, _, _, err := schema.buildSelect(rel, nil)
 		if err == nil || !strings.Contains(err.Error(), "query nesting exceeds maximum depth") {
 			t.Fatalf("expected depth error, got %v", err)
 		}
@@ -320,7 +320,7 @@ func TestBuildSelect_QueryDepthLimitAndRelationshipErrors(t *testing.T) {
 			},
 		}
 
-		_, _, _, err := schema.buildSelect(rel, nil)
+		_, _, _, _, err := schema.buildSelect(rel, nil)
 		if err == nil || !strings.Contains(err.Error(), "no relationship exists between tables") {
 			t.Fatalf("expected relationship error, got %v", err)
 		}
@@ -7,7 +7,6 @@ import (
 	"errors"
 	"fmt"
 
-	"github.com/atombasedev/atombase/config"
 	"github.com/atombasedev/atombase/definitions"
 	"github.com/atombasedev/atombase/primarystore"
 	"github.com/atombasedev/atombase/tools"
@@ -27,17 +26,16 @@ func NewAPI(primaryStore *primarystore.Store) (*API, error) {
 	return &API{
 		store:       primaryStore,
 		definitions: definitions.NewService(primaryStore),
+		exports:     newExportRegistry(),
+		events:      newEventHub(),
+		presence:    newPresenceHub(),
+		broadcast:   newBroadcastHub(),
+		webhooks:    newWebhookCache(),
 	}, nil
 }
 
 // connTurso opens a connection to an external Turso database by resolved target.
 func (api *API) connTurso(principal definitions.Principal, target definitions.DatabaseTarget) (TenantConnection, error) {
-	org := config.Cfg.TursoOrganization
-
-	if org == "" {
-		return TenantConnection{}, errors.New("TURSO_ORGANIZATION environment variable is not set but is required to access external databases")
-	}
-
 	if api == nil || api.store == nil || api.store.DB() == nil {
 		return TenantConnection{}, errors.New("primary store not initialized")
 	}
@@ -52,19 +50,14 @@ func (api *API) connTurso(principal definitions.Principal, target definitions.Da
 		return TenantConnection{}, fmt.Errorf("failed to load schema: %w", err)
 	}
 
-	client, err := sql.Open("libsql", fmt.Sprintf("libsql://%s-%s.turso.io?authToken=%s", target.DatabaseID, org, target.AuthToken))
-	if err != nil {
-		return TenantConnection{}, err
-	}
-
-	err = client.Ping()
+	client, release, err := tools.AcquireTenantDB(target.DatabaseID, target.AuthToken)
 	if err != nil {
-		client.Close()
 		return TenantConnection{}, err
 	}
 
 	return TenantConnection{
 		Client:          client,
+		release:         release,
 		Schema:          schema,
 		Token:           target.AuthToken,
 		Name:            target.DatabaseID,
@@ -74,10 +67,49 @@ func (api *API) connTurso(principal definitions.Principal, target definitions.Da
 		SchemaVersion:   currentVersion,
 		DatabaseVersion: target.DefinitionVersion,
 		Principal:       principal,
+		RowTenant:       target.RowTenant,
+		WritesPaused:    target.WritesPaused,
 		primaryStore:    api.store,
+		events:          api.events,
+		webhooks:        api.webhooks,
 	}, nil
 }
 
+// Close hands the connection's database back to the pool, or closes it when
+// it is the connection's own.
+func (dao *TenantConnection) Close() {
+	if dao.release != nil {
+		dao.release()
+		return
+	}
+	dao.Client.Close()
+}
+
+// useQueryOnly reopens a read-only request's local tenant database with
+// PRAGMA query_only, so a statement that slips past the policy checks fails in
+// SQLite too. It runs after migrations, which have to write. Turso databases
+// are read from their local replica when one is fresh and at the database's
+// version, and otherwise keep their connection and rely on the checks.
+func (dao *TenantConnection) useQueryOnly() error {
+	if !dao.ReadOnly {
+		return nil
+	}
+	if !tools.LocalTenants() {
+		if replica, release, ok := tools.OpenTenantReplica(dao.ID, dao.Token, dao.DatabaseVersion); ok {
+			dao.Close()
+			dao.Client, dao.release = replica, release
+		}
+		return nil
+	}
+	client, err := tools.OpenLocalTenantDBReadOnly(dao.ID)
+	if err != nil {
+		return err
+	}
+	dao.Close()
+	dao.Client, dao.release = client, nil
+	return nil
+}
+
 // QueryMap executes a query and returns results as a slice of maps.
 func (dao *TenantConnection) QueryMap(ctx context.Context, query string, args ...any) ([]map[string]any, error) {
 	rows, err := dao.Client.QueryContext(ctx, query, args...)
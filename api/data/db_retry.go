@@ -5,6 +5,8 @@ import (
 	"database/sql"
 	"strings"
 	"time"
+
+	"github.com/atombasedev/atombase/tools"
 )
 
 var (
@@ -71,6 +73,9 @@ func ExecContextWithRetry(ctx context.Context, exec Executor, query string, args
 	var err error
 
 	retryErr := execWithRetry(ctx, func() error {
+		if err = tools.InjectFault(ctx, tools.FaultSQLiteExec); err != nil {
+			return err
+		}
 		result, err = exec.ExecContext(ctx, query, args...)
 		return err
 	})
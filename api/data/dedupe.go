@@ -0,0 +1,301 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/atombasedev/atombase/tools"
+)
+
+// Dedupe match kinds.
+const (
+	MatchExact   = "exact"
+	MatchNocase  = "nocase"
+	MatchSimilar = "similar"
+)
+
+const defaultSimilarity = 0.6
+
+// FindDuplicates scans a table's rows through the select path, so policies
+// and filters apply, and groups rows that every rule matches. Exact and
+// nocase rules split rows into blocks by value; similar rules then compare
+// the rows of a block pairwise by trigram similarity.
+func (dao *TenantConnection) FindDuplicates(ctx context.Context, relation string, req DedupeRequest) (DedupeResponse, error) {
+	table, err := dao.Schema.SearchTbls(relation)
+	if err != nil {
+		return DedupeResponse{}, err
+	}
+	if len(table.Pk) != 1 {
+		return DedupeResponse{}, tools.InvalidRequestErr("dedupe needs a table with a single-column primary key")
+	}
+	pk := table.Pk[0]
+	if len(req.Rules) == 0 || len(req.Rules) > MaxDedupeRules {
+		return DedupeResponse{}, tools.InvalidRequestErr(fmt.Sprintf("dedupe needs 1 to %d rules", MaxDedupeRules))
+	}
+	selectCols := []any{pk}
+	for i, rule := range req.Rules {
+		if _, err := table.SearchCols(rule.Column); err != nil {
+			return DedupeResponse{}, err
+		}
+		switch rule.Match {
+		case MatchExact, MatchNocase:
+		case MatchSimilar:
+			if rule.Threshold < 0 || rule.Threshold > 1 {
+				return DedupeResponse{}, tools.InvalidRequestErr("similar threshold must be between 0 and 1")
+			}
+			if rule.Threshold == 0 {
+				req.Rules[i].Threshold = defaultSimilarity
+			}
+		default:
+			return DedupeResponse{}, tools.InvalidRequestErr(fmt.Sprintf("unknown match %q, use exact, nocase or similar", rule.Match))
+		}
+		if rule.Column != pk {
+			selectCols = append(selectCols, rule.Column)
+		}
+	}
+
+	limit := dao.Schema.selectLimit(req.Limit)
+	result, err := dao.SelectJSON(ctx, relation, SelectQuery{
+		Select: selectCols,
+		Where:  req.Where,
+		Order:  map[string]string{pk: OrderAsc},
+		Limit:  &limit,
+	}, false)
+	if err != nil {
+		return DedupeResponse{}, err
+	}
+	var rows []map[string]any
+	if err := decodeJSONPayload(result.Data, &rows); err != nil {
+		return DedupeResponse{}, err
+	}
+
+	clusters := clusterDuplicates(rows, req.Rules)
+	return DedupeResponse{
+		Clusters:  clusters,
+		Scanned:   len(rows),
+		Truncated: limit > 0 && len(rows) == limit,
+	}, nil
+}
+
+// clusterDuplicates returns the groups of two or more rows that match on
+// every rule, linking rows transitively.
+func clusterDuplicates(rows []map[string]any, rules []DedupeRule) [][]map[string]any {
+	parent := make([]int, len(rows))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	// Block on the exact and nocase rules; rows with a null in any rule
+	// column never match.
+	blocks := map[string][]int{}
+	var order []string
+rows:
+	for i, row := range rows {
+		var key strings.Builder
+		for _, rule := range rules {
+			value := row[rule.Column]
+			if value == nil {
+				continue rows
+			}
+			switch rule.Match {
+			case MatchExact:
+				raw, _ := json.Marshal(value)
+				key.Write(raw)
+			case MatchNocase:
+				raw, _ := json.Marshal(strings.ToLower(strings.TrimSpace(fmt.Sprint(value))))
+				key.Write(raw)
+			}
+			key.WriteByte(0)
+		}
+		if _, ok := blocks[key.String()]; !ok {
+			order = append(order, key.String())
+		}
+		blocks[key.String()] = append(blocks[key.String()], i)
+	}
+
+	var similar []DedupeRule
+	for _, rule := range rules {
+		if rule.Match == MatchSimilar {
+			similar = append(similar, rule)
+		}
+	}
+	trigramCache := map[[2]int]map[string]bool{}
+	grams := func(row, rule int) map[string]bool {
+		key := [2]int{row, rule}
+		if g, ok := trigramCache[key]; ok {
+			return g
+		}
+		g := trigrams(fmt.Sprint(rows[row][similar[rule].Column]))
+		trigramCache[key] = g
+		return g
+	}
+
+	for _, key := range order {
+		members := blocks[key]
+		for a := 0; a < len(members); a++ {
+			for b := a + 1; b < len(members); b++ {
+				match := true
+				for r, rule := range similar {
+					if trigramSimilarity(grams(members[a], r), grams(members[b], r)) < rule.Threshold {
+						match = false
+						break
+					}
+				}
+				if match {
+					parent[find(members[b])] = find(members[a])
+				}
+			}
+		}
+	}
+
+	groups := map[int][]map[string]any{}
+	var roots []int
+	for i, row := range rows {
+		root := find(i)
+		if _, ok := groups[root]; !ok {
+			roots = append(roots, root)
+		}
+		groups[root] = append(groups[root], row)
+	}
+	var clusters [][]map[string]any
+	for _, root := range roots {
+		if len(groups[root]) > 1 {
+			clusters = append(clusters, groups[root])
+		}
+	}
+	return clusters
+}
+
+// trigrams returns the three-letter substrings of a lowercased value padded
+// like pg_trgm, so short words still share their leading trigrams.
+func trigrams(value string) map[string]bool {
+	grams := map[string]bool{}
+	for _, word := range strings.Fields(strings.ToLower(value)) {
+		runes := []rune("  " + word + " ")
+		for i := 0; i+3 <= len(runes); i++ {
+			grams[string(runes[i:i+3])] = true
+		}
+	}
+	return grams
+}
+
+// trigramSimilarity is the share of trigrams two values have in common.
+func trigramSimilarity(a, b map[string]bool) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 1
+	}
+	shared := 0
+	for gram := range a {
+		if b[gram] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
+
+// checkSurvivor reads a merge's survivor inside its transaction, so a row the
+// caller can't see, or one an earlier merge deleted, is not merged into.
+func (dao *TenantConnection) checkSurvivor(ctx context.Context, exec Executor, relation, pk string, survivor any) error {
+	where := dao.Schema.excludeSoftDeleted(fmt.Sprintf("WHERE [%s].[%s] = ? ", relation, pk), relation)
+	policy, err := dao.compilePolicy(ctx, relation, "select", nil)
+	if err != nil {
+		return err
+	}
+	where, args := appendPolicyWhere(where, []any{survivor}, policy)
+	query, args := applyPolicyCTE(fmt.Sprintf("SELECT 1 FROM [%s] %s", relation, where), args, dao, policy.NeedsMembershipCTE)
+	var found int
+	if err := exec.QueryRowContext(ctx, query, args...).Scan(&found); errors.Is(err, sql.ErrNoRows) {
+		return tools.ErrRowNotFound
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// MergeDuplicates folds each cluster into its survivor in one transaction:
+// foreign keys pointing at a duplicate are updated to the survivor, then the
+// duplicates are deleted. Both go through the update and delete paths, so the
+// caller's policies apply.
+func (dao *TenantConnection) MergeDuplicates(ctx context.Context, relation string, merges []DedupeMerge) (DedupeResponse, error) {
+	table, err := dao.Schema.SearchTbls(relation)
+	if err != nil {
+		return DedupeResponse{}, err
+	}
+	if len(table.Pk) != 1 {
+		return DedupeResponse{}, tools.InvalidRequestErr("dedupe needs a table with a single-column primary key")
+	}
+	pk := table.Pk[0]
+	if len(merges) > MaxBatchOperations {
+		return DedupeResponse{}, tools.ErrBatchTooLarge
+	}
+
+	var refs []CacheFk
+	for _, fks := range dao.Schema.Fks {
+		for _, fk := range fks {
+			if fk.References == relation && fk.To == pk {
+				refs = append(refs, fk)
+			}
+		}
+	}
+
+	tx, err := dao.Client.BeginTx(ctx, nil)
+	if err != nil {
+		return DedupeResponse{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	dao.pendingChanges = nil
+
+	var merged int64
+	for i, merge := range merges {
+		if merge.Survivor == nil || len(merge.Duplicates) == 0 || len(merge.Duplicates) > MaxInArraySize {
+			return DedupeResponse{}, tools.InvalidRequestErr(fmt.Sprintf("merge %d needs a survivor and 1 to %d duplicates", i, MaxInArraySize))
+		}
+		for _, dup := range merge.Duplicates {
+			if fmt.Sprint(dup) == fmt.Sprint(merge.Survivor) {
+				return DedupeResponse{}, tools.InvalidRequestErr(fmt.Sprintf("merge %d lists its survivor as a duplicate", i))
+			}
+		}
+		if err := dao.checkSurvivor(ctx, tx, relation, pk, merge.Survivor); err != nil {
+			return DedupeResponse{}, fmt.Errorf("merge %d: survivor %v: %w", i, merge.Survivor, err)
+		}
+
+		for _, fk := range refs {
+			if _, err := dao.updateJSON(ctx, tx, fk.Table, UpdateRequest{
+				Data:  map[string]any{fk.From: merge.Survivor},
+				Where: []map[string]any{{fk.From: map[string]any{OpIn: merge.Duplicates}}},
+			}); err != nil {
+				return DedupeResponse{}, fmt.Errorf("merge %d: repointing %s.%s: %w", i, fk.Table, fk.From, err)
+			}
+		}
+		data, err := dao.deleteJSON(ctx, tx, relation, DeleteRequest{
+			Where: []map[string]any{{pk: map[string]any{OpIn: merge.Duplicates}}},
+		})
+		if err != nil {
+			return DedupeResponse{}, fmt.Errorf("merge %d: %w", i, err)
+		}
+		var deleted struct {
+			RowsAffected int64 `json:"rows_affected"`
+		}
+		if err := json.Unmarshal(data, &deleted); err != nil {
+			return DedupeResponse{}, err
+		}
+		merged += deleted.RowsAffected
+	}
+
+	if err := tx.Commit(); err != nil {
+		return DedupeResponse{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	dao.flushChanges(ctx)
+	return DedupeResponse{Merged: merged}, nil
+}
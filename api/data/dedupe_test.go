@@ -0,0 +1,144 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/atombasedev/atombase/tools"
+)
+
+const schemaCustomers = `
+CREATE TABLE customers (
+	id INTEGER PRIMARY KEY,
+	name TEXT,
+	email TEXT
+);
+CREATE TABLE orders (
+	id INTEGER PRIMARY KEY,
+	customer_id INTEGER REFERENCES customers(id),
+	total REAL
+);
+`
+
+func clusterIDs(clusters [][]map[string]any) [][]float64 {
+	ids := make([][]float64, len(clusters))
+	for i, cluster := range clusters {
+		for _, row := range cluster {
+			ids[i] = append(ids[i], row["id"].(float64))
+		}
+	}
+	return ids
+}
+
+func TestFindDuplicates(t *testing.T) {
+	db := setupTestDB(t, schemaCustomers)
+	if _, err := db.Exec(`INSERT INTO customers (id, name, email) VALUES
+		(1, 'Jonathan Smith', 'jon@example.com'),
+		(2, 'Jonathon Smith', 'JON@example.com '),
+		(3, 'Jane Doe', 'jane@example.com'),
+		(4, 'J. Smith', 'jon@example.com'),
+		(5, 'Mary Major', NULL),
+		(6, 'Mary Major', NULL)`); err != nil {
+		t.Fatal(err)
+	}
+	dao := &TenantConnection{Client: db, Schema: loadSchema(t, db)}
+	ctx := context.Background()
+
+	tests := []struct {
+		name  string
+		rules []DedupeRule
+		want  [][]float64
+	}{
+		{"exact", []DedupeRule{{Column: "email", Match: MatchExact}}, [][]float64{{1, 4}}},
+		{"nocase", []DedupeRule{{Column: "email", Match: MatchNocase}}, [][]float64{{1, 2, 4}}},
+		{"nocase and similar", []DedupeRule{{Column: "email", Match: MatchNocase}, {Column: "name", Match: MatchSimilar}}, [][]float64{{1, 2}}},
+		{"similar only", []DedupeRule{{Column: "name", Match: MatchSimilar, Threshold: 0.9}}, [][]float64{{5, 6}}},
+	}
+	for _, tt := range tests {
+		resp, err := dao.FindDuplicates(ctx, "customers", DedupeRequest{Rules: tt.rules})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		got := clusterIDs(resp.Clusters)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got clusters %v, want %v", tt.name, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if len(got[i]) != len(tt.want[i]) {
+				t.Errorf("%s: got clusters %v, want %v", tt.name, got, tt.want)
+				break
+			}
+			for j := range got[i] {
+				if got[i][j] != tt.want[i][j] {
+					t.Errorf("%s: got clusters %v, want %v", tt.name, got, tt.want)
+				}
+			}
+		}
+		if resp.Scanned != 6 {
+			t.Errorf("%s: scanned %d rows, want 6", tt.name, resp.Scanned)
+		}
+	}
+
+	for _, rules := range [][]DedupeRule{nil, {{Column: "email", Match: "soundex"}}, {{Column: "nope", Match: MatchExact}}} {
+		if _, err := dao.FindDuplicates(ctx, "customers", DedupeRequest{Rules: rules}); err == nil {
+			t.Errorf("expected rules %v to be rejected", rules)
+		}
+	}
+}
+
+func TestMergeDuplicates(t *testing.T) {
+	db := setupTestDB(t, schemaCustomers)
+	if _, err := db.Exec(`INSERT INTO customers (id, name) VALUES (1, 'A'), (2, 'A'), (3, 'A'), (4, 'B');
+		INSERT INTO orders (id, customer_id, total) VALUES (10, 2, 5), (11, 3, 7), (12, 4, 9)`); err != nil {
+		t.Fatal(err)
+	}
+	dao := &TenantConnection{Client: db, Schema: loadSchema(t, db)}
+	ctx := context.Background()
+
+	resp, err := dao.MergeDuplicates(ctx, "customers", []DedupeMerge{{Survivor: 1, Duplicates: []any{2, 3}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Merged != 2 {
+		t.Errorf("merged %d rows, want 2", resp.Merged)
+	}
+	var customers, repointed int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM customers`).Scan(&customers); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.QueryRow(`SELECT COUNT(*) FROM orders WHERE customer_id = 1`).Scan(&repointed); err != nil {
+		t.Fatal(err)
+	}
+	if customers != 2 || repointed != 2 {
+		t.Errorf("got %d customers and %d orders on the survivor, want 2 and 2", customers, repointed)
+	}
+
+	if _, err := dao.MergeDuplicates(ctx, "customers", []DedupeMerge{{Survivor: 4, Duplicates: []any{4}}}); err == nil || !strings.Contains(err.Error(), "survivor as a duplicate") {
+		t.Errorf("expected a survivor listed as a duplicate to be rejected, got %v", err)
+	}
+	// The survivor of the second merge was deleted by the first, so neither happens.
+	if _, err := dao.MergeDuplicates(ctx, "customers", []DedupeMerge{{Survivor: 4, Duplicates: []any{1}}, {Survivor: 1, Duplicates: []any{4}}}); !errors.Is(err, tools.ErrRowNotFound) {
+		t.Errorf("expected a missing survivor to be refused, got %v", err)
+	}
+	if _, err := dao.MergeDuplicates(ctx, "customers", []DedupeMerge{{Survivor: 99, Duplicates: []any{4}}}); !errors.Is(err, tools.ErrRowNotFound) {
+		t.Errorf("expected a missing survivor to be refused, got %v", err)
+	}
+	if err := db.QueryRow(`SELECT COUNT(*) FROM customers`).Scan(&customers); err != nil || customers != 2 {
+		t.Errorf("expected refused merges to delete nothing, got %d customers, %v", customers, err)
+	}
+}
+
+func TestTrigramSimilarity(t *testing.T) {
+	if got := trigramSimilarity(trigrams("Smith"), trigrams("smith")); got != 1 {
+		t.Errorf("case should not matter, got %v", got)
+	}
+	if got := trigramSimilarity(trigrams("Jonathan"), trigrams("Jonathon")); got < 0.5 || got >= 1 {
+		t.Errorf("near spellings: got %v", got)
+	}
+	if got := trigramSimilarity(trigrams("apple"), trigrams("zebra")); got != 0 {
+		t.Errorf("unrelated words: got %v", got)
+	}
+}
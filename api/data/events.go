@@ -0,0 +1,380 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/atombasedev/atombase/config"
+	"github.com/atombasedev/atombase/definitions"
+	"github.com/atombasedev/atombase/tools"
+)
+
+const (
+	eventBacklog      = 1000            // Events kept per table for Last-Event-ID resume
+	eventBuffer       = 64              // Events a slow stream may fall behind before it is reset
+	eventResumeWindow = 2 * time.Minute // How long writes keep being captured after the last stream leaves
+	changeRowID       = "__ab_rowid"    // Alias of the rowid a captured insert returns
+)
+
+// eventHub fans out the rows written through this server to the event
+// streams open on their tables. Writes are only captured while a table has a
+// stream, or had one within eventResumeWindow, so a client can reconnect
+// without missing events. Writes made through other servers, or by raw SQL,
+// are not seen.
+type eventHub struct {
+	mu      sync.Mutex
+	streams map[string]*eventStream // Keyed by database ID and table
+}
+
+type eventStream struct {
+	gen     string // Changes when a stream is recreated, so old ids can't match new events
+	seq     int64
+	backlog []ChangeEvent
+	subs    map[*eventSub]struct{}
+	idleAt  time.Time // When the last subscriber left
+}
+
+type eventSub struct {
+	ch chan ChangeEvent // Closed when the subscriber falls too far behind
+}
+
+// pendingChange is a write waiting for its transaction to commit.
+type pendingChange struct {
+	table string
+	op    string
+	rows  []map[string]any
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{streams: map[string]*eventStream{}}
+}
+
+func eventKey(databaseID, table string) string {
+	return databaseID + "\x00" + table
+}
+
+// watching reports whether writes to a table should be captured, dropping
+// the table's stream once it has been idle past the resume window.
+func (h *eventHub) watching(databaseID, table string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	key := eventKey(databaseID, table)
+	stream, ok := h.streams[key]
+	if !ok {
+		return false
+	}
+	if len(stream.subs) == 0 && time.Since(stream.idleAt) > eventResumeWindow {
+		delete(h.streams, key)
+		return false
+	}
+	return true
+}
+
+// publish numbers a write's rows and sends them to the table's streams. A
+// subscriber whose buffer is full is dropped; its stream then tells the
+// client to reload.
+func (h *eventHub) publish(databaseID, table, op string, rows []map[string]any) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	stream, ok := h.streams[eventKey(databaseID, table)]
+	if !ok {
+		return
+	}
+	for _, row := range rows {
+		stream.seq++
+		event := ChangeEvent{ID: stream.gen + "-" + strconv.FormatInt(stream.seq, 10), Table: table, Op: op, Row: row}
+		stream.backlog = append(stream.backlog, event)
+		for sub := range stream.subs {
+			select {
+			case sub.ch <- event:
+			default:
+				close(sub.ch)
+				delete(stream.subs, sub)
+				if len(stream.subs) == 0 {
+					stream.idleAt = time.Now()
+				}
+			}
+		}
+	}
+	if over := len(stream.backlog) - eventBacklog; over > 0 {
+		stream.backlog = append(stream.backlog[:0:0], stream.backlog[over:]...)
+	}
+}
+
+// subscribe opens a subscription on a table. With a lastEventID it returns
+// the events written since then; resumed is false when they are no longer
+// all known, and the client has to reload instead.
+func (h *eventHub) subscribe(databaseID, table, lastEventID string) (sub *eventSub, replay []ChangeEvent, resumed bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	key := eventKey(databaseID, table)
+	stream, ok := h.streams[key]
+	if !ok {
+		gen := make([]byte, 4)
+		_, _ = rand.Read(gen)
+		stream = &eventStream{gen: hex.EncodeToString(gen), subs: map[*eventSub]struct{}{}}
+		h.streams[key] = stream
+	}
+	sub = &eventSub{ch: make(chan ChangeEvent, eventBuffer)}
+	stream.subs[sub] = struct{}{}
+
+	if lastEventID == "" {
+		return sub, nil, true
+	}
+	gen, rawSeq, _ := strings.Cut(lastEventID, "-")
+	seq, err := strconv.ParseInt(rawSeq, 10, 64)
+	if err != nil || gen != stream.gen || seq > stream.seq || seq < stream.seq-int64(len(stream.backlog)) {
+		return sub, nil, false
+	}
+	missed := stream.seq - seq
+	replay = append([]ChangeEvent(nil), stream.backlog[int64(len(stream.backlog))-missed:]...)
+	return sub, replay, true
+}
+
+func (h *eventHub) unsubscribe(databaseID, table string, sub *eventSub) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	stream, ok := h.streams[eventKey(databaseID, table)]
+	if !ok {
+		return
+	}
+	if _, ok := stream.subs[sub]; ok {
+		delete(stream.subs, sub)
+		if len(stream.subs) == 0 {
+			stream.idleAt = time.Now()
+		}
+	}
+}
+
+// watchingChanges reports whether writes to a table should capture their
+// rows for event streams or webhooks.
+func (dao *TenantConnection) watchingChanges(ctx context.Context, table string) bool {
+	if dao.events != nil && dao.events.watching(dao.ID, table) {
+		return true
+	}
+	return len(dao.webhooksFor(ctx, table, "")) > 0
+}
+
+// writeWithChanges runs a write with RETURNING * so its rows can be sent to
+// the table's event streams and webhooks, then answers as the write would have: with the
+// columns it asked to return, or with its last insert id or affected row count.
+func (dao *TenantConnection) writeWithChanges(ctx context.Context, exec Executor, table CacheTable, shape, op, query string, args []any, policy definitions.CompiledPredicate, returning []string, lastInsertID bool) ([]byte, error) {
+	var project []string
+	if len(returning) > 0 && (len(returning) != 1 || returning[0] != "*") {
+		if _, err := table.BuildReturningFromJSON(returning); err != nil {
+			return nil, err
+		}
+		project = returning
+	}
+
+	query += fmt.Sprintf("RETURNING *, [rowid] AS [%s] ", changeRowID)
+	query, args = applyPolicyCTE(query, args, dao, policy.NeedsMembershipCTE)
+	rows, err := exec.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	results, err := tools.ScanRows(rows)
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+	var rowID int64
+	for _, row := range results {
+		if id, ok := row[changeRowID].(int64); ok {
+			rowID = id
+		}
+		delete(row, changeRowID)
+	}
+	recordQuery(ctx, shape, int64(len(results)))
+	dao.recordChange(ctx, exec, table.Name, op, results)
+
+	switch {
+	case len(returning) == 0 && lastInsertID:
+		return json.Marshal(map[string]any{"last_insert_id": rowID})
+	case len(returning) == 0:
+		return json.Marshal(map[string]any{"rows_affected": int64(len(results))})
+	case project == nil:
+		return json.Marshal(results)
+	}
+	projected := make([]map[string]any, len(results))
+	for i, row := range results {
+		projected[i] = make(map[string]any, len(project))
+		for _, col := range project {
+			projected[i][col] = row[col]
+		}
+	}
+	return json.Marshal(projected)
+}
+
+// recordChange publishes written rows, or holds them until commit when the
+// write runs in a transaction.
+func (dao *TenantConnection) recordChange(ctx context.Context, exec Executor, table, op string, rows []map[string]any) {
+	if len(rows) == 0 {
+		return
+	}
+	if _, inTx := exec.(*sql.Tx); inTx {
+		dao.pendingChanges = append(dao.pendingChanges, pendingChange{table: table, op: op, rows: rows})
+		return
+	}
+	dao.publishChange(ctx, table, op, rows)
+}
+
+// flushChanges publishes the changes of a committed transaction.
+func (dao *TenantConnection) flushChanges(ctx context.Context) {
+	for _, change := range dao.pendingChanges {
+		dao.publishChange(ctx, change.table, change.op, change.rows)
+	}
+	dao.pendingChanges = nil
+}
+
+// publishChange sends written rows to the table's event streams and queues
+// them for its webhooks.
+func (dao *TenantConnection) publishChange(ctx context.Context, table, op string, rows []map[string]any) {
+	if dao.events != nil {
+		dao.events.publish(dao.ID, table, op, rows)
+	}
+	dao.enqueueWebhooks(ctx, table, op, rows)
+}
+
+// eventVisible reports whether the subscriber may see an event's row: it must
+// pass the stream's filters and the subscriber's select policy. The row is
+// checked by a query over a CTE that shadows the table with the row alone, so
+// filters and policies run exactly as they would in a select.
+func (dao *TenantConnection) eventVisible(ctx context.Context, table CacheTable, where string, whereArgs []any, policy definitions.CompiledPredicate, row map[string]any) (bool, error) {
+	where, whereArgs = appendPolicyWhere(where, whereArgs, policy)
+	if where == "" {
+		return true, nil
+	}
+
+	cols := make([]string, 0, len(row))
+	for col := range row {
+		if _, ok := table.Columns[col]; ok {
+			cols = append(cols, col)
+		}
+	}
+	sort.Strings(cols)
+	values := make([]string, len(cols))
+	var args []any
+	for i, col := range cols {
+		values[i] = fmt.Sprintf("? AS [%s]", col)
+		args = append(args, row[col])
+	}
+
+	ctes := fmt.Sprintf("[%s] AS (SELECT %s)", table.Name, strings.Join(values, ", "))
+	if policy.NeedsMembershipCTE && dao.DefinitionType == "organization" {
+		ctes = "__ab_membership AS (SELECT user_id, role, status FROM atombase_membership WHERE user_id = ?), " + ctes
+		args = append([]any{dao.Principal.UserID}, args...)
+	}
+	query := fmt.Sprintf("WITH %s SELECT 1 FROM [%s] %s", ctes, table.Name, where)
+	var one int
+	err := dao.Client.QueryRowContext(ctx, query, append(args, whereArgs...)...).Scan(&one)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// serveEvents streams a table's change events as Server-Sent Events until
+// the client disconnects. Comments are sent as heartbeats so proxies keep the
+// connection open.
+func (dao *TenantConnection) serveEvents(w http.ResponseWriter, req *http.Request, relation string) error {
+	ctx := req.Context()
+	table, err := dao.Schema.SearchTbls(relation)
+	if err != nil {
+		return err
+	}
+	filters, err := requestFilters(req, dao.Schema, relation)
+	if err != nil {
+		return err
+	}
+	if err := dao.Schema.checkAllowedOperators(filters); err != nil {
+		return err
+	}
+	where, whereArgs, err := table.BuildWhereFromJSON(filters, dao.Schema)
+	if err != nil {
+		return err
+	}
+	policy, err := dao.compilePolicy(ctx, relation, "select", nil)
+	if err != nil {
+		return err
+	}
+
+	sub, replay, resumed := dao.events.subscribe(dao.ID, relation, req.Header.Get("Last-Event-ID"))
+	defer dao.events.unsubscribe(dao.ID, relation, sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Time{})
+	tools.LiftRequestTimeout(req.Context())
+
+	send := func(event ChangeEvent) error {
+		visible, err := dao.eventVisible(ctx, table, where, whereArgs, policy, event.Row)
+		if err != nil || !visible {
+			return err
+		}
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Op, data); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+	reset := func() {
+		_, _ = fmt.Fprint(w, "event: reset\ndata: {}\n\n")
+		_ = rc.Flush()
+	}
+
+	if !resumed {
+		reset()
+	}
+	if _, err := fmt.Fprint(w, ": connected\n\n"); err != nil {
+		return nil
+	}
+	_ = rc.Flush()
+	for _, event := range replay {
+		if err := send(event); err != nil {
+			return nil
+		}
+	}
+
+	interval := time.Duration(config.Cfg.EventHeartbeatInterval) * time.Second
+	if interval <= 0 {
+		interval = 15 * time.Second
+	}
+	heartbeat := time.NewTicker(interval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return nil
+			}
+			_ = rc.Flush()
+		case event, ok := <-sub.ch:
+			if !ok {
+				reset()
+				return nil
+			}
+			if err := send(event); err != nil {
+				return nil
+			}
+		}
+	}
+}
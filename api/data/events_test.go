@@ -0,0 +1,177 @@
+package data
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventHub_ResumeAndReset(t *testing.T) {
+	hub := newEventHub()
+	if hub.watching("db", "users") {
+		t.Fatal("a table without streams should not be watched")
+	}
+	sub, _, resumed := hub.subscribe("db", "users", "")
+	if !resumed || !hub.watching("db", "users") {
+		t.Fatal("expected a fresh subscription to watch the table")
+	}
+	hub.publish("db", "users", ChangeInsert, []map[string]any{{"id": 1}, {"id": 2}, {"id": 3}})
+	var ids []string
+	for range 3 {
+		ids = append(ids, (<-sub.ch).ID)
+	}
+	hub.unsubscribe("db", "users", sub)
+	if !hub.watching("db", "users") {
+		t.Fatal("expected the table to stay watched within the resume window")
+	}
+
+	_, replay, resumed := hub.subscribe("db", "users", ids[0])
+	if !resumed || len(replay) != 2 || replay[0].ID != ids[1] || replay[1].ID != ids[2] {
+		t.Fatalf("expected events 2 and 3 replayed, got %v (resumed %v)", replay, resumed)
+	}
+	if _, replay, resumed := hub.subscribe("db", "users", ids[2]); !resumed || len(replay) != 0 {
+		t.Fatalf("expected nothing to replay after the last event, got %v", replay)
+	}
+	for _, stale := range []string{"other-1", "garbage", strings.Split(ids[0], "-")[0] + "-99"} {
+		if _, _, resumed := hub.subscribe("db", "users", stale); resumed {
+			t.Errorf("expected %q to need a reset", stale)
+		}
+	}
+
+	slow, _, _ := hub.subscribe("db", "slow", "")
+	rows := make([]map[string]any, eventBuffer+1)
+	for i := range rows {
+		rows[i] = map[string]any{"id": i}
+	}
+	hub.publish("db", "slow", ChangeInsert, rows)
+	for range eventBuffer {
+		<-slow.ch
+	}
+	if _, ok := <-slow.ch; ok {
+		t.Fatal("expected a subscriber that fell behind to be closed")
+	}
+}
+
+func TestWriteWithChanges(t *testing.T) {
+	db := setupTestDB(t, schemaUsers)
+	defer db.Close()
+	dao := &TenantConnection{Client: db, Schema: loadSchema(t, db), ID: "db", events: newEventHub()}
+	ctx := context.Background()
+
+	// Writes before any stream are not captured.
+	if _, err := dao.InsertJSON(ctx, "users", InsertRequest{Data: []map[string]any{{"name": "Early"}}}); err != nil {
+		t.Fatal(err)
+	}
+	sub, _, _ := dao.events.subscribe("db", "users", "")
+
+	data, err := dao.InsertJSON(ctx, "users", InsertRequest{Data: []map[string]any{{"name": "Alice", "age": 30}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"last_insert_id":2}` {
+		t.Fatalf("unexpected insert response: %s", data)
+	}
+	event := <-sub.ch
+	if event.Op != ChangeInsert || event.Row["name"] != "Alice" || event.Row["status"] != "active" || event.Row["id"] != int64(2) {
+		t.Fatalf("unexpected insert event: %+v", event)
+	}
+	if _, ok := event.Row[changeRowID]; ok {
+		t.Fatal("the rowid alias should not reach events")
+	}
+
+	data, err = dao.UpdateJSON(ctx, "users", UpdateRequest{
+		Data:      map[string]any{"age": 31},
+		Where:     []map[string]any{{"id": map[string]any{"eq": 2}}},
+		Returning: []string{"age"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `[{"age":31}]` {
+		t.Fatalf("unexpected update response: %s", data)
+	}
+	if event := <-sub.ch; event.Op != ChangeUpdate || event.Row["name"] != "Alice" {
+		t.Fatalf("unexpected update event: %+v", event)
+	}
+
+	// A batch publishes only once it commits.
+	if _, err := dao.Batch(ctx, BatchRequest{Operations: []BatchOperation{
+		{Operation: "delete", Table: "users", Body: map[string]any{"where": []any{map[string]any{"id": map[string]any{"eq": 1}}}}},
+		{Operation: "insert", Table: "users", Body: map[string]any{"data": map[string]any{"id": 2, "name": "Duplicate"}}},
+	}}); err == nil {
+		t.Fatal("expected the batch to fail on the duplicate key")
+	}
+	select {
+	case event := <-sub.ch:
+		t.Fatalf("a rolled back batch published %+v", event)
+	default:
+	}
+	if _, err := dao.Batch(ctx, BatchRequest{Operations: []BatchOperation{
+		{Operation: "delete", Table: "users", Body: map[string]any{"where": []any{map[string]any{"id": map[string]any{"eq": 1}}}}},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	if event := <-sub.ch; event.Op != ChangeDelete || event.Row["name"] != "Early" {
+		t.Fatalf("unexpected delete event: %+v", event)
+	}
+}
+
+func TestServeEvents_Filters(t *testing.T) {
+	db := setupTestDB(t, schemaUsers)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	dao := &TenantConnection{Client: db, Schema: loadSchema(t, db), ID: "db", events: newEventHub()}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := dao.serveEvents(w, r, "users"); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer server.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/data/events/users?age=gt.26", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("unexpected content type %q", resp.Header.Get("Content-Type"))
+	}
+	lines := bufio.NewScanner(resp.Body)
+	if !lines.Scan() || lines.Text() != ": connected" {
+		t.Fatalf("expected the connected comment, got %q", lines.Text())
+	}
+
+	for _, row := range []map[string]any{{"name": "Young", "age": 20}, {"name": "Old", "age": 40}} {
+		if _, err := dao.InsertJSON(context.Background(), "users", InsertRequest{Data: []map[string]any{row}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var got []string
+	for lines.Scan() {
+		if lines.Text() == "" {
+			if len(got) > 0 {
+				break
+			}
+			continue
+		}
+		got = append(got, lines.Text())
+	}
+	if len(got) != 3 || !strings.HasPrefix(got[0], "id: ") || got[1] != "event: insert" {
+		t.Fatalf("unexpected event: %q", got)
+	}
+	var event ChangeEvent
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(got[2], "data: ")), &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Row["name"] != "Old" || event.ID != strings.TrimPrefix(got[0], "id: ") {
+		t.Fatalf("expected only the row matching the filter, got %+v", event)
+	}
+}
@@ -0,0 +1,500 @@
+package data
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/atombasedev/atombase/config"
+	"github.com/atombasedev/atombase/tools"
+)
+
+// exportPageSize is how many rows an export reads per cursor page.
+const exportPageSize = 1000
+
+// exportRegistry keeps export jobs in memory. A finished job is dropped once
+// its download link expires, and every job is lost on restart.
+type exportRegistry struct {
+	mu   sync.Mutex
+	jobs map[string]*exportEntry
+}
+
+type exportEntry struct {
+	job   ExportJob
+	owner string
+}
+
+func newExportRegistry() *exportRegistry {
+	return &exportRegistry{jobs: map[string]*exportEntry{}}
+}
+
+// start registers a running job, refusing it when MaxRunningExports are
+// already running.
+func (r *exportRegistry) start(job ExportJob, owner string, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	running := 0
+	for id, entry := range r.jobs {
+		switch {
+		case entry.job.Status == ExportRunning:
+			running++
+		case entry.job.ExpiresAt != nil && now.After(*entry.job.ExpiresAt),
+			entry.job.ExpiresAt == nil && entry.job.CompletedAt != nil && now.Sub(*entry.job.CompletedAt) > exportURLTTL():
+			delete(r.jobs, id)
+		}
+	}
+	if running >= MaxRunningExports {
+		return fmt.Errorf("%w: %d exports are already running", tools.ErrTooManyConcurrentRequests, running)
+	}
+	r.jobs[job.ID] = &exportEntry{job: job, owner: owner}
+	return nil
+}
+
+// get returns a job started by owner.
+func (r *exportRegistry) get(id, owner string) (ExportJob, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry, ok := r.jobs[id]
+	if !ok || entry.owner != owner {
+		return ExportJob{}, tools.ErrExportNotFound
+	}
+	return entry.job, nil
+}
+
+// finish applies the outcome of a job and returns its final state.
+func (r *exportRegistry) finish(id string, update func(job *ExportJob)) ExportJob {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry := r.jobs[id]
+	update(&entry.job)
+	return entry.job
+}
+
+// exportOwner identifies who may read a job: the service key, the scoped API
+// key or the user who started it. Anonymous callers cannot export.
+func exportOwner(dao *TenantConnection) (string, error) {
+	switch {
+	case dao.Principal.KeyScope != nil:
+		return "key:" + dao.Principal.KeyScope.KeyID, nil
+	case dao.Principal.IsService:
+		return "service", nil
+	case dao.Principal.TokenDatabase != "":
+		return "jwt:" + dao.Principal.TokenDatabase + ":" + dao.Principal.UserID, nil
+	case dao.Principal.UserID != "":
+		return "user:" + dao.Principal.UserID, nil
+	}
+	return "", tools.UnauthorizedErr("exports need a signed-in user or the service key")
+}
+
+func exportURLTTL() time.Duration {
+	return time.Duration(config.Cfg.ExportURLTTL) * time.Second
+}
+
+func exportStore() *tools.ObjectStore {
+	return tools.NewObjectStore(config.Cfg.ExportS3URL, config.Cfg.ExportS3Region, config.Cfg.ExportS3AccessKey, config.Cfg.ExportS3SecretKey)
+}
+
+// validateExport checks an export request before its job starts, so mistakes
+// are reported to the caller instead of in a failed job.
+func validateExport(dao *TenantConnection, table string, req *ExportRequest) error {
+	switch req.Format {
+	case ExportCSV, ExportNDJSON, ExportSQLite:
+	default:
+		return tools.InvalidRequestErr(fmt.Sprintf("format must be %s, %s or %s, got %q", ExportCSV, ExportNDJSON, ExportSQLite, req.Format))
+	}
+	switch req.Nested {
+	case "":
+		req.Nested = NestedFlatten
+	case NestedFlatten, NestedOmit:
+	default:
+		return tools.InvalidRequestErr(fmt.Sprintf("nested must be %s or %s, got %q", NestedFlatten, NestedOmit, req.Nested))
+	}
+	if req.Query.Offset != nil || req.Query.Cursor != nil {
+		return tools.InvalidRequestErr("exports page through every matching row; remove offset and cursor")
+	}
+	if len(req.Query.Join) > 0 {
+		return tools.InvalidRequestErr("exports do not support custom joins")
+	}
+	if req.Webhook != "" {
+		if !dao.Principal.IsService {
+			return tools.UnauthorizedErr("export webhooks need the service key")
+		}
+		if err := checkWebhookURL(req.Webhook); err != nil {
+			return tools.InvalidRequestErr("webhook: " + err.Error())
+		}
+	}
+	if _, err := dao.Schema.SearchTbls(table); err != nil {
+		return err
+	}
+	return nil
+}
+
+// startExport registers an export job and runs it in the background. The
+// job owns dao from here on and closes it when closeConn is set.
+func (api *API) startExport(dao TenantConnection, closeConn bool, table string, req ExportRequest, store *tools.ObjectStore) (ExportJob, error) {
+	owner, err := exportOwner(&dao)
+	if err != nil {
+		return ExportJob{}, err
+	}
+	if err := validateExport(&dao, table, &req); err != nil {
+		return ExportJob{}, err
+	}
+
+	id := make([]byte, 12)
+	_, _ = rand.Read(id)
+	job := ExportJob{
+		ID:        hex.EncodeToString(id),
+		Database:  dao.Name,
+		Table:     table,
+		Format:    req.Format,
+		Status:    ExportRunning,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := api.exports.start(job, owner, job.CreatedAt); err != nil {
+		return ExportJob{}, err
+	}
+
+	go func() {
+		if closeConn {
+			defer dao.Close()
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(config.Cfg.ExportTimeout)*time.Second)
+		defer cancel()
+
+		rows, link, expires, err := dao.runExport(ctx, job, req, store)
+		done := api.exports.finish(job.ID, func(j *ExportJob) {
+			now := time.Now().UTC()
+			j.CompletedAt = &now
+			j.Rows = rows
+			if err != nil {
+				j.Status = ExportFailed
+				j.Error = err.Error()
+				return
+			}
+			j.Status = ExportDone
+			j.URL = link
+			j.ExpiresAt = &expires
+		})
+		if err != nil {
+			log.Printf("export %s of %s.%s failed: %v", job.ID, dao.ID, table, err)
+		}
+		if req.Webhook != "" {
+			notifyExport(req.Webhook, done)
+		}
+	}()
+	return job, nil
+}
+
+var exportContentTypes = map[string]string{
+	ExportCSV:    "text/csv",
+	ExportNDJSON: "application/x-ndjson",
+	ExportSQLite: "application/vnd.sqlite3",
+}
+
+// runExport writes the matching rows to a temporary file in the job's
+// format, uploads it and returns a signed link to it.
+func (dao *TenantConnection) runExport(ctx context.Context, job ExportJob, req ExportRequest, store *tools.ObjectStore) (int64, string, time.Time, error) {
+	rowsFile, err := os.CreateTemp("", "atomicbase-export-*.ndjson")
+	if err != nil {
+		return 0, "", time.Time{}, err
+	}
+	defer os.Remove(rowsFile.Name())
+	defer rowsFile.Close()
+
+	n, err := dao.exportRows(ctx, job.Table, req.Query, rowsFile)
+	if err != nil {
+		return n, "", time.Time{}, err
+	}
+
+	artifact := rowsFile
+	switch job.Format {
+	case ExportCSV:
+		if artifact, err = os.CreateTemp("", "atomicbase-export-*.csv"); err != nil {
+			return n, "", time.Time{}, err
+		}
+		defer os.Remove(artifact.Name())
+		defer artifact.Close()
+		if _, err := rowsFile.Seek(0, io.SeekStart); err != nil {
+			return n, "", time.Time{}, err
+		}
+		if err := writeExportCSV(rowsFile, artifact, req.Nested); err != nil {
+			return n, "", time.Time{}, err
+		}
+	case ExportSQLite:
+		path := strings.TrimSuffix(rowsFile.Name(), ".ndjson") + ".db"
+		defer os.Remove(path)
+		table, _ := dao.Schema.SearchTbls(job.Table)
+		if err := writeExportSQLite(ctx, rowsFile, path, table, req.Nested); err != nil {
+			return n, "", time.Time{}, err
+		}
+		if artifact, err = os.Open(path); err != nil {
+			return n, "", time.Time{}, err
+		}
+		defer artifact.Close()
+	}
+
+	key := fmt.Sprintf("%s/%s.%s", dao.ID, job.ID, job.Format)
+	if job.Format == ExportSQLite {
+		key = fmt.Sprintf("%s/%s.db", dao.ID, job.ID)
+	}
+	if err := store.PutFile(ctx, key, artifact, exportContentTypes[job.Format]); err != nil {
+		return n, "", time.Time{}, fmt.Errorf("upload failed: %w", err)
+	}
+	now := time.Now().UTC()
+	link, err := store.PresignGet(key, exportURLTTL(), now)
+	if err != nil {
+		return n, "", time.Time{}, err
+	}
+	return n, link, now.Add(exportURLTTL()), nil
+}
+
+// exportRows pages through a select by cursor, so the export is not capped by
+// the select limit, and writes each row to w as a line of JSON. A limit on
+// the query caps the total.
+func (dao *TenantConnection) exportRows(ctx context.Context, table string, query SelectQuery, w io.Writer) (int64, error) {
+	total := -1
+	if query.Limit != nil && *query.Limit > 0 {
+		total = *query.Limit
+	}
+	out := bufio.NewWriter(w)
+	cursor := ""
+	var n int64
+	for {
+		size := exportPageSize
+		size = dao.Schema.selectLimit(&size)
+		if total >= 0 && int64(size) > int64(total)-n {
+			size = int(int64(total) - n)
+		}
+		if size <= 0 {
+			break
+		}
+		page := query
+		page.Limit = &size
+		page.Cursor = &cursor
+		result, err := dao.SelectJSON(ctx, table, page, false)
+		if err != nil {
+			return n, err
+		}
+		var rows []json.RawMessage
+		if err := json.Unmarshal(result.Data, &rows); err != nil {
+			return n, err
+		}
+		for _, row := range rows {
+			out.Write(row)
+			out.WriteByte('\n')
+		}
+		n += int64(len(rows))
+		if result.NextCursor == "" {
+			break
+		}
+		cursor = result.NextCursor
+	}
+	return n, out.Flush()
+}
+
+// scanExportRows calls fn with each row of an exported rows file, flattened
+// the way CSV selects flatten them.
+func scanExportRows(r io.Reader, nested string, fn func(row []csvField) error) error {
+	dec := json.NewDecoder(bufio.NewReader(r))
+	dec.UseNumber()
+	for dec.More() {
+		value, err := decodeOrderedJSON(dec)
+		if err != nil {
+			return err
+		}
+		row, ok := value.([]csvField)
+		if !ok {
+			return fmt.Errorf("expected rows to be objects")
+		}
+		if err := fn(flattenCSVRow(nil, "", row, nested)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportHeader reads a rows file once for the union of its flattened keys,
+// in first-seen order, and rewinds it.
+func exportHeader(rows io.ReadSeeker, nested string) ([]string, map[string]int, error) {
+	if _, err := rows.Seek(0, io.SeekStart); err != nil {
+		return nil, nil, err
+	}
+	var header []string
+	index := map[string]int{}
+	err := scanExportRows(rows, nested, func(row []csvField) error {
+		for _, field := range row {
+			if _, ok := index[field.key]; !ok {
+				index[field.key] = len(header)
+				header = append(header, field.key)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	_, err = rows.Seek(0, io.SeekStart)
+	return header, index, err
+}
+
+// writeExportCSV converts a rows file to CSV, reading it twice so the header
+// is known before the first record without holding the rows in memory.
+func writeExportCSV(rows io.ReadSeeker, w io.Writer, nested string) error {
+	header, index, err := exportHeader(rows, nested)
+	if err != nil {
+		return err
+	}
+	out := csv.NewWriter(w)
+	if err := out.Write(header); err != nil {
+		return err
+	}
+	record := make([]string, len(header))
+	err = scanExportRows(rows, nested, func(row []csvField) error {
+		clear(record)
+		for _, field := range row {
+			record[index[field.key]] = csvCell(field.value)
+		}
+		return out.Write(record)
+	})
+	if err != nil {
+		return err
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// writeExportSQLite converts a rows file to a SQLite database at path holding
+// one table named after the exported table. Values keep their JSON types;
+// nested relations are flattened as for CSV. An export without rows gets the
+// table's columns.
+func writeExportSQLite(ctx context.Context, rows io.ReadSeeker, path string, table CacheTable, nested string) error {
+	header, index, err := exportHeader(rows, nested)
+	if err != nil {
+		return err
+	}
+	if len(header) == 0 {
+		for name := range table.Columns {
+			header = append(header, name)
+		}
+		sort.Strings(header)
+	}
+
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	columns := make([]string, len(header))
+	for i, name := range header {
+		columns[i] = sqliteQuote(name)
+	}
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("CREATE TABLE %s (%s)", sqliteQuote(table.Name), strings.Join(columns, ", "))); err != nil {
+		return err
+	}
+	stmt, err := tx.PrepareContext(ctx, fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+		sqliteQuote(table.Name), strings.Join(columns, ", "), strings.TrimSuffix(strings.Repeat("?, ", len(header)), ", ")))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	values := make([]any, len(header))
+	err = scanExportRows(rows, nested, func(row []csvField) error {
+		clear(values)
+		for _, field := range row {
+			values[index[field.key]] = exportSQLValue(field.value)
+		}
+		_, err := stmt.ExecContext(ctx, values...)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// sqliteQuote quotes an identifier for the export database, where flattened
+// names like author.name are not valid bare identifiers.
+func sqliteQuote(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func exportSQLValue(value any) any {
+	switch v := value.(type) {
+	case nil, string:
+		return v
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case bool:
+		if v {
+			return 1
+		}
+		return 0
+	default:
+		return csvCell(v)
+	}
+}
+
+// notifyExport POSTs a finished job to its webhook. Delivery is best effort.
+func notifyExport(webhook string, job ExportJob) {
+	if err := postJSON(webhook, job); err != nil {
+		log.Printf("export %s webhook failed: %v", job.ID, err)
+	}
+}
+
+// webhookClient POSTs finished jobs, only to public addresses; postJSON
+// bounds each call.
+var webhookClient = tools.PublicHTTPClient(0)
+
+// checkWebhookURL vets a webhook URL when it is saved. Tests swap it, and
+// webhookClient, to post to a local server.
+var checkWebhookURL = tools.CheckPublicURL
+
+// postJSON POSTs payload to url once, without retries.
+func postJSON(url string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
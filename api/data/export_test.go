@@ -0,0 +1,171 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/atombasedev/atombase/config"
+	"github.com/atombasedev/atombase/definitions"
+	"github.com/atombasedev/atombase/tools"
+)
+
+func TestExportRows_PagesPastSelectLimit(t *testing.T) {
+	oldCfg := config.Cfg
+	defer func() { config.Cfg = oldCfg }()
+	config.Cfg.MaxQueryLimit = 2
+
+	db := setupTestDB(t, schemaUsers)
+	if _, err := db.Exec(`INSERT INTO users (name, email, age) VALUES ('Alice', 'a@example.com', 30), ('Bob', 'b@example.com', 25), ('Cara', 'c@example.com', 41), ('Dan', 'd@example.com', 19), ('Eve', 'e@example.com', 52)`); err != nil {
+		t.Fatal(err)
+	}
+	dao := &TenantConnection{Client: db, Schema: loadSchema(t, db)}
+
+	var out bytes.Buffer
+	n, err := dao.exportRows(context.Background(), "users", SelectQuery{Select: []any{"id", "name"}}, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 5 || strings.Count(out.String(), "\n") != 5 {
+		t.Fatalf("got %d rows, want all 5:\n%s", n, out.String())
+	}
+
+	out.Reset()
+	n, err = dao.exportRows(context.Background(), "users", SelectQuery{Select: []any{"name"}, Limit: intPtr(3)}, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Fatalf("limit 3 exported %d rows", n)
+	}
+}
+
+const exportRowsFile = `{"id":1,"name":"Alice","active":true,"author":[{"name":"Zed"}]}
+{"id":2,"name":"Bob","score":1.5,"tags":["a","b"]}
+`
+
+func TestWriteExportCSV(t *testing.T) {
+	var out bytes.Buffer
+	if err := writeExportCSV(strings.NewReader(exportRowsFile), &out, NestedFlatten); err != nil {
+		t.Fatal(err)
+	}
+	want := "id,name,active,author.name,score,tags\n1,Alice,true,Zed,,\n2,Bob,,,1.5,\"[\"\"a\"\",\"\"b\"\"]\"\n"
+	if out.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", out.String(), want)
+	}
+
+	out.Reset()
+	if err := writeExportCSV(strings.NewReader(exportRowsFile), &out, NestedOmit); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out.String(), "id,name,active,score\n") {
+		t.Errorf("omit kept nested columns:\n%s", out.String())
+	}
+}
+
+func TestWriteExportSQLite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "export.db")
+	table := CacheTable{Name: "users", Columns: map[string]string{"id": ColTypeInteger}}
+	if err := writeExportSQLite(context.Background(), strings.NewReader(exportRowsFile), path, table, NestedFlatten); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var id int64
+	var name, author string
+	var active int
+	var score sql.NullFloat64
+	if err := db.QueryRow(`SELECT id, name, active, "author.name", score FROM users WHERE id = 1`).Scan(&id, &name, &active, &author, &score); err != nil {
+		t.Fatal(err)
+	}
+	if name != "Alice" || active != 1 || author != "Zed" || score.Valid {
+		t.Errorf("row 1 = %d %s %d %s %v", id, name, active, author, score)
+	}
+	var kind string
+	if err := db.QueryRow(`SELECT typeof(score) FROM users WHERE id = 2`).Scan(&kind); err != nil {
+		t.Fatal(err)
+	}
+	if kind != "real" {
+		t.Errorf("score stored as %s, want real", kind)
+	}
+
+	empty := filepath.Join(t.TempDir(), "empty.db")
+	if err := writeExportSQLite(context.Background(), strings.NewReader(""), empty, table, NestedFlatten); err != nil {
+		t.Fatalf("empty export: %v", err)
+	}
+}
+
+func TestExportRegistry(t *testing.T) {
+	r := newExportRegistry()
+	now := time.Now()
+	for i := 0; i < MaxRunningExports; i++ {
+		if err := r.start(ExportJob{ID: string(rune('a' + i)), Status: ExportRunning}, "user:1", now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.start(ExportJob{ID: "z", Status: ExportRunning}, "user:1", now); !errors.Is(err, tools.ErrTooManyConcurrentRequests) {
+		t.Fatalf("expected too many exports, got %v", err)
+	}
+
+	expired := now.Add(-time.Minute)
+	r.finish("a", func(job *ExportJob) {
+		job.Status = ExportDone
+		job.ExpiresAt = &expired
+	})
+	if err := r.start(ExportJob{ID: "z", Status: ExportRunning}, "service", now); err != nil {
+		t.Fatalf("finished job should free a slot: %v", err)
+	}
+	if _, err := r.get("a", "user:1"); !errors.Is(err, tools.ErrExportNotFound) {
+		t.Errorf("expired job should be pruned, got %v", err)
+	}
+	if _, err := r.get("b", "user:2"); !errors.Is(err, tools.ErrExportNotFound) {
+		t.Errorf("another user read the job: %v", err)
+	}
+	if job, err := r.get("b", "user:1"); err != nil || job.ID != "b" {
+		t.Errorf("owner get = %v, %v", job, err)
+	}
+}
+
+func TestValidateExport(t *testing.T) {
+	db := setupTestDB(t, schemaUsers)
+	user := &TenantConnection{Client: db, Schema: loadSchema(t, db), Principal: definitions.Principal{UserID: "u1"}}
+
+	req := ExportRequest{Format: ExportCSV}
+	if err := validateExport(user, "users", &req); err != nil || req.Nested != NestedFlatten {
+		t.Fatalf("valid request: %v, nested %q", err, req.Nested)
+	}
+	for name, req := range map[string]ExportRequest{
+		"format":  {Format: "xlsx"},
+		"nested":  {Format: ExportCSV, Nested: "keep"},
+		"offset":  {Format: ExportCSV, Query: SelectQuery{Offset: intPtr(5)}},
+		"webhook": {Format: ExportCSV, Webhook: "https://example.com/done"},
+		"table":   {Format: ExportCSV},
+	} {
+		table := "users"
+		if name == "table" {
+			table = "missing"
+		}
+		if err := validateExport(user, table, &req); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	service := &TenantConnection{Client: db, Schema: user.Schema, Principal: definitions.Principal{IsService: true}}
+	if err := validateExport(service, "users", &ExportRequest{Format: ExportSQLite, Webhook: "https://example.com/done"}); err != nil {
+		t.Errorf("service webhook: %v", err)
+	}
+	for _, webhook := range []string{"file:///etc/passwd", "http://example.com/done", "https://169.254.169.254/latest"} {
+		if err := validateExport(service, "users", &ExportRequest{Format: ExportSQLite, Webhook: webhook}); err == nil {
+			t.Errorf("expected webhook %s to be rejected", webhook)
+		}
+	}
+}
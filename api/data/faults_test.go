@@ -0,0 +1,49 @@
+//go:build faults
+
+package data
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/atombasedev/atombase/tools"
+)
+
+func TestFaults_BusyWritesAreRetried(t *testing.T) {
+	db := setupTestDB(t, schemaUsers)
+	defer db.Close()
+	dao := &TenantConnection{Client: db, Schema: loadSchema(t, db)}
+	defer tools.ClearFaults()
+	if err := tools.SetFaults([]tools.Fault{{Point: tools.FaultSQLiteExec, Kind: tools.FaultKindBusy, Count: 2}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := dao.InsertJSON(context.Background(), "users", InsertRequest{Data: []map[string]any{{"id": 1, "name": "ann"}}}); err != nil {
+		t.Fatalf("expected the insert to succeed after retries, got %v", err)
+	}
+	if fired := tools.ListFaults()[0].Fired; fired != 2 {
+		t.Fatalf("expected two injected busy errors, got %d", fired)
+	}
+}
+
+func TestFaults_PartialMigrationFailure(t *testing.T) {
+	db := setupTestDB(t, schemaUsers)
+	defer db.Close()
+	defer tools.ClearFaults()
+	if err := tools.SetFaults([]tools.Fault{{Point: tools.FaultMigrationStatement, Kind: tools.FaultKindError, Skip: 1}}); err != nil {
+		t.Fatal(err)
+	}
+
+	err := executeMigrationBatch(context.Background(), db, []string{
+		`CREATE TABLE a (id INTEGER)`,
+		`CREATE TABLE b (id INTEGER)`,
+	}, nil, false)
+	if err == nil || !strings.Contains(err.Error(), "statement 2 failed (earlier statements remain applied)") {
+		t.Fatalf("expected the second statement to fail, got %v", err)
+	}
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE name IN ('a', 'b')`).Scan(&n); err != nil || n != 1 {
+		t.Fatalf("expected only the first statement applied, got %d (%v)", n, err)
+	}
+}
@@ -0,0 +1,284 @@
+package data
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/atombasedev/atombase/tools"
+)
+
+// filterParamOperators are the operators accepted in URL filters.
+var filterParamOperators = map[string]bool{
+	OpEq: true, OpNeq: true, OpGt: true, OpGte: true, OpLt: true, OpLte: true,
+	OpLike: true, OpIlike: true, OpGlob: true, OpIn: true, OpIs: true, OpFts: true, OpBetween: true,
+}
+
+// reservedParams are query parameters that are not column filters.
+var reservedParams = map[string]bool{
+	ParamSelect: true, ParamOrder: true, ParamLimit: true, ParamOffset: true, ParamCount: true, ParamCursor: true,
+	ParamFormat: true, ParamNested: true, ParamComputed: true, ParamLang: true, ParamPage: true, ParamPerPage: true,
+	ParamFTS: true, ParamFTSRank: true, ParamFTSSnippet: true, ParamFTSHighlight: true, ParamResolution: true,
+	ParamAllowFullScan: true,
+}
+
+// requestFilters returns the where conditions in the request's query string.
+func requestFilters(req *http.Request, schema SchemaCache, table string) ([]map[string]any, error) {
+	params := req.URL.Query()
+	if len(params) == 0 {
+		return nil, nil
+	}
+	tbl, err := schema.SearchTbls(table)
+	if err != nil {
+		return nil, err
+	}
+	return parseFilterParams(params, tbl)
+}
+
+// parseFilterParams turns PostgREST-style query parameters into where
+// conditions, which are ANDed with the body's where:
+//
+//	age=gt.18                                  {"age": {"gt": 18}}
+//	status=not.in.(banned,deleted)             {"status": {"not": {"in": ["banned", "deleted"]}}}
+//	or=(age.gt.18,status.eq.active)            {"or": [{"age": {"gt": 18}}, {"status": {"eq": "active"}}]}
+//	or=(role.eq.admin,and(age.gt.18,age.lt.65))
+//	data->age=gt.21                            {"data->age": {"gt": 21}}
+//	geo=near.(52.52,13.40,500)                 {"__geo": {"near": [52.52, 13.40, 500]}}
+//
+// Values are converted to the column's type; double quotes keep commas,
+// parentheses and dots inside a value. In like and ilike patterns * is the
+// wildcard and % and _ match themselves.
+func parseFilterParams(params url.Values, table CacheTable) ([]map[string]any, error) {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		if !reservedParams[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var where []map[string]any
+	for _, key := range keys {
+		for _, value := range params[key] {
+			var condition map[string]any
+			var err error
+			if key == OpOr || key == OpAnd {
+				condition, err = parseFilterGroup(key, value, table, 1)
+			} else if key == ParamGeo {
+				condition, err = parseGeoParam(value)
+			} else {
+				condition, err = parseFilterTerm(key, value, table)
+			}
+			if err != nil {
+				return nil, tools.InvalidRequestErr(fmt.Sprintf("invalid filter %s=%s: %v", key, value, err))
+			}
+			where = append(where, condition)
+		}
+	}
+	return where, nil
+}
+
+// parseFilterGroup parses "(term,term,...)" where each term is col.op.value
+// or a nested and(...) / or(...) group.
+func parseFilterGroup(op, value string, table CacheTable, depth int) (map[string]any, error) {
+	if depth > MaxFilterDepth {
+		return nil, fmt.Errorf("filter groups nest more than %d levels", MaxFilterDepth)
+	}
+	inner, ok := parenthesized(value)
+	if !ok {
+		return nil, fmt.Errorf("%s group must be wrapped in parentheses", op)
+	}
+	terms, err := splitFilterList(inner)
+	if err != nil {
+		return nil, err
+	}
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("%s group cannot be empty", op)
+	}
+	conditions := make([]any, 0, len(terms))
+	for _, term := range terms {
+		var condition map[string]any
+		switch {
+		case strings.HasPrefix(term, OpOr+"("):
+			condition, err = parseFilterGroup(OpOr, term[len(OpOr):], table, depth+1)
+		case strings.HasPrefix(term, OpAnd+"("):
+			condition, err = parseFilterGroup(OpAnd, term[len(OpAnd):], table, depth+1)
+		default:
+			column, rest, found := splitFilterColumn(term)
+			if !found {
+				return nil, fmt.Errorf("%q must have the form column.operator.value", term)
+			}
+			condition, err = parseFilterTerm(column, rest, table)
+		}
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, condition)
+	}
+	return map[string]any{op: conditions}, nil
+}
+
+// splitFilterColumn splits "col.op.value" at the first operator, so
+// table.column names keep their dot.
+func splitFilterColumn(term string) (column, rest string, found bool) {
+	segments := strings.Split(term, ".")
+	for i := 1; i < len(segments); i++ {
+		if filterParamOperators[segments[i]] || segments[i] == OpNot {
+			return strings.Join(segments[:i], "."), strings.Join(segments[i:], "."), true
+		}
+	}
+	return "", "", false
+}
+
+// parseFilterTerm parses "op.value" or "not.op.value" for a column.
+func parseFilterTerm(column, expr string, table CacheTable) (map[string]any, error) {
+	negate := false
+	if rest, ok := strings.CutPrefix(expr, OpNot+"."); ok {
+		negate = true
+		expr = rest
+	}
+	op, raw, found := strings.Cut(expr, ".")
+	if !found || !filterParamOperators[op] {
+		return nil, fmt.Errorf("%q must have the form operator.value", expr)
+	}
+	colType := table.Columns[column]
+	if strings.Contains(column, "->") {
+		colType = jsonValueType
+	}
+	value, err := parseFilterValue(op, raw, colType)
+	if err != nil {
+		return nil, err
+	}
+	filter := map[string]any{op: value}
+	if negate {
+		filter = map[string]any{OpNot: filter}
+	}
+	return map[string]any{column: filter}, nil
+}
+
+func parseFilterValue(op, raw, colType string) (any, error) {
+	switch op {
+	case OpIn, OpBetween:
+		inner, ok := parenthesized(raw)
+		if !ok {
+			return nil, fmt.Errorf("%s value must be a parenthesized list", op)
+		}
+		items, err := splitFilterList(inner)
+		if err != nil {
+			return nil, err
+		}
+		values := make([]any, len(items))
+		for i, item := range items {
+			values[i] = coerceFilterValue(item, colType)
+		}
+		return values, nil
+	case OpIs:
+		switch strings.ToLower(raw) {
+		case "null":
+			return nil, nil
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+		return nil, fmt.Errorf("is value must be null, true or false")
+	case OpLike, OpIlike:
+		return likePattern(unquoteFilterValue(raw)), nil
+	case OpGlob, OpFts:
+		return unquoteFilterValue(raw), nil
+	default:
+		return coerceFilterValue(raw, colType), nil
+	}
+}
+
+// likePatternEscaper escapes LIKE's own wildcards so only * matches anything.
+var likePatternEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`, "*", "%")
+
+// likePattern turns a URL like value into a LIKE pattern: * is the wildcard and
+// a literal % or _ matches only itself.
+func likePattern(value string) string {
+	return likePatternEscaper.Replace(value)
+}
+
+// coerceFilterValue converts a URL value to the column's type. Tenant columns
+// may be declared without a type affinity, where "18" would not equal 18.
+func coerceFilterValue(raw, colType string) any {
+	if strings.HasPrefix(raw, `"`) {
+		return unquoteFilterValue(raw)
+	}
+	switch strings.ToUpper(colType) {
+	case ColTypeInteger:
+		if n, err := strconv.ParseInt(raw, 10, 64); err == nil {
+			return n
+		}
+	case ColTypeReal:
+		if f, err := strconv.ParseFloat(raw, 64); err == nil {
+			return f
+		}
+	case jsonValueType:
+		if n, err := strconv.ParseInt(raw, 10, 64); err == nil {
+			return n
+		}
+		if f, err := strconv.ParseFloat(raw, 64); err == nil {
+			return f
+		}
+	}
+	return raw
+}
+
+func unquoteFilterValue(raw string) string {
+	if len(raw) >= 2 && raw[0] == '"' && raw[len(raw)-1] == '"' {
+		if s, err := strconv.Unquote(raw); err == nil {
+			return s
+		}
+		return raw[1 : len(raw)-1]
+	}
+	return raw
+}
+
+func parenthesized(s string) (string, bool) {
+	if len(s) < 2 || s[0] != '(' || s[len(s)-1] != ')' {
+		return "", false
+	}
+	return s[1 : len(s)-1], true
+}
+
+// splitFilterList splits a comma-separated list at the top level, leaving
+// commas inside parentheses and double-quoted values alone.
+func splitFilterList(s string) ([]string, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	var items []string
+	depth, start := 0, 0
+	quoted, escaped := false, false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case escaped:
+			escaped = false
+		case quoted && c == '\\':
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+			if depth < 0 {
+				return nil, fmt.Errorf("unbalanced parentheses")
+			}
+		case c == ',' && depth == 0:
+			items = append(items, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+	if quoted || depth != 0 {
+		return nil, fmt.Errorf("unbalanced quotes or parentheses")
+	}
+	return append(items, strings.TrimSpace(s[start:])), nil
+}
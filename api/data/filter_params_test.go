@@ -0,0 +1,111 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestParseFilterParams(t *testing.T) {
+	table := CacheTable{Name: "users", Columns: map[string]string{"age": "INTEGER", "score": "REAL", "name": "TEXT", "status": "TEXT"}}
+
+	tests := []struct {
+		query string
+		want  []map[string]any
+	}{
+		{"age=gt.18", []map[string]any{{"age": map[string]any{"gt": int64(18)}}}},
+		{"score=lte.2.5", []map[string]any{{"score": map[string]any{"lte": 2.5}}}},
+		{"name=eq.18", []map[string]any{{"name": map[string]any{"eq": "18"}}}},
+		{"status=not.in.(banned,deleted)", []map[string]any{{"status": map[string]any{"not": map[string]any{"in": []any{"banned", "deleted"}}}}}},
+		{"name=like.Jo*", []map[string]any{{"name": map[string]any{"like": "Jo%"}}}},
+		{"name=ilike.*50%25_off*", []map[string]any{{"name": map[string]any{"ilike": `%50\%\_off%`}}}},
+		{"name=not.ilike.a*", []map[string]any{{"name": map[string]any{"not": map[string]any{"ilike": "a%"}}}}},
+		{"age=not.gt.18", []map[string]any{{"age": map[string]any{"not": map[string]any{"gt": int64(18)}}}}},
+		{"name=is.null", []map[string]any{{"name": map[string]any{"is": nil}}}},
+		{`name=in.("a,b","c")`, []map[string]any{{"name": map[string]any{"in": []any{"a,b", "c"}}}}},
+		{"select=id&limit=5&age=eq.1", []map[string]any{{"age": map[string]any{"eq": int64(1)}}}},
+		{"or=(age.lt.18,and(status.eq.active,age.between.(18,65)))", []map[string]any{{"or": []any{
+			map[string]any{"age": map[string]any{"lt": int64(18)}},
+			map[string]any{"and": []any{
+				map[string]any{"status": map[string]any{"eq": "active"}},
+				map[string]any{"age": map[string]any{"between": []any{int64(18), int64(65)}}},
+			}},
+		}}}},
+		{`or=(name.eq."a.b",name.not.eq.x)`, []map[string]any{{"or": []any{
+			map[string]any{"name": map[string]any{"eq": "a.b"}},
+			map[string]any{"name": map[string]any{"not": map[string]any{"eq": "x"}}},
+		}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			params, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := parseFilterParams(params, table)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFilterParams_Errors(t *testing.T) {
+	table := CacheTable{Name: "users", Columns: map[string]string{"age": "INTEGER"}}
+	for _, query := range []string{
+		"age=18",
+		"age=approx.18",
+		"age=in.1,2",
+		"age=is.maybe",
+		"or=age.eq.1",
+		"or=()",
+		"or=(age.eq.1",
+		"or=(age)",
+		"and=(or(and(or(and(or(and(or(and(age.eq.1)))))))))",
+	} {
+		params, err := url.ParseQuery(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := parseFilterParams(params, table); err == nil {
+			t.Errorf("%s: expected an error", query)
+		}
+	}
+}
+
+func TestParseFilterParams_LikeMatchesLiteralWildcards(t *testing.T) {
+	db := setupTestDB(t, schemaUsers)
+	defer db.Close()
+	if _, err := db.Exec(`INSERT INTO users (id, name) VALUES (1, '50% OFF'), (2, '50x off'), (3, 'a_b'), (4, 'axb')`); err != nil {
+		t.Fatal(err)
+	}
+	schema := loadSchema(t, db)
+	dao := &TenantConnection{Client: db, Schema: schema}
+
+	for query, want := range map[string]float64{
+		"name=ilike.50%25*": 1,
+		"name=like.a_b":     3,
+	} {
+		params, _ := url.ParseQuery(query)
+		where, err := parseFilterParams(params, schema.Tables["users"])
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := dao.SelectJSON(context.Background(), "users", SelectQuery{Select: []any{"id"}, Where: where}, false)
+		if err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+		var rows []map[string]any
+		if err := json.Unmarshal(result.Data, &rows); err != nil {
+			t.Fatal(err)
+		}
+		if len(rows) != 1 || rows[0]["id"] != want {
+			t.Errorf("%s: expected only row %v, got %v", query, want, rows)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/atombasedev/atombase/config"
+	"github.com/atombasedev/atombase/tools"
+)
+
+// Modes of ATOMICBASE_FULL_SCAN_GUARD.
+const (
+	FullScanWarn    = "warn"    // Run the query and name the scanned tables in X-Full-Scan
+	FullScanRequire = "require" // Refuse the query unless it is sent with allow_full_scan=true
+	FullScanReject  = "reject"  // Refuse the query
+)
+
+// guardFullScan checks the plan of a filtered query for full scans of tables
+// that sqlite_stat1 records at least FullScanMinRows rows for. Depending on
+// the guard's mode the scanned tables are noted for the response or the query
+// is refused. Tables that were never analyzed are not checked, nor are
+// service requests, which no query limit applies to.
+func (dao *TenantConnection) guardFullScan(ctx context.Context, exec Executor, where []map[string]any, query string, args []any) error {
+	mode := config.Cfg.FullScanGuard
+	if mode != FullScanWarn && mode != FullScanRequire && mode != FullScanReject {
+		return nil
+	}
+	if len(where) == 0 || dao.CallerKey == "" {
+		return nil
+	}
+	query, args = applyPolicyCTE(query, args, dao, strings.Contains(query, "__ab_membership"))
+	scanned, err := dao.fullScans(ctx, exec, query, args)
+	if err != nil || len(scanned) == 0 {
+		return err
+	}
+	switch {
+	case mode == FullScanReject:
+		return fmt.Errorf("%w: %s is scanned in full; filter on an indexed column", tools.ErrFullScan, strings.Join(scanned, ", "))
+	case mode == FullScanRequire && !dao.AllowFullScan:
+		return fmt.Errorf("%w: %s is scanned in full; filter on an indexed column or pass %s=true", tools.ErrFullScan, strings.Join(scanned, ", "), ParamAllowFullScan)
+	}
+	for _, table := range scanned {
+		if !slices.Contains(dao.FullScans, table) {
+			dao.FullScans = append(dao.FullScans, table)
+		}
+	}
+	return nil
+}
+
+// fullScans returns the large tables the plan of query reads every row of.
+// A SCAN step reads the whole table, or the whole of an index, where a
+// SEARCH step looks rows up by key.
+func (dao *TenantConnection) fullScans(ctx context.Context, exec Executor, query string, args []any) ([]string, error) {
+	rows, err := exec.QueryContext(ctx, "EXPLAIN QUERY PLAN "+query, args...)
+	if err != nil {
+		return nil, err
+	}
+	var tables []string
+	for rows.Next() {
+		var id, parent, notUsed int
+		var detail string
+		if err := rows.Scan(&id, &parent, &notUsed, &detail); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		fields := strings.Fields(detail)
+		if len(fields) < 2 || fields[0] != "SCAN" {
+			continue
+		}
+		table := fields[1]
+		// SQLite before 3.36 writes SCAN TABLE name.
+		if table == "TABLE" && len(fields) > 2 {
+			table = fields[2]
+		}
+		if _, err := dao.Schema.SearchTbls(table); err == nil && !slices.Contains(tables, table) {
+			tables = append(tables, table)
+		}
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// Row counts are read once the plan is closed, which an Executor holding
+	// a single connection needs.
+	var scanned []string
+	for _, table := range tables {
+		if dao.estimateRows(ctx, exec, table, -1) >= config.Cfg.FullScanMinRows {
+			scanned = append(scanned, table)
+		}
+	}
+	return scanned, nil
+}
+
+// setFullScanHeader names the tables a warned query scanned in full.
+func (dao *TenantConnection) setFullScanHeader(w http.ResponseWriter) {
+	if len(dao.FullScans) > 0 {
+		w.Header().Set("X-Full-Scan", strings.Join(dao.FullScans, ", "))
+	}
+}
@@ -0,0 +1,75 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/atombasedev/atombase/config"
+	"github.com/atombasedev/atombase/tools"
+)
+
+func TestFullScanGuard(t *testing.T) {
+	db := setupTestDB(t, schemaUsers+`
+WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < 50)
+INSERT INTO users (id, name, email) SELECT i, 'user' || i, 'user' || i || '@example.com' FROM n;
+ANALYZE;`)
+	defer db.Close()
+	schema := loadSchema(t, db)
+	ctx := context.Background()
+
+	oldGuard, oldMin := config.Cfg.FullScanGuard, config.Cfg.FullScanMinRows
+	defer func() { config.Cfg.FullScanGuard, config.Cfg.FullScanMinRows = oldGuard, oldMin }()
+	config.Cfg.FullScanMinRows = 20
+
+	byName := SelectQuery{Where: []map[string]any{{"name": map[string]any{"eq": "user7"}}}}
+	byID := SelectQuery{Where: []map[string]any{{"id": map[string]any{"eq": 7}}}}
+	caller := func() *TenantConnection {
+		return &TenantConnection{Client: db, Schema: schema, ID: "full-scan", CallerKey: "ip:192.0.2.1"}
+	}
+
+	config.Cfg.FullScanGuard = FullScanWarn
+	dao := caller()
+	if _, err := dao.SelectJSON(ctx, "users", byID, false); err != nil || len(dao.FullScans) != 0 {
+		t.Fatalf("expected a lookup by key to pass, got %v, %v", dao.FullScans, err)
+	}
+	if _, err := dao.SelectJSON(ctx, "users", byName, false); err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	dao.setFullScanHeader(w)
+	if got := w.Header().Get("X-Full-Scan"); got != "users" {
+		t.Fatalf("expected X-Full-Scan: users, got %q", got)
+	}
+
+	config.Cfg.FullScanGuard = FullScanRequire
+	if _, err := caller().SelectJSON(ctx, "users", byName, false); !errors.Is(err, tools.ErrFullScan) {
+		t.Fatalf("expected ErrFullScan, got %v", err)
+	}
+	dao = caller()
+	dao.AllowFullScan = true
+	if _, err := dao.SelectJSON(ctx, "users", byName, false); err != nil {
+		t.Fatalf("expected allow_full_scan to let the scan run, got %v", err)
+	}
+	service := &TenantConnection{Client: db, Schema: schema, ID: "full-scan"}
+	if _, err := service.SelectJSON(ctx, "users", byName, false); err != nil {
+		t.Fatalf("expected service requests to be exempt, got %v", err)
+	}
+
+	config.Cfg.FullScanGuard = FullScanReject
+	dao = caller()
+	dao.AllowFullScan = true
+	if _, err := dao.DeleteJSON(ctx, "users", DeleteRequest{Where: byName.Where}); !errors.Is(err, tools.ErrFullScan) {
+		t.Fatalf("expected the delete refused, got %v", err)
+	}
+	if _, err := dao.UpdateJSON(ctx, "users", UpdateRequest{Data: map[string]any{"name": "x"}, Where: byID.Where}); err != nil {
+		t.Fatalf("expected an update by key to run, got %v", err)
+	}
+
+	// Small tables are never guarded.
+	config.Cfg.FullScanMinRows = 100
+	if _, err := caller().SelectJSON(ctx, "users", byName, false); err != nil {
+		t.Fatalf("expected a small table to be scanned, got %v", err)
+	}
+}
@@ -0,0 +1,209 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/atombasedev/atombase/tools"
+)
+
+// earthRadius is the mean radius of the Earth in meters.
+const earthRadius = 6371008.8
+
+// geoColumnPairs are the latitude and longitude columns a table without
+// geoColumns is filtered on, in order of preference.
+var geoColumnPairs = [][2]string{{"lat", "lng"}, {"lat", "lon"}, {"latitude", "longitude"}}
+
+// parseGeoParam parses ?geo=near.(lat,lng,radius_m) or
+// ?geo=bbox.(minLat,minLng,maxLat,maxLng) into a where condition.
+func parseGeoParam(value string) (map[string]any, error) {
+	op, raw, _ := strings.Cut(value, ".")
+	if op != OpNear && op != OpBBox {
+		return nil, fmt.Errorf("geo filter must be near.(lat,lng,radius) or bbox.(minLat,minLng,maxLat,maxLng)")
+	}
+	inner, ok := parenthesized(raw)
+	if !ok {
+		return nil, fmt.Errorf("%s value must be a parenthesized list", op)
+	}
+	items, err := splitFilterList(inner)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]any, len(items))
+	for i, item := range items {
+		if values[i], err = strconv.ParseFloat(item, 64); err != nil {
+			return nil, fmt.Errorf("%s value %q is not a number", op, item)
+		}
+	}
+	return map[string]any{geoFilter: map[string]any{op: values}}, nil
+}
+
+// geoColumns returns the latitude and longitude columns of table, and
+// whether they have an R*Tree index.
+func (schema SchemaCache) geoColumns(table CacheTable) (lat, lng string, indexed bool, err error) {
+	if cols := schema.GeoColumns[table.Name]; len(cols) == 2 {
+		return cols[0], cols[1], true, nil
+	}
+	for _, pair := range geoColumnPairs {
+		latType, hasLat := table.Columns[pair[0]]
+		lngType, hasLng := table.Columns[pair[1]]
+		if hasLat && hasLng && numericColumn(latType) && numericColumn(lngType) {
+			return pair[0], pair[1], false, nil
+		}
+	}
+	return "", "", false, tools.InvalidRequestErr(fmt.Sprintf("table %s has no numeric lat/lng columns to filter by location", table.Name))
+}
+
+func numericColumn(colType string) bool {
+	switch strings.ToUpper(colType) {
+	case "", ColTypeReal, ColTypeInteger:
+		return true
+	}
+	return false
+}
+
+// geoBox is a latitude/longitude box in degrees. MinLng > MaxLng when the
+// box crosses the antimeridian.
+type geoBox struct {
+	MinLat, MinLng, MaxLat, MaxLng float64
+}
+
+// buildGeoClause builds the condition of a {"__geo": {"near": [...]}} or
+// {"__geo": {"bbox": [...]}} filter. near keeps the rows within a
+// great-circle distance, computed with the haversine formula, after cutting
+// the table down to the circle's bounding box; with an R*Tree index that
+// cut uses the index.
+func (table CacheTable) buildGeoClause(value any, schema SchemaCache) (string, []any, error) {
+	filter, ok := value.(map[string]any)
+	if !ok || len(filter) != 1 {
+		return "", nil, tools.InvalidRequestErr(fmt.Sprintf("%s value must be an object with one of near or bbox", geoFilter))
+	}
+	lat, lng, indexed, err := schema.geoColumns(table)
+	if err != nil {
+		return "", nil, err
+	}
+	latCol := fmt.Sprintf("[%s].[%s]", table.Name, lat)
+	lngCol := fmt.Sprintf("[%s].[%s]", table.Name, lng)
+
+	for op, val := range filter {
+		switch op {
+		case OpBBox:
+			nums, err := geoNumbers(op, val, 4)
+			if err != nil {
+				return "", nil, err
+			}
+			box := geoBox{MinLat: nums[0], MinLng: nums[1], MaxLat: nums[2], MaxLng: nums[3]}
+			if !validLatitude(box.MinLat) || !validLatitude(box.MaxLat) || box.MinLat > box.MaxLat ||
+				!validLongitude(box.MinLng) || !validLongitude(box.MaxLng) {
+				return "", nil, tools.InvalidRequestErr("bbox must be minLat,minLng,maxLat,maxLng with latitudes in -90..90, minLat <= maxLat and longitudes in -180..180")
+			}
+			clause, args := table.geoBoxClause(box, latCol, lngCol, indexed)
+			return clause + " ", args, nil
+		case OpNear:
+			nums, err := geoNumbers(op, val, 3)
+			if err != nil {
+				return "", nil, err
+			}
+			pointLat, pointLng, radius := nums[0], nums[1], nums[2]
+			if !validLatitude(pointLat) || !validLongitude(pointLng) || !(radius > 0) {
+				return "", nil, tools.InvalidRequestErr("near must be lat,lng,radius with lat in -90..90, lng in -180..180 and a positive radius in meters")
+			}
+			clause, args := table.geoBoxClause(nearBox(pointLat, pointLng, radius), latCol, lngCol, indexed)
+			// haversine(d) = sin²(Δlat/2) + cos(lat1)·cos(lat2)·sin²(Δlng/2),
+			// compared against haversine of the radius.
+			angle := math.Min(radius/earthRadius, math.Pi)
+			limit := math.Pow(math.Sin(angle/2), 2)
+			clause += fmt.Sprintf(" AND power(sin(radians(%s - ?) / 2), 2) + cos(radians(%s)) * ? * power(sin(radians(%s - ?) / 2), 2) <= ?",
+				latCol, latCol, lngCol)
+			args = append(args, pointLat, math.Cos(pointLat*math.Pi/180), pointLng, limit)
+			return "(" + clause + ") ", args, nil
+		default:
+			return "", nil, fmt.Errorf("%w: %s", tools.ErrInvalidOperator, op)
+		}
+	}
+	return "", nil, nil
+}
+
+// geoBoxClause keeps the rows inside box, using the table's R*Tree when it
+// has one. The index stores coordinates as 32-bit floats, so the exact
+// comparison always follows it.
+func (table CacheTable) geoBoxClause(box geoBox, latCol, lngCol string, indexed bool) (string, []any) {
+	clause := fmt.Sprintf("%s BETWEEN ? AND ?", latCol)
+	args := []any{box.MinLat, box.MaxLat}
+	if box.MinLng <= box.MaxLng {
+		clause += fmt.Sprintf(" AND %s BETWEEN ? AND ?", lngCol)
+	} else {
+		clause += fmt.Sprintf(" AND (%s >= ? OR %s <= ?)", lngCol, lngCol)
+	}
+	args = append(args, box.MinLng, box.MaxLng)
+
+	if indexed && box.MinLng <= box.MaxLng && len(table.Pk) == 1 {
+		geoTable := table.Name + GeoSuffix
+		clause = fmt.Sprintf("[%s].[%s] IN (SELECT id FROM [%s] WHERE max_lat >= ? AND min_lat <= ? AND max_lng >= ? AND min_lng <= ?) AND ",
+			table.Name, table.Pk[0], geoTable) + clause
+		args = append([]any{box.MinLat, box.MaxLat, box.MinLng, box.MaxLng}, args...)
+	}
+	return clause, args
+}
+
+// nearBox is the bounding box of the circle of radius meters around a
+// point. Circles reaching a pole span every longitude.
+func nearBox(lat, lng, radius float64) geoBox {
+	angle := radius / earthRadius
+	dLat := angle * 180 / math.Pi
+	box := geoBox{MinLat: lat - dLat, MaxLat: lat + dLat, MinLng: -180, MaxLng: 180}
+	if box.MinLat <= -90 || box.MaxLat >= 90 {
+		box.MinLat, box.MaxLat = math.Max(box.MinLat, -90), math.Min(box.MaxLat, 90)
+		return box
+	}
+	dLng := math.Asin(math.Sin(angle)/math.Cos(lat*math.Pi/180)) * 180 / math.Pi
+	box.MinLng, box.MaxLng = lng-dLng, lng+dLng
+	if box.MinLng < -180 {
+		box.MinLng += 360
+	}
+	if box.MaxLng > 180 {
+		box.MaxLng -= 360
+	}
+	return box
+}
+
+func geoNumbersErr(op string, n int) error {
+	return tools.InvalidRequestErr(fmt.Sprintf("%s value must be an array of %d numbers", op, n))
+}
+
+func validLatitude(v float64) bool  { return v >= -90 && v <= 90 }
+func validLongitude(v float64) bool { return v >= -180 && v <= 180 }
+
+// geoNumbers reads the n numbers of a near or bbox value.
+func geoNumbers(op string, val any, n int) ([]float64, error) {
+	items, ok := val.([]any)
+	if !ok || len(items) != n {
+		return nil, geoNumbersErr(op, n)
+	}
+	nums := make([]float64, n)
+	for i, item := range items {
+		switch v := item.(type) {
+		case float64:
+			nums[i] = v
+		case int64:
+			nums[i] = float64(v)
+		case int:
+			nums[i] = float64(v)
+		case json.Number:
+			f, err := v.Float64()
+			if err != nil {
+				return nil, geoNumbersErr(op, n)
+			}
+			nums[i] = f
+		default:
+			return nil, geoNumbersErr(op, n)
+		}
+		if math.IsNaN(nums[i]) || math.IsInf(nums[i], 0) {
+			return nil, geoNumbersErr(op, n)
+		}
+	}
+	return nums, nil
+}
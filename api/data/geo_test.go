@@ -0,0 +1,144 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestParseGeoParam(t *testing.T) {
+	got, err := parseGeoParam("near.(51.5,-0.12,500)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{geoFilter: map[string]any{OpNear: []any{51.5, -0.12, 500.0}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	for _, value := range []string{"within.(1,2,3)", "bbox.1,2,3,4", "near.(1,x,3)"} {
+		if _, err := parseGeoParam(value); err == nil {
+			t.Errorf("%s: expected an error", value)
+		}
+	}
+}
+
+func TestNearBox(t *testing.T) {
+	// One degree of latitude is about 111.2 km.
+	box := nearBox(0, 179.5, 111195)
+	if math.Abs(box.MaxLat-1) > 1e-3 || math.Abs(box.MinLat+1) > 1e-3 {
+		t.Errorf("latitude span: got %+v", box)
+	}
+	if box.MinLng <= box.MaxLng || math.Abs(box.MaxLng+179.5) > 1e-3 {
+		t.Errorf("expected the box to cross the antimeridian, got %+v", box)
+	}
+	if box := nearBox(89.9, 0, 50000); box.MinLng != -180 || box.MaxLng != 180 || box.MaxLat != 90 {
+		t.Errorf("expected a box around the pole to span every longitude, got %+v", box)
+	}
+}
+
+func setupGeoTest(t *testing.T, indexed bool) *TenantConnection {
+	t.Helper()
+	db := setupTestDB(t, `CREATE TABLE places (id INTEGER PRIMARY KEY, name TEXT, lat REAL, lng REAL);`)
+	if _, err := db.Exec(`INSERT INTO places (id, name, lat, lng) VALUES
+		(1, 'Trafalgar Square', 51.5080, -0.1281),
+		(2, 'Tower Bridge', 51.5055, -0.0754),
+		(3, 'Paris', 48.8566, 2.3522),
+		(4, 'Fiji', -17.7134, 178.0650),
+		(5, 'Nowhere', NULL, NULL)`); err != nil {
+		t.Fatal(err)
+	}
+	schema := loadSchema(t, db)
+	if indexed {
+		if _, err := db.Exec(`CREATE VIRTUAL TABLE places_geo USING rtree(id, min_lat, max_lat, min_lng, max_lng);
+			INSERT INTO places_geo SELECT id, lat, lat, lng, lng FROM places WHERE lat IS NOT NULL`); err != nil {
+			t.Fatal(err)
+		}
+		schema.GeoColumns = map[string][]string{"places": {"lat", "lng"}}
+	}
+	return &TenantConnection{Client: db, Schema: schema}
+}
+
+func geoNames(t *testing.T, dao *TenantConnection, query string) []string {
+	t.Helper()
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	where, err := parseFilterParams(params, dao.Schema.Tables["places"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := dao.SelectJSON(context.Background(), "places", SelectQuery{
+		Select: []any{"name"},
+		Where:  where,
+		Order:  map[string]string{"id": "asc"},
+	}, false)
+	if err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	var rows []map[string]any
+	if err := json.Unmarshal(result.Data, &rows); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, row := range rows {
+		names = append(names, row["name"].(string))
+	}
+	return names
+}
+
+func TestSelectJSON_GeoBBox(t *testing.T) {
+	for _, indexed := range []bool{false, true} {
+		dao := setupGeoTest(t, indexed)
+		if got, want := geoNames(t, dao, "geo=bbox.(51,-1,52,0)"), []string{"Trafalgar Square", "Tower Bridge"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("indexed=%v: got %v, want %v", indexed, got, want)
+		}
+		if got, want := geoNames(t, dao, "geo=bbox.(-20,170,0,-170)"), []string{"Fiji"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("indexed=%v: across the antimeridian got %v, want %v", indexed, got, want)
+		}
+		if got, want := geoNames(t, dao, "geo=bbox.(51,-1,52,0)&name=like.Tower*"), []string{"Tower Bridge"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("indexed=%v: with another filter got %v, want %v", indexed, got, want)
+		}
+	}
+}
+
+func TestSelectJSON_GeoNear(t *testing.T) {
+	for _, indexed := range []bool{false, true} {
+		dao := setupGeoTest(t, indexed)
+		if _, err := dao.Client.Exec(`SELECT radians(1)`); err != nil {
+			t.Skipf("sqlite built without math functions (use -tags sqlite_math_functions): %v", err)
+		}
+		// Tower Bridge is about 3.7 km from Trafalgar Square.
+		if got, want := geoNames(t, dao, "geo=near.(51.5080,-0.1281,1000)"), []string{"Trafalgar Square"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("indexed=%v: got %v, want %v", indexed, got, want)
+		}
+		if got, want := geoNames(t, dao, "geo=near.(51.5080,-0.1281,5000)"), []string{"Trafalgar Square", "Tower Bridge"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("indexed=%v: got %v, want %v", indexed, got, want)
+		}
+	}
+}
+
+func TestSelectJSON_GeoErrors(t *testing.T) {
+	dao := setupGeoTest(t, false)
+	for name, where := range map[string]map[string]any{
+		"latitude out of range": {geoFilter: map[string]any{OpBBox: []any{-91.0, 0.0, 0.0, 1.0}}},
+		"min above max":         {geoFilter: map[string]any{OpBBox: []any{10.0, 0.0, 0.0, 1.0}}},
+		"negative radius":       {geoFilter: map[string]any{OpNear: []any{0.0, 0.0, -1.0}}},
+		"wrong length":          {geoFilter: map[string]any{OpNear: []any{0.0, 0.0}}},
+		"unknown operator":      {geoFilter: map[string]any{"within": []any{0.0, 0.0, 1.0}}},
+	} {
+		if _, err := dao.SelectJSON(context.Background(), "places", SelectQuery{Where: []map[string]any{where}}, false); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	db := setupTestDB(t, `CREATE TABLE notes (id INTEGER PRIMARY KEY, body TEXT);`)
+	dao = &TenantConnection{Client: db, Schema: loadSchema(t, db)}
+	where := []map[string]any{{geoFilter: map[string]any{OpBBox: []any{0.0, 0.0, 1.0, 1.0}}}}
+	if _, err := dao.SelectJSON(context.Background(), "notes", SelectQuery{Where: where}, false); err == nil {
+		t.Error("expected an error for a table without lat/lng columns")
+	}
+}
@@ -1,12 +1,22 @@
 package data
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
 	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/atombasedev/atombase/config"
 	"github.com/atombasedev/atombase/definitions"
 	"github.com/atombasedev/atombase/tools"
 )
@@ -30,6 +40,33 @@ func (api *API) RegisterRoutes(app *http.ServeMux) {
 	// Data API routes
 	app.HandleFunc("POST /data/query/{table}", api.handleQueryRows())
 	app.HandleFunc("POST /data/batch", api.handleBatch())
+	app.HandleFunc("POST /data/dedupe/{table}", api.handleDedupe())
+	app.HandleFunc("POST /data/exports/{table}", api.handleCreateExport())
+	app.HandleFunc("GET /data/exports/{id}", api.handleGetExport())
+	app.HandleFunc("GET /data/events/{table}", api.handleEvents())
+	app.HandleFunc("GET /data/presence/{channel}", api.handlePresence())
+	app.HandleFunc("POST /data/presence/{channel}", api.handleUpdatePresence())
+	app.HandleFunc("GET /data/broadcast/{channel}", api.handleSubscribeBroadcast())
+	app.HandleFunc("POST /data/broadcast/{channel}", api.handlePublishBroadcast())
+	app.HandleFunc("GET /data/sync/{table}", api.handlePullChanges())
+	app.HandleFunc("POST /data/sync/{table}", api.handlePushChanges())
+	app.HandleFunc("GET /data/search", api.handleSearch())
+	app.HandleFunc("GET /data/timeseries/{table}", api.handleListPartitions())
+	app.HandleFunc("POST /data/timeseries/{table}/rollover", api.handleRolloverTimeSeries())
+	app.HandleFunc("POST /data/timeseries/{table}/archive", api.handleArchivePartition())
+	app.HandleFunc("POST /data/timeseries/{table}/rollups", api.handleRefreshRollups())
+	app.HandleFunc("GET /data/queries", api.handleListSavedQueries())
+	app.HandleFunc("POST /data/queries", api.handleSaveQuery())
+	app.HandleFunc("GET /data/queries/{name}", api.handleGetSavedQuery())
+	app.HandleFunc("DELETE /data/queries/{name}", api.handleDeleteSavedQuery())
+	app.HandleFunc("POST /data/queries/{name}/run", api.handleRunSavedQuery())
+	app.HandleFunc("GET /data/reports", api.handleListReports())
+	app.HandleFunc("POST /data/reports", api.handleCreateReport())
+	app.HandleFunc("DELETE /data/reports/{id}", api.handleDeleteReport())
+	app.HandleFunc("POST /data/rpc/{name}", api.handleCallFunction())
+	app.HandleFunc("GET /data/openapi.json", api.handleOpenAPI())
+	app.HandleFunc("GET /data/{table}/{pk}/{column}/blob", api.handleGetBlob())
+	app.HandleFunc("PUT /data/{table}/{pk}/{column}/blob", api.handlePutBlob())
 }
 
 // withDB wraps handlers that operate on external tenant databases.
@@ -44,23 +81,35 @@ func (api *API) withDB(handler DbHandler) http.HandlerFunc {
 			tools.RespErr(wr, err)
 			return
 		}
-		// Only close external (non-pooled) connections
+		// Only close external (non-pooled) connections. The client may be
+		// replaced by useQueryOnly, so it is looked up when closing.
 		if isExternal {
-			defer dao.Client.Close()
+			defer func() { dao.Close() }()
 		}
 
 		if err := MigrateIfNeeded(ctx, &dao); err != nil {
 			respondMigrationFailed(wr, err)
 			return
 		}
+		if err := dao.useQueryOnly(); err != nil {
+			tools.RespErr(wr, err)
+			return
+		}
 
+		ctx, done := tools.TrackQuery(ctx, dao.ID, req.URL.Path)
+		defer done()
 		data, err := handler(ctx, &dao, req)
 		if err != nil {
-			tools.RespErr(wr, err)
+			if cause := context.Cause(ctx); errors.Is(cause, tools.ErrQueryInterrupted) {
+				err = cause
+			}
+			operation, _, _ := parsePreferHeaders(req)
+			tools.RespErr(wr, dao.describeConstraint(ctx, dao.Client, err, req.PathValue("table"), operation))
 			return
 		}
 
 		if data != nil {
+			dao.setFullScanHeader(wr)
 			tools.RespondJSON(wr, http.StatusOK, data)
 			return
 		}
@@ -79,30 +128,43 @@ func (api *API) withDBResponse(handler DbResponseHandler) http.HandlerFunc {
 			tools.RespErr(wr, err)
 			return
 		}
-		// Only close external (non-pooled) connections
+		// Only close external (non-pooled) connections. The client may be
+		// replaced by useQueryOnly, so it is looked up when closing.
 		if isExternal {
-			defer dao.Client.Close()
+			defer func() { dao.Close() }()
 		}
 
 		if err := MigrateIfNeeded(ctx, &dao); err != nil {
 			respondMigrationFailed(wr, err)
 			return
 		}
+		if err := dao.useQueryOnly(); err != nil {
+			tools.RespErr(wr, err)
+			return
+		}
 
+		ctx, done := tools.TrackQuery(ctx, dao.ID, req.URL.Path)
+		defer done()
 		data, err := handler(ctx, &dao, req, wr)
 		if err != nil {
-			tools.RespErr(wr, err)
+			if cause := context.Cause(ctx); errors.Is(cause, tools.ErrQueryInterrupted) {
+				err = cause
+			}
+			operation, _, _ := parsePreferHeaders(req)
+			tools.RespErr(wr, dao.describeConstraint(ctx, dao.Client, err, req.PathValue("table"), operation))
 			return
 		}
 
 		if data != nil {
+			dao.setFullScanHeader(wr)
 			tools.RespondJSON(wr, http.StatusOK, data)
 			return
 		}
 	}
 }
 
-// connDb returns an external tenant database connection for the Database header value.
+// connDb returns an external tenant database connection for the request's
+// Database header, tenant header or tenant subdomain.
 // The internal primary metadata database is never queryable through Data API routes.
 // Returns the connection and a boolean indicating if it should be closed after use.
 func (api *API) connDb(req *http.Request) (TenantConnection, bool, error) {
@@ -111,8 +173,11 @@ func (api *API) connDb(req *http.Request) (TenantConnection, bool, error) {
 		return TenantConnection{}, false, err
 	}
 
-	dbHeader := req.Header.Get("Database")
-	target, err := api.definitions.ResolveTarget(req.Context(), principal, dbHeader)
+	route, err := tools.DatabaseRoute(req)
+	if err != nil {
+		return TenantConnection{}, false, err
+	}
+	target, err := api.definitions.ResolveTarget(req.Context(), principal, route)
 	if err != nil {
 		return TenantConnection{}, false, err
 	}
@@ -121,6 +186,13 @@ func (api *API) connDb(req *http.Request) (TenantConnection, bool, error) {
 	if err != nil {
 		return TenantConnection{}, false, err
 	}
+	db.CallerKey = callerKey(principal, req)
+	if err := db.takeRequest(time.Now()); err != nil {
+		db.Close()
+		return TenantConnection{}, false, err
+	}
+	db.ReadOnly = readOnlyRequest(req)
+	db.AllowFullScan = req.URL.Query().Get(ParamAllowFullScan) == "true"
 
 	return db, true, nil
 }
@@ -140,12 +212,469 @@ func (api *API) handleBatch() http.HandlerFunc {
 	})
 }
 
-// handleQueryRows handles POST /data/query/{table} for SELECT, INSERT, UPDATE, and DELETE operations.
+// handleDedupe handles POST /data/dedupe/{table}: it lists clusters of likely
+// duplicate rows, or merges the clusters the request names.
+func (api *API) handleDedupe() http.HandlerFunc {
+	return api.withDB(func(ctx context.Context, dao *TenantConnection, req *http.Request) (any, error) {
+		var dedupeReq DedupeRequest
+		if err := tools.DecodeJSON(req.Body, &dedupeReq); err != nil {
+			return nil, err
+		}
+		table := req.PathValue("table")
+		if len(dedupeReq.Merge) > 0 {
+			return dao.MergeDuplicates(ctx, table, dedupeReq.Merge)
+		}
+		return dao.FindDuplicates(ctx, table, dedupeReq)
+	})
+}
+
+// handleSearch handles GET /data/search?q=terms, a full-text search across
+// the database's FTS-enabled tables.
+func (api *API) handleSearch() http.HandlerFunc {
+	return api.withDB(func(ctx context.Context, dao *TenantConnection, req *http.Request) (any, error) {
+		params := req.URL.Query()
+		var tables []string
+		if raw := params.Get("tables"); raw != "" {
+			for _, table := range strings.Split(raw, ",") {
+				if table = strings.TrimSpace(table); table != "" {
+					tables = append(tables, table)
+				}
+			}
+		}
+		limit := 0
+		if raw := params.Get(ParamLimit); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n < 1 {
+				return nil, tools.InvalidRequestErr("limit must be a whole number of at least 1, got " + strconv.Quote(raw))
+			}
+			limit = n
+		}
+		return dao.SearchTables(ctx, params.Get("q"), tables, limit)
+	})
+}
+
+// handleListSavedQueries handles GET /data/queries.
+func (api *API) handleListSavedQueries() http.HandlerFunc {
+	return api.withDB(func(ctx context.Context, dao *TenantConnection, req *http.Request) (any, error) {
+		return dao.ListSavedQueries(ctx)
+	})
+}
+
+// handleSaveQuery handles POST /data/queries, creating or replacing the
+// saved query of the body's name.
+func (api *API) handleSaveQuery() http.HandlerFunc {
+	return api.withDB(func(ctx context.Context, dao *TenantConnection, req *http.Request) (any, error) {
+		var query SavedQuery
+		if err := tools.DecodeJSON(req.Body, &query); err != nil {
+			return nil, err
+		}
+		return dao.SaveQuery(ctx, query)
+	})
+}
+
+// handleGetSavedQuery handles GET /data/queries/{name}.
+func (api *API) handleGetSavedQuery() http.HandlerFunc {
+	return api.withDB(func(ctx context.Context, dao *TenantConnection, req *http.Request) (any, error) {
+		return dao.GetSavedQuery(ctx, req.PathValue("name"))
+	})
+}
+
+// handleDeleteSavedQuery handles DELETE /data/queries/{name}.
+func (api *API) handleDeleteSavedQuery() http.HandlerFunc {
+	return api.withDBResponse(func(ctx context.Context, dao *TenantConnection, req *http.Request, w http.ResponseWriter) (any, error) {
+		if err := dao.DeleteSavedQuery(ctx, req.PathValue("name")); err != nil {
+			return nil, err
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return nil, nil
+	})
+}
+
+// handleRunSavedQuery handles POST /data/queries/{name}/run. The body is
+// optional and answers like a select: a JSON array of rows.
+func (api *API) handleRunSavedQuery() http.HandlerFunc {
+	return api.withDB(func(ctx context.Context, dao *TenantConnection, req *http.Request) (any, error) {
+		var runReq RunSavedQueryRequest
+		if err := tools.DecodeJSON(req.Body, &runReq); err != nil && err != io.EOF {
+			return nil, err
+		}
+		result, err := dao.RunSavedQuery(ctx, req.PathValue("name"), runReq)
+		if err != nil {
+			return nil, err
+		}
+		return json.RawMessage(result.Data), nil
+	})
+}
+
+// handleListReports handles GET /data/reports.
+func (api *API) handleListReports() http.HandlerFunc {
+	return api.withDB(func(ctx context.Context, dao *TenantConnection, req *http.Request) (any, error) {
+		return dao.ListReports(ctx)
+	})
+}
+
+// handleCreateReport handles POST /data/reports, scheduling a saved query.
+func (api *API) handleCreateReport() http.HandlerFunc {
+	return api.withDBResponse(func(ctx context.Context, dao *TenantConnection, req *http.Request, w http.ResponseWriter) (any, error) {
+		var reportReq ReportRequest
+		if err := tools.DecodeJSON(req.Body, &reportReq); err != nil {
+			return nil, err
+		}
+		report, err := dao.CreateReport(ctx, reportReq)
+		if err != nil {
+			return nil, err
+		}
+		tools.RespondJSON(w, http.StatusCreated, report)
+		return nil, nil
+	})
+}
+
+// handleDeleteReport handles DELETE /data/reports/{id}.
+func (api *API) handleDeleteReport() http.HandlerFunc {
+	return api.withDBResponse(func(ctx context.Context, dao *TenantConnection, req *http.Request, w http.ResponseWriter) (any, error) {
+		if err := dao.DeleteReport(ctx, req.PathValue("id")); err != nil {
+			return nil, err
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return nil, nil
+	})
+}
+
+// handleCallFunction handles POST /data/rpc/{name}. The body is an optional
+// object of the function's params.
+func (api *API) handleCallFunction() http.HandlerFunc {
+	return api.withDB(func(ctx context.Context, dao *TenantConnection, req *http.Request) (any, error) {
+		var args map[string]any
+		if err := tools.DecodeJSON(req.Body, &args); err != nil && err != io.EOF {
+			return nil, err
+		}
+		return dao.CallFunction(ctx, req.PathValue("name"), args)
+	})
+}
+
+// handleOpenAPI handles GET /data/openapi.json, an OpenAPI document of the
+// database's tables.
+func (api *API) handleOpenAPI() http.HandlerFunc {
+	return api.withDB(func(ctx context.Context, dao *TenantConnection, req *http.Request) (any, error) {
+		return dao.Schema.OpenAPISpec(dao.SchemaVersion), nil
+	})
+}
+
+// handleGetBlob handles GET /data/{table}/{pk}/{column}/blob, serving the raw
+// bytes with Range and conditional request support. A NULL blob answers 204.
+func (api *API) handleGetBlob() http.HandlerFunc {
+	return api.withDBResponse(func(ctx context.Context, dao *TenantConnection, req *http.Request, wr http.ResponseWriter) (any, error) {
+		content, contentType, err := dao.ReadBlob(ctx, req.PathValue("table"), req.PathValue("column"), req.PathValue("pk"))
+		if err != nil {
+			return nil, err
+		}
+		if content == nil {
+			wr.WriteHeader(http.StatusNoContent)
+			return nil, nil
+		}
+		if contentType == "" {
+			contentType = http.DetectContentType(content)
+		}
+		sum := sha256.Sum256(content)
+		wr.Header().Set("Content-Type", contentType)
+		wr.Header().Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+		// Uploaded bytes are not trusted to run as a page of the API's origin.
+		wr.Header().Set("X-Content-Type-Options", "nosniff")
+		wr.Header().Set("Content-Security-Policy", "sandbox")
+		http.ServeContent(wr, req, "", time.Time{}, bytes.NewReader(content))
+		return nil, nil
+	})
+}
+
+// handlePutBlob handles PUT /data/{table}/{pk}/{column}/blob, storing the raw
+// body. Blobs may be larger than JSON bodies, up to ATOMICBASE_MAX_BLOB_SIZE,
+// so it reads the body itself instead of going through withDB.
+func (api *API) handlePutBlob() http.HandlerFunc {
+	return func(wr http.ResponseWriter, req *http.Request) {
+		defer req.Body.Close()
+		if req.ContentLength > config.Cfg.MaxBlobSize {
+			tools.RespErr(wr, tools.ErrBlobTooLarge)
+			return
+		}
+		content, err := io.ReadAll(http.MaxBytesReader(wr, req.Body, config.Cfg.MaxBlobSize))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				err = tools.ErrBlobTooLarge
+			}
+			tools.RespErr(wr, err)
+			return
+		}
+
+		dao, isExternal, err := api.connDb(req)
+		if err != nil {
+			tools.RespErr(wr, err)
+			return
+		}
+		if isExternal {
+			defer dao.Close()
+		}
+		if err := MigrateIfNeeded(req.Context(), &dao); err != nil {
+			respondMigrationFailed(wr, err)
+			return
+		}
+
+		table := req.PathValue("table")
+		contentType := req.Header.Get("Content-Type")
+		if err := dao.WriteBlob(req.Context(), table, req.PathValue("column"), req.PathValue("pk"), content, contentType); err != nil {
+			tools.RespErr(wr, dao.describeConstraint(req.Context(), dao.Client, err, table, "update"))
+			return
+		}
+		wr.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// handleCreateExport handles POST /data/exports/{table}. The export runs in the
+// background after the response, so it manages its connection itself instead
+// of going through withDB.
+func (api *API) handleCreateExport() http.HandlerFunc {
+	return func(wr http.ResponseWriter, req *http.Request) {
+		tools.LimitBody(wr, req)
+		defer req.Body.Close()
+
+		var exportReq ExportRequest
+		if err := tools.DecodeJSON(req.Body, &exportReq); err != nil {
+			tools.RespErr(wr, err)
+			return
+		}
+		store := exportStore()
+		if store == nil {
+			tools.RespErr(wr, tools.InvalidRequestErr("exports are not configured on this server"))
+			return
+		}
+
+		dao, isExternal, err := api.connDb(req)
+		if err != nil {
+			tools.RespErr(wr, err)
+			return
+		}
+		if err := MigrateIfNeeded(req.Context(), &dao); err != nil {
+			if isExternal {
+				dao.Close()
+			}
+			respondMigrationFailed(wr, err)
+			return
+		}
+
+		job, err := api.startExport(dao, isExternal, req.PathValue("table"), exportReq, store)
+		if err != nil {
+			if isExternal {
+				dao.Close()
+			}
+			tools.RespErr(wr, err)
+			return
+		}
+		tools.RespondJSON(wr, http.StatusAccepted, job)
+	}
+}
+
+// handleGetExport handles GET /data/exports/{id}, returning the job to the
+// caller that started it.
+func (api *API) handleGetExport() http.HandlerFunc {
+	return func(wr http.ResponseWriter, req *http.Request) {
+		principal, err := api.definitions.ResolvePrincipal(req.Context(), tools.GetAuthContext(req.Context()))
+		if err != nil {
+			tools.RespErr(wr, err)
+			return
+		}
+		owner, err := exportOwner(&TenantConnection{Principal: principal})
+		if err != nil {
+			tools.RespErr(wr, err)
+			return
+		}
+		job, err := api.exports.get(req.PathValue("id"), owner)
+		if err != nil {
+			tools.RespErr(wr, err)
+			return
+		}
+		tools.RespondJSON(wr, http.StatusOK, job)
+	}
+}
+
+// handleEvents handles GET /data/events/{table}, streaming the table's row
+// changes as Server-Sent Events. The stream holds its connection until the
+// client leaves, so it does not go through withDB.
+func (api *API) handleEvents() http.HandlerFunc {
+	return func(wr http.ResponseWriter, req *http.Request) {
+		dao, isExternal, err := api.connDb(req)
+		if err != nil {
+			tools.RespErr(wr, err)
+			return
+		}
+		if isExternal {
+			defer dao.Close()
+		}
+		if err := MigrateIfNeeded(req.Context(), &dao); err != nil {
+			respondMigrationFailed(wr, err)
+			return
+		}
+		if err := dao.serveEvents(wr, req, req.PathValue("table")); err != nil {
+			tools.RespErr(wr, err)
+		}
+	}
+}
+
+// handlePresence handles GET /data/presence/{channel}, joining the caller to
+// a presence channel for as long as it reads the stream. Presence lives in
+// server memory, so the database connection is only needed for its settings.
+func (api *API) handlePresence() http.HandlerFunc {
+	return func(wr http.ResponseWriter, req *http.Request) {
+		dao, isExternal, err := api.connDb(req)
+		if err != nil {
+			tools.RespErr(wr, err)
+			return
+		}
+		if isExternal {
+			dao.Close()
+		}
+		if err := api.servePresence(wr, req, &dao, req.PathValue("channel")); err != nil {
+			tools.RespErr(wr, err)
+		}
+	}
+}
+
+// handleUpdatePresence handles POST /data/presence/{channel}, replacing the
+// state of one of the caller's members.
+func (api *API) handleUpdatePresence() http.HandlerFunc {
+	return api.withDB(func(ctx context.Context, dao *TenantConnection, req *http.Request) (any, error) {
+		var update PresenceStateRequest
+		if err := tools.DecodeJSON(req.Body, &update); err != nil {
+			return nil, err
+		}
+		return api.updatePresence(dao, req.PathValue("channel"), update)
+	})
+}
+
+// handleSubscribeBroadcast handles GET /data/broadcast/{channel}, streaming
+// the messages published on a channel while the client reads.
+func (api *API) handleSubscribeBroadcast() http.HandlerFunc {
+	return func(wr http.ResponseWriter, req *http.Request) {
+		dao, isExternal, err := api.connDb(req)
+		if err != nil {
+			tools.RespErr(wr, err)
+			return
+		}
+		if isExternal {
+			dao.Close()
+		}
+		if err := api.serveBroadcast(wr, req, &dao, req.PathValue("channel")); err != nil {
+			tools.RespErr(wr, err)
+		}
+	}
+}
+
+// handlePublishBroadcast handles POST /data/broadcast/{channel}, sending a
+// message to the channel's subscribers.
+func (api *API) handlePublishBroadcast() http.HandlerFunc {
+	return api.withDB(func(ctx context.Context, dao *TenantConnection, req *http.Request) (any, error) {
+		var msg BroadcastRequest
+		if err := tools.DecodeJSON(req.Body, &msg); err != nil {
+			return nil, err
+		}
+		return api.publishBroadcast(dao, req.PathValue("channel"), msg)
+	})
+}
+
+// handlePullChanges handles GET /data/sync/{table}?since=&limit=, returning
+// the table's changes after a client's cursor.
+func (api *API) handlePullChanges() http.HandlerFunc {
+	return api.withDB(func(ctx context.Context, dao *TenantConnection, req *http.Request) (any, error) {
+		params := req.URL.Query()
+		var since int64
+		if raw := params.Get("since"); raw != "" {
+			n, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil || n < 0 {
+				return nil, tools.InvalidRequestErr(fmt.Sprintf("since must be a whole number of at least 0, got %q", raw))
+			}
+			since = n
+		}
+		var limit *int
+		if raw := params.Get("limit"); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n < 1 {
+				return nil, tools.InvalidRequestErr(fmt.Sprintf("limit must be a whole number of at least 1, got %q", raw))
+			}
+			limit = &n
+		}
+		return dao.PullChanges(ctx, req.PathValue("table"), since, limit)
+	})
+}
+
+// handleListPartitions handles GET /data/timeseries/{table}, listing the
+// months a time-series table has partitioned.
+func (api *API) handleListPartitions() http.HandlerFunc {
+	return api.withDB(func(ctx context.Context, dao *TenantConnection, req *http.Request) (any, error) {
+		return dao.ListPartitions(ctx, req.PathValue("table"))
+	})
+}
+
+// handleRolloverTimeSeries handles POST /data/timeseries/{table}/rollover,
+// running the monthly maintenance now rather than on the month's first request.
+func (api *API) handleRolloverTimeSeries() http.HandlerFunc {
+	return api.withDB(func(ctx context.Context, dao *TenantConnection, req *http.Request) (any, error) {
+		table := req.PathValue("table")
+		if err := dao.timeSeriesTable(table); err != nil {
+			return nil, err
+		}
+		if err := dao.RolloverTimeSeries(ctx, time.Now()); err != nil {
+			return nil, err
+		}
+		return dao.ListPartitions(ctx, table)
+	})
+}
+
+// handleArchivePartition handles POST /data/timeseries/{table}/archive?month=YYYY-MM,
+// moving a partition to the export bucket.
+func (api *API) handleArchivePartition() http.HandlerFunc {
+	return api.withDB(func(ctx context.Context, dao *TenantConnection, req *http.Request) (any, error) {
+		table, month := req.PathValue("table"), req.URL.Query().Get("month")
+		if err := dao.timeSeriesTable(table); err != nil {
+			return nil, err
+		}
+		if _, err := time.Parse("2006-01", month); err != nil {
+			return nil, tools.InvalidRequestErr(fmt.Sprintf("month must be YYYY-MM, got %q", month))
+		}
+		return dao.ArchivePartition(ctx, table, month)
+	})
+}
+
+// handleRefreshRollups handles POST /data/timeseries/{table}/rollups,
+// refreshing the table's rollups now, or with ?rebuild=true aggregating them
+// again from scratch.
+func (api *API) handleRefreshRollups() http.HandlerFunc {
+	return api.withDB(func(ctx context.Context, dao *TenantConnection, req *http.Request) (any, error) {
+		table := req.PathValue("table")
+		if err := dao.timeSeriesTable(table); err != nil {
+			return nil, err
+		}
+		return dao.RefreshRollups(ctx, table, time.Now(), req.URL.Query().Get("rebuild") == "true")
+	})
+}
+
+// handlePushChanges handles POST /data/sync/{table}, writing changes a
+// client made offline.
+func (api *API) handlePushChanges() http.HandlerFunc {
+	return api.withDB(func(ctx context.Context, dao *TenantConnection, req *http.Request) (any, error) {
+		var push SyncPushRequest
+		if err := tools.DecodeJSON(req.Body, &push); err != nil {
+			return nil, err
+		}
+		return dao.PushChanges(ctx, req.PathValue("table"), push)
+	})
+}
+
+// handleQueryRows handles POST /data/query/{table} for SELECT, INSERT, UPDATE, DELETE and approximate aggregate operations.
 func (api *API) handleQueryRows() http.HandlerFunc {
 	return api.withDBResponse(func(ctx context.Context, dao *TenantConnection, req *http.Request, w http.ResponseWriter) (any, error) {
 		table := req.PathValue("table")
 
-		operation, onConflict, countExact := parsePreferHeaders(req)
+		operation, onConflict, _ := parsePreferHeaders(req)
+		representation := preferRepresentation(req)
 
 		switch operation {
 		case "select":
@@ -154,12 +683,108 @@ func (api *API) handleQueryRows() http.HandlerFunc {
 				if err := tools.DecodeJSON(req.Body, &query); err != nil {
 					return nil, err
 				}
+				// A time-series table's rollups are selected in its place,
+				// under its select policy.
+				policyTable := table
+				if resolution := req.URL.Query().Get(ParamResolution); resolution != "" {
+					var err error
+					if table, err = dao.Schema.rollupTable(table, resolution); err != nil {
+						return nil, err
+					}
+				}
+				filters, err := requestFilters(req, dao.Schema, table)
+				if err != nil {
+					return nil, err
+				}
+				query.Where = append(query.Where, filters...)
+				if param := req.URL.Query().Get(ParamComputed); param != "" {
+					computed, err := parseComputedParam(param)
+					if err != nil {
+						return nil, err
+					}
+					if query.Computed == nil {
+						query.Computed = computed
+					} else {
+						maps.Copy(query.Computed, computed)
+					}
+				}
+				if query.Search == nil {
+					if query.Search, err = parseSearchParams(req.URL.Query()); err != nil {
+						return nil, err
+					}
+				}
+				if query.Lang == "" {
+					query.Lang = requestLanguage(req)
+				}
+				if dao.Schema.Settings != nil && len(dao.Schema.Settings.Localized[table]) > 0 {
+					w.Header().Add("Vary", "Accept-Language")
+				}
+				if cursor, ok := req.URL.Query()[ParamCursor]; ok && query.Cursor == nil {
+					query.Cursor = &cursor[0]
+				}
+				page, paged, err := parsePageParams(req.URL.Query(), dao.Schema)
+				if err != nil {
+					return nil, err
+				}
+				if paged {
+					if err := page.apply(&query); err != nil {
+						return nil, err
+					}
+				}
+				if query.Limit == nil && query.Offset == nil && query.Cursor == nil {
+					query.Offset, query.Limit = parseRangeHeader(req)
+				}
+				csvOut, nested := wantsCSV(req), ""
+				if csvOut {
+					if nested, err = csvNested(req); err != nil {
+						return nil, err
+					}
+				}
 				if _, err := api.definitions.CompilePolicy(ctx, dao.Principal, definitions.DatabaseTarget{
 					DatabaseID:        dao.ID,
 					DefinitionID:      dao.DefinitionID,
 					DefinitionType:    dao.DefinitionType,
 					DefinitionVersion: dao.DatabaseVersion,
-				}, table, "select", nil); err != nil {
+				}, policyTable, "select", nil); err != nil {
+					return nil, err
+				}
+
+				// A planned count is the table's size from sqlite_stat1; without
+				// statistics it falls back to an exact count.
+				countMode := preferCount(req)
+				planned, hasPlanned := int64(0), false
+				if countMode == CountPlanned {
+					planned, hasPlanned = dao.plannedCount(ctx, table)
+				}
+				countExact := countMode == CountExact || (countMode == CountPlanned && !hasPlanned)
+				// A page needs a total for its last link.
+				if paged && !hasPlanned {
+					countExact = true
+				}
+
+				// Streamed rows are never held in memory together, so there is
+				// no Content-Range: the row count is only known at the end.
+				if !csvOut && wantsNDJSON(req) {
+					var out *flushWriter
+					_, err := dao.SelectNDJSON(ctx, table, query, countExact, func(count int64) io.Writer {
+						if countExact {
+							w.Header().Set("X-Total-Count", strconv.FormatInt(count, 10))
+						} else if hasPlanned {
+							count = planned
+							w.Header().Set("X-Total-Count", strconv.FormatInt(planned, 10))
+						}
+						if paged {
+							w.Header().Set("Link", page.links(req, count))
+						}
+						dao.setFullScanHeader(w)
+						w.Header().Set("Content-Type", "application/x-ndjson")
+						w.WriteHeader(http.StatusOK)
+						out = newFlushWriter(w)
+						return out
+					})
+					if out != nil {
+						out.Flush()
+					}
 					return nil, err
 				}
 
@@ -168,16 +793,69 @@ func (api *API) handleQueryRows() http.HandlerFunc {
 					return nil, err
 				}
 
+				total := "*"
 				if countExact {
-					w.Header().Set("X-Total-Count", strconv.FormatInt(result.Count, 10))
+					total = strconv.FormatInt(result.Count, 10)
+				} else if hasPlanned {
+					total = strconv.FormatInt(planned, 10)
+				}
+				if total != "*" {
+					w.Header().Set("X-Total-Count", total)
+				}
+				if query.Cursor == nil {
+					w.Header().Set("Content-Range", contentRange(query.Offset, result.Rows, total))
+				}
+				pageTotal := result.Count
+				if !countExact {
+					pageTotal = planned
+				}
+				if paged {
+					w.Header().Set("Link", page.links(req, pageTotal))
+				}
+
+				if csvOut {
+					if result.NextCursor != "" {
+						w.Header().Set("X-Next-Cursor", result.NextCursor)
+					}
+					w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+					w.Header().Set("Content-Disposition", "attachment; filename="+strconv.Quote(table+".csv"))
+					dao.setFullScanHeader(w)
+					return nil, writeCSV(w, result.Data, nested)
 				}
 
 				var payload any
 				if err := decodeJSONPayload(result.Data, &payload); err != nil {
 					return nil, err
 				}
+				if query.Cursor != nil {
+					return cursorPage(w, payload, result.NextCursor), nil
+				}
+				if paged {
+					return page.envelope(payload, pageTotal), nil
+				}
 				return payload, nil
 			}
+		case "aggregate":
+			{
+				var query AggregateQuery
+				if err := tools.DecodeJSON(req.Body, &query); err != nil {
+					return nil, err
+				}
+				filters, err := requestFilters(req, dao.Schema, table)
+				if err != nil {
+					return nil, err
+				}
+				query.Where = append(query.Where, filters...)
+				if _, err := api.definitions.CompilePolicy(ctx, dao.Principal, definitions.DatabaseTarget{
+					DatabaseID:        dao.ID,
+					DefinitionID:      dao.DefinitionID,
+					DefinitionType:    dao.DefinitionType,
+					DefinitionVersion: dao.DatabaseVersion,
+				}, table, "select", nil); err != nil {
+					return nil, err
+				}
+				return dao.AggregateJSON(ctx, table, query)
+			}
 		case "insert":
 			{
 				if onConflict == "" {
@@ -185,6 +863,9 @@ func (api *API) handleQueryRows() http.HandlerFunc {
 					if err := tools.DecodeJSON(req.Body, &insertReq); err != nil {
 						return nil, err
 					}
+					if representation && len(insertReq.Returning) == 0 {
+						insertReq.Returning = []string{"*"}
+					}
 					if len(insertReq.Data) > 0 {
 						if _, err := api.definitions.CompilePolicy(ctx, dao.Principal, definitions.DatabaseTarget{
 							DatabaseID:        dao.ID,
@@ -197,11 +878,21 @@ func (api *API) handleQueryRows() http.HandlerFunc {
 					}
 					return decodeResultPayload(dao.InsertJSON(ctx, table, insertReq))
 				}
-				if onConflict == "replace" {
+				// An explicit conflict target turns ignore into ON CONFLICT DO NOTHING,
+				// which unlike INSERT OR IGNORE still fails on other constraints.
+				target := conflictColumns(req)
+				if onConflict == "replace" || (onConflict == "ignore" && len(target) > 0) {
 					var upsertReq UpsertRequest
 					if err := tools.DecodeJSON(req.Body, &upsertReq); err != nil {
 						return nil, err
 					}
+					if len(target) > 0 {
+						upsertReq.OnConflict = target
+					}
+					upsertReq.IgnoreDuplicates = onConflict == "ignore"
+					if representation && len(upsertReq.Returning) == 0 {
+						upsertReq.Returning = []string{"*"}
+					}
 					if len(upsertReq.Data) > 0 {
 						if _, err := api.definitions.CompilePolicy(ctx, dao.Principal, definitions.DatabaseTarget{
 							DatabaseID:        dao.ID,
@@ -219,6 +910,9 @@ func (api *API) handleQueryRows() http.HandlerFunc {
 					if err := tools.DecodeJSON(req.Body, &ignoreReq); err != nil {
 						return nil, err
 					}
+					if representation && len(ignoreReq.Returning) == 0 {
+						ignoreReq.Returning = []string{"*"}
+					}
 					if len(ignoreReq.Data) > 0 {
 						if _, err := api.definitions.CompilePolicy(ctx, dao.Principal, definitions.DatabaseTarget{
 							DatabaseID:        dao.ID,
@@ -239,6 +933,14 @@ func (api *API) handleQueryRows() http.HandlerFunc {
 				if err := tools.DecodeJSON(req.Body, &updateReq); err != nil {
 					return nil, err
 				}
+				if representation && len(updateReq.Returning) == 0 {
+					updateReq.Returning = []string{"*"}
+				}
+				filters, err := requestFilters(req, dao.Schema, table)
+				if err != nil {
+					return nil, err
+				}
+				updateReq.Where = append(updateReq.Where, filters...)
 				if _, err := api.definitions.CompilePolicy(ctx, dao.Principal, definitions.DatabaseTarget{
 					DatabaseID:        dao.ID,
 					DefinitionID:      dao.DefinitionID,
@@ -255,6 +957,14 @@ func (api *API) handleQueryRows() http.HandlerFunc {
 				if err := tools.DecodeJSON(req.Body, &deleteReq); err != nil {
 					return nil, err
 				}
+				if representation && len(deleteReq.Returning) == 0 {
+					deleteReq.Returning = []string{"*"}
+				}
+				filters, err := requestFilters(req, dao.Schema, table)
+				if err != nil {
+					return nil, err
+				}
+				deleteReq.Where = append(deleteReq.Where, filters...)
 				if _, err := api.definitions.CompilePolicy(ctx, dao.Principal, definitions.DatabaseTarget{
 					DatabaseID:        dao.ID,
 					DefinitionID:      dao.DefinitionID,
@@ -271,6 +981,17 @@ func (api *API) handleQueryRows() http.HandlerFunc {
 	})
 }
 
+// cursorPage wraps a cursor select's rows with the cursor of the next page,
+// which is also sent as X-Next-Cursor. The cursor is null on the last page.
+func cursorPage(w http.ResponseWriter, rows any, next string) map[string]any {
+	page := map[string]any{"data": rows, "nextCursor": nil}
+	if next != "" {
+		w.Header().Set("X-Next-Cursor", next)
+		page["nextCursor"] = next
+	}
+	return page
+}
+
 func decodeResultPayload(data []byte, err error) (any, error) {
 	if err != nil {
 		return nil, err
@@ -311,7 +1032,13 @@ func handleSwaggerUI() http.HandlerFunc {
       url: '/openapi.yaml',
       dom_id: '#swagger-ui',
       presets: [SwaggerUIBundle.presets.apis, SwaggerUIBundle.SwaggerUIStandalonePreset],
-      layout: 'BaseLayout'
+      layout: 'BaseLayout',
+      // With an admin session cookie, changes must echo its CSRF token.
+      requestInterceptor: (req) => {
+        const csrf = document.cookie.split('; ').find((c) => c.startsWith('atombase_csrf='));
+        if (csrf) req.headers['X-CSRF-Token'] = decodeURIComponent(csrf.split('=')[1]);
+        return req;
+      }
     });
   </script>
 </body>
@@ -332,14 +1059,115 @@ func parsePreferHeaders(req *http.Request) (operation string, onConflict string,
 			onConflict, _ = strings.CutPrefix(normalized, "on-conflict=")
 			continue
 		}
-		if normalized == "count=exact" {
+		switch normalized {
+		case PreferResolutionMerge:
+			onConflict = "replace"
+		case PreferResolutionIgnore:
+			onConflict = "ignore"
+		case PreferCountExact:
 			countExact = true
 		}
 	}
+	// A resolution alone, as sync clients send it, means an insert.
+	if operation == "" && onConflict != "" {
+		operation = "insert"
+	}
 
 	return operation, onConflict, countExact
 }
 
+// conflictColumns returns the ?on_conflict= columns of an upsert, which may
+// be comma separated or repeated.
+func conflictColumns(req *http.Request) []string {
+	var columns []string
+	for _, value := range req.URL.Query()["on_conflict"] {
+		for _, col := range strings.Split(value, ",") {
+			if col = strings.TrimSpace(col); col != "" {
+				columns = append(columns, col)
+			}
+		}
+	}
+	return columns
+}
+
+// preferCount returns the count= preference: exact, planned, none, or "" when
+// absent.
+func preferCount(req *http.Request) string {
+	for _, v := range tools.ParseHeaderCommas(req.Header.Values("Prefer")) {
+		normalized := strings.ToLower(strings.ReplaceAll(v, " ", ""))
+		if mode, ok := strings.CutPrefix(normalized, "count="); ok {
+			switch mode {
+			case CountExact, CountPlanned, CountNone:
+				return mode
+			}
+		}
+	}
+	return ""
+}
+
+// parseRangeHeader reads a PostgREST-style Range: first-last header (items,
+// zero-based, inclusive; last may be omitted) as an offset and limit. Malformed
+// ranges are ignored, as PostgREST does.
+func parseRangeHeader(req *http.Request) (offset, limit *int) {
+	header := strings.TrimSpace(req.Header.Get("Range"))
+	header = strings.TrimPrefix(header, "items=")
+	first, last, ok := strings.Cut(header, "-")
+	if !ok {
+		return nil, nil
+	}
+	from, err := strconv.Atoi(first)
+	if err != nil || from < 0 {
+		return nil, nil
+	}
+	if last == "" {
+		return &from, nil
+	}
+	to, err := strconv.Atoi(last)
+	if err != nil || to < from {
+		return nil, nil
+	}
+	n := to - from + 1
+	return &from, &n
+}
+
+// contentRange formats Content-Range for a page of rows starting at offset:
+// "0-24/3573", "*/3573" for an empty page, or a total of "*" when not counted.
+func contentRange(offset *int, rows int64, total string) string {
+	if rows == 0 {
+		return "*/" + total
+	}
+	start := int64(0)
+	if offset != nil && *offset > 0 {
+		start = int64(*offset)
+	}
+	return strconv.FormatInt(start, 10) + "-" + strconv.FormatInt(start+rows-1, 10) + "/" + total
+}
+
+// preferRepresentation reports whether the request asked for the written rows
+// back with Prefer: return=representation.
+// readOnlyRequest reports whether a request may only read: every GET, and
+// any request sent with Prefer: tx=read-only.
+func readOnlyRequest(req *http.Request) bool {
+	if req.Method == http.MethodGet {
+		return true
+	}
+	for _, v := range tools.ParseHeaderCommas(req.Header.Values("Prefer")) {
+		if strings.ToLower(strings.ReplaceAll(v, " ", "")) == PreferTxReadOnly {
+			return true
+		}
+	}
+	return false
+}
+
+func preferRepresentation(req *http.Request) bool {
+	for _, v := range tools.ParseHeaderCommas(req.Header.Values("Prefer")) {
+		if strings.ToLower(strings.ReplaceAll(v, " ", "")) == "return=representation" {
+			return true
+		}
+	}
+	return false
+}
+
 func respondMigrationFailed(w http.ResponseWriter, err error) {
 	tools.RespondJSON(w, http.StatusServiceUnavailable, tools.APIError{
 		Code:    "MIGRATION_FAILED",
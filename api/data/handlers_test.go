@@ -38,6 +38,18 @@ func TestParsePreferHeaders(t *testing.T) {
 			wantOperation:  "delete",
 			wantCountExact: true,
 		},
+		{
+			name:           "resolution implies insert",
+			headers:        []string{"resolution=merge-duplicates"},
+			wantOperation:  "insert",
+			wantOnConflict: "replace",
+		},
+		{
+			name:           "ignore duplicates",
+			headers:        []string{"operation=insert, resolution=ignore-duplicates"},
+			wantOperation:  "insert",
+			wantOnConflict: "ignore",
+		},
 		{
 			name:    "missing headers",
 			headers: nil,
@@ -64,3 +76,64 @@ func TestParsePreferHeaders(t *testing.T) {
 		})
 	}
 }
+
+func TestPreferRepresentation(t *testing.T) {
+	for header, want := range map[string]bool{
+		"operation=insert, return=representation": true,
+		"Return = Representation":                 true,
+		"return=minimal":                          false,
+		"":                                        false,
+	} {
+		req := httptest.NewRequest("POST", "/data/query/users", nil)
+		req.Header.Set("Prefer", header)
+		if got := preferRepresentation(req); got != want {
+			t.Errorf("%q: expected %v, got %v", header, want, got)
+		}
+	}
+}
+
+func TestPreferCount(t *testing.T) {
+	for header, want := range map[string]string{
+		"count=exact":                     CountExact,
+		"operation=select, count=planned": CountPlanned,
+		"COUNT = NONE":                    CountNone,
+		"count=estimated":                 "",
+		"":                                "",
+	} {
+		req := httptest.NewRequest("POST", "/data/query/users", nil)
+		req.Header.Set("Prefer", header)
+		if got := preferCount(req); got != want {
+			t.Errorf("%q: expected %q, got %q", header, want, got)
+		}
+	}
+}
+
+func TestParseRangeHeader(t *testing.T) {
+	tests := []struct {
+		header           string
+		wantOff, wantLim int // -1 when nil
+	}{
+		{"0-24", 0, 25},
+		{"items=10-19", 10, 10},
+		{"100-", 100, -1},
+		{"9-3", -1, -1},
+		{"-5", -1, -1},
+		{"bytes", -1, -1},
+		{"", -1, -1},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", "/data/query/users", nil)
+		req.Header.Set("Range", tt.header)
+		offset, limit := parseRangeHeader(req)
+		gotOff, gotLim := -1, -1
+		if offset != nil {
+			gotOff = *offset
+		}
+		if limit != nil {
+			gotLim = *limit
+		}
+		if gotOff != tt.wantOff || gotLim != tt.wantLim {
+			t.Errorf("%q: got offset %d limit %d, want %d %d", tt.header, gotOff, gotLim, tt.wantOff, tt.wantLim)
+		}
+	}
+}
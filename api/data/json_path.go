@@ -0,0 +1,129 @@
+package data
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/atombasedev/atombase/tools"
+)
+
+// jsonValueType stands in for the column type of a JSON path when URL filter
+// values are converted: JSON numbers compare as numbers, anything else as
+// text.
+const jsonValueType = "JSON"
+
+// jsonPathKeyPattern is what a key of an arrow path may be. Keys are written
+// into the query as part of a JSON path literal, so nothing else is accepted.
+var jsonPathKeyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// jsonPath is a TEXT column holding JSON followed by PostgREST's arrow
+// operators:
+//
+//	data->>name               json_extract([t].[data], '$.name')
+//	data->'address'->>'city'  json_extract([t].[data], '$.address.city')
+//	data->tags->0             json_extract([t].[data], '$.tags[0]'), as JSON
+//
+// -> yields JSON and ->> a plain value when selected; filters always compare
+// the plain value. Keys may be single quoted.
+type jsonPath struct {
+	column string
+	path   string // SQLite JSON path, e.g. $.address.city
+	key    string // Last object key, the name a selected path gets without an alias
+	text   bool   // Ended in ->>
+}
+
+// parseJSONPath parses expr when it has an arrow path and reports whether it
+// had one.
+func parseJSONPath(expr string) (jsonPath, bool, error) {
+	idx := strings.Index(expr, "->")
+	if idx == -1 {
+		return jsonPath{}, false, nil
+	}
+	p := jsonPath{column: expr[:idx], path: "$", key: expr[:idx]}
+	if p.column == "" {
+		return jsonPath{}, true, tools.InvalidRequestErr(fmt.Sprintf("json path %q has no column", expr))
+	}
+	for rest := expr[idx:]; rest != ""; {
+		if p.text {
+			return jsonPath{}, true, tools.InvalidRequestErr(fmt.Sprintf("json path %q: ->> must be the last step", expr))
+		}
+		if after, ok := strings.CutPrefix(rest, "->>"); ok {
+			p.text = true
+			rest = after
+		} else {
+			rest = rest[len("->"):]
+		}
+		key := rest
+		if next := strings.Index(rest, "->"); next != -1 {
+			key, rest = rest[:next], rest[next:]
+		} else {
+			rest = ""
+		}
+		if len(key) >= 2 && key[0] == '\'' && key[len(key)-1] == '\'' {
+			key = key[1 : len(key)-1]
+		}
+		switch {
+		case isArrayIndex(key):
+			p.path += "[" + key + "]"
+		case jsonPathKeyPattern.MatchString(key):
+			p.path += "." + key
+			p.key = key
+		default:
+			return jsonPath{}, true, tools.InvalidRequestErr(fmt.Sprintf("json path %q: key %q must be an identifier or an array index", expr, key))
+		}
+	}
+	return p, true, nil
+}
+
+func isArrayIndex(key string) bool {
+	if key == "" || len(key) > 9 {
+		return false
+	}
+	_, err := strconv.ParseUint(key, 10, 32)
+	return err == nil
+}
+
+// jsonPathColumn parses a select item or filter column with an arrow path
+// and checks its column against the table. Only TEXT and untyped columns
+// hold JSON.
+func (table CacheTable) jsonPathColumn(expr string) (jsonPath, bool, error) {
+	p, ok, err := parseJSONPath(expr)
+	if !ok || err != nil {
+		return p, ok, err
+	}
+	colType, err := table.SearchCols(p.column)
+	if err != nil {
+		return jsonPath{}, true, err
+	}
+	if colType != "" && !strings.EqualFold(colType, ColTypeText) {
+		return jsonPath{}, true, tools.InvalidRequestErr(fmt.Sprintf("json path on %s column %s: only TEXT columns hold JSON", strings.ToUpper(colType), p.column))
+	}
+	return p, true, nil
+}
+
+// valueSQL extracts the plain value. Rows whose column is not valid JSON give
+// NULL instead of failing the query.
+func (p jsonPath) valueSQL(tableName string) string {
+	col := fmt.Sprintf("[%s].[%s]", tableName, p.column)
+	return fmt.Sprintf("CASE WHEN json_valid(%s) THEN json_extract(%s, '%s') END", col, col, p.path)
+}
+
+// selectSQL is the selected expression: the plain value for ->>, and JSON
+// text for ->, which the JSON aggregation nests with json().
+func (p jsonPath) selectSQL(tableName string) string {
+	if p.text {
+		return p.valueSQL(tableName)
+	}
+	col := fmt.Sprintf("[%s].[%s]", tableName, p.column)
+	return fmt.Sprintf("CASE WHEN json_valid(%s) THEN json_quote(json_extract(%s, '%s')) END", col, col, p.path)
+}
+
+// aggregated is how the JSON aggregation reads the selected path back.
+func (p jsonPath) aggregated(ref string) string {
+	if p.text {
+		return ref
+	}
+	return "json(" + ref + ")"
+}
@@ -0,0 +1,91 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestParseJSONPath(t *testing.T) {
+	tests := []struct {
+		expr string
+		want jsonPath
+	}{
+		{"data->>name", jsonPath{column: "data", path: "$.name", key: "name", text: true}},
+		{"data->'address'->>'city'", jsonPath{column: "data", path: "$.address.city", key: "city", text: true}},
+		{"data->tags->0", jsonPath{column: "data", path: "$.tags[0]", key: "tags"}},
+	}
+	for _, tt := range tests {
+		got, ok, err := parseJSONPath(tt.expr)
+		if !ok || err != nil || got != tt.want {
+			t.Errorf("%s: got %+v %v %v, want %+v", tt.expr, got, ok, err, tt.want)
+		}
+	}
+	if _, ok, _ := parseJSONPath("name"); ok {
+		t.Error("expected a plain column not to be a path")
+	}
+	for _, expr := range []string{"->>name", "data->>a->b", "data->", "data->'a b'", "data->a')--", "data->$.x"} {
+		if _, ok, err := parseJSONPath(expr); !ok || err == nil {
+			t.Errorf("%s: expected an error", expr)
+		}
+	}
+}
+
+func TestSelectJSON_JSONPath(t *testing.T) {
+	db := setupTestDB(t, `CREATE TABLE profiles (id INTEGER PRIMARY KEY, data TEXT, age INTEGER);`)
+	if _, err := db.Exec(`INSERT INTO profiles (id, data, age) VALUES
+		(1, '{"name": "Ada", "age": 36, "address": {"city": "London"}, "tags": ["math"]}', 1),
+		(2, '{"name": "Alan", "age": 19}', 2),
+		(3, 'not json', 3)`); err != nil {
+		t.Fatal(err)
+	}
+	dao := &TenantConnection{Client: db, Schema: loadSchema(t, db)}
+	ctx := context.Background()
+
+	params, err := url.ParseQuery("data->age=gt.21")
+	if err != nil {
+		t.Fatal(err)
+	}
+	where, err := parseFilterParams(params, dao.Schema.Tables["profiles"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := dao.SelectJSON(ctx, "profiles", SelectQuery{
+		Select: []any{"id", "data->>'name'", map[string]any{"town": "data->address->>city"}, "data->address", map[string]any{"first_tag": "data->tags->0"}},
+		Where:  where,
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rows []map[string]any
+	if err := json.Unmarshal(result.Data, &rows); err != nil {
+		t.Fatal(err)
+	}
+	want := []map[string]any{{"id": float64(1), "name": "Ada", "town": "London", "address": map[string]any{"city": "London"}, "first_tag": "math"}}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("got %v, want %v", rows, want)
+	}
+
+	result, err = dao.SelectJSON(ctx, "profiles", SelectQuery{
+		Select: []any{"id"},
+		Where:  []map[string]any{{"data->>name": map[string]any{"not": map[string]any{"like": "A%"}}}},
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(result.Data) != "[]" {
+		t.Errorf("expected rows without valid JSON not to match, got %s", result.Data)
+	}
+
+	for name, query := range map[string]SelectQuery{
+		"integer column": {Select: []any{"age->>x"}},
+		"unknown column": {Select: []any{"nope->>x"}},
+		"quoted key":     {Where: []map[string]any{{"data->>'x''": map[string]any{"eq": 1}}}},
+	} {
+		if _, err := dao.SelectJSON(ctx, "profiles", query, false); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package data
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/atombasedev/atombase/tools"
+)
+
+// requestLanguage returns the languages a select asks for: ?lang= if set,
+// otherwise the Accept-Language header.
+func requestLanguage(req *http.Request) string {
+	if lang := req.URL.Query().Get(ParamLang); lang != "" {
+		return lang
+	}
+	return req.Header.Get("Accept-Language")
+}
+
+// parseLanguages returns the tags in a lang value or Accept-Language header,
+// most preferred first, each followed by its base language (de-at, de).
+// Tags are lowercased; *, q=0 and malformed entries are dropped.
+func parseLanguages(value string) []string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+	var tags []weighted
+	for _, part := range strings.Split(value, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tools.ValidateLanguageTag(tag) != nil {
+			continue
+		}
+		q := 1.0
+		if name, raw, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(name) == "q" {
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if q > 0 {
+			tags = append(tags, weighted{tag, q})
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].q > tags[j].q })
+
+	var langs []string
+	seen := map[string]bool{}
+	add := func(tag string) {
+		if !seen[tag] {
+			seen[tag] = true
+			langs = append(langs, tag)
+		}
+	}
+	for _, t := range tags {
+		add(t.tag)
+		if base, _, ok := strings.Cut(t.tag, "-"); ok {
+			add(base)
+		}
+	}
+	return langs
+}
+
+// localizeSelect swaps the localized fields a select names, or all of them
+// when it selects every column, for SQL that returns the first translation
+// available in the requested languages, falling back to the definition's
+// default language.
+func (schema SchemaCache) localizeSelect(rel *Relation, table CacheTable, lang string) error {
+	if schema.Settings == nil || len(schema.Settings.Localized[table.Name]) == 0 {
+		return nil
+	}
+	fields := schema.Settings.Localized[table.Name]
+	langs := parseLanguages(lang)
+	langs = append(langs, parseLanguages(schema.Settings.DefaultLanguage)...)
+
+	all := rel.columns == nil && rel.joins == nil
+	var kept []column
+	var localized []computedColumn
+	added := map[string]bool{}
+	for _, col := range rel.columns {
+		field, ok := fields[col.name]
+		if _, real := table.Columns[col.name]; !ok || real {
+			all = all || col.name == "*"
+			kept = append(kept, col)
+			continue
+		}
+		name := col.name
+		if col.alias != "" {
+			name = col.alias
+		}
+		localized = append(localized, computedColumn{name: name, sql: localizedSQL(table.Name, field, langs)})
+		added[col.name] = true
+	}
+	if all {
+		names := make([]string, 0, len(fields))
+		for name := range fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if !added[name] {
+				localized = append(localized, computedColumn{name: name, sql: localizedSQL(table.Name, fields[name], langs)})
+			}
+		}
+	}
+	if len(localized) == 0 {
+		return nil
+	}
+
+	for _, loc := range localized {
+		for _, col := range rel.computed {
+			if col.name == loc.name {
+				return tools.InvalidRequestErr(fmt.Sprintf("computed field %q conflicts with a localized field", col.name))
+			}
+		}
+	}
+	// An empty, non-nil column list keeps buildSelect from selecting every column.
+	if rel.columns != nil && kept == nil {
+		kept = []column{}
+	}
+	rel.columns = kept
+	rel.computed = append(localized, rel.computed...)
+	return nil
+}
+
+// localizedSQL coalesces a field's translations in language order. Language
+// tags are validated, so they are safe inside a JSON path.
+func localizedSQL(tableName string, field LocalizedField, langs []string) string {
+	var values []string
+	seen := map[string]bool{}
+	for _, lang := range langs {
+		if field.JSONColumn != "" {
+			if !seen[lang] {
+				seen[lang] = true
+				values = append(values, fmt.Sprintf(`json_extract([%s].[%s], '$."%s"')`, tableName, field.JSONColumn, lang))
+			}
+			continue
+		}
+		for tag, col := range field.Columns {
+			if strings.EqualFold(tag, lang) && !seen[col] {
+				seen[col] = true
+				values = append(values, fmt.Sprintf("[%s].[%s]", tableName, col))
+			}
+		}
+	}
+	switch len(values) {
+	case 0:
+		return "NULL"
+	case 1:
+		return values[0]
+	}
+	return "coalesce(" + strings.Join(values, ", ") + ")"
+}
@@ -0,0 +1,86 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"testing"
+)
+
+const schemaArticles = `
+CREATE TABLE articles (
+	id INTEGER PRIMARY KEY,
+	title_en TEXT,
+	title_de TEXT,
+	body TEXT
+);
+`
+
+func TestParseLanguages(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []string
+	}{
+		{"", nil},
+		{"de", []string{"de"}},
+		{"de-AT, en;q=0.5, fr;q=0.8", []string{"de-at", "de", "fr", "en"}},
+		{"*, en;q=0, it", []string{"it"}},
+		{"en_US, es-419", []string{"es-419", "es"}},
+	}
+	for _, tt := range tests {
+		if got := parseLanguages(tt.value); !slices.Equal(got, tt.want) {
+			t.Errorf("%q: got %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestSelectJSON_Localized(t *testing.T) {
+	db := setupTestDB(t, schemaArticles)
+	if _, err := db.Exec(`INSERT INTO articles (id, title_en, title_de, body) VALUES
+		(1, 'Hello', 'Hallo', '{"en": "Text", "de": "Inhalt"}'),
+		(2, 'Only English', NULL, '{"en": "More"}')`); err != nil {
+		t.Fatal(err)
+	}
+	schema := loadSchema(t, db)
+	schema.Settings = &APISettings{
+		DefaultLanguage: "en",
+		Localized: map[string]LocalizedFields{"articles": {
+			"title":   {Columns: map[string]string{"en": "title_en", "de": "title_de"}},
+			"content": {JSONColumn: "body"},
+		}},
+	}
+	dao := &TenantConnection{Client: db, Schema: schema}
+	ctx := context.Background()
+
+	selectRows := func(query SelectQuery) []map[string]any {
+		t.Helper()
+		query.Order = map[string]string{"id": "asc"}
+		result, err := dao.SelectJSON(ctx, "articles", query, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var rows []map[string]any
+		if err := json.Unmarshal(result.Data, &rows); err != nil {
+			t.Fatal(err)
+		}
+		return rows
+	}
+
+	rows := selectRows(SelectQuery{Lang: "de-CH, en;q=0.5"})
+	if rows[0]["title"] != "Hallo" || rows[0]["content"] != "Inhalt" || rows[1]["title"] != "Only English" || rows[1]["content"] != "More" {
+		t.Errorf("German with English fallback: got %v", rows)
+	}
+	if rows[0]["title_de"] != "Hallo" {
+		t.Errorf("expected every column alongside the localized fields, got %v", rows[0])
+	}
+
+	rows = selectRows(SelectQuery{Select: []any{"id", map[string]any{"heading": "title"}}, Lang: "fr"})
+	if len(rows[0]) != 2 || rows[0]["heading"] != "Hello" {
+		t.Errorf("French falls back to the default: got %v", rows[0])
+	}
+
+	rows = selectRows(SelectQuery{Select: []any{"title"}})
+	if len(rows[0]) != 1 || rows[0]["title"] != "Hello" {
+		t.Errorf("only the localized field: got %v", rows[0])
+	}
+}
@@ -3,22 +3,38 @@ package data
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
+	"reflect"
+	"slices"
 	"strings"
 	"time"
 
+	"github.com/atombasedev/atombase/definitions"
+	"github.com/atombasedev/atombase/primarystore"
 	"github.com/atombasedev/atombase/tools"
 )
 
 var (
 	ErrMigrationFailed      = errors.New("migration failed")
+	ErrMigrationTestFailed  = errors.New("migration test failed")
 	ErrDatabaseVersionAhead = errors.New("database version ahead of definition version")
 	retryBackoff            = []time.Duration{100 * time.Millisecond, 500 * time.Millisecond, 2 * time.Second}
 )
 
+// MigrateIfNeeded brings the database to its definition's version, then runs
+// time-series maintenance when it is due.
 func MigrateIfNeeded(ctx context.Context, dao *TenantConnection) error {
+	if err := migrateIfNeeded(ctx, dao); err != nil {
+		return err
+	}
+	dao.maintainTimeSeries(ctx)
+	return nil
+}
+
+func migrateIfNeeded(ctx context.Context, dao *TenantConnection) error {
 	if dao.DefinitionID == 0 {
 		return nil
 	}
@@ -41,10 +57,25 @@ func MigrateIfNeeded(ctx context.Context, dao *TenantConnection) error {
 		return fmt.Errorf("failed to load migrations: %w", err)
 	}
 
+	// A migration limited to windows waits until one is open for the
+	// database, which is served at its own version meanwhile.
+	deferred, err := dao.deferMigration(ctx, migrations, time.Now())
+	if err != nil || deferred {
+		return err
+	}
+
 	var allSQL []string
 	for _, migration := range migrations {
 		allSQL = append(allSQL, migration.SQL...)
 	}
+	tests, err := dao.primaryStore.GetDefinitionTests(ctx, dao.DefinitionID, dao.SchemaVersion)
+	if err != nil {
+		return fmt.Errorf("failed to load definition tests: %w", err)
+	}
+
+	// Statements that cannot run in a transaction are applied one by one, so a
+	// failure may leave the database part way; those batches are never retried.
+	atomic := tools.TransactionalStatements(allSQL)
 
 	var lastErr error
 	for attempt := 0; attempt < len(retryBackoff); attempt++ {
@@ -53,7 +84,7 @@ func MigrateIfNeeded(ctx context.Context, dao *TenantConnection) error {
 		}
 
 		execCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
-		err = executeMigrationBatch(execCtx, dao.Client, allSQL)
+		err = executeMigrationBatch(execCtx, dao.Client, allSQL, tests, atomic)
 		cancel()
 
 		if err == nil {
@@ -69,24 +100,73 @@ func MigrateIfNeeded(ctx context.Context, dao *TenantConnection) error {
 		}
 
 		lastErr = err
-		if !isRetryableMigrationError(err) {
+		if !atomic || errors.Is(err, ErrMigrationTestFailed) || !isRetryableMigrationError(err) {
 			break
 		}
 	}
 
-	log.Printf("CRITICAL: lazy migration failed database_id=%s definition_id=%d from=%d to=%d err=%v",
-		dao.ID, dao.DefinitionID, dao.DatabaseVersion, dao.SchemaVersion, lastErr)
+	log.Printf("CRITICAL: lazy migration failed database_id=%s definition_id=%d from=%d to=%d atomic=%t err=%v",
+		dao.ID, dao.DefinitionID, dao.DatabaseVersion, dao.SchemaVersion, atomic, lastErr)
 
-	dao.primaryStore.RecordMigrationFailure(ctx, dao.ID, dao.DatabaseVersion, dao.SchemaVersion, lastErr)
+	dao.primaryStore.RecordMigrationFailure(ctx, dao.ID, dao.DatabaseVersion, dao.SchemaVersion, atomic, lastErr)
 
 	return fmt.Errorf("%w: %v", ErrMigrationFailed, lastErr)
 }
 
-func executeMigrationBatch(ctx context.Context, client *sql.DB, statements []string) error {
-	if len(statements) == 0 {
+// deferMigration reports whether any pending migration is outside its
+// windows for the database, and if so switches the connection to the schema
+// of the database's own version. A version whose history was pruned cannot be
+// served, so its database migrates anyway.
+func (dao *TenantConnection) deferMigration(ctx context.Context, migrations []primarystore.DefinitionMigration, now time.Time) (bool, error) {
+	if !slices.ContainsFunc(migrations, func(m primarystore.DefinitionMigration) bool { return len(m.Windows) > 0 }) {
+		return false, nil
+	}
+	schedule, err := dao.primaryStore.GetDatabaseSchedule(ctx, dao.ID)
+	if err != nil {
+		return false, fmt.Errorf("failed to load database schedule: %w", err)
+	}
+	open := true
+	for _, migration := range migrations {
+		if len(migration.Windows) > 0 && !tools.MigrationWindowOpen(migration.Windows, schedule, now) {
+			open = false
+			break
+		}
+	}
+	if open {
+		return false, nil
+	}
+
+	schema, err := loadSchemaVersionFromDB(ctx, dao.primaryStore.DB(), dao.DefinitionID, dao.DatabaseVersion)
+	if errors.Is(err, sql.ErrNoRows) {
+		log.Printf("migration window ignored for database_id=%s: version %d is no longer in the history", dao.ID, dao.DatabaseVersion)
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to load schema version %d: %w", dao.DatabaseVersion, err)
+	}
+	dao.Schema = schema
+	dao.SchemaVersion = dao.DatabaseVersion
+	return true, nil
+}
+
+// executeMigrationBatch applies statements and runs the target version's tests.
+// When atomic, everything runs in one transaction so a failed statement or
+// assertion leaves the database on its previous version. Otherwise statements
+// are applied one at a time and tests run once they have all succeeded.
+func executeMigrationBatch(ctx context.Context, client *sql.DB, statements []string, tests []definitions.TestCase, atomic bool) error {
+	if len(statements) == 0 && len(tests) == 0 {
 		return nil
 	}
 
+	if !atomic {
+		for i, statement := range statements {
+			if err := execMigrationStatement(ctx, client, statement); err != nil {
+				return fmt.Errorf("statement %d failed (earlier statements remain applied): %w", i+1, err)
+			}
+		}
+		statements = nil
+	}
+
 	tx, err := client.BeginTx(ctx, nil)
 	if err != nil {
 		return err
@@ -94,14 +174,69 @@ func executeMigrationBatch(ctx context.Context, client *sql.DB, statements []str
 	defer tx.Rollback()
 
 	for i, statement := range statements {
-		if _, err := tx.ExecContext(ctx, statement); err != nil {
+		if err := execMigrationStatement(ctx, tx, statement); err != nil {
 			return fmt.Errorf("statement %d failed: %w", i+1, err)
 		}
 	}
+	for _, test := range tests {
+		if err := runMigrationTest(ctx, tx, test); err != nil {
+			return err
+		}
+	}
 
 	return tx.Commit()
 }
 
+func execMigrationStatement(ctx context.Context, exec Executor, statement string) error {
+	if err := tools.InjectFault(ctx, tools.FaultMigrationStatement); err != nil {
+		return err
+	}
+	_, err := exec.ExecContext(ctx, statement)
+	return err
+}
+
+// maxTestOutput caps the assertion output recorded with a migration failure.
+const maxTestOutput = 1024
+
+func runMigrationTest(ctx context.Context, tx *sql.Tx, test definitions.TestCase) error {
+	rows, err := tx.QueryContext(ctx, test.Query)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrMigrationTestFailed, test.Name, err)
+	}
+	actual, err := tools.ScanRows(rows)
+	rows.Close()
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrMigrationTestFailed, test.Name, err)
+	}
+
+	expected := test.Expect
+	if expected == nil {
+		expected = []map[string]any{}
+	}
+	// Compare through JSON so numeric types from the driver match decoded expectations.
+	actualJSON, _ := json.Marshal(actual)
+	var normalized []map[string]any
+	if err := json.Unmarshal(actualJSON, &normalized); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrMigrationTestFailed, test.Name, err)
+	}
+	if normalized == nil {
+		normalized = []map[string]any{}
+	}
+	if reflect.DeepEqual(normalized, expected) {
+		return nil
+	}
+	expectedJSON, _ := json.Marshal(expected)
+	return fmt.Errorf("%w: %s: expected %s, got %s", ErrMigrationTestFailed, test.Name,
+		truncateTestOutput(string(expectedJSON)), truncateTestOutput(string(actualJSON)))
+}
+
+func truncateTestOutput(s string) string {
+	if len(s) <= maxTestOutput {
+		return s
+	}
+	return s[:maxTestOutput] + "..."
+}
+
 func isRetryableMigrationError(err error) bool {
 	if err == nil {
 		return false
@@ -0,0 +1,242 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/atombasedev/atombase/primarystore"
+)
+
+const primaryMigrationSchema = `
+CREATE TABLE atombase_databases (
+	id TEXT PRIMARY KEY NOT NULL,
+	definition_id INTEGER NOT NULL,
+	definition_version INTEGER DEFAULT 1,
+	updated_at TEXT
+);
+CREATE TABLE atombase_migrations (
+	id INTEGER PRIMARY KEY,
+	definition_id INTEGER NOT NULL,
+	from_version INTEGER NOT NULL,
+	to_version INTEGER NOT NULL,
+	sql TEXT NOT NULL,
+	created_at TEXT NOT NULL
+);
+CREATE TABLE atombase_migration_windows (
+	migration_id INTEGER PRIMARY KEY,
+	windows_json TEXT NOT NULL
+);
+CREATE TABLE atombase_database_schedules (
+	database_id TEXT PRIMARY KEY,
+	timezone TEXT NOT NULL DEFAULT '',
+	labels_json TEXT NOT NULL DEFAULT '[]',
+	updated_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE TABLE atombase_migration_failures (
+	database_id TEXT PRIMARY KEY,
+	from_version INTEGER NOT NULL,
+	to_version INTEGER NOT NULL,
+	error TEXT,
+	atomic INTEGER NOT NULL DEFAULT 1,
+	created_at TEXT NOT NULL
+);
+CREATE TABLE atombase_definition_tests (
+	definition_id INTEGER NOT NULL,
+	version INTEGER NOT NULL,
+	name TEXT NOT NULL,
+	query TEXT NOT NULL,
+	expect_json TEXT,
+	PRIMARY KEY(definition_id, version, name)
+);
+INSERT INTO atombase_databases (id, definition_id, definition_version) VALUES ('tenant-db', 1, 1);
+INSERT INTO atombase_migrations (definition_id, from_version, to_version, sql, created_at)
+VALUES (1, 1, 2, '["CREATE TABLE comments (id INTEGER PRIMARY KEY, post_id INTEGER)","INSERT INTO comments (id, post_id) VALUES (1, 1), (2, 99)"]', '2026-01-01T00:00:00Z');
+`
+
+func setupMigrationDAO(t *testing.T) (*TenantConnection, *sql.DB, *sql.DB) {
+	t.Helper()
+	primaryDB, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	primaryDB.SetMaxOpenConns(1)
+	if _, err := primaryDB.Exec(primaryMigrationSchema); err != nil {
+		t.Fatal(err)
+	}
+	store, err := primarystore.New(primaryDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tenantDB, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tenantDB.SetMaxOpenConns(1)
+	if _, err := tenantDB.Exec(`CREATE TABLE posts (id INTEGER PRIMARY KEY); INSERT INTO posts (id) VALUES (1);`); err != nil {
+		t.Fatal(err)
+	}
+	dao := &TenantConnection{
+		Client:          tenantDB,
+		ID:              "tenant-db",
+		DefinitionID:    1,
+		SchemaVersion:   2,
+		DatabaseVersion: 1,
+		primaryStore:    store,
+	}
+	return dao, primaryDB, tenantDB
+}
+
+func TestMigrateIfNeeded_RunsDefinitionTests(t *testing.T) {
+	dao, primaryDB, tenantDB := setupMigrationDAO(t)
+	defer primaryDB.Close()
+	defer tenantDB.Close()
+
+	if _, err := primaryDB.Exec(`
+		INSERT INTO atombase_definition_tests (definition_id, version, name, query, expect_json) VALUES
+		(1, 2, 'comment count', 'SELECT COUNT(*) AS n FROM comments', '[{"n":2}]')
+	`); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := MigrateIfNeeded(context.Background(), dao); err != nil {
+		t.Fatalf("MigrateIfNeeded failed: %v", err)
+	}
+	if dao.DatabaseVersion != 2 {
+		t.Fatalf("expected database version 2, got %d", dao.DatabaseVersion)
+	}
+}
+
+func TestMigrateIfNeeded_FailedTestRollsBackAndRecordsOutput(t *testing.T) {
+	dao, primaryDB, tenantDB := setupMigrationDAO(t)
+	defer primaryDB.Close()
+	defer tenantDB.Close()
+
+	if _, err := primaryDB.Exec(`
+		INSERT INTO atombase_definition_tests (definition_id, version, name, query) VALUES
+		(1, 2, 'no orphan comments', 'SELECT c.id FROM comments c LEFT JOIN posts p ON p.id = c.post_id WHERE p.id IS NULL')
+	`); err != nil {
+		t.Fatal(err)
+	}
+
+	err := MigrateIfNeeded(context.Background(), dao)
+	if !errors.Is(err, ErrMigrationFailed) {
+		t.Fatalf("expected ErrMigrationFailed, got %v", err)
+	}
+	if dao.DatabaseVersion != 1 {
+		t.Fatalf("expected database to stay on version 1, got %d", dao.DatabaseVersion)
+	}
+
+	var count int
+	if err := tenantDB.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE name = 'comments'`).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Fatal("expected migration to be rolled back")
+	}
+
+	var recorded string
+	if err := primaryDB.QueryRow(`SELECT error FROM atombase_migration_failures WHERE database_id = 'tenant-db'`).Scan(&recorded); err != nil {
+		t.Fatalf("expected recorded failure: %v", err)
+	}
+	if !strings.Contains(recorded, "no orphan comments") || !strings.Contains(recorded, `"id":2`) {
+		t.Fatalf("expected assertion output in failure, got %q", recorded)
+	}
+}
+
+func TestMigrateIfNeeded_RecordsWhetherFailureWasAtomic(t *testing.T) {
+	cases := []struct {
+		name       string
+		sql        string
+		atomic     bool
+		leftBehind int
+	}{
+		{
+			name:       "transactional",
+			sql:        `["CREATE TABLE comments (id INTEGER PRIMARY KEY)","INSERT INTO missing (id) VALUES (1)"]`,
+			atomic:     true,
+			leftBehind: 0,
+		},
+		{
+			name:       "vacuum",
+			sql:        `["CREATE TABLE comments (id INTEGER PRIMARY KEY)","VACUUM","INSERT INTO missing (id) VALUES (1)"]`,
+			atomic:     false,
+			leftBehind: 1,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			dao, primaryDB, tenantDB := setupMigrationDAO(t)
+			defer primaryDB.Close()
+			defer tenantDB.Close()
+
+			if _, err := primaryDB.Exec(`UPDATE atombase_migrations SET sql = ?`, tc.sql); err != nil {
+				t.Fatal(err)
+			}
+			if err := MigrateIfNeeded(context.Background(), dao); !errors.Is(err, ErrMigrationFailed) {
+				t.Fatalf("expected ErrMigrationFailed, got %v", err)
+			}
+
+			var count int
+			if err := tenantDB.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE name = 'comments'`).Scan(&count); err != nil {
+				t.Fatal(err)
+			}
+			if count != tc.leftBehind {
+				t.Fatalf("expected %d leftover tables, got %d", tc.leftBehind, count)
+			}
+			var atomic bool
+			if err := primaryDB.QueryRow(`SELECT atomic FROM atombase_migration_failures WHERE database_id = 'tenant-db'`).Scan(&atomic); err != nil {
+				t.Fatalf("expected recorded failure: %v", err)
+			}
+			if atomic != tc.atomic {
+				t.Fatalf("expected atomic=%v, got %v", tc.atomic, atomic)
+			}
+		})
+	}
+}
+
+func TestMigrateIfNeeded_DefersOutsideWindow(t *testing.T) {
+	dao, primaryDB, tenantDB := setupMigrationDAO(t)
+	defer primaryDB.Close()
+	defer tenantDB.Close()
+
+	if _, err := primaryDB.Exec(`
+		CREATE TABLE atombase_definitions_history (definition_id INTEGER, version INTEGER, schema_json TEXT);
+		INSERT INTO atombase_definitions_history VALUES (1, 1, '{"tables":[{"name":"posts","pk":["id"],"columns":{"id":{"name":"id","type":"INTEGER"}}}]}');
+		INSERT INTO atombase_database_schedules (database_id, timezone, labels_json) VALUES ('tenant-db', 'UTC', '["eu"]');
+	`); err != nil {
+		t.Fatal(err)
+	}
+	// A window that has just closed, so the test never races its edge.
+	now := time.Now().UTC()
+	window := fmt.Sprintf(`[{"start":"%s","end":"%s","labels":["eu"]}]`, now.Add(-2*time.Hour).Format("15:04"), now.Add(-time.Hour).Format("15:04"))
+	if _, err := primaryDB.Exec(`INSERT INTO atombase_migration_windows (migration_id, windows_json) SELECT id, ? FROM atombase_migrations`, window); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := MigrateIfNeeded(context.Background(), dao); err != nil {
+		t.Fatalf("MigrateIfNeeded failed: %v", err)
+	}
+	if dao.DatabaseVersion != 1 || dao.SchemaVersion != 1 {
+		t.Fatalf("expected database to be served at version 1, got database %d schema %d", dao.DatabaseVersion, dao.SchemaVersion)
+	}
+	if _, err := dao.Schema.SearchTbls("posts"); err != nil {
+		t.Fatalf("expected version 1 schema: %v", err)
+	}
+
+	// Windows for other labels leave the database unrestricted.
+	if _, err := primaryDB.Exec(`UPDATE atombase_database_schedules SET labels_json = '["us"]'`); err != nil {
+		t.Fatal(err)
+	}
+	dao.SchemaVersion = 2
+	if err := MigrateIfNeeded(context.Background(), dao); err != nil {
+		t.Fatalf("MigrateIfNeeded failed: %v", err)
+	}
+	if dao.DatabaseVersion != 2 {
+		t.Fatalf("expected database version 2, got %d", dao.DatabaseVersion)
+	}
+}
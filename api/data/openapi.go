@@ -0,0 +1,431 @@
+package data
+
+import (
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/atombasedev/atombase/config"
+)
+
+// filterOperators are the where operators every column takes; text columns
+// also take the pattern operators.
+var (
+	filterOperators  = []string{OpEq, OpNeq, OpLt, OpLte, OpGt, OpGte, OpIn, OpBetween, OpIs, OpNot}
+	patternOperators = []string{OpLike, OpIlike, OpGlob}
+)
+
+// OpenAPISpec describes the database's tables as an OpenAPI 3.1 document: one
+// POST /data/query/{table} path per table with the bodies of each Prefer
+// operation, typed from the schema, so clients can generate SDKs. Views only
+// offer selects. Filter operators follow settings.allowedOperators and write
+// schemas carry settings.validation.
+func (schema SchemaCache) OpenAPISpec(version int) map[string]any {
+	components := map[string]any{}
+	paths := map[string]any{}
+	allowed := schema.allowedOperatorSet()
+
+	for _, kind := range []string{ColTypeInteger, ColTypeReal, ColTypeText, ColTypeBlob, ""} {
+		components[filterComponent(kind)] = filterSchema(kind, allowed)
+	}
+	components["Error"] = map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"code":    map[string]any{"type": "string"},
+			"message": map[string]any{"type": "string"},
+			"hint":    map[string]any{"type": "string"},
+		},
+	}
+
+	for _, name := range sortedTableNames(schema.Tables) {
+		table := schema.Tables[name]
+		isView := schema.Views[name]
+		components[name] = schema.rowSchema(table, "")
+		components[name+".condition"] = conditionSchema(table, allowed)
+		components[name+".select"] = schema.selectQuerySchema(table)
+		operations := []string{"select"}
+		if !isView {
+			components[name+".insert"] = map[string]any{
+				"type":     "object",
+				"required": []string{"data"},
+				"properties": map[string]any{
+					"data": map[string]any{"oneOf": []any{
+						schema.rowSchema(table, "insert"),
+						map[string]any{"type": "array", "items": schema.rowSchema(table, "insert")},
+					}},
+					"returning": columnListSchema(table),
+				},
+			}
+			// Bulk updates and deletes name rows by primary key in rows instead.
+			components[name+".update"] = map[string]any{
+				"type":  "object",
+				"oneOf": []any{map[string]any{"required": []string{"data", "where"}}, map[string]any{"required": []string{"rows"}}},
+				"properties": map[string]any{
+					"data":      schema.rowSchema(table, "update"),
+					"where":     whereSchema(name),
+					"rows":      map[string]any{"type": "array", "items": schema.rowSchema(table, "update"), "maxItems": MaxBatchOperations},
+					"returning": columnListSchema(table),
+				},
+			}
+			components[name+".delete"] = map[string]any{
+				"type":  "object",
+				"oneOf": []any{map[string]any{"required": []string{"where"}}, map[string]any{"required": []string{"rows"}}},
+				"properties": map[string]any{
+					"where":     whereSchema(name),
+					"rows":      map[string]any{"type": "array", "items": map[string]any{"type": "object"}, "maxItems": MaxBatchOperations},
+					"returning": columnListSchema(table),
+				},
+			}
+			operations = append(operations, "insert", "update", "delete")
+		}
+		paths["/data/query/"+name] = map[string]any{"post": queryOperation(table, operations, isView)}
+		if isView || len(table.Pk) == 0 {
+			continue
+		}
+		for _, col := range sortedKeys(table.Columns) {
+			if strings.EqualFold(table.Columns[col], ColTypeBlob) {
+				paths["/data/"+name+"/{pk}/"+col+"/blob"] = blobOperations(table, col)
+			}
+		}
+	}
+
+	return map[string]any{
+		"openapi": "3.1.0",
+		"info": map[string]any{
+			"title":   "Atomicbase Data API",
+			"version": strconv.Itoa(version),
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": components,
+			"securitySchemes": map[string]any{
+				"bearer": map[string]any{"type": "http", "scheme": "bearer"},
+			},
+		},
+		"security": []any{map[string]any{"bearer": []string{}}},
+	}
+}
+
+// queryOperation describes POST /data/query/{table}. The operation is chosen
+// by the Prefer header, so the body is one of the operation's schemas.
+func queryOperation(table CacheTable, operations []string, isView bool) map[string]any {
+	prefer := make([]string, 0, len(operations)+2)
+	bodies := make([]any, 0, len(operations))
+	for _, op := range operations {
+		prefer = append(prefer, "operation="+op)
+		bodies = append(bodies, componentRef(table.Name+"."+op))
+	}
+	if !isView {
+		prefer = append(prefer, "operation=insert, on-conflict=replace", "operation=insert, on-conflict=ignore",
+			"operation=insert, "+PreferResolutionMerge, "operation=insert, "+PreferResolutionIgnore)
+	}
+
+	parameters := []any{
+		map[string]any{
+			"name": "Database", "in": "header", "required": true,
+			"description": "Database to query, as type:name",
+			"schema":      map[string]any{"type": "string"},
+		},
+		map[string]any{
+			"name": "Prefer", "in": "header", "required": true,
+			"schema": map[string]any{"type": "string", "enum": prefer},
+		},
+	}
+	if !isView {
+		parameters = append(parameters, map[string]any{
+			"name": "on_conflict", "in": "query",
+			"description": "Comma separated unique columns upserts match rows on, the primary key by default",
+			"schema":      map[string]any{"type": "string"},
+		})
+	}
+	// URL filters take column=operator.value.
+	for _, col := range sortedKeys(table.Columns) {
+		parameters = append(parameters, map[string]any{
+			"name": col, "in": "query",
+			"description": "Filter as operator.value, e.g. eq.1",
+			"schema":      map[string]any{"type": "string"},
+		})
+	}
+
+	summary := "Select, insert, update or delete " + table.Name + " rows"
+	if isView {
+		summary = "Select " + table.Name + " rows"
+	}
+	return map[string]any{
+		"operationId": "query_" + table.Name,
+		"summary":     summary,
+		"parameters":  parameters,
+		"requestBody": map[string]any{
+			"required": true,
+			"content": map[string]any{
+				"application/json": map[string]any{"schema": map[string]any{"oneOf": bodies}},
+			},
+		},
+		"responses": map[string]any{
+			"200": map[string]any{
+				"description": "Selected rows, or the rows a write returned",
+				"content": map[string]any{
+					"application/json": map[string]any{"schema": map[string]any{
+						"oneOf": []any{
+							map[string]any{"type": "array", "items": componentRef(table.Name)},
+							map[string]any{"type": "object"},
+						},
+					}},
+				},
+			},
+			"default": map[string]any{
+				"description": "Error",
+				"content": map[string]any{
+					"application/json": map[string]any{"schema": componentRef("Error")},
+				},
+			},
+		},
+	}
+}
+
+// blobOperations describes GET and PUT /data/{table}/{pk}/{column}/blob for
+// a BLOB column.
+func blobOperations(table CacheTable, column string) map[string]any {
+	parameters := []any{
+		map[string]any{
+			"name": "Database", "in": "header", "required": true,
+			"description": "Database to query, as type:name",
+			"schema":      map[string]any{"type": "string"},
+		},
+		map[string]any{
+			"name": "pk", "in": "path", "required": true,
+			"description": "Primary key value; " + strings.Join(table.Pk, ", ") + " comma separated in that order",
+			"schema":      map[string]any{"type": "string"},
+		},
+	}
+	binary := map[string]any{"*/*": map[string]any{"schema": map[string]any{"type": "string", "format": "binary"}}}
+	errorResponse := map[string]any{
+		"description": "Error",
+		"content": map[string]any{
+			"application/json": map[string]any{"schema": componentRef("Error")},
+		},
+	}
+	return map[string]any{
+		"get": map[string]any{
+			"operationId": "get_" + table.Name + "_" + column,
+			"summary":     "Download " + table.Name + "." + column,
+			"parameters":  append(parameters, map[string]any{"name": "Range", "in": "header", "schema": map[string]any{"type": "string"}}),
+			"responses": map[string]any{
+				"200":     map[string]any{"description": "The blob", "content": binary},
+				"206":     map[string]any{"description": "The requested range of the blob", "content": binary},
+				"204":     map[string]any{"description": "The blob is NULL"},
+				"default": errorResponse,
+			},
+		},
+		"put": map[string]any{
+			"operationId": "put_" + table.Name + "_" + column,
+			"summary":     "Upload " + table.Name + "." + column,
+			"parameters":  parameters,
+			"requestBody": map[string]any{"required": true, "content": binary},
+			"responses": map[string]any{
+				"204":     map[string]any{"description": "Stored"},
+				"default": errorResponse,
+			},
+		},
+	}
+}
+
+// rowSchema is a table's row. For "insert" and "update" it is the data a
+// write takes, with the table's validation rules for that operation.
+func (schema SchemaCache) rowSchema(table CacheTable, operation string) map[string]any {
+	var rules map[string]ColumnRule
+	if operation != "" && schema.Settings != nil {
+		rules = schema.Settings.Validation[table.Name].Columns
+	}
+	properties := make(map[string]any, len(table.Columns))
+	var required []string
+	for _, col := range sortedKeys(table.Columns) {
+		prop := columnSchema(table.Columns[col])
+		if rule, ok := rules[col]; ok {
+			if rule.Pattern != "" {
+				prop["pattern"] = rule.Pattern
+			}
+			if rule.Min != nil {
+				prop["minimum"] = *rule.Min
+			}
+			if rule.Max != nil {
+				prop["maximum"] = *rule.Max
+			}
+			if rule.MinLength != nil {
+				prop["minLength"] = *rule.MinLength
+			}
+			if rule.MaxLength != nil {
+				prop["maxLength"] = *rule.MaxLength
+			}
+			if slices.Contains(rule.Required, operation) {
+				required = append(required, col)
+			}
+		}
+		properties[col] = prop
+	}
+	row := map[string]any{"type": "object", "properties": properties}
+	if operation == "" && len(table.Pk) > 0 {
+		row["x-primary-key"] = table.Pk
+	}
+	if len(required) > 0 {
+		row["required"] = required
+	}
+	return row
+}
+
+func (schema SchemaCache) selectQuerySchema(table CacheTable) map[string]any {
+	columns := sortedKeys(table.Columns)
+	order := make(map[string]any, len(columns))
+	for _, col := range columns {
+		order[col] = map[string]any{"type": "string", "enum": []string{"asc", "desc"}}
+	}
+	limit := map[string]any{"type": "integer", "minimum": 0}
+	if maxLimit := schema.maxSelectLimit(); maxLimit > 0 {
+		limit["maximum"] = maxLimit
+	}
+	properties := map[string]any{
+		"select": map[string]any{
+			"type": "array",
+			"items": map[string]any{"anyOf": []any{
+				map[string]any{"type": "string", "description": "Column, table.column or *"},
+				map[string]any{"type": "object", "description": "Related table -> its select"},
+			}},
+		},
+		"join":     map[string]any{"type": "array", "items": map[string]any{"type": "object"}},
+		"where":    whereSchema(table.Name),
+		"order":    map[string]any{"type": "object", "properties": order, "additionalProperties": false},
+		"limit":    limit,
+		"offset":   map[string]any{"type": "integer", "minimum": 0},
+		"cursor":   map[string]any{"type": "string"},
+		"computed": map[string]any{"type": "object", "additionalProperties": map[string]any{"type": "string"}},
+		"lang":     map[string]any{"type": "string"},
+	}
+	if schema.FTSTables[table.Name] {
+		properties["search"] = map[string]any{
+			"type":     "object",
+			"required": []string{"query"},
+			"properties": map[string]any{
+				"query":     map[string]any{"type": "string"},
+				"rank":      map[string]any{"type": "string"},
+				"snippet":   map[string]any{"type": "object", "additionalProperties": map[string]any{"type": "string"}},
+				"highlight": map[string]any{"type": "object", "additionalProperties": map[string]any{"type": "string"}},
+			},
+		}
+	}
+	return map[string]any{"type": "object", "properties": properties}
+}
+
+// maxSelectLimit is the largest limit a select may use, 0 for none.
+func (schema SchemaCache) maxSelectLimit() int {
+	maxLimit := config.Cfg.MaxQueryLimit
+	if s := schema.Settings; s != nil && s.MaxLimit != nil && (maxLimit == 0 || *s.MaxLimit < maxLimit) {
+		maxLimit = *s.MaxLimit
+	}
+	return maxLimit
+}
+
+// allowedOperatorSet returns the operators where clauses may use, or nil
+// when every operator is accepted.
+func (schema SchemaCache) allowedOperatorSet() map[string]bool {
+	if schema.Settings == nil || len(schema.Settings.AllowedOperators) == 0 {
+		return nil
+	}
+	allowed := make(map[string]bool, len(schema.Settings.AllowedOperators))
+	for _, op := range schema.Settings.AllowedOperators {
+		allowed[op] = true
+	}
+	return allowed
+}
+
+// conditionSchema is one entry of a where list: column filters, and and/or
+// groups of further conditions.
+func conditionSchema(table CacheTable, allowed map[string]bool) map[string]any {
+	properties := make(map[string]any, len(table.Columns)+2)
+	for _, col := range sortedKeys(table.Columns) {
+		properties[col] = componentRef(filterComponent(table.Columns[col]))
+	}
+	for _, op := range []string{OpAnd, OpOr} {
+		if allowed == nil || allowed[op] {
+			properties[op] = whereSchema(table.Name)
+		}
+	}
+	return map[string]any{"type": "object", "properties": properties}
+}
+
+func filterSchema(colType string, allowed map[string]bool) map[string]any {
+	value := columnSchema(colType)
+	ops := filterOperators
+	if colType == ColTypeText {
+		ops = append(slices.Clone(ops), patternOperators...)
+	}
+	properties := map[string]any{}
+	for _, op := range ops {
+		if allowed != nil && !allowed[op] {
+			continue
+		}
+		switch op {
+		case OpIn:
+			properties[op] = map[string]any{"type": "array", "items": value}
+		case OpBetween:
+			properties[op] = map[string]any{"type": "array", "items": value, "minItems": 2, "maxItems": 2}
+		case OpIs:
+			properties[op] = map[string]any{"enum": []any{nil, true, false}}
+		case OpNot:
+			properties[op] = componentRef(filterComponent(colType))
+		case OpLike, OpIlike, OpGlob:
+			properties[op] = map[string]any{"type": "string"}
+		default:
+			properties[op] = value
+		}
+	}
+	return map[string]any{"type": "object", "properties": properties, "additionalProperties": false}
+}
+
+// columnSchema maps a SQLite column type to a JSON schema. Columns without a
+// declared type, such as view expressions, take any value.
+func columnSchema(colType string) map[string]any {
+	switch colType {
+	case ColTypeInteger:
+		return map[string]any{"type": []string{"integer", "null"}}
+	case ColTypeReal:
+		return map[string]any{"type": []string{"number", "null"}}
+	case ColTypeText:
+		return map[string]any{"type": []string{"string", "null"}}
+	case ColTypeBlob:
+		return map[string]any{"type": []string{"string", "null"}, "contentEncoding": "base64"}
+	}
+	return map[string]any{}
+}
+
+func filterComponent(colType string) string {
+	switch colType {
+	case ColTypeInteger, ColTypeReal, ColTypeText, ColTypeBlob:
+		return "filter." + colType
+	}
+	return "filter.ANY"
+}
+
+func whereSchema(table string) map[string]any {
+	return map[string]any{"type": "array", "items": componentRef(table + ".condition")}
+}
+
+func columnListSchema(table CacheTable) map[string]any {
+	return map[string]any{
+		"type":  "array",
+		"items": map[string]any{"type": "string", "enum": append([]string{"*"}, sortedKeys(table.Columns)...)},
+	}
+}
+
+func componentRef(name string) map[string]any {
+	return map[string]any{"$ref": "#/components/schemas/" + name}
+}
+
+func sortedTableNames(tables map[string]CacheTable) []string {
+	names := make([]string, 0, len(tables))
+	for name := range tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,77 @@
+package data
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestOpenAPISpec(t *testing.T) {
+	maxLen := 120
+	schema, err := decodeSchemaCache([]byte(`{
+		"tables": [
+			{"name": "users", "pk": ["id"], "columns": {"id": {"name": "id", "type": "INTEGER"}, "name": {"name": "name", "type": "TEXT"}}},
+			{"name": "posts", "pk": ["id"], "ftsColumns": ["title"], "columns": {"id": {"name": "id", "type": "INTEGER"}, "title": {"name": "title", "type": "TEXT"}, "user_id": {"name": "user_id", "type": "INTEGER", "references": "users.id"}}}
+		],
+		"views": [{"name": "named_users", "select": "SELECT name FROM users", "columns": {"name": "TEXT"}}],
+		"settings": {
+			"allowedOperators": ["eq", "in", "like", "and"],
+			"validation": {"posts": {"columns": {"title": {"required": ["insert"], "maxLength": 120}}}}
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec := schema.OpenAPISpec(3)
+
+	raw, err := json.Marshal(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every reference resolves to a component.
+	schemas := spec["components"].(map[string]any)["schemas"].(map[string]any)
+	for _, ref := range strings.Split(string(raw), `"$ref":"#/components/schemas/`)[1:] {
+		name := ref[:strings.Index(ref, `"`)]
+		if _, ok := schemas[name]; !ok {
+			t.Errorf("unresolved $ref %s", name)
+		}
+	}
+
+	paths := spec["paths"].(map[string]any)
+	if len(paths) != 3 || spec["info"].(map[string]any)["version"] != "3" {
+		t.Fatalf("unexpected paths %v", paths)
+	}
+	if _, ok := schemas["named_users.insert"]; ok {
+		t.Error("expected views to offer selects only")
+	}
+	if _, ok := schemas["posts.select"].(map[string]any)["properties"].(map[string]any)["search"]; !ok {
+		t.Error("expected the FTS table's select to take search")
+	}
+	if _, ok := schemas["users.select"].(map[string]any)["properties"].(map[string]any)["search"]; ok {
+		t.Error("expected search only on FTS tables")
+	}
+
+	text := schemas["filter.TEXT"].(map[string]any)["properties"].(map[string]any)
+	if len(text) != 3 || text["eq"] == nil || text["in"] == nil || text["like"] == nil {
+		t.Errorf("expected only allowed operators, got %v", text)
+	}
+	if _, ok := schemas["filter.INTEGER"].(map[string]any)["properties"].(map[string]any)["like"]; ok {
+		t.Error("expected pattern operators only on text")
+	}
+	condition := schemas["posts.condition"].(map[string]any)["properties"].(map[string]any)
+	if condition["and"] == nil || condition["or"] != nil {
+		t.Errorf("expected and groups only, got %v", condition)
+	}
+
+	insert := schemas["posts.insert"].(map[string]any)["properties"].(map[string]any)["data"].(map[string]any)["oneOf"].([]any)[0].(map[string]any)
+	if required := insert["required"].([]string); len(required) != 1 || required[0] != "title" {
+		t.Errorf("insert required: %v", insert["required"])
+	}
+	if title := insert["properties"].(map[string]any)["title"].(map[string]any); title["maxLength"] != maxLen {
+		t.Errorf("insert title: %v", title)
+	}
+	update := schemas["posts.update"].(map[string]any)["properties"].(map[string]any)["data"].(map[string]any)
+	if _, ok := update["required"]; ok {
+		t.Error("expected insert-only requirements to stay off updates")
+	}
+}
@@ -0,0 +1,98 @@
+package data
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/atombasedev/atombase/tools"
+)
+
+// fallbackPerPage is the page size when neither ?per_page nor a default
+// limit sets one.
+const fallbackPerPage = 100
+
+// pageRequest is a select asked for by page number with ?page and ?per_page.
+type pageRequest struct {
+	page    int // 1-based
+	perPage int
+}
+
+// parsePageParams reads ?page=N&per_page=M. ok is false when the request has
+// no ?page, so the select is not paged. per_page defaults to the select's
+// default limit and is capped like any limit.
+func parsePageParams(params url.Values, schema SchemaCache) (pageRequest, bool, error) {
+	raw := params.Get(ParamPage)
+	if raw == "" {
+		if params.Has(ParamPerPage) {
+			return pageRequest{}, false, tools.InvalidRequestErr(fmt.Sprintf("%s needs ?%s=", ParamPerPage, ParamPage))
+		}
+		return pageRequest{}, false, nil
+	}
+	page, err := strconv.Atoi(raw)
+	if err != nil || page < 1 {
+		return pageRequest{}, false, tools.InvalidRequestErr(fmt.Sprintf("%s must be a whole number of at least 1, got %q", ParamPage, raw))
+	}
+	var requested *int
+	if raw := params.Get(ParamPerPage); raw != "" {
+		perPage, err := strconv.Atoi(raw)
+		if err != nil || perPage < 1 {
+			return pageRequest{}, false, tools.InvalidRequestErr(fmt.Sprintf("%s must be a whole number of at least 1, got %q", ParamPerPage, raw))
+		}
+		requested = &perPage
+	}
+	perPage := schema.selectLimit(requested)
+	if perPage <= 0 {
+		perPage = fallbackPerPage
+	}
+	return pageRequest{page: page, perPage: perPage}, true, nil
+}
+
+// apply sets the select's offset and limit to the page's rows.
+func (p pageRequest) apply(query *SelectQuery) error {
+	if query.Offset != nil || query.Limit != nil || query.Cursor != nil {
+		return tools.InvalidRequestErr("page cannot be combined with limit, offset or cursor")
+	}
+	offset := (p.page - 1) * p.perPage
+	limit := p.perPage
+	query.Offset, query.Limit = &offset, &limit
+	return nil
+}
+
+func (p pageRequest) totalPages(total int64) int64 {
+	return (total + int64(p.perPage) - 1) / int64(p.perPage)
+}
+
+// links returns an RFC 5988 Link header to the first, previous, next and
+// last pages, as the request's own URL with ?page replaced.
+func (p pageRequest) links(req *http.Request, total int64) string {
+	last := max(1, p.totalPages(total))
+	link := func(page int64, rel string) string {
+		params := req.URL.Query()
+		params.Set(ParamPage, strconv.FormatInt(page, 10))
+		params.Set(ParamPerPage, strconv.Itoa(p.perPage))
+		return fmt.Sprintf(`<%s?%s>; rel="%s"`, req.URL.Path, params.Encode(), rel)
+	}
+	links := []string{link(1, "first")}
+	if p.page > 1 {
+		links = append(links, link(min(int64(p.page-1), last), "prev"))
+	}
+	if int64(p.page) < last {
+		links = append(links, link(int64(p.page+1), "next"))
+	}
+	links = append(links, link(last, "last"))
+	return strings.Join(links, ", ")
+}
+
+// envelope wraps a page's rows with the pagination state.
+func (p pageRequest) envelope(rows any, total int64) map[string]any {
+	return map[string]any{
+		"data":        rows,
+		"total":       total,
+		"page":        p.page,
+		"per_page":    p.perPage,
+		"total_pages": p.totalPages(total),
+	}
+}
@@ -0,0 +1,70 @@
+package data
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/atombasedev/atombase/config"
+)
+
+func TestParsePageParams(t *testing.T) {
+	original := config.Cfg
+	defer func() { config.Cfg = original }()
+	config.Cfg.DefaultLimit = 100
+	config.Cfg.MaxQueryLimit = 1000
+
+	page, ok, err := parsePageParams(url.Values{ParamPage: {"3"}, ParamPerPage: {"25"}}, SchemaCache{})
+	if err != nil || !ok || page != (pageRequest{page: 3, perPage: 25}) {
+		t.Fatalf("got %+v, %v, %v", page, ok, err)
+	}
+	if page, _, _ := parsePageParams(url.Values{ParamPage: {"1"}}, SchemaCache{}); page.perPage != 100 {
+		t.Errorf("got per_page %d, want the default limit", page.perPage)
+	}
+	if page, _, _ := parsePageParams(url.Values{ParamPage: {"1"}, ParamPerPage: {"5000"}}, SchemaCache{}); page.perPage != 1000 {
+		t.Errorf("got per_page %d, want the max limit", page.perPage)
+	}
+	if _, ok, err := parsePageParams(url.Values{}, SchemaCache{}); ok || err != nil {
+		t.Errorf("got %v, %v without ?page", ok, err)
+	}
+	for _, params := range []url.Values{
+		{ParamPage: {"0"}},
+		{ParamPage: {"two"}},
+		{ParamPage: {"1"}, ParamPerPage: {"-1"}},
+		{ParamPerPage: {"10"}},
+	} {
+		if _, _, err := parsePageParams(params, SchemaCache{}); err == nil {
+			t.Errorf("%v: expected an error", params)
+		}
+	}
+}
+
+func TestPageRequest(t *testing.T) {
+	page := pageRequest{page: 2, perPage: 10}
+
+	var query SelectQuery
+	if err := page.apply(&query); err != nil || *query.Offset != 10 || *query.Limit != 10 {
+		t.Fatalf("got offset %v, limit %v, %v", query.Offset, query.Limit, err)
+	}
+	if err := page.apply(&query); err == nil {
+		t.Error("expected an error for a select that already has a limit")
+	}
+
+	req := httptest.NewRequest("POST", "/data/query/users?status=eq.active&page=2&per_page=10", nil)
+	want := `</data/query/users?page=1&per_page=10&status=eq.active>; rel="first", ` +
+		`</data/query/users?page=1&per_page=10&status=eq.active>; rel="prev", ` +
+		`</data/query/users?page=3&per_page=10&status=eq.active>; rel="next", ` +
+		`</data/query/users?page=3&per_page=10&status=eq.active>; rel="last"`
+	if got := page.links(req, 25); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+	// The last page has no next link, and an empty result still has one page.
+	if got := (pageRequest{page: 1, perPage: 10}).links(req, 0); got != `</data/query/users?page=1&per_page=10&status=eq.active>; rel="first", </data/query/users?page=1&per_page=10&status=eq.active>; rel="last"` {
+		t.Errorf("got %s", got)
+	}
+
+	envelope := page.envelope([]any{}, 25)
+	if envelope["total"] != int64(25) || envelope["page"] != 2 || envelope["per_page"] != 10 || envelope["total_pages"] != int64(3) {
+		t.Errorf("got %v", envelope)
+	}
+}
@@ -2,11 +2,40 @@ package data
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/atombasedev/atombase/definitions"
+	"github.com/atombasedev/atombase/tools"
 )
 
+// compilePolicy returns the predicate rows of table must satisfy for operation.
+// Every read and write compiles one, so it also rejects writes to views,
+// writes while paused or in a read-only request and operations outside the
+// caller's API key scope.
 func (dao *TenantConnection) compilePolicy(ctx context.Context, table, operation string, values map[string]any) (definitions.CompiledPredicate, error) {
+	if dao != nil && dao.Schema.Views[table] && operation != "select" {
+		return definitions.CompiledPredicate{}, fmt.Errorf("%w: cannot %s %s", tools.ErrReadOnlyView, operation, table)
+	}
+	if dao != nil && dao.WritesPaused && operation != "select" {
+		return definitions.CompiledPredicate{}, tools.ErrWritesPaused
+	}
+	if dao != nil && dao.ReadOnly && operation != "select" {
+		return definitions.CompiledPredicate{}, fmt.Errorf("%w: cannot %s %s", tools.ErrReadOnlyRequest, operation, table)
+	}
+	if base, ok := dao.rollupOf(table); ok && operation == "select" {
+		return dao.compileRollupPolicy(ctx, base)
+	}
+	if dao != nil && dao.Principal.KeyScope != nil && !dao.Principal.KeyScope.Allows(table, operation) {
+		return definitions.CompiledPredicate{}, fmt.Errorf("%w: %s on %s", tools.ErrAPIKeyScope, operation, table)
+	}
+	predicate, err := dao.compileAccessPolicy(ctx, table, operation, values)
+	if err != nil {
+		return definitions.CompiledPredicate{}, err
+	}
+	return dao.scopeToRowTenant(table, operation, predicate)
+}
+
+func (dao *TenantConnection) compileAccessPolicy(ctx context.Context, table, operation string, values map[string]any) (definitions.CompiledPredicate, error) {
 	if dao == nil || dao.primaryStore == nil || dao.DefinitionID == 0 {
 		return definitions.CompiledPredicate{GoAllowed: true}, nil
 	}
@@ -22,6 +51,7 @@ func (dao *TenantConnection) compilePolicy(ctx context.Context, table, operation
 			DefinitionID:      dao.DefinitionID,
 			DefinitionType:    dao.DefinitionType,
 			DefinitionVersion: dao.DatabaseVersion,
+			RowTenant:         dao.RowTenant,
 		},
 		Table:     table,
 		Operation: operation,
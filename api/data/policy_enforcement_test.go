@@ -4,10 +4,12 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"testing"
 
 	"github.com/atombasedev/atombase/definitions"
 	"github.com/atombasedev/atombase/primarystore"
+	"github.com/atombasedev/atombase/tools"
 	_ "github.com/mattn/go-sqlite3"
 )
 
@@ -179,3 +181,32 @@ func TestUpdateJSON_OrganizationPolicyFiltersRowsInSQL(t *testing.T) {
 		t.Fatalf("unexpected titles after update: locked=%q editable=%q", lockedTitle, editableTitle)
 	}
 }
+
+func TestAPIKeyScope_LimitsTablesAndVerbs(t *testing.T) {
+	dao, primaryDB, tenantDB := setupPolicyDAO(t, definitions.Principal{
+		IsService:  true,
+		AuthStatus: definitions.AuthStatusAuthenticated,
+		KeyScope:   &tools.APIKeyScope{KeyID: "key_1", Tables: []string{"posts"}, Verbs: []string{tools.VerbRead}},
+	})
+	defer primaryDB.Close()
+	defer tenantDB.Close()
+	ctx := context.Background()
+
+	if _, err := tenantDB.Exec(`INSERT INTO users (id, name) VALUES (1, 'Alice'); INSERT INTO posts (id, user_id, author_id, title) VALUES (1, 1, 'user-1', 'hello')`); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := dao.SelectJSON(ctx, "posts", SelectQuery{Select: []any{"id", "title"}}, true)
+	if err != nil || result.Count != 1 {
+		t.Fatalf("expected the key to read posts, got %v, %v", result.Count, err)
+	}
+	if _, err := dao.SelectJSON(ctx, "users", SelectQuery{Select: []any{"id"}}, false); !errors.Is(err, tools.ErrAPIKeyScope) {
+		t.Fatalf("expected users to be outside the key's tables, got %v", err)
+	}
+	if _, err := dao.SelectJSON(ctx, "posts", SelectQuery{Select: []any{"id", map[string]any{"users": []any{"name"}}}}, false); !errors.Is(err, tools.ErrAPIKeyScope) {
+		t.Fatalf("expected a nested relation outside the key's tables to be refused, got %v", err)
+	}
+	if _, err := dao.InsertJSON(ctx, "posts", InsertRequest{Data: RowData{{"id": 2, "user_id": 1, "author_id": "user-1", "title": "new"}}}); !errors.Is(err, tools.ErrAPIKeyScope) {
+		t.Fatalf("expected a read key to be refused writes, got %v", err)
+	}
+}
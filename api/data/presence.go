@@ -0,0 +1,298 @@
+package data
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/atombasedev/atombase/config"
+	"github.com/atombasedev/atombase/tools"
+)
+
+const (
+	maxPresenceMembers = 1000 // Members a channel holds when its settings give no limit
+	maxPresenceState   = 4096 // Bytes of JSON state a member may carry
+	presenceBuffer     = 64   // Events a slow member may fall behind before it is dropped
+)
+
+// presenceChannelPattern is what a channel name may be.
+var presenceChannelPattern = regexp.MustCompile(`^[A-Za-z0-9_.:-]{1,128}$`)
+
+// PresenceMember is one connection in a presence channel. A user with several
+// tabs open is several members with the same UserID.
+type PresenceMember struct {
+	Ref      string          `json:"ref"`
+	UserID   string          `json:"userId"`
+	State    json.RawMessage `json:"state"`
+	JoinedAt time.Time       `json:"joinedAt"`
+}
+
+// PresenceEvent is sent to a channel's members: sync once when joining with
+// every member, then join, leave and state for each change.
+type PresenceEvent struct {
+	Type    string           `json:"-"`
+	Ref     string           `json:"ref,omitempty"`     // The receiving member, on sync
+	Member  *PresenceMember  `json:"member,omitempty"`  // The member that changed
+	Members []PresenceMember `json:"members,omitempty"` // Every member, on sync
+}
+
+// presenceHub keeps the members of each presence channel, per database, in
+// server memory. Members are only known to the server their stream is on.
+type presenceHub struct {
+	mu       sync.Mutex
+	channels map[string]map[string]*presenceSub // Keyed by database ID and channel, then ref
+}
+
+type presenceSub struct {
+	member PresenceMember
+	ch     chan PresenceEvent // Closed when the member falls too far behind
+}
+
+func newPresenceHub() *presenceHub {
+	return &presenceHub{channels: map[string]map[string]*presenceSub{}}
+}
+
+// join adds a member to a channel of at most limit members and tells the
+// others. The new member's first event is a sync with everyone, itself
+// included.
+func (h *presenceHub) join(databaseID, channel, userID string, state json.RawMessage, limit int) (*presenceSub, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	key := eventKey(databaseID, channel)
+	members := h.channels[key]
+	if len(members) >= limit {
+		return nil, fmt.Errorf("%w: %s has %d members", tools.ErrPresenceFull, channel, limit)
+	}
+	if members == nil {
+		members = map[string]*presenceSub{}
+		h.channels[key] = members
+	}
+	ref := make([]byte, 8)
+	_, _ = rand.Read(ref)
+	sub := &presenceSub{
+		member: PresenceMember{Ref: hex.EncodeToString(ref), UserID: userID, State: state, JoinedAt: time.Now().UTC()},
+		ch:     make(chan PresenceEvent, presenceBuffer),
+	}
+	h.broadcast(members, PresenceEvent{Type: "join", Member: &sub.member})
+	members[sub.member.Ref] = sub
+
+	snapshot := PresenceEvent{Type: "sync", Ref: sub.member.Ref, Members: make([]PresenceMember, 0, len(members))}
+	for _, other := range members {
+		snapshot.Members = append(snapshot.Members, other.member)
+	}
+	sort.Slice(snapshot.Members, func(i, j int) bool { return snapshot.Members[i].JoinedAt.Before(snapshot.Members[j].JoinedAt) })
+	sub.ch <- snapshot
+	return sub, nil
+}
+
+// leave removes a member and tells the others.
+func (h *presenceHub) leave(databaseID, channel string, sub *presenceSub) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	key := eventKey(databaseID, channel)
+	members := h.channels[key]
+	if members[sub.member.Ref] != sub {
+		return
+	}
+	delete(members, sub.member.Ref)
+	h.broadcast(members, PresenceEvent{Type: "leave", Member: &sub.member})
+	if len(members) == 0 {
+		delete(h.channels, key)
+	}
+}
+
+// setState replaces the state of a member the user owns and tells everyone.
+func (h *presenceHub) setState(databaseID, channel, ref, userID string, state json.RawMessage) (PresenceMember, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	members := h.channels[eventKey(databaseID, channel)]
+	sub, ok := members[ref]
+	if !ok || sub.member.UserID != userID {
+		return PresenceMember{}, fmt.Errorf("%w: you have no member %q in %s", tools.ErrPresenceNotFound, ref, channel)
+	}
+	sub.member.State = state
+	member := sub.member
+	h.broadcast(members, PresenceEvent{Type: "state", Member: &member})
+	return member, nil
+}
+
+// broadcast sends an event to every member. A member whose buffer is full is
+// dropped; its stream ends and the client rejoins. Callers hold h.mu.
+func (h *presenceHub) broadcast(members map[string]*presenceSub, event PresenceEvent) {
+	var dropped []*presenceSub
+	for ref, sub := range members {
+		select {
+		case sub.ch <- event:
+		default:
+			close(sub.ch)
+			delete(members, ref)
+			dropped = append(dropped, sub)
+		}
+	}
+	for _, sub := range dropped {
+		h.broadcast(members, PresenceEvent{Type: "leave", Member: &sub.member})
+	}
+}
+
+// matchChannel returns the settings of the channel a name matches: its own
+// entry, or else the longest prefix ending in *.
+func matchChannel[T any](channels map[string]T, name string) (T, bool) {
+	if channel, ok := channels[name]; ok {
+		return channel, true
+	}
+	best, found := "", false
+	var match T
+	for pattern, channel := range channels {
+		prefix, ok := strings.CutSuffix(pattern, "*")
+		if ok && strings.HasPrefix(name, prefix) && (!found || len(prefix) > len(best)) {
+			best, match, found = prefix, channel, true
+		}
+	}
+	return match, found
+}
+
+// missingClaim returns the first claim of want the caller's token lacks or
+// carries with another value.
+func (dao *TenantConnection) missingClaim(want map[string]any) (string, bool) {
+	for claim, value := range want {
+		if got, ok := dao.Principal.Claims[claim]; !ok || !claimEqual(got, value) {
+			return claim, true
+		}
+	}
+	return "", false
+}
+
+// authorizePresence checks that the caller may join a channel and returns
+// how many members it may hold.
+func (dao *TenantConnection) authorizePresence(name string) (int, error) {
+	if !presenceChannelPattern.MatchString(name) {
+		return 0, tools.InvalidRequestErr("presence channel names are 1-128 letters, digits, _ . : or -")
+	}
+	if dao.Schema.Settings == nil {
+		return 0, fmt.Errorf("%w: %s", tools.ErrPresenceNotFound, name)
+	}
+	channel, ok := matchChannel(dao.Schema.Settings.Presence, name)
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", tools.ErrPresenceNotFound, name)
+	}
+	if dao.Principal.UserID == "" {
+		return 0, tools.UnauthorizedErr("presence channels require a signed-in user")
+	}
+	if claim, ok := dao.missingClaim(channel.Claims); ok {
+		return 0, fmt.Errorf("%w: claim %s does not match %s", tools.ErrPresenceForbidden, claim, name)
+	}
+	if channel.MaxMembers > 0 {
+		return channel.MaxMembers, nil
+	}
+	return maxPresenceMembers, nil
+}
+
+// claimEqual compares a token claim with a scalar from the settings.
+func claimEqual(got, want any) bool {
+	switch got.(type) {
+	case string, float64, bool:
+		return got == want
+	}
+	return false
+}
+
+// presenceState checks a member's state: a JSON value of at most
+// maxPresenceState bytes, null when empty.
+func presenceState(raw []byte) (json.RawMessage, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 {
+		return json.RawMessage("null"), nil
+	}
+	if len(raw) > maxPresenceState {
+		return nil, tools.InvalidRequestErr(fmt.Sprintf("presence state is larger than %d bytes", maxPresenceState))
+	}
+	if !json.Valid(raw) {
+		return nil, tools.InvalidRequestErr("presence state must be JSON")
+	}
+	var compact bytes.Buffer
+	_ = json.Compact(&compact, raw)
+	return compact.Bytes(), nil
+}
+
+// servePresence joins the caller to a channel and streams its presence
+// events as Server-Sent Events until the client disconnects, then leaves.
+func (api *API) servePresence(w http.ResponseWriter, req *http.Request, dao *TenantConnection, channel string) error {
+	limit, err := dao.authorizePresence(channel)
+	if err != nil {
+		return err
+	}
+	state, err := presenceState([]byte(req.URL.Query().Get("state")))
+	if err != nil {
+		return err
+	}
+	sub, err := api.presence.join(dao.ID, channel, dao.Principal.UserID, state, limit)
+	if err != nil {
+		return err
+	}
+	defer api.presence.leave(dao.ID, channel, sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Time{})
+	tools.LiftRequestTimeout(req.Context())
+
+	interval := time.Duration(config.Cfg.EventHeartbeatInterval) * time.Second
+	if interval <= 0 {
+		interval = 15 * time.Second
+	}
+	heartbeat := time.NewTicker(interval)
+	defer heartbeat.Stop()
+	ctx := req.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return nil
+			}
+			_ = rc.Flush()
+		case event, ok := <-sub.ch:
+			if !ok {
+				return nil
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				return nil
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+				return nil
+			}
+			_ = rc.Flush()
+		}
+	}
+}
+
+// PresenceStateRequest replaces the state of one of the caller's members.
+type PresenceStateRequest struct {
+	Ref   string          `json:"ref"`
+	State json.RawMessage `json:"state"`
+}
+
+// updatePresence sets the state of one of the caller's members in a channel.
+func (api *API) updatePresence(dao *TenantConnection, channel string, update PresenceStateRequest) (PresenceMember, error) {
+	if _, err := dao.authorizePresence(channel); err != nil {
+		return PresenceMember{}, err
+	}
+	state, err := presenceState(update.State)
+	if err != nil {
+		return PresenceMember{}, err
+	}
+	return api.presence.setState(dao.ID, channel, update.Ref, dao.Principal.UserID, state)
+}
@@ -0,0 +1,119 @@
+package data
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/atombasedev/atombase/definitions"
+	"github.com/atombasedev/atombase/tools"
+)
+
+func TestPresenceHub(t *testing.T) {
+	hub := newPresenceHub()
+	next := func(sub *presenceSub) PresenceEvent {
+		t.Helper()
+		select {
+		case event := <-sub.ch:
+			return event
+		default:
+			t.Fatal("expected an event")
+			return PresenceEvent{}
+		}
+	}
+
+	ada, err := hub.join("db", "lobby", "ada", json.RawMessage(`{"cursor":1}`), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event := next(ada); event.Type != "sync" || event.Ref != ada.member.Ref || len(event.Members) != 1 {
+		t.Fatalf("expected a sync with the joining member, got %+v", event)
+	}
+	grace, err := hub.join("db", "lobby", "grace", json.RawMessage(`null`), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event := next(ada); event.Type != "join" || event.Member.UserID != "grace" {
+		t.Errorf("expected a join, got %+v", event)
+	}
+	if event := next(grace); event.Type != "sync" || len(event.Members) != 2 || event.Members[0].UserID != "ada" {
+		t.Errorf("expected a sync with both members, got %+v", event)
+	}
+	if _, err := hub.join("db", "lobby", "eve", nil, 2); !errors.Is(err, tools.ErrPresenceFull) {
+		t.Errorf("expected a full channel to refuse, got %v", err)
+	}
+	// Channels are per database.
+	if _, err := hub.join("other-db", "lobby", "eve", nil, 2); err != nil {
+		t.Errorf("expected another database's channel to be separate, got %v", err)
+	}
+
+	if _, err := hub.setState("db", "lobby", ada.member.Ref, "grace", json.RawMessage(`{}`)); !errors.Is(err, tools.ErrPresenceNotFound) {
+		t.Errorf("expected another user's member to be refused, got %v", err)
+	}
+	if _, err := hub.setState("db", "lobby", ada.member.Ref, "ada", json.RawMessage(`{"cursor":2}`)); err != nil {
+		t.Fatal(err)
+	}
+	if event := next(grace); event.Type != "state" || string(event.Member.State) != `{"cursor":2}` {
+		t.Errorf("expected a state change, got %+v", event)
+	}
+	next(ada)
+
+	hub.leave("db", "lobby", grace)
+	if event := next(ada); event.Type != "leave" || event.Member.Ref != grace.member.Ref {
+		t.Errorf("expected a leave, got %+v", event)
+	}
+	hub.leave("db", "lobby", ada)
+	if _, ok := hub.channels[eventKey("db", "lobby")]; ok {
+		t.Error("expected an empty channel to be dropped")
+	}
+}
+
+func TestAuthorizePresence(t *testing.T) {
+	schema := SchemaCache{Settings: &APISettings{Presence: map[string]PresenceChannel{
+		"lobby":   {},
+		"doc:*":   {MaxMembers: 10},
+		"doc:hq*": {Claims: map[string]any{"team": "hq"}},
+	}}}
+	conn := func(principal definitions.Principal) *TenantConnection {
+		return &TenantConnection{Schema: schema, Principal: principal}
+	}
+	user := conn(definitions.Principal{UserID: "ada"})
+	hq := conn(definitions.Principal{UserID: "grace", Claims: map[string]any{"team": "hq"}})
+
+	if limit, err := user.authorizePresence("lobby"); err != nil || limit != maxPresenceMembers {
+		t.Errorf("lobby: got %d, %v", limit, err)
+	}
+	if limit, err := user.authorizePresence("doc:42"); err != nil || limit != 10 {
+		t.Errorf("doc:42: got %d, %v", limit, err)
+	}
+	if _, err := hq.authorizePresence("doc:hq-plans"); err != nil {
+		t.Errorf("expected the claim to allow the longest prefix, got %v", err)
+	}
+	if _, err := user.authorizePresence("doc:hq-plans"); !errors.Is(err, tools.ErrPresenceForbidden) {
+		t.Errorf("expected a missing claim to be refused, got %v", err)
+	}
+	if _, err := user.authorizePresence("kitchen"); !errors.Is(err, tools.ErrPresenceNotFound) {
+		t.Errorf("expected an undeclared channel to be unknown, got %v", err)
+	}
+	if _, err := conn(definitions.Principal{}).authorizePresence("lobby"); !errors.Is(err, tools.ErrUnauthorized) {
+		t.Errorf("expected anonymous callers to be refused, got %v", err)
+	}
+	if _, err := user.authorizePresence("lobby/1"); err == nil {
+		t.Error("expected an invalid channel name to be refused")
+	}
+}
+
+func TestPresenceState(t *testing.T) {
+	if state, err := presenceState([]byte(` { "typing" : true } `)); err != nil || string(state) != `{"typing":true}` {
+		t.Errorf("got %s, %v", state, err)
+	}
+	if state, err := presenceState(nil); err != nil || string(state) != "null" {
+		t.Errorf("expected empty state to be null, got %s, %v", state, err)
+	}
+	if _, err := presenceState([]byte(`{"typing":`)); err == nil {
+		t.Error("expected invalid JSON to be refused")
+	}
+	if _, err := presenceState(make([]byte, maxPresenceState+1)); err == nil {
+		t.Error("expected oversized state to be refused")
+	}
+}
@@ -5,9 +5,10 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"strings"
 
-	"github.com/atombasedev/atombase/config"
+	"github.com/atombasedev/atombase/definitions"
 	"github.com/atombasedev/atombase/tools"
 )
 
@@ -18,91 +19,274 @@ func (dao *TenantConnection) SelectJSON(ctx context.Context, relation string, qu
 }
 
 func (dao *TenantConnection) selectJSON(ctx context.Context, exec Executor, relation string, query SelectQuery, includeCount bool) (SelectResult, error) {
-	if err := tools.ValidateTableName(relation); err != nil {
+	plan, err := dao.prepareSelect(ctx, exec, relation, query, includeCount)
+	if err != nil {
 		return SelectResult{}, err
 	}
+	result := SelectResult{Count: plan.count}
+
+	if plan.cursorCols == nil {
+		finalQuery := fmt.Sprintf("SELECT json_group_array(%s) AS data, COUNT(*) FROM (%s)", plan.agg, plan.query)
+		finalQuery, args := applyPolicyCTE(finalQuery, plan.args, dao, strings.Contains(finalQuery, "__ab_membership"))
+		row := exec.QueryRowContext(ctx, finalQuery, args...)
+		var rows int64
+		if err := row.Scan(&result.Data, &rows); err != nil {
+			return SelectResult{}, err
+		}
+		recordQuery(ctx, plan.shape, rows)
+		result.Rows = rows
+		return result, nil
+	}
+
+	finalQuery := fmt.Sprintf("SELECT json_group_array(%s) AS data, COUNT(*), %s FROM (%s)", plan.agg, cursorKeyArray(plan.cursorCols), plan.query)
+	finalQuery, args := applyPolicyCTE(finalQuery, plan.args, dao, strings.Contains(finalQuery, "__ab_membership"))
+	row := exec.QueryRowContext(ctx, finalQuery, args...)
+	var rows int64
+	var keys []byte
+	if err := row.Scan(&result.Data, &rows, &keys); err != nil {
+		return SelectResult{}, err
+	}
+	recordQuery(ctx, plan.shape, rows)
+	result.Rows = rows
+
+	// A short page is the last one; a full page may be followed by more.
+	if plan.limit > 0 && rows == int64(plan.limit) {
+		last, err := lastCursorKeys(keys)
+		if err != nil {
+			return SelectResult{}, err
+		}
+		result.NextCursor = encodeCursor(plan.cursorCols, plan.cursorDesc, last)
+	}
+
+	return result, nil
+}
+
+// SelectNDJSON runs a select row by row, writing each row to w as one line
+// of JSON as it is scanned instead of aggregating the page in memory. begin
+// is called with the count, when asked for, before anything is written, and
+// returns the writer. It returns the number of rows written.
+func (dao *TenantConnection) SelectNDJSON(ctx context.Context, relation string, query SelectQuery, includeCount bool, begin func(count int64) io.Writer) (int64, error) {
+	if query.Cursor != nil {
+		return 0, tools.InvalidRequestErr("cursor pagination is not available for streamed selects")
+	}
+	plan, err := dao.prepareSelect(ctx, dao.Client, relation, query, includeCount)
+	if err != nil {
+		return 0, err
+	}
+
+	rowQuery := fmt.Sprintf("SELECT %s FROM (%s)", plan.agg, plan.query)
+	rowQuery, args := applyPolicyCTE(rowQuery, plan.args, dao, strings.Contains(rowQuery, "__ab_membership"))
+	rows, err := dao.Client.QueryContext(ctx, rowQuery, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	w := begin(plan.count)
+	var n int64
+	var line []byte
+	for rows.Next() {
+		if err := rows.Scan(&line); err != nil {
+			return n, err
+		}
+		line = append(line, '\n')
+		if _, err := w.Write(line); err != nil {
+			return n, err
+		}
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return n, err
+	}
+	recordQuery(ctx, plan.shape, n)
+	return n, nil
+}
+
+// selectPlan is a select built up to its final aggregation: query returns the
+// page's rows and agg turns one of them into a JSON object.
+type selectPlan struct {
+	shape      string
+	query      string
+	args       []any
+	agg        string
+	limit      int
+	count      int64
+	cursorCols []string
+	cursorDesc bool
+}
+
+// prepareSelect checks and builds a select, running the count query when asked.
+func (dao *TenantConnection) prepareSelect(ctx context.Context, exec Executor, relation string, query SelectQuery, includeCount bool) (selectPlan, error) {
+	if err := tools.ValidateTableName(relation); err != nil {
+		return selectPlan{}, err
+	}
+	shape := selectShape(relation, query)
+	tools.NoteQueryShape(ctx, shape)
+	if err := dao.Schema.checkQueryAllowed(shape); err != nil {
+		return selectPlan{}, err
+	}
+	if queryCostLimited() {
+		if err := dao.chargeQueryCost(dao.selectCost(ctx, exec, relation, query, includeCount)); err != nil {
+			return selectPlan{}, err
+		}
+	}
 
 	table, err := dao.Schema.SearchTbls(relation)
 	if err != nil {
-		return SelectResult{}, err
+		return selectPlan{}, err
+	}
+
+	// A cursor pages by key instead of OFFSET, so deep pages cost the same as
+	// the first.
+	var cursorCols []string
+	var cursorDesc bool
+	var after []any
+	if query.Cursor != nil {
+		if len(query.Join) > 0 {
+			return selectPlan{}, fmt.Errorf("%w: cursor pagination does not support custom joins", tools.ErrInvalidCursor)
+		}
+		if query.Offset != nil {
+			return selectPlan{}, fmt.Errorf("%w: cursor and offset cannot be combined", tools.ErrInvalidCursor)
+		}
+		if cursorCols, cursorDesc, err = cursorKeys(table, query.Order); err != nil {
+			return selectPlan{}, err
+		}
+		if after, err = decodeCursor(*query.Cursor, cursorCols, cursorDesc); err != nil {
+			return selectPlan{}, err
+		}
 	}
 
 	var sqlQuery, groupBy, agg string
 	var policyArgs []any
+	var rootPolicy definitions.CompiledPredicate
 
 	// Check if this is a custom join query
 	if len(query.Join) > 0 {
+		if len(query.Computed) > 0 {
+			return selectPlan{}, tools.InvalidRequestErr("computed fields cannot be combined with custom joins")
+		}
+		if query.Search != nil {
+			return selectPlan{}, tools.InvalidRequestErr("full-text search cannot be combined with custom joins")
+		}
 		// Parse and build custom join query
 		cjq, err := dao.Schema.ParseCustomJoinQuery(relation, query)
 		if err != nil {
-			return SelectResult{}, err
+			return selectPlan{}, err
 		}
 		policies, err := dao.compileCustomJoinPolicies(ctx, cjq)
 		if err != nil {
-			return SelectResult{}, err
+			return selectPlan{}, err
 		}
 
 		sqlQuery, groupBy, agg, policyArgs, err = dao.Schema.BuildCustomJoinSelect(cjq, policies)
 		if err != nil {
-			return SelectResult{}, err
+			return selectPlan{}, err
 		}
+		rootPolicy = policies[cjq.BaseTable]
 	} else {
 		// Parse select clause for implicit FK-based joins
 		rel, err := ParseSelectFromJSON(query.Select, relation)
 		if err != nil {
-			return SelectResult{}, err
+			return selectPlan{}, err
+		}
+		if rel.computed, err = compileComputed(table, query.Computed); err != nil {
+			return selectPlan{}, err
+		}
+		if err := compileWindows(table, &rel); err != nil {
+			return selectPlan{}, err
+		}
+		if err := dao.Schema.localizeSelect(&rel, table, query.Lang); err != nil {
+			return selectPlan{}, err
+		}
+		if query.Search != nil {
+			join, fields, err := dao.Schema.compileSearch(table, query.Search)
+			if err != nil {
+				return selectPlan{}, err
+			}
+			for _, field := range fields {
+				for _, col := range rel.computed {
+					if col.name == field.name {
+						return selectPlan{}, tools.InvalidRequestErr(fmt.Sprintf("search field %q conflicts with a computed field", field.name))
+					}
+				}
+			}
+			rel.computed = append(rel.computed, fields...)
+			rel.search = &relationSearch{join: join, args: []any{query.Search.Query}}
+		}
+		for _, col := range rel.computed {
+			for _, join := range rel.joins {
+				if col.name == join.name || col.name == join.alias {
+					return selectPlan{}, tools.InvalidRequestErr(fmt.Sprintf("computed field %q conflicts with a relation", col.name))
+				}
+			}
 		}
 		policies, err := dao.compileSelectPolicies(ctx, rel)
 		if err != nil {
-			return SelectResult{}, err
+			return selectPlan{}, err
 		}
 
 		// Build SELECT query
-		sqlQuery, agg, policyArgs, err = dao.Schema.buildSelect(rel, policies)
+		sqlQuery, groupBy, agg, policyArgs, err = dao.Schema.buildSelect(rel, policies)
 		if err != nil {
-			return SelectResult{}, err
+			return selectPlan{}, err
+		}
+		rootPolicy = policies[rel.name]
+		if cursorCols != nil {
+			sqlQuery = "SELECT " + cursorSelectColumns(relation, cursorCols) + ", " + strings.TrimPrefix(sqlQuery, "SELECT ")
 		}
 	}
 
 	// Build WHERE clause
+	if err := dao.Schema.checkAllowedOperators(query.Where); err != nil {
+		return selectPlan{}, err
+	}
 	where, args, err := table.BuildWhereFromJSON(query.Where, dao.Schema)
 	if err != nil {
-		return SelectResult{}, err
+		return selectPlan{}, err
 	}
-	args = append(args, policyArgs...)
+	where = dao.Schema.excludeSoftDeleted(where, relation)
+	where, args = appendPolicyWhere(where, args, rootPolicy)
+	// Join policies sit in the FROM clause, ahead of the WHERE arguments.
+	args = append(policyArgs, args...)
 
 	// Build query in correct SQL order: SELECT...FROM...JOIN + WHERE + GROUP BY
 	baseQuery := sqlQuery + where + groupBy
-
-	var result SelectResult
+	if err := dao.guardFullScan(ctx, exec, query.Where, baseQuery, args); err != nil {
+		return selectPlan{}, err
+	}
 
 	// Get count if requested
+	var count int64
 	if includeCount {
 		countQuery := fmt.Sprintf("SELECT COUNT(*) FROM (%s)", baseQuery)
 		countQuery, countArgs := applyPolicyCTE(countQuery, args, dao, strings.Contains(countQuery, "__ab_membership"))
 		row := exec.QueryRowContext(ctx, countQuery, countArgs...)
-		if err := row.Scan(&result.Count); err != nil {
-			return SelectResult{}, err
+		if err := row.Scan(&count); err != nil {
+			return selectPlan{}, err
 		}
 	}
 
+	// The count covers every matching row, not only those after the cursor.
+	if after != nil {
+		where, args = appendCursorWhere(where, args, relation, cursorCols, cursorDesc, after)
+		baseQuery = sqlQuery + where + groupBy
+	}
+
 	// Add ordering
-	if query.Order != nil {
+	if cursorCols != nil {
+		baseQuery += cursorOrder(relation, cursorCols, cursorDesc)
+	} else if query.Order != nil {
 		order, err := table.BuildOrderFromJSON(query.Order)
 		if err != nil {
-			return SelectResult{}, err
+			return selectPlan{}, err
 		}
 		baseQuery += order
+	} else if query.Search != nil {
+		baseQuery += searchOrder()
 	}
 
 	// Handle pagination
-	limit := config.Cfg.DefaultLimit
-	if query.Limit != nil && *query.Limit >= 0 {
-		limit = *query.Limit
-	}
-	if config.Cfg.MaxQueryLimit > 0 && (limit > config.Cfg.MaxQueryLimit || limit == 0) {
-		limit = config.Cfg.MaxQueryLimit
-	}
+	limit := dao.Schema.selectLimit(query.Limit)
 
 	offset := 0
 	if query.Offset != nil && *query.Offset >= 0 {
@@ -116,14 +300,16 @@ func (dao *TenantConnection) selectJSON(ctx context.Context, exec Executor, rela
 		baseQuery += fmt.Sprintf("OFFSET %d ", offset)
 	}
 
-	finalQuery := fmt.Sprintf("SELECT json_group_array(%s) AS data FROM (%s)", agg, baseQuery)
-	finalQuery, args = applyPolicyCTE(finalQuery, args, dao, strings.Contains(finalQuery, "__ab_membership"))
-	row := exec.QueryRowContext(ctx, finalQuery, args...)
-	if err := row.Scan(&result.Data); err != nil {
-		return SelectResult{}, err
-	}
-
-	return result, nil
+	return selectPlan{
+		shape:      shape,
+		query:      baseQuery,
+		args:       args,
+		agg:        agg,
+		limit:      limit,
+		count:      count,
+		cursorCols: cursorCols,
+		cursorDesc: cursorDesc,
+	}, nil
 }
 
 // InsertJSON inserts a single row using JSON body format.
@@ -136,6 +322,16 @@ func (dao *TenantConnection) insertJSON(ctx context.Context, exec Executor, rela
 	if err := tools.ValidateTableName(relation); err != nil {
 		return nil, err
 	}
+	shape := insertShape("insert", relation, req.Data, req.Returning)
+	tools.NoteQueryShape(ctx, shape)
+	if err := dao.Schema.checkQueryAllowed(shape); err != nil {
+		return nil, err
+	}
+	if queryCostLimited() {
+		if err := dao.chargeQueryCost(insertCost(len(req.Data))); err != nil {
+			return nil, err
+		}
+	}
 
 	table, err := dao.Schema.SearchTbls(relation)
 	if err != nil {
@@ -149,6 +345,13 @@ func (dao *TenantConnection) insertJSON(ctx context.Context, exec Executor, rela
 	if len(req.Data[0]) == 0 {
 		return nil, errors.New("insert rows must have at least one column")
 	}
+	if err := dao.Schema.validateWrite(relation, "insert", req.Data); err != nil {
+		return nil, err
+	}
+	req.Data, err = dao.stampRowTenant(req.Data)
+	if err != nil {
+		return nil, err
+	}
 	policy, err := dao.compilePolicy(ctx, relation, "insert", req.Data[0])
 	if err != nil {
 		return nil, err
@@ -165,6 +368,10 @@ func (dao *TenantConnection) insertJSON(ctx context.Context, exec Executor, rela
 
 	query, args := buildInsertSelectSQL("INSERT", relation, columns, req.Data, policy)
 
+	if dao.watchingChanges(ctx, relation) {
+		return dao.writeWithChanges(ctx, exec, table, shape, ChangeInsert, query, args, policy, req.Returning, true)
+	}
+
 	if len(req.Returning) > 0 {
 		retQuery, err := table.BuildReturningFromJSON(req.Returning)
 		if err != nil {
@@ -172,7 +379,11 @@ func (dao *TenantConnection) insertJSON(ctx context.Context, exec Executor, rela
 		}
 		query += retQuery
 		query, args = applyPolicyCTE(query, args, dao, policy.NeedsMembershipCTE)
-		return dao.queryJSONWithExec(ctx, exec, query, args...)
+		data, err := dao.queryJSONWithExec(ctx, exec, query, args...)
+		if err == nil {
+			recordQuery(ctx, shape, int64(len(req.Data)))
+		}
+		return data, err
 	}
 
 	query, args = applyPolicyCTE(query, args, dao, policy.NeedsMembershipCTE)
@@ -185,6 +396,7 @@ func (dao *TenantConnection) insertJSON(ctx context.Context, exec Executor, rela
 	if err != nil {
 		return nil, fmt.Errorf("failed to get last insert id: %w", err)
 	}
+	recordQuery(ctx, shape, int64(len(req.Data)))
 	return json.Marshal(map[string]any{"last_insert_id": lastInsertId})
 }
 
@@ -198,6 +410,16 @@ func (dao *TenantConnection) insertIgnoreJSON(ctx context.Context, exec Executor
 	if err := tools.ValidateTableName(relation); err != nil {
 		return nil, err
 	}
+	shape := insertShape("insert-ignore", relation, req.Data, req.Returning)
+	tools.NoteQueryShape(ctx, shape)
+	if err := dao.Schema.checkQueryAllowed(shape); err != nil {
+		return nil, err
+	}
+	if queryCostLimited() {
+		if err := dao.chargeQueryCost(insertCost(len(req.Data))); err != nil {
+			return nil, err
+		}
+	}
 
 	table, err := dao.Schema.SearchTbls(relation)
 	if err != nil {
@@ -211,6 +433,13 @@ func (dao *TenantConnection) insertIgnoreJSON(ctx context.Context, exec Executor
 	if len(req.Data[0]) == 0 {
 		return nil, errors.New("insert rows must have at least one column")
 	}
+	if err := dao.Schema.validateWrite(relation, "insert", req.Data); err != nil {
+		return nil, err
+	}
+	req.Data, err = dao.stampRowTenant(req.Data)
+	if err != nil {
+		return nil, err
+	}
 	policy, err := dao.compilePolicy(ctx, relation, "insert", req.Data[0])
 	if err != nil {
 		return nil, err
@@ -227,6 +456,10 @@ func (dao *TenantConnection) insertIgnoreJSON(ctx context.Context, exec Executor
 
 	query, args := buildInsertSelectSQL("INSERT OR IGNORE", relation, columns, req.Data, policy)
 
+	if dao.watchingChanges(ctx, relation) {
+		return dao.writeWithChanges(ctx, exec, table, shape, ChangeInsert, query, args, policy, req.Returning, false)
+	}
+
 	if len(req.Returning) > 0 {
 		retQuery, err := table.BuildReturningFromJSON(req.Returning)
 		if err != nil {
@@ -234,7 +467,11 @@ func (dao *TenantConnection) insertIgnoreJSON(ctx context.Context, exec Executor
 		}
 		query += retQuery
 		query, args = applyPolicyCTE(query, args, dao, policy.NeedsMembershipCTE)
-		return dao.queryJSONWithExec(ctx, exec, query, args...)
+		data, err := dao.queryJSONWithExec(ctx, exec, query, args...)
+		if err == nil {
+			recordQuery(ctx, shape, int64(len(req.Data)))
+		}
+		return data, err
 	}
 
 	query, args = applyPolicyCTE(query, args, dao, policy.NeedsMembershipCTE)
@@ -247,19 +484,35 @@ func (dao *TenantConnection) insertIgnoreJSON(ctx context.Context, exec Executor
 	if err != nil {
 		return nil, fmt.Errorf("failed to get rows affected: %w", err)
 	}
+	recordQuery(ctx, shape, rowsAffected)
 	return json.Marshal(map[string]any{"rows_affected": rowsAffected})
 }
 
-// UpsertJSON inserts multiple rows, updating on conflict.
+// UpsertJSON inserts multiple rows, updating on conflict, or leaving the
+// existing rows alone with IgnoreDuplicates.
 // POST /data/query/{table} with Prefer: on-conflict=replace
 func (dao *TenantConnection) UpsertJSON(ctx context.Context, relation string, req UpsertRequest) ([]byte, error) {
-	return dao.upsertJSON(ctx, dao.Client, relation, req)
+	return dao.upsertJSON(ctx, dao.Client, relation, dao.withConflictRule(relation, req))
 }
 
 func (dao *TenantConnection) upsertJSON(ctx context.Context, exec Executor, relation string, req UpsertRequest) ([]byte, error) {
 	if err := tools.ValidateTableName(relation); err != nil {
 		return nil, err
 	}
+	operation, change := "upsert", ChangeUpsert
+	if req.IgnoreDuplicates {
+		operation, change = "insert-ignore", ChangeInsert
+	}
+	shape := insertShape(operation, relation, req.Data, req.Returning)
+	tools.NoteQueryShape(ctx, shape)
+	if err := dao.Schema.checkQueryAllowed(shape); err != nil {
+		return nil, err
+	}
+	if queryCostLimited() {
+		if err := dao.chargeQueryCost(insertCost(len(req.Data))); err != nil {
+			return nil, err
+		}
+	}
 
 	table, err := dao.Schema.SearchTbls(relation)
 	if err != nil {
@@ -273,6 +526,13 @@ func (dao *TenantConnection) upsertJSON(ctx context.Context, exec Executor, rela
 	if len(req.Data[0]) == 0 {
 		return nil, errors.New("upsert rows must have at least one column")
 	}
+	if err := dao.Schema.validateWrite(relation, "insert", req.Data); err != nil {
+		return nil, err
+	}
+	req.Data, err = dao.stampRowTenant(req.Data)
+	if err != nil {
+		return nil, err
+	}
 	policy, err := dao.compilePolicy(ctx, relation, "insert", req.Data[0])
 	if err != nil {
 		return nil, err
@@ -289,21 +549,29 @@ func (dao *TenantConnection) upsertJSON(ctx context.Context, exec Executor, rela
 
 	query, args := buildInsertSelectSQL("INSERT", relation, columns, req.Data, policy)
 
-	if len(table.Pk) == 0 {
-		query += " ON CONFLICT(rowid) DO UPDATE SET "
+	target, err := conflictTarget(table, req.OnConflict)
+	if err != nil {
+		return nil, err
+	}
+	if req.IgnoreDuplicates {
+		query += fmt.Sprintf(" ON CONFLICT(%s) DO NOTHING ", target)
 	} else {
-		pkCols := make([]string, len(table.Pk))
-		for i, col := range table.Pk {
-			pkCols[i] = fmt.Sprintf("[%s]", col)
+		query += fmt.Sprintf(" ON CONFLICT(%s) DO UPDATE SET ", target)
+		for _, col := range columns {
+			query += fmt.Sprintf("[%s] = excluded.[%s], ", col, col)
 		}
-		query += fmt.Sprintf(" ON CONFLICT(%s) DO UPDATE SET ", strings.Join(pkCols, ", "))
-	}
 
-	for _, col := range columns {
-		query += fmt.Sprintf("[%s] = excluded.[%s], ", col, col)
+		query = query[:len(query)-2] + " "
+		conflictWhere, err := dao.rowTenantConflictClause(relation)
+		if err != nil {
+			return nil, err
+		}
+		query += conflictWhere
 	}
 
-	query = query[:len(query)-2] + " "
+	if dao.watchingChanges(ctx, relation) {
+		return dao.writeWithChanges(ctx, exec, table, shape, change, query, args, policy, req.Returning, false)
+	}
 
 	if len(req.Returning) > 0 {
 		retQuery, err := table.BuildReturningFromJSON(req.Returning)
@@ -312,7 +580,11 @@ func (dao *TenantConnection) upsertJSON(ctx context.Context, exec Executor, rela
 		}
 		query += retQuery
 		query, args = applyPolicyCTE(query, args, dao, policy.NeedsMembershipCTE)
-		return dao.queryJSONWithExec(ctx, exec, query, args...)
+		data, err := dao.queryJSONWithExec(ctx, exec, query, args...)
+		if err == nil {
+			recordQuery(ctx, shape, int64(len(req.Data)))
+		}
+		return data, err
 	}
 
 	query, args = applyPolicyCTE(query, args, dao, policy.NeedsMembershipCTE)
@@ -325,12 +597,38 @@ func (dao *TenantConnection) upsertJSON(ctx context.Context, exec Executor, rela
 	if err != nil {
 		return nil, fmt.Errorf("failed to get rows affected: %w", err)
 	}
+	recordQuery(ctx, shape, rowsAffected)
 	return json.Marshal(map[string]any{"rows_affected": rowsAffected})
 }
 
+// conflictTarget renders the ON CONFLICT target of an upsert: the given
+// columns, else the primary key, else rowid. SQLite refuses columns that are
+// not exactly a primary key or unique constraint.
+func conflictTarget(table CacheTable, columns []string) (string, error) {
+	if len(columns) == 0 {
+		columns = table.Pk
+	}
+	if len(columns) == 0 {
+		return "rowid", nil
+	}
+	quoted := make([]string, len(columns))
+	for i, col := range columns {
+		if _, err := table.SearchCols(col); err != nil {
+			return "", err
+		}
+		quoted[i] = fmt.Sprintf("[%s]", col)
+	}
+	return strings.Join(quoted, ", "), nil
+}
+
 // UpdateJSON modifies rows using JSON body format.
 // PATCH /data/query/{table}
 func (dao *TenantConnection) UpdateJSON(ctx context.Context, relation string, req UpdateRequest) ([]byte, error) {
+	if req.Rows != nil {
+		return dao.inTransaction(ctx, func(tx Executor) ([]byte, error) {
+			return dao.updateRowsJSON(ctx, tx, relation, req)
+		})
+	}
 	return dao.updateJSON(ctx, dao.Client, relation, req)
 }
 
@@ -338,6 +636,19 @@ func (dao *TenantConnection) updateJSON(ctx context.Context, exec Executor, rela
 	if err := tools.ValidateTableName(relation); err != nil {
 		return nil, err
 	}
+	if req.Rows != nil {
+		return dao.updateRowsJSON(ctx, exec, relation, req)
+	}
+	shape := updateShape(relation, req)
+	tools.NoteQueryShape(ctx, shape)
+	if err := dao.Schema.checkQueryAllowed(shape); err != nil {
+		return nil, err
+	}
+	if queryCostLimited() {
+		if err := dao.chargeQueryCost(dao.writeCost(ctx, exec, relation, req.Where)); err != nil {
+			return nil, err
+		}
+	}
 
 	table, err := dao.Schema.SearchTbls(relation)
 	if err != nil {
@@ -347,6 +658,12 @@ func (dao *TenantConnection) updateJSON(ctx context.Context, exec Executor, rela
 	if len(req.Data) == 0 {
 		return nil, errors.New("update requires at least one column")
 	}
+	if err := dao.Schema.validateWrite(relation, "update", []map[string]any{req.Data}); err != nil {
+		return nil, err
+	}
+	if err := dao.checkRowTenantUpdate(req.Data); err != nil {
+		return nil, err
+	}
 
 	query := fmt.Sprintf("UPDATE [%s] SET ", relation)
 	var args []any
@@ -367,6 +684,9 @@ func (dao *TenantConnection) updateJSON(ctx context.Context, exec Executor, rela
 	}
 	query += " "
 
+	if err := dao.Schema.checkAllowedOperators(req.Where); err != nil {
+		return nil, err
+	}
 	where, whereArgs, err := table.BuildWhereFromJSON(req.Where, dao.Schema)
 	if err != nil {
 		return nil, err
@@ -375,6 +695,7 @@ func (dao *TenantConnection) updateJSON(ctx context.Context, exec Executor, rela
 	if where == "" {
 		return nil, tools.ErrMissingWhereClause
 	}
+	where = dao.Schema.excludeSoftDeleted(where, relation)
 	policy, err := dao.compilePolicy(ctx, relation, "update", req.Data)
 	if err != nil {
 		return nil, err
@@ -382,8 +703,25 @@ func (dao *TenantConnection) updateJSON(ctx context.Context, exec Executor, rela
 	where, whereArgs = appendPolicyWhere(where, whereArgs, policy)
 	query += where
 	args = append(args, whereArgs...)
-	query, args = applyPolicyCTE(query, args, dao, policy.NeedsMembershipCTE)
+	if err := dao.guardFullScan(ctx, exec, req.Where, query, args); err != nil {
+		return nil, err
+	}
+
+	if dao.watchingChanges(ctx, relation) {
+		return dao.writeWithChanges(ctx, exec, table, shape, ChangeUpdate, query, args, policy, req.Returning, false)
+	}
 
+	if len(req.Returning) > 0 {
+		retQuery, err := table.BuildReturningFromJSON(req.Returning)
+		if err != nil {
+			return nil, err
+		}
+		query += retQuery
+		query, args = applyPolicyCTE(query, args, dao, policy.NeedsMembershipCTE)
+		return dao.returningJSONWithExec(ctx, exec, shape, query, args...)
+	}
+
+	query, args = applyPolicyCTE(query, args, dao, policy.NeedsMembershipCTE)
 	result, err := ExecContextWithRetry(ctx, exec, query, args...)
 	if err != nil {
 		return nil, err
@@ -393,12 +731,18 @@ func (dao *TenantConnection) updateJSON(ctx context.Context, exec Executor, rela
 	if err != nil {
 		return nil, fmt.Errorf("failed to get rows affected: %w", err)
 	}
+	recordQuery(ctx, shape, rowsAffected)
 	return json.Marshal(map[string]any{"rows_affected": rowsAffected})
 }
 
 // DeleteJSON removes rows using JSON body format.
 // DELETE /data/query/{table}
 func (dao *TenantConnection) DeleteJSON(ctx context.Context, relation string, req DeleteRequest) ([]byte, error) {
+	if req.Rows != nil {
+		return dao.inTransaction(ctx, func(tx Executor) ([]byte, error) {
+			return dao.deleteRowsJSON(ctx, tx, relation, req)
+		})
+	}
 	return dao.deleteJSON(ctx, dao.Client, relation, req)
 }
 
@@ -406,14 +750,34 @@ func (dao *TenantConnection) deleteJSON(ctx context.Context, exec Executor, rela
 	if err := tools.ValidateTableName(relation); err != nil {
 		return nil, err
 	}
+	if req.Rows != nil {
+		return dao.deleteRowsJSON(ctx, exec, relation, req)
+	}
+	shape := deleteShape(relation, req)
+	tools.NoteQueryShape(ctx, shape)
+	if err := dao.Schema.checkQueryAllowed(shape); err != nil {
+		return nil, err
+	}
+	if queryCostLimited() {
+		if err := dao.chargeQueryCost(dao.writeCost(ctx, exec, relation, req.Where)); err != nil {
+			return nil, err
+		}
+	}
 
 	table, err := dao.Schema.SearchTbls(relation)
 	if err != nil {
 		return nil, err
 	}
 
+	// Soft deleted tables stamp their delete column instead of removing rows.
 	query := fmt.Sprintf("DELETE FROM [%s] ", relation)
+	if column := dao.Schema.softDeleteColumn(relation); column != "" {
+		query = fmt.Sprintf("UPDATE [%s] SET [%s] = CURRENT_TIMESTAMP ", relation, column)
+	}
 
+	if err := dao.Schema.checkAllowedOperators(req.Where); err != nil {
+		return nil, err
+	}
 	where, args, err := table.BuildWhereFromJSON(req.Where, dao.Schema)
 	if err != nil {
 		return nil, err
@@ -422,14 +786,32 @@ func (dao *TenantConnection) deleteJSON(ctx context.Context, exec Executor, rela
 	if where == "" {
 		return nil, tools.ErrMissingWhereClause
 	}
+	where = dao.Schema.excludeSoftDeleted(where, relation)
 	policy, err := dao.compilePolicy(ctx, relation, "delete", nil)
 	if err != nil {
 		return nil, err
 	}
 	where, args = appendPolicyWhere(where, args, policy)
 	query += where
-	query, args = applyPolicyCTE(query, args, dao, policy.NeedsMembershipCTE)
+	if err := dao.guardFullScan(ctx, exec, req.Where, query, args); err != nil {
+		return nil, err
+	}
+
+	if dao.watchingChanges(ctx, relation) {
+		return dao.writeWithChanges(ctx, exec, table, shape, ChangeDelete, query, args, policy, req.Returning, false)
+	}
+
+	if len(req.Returning) > 0 {
+		retQuery, err := table.BuildReturningFromJSON(req.Returning)
+		if err != nil {
+			return nil, err
+		}
+		query += retQuery
+		query, args = applyPolicyCTE(query, args, dao, policy.NeedsMembershipCTE)
+		return dao.returningJSONWithExec(ctx, exec, shape, query, args...)
+	}
 
+	query, args = applyPolicyCTE(query, args, dao, policy.NeedsMembershipCTE)
 	result, err := ExecContextWithRetry(ctx, exec, query, args...)
 	if err != nil {
 		return nil, err
@@ -439,9 +821,27 @@ func (dao *TenantConnection) deleteJSON(ctx context.Context, exec Executor, rela
 	if err != nil {
 		return nil, fmt.Errorf("failed to get rows affected: %w", err)
 	}
+	recordQuery(ctx, shape, rowsAffected)
 	return json.Marshal(map[string]any{"rows_affected": rowsAffected})
 }
 
+// returningJSONWithExec runs an update or delete with a RETURNING clause and
+// records it against the number of rows it returned.
+func (dao *TenantConnection) returningJSONWithExec(ctx context.Context, exec Executor, shape, query string, args ...any) ([]byte, error) {
+	rows, err := exec.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results, err := tools.ScanRows(rows)
+	if err != nil {
+		return nil, err
+	}
+	recordQuery(ctx, shape, int64(len(results)))
+	return json.Marshal(results)
+}
+
 // queryJSONWithExec executes a query and returns JSON results using the provided executor.
 func (dao *TenantConnection) queryJSONWithExec(ctx context.Context, exec Executor, query string, args ...any) ([]byte, error) {
 	rows, err := exec.QueryContext(ctx, query, args...)
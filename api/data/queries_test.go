@@ -4,9 +4,13 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"strings"
 	"testing"
 
+	"github.com/atombasedev/atombase/tools"
+
 	_ "github.com/mattn/go-sqlite3"
 )
 
@@ -123,6 +127,16 @@ func TestBuildWhereFromJSON_Operators(t *testing.T) {
 		{"not in", []map[string]any{{"status": map[string]any{"not": map[string]any{"in": []any{"banned"}}}}}, "NOT IN", 1, false},
 		{"not is null", []map[string]any{{"email": map[string]any{"not": map[string]any{"is": nil}}}}, "IS NOT NULL", 0, false},
 		{"not like", []map[string]any{{"name": map[string]any{"not": map[string]any{"like": "%test%"}}}}, "NOT LIKE", 1, false},
+		{"not gt", []map[string]any{{"age": map[string]any{"not": map[string]any{"gt": 18}}}}, "NOT ([users].[age] > ?)", 1, false},
+		{"not between", []map[string]any{{"age": map[string]any{"not": map[string]any{"between": []any{18, 65}}}}}, "NOT ([users].[age] BETWEEN ? AND ?)", 2, false},
+		{"not not eq", []map[string]any{{"id": map[string]any{"not": map[string]any{"not": map[string]any{"eq": 5}}}}}, "NOT ([users].[id] != ?)", 1, false},
+		{"not ilike", []map[string]any{{"name": map[string]any{"not": map[string]any{"ilike": "%test%"}}}}, "NOT (LOWER([users].[name]) LIKE LOWER(?)", 1, false},
+
+		// ilike and is
+		{"ilike", []map[string]any{{"name": map[string]any{"ilike": "%smith%"}}}, "LOWER([users].[name]) LIKE LOWER(?)", 1, false},
+		{"is true", []map[string]any{{"status": map[string]any{"is": true}}}, "IS TRUE", 0, false},
+		{"not is false", []map[string]any{{"status": map[string]any{"not": map[string]any{"is": "false"}}}}, "IS NOT FALSE", 0, false},
+		{"is rejects other values", []map[string]any{{"status": map[string]any{"is": "1 OR 1=1"}}}, "", 0, true},
 
 		// Invalid operator
 		{"invalid op", []map[string]any{{"id": map[string]any{"invalid": 5}}}, "", 0, true},
@@ -188,6 +202,45 @@ func TestBuildWhereFromJSON_OrConditions(t *testing.T) {
 	}
 }
 
+func TestBuildWhereFromJSON_NestedGroups(t *testing.T) {
+	db := setupTestDB(t, schemaUsers)
+	defer db.Close()
+	schema := loadSchema(t, db)
+	table := schema.Tables["users"]
+
+	where := []map[string]any{
+		{"or": []any{
+			map[string]any{"status": map[string]any{"eq": "admin"}},
+			map[string]any{"and": []any{
+				map[string]any{"age": map[string]any{"gte": 18}},
+				map[string]any{"age": map[string]any{"lt": 65}},
+			}},
+		}},
+	}
+	sql, args, err := table.BuildWhereFromJSON(where, schema)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(sql, "OR (") || !strings.Contains(sql, " AND ") {
+		t.Errorf("expected a nested AND inside OR: %s", sql)
+	}
+	if len(args) != 3 {
+		t.Errorf("expected 3 args, got %d", len(args))
+	}
+
+	if _, _, err := table.BuildWhereFromJSON([]map[string]any{{"and": []any{}}}, schema); err == nil {
+		t.Error("expected an empty group to be rejected")
+	}
+
+	deep := map[string]any{"age": map[string]any{"eq": 1}}
+	for i := 0; i <= MaxFilterDepth; i++ {
+		deep = map[string]any{"or": []any{deep}}
+	}
+	if _, _, err := table.BuildWhereFromJSON([]map[string]any{deep}, schema); !errors.Is(err, tools.ErrQueryTooDeep) {
+		t.Errorf("expected ErrQueryTooDeep, got %v", err)
+	}
+}
+
 func TestBuildWhereFromJSON_ColumnReference(t *testing.T) {
 	db := setupTestDB(t, `
 		CREATE TABLE posts (
@@ -486,6 +539,55 @@ func TestUpsertJSON_AllPKColumnsPresent(t *testing.T) {
 	}
 }
 
+func TestUpsertJSON_ConflictTarget(t *testing.T) {
+	db := setupTestDB(t, schemaUsers)
+	defer db.Close()
+	dao := &TenantConnection{Client: db, Schema: loadSchema(t, db)}
+	ctx := context.Background()
+
+	if _, err := db.Exec(`INSERT INTO users (id, name, email) VALUES (1, 'Alice', 'alice@example.com')`); err != nil {
+		t.Fatal(err)
+	}
+	// A sync client knows the email but not the server's id.
+	if _, err := dao.UpsertJSON(ctx, "users", UpsertRequest{
+		Data:       RowData{{"name": "Alice Smith", "email": "alice@example.com"}},
+		OnConflict: []string{"email"},
+	}); err != nil {
+		t.Fatalf("upsert on email failed: %v", err)
+	}
+	if _, err := dao.UpsertJSON(ctx, "users", UpsertRequest{
+		Data:             RowData{{"name": "Ignored", "email": "alice@example.com"}, {"name": "Bob", "email": "bob@example.com"}},
+		OnConflict:       []string{"email"},
+		IgnoreDuplicates: true,
+	}); err != nil {
+		t.Fatalf("upsert ignoring duplicates failed: %v", err)
+	}
+	rows, err := db.Query(`SELECT id, name FROM users ORDER BY id`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var got []string
+	for rows.Next() {
+		var id int
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, fmt.Sprintf("%d:%s", id, name))
+	}
+	if strings.Join(got, ",") != "1:Alice Smith,2:Bob" {
+		t.Fatalf("expected alice updated in place and bob added, got %v", got)
+	}
+
+	if _, err := dao.UpsertJSON(ctx, "users", UpsertRequest{
+		Data:       RowData{{"name": "Carol", "email": "carol@example.com"}},
+		OnConflict: []string{"missing"},
+	}); err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Fatalf("expected an unknown conflict column to fail, got %v", err)
+	}
+}
+
 // =============================================================================
 // Update/Delete Require WHERE Clause
 // Criteria B: validation edge case
@@ -532,6 +634,67 @@ func TestDeleteJSON_RequiresWhereClause(t *testing.T) {
 	}
 }
 
+// =============================================================================
+// RETURNING on writes
+// =============================================================================
+
+func TestWriteJSON_ReturningFullRows(t *testing.T) {
+	db := setupTestDB(t, schemaUsers)
+	defer db.Close()
+	schema := loadSchema(t, db)
+
+	dao := &TenantConnection{
+		Client: db,
+		Schema: schema,
+	}
+	ctx := context.Background()
+
+	decode := func(raw []byte, err error) []map[string]any {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var rows []map[string]any
+		if err := json.Unmarshal(raw, &rows); err != nil {
+			t.Fatalf("failed to parse response %s: %v", raw, err)
+		}
+		return rows
+	}
+
+	// The default status is filled in by SQLite and comes back with the row.
+	rows := decode(dao.UpsertJSON(ctx, "users", UpsertRequest{
+		Data:      []map[string]any{{"id": 1, "name": "Alice", "age": 30}},
+		Returning: []string{"*"},
+	}))
+	if len(rows) != 1 || rows[0]["status"] != "active" || rows[0]["name"] != "Alice" {
+		t.Fatalf("unexpected upsert rows: %v", rows)
+	}
+
+	rows = decode(dao.UpdateJSON(ctx, "users", UpdateRequest{
+		Data:      map[string]any{"age": 31},
+		Where:     []map[string]any{{"id": map[string]any{"eq": 1}}},
+		Returning: []string{"*"},
+	}))
+	if len(rows) != 1 || rows[0]["age"] != float64(31) || rows[0]["status"] != "active" {
+		t.Fatalf("unexpected update rows: %v", rows)
+	}
+
+	rows = decode(dao.DeleteJSON(ctx, "users", DeleteRequest{
+		Where:     []map[string]any{{"id": map[string]any{"eq": 1}}},
+		Returning: []string{"id", "name"},
+	}))
+	if len(rows) != 1 || rows[0]["name"] != "Alice" || len(rows[0]) != 2 {
+		t.Fatalf("unexpected delete rows: %v", rows)
+	}
+
+	if _, err := dao.DeleteJSON(ctx, "users", DeleteRequest{
+		Where:     []map[string]any{{"id": map[string]any{"eq": 1}}},
+		Returning: []string{"nope"},
+	}); err == nil {
+		t.Fatal("expected an unknown returning column to be rejected")
+	}
+}
+
 // =============================================================================
 // Batch Transaction Atomicity
 // Criteria C: complex context - transaction rollback
@@ -579,6 +742,61 @@ func TestBatch_TransactionRollback(t *testing.T) {
 	}
 }
 
+func TestBatch_Snapshot(t *testing.T) {
+	db := setupTestDB(t, schemaUsers)
+	defer db.Close()
+	if _, err := db.Exec(`INSERT INTO users (id, name) VALUES (1, 'Alice'), (2, 'Bob')`); err != nil {
+		t.Fatal(err)
+	}
+	dao := &TenantConnection{Client: db, Schema: loadSchema(t, db)}
+	ctx := context.Background()
+
+	resp, err := dao.Batch(ctx, BatchRequest{Snapshot: true, Operations: []BatchOperation{
+		{Operation: "select", Table: "users", Body: map[string]any{"select": []any{"id"}}, Count: true},
+		{Operation: "select", Table: "users", Body: map[string]any{"where": []any{map[string]any{"id": map[string]any{"eq": 2}}}}},
+	}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if counted, ok := resp.Results[0].(map[string]any); !ok || counted["count"] != int64(2) {
+		t.Errorf("unexpected first result: %v", resp.Results[0])
+	}
+	if rows, ok := resp.Results[1].([]any); !ok || len(rows) != 1 {
+		t.Errorf("unexpected second result: %v", resp.Results[1])
+	}
+
+	_, err = dao.Batch(ctx, BatchRequest{Snapshot: true, Operations: []BatchOperation{
+		{Operation: "select", Table: "users", Body: map[string]any{}},
+		{Operation: "delete", Table: "users", Body: map[string]any{"where": []any{map[string]any{"id": map[string]any{"eq": 1}}}}},
+	}})
+	if err == nil || !strings.Contains(err.Error(), "snapshot batches can only select") {
+		t.Fatalf("expected writes to be refused in a snapshot batch, got %v", err)
+	}
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM users").Scan(&count); err != nil || count != 2 {
+		t.Fatalf("expected both users to remain, got %d (%v)", count, err)
+	}
+}
+
+func TestBatch_WriteReturningRows(t *testing.T) {
+	db := setupTestDB(t, schemaUsers)
+	defer db.Close()
+	dao := &TenantConnection{Client: db, Schema: loadSchema(t, db)}
+
+	resp, err := dao.Batch(context.Background(), BatchRequest{Operations: []BatchOperation{
+		{Operation: "insert", Table: "users", Body: map[string]any{"data": []any{map[string]any{"id": 1, "name": "Alice"}}, "returning": []any{"*"}}},
+		{Operation: "update", Table: "users", Body: map[string]any{"data": map[string]any{"age": 40}, "where": []any{map[string]any{"id": map[string]any{"eq": 1}}}, "returning": []any{"age"}}},
+	}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i, result := range resp.Results {
+		if rows, ok := result.([]any); !ok || len(rows) != 1 {
+			t.Errorf("operation %d: expected one returned row, got %v", i, result)
+		}
+	}
+}
+
 // =============================================================================
 // opToSQL Tests
 // Criteria A: unlikely to change, operator mapping
@@ -595,6 +813,8 @@ func TestOpToSQL(t *testing.T) {
 		{OpGte, ">="},
 		{OpLt, "<"},
 		{OpLte, "<="},
+		{OpLike, "LIKE"},
+		{OpGlob, "GLOB"},
 		{"unknown", "="}, // default
 	}
 
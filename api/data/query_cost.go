@@ -0,0 +1,228 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/atombasedev/atombase/config"
+	"github.com/atombasedev/atombase/definitions"
+	"github.com/atombasedev/atombase/tools"
+)
+
+// Query cost weights. A query costs one point, plus one point per rowsPerPoint
+// rows it is expected to scan, plus fixed surcharges for joins, full-text
+// search and pattern filters.
+const (
+	rowsPerPoint      = 100
+	joinCost          = 5  // Per joined table, multiplied by its nesting depth
+	ftsCost           = 20 // Per full-text search filter
+	patternCost       = 5  // Per like or glob filter
+	rowEstimateMaxAge = 5 * time.Minute
+)
+
+// callerKey identifies who is charged for a request's query cost. Service
+// requests are not limited and have no key.
+func callerKey(principal definitions.Principal, req *http.Request) string {
+	switch {
+	case principal.IsService:
+		return ""
+	case principal.TokenDatabase != "":
+		// JWT subjects are the app's user IDs, unique only within the database.
+		return "jwt:" + principal.TokenDatabase + ":" + principal.UserID
+	case principal.UserID != "":
+		return "user:" + principal.UserID
+	default:
+		return "ip:" + tools.ClientIP(req)
+	}
+}
+
+func queryCostLimited() bool {
+	return config.Cfg.QueryCostLimit > 0 || config.Cfg.QueryCostBudget > 0
+}
+
+// selectCost estimates the cost of a select. The root table is expected to be
+// scanned in full when its size is known from sqlite_stat1, and up to the
+// select's limit otherwise; counting scans it a second time.
+func (dao *TenantConnection) selectCost(ctx context.Context, exec Executor, table string, query SelectQuery, includeCount bool) int {
+	limit := dao.Schema.selectLimit(query.Limit)
+	rows := dao.estimateRows(ctx, exec, table, limit)
+	cost := 1 + rows/rowsPerPoint
+	if includeCount {
+		cost += rows / rowsPerPoint
+	}
+	cost += dao.relationsCost(ctx, exec, query.Select, 1, limit)
+	for _, join := range query.Join {
+		cost += joinCost + dao.estimateRows(ctx, exec, join.Table, limit)/rowsPerPoint
+	}
+	if query.Search != nil {
+		cost += ftsCost
+	}
+	return cost + filtersCost(query.Where)
+}
+
+// relationsCost charges for the nested relations of a select list.
+func (dao *TenantConnection) relationsCost(ctx context.Context, exec Executor, items []any, depth, limit int) int {
+	cost := 0
+	for _, item := range items {
+		nested, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		for relation, value := range nested {
+			cols, ok := value.([]any)
+			if !ok {
+				continue
+			}
+			relation, _ = splitRelationHint(relation)
+			cost += joinCost*depth + dao.estimateRows(ctx, exec, relation, limit)/rowsPerPoint
+			cost += dao.relationsCost(ctx, exec, cols, depth+1, limit)
+		}
+	}
+	return cost
+}
+
+// writeCost estimates the cost of an update or delete, which scans the table to
+// find the rows its filters match.
+func (dao *TenantConnection) writeCost(ctx context.Context, exec Executor, table string, where []map[string]any) int {
+	return 1 + dao.estimateRows(ctx, exec, table, 0)/rowsPerPoint + filtersCost(where)
+}
+
+func insertCost(rows int) int {
+	return 1 + rows/rowsPerPoint
+}
+
+func filtersCost(where []map[string]any) int {
+	cost := 0
+	for _, condition := range where {
+		cost += conditionCost(condition)
+	}
+	return cost
+}
+
+func conditionCost(condition map[string]any) int {
+	cost := 0
+	for key, value := range condition {
+		if key == OpOr || key == OpAnd {
+			items, _ := value.([]any)
+			for _, item := range items {
+				if nested, ok := item.(map[string]any); ok {
+					cost += conditionCost(nested)
+				}
+			}
+			continue
+		}
+		if filter, ok := value.(map[string]any); ok {
+			cost += filterCost(filter)
+		}
+	}
+	return cost
+}
+
+func filterCost(filter map[string]any) int {
+	cost := 0
+	for op, val := range filter {
+		switch op {
+		case OpFts:
+			cost += ftsCost
+		case OpLike, OpIlike, OpGlob:
+			cost += patternCost
+		case OpNot:
+			if inner, ok := val.(map[string]any); ok {
+				cost += filterCost(inner)
+			}
+		}
+	}
+	return cost
+}
+
+type rowEstimate struct {
+	rows int
+	at   time.Time
+}
+
+var (
+	rowEstimatesMu sync.Mutex
+	rowEstimates   = map[string]rowEstimate{}
+)
+
+// plannedCount returns the row count sqlite_stat1 records for a table, and
+// false when the database has not been analyzed.
+func (dao *TenantConnection) plannedCount(ctx context.Context, table string) (int64, bool) {
+	if _, err := dao.Schema.SearchTbls(table); err != nil {
+		return 0, false
+	}
+	rows := dao.estimateRows(ctx, dao.Client, table, -1)
+	return int64(rows), rows >= 0
+}
+
+// tableRows returns how many rows a table has, from sqlite_stat1 or, when the
+// database has not been analyzed, by counting them in SQL. It costs queries
+// that read the whole table whatever their page size.
+func (dao *TenantConnection) tableRows(ctx context.Context, exec Executor, table string) (int, error) {
+	if rows := dao.estimateRows(ctx, exec, table, -1); rows >= 0 {
+		return rows, nil
+	}
+	var rows int
+	err := exec.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+dao.Schema.source(table)).Scan(&rows)
+	return rows, err
+}
+
+// estimateRows returns the row count sqlite_stat1 records for a table, or
+// fallback when the database has not been analyzed. Estimates are cached per
+// database for a few minutes.
+func (dao *TenantConnection) estimateRows(ctx context.Context, exec Executor, table string, fallback int) int {
+	key := dao.ID + "/" + table
+	rowEstimatesMu.Lock()
+	cached, ok := rowEstimates[key]
+	rowEstimatesMu.Unlock()
+	if !ok || time.Since(cached.at) > rowEstimateMaxAge {
+		cached = rowEstimate{rows: -1, at: time.Now()}
+		var stat string
+		err := exec.QueryRowContext(ctx, `SELECT stat FROM sqlite_stat1 WHERE tbl = ? ORDER BY idx IS NULL DESC LIMIT 1`, table).Scan(&stat)
+		if err == nil {
+			if n, convErr := strconv.Atoi(strings.Fields(stat + " ")[0]); convErr == nil {
+				cached.rows = n
+			}
+		}
+		rowEstimatesMu.Lock()
+		rowEstimates[key] = cached
+		rowEstimatesMu.Unlock()
+	}
+	if cached.rows < 0 {
+		return fallback
+	}
+	return cached.rows
+}
+
+// maxCostBuckets bounds how many callers are tracked before buckets that have
+// refilled, and so carry no state, are dropped.
+const maxCostBuckets = 10000
+
+// costBuckets hold the query cost each caller may still spend. They refill at
+// QueryCostBudget points per minute up to the same amount.
+var costBuckets = tools.NewTokenBuckets("query_cost", maxCostBuckets)
+
+// chargeQueryCost rejects a query above the per-query cost limit, and otherwise
+// spends its cost from the caller's budget. Service requests are not charged.
+func (dao *TenantConnection) chargeQueryCost(cost int) error {
+	if dao.CallerKey == "" {
+		return nil
+	}
+	if limit := config.Cfg.QueryCostLimit; limit > 0 && cost > limit {
+		return fmt.Errorf("%w: cost %d exceeds the limit of %d", tools.ErrQueryTooComplex, cost, limit)
+	}
+	budget := float64(config.Cfg.QueryCostBudget)
+	if budget <= 0 {
+		return nil
+	}
+	ok, left, _ := costBuckets.Take(dao.CallerKey, float64(cost), tools.BucketLimit{Rate: budget / 60, Burst: budget}, time.Now())
+	if !ok {
+		return fmt.Errorf("%w: cost %d, %d points left", tools.ErrQueryBudgetExceeded, cost, int(left))
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/atombasedev/atombase/config"
+	"github.com/atombasedev/atombase/tools"
+)
+
+func TestQueryCost_UsesTableStats(t *testing.T) {
+	db := setupTestDB(t, schemaUsers+`
+WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < 250)
+INSERT INTO users (id, name, email) SELECT i, 'user' || i, 'user' || i || '@example.com' FROM n;
+ANALYZE;`)
+	defer db.Close()
+	dao := &TenantConnection{Client: db, Schema: loadSchema(t, db), ID: "cost-stats"}
+	ctx := context.Background()
+	limit := 10
+
+	if got := dao.selectCost(ctx, db, "users", SelectQuery{Limit: &limit}, false); got != 3 {
+		t.Fatalf("expected a scan of 250 rows to cost 3, got %d", got)
+	}
+	query := SelectQuery{Limit: &limit, Where: []map[string]any{{"name": map[string]any{"like": "user1%"}}}}
+	if got := dao.selectCost(ctx, db, "users", query, true); got != 10 {
+		t.Fatalf("expected count and like filter to raise the cost to 10, got %d", got)
+	}
+}
+
+func TestQueryCost_LimitAndBudget(t *testing.T) {
+	db := setupTestDB(t, schemaUsers+`INSERT INTO users (id, name) VALUES (1, 'ann');`)
+	defer db.Close()
+	schema := loadSchema(t, db)
+	ctx := context.Background()
+
+	oldLimit, oldBudget := config.Cfg.QueryCostLimit, config.Cfg.QueryCostBudget
+	defer func() { config.Cfg.QueryCostLimit, config.Cfg.QueryCostBudget = oldLimit, oldBudget }()
+	config.Cfg.QueryCostLimit = 4
+	config.Cfg.QueryCostBudget = 0
+
+	caller := &TenantConnection{Client: db, Schema: schema, ID: "cost-limit", CallerKey: "ip:192.0.2.1"}
+	fts := SelectQuery{Where: []map[string]any{{"name": map[string]any{"glob": "a*"}}}}
+	if _, err := caller.SelectJSON(ctx, "users", fts, false); !errors.Is(err, tools.ErrQueryTooComplex) {
+		t.Fatalf("expected ErrQueryTooComplex, got %v", err)
+	}
+	service := &TenantConnection{Client: db, Schema: schema, ID: "cost-limit"}
+	if _, err := service.SelectJSON(ctx, "users", fts, false); err != nil {
+		t.Fatalf("expected service requests to be exempt, got %v", err)
+	}
+
+	config.Cfg.QueryCostLimit = 0
+	config.Cfg.QueryCostBudget = 3
+	caller.CallerKey = "ip:192.0.2.2"
+	limit := 10
+	plain := SelectQuery{Select: []any{"id"}, Limit: &limit} // Costs one point without stats
+	for i := 0; i < 3; i++ {
+		if _, err := caller.SelectJSON(ctx, "users", plain, false); err != nil {
+			t.Fatalf("select %d failed: %v", i, err)
+		}
+	}
+	if _, err := caller.SelectJSON(ctx, "users", plain, false); !errors.Is(err, tools.ErrQueryBudgetExceeded) {
+		t.Fatalf("expected ErrQueryBudgetExceeded once the budget is spent, got %v", err)
+	}
+	other := &TenantConnection{Client: db, Schema: schema, ID: "cost-limit", CallerKey: "ip:192.0.2.3"}
+	if _, err := other.SelectJSON(ctx, "users", plain, false); err != nil {
+		t.Fatalf("expected another caller to have its own budget, got %v", err)
+	}
+}
+
+func TestQueryCost_AggregateReadsWholeTable(t *testing.T) {
+	db := setupTestDB(t, schemaUsers+`
+WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < 500)
+INSERT INTO users (id, name) SELECT i, 'user' || i FROM n;`)
+	defer db.Close()
+	ctx := context.Background()
+
+	oldLimit := config.Cfg.QueryCostLimit
+	defer func() { config.Cfg.QueryCostLimit = oldLimit }()
+	config.Cfg.QueryCostLimit = 5
+
+	// Without stats the rows are counted, not assumed to fit in a page.
+	caller := &TenantConnection{Client: db, Schema: loadSchema(t, db), ID: "cost-aggregate", CallerKey: "ip:192.0.2.4"}
+	query := AggregateQuery{Aggregates: map[string]string{"names": "approx_count_distinct(name)"}}
+	if _, err := caller.AggregateJSON(ctx, "users", query); !errors.Is(err, tools.ErrQueryTooComplex) {
+		t.Fatalf("expected an aggregate over 500 rows to cost more than 5, got %v", err)
+	}
+}
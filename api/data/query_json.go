@@ -8,8 +8,8 @@ import (
 )
 
 // BuildWhereFromJSON builds a WHERE clause from JSON filter array.
-// Each element in the array is ANDed together.
-// Example input: [{"id": {"eq": 5}}, {"or": [{"status": {"eq": "active"}}, {"role": {"eq": "admin"}}]}]
+// Each element in the array is ANDed together; "or" and "and" groups nest.
+// Example input: [{"id": {"eq": 5}}, {"or": [{"status": {"eq": "active"}}, {"and": [{"role": {"eq": "admin"}}, {"age": {"gt": 18}}]}]}]
 func (table CacheTable) BuildWhereFromJSON(where []map[string]any, schema SchemaCache) (string, []any, error) {
 	if len(where) == 0 {
 		return "", nil, nil
@@ -21,14 +21,9 @@ func (table CacheTable) BuildWhereFromJSON(where []map[string]any, schema Schema
 
 	for _, condition := range where {
 		for key, value := range condition {
-			// Handle OR conditions
-			if key == "or" {
-				orConditions, ok := value.([]any)
-				if !ok {
-					return "", nil, fmt.Errorf("or value must be an array")
-				}
-
-				orClause, orArgs, err := table.buildOrClause(orConditions, schema)
+			// Handle OR and AND groups
+			if key == OpOr || key == OpAnd {
+				groupClause, groupArgs, err := table.buildGroupClause(key, value, schema, 1)
 				if err != nil {
 					return "", nil, err
 				}
@@ -37,8 +32,8 @@ func (table CacheTable) BuildWhereFromJSON(where []map[string]any, schema Schema
 					query += "AND "
 				}
 				first = false
-				query += "(" + orClause + ") "
-				args = append(args, orArgs...)
+				query += "(" + groupClause + ") "
+				args = append(args, groupArgs...)
 				continue
 			}
 
@@ -67,6 +62,21 @@ func (table CacheTable) BuildWhereFromJSON(where []map[string]any, schema Schema
 				continue
 			}
 
+			// Handle table-wide location filters: {"__geo": {"near": [lat, lng, radius]}}
+			if key == geoFilter {
+				clause, clauseArgs, err := table.buildGeoClause(value, schema)
+				if err != nil {
+					return "", nil, err
+				}
+				if !first {
+					query += "AND "
+				}
+				first = false
+				query += clause
+				args = append(args, clauseArgs...)
+				continue
+			}
+
 			// Regular column filter
 			filterMap, ok := value.(map[string]any)
 			if !ok {
@@ -90,18 +100,40 @@ func (table CacheTable) BuildWhereFromJSON(where []map[string]any, schema Schema
 	return query, args, nil
 }
 
-// buildOrClause builds an OR clause from an array of conditions.
-func (table CacheTable) buildOrClause(conditions []any, schema SchemaCache) (string, []any, error) {
+// buildGroupClause joins the conditions of an "or" or "and" group with that
+// operator. Conditions may be groups themselves, nested up to MaxFilterDepth.
+func (table CacheTable) buildGroupClause(op string, value any, schema SchemaCache, depth int) (string, []any, error) {
+	if depth > MaxFilterDepth {
+		return "", nil, fmt.Errorf("%w: filter groups nest more than %d levels", tools.ErrQueryTooDeep, MaxFilterDepth)
+	}
+	conditions, ok := value.([]any)
+	if !ok {
+		return "", nil, fmt.Errorf("%s value must be an array", op)
+	}
+	if len(conditions) == 0 {
+		return "", nil, fmt.Errorf("%s group cannot be empty", op)
+	}
+
 	var parts []string
 	var args []any
 
 	for _, cond := range conditions {
 		condMap, ok := cond.(map[string]any)
 		if !ok {
-			return "", nil, fmt.Errorf("or condition must be an object")
+			return "", nil, fmt.Errorf("%s condition must be an object", op)
 		}
 
 		for col, filter := range condMap {
+			if col == OpOr || col == OpAnd {
+				clause, clauseArgs, err := table.buildGroupClause(col, filter, schema, depth+1)
+				if err != nil {
+					return "", nil, err
+				}
+				parts = append(parts, "("+clause+")")
+				args = append(args, clauseArgs...)
+				continue
+			}
+
 			filterMap, ok := filter.(map[string]any)
 			if !ok {
 				return "", nil, fmt.Errorf("filter must be an object")
@@ -117,7 +149,11 @@ func (table CacheTable) buildOrClause(conditions []any, schema SchemaCache) (str
 		}
 	}
 
-	return strings.Join(parts, " OR "), args, nil
+	sqlOp := SqlOr
+	if op == OpAnd {
+		sqlOp = SqlAnd
+	}
+	return strings.Join(parts, " "+sqlOp+" "), args, nil
 }
 
 // isColumnRef checks if a value is a column reference marker {"__col": "column_name"}
@@ -134,29 +170,32 @@ func isColumnRef(val any) (string, bool) {
 }
 
 // buildFilterClause builds a single filter clause for a column.
-// Supports table.column syntax for join queries.
+// Supports table.column syntax for join queries, and arrow paths into JSON
+// columns (data->address->>city), which compare the extracted value.
 func (table CacheTable) buildFilterClause(column string, filter map[string]any, schema SchemaCache) (string, []any, error) {
 	// Parse table.column format if present
 	tableName := table.Name
 	colName := column
+	tbl := table
 	if idx := strings.Index(column, "."); idx != -1 {
 		tableName = column[:idx]
 		colName = column[idx+1:]
 		// Validate the table exists in schema
-		tbl, err := schema.SearchTbls(tableName)
-		if err != nil {
+		var err error
+		if tbl, err = schema.SearchTbls(tableName); err != nil {
 			return "", nil, err
 		}
+	}
+	target := fmt.Sprintf("[%s].[%s]", tableName, colName)
+	path, isPath, err := tbl.jsonPathColumn(colName)
+	if err != nil {
+		return "", nil, err
+	}
+	if isPath {
+		target = path.valueSQL(tableName)
+	} else if _, err := tbl.SearchCols(colName); err != nil {
 		// Validate column exists in that table
-		if _, err := tbl.SearchCols(colName); err != nil {
-			return "", nil, err
-		}
-	} else {
-		// Validate column exists in base table
-		_, err := table.SearchCols(column)
-		if err != nil {
-			return "", nil, err
-		}
+		return "", nil, err
 	}
 
 	var args []any
@@ -167,7 +206,7 @@ func (table CacheTable) buildFilterClause(column string, filter map[string]any,
 		if !ok {
 			return "", nil, fmt.Errorf("not value must be an object")
 		}
-		return table.buildNotFilterClauseWithTable(tableName, colName, notMap, schema)
+		return table.buildNotFilterClause(column, target, notMap, schema)
 	}
 
 	// Handle each operator
@@ -178,33 +217,41 @@ func (table CacheTable) buildFilterClause(column string, filter map[string]any,
 			if _, err := table.SearchCols(colRef); err != nil {
 				return "", nil, err
 			}
+			switch op {
+			case OpEq, OpNeq, OpGt, OpGte, OpLt, OpLte, OpLike, OpGlob:
+			default:
+				return "", nil, fmt.Errorf("%w: %s cannot compare against a column", tools.ErrInvalidOperator, op)
+			}
 			sqlOp := opToSQL(op)
-			return fmt.Sprintf("[%s].[%s] %s [%s].[%s] ", tableName, colName, sqlOp, table.Name, colRef), nil, nil
+			return fmt.Sprintf("%s %s [%s].[%s] ", target, sqlOp, table.Name, colRef), nil, nil
 		}
 
 		switch op {
 		case OpEq:
-			return fmt.Sprintf("[%s].[%s] = ? ", tableName, colName), []any{val}, nil
+			return fmt.Sprintf("%s = ? ", target), []any{val}, nil
 		case OpNeq:
-			return fmt.Sprintf("[%s].[%s] != ? ", tableName, colName), []any{val}, nil
+			return fmt.Sprintf("%s != ? ", target), []any{val}, nil
 		case OpGt:
-			return fmt.Sprintf("[%s].[%s] > ? ", tableName, colName), []any{val}, nil
+			return fmt.Sprintf("%s > ? ", target), []any{val}, nil
 		case OpGte:
-			return fmt.Sprintf("[%s].[%s] >= ? ", tableName, colName), []any{val}, nil
+			return fmt.Sprintf("%s >= ? ", target), []any{val}, nil
 		case OpLt:
-			return fmt.Sprintf("[%s].[%s] < ? ", tableName, colName), []any{val}, nil
+			return fmt.Sprintf("%s < ? ", target), []any{val}, nil
 		case OpLte:
-			return fmt.Sprintf("[%s].[%s] <= ? ", tableName, colName), []any{val}, nil
+			return fmt.Sprintf("%s <= ? ", target), []any{val}, nil
 		case OpLike:
-			return fmt.Sprintf("[%s].[%s] LIKE ? ", tableName, colName), []any{val}, nil
+			return fmt.Sprintf("%s LIKE ? ESCAPE '\\' ", target), []any{val}, nil
+		case OpIlike:
+			return fmt.Sprintf("LOWER(%s) LIKE LOWER(?) ESCAPE '\\' ", target), []any{val}, nil
 		case OpGlob:
-			return fmt.Sprintf("[%s].[%s] GLOB ? ", tableName, colName), []any{val}, nil
+			return fmt.Sprintf("%s GLOB ? ", target), []any{val}, nil
 		case OpIs:
 			// IS NULL, IS TRUE, IS FALSE
-			if val == nil {
-				return fmt.Sprintf("[%s].[%s] IS NULL ", tableName, colName), nil, nil
+			keyword, err := isKeyword(val)
+			if err != nil {
+				return "", nil, err
 			}
-			return fmt.Sprintf("[%s].[%s] IS %v ", tableName, colName, val), nil, nil
+			return fmt.Sprintf("%s IS %s ", target, keyword), nil, nil
 		case OpIn:
 			arr, ok := val.([]any)
 			if !ok {
@@ -220,15 +267,18 @@ func (table CacheTable) buildFilterClause(column string, filter map[string]any,
 			for i := range arr {
 				placeholders[i] = "?"
 			}
-			return fmt.Sprintf("[%s].[%s] IN (%s) ", tableName, colName, strings.Join(placeholders, ", ")), arr, nil
+			return fmt.Sprintf("%s IN (%s) ", target, strings.Join(placeholders, ", ")), arr, nil
 		case OpBetween:
 			arr, ok := val.([]any)
 			if !ok || len(arr) != 2 {
 				return "", nil, fmt.Errorf("between value must be an array of exactly 2 elements")
 			}
-			return fmt.Sprintf("[%s].[%s] BETWEEN ? AND ? ", tableName, colName), arr, nil
+			return fmt.Sprintf("%s BETWEEN ? AND ? ", target), arr, nil
 		case OpFts:
 			// Full-text search on specific column (only supported on base table)
+			if isPath {
+				return "", nil, fmt.Errorf("%w: fts cannot search a json path", tools.ErrInvalidOperator)
+			}
 			if !schema.HasFTSIndex(tableName) {
 				return "", nil, fmt.Errorf("%w: %s", tools.ErrNoFTSIndex, tableName)
 			}
@@ -244,12 +294,13 @@ func (table CacheTable) buildFilterClause(column string, filter map[string]any,
 	return "", args, nil
 }
 
-// buildNotFilterClauseWithTable builds a NOT filter clause with explicit table name.
-func (table CacheTable) buildNotFilterClauseWithTable(tableName, colName string, filter map[string]any, schema SchemaCache) (string, []any, error) {
+// buildNotFilterClause builds a NOT filter clause for column, whose SQL
+// expression is target.
+func (table CacheTable) buildNotFilterClause(column, target string, filter map[string]any, schema SchemaCache) (string, []any, error) {
 	for op, val := range filter {
 		switch op {
 		case OpEq:
-			return fmt.Sprintf("[%s].[%s] != ? ", tableName, colName), []any{val}, nil
+			return fmt.Sprintf("%s != ? ", target), []any{val}, nil
 		case OpIn:
 			arr, ok := val.([]any)
 			if !ok {
@@ -265,23 +316,53 @@ func (table CacheTable) buildNotFilterClauseWithTable(tableName, colName string,
 			for i := range arr {
 				placeholders[i] = "?"
 			}
-			return fmt.Sprintf("[%s].[%s] NOT IN (%s) ", tableName, colName, strings.Join(placeholders, ", ")), arr, nil
+			return fmt.Sprintf("%s NOT IN (%s) ", target, strings.Join(placeholders, ", ")), arr, nil
 		case OpIs:
-			if val == nil {
-				return fmt.Sprintf("[%s].[%s] IS NOT NULL ", tableName, colName), nil, nil
+			keyword, err := isKeyword(val)
+			if err != nil {
+				return "", nil, err
 			}
-			return fmt.Sprintf("[%s].[%s] IS NOT %v ", tableName, colName, val), nil, nil
+			return fmt.Sprintf("%s IS NOT %s ", target, keyword), nil, nil
 		case OpLike:
-			return fmt.Sprintf("[%s].[%s] NOT LIKE ? ", tableName, colName), []any{val}, nil
+			return fmt.Sprintf("%s NOT LIKE ? ESCAPE '\\' ", target), []any{val}, nil
 		case OpGlob:
-			return fmt.Sprintf("[%s].[%s] NOT GLOB ? ", tableName, colName), []any{val}, nil
+			return fmt.Sprintf("%s NOT GLOB ? ", target), []any{val}, nil
 		default:
-			return "", nil, fmt.Errorf("%w: not.%s", tools.ErrInvalidOperator, op)
+			// Any other operator, including a nested not, is negated as a whole.
+			clause, args, err := table.buildFilterClause(column, map[string]any{op: val}, schema)
+			if err != nil {
+				return "", nil, err
+			}
+			return fmt.Sprintf("NOT (%s) ", strings.TrimSpace(clause)), args, nil
 		}
 	}
 	return "", nil, nil
 }
 
+// isKeyword returns the SQL keyword for an is filter value. Only null, true
+// and false are accepted because the keyword is written into the query.
+func isKeyword(val any) (string, error) {
+	switch v := val.(type) {
+	case nil:
+		return "NULL", nil
+	case bool:
+		if v {
+			return "TRUE", nil
+		}
+		return "FALSE", nil
+	case string:
+		switch strings.ToLower(v) {
+		case "null":
+			return "NULL", nil
+		case "true":
+			return "TRUE", nil
+		case "false":
+			return "FALSE", nil
+		}
+	}
+	return "", fmt.Errorf("is value must be null, true or false")
+}
+
 // BuildOrderFromJSON builds an ORDER BY clause from JSON order map.
 // Example input: {"created_at": "desc", "name": "asc"}
 func (table CacheTable) BuildOrderFromJSON(order map[string]string) (string, error) {
@@ -319,6 +400,17 @@ func (table CacheTable) BuildOrderFromJSON(order map[string]string) (string, err
 	return query + " ", nil
 }
 
+// relationHintOne embeds a relation as an object or null, as in
+// {"profile!one": ["bio"]}.
+const relationHintOne = "one"
+
+// splitRelationHint splits a nested relation's key into the relation and the
+// hint after its !.
+func splitRelationHint(key string) (string, string) {
+	name, hint, _ := strings.Cut(key, "!")
+	return name, hint
+}
+
 // ParseSelectFromJSON parses JSON select array into a Relation tree.
 // Example input: ["id", "name", {"posts": ["title", {"comments": ["body"]}]}]
 func ParseSelectFromJSON(sel []any, tableName string) (Relation, error) {
@@ -341,10 +433,15 @@ func ParseSelectFromJSON(sel []any, tableName string) (Relation, error) {
 			for key, value := range v {
 				// Check if it's a nested relation (value is an array)
 				if cols, ok := value.([]any); ok {
-					nestedRel, err := ParseSelectFromJSON(cols, key)
+					name, hint := splitRelationHint(key)
+					if hint != "" && hint != relationHintOne {
+						return rel, fmt.Errorf("unknown hint %q on relation %s", hint, name)
+					}
+					nestedRel, err := ParseSelectFromJSON(cols, name)
 					if err != nil {
 						return rel, err
 					}
+					nestedRel.one = hint == relationHintOne
 					nestedRel.parent = &rel
 					rel.joins = append(rel.joins, &nestedRel)
 				} else {
@@ -0,0 +1,248 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/atombasedev/atombase/config"
+	"github.com/atombasedev/atombase/tools"
+)
+
+// A query shape describes a Data API request without its literal values, so the
+// same query run with different arguments has the same shape. Columns, filters
+// and orderings are sorted, making shapes independent of key order:
+//
+//	select users select=id,name,posts(title) where=age.gt,or(name.like,name.eq) order=id.desc limit
+//	insert users columns=id,name returning=id
+//	update users set=name where=id.eq
+//	delete users where=id.in
+
+func selectShape(table string, query SelectQuery) string {
+	parts := []string{"select", table}
+	if cols := selectColumnsShape(query.Select); cols != "" {
+		parts = append(parts, "select="+cols)
+	}
+	if len(query.Join) > 0 {
+		joins := make([]string, 0, len(query.Join))
+		for _, join := range query.Join {
+			kind := join.Type
+			if kind == "" {
+				kind = "left"
+			}
+			joins = append(joins, fmt.Sprintf("%s:%s(%s)", kind, join.Table, whereShape(join.On)))
+		}
+		sort.Strings(joins)
+		parts = append(parts, "join="+strings.Join(joins, ","))
+	}
+	if where := whereShape(query.Where); where != "" {
+		parts = append(parts, "where="+where)
+	}
+	if len(query.Order) > 0 {
+		order := make([]string, 0, len(query.Order))
+		for col, dir := range query.Order {
+			order = append(order, col+"."+strings.ToLower(dir))
+		}
+		sort.Strings(order)
+		parts = append(parts, "order="+strings.Join(order, ","))
+	}
+	if query.Limit != nil {
+		parts = append(parts, "limit")
+	}
+	if query.Offset != nil {
+		parts = append(parts, "offset")
+	}
+	if query.Cursor != nil {
+		parts = append(parts, "cursor")
+	}
+	if len(query.Computed) > 0 {
+		// Expressions are compiled into the SQL, so they are part of the shape.
+		computed := make([]string, 0, len(query.Computed))
+		for name, expr := range query.Computed {
+			computed = append(computed, name+":"+strings.Join(strings.Fields(expr), " "))
+		}
+		sort.Strings(computed)
+		parts = append(parts, "computed="+strings.Join(computed, ","))
+	}
+	if query.Search != nil {
+		// The search terms are a parameter; the fields it adds are not.
+		search := []string{}
+		if query.Search.Rank != "" {
+			search = append(search, "rank:"+query.Search.Rank)
+		}
+		for _, name := range sortedKeys(query.Search.Snippet) {
+			search = append(search, "snippet:"+name+":"+query.Search.Snippet[name])
+		}
+		for _, name := range sortedKeys(query.Search.Highlight) {
+			search = append(search, "highlight:"+name+":"+query.Search.Highlight[name])
+		}
+		parts = append(parts, "search="+strings.Join(search, ","))
+	}
+	return strings.Join(parts, " ")
+}
+
+func insertShape(operation, table string, rows []map[string]any, returning []string) string {
+	seen := map[string]bool{}
+	var columns []string
+	for _, row := range rows {
+		for col := range row {
+			if !seen[col] {
+				seen[col] = true
+				columns = append(columns, col)
+			}
+		}
+	}
+	sort.Strings(columns)
+	parts := []string{operation, table, "columns=" + strings.Join(columns, ",")}
+	if len(returning) > 0 {
+		parts = append(parts, "returning="+strings.Join(sortedCopy(returning), ","))
+	}
+	return strings.Join(parts, " ")
+}
+
+func updateShape(table string, req UpdateRequest) string {
+	columns := make([]string, 0, len(req.Data))
+	for col := range req.Data {
+		columns = append(columns, col)
+	}
+	sort.Strings(columns)
+	parts := []string{"update", table, "set=" + strings.Join(columns, ",")}
+	if where := whereShape(req.Where); where != "" {
+		parts = append(parts, "where="+where)
+	}
+	if len(req.Returning) > 0 {
+		parts = append(parts, "returning="+strings.Join(sortedCopy(req.Returning), ","))
+	}
+	return strings.Join(parts, " ")
+}
+
+func aggregateShape(table string, query AggregateQuery) string {
+	aggs := make([]string, 0, len(query.Aggregates))
+	for name, expr := range query.Aggregates {
+		aggs = append(aggs, name+":"+strings.ReplaceAll(expr, " ", ""))
+	}
+	sort.Strings(aggs)
+	parts := []string{"aggregate", table, "aggregates=" + strings.Join(aggs, ",")}
+	if where := whereShape(query.Where); where != "" {
+		parts = append(parts, "where="+where)
+	}
+	return strings.Join(parts, " ")
+}
+
+func deleteShape(table string, req DeleteRequest) string {
+	parts := []string{"delete", table}
+	if shape := whereShape(req.Where); shape != "" {
+		parts = append(parts, "where="+shape)
+	}
+	if len(req.Returning) > 0 {
+		parts = append(parts, "returning="+strings.Join(sortedCopy(req.Returning), ","))
+	}
+	return strings.Join(parts, " ")
+}
+
+// selectColumnsShape renders select items: plain columns, aliases as
+// alias:column and nested relations as relation(columns).
+func selectColumnsShape(items []any) string {
+	var cols []string
+	for _, item := range items {
+		switch v := item.(type) {
+		case string:
+			cols = append(cols, v)
+		case map[string]any:
+			for key, value := range v {
+				switch inner := value.(type) {
+				case []any:
+					cols = append(cols, key+"("+selectColumnsShape(inner)+")")
+				case string:
+					cols = append(cols, key+":"+inner)
+				}
+			}
+		}
+	}
+	sort.Strings(cols)
+	return strings.Join(cols, ",")
+}
+
+func whereShape(where []map[string]any) string {
+	var conds []string
+	for _, condition := range where {
+		conds = append(conds, conditionShapes(condition)...)
+	}
+	sort.Strings(conds)
+	return strings.Join(conds, ",")
+}
+
+func conditionShapes(condition map[string]any) []string {
+	var shapes []string
+	for key, value := range condition {
+		if key == OpOr || key == OpAnd {
+			items, _ := value.([]any)
+			var branches []string
+			for _, item := range items {
+				if nested, ok := item.(map[string]any); ok {
+					inner := conditionShapes(nested)
+					sort.Strings(inner)
+					branches = append(branches, strings.Join(inner, "+"))
+				}
+			}
+			sort.Strings(branches)
+			shapes = append(shapes, key+"("+strings.Join(branches, ",")+")")
+			continue
+		}
+		filter, ok := value.(map[string]any)
+		if !ok {
+			shapes = append(shapes, key)
+			continue
+		}
+		shapes = append(shapes, filterShapes(key, filter)...)
+	}
+	return shapes
+}
+
+func filterShapes(prefix string, filter map[string]any) []string {
+	var shapes []string
+	for op, val := range filter {
+		if op == OpNot {
+			if inner, ok := val.(map[string]any); ok {
+				shapes = append(shapes, filterShapes(prefix+"."+OpNot, inner)...)
+				continue
+			}
+		}
+		shapes = append(shapes, prefix+"."+op)
+	}
+	return shapes
+}
+
+// recordQuery adds a completed query to the request's activity record. The
+// operation and table are the first two words of its shape.
+func recordQuery(ctx context.Context, shape string, rows int64) {
+	operation, rest, _ := strings.Cut(shape, " ")
+	table, _, _ := strings.Cut(rest, " ")
+	tools.RecordQuery(ctx, operation, table, shape, rows)
+}
+
+func sortedCopy(values []string) []string {
+	out := append([]string(nil), values...)
+	sort.Strings(out)
+	return out
+}
+
+// checkQueryAllowed rejects a query whose shape is not in the definition's
+// allowlist. Without an allowlist every shape is accepted, unless the server
+// requires one.
+func (schema SchemaCache) checkQueryAllowed(shape string) error {
+	var allowlist []string
+	if schema.Settings != nil {
+		allowlist = schema.Settings.QueryAllowlist
+	}
+	if len(allowlist) == 0 && !config.Cfg.RequireQueryAllowlist {
+		return nil
+	}
+	for _, allowed := range allowlist {
+		if allowed == shape {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", tools.ErrQueryNotAllowed, shape)
+}
@@ -0,0 +1,112 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/atombasedev/atombase/tools"
+)
+
+func TestQueryShapes_StripValues(t *testing.T) {
+	limit := 10
+	a := selectShape("users", SelectQuery{
+		Select: []any{"name", "id", map[string]any{"posts": []any{"title"}}},
+		Where: []map[string]any{
+			{"id": map[string]any{"gt": 5}},
+			{"or": []any{map[string]any{"name": map[string]any{"like": "a%"}}, map[string]any{"name": map[string]any{"not": map[string]any{"eq": "b"}}}}},
+		},
+		Order: map[string]string{"id": "DESC"},
+		Limit: &limit,
+	})
+	b := selectShape("users", SelectQuery{
+		Select: []any{"id", map[string]any{"posts": []any{"title"}}, "name"},
+		Where: []map[string]any{
+			{"or": []any{map[string]any{"name": map[string]any{"not": map[string]any{"eq": "z"}}}, map[string]any{"name": map[string]any{"like": "q%"}}}},
+			{"id": map[string]any{"gt": 99}},
+		},
+		Order: map[string]string{"id": "desc"},
+		Limit: &limit,
+	})
+	want := "select users select=id,name,posts(title) where=id.gt,or(name.like,name.not.eq) order=id.desc limit"
+	if a != want || b != want {
+		t.Fatalf("unexpected shapes:\n%s\n%s\nwant %s", a, b, want)
+	}
+
+	if got := insertShape("insert", "users", []map[string]any{{"name": "a"}, {"id": 1, "name": "b"}}, []string{"id"}); got != "insert users columns=id,name returning=id" {
+		t.Fatalf("unexpected insert shape %q", got)
+	}
+	if got := updateShape("users", UpdateRequest{Data: map[string]any{"name": "x"}, Where: []map[string]any{{"id": map[string]any{"eq": 1}}}}); got != "update users set=name where=id.eq" {
+		t.Fatalf("unexpected update shape %q", got)
+	}
+}
+
+func TestQueryAllowlist_RejectsUnregisteredShapes(t *testing.T) {
+	db := setupTestDB(t, schemaUsers+`INSERT INTO users (id, name) VALUES (1, 'ann');`)
+	defer db.Close()
+	schema := loadSchema(t, db)
+	schema.Settings = &APISettings{QueryAllowlist: []string{"select users select=id,name where=id.eq"}}
+	dao := &TenantConnection{Client: db, Schema: schema}
+	ctx := context.Background()
+
+	if _, err := dao.SelectJSON(ctx, "users", SelectQuery{
+		Select: []any{"name", "id"},
+		Where:  []map[string]any{{"id": map[string]any{"eq": 1}}},
+	}, false); err != nil {
+		t.Fatalf("expected registered shape to be served, got %v", err)
+	}
+	_, err := dao.SelectJSON(ctx, "users", SelectQuery{Select: []any{"id", "name"}}, false)
+	if !errors.Is(err, tools.ErrQueryNotAllowed) {
+		t.Fatalf("expected ErrQueryNotAllowed for an unfiltered select, got %v", err)
+	}
+	if _, err := dao.DeleteJSON(ctx, "users", DeleteRequest{Where: []map[string]any{{"id": map[string]any{"eq": 1}}}}); !errors.Is(err, tools.ErrQueryNotAllowed) {
+		t.Fatalf("expected ErrQueryNotAllowed for delete, got %v", err)
+	}
+	if _, err := dao.Batch(ctx, BatchRequest{Operations: []BatchOperation{{
+		Operation: "insert",
+		Table:     "users",
+		Body:      map[string]any{"data": map[string]any{"id": 2, "name": "bob"}},
+	}}}); !errors.Is(err, tools.ErrQueryNotAllowed) {
+		t.Fatalf("expected ErrQueryNotAllowed inside a batch, got %v", err)
+	}
+}
+
+func TestRecordQuery_FingerprintsWithoutValues(t *testing.T) {
+	db := setupTestDB(t, schemaUsers+`INSERT INTO users (id, name) VALUES (1, 'ann'), (2, 'bob');`)
+	defer db.Close()
+	dao := &TenantConnection{Client: db, Schema: loadSchema(t, db)}
+	ctx := tools.WithQueryLog(context.Background())
+
+	for _, name := range []string{"ann", "nobody"} {
+		if _, err := dao.SelectJSON(ctx, "users", SelectQuery{
+			Select: []any{"id"},
+			Where:  []map[string]any{{"name": map[string]any{"eq": name}}},
+		}, false); err != nil {
+			t.Fatalf("SelectJSON failed: %v", err)
+		}
+	}
+	if _, err := dao.UpdateJSON(ctx, "users", UpdateRequest{
+		Data:  map[string]any{"name": "secret"},
+		Where: []map[string]any{{"id": map[string]any{"gt": 0}}},
+	}); err != nil {
+		t.Fatalf("UpdateJSON failed: %v", err)
+	}
+
+	queries := tools.RecordedQueries(ctx)
+	if len(queries) != 3 {
+		t.Fatalf("expected three recorded queries, got %#v", queries)
+	}
+	if queries[0].Fingerprint != queries[1].Fingerprint || queries[0].Rows != 1 || queries[1].Rows != 0 {
+		t.Fatalf("expected selects to share a fingerprint with their own row counts: %#v", queries[:2])
+	}
+	update := queries[2]
+	if update.Operation != "update" || update.Table != "users" || update.Shape != "update users set=name where=id.gt" || update.Rows != 2 {
+		t.Fatalf("unexpected update record: %#v", update)
+	}
+	for _, q := range queries {
+		if strings.Contains(q.Shape, "ann") || strings.Contains(q.Shape, "secret") {
+			t.Fatalf("shape leaks a literal value: %q", q.Shape)
+		}
+	}
+}
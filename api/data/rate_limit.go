@@ -0,0 +1,71 @@
+package data
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/atombasedev/atombase/tools"
+)
+
+// Roles settings.rateLimits are keyed by, besides the role claim of a JWT.
+const (
+	RateLimitRoleAnonymous = "anonymous"
+	RateLimitRoleUser      = "user"
+)
+
+// abusePenaltyScore is the abuse score at which an end user's budget is
+// halved, until enough of the refusals behind it have decayed.
+const abusePenaltyScore = 50
+
+// userRequestBuckets hold each end user's request allowance per database.
+var userRequestBuckets = tools.NewTokenBuckets("user_requests", 100000)
+
+// rateLimitRole is the settings.rateLimits entry the caller falls under:
+// anonymous without a user, the token's role claim when the settings name
+// it, and user otherwise.
+func (dao *TenantConnection) rateLimitRole() string {
+	if dao.Principal.UserID == "" {
+		return RateLimitRoleAnonymous
+	}
+	if role, ok := dao.Principal.Claims["role"].(string); ok {
+		if _, limited := dao.Schema.Settings.RateLimits[role]; limited {
+			return role
+		}
+	}
+	return RateLimitRoleUser
+}
+
+// takeRequest spends one request from the end user's budget on this
+// database, so one user can't use up what the tenant's other users share.
+// Refusals raise the user's abuse score, and a high score halves the budget.
+// Service requests and roles without a budget are not limited.
+func (dao *TenantConnection) takeRequest(now time.Time) error {
+	if dao.CallerKey == "" || dao.Schema.Settings == nil || len(dao.Schema.Settings.RateLimits) == 0 {
+		return nil
+	}
+	role := dao.rateLimitRole()
+	limit, ok := dao.Schema.Settings.RateLimits[role]
+	if !ok {
+		return nil
+	}
+	key := dao.ID + "/" + dao.CallerKey
+	bucket := tools.BucketLimit{Rate: limit.Rate, Burst: float64(limit.Burst)}
+	if bucket.Burst < 1 {
+		bucket.Burst = max(1, math.Ceil(limit.Rate))
+	}
+	if tools.AbuseScoreOf(key, now) >= abusePenaltyScore {
+		bucket.Rate /= 2
+		bucket.Burst = max(1, math.Floor(bucket.Burst/2))
+	}
+
+	allowed, _, wait := userRequestBuckets.Take(key, 1, bucket, now)
+	if !allowed {
+		tools.RecordAbuse(key, 1, now)
+		return &tools.RetryAfterError{
+			Err:  fmt.Errorf("%w: %s budget of %g requests per second on this database", tools.ErrRateLimited, role, bucket.Rate),
+			Wait: wait,
+		}
+	}
+	return nil
+}
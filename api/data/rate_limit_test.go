@@ -0,0 +1,76 @@
+package data
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/atombasedev/atombase/definitions"
+	"github.com/atombasedev/atombase/tools"
+)
+
+func TestTakeRequest(t *testing.T) {
+	settings := &APISettings{RateLimits: map[string]RateLimit{
+		RateLimitRoleUser: {Rate: 1, Burst: 2},
+		"premium":         {Rate: 100},
+	}}
+	conn := func(id string, principal definitions.Principal) *TenantConnection {
+		return &TenantConnection{ID: id, Schema: SchemaCache{Settings: settings}, Principal: principal, CallerKey: "user:" + principal.UserID}
+	}
+	now := time.Now()
+	ada := conn("db-take-1", definitions.Principal{UserID: "ada"})
+	for i := range 2 {
+		if err := ada.takeRequest(now); err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+	}
+	err := ada.takeRequest(now)
+	var retry *tools.RetryAfterError
+	if !errors.Is(err, tools.ErrRateLimited) || !errors.As(err, &retry) || retry.Wait != time.Second {
+		t.Fatalf("expected the third request to wait a second, got %v", err)
+	}
+
+	// Other users and other databases have their own budgets.
+	if err := conn("db-take-1", definitions.Principal{UserID: "grace"}).takeRequest(now); err != nil {
+		t.Errorf("expected another user to be allowed, got %v", err)
+	}
+	if err := conn("db-take-2", definitions.Principal{UserID: "ada"}).takeRequest(now); err != nil {
+		t.Errorf("expected another database to be allowed, got %v", err)
+	}
+	// A role claim the settings name picks its budget; anonymous has none here.
+	premium := conn("db-take-1", definitions.Principal{UserID: "eve", Claims: map[string]any{"role": "premium"}})
+	for range 10 {
+		if err := premium.takeRequest(now); err != nil {
+			t.Fatalf("expected the premium budget, got %v", err)
+		}
+	}
+	anonymous := &TenantConnection{ID: "db-take-1", Schema: SchemaCache{Settings: settings}, CallerKey: "ip:192.0.2.1"}
+	for range 10 {
+		if err := anonymous.takeRequest(now); err != nil {
+			t.Fatalf("expected anonymous callers to be unlimited, got %v", err)
+		}
+	}
+}
+
+func TestTakeRequest_AbusePenalty(t *testing.T) {
+	settings := &APISettings{RateLimits: map[string]RateLimit{RateLimitRoleUser: {Rate: 4, Burst: 4}}}
+	dao := &TenantConnection{ID: "db-abuse", Schema: SchemaCache{Settings: settings}, Principal: definitions.Principal{UserID: "mallory"}, CallerKey: "user:mallory"}
+	now := time.Now()
+	for range 4 + 2*abusePenaltyScore {
+		_ = dao.takeRequest(now)
+	}
+	if score := tools.AbuseScoreOf("db-abuse/user:mallory", now); score < abusePenaltyScore {
+		t.Fatalf("expected every refusal to count, got a score of %v", score)
+	}
+
+	// A full refill only gives back half the burst while the score is high.
+	later := now.Add(time.Second)
+	for i := range 2 {
+		if err := dao.takeRequest(later); err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+	}
+	if err := dao.takeRequest(later); !errors.Is(err, tools.ErrRateLimited) {
+		t.Fatalf("expected the halved burst to run out, got %v", err)
+	}
+}
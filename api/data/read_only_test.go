@@ -0,0 +1,98 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/atombasedev/atombase/config"
+	"github.com/atombasedev/atombase/definitions"
+	"github.com/atombasedev/atombase/tools"
+)
+
+func TestReadOnlyRequest(t *testing.T) {
+	tests := []struct {
+		method, prefer string
+		want           bool
+	}{
+		{"GET", "", true},
+		{"POST", "tx=read-only", true},
+		{"POST", "operation=select, tx = read-only", true},
+		{"POST", "return=representation", false},
+		{"DELETE", "", false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, "/data/query/users", nil)
+		if tt.prefer != "" {
+			req.Header.Set("Prefer", tt.prefer)
+		}
+		if got := readOnlyRequest(req); got != tt.want {
+			t.Errorf("%s with Prefer %q: got %v, want %v", tt.method, tt.prefer, got, tt.want)
+		}
+	}
+}
+
+func TestReadOnly_RejectsWrites(t *testing.T) {
+	db := setupTestDB(t, schemaUsers)
+	defer db.Close()
+	if _, err := db.Exec(`INSERT INTO users (name, email, age) VALUES ('Alice', 'u1', 30)`); err != nil {
+		t.Fatal(err)
+	}
+	schema := loadSchema(t, db)
+	schema.Settings = &APISettings{Functions: map[string]Function{
+		"deactivate": {SQL: "UPDATE users SET status = 'inactive'"},
+	}}
+	dao := &TenantConnection{Client: db, Schema: schema, ID: "db", Principal: definitions.Principal{IsService: true}, ReadOnly: true}
+	ctx := context.Background()
+
+	if _, err := dao.SelectJSON(ctx, "users", SelectQuery{}, false); err != nil {
+		t.Fatalf("expected reads to work, got %v", err)
+	}
+	if _, err := dao.InsertJSON(ctx, "users", InsertRequest{Data: RowData{{"name": "Bob"}}}); !errors.Is(err, tools.ErrReadOnlyRequest) {
+		t.Errorf("expected an insert to be refused, got %v", err)
+	}
+	if _, err := dao.DeleteJSON(ctx, "users", DeleteRequest{Where: []map[string]any{{"id": map[string]any{"eq": 1}}}}); !errors.Is(err, tools.ErrReadOnlyRequest) {
+		t.Errorf("expected a delete to be refused, got %v", err)
+	}
+	// A function's statement is only known to write once it ran; it is undone.
+	if _, err := dao.CallFunction(ctx, "deactivate", nil); !errors.Is(err, tools.ErrReadOnlyRequest) {
+		t.Errorf("expected a writing function to be refused, got %v", err)
+	}
+	var status string
+	if err := db.QueryRow(`SELECT status FROM users`).Scan(&status); err != nil || status != "active" {
+		t.Errorf("expected the function's write to be rolled back, got %q %v", status, err)
+	}
+}
+
+func TestUseQueryOnly(t *testing.T) {
+	prevCfg := config.Cfg
+	t.Cleanup(func() { config.Cfg = prevCfg })
+	config.Cfg.LocalTenantDir = t.TempDir()
+
+	client, err := tools.OpenTenantDB("tenant", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Exec(schemaUsers); err != nil {
+		t.Fatal(err)
+	}
+	dao := &TenantConnection{Client: client, ID: "tenant", ReadOnly: true}
+	if err := dao.useQueryOnly(); err != nil {
+		t.Fatal(err)
+	}
+	defer dao.Client.Close()
+	if dao.Client == client {
+		t.Fatal("expected a read-only request to get a new connection")
+	}
+	if _, err := dao.Client.Exec(`INSERT INTO users (name) VALUES ('Alice')`); err == nil {
+		t.Error("expected a write on the query_only connection to fail")
+	}
+	var n int
+	if err := dao.Client.QueryRow(`SELECT count(*) FROM users`).Scan(&n); err != nil {
+		t.Errorf("expected reads to work, got %v", err)
+	}
+	if err := dao.functionWriteErr("f", errors.New("attempt to write a readonly database")); !errors.Is(err, tools.ErrReadOnlyRequest) {
+		t.Errorf("expected SQLite's refusal to read as ErrReadOnlyRequest, got %v", err)
+	}
+}
@@ -0,0 +1,288 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/atombasedev/atombase/config"
+	"github.com/atombasedev/atombase/definitions"
+	"github.com/atombasedev/atombase/primarystore"
+	"github.com/atombasedev/atombase/tools"
+)
+
+const (
+	reportPollInterval = 30 * time.Second // Time between scheduler passes
+	reportBatchSize    = 10               // Reports one scheduler pass runs at most
+)
+
+// sendReportEmail is replaced in tests.
+var sendReportEmail = tools.SendEmail
+
+// CreateReport schedules a saved query. The query must have a default for
+// every param, since nobody is there to pass them when it runs. Reports need
+// the service key and an export bucket. A report runs as the service, so
+// scoped keys can't create one unless they have full access.
+func (dao *TenantConnection) CreateReport(ctx context.Context, req ReportRequest) (Report, error) {
+	if err := dao.requireUnscopedService("reports"); err != nil {
+		return Report{}, err
+	}
+	if exportStore() == nil {
+		return Report{}, tools.InvalidRequestErr("exports are not configured on this server")
+	}
+	saved, err := dao.GetSavedQuery(ctx, req.Query)
+	if err != nil {
+		return Report{}, err
+	}
+	names, err := queryParams(saved.Query.Where)
+	if err != nil {
+		return Report{}, err
+	}
+	var missing []string
+	for name := range names {
+		if _, ok := saved.Params[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return Report{}, tools.InvalidRequestErr(fmt.Sprintf("saved query %s needs defaults for params: %s", saved.Name, strings.Join(missing, ", ")))
+	}
+
+	switch req.Format {
+	case ExportCSV, ExportNDJSON, ExportSQLite:
+	default:
+		return Report{}, tools.InvalidRequestErr(fmt.Sprintf("format must be %s, %s or %s, got %q", ExportCSV, ExportNDJSON, ExportSQLite, req.Format))
+	}
+	cron, err := tools.ParseCron(req.Cron)
+	if err != nil {
+		return Report{}, tools.InvalidRequestErr(err.Error())
+	}
+	if req.Timezone == "" {
+		req.Timezone = "UTC"
+	}
+	loc, err := time.LoadLocation(req.Timezone)
+	if err != nil {
+		return Report{}, tools.InvalidRequestErr(fmt.Sprintf("unknown timezone %q", req.Timezone))
+	}
+	if req.Webhook != "" {
+		if err := checkWebhookURL(req.Webhook); err != nil {
+			return Report{}, tools.InvalidRequestErr("webhook: " + err.Error())
+		}
+	}
+	if req.Email != "" && !strings.Contains(req.Email, "@") {
+		return Report{}, tools.InvalidRequestErr("email must be an email address")
+	}
+
+	id := make([]byte, 8)
+	_, _ = rand.Read(id)
+	now := time.Now().UTC()
+	report := primarystore.Report{
+		ID:         "rpt_" + hex.EncodeToString(id),
+		DatabaseID: dao.ID,
+		Query:      saved.Name,
+		Cron:       req.Cron,
+		Timezone:   req.Timezone,
+		Format:     req.Format,
+		Webhook:    req.Webhook,
+		Email:      req.Email,
+		NextRunAt:  cron.Next(now.In(loc)).UTC().Format(time.RFC3339),
+		CreatedAt:  now.Format(time.RFC3339),
+	}
+	if err := dao.primaryStore.CreateReport(ctx, report); err != nil {
+		return Report{}, err
+	}
+	return reportFromStore(report), nil
+}
+
+// ListReports returns the database's reports, oldest first.
+func (dao *TenantConnection) ListReports(ctx context.Context) ([]Report, error) {
+	if err := dao.requireUnscopedService("reports"); err != nil {
+		return nil, err
+	}
+	stored, err := dao.primaryStore.ListReports(ctx, dao.ID)
+	if err != nil {
+		return nil, err
+	}
+	reports := make([]Report, len(stored))
+	for i, r := range stored {
+		reports[i] = reportFromStore(r)
+	}
+	return reports, nil
+}
+
+// DeleteReport stops a report; its uploaded files are left in the bucket.
+func (dao *TenantConnection) DeleteReport(ctx context.Context, id string) error {
+	if err := dao.requireUnscopedService("reports"); err != nil {
+		return err
+	}
+	return dao.primaryStore.DeleteReport(ctx, dao.ID, id)
+}
+
+func reportFromStore(r primarystore.Report) Report {
+	report := Report{
+		ID:       r.ID,
+		Query:    r.Query,
+		Cron:     r.Cron,
+		Timezone: r.Timezone,
+		Format:   r.Format,
+		Webhook:  r.Webhook,
+		Email:    r.Email,
+	}
+	report.NextRunAt, _ = time.Parse(time.RFC3339, r.NextRunAt)
+	report.CreatedAt, _ = time.Parse(time.RFC3339, r.CreatedAt)
+	if r.LastRunAt != "" {
+		run := &ReportRun{Report: r.ID, Query: r.Query, Database: r.DatabaseID, Status: r.LastStatus, Rows: r.LastRows, URL: r.LastURL, Error: r.LastError}
+		run.RanAt, _ = time.Parse(time.RFC3339, r.LastRunAt)
+		if run.URL != "" {
+			expires := run.RanAt.Add(exportURLTTL())
+			run.ExpiresAt = &expires
+		}
+		report.LastRun = run
+	}
+	return report
+}
+
+// RunReportScheduler runs due reports until stop is closed. Reports are
+// claimed in the primary database, so any number of servers can run the
+// scheduler; a report missed while no server was up runs once when one is.
+func (api *API) RunReportScheduler(stop <-chan struct{}) {
+	ticker := time.NewTicker(reportPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			if err := api.runDueReports(context.Background(), now); err != nil {
+				tools.Logger.Error("report scheduling failed", "error", err)
+			}
+		}
+	}
+}
+
+func (api *API) runDueReports(ctx context.Context, now time.Time) error {
+	store := exportStore()
+	if store == nil {
+		return nil
+	}
+	timeout := time.Duration(config.Cfg.ExportTimeout) * time.Second
+	due, err := api.store.ClaimDueReports(ctx, now, now.Add(timeout+time.Minute), reportBatchSize)
+	if err != nil {
+		return err
+	}
+	var wg sync.WaitGroup
+	for _, report := range due {
+		wg.Add(1)
+		go func(report primarystore.Report) {
+			defer wg.Done()
+			runCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			run := api.runReport(runCtx, report, store, now)
+			if err := api.finishReport(ctx, report, run); err != nil {
+				tools.Logger.Error("failed to record report run", "report_id", report.ID, "error", err)
+			}
+		}(report)
+	}
+	wg.Wait()
+	return nil
+}
+
+// runReport connects to the report's database as the service and exports
+// its saved query.
+func (api *API) runReport(ctx context.Context, report primarystore.Report, store *tools.ObjectStore, now time.Time) ReportRun {
+	run := ReportRun{Report: report.ID, Query: report.Query, Database: report.DatabaseID, RanAt: now.UTC()}
+	target, err := api.store.LookupDatabaseTarget(ctx, report.DatabaseID)
+	if err == nil {
+		var dao TenantConnection
+		if dao, err = api.connTurso(definitions.Principal{IsService: true}, target); err == nil {
+			defer dao.Close()
+			if err = MigrateIfNeeded(ctx, &dao); err == nil {
+				run = dao.runReport(ctx, report, store, now)
+			}
+		}
+	}
+	if err != nil {
+		run.Status, run.Error = ExportFailed, err.Error()
+	}
+	return run
+}
+
+// runReport exports a report's saved query, with its params' defaults, the
+// way an export job would.
+func (dao *TenantConnection) runReport(ctx context.Context, report primarystore.Report, store *tools.ObjectStore, now time.Time) ReportRun {
+	run := ReportRun{Report: report.ID, Query: report.Query, Database: report.DatabaseID, RanAt: now.UTC()}
+	saved, err := dao.GetSavedQuery(ctx, report.Query)
+	if err == nil {
+		query := saved.Query
+		query.Where = bindParams(saved.Query.Where, saved.Params, nil)
+		job := ExportJob{ID: report.ID + "-" + run.RanAt.Format("20060102T150405Z"), Table: saved.Table, Format: report.Format}
+		var link string
+		var expires time.Time
+		run.Rows, link, expires, err = dao.runExport(ctx, job, ExportRequest{Format: report.Format, Query: query, Nested: NestedFlatten}, store)
+		if err == nil {
+			run.Status, run.URL, run.ExpiresAt = ExportDone, link, &expires
+		}
+	}
+	if err != nil {
+		run.Status, run.Error = ExportFailed, err.Error()
+	}
+	return run
+}
+
+// finishReport records a run, schedules the report's next run after it and
+// sends the run to the report's webhook and email. Notifications are best
+// effort and not retried.
+func (api *API) finishReport(ctx context.Context, report primarystore.Report, run ReportRun) error {
+	if run.Status == ExportFailed {
+		log.Printf("report %s of %s failed: %v", report.ID, report.DatabaseID, run.Error)
+	}
+	next := time.Now().Add(24 * time.Hour)
+	if cron, err := tools.ParseCron(report.Cron); err == nil {
+		loc, err := time.LoadLocation(report.Timezone)
+		if err != nil {
+			loc = time.UTC
+		}
+		if n := cron.Next(time.Now().In(loc)); !n.IsZero() {
+			next = n
+		}
+	}
+	report.NextRunAt = next.UTC().Format(time.RFC3339)
+	report.LastRunAt = run.RanAt.Format(time.RFC3339)
+	report.LastStatus, report.LastError, report.LastRows, report.LastURL = run.Status, run.Error, run.Rows, run.URL
+	err := api.store.FinishReport(ctx, report)
+
+	if report.Webhook != "" {
+		if err := postJSON(report.Webhook, run); err != nil {
+			log.Printf("report %s webhook failed: %v", report.ID, err)
+		}
+	}
+	if report.Email != "" {
+		if err := sendReportEmail(ctx, reportEmail(report, run)); err != nil {
+			log.Printf("report %s email failed: %v", report.ID, err)
+		}
+	}
+	return err
+}
+
+func reportEmail(report primarystore.Report, run ReportRun) tools.Email {
+	if run.Status == ExportFailed {
+		return tools.Email{
+			To:      report.Email,
+			Subject: fmt.Sprintf("Report %s failed", report.Query),
+			Text:    fmt.Sprintf("The %s report of database %s failed at %s:\n\n%s\n", report.Query, report.DatabaseID, run.RanAt.Format(time.RFC1123), run.Error),
+		}
+	}
+	return tools.Email{
+		To:      report.Email,
+		Subject: fmt.Sprintf("Report %s is ready", report.Query),
+		Text: fmt.Sprintf("The %s report of database %s ran at %s with %d rows.\n\nDownload it (%s) until %s:\n%s\n",
+			report.Query, report.DatabaseID, run.RanAt.Format(time.RFC1123), run.Rows, report.Format, run.ExpiresAt.Format(time.RFC1123), run.URL),
+	}
+}
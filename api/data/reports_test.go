@@ -0,0 +1,187 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/atombasedev/atombase/config"
+	"github.com/atombasedev/atombase/definitions"
+	"github.com/atombasedev/atombase/primarystore"
+	"github.com/atombasedev/atombase/tools"
+)
+
+func TestReports_RunAndNotify(t *testing.T) {
+	oldCfg := config.Cfg
+	defer func() { config.Cfg = oldCfg }()
+
+	var mu sync.Mutex
+	uploads := map[string]string{}
+	var notified ReportRun
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		body, _ := io.ReadAll(r.Body)
+		if r.URL.Path == "/hook" {
+			_ = json.Unmarshal(body, &notified)
+			return
+		}
+		uploads[r.URL.Path] = string(body)
+	}))
+	defer server.Close()
+	oldClient, oldCheck := webhookClient, checkWebhookURL
+	defer func() { webhookClient, checkWebhookURL = oldClient, oldCheck }()
+	webhookClient = server.Client()
+	config.Cfg.ExportS3URL = server.URL + "/bucket"
+	config.Cfg.ExportURLTTL = 3600
+
+	var mailed tools.Email
+	oldSend := sendReportEmail
+	sendReportEmail = func(_ context.Context, msg tools.Email) error { mailed = msg; return nil }
+	defer func() { sendReportEmail = oldSend }()
+
+	primaryDB, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer primaryDB.Close()
+	primaryDB.SetMaxOpenConns(1)
+	if _, err := primaryDB.Exec(`
+		CREATE TABLE atombase_saved_queries (
+			database_id TEXT NOT NULL, name TEXT NOT NULL, table_name TEXT NOT NULL,
+			query_json TEXT NOT NULL, params_json TEXT NOT NULL DEFAULT '{}',
+			created_at TEXT NOT NULL, updated_at TEXT NOT NULL, PRIMARY KEY (database_id, name)
+		);
+		CREATE TABLE atombase_reports (
+			id TEXT PRIMARY KEY, database_id TEXT NOT NULL, query_name TEXT NOT NULL, cron TEXT NOT NULL,
+			timezone TEXT NOT NULL DEFAULT 'UTC', format TEXT NOT NULL, webhook TEXT NOT NULL DEFAULT '',
+			email TEXT NOT NULL DEFAULT '', next_run_at TEXT NOT NULL, locked_until TEXT, last_run_at TEXT,
+			last_status TEXT, last_error TEXT, last_rows INTEGER, last_url TEXT, created_at TEXT NOT NULL
+		);`); err != nil {
+		t.Fatal(err)
+	}
+	store, err := primarystore.New(primaryDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := setupTestDB(t, schemaUsers)
+	defer db.Close()
+	if _, err := db.Exec(`INSERT INTO users (name, age) VALUES ('Alice', 30), ('Bob', 17), ('Carol', 45)`); err != nil {
+		t.Fatal(err)
+	}
+	dao := &TenantConnection{Client: db, Schema: loadSchema(t, db), ID: "db", primaryStore: store, Principal: definitions.Principal{IsService: true}}
+	ctx := context.Background()
+
+	query := SavedQuery{
+		Name:  "adults",
+		Table: "users",
+		Query: SelectQuery{
+			Select: []any{"name"},
+			Where:  []map[string]any{{"age": map[string]any{OpGte: map[string]any{paramKey: "min_age"}}}},
+			Order:  map[string]string{"name": OrderAsc},
+		},
+	}
+	if _, err := dao.SaveQuery(ctx, query); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dao.CreateReport(ctx, ReportRequest{Query: "adults", Cron: "@daily", Format: ExportCSV}); err == nil {
+		t.Error("expected an error for a param without a default")
+	}
+	query.Params = map[string]any{"min_age": 18}
+	if _, err := dao.SaveQuery(ctx, query); err != nil {
+		t.Fatal(err)
+	}
+	for name, req := range map[string]ReportRequest{
+		"cron":     {Query: "adults", Cron: "every day", Format: ExportCSV},
+		"timezone": {Query: "adults", Cron: "@daily", Timezone: "Mars/Olympus", Format: ExportCSV},
+		"format":   {Query: "adults", Cron: "@daily", Format: "xlsx"},
+		"query":    {Query: "missing", Cron: "@daily", Format: ExportCSV},
+		"webhook":  {Query: "adults", Cron: "@daily", Format: ExportCSV, Webhook: "http://127.0.0.1/hook"},
+	} {
+		if _, err := dao.CreateReport(ctx, req); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	checkWebhookURL = func(string) error { return nil }
+
+	// A key limited to other tables can't export users through a report.
+	scoped := *dao
+	scoped.Principal = definitions.Principal{IsService: true, KeyScope: &tools.APIKeyScope{KeyID: "k1", Tables: []string{"posts"}, Verbs: []string{tools.VerbAdmin}}}
+	if _, err := scoped.CreateReport(ctx, ReportRequest{Query: "adults", Cron: "@daily", Format: ExportCSV, Webhook: server.URL + "/hook"}); !errors.Is(err, tools.ErrAPIKeyScope) {
+		t.Errorf("a scoped key created a report: %v", err)
+	}
+
+	report, err := dao.CreateReport(ctx, ReportRequest{Query: "adults", Cron: "0 6 * * *", Timezone: "UTC", Format: ExportCSV, Webhook: server.URL + "/hook", Email: "ops@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.NextRunAt.Hour() != 6 || report.NextRunAt.Minute() != 0 {
+		t.Errorf("next run at %s", report.NextRunAt)
+	}
+
+	api := &API{store: store}
+	now := time.Now().Add(48 * time.Hour)
+	due, err := store.ClaimDueReports(ctx, now, now.Add(time.Hour), 10)
+	if err != nil || len(due) != 1 {
+		t.Fatalf("got %v, %v", due, err)
+	}
+	if again, _ := store.ClaimDueReports(ctx, now, now.Add(time.Hour), 10); len(again) != 0 {
+		t.Error("a claimed report was claimed again")
+	}
+
+	run := dao.runReport(ctx, due[0], exportStore(), now)
+	if run.Status != ExportDone || run.Rows != 2 || run.URL == "" {
+		t.Fatalf("got %+v", run)
+	}
+	if err := api.finishReport(ctx, due[0], run); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	var csv string
+	for key, body := range uploads {
+		if strings.HasPrefix(key, "/bucket/db/"+report.ID+"-") && strings.HasSuffix(key, ".csv") {
+			csv = body
+		}
+	}
+	gotHook := notified
+	mu.Unlock()
+	if csv != "name\nAlice\nCarol\n" {
+		t.Errorf("uploaded %v", uploads)
+	}
+	if gotHook.Report != report.ID || gotHook.Rows != 2 || gotHook.Status != ExportDone {
+		t.Errorf("webhook got %+v", gotHook)
+	}
+	if mailed.To != "ops@example.com" || !strings.Contains(mailed.Text, run.URL) {
+		t.Errorf("mailed %+v", mailed)
+	}
+
+	reports, err := dao.ListReports(ctx)
+	if err != nil || len(reports) != 1 {
+		t.Fatalf("got %v, %v", reports, err)
+	}
+	if last := reports[0].LastRun; last == nil || last.Status != ExportDone || last.Rows != 2 || !reports[0].NextRunAt.After(report.NextRunAt.Add(-time.Minute)) {
+		t.Errorf("got %+v", reports[0])
+	}
+	if _, err := scoped.ListReports(ctx); !errors.Is(err, tools.ErrAPIKeyScope) {
+		t.Errorf("a scoped key listed reports: %v", err)
+	}
+	if err := scoped.DeleteReport(ctx, report.ID); !errors.Is(err, tools.ErrAPIKeyScope) {
+		t.Errorf("a scoped key deleted a report: %v", err)
+	}
+	if err := dao.DeleteReport(ctx, report.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := dao.DeleteReport(ctx, report.ID); err == nil {
+		t.Error("expected an error deleting a missing report")
+	}
+}
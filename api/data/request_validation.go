@@ -0,0 +1,200 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/atombasedev/atombase/tools"
+)
+
+// validationPatterns caches compiled ColumnRule patterns. Patterns are checked
+// when a definition is saved, so compiling one here only fails for schemas
+// stored before validation existed.
+var validationPatterns sync.Map // pattern -> *regexp.Regexp
+
+// fieldRulePhrases words FieldRule operators for violation messages.
+var fieldRulePhrases = map[string]string{
+	OpEq: "equal", OpNeq: "differ from", OpLt: "be less than", OpLte: "be at most",
+	OpGt: "be greater than", OpGte: "be at least",
+}
+
+// validateWrite checks rows against the table's settings.validation before any
+// SQL is built. operation is insert or update; upserts validate as inserts.
+// Every violation is reported at once so clients can fix a form in one pass.
+func (schema SchemaCache) validateWrite(table, operation string, rows []map[string]any) error {
+	if schema.Settings == nil {
+		return nil
+	}
+	validation, ok := schema.Settings.Validation[table]
+	if !ok {
+		return nil
+	}
+	columns := make([]string, 0, len(validation.Columns))
+	for column := range validation.Columns {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+
+	var violations []string
+	for i, row := range rows {
+		prefix := ""
+		if len(rows) > 1 {
+			prefix = fmt.Sprintf("row %d: ", i)
+		}
+		for _, column := range columns {
+			rule := validation.Columns[column]
+			if problem := columnViolation(rule, operation, row, column); problem != "" {
+				if rule.Message != "" {
+					problem = rule.Message
+				}
+				violations = append(violations, prefix+column+" "+problem)
+			}
+		}
+		for _, rule := range validation.Rules {
+			left, leftOK := row[rule.Column]
+			right, rightOK := row[rule.Other]
+			if !leftOK || !rightOK || left == nil || right == nil {
+				continue
+			}
+			cmp, comparable := compareValidationValues(left, right)
+			if comparable && fieldRuleHolds(rule.Op, cmp) {
+				continue
+			}
+			message := rule.Message
+			if message == "" {
+				message = fmt.Sprintf("%s must %s %s", rule.Column, fieldRulePhrases[rule.Op], rule.Other)
+			}
+			violations = append(violations, prefix+message)
+		}
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", tools.ErrValidationFailed, strings.Join(violations, "; "))
+}
+
+// columnViolation describes how a row breaks a column rule, or returns "".
+func columnViolation(rule ColumnRule, operation string, row map[string]any, column string) string {
+	value, present := row[column]
+	if !present || value == nil {
+		if slices.Contains(rule.Required, operation) {
+			return "is required"
+		}
+		return ""
+	}
+
+	if rule.Min != nil || rule.Max != nil {
+		n, ok := validationNumber(value)
+		if !ok {
+			return "must be a number"
+		}
+		if rule.Min != nil && n < *rule.Min {
+			return fmt.Sprintf("must be at least %v", *rule.Min)
+		}
+		if rule.Max != nil && n > *rule.Max {
+			return fmt.Sprintf("must be at most %v", *rule.Max)
+		}
+	}
+
+	if rule.Pattern == "" && rule.MinLength == nil && rule.MaxLength == nil {
+		return ""
+	}
+	text, ok := value.(string)
+	if !ok {
+		return "must be text"
+	}
+	length := utf8.RuneCountInString(text)
+	if rule.MinLength != nil && length < *rule.MinLength {
+		return fmt.Sprintf("must be at least %d characters", *rule.MinLength)
+	}
+	if rule.MaxLength != nil && length > *rule.MaxLength {
+		return fmt.Sprintf("must be at most %d characters", *rule.MaxLength)
+	}
+	if rule.Pattern != "" {
+		re, err := validationPattern(rule.Pattern)
+		if err != nil || !re.MatchString(text) {
+			return fmt.Sprintf("must match %s", rule.Pattern)
+		}
+	}
+	return ""
+}
+
+func validationPattern(pattern string) (*regexp.Regexp, error) {
+	if cached, ok := validationPatterns.Load(pattern); ok {
+		return cached.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	validationPatterns.Store(pattern, re)
+	return re, nil
+}
+
+func validationNumber(value any) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// compareValidationValues orders two numbers numerically or two strings
+// lexically, which also orders ISO 8601 timestamps.
+func compareValidationValues(a, b any) (int, bool) {
+	if x, ok := validationNumber(a); ok {
+		y, ok := validationNumber(b)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case x < y:
+			return -1, true
+		case x > y:
+			return 1, true
+		}
+		return 0, true
+	}
+	x, ok := a.(string)
+	if !ok {
+		return 0, false
+	}
+	y, ok := b.(string)
+	if !ok {
+		return 0, false
+	}
+	return strings.Compare(x, y), true
+}
+
+func fieldRuleHolds(op string, cmp int) bool {
+	switch op {
+	case OpEq:
+		return cmp == 0
+	case OpNeq:
+		return cmp != 0
+	case OpLt:
+		return cmp < 0
+	case OpLte:
+		return cmp <= 0
+	case OpGt:
+		return cmp > 0
+	case OpGte:
+		return cmp >= 0
+	}
+	return false
+}
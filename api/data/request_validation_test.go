@@ -0,0 +1,81 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/atombasedev/atombase/tools"
+)
+
+func TestValidateWrite(t *testing.T) {
+	db := setupTestDB(t, `
+		CREATE TABLE events (
+			id INTEGER PRIMARY KEY,
+			title TEXT,
+			slug TEXT,
+			seats INTEGER,
+			starts_at TEXT,
+			ends_at TEXT
+		);
+	`)
+	defer db.Close()
+	schema := loadSchema(t, db)
+	minSeats, maxSeats, maxTitle := 1.0, 500.0, 10
+	schema.Settings = &APISettings{Validation: map[string]TableValidation{"events": {
+		Columns: map[string]ColumnRule{
+			"title": {Required: []string{"insert"}, MaxLength: &maxTitle},
+			"slug":  {Pattern: `^[a-z0-9-]+$`, Message: "may only contain lowercase letters, digits and dashes"},
+			"seats": {Min: &minSeats, Max: &maxSeats},
+		},
+		Rules: []FieldRule{{Column: "starts_at", Op: "lt", Other: "ends_at"}},
+	}}}
+	dao := &TenantConnection{Client: db, Schema: schema}
+	ctx := context.Background()
+
+	if _, err := dao.InsertJSON(ctx, "events", InsertRequest{Data: RowData{
+		{"id": 1, "title": "Launch", "slug": "launch", "seats": 20, "starts_at": "2026-01-01T10:00", "ends_at": "2026-01-01T12:00"},
+	}}); err != nil {
+		t.Fatalf("expected a valid row to insert, got %v", err)
+	}
+
+	_, err := dao.InsertJSON(ctx, "events", InsertRequest{Data: RowData{
+		{"id": 2, "title": "Fine", "seats": 5},
+		{"id": 3, "slug": "Bad Slug", "seats": 0, "starts_at": "2026-02-02", "ends_at": "2026-02-01"},
+	}})
+	if !errors.Is(err, tools.ErrValidationFailed) {
+		t.Fatalf("expected ErrValidationFailed, got %v", err)
+	}
+	for _, want := range []string{
+		"row 1: seats must be at least 1",
+		"row 1: slug may only contain lowercase letters, digits and dashes",
+		"row 1: title is required",
+		"row 1: starts_at must be less than ends_at",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %q in %v", want, err)
+		}
+	}
+	if strings.Contains(err.Error(), "row 0") {
+		t.Errorf("the valid row should not be reported: %v", err)
+	}
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM events`).Scan(&count); err != nil || count != 1 {
+		t.Fatalf("expected nothing to be written, found %d rows (%v)", count, err)
+	}
+
+	// Updates only need the columns they set, but those are still checked.
+	if _, err := dao.UpdateJSON(ctx, "events", UpdateRequest{
+		Data:  map[string]any{"seats": 40},
+		Where: []map[string]any{{"id": map[string]any{"eq": 1}}},
+	}); err != nil {
+		t.Fatalf("expected a partial update to pass, got %v", err)
+	}
+	if _, err := dao.UpdateJSON(ctx, "events", UpdateRequest{
+		Data:  map[string]any{"title": "A much longer title"},
+		Where: []map[string]any{{"id": map[string]any{"eq": 1}}},
+	}); err == nil || !strings.Contains(err.Error(), "title must be at most 10 characters") {
+		t.Fatalf("expected the title length to be enforced, got %v", err)
+	}
+}
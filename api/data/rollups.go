@@ -0,0 +1,281 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/atombasedev/atombase/definitions"
+	"github.com/atombasedev/atombase/tools"
+)
+
+const (
+	rollupPollInterval = time.Minute     // Time between rollup scheduler passes
+	rollupTimeout      = 5 * time.Minute // Time one database's rollups may take
+)
+
+// RollupStatus is how far a rollup has aggregated its table.
+type RollupStatus struct {
+	Table      string    `json:"table"`
+	Resolution string    `json:"resolution"`
+	Rows       int64     `json:"rows"`    // Rollup rows written by this refresh
+	Through    time.Time `json:"through"` // Start of the first interval not yet aggregated
+}
+
+func rollupTableName(table, resolution string) string {
+	return table + "_rollup_" + resolution
+}
+
+// rollupCacheTables returns the read-only tables a time-series table's
+// rollups are selected from, typed as the platform creates them.
+func rollupCacheTables(t Table) []CacheTable {
+	if t.TimeSeries == nil {
+		return nil
+	}
+	var tables []CacheTable
+	for _, rollup := range t.TimeSeries.Rollups {
+		timeCol := t.TimeSeries.Column
+		tbl := CacheTable{
+			Name:    rollupTableName(t.Name, rollup.Resolution),
+			Pk:      append([]string{timeCol}, rollup.GroupBy...),
+			Columns: map[string]string{timeCol: t.Columns[timeCol].Type},
+		}
+		for _, column := range rollup.GroupBy {
+			tbl.Columns[column] = t.Columns[column].Type
+		}
+		for name, agg := range rollup.Aggregates {
+			switch agg.Fn {
+			case "count":
+				tbl.Columns[name] = ColTypeInteger
+			case "avg":
+				tbl.Columns[name] = ColTypeReal
+			default:
+				tbl.Columns[name] = t.Columns[agg.Column].Type
+			}
+		}
+		tables = append(tables, tbl)
+	}
+	return tables
+}
+
+// rollupTable returns the table a select at resolution reads: a rollup of
+// table, or the table itself for raw.
+func (schema SchemaCache) rollupTable(table, resolution string) (string, error) {
+	if resolution == "raw" {
+		return table, nil
+	}
+	ts, ok := schema.TimeSeries[table]
+	if !ok {
+		return "", tools.InvalidRequestErr(fmt.Sprintf("table %s is not a time series", table))
+	}
+	var available []string
+	for _, rollup := range ts.Rollups {
+		if rollup.Resolution == resolution {
+			return rollupTableName(table, resolution), nil
+		}
+		available = append(available, rollup.Resolution)
+	}
+	return "", tools.InvalidRequestErr(fmt.Sprintf("table %s has no %s rollup (resolutions: %s)",
+		table, resolution, strings.Join(append(available, "raw"), ", ")))
+}
+
+// compileRollupPolicy applies a table's select policy to its rollups. A
+// rollup interval sums up rows of every caller, so a policy that filters
+// rows can't be applied to it and only one that allows the whole table lets
+// the caller read it.
+func (dao *TenantConnection) compileRollupPolicy(ctx context.Context, table string) (definitions.CompiledPredicate, error) {
+	predicate, err := dao.compilePolicy(ctx, table, "select", nil)
+	if err != nil {
+		return definitions.CompiledPredicate{}, err
+	}
+	if predicate.SQL != "" {
+		return definitions.CompiledPredicate{}, tools.UnauthorizedErr(fmt.Sprintf("rollups of %s need a select policy that allows every row", table))
+	}
+	return predicate, nil
+}
+
+// rollupOf returns the time-series table a rollup table aggregates.
+func (dao *TenantConnection) rollupOf(table string) (string, bool) {
+	if dao == nil {
+		return "", false
+	}
+	base, ok := dao.Schema.Rollups[table]
+	return base, ok
+}
+
+// unixExpr is a time-series table's time column as unix seconds.
+func (schema SchemaCache) unixExpr(table string) string {
+	column := schema.TimeSeries[table].Column
+	if strings.EqualFold(schema.Tables[table].Columns[column], ColTypeInteger) {
+		return "[" + column + "]"
+	}
+	return fmt.Sprintf("CAST(strftime('%%s', [%s]) AS INTEGER)", column)
+}
+
+// RefreshRollups aggregates the intervals that ended since each rollup was
+// last refreshed, of table or of every time-series table when table is "".
+// The interval now falls in is left until it ends, and rows that arrive for
+// an interval already aggregated are only counted by a rebuild, which
+// aggregates every rollup again from the rows the table still has.
+func (dao *TenantConnection) RefreshRollups(ctx context.Context, table string, now time.Time, rebuild bool) ([]RollupStatus, error) {
+	var listed bool
+	if err := dao.Client.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = 'atombase_rollups')`).Scan(&listed); err != nil || !listed {
+		return []RollupStatus{}, err
+	}
+	tables := make([]string, 0, len(dao.Schema.TimeSeries))
+	for name := range dao.Schema.TimeSeries {
+		if table == "" || name == table {
+			tables = append(tables, name)
+		}
+	}
+	sort.Strings(tables)
+
+	statuses := []RollupStatus{}
+	for _, name := range tables {
+		for _, rollup := range dao.Schema.TimeSeries[name].Rollups {
+			status, err := dao.refreshRollup(ctx, name, rollup, now, rebuild)
+			if err != nil {
+				return statuses, fmt.Errorf("%s rollup of %s: %w", rollup.Resolution, name, err)
+			}
+			statuses = append(statuses, status)
+		}
+	}
+	return statuses, nil
+}
+
+func (dao *TenantConnection) refreshRollup(ctx context.Context, table string, rollup Rollup, now time.Time, rebuild bool) (RollupStatus, error) {
+	name := rollupTableName(table, rollup.Resolution)
+	seconds := definitions.RollupSeconds[rollup.Resolution]
+	end := now.Unix() / seconds * seconds
+	status := RollupStatus{Table: table, Resolution: rollup.Resolution, Through: time.Unix(end, 0).UTC()}
+
+	tx, err := dao.Client.BeginTx(ctx, nil)
+	if err != nil {
+		return status, err
+	}
+	defer tx.Rollback()
+
+	var through sql.NullInt64
+	if err := tx.QueryRowContext(ctx, `SELECT through FROM atombase_rollups WHERE name = ?`, name).Scan(&through); err != nil && err != sql.ErrNoRows {
+		return status, err
+	}
+	if rebuild {
+		through.Valid = false
+	}
+	if through.Valid && through.Int64 >= end {
+		status.Through = time.Unix(through.Int64, 0).UTC()
+		return status, nil
+	}
+
+	unix := dao.Schema.unixExpr(table)
+	timeCol := dao.Schema.TimeSeries[table].Column
+	bucket := fmt.Sprintf("(%s / %d) * %d", unix, seconds, seconds)
+	if !strings.EqualFold(dao.Schema.Tables[table].Columns[timeCol], ColTypeInteger) {
+		bucket = fmt.Sprintf("datetime(%s, 'unixepoch')", bucket)
+	}
+	columns := []string{"[" + timeCol + "]"}
+	selects := []string{bucket}
+	groups := []string{"1"}
+	for _, column := range rollup.GroupBy {
+		columns = append(columns, "["+column+"]")
+		selects = append(selects, "["+column+"]")
+		groups = append(groups, "["+column+"]")
+	}
+	aggNames := make([]string, 0, len(rollup.Aggregates))
+	for agg := range rollup.Aggregates {
+		aggNames = append(aggNames, agg)
+	}
+	sort.Strings(aggNames)
+	for _, agg := range aggNames {
+		columns = append(columns, "["+agg+"]")
+		selects = append(selects, aggregateExpr(rollup.Aggregates[agg]))
+	}
+
+	// A rebuild empties the rollup and aggregates it from the start.
+	deleteSQL, where := fmt.Sprintf("DELETE FROM [%s]", name), fmt.Sprintf("%s < ?", unix)
+	args, deleteArgs := []any{end}, []any(nil)
+	if through.Valid {
+		deleteSQL += fmt.Sprintf(" WHERE %s >= ?", unix)
+		where = fmt.Sprintf("%s >= ? AND %s", unix, where)
+		args, deleteArgs = []any{through.Int64, end}, []any{through.Int64}
+	}
+	if _, err := tx.ExecContext(ctx, deleteSQL, deleteArgs...); err != nil {
+		return status, err
+	}
+	res, err := tx.ExecContext(ctx, fmt.Sprintf("INSERT INTO [%s] (%s) SELECT %s FROM %s WHERE %s GROUP BY %s",
+		name, strings.Join(columns, ", "), strings.Join(selects, ", "), dao.Schema.source(table), where, strings.Join(groups, ", ")), args...)
+	if err != nil {
+		return status, err
+	}
+	if status.Rows, err = res.RowsAffected(); err != nil {
+		return status, err
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO atombase_rollups (name, tbl, resolution, through) VALUES (?, ?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET through = excluded.through`, name, table, rollup.Resolution, end); err != nil {
+		return status, err
+	}
+	return status, tx.Commit()
+}
+
+func aggregateExpr(agg Aggregate) string {
+	if agg.Column == "" {
+		return "COUNT(*)"
+	}
+	return fmt.Sprintf("%s([%s])", strings.ToUpper(agg.Fn), agg.Column)
+}
+
+// RunRollupScheduler refreshes the rollups of every database that has any
+// until stop is closed. A refresh only writes intervals that ended, the
+// same way from any server, so servers sharing the primary database may
+// each run the scheduler.
+func (api *API) RunRollupScheduler(stop <-chan struct{}) {
+	ticker := time.NewTicker(rollupPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			if err := api.refreshDueRollups(context.Background(), now); err != nil {
+				tools.Logger.Error("rollup scheduling failed", "error", err)
+			}
+		}
+	}
+}
+
+func (api *API) refreshDueRollups(ctx context.Context, now time.Time) error {
+	ids, err := api.store.ListRollupDatabases(ctx)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		runCtx, cancel := context.WithTimeout(ctx, rollupTimeout)
+		if err := api.refreshDatabaseRollups(runCtx, id, now); err != nil {
+			tools.Logger.Error("rollup refresh failed", "database_id", id, "error", err)
+		}
+		cancel()
+	}
+	return nil
+}
+
+// refreshDatabaseRollups connects to a database as the service and
+// refreshes its rollups.
+func (api *API) refreshDatabaseRollups(ctx context.Context, id string, now time.Time) error {
+	target, err := api.store.LookupDatabaseTarget(ctx, id)
+	if err != nil {
+		return err
+	}
+	dao, err := api.connTurso(definitions.Principal{IsService: true}, target)
+	if err != nil {
+		return err
+	}
+	defer dao.Close()
+	if err := MigrateIfNeeded(ctx, &dao); err != nil {
+		return err
+	}
+	_, err = dao.RefreshRollups(ctx, "", now, false)
+	return err
+}
@@ -0,0 +1,129 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+const schemaRollupEvents = `
+CREATE TABLE events (id INTEGER PRIMARY KEY, at INTEGER NOT NULL, kind TEXT, value REAL);
+CREATE VIEW events_series AS SELECT * FROM events;
+CREATE TABLE atombase_rollups (name TEXT PRIMARY KEY, tbl TEXT NOT NULL, resolution TEXT NOT NULL, through INTEGER);
+CREATE TABLE events_rollup_hour (at INTEGER NOT NULL, kind TEXT, avg_value REAL, n INTEGER, PRIMARY KEY (at, kind));
+INSERT INTO atombase_rollups (name, tbl, resolution) VALUES ('events_rollup_hour', 'events', 'hour');
+`
+
+func rollupSchema(t *testing.T) SchemaCache {
+	t.Helper()
+	data, err := json.Marshal(Schema{Tables: []Table{{
+		Name: "events",
+		Pk:   []string{"id"},
+		Columns: map[string]Col{
+			"id":    {Name: "id", Type: "INTEGER"},
+			"at":    {Name: "at", Type: "INTEGER"},
+			"kind":  {Name: "kind", Type: "TEXT"},
+			"value": {Name: "value", Type: "REAL"},
+		},
+		TimeSeries: &TimeSeries{Column: "at", Rollups: []Rollup{{
+			Resolution: "hour",
+			GroupBy:    []string{"kind"},
+			Aggregates: map[string]Aggregate{"n": {Fn: "count"}, "avg_value": {Fn: "avg", Column: "value"}},
+		}}},
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema, err := decodeSchemaCache(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return schema
+}
+
+func TestRefreshRollups(t *testing.T) {
+	db := setupTestDB(t, schemaRollupEvents)
+	defer db.Close()
+	base := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC).Unix()
+	for _, row := range []struct {
+		offset int64
+		kind   string
+		value  float64
+	}{{60, "a", 1}, {120, "a", 3}, {600, "b", 10}, {3600 + 60, "a", 5}, {2*3600 + 5, "a", 7}} {
+		if _, err := db.Exec(`INSERT INTO events (at, kind, value) VALUES (?, ?, ?)`, base+row.offset, row.kind, row.value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dao := &TenantConnection{Client: db, Schema: rollupSchema(t)}
+	ctx := context.Background()
+
+	// At 12:30 the 10:00 and 11:00 hours are over; 12:00 is not.
+	now := time.Unix(base+2*3600+1800, 0)
+	statuses, err := dao.RefreshRollups(ctx, "", now, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 1 || statuses[0].Rows != 3 || statuses[0].Through.Unix() != base+2*3600 {
+		t.Fatalf("unexpected refresh %+v", statuses)
+	}
+
+	table, err := dao.Schema.rollupTable("events", "hour")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := dao.SelectJSON(ctx, table, SelectQuery{
+		Where: []map[string]any{{"kind": map[string]any{"eq": "a"}}},
+		Order: map[string]string{"at": "asc"},
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rows []struct {
+		At       int64   `json:"at"`
+		N        int     `json:"n"`
+		AvgValue float64 `json:"avg_value"`
+	}
+	if err := json.Unmarshal(result.Data, &rows); err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0].At != base || rows[0].N != 2 || rows[0].AvgValue != 2 || rows[1].At != base+3600 || rows[1].N != 1 {
+		t.Fatalf("unexpected hourly rows %s", result.Data)
+	}
+
+	// A second refresh in the same hour has nothing to add.
+	statuses, err = dao.RefreshRollups(ctx, "events", now, false)
+	if err != nil || statuses[0].Rows != 0 {
+		t.Fatalf("expected nothing to refresh, got %+v, %v", statuses, err)
+	}
+
+	// A late row is only counted by a rebuild.
+	if _, err := db.Exec(`INSERT INTO events (at, kind, value) VALUES (?, 'b', 20)`, base+900); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dao.RefreshRollups(ctx, "events", now, true); err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	var avg float64
+	if err := db.QueryRow(`SELECT n, avg_value FROM events_rollup_hour WHERE at = ? AND kind = 'b'`, base).Scan(&n, &avg); err != nil || n != 2 || avg != 15 {
+		t.Fatalf("expected the rebuild to count the late row, got %d %v %v", n, avg, err)
+	}
+
+	if _, err := dao.InsertJSON(ctx, table, InsertRequest{Data: []map[string]any{{"at": base, "n": 1}}}); err == nil {
+		t.Error("expected rollups to be read-only")
+	}
+}
+
+func TestRollupTable(t *testing.T) {
+	schema := rollupSchema(t)
+	if table, err := schema.rollupTable("events", "raw"); err != nil || table != "events" {
+		t.Fatalf("expected raw to read the table, got %q, %v", table, err)
+	}
+	if _, err := schema.rollupTable("events", "day"); err == nil {
+		t.Error("expected a missing resolution to be refused")
+	}
+	if schema.Rollups["events_rollup_hour"] != "events" || !schema.Views["events_rollup_hour"] {
+		t.Errorf("expected the rollup cached as a view of events, got %v", schema.Rollups)
+	}
+}
@@ -0,0 +1,89 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/atombasedev/atombase/definitions"
+	"github.com/atombasedev/atombase/tools"
+)
+
+var errNoTenantColumn = errors.New("shared database has no tenant column configured")
+
+// tenantColumn returns the column scoping rows to the connection's row tenant,
+// or "" when the connection serves a dedicated database.
+func (dao *TenantConnection) tenantColumn() (string, error) {
+	if dao == nil || dao.RowTenant == "" {
+		return "", nil
+	}
+	if dao.Schema.Settings == nil || dao.Schema.Settings.TenantColumn == "" {
+		return "", errNoTenantColumn
+	}
+	return dao.Schema.Settings.TenantColumn, nil
+}
+
+// scopeToRowTenant narrows an access policy predicate to the row tenant's rows.
+// Inserts are not narrowed here since the inserted rows are stamped instead.
+func (dao *TenantConnection) scopeToRowTenant(table, operation string, predicate definitions.CompiledPredicate) (definitions.CompiledPredicate, error) {
+	column, err := dao.tenantColumn()
+	if err != nil || column == "" || operation == "insert" {
+		return predicate, err
+	}
+	clause := fmt.Sprintf("[%s].[%s] = ?", table, column)
+	if predicate.SQL == "" {
+		predicate.SQL = clause
+	} else {
+		predicate.SQL = "(" + predicate.SQL + ") AND " + clause
+	}
+	predicate.Args = append(append([]any{}, predicate.Args...), dao.RowTenant)
+	return predicate, nil
+}
+
+// stampRowTenant returns copies of rows with the tenant column set to the row
+// tenant. Rows that already name a different tenant are rejected.
+func (dao *TenantConnection) stampRowTenant(rows []map[string]any) ([]map[string]any, error) {
+	column, err := dao.tenantColumn()
+	if err != nil || column == "" {
+		return rows, err
+	}
+	stamped := make([]map[string]any, len(rows))
+	for i, row := range rows {
+		if err := dao.checkRowTenantValue(column, row); err != nil {
+			return nil, err
+		}
+		copied := make(map[string]any, len(row)+1)
+		for key, value := range row {
+			copied[key] = value
+		}
+		copied[column] = dao.RowTenant
+		stamped[i] = copied
+	}
+	return stamped, nil
+}
+
+// checkRowTenantUpdate rejects updates that would move rows to another tenant.
+func (dao *TenantConnection) checkRowTenantUpdate(data map[string]any) error {
+	column, err := dao.tenantColumn()
+	if err != nil || column == "" {
+		return err
+	}
+	return dao.checkRowTenantValue(column, data)
+}
+
+func (dao *TenantConnection) checkRowTenantValue(column string, row map[string]any) error {
+	value, ok := row[column]
+	if !ok || value == dao.RowTenant {
+		return nil
+	}
+	return tools.InvalidRequestErr(fmt.Sprintf("%s cannot be set to another tenant", column))
+}
+
+// rowTenantConflictClause keeps an upsert from overwriting a row that belongs to
+// another tenant when the inserted key collides with it.
+func (dao *TenantConnection) rowTenantConflictClause(table string) (string, error) {
+	column, err := dao.tenantColumn()
+	if err != nil || column == "" {
+		return "", err
+	}
+	return fmt.Sprintf("WHERE [%s].[%s] = excluded.[%s] ", table, column, column), nil
+}
@@ -0,0 +1,111 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/atombasedev/atombase/tools"
+)
+
+func TestRowTenant_ScopesQueriesToTenant(t *testing.T) {
+	db := setupTestDB(t, schemaUsers+`ALTER TABLE users ADD COLUMN tenant_id TEXT;
+INSERT INTO users (id, name, tenant_id) VALUES (1, 'ann', 'user-a'), (2, 'bob', 'user-b');`)
+	defer db.Close()
+	schema := loadSchema(t, db)
+	schema.Settings = &APISettings{TenantColumn: "tenant_id"}
+	dao := &TenantConnection{Client: db, Schema: schema, RowTenant: "user-a"}
+	ctx := context.Background()
+
+	if _, err := dao.InsertJSON(ctx, "users", InsertRequest{Data: RowData{{"id": 3, "name": "cat"}}}); err != nil {
+		t.Fatalf("InsertJSON failed: %v", err)
+	}
+	var tenant string
+	if err := db.QueryRow(`SELECT tenant_id FROM users WHERE id = 3`).Scan(&tenant); err != nil || tenant != "user-a" {
+		t.Fatalf("expected inserted row to be stamped, got %q (%v)", tenant, err)
+	}
+	if _, err := dao.InsertJSON(ctx, "users", InsertRequest{Data: RowData{{"id": 4, "name": "dan", "tenant_id": "user-b"}}}); err == nil {
+		t.Fatal("expected insert for another tenant to be rejected")
+	}
+
+	result, err := dao.SelectJSON(ctx, "users", SelectQuery{
+		Select: []any{"id"},
+		Where:  []map[string]any{{"id": map[string]any{"in": []any{1, 2, 3}}}},
+	}, true)
+	if err != nil {
+		t.Fatalf("SelectJSON failed: %v", err)
+	}
+	var rows []map[string]any
+	if err := json.Unmarshal(result.Data, &rows); err != nil {
+		t.Fatal(err)
+	}
+	if result.Count != 2 || len(rows) != 2 {
+		t.Fatalf("expected only the tenant's rows, got count=%d rows=%v", result.Count, rows)
+	}
+
+	updated, err := dao.UpdateJSON(ctx, "users", UpdateRequest{
+		Data:  map[string]any{"name": "renamed"},
+		Where: []map[string]any{{"id": map[string]any{"eq": 2}}},
+	})
+	if err != nil {
+		t.Fatalf("UpdateJSON failed: %v", err)
+	}
+	if string(updated) != `{"rows_affected":0}` {
+		t.Fatalf("expected another tenant's row to be untouched, got %s", updated)
+	}
+	if _, err := dao.UpdateJSON(ctx, "users", UpdateRequest{
+		Data:  map[string]any{"tenant_id": "user-b"},
+		Where: []map[string]any{{"id": map[string]any{"eq": 1}}},
+	}); err == nil {
+		t.Fatal("expected moving a row to another tenant to be rejected")
+	}
+
+	if _, err := dao.UpsertJSON(ctx, "users", UpsertRequest{Data: RowData{{"id": 2, "name": "stolen"}}}); err != nil {
+		t.Fatalf("UpsertJSON failed: %v", err)
+	}
+	var name string
+	if err := db.QueryRow(`SELECT name FROM users WHERE id = 2`).Scan(&name); err != nil || name != "bob" {
+		t.Fatalf("expected upsert to leave another tenant's row alone, got %q (%v)", name, err)
+	}
+
+	deleted, err := dao.DeleteJSON(ctx, "users", DeleteRequest{Where: []map[string]any{{"id": map[string]any{"in": []any{1, 2}}}}})
+	if err != nil {
+		t.Fatalf("DeleteJSON failed: %v", err)
+	}
+	if string(deleted) != `{"rows_affected":1}` {
+		t.Fatalf("expected only the tenant's row to be deleted, got %s", deleted)
+	}
+}
+
+func TestWritesPaused_RejectsWritesButServesReads(t *testing.T) {
+	db := setupTestDB(t, schemaUsers+`INSERT INTO users (id, name) VALUES (1, 'ann');`)
+	defer db.Close()
+	dao := &TenantConnection{Client: db, Schema: loadSchema(t, db), WritesPaused: true}
+	ctx := context.Background()
+
+	if _, err := dao.InsertJSON(ctx, "users", InsertRequest{Data: RowData{{"id": 2, "name": "bob"}}}); !errors.Is(err, tools.ErrWritesPaused) {
+		t.Fatalf("expected ErrWritesPaused from insert, got %v", err)
+	}
+	if _, err := dao.DeleteJSON(ctx, "users", DeleteRequest{Where: []map[string]any{{"id": map[string]any{"eq": 1}}}}); !errors.Is(err, tools.ErrWritesPaused) {
+		t.Fatalf("expected ErrWritesPaused from delete, got %v", err)
+	}
+	result, err := dao.SelectJSON(ctx, "users", SelectQuery{Select: []any{"id"}}, true)
+	if err != nil {
+		t.Fatalf("SelectJSON failed: %v", err)
+	}
+	if result.Count != 1 {
+		t.Fatalf("expected reads to be served, got count=%d", result.Count)
+	}
+}
+
+func TestRowTenant_RequiresTenantColumn(t *testing.T) {
+	db := setupTestDB(t, schemaUsers)
+	defer db.Close()
+	dao := &TenantConnection{Client: db, Schema: loadSchema(t, db), RowTenant: "user-a"}
+
+	_, err := dao.SelectJSON(context.Background(), "users", SelectQuery{Select: []any{"id"}}, false)
+	if !errors.Is(err, errNoTenantColumn) {
+		t.Fatalf("expected errNoTenantColumn, got %v", err)
+	}
+}
@@ -0,0 +1,196 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/atombasedev/atombase/tools"
+)
+
+// CallFunction runs one of the definition's functions with the params of a
+// call. Statements that return rows answer with them, at most the select
+// limit's maximum; others answer with the number of rows they changed.
+// Functions run without access policies or row tenant scoping, so the caller
+// is only checked against the function's access; events and webhooks don't
+// see their writes.
+func (dao *TenantConnection) CallFunction(ctx context.Context, name string, args map[string]any) (any, error) {
+	var fn Function
+	var ok bool
+	if dao.Schema.Settings != nil {
+		fn, ok = dao.Schema.Settings.Functions[name]
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", tools.ErrFunctionNotFound, name)
+	}
+	if err := dao.checkFunctionAccess(name, fn); err != nil {
+		return nil, err
+	}
+	stmt, bound, err := dao.bindFunction(name, fn, args)
+	if err != nil {
+		return nil, err
+	}
+
+	// The statement runs in a transaction so the rows it changed can be
+	// counted on its connection, and undone when writes are paused or the
+	// request is read-only.
+	tx, err := dao.Client.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	var before, after int64
+	if err := tx.QueryRowContext(ctx, "SELECT total_changes()").Scan(&before); err != nil {
+		return nil, err
+	}
+	rows, err := tx.QueryContext(ctx, stmt, bound...)
+	if err != nil {
+		return nil, dao.functionWriteErr(name, err)
+	}
+	columns, err := rows.Columns()
+	if err != nil {
+		rows.Close()
+		return nil, err
+	}
+	results, err := tools.ScanRows(rows)
+	rows.Close()
+	if err != nil {
+		return nil, dao.functionWriteErr(name, err)
+	}
+	if err := tx.QueryRowContext(ctx, "SELECT total_changes()").Scan(&after); err != nil {
+		return nil, err
+	}
+	if after != before && dao.WritesPaused {
+		return nil, tools.ErrWritesPaused
+	}
+	if after != before && dao.ReadOnly {
+		return nil, fmt.Errorf("%w: function %s writes", tools.ErrReadOnlyRequest, name)
+	}
+	zero := 0
+	if limit := dao.Schema.selectLimit(&zero); limit > 0 && len(results) > limit {
+		return nil, tools.InvalidRequestErr(fmt.Sprintf("function %s returned more than %d rows; add a LIMIT to its sql", name, limit))
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	if len(columns) == 0 {
+		return map[string]any{"rows_affected": after - before}, nil
+	}
+	if results == nil {
+		results = []map[string]any{}
+	}
+	return results, nil
+}
+
+// bindFunction checks a call's params against a function's and returns its
+// statement with positional args.
+func (dao *TenantConnection) bindFunction(name string, fn Function, args map[string]any) (string, []any, error) {
+	var unknown []string
+	for arg := range args {
+		if _, ok := fn.Params[arg]; !ok {
+			unknown = append(unknown, arg)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return "", nil, tools.InvalidRequestErr(fmt.Sprintf("function %s has no params %s", name, strings.Join(unknown, ", ")))
+	}
+
+	stmt, placeholders, err := tools.PositionalParams(fn.SQL)
+	if err != nil {
+		return "", nil, err
+	}
+	values := make(map[string]any, len(fn.Params)+1)
+	if dao.Principal.UserID != "" {
+		values["auth_id"] = dao.Principal.UserID
+	}
+	for paramName, param := range fn.Params {
+		value, passed := args[paramName]
+		if !passed {
+			if param.Required {
+				return "", nil, tools.InvalidRequestErr(fmt.Sprintf("function %s needs param %s", name, paramName))
+			}
+			value = param.Default
+		}
+		if values[paramName], err = functionArg(paramName, param, value); err != nil {
+			return "", nil, err
+		}
+	}
+	bound := make([]any, len(placeholders))
+	for i, placeholder := range placeholders {
+		bound[i] = values[placeholder]
+	}
+	return stmt, bound, nil
+}
+
+// functionWriteErr reports a write PRAGMA query_only refused as a write in a
+// read-only request.
+func (dao *TenantConnection) functionWriteErr(name string, err error) error {
+	if dao.ReadOnly && strings.Contains(err.Error(), "attempt to write a readonly database") {
+		return fmt.Errorf("%w: function %s writes", tools.ErrReadOnlyRequest, name)
+	}
+	return err
+}
+
+// checkFunctionAccess rejects callers the function's access doesn't admit.
+// Scoped API keys are limited to tables and verbs, which a function's SQL
+// can't be checked against, so they may only call public functions.
+func (dao *TenantConnection) checkFunctionAccess(name string, fn Function) error {
+	access := fn.Access
+	if access == "" {
+		access = FunctionAccessService
+	}
+	if access == FunctionAccessPublic {
+		return nil
+	}
+	if dao.Principal.KeyScope != nil {
+		return fmt.Errorf("%w: function %s", tools.ErrAPIKeyScope, name)
+	}
+	switch {
+	case dao.Principal.IsService:
+		return nil
+	case access == FunctionAccessUser && dao.Principal.UserID != "":
+		return nil
+	case access == FunctionAccessUser:
+		return tools.UnauthorizedErr(fmt.Sprintf("function %s needs a signed-in user", name))
+	}
+	return tools.UnauthorizedErr(fmt.Sprintf("function %s needs the service key", name))
+}
+
+// functionArg checks a param's JSON value against its declared type and
+// returns it as it is bound. Null is accepted for any type.
+func functionArg(name string, param FunctionParam, value any) (any, error) {
+	if value == nil {
+		return nil, nil
+	}
+	switch v := value.(type) {
+	case string:
+		if param.Type == "text" {
+			return v, nil
+		}
+	case bool:
+		if param.Type == "boolean" {
+			return v, nil
+		}
+	case float64:
+		switch param.Type {
+		case "real":
+			return v, nil
+		case "integer":
+			if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+				return int64(v), nil
+			}
+		}
+	}
+	return nil, tools.InvalidRequestErr(fmt.Sprintf("param %s must be %s", name, functionTypeArticle(param.Type)))
+}
+
+func functionTypeArticle(paramType string) string {
+	if paramType == "integer" {
+		return "an integer"
+	}
+	return "a " + paramType
+}
@@ -0,0 +1,125 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/atombasedev/atombase/definitions"
+	"github.com/atombasedev/atombase/tools"
+)
+
+func TestCallFunction(t *testing.T) {
+	db := setupTestDB(t, schemaUsers)
+	defer db.Close()
+	if _, err := db.Exec(`INSERT INTO users (name, email, age) VALUES ('Alice', 'u1', 30), ('Bob', 'u2', 17), ('Carol', 'u3', 45)`); err != nil {
+		t.Fatal(err)
+	}
+	schema := loadSchema(t, db)
+	schema.Settings = &APISettings{Functions: map[string]Function{
+		"adults": {
+			SQL:    "SELECT name FROM users WHERE age >= :min_age ORDER BY name",
+			Params: map[string]FunctionParam{"min_age": {Type: "integer", Default: float64(18)}},
+			Access: FunctionAccessPublic,
+		},
+		"me": {
+			SQL:    "SELECT name FROM users WHERE email = :auth_id",
+			Access: FunctionAccessUser,
+		},
+		"deactivate": {
+			SQL:    "UPDATE users SET status = 'inactive' WHERE age < :age",
+			Params: map[string]FunctionParam{"age": {Type: "integer", Required: true}},
+		},
+	}}
+	conn := func(principal definitions.Principal) *TenantConnection {
+		return &TenantConnection{Client: db, Schema: schema, ID: "db", Principal: principal}
+	}
+	service := conn(definitions.Principal{IsService: true})
+	user := conn(definitions.Principal{UserID: "u3"})
+	anonymous := conn(definitions.Principal{})
+	ctx := context.Background()
+
+	names := func(result any) string {
+		t.Helper()
+		rows, ok := result.([]map[string]any)
+		if !ok {
+			t.Fatalf("expected rows, got %#v", result)
+		}
+		out := ""
+		for _, row := range rows {
+			out += row["name"].(string) + " "
+		}
+		return out
+	}
+
+	result, err := anonymous.CallFunction(ctx, "adults", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := names(result); got != "Alice Carol " {
+		t.Errorf("default param: got %q", got)
+	}
+	result, err = anonymous.CallFunction(ctx, "adults", map[string]any{"min_age": float64(40)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := names(result); got != "Carol " {
+		t.Errorf("passed param: got %q", got)
+	}
+	if _, err := anonymous.CallFunction(ctx, "adults", map[string]any{"min_age": "40"}); err == nil {
+		t.Error("expected a text value for an integer param to be rejected")
+	}
+	if _, err := anonymous.CallFunction(ctx, "adults", map[string]any{"max_age": float64(40)}); err == nil {
+		t.Error("expected an undeclared param to be rejected")
+	}
+
+	if _, err := anonymous.CallFunction(ctx, "me", nil); !errors.Is(err, tools.ErrUnauthorized) {
+		t.Errorf("expected a user function to need a user, got %v", err)
+	}
+	result, err = user.CallFunction(ctx, "me", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := names(result); got != "Carol " {
+		t.Errorf("auth_id: got %q", got)
+	}
+
+	if _, err := user.CallFunction(ctx, "deactivate", map[string]any{"age": float64(18)}); !errors.Is(err, tools.ErrUnauthorized) {
+		t.Errorf("expected a service function to refuse users, got %v", err)
+	}
+	if _, err := service.CallFunction(ctx, "deactivate", nil); err == nil {
+		t.Error("expected a missing required param to be rejected")
+	}
+	scoped := conn(definitions.Principal{IsService: true, KeyScope: &tools.APIKeyScope{KeyID: "key_1", Tables: []string{"users"}}})
+	if _, err := scoped.CallFunction(ctx, "deactivate", map[string]any{"age": float64(18)}); !errors.Is(err, tools.ErrAPIKeyScope) {
+		t.Errorf("expected a scoped key to be refused, got %v", err)
+	}
+	if _, err := scoped.CallFunction(ctx, "adults", nil); err != nil {
+		t.Errorf("expected a scoped key to call a public function, got %v", err)
+	}
+
+	paused := conn(definitions.Principal{IsService: true})
+	paused.WritesPaused = true
+	if _, err := paused.CallFunction(ctx, "deactivate", map[string]any{"age": float64(18)}); !errors.Is(err, tools.ErrWritesPaused) {
+		t.Errorf("expected writes to be paused, got %v", err)
+	}
+	var inactive int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM users WHERE status = 'inactive'`).Scan(&inactive); err != nil || inactive != 0 {
+		t.Fatalf("expected the paused write to roll back, got %d, %v", inactive, err)
+	}
+	if _, err := paused.CallFunction(ctx, "adults", nil); err != nil {
+		t.Errorf("expected reads while writes are paused, got %v", err)
+	}
+
+	result, err = service.CallFunction(ctx, "deactivate", map[string]any{"age": float64(18)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if affected := result.(map[string]any)["rows_affected"]; affected != int64(1) {
+		t.Errorf("rows_affected: got %v", affected)
+	}
+
+	if _, err := service.CallFunction(ctx, "missing", nil); !errors.Is(err, tools.ErrFunctionNotFound) {
+		t.Errorf("expected an unknown function to be not found, got %v", err)
+	}
+}
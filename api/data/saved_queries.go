@@ -0,0 +1,258 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/atombasedev/atombase/primarystore"
+	"github.com/atombasedev/atombase/tools"
+)
+
+// paramKey marks a where value filled in when a saved query runs:
+// {"age": {"gte": {"$param": "min_age"}}}.
+const paramKey = "$param"
+
+// SaveQuery creates or replaces a saved query. The select is compiled with
+// its parameters' defaults, or nulls where there are none, so mistakes are
+// reported now rather than when it runs. Only the service key may save, since
+// a saved query is shared by every caller of the database.
+func (dao *TenantConnection) SaveQuery(ctx context.Context, query SavedQuery) (SavedQuery, error) {
+	if err := dao.requireUnscopedService("saving queries"); err != nil {
+		return SavedQuery{}, err
+	}
+	if dao.primaryStore == nil {
+		return SavedQuery{}, fmt.Errorf("primary store not initialized")
+	}
+	if _, message, _ := tools.ValidateResourceName(query.Name); message != "" {
+		return SavedQuery{}, tools.InvalidRequestErr("saved query " + message + "; use lowercase letters, numbers and dashes")
+	}
+	if query.Query.Cursor != nil {
+		return SavedQuery{}, tools.InvalidRequestErr("saved queries can't hold a cursor; page with limit and offset when running them")
+	}
+
+	names, err := queryParams(query.Query.Where)
+	if err != nil {
+		return SavedQuery{}, err
+	}
+	for name := range query.Params {
+		if !names[name] {
+			return SavedQuery{}, tools.InvalidRequestErr(fmt.Sprintf("param %q has a default but is not used in where", name))
+		}
+	}
+	check := query.Query
+	check.Where = bindParams(query.Query.Where, query.Params, nil)
+	if _, err := dao.prepareSelect(ctx, dao.Client, query.Table, check, false); err != nil {
+		return SavedQuery{}, err
+	}
+
+	queryJSON, err := json.Marshal(query.Query)
+	if err != nil {
+		return SavedQuery{}, err
+	}
+	params := query.Params
+	if params == nil {
+		params = map[string]any{}
+	}
+	paramsJSON, err := json.Marshal(params)
+	if err != nil {
+		return SavedQuery{}, err
+	}
+	if err := dao.primaryStore.PutSavedQuery(ctx, dao.ID, primarystore.SavedQuery{
+		Name:   query.Name,
+		Table:  query.Table,
+		Query:  queryJSON,
+		Params: paramsJSON,
+	}); err != nil {
+		return SavedQuery{}, err
+	}
+	return dao.GetSavedQuery(ctx, query.Name)
+}
+
+// requireUnscopedService rejects callers other than the service key or an API
+// key with its full access. What such a caller sets up runs later for other
+// callers, so a key limited to some tables or verbs can't be checked against it.
+func (dao *TenantConnection) requireUnscopedService(action string) error {
+	if !dao.Principal.IsService {
+		return tools.UnauthorizedErr(action + " needs the service key")
+	}
+	if scope := dao.Principal.KeyScope; scope != nil && !scope.FullAccess() {
+		return fmt.Errorf("%w: %s needs a key without table, database or verb limits", tools.ErrAPIKeyScope, action)
+	}
+	return nil
+}
+
+// GetSavedQuery returns a saved query by name.
+func (dao *TenantConnection) GetSavedQuery(ctx context.Context, name string) (SavedQuery, error) {
+	if dao.primaryStore == nil {
+		return SavedQuery{}, fmt.Errorf("primary store not initialized")
+	}
+	stored, err := dao.primaryStore.GetSavedQuery(ctx, dao.ID, name)
+	if err != nil {
+		return SavedQuery{}, err
+	}
+	return decodeSavedQuery(stored)
+}
+
+// ListSavedQueries returns the database's saved queries by name.
+func (dao *TenantConnection) ListSavedQueries(ctx context.Context) ([]SavedQuery, error) {
+	if dao.primaryStore == nil {
+		return nil, fmt.Errorf("primary store not initialized")
+	}
+	stored, err := dao.primaryStore.ListSavedQueries(ctx, dao.ID)
+	if err != nil {
+		return nil, err
+	}
+	queries := make([]SavedQuery, 0, len(stored))
+	for _, s := range stored {
+		query, err := decodeSavedQuery(s)
+		if err != nil {
+			return nil, err
+		}
+		queries = append(queries, query)
+	}
+	return queries, nil
+}
+
+// DeleteSavedQuery removes a saved query. Like saving, it needs the service key.
+func (dao *TenantConnection) DeleteSavedQuery(ctx context.Context, name string) error {
+	if err := dao.requireUnscopedService("deleting saved queries"); err != nil {
+		return err
+	}
+	if dao.primaryStore == nil {
+		return fmt.Errorf("primary store not initialized")
+	}
+	return dao.primaryStore.DeleteSavedQuery(ctx, dao.ID, name)
+}
+
+// RunSavedQuery runs a saved query as the caller, so the caller's policies
+// apply as they would to the same select sent directly.
+func (dao *TenantConnection) RunSavedQuery(ctx context.Context, name string, req RunSavedQueryRequest) (SelectResult, error) {
+	saved, err := dao.GetSavedQuery(ctx, name)
+	if err != nil {
+		return SelectResult{}, err
+	}
+	names, err := queryParams(saved.Query.Where)
+	if err != nil {
+		return SelectResult{}, err
+	}
+	for param := range req.Params {
+		if !names[param] {
+			return SelectResult{}, tools.InvalidRequestErr(fmt.Sprintf("saved query %s has no param %q", name, param))
+		}
+	}
+
+	var missing []string
+	for param := range names {
+		if _, ok := req.Params[param]; ok {
+			continue
+		}
+		if _, ok := saved.Params[param]; !ok {
+			missing = append(missing, param)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return SelectResult{}, tools.InvalidRequestErr(fmt.Sprintf("saved query %s needs params: %s", name, strings.Join(missing, ", ")))
+	}
+
+	query := saved.Query
+	query.Where = bindParams(saved.Query.Where, saved.Params, req.Params)
+	if req.Order != nil {
+		query.Order = req.Order
+	}
+	if req.Limit != nil {
+		query.Limit = req.Limit
+	}
+	if req.Offset != nil {
+		query.Offset = req.Offset
+	}
+	return dao.SelectJSON(ctx, saved.Table, query, false)
+}
+
+func decodeSavedQuery(stored primarystore.SavedQuery) (SavedQuery, error) {
+	query := SavedQuery{Name: stored.Name, Table: stored.Table, CreatedAt: stored.CreatedAt, UpdatedAt: stored.UpdatedAt}
+	if err := decodeJSONPayload(stored.Query, &query.Query); err != nil {
+		return SavedQuery{}, fmt.Errorf("failed to decode saved query %s: %w", stored.Name, err)
+	}
+	if err := decodeJSONPayload(stored.Params, &query.Params); err != nil {
+		return SavedQuery{}, fmt.Errorf("failed to decode saved query %s params: %w", stored.Name, err)
+	}
+	if len(query.Params) == 0 {
+		query.Params = nil
+	}
+	return query, nil
+}
+
+// queryParams returns the names of the params a where uses.
+func queryParams(where []map[string]any) (map[string]bool, error) {
+	names := map[string]bool{}
+	var walk func(value any) error
+	walk = func(value any) error {
+		switch v := value.(type) {
+		case map[string]any:
+			if raw, ok := v[paramKey]; ok {
+				name, isString := raw.(string)
+				if !isString || name == "" || len(v) != 1 {
+					return tools.InvalidRequestErr(`a param is written {"$param": "name"}`)
+				}
+				names[name] = true
+				return nil
+			}
+			for _, item := range v {
+				if err := walk(item); err != nil {
+					return err
+				}
+			}
+		case []any:
+			for _, item := range v {
+				if err := walk(item); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	for _, clause := range where {
+		if err := walk(map[string]any(clause)); err != nil {
+			return nil, err
+		}
+	}
+	return names, nil
+}
+
+// bindParams returns a copy of where with each param replaced by its value
+// in values, else its default, else null.
+func bindParams(where []map[string]any, defaults, values map[string]any) []map[string]any {
+	var bind func(value any) any
+	bind = func(value any) any {
+		switch v := value.(type) {
+		case map[string]any:
+			if name, ok := v[paramKey].(string); ok {
+				if value, ok := values[name]; ok {
+					return value
+				}
+				return defaults[name]
+			}
+			out := make(map[string]any, len(v))
+			for key, item := range v {
+				out[key] = bind(item)
+			}
+			return out
+		case []any:
+			out := make([]any, len(v))
+			for i, item := range v {
+				out[i] = bind(item)
+			}
+			return out
+		}
+		return value
+	}
+	bound := make([]map[string]any, len(where))
+	for i, clause := range where {
+		bound[i] = bind(map[string]any(clause)).(map[string]any)
+	}
+	return bound
+}
@@ -0,0 +1,134 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/atombasedev/atombase/definitions"
+	"github.com/atombasedev/atombase/primarystore"
+	"github.com/atombasedev/atombase/tools"
+)
+
+func TestSavedQueries(t *testing.T) {
+	primaryDB, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer primaryDB.Close()
+	primaryDB.SetMaxOpenConns(1)
+	if _, err := primaryDB.Exec(`CREATE TABLE atombase_saved_queries (
+		database_id TEXT NOT NULL,
+		name TEXT NOT NULL,
+		table_name TEXT NOT NULL,
+		query_json TEXT NOT NULL,
+		params_json TEXT NOT NULL DEFAULT '{}',
+		created_at TEXT NOT NULL,
+		updated_at TEXT NOT NULL,
+		PRIMARY KEY (database_id, name)
+	)`); err != nil {
+		t.Fatal(err)
+	}
+	store, err := primarystore.New(primaryDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := setupTestDB(t, schemaUsers)
+	defer db.Close()
+	if _, err := db.Exec(`INSERT INTO users (name, age) VALUES ('Alice', 30), ('Bob', 17), ('Carol', 45)`); err != nil {
+		t.Fatal(err)
+	}
+	service := &TenantConnection{Client: db, Schema: loadSchema(t, db), ID: "db", primaryStore: store, Principal: definitions.Principal{IsService: true}}
+	user := &TenantConnection{Client: db, Schema: service.Schema, ID: "db", primaryStore: store, Principal: definitions.Principal{UserID: "u1"}}
+	ctx := context.Background()
+
+	adults := SavedQuery{
+		Name:  "adults",
+		Table: "users",
+		Query: SelectQuery{
+			Select: []any{"name"},
+			Where:  []map[string]any{{"age": map[string]any{OpGte: map[string]any{paramKey: "min_age"}}}},
+			Order:  map[string]string{"name": OrderAsc},
+		},
+		Params: map[string]any{"min_age": 18},
+	}
+	if _, err := user.SaveQuery(ctx, adults); !errors.Is(err, tools.ErrUnauthorized) {
+		t.Errorf("a user saved a query: %v", err)
+	}
+	scoped := &TenantConnection{Client: db, Schema: service.Schema, ID: "db", primaryStore: store,
+		Principal: definitions.Principal{IsService: true, KeyScope: &tools.APIKeyScope{KeyID: "k1", Tables: []string{"users"}, Verbs: []string{tools.VerbAdmin}}}}
+	if _, err := scoped.SaveQuery(ctx, adults); !errors.Is(err, tools.ErrAPIKeyScope) {
+		t.Errorf("a scoped key saved a query: %v", err)
+	}
+	saved, err := service.SaveQuery(ctx, adults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.CreatedAt == "" || saved.Params["min_age"] != float64(18) {
+		t.Errorf("got %+v", saved)
+	}
+
+	names := func(req RunSavedQueryRequest) string {
+		t.Helper()
+		result, err := user.RunSavedQuery(ctx, "adults", req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var rows []map[string]any
+		if err := json.Unmarshal(result.Data, &rows); err != nil {
+			t.Fatal(err)
+		}
+		out := ""
+		for _, row := range rows {
+			out += row["name"].(string) + " "
+		}
+		return out
+	}
+	if got := names(RunSavedQueryRequest{}); got != "Alice Carol " {
+		t.Errorf("defaults: got %q", got)
+	}
+	limit := 1
+	if got := names(RunSavedQueryRequest{Params: map[string]any{"min_age": 0}, Order: map[string]string{"age": OrderDesc}, Limit: &limit}); got != "Carol " {
+		t.Errorf("overrides: got %q", got)
+	}
+	if _, err := user.RunSavedQuery(ctx, "adults", RunSavedQueryRequest{Params: map[string]any{"max_age": 1}}); err == nil {
+		t.Error("expected an error for an unknown param")
+	}
+
+	adults.Params = nil
+	if _, err := service.SaveQuery(ctx, adults); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := user.RunSavedQuery(ctx, "adults", RunSavedQueryRequest{}); err == nil {
+		t.Error("expected an error for a param without a value")
+	}
+
+	for name, query := range map[string]SavedQuery{
+		"bad name":      {Name: "Adults!", Table: "users"},
+		"unused param":  {Name: "x", Table: "users", Params: map[string]any{"min_age": 1}},
+		"unknown table": {Name: "x", Table: "missing"},
+		"unknown column": {Name: "x", Table: "users", Query: SelectQuery{
+			Where: []map[string]any{{"height": map[string]any{OpEq: map[string]any{paramKey: "h"}}}},
+		}},
+	} {
+		if _, err := service.SaveQuery(ctx, query); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	list, err := user.ListSavedQueries(ctx)
+	if err != nil || len(list) != 1 || list[0].Name != "adults" {
+		t.Errorf("got %+v, %v", list, err)
+	}
+	if err := scoped.DeleteSavedQuery(ctx, "adults"); !errors.Is(err, tools.ErrAPIKeyScope) {
+		t.Errorf("a scoped key deleted a saved query: %v", err)
+	}
+	if err := service.DeleteSavedQuery(ctx, "adults"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := user.RunSavedQuery(ctx, "adults", RunSavedQueryRequest{}); !errors.Is(err, tools.ErrSavedQueryNotFound) {
+		t.Errorf("got %v after delete", err)
+	}
+}
@@ -10,8 +10,16 @@ import (
 func schemaFks(db *sql.DB) (map[string][]CacheFk, error) {
 	fks := make(map[string][]CacheFk)
 
+	// A foreign key is unique when its column is the whole primary key or has
+	// a unique index of its own. An INTEGER PRIMARY KEY has no index.
 	rows, err := db.Query(`
-		SELECT m.name as "table", p."table" as "references", p."from", p."to"
+		SELECT m.name as "table", p."table" as "references", p."from", p."to",
+			EXISTS (
+				SELECT 1 FROM pragma_index_list(m.name) i
+				WHERE i."unique" AND (SELECT group_concat(name) FROM pragma_index_info(i.name)) = p."from"
+			) OR (
+				SELECT group_concat(name) FROM pragma_table_info(m.name) WHERE pk > 0
+			) = p."from" as "unique"
 		FROM sqlite_master m
 		JOIN pragma_foreign_key_list(m.name) p ON m.name != p."table"
 		WHERE m.type = 'table';
@@ -23,13 +31,14 @@ func schemaFks(db *sql.DB) (map[string][]CacheFk, error) {
 
 	for rows.Next() {
 		var from, to, references, table sql.NullString
+		var unique bool
 
-		err := rows.Scan(&table, &references, &from, &to)
+		err := rows.Scan(&table, &references, &from, &to, &unique)
 		if err != nil {
 			return nil, err
 		}
 
-		fk := CacheFk{table.String, references.String, from.String, to.String}
+		fk := CacheFk{table.String, references.String, from.String, to.String, unique}
 		fks[table.String] = append(fks[table.String], fk)
 	}
 
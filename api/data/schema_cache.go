@@ -1,6 +1,7 @@
 package data
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
@@ -60,24 +61,91 @@ func loadCurrentSchemaFromDB(db *sql.DB, definitionID int32) (SchemaCache, int,
 		return SchemaCache{}, 0, err
 	}
 
-	// Deserialize schema from JSON (format: {"tables": [...]})
-	var schema Schema
-	if err := tools.DecodeSchema(tablesData, &schema); err != nil {
+	cache, err := decodeSchemaCache(tablesData)
+	if err != nil {
 		return SchemaCache{}, 0, err
 	}
+	return cache, version, nil
+}
 
-	return TablesToSchemaCache(schema.Tables), version, nil
+// loadSchemaVersionFromDB loads one version of a definition's schema from its
+// history. It returns sql.ErrNoRows when the version was pruned.
+func loadSchemaVersionFromDB(ctx context.Context, db *sql.DB, definitionID int32, version int) (SchemaCache, error) {
+	var tablesData []byte
+	if err := db.QueryRowContext(ctx, `
+		SELECT schema_json FROM atombase_definitions_history WHERE definition_id = ? AND version = ?
+	`, definitionID, version).Scan(&tablesData); err != nil {
+		return SchemaCache{}, err
+	}
+	return decodeSchemaCache(tablesData)
+}
+
+// decodeSchemaCache deserializes a stored schema (format: {"tables": [...], "views": [...]}).
+// Views are indexed as tables without a primary key.
+func decodeSchemaCache(data []byte) (SchemaCache, error) {
+	var schema Schema
+	if err := tools.DecodeSchema(data, &schema); err != nil {
+		return SchemaCache{}, err
+	}
+	cache := TablesToSchemaCache(schema.Tables)
+	cache.Views = make(map[string]bool, len(schema.Views))
+	for _, view := range schema.Views {
+		cache.Tables[view.Name] = CacheTable{Name: view.Name, Columns: view.Columns}
+		cache.Views[view.Name] = true
+	}
+	cache.Rollups = make(map[string]string)
+	for _, t := range schema.Tables {
+		for _, rollup := range rollupCacheTables(t) {
+			cache.Tables[rollup.Name] = rollup
+			cache.Views[rollup.Name] = true
+			cache.Rollups[rollup.Name] = t.Name
+		}
+	}
+	cache.Settings = schema.Settings
+	return cache, nil
 }
 
 // TablesToSchemaCache converts a slice of Table definitions to a SchemaCache.
+// uniqueColumn reports whether no two rows of t can share a value of col: it
+// is declared unique, is the whole primary key, or has a unique index of its
+// own.
+func uniqueColumn(t Table, col Col) bool {
+	if col.Unique || (len(t.Pk) == 1 && t.Pk[0] == col.Name) {
+		return true
+	}
+	for _, idx := range t.Indexes {
+		if idx.Unique && len(idx.Columns) == 1 && idx.Columns[0] == col.Name {
+			return true
+		}
+	}
+	return false
+}
+
 func TablesToSchemaCache(tables []Table) SchemaCache {
 	cache := SchemaCache{
-		Tables:    make(map[string]CacheTable),
-		Fks:       make(map[string][]CacheFk),
-		FTSTables: make(map[string]bool),
+		Tables:     make(map[string]CacheTable),
+		Fks:        make(map[string][]CacheFk),
+		FTSTables:  make(map[string]bool),
+		FTSColumns: make(map[string][]string),
+		GeoColumns: make(map[string][]string),
+		SyncTables: make(map[string]bool),
+		TimeSeries: make(map[string]TimeSeries),
 	}
 
 	for _, t := range tables {
+		if len(t.FTSColumns) > 0 {
+			cache.FTSTables[t.Name] = true
+			cache.FTSColumns[t.Name] = t.FTSColumns
+		}
+		if len(t.GeoColumns) == 2 {
+			cache.GeoColumns[t.Name] = t.GeoColumns
+		}
+		if t.Sync {
+			cache.SyncTables[t.Name] = true
+		}
+		if t.TimeSeries != nil {
+			cache.TimeSeries[t.Name] = *t.TimeSeries
+		}
 		tbl := CacheTable{
 			Name:    t.Name,
 			Pk:      t.Pk,
@@ -99,6 +167,7 @@ func TablesToSchemaCache(tables []Table) SchemaCache {
 							References: refTable,
 							From:       col.Name,
 							To:         refCol,
+							Unique:     uniqueColumn(t, col),
 						}
 						cache.Fks[t.Name] = append(cache.Fks[t.Name], fk)
 						break
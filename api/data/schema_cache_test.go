@@ -1,7 +1,9 @@
 package data
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"testing"
 
 	"github.com/atombasedev/atombase/tools"
@@ -106,6 +108,33 @@ func TestTablesToSchemaCache_MultipleForeignKeys(t *testing.T) {
 	}
 }
 
+// TestTablesToSchemaCache_UniqueForeignKeys verifies FKs on unique columns are marked unique.
+func TestTablesToSchemaCache_UniqueForeignKeys(t *testing.T) {
+	profiles := Table{
+		Name: "profiles",
+		Pk:   []string{"id"},
+		Columns: map[string]Col{
+			"id":      {Name: "id", Type: "INTEGER"},
+			"user_id": {Name: "user_id", Type: "INTEGER", References: "users.id", Unique: true},
+		},
+	}
+	settings := Table{
+		Name: "settings",
+		Pk:   []string{"user_id"},
+		Columns: map[string]Col{
+			"user_id": {Name: "user_id", Type: "INTEGER", References: "users.id"},
+		},
+	}
+
+	cache := TablesToSchemaCache([]Table{testTableUsers, testTablePosts, profiles, settings})
+
+	for table, want := range map[string]bool{"posts": false, "profiles": true, "settings": true} {
+		if got := cache.Fks[table][0].Unique; got != want {
+			t.Errorf("%s: expected unique %v, got %v", table, want, got)
+		}
+	}
+}
+
 // TestTablesToSchemaCache_NoForeignKeys verifies tables without FKs work correctly.
 func TestTablesToSchemaCache_NoForeignKeys(t *testing.T) {
 	tables := []Table{testTableUsers}
@@ -235,3 +264,47 @@ func TestSchemaCache_VersionUpdate(t *testing.T) {
 	// Clean up
 	tools.InvalidateDefinition(997)
 }
+
+// TestDecodeSchemaCache_ServesViewsReadOnly verifies views are indexed with
+// their resolved columns and only accept selects.
+func TestDecodeSchemaCache_ServesViewsReadOnly(t *testing.T) {
+	schema, err := decodeSchemaCache([]byte(`{
+		"tables": [{"name": "users", "pk": ["id"], "columns": {
+			"id": {"name": "id", "type": "INTEGER"},
+			"name": {"name": "name", "type": "TEXT"},
+			"age": {"name": "age", "type": "INTEGER"}
+		}}],
+		"views": [{"name": "adults", "select": "SELECT id, name FROM users WHERE age >= 18", "columns": {"id": "INTEGER", "name": "TEXT"}}]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !schema.Views["adults"] || schema.Views["users"] {
+		t.Fatalf("views: %v", schema.Views)
+	}
+	if view, err := schema.SearchTbls("adults"); err != nil || view.Columns["name"] != "TEXT" || len(view.Pk) != 0 {
+		t.Fatalf("adults: %+v, %v", view, err)
+	}
+
+	db := setupTestDB(t, schemaUsers+`CREATE VIEW adults AS SELECT id, name FROM users WHERE age >= 18;`)
+	defer db.Close()
+	if _, err := db.Exec(`INSERT INTO users (name, age) VALUES ('Alice', 30), ('Bob', 17)`); err != nil {
+		t.Fatal(err)
+	}
+	dao := &TenantConnection{Client: db, Schema: schema}
+	ctx := context.Background()
+
+	result, err := dao.SelectJSON(ctx, "adults", SelectQuery{Select: []any{"name"}}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(result.Data) != `[{"name":"Alice"}]` {
+		t.Errorf("select: %s", result.Data)
+	}
+	if _, err := dao.InsertJSON(ctx, "adults", InsertRequest{Data: RowData{{"name": "Carol"}}}); !errors.Is(err, tools.ErrReadOnlyView) {
+		t.Errorf("insert: expected a read-only view error, got %v", err)
+	}
+	if _, err := dao.DeleteJSON(ctx, "adults", DeleteRequest{Where: []map[string]any{{"id": map[string]any{OpEq: 1}}}}); !errors.Is(err, tools.ErrReadOnlyView) {
+		t.Errorf("delete: expected a read-only view error, got %v", err)
+	}
+}
@@ -0,0 +1,248 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/atombasedev/atombase/tools"
+)
+
+// Markup of full-text search output. Matches are wrapped in <mark> tags and
+// snippets are cut to about snippetTokens tokens.
+const (
+	searchMarkOpen  = "<mark>"
+	searchMarkClose = "</mark>"
+	searchEllipsis  = "…"
+	snippetTokens   = 16
+)
+
+// parseSearchParams reads ?fts=terms and its fts.rank, fts.snippet and
+// fts.highlight options, returning nil when there is no ?fts.
+func parseSearchParams(params url.Values) (*TextSearch, error) {
+	query := params.Get(ParamFTS)
+	if query == "" {
+		for _, name := range []string{ParamFTSRank, ParamFTSSnippet, ParamFTSHighlight} {
+			if params.Has(name) {
+				return nil, tools.InvalidRequestErr(fmt.Sprintf("%s needs a search in ?%s=", name, ParamFTS))
+			}
+		}
+		return nil, nil
+	}
+	search := &TextSearch{Query: query, Rank: strings.TrimSpace(params.Get(ParamFTSRank))}
+	var err error
+	if search.Snippet, err = parseSearchFields(ParamFTSSnippet, params.Get(ParamFTSSnippet)); err != nil {
+		return nil, err
+	}
+	if search.Highlight, err = parseSearchFields(ParamFTSHighlight, params.Get(ParamFTSHighlight)); err != nil {
+		return nil, err
+	}
+	return search, nil
+}
+
+// parseSearchFields parses name:column,... into field-column pairs.
+func parseSearchFields(param, value string) (map[string]string, error) {
+	if value == "" {
+		return nil, nil
+	}
+	items, err := splitFilterList(value)
+	if err != nil {
+		return nil, tools.InvalidRequestErr(param + ": " + err.Error())
+	}
+	fields := make(map[string]string, len(items))
+	for _, item := range items {
+		name, column, ok := strings.Cut(item, ":")
+		if !ok || strings.TrimSpace(name) == "" || strings.TrimSpace(column) == "" {
+			return nil, tools.InvalidRequestErr(fmt.Sprintf("%s field %q must be name:column", param, item))
+		}
+		fields[strings.TrimSpace(name)] = strings.TrimSpace(column)
+	}
+	return fields, nil
+}
+
+// Fields a search across tables reads from each table's rows.
+const (
+	searchRankField    = "__rank"
+	searchSnippetField = "__snippet"
+	defaultSearchLimit = 20
+)
+
+// SearchTables runs a full-text search on each of tables, or on every table
+// with an FTS index when none are named, and merges the matches by rank.
+// Each table is searched through the select path, so its policies apply;
+// tables the caller may not select are left out. bm25 scores depend on each
+// table's term statistics, so ranks across tables are comparable only
+// roughly.
+func (dao *TenantConnection) SearchTables(ctx context.Context, query string, tables []string, limit int) (SearchResponse, error) {
+	if strings.TrimSpace(query) == "" {
+		return SearchResponse{}, tools.InvalidRequestErr("search needs a query in ?q=")
+	}
+	if len(tables) == 0 {
+		for table := range dao.Schema.FTSTables {
+			tables = append(tables, table)
+		}
+		sort.Strings(tables)
+	}
+	for _, table := range tables {
+		if !dao.Schema.HasFTSIndex(table) {
+			return SearchResponse{}, fmt.Errorf("%w: %s", tools.ErrNoFTSIndex, table)
+		}
+	}
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+	limit = dao.Schema.selectLimit(&limit)
+
+	resp := SearchResponse{Results: []SearchResult{}, Tables: []string{}}
+	for _, table := range tables {
+		if _, err := dao.compilePolicy(ctx, table, "select", nil); err != nil {
+			continue
+		}
+		result, err := dao.SelectJSON(ctx, table, SelectQuery{
+			Limit: &limit,
+			Search: &TextSearch{
+				Query:   query,
+				Rank:    searchRankField,
+				Snippet: map[string]string{searchSnippetField: "*"},
+			},
+		}, false)
+		if err != nil {
+			return SearchResponse{}, fmt.Errorf("searching %s: %w", table, err)
+		}
+		var rows []map[string]any
+		if err := decodeJSONPayload(result.Data, &rows); err != nil {
+			return SearchResponse{}, err
+		}
+		for _, row := range rows {
+			rank, _ := row[searchRankField].(float64)
+			snippet, _ := row[searchSnippetField].(string)
+			delete(row, searchRankField)
+			delete(row, searchSnippetField)
+			resp.Results = append(resp.Results, SearchResult{Table: table, Rank: rank, Snippet: snippet, Row: row})
+		}
+		resp.Tables = append(resp.Tables, table)
+	}
+
+	sort.SliceStable(resp.Results, func(i, j int) bool { return resp.Results[i].Rank < resp.Results[j].Rank })
+	if len(resp.Results) > limit {
+		resp.Results = resp.Results[:limit]
+	}
+	return resp, nil
+}
+
+// searchAlias names the derived table of search matches joined to the root
+// table, and searchRank the bm25 score it always carries for ordering.
+const (
+	searchAlias = "__ab_search"
+	searchRank  = "__ab_rank"
+)
+
+// compileSearch checks a search against the table's FTS5 index and returns
+// the join to its matches and the rank, snippet and highlight fields it adds
+// to each root row. FTS5 only evaluates its auxiliary functions in a plain
+// query of the index, so they run in the derived table rather than in the
+// select, which may be grouped for nested relations. Its LIMIT -1 keeps
+// SQLite from flattening it back into the select.
+func (schema SchemaCache) compileSearch(table CacheTable, search *TextSearch) (string, []computedColumn, error) {
+	if !schema.HasFTSIndex(table.Name) {
+		return "", nil, fmt.Errorf("%w: %s", tools.ErrNoFTSIndex, table.Name)
+	}
+	if strings.TrimSpace(search.Query) == "" {
+		return "", nil, tools.InvalidRequestErr("search query is empty")
+	}
+	fts := table.Name + FTSSuffix
+
+	outputs := []string{fmt.Sprintf("bm25([%s]) AS [%s]", fts, searchRank)}
+	var fields []computedColumn
+	if search.Rank != "" {
+		fields = append(fields, computedColumn{name: search.Rank, sql: fmt.Sprintf("[%s].[%s]", searchAlias, searchRank)})
+	}
+	add := func(name, sql string) {
+		outputs = append(outputs, fmt.Sprintf("%s AS [%s]", sql, name))
+		fields = append(fields, computedColumn{name: name, sql: fmt.Sprintf("[%s].[%s]", searchAlias, name)})
+	}
+
+	seen := map[string]bool{}
+	check := func(name string) error {
+		if err := tools.ValidateIdentifier(name); err != nil {
+			return tools.InvalidRequestErr(fmt.Sprintf("search field %q: %v", name, err))
+		}
+		if _, ok := table.Columns[name]; ok || strings.HasPrefix(name, "__ab_") {
+			return tools.InvalidRequestErr(fmt.Sprintf("search field %q conflicts with a column", name))
+		}
+		if seen[name] {
+			return tools.InvalidRequestErr(fmt.Sprintf("search field %q is named twice", name))
+		}
+		seen[name] = true
+		return nil
+	}
+	if search.Rank != "" {
+		if err := check(search.Rank); err != nil {
+			return "", nil, err
+		}
+	}
+	for _, name := range sortedKeys(search.Snippet) {
+		if err := check(name); err != nil {
+			return "", nil, err
+		}
+		index, err := schema.ftsColumnIndex(table.Name, search.Snippet[name], true)
+		if err != nil {
+			return "", nil, err
+		}
+		add(name, fmt.Sprintf("snippet([%s], %d, '%s', '%s', '%s', %d)",
+			fts, index, searchMarkOpen, searchMarkClose, searchEllipsis, snippetTokens))
+	}
+	for _, name := range sortedKeys(search.Highlight) {
+		if err := check(name); err != nil {
+			return "", nil, err
+		}
+		index, err := schema.ftsColumnIndex(table.Name, search.Highlight[name], false)
+		if err != nil {
+			return "", nil, err
+		}
+		add(name, fmt.Sprintf("highlight([%s], %d, '%s', '%s')", fts, index, searchMarkOpen, searchMarkClose))
+	}
+	if len(fields) > MaxComputedFields {
+		return "", nil, tools.InvalidRequestErr(fmt.Sprintf("at most %d search fields are allowed", MaxComputedFields))
+	}
+
+	// The index's rowid is the table's first primary key column.
+	key := "rowid"
+	if len(table.Pk) > 0 {
+		key = table.Pk[0]
+	}
+	join := fmt.Sprintf("JOIN (SELECT [rowid], %s FROM [%s] WHERE [%s] MATCH ? LIMIT -1) AS [%s] ON [%s].[rowid] = [%s].[%s] ",
+		strings.Join(outputs, ", "), fts, fts, searchAlias, searchAlias, table.Name, key)
+	return join, fields, nil
+}
+
+// ftsColumnIndex returns the position of a column in a table's FTS5 index,
+// which snippet() and highlight() take. snippet() accepts "*" to excerpt
+// whichever column matches best.
+func (schema SchemaCache) ftsColumnIndex(table, column string, anyColumn bool) (int, error) {
+	if column == "*" && anyColumn {
+		return -1, nil
+	}
+	for i, col := range schema.FTSColumns[table] {
+		if col == column {
+			return i, nil
+		}
+	}
+	return 0, tools.InvalidRequestErr(fmt.Sprintf("column %q is not in the full-text index of %s", column, table))
+}
+
+// searchOrder orders matches best first.
+func searchOrder() string {
+	return fmt.Sprintf("ORDER BY [%s].[%s] ", searchAlias, searchRank)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,221 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestParseSearchParams(t *testing.T) {
+	search, err := parseSearchParams(url.Values{
+		ParamFTS:          {"sqlite OR go*"},
+		ParamFTSRank:      {"score"},
+		ParamFTSSnippet:   {"excerpt:body"},
+		ParamFTSHighlight: {"marked:title, marked_body:body"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if search.Query != "sqlite OR go*" || search.Rank != "score" || search.Snippet["excerpt"] != "body" ||
+		search.Highlight["marked"] != "title" || search.Highlight["marked_body"] != "body" {
+		t.Errorf("got %+v", search)
+	}
+
+	if search, err := parseSearchParams(url.Values{}); search != nil || err != nil {
+		t.Errorf("got %+v, %v without ?fts", search, err)
+	}
+	if _, err := parseSearchParams(url.Values{ParamFTSRank: {"score"}}); err == nil {
+		t.Error("expected an error for fts.rank without ?fts")
+	}
+	if _, err := parseSearchParams(url.Values{ParamFTS: {"x"}, ParamFTSSnippet: {"body"}}); err == nil {
+		t.Error("expected an error for a snippet without a name")
+	}
+}
+
+func TestCompileSearch(t *testing.T) {
+	schema := TablesToSchemaCache([]Table{{
+		Name:       "posts",
+		Pk:         []string{"id"},
+		Columns:    map[string]Col{"id": {Name: "id", Type: "INTEGER"}, "title": {Name: "title", Type: "TEXT"}, "body": {Name: "body", Type: "TEXT"}},
+		FTSColumns: []string{"title", "body"},
+	}})
+	table := schema.Tables["posts"]
+
+	join, fields, err := schema.compileSearch(table, &TextSearch{
+		Query:     "sqlite",
+		Rank:      "score",
+		Snippet:   map[string]string{"excerpt": "*"},
+		Highlight: map[string]string{"marked": "body"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make([]string, len(fields))
+	for i, field := range fields {
+		got[i] = field.name + "=" + field.sql
+	}
+	want := []string{
+		"score=[__ab_search].[__ab_rank]",
+		"excerpt=[__ab_search].[excerpt]",
+		"marked=[__ab_search].[marked]",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	wantJoin := "JOIN (SELECT [rowid], bm25([posts_fts]) AS [__ab_rank], " +
+		"snippet([posts_fts], -1, '<mark>', '</mark>', '…', 16) AS [excerpt], " +
+		"highlight([posts_fts], 1, '<mark>', '</mark>') AS [marked] " +
+		"FROM [posts_fts] WHERE [posts_fts] MATCH ? LIMIT -1) AS [__ab_search] ON [__ab_search].[rowid] = [posts].[id] "
+	if join != wantJoin {
+		t.Errorf("got join\n%s\nwant\n%s", join, wantJoin)
+	}
+
+	for name, search := range map[string]*TextSearch{
+		"empty query":        {Query: "  "},
+		"column name":        {Query: "x", Rank: "title"},
+		"unindexed column":   {Query: "x", Highlight: map[string]string{"marked": "id"}},
+		"highlight any":      {Query: "x", Highlight: map[string]string{"marked": "*"}},
+		"field named twice":  {Query: "x", Rank: "hit", Snippet: map[string]string{"hit": "body"}},
+		"invalid field name": {Query: "x", Rank: "bad name"},
+	} {
+		if _, _, err := schema.compileSearch(table, search); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if _, _, err := (SchemaCache{}).compileSearch(table, &TextSearch{Query: "x"}); err == nil {
+		t.Error("expected an error for a table without an FTS index")
+	}
+}
+
+func TestSelectJSON_Search(t *testing.T) {
+	db := setupTestDB(t, `
+		CREATE TABLE posts (id INTEGER PRIMARY KEY, title TEXT, body TEXT);
+		CREATE TABLE comments (id INTEGER PRIMARY KEY, post_id INTEGER REFERENCES posts(id), text TEXT);`)
+	if _, err := db.Exec(`CREATE VIRTUAL TABLE posts_fts USING fts5(title, body, content=posts, content_rowid=id)`); err != nil {
+		t.Skipf("sqlite built without fts5 (use -tags fts5): %v", err)
+	}
+	if _, err := db.Exec(`
+		INSERT INTO posts (id, title, body) VALUES
+			(1, 'Cooking', 'A recipe for bread'),
+			(2, 'SQLite tips', 'Indexes make sqlite fast and sqlite is small'),
+			(3, 'Databases', 'Postgres and sqlite compared');
+		INSERT INTO posts_fts (rowid, title, body) SELECT id, title, body FROM posts;
+		INSERT INTO comments (post_id, text) VALUES (2, 'nice'), (3, 'ok');`); err != nil {
+		t.Fatal(err)
+	}
+	schema := TablesToSchemaCache([]Table{
+		{
+			Name:       "posts",
+			Pk:         []string{"id"},
+			Columns:    map[string]Col{"id": {Name: "id", Type: "INTEGER"}, "title": {Name: "title", Type: "TEXT"}, "body": {Name: "body", Type: "TEXT"}},
+			FTSColumns: []string{"title", "body"},
+		},
+		{
+			Name:    "comments",
+			Pk:      []string{"id"},
+			Columns: map[string]Col{"id": {Name: "id", Type: "INTEGER"}, "post_id": {Name: "post_id", Type: "INTEGER", References: "posts.id"}, "text": {Name: "text", Type: "TEXT"}},
+		},
+	})
+	dao := &TenantConnection{Client: db, Schema: schema}
+	ctx := context.Background()
+
+	result, err := dao.SelectJSON(ctx, "posts", SelectQuery{
+		Select: []any{"id", map[string]any{"comments": []any{"text"}}},
+		Search: &TextSearch{
+			Query:     "sqlite",
+			Rank:      "score",
+			Snippet:   map[string]string{"excerpt": "body"},
+			Highlight: map[string]string{"marked": "title"},
+		},
+	}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rows []map[string]any
+	if err := json.Unmarshal(result.Data, &rows); err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || result.Count != 2 {
+		t.Fatalf("got %d rows, count %d: %v", len(rows), result.Count, rows)
+	}
+	// The post mentioning sqlite three times ranks first.
+	if rows[0]["id"] != float64(2) || rows[1]["id"] != float64(3) {
+		t.Errorf("rows are not ordered by rank: %v", rows)
+	}
+	if rows[0]["score"].(float64) >= rows[1]["score"].(float64) {
+		t.Errorf("scores %v and %v are not best first", rows[0]["score"], rows[1]["score"])
+	}
+	if rows[0]["marked"] != "<mark>SQLite</mark> tips" || !strings.Contains(rows[0]["excerpt"].(string), "<mark>sqlite</mark>") {
+		t.Errorf("got marked %q, excerpt %q", rows[0]["marked"], rows[0]["excerpt"])
+	}
+	if comments, _ := rows[0]["comments"].([]any); len(comments) != 1 {
+		t.Errorf("got comments %v", rows[0]["comments"])
+	}
+
+	// An explicit order wins over the rank.
+	result, err = dao.SelectJSON(ctx, "posts", SelectQuery{
+		Select: []any{"id"},
+		Order:  map[string]string{"id": OrderAsc},
+		Search: &TextSearch{Query: "sqlite"},
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(result.Data) != `[{"id":2},{"id":3}]` {
+		t.Errorf("got %s", result.Data)
+	}
+}
+
+func TestSearchTables(t *testing.T) {
+	db := setupTestDB(t, `
+		CREATE TABLE posts (id INTEGER PRIMARY KEY, title TEXT);
+		CREATE TABLE notes (id INTEGER PRIMARY KEY, body TEXT);
+		CREATE TABLE tags (id INTEGER PRIMARY KEY, name TEXT);`)
+	schema := TablesToSchemaCache([]Table{
+		{Name: "posts", Pk: []string{"id"}, Columns: map[string]Col{"id": {Name: "id", Type: "INTEGER"}, "title": {Name: "title", Type: "TEXT"}}, FTSColumns: []string{"title"}},
+		{Name: "notes", Pk: []string{"id"}, Columns: map[string]Col{"id": {Name: "id", Type: "INTEGER"}, "body": {Name: "body", Type: "TEXT"}}, FTSColumns: []string{"body"}},
+		{Name: "tags", Pk: []string{"id"}, Columns: map[string]Col{"id": {Name: "id", Type: "INTEGER"}, "name": {Name: "name", Type: "TEXT"}}},
+	})
+	dao := &TenantConnection{Client: db, Schema: schema}
+	ctx := context.Background()
+
+	if _, err := dao.SearchTables(ctx, " ", nil, 0); err == nil {
+		t.Error("expected an error for an empty query")
+	}
+	if _, err := dao.SearchTables(ctx, "sqlite", []string{"tags"}, 0); err == nil {
+		t.Error("expected an error for a table without an FTS index")
+	}
+
+	if _, err := db.Exec(`CREATE VIRTUAL TABLE posts_fts USING fts5(title, content=posts, content_rowid=id)`); err != nil {
+		t.Skipf("sqlite built without fts5 (use -tags fts5): %v", err)
+	}
+	if _, err := db.Exec(`
+		CREATE VIRTUAL TABLE notes_fts USING fts5(body, content=notes, content_rowid=id);
+		INSERT INTO posts (id, title) VALUES (1, 'sqlite sqlite sqlite'), (2, 'cooking');
+		INSERT INTO notes (id, body) VALUES (1, 'a long note that mentions sqlite once among many other words');
+		INSERT INTO posts_fts (rowid, title) SELECT id, title FROM posts;
+		INSERT INTO notes_fts (rowid, body) SELECT id, body FROM notes;`); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := dao.SearchTables(ctx, "sqlite", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Tables) != 2 || len(resp.Results) != 2 {
+		t.Fatalf("got %+v", resp)
+	}
+	first, second := resp.Results[0], resp.Results[1]
+	if first.Table != "posts" || second.Table != "notes" || first.Rank >= second.Rank {
+		t.Errorf("results are not merged best first: %+v", resp.Results)
+	}
+	if first.Row["title"] != "sqlite sqlite sqlite" || first.Row[searchRankField] != nil || !strings.Contains(second.Snippet, "<mark>sqlite</mark>") {
+		t.Errorf("got %+v", resp.Results)
+	}
+
+	if resp, err := dao.SearchTables(ctx, "sqlite", nil, 1); err != nil || len(resp.Results) != 1 || resp.Results[0].Table != "posts" {
+		t.Errorf("got %+v, %v with a limit of 1", resp, err)
+	}
+}
@@ -0,0 +1,118 @@
+package data
+
+import (
+	"fmt"
+
+	"github.com/atombasedev/atombase/config"
+	"github.com/atombasedev/atombase/tools"
+)
+
+// selectLimit resolves the row limit of a select. The definition's settings
+// replace the server default and can lower, but not raise, the server maximum.
+func (schema SchemaCache) selectLimit(requested *int) int {
+	limit := config.Cfg.DefaultLimit
+	maxLimit := config.Cfg.MaxQueryLimit
+	if s := schema.Settings; s != nil {
+		if s.DefaultLimit != nil {
+			limit = *s.DefaultLimit
+		}
+		if s.MaxLimit != nil && (maxLimit == 0 || *s.MaxLimit < maxLimit) {
+			maxLimit = *s.MaxLimit
+		}
+	}
+	if requested != nil && *requested >= 0 {
+		limit = *requested
+	}
+	if maxLimit > 0 && (limit > maxLimit || limit == 0) {
+		limit = maxLimit
+	}
+	return limit
+}
+
+// checkAllowedOperators rejects filters using operators the definition's
+// settings do not allow. Without an allowlist every operator is accepted.
+func (schema SchemaCache) checkAllowedOperators(where []map[string]any) error {
+	if schema.Settings == nil || len(schema.Settings.AllowedOperators) == 0 {
+		return nil
+	}
+	allowed := make(map[string]bool, len(schema.Settings.AllowedOperators))
+	for _, op := range schema.Settings.AllowedOperators {
+		allowed[op] = true
+	}
+	for _, condition := range where {
+		if err := checkConditionOperators(condition, allowed); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkConditionOperators(condition map[string]any, allowed map[string]bool) error {
+	for key, value := range condition {
+		if key == OpOr || key == OpAnd {
+			if !allowed[key] {
+				return operatorNotAllowedErr(key)
+			}
+			items, _ := value.([]any)
+			for _, item := range items {
+				if nested, ok := item.(map[string]any); ok {
+					if err := checkConditionOperators(nested, allowed); err != nil {
+						return err
+					}
+				}
+			}
+			continue
+		}
+		filter, ok := value.(map[string]any)
+		if !ok {
+			continue
+		}
+		if err := checkFilterOperators(filter, allowed); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkFilterOperators(filter map[string]any, allowed map[string]bool) error {
+	for op, val := range filter {
+		if !allowed[op] {
+			return operatorNotAllowedErr(op)
+		}
+		if op == OpNot {
+			if inner, ok := val.(map[string]any); ok {
+				if err := checkFilterOperators(inner, allowed); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func operatorNotAllowedErr(op string) error {
+	return fmt.Errorf("%w: %s is not allowed for this database", tools.ErrInvalidOperator, op)
+}
+
+// softDeleteColumn returns the column stamped instead of deleting rows from
+// table, or "" when the table uses hard deletes.
+func (schema SchemaCache) softDeleteColumn(table string) string {
+	if schema.Settings == nil {
+		return ""
+	}
+	return schema.Settings.SoftDelete[table]
+}
+
+// excludeSoftDeleted narrows a WHERE clause built by BuildWhereFromJSON to rows
+// of table that have not been soft deleted.
+func (schema SchemaCache) excludeSoftDeleted(where, table string) string {
+	column := schema.softDeleteColumn(table)
+	if column == "" {
+		return where
+	}
+	clause := fmt.Sprintf("[%s].[%s] IS NULL ", table, column)
+	if where == "" {
+		return "WHERE " + clause
+	}
+	return where + "AND " + clause
+}
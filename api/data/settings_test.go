@@ -0,0 +1,105 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/atombasedev/atombase/config"
+	"github.com/atombasedev/atombase/tools"
+)
+
+func intPtr(v int) *int { return &v }
+
+func TestSelectLimit_AppliesDefinitionSettings(t *testing.T) {
+	oldCfg := config.Cfg
+	defer func() { config.Cfg = oldCfg }()
+	config.Cfg.DefaultLimit = 100
+	config.Cfg.MaxQueryLimit = 1000
+
+	tests := []struct {
+		name      string
+		settings  *APISettings
+		requested *int
+		want      int
+	}{
+		{name: "server defaults", want: 100},
+		{name: "definition default", settings: &APISettings{DefaultLimit: intPtr(20)}, want: 20},
+		{name: "definition max caps request", settings: &APISettings{MaxLimit: intPtr(50)}, requested: intPtr(500), want: 50},
+		{name: "definition max cannot raise server max", settings: &APISettings{MaxLimit: intPtr(5000)}, requested: intPtr(5000), want: 1000},
+		{name: "unlimited request is capped", settings: &APISettings{MaxLimit: intPtr(50)}, requested: intPtr(0), want: 50},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schema := SchemaCache{Settings: tt.settings}
+			if got := schema.selectLimit(tt.requested); got != tt.want {
+				t.Fatalf("selectLimit() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckAllowedOperators(t *testing.T) {
+	schema := SchemaCache{Settings: &APISettings{AllowedOperators: []string{"eq", "in", "or", "not"}}}
+
+	allowed := []map[string]any{
+		{"id": map[string]any{"eq": 1}},
+		{"or": []any{map[string]any{"status": map[string]any{"not": map[string]any{"in": []any{"a"}}}}}},
+	}
+	if err := schema.checkAllowedOperators(allowed); err != nil {
+		t.Fatalf("expected filters to be allowed, got %v", err)
+	}
+
+	for _, where := range [][]map[string]any{
+		{{"name": map[string]any{"like": "%a%"}}},
+		{{"or": []any{map[string]any{"age": map[string]any{"gt": 3}}}}},
+		{{"name": map[string]any{"not": map[string]any{"glob": "a*"}}}},
+	} {
+		if err := schema.checkAllowedOperators(where); !errors.Is(err, tools.ErrInvalidOperator) {
+			t.Fatalf("expected %v to be rejected, got %v", where, err)
+		}
+	}
+}
+
+func TestDeleteJSON_SoftDeleteHidesRows(t *testing.T) {
+	db := setupTestDB(t, schemaUsers+`ALTER TABLE users ADD COLUMN deleted_at TEXT;
+INSERT INTO users (id, name) VALUES (1, 'ann'), (2, 'bob');`)
+	defer db.Close()
+	schema := loadSchema(t, db)
+	schema.Settings = &APISettings{SoftDelete: map[string]string{"users": "deleted_at"}}
+	dao := &TenantConnection{Client: db, Schema: schema}
+	ctx := context.Background()
+
+	if _, err := dao.DeleteJSON(ctx, "users", DeleteRequest{Where: []map[string]any{{"id": map[string]any{"eq": 1}}}}); err != nil {
+		t.Fatalf("DeleteJSON failed: %v", err)
+	}
+
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM users WHERE deleted_at IS NOT NULL`).Scan(&count); err != nil || count != 1 {
+		t.Fatalf("expected one stamped row, got %d (%v)", count, err)
+	}
+
+	result, err := dao.SelectJSON(ctx, "users", SelectQuery{Select: []any{"id"}}, true)
+	if err != nil {
+		t.Fatalf("SelectJSON failed: %v", err)
+	}
+	var rows []map[string]any
+	if err := json.Unmarshal(result.Data, &rows); err != nil {
+		t.Fatal(err)
+	}
+	if result.Count != 1 || len(rows) != 1 || rows[0]["id"] != float64(2) {
+		t.Fatalf("expected only the live row, got count=%d rows=%v", result.Count, rows)
+	}
+
+	updated, err := dao.UpdateJSON(ctx, "users", UpdateRequest{
+		Data:  map[string]any{"name": "renamed"},
+		Where: []map[string]any{{"id": map[string]any{"in": []any{1, 2}}}},
+	})
+	if err != nil {
+		t.Fatalf("UpdateJSON failed: %v", err)
+	}
+	if string(updated) != `{"rows_affected":1}` {
+		t.Fatalf("expected soft deleted row to be skipped, got %s", updated)
+	}
+}
@@ -0,0 +1,61 @@
+package data
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/atombasedev/atombase/config"
+)
+
+// acceptsMediaType reports whether the request's Accept header lists mediaType.
+func acceptsMediaType(req *http.Request, mediaType string) bool {
+	for _, accept := range strings.Split(req.Header.Get("Accept"), ",") {
+		name, _, _ := strings.Cut(accept, ";")
+		if strings.EqualFold(strings.TrimSpace(name), mediaType) {
+			return true
+		}
+	}
+	return false
+}
+
+// wantsNDJSON reports whether a select should stream one JSON row per line.
+func wantsNDJSON(req *http.Request) bool {
+	return strings.EqualFold(req.URL.Query().Get(ParamFormat), "ndjson") || acceptsMediaType(req, "application/x-ndjson")
+}
+
+// flushWriter flushes a streamed response at most once per interval, so rows
+// reach the client as they are scanned without a flush per row.
+// The response controller reaches the server's writer through the
+// middleware wrappers.
+type flushWriter struct {
+	w         io.Writer
+	rc        *http.ResponseController
+	interval  time.Duration
+	lastFlush time.Time
+}
+
+func newFlushWriter(w http.ResponseWriter) *flushWriter {
+	return &flushWriter{
+		w:         w,
+		rc:        http.NewResponseController(w),
+		interval:  time.Duration(config.Cfg.StreamFlushInterval) * time.Millisecond,
+		lastFlush: time.Now(),
+	}
+}
+
+func (fw *flushWriter) Write(p []byte) (int, error) {
+	n, err := fw.w.Write(p)
+	if err == nil && time.Since(fw.lastFlush) >= fw.interval {
+		fw.Flush()
+	}
+	return n, err
+}
+
+// Flush sends whatever is still buffered. Writers that can't flush are
+// left to send on their own.
+func (fw *flushWriter) Flush() {
+	_ = fw.rc.Flush()
+	fw.lastFlush = time.Now()
+}
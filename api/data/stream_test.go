@@ -0,0 +1,68 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSelectNDJSON(t *testing.T) {
+	db := setupTestDB(t, schemaUsers)
+	if _, err := db.Exec(`INSERT INTO users (name, email, age) VALUES ('Alice', 'a@example.com', 30), ('Bob', 'b@example.com', 25), ('Cara', 'c@example.com', 41)`); err != nil {
+		t.Fatal(err)
+	}
+	dao := &TenantConnection{Client: db, Schema: loadSchema(t, db)}
+
+	var out bytes.Buffer
+	var counted int64 = -1
+	n, err := dao.SelectNDJSON(context.Background(), "users", SelectQuery{
+		Select: []any{"name"},
+		Where:  []map[string]any{{"age": map[string]any{"gt": 26}}},
+		Order:  map[string]string{"name": "asc"},
+	}, true, func(count int64) io.Writer {
+		counted = count
+		return &out
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 || counted != 2 {
+		t.Fatalf("got %d rows with count %d, want 2 and 2", n, counted)
+	}
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %q", out.String())
+	}
+	for i, want := range []string{"Alice", "Cara"} {
+		var row map[string]any
+		if err := json.Unmarshal([]byte(lines[i]), &row); err != nil {
+			t.Fatal(err)
+		}
+		if row["name"] != want {
+			t.Errorf("line %d: got %v, want name %s", i, row, want)
+		}
+	}
+
+	cursor := ""
+	if _, err := dao.SelectNDJSON(context.Background(), "users", SelectQuery{Cursor: &cursor}, false, func(int64) io.Writer { return &out }); err == nil {
+		t.Error("expected cursor pagination to be rejected")
+	}
+}
+
+func TestWantsNDJSON(t *testing.T) {
+	req := httptest.NewRequest("POST", "/data/query/users", nil)
+	if wantsNDJSON(req) {
+		t.Error("plain request should not stream")
+	}
+	req.Header.Set("Accept", "application/x-ndjson")
+	if !wantsNDJSON(req) {
+		t.Error("Accept: application/x-ndjson should stream")
+	}
+	if !wantsNDJSON(httptest.NewRequest("POST", "/data/query/users?format=ndjson", nil)) {
+		t.Error("?format=ndjson should stream")
+	}
+}
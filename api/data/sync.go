@@ -0,0 +1,298 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/atombasedev/atombase/tools"
+)
+
+// maxSyncChanges bounds one pull when the settings set no query limit.
+const maxSyncChanges = 1000
+
+// Conflict policies of a sync push.
+const (
+	SyncLastWriteWins = "lastWriteWins" // Apply the change over whatever the server has
+	SyncCustom        = "custom"        // Return the conflict for the client to resolve
+)
+
+// SyncChange is the latest change of one row in a table's change log. Each
+// row keeps only its latest change, so a client that pulls every page from
+// its cursor ends up with the table as it is now.
+type SyncChange struct {
+	Seq int64           `json:"seq"`
+	Op  string          `json:"op"` // upsert, or delete for a tombstone
+	Pk  any             `json:"pk"`
+	Row json.RawMessage `json:"row,omitempty"` // The row as it is now, on upsert
+}
+
+// SyncPage is the changes after a client's cursor, oldest first.
+type SyncPage struct {
+	Changes []SyncChange `json:"changes"`
+	Cursor  int64        `json:"cursor"` // Pass as since to pull the changes after these
+	HasMore bool         `json:"hasMore"`
+}
+
+// SyncPushRequest writes changes a client made while offline.
+type SyncPushRequest struct {
+	Changes  []SyncPushChange `json:"changes"`
+	Conflict string           `json:"conflict,omitempty"` // lastWriteWins (default) or custom
+}
+
+// SyncPushChange is one row a client wrote.
+type SyncPushChange struct {
+	Op      string         `json:"op"`             // upsert or delete
+	Row     map[string]any `json:"row,omitempty"`  // The columns to write, primary key included, on upsert
+	Pk      any            `json:"pk,omitempty"`   // The row to delete
+	BaseSeq int64          `json:"baseSeq"`        // Seq of the row's change the client last pulled, 0 for a row it made
+	Base    map[string]any `json:"base,omitempty"` // The row as the client last pulled it, for the merge strategy
+}
+
+// SyncPushResult reports how many changes were written and which were not.
+type SyncPushResult struct {
+	Applied   int            `json:"applied"`
+	Conflicts []SyncConflict `json:"conflicts"`
+}
+
+// SyncConflict is a pushed change to a row that changed on the server after
+// the client's baseSeq, and how it was settled. Left to the client, with
+// Resolution custom, the client merges it with the server's row and pushes
+// again with Seq as its baseSeq.
+type SyncConflict struct {
+	Index      int             `json:"index"` // Position of the change in the push
+	Pk         any             `json:"pk"`
+	Seq        int64           `json:"seq"`
+	Op         string          `json:"op"`            // The server's latest change to the row
+	Resolution string          `json:"resolution"`    // serverWins, clientWins, merge, rpc or custom
+	Row        json.RawMessage `json:"row,omitempty"` // The row on the server once settled, unless deleted or hidden by policy
+}
+
+// syncTable returns a table that logs its changes.
+func (dao *TenantConnection) syncTable(relation string) (CacheTable, error) {
+	if err := tools.ValidateTableName(relation); err != nil {
+		return CacheTable{}, err
+	}
+	table, err := dao.Schema.SearchTbls(relation)
+	if err != nil {
+		return CacheTable{}, err
+	}
+	if !dao.Schema.SyncTables[relation] || len(table.Pk) != 1 {
+		return CacheTable{}, fmt.Errorf("%w: %s", tools.ErrSyncNotEnabled, relation)
+	}
+	return table, nil
+}
+
+// PullChanges returns a table's changes after since. Upserted rows are read
+// through a select, so policies apply. A change to a row the caller cannot
+// see now comes as a delete only when the row was visible before the change,
+// judged from the row image the log keeps, so the rows that left the caller's
+// view are removed and the rest stay out of the pull. A row that left the view
+// and changed again before the pull is judged by its last image, and stays on
+// the client until it is deleted.
+func (dao *TenantConnection) PullChanges(ctx context.Context, relation string, since int64, requested *int) (SyncPage, error) {
+	table, err := dao.syncTable(relation)
+	if err != nil {
+		return SyncPage{}, err
+	}
+	limit := dao.Schema.selectLimit(requested)
+	if limit <= 0 || limit > maxSyncChanges {
+		limit = maxSyncChanges
+	}
+	policy, err := dao.compilePolicy(ctx, relation, "select", nil)
+	if err != nil {
+		return SyncPage{}, err
+	}
+
+	rows, err := dao.Client.QueryContext(ctx, "SELECT seq, op, pk, old FROM atombase_changes WHERE tbl = ? AND seq > ? ORDER BY seq LIMIT ?", relation, since, limit+1)
+	if err != nil {
+		return SyncPage{}, err
+	}
+	var changes []SyncChange
+	var olds []sql.NullString
+	for rows.Next() {
+		var change SyncChange
+		var old sql.NullString
+		if err := rows.Scan(&change.Seq, &change.Op, &change.Pk, &old); err != nil {
+			rows.Close()
+			return SyncPage{}, err
+		}
+		if b, ok := change.Pk.([]byte); ok {
+			change.Pk = string(b)
+		}
+		changes = append(changes, change)
+		olds = append(olds, old)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return SyncPage{}, err
+	}
+	page := SyncPage{Changes: []SyncChange{}, Cursor: since}
+	if len(changes) > limit {
+		changes, page.HasMore = changes[:limit], true
+	}
+	if len(changes) == 0 {
+		return page, nil
+	}
+	page.Cursor = changes[len(changes)-1].Seq
+
+	var pks []any
+	for _, change := range changes {
+		if change.Op == "upsert" {
+			pks = append(pks, change.Pk)
+		}
+	}
+	current, err := dao.syncRows(ctx, dao.Client, table, pks)
+	if err != nil {
+		return SyncPage{}, err
+	}
+	for i, change := range changes {
+		if change.Op == "upsert" {
+			if row, ok := current[syncKey(change.Pk)]; ok {
+				change.Row = row
+				page.Changes = append(page.Changes, change)
+				continue
+			}
+		}
+		if !olds[i].Valid {
+			continue
+		}
+		var old map[string]any
+		if err := json.Unmarshal([]byte(olds[i].String), &old); err != nil {
+			return SyncPage{}, err
+		}
+		visible, err := dao.eventVisible(ctx, table, "", nil, policy, old)
+		if err != nil {
+			return SyncPage{}, err
+		}
+		if visible {
+			change.Op = "delete"
+			page.Changes = append(page.Changes, change)
+		}
+	}
+	return page, nil
+}
+
+// syncRows selects the rows with the given primary keys that the caller can
+// see, keyed by syncKey.
+func (dao *TenantConnection) syncRows(ctx context.Context, exec Executor, table CacheTable, pks []any) (map[string]json.RawMessage, error) {
+	rows := map[string]json.RawMessage{}
+	if len(pks) == 0 {
+		return rows, nil
+	}
+	pkCol := table.Pk[0]
+	limit := len(pks)
+	result, err := dao.selectJSON(ctx, exec, table.Name, SelectQuery{
+		Where: []map[string]any{{pkCol: map[string]any{"in": pks}}},
+		Limit: &limit,
+	}, false)
+	if err != nil {
+		return nil, err
+	}
+	var list []json.RawMessage
+	if err := json.Unmarshal(result.Data, &list); err != nil {
+		return nil, err
+	}
+	for _, raw := range list {
+		var cols map[string]any
+		if err := json.Unmarshal(raw, &cols); err != nil {
+			return nil, err
+		}
+		rows[syncKey(cols[pkCol])] = raw
+	}
+	return rows, nil
+}
+
+// syncKey matches primary keys from the change log with those in JSON rows,
+// where integers come back as float64.
+func syncKey(pk any) string {
+	key, _ := json.Marshal(pk)
+	return string(key)
+}
+
+// PushChanges writes a client's changes in one transaction. A change to a row
+// that changed on the server after its baseSeq is a conflict, settled by the
+// table's settings.conflicts entry, or else by the push: lastWriteWins writes
+// it anyway and custom leaves it to the client. Every conflict is returned
+// with the row it left. Writes go through the table's policies like any other.
+func (dao *TenantConnection) PushChanges(ctx context.Context, relation string, req SyncPushRequest) (SyncPushResult, error) {
+	table, err := dao.syncTable(relation)
+	if err != nil {
+		return SyncPushResult{}, err
+	}
+	switch req.Conflict {
+	case "":
+		req.Conflict = SyncLastWriteWins
+	case SyncLastWriteWins, SyncCustom:
+	default:
+		return SyncPushResult{}, tools.InvalidRequestErr(fmt.Sprintf("conflict must be %s or %s, got %q", SyncLastWriteWins, SyncCustom, req.Conflict))
+	}
+	if len(req.Changes) > MaxBatchOperations {
+		return SyncPushResult{}, tools.ErrBatchTooLarge
+	}
+	result := SyncPushResult{Conflicts: []SyncConflict{}}
+	if len(req.Changes) == 0 {
+		return result, nil
+	}
+
+	tx, err := dao.Client.BeginTx(ctx, nil)
+	if err != nil {
+		return SyncPushResult{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	dao.pendingChanges = nil
+
+	pkCol := table.Pk[0]
+	for i, change := range req.Changes {
+		pk := change.Pk
+		switch change.Op {
+		case "upsert":
+			var ok bool
+			if pk, ok = change.Row[pkCol]; !ok || pk == nil {
+				return SyncPushResult{}, tools.InvalidRequestErr(fmt.Sprintf("change %d: upserted row has no %s", i, pkCol))
+			}
+		case "delete":
+			if pk == nil {
+				return SyncPushResult{}, tools.InvalidRequestErr(fmt.Sprintf("change %d: delete needs a pk", i))
+			}
+		default:
+			return SyncPushResult{}, tools.InvalidRequestErr(fmt.Sprintf("change %d: op must be upsert or delete, got %q", i, change.Op))
+		}
+
+		conflict := SyncConflict{Index: i, Pk: pk}
+		err := tx.QueryRowContext(ctx, "SELECT seq, op FROM atombase_changes WHERE tbl = ? AND pk = ?", relation, pk).Scan(&conflict.Seq, &conflict.Op)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return SyncPushResult{}, err
+		}
+		if conflict.Seq <= change.BaseSeq {
+			if err := dao.applySyncChange(ctx, tx, table, change.Op, change.Row, pk); err != nil {
+				return SyncPushResult{}, fmt.Errorf("change %d: %w", i, err)
+			}
+			result.Applied++
+			continue
+		}
+
+		conflict.Resolution = dao.Schema.conflictStrategy(relation, req.Conflict)
+		applied, err := dao.resolveConflict(ctx, tx, table, change, pk, &conflict)
+		if err != nil {
+			return SyncPushResult{}, fmt.Errorf("change %d: %w", i, err)
+		}
+		if applied {
+			result.Applied++
+		}
+		current, err := dao.syncRows(ctx, tx, table, []any{pk})
+		if err != nil {
+			return SyncPushResult{}, err
+		}
+		conflict.Row = current[syncKey(pk)]
+		result.Conflicts = append(result.Conflicts, conflict)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return SyncPushResult{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	dao.flushChanges(ctx)
+	return result, nil
+}
@@ -0,0 +1,190 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/atombasedev/atombase/tools"
+)
+
+const schemaSyncNotes = `
+CREATE TABLE notes (
+	id INTEGER PRIMARY KEY,
+	title TEXT,
+	tenant_id TEXT
+);
+CREATE TABLE atombase_changes (seq INTEGER PRIMARY KEY AUTOINCREMENT, tbl TEXT NOT NULL, pk NOT NULL, op TEXT NOT NULL, old TEXT, UNIQUE (tbl, pk));
+CREATE TRIGGER notes_sync_ai AFTER INSERT ON notes BEGIN
+	DELETE FROM atombase_changes WHERE tbl = 'notes' AND pk = NEW.id;
+	INSERT INTO atombase_changes (tbl, pk, op, old) VALUES ('notes', NEW.id, 'upsert', NULL);
+END;
+CREATE TRIGGER notes_sync_au AFTER UPDATE ON notes BEGIN
+	DELETE FROM atombase_changes WHERE tbl = 'notes' AND pk = NEW.id;
+	INSERT INTO atombase_changes (tbl, pk, op, old) VALUES ('notes', NEW.id, 'upsert', json_object('id', OLD.id, 'title', OLD.title, 'tenant_id', OLD.tenant_id));
+END;
+CREATE TRIGGER notes_sync_ad AFTER DELETE ON notes BEGIN
+	DELETE FROM atombase_changes WHERE tbl = 'notes' AND pk = OLD.id;
+	INSERT INTO atombase_changes (tbl, pk, op, old) VALUES ('notes', OLD.id, 'delete', json_object('id', OLD.id, 'title', OLD.title, 'tenant_id', OLD.tenant_id));
+END;
+`
+
+func syncOps(page SyncPage) []string {
+	ops := make([]string, len(page.Changes))
+	for i, change := range page.Changes {
+		ops[i] = change.Op + ":" + syncKey(change.Pk)
+	}
+	return ops
+}
+
+func TestPullChanges(t *testing.T) {
+	db := setupTestDB(t, schemaSyncNotes)
+	defer db.Close()
+	if _, err := db.Exec(`INSERT INTO notes (id, title) VALUES (1, 'a'), (2, 'b'), (3, 'c');
+		UPDATE notes SET title = 'A' WHERE id = 1;
+		DELETE FROM notes WHERE id = 2`); err != nil {
+		t.Fatal(err)
+	}
+	schema := loadSchema(t, db)
+	dao := &TenantConnection{Client: db, Schema: schema}
+	ctx := context.Background()
+
+	if _, err := dao.PullChanges(ctx, "notes", 0, nil); !errors.Is(err, tools.ErrSyncNotEnabled) {
+		t.Fatalf("expected ErrSyncNotEnabled without sync, got %v", err)
+	}
+	dao.Schema.SyncTables = map[string]bool{"notes": true}
+
+	limit := 2
+	page, err := dao.PullChanges(ctx, "notes", 0, &limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := syncOps(page); len(got) != 2 || got[0] != "upsert:3" || got[1] != "upsert:1" || !page.HasMore {
+		t.Fatalf("unexpected first page %v hasMore=%v", got, page.HasMore)
+	}
+	var row map[string]any
+	if err := json.Unmarshal(page.Changes[1].Row, &row); err != nil || row["title"] != "A" {
+		t.Fatalf("expected the current row, got %s", page.Changes[1].Row)
+	}
+
+	page, err = dao.PullChanges(ctx, "notes", page.Cursor, &limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := syncOps(page); len(got) != 1 || got[0] != "delete:2" || page.HasMore || page.Changes[0].Row != nil {
+		t.Fatalf("unexpected last page %v hasMore=%v", got, page.HasMore)
+	}
+
+	page, err = dao.PullChanges(ctx, "notes", page.Cursor, nil)
+	if err != nil || len(page.Changes) != 0 || page.HasMore {
+		t.Fatalf("expected nothing after the last cursor, got %v %v", syncOps(page), err)
+	}
+}
+
+func TestPullChanges_RowScoped(t *testing.T) {
+	db := setupTestDB(t, schemaSyncNotes)
+	defer db.Close()
+	if _, err := db.Exec(`INSERT INTO notes (id, title, tenant_id) VALUES (1, 'a', 'user-a'), (2, 'b', 'user-b'), (3, 'c', 'user-a'), (4, 'd', 'user-b'), (5, 'e', 'user-a');
+		DELETE FROM notes WHERE id = 2;
+		DELETE FROM notes WHERE id = 3;
+		UPDATE notes SET tenant_id = 'user-b' WHERE id = 1;
+		UPDATE notes SET title = 'D' WHERE id = 4;
+		UPDATE notes SET title = 'E' WHERE id = 5`); err != nil {
+		t.Fatal(err)
+	}
+	schema := loadSchema(t, db)
+	schema.SyncTables = map[string]bool{"notes": true}
+	schema.Settings = &APISettings{TenantColumn: "tenant_id"}
+	dao := &TenantConnection{Client: db, Schema: schema, RowTenant: "user-a"}
+
+	page, err := dao.PullChanges(context.Background(), "notes", 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Another tenant's rows and tombstones stay out, the caller's own delete
+	// and the row that moved away come as deletes.
+	got := syncOps(page)
+	if len(got) != 3 || got[0] != "delete:3" || got[1] != "delete:1" || got[2] != "upsert:5" {
+		t.Fatalf("expected only the caller's changes, got %v", got)
+	}
+	var last int64
+	if err := db.QueryRow(`SELECT MAX(seq) FROM atombase_changes`).Scan(&last); err != nil {
+		t.Fatal(err)
+	}
+	if page.Cursor != last || page.HasMore {
+		t.Fatalf("expected the cursor past the hidden changes, got %d want %d", page.Cursor, last)
+	}
+}
+
+func TestPushChanges(t *testing.T) {
+	db := setupTestDB(t, schemaSyncNotes)
+	defer db.Close()
+	if _, err := db.Exec(`INSERT INTO notes (id, title) VALUES (1, 'a'), (2, 'b')`); err != nil {
+		t.Fatal(err)
+	}
+	schema := loadSchema(t, db)
+	schema.SyncTables = map[string]bool{"notes": true}
+	dao := &TenantConnection{Client: db, Schema: schema}
+	ctx := context.Background()
+
+	page, err := dao.PullChanges(ctx, "notes", 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := page.Cursor
+	// Another client edits note 1 after this one pulled.
+	if _, err := db.Exec(`UPDATE notes SET title = 'server' WHERE id = 1`); err != nil {
+		t.Fatal(err)
+	}
+
+	push := SyncPushRequest{
+		Conflict: SyncCustom,
+		Changes: []SyncPushChange{
+			{Op: "upsert", Row: map[string]any{"id": 1, "title": "client"}, BaseSeq: base},
+			{Op: "delete", Pk: 2, BaseSeq: base},
+			{Op: "upsert", Row: map[string]any{"id": 3, "title": "new"}},
+		},
+	}
+	result, err := dao.PushChanges(ctx, "notes", push)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Applied != 2 || len(result.Conflicts) != 1 {
+		t.Fatalf("expected 2 applied and 1 conflict, got %+v", result)
+	}
+	conflict := result.Conflicts[0]
+	var row map[string]any
+	if err := json.Unmarshal(conflict.Row, &row); err != nil || conflict.Index != 0 || conflict.Op != "upsert" || row["title"] != "server" {
+		t.Fatalf("expected the server's row in the conflict, got %+v", conflict)
+	}
+
+	// Resolving the conflict against the server's seq applies it.
+	push = SyncPushRequest{Conflict: SyncCustom, Changes: []SyncPushChange{
+		{Op: "upsert", Row: map[string]any{"id": 1, "title": "merged"}, BaseSeq: conflict.Seq},
+	}}
+	if result, err = dao.PushChanges(ctx, "notes", push); err != nil || result.Applied != 1 {
+		t.Fatalf("expected the resolved change to apply, got %+v %v", result, err)
+	}
+
+	// Last write wins ignores the base.
+	push = SyncPushRequest{Changes: []SyncPushChange{{Op: "upsert", Row: map[string]any{"id": 1, "title": "last"}}}}
+	if result, err = dao.PushChanges(ctx, "notes", push); err != nil || result.Applied != 1 {
+		t.Fatalf("expected last write to win, got %+v %v", result, err)
+	}
+
+	var titles string
+	if err := db.QueryRow(`SELECT group_concat(id || '=' || title, ',') FROM (SELECT * FROM notes ORDER BY id)`).Scan(&titles); err != nil {
+		t.Fatal(err)
+	}
+	if titles != "1=last,3=new" {
+		t.Fatalf("unexpected rows after push: %s", titles)
+	}
+
+	if _, err := dao.PushChanges(ctx, "notes", SyncPushRequest{Changes: []SyncPushChange{{Op: "upsert", Row: map[string]any{"title": "x"}}}}); err == nil {
+		t.Fatal("expected an upsert without its primary key to fail")
+	}
+	if _, err := dao.PushChanges(ctx, "notes", SyncPushRequest{Conflict: "merge"}); err == nil {
+		t.Fatal("expected an unknown conflict policy to fail")
+	}
+}
@@ -0,0 +1,547 @@
+package data
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/atombasedev/atombase/tools"
+)
+
+// timeSeriesMaintained holds, by database, the month and definition version
+// time-series maintenance last ran at, so it runs once for each.
+var timeSeriesMaintained sync.Map
+
+// TimeSeriesPartition is the rows of one past month of a time-series table.
+type TimeSeriesPartition struct {
+	Month string `json:"month"` // YYYY-MM
+	Rows  int64  `json:"rows"`
+}
+
+// TimeSeriesPartitions lists a time-series table's partitions, oldest first,
+// and the rows of the current month still in the table.
+type TimeSeriesPartitions struct {
+	Table      string                `json:"table"`
+	Current    int64                 `json:"current"`
+	Partitions []TimeSeriesPartition `json:"partitions"`
+}
+
+// TimeSeriesArchive is a partition uploaded to the export bucket as a SQLite
+// database and dropped.
+type TimeSeriesArchive struct {
+	Month     string    `json:"month"`
+	Rows      int64     `json:"rows"`
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type partition struct {
+	table, month, name string
+	rows               int64
+}
+
+// sourceAs returns what a select reads a table from, under alias: a
+// time-series table's series view, which adds its partitions to it.
+func (schema SchemaCache) sourceAs(table, alias string) string {
+	name := table
+	if _, ok := schema.TimeSeries[table]; ok {
+		name = table + "_series"
+	}
+	if name == alias {
+		return "[" + name + "]"
+	}
+	return fmt.Sprintf("[%s] AS [%s]", name, alias)
+}
+
+func (schema SchemaCache) source(table string) string {
+	return schema.sourceAs(table, table)
+}
+
+// monthExpr is the YYYY-MM of a time-series table's row.
+func (schema SchemaCache) monthExpr(table string) string {
+	column := schema.TimeSeries[table].Column
+	if strings.EqualFold(schema.Tables[table].Columns[column], ColTypeInteger) {
+		return fmt.Sprintf("strftime('%%Y-%%m', [%s], 'unixepoch')", column)
+	}
+	return fmt.Sprintf("strftime('%%Y-%%m', [%s])", column)
+}
+
+// partitionName names the table holding a month of a time-series table.
+func partitionName(table, month string) string {
+	return table + "_p" + strings.ReplaceAll(month, "-", "")
+}
+
+// maintainTimeSeries rolls time-series tables over once a month, and after a
+// migration, which leaves series views over their tables alone. A failure is
+// logged and tried again on the next request; reads meanwhile see the rows
+// the views already cover.
+func (dao *TenantConnection) maintainTimeSeries(ctx context.Context) {
+	if dao.DefinitionID == 0 || dao.Client == nil || dao.DatabaseVersion != dao.SchemaVersion {
+		return
+	}
+	now := time.Now().UTC()
+	key := fmt.Sprintf("%s:%d", now.Format("2006-01"), dao.DatabaseVersion)
+	if last, ok := timeSeriesMaintained.Load(dao.ID); ok && last == key {
+		return
+	}
+	if err := dao.RolloverTimeSeries(ctx, now); err != nil {
+		log.Printf("time-series maintenance failed database_id=%s: %v", dao.ID, err)
+		return
+	}
+	timeSeriesMaintained.Store(dao.ID, key)
+}
+
+// RolloverTimeSeries moves the rows of months before now's out of each
+// time-series table into its partitions, drops partitions past retention,
+// archiving them first when the table asks to, and rebuilds the series views.
+// Partitions of tables that are no longer time series are emptied back into
+// their table, or dropped with it.
+func (dao *TenantConnection) RolloverTimeSeries(ctx context.Context, now time.Time) error {
+	if len(dao.Schema.TimeSeries) == 0 {
+		var listed bool
+		if err := dao.Client.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = 'atombase_partitions')`).Scan(&listed); err != nil || !listed {
+			return err
+		}
+	}
+	tx, err := dao.Client.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	partitions, err := listPartitions(ctx, tx)
+	if err != nil {
+		return err
+	}
+	for table, parts := range partitions {
+		if _, ok := dao.Schema.TimeSeries[table]; ok {
+			continue
+		}
+		_, isTable := dao.Schema.Tables[table]
+		if err := dao.dissolvePartitions(ctx, tx, table, parts, isTable && !dao.Schema.Views[table]); err != nil {
+			return err
+		}
+	}
+
+	current := now.UTC().Format("2006-01")
+	var expired []partition
+	for _, table := range sortedTimeSeries(dao.Schema.TimeSeries) {
+		parts, err := dao.rolloverTable(ctx, tx, table, current, partitions[table])
+		if err != nil {
+			return err
+		}
+		ts := dao.Schema.TimeSeries[table]
+		if ts.Retention > 0 {
+			y, m, _ := now.UTC().Date()
+			cutoff := time.Date(y, m-time.Month(ts.Retention), 1, 0, 0, 0, 0, time.UTC).Format("2006-01")
+			kept := parts[:0]
+			for _, part := range parts {
+				switch {
+				case part.month >= cutoff:
+					kept = append(kept, part)
+				case ts.Archive:
+					// Archived after commit; dropped once uploaded.
+					kept = append(kept, part)
+					expired = append(expired, part)
+				default:
+					if err := dropPartition(ctx, tx, part); err != nil {
+						return err
+					}
+				}
+			}
+			parts = kept
+		}
+		if err := refreshSeriesView(ctx, tx, table, parts); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	if len(expired) > 0 && exportStore() == nil {
+		log.Printf("time-series partitions kept past retention database_id=%s: exports are not configured", dao.ID)
+		return nil
+	}
+	for _, part := range expired {
+		if _, err := dao.ArchivePartition(ctx, part.table, part.month); err != nil {
+			return fmt.Errorf("archive %s: %w", part.name, err)
+		}
+	}
+	return nil
+}
+
+func sortedTimeSeries(m map[string]TimeSeries) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// listPartitions returns every partition by table, oldest first.
+func listPartitions(ctx context.Context, exec Executor) (map[string][]partition, error) {
+	var listed bool
+	if err := exec.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = 'atombase_partitions')`).Scan(&listed); err != nil || !listed {
+		return nil, err
+	}
+	rows, err := exec.QueryContext(ctx, `SELECT tbl, month, name, rows FROM atombase_partitions ORDER BY tbl, month`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	partitions := map[string][]partition{}
+	for rows.Next() {
+		var p partition
+		if err := rows.Scan(&p.table, &p.month, &p.name, &p.rows); err != nil {
+			return nil, err
+		}
+		partitions[p.table] = append(partitions[p.table], p)
+	}
+	return partitions, rows.Err()
+}
+
+// rolloverTable moves a table's rows from months before current into their
+// partitions and returns the table's partitions.
+func (dao *TenantConnection) rolloverTable(ctx context.Context, tx *sql.Tx, table, current string, parts []partition) ([]partition, error) {
+	month := dao.Schema.monthExpr(table)
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("SELECT DISTINCT %s FROM [%s] WHERE %s < ?", month, table, month), current)
+	if err != nil {
+		return nil, err
+	}
+	var months []string
+	for rows.Next() {
+		var m string
+		if err := rows.Scan(&m); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		months = append(months, m)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil || len(months) == 0 {
+		return parts, err
+	}
+
+	columns, err := tableColumns(ctx, tx, table)
+	if err != nil {
+		return nil, err
+	}
+	byMonth := make(map[string]int, len(parts))
+	for i, part := range parts {
+		byMonth[part.month] = i
+	}
+	for _, m := range months {
+		i, ok := byMonth[m]
+		if !ok {
+			part := partition{table: table, month: m, name: partitionName(table, m)}
+			stmts := []string{
+				fmt.Sprintf("CREATE TABLE [%s] AS SELECT * FROM [%s] WHERE 0", part.name, table),
+				fmt.Sprintf("CREATE INDEX [%s_time] ON [%s] ([%s])", part.name, part.name, dao.Schema.TimeSeries[table].Column),
+			}
+			for _, stmt := range stmts {
+				if _, err := tx.ExecContext(ctx, stmt); err != nil {
+					return nil, err
+				}
+			}
+			if _, err := tx.ExecContext(ctx, `INSERT INTO atombase_partitions (tbl, month, name) VALUES (?, ?, ?)`, table, m, part.name); err != nil {
+				return nil, err
+			}
+			parts = append(parts, part)
+			i = len(parts) - 1
+			byMonth[m] = i
+		} else if err := addPartitionColumns(ctx, tx, parts[i].name, columns); err != nil {
+			return nil, err
+		}
+		names := quotedColumns(columns)
+		res, err := tx.ExecContext(ctx, fmt.Sprintf("INSERT INTO [%s] (%s) SELECT %s FROM [%s] WHERE %s = ?", parts[i].name, names, names, table, month), m)
+		if err != nil {
+			return nil, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+		parts[i].rows += n
+		if _, err := tx.ExecContext(ctx, `UPDATE atombase_partitions SET rows = ? WHERE name = ?`, parts[i].rows, parts[i].name); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM [%s] WHERE %s < ?", table, month), current); err != nil {
+		return nil, err
+	}
+	sort.Slice(parts, func(a, b int) bool { return parts[a].month < parts[b].month })
+	return parts, nil
+}
+
+// dissolvePartitions drops the partitions of a table that is no longer a
+// time series, moving their rows back into it first when it still exists.
+func (dao *TenantConnection) dissolvePartitions(ctx context.Context, tx *sql.Tx, table string, parts []partition, restore bool) error {
+	var columns []tableColumn
+	if restore {
+		var err error
+		if columns, err = tableColumns(ctx, tx, table); err != nil {
+			return err
+		}
+	}
+	for _, part := range parts {
+		if restore {
+			if err := addPartitionColumns(ctx, tx, part.name, columns); err != nil {
+				return err
+			}
+			names := quotedColumns(columns)
+			if _, err := tx.ExecContext(ctx, fmt.Sprintf("INSERT INTO [%s] (%s) SELECT %s FROM [%s]", table, names, names, part.name)); err != nil {
+				return err
+			}
+		}
+		if err := dropPartition(ctx, tx, part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func dropPartition(ctx context.Context, tx *sql.Tx, part partition) error {
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("DROP TABLE IF EXISTS [%s]", part.name)); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, `DELETE FROM atombase_partitions WHERE name = ?`, part.name)
+	return err
+}
+
+// refreshSeriesView makes a table's series view read the table and each of
+// its partitions.
+func refreshSeriesView(ctx context.Context, tx *sql.Tx, table string, parts []partition) error {
+	columns, err := tableColumns(ctx, tx, table)
+	if err != nil {
+		return err
+	}
+	names := quotedColumns(columns)
+	selects := []string{fmt.Sprintf("SELECT %s FROM [%s]", names, table)}
+	for _, part := range parts {
+		if err := addPartitionColumns(ctx, tx, part.name, columns); err != nil {
+			return err
+		}
+		selects = append(selects, fmt.Sprintf("SELECT %s FROM [%s]", names, part.name))
+	}
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("DROP VIEW IF EXISTS [%s_series]", table)); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, fmt.Sprintf("CREATE VIEW [%s_series] AS %s", table, strings.Join(selects, " UNION ALL ")))
+	return err
+}
+
+type tableColumn struct {
+	name, typ string
+}
+
+func tableColumns(ctx context.Context, exec Executor, table string) ([]tableColumn, error) {
+	rows, err := exec.QueryContext(ctx, `SELECT name, type FROM pragma_table_info(?) ORDER BY cid`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var columns []tableColumn
+	for rows.Next() {
+		var col tableColumn
+		if err := rows.Scan(&col.name, &col.typ); err != nil {
+			return nil, err
+		}
+		columns = append(columns, col)
+	}
+	return columns, rows.Err()
+}
+
+// addPartitionColumns adds the columns a partition's table gained since the
+// partition was made. Columns it lost stay in the partition, unread.
+func addPartitionColumns(ctx context.Context, tx *sql.Tx, name string, columns []tableColumn) error {
+	have, err := tableColumns(ctx, tx, name)
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]bool, len(have))
+	for _, col := range have {
+		existing[col.name] = true
+	}
+	for _, col := range columns {
+		if !existing[col.name] {
+			if _, err := tx.ExecContext(ctx, fmt.Sprintf("ALTER TABLE [%s] ADD COLUMN [%s] %s", name, col.name, col.typ)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func quotedColumns(columns []tableColumn) string {
+	names := make([]string, len(columns))
+	for i, col := range columns {
+		names[i] = "[" + col.name + "]"
+	}
+	return strings.Join(names, ", ")
+}
+
+// timeSeriesTable checks that table exists and is a time series.
+func (dao *TenantConnection) timeSeriesTable(table string) error {
+	if !dao.Principal.IsService {
+		return tools.UnauthorizedErr("time-series partitions need the service key")
+	}
+	if _, err := dao.Schema.SearchTbls(table); err != nil {
+		return err
+	}
+	if _, ok := dao.Schema.TimeSeries[table]; !ok {
+		return tools.InvalidRequestErr(fmt.Sprintf("table %s is not a time series", table))
+	}
+	return nil
+}
+
+// ListPartitions returns a time-series table's partitions.
+func (dao *TenantConnection) ListPartitions(ctx context.Context, table string) (TimeSeriesPartitions, error) {
+	if err := dao.timeSeriesTable(table); err != nil {
+		return TimeSeriesPartitions{}, err
+	}
+	result := TimeSeriesPartitions{Table: table, Partitions: []TimeSeriesPartition{}}
+	if err := dao.Client.QueryRowContext(ctx, fmt.Sprintf("SELECT COUNT(*) FROM [%s]", table)).Scan(&result.Current); err != nil {
+		return TimeSeriesPartitions{}, err
+	}
+	partitions, err := listPartitions(ctx, dao.Client)
+	if err != nil {
+		return TimeSeriesPartitions{}, err
+	}
+	for _, part := range partitions[table] {
+		result.Partitions = append(result.Partitions, TimeSeriesPartition{Month: part.month, Rows: part.rows})
+	}
+	return result, nil
+}
+
+// ArchivePartition uploads a month of a time-series table to the export
+// bucket as a SQLite database, drops the partition and returns a signed link
+// to the upload.
+func (dao *TenantConnection) ArchivePartition(ctx context.Context, table, month string) (TimeSeriesArchive, error) {
+	store := exportStore()
+	if store == nil {
+		return TimeSeriesArchive{}, tools.InvalidRequestErr("exports are not configured on this server")
+	}
+	partitions, err := listPartitions(ctx, dao.Client)
+	if err != nil {
+		return TimeSeriesArchive{}, err
+	}
+	var part partition
+	for _, p := range partitions[table] {
+		if p.month == month {
+			part = p
+		}
+	}
+	if part.name == "" {
+		return TimeSeriesArchive{}, tools.InvalidRequestErr(fmt.Sprintf("table %s has no partition for %s", table, month))
+	}
+
+	rowsFile, err := os.CreateTemp("", "atomicbase-archive-*.ndjson")
+	if err != nil {
+		return TimeSeriesArchive{}, err
+	}
+	defer os.Remove(rowsFile.Name())
+	defer rowsFile.Close()
+	if err := writePartitionRows(ctx, dao.Client, part.name, rowsFile); err != nil {
+		return TimeSeriesArchive{}, err
+	}
+	path := strings.TrimSuffix(rowsFile.Name(), ".ndjson") + ".db"
+	defer os.Remove(path)
+	cacheTable, _ := dao.Schema.SearchTbls(table)
+	if err := writeExportSQLite(ctx, rowsFile, path, cacheTable, NestedFlatten); err != nil {
+		return TimeSeriesArchive{}, err
+	}
+	artifact, err := os.Open(path)
+	if err != nil {
+		return TimeSeriesArchive{}, err
+	}
+	defer artifact.Close()
+	key := fmt.Sprintf("%s/archives/%s/%s.db", dao.ID, table, month)
+	if err := store.PutFile(ctx, key, artifact, exportContentTypes[ExportSQLite]); err != nil {
+		return TimeSeriesArchive{}, fmt.Errorf("upload failed: %w", err)
+	}
+
+	tx, err := dao.Client.BeginTx(ctx, nil)
+	if err != nil {
+		return TimeSeriesArchive{}, err
+	}
+	defer tx.Rollback()
+	if err := dropPartition(ctx, tx, part); err != nil {
+		return TimeSeriesArchive{}, err
+	}
+	remaining := partitions[table][:0]
+	for _, p := range partitions[table] {
+		if p.name != part.name {
+			remaining = append(remaining, p)
+		}
+	}
+	if err := refreshSeriesView(ctx, tx, table, remaining); err != nil {
+		return TimeSeriesArchive{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return TimeSeriesArchive{}, err
+	}
+
+	now := time.Now().UTC()
+	link, err := store.PresignGet(key, exportURLTTL(), now)
+	if err != nil {
+		return TimeSeriesArchive{}, err
+	}
+	return TimeSeriesArchive{Month: month, Rows: part.rows, URL: link, ExpiresAt: now.Add(exportURLTTL())}, nil
+}
+
+// writePartitionRows writes a partition's rows to w as lines of JSON, the
+// rows file writeExportSQLite reads.
+func writePartitionRows(ctx context.Context, exec Executor, name string, w *os.File) error {
+	rows, err := exec.QueryContext(ctx, fmt.Sprintf("SELECT * FROM [%s]", name))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	out := bufio.NewWriter(w)
+	values := make([]any, len(columns))
+	ptrs := make([]any, len(columns))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	row := make(map[string]any, len(columns))
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return err
+		}
+		for i, col := range columns {
+			if b, ok := values[i].([]byte); ok {
+				row[col] = string(b)
+			} else {
+				row[col] = values[i]
+			}
+		}
+		line, err := json.Marshal(row)
+		if err != nil {
+			return err
+		}
+		out.Write(line)
+		out.WriteByte('\n')
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if err := out.Flush(); err != nil {
+		return err
+	}
+	_, err = w.Seek(0, 0)
+	return err
+}
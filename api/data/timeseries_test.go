@@ -0,0 +1,145 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/atombasedev/atombase/definitions"
+)
+
+const schemaTimeSeriesEvents = `
+CREATE TABLE events (
+	id INTEGER PRIMARY KEY,
+	at INTEGER NOT NULL,
+	kind TEXT
+);
+CREATE VIEW events_series AS SELECT * FROM events;
+`
+
+func unixAt(month string, day int) int64 {
+	t, _ := time.Parse("2006-01", month)
+	return t.AddDate(0, 0, day-1).Unix()
+}
+
+func seriesMonths(t *testing.T, dao *TenantConnection) []string {
+	t.Helper()
+	list, err := dao.ListPartitions(context.Background(), "events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var months []string
+	for _, part := range list.Partitions {
+		months = append(months, part.Month)
+	}
+	return months
+}
+
+func TestRolloverTimeSeries(t *testing.T) {
+	db := setupTestDB(t, schemaTimeSeriesEvents+`CREATE TABLE atombase_partitions (tbl TEXT NOT NULL, month TEXT NOT NULL, name TEXT NOT NULL UNIQUE, rows INTEGER NOT NULL DEFAULT 0, PRIMARY KEY (tbl, month));`)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	for _, row := range []struct {
+		month string
+		day   int
+		kind  string
+	}{{"2026-01", 3, "a"}, {"2026-01", 20, "b"}, {"2026-02", 1, "c"}, {"2026-03", 2, "d"}} {
+		if _, err := db.Exec(`INSERT INTO events (at, kind) VALUES (?, ?)`, unixAt(row.month, row.day), row.kind); err != nil {
+			t.Fatal(err)
+		}
+	}
+	schema := loadSchema(t, db)
+	schema.TimeSeries = map[string]TimeSeries{"events": {Column: "at"}}
+	dao := &TenantConnection{Client: db, Schema: schema, Principal: definitions.Principal{IsService: true}}
+	ctx := context.Background()
+	march := time.Date(2026, 3, 15, 0, 0, 0, 0, time.UTC)
+
+	countRows := func() int {
+		t.Helper()
+		result, err := dao.SelectJSON(ctx, "events", SelectQuery{Select: []any{"id", "kind"}}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var rows []map[string]any
+		if err := json.Unmarshal(result.Data, &rows); err != nil {
+			t.Fatal(err)
+		}
+		return len(rows)
+	}
+
+	if err := dao.RolloverTimeSeries(ctx, march); err != nil {
+		t.Fatal(err)
+	}
+	if got := seriesMonths(t, dao); len(got) != 2 || got[0] != "2026-01" || got[1] != "2026-02" {
+		t.Fatalf("expected January and February partitioned, got %v", got)
+	}
+	var hot int
+	db.QueryRow(`SELECT COUNT(*) FROM events`).Scan(&hot)
+	if hot != 1 {
+		t.Fatalf("expected only March left in the table, got %d rows", hot)
+	}
+	if n := countRows(); n != 4 {
+		t.Fatalf("expected selects to read the partitions, got %d rows", n)
+	}
+
+	// Rows arriving late for a partitioned month join its partition, with
+	// columns the table gained since.
+	if _, err := db.Exec(`ALTER TABLE events ADD COLUMN note TEXT`); err != nil {
+		t.Fatal(err)
+	}
+	dao.Schema = loadSchema(t, db)
+	dao.Schema.TimeSeries = map[string]TimeSeries{"events": {Column: "at"}}
+	if _, err := db.Exec(`INSERT INTO events (at, kind, note) VALUES (?, 'e', 'late')`, unixAt("2026-02", 9)); err != nil {
+		t.Fatal(err)
+	}
+	if err := dao.RolloverTimeSeries(ctx, march); err != nil {
+		t.Fatal(err)
+	}
+	list, _ := dao.ListPartitions(ctx, "events")
+	if list.Partitions[1].Rows != 2 || list.Current != 1 {
+		t.Fatalf("expected the late row in February, got %+v", list)
+	}
+	var note string
+	if err := db.QueryRow(`SELECT note FROM events_series WHERE kind = 'e'`).Scan(&note); err != nil || note != "late" {
+		t.Fatalf("expected the new column through the view, got %q, %v", note, err)
+	}
+
+	// Partitions past retention are dropped.
+	dao.Schema.TimeSeries["events"] = TimeSeries{Column: "at", Retention: 1}
+	if err := dao.RolloverTimeSeries(ctx, time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+	if got := seriesMonths(t, dao); len(got) != 1 || got[0] != "2026-03" {
+		t.Fatalf("expected only March kept, got %v", got)
+	}
+	if n := countRows(); n != 1 {
+		t.Fatalf("expected one row after retention, got %d", n)
+	}
+
+	// A table that stops being a time series gets its rows back.
+	delete(dao.Schema.TimeSeries, "events")
+	if err := dao.RolloverTimeSeries(ctx, time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+	db.QueryRow(`SELECT COUNT(*) FROM events`).Scan(&hot)
+	var partitions int
+	db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE name LIKE 'events_p%'`).Scan(&partitions)
+	if hot != 1 || partitions != 0 {
+		t.Fatalf("expected the partition emptied back into the table, got %d rows and %d partitions", hot, partitions)
+	}
+}
+
+func TestTimeSeriesRequiresTimeSeriesTable(t *testing.T) {
+	db := setupTestDB(t, schemaTimeSeriesEvents)
+	defer db.Close()
+	dao := &TenantConnection{Client: db, Schema: loadSchema(t, db), Principal: definitions.Principal{IsService: true}}
+	if _, err := dao.ListPartitions(context.Background(), "events"); err == nil {
+		t.Fatal("expected a table that is not a time series to be refused")
+	}
+	dao.Schema.TimeSeries = map[string]TimeSeries{"events": {Column: "at"}}
+	dao.Principal = definitions.Principal{UserID: "u1"}
+	if _, err := dao.ListPartitions(context.Background(), "events"); err == nil {
+		t.Fatal("expected partitions to need the service key")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"time"
 
 	"github.com/atombasedev/atombase/definitions"
 	"github.com/atombasedev/atombase/primarystore"
@@ -15,6 +16,11 @@ import (
 type API struct {
 	store       *primarystore.Store
 	definitions *definitions.Service
+	exports     *exportRegistry
+	events      *eventHub
+	presence    *presenceHub
+	broadcast   *broadcastHub
+	webhooks    *webhookCache
 }
 
 // TenantConnection represents an external tenant database connection with cached schema.
@@ -29,14 +35,31 @@ type TenantConnection struct {
 	SchemaVersion   int // Current definition version from schema cache
 	DatabaseVersion int // Database's applied definition_version
 	Principal       definitions.Principal
+	RowTenant       string   // User the connection is scoped to in a shared database
+	WritesPaused    bool     // Writes are rejected while the user moves between databases
+	ReadOnly        bool     // The request may only read: a GET, or sent with Prefer: tx=read-only
+	CallerKey       string   // Identifies the caller for per-caller limits ("" for service requests)
+	AllowFullScan   bool     // Sent with allow_full_scan=true, so the full scan guard lets unindexed filters run
+	FullScans       []string // Large tables the request's filters scanned in full, reported in X-Full-Scan
+	release         func()   // Hands a pooled Client back; nil when Client is the connection's own
 	primaryStore    *primarystore.Store
+	events          *eventHub
+	webhooks        *webhookCache
+	pendingChanges  []pendingChange // Changes written in a transaction, published on commit
 }
 
 // SchemaCache holds cached table and foreign key information for query validation.
 type SchemaCache struct {
-	Tables    map[string]CacheTable // Keyed by table name
-	Fks       map[string][]CacheFk  // Keyed by table name -> list of FKs from that table
-	FTSTables map[string]bool       // Set of tables that have FTS5 indexes
+	Tables     map[string]CacheTable // Keyed by table name
+	Fks        map[string][]CacheFk  // Keyed by table name -> list of FKs from that table
+	FTSTables  map[string]bool       // Set of tables that have FTS5 indexes
+	FTSColumns map[string][]string   // Indexed columns of each FTS5 table, in index order
+	GeoColumns map[string][]string   // Latitude and longitude columns of tables with an R*Tree index
+	Views      map[string]bool       // Set of Tables entries that are read-only views
+	SyncTables map[string]bool       // Set of tables that log their changes for offline sync
+	TimeSeries map[string]TimeSeries // Tables partitioned by month, read through their series views
+	Rollups    map[string]string     // Time-series table of each rollup, which Tables holds as a view
+	Settings   *APISettings          // Data API settings declared by the definition
 }
 
 // Fk represents a foreign key relationship between tables.
@@ -45,6 +68,7 @@ type CacheFk struct {
 	References string // Referenced table
 	From       string // FK column name
 	To         string // Referenced column name
+	Unique     bool   // From is unique, so a referenced row has at most one referencing row
 }
 
 type CacheTable struct {
@@ -55,9 +79,25 @@ type CacheTable struct {
 
 type Schema = sharedschema.Schema
 type Table = sharedschema.Table
+type View = sharedschema.View
 type Index = sharedschema.Index
 type Col = sharedschema.Col
 type Generated = sharedschema.Generated
+type APISettings = sharedschema.APISettings
+type TableValidation = sharedschema.TableValidation
+type ColumnRule = sharedschema.ColumnRule
+type FieldRule = sharedschema.FieldRule
+type LocalizedFields = sharedschema.LocalizedFields
+type LocalizedField = sharedschema.LocalizedField
+type Function = sharedschema.Function
+type FunctionParam = sharedschema.FunctionParam
+type RateLimit = sharedschema.RateLimit
+type PresenceChannel = sharedschema.PresenceChannel
+type BroadcastChannel = sharedschema.BroadcastChannel
+type ConflictRule = sharedschema.ConflictRule
+type TimeSeries = sharedschema.TimeSeries
+type Rollup = sharedschema.Rollup
+type Aggregate = sharedschema.Aggregate
 
 // Executor is an interface that both *sql.DB and *sql.Tx implement.
 // This allows query methods to work with either a direct connection or a transaction.
@@ -99,6 +139,30 @@ type SelectQuery struct {
 	Order  map[string]string `json:"order,omitempty"`  // Ordering: {"created_at": "desc"}
 	Limit  *int              `json:"limit,omitempty"`
 	Offset *int              `json:"offset,omitempty"`
+	Cursor *string           `json:"cursor,omitempty"` // Keyset pagination: "" for the first page, then the previous nextCursor
+	// Computed fields: {"total": "price * quantity"}, added to each root row.
+	Computed map[string]string `json:"computed,omitempty"`
+	// Languages for localized fields, as in Accept-Language: "de-AT, en;q=0.5".
+	Lang string `json:"lang,omitempty"`
+	// Full-text search over the table's FTS5 index.
+	Search *TextSearch `json:"search,omitempty"`
+}
+
+// AggregateQuery computes approximate aggregates over the rows matching
+// Where: {"visitors": "approx_count_distinct(user_id)", "p95": "approx_percentile(latency, 0.95)"}.
+// POST /data/query/{table} with Prefer: operation=aggregate
+type AggregateQuery struct {
+	Aggregates map[string]string `json:"aggregates"`
+	Where      []map[string]any  `json:"where,omitempty"`
+}
+
+// TextSearch restricts a select to the rows matching an FTS5 query. Matches
+// come back best first unless the select is ordered or paged by cursor.
+type TextSearch struct {
+	Query     string            `json:"query"`               // FTS5 query: words, "phrases", prefix*, AND, OR, NOT
+	Rank      string            `json:"rank,omitempty"`      // Field for the bm25 score; lower is a better match
+	Snippet   map[string]string `json:"snippet,omitempty"`   // Field -> column to excerpt around the matches, "*" for the best one
+	Highlight map[string]string `json:"highlight,omitempty"` // Field -> column returned whole with the matches marked
 }
 
 // JoinClause represents a custom join specification.
@@ -122,22 +186,31 @@ type InsertRequest struct {
 // UpsertRequest represents a JSON UPSERT request body.
 // Used with POST /data/query/{table} and Prefer: operation=insert,on-conflict=replace header.
 // Data accepts either a single object or an array of objects.
+// OnConflict names the columns of a unique constraint to match rows on, the
+// primary key when empty; the ?on_conflict= query parameter sets it too.
+// IgnoreDuplicates keeps conflicting rows as they are instead of updating them.
 type UpsertRequest struct {
-	Data      RowData  `json:"data"`                // Row(s) to upsert: {...} or [{...}, ...]
-	Returning []string `json:"returning,omitempty"` // Columns to return after upsert
+	Data             RowData  `json:"data"`                       // Row(s) to upsert: {...} or [{...}, ...]
+	Returning        []string `json:"returning,omitempty"`        // Columns to return after upsert
+	OnConflict       []string `json:"onConflict,omitempty"`       // Conflict target columns
+	IgnoreDuplicates bool     `json:"ignoreDuplicates,omitempty"` // DO NOTHING instead of DO UPDATE
 }
 
 // UpdateRequest represents a JSON UPDATE request body.
 // Used with PATCH /data/query/{table}.
 type UpdateRequest struct {
-	Data  map[string]any   `json:"data"`  // Column values to update
-	Where []map[string]any `json:"where"` // Required: filter conditions
+	Data      map[string]any   `json:"data"`                // Column values to update
+	Where     []map[string]any `json:"where"`               // Required: filter conditions
+	Returning []string         `json:"returning,omitempty"` // Columns to return for the updated rows
+	Rows      []map[string]any `json:"rows,omitempty"`      // Bulk mode: rows keyed by primary key, instead of data and where
 }
 
 // DeleteRequest represents a JSON DELETE request body.
 // Used with DELETE /data/query/{table}.
 type DeleteRequest struct {
-	Where []map[string]any `json:"where"` // Required: filter conditions
+	Where     []map[string]any `json:"where"`               // Required: filter conditions
+	Returning []string         `json:"returning,omitempty"` // Columns to return for the deleted rows
+	Rows      []map[string]any `json:"rows,omitempty"`      // Bulk mode: primary keys of the rows to delete, instead of where
 }
 
 // Filter represents a single filter condition on a column.
@@ -162,6 +235,7 @@ type Filter struct {
 // Used with POST /data/batch.
 type BatchRequest struct {
 	Operations []BatchOperation `json:"operations"`
+	Snapshot   bool             `json:"snapshot,omitempty"` // Read-only: every select sees the same point-in-time view
 }
 
 // BatchOperation represents a single operation within a batch.
@@ -177,10 +251,161 @@ type BatchResponse struct {
 	Results []any `json:"results"`
 }
 
+// DedupeRequest represents a JSON duplicate-detection request body.
+// Used with POST /data/dedupe/{table}.
+type DedupeRequest struct {
+	Rules []DedupeRule     `json:"rules"`           // All rules must match for two rows to be duplicates
+	Where []map[string]any `json:"where,omitempty"` // Rows to scan
+	Limit *int             `json:"limit,omitempty"` // Rows to scan, capped like a select's limit
+	Merge []DedupeMerge    `json:"merge,omitempty"` // Clusters to merge instead of searching
+}
+
+// DedupeRule compares one column of two rows.
+type DedupeRule struct {
+	Column    string  `json:"column"`
+	Match     string  `json:"match"`               // exact, nocase, similar
+	Threshold float64 `json:"threshold,omitempty"` // Trigram similarity from 0 to 1 for similar (default 0.6)
+}
+
+// DedupeMerge folds duplicate rows into a survivor: rows referencing a
+// duplicate are repointed at the survivor, then the duplicates are deleted.
+type DedupeMerge struct {
+	Survivor   any   `json:"survivor"`   // Primary key of the row kept
+	Duplicates []any `json:"duplicates"` // Primary keys of the rows removed
+}
+
+// DedupeResponse represents the response from a dedupe request.
+type DedupeResponse struct {
+	Clusters  [][]map[string]any `json:"clusters,omitempty"`  // Likely duplicates, each cluster in primary key order
+	Scanned   int                `json:"scanned,omitempty"`   // Rows compared
+	Truncated bool               `json:"truncated,omitempty"` // More rows matched than were scanned
+	Merged    int64              `json:"merged,omitempty"`    // Duplicate rows removed by a merge
+}
+
+// SearchResult is one row found by a search across tables.
+type SearchResult struct {
+	Table   string         `json:"table"`
+	Rank    float64        `json:"rank"`    // bm25 score; lower is a better match
+	Snippet string         `json:"snippet"` // Excerpt of the column that matched best
+	Row     map[string]any `json:"row"`
+}
+
+// SearchResponse represents the response from GET /data/search.
+type SearchResponse struct {
+	Results []SearchResult `json:"results"` // Best match first, across every table
+	Tables  []string       `json:"tables"`  // Tables searched
+}
+
+// SavedQuery is a named select saved on a database, so clients can run it by
+// name. Used with POST /data/queries.
+type SavedQuery struct {
+	Name      string         `json:"name"`
+	Table     string         `json:"table"`
+	Query     SelectQuery    `json:"query"`            // Cursor is not saved; paging is passed when the query runs
+	Params    map[string]any `json:"params,omitempty"` // Defaults of the {"$param": "name"} values in query.where
+	CreatedAt string         `json:"createdAt,omitempty"`
+	UpdatedAt string         `json:"updatedAt,omitempty"`
+}
+
+// RunSavedQueryRequest represents a JSON body running a saved query.
+// Used with POST /data/queries/{name}/run.
+type RunSavedQueryRequest struct {
+	Params map[string]any    `json:"params,omitempty"` // Override the saved defaults
+	Order  map[string]string `json:"order,omitempty"`  // Replaces the saved order
+	Limit  *int              `json:"limit,omitempty"`
+	Offset *int              `json:"offset,omitempty"`
+}
+
+// ReportRequest represents a JSON body scheduling a saved query.
+// Used with POST /data/reports.
+type ReportRequest struct {
+	Query    string `json:"query"`              // Saved query name
+	Cron     string `json:"cron"`               // "30 6 * * 1-5", "@daily"
+	Timezone string `json:"timezone,omitempty"` // IANA zone the cron is read in (default UTC)
+	Format   string `json:"format"`             // csv, ndjson, sqlite
+	Webhook  string `json:"webhook,omitempty"`  // URL each run is POSTed to
+	Email    string `json:"email,omitempty"`    // Address each run is mailed to
+}
+
+// Report is a saved query run on a cron, with the outcome of its last run.
+type Report struct {
+	ID        string     `json:"id"`
+	Query     string     `json:"query"`
+	Cron      string     `json:"cron"`
+	Timezone  string     `json:"timezone"`
+	Format    string     `json:"format"`
+	Webhook   string     `json:"webhook,omitempty"`
+	Email     string     `json:"email,omitempty"`
+	NextRunAt time.Time  `json:"nextRunAt"`
+	CreatedAt time.Time  `json:"createdAt"`
+	LastRun   *ReportRun `json:"lastRun,omitempty"`
+}
+
+// ReportRun is the outcome of one run of a report, as sent to its webhook.
+type ReportRun struct {
+	Report    string     `json:"report"`
+	Query     string     `json:"query"`
+	Database  string     `json:"database"`
+	Status    string     `json:"status"` // done, failed
+	Rows      int64      `json:"rows"`
+	URL       string     `json:"url,omitempty"`       // Signed link to the file
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"` // When the link stops working
+	Error     string     `json:"error,omitempty"`
+	RanAt     time.Time  `json:"ranAt"`
+}
+
+// ExportRequest represents a JSON export request body.
+// Used with POST /data/exports/{table}.
+type ExportRequest struct {
+	Format  string      `json:"format"`            // csv, ndjson, sqlite
+	Query   SelectQuery `json:"query"`             // Rows to export; limit caps the total, offset and cursor are not allowed
+	Nested  string      `json:"nested,omitempty"`  // CSV handling of nested relations: flatten (default) or omit
+	Webhook string      `json:"webhook,omitempty"` // URL the finished job is POSTed to (service key only)
+}
+
+// ExportJob is the state of an export, returned when it starts and by
+// GET /data/exports/{id}.
+type ExportJob struct {
+	ID          string     `json:"id"`
+	Database    string     `json:"database"`
+	Table       string     `json:"table"`
+	Format      string     `json:"format"`
+	Status      string     `json:"status"` // running, done, failed
+	Rows        int64      `json:"rows"`
+	Error       string     `json:"error,omitempty"`
+	URL         string     `json:"url,omitempty"`       // Signed download link, set when done
+	ExpiresAt   *time.Time `json:"expiresAt,omitempty"` // When the link stops working
+	CreatedAt   time.Time  `json:"createdAt"`
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+}
+
+// ChangeEvent is a row written through the Data API, sent to the event
+// streams of its table. Updates and upserts carry the row as written and
+// deletes the row as removed.
+type ChangeEvent struct {
+	ID    string         `json:"id"` // Resume point for Last-Event-ID
+	Table string         `json:"table"`
+	Op    string         `json:"op"` // insert, upsert, update, delete
+	Row   map[string]any `json:"row"`
+}
+
+// WebhookPayload is the body POSTed to a webhook for one Data API write. Rows
+// are the rows as written, or as removed for deletes.
+type WebhookPayload struct {
+	Database string           `json:"database"`
+	Tenant   string           `json:"tenant,omitempty"` // Row tenant of a shared database
+	Table    string           `json:"table"`
+	Event    string           `json:"event"` // insert, upsert, update, delete
+	Rows     []map[string]any `json:"rows"`
+	Time     time.Time        `json:"time"`
+}
+
 // SelectResult holds the result of a Select query with optional count.
 type SelectResult struct {
-	Data  []byte
-	Count int64
+	Data       []byte
+	Count      int64
+	Rows       int64  // Rows in Data
+	NextCursor string // Set for cursor selects that may have more rows
 }
 
 // Prefer header values
@@ -188,5 +413,8 @@ const (
 	PreferOperationSelect   = "operation=select"
 	PreferOnConflictReplace = "on-conflict=replace"
 	PreferOnConflictIgnore  = "on-conflict=ignore"
+	PreferResolutionMerge   = "resolution=merge-duplicates"
+	PreferResolutionIgnore  = "resolution=ignore-duplicates"
 	PreferCountExact        = "count=exact"
+	PreferTxReadOnly        = "tx=read-only"
 )
@@ -0,0 +1,101 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/atombasedev/atombase/primarystore"
+)
+
+// webhookCacheTTL is how long a database's webhook list is reused before it
+// is read from the primary database again, so registrations take effect on
+// every server within it.
+const webhookCacheTTL = 5 * time.Second
+
+// webhookCache holds the webhooks registered on each database, so writes to
+// databases without any don't read the primary database.
+type webhookCache struct {
+	mu      sync.Mutex
+	entries map[string]webhookCacheEntry // Keyed by database ID
+}
+
+type webhookCacheEntry struct {
+	hooks    []primarystore.Webhook
+	loadedAt time.Time
+}
+
+func newWebhookCache() *webhookCache {
+	return &webhookCache{entries: map[string]webhookCacheEntry{}}
+}
+
+// lookup returns a database's webhooks. When they can't be loaded the last
+// known list is used, so a primary database hiccup doesn't fail writes.
+func (c *webhookCache) lookup(ctx context.Context, store *primarystore.Store, databaseID string) []primarystore.Webhook {
+	c.mu.Lock()
+	entry, ok := c.entries[databaseID]
+	c.mu.Unlock()
+	if ok && time.Since(entry.loadedAt) < webhookCacheTTL {
+		return entry.hooks
+	}
+	hooks, err := store.ListWebhooks(ctx, databaseID)
+	if err != nil {
+		log.Printf("failed to load webhooks of database_id=%s: %v", databaseID, err)
+		return entry.hooks
+	}
+	c.mu.Lock()
+	c.entries[databaseID] = webhookCacheEntry{hooks: hooks, loadedAt: time.Now()}
+	c.mu.Unlock()
+	return hooks
+}
+
+// webhooksFor returns the webhooks listening to a kind of write on a table,
+// or to any kind when op is empty.
+func (dao *TenantConnection) webhooksFor(ctx context.Context, table, op string) []primarystore.Webhook {
+	if dao.webhooks == nil || dao.primaryStore == nil {
+		return nil
+	}
+	var matched []primarystore.Webhook
+	for _, hook := range dao.webhooks.lookup(ctx, dao.primaryStore, dao.ID) {
+		if hook.Table != "" && hook.Table != table {
+			continue
+		}
+		if op != "" && !slices.Contains(hook.Events, op) {
+			continue
+		}
+		matched = append(matched, hook)
+	}
+	return matched
+}
+
+// enqueueWebhooks queues a delivery of written rows for every webhook
+// listening to the write. The write has already committed, so a delivery
+// that can't be queued is logged rather than failing the request.
+func (dao *TenantConnection) enqueueWebhooks(ctx context.Context, table, op string, rows []map[string]any) {
+	hooks := dao.webhooksFor(ctx, table, op)
+	if len(hooks) == 0 {
+		return
+	}
+	payload, err := json.Marshal(WebhookPayload{
+		Database: dao.ID,
+		Tenant:   dao.RowTenant,
+		Table:    table,
+		Event:    op,
+		Rows:     rows,
+		Time:     time.Now().UTC(),
+	})
+	if err != nil {
+		log.Printf("failed to encode webhook payload for database_id=%s table=%s: %v", dao.ID, table, err)
+		return
+	}
+	// Queue even if the request was canceled after its write committed.
+	ctx = context.WithoutCancel(ctx)
+	for _, hook := range hooks {
+		if err := dao.primaryStore.EnqueueWebhookDelivery(ctx, hook.ID, op, table, payload); err != nil {
+			log.Printf("failed to queue webhook %s delivery for database_id=%s: %v", hook.ID, dao.ID, err)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"testing"
+
+	"github.com/atombasedev/atombase/primarystore"
+)
+
+const primaryWebhookSchema = `
+CREATE TABLE atombase_webhooks (
+	id TEXT PRIMARY KEY,
+	database_id TEXT NOT NULL,
+	table_name TEXT NOT NULL DEFAULT '',
+	events_json TEXT NOT NULL
+);
+CREATE TABLE atombase_webhook_deliveries (
+	id INTEGER PRIMARY KEY,
+	webhook_id TEXT NOT NULL,
+	event TEXT NOT NULL,
+	table_name TEXT NOT NULL,
+	payload TEXT NOT NULL,
+	next_attempt_at TEXT NOT NULL,
+	created_at TEXT NOT NULL
+);
+INSERT INTO atombase_webhooks (id, database_id, table_name, events_json) VALUES
+	('whk_users', 'db', 'users', '["insert","delete"]'),
+	('whk_other', 'other-db', '', '["insert"]');
+`
+
+func TestWebhooks_QueueWrites(t *testing.T) {
+	primaryDB, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer primaryDB.Close()
+	primaryDB.SetMaxOpenConns(1)
+	if _, err := primaryDB.Exec(primaryWebhookSchema); err != nil {
+		t.Fatal(err)
+	}
+	store, err := primarystore.New(primaryDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := setupTestDB(t, schemaUsers)
+	defer db.Close()
+	dao := &TenantConnection{Client: db, Schema: loadSchema(t, db), ID: "db", primaryStore: store, webhooks: newWebhookCache()}
+	ctx := context.Background()
+
+	if _, err := dao.InsertJSON(ctx, "users", InsertRequest{Data: []map[string]any{{"name": "Alice"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dao.UpdateJSON(ctx, "users", UpdateRequest{
+		Data:  map[string]any{"age": 31},
+		Where: []map[string]any{{"name": map[string]any{OpEq: "Alice"}}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dao.Batch(ctx, BatchRequest{Operations: []BatchOperation{{
+		Operation: "delete",
+		Table:     "users",
+		Body:      map[string]any{"where": []any{map[string]any{"name": map[string]any{OpEq: "Alice"}}}},
+	}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := primaryDB.Query(`SELECT webhook_id, event, payload FROM atombase_webhook_deliveries ORDER BY id`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var events []string
+	var last WebhookPayload
+	for rows.Next() {
+		var hook, event, payload string
+		if err := rows.Scan(&hook, &event, &payload); err != nil {
+			t.Fatal(err)
+		}
+		if hook != "whk_users" {
+			t.Fatalf("unexpected delivery for %s", hook)
+		}
+		events = append(events, event)
+		if err := json.Unmarshal([]byte(payload), &last); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(events) != 2 || events[0] != ChangeInsert || events[1] != ChangeDelete {
+		t.Fatalf("expected insert and delete deliveries, got %v", events)
+	}
+	if last.Database != "db" || last.Table != "users" || len(last.Rows) != 1 || last.Rows[0]["age"] != float64(31) {
+		t.Fatalf("unexpected delete payload: %+v", last)
+	}
+}
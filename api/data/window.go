@@ -0,0 +1,241 @@
+package data
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/atombasedev/atombase/tools"
+)
+
+// MaxWindowFields limits the window functions one select may compute.
+const MaxWindowFields = 8
+
+// windowRanking are the window functions that take no arguments.
+var windowRanking = map[string]bool{
+	"row_number": true, "rank": true, "dense_rank": true, "percent_rank": true, "cume_dist": true,
+}
+
+// windowAggregates are the aggregates that may run over a window on one column.
+var windowAggregates = map[string]bool{
+	"sum": true, "total": true, "avg": true, "min": true, "max": true, "count": true,
+	"first_value": true, "last_value": true,
+}
+
+// isWindowSelect reports whether a select item is a window expression rather
+// than a column. Column names and JSON paths never hold parentheses.
+func isWindowSelect(item string) bool {
+	return strings.Contains(item, "(")
+}
+
+// compileWindows moves the window expressions of the root relation's select
+// into its computed fields, e.g. {"rank": "row_number() over(partition:category, order:price.desc)"}.
+// An item without an alias is named after its function.
+func compileWindows(table CacheTable, rel *Relation) error {
+	if err := rejectNestedWindows(rel.joins); err != nil {
+		return err
+	}
+	columns := rel.columns[:0:0]
+	var windows []computedColumn
+	for _, col := range rel.columns {
+		if !isWindowSelect(col.name) {
+			columns = append(columns, col)
+			continue
+		}
+		if len(windows) == MaxWindowFields {
+			return tools.InvalidRequestErr(fmt.Sprintf("at most %d window functions are allowed", MaxWindowFields))
+		}
+		sql, fn, err := compileWindowExpr(table, col.name)
+		if err != nil {
+			return tools.InvalidRequestErr(fmt.Sprintf("window %q: %v", col.name, err))
+		}
+		name := col.alias
+		if name == "" {
+			name = fn
+		}
+		if err := tools.ValidateIdentifier(name); err != nil {
+			return tools.InvalidRequestErr(fmt.Sprintf("window field %q: %v", name, err))
+		}
+		if _, ok := table.Columns[name]; ok || strings.HasPrefix(name, "__ab_") {
+			return tools.InvalidRequestErr(fmt.Sprintf("window field %q conflicts with a column", name))
+		}
+		for _, other := range append(rel.computed, windows...) {
+			if other.name == name {
+				return tools.InvalidRequestErr(fmt.Sprintf("window field %q is selected twice; give it an alias", name))
+			}
+		}
+		windows = append(windows, computedColumn{name: name, sql: sql})
+	}
+	if windows == nil {
+		return nil
+	}
+	rel.columns = columns
+	rel.computed = append(rel.computed, windows...)
+	return nil
+}
+
+func rejectNestedWindows(joins []*Relation) error {
+	for _, join := range joins {
+		for _, col := range join.columns {
+			if isWindowSelect(col.name) {
+				return tools.InvalidRequestErr(fmt.Sprintf("window %q: window functions are only allowed on the root table", col.name))
+			}
+		}
+		if err := rejectNestedWindows(join.joins); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compileWindowExpr parses fn(args) over(partition:col, order:col.desc, ...)
+// and returns it as SQL along with the function name. partition and order may
+// repeat, and order defaults to ascending. Only parsed names are written
+// back, so nothing from the request reaches SQL verbatim.
+func compileWindowExpr(table CacheTable, expr string) (string, string, error) {
+	if len(expr) > MaxComputedExprLength {
+		return "", "", fmt.Errorf("expression is longer than %d characters", MaxComputedExprLength)
+	}
+	fn, rest, ok := strings.Cut(strings.TrimSpace(expr), "(")
+	fn = strings.ToLower(strings.TrimSpace(fn))
+	if !ok || fn == "" {
+		return "", "", fmt.Errorf("expected fn(args) over(...)")
+	}
+	rawArgs, rest, ok := strings.Cut(rest, ")")
+	if !ok {
+		return "", "", fmt.Errorf("missing ) after the arguments of %s", fn)
+	}
+	over, ok := cutPrefixFold(strings.TrimSpace(rest), "over")
+	over = strings.TrimSpace(over)
+	if !ok || !strings.HasPrefix(over, "(") || !strings.HasSuffix(over, ")") {
+		return "", "", fmt.Errorf("%s must be followed by over(...)", fn)
+	}
+
+	args, err := table.windowArgs(fn, splitWindowList(rawArgs))
+	if err != nil {
+		return "", "", err
+	}
+	var partition, order []string
+	for _, clause := range splitWindowList(over[1 : len(over)-1]) {
+		kind, col, ok := strings.Cut(clause, ":")
+		switch kind = strings.ToLower(strings.TrimSpace(kind)); {
+		case !ok:
+			return "", "", fmt.Errorf("over clause %q must be partition:column or order:column", clause)
+		case kind == "partition":
+			name, err := table.windowColumn(strings.TrimSpace(col))
+			if err != nil {
+				return "", "", err
+			}
+			partition = append(partition, name)
+		case kind == "order":
+			name, dir, _ := strings.Cut(strings.TrimSpace(col), ".")
+			sqlDir := "ASC"
+			switch strings.ToLower(dir) {
+			case "", "asc":
+			case "desc":
+				sqlDir = "DESC"
+			default:
+				return "", "", fmt.Errorf("invalid order direction: %s", dir)
+			}
+			if name, err = table.windowColumn(name); err != nil {
+				return "", "", err
+			}
+			order = append(order, name+" "+sqlDir)
+		default:
+			return "", "", fmt.Errorf("over clause %q must be partition:column or order:column", clause)
+		}
+	}
+
+	var spec []string
+	if len(partition) > 0 {
+		spec = append(spec, "PARTITION BY "+strings.Join(partition, ", "))
+	}
+	if len(order) > 0 {
+		spec = append(spec, "ORDER BY "+strings.Join(order, ", "))
+	}
+	return fmt.Sprintf("%s(%s) OVER (%s)", fn, strings.Join(args, ", "), strings.Join(spec, " ")), fn, nil
+}
+
+// windowArgs checks the arguments of an allowlisted window function and
+// returns them as SQL.
+func (table CacheTable) windowArgs(fn string, args []string) ([]string, error) {
+	switch {
+	case windowRanking[fn]:
+		if len(args) != 0 {
+			return nil, fmt.Errorf("%s takes no arguments", fn)
+		}
+		return nil, nil
+	case fn == "ntile":
+		if len(args) != 1 {
+			return nil, fmt.Errorf("ntile takes the number of buckets")
+		}
+		n, err := windowCount(args[0], 1)
+		if err != nil {
+			return nil, err
+		}
+		return []string{n}, nil
+	case fn == "lag" || fn == "lead":
+		if len(args) != 1 && len(args) != 2 {
+			return nil, fmt.Errorf("%s takes a column and an optional offset", fn)
+		}
+		col, err := table.windowColumn(args[0])
+		if err != nil {
+			return nil, err
+		}
+		if len(args) == 1 {
+			return []string{col}, nil
+		}
+		offset, err := windowCount(args[1], 0)
+		if err != nil {
+			return nil, err
+		}
+		return []string{col, offset}, nil
+	case fn == "count" && (len(args) == 0 || len(args) == 1 && args[0] == "*"):
+		return []string{"*"}, nil
+	case windowAggregates[fn]:
+		if len(args) != 1 {
+			return nil, fmt.Errorf("%s takes one column", fn)
+		}
+		col, err := table.windowColumn(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return []string{col}, nil
+	}
+	return nil, fmt.Errorf("window function %s is not allowed", fn)
+}
+
+func (table CacheTable) windowColumn(name string) (string, error) {
+	if _, err := table.SearchCols(name); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("[%s].[%s]", table.Name, name), nil
+}
+
+// windowCount reads an integer argument of at least min.
+func windowCount(arg string, min int) (string, error) {
+	n, err := strconv.Atoi(arg)
+	if err != nil || n < min {
+		return "", fmt.Errorf("%q must be an integer of at least %d", arg, min)
+	}
+	return strconv.Itoa(n), nil
+}
+
+// splitWindowList splits a comma separated list, trimming each item.
+func splitWindowList(list string) []string {
+	if strings.TrimSpace(list) == "" {
+		return nil
+	}
+	items := strings.Split(list, ",")
+	for i := range items {
+		items[i] = strings.TrimSpace(items[i])
+	}
+	return items
+}
+
+func cutPrefixFold(s, prefix string) (string, bool) {
+	if len(s) < len(prefix) || !strings.EqualFold(s[:len(prefix)], prefix) {
+		return s, false
+	}
+	return s[len(prefix):], true
+}
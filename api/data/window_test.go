@@ -0,0 +1,92 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestCompileWindowExpr(t *testing.T) {
+	table := CacheTable{Name: "products", Columns: map[string]string{"category": "TEXT", "price": "REAL", "created_at": "TEXT"}}
+
+	tests := []struct {
+		expr, want string
+		wantErr    bool
+	}{
+		{"row_number() over(partition:category, order:price.desc)", "row_number() OVER (PARTITION BY [products].[category] ORDER BY [products].[price] DESC)", false},
+		{"SUM(price) OVER (order:created_at)", "sum([products].[price]) OVER (ORDER BY [products].[created_at] ASC)", false},
+		{"rank() over()", "rank() OVER ()", false},
+		{"ntile(4) over(order:price)", "ntile(4) OVER (ORDER BY [products].[price] ASC)", false},
+		{"lag(price, 2) over(partition:category, partition:created_at)", "lag([products].[price], 2) OVER (PARTITION BY [products].[category], [products].[created_at])", false},
+		{"count(*) over(partition:category)", "count(*) OVER (PARTITION BY [products].[category])", false},
+		{"row_number()", "", true},
+		{"row_number(price) over()", "", true},
+		{"ntile(0) over()", "", true},
+		{"sum(missing) over()", "", true},
+		{"sum(price) over(order:price.sideways)", "", true},
+		{"sum(price) over(group:category)", "", true},
+		{"load_extension('x') over()", "", true},
+		{"sum(price) over(order:price) FROM products --", "", true},
+		{"sum(price) over(order:[price])", "", true},
+	}
+	for _, tt := range tests {
+		got, _, err := compileWindowExpr(table, tt.expr)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %q", tt.expr, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%q: got %q, %v; want %q", tt.expr, got, err, tt.want)
+		}
+	}
+}
+
+func TestSelectJSON_Window(t *testing.T) {
+	db := setupTestDB(t, `CREATE TABLE products (id INTEGER PRIMARY KEY, category TEXT, price REAL);`)
+	if _, err := db.Exec(`INSERT INTO products (id, category, price) VALUES
+		(1, 'tea', 4), (2, 'tea', 9), (3, 'coffee', 7), (4, 'tea', 6), (5, 'coffee', 3)`); err != nil {
+		t.Fatal(err)
+	}
+	dao := &TenantConnection{Client: db, Schema: loadSchema(t, db)}
+	ctx := context.Background()
+	limit := 4
+
+	result, err := dao.SelectJSON(ctx, "products", SelectQuery{
+		Select: []any{"id",
+			"row_number() over(partition:category, order:price.desc)",
+			map[string]any{"running": "sum(price) over(order:id)"},
+		},
+		Order: map[string]string{"id": "asc"},
+		Limit: &limit,
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rows []map[string]any
+	if err := json.Unmarshal(result.Data, &rows); err != nil {
+		t.Fatal(err)
+	}
+	wantRank := []float64{3, 1, 1, 2}
+	wantRunning := []float64{4, 13, 20, 26}
+	if len(rows) != len(wantRank) {
+		t.Fatalf("got %v", rows)
+	}
+	for i, row := range rows {
+		if row["row_number"] != wantRank[i] || row["running"] != wantRunning[i] {
+			t.Errorf("row %d: got %v, want row_number %v and running %v", i, row, wantRank[i], wantRunning[i])
+		}
+	}
+
+	for name, sel := range map[string][]any{
+		"column name":   {map[string]any{"price": "rank() over(order:price)"}},
+		"same name":     {"rank() over(order:price)", "rank() over(order:id)"},
+		"unknown":       {"median(price) over()"},
+		"nested window": {"id", map[string]any{"products": []any{"rank() over(order:price)"}}},
+	} {
+		if _, err := dao.SelectJSON(ctx, "products", SelectQuery{Select: sel}, false); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -162,6 +162,10 @@ func compileAuthLeaf(fieldName, op string, raw any, input CompileInput) (string,
 		}
 		return "EXISTS (SELECT 1 FROM __ab_membership m WHERE m.user_id = ? AND m.role " + sqlOperator(op) + " ?)", []any{input.Principal.UserID, resolveValue(raw, input)}, true, true, nil
 	default:
+		if name, ok := strings.CutPrefix(fieldName, "claims."); ok && name != "" {
+			ok, err := compareValues(input.Principal.Claims[name], op, resolveValue(raw, input))
+			return "", nil, ok, false, err
+		}
 		return "", nil, false, false, fmt.Errorf("unsupported auth field %q", fieldName)
 	}
 }
@@ -252,6 +256,9 @@ func resolveValue(raw any, input CompileInput) any {
 	case "auth.status":
 		return string(input.Principal.AuthStatus)
 	default:
+		if name, ok := strings.CutPrefix(ref, "auth.claims."); ok {
+			return input.Principal.Claims[name]
+		}
 		if strings.HasPrefix(ref, "new.") && input.NewValues != nil {
 			return input.NewValues[strings.TrimPrefix(ref, "new.")]
 		}
@@ -99,3 +99,28 @@ func TestEvaluateProvision_UsesPrimaryAuthContext(t *testing.T) {
 		t.Fatal("expected service subject to bypass provisioning rules")
 	}
 }
+
+func TestCompiler_AuthClaims(t *testing.T) {
+	compiler := NewCompiler()
+	input := CompileInput{
+		Principal: Principal{UserID: "user-1", AuthStatus: AuthStatusAuthenticated, Claims: map[string]any{"plan": "pro", "team": "t-9"}},
+		Target:    DatabaseTarget{DefinitionType: DefinitionTypeGlobal},
+		Table:     "projects",
+		Operation: "select",
+	}
+
+	if _, err := compiler.Compile(&AccessPolicy{Condition: &Condition{Field: "auth.claims.plan", Op: "eq", Value: "pro"}}, input); err != nil {
+		t.Fatalf("matching claim rejected: %v", err)
+	}
+	if _, err := compiler.Compile(&AccessPolicy{Condition: &Condition{Field: "auth.claims.plan", Op: "eq", Value: "free"}}, input); err == nil {
+		t.Fatal("expected a non-matching claim to be rejected")
+	}
+
+	predicate, err := compiler.Compile(&AccessPolicy{Condition: &Condition{Field: "old.team_id", Op: "eq", Value: "auth.claims.team"}}, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if predicate.SQL != "[team_id] = ?" || len(predicate.Args) != 1 || predicate.Args[0] != "t-9" {
+		t.Fatalf("predicate = %q %v", predicate.SQL, predicate.Args)
+	}
+}
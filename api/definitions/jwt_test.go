@@ -0,0 +1,59 @@
+package definitions
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/atombasedev/atombase/tools"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func hs256Token(secret, header, claims string) string {
+	signed := base64.RawURLEncoding.EncodeToString([]byte(header)) + "." + base64.RawURLEncoding.EncodeToString([]byte(claims))
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestValidateJWT(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	secret := strings.Repeat("k", tools.MinJWTSecretLength)
+	if _, err := db.Exec(`
+		CREATE TABLE atombase_jwt_keys (id TEXT PRIMARY KEY, database_id TEXT NOT NULL, algorithm TEXT NOT NULL, key_encrypted BLOB NOT NULL);
+		INSERT INTO atombase_jwt_keys VALUES ('kid-1', 'db-1', 'HS256', ?);
+	`, []byte(secret)); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	now := time.Now()
+
+	principal, err := validateJWT(ctx, db, hs256Token(secret, `{"alg":"HS256","kid":"kid-1"}`, `{"sub":"app-user","role":"editor"}`), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if principal.UserID != "app-user" || principal.TokenDatabase != "db-1" || principal.Claims["role"] != "editor" || principal.AuthStatus != AuthStatusAuthenticated {
+		t.Fatalf("principal = %+v", principal)
+	}
+
+	for name, token := range map[string]string{
+		"unknown kid": hs256Token(secret, `{"alg":"HS256","kid":"kid-2"}`, `{"sub":"app-user"}`),
+		"no kid":      hs256Token(secret, `{"alg":"HS256"}`, `{"sub":"app-user"}`),
+		"no sub":      hs256Token(secret, `{"alg":"HS256","kid":"kid-1"}`, `{"role":"editor"}`),
+		"bad secret":  hs256Token(strings.Repeat("x", tools.MinJWTSecretLength), `{"alg":"HS256","kid":"kid-1"}`, `{"sub":"app-user"}`),
+	} {
+		if _, err := validateJWT(ctx, db, token, now); !errors.Is(err, tools.ErrUnauthorized) {
+			t.Errorf("%s: expected unauthorized, got %v", name, err)
+		}
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"regexp"
 	"strings"
 	"time"
 
@@ -32,10 +33,15 @@ func NewService(store Store) *Service {
 func (s *Service) ResolvePrincipal(ctx context.Context, authCtx tools.AuthContext) (Principal, error) {
 	switch authCtx.Role {
 	case tools.RoleService:
-		return Principal{
+		principal := Principal{
 			AuthStatus: AuthStatusAuthenticated,
 			IsService:  true,
-		}, nil
+		}
+		if authCtx.Scope != nil {
+			principal.KeyScope = authCtx.Scope
+			principal.TokenDatabase = authCtx.Scope.Database
+		}
+		return principal, nil
 	case tools.RoleAnonymous:
 		return Principal{AuthStatus: AuthStatusAnonymous}, nil
 	case tools.RoleUser:
@@ -46,16 +52,77 @@ func (s *Service) ResolvePrincipal(ctx context.Context, authCtx tools.AuthContex
 		if err != nil {
 			return Principal{}, tools.UnauthorizedErr("invalid session")
 		}
+		if err := tools.IdentifyCaller(ctx, "user:"+session.UserID); err != nil {
+			return Principal{}, err
+		}
 		return Principal{
 			UserID:     session.UserID,
 			SessionID:  session.ID,
 			AuthStatus: AuthStatusAuthenticated,
 		}, nil
+	case tools.RoleJWT:
+		if s == nil || s.store == nil || s.store.DB() == nil {
+			return Principal{}, errors.New("primary store not initialized")
+		}
+		principal, err := validateJWT(ctx, s.store.DB(), authCtx.Token, time.Now())
+		if err != nil {
+			return Principal{}, err
+		}
+		// JWT subjects are the app's user IDs, unique only within the database.
+		if err := tools.IdentifyCaller(ctx, "jwt:"+principal.TokenDatabase+":"+principal.UserID); err != nil {
+			return Principal{}, err
+		}
+		return principal, nil
 	default:
 		return Principal{}, tools.UnauthorizedErr("unsupported auth role")
 	}
 }
 
+// validateJWT verifies a token against the signing key its kid names. The sub
+// claim becomes the user ID, and the key's database the only one the token
+// can reach.
+func validateJWT(ctx context.Context, db *sql.DB, token string, now time.Time) (Principal, error) {
+	header, err := tools.ParseJWTHeader(token)
+	if err != nil {
+		return Principal{}, err
+	}
+	if header.Kid == "" {
+		return Principal{}, tools.UnauthorizedErr("token has no kid header")
+	}
+	var databaseID, alg string
+	var stored []byte
+	err = db.QueryRowContext(ctx, `
+		SELECT database_id, algorithm, key_encrypted FROM atombase_jwt_keys WHERE id = ?
+	`, header.Kid).Scan(&databaseID, &alg, &stored)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Principal{}, tools.UnauthorizedErr("unknown token signing key")
+	}
+	if err != nil {
+		return Principal{}, err
+	}
+	key := stored
+	if tools.EncryptionEnabled() {
+		if key, err = tools.Decrypt(stored); err != nil {
+			return Principal{}, fmt.Errorf("failed to decrypt signing key: %w", err)
+		}
+	}
+
+	claims, err := tools.VerifyJWT(token, alg, key, now)
+	if err != nil {
+		return Principal{}, err
+	}
+	sub, _ := claims["sub"].(string)
+	if sub == "" {
+		return Principal{}, tools.UnauthorizedErr("token has no sub claim")
+	}
+	return Principal{
+		UserID:        sub,
+		AuthStatus:    AuthStatusAuthenticated,
+		Claims:        claims,
+		TokenDatabase: databaseID,
+	}, nil
+}
+
 type sessionRecord struct {
 	ID        string
 	UserID    string
@@ -128,10 +195,36 @@ func (s *Service) CompilePolicy(ctx context.Context, principal Principal, target
 	})
 }
 
+// StorageAccessPrefix marks an access map entry for a storage bucket rather
+// than a table, e.g. "storage:avatars". A bucket without an entry is only
+// reachable with the service key.
+const StorageAccessPrefix = "storage:"
+
+var storageBucketPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+// StorageAccessTable is the access map key of bucket's policies.
+func StorageAccessTable(bucket string) string {
+	return StorageAccessPrefix + bucket
+}
+
+// IsStorageAccess reports whether an access map key is a bucket's.
+func IsStorageAccess(table string) bool {
+	return strings.HasPrefix(table, StorageAccessPrefix)
+}
+
 func ParseAndValidateAccess(defType DefinitionType, raw AccessMap, schemaTables map[string]struct{}) ([]AccessPolicy, error) {
 	var rows []AccessPolicy
 	for table, ops := range raw {
-		if _, ok := schemaTables[table]; !ok {
+		storage := false
+		if bucket, ok := strings.CutPrefix(table, StorageAccessPrefix); ok {
+			if !storageBucketPattern.MatchString(bucket) {
+				return nil, fmt.Errorf("access policy references invalid bucket %q", bucket)
+			}
+			if ops.Update != nil {
+				return nil, fmt.Errorf("access policy %q: storage objects have no update policy", table)
+			}
+			storage = true
+		} else if _, ok := schemaTables[table]; !ok {
 			return nil, fmt.Errorf("access policy references unknown table %q", table)
 		}
 		for _, item := range []struct {
@@ -149,6 +242,11 @@ func ParseAndValidateAccess(defType DefinitionType, raw AccessMap, schemaTables
 			if err := ValidateConditionContext(*item.cond, item.op, defType); err != nil {
 				return nil, err
 			}
+			if storage {
+				if err := validateStorageCondition(*item.cond); err != nil {
+					return nil, fmt.Errorf("access policy %q: %w", table, err)
+				}
+			}
 			cond := *item.cond
 			rows = append(rows, AccessPolicy{
 				Table:     table,
@@ -234,6 +332,34 @@ func ParseAndValidateProvision(defType DefinitionType, raw *Condition) (*Provisi
 	return &ProvisionPolicy{Condition: &cond}, nil
 }
 
+func ParseAndValidateTests(raw []TestCase) ([]TestCase, error) {
+	seen := make(map[string]struct{}, len(raw))
+	tests := make([]TestCase, 0, len(raw))
+	for _, test := range raw {
+		if strings.TrimSpace(test.Name) == "" {
+			return nil, fmt.Errorf("test name is required")
+		}
+		if _, ok := seen[test.Name]; ok {
+			return nil, fmt.Errorf("duplicate test %q", test.Name)
+		}
+		seen[test.Name] = struct{}{}
+		query := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(test.Query), ";"))
+		if query == "" {
+			return nil, fmt.Errorf("test %q has no query", test.Name)
+		}
+		keyword := strings.ToUpper(strings.Fields(query)[0])
+		if keyword != "SELECT" && keyword != "WITH" {
+			return nil, fmt.Errorf("test %q must be a SELECT query", test.Name)
+		}
+		if strings.Contains(query, ";") {
+			return nil, fmt.Errorf("test %q must be a single statement", test.Name)
+		}
+		test.Query = query
+		tests = append(tests, test)
+	}
+	return tests, nil
+}
+
 func ValidateConditionContext(cond Condition, op string, defType DefinitionType) error {
 	if cond.Field != "" {
 		if strings.HasPrefix(cond.Field, "old.") && op == "insert" {
@@ -263,6 +389,31 @@ func ValidateConditionContext(cond Condition, op string, defType DefinitionType)
 	return nil
 }
 
+// validateStorageCondition checks that a bucket policy only tests the caller.
+// Objects have no row to compare against, so old.* and new.* can't be used.
+func validateStorageCondition(cond Condition) error {
+	if cond.Field != "" {
+		if scope, _, err := splitScopedRef(cond.Field); err != nil {
+			return err
+		} else if scope != "auth" {
+			return fmt.Errorf("storage policies only support auth.* fields, got %q", cond.Field)
+		}
+		if ref, ok := cond.Value.(string); ok && (strings.HasPrefix(ref, "old.") || strings.HasPrefix(ref, "new.")) {
+			return fmt.Errorf("storage policies only support auth.* values, got %q", ref)
+		}
+		return nil
+	}
+	for _, child := range append(append([]Condition{}, cond.And...), cond.Or...) {
+		if err := validateStorageCondition(child); err != nil {
+			return err
+		}
+	}
+	if cond.Not != nil {
+		return validateStorageCondition(*cond.Not)
+	}
+	return nil
+}
+
 func ValidateProvisionCondition(cond Condition) error {
 	if cond.Field != "" {
 		scope, fieldName, err := splitScopedRef(cond.Field)
@@ -0,0 +1,44 @@
+package definitions
+
+import (
+	"context"
+	"testing"
+
+	"github.com/atombasedev/atombase/tools"
+)
+
+func TestParseAndValidateTests(t *testing.T) {
+	tests, err := ParseAndValidateTests([]TestCase{
+		{Name: "no orphans", Query: "  SELECT id FROM posts WHERE author_id IS NULL; "},
+		{Name: "count", Query: "WITH t AS (SELECT 1 AS n) SELECT n FROM t", Expect: []map[string]any{{"n": 1}}},
+	})
+	if err != nil {
+		t.Fatalf("ParseAndValidateTests failed: %v", err)
+	}
+	if tests[0].Query != "SELECT id FROM posts WHERE author_id IS NULL" {
+		t.Fatalf("expected query to be trimmed, got %q", tests[0].Query)
+	}
+
+	invalid := [][]TestCase{
+		{{Query: "SELECT 1"}},
+		{{Name: "a", Query: "SELECT 1"}, {Name: "a", Query: "SELECT 2"}},
+		{{Name: "write", Query: "DELETE FROM posts"}},
+		{{Name: "multi", Query: "SELECT 1; DROP TABLE posts"}},
+	}
+	for _, raw := range invalid {
+		if _, err := ParseAndValidateTests(raw); err == nil {
+			t.Fatalf("expected %+v to be rejected", raw)
+		}
+	}
+}
+
+func TestResolvePrincipal_ScopedAPIKey(t *testing.T) {
+	scope := &tools.APIKeyScope{KeyID: "key_1", Database: "db-1", Verbs: []string{tools.VerbRead}}
+	principal, err := NewService(nil).ResolvePrincipal(context.Background(), tools.AuthContext{Role: tools.RoleService, Scope: scope})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !principal.IsService || principal.KeyScope != scope || principal.TokenDatabase != "db-1" {
+		t.Fatalf("unexpected principal %+v", principal)
+	}
+}
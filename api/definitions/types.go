@@ -1,6 +1,10 @@
 package definitions
 
-import "encoding/json"
+import (
+	"encoding/json"
+
+	"github.com/atombasedev/atombase/tools"
+)
 
 type DefinitionType string
 
@@ -22,6 +26,13 @@ type Principal struct {
 	SessionID  string
 	AuthStatus AuthStatus
 	IsService  bool
+	// Set for JWT callers: the token's claims, readable in policies as
+	// auth.claims.<name>, and the database whose key signed it, the only one
+	// the token can reach. A database-scoped API key sets TokenDatabase too.
+	Claims        map[string]any
+	TokenDatabase string
+	// KeyScope limits a service caller that used a scoped API key.
+	KeyScope *tools.APIKeyScope
 }
 
 type DatabaseTarget struct {
@@ -31,6 +42,8 @@ type DatabaseTarget struct {
 	DefinitionType    DefinitionType
 	DefinitionVersion int
 	AuthToken         string
+	RowTenant         string // User whose rows are served from a shared database, empty for dedicated databases
+	WritesPaused      bool   // The user is being moved between databases and may only read
 }
 
 type Condition struct {
@@ -55,6 +68,14 @@ type AccessPolicy struct {
 	Condition    *Condition
 }
 
+// TestCase is a read-only query bundled with a definition version that must hold
+// after every tenant migration. Without Expect the query must return no rows.
+type TestCase struct {
+	Name   string           `json:"name"`
+	Query  string           `json:"query"`
+	Expect []map[string]any `json:"expect,omitempty"`
+}
+
 type ProvisionPolicy struct {
 	DefinitionID int32
 	Version      int
@@ -166,6 +187,7 @@ type Definition struct {
 	Management     ManagementMap   `json:"management,omitempty"`
 	Provision      *Condition      `json:"provision,omitempty"`
 	CurrentVersion int             `json:"currentVersion"`
+	Org            string          `json:"org,omitempty"` // Platform organization that owns it
 	CreatedAt      string          `json:"createdAt"`
 	UpdatedAt      string          `json:"updatedAt"`
 	Schema         json.RawMessage `json:"schema,omitempty"`
@@ -223,3 +245,8 @@ type CompiledPredicate struct {
 	GoAllowed          bool
 	NeedsMembershipCTE bool
 }
+
+// RollupSeconds is the length of each time-series rollup resolution's
+// interval, shared by the definitions that declare rollups and the Data API
+// that refreshes them.
+var RollupSeconds = map[string]int64{"minute": 60, "hour": 3600, "day": 86400}
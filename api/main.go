@@ -3,7 +3,6 @@ package main
 import (
 	"context"
 	"database/sql"
-	_ "embed"
 	"fmt"
 	"log"
 	"net/http"
@@ -12,19 +11,13 @@ import (
 	"syscall"
 	"time"
 
-	"github.com/atombasedev/atombase/auth"
 	"github.com/atombasedev/atombase/config"
-	"github.com/atombasedev/atombase/data"
-	"github.com/atombasedev/atombase/platform"
-	"github.com/atombasedev/atombase/primarystore"
+	"github.com/atombasedev/atombase/server"
 	"github.com/atombasedev/atombase/tools"
 	_ "github.com/mattn/go-sqlite3"
 	_ "github.com/tursodatabase/libsql-client-go/libsql"
 )
 
-//go:embed schema.sql
-var primarySchemaSQL string
-
 const primaryDBPragmas = `
 PRAGMA journal_mode = WAL;
 PRAGMA synchronous = NORMAL;
@@ -72,7 +65,7 @@ func initPrimaryDBTurso() (*sql.DB, error) {
 
 	// Initialize schema only if INIT_SCHEMA=true (skip for fast cold starts)
 	if config.Cfg.InitSchema {
-		if _, err := conn.Exec(primarySchemaSQL); err != nil {
+		if _, err := conn.Exec(server.SchemaSQL); err != nil {
 			_ = conn.Close()
 			return nil, fmt.Errorf("failed to initialize schema: %w", err)
 		}
@@ -103,7 +96,7 @@ func initPrimaryDBLocal() (*sql.DB, error) {
 
 	// Initialize schema only if INIT_SCHEMA=true (skip for fast cold starts)
 	if config.Cfg.InitSchema {
-		if _, err := conn.Exec(primarySchemaSQL); err != nil {
+		if _, err := conn.Exec(server.SchemaSQL); err != nil {
 			_ = conn.Close()
 			return nil, err
 		}
@@ -145,6 +138,28 @@ func logStartupInfo() {
 		fmt.Println("[INFO] Activity logging disabled")
 	}
 
+	if tools.FaultInjectionEnabled {
+		fmt.Println("[WARN] Built with fault injection - not for production")
+		warnings++
+	}
+
+	if config.Cfg.DebugEndpoints {
+		fmt.Println("[INFO] Debug endpoints enabled under /platform/debug/")
+	}
+
+	if config.Cfg.TursoCassetteMode != "" {
+		fmt.Printf("[WARN] Turso cassette in %s mode: %s - not for production\n", config.Cfg.TursoCassetteMode, config.Cfg.TursoCassette)
+		warnings++
+	}
+
+	if config.Cfg.SentryDSN != "" {
+		fmt.Println("[OK]   Error reporting enabled")
+	}
+
+	if config.Cfg.LogShipSink != "" {
+		fmt.Printf("[OK]   Log shipping: %s\n", config.Cfg.LogShipSink)
+	}
+
 	if warnings > 0 {
 		fmt.Printf("\n[!] %d security warning(s) - review before production\n", warnings)
 	}
@@ -160,6 +175,21 @@ func main() {
 		log.Fatalf("Failed to initialize activity logger: %v", err)
 	}
 
+	// Start forwarding activity and audit logs to an external sink if configured
+	if err := tools.InitLogShipper(); err != nil {
+		log.Fatalf("Failed to initialize log shipping: %v", err)
+	}
+
+	// Report panics and internal errors if a Sentry DSN is configured
+	if err := tools.InitErrorReporting(); err != nil {
+		log.Fatalf("Failed to initialize error reporting: %v", err)
+	}
+
+	// Record or replay Turso API calls if a cassette is configured
+	if err := tools.InitTursoCassette(); err != nil {
+		log.Fatalf("Failed to initialize turso cassette: %v", err)
+	}
+
 	// Initialize encryption for database tokens
 	if err := tools.InitEncryption(config.Cfg.TokenEncryptionKey); err != nil {
 		log.Fatalf("Failed to initialize encryption: %v", err)
@@ -199,58 +229,21 @@ func main() {
 		log.Fatalf("Failed to initialize primary database: %v", err)
 	}
 
-	primaryStore, err := primarystore.New(primaryDB)
-	if err != nil {
-		_ = primaryDB.Close()
-		log.Fatalf("Failed to initialize primary store: %v", err)
-	}
-
-	dataAPI, err := data.NewAPI(primaryStore)
-	if err != nil {
-		_ = primaryStore.Close()
-		_ = primaryDB.Close()
-		log.Fatalf("Failed to initialize data API: %v", err)
-	}
-
-	platformAPI, err := platform.NewAPI(primaryStore)
+	app, err := server.New(primaryDB)
 	if err != nil {
-		_ = primaryStore.Close()
 		_ = primaryDB.Close()
-		log.Fatalf("Failed to initialize platform database: %v", err)
+		log.Fatalf("Failed to initialize server: %v", err)
 	}
 
-	authAPI := auth.NewAPI(authResolver{store: primaryStore, platform: platformAPI})
-
-	app := http.NewServeMux()
-
-	// Health check
-	app.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte(`{"status":"healthy"}`))
-	})
-
-	// Register routes from each module
-	dataAPI.RegisterRoutes(app)
-	platformAPI.RegisterRoutes(app)
-	authAPI.RegisterRoutes(app)
-
-	// Apply middleware chain: panic recovery -> logging -> timeout -> cors -> auth -> handler
-	handler := tools.PanicRecoveryMiddleware(
-		tools.LoggingMiddleware(
-			tools.TimeoutMiddleware(
-				tools.CORSMiddleware(
-					tools.AuthMiddleware(app)))))
-
-	server := &http.Server{
+	httpServer := &http.Server{
 		Addr:    config.Cfg.Port,
-		Handler: handler,
+		Handler: app.Handler,
 	}
 
 	// Start server in goroutine
 	go func() {
 		fmt.Printf("Listening on %s\n", config.Cfg.Port)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			log.Fatalf("Server error: %v", err)
 		}
 	}()
@@ -266,7 +259,7 @@ func main() {
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	if err := server.Shutdown(shutdownCtx); err != nil {
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
 		log.Printf("Server forced to shutdown: %v", err)
 	}
 
@@ -274,7 +267,7 @@ func main() {
 	appCache.Close()
 
 	// Close database connections
-	if err := primaryStore.Close(); err != nil {
+	if err := app.Close(); err != nil {
 		log.Printf("Error closing primary store: %v", err)
 	}
 	if err := primaryDB.Close(); err != nil {
@@ -284,5 +277,10 @@ func main() {
 	// Close activity logger
 	tools.CloseActivityLogger()
 
+	// Send queued logs before exiting
+	flushCtx, flushCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	tools.CloseLogShipper(flushCtx)
+	flushCancel()
+
 	fmt.Println("Server stopped")
 }
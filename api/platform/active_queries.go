@@ -0,0 +1,33 @@
+package platform
+
+import (
+	"context"
+
+	"github.com/atombasedev/atombase/tools"
+)
+
+const auditQueryInterrupted = "query.interrupted"
+
+// listActiveQueries returns the Data API requests running on a database on
+// this server instance, oldest first.
+func (api *API) listActiveQueries(ctx context.Context, id string) ([]tools.ActiveQuery, error) {
+	if _, err := api.getDatabase(ctx, id); err != nil {
+		return nil, err
+	}
+	return tools.ActiveQueries(id), nil
+}
+
+// interruptQuery stops a Data API request running on a database. The
+// request fails with QUERY_INTERRUPTED.
+func (api *API) interruptQuery(ctx context.Context, id, queryID string) error {
+	if _, err := api.getDatabase(ctx, id); err != nil {
+		return err
+	}
+	query, err := tools.InterruptQuery(id, queryID)
+	if err != nil {
+		return err
+	}
+	return api.recordAudit(ctx, auditQueryInterrupted, id, map[string]any{
+		"query": query.ID, "path": query.Path, "fingerprint": query.Fingerprint, "ageMs": query.AgeMs,
+	})
+}
@@ -0,0 +1,239 @@
+package platform
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/atombasedev/atombase/definitions"
+	"github.com/atombasedev/atombase/tools"
+)
+
+// adoptDatabase registers an existing Turso database as a managed database.
+// A full-access token is minted for it, its schema is introspected and matched
+// against the definition history. The closest version is recorded as the
+// database's version and any remaining differences are stored as drift. When
+// the definition does not exist yet it is created from the introspected schema.
+// When the adoption fails after the token was minted, the database's tokens
+// are revoked so the minted one doesn't stay valid unrecorded.
+func (api *API) adoptDatabase(ctx context.Context, req AdoptDatabaseRequest) (*AdoptDatabaseResponse, error) {
+	conn, err := api.dbConn()
+	if err != nil {
+		return nil, err
+	}
+
+	var exists int
+	if err := conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM atombase_databases WHERE id = ?`, req.ID).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if exists > 0 {
+		return nil, ErrDatabaseExists
+	}
+	def, err := api.getDefinition(ctx, req.Definition)
+	if err != nil && !errors.Is(err, ErrDefinitionNotFound) {
+		return nil, err
+	}
+	// A new definition is created for the caller's org.
+	defType, org := req.Type, callerOrg(ctx)
+	if def != nil {
+		defType, org = def.Type, def.Org
+	}
+	if err := api.checkDatabaseQuota(ctx, org); err != nil {
+		return nil, err
+	}
+	switch defType {
+	case definitions.DefinitionTypeGlobal:
+		if req.UserID != "" {
+			return nil, tools.InvalidRequestErr("userId is only allowed for user definitions")
+		}
+	case definitions.DefinitionTypeUser:
+		if req.UserID == "" {
+			return nil, tools.InvalidRequestErr("userId is required for user definitions")
+		}
+	case definitions.DefinitionTypeOrganization:
+		return nil, tools.InvalidRequestErr("organization databases must be managed through the auth API")
+	case "":
+		return nil, tools.InvalidRequestErr("type is required when the definition does not exist")
+	default:
+		return nil, tools.InvalidRequestErr(fmt.Sprintf("unsupported definition type %q", defType))
+	}
+
+	if defType == definitions.DefinitionTypeUser {
+		if err := checkAdoptingUser(ctx, conn, req.UserID); err != nil {
+			return nil, err
+		}
+	}
+
+	token, err := createTenantTokenFn(ctx, req.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create database token: %w", err)
+	}
+	committed := false
+	defer func() {
+		if committed {
+			return
+		}
+		if err := revokeTenantTokensFn(context.WithoutCancel(ctx), req.ID); err != nil {
+			tools.Logger.Error("failed to revoke the token of a failed adoption", "database_id", req.ID, "error", err)
+		}
+	}()
+	actual, err := tursoIntrospectSchemaFn(ctx, req.ID, token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to introspect database schema: %w", err)
+	}
+	if len(actual.Tables) == 0 {
+		return nil, tools.InvalidRequestErr("database has no tables to adopt")
+	}
+	storedToken := []byte(token)
+	if tools.EncryptionEnabled() {
+		storedToken, err = tools.Encrypt([]byte(token))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	resp := &AdoptDatabaseResponse{Drift: []SchemaDiff{}}
+	now := time.Now().UTC().Format(time.RFC3339)
+	record := func(tx *sql.Tx, definitionID int32) error {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO atombase_databases (id, definition_id, definition_version, auth_token_encrypted, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?)
+		`, req.ID, definitionID, resp.MatchedVersion, storedToken, now, now); err != nil {
+			return err
+		}
+
+		if defType == definitions.DefinitionTypeUser {
+			// Checked again here in case the user was given a database meanwhile.
+			if err := checkAdoptingUser(ctx, tx, req.UserID); err != nil {
+				return err
+			}
+			if _, err := tx.ExecContext(ctx, `
+				UPDATE atombase_users SET database_id = ?, updated_at = ? WHERE id = ?
+			`, req.ID, now, req.UserID); err != nil {
+				return err
+			}
+		}
+
+		if len(resp.Drift) > 0 {
+			driftJSON, err := json.Marshal(resp.Drift)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.ExecContext(ctx, `
+				INSERT INTO atombase_database_drift (database_id, definition_version, changes_json, detected_at)
+				VALUES (?, ?, ?, ?)
+			`, req.ID, resp.MatchedVersion, string(driftJSON), now); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if def == nil {
+		// The definition is created in the same transaction as the database,
+		// so a failed adoption does not leave one behind.
+		resp.MatchedVersion = 1
+		if _, err := api.createDefinitionWith(ctx, CreateDefinitionRequest{
+			Name:   req.Definition,
+			Type:   req.Type,
+			Schema: actual,
+		}, record); err != nil {
+			return nil, err
+		}
+		resp.CreatedDefinition = true
+		committed = true
+	} else {
+		history, err := api.getDefinitionHistory(ctx, def.Name)
+		if err != nil {
+			return nil, err
+		}
+		resp.MatchedVersion, resp.Drift = closestDefinitionVersion(history, actual)
+
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return nil, err
+		}
+		defer tx.Rollback()
+		if err := record(tx, def.ID); err != nil {
+			return nil, err
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+		committed = true
+	}
+
+	resp.Database, err = api.getDatabase(ctx, req.ID)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// rowQuerier is a connection or transaction reading a single row.
+type rowQuerier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// checkAdoptingUser checks that a user exists and has no database yet.
+func checkAdoptingUser(ctx context.Context, q rowQuerier, userID string) error {
+	var existingDatabaseID sql.NullString
+	if err := q.QueryRowContext(ctx, `
+		SELECT database_id
+		FROM atombase_users
+		WHERE id = ?
+	`, userID).Scan(&existingDatabaseID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return tools.InvalidRequestErr("user not found")
+		}
+		return err
+	}
+	if existingDatabaseID.Valid && existingDatabaseID.String != "" {
+		return tools.ErrDatabaseExists
+	}
+	return nil
+}
+
+// closestDefinitionVersion returns the version whose schema matches actual with
+// the fewest differences, preferring newer versions on ties, and those differences.
+func closestDefinitionVersion(history []DefinitionVersion, actual Schema) (int, []SchemaDiff) {
+	bestVersion := 0
+	var bestDiff []SchemaDiff
+	for _, item := range history {
+		changes := diffSchemas(item.Schema, alignIntrospectedSchema(actual, item.Schema))
+		if bestVersion == 0 || len(changes) < len(bestDiff) || (len(changes) == len(bestDiff) && item.Version > bestVersion) {
+			bestVersion = item.Version
+			bestDiff = changes
+		}
+	}
+	if bestDiff == nil {
+		bestDiff = []SchemaDiff{}
+	}
+	return bestVersion, bestDiff
+}
+
+func (api *API) getDatabaseDrift(ctx context.Context, id string) ([]SchemaDiff, error) {
+	conn, err := api.dbConn()
+	if err != nil {
+		return nil, err
+	}
+	var raw string
+	if err := conn.QueryRowContext(ctx, `
+		SELECT changes_json
+		FROM atombase_database_drift
+		WHERE database_id = ?
+	`, id).Scan(&raw); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return []SchemaDiff{}, nil
+		}
+		return nil, err
+	}
+	var changes []SchemaDiff
+	if err := json.Unmarshal([]byte(raw), &changes); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
@@ -0,0 +1,184 @@
+package platform
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+)
+
+func openSchemaDB(t *testing.T, schema Schema) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, stmt := range generateSchemaSQL(schema) {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("failed to apply %q: %v", stmt, err)
+		}
+	}
+	return db
+}
+
+func TestIntrospectSchema_RoundTripsGeneratedSchema(t *testing.T) {
+	schema := Schema{Tables: []Table{
+		{Name: "users", Pk: []string{"id"}, Columns: map[string]Col{
+			"id":    {Name: "id", Type: "INTEGER"},
+			"email": {Name: "email", Type: "TEXT", NotNull: true, Unique: true, Collate: "NOCASE"},
+			"role":  {Name: "role", Type: "TEXT", Default: "member"},
+		}},
+		{Name: "posts", Pk: []string{"id"}, Columns: map[string]Col{
+			"id":       {Name: "id", Type: "INTEGER"},
+			"title":    {Name: "title", Type: "TEXT", Check: "length(title) > 0"},
+			"author":   {Name: "author", Type: "INTEGER", References: "users.id", OnDelete: "CASCADE"},
+			"views":    {Name: "views", Type: "INTEGER", Default: float64(0)},
+			"headline": {Name: "headline", Type: "TEXT", Generated: &Generated{Expr: "upper(title)"}},
+		}, Indexes: []Index{{Name: "idx_posts_author", Columns: []string{"author"}}}},
+	}}
+	db := openSchemaDB(t, schema)
+	defer db.Close()
+
+	actual, err := introspectSchema(context.Background(), db)
+	if err != nil {
+		t.Fatalf("introspectSchema failed: %v", err)
+	}
+	if len(actual.Tables) != 2 {
+		t.Fatalf("expected 2 tables, got %+v", actual.Tables)
+	}
+	if changes := diffSchemas(schema, alignIntrospectedSchema(actual, schema)); len(changes) != 0 {
+		t.Fatalf("expected introspected schema to match, got %+v", changes)
+	}
+}
+
+func TestIntrospectSchema_ReportsDrift(t *testing.T) {
+	schema := Schema{Tables: []Table{{Name: "notes", Pk: []string{"id"}, Columns: map[string]Col{
+		"id":   {Name: "id", Type: "INTEGER"},
+		"body": {Name: "body", Type: "TEXT"},
+	}}}}
+	db := openSchemaDB(t, schema)
+	defer db.Close()
+	if _, err := db.Exec(`ALTER TABLE notes ADD COLUMN pinned INTEGER`); err != nil {
+		t.Fatal(err)
+	}
+
+	actual, err := introspectSchema(context.Background(), db)
+	if err != nil {
+		t.Fatalf("introspectSchema failed: %v", err)
+	}
+	changes := diffSchemas(schema, alignIntrospectedSchema(actual, schema))
+	if len(changes) != 1 || changes[0].Type != "add_column" || changes[0].Column != "pinned" {
+		t.Fatalf("expected pinned column drift, got %+v", changes)
+	}
+}
+
+func TestAdoptDatabase_MatchesVersionAndRecordsDrift(t *testing.T) {
+	api, db := setupPlatformAPI(t)
+	defer db.Close()
+
+	v1 := Schema{Tables: []Table{{Name: "notes", Pk: []string{"id"}, Columns: map[string]Col{
+		"id":   {Name: "id", Type: "INTEGER"},
+		"body": {Name: "body", Type: "TEXT"},
+	}}}}
+	if _, err := api.createDefinition(context.Background(), CreateDefinitionRequest{Name: "notes", Type: "global", Schema: v1}); err != nil {
+		t.Fatalf("createDefinition failed: %v", err)
+	}
+
+	tenant := openSchemaDB(t, v1)
+	defer tenant.Close()
+	if _, err := tenant.Exec(`CREATE INDEX idx_notes_body ON notes(body)`); err != nil {
+		t.Fatal(err)
+	}
+
+	oldToken := createTenantTokenFn
+	oldRevoke := revokeTenantTokensFn
+	oldIntrospect := tursoIntrospectSchemaFn
+	defer func() {
+		createTenantTokenFn = oldToken
+		revokeTenantTokensFn = oldRevoke
+		tursoIntrospectSchemaFn = oldIntrospect
+	}()
+	var revoked []string
+	revokeTenantTokensFn = func(ctx context.Context, name string) error { revoked = append(revoked, name); return nil }
+	createTenantTokenFn = func(ctx context.Context, name string) (string, error) { return "minted", nil }
+	tursoIntrospectSchemaFn = func(ctx context.Context, dbName, token string) (Schema, error) {
+		if token != "minted" {
+			t.Fatalf("expected minted token, got %q", token)
+		}
+		return introspectSchema(ctx, tenant)
+	}
+
+	resp, err := api.adoptDatabase(context.Background(), AdoptDatabaseRequest{ID: "legacy-notes", Definition: "notes"})
+	if err != nil {
+		t.Fatalf("adoptDatabase failed: %v", err)
+	}
+	if resp.CreatedDefinition || resp.MatchedVersion != 1 || resp.Database.DefinitionName != "notes" {
+		t.Fatalf("unexpected adopt response: %+v", resp)
+	}
+	if len(resp.Drift) != 1 || resp.Drift[0].Type != "add_index" {
+		t.Fatalf("expected index drift, got %+v", resp.Drift)
+	}
+	token, err := api.getDatabaseToken(context.Background(), "legacy-notes")
+	if err != nil || token != "minted" {
+		t.Fatalf("expected stored minted token, got %q (%v)", token, err)
+	}
+	drift, err := api.getDatabaseDrift(context.Background(), "legacy-notes")
+	if err != nil || len(drift) != 1 {
+		t.Fatalf("expected persisted drift, got %+v (%v)", drift, err)
+	}
+
+	if _, err := api.adoptDatabase(context.Background(), AdoptDatabaseRequest{ID: "legacy-notes", Definition: "notes"}); err != ErrDatabaseExists {
+		t.Fatalf("expected ErrDatabaseExists on re-adopt, got %v", err)
+	}
+
+	resp, err = api.adoptDatabase(context.Background(), AdoptDatabaseRequest{ID: "legacy-journal", Definition: "journal", Type: "global"})
+	if err != nil {
+		t.Fatalf("adoptDatabase(new definition) failed: %v", err)
+	}
+	if !resp.CreatedDefinition || resp.MatchedVersion != 1 || len(resp.Drift) != 0 {
+		t.Fatalf("expected definition to be created from schema, got %+v", resp)
+	}
+	if len(revoked) != 0 {
+		t.Fatalf("expected no tokens revoked after adoptions that committed, got %v", revoked)
+	}
+
+	// Introspection fails after the token was minted, which revokes it.
+	introspect := tursoIntrospectSchemaFn
+	tursoIntrospectSchemaFn = func(ctx context.Context, dbName, token string) (Schema, error) {
+		return Schema{}, errors.New("connection refused")
+	}
+	if _, err := api.adoptDatabase(context.Background(), AdoptDatabaseRequest{ID: "legacy-gone", Definition: "notes"}); err == nil {
+		t.Fatal("expected adoption to fail when introspection does")
+	}
+	if len(revoked) != 1 || revoked[0] != "legacy-gone" {
+		t.Fatalf("expected the minted token revoked, got %v", revoked)
+	}
+	tursoIntrospectSchemaFn = introspect
+
+	// A user that does not exist fails before a token is minted, and leaves no definition.
+	minted := false
+	createTenantTokenFn = func(ctx context.Context, name string) (string, error) { minted = true; return "minted", nil }
+	if _, err := api.adoptDatabase(context.Background(), AdoptDatabaseRequest{ID: "legacy-diary", Definition: "diary", Type: "user", UserID: "nobody"}); err == nil {
+		t.Fatal("expected adoption for a missing user to fail")
+	}
+	if minted {
+		t.Fatal("expected no token to be minted for a missing user")
+	}
+	if _, err := api.getDefinition(context.Background(), "diary"); !errors.Is(err, ErrDefinitionNotFound) {
+		t.Fatalf("expected no definition after a failed adoption, got %v", err)
+	}
+
+	// Recording the database fails after the definition was inserted, which rolls it back.
+	if _, err := db.Exec(`CREATE TRIGGER refuse_adopt BEFORE INSERT ON atombase_databases BEGIN SELECT RAISE(ABORT, 'refused'); END`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := api.adoptDatabase(context.Background(), AdoptDatabaseRequest{ID: "legacy-log", Definition: "log", Type: "global"}); err == nil {
+		t.Fatal("expected adoption to fail")
+	}
+	if _, err := api.getDefinition(context.Background(), "log"); !errors.Is(err, ErrDefinitionNotFound) {
+		t.Fatalf("expected the definition to be rolled back, got %v", err)
+	}
+	if revoked[len(revoked)-1] != "legacy-log" {
+		t.Fatalf("expected the token of the rolled back adoption revoked, got %v", revoked)
+	}
+}
@@ -0,0 +1,256 @@
+package platform
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/atombasedev/atombase/definitions"
+	"github.com/atombasedev/atombase/tools"
+)
+
+// Audit actions recorded for scoped API keys.
+const (
+	auditAPIKeyCreated = "api_key.created"
+	auditAPIKeyDeleted = "api_key.deleted"
+)
+
+// createAPIKey creates a scoped key and returns its token, which is not
+// stored and cannot be read again.
+func (api *API) createAPIKey(ctx context.Context, req CreateAPIKeyRequest) (*APIKey, error) {
+	key, err := api.resolveKeyScope(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := api.dbConn()
+	if err != nil {
+		return nil, err
+	}
+	// The org row goes in with the key: without it the key would reach every org.
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	if err := storeAPIKey(ctx, tx, key); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	if err := api.recordAudit(ctx, auditAPIKeyCreated, "api_key:"+key.ID, map[string]any{
+		"name": key.Name, "org": key.Org, "role": key.Role, "databaseId": key.DatabaseID, "tables": key.Tables, "verbs": key.Verbs,
+	}); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// resolveKeyScope validates the name and scope of a new key or service
+// account and returns them as an unsaved key: its org and role settled, and
+// tables and verbs sorted.
+func (api *API) resolveKeyScope(ctx context.Context, req CreateAPIKeyRequest) (*APIKey, error) {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return nil, tools.InvalidRequestErr("name is required")
+	}
+	if len(req.Verbs) == 0 {
+		return nil, tools.InvalidRequestErr("at least one verb is required")
+	}
+	org, err := api.requestOrg(ctx, req.Org)
+	if err != nil {
+		return nil, err
+	}
+	role, err := keyRole(ctx, org, req.Role, req.Verbs)
+	if err != nil {
+		return nil, err
+	}
+	for _, verb := range req.Verbs {
+		if verb == tools.VerbOverrideQuotas && org != "" {
+			return nil, tools.InvalidRequestErr("organization keys cannot override quotas")
+		}
+		switch verb {
+		case tools.VerbRead, tools.VerbWrite, tools.VerbAdmin, tools.VerbOverrideQuotas:
+		default:
+			return nil, tools.InvalidRequestErr(fmt.Sprintf("unknown verb %q, use read, write, admin or override_quotas", verb))
+		}
+	}
+	for _, table := range req.Tables {
+		if err := tools.ValidateTableName(table); err != nil {
+			return nil, err
+		}
+	}
+	if req.DatabaseID != "" {
+		db, err := api.getDatabase(ctx, req.DatabaseID)
+		if err != nil {
+			return nil, err
+		}
+		if db.DefinitionType == string(definitions.DefinitionTypeUser) {
+			return nil, tools.InvalidRequestErr("API keys can only be scoped to global and organization databases")
+		}
+		if db.Org != org {
+			return nil, tools.InvalidRequestErr(fmt.Sprintf("database %s does not belong to the key's organization", req.DatabaseID))
+		}
+	}
+
+	key := &APIKey{
+		Name:       req.Name,
+		Org:        org,
+		Role:       role,
+		DatabaseID: req.DatabaseID,
+		Tables:     slices.Compact(slices.Sorted(slices.Values(req.Tables))),
+		Verbs:      slices.Compact(slices.Sorted(slices.Values(req.Verbs))),
+	}
+	if key.Tables == nil {
+		key.Tables = []string{}
+	}
+	return key, nil
+}
+
+// keyRole picks the role of a new key of org: the requested one, else the
+// caller's, or owner for keys the service key creates. Callers cannot grant
+// more than their own role, and viewer keys only read.
+func keyRole(ctx context.Context, org, requested string, verbs []string) (string, error) {
+	if org == "" {
+		if requested != "" {
+			return "", tools.InvalidRequestErr("role needs an org")
+		}
+		return "", nil
+	}
+	role := requested
+	if role == "" {
+		role = callerRole(ctx)
+	}
+	if err := validateOrgRole(role); err != nil {
+		return "", err
+	}
+	if !roleAtLeast(callerRole(ctx), role) {
+		return "", fmt.Errorf("%w: a %s cannot create %s keys", tools.ErrAPIKeyScope, callerRole(ctx), role)
+	}
+	if role == tools.OrgRoleViewer && slices.ContainsFunc(verbs, func(verb string) bool { return verb != tools.VerbRead }) {
+		return "", tools.InvalidRequestErr("viewer keys can only have the read verb")
+	}
+	return role, nil
+}
+
+// storeAPIKey generates the id and token of key and inserts it, with its org
+// row, in tx.
+func storeAPIKey(ctx context.Context, tx *sql.Tx, key *APIKey) error {
+	id := make([]byte, 8)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return err
+	}
+	key.ID = "key_" + hex.EncodeToString(id)
+	key.CreatedAt = time.Now().UTC()
+	if key.Tables == nil {
+		key.Tables = []string{}
+	}
+	encodedSecret := base64.RawURLEncoding.EncodeToString(secret)
+	key.Key = tools.APIKeyPrefix + key.ID + "." + encodedSecret
+
+	tablesJSON, _ := json.Marshal(key.Tables)
+	verbsJSON, _ := json.Marshal(key.Verbs)
+	hash := sha256.Sum256([]byte(encodedSecret))
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO atombase_api_keys (id, name, secret_hash, database_id, tables_json, verbs_json, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, key.ID, key.Name, hash[:], sql.NullString{String: key.DatabaseID, Valid: key.DatabaseID != ""},
+		string(tablesJSON), string(verbsJSON), key.CreatedAt.Format(time.RFC3339)); err != nil {
+		return err
+	}
+	if key.Org == "" {
+		return nil
+	}
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO atombase_api_key_orgs (key_id, org_id, role, member_email) VALUES (?, ?, ?, ?)
+	`, key.ID, key.Org, key.Role, sql.NullString{String: key.Member, Valid: key.Member != ""})
+	return err
+}
+
+// listAPIKeys returns every scoped key the caller can see, oldest first,
+// without tokens.
+func (api *API) listAPIKeys(ctx context.Context) ([]APIKey, error) {
+	conn, err := api.dbConn()
+	if err != nil {
+		return nil, err
+	}
+	org := callerOrg(ctx)
+	rows, err := conn.QueryContext(ctx, `
+		SELECT k.id, k.name, COALESCE(o.org_id, ''), COALESCE(o.role, ''), COALESCE(o.member_email, ''),
+		       COALESCE(k.database_id, ''), k.tables_json, k.verbs_json, k.created_at
+		FROM atombase_api_keys k
+		LEFT JOIN atombase_api_key_orgs o ON o.key_id = k.id
+		WHERE ? = '' OR o.org_id = ?
+		ORDER BY k.created_at ASC, k.id ASC
+	`, org, org)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		var key APIKey
+		var tablesJSON, verbsJSON, createdAt string
+		if err := rows.Scan(&key.ID, &key.Name, &key.Org, &key.Role, &key.Member, &key.DatabaseID, &tablesJSON, &verbsJSON, &createdAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(tablesJSON), &key.Tables); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(verbsJSON), &key.Verbs); err != nil {
+			return nil, err
+		}
+		key.CreatedAt = mustParseTime(createdAt)
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// deleteAPIKey revokes a key. Requests made with it fail immediately.
+func (api *API) deleteAPIKey(ctx context.Context, id string) error {
+	conn, err := api.dbConn()
+	if err != nil {
+		return err
+	}
+	org := callerOrg(ctx)
+	if org != "" {
+		var role string
+		err := conn.QueryRowContext(ctx, `
+			SELECT role FROM atombase_api_key_orgs WHERE key_id = ? AND org_id = ?
+		`, id, org).Scan(&role)
+		if errors.Is(err, sql.ErrNoRows) {
+			return tools.ErrAPIKeyNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if !roleAtLeast(callerRole(ctx), role) {
+			return fmt.Errorf("%w: a %s cannot revoke %s keys", tools.ErrAPIKeyScope, callerRole(ctx), role)
+		}
+	}
+	result, err := conn.ExecContext(ctx, `
+		DELETE FROM atombase_api_keys
+		WHERE id = ? AND (? = '' OR id IN (SELECT key_id FROM atombase_api_key_orgs WHERE org_id = ?))
+	`, id, org, org)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return tools.ErrAPIKeyNotFound
+	}
+	return api.recordAudit(ctx, auditAPIKeyDeleted, "api_key:"+id, map[string]string{})
+}
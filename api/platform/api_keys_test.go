@@ -0,0 +1,93 @@
+package platform
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/atombasedev/atombase/tools"
+)
+
+func TestAPIKeys(t *testing.T) {
+	api, db := setupPlatformAPI(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	if _, err := db.Exec(`
+		INSERT INTO atombase_definitions (id, name, definition_type, current_version, created_at, updated_at) VALUES
+			(1, 'market', 'global', 1, '2026-01-01T00:00:00Z', '2026-01-01T00:00:00Z'),
+			(2, 'notes', 'user', 1, '2026-01-01T00:00:00Z', '2026-01-01T00:00:00Z');
+		INSERT INTO atombase_databases (id, definition_id, definition_version, created_at, updated_at) VALUES
+			('market-db', 1, 1, '2026-01-01T00:00:00Z', '2026-01-01T00:00:00Z'),
+			('notes-db', 2, 1, '2026-01-01T00:00:00Z', '2026-01-01T00:00:00Z');
+	`); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := api.createAPIKey(ctx, CreateAPIKeyRequest{
+		Name:       "reports",
+		DatabaseID: "market-db",
+		Tables:     []string{"orders", "items", "orders"},
+		Verbs:      []string{tools.VerbRead},
+	})
+	if err != nil {
+		t.Fatalf("createAPIKey failed: %v", err)
+	}
+	id, secret, ok := tools.ParseAPIKeyToken(reader.Key)
+	if !ok || id != reader.ID || !strings.HasPrefix(id, "key_") {
+		t.Fatalf("unexpected token %q for key %q", reader.Key, reader.ID)
+	}
+	if strings.Join(reader.Tables, ",") != "items,orders" {
+		t.Errorf("tables = %v, want deduplicated and sorted", reader.Tables)
+	}
+
+	scope, err := api.store.LookupAPIKey(ctx, id, secret)
+	if err != nil {
+		t.Fatalf("created key does not authenticate: %v", err)
+	}
+	if scope.Database != "market-db" || scope.FullAccess() || !scope.Allows("orders", "select") || scope.Allows("orders", "insert") {
+		t.Fatalf("unexpected scope %+v", scope)
+	}
+
+	admin, err := api.createAPIKey(ctx, CreateAPIKeyRequest{Name: "ops", Verbs: []string{tools.VerbAdmin}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, req := range map[string]CreateAPIKeyRequest{
+		"no name":       {Verbs: []string{tools.VerbRead}},
+		"no verbs":      {Name: "x"},
+		"unknown verb":  {Name: "x", Verbs: []string{"delete"}},
+		"bad table":     {Name: "x", Verbs: []string{tools.VerbRead}, Tables: []string{"bad table"}},
+		"user database": {Name: "x", Verbs: []string{tools.VerbRead}, DatabaseID: "notes-db"},
+	} {
+		if _, err := api.createAPIKey(ctx, req); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if _, err := api.createAPIKey(ctx, CreateAPIKeyRequest{Name: "x", Verbs: []string{tools.VerbRead}, DatabaseID: "missing-db"}); !errors.Is(err, ErrDatabaseNotFound) {
+		t.Errorf("expected database not found, got %v", err)
+	}
+
+	keys, err := api.listAPIKeys(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || keys[0].Key != "" || keys[1].Key != "" {
+		t.Fatalf("listed keys = %+v", keys)
+	}
+
+	if err := api.deleteAPIKey(ctx, reader.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := api.store.LookupAPIKey(ctx, id, secret); !errors.Is(err, tools.ErrAPIKeyNotFound) {
+		t.Errorf("revoked key still authenticates: %v", err)
+	}
+	if err := api.deleteAPIKey(ctx, reader.ID); !errors.Is(err, tools.ErrAPIKeyNotFound) {
+		t.Errorf("deleting twice: %v", err)
+	}
+	if keys, _ := api.listAPIKeys(ctx); len(keys) != 1 || keys[0].ID != admin.ID {
+		t.Fatalf("keys after delete = %+v", keys)
+	}
+}
@@ -0,0 +1,79 @@
+package platform
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/atombasedev/atombase/tools"
+)
+
+// maxAuditEntries caps how many audit entries one listing returns.
+const maxAuditEntries = 500
+
+// recordAudit appends an entry to the platform audit log. The detail is stored
+// as JSON alongside the action and the resource it applies to, and the entry is
+// forwarded to the log sink.
+func (api *API) recordAudit(ctx context.Context, action, target string, detail any) error {
+	conn, err := api.dbConn()
+	if err != nil {
+		return err
+	}
+	raw, err := json.Marshal(detail)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	result, err := conn.ExecContext(ctx, `
+		INSERT INTO atombase_audit_log (action, target, detail_json, created_at)
+		VALUES (?, ?, ?, ?)
+	`, action, target, string(raw), now.Format(time.RFC3339))
+	if err != nil {
+		return err
+	}
+	id, _ := result.LastInsertId()
+	tools.ShipLog(tools.LogStreamAudit, AuditEntry{ID: id, Action: action, Target: target, Detail: raw, CreatedAt: now})
+	return nil
+}
+
+// RecordAudit records an entry on behalf of another package, such as sign-in
+// lockouts from the auth module.
+func (api *API) RecordAudit(ctx context.Context, action, target string, detail any) error {
+	return api.recordAudit(ctx, action, target, detail)
+}
+
+// listAuditLog returns the most recent audit entries first, optionally only
+// those with the given action.
+func (api *API) listAuditLog(ctx context.Context, action string, limit int) ([]AuditEntry, error) {
+	if limit <= 0 || limit > maxAuditEntries {
+		limit = maxAuditEntries
+	}
+	conn, err := api.dbConn()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := conn.QueryContext(ctx, `
+		SELECT id, action, target, detail_json, created_at
+		FROM atombase_audit_log
+		WHERE ? = '' OR action = ?
+		ORDER BY id DESC
+		LIMIT ?
+	`, action, action, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var entry AuditEntry
+		var detail, createdAt string
+		if err := rows.Scan(&entry.ID, &entry.Action, &entry.Target, &detail, &createdAt); err != nil {
+			return nil, err
+		}
+		entry.Detail = json.RawMessage(detail)
+		entry.CreatedAt = mustParseTime(createdAt)
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,557 @@
+package platform
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/atombasedev/atombase/config"
+	"github.com/atombasedev/atombase/tools"
+)
+
+const auditBackupRestored = "backup.restored"
+
+// Backup statuses.
+const (
+	BackupRunning = "running"
+	BackupDone    = "done"
+	BackupFailed  = "failed"
+)
+
+// Places a backup is kept.
+const (
+	backupLocal = "local"
+	backupS3    = "s3"
+)
+
+const (
+	backupPollInterval  = time.Minute      // Time between scheduler passes
+	backupBatchSize     = 20               // Backups one scheduler pass takes at most
+	backupTimeout       = 30 * time.Minute // How long a backup may run before it counts as failed
+	defaultBackupRetain = 7
+	maxBackupRetain     = 1000
+	minBackupInterval   = 15 * time.Minute
+	maxBackupListing    = 200 // Backups one listing returns at most
+)
+
+var exportTenantSQLiteFn = tools.ExportTenantSQLite
+
+// validateBackupPolicy checks a definition's settings.backup.
+func validateBackupPolicy(policy BackupPolicy) error {
+	interval, err := time.ParseDuration(policy.Interval)
+	if err != nil {
+		return fmt.Errorf("interval %q is not a duration such as 6h", policy.Interval)
+	}
+	if interval < minBackupInterval {
+		return fmt.Errorf("interval must be at least %s", minBackupInterval)
+	}
+	if policy.Retain < 0 || policy.Retain > maxBackupRetain {
+		return fmt.Errorf("retain must be between 0 (keep %d) and %d", defaultBackupRetain, maxBackupRetain)
+	}
+	return nil
+}
+
+// backupStore keeps backup files in the backup bucket when one is configured
+// and under the backup directory otherwise.
+type backupStore struct {
+	bucket *tools.ObjectStore
+	dir    string
+}
+
+func newBackupStore() backupStore {
+	dir := config.Cfg.BackupDir
+	if dir == "" {
+		dir = filepath.Join(config.Cfg.DataDir, "backups")
+	}
+	bucket := tools.NewObjectStore(config.Cfg.BackupS3URL, config.Cfg.BackupS3Region, config.Cfg.BackupS3AccessKey, config.Cfg.BackupS3SecretKey)
+	return backupStore{bucket: bucket, dir: dir}
+}
+
+// backupStoreAt returns the store of a backup kept at location, which need
+// not be where new backups go.
+func backupStoreAt(location string) (backupStore, error) {
+	store := newBackupStore()
+	if location == backupLocal {
+		store.bucket = nil
+	} else if store.bucket == nil {
+		return backupStore{}, errors.New("backup is kept in a bucket but ATOMICBASE_BACKUP_S3_URL is not set")
+	}
+	return store, nil
+}
+
+func (s backupStore) location() string {
+	if s.bucket != nil {
+		return backupS3
+	}
+	return backupLocal
+}
+
+func backupKey(databaseID, id string) string {
+	return databaseID + "/" + id + ".db"
+}
+
+func (s backupStore) put(ctx context.Context, key string, file *os.File) error {
+	if s.bucket != nil {
+		return s.bucket.PutFile(ctx, key, file, "application/vnd.sqlite3")
+	}
+	target := filepath.Join(s.dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(target), 0o700); err != nil {
+		return err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	// Written next to the target and renamed, so a restore never reads half
+	// a file.
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".backup-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, file); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), target)
+}
+
+func (s backupStore) open(ctx context.Context, key string) (io.ReadCloser, error) {
+	if s.bucket != nil {
+		body, _, err := s.bucket.Open(ctx, key)
+		return body, err
+	}
+	return os.Open(filepath.Join(s.dir, filepath.FromSlash(key)))
+}
+
+func (s backupStore) remove(ctx context.Context, key string) error {
+	if s.bucket != nil {
+		return s.bucket.Delete(ctx, key)
+	}
+	err := os.Remove(filepath.Join(s.dir, filepath.FromSlash(key)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// RunBackupScheduler backs up the databases of definitions with a backup
+// policy until stop is closed. Backups are claimed in the primary database,
+// so any number of servers can run the scheduler.
+func (api *API) RunBackupScheduler(stop <-chan struct{}) {
+	ticker := time.NewTicker(backupPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			if err := api.runDueBackups(context.Background(), now); err != nil {
+				tools.Logger.Error("backup scheduling failed", "error", err)
+			}
+		}
+	}
+}
+
+// definitionBackupPolicy is the backup policy of a definition's current
+// version.
+type definitionBackupPolicy struct {
+	definitionID int32
+	interval     time.Duration
+	retain       int
+	pointInTime  bool
+}
+
+// runDueBackups backs up every database whose last backup is older than its
+// definition's interval, up to backupBatchSize, and then drops the backups
+// past its retention along with the change log entries they held.
+func (api *API) runDueBackups(ctx context.Context, now time.Time) error {
+	conn, err := api.dbConn()
+	if err != nil {
+		return err
+	}
+	// A backup still running after the timeout was cut off with its server.
+	if _, err := conn.ExecContext(ctx, `
+		UPDATE atombase_backups SET status = ?, error = 'backup did not finish', finished_at = ?
+		WHERE status = ? AND created_at < ?
+	`, BackupFailed, now.UTC().Format(time.RFC3339), BackupRunning, now.Add(-backupTimeout).UTC().Format(time.RFC3339)); err != nil {
+		return err
+	}
+	policies, err := api.backupPolicies(ctx)
+	if err != nil {
+		return err
+	}
+	store := newBackupStore()
+	left := backupBatchSize
+	for _, policy := range policies {
+		if left <= 0 {
+			break
+		}
+		due, err := api.claimDueBackups(ctx, policy, store.location(), now, left)
+		if err != nil {
+			return err
+		}
+		left -= len(due)
+		for _, backup := range due {
+			runCtx, cancel := context.WithTimeout(ctx, backupTimeout)
+			err := api.takeBackup(runCtx, store, backup)
+			cancel()
+			if err != nil {
+				tools.Logger.Error("backup failed", "database_id", backup.DatabaseID, "backup_id", backup.ID, "error", err)
+			}
+			if err := api.pruneBackups(ctx, backup.DatabaseID, policy.retain); err != nil {
+				tools.Logger.Error("failed to prune backups", "database_id", backup.DatabaseID, "error", err)
+			} else if policy.pointInTime {
+				if err := api.pruneChangelog(ctx, backup.DatabaseID); err != nil {
+					tools.Logger.Error("failed to prune change log", "database_id", backup.DatabaseID, "error", err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// backupPolicies returns the definitions whose current version sets
+// settings.backup.
+func (api *API) backupPolicies(ctx context.Context) ([]definitionBackupPolicy, error) {
+	conn, err := api.dbConn()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := conn.QueryContext(ctx, `
+		SELECT d.id, h.schema_json
+		FROM atombase_definitions d
+		JOIN atombase_definitions_history h ON h.definition_id = d.id AND h.version = d.current_version
+		ORDER BY d.id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var policies []definitionBackupPolicy
+	for rows.Next() {
+		var id int32
+		var schemaJSON string
+		if err := rows.Scan(&id, &schemaJSON); err != nil {
+			return nil, err
+		}
+		var schema Schema
+		if err := tools.DecodeSchema([]byte(schemaJSON), &schema); err != nil {
+			return nil, err
+		}
+		if schema.Settings == nil || schema.Settings.Backup == nil {
+			continue
+		}
+		interval, err := time.ParseDuration(schema.Settings.Backup.Interval)
+		if err != nil {
+			continue
+		}
+		retain := schema.Settings.Backup.Retain
+		if retain == 0 {
+			retain = defaultBackupRetain
+		}
+		policies = append(policies, definitionBackupPolicy{definitionID: id, interval: interval, retain: retain, pointInTime: pointInTime(schema)})
+	}
+	return policies, rows.Err()
+}
+
+// claimDueBackups starts a backup of up to limit databases of a definition
+// that have none newer than the policy's interval. The check and the claim
+// are one statement, so two schedulers never back up a database twice.
+func (api *API) claimDueBackups(ctx context.Context, policy definitionBackupPolicy, location string, now time.Time, limit int) ([]Backup, error) {
+	conn, err := api.dbConn()
+	if err != nil {
+		return nil, err
+	}
+	since := now.Add(-policy.interval).UTC().Format(time.RFC3339)
+	rows, err := conn.QueryContext(ctx, `
+		SELECT d.id FROM atombase_databases d
+		WHERE d.definition_id = ? AND NOT EXISTS (
+			SELECT 1 FROM atombase_backups b WHERE b.database_id = d.id AND b.created_at > ?
+		)
+		ORDER BY d.id
+		LIMIT ?
+	`, policy.definitionID, since, limit)
+	if err != nil {
+		return nil, err
+	}
+	var candidates []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		candidates = append(candidates, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var claimed []Backup
+	createdAt := now.UTC().Truncate(time.Second)
+	for _, databaseID := range candidates {
+		raw := make([]byte, 8)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		backup := Backup{ID: "bak_" + hex.EncodeToString(raw), DatabaseID: databaseID, Location: location, Status: BackupRunning, CreatedAt: createdAt}
+		err := conn.QueryRowContext(ctx, `
+			INSERT INTO atombase_backups (id, database_id, definition_version, location, status, created_at)
+			SELECT ?, d.id, d.definition_version, ?, ?, ? FROM atombase_databases d
+			WHERE d.id = ? AND NOT EXISTS (
+				SELECT 1 FROM atombase_backups b WHERE b.database_id = d.id AND b.created_at > ?
+			)
+			RETURNING definition_version
+		`, backup.ID, location, BackupRunning, createdAt.Format(time.RFC3339), databaseID, since).Scan(&backup.Version)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		claimed = append(claimed, backup)
+	}
+	return claimed, nil
+}
+
+// takeBackup snapshots a claimed backup's database into the store and
+// records how it went.
+func (api *API) takeBackup(ctx context.Context, store backupStore, backup Backup) error {
+	size, seq, err := api.writeBackup(ctx, store, backup)
+	conn, connErr := api.dbConn()
+	if connErr != nil {
+		return connErr
+	}
+	finishedAt := time.Now().UTC().Format(time.RFC3339)
+	if err != nil {
+		_, _ = conn.ExecContext(context.Background(), `UPDATE atombase_backups SET status = ?, error = ?, finished_at = ? WHERE id = ?`,
+			BackupFailed, err.Error(), finishedAt, backup.ID)
+		return err
+	}
+	_, err = conn.ExecContext(ctx, `UPDATE atombase_backups SET status = ?, size = ?, finished_at = ?, changelog_seq = ? WHERE id = ?`,
+		BackupDone, size, finishedAt, seq, backup.ID)
+	return err
+}
+
+// writeBackup uploads a snapshot of a backup's database, returning its size
+// and the last change log entry it holds.
+func (api *API) writeBackup(ctx context.Context, store backupStore, backup Backup) (int64, sql.NullInt64, error) {
+	var seq sql.NullInt64
+	token, err := api.getDatabaseToken(ctx, backup.DatabaseID)
+	if err != nil {
+		return 0, seq, err
+	}
+	dir, err := os.MkdirTemp("", "atombase-backup-*")
+	if err != nil {
+		return 0, seq, err
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, backup.ID+".db")
+	if err := exportTenantSQLiteFn(ctx, backup.DatabaseID, token, backup.Version, path); err != nil {
+		return 0, seq, err
+	}
+	if seq, err = changelogSeq(ctx, path); err != nil {
+		return 0, seq, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, seq, err
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil {
+		return 0, seq, err
+	}
+	if err := store.put(ctx, backupKey(backup.DatabaseID, backup.ID), file); err != nil {
+		return 0, seq, err
+	}
+	return stat.Size(), seq, nil
+}
+
+// pruneBackups keeps the newest retain finished backups of a database, and
+// as many failed ones, deleting the files of those it drops. Failures are
+// counted apart so a run of them never pushes out a good backup.
+func (api *API) pruneBackups(ctx context.Context, databaseID string, retain int) error {
+	conn, err := api.dbConn()
+	if err != nil {
+		return err
+	}
+	for _, status := range []string{BackupDone, BackupFailed} {
+		rows, err := conn.QueryContext(ctx, `
+			SELECT id, location FROM atombase_backups
+			WHERE database_id = ? AND status = ?
+			ORDER BY created_at DESC, rowid DESC
+			LIMIT -1 OFFSET ?
+		`, databaseID, status, retain)
+		if err != nil {
+			return err
+		}
+		var expired []Backup
+		for rows.Next() {
+			var backup Backup
+			if err := rows.Scan(&backup.ID, &backup.Location); err != nil {
+				rows.Close()
+				return err
+			}
+			expired = append(expired, backup)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		for _, backup := range expired {
+			if status == BackupDone {
+				store, err := backupStoreAt(backup.Location)
+				if err != nil {
+					return err
+				}
+				if err := store.remove(ctx, backupKey(databaseID, backup.ID)); err != nil {
+					return err
+				}
+			}
+			if _, err := conn.ExecContext(ctx, `DELETE FROM atombase_backups WHERE id = ?`, backup.ID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// listBackups returns the backups of a database, or of every database when
+// databaseID is empty, newest first. Backups outlive their database, so
+// those of deleted databases are listed too.
+func (api *API) listBackups(ctx context.Context, databaseID string) ([]Backup, error) {
+	conn, err := api.dbConn()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := conn.QueryContext(ctx, `
+		SELECT id, database_id, definition_version, location, size, status, error, created_at, finished_at
+		FROM atombase_backups
+		WHERE ? = '' OR database_id = ?
+		ORDER BY created_at DESC, rowid DESC
+		LIMIT ?
+	`, databaseID, databaseID, maxBackupListing)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	backups := []Backup{}
+	for rows.Next() {
+		backup, err := scanBackup(rows)
+		if err != nil {
+			return nil, err
+		}
+		backups = append(backups, backup)
+	}
+	return backups, rows.Err()
+}
+
+func (api *API) getBackup(ctx context.Context, id string) (*Backup, error) {
+	conn, err := api.dbConn()
+	if err != nil {
+		return nil, err
+	}
+	backup, err := scanBackup(conn.QueryRowContext(ctx, `
+		SELECT id, database_id, definition_version, location, size, status, error, created_at, finished_at
+		FROM atombase_backups WHERE id = ?
+	`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, tools.ErrBackupNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &backup, nil
+}
+
+func scanBackup(row interface{ Scan(...any) error }) (Backup, error) {
+	var backup Backup
+	var backupErr, finishedAt sql.NullString
+	var createdAt string
+	if err := row.Scan(&backup.ID, &backup.DatabaseID, &backup.Version, &backup.Location, &backup.Size, &backup.Status, &backupErr, &createdAt, &finishedAt); err != nil {
+		return Backup{}, err
+	}
+	backup.Error = backupErr.String
+	backup.CreatedAt = mustParseTime(createdAt)
+	if finishedAt.Valid {
+		at := mustParseTime(finishedAt.String)
+		backup.FinishedAt = &at
+	}
+	return backup, nil
+}
+
+// restoreBackup replaces the rows of a backup's database with the backup's,
+// the way an import in replace mode would. The database must be on the
+// definition version the backup was taken at; roll it back first otherwise.
+func (api *API) restoreBackup(ctx context.Context, id string, dryRun bool) (*ImportDatabaseResponse, error) {
+	backup, err := api.getBackup(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if backup.Status != BackupDone {
+		return nil, tools.InvalidRequestErr(fmt.Sprintf("backup %s is %s; only finished backups can be restored", id, backup.Status))
+	}
+	db, err := api.getDatabase(ctx, backup.DatabaseID)
+	if err != nil {
+		return nil, err
+	}
+	if db.DefinitionVersion != backup.Version {
+		return nil, tools.InvalidRequestErr(fmt.Sprintf("backup %s was taken at version %d but %s is on version %d; roll the database back to version %d first",
+			id, backup.Version, db.ID, db.DefinitionVersion, backup.Version))
+	}
+	token, err := api.getDatabaseToken(ctx, db.ID)
+	if err != nil {
+		return nil, err
+	}
+	store, err := backupStoreAt(backup.Location)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp("", "atombase-backup-restore-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, id+".db")
+	if err := downloadBackup(ctx, store, backupKey(db.ID, id), path); err != nil {
+		return nil, fmt.Errorf("failed to read backup %s: %w", id, err)
+	}
+	resp, err := api.applyImport(ctx, db, token, path, importReplace, dryRun)
+	if err != nil || dryRun {
+		return resp, err
+	}
+	if err := api.recordAudit(ctx, auditBackupRestored, db.ID, map[string]any{"backup": id, "rows": resp.Rows}); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func downloadBackup(ctx context.Context, store backupStore, key, path string) error {
+	body, err := store.open(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, body); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,126 @@
+package platform
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/atombasedev/atombase/config"
+	"github.com/atombasedev/atombase/tools"
+)
+
+func TestBackups(t *testing.T) {
+	api, db := setupPlatformAPI(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	tenantPath := func(name string) string { return filepath.Join(dir, name+".db") }
+	oldOpen, oldCreate, oldToken, oldBatch, oldExport := tursoOpenFn, createTenantDatabaseFn, createTenantTokenFn, batchExecuteWithTokenFn, exportTenantSQLiteFn
+	oldDir, oldBucket := config.Cfg.BackupDir, config.Cfg.BackupS3URL
+	defer func() {
+		tursoOpenFn, createTenantDatabaseFn, createTenantTokenFn, batchExecuteWithTokenFn, exportTenantSQLiteFn = oldOpen, oldCreate, oldToken, oldBatch, oldExport
+		config.Cfg.BackupDir, config.Cfg.BackupS3URL = oldDir, oldBucket
+	}()
+	config.Cfg.BackupDir, config.Cfg.BackupS3URL = t.TempDir(), ""
+	tursoOpenFn = func(name, token string) (*sql.DB, error) { return sql.Open("sqlite3", tenantPath(name)) }
+	createTenantDatabaseFn = func(ctx context.Context, name, group string) error { return nil }
+	createTenantTokenFn = func(ctx context.Context, name string) (string, error) { return "token", nil }
+	batchExecuteWithTokenFn = func(ctx context.Context, name, token string, statements []string) error {
+		conn, _ := tursoOpenFn(name, token)
+		defer conn.Close()
+		for _, stmt := range statements {
+			if _, err := conn.Exec(stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	exportTenantSQLiteFn = func(ctx context.Context, name, token string, version int, path string) error {
+		conn, _ := tursoOpenFn(name, token)
+		defer conn.Close()
+		_, err := conn.ExecContext(ctx, `VACUUM INTO ?`, path)
+		return err
+	}
+
+	if _, err := api.createDefinition(ctx, CreateDefinitionRequest{
+		Name: "notes",
+		Type: "global",
+		Schema: Schema{
+			Tables: []Table{{Name: "notes", Pk: []string{"id"}, Columns: map[string]Col{
+				"id":   {Name: "id", Type: "INTEGER"},
+				"body": {Name: "body", Type: "TEXT"},
+			}}},
+			Settings: &APISettings{Backup: &BackupPolicy{Interval: "1h", Retain: 2}},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := api.createDatabase(ctx, CreateDatabaseRequest{ID: "notes-1", Definition: "notes"}); err != nil {
+		t.Fatal(err)
+	}
+	tenant, _ := tursoOpenFn("notes-1", "")
+	defer tenant.Close()
+	if _, err := tenant.Exec(`INSERT INTO notes (id, body) VALUES (1, 'first')`); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	for _, at := range []time.Duration{0, 30 * time.Minute, time.Hour, 2 * time.Hour} {
+		if err := api.runDueBackups(ctx, now.Add(at)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	backups, err := api.listBackups(ctx, "notes-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Three backups were taken, a half-hour pass took none, and the oldest
+	// was pruned past the retention of two.
+	if len(backups) != 2 || backups[0].Status != BackupDone || backups[0].Size == 0 || !backups[0].CreatedAt.Equal(now.Add(2*time.Hour)) {
+		t.Fatalf("expected the two newest backups, got %+v", backups)
+	}
+	files, _ := filepath.Glob(filepath.Join(config.Cfg.BackupDir, "notes-1", "*.db"))
+	if len(files) != 2 {
+		t.Fatalf("expected the pruned backup's file removed, got %v", files)
+	}
+
+	if _, err := tenant.Exec(`DELETE FROM notes; INSERT INTO notes (id, body) VALUES (2, 'later')`); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := api.restoreBackup(ctx, backups[0].ID, true)
+	if err != nil || !resp.Valid || resp.Rows != 1 {
+		t.Fatalf("expected a valid dry run, got %+v, %v", resp, err)
+	}
+	if _, err := api.restoreBackup(ctx, backups[0].ID, false); err != nil {
+		t.Fatal(err)
+	}
+	var body string
+	if err := tenant.QueryRow(`SELECT group_concat(body) FROM notes`).Scan(&body); err != nil || body != "first" {
+		t.Fatalf("expected the backup's rows restored, got %q, %v", body, err)
+	}
+
+	if _, err := api.restoreBackup(ctx, "bak_missing", false); !errors.Is(err, tools.ErrBackupNotFound) {
+		t.Fatalf("expected ErrBackupNotFound, got %v", err)
+	}
+	os.Remove(files[0])
+	os.Remove(files[1])
+	if _, err := api.restoreBackup(ctx, backups[1].ID, false); err == nil {
+		t.Fatal("expected a backup whose file is gone to fail")
+	}
+}
+
+func TestValidateBackupPolicy(t *testing.T) {
+	for _, policy := range []BackupPolicy{{Interval: "daily"}, {Interval: "5m"}, {Interval: "1h", Retain: -1}} {
+		if err := validateBackupPolicy(policy); err == nil {
+			t.Errorf("expected %+v to be refused", policy)
+		}
+	}
+	if err := validateBackupPolicy(BackupPolicy{Interval: "24h"}); err != nil {
+		t.Error(err)
+	}
+}
@@ -17,13 +17,32 @@ type API struct {
 
 // Table names for internal platform tables.
 const (
-	TableDefinitions        = "atombase_definitions"
-	TableDefinitionsHistory = "atombase_definitions_history"
-	TableDatabases          = "atombase_databases"
-	TableMigrations         = "atombase_migrations"
-	TableMigrationFailures  = "atombase_migration_failures"
-	TableAccessPolicies     = "atombase_access_policies"
-	TableOrganizations      = "atombase_organizations"
+	TableDefinitions         = "atombase_definitions"
+	TableDefinitionsHistory  = "atombase_definitions_history"
+	TableDatabases           = "atombase_databases"
+	TableMigrations          = "atombase_migrations"
+	TableMigrationFailures   = "atombase_migration_failures"
+	TableAccessPolicies      = "atombase_access_policies"
+	TableProvisionPolicies   = "atombase_provision_policies"
+	TableDefinitionTests     = "atombase_definition_tests"
+	TableOrganizations       = "atombase_organizations"
+	TableDatabaseDrift       = "atombase_database_drift"
+	TableRowTenants          = "atombase_row_tenants"
+	TableTenantMoves         = "atombase_tenant_moves"
+	TableDefinitionResidency = "atombase_definition_residency"
+	TableDefinitionSources   = "atombase_definition_sources"
+	TableDatabaseResidency   = "atombase_database_residency"
+	TableDatabasePlacements  = "atombase_database_placements"
+	TableMigrationWindows    = "atombase_migration_windows"
+	TableDatabaseSchedules   = "atombase_database_schedules"
+	TableJWTKeys             = "atombase_jwt_keys"
+	TableAPIKeys             = "atombase_api_keys"
+	TableWebhooks            = "atombase_webhooks"
+	TableWebhookDeliveries   = "atombase_webhook_deliveries"
+	TableSavedQueries        = "atombase_saved_queries"
+	TableReports             = "atombase_reports"
+	TableBackups             = "atombase_backups"
+	TableAuditLog            = "atombase_audit_log"
 )
 
 // NewAPI builds a Platform API module using the shared primary metadata store.
@@ -8,6 +8,7 @@ import (
 	"net/http"
 
 	"github.com/atombasedev/atombase/config"
+	"github.com/atombasedev/atombase/tools"
 )
 
 // Turso HTTP Pipeline API types
@@ -18,8 +19,25 @@ type batchRequest struct {
 }
 
 type pipelineStatement struct {
-	Type string    `json:"type"`
-	Stmt *stmtBody `json:"stmt,omitempty"`
+	Type  string     `json:"type"`
+	Stmt  *stmtBody  `json:"stmt,omitempty"`
+	Batch *batchBody `json:"batch,omitempty"`
+}
+
+type batchBody struct {
+	Steps []batchStep `json:"steps"`
+}
+
+type batchStep struct {
+	Condition *batchCondition `json:"condition,omitempty"`
+	Stmt      stmtBody        `json:"stmt"`
+}
+
+// batchCondition gates a batch step on the outcome of an earlier step.
+type batchCondition struct {
+	Type string          `json:"type"` // ok, not
+	Step *int            `json:"step,omitempty"`
+	Cond *batchCondition `json:"cond,omitempty"`
 }
 
 type stmtBody struct {
@@ -37,9 +55,14 @@ type pipelineResult struct {
 }
 
 type resultDetails struct {
-	Type            string `json:"type"`
-	AffectedRows    int    `json:"affected_row_count,omitempty"`
-	LastInsertRowID int64  `json:"last_insert_rowid,omitempty"`
+	Type            string       `json:"type"`
+	AffectedRows    int          `json:"affected_row_count,omitempty"`
+	LastInsertRowID int64        `json:"last_insert_rowid,omitempty"`
+	Result          *batchResult `json:"result,omitempty"`
+}
+
+type batchResult struct {
+	StepErrors []*pipelineError `json:"step_errors"`
 }
 
 type pipelineError struct {
@@ -50,8 +73,9 @@ type pipelineError struct {
 var batchExecuteWithTokenFn = BatchExecuteWithToken
 
 // BatchExecuteWithToken sends multiple SQL statements to a Turso database using a per-database token.
-// Turso automatically executes all statements as a single transaction - if any statement
-// fails, the entire batch is rolled back.
+// The statements run as one pipeline batch where each step only runs if the previous one
+// succeeded. When every statement can run in a transaction the batch is wrapped in
+// BEGIN/COMMIT with a ROLLBACK step on failure, so a failing statement leaves nothing applied.
 //
 // This is significantly more efficient than individual ExecContext calls:
 // - 1 HTTP round-trip instead of N
@@ -60,6 +84,12 @@ func BatchExecuteWithToken(ctx context.Context, dbName, token string, statements
 	if len(statements) == 0 {
 		return nil
 	}
+	if tools.LocalTenants() {
+		return batchExecuteLocal(ctx, dbName, statements)
+	}
+	if batcher, ok := tools.Tenants().(tools.TenantBatcher); ok {
+		return batcher.ExecBatch(ctx, dbName, token, statements)
+	}
 
 	org := config.Cfg.TursoOrganization
 	if org == "" {
@@ -69,16 +99,16 @@ func BatchExecuteWithToken(ctx context.Context, dbName, token string, statements
 	if token == "" {
 		return fmt.Errorf("auth token is required")
 	}
+	if err := tools.InjectFault(ctx, tools.FaultTursoAPI); err != nil {
+		return fmt.Errorf("batch request failed: %w", err)
+	}
 
-	// Build pipeline request
-	requests := make([]pipelineStatement, 0, len(statements)+1)
-	for _, sql := range statements {
-		requests = append(requests, pipelineStatement{
-			Type: "execute",
-			Stmt: &stmtBody{SQL: sql},
-		})
+	atomic := tools.TransactionalStatements(statements)
+	steps := buildBatchSteps(statements, atomic)
+	requests := []pipelineStatement{
+		{Type: "batch", Batch: &batchBody{Steps: steps}},
+		{Type: "close"},
 	}
-	requests = append(requests, pipelineStatement{Type: "close"})
 
 	body, err := json.Marshal(batchRequest{Requests: requests})
 	if err != nil {
@@ -95,7 +125,7 @@ func BatchExecuteWithToken(ctx context.Context, dbName, token string, statements
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+token)
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := tools.TursoHTTPClient.Do(req)
 	if err != nil {
 		return fmt.Errorf("batch request failed: %w", err)
 	}
@@ -113,11 +143,90 @@ func BatchExecuteWithToken(ctx context.Context, dbName, token string, statements
 	}
 
 	// Check for statement errors
-	for i, result := range batchResp.Results {
+	for _, result := range batchResp.Results {
 		if result.Type == "error" && result.Error != nil {
-			return fmt.Errorf("statement %d failed: %s", i+1, result.Error.Message)
+			return fmt.Errorf("batch failed: %s", result.Error.Message)
+		}
+		if result.Response == nil || result.Response.Result == nil {
+			continue
+		}
+		offset := 0
+		if atomic {
+			offset = 1
+		}
+		for i, stepErr := range result.Response.Result.StepErrors {
+			if stepErr == nil {
+				continue
+			}
+			n := i - offset + 1
+			if n < 1 || n > len(statements) {
+				return fmt.Errorf("transaction failed: %s", stepErr.Message)
+			}
+			if !atomic {
+				return fmt.Errorf("statement %d failed (earlier statements remain applied): %s", n, stepErr.Message)
+			}
+			return fmt.Errorf("statement %d failed: %s", n, stepErr.Message)
 		}
 	}
 
 	return nil
 }
+
+// buildBatchSteps chains statements so each runs only after the previous step
+// succeeded. Atomic batches are wrapped in a transaction that is rolled back
+// when any statement or the commit fails.
+func buildBatchSteps(statements []string, atomic bool) []batchStep {
+	steps := make([]batchStep, 0, len(statements)+3)
+	add := func(sql string, cond *batchCondition) {
+		steps = append(steps, batchStep{Condition: cond, Stmt: stmtBody{SQL: sql}})
+	}
+	afterPrevious := func() *batchCondition {
+		if len(steps) == 0 {
+			return nil
+		}
+		prev := len(steps) - 1
+		return &batchCondition{Type: "ok", Step: &prev}
+	}
+
+	if atomic {
+		add("BEGIN", nil)
+	}
+	for _, stmt := range statements {
+		add(stmt, afterPrevious())
+	}
+	if atomic {
+		add("COMMIT", afterPrevious())
+		commit := len(steps) - 1
+		add("ROLLBACK", &batchCondition{Type: "not", Cond: &batchCondition{Type: "ok", Step: &commit}})
+	}
+	return steps
+}
+
+// batchExecuteLocal runs statements against a local tenant database with the
+// same all-or-nothing behavior as the pipeline batch.
+func batchExecuteLocal(ctx context.Context, dbName string, statements []string) error {
+	db, err := tools.OpenTenantDB(dbName, "")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if !tools.TransactionalStatements(statements) {
+		for i, stmt := range statements {
+			if _, err := db.ExecContext(ctx, stmt); err != nil {
+				return fmt.Errorf("batch failed at statement %d: %w", i+1, err)
+			}
+		}
+		return nil
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for i, stmt := range statements {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("batch failed at statement %d: %w", i+1, err)
+		}
+	}
+	return tx.Commit()
+}
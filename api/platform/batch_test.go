@@ -0,0 +1,32 @@
+package platform
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestBuildBatchSteps_WrapsAtomicBatchInTransaction(t *testing.T) {
+	steps := buildBatchSteps([]string{"CREATE TABLE a (id INTEGER)", "CREATE TABLE b (id INTEGER)"}, true)
+	raw, err := json.Marshal(steps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[{"stmt":{"sql":"BEGIN"}},` +
+		`{"condition":{"type":"ok","step":0},"stmt":{"sql":"CREATE TABLE a (id INTEGER)"}},` +
+		`{"condition":{"type":"ok","step":1},"stmt":{"sql":"CREATE TABLE b (id INTEGER)"}},` +
+		`{"condition":{"type":"ok","step":2},"stmt":{"sql":"COMMIT"}},` +
+		`{"condition":{"type":"not","cond":{"type":"ok","step":3}},"stmt":{"sql":"ROLLBACK"}}]`
+	if string(raw) != want {
+		t.Fatalf("unexpected steps:\n%s", raw)
+	}
+}
+
+func TestBuildBatchSteps_ChainsNonAtomicBatch(t *testing.T) {
+	steps := buildBatchSteps([]string{"CREATE TABLE a (id INTEGER)", "VACUUM"}, false)
+	if len(steps) != 2 || steps[0].Condition != nil || steps[1].Stmt.SQL != "VACUUM" {
+		t.Fatalf("unexpected steps: %+v", steps)
+	}
+	if cond := steps[1].Condition; cond == nil || cond.Type != "ok" || *cond.Step != 0 {
+		t.Fatalf("expected VACUUM to depend on the first step, got %+v", cond)
+	}
+}
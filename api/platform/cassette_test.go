@@ -0,0 +1,52 @@
+package platform
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/atombasedev/atombase/config"
+	"github.com/atombasedev/atombase/tools"
+)
+
+// TestProvisioning_ReplaysTursoCassette drives database provisioning through the
+// real Turso client against a recorded cassette.
+func TestProvisioning_ReplaysTursoCassette(t *testing.T) {
+	api, db := setupPlatformAPI(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	oldCfg, oldClient := config.Cfg, tools.TursoHTTPClient
+	defer func() { config.Cfg, tools.TursoHTTPClient = oldCfg, oldClient }()
+	config.Cfg.TursoOrganization = "ci"
+	config.Cfg.LocalTenantDir = ""
+	cassette, err := tools.NewTursoCassette(tools.CassetteReplay, "testdata/turso_provisioning.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tools.TursoHTTPClient = &http.Client{Transport: cassette}
+
+	if _, err := api.createDefinition(ctx, CreateDefinitionRequest{
+		Name: "catalog",
+		Type: "global",
+		Schema: Schema{Tables: []Table{{Name: "products", Pk: []string{"id"}, Columns: map[string]Col{
+			"id":   {Name: "id", Type: "INTEGER"},
+			"name": {Name: "name", Type: "TEXT"},
+		}}}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := api.createDatabase(ctx, CreateDatabaseRequest{ID: "catalog-1", Definition: "catalog"}); err != nil {
+		t.Fatalf("createDatabase failed: %v", err)
+	}
+	var token string
+	if err := db.QueryRow(`SELECT auth_token_encrypted FROM atombase_databases WHERE id = 'catalog-1'`).Scan(&token); err != nil || token != "[redacted]" {
+		t.Fatalf("expected the recorded token placeholder to be stored, got %q (%v)", token, err)
+	}
+	if err := api.deleteDatabase(ctx, "catalog-1"); err != nil {
+		t.Fatalf("deleteDatabase failed: %v", err)
+	}
+	if unused := cassette.Unused(); len(unused) != 0 {
+		t.Fatalf("provisioning skipped recorded calls: %+v", unused)
+	}
+}
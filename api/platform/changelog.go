@@ -0,0 +1,424 @@
+package platform
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/atombasedev/atombase/tools"
+)
+
+const auditDatabaseRestored = "database.restored"
+
+// changelogTime is how change log entries stamp the time of a change.
+const changelogTime = "2006-01-02T15:04:05.000Z"
+
+// Columns of a change log entry's values that one json_object call takes,
+// well under SQLite's limit on function arguments.
+const changelogChunk = 50
+
+// changelogSQL creates the log of row changes kept by databases whose
+// definition sets settings.backup.pointInTime. Entries are only appended:
+// each holds the key a change was made at and, unless the row was deleted,
+// the row's new values, so replaying the entries after a backup onto it
+// brings it to any later time. BLOB values are logged as {"blob": hex}.
+const changelogSQL = `CREATE TABLE IF NOT EXISTS atombase_changelog (
+  seq INTEGER PRIMARY KEY AUTOINCREMENT,
+  at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%fZ', 'now')),
+  tbl TEXT NOT NULL,
+  op TEXT NOT NULL,
+  key TEXT NOT NULL,
+  row TEXT
+)`
+
+// pointInTime reports whether the databases of a schema log their row
+// changes.
+func pointInTime(schema Schema) bool {
+	return schema.Settings != nil && schema.Settings.Backup != nil && schema.Settings.Backup.PointInTime
+}
+
+// changelogKey returns the columns a table's logged rows are found by: its
+// primary key, or the rowid of a table without one.
+func changelogKey(table Table) []string {
+	if len(table.Pk) == 0 {
+		return []string{"rowid"}
+	}
+	return table.Pk
+}
+
+// changelogColumns returns the columns a table's logged rows hold.
+func changelogColumns(table Table) []string {
+	columns := storedColumns(table)
+	if len(table.Pk) == 0 {
+		columns = append(columns, "rowid")
+	}
+	return columns
+}
+
+// changelogJSON builds the JSON object of the columns of the row ref (NEW or
+// OLD) names.
+func changelogJSON(ref string, columns []string) string {
+	var parts []string
+	for start := 0; start < len(columns); start += changelogChunk {
+		var args []string
+		for _, col := range columns[start:min(start+changelogChunk, len(columns))] {
+			value := fmt.Sprintf("%s.[%s]", ref, col)
+			args = append(args, fmt.Sprintf("'%s', CASE WHEN typeof(%s) = 'blob' THEN json_object('blob', hex(%s)) ELSE %s END",
+				strings.ReplaceAll(col, "'", "''"), value, value, value))
+		}
+		parts = append(parts, "json_object("+strings.Join(args, ", ")+")")
+	}
+	object := parts[0]
+	for _, part := range parts[1:] {
+		object = fmt.Sprintf("json_patch(%s, %s)", object, part)
+	}
+	return object
+}
+
+// generateChangelogSQL creates the change log and the triggers logging the
+// changes to every table of schema. Time-series tables are not logged.
+func generateChangelogSQL(schema Schema) []string {
+	statements := []string{changelogSQL}
+	for _, table := range schema.Tables {
+		if table.TimeSeries != nil {
+			continue
+		}
+		name := strings.ReplaceAll(table.Name, "'", "''")
+		key, columns := changelogKey(table), changelogColumns(table)
+		logRow := func(op, keyRef, rowRef string) string {
+			row := "NULL"
+			if rowRef != "" {
+				row = changelogJSON(rowRef, columns)
+			}
+			return fmt.Sprintf("INSERT INTO atombase_changelog (tbl, op, key, row) VALUES ('%s', '%s', %s, %s);",
+				name, op, changelogJSON(keyRef, key), row)
+		}
+		statements = append(statements,
+			fmt.Sprintf("CREATE TRIGGER IF NOT EXISTS [%s_changelog_ai] AFTER INSERT ON [%s] BEGIN\n  %s\nEND",
+				table.Name, table.Name, logRow("insert", "NEW", "NEW")),
+			fmt.Sprintf("CREATE TRIGGER IF NOT EXISTS [%s_changelog_au] AFTER UPDATE ON [%s] BEGIN\n  %s\nEND",
+				table.Name, table.Name, logRow("update", "OLD", "NEW")),
+			fmt.Sprintf("CREATE TRIGGER IF NOT EXISTS [%s_changelog_ad] AFTER DELETE ON [%s] BEGIN\n  %s\nEND",
+				table.Name, table.Name, logRow("delete", "OLD", "")),
+		)
+	}
+	return statements
+}
+
+func dropChangelogTriggersSQL(table string) []string {
+	return []string{
+		fmt.Sprintf("DROP TRIGGER IF EXISTS [%s_changelog_ai]", table),
+		fmt.Sprintf("DROP TRIGGER IF EXISTS [%s_changelog_au]", table),
+		fmt.Sprintf("DROP TRIGGER IF EXISTS [%s_changelog_ad]", table),
+	}
+}
+
+// changelogMigrationSQL wraps the table SQL of a migration to or from a
+// schema whose databases log their changes. The triggers name every column,
+// so they are dropped before the tables change and made again from the new
+// schema after. Turning the log off drops it.
+func changelogMigrationSQL(oldSchema, newSchema Schema, tableSQL []string) []string {
+	var statements []string
+	if pointInTime(oldSchema) {
+		for _, table := range oldSchema.Tables {
+			statements = append(statements, dropChangelogTriggersSQL(table.Name)...)
+		}
+		if !pointInTime(newSchema) {
+			statements = append(statements, "DROP TABLE IF EXISTS atombase_changelog")
+		}
+	}
+	statements = append(statements, tableSQL...)
+	if pointInTime(newSchema) {
+		statements = append(statements, generateChangelogSQL(newSchema)...)
+	}
+	return statements
+}
+
+// changelogSeq returns the last change log entry of the SQLite database at
+// path, or NULL when it keeps no log.
+func changelogSeq(ctx context.Context, path string) (sql.NullInt64, error) {
+	db, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return sql.NullInt64{}, err
+	}
+	defer db.Close()
+	var seq sql.NullInt64
+	var logged bool
+	if err := db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = 'atombase_changelog')`).Scan(&logged); err != nil || !logged {
+		return seq, err
+	}
+	err = db.QueryRowContext(ctx, `SELECT COALESCE(MAX(seq), 0) FROM atombase_changelog`).Scan(&seq)
+	return seq, err
+}
+
+// pruneChangelog drops the change log entries of a database that its
+// oldest finished backup at its version already holds. Backups at other
+// versions can't be replayed onto, and may predate the log. The backup's
+// last entry is kept, so a restore can check the log still follows on from
+// it.
+func (api *API) pruneChangelog(ctx context.Context, databaseID string) error {
+	conn, err := api.dbConn()
+	if err != nil {
+		return err
+	}
+	var seq sql.NullInt64
+	if err := conn.QueryRowContext(ctx, `
+		SELECT MIN(b.changelog_seq) FROM atombase_backups b
+		JOIN atombase_databases d ON d.id = b.database_id AND d.definition_version = b.definition_version
+		WHERE b.database_id = ? AND b.status = ?
+	`, databaseID, BackupDone).Scan(&seq); err != nil || !seq.Valid {
+		return err
+	}
+	token, err := api.getDatabaseToken(ctx, databaseID)
+	if err != nil {
+		return err
+	}
+	return batchExecuteWithTokenFn(ctx, databaseID, token, []string{fmt.Sprintf("DELETE FROM atombase_changelog WHERE seq < %d", seq.Int64)})
+}
+
+// restoreDatabaseAt replaces the rows of a database with its rows as they
+// were at a point in time: the newest backup finished by then, taken at the
+// version the database is on, with the changes logged after it up to at
+// replayed onto it. The result is imported in replace mode, so the restore
+// is logged like any other change and a later restore can go past it.
+func (api *API) restoreDatabaseAt(ctx context.Context, id string, at time.Time, dryRun bool) (*RestoreDatabaseResponse, error) {
+	if at.After(time.Now()) {
+		return nil, tools.InvalidRequestErr("at is in the future")
+	}
+	db, err := api.getDatabase(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	schema, err := api.loadDefinitionSchema(ctx, db.DefinitionID, db.DefinitionVersion)
+	if err != nil {
+		return nil, err
+	}
+	if !pointInTime(schema) {
+		return nil, tools.InvalidRequestErr(fmt.Sprintf("version %d of definition %s does not log changes; set settings.backup.pointInTime to restore its databases to a point in time",
+			db.DefinitionVersion, db.DefinitionName))
+	}
+	conn, err := api.dbConn()
+	if err != nil {
+		return nil, err
+	}
+	// finished_at is kept to the second, so a backup that finished in the
+	// same second as at may hold later changes.
+	var backup Backup
+	var seq int64
+	err = conn.QueryRowContext(ctx, `
+		SELECT id, location, changelog_seq FROM atombase_backups
+		WHERE database_id = ? AND status = ? AND definition_version = ? AND changelog_seq IS NOT NULL AND finished_at < ?
+		ORDER BY finished_at DESC, rowid DESC
+		LIMIT 1
+	`, id, BackupDone, db.DefinitionVersion, at.UTC().Truncate(time.Second).Format(time.RFC3339)).Scan(&backup.ID, &backup.Location, &seq)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, tools.InvalidRequestErr(fmt.Sprintf("no backup of %s at version %d with a change log finished before %s",
+			id, db.DefinitionVersion, at.UTC().Format(time.RFC3339)))
+	}
+	if err != nil {
+		return nil, err
+	}
+	token, err := api.getDatabaseToken(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	store, err := backupStoreAt(backup.Location)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp("", "atombase-point-in-time-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, backup.ID+".db")
+	if err := downloadBackup(ctx, store, backupKey(id, backup.ID), path); err != nil {
+		return nil, fmt.Errorf("failed to read backup %s: %w", backup.ID, err)
+	}
+	live, err := tursoOpenFn(id, token)
+	if err != nil {
+		return nil, err
+	}
+	defer live.Close()
+	replayed, err := replayChangelog(ctx, live, path, schema, backup.ID, seq, at)
+	if err != nil {
+		return nil, err
+	}
+
+	imported, err := api.applyImport(ctx, db, token, path, importReplace, dryRun)
+	if err != nil {
+		return nil, err
+	}
+	resp := &RestoreDatabaseResponse{ImportDatabaseResponse: *imported, At: at.UTC(), Backup: backup.ID, Replayed: replayed}
+	if dryRun {
+		return resp, nil
+	}
+	if err := api.recordAudit(ctx, auditDatabaseRestored, id, map[string]any{
+		"at": resp.At.Format(time.RFC3339), "backup": backup.ID, "replayed": replayed, "rows": resp.Rows,
+	}); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// replayChangelog applies the changes live logged after entry seq, up to at,
+// to the backup at path. The backup's last entry must still be in live's
+// log, the same as in the backup, or changes after it may be missing.
+func replayChangelog(ctx context.Context, live *sql.DB, path string, schema Schema, backupID string, seq int64, at time.Time) (int64, error) {
+	snapshot, err := sql.Open("sqlite3", "file:"+path)
+	if err != nil {
+		return 0, err
+	}
+	defer snapshot.Close()
+
+	gone := tools.InvalidRequestErr(fmt.Sprintf("the change log no longer follows on from backup %s", backupID))
+	if seq > 0 {
+		var want, got string
+		if err := snapshot.QueryRowContext(ctx, `SELECT at || tbl || key FROM atombase_changelog WHERE seq = ?`, seq).Scan(&want); err != nil {
+			return 0, err
+		}
+		err := live.QueryRowContext(ctx, `SELECT at || tbl || key FROM atombase_changelog WHERE seq = ?`, seq).Scan(&got)
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && got != want) {
+			return 0, gone
+		}
+		if err != nil {
+			return 0, err
+		}
+	} else {
+		var first sql.NullInt64
+		if err := live.QueryRowContext(ctx, `SELECT MIN(seq) FROM atombase_changelog`).Scan(&first); err != nil {
+			return 0, err
+		}
+		if first.Int64 > 1 {
+			return 0, gone
+		}
+	}
+
+	tables := make(map[string]Table, len(schema.Tables))
+	for _, table := range schema.Tables {
+		if table.TimeSeries == nil {
+			tables[table.Name] = table
+		}
+	}
+	rows, err := live.QueryContext(ctx, `
+		SELECT seq, tbl, op, key, row FROM atombase_changelog
+		WHERE seq > ? AND at <= ?
+		ORDER BY seq
+	`, seq, at.UTC().Format(changelogTime))
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	tx, err := snapshot.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	var replayed int64
+	for rows.Next() {
+		var entry int64
+		var tbl, op, key string
+		var row sql.NullString
+		if err := rows.Scan(&entry, &tbl, &op, &key, &row); err != nil {
+			return 0, err
+		}
+		table, ok := tables[tbl]
+		if !ok {
+			return 0, fmt.Errorf("change log entry %d is for unknown table %s", entry, tbl)
+		}
+		if err := replayChange(ctx, tx, table, op, key, row.String); err != nil {
+			return 0, fmt.Errorf("change log entry %d: %w", entry, err)
+		}
+		replayed++
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	return replayed, tx.Commit()
+}
+
+// replayChange applies one logged change. The row at the change's key is
+// deleted and, unless the change was a delete, written again with the
+// logged values. Deletes a REPLACE made are not logged, so the write
+// replaces rows in its way too.
+func replayChange(ctx context.Context, tx *sql.Tx, table Table, op, keyJSON, rowJSON string) error {
+	allowed := changelogColumns(table)
+	key, err := decodeChangelogValues(keyJSON, allowed)
+	if err != nil {
+		return err
+	}
+	keyCols := changelogKey(table)
+	where := make([]string, len(keyCols))
+	args := make([]any, len(keyCols))
+	for i, col := range keyCols {
+		where[i] = fmt.Sprintf("[%s] IS ?", col)
+		args[i] = key[col]
+	}
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM [%s] WHERE %s", table.Name, strings.Join(where, " AND ")), args...); err != nil {
+		return err
+	}
+	if op == "delete" {
+		return nil
+	}
+	row, err := decodeChangelogValues(rowJSON, allowed)
+	if err != nil {
+		return err
+	}
+	columns := make([]string, 0, len(row))
+	values := make([]any, 0, len(row))
+	for _, col := range allowed {
+		if value, ok := row[col]; ok {
+			columns = append(columns, fmt.Sprintf("[%s]", col))
+			values = append(values, value)
+		}
+	}
+	_, err = tx.ExecContext(ctx, fmt.Sprintf("INSERT OR REPLACE INTO [%s] (%s) VALUES (%s)",
+		table.Name, strings.Join(columns, ", "), strings.TrimRight(strings.Repeat("?, ", len(columns)), ", ")), values...)
+	return err
+}
+
+// decodeChangelogValues decodes a logged key or row back into the values
+// SQLite stored, refusing columns outside allowed.
+func decodeChangelogValues(raw string, allowed []string) (map[string]any, error) {
+	dec := json.NewDecoder(bytes.NewReader([]byte(raw)))
+	dec.UseNumber()
+	var fields map[string]any
+	if err := dec.Decode(&fields); err != nil {
+		return nil, err
+	}
+	values := make(map[string]any, len(fields))
+	for col, value := range fields {
+		if !slices.Contains(allowed, col) {
+			return nil, fmt.Errorf("unknown column %s", col)
+		}
+		switch v := value.(type) {
+		case json.Number:
+			if n, err := v.Int64(); err == nil && !strings.ContainsAny(v.String(), ".eE") {
+				values[col] = n
+			} else {
+				// Infinities are logged past the range of a float.
+				f, _ := v.Float64()
+				values[col] = f
+			}
+		case map[string]any:
+			blob, err := hex.DecodeString(fmt.Sprint(v["blob"]))
+			if err != nil {
+				return nil, fmt.Errorf("column %s: %w", col, err)
+			}
+			values[col] = blob
+		default:
+			values[col] = v
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,186 @@
+package platform
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/atombasedev/atombase/config"
+)
+
+func TestRestoreDatabaseAt(t *testing.T) {
+	api, db := setupPlatformAPI(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	oldOpen, oldCreate, oldToken, oldBatch, oldExport := tursoOpenFn, createTenantDatabaseFn, createTenantTokenFn, batchExecuteWithTokenFn, exportTenantSQLiteFn
+	oldDir, oldBucket := config.Cfg.BackupDir, config.Cfg.BackupS3URL
+	defer func() {
+		tursoOpenFn, createTenantDatabaseFn, createTenantTokenFn, batchExecuteWithTokenFn, exportTenantSQLiteFn = oldOpen, oldCreate, oldToken, oldBatch, oldExport
+		config.Cfg.BackupDir, config.Cfg.BackupS3URL = oldDir, oldBucket
+	}()
+	config.Cfg.BackupDir, config.Cfg.BackupS3URL = t.TempDir(), ""
+	tursoOpenFn = func(name, token string) (*sql.DB, error) { return sql.Open("sqlite3", filepath.Join(dir, name+".db")) }
+	createTenantDatabaseFn = func(ctx context.Context, name, group string) error { return nil }
+	createTenantTokenFn = func(ctx context.Context, name string) (string, error) { return "token", nil }
+	batchExecuteWithTokenFn = func(ctx context.Context, name, token string, statements []string) error {
+		conn, _ := tursoOpenFn(name, token)
+		defer conn.Close()
+		for _, stmt := range statements {
+			if _, err := conn.Exec(stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	exportTenantSQLiteFn = func(ctx context.Context, name, token string, version int, path string) error {
+		conn, _ := tursoOpenFn(name, token)
+		defer conn.Close()
+		_, err := conn.ExecContext(ctx, `VACUUM INTO ?`, path)
+		return err
+	}
+
+	if _, err := api.createDefinition(ctx, CreateDefinitionRequest{
+		Name: "notes",
+		Type: "global",
+		Schema: Schema{
+			Tables: []Table{
+				{Name: "notes", Pk: []string{"id"}, Columns: map[string]Col{
+					"id":   {Name: "id", Type: "INTEGER"},
+					"body": {Name: "body", Type: "TEXT"},
+					"data": {Name: "data", Type: "BLOB"},
+				}},
+				{Name: "tags", Columns: map[string]Col{"name": {Name: "name", Type: "TEXT"}}},
+			},
+			Settings: &APISettings{Backup: &BackupPolicy{Interval: "1h", PointInTime: true}},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := api.createDatabase(ctx, CreateDatabaseRequest{ID: "notes-1", Definition: "notes"}); err != nil {
+		t.Fatal(err)
+	}
+	tenant, _ := tursoOpenFn("notes-1", "")
+	defer tenant.Close()
+	exec := func(query string, args ...any) {
+		t.Helper()
+		if _, err := tenant.Exec(query, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exec(`INSERT INTO notes (id, body, data) VALUES (1, 'first', x'00ff'); INSERT INTO tags (name) VALUES ('a')`)
+
+	base := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	if err := api.runDueBackups(ctx, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	conn, _ := api.dbConn()
+	var backupSeq int64
+	if err := conn.QueryRow(`SELECT changelog_seq FROM atombase_backups WHERE database_id = 'notes-1'`).Scan(&backupSeq); err != nil || backupSeq != 2 {
+		t.Fatalf("expected the backup to hold two logged changes, got %d, %v", backupSeq, err)
+	}
+	if _, err := conn.Exec(`UPDATE atombase_backups SET finished_at = ?`, base.Format(time.RFC3339)); err != nil {
+		t.Fatal(err)
+	}
+	// Changes are logged at the time they run; these are moved into the past.
+	logAt := func(at time.Time) {
+		exec(`UPDATE atombase_changelog SET at = ? WHERE seq > ? AND at > ?`, at.Format(changelogTime), backupSeq, base.Add(30*time.Minute).Format(changelogTime))
+	}
+	exec(`UPDATE notes SET body = 'second' WHERE id = 1; INSERT INTO notes (id, body) VALUES (2, 'added'); DELETE FROM tags`)
+	logAt(base.Add(10 * time.Minute))
+	exec(`UPDATE notes SET id = 3, body = 'third' WHERE id = 1; DELETE FROM notes WHERE id = 2`)
+	logAt(base.Add(20 * time.Minute))
+
+	rowsOf := func() string {
+		t.Helper()
+		var notes, tags sql.NullString
+		if err := tenant.QueryRow(`SELECT group_concat(id || ':' || body || ':' || coalesce(hex(data), ''), ',') FROM (SELECT * FROM notes ORDER BY id)`).Scan(&notes); err != nil {
+			t.Fatal(err)
+		}
+		if err := tenant.QueryRow(`SELECT group_concat(name) FROM tags`).Scan(&tags); err != nil {
+			t.Fatal(err)
+		}
+		return notes.String + "|" + tags.String
+	}
+
+	resp, err := api.restoreDatabaseAt(ctx, "notes-1", base.Add(15*time.Minute), true)
+	if err != nil || !resp.Valid || resp.Replayed != 3 || resp.Rows != 2 {
+		t.Fatalf("expected a dry run replaying three changes, got %+v, %v", resp, err)
+	}
+	if got := rowsOf(); got != "3:third:00FF|" {
+		t.Fatalf("expected the dry run to change nothing, got %s", got)
+	}
+	if _, err := api.restoreDatabaseAt(ctx, "notes-1", base.Add(15*time.Minute), false); err != nil {
+		t.Fatal(err)
+	}
+	if got := rowsOf(); got != "1:second:00FF,2:added:|" {
+		t.Fatalf("expected the rows as of 15 minutes in, got %s", got)
+	}
+	// The restore was logged, so a later point can still be restored to.
+	if resp, err = api.restoreDatabaseAt(ctx, "notes-1", base.Add(25*time.Minute), false); err != nil || resp.Replayed != 5 {
+		t.Fatalf("expected five changes replayed, got %+v, %v", resp, err)
+	}
+	if got := rowsOf(); got != "3:third:00FF|" {
+		t.Fatalf("expected the rows as of 25 minutes in, got %s", got)
+	}
+
+	if _, err := api.restoreDatabaseAt(ctx, "notes-1", base.Add(-time.Minute), false); err == nil || !strings.Contains(err.Error(), "no backup") {
+		t.Fatalf("expected a time before the first backup to be refused, got %v", err)
+	}
+	if err := api.pruneChangelog(ctx, "notes-1"); err != nil {
+		t.Fatal(err)
+	}
+	var first int64
+	if err := tenant.QueryRow(`SELECT MIN(seq) FROM atombase_changelog`).Scan(&first); err != nil || first != backupSeq {
+		t.Fatalf("expected the log pruned up to the backup's last entry, got %d, %v", first, err)
+	}
+	exec(`DELETE FROM atombase_changelog WHERE seq = ?`, backupSeq)
+	if _, err := api.restoreDatabaseAt(ctx, "notes-1", base.Add(15*time.Minute), false); err == nil || !strings.Contains(err.Error(), "no longer follows") {
+		t.Fatalf("expected a log that lost the backup's last entry to be refused, got %v", err)
+	}
+}
+
+func TestChangelogMigrationSQL(t *testing.T) {
+	ctx := context.Background()
+	old := Schema{Tables: []Table{{Name: "notes", Pk: []string{"id"}, Columns: map[string]Col{
+		"id":   {Name: "id", Type: "INTEGER"},
+		"body": {Name: "body", Type: "TEXT"},
+	}}}}
+	logged := old
+	logged.Settings = &APISettings{Backup: &BackupPolicy{Interval: "1h", PointInTime: true}}
+
+	plan, err := GenerateMigrationPlan(old, logged, diffSchemas(old, logged), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.SQL) != 4 || plan.SQL[0] != changelogSQL {
+		t.Fatalf("expected turning the log on to create it, got %v", plan.SQL)
+	}
+
+	// The triggers read every column, so dropping one makes them again.
+	dropped := Schema{Tables: []Table{{Name: "notes", Pk: []string{"id"}, Columns: map[string]Col{
+		"id": {Name: "id", Type: "INTEGER"},
+	}}}, Settings: logged.Settings}
+	plan, err = GenerateMigrationPlan(logged, dropped, diffSchemas(logged, dropped), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyMigrationPlan(ctx, logged, dropped, plan.SQL, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(plan.SQL[0], "DROP TRIGGER") || strings.Contains(strings.Join(plan.SQL[4:], ";"), "body") {
+		t.Fatalf("expected the triggers dropped and made without body, got %v", plan.SQL)
+	}
+
+	plan, err = GenerateMigrationPlan(logged, old, diffSchemas(logged, old), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.SQL) != 4 || plan.SQL[3] != "DROP TABLE IF EXISTS atombase_changelog" {
+		t.Fatalf("expected turning the log off to drop it, got %v", plan.SQL)
+	}
+}
@@ -0,0 +1,259 @@
+package platform
+
+import (
+	"context"
+	"fmt"
+	"go/format"
+	"go/token"
+	"sort"
+	"strings"
+
+	"github.com/atombasedev/atombase/tools"
+)
+
+// Languages GET /platform/definitions/{name}/types renders.
+const (
+	TypesLangTS = "ts"
+	TypesLangGo = "go"
+)
+
+// definitionTypes renders the schema of a definition version, the current one
+// when version is 0, as source code in lang. pkg names the Go package.
+func (api *API) definitionTypes(ctx context.Context, name, lang, pkg string, version int) (string, error) {
+	switch lang {
+	case "":
+		lang = TypesLangTS
+	case TypesLangTS, TypesLangGo:
+	default:
+		return "", tools.InvalidRequestErr(fmt.Sprintf("unknown lang %q (expected %s or %s)", lang, TypesLangTS, TypesLangGo))
+	}
+	if pkg == "" {
+		pkg = "models"
+	}
+	if lang == TypesLangGo && (!token.IsIdentifier(pkg) || token.IsKeyword(pkg)) {
+		return "", tools.InvalidRequestErr(fmt.Sprintf("package %q is not a Go identifier", pkg))
+	}
+
+	history, err := api.getDefinitionHistory(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	if len(history) == 0 {
+		return "", fmt.Errorf("definition %s has no history", name)
+	}
+	selected := history[0]
+	if version != 0 {
+		found := false
+		for _, item := range history {
+			if item.Version == version {
+				selected, found = item, true
+				break
+			}
+		}
+		if !found {
+			return "", tools.VersionNotFoundErr(version)
+		}
+	}
+
+	header := fmt.Sprintf("generated from definition %s version %d", name, selected.Version)
+	if lang == TypesLangGo {
+		return renderGoTypes(header, pkg, selected.Schema), nil
+	}
+	return renderTSTypes(header, selected.Schema), nil
+}
+
+// codegenColumn is a column as the Data API returns it.
+type codegenColumn struct {
+	name      string
+	sqlType   string
+	nullable  bool
+	optional  bool // Inserts may leave it out
+	generated bool
+}
+
+// tableColumns lists a table's columns, primary key first and the rest by
+// name.
+func tableColumns(table Table) []codegenColumn {
+	inPk := make(map[string]bool, len(table.Pk))
+	for _, name := range table.Pk {
+		inPk[name] = true
+	}
+	names := append([]string{}, table.Pk...)
+	for _, name := range sortedKeys(table.Columns) {
+		if !inPk[name] {
+			names = append(names, name)
+		}
+	}
+	rowid := len(table.Pk) == 1 && strings.EqualFold(table.Columns[table.Pk[0]].Type, "INTEGER")
+	columns := make([]codegenColumn, 0, len(names))
+	for _, name := range names {
+		col := table.Columns[name]
+		nullable := !col.NotNull && !inPk[name]
+		columns = append(columns, codegenColumn{
+			name:      name,
+			sqlType:   strings.ToUpper(col.Type),
+			nullable:  nullable,
+			optional:  nullable || col.Default != nil || (rowid && inPk[name]),
+			generated: col.Generated != nil,
+		})
+	}
+	return columns
+}
+
+// viewColumns lists a view's columns by name. Any of them may be null.
+func viewColumns(view View) []codegenColumn {
+	columns := make([]codegenColumn, 0, len(view.Columns))
+	for _, name := range sortedKeys(view.Columns) {
+		columns = append(columns, codegenColumn{name: name, sqlType: strings.ToUpper(view.Columns[name]), nullable: true})
+	}
+	return columns
+}
+
+// renderTSTypes writes a row interface and an insert interface per table, a
+// row interface per view, and a Tables map from table name to row type.
+func renderTSTypes(header string, schema Schema) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "// Code %s. DO NOT EDIT.\n", header)
+	tables := sortedTables(schema.Tables)
+	for _, table := range tables {
+		columns := tableColumns(table)
+		typeName := exportedName(table.Name)
+		fmt.Fprintf(&b, "\nexport interface %s {\n", typeName)
+		for _, col := range columns {
+			fmt.Fprintf(&b, "  %s: %s;\n", col.name, tsType(col))
+		}
+		fmt.Fprintf(&b, "}\n\nexport interface %sInsert {\n", typeName)
+		for _, col := range columns {
+			if col.generated {
+				continue
+			}
+			optional := ""
+			if col.optional {
+				optional = "?"
+			}
+			fmt.Fprintf(&b, "  %s%s: %s;\n", col.name, optional, tsType(col))
+		}
+		b.WriteString("}\n")
+	}
+	for _, view := range schema.Views {
+		fmt.Fprintf(&b, "\nexport interface %s {\n", exportedName(view.Name))
+		for _, col := range viewColumns(view) {
+			fmt.Fprintf(&b, "  readonly %s: %s;\n", col.name, tsType(col))
+		}
+		b.WriteString("}\n")
+	}
+	b.WriteString("\nexport interface Tables {\n")
+	for _, table := range tables {
+		fmt.Fprintf(&b, "  %s: %s;\n", table.Name, exportedName(table.Name))
+	}
+	for _, view := range schema.Views {
+		fmt.Fprintf(&b, "  %s: %s;\n", view.Name, exportedName(view.Name))
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+func tsType(col codegenColumn) string {
+	var base string
+	switch col.sqlType {
+	case "INTEGER", "REAL":
+		base = "number"
+	case "TEXT", "BLOB": // Blobs come back base64 encoded
+		base = "string"
+	default:
+		return "unknown"
+	}
+	if col.nullable {
+		return base + " | null"
+	}
+	return base
+}
+
+// renderGoTypes writes a gofmt-ed struct per table and view. Nullable
+// columns are pointers.
+func renderGoTypes(header, pkg string, schema Schema) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "// Code %s. DO NOT EDIT.\n\npackage %s\n", header, pkg)
+	writeStruct := func(name string, columns []codegenColumn) {
+		fmt.Fprintf(&b, "\ntype %s struct {\n", exportedName(name))
+		for _, col := range columns {
+			fmt.Fprintf(&b, "\t%s %s `json:\"%s\"`\n", goFieldName(col.name), goType(col), col.name)
+		}
+		b.WriteString("}\n")
+	}
+	for _, table := range sortedTables(schema.Tables) {
+		writeStruct(table.Name, tableColumns(table))
+	}
+	for _, view := range schema.Views {
+		writeStruct(view.Name, viewColumns(view))
+	}
+	if formatted, err := format.Source([]byte(b.String())); err == nil {
+		return string(formatted)
+	}
+	return b.String()
+}
+
+func goType(col codegenColumn) string {
+	var base string
+	switch col.sqlType {
+	case "INTEGER":
+		base = "int64"
+	case "REAL":
+		base = "float64"
+	case "TEXT":
+		base = "string"
+	case "BLOB":
+		return "[]byte"
+	default:
+		return "any"
+	}
+	if col.nullable {
+		return "*" + base
+	}
+	return base
+}
+
+// goInitialisms are name parts written in capitals, as golint expects.
+var goInitialisms = map[string]bool{"id": true, "url": true, "uri": true, "api": true, "ip": true, "uuid": true, "json": true, "html": true, "http": true, "sql": true}
+
+func goFieldName(name string) string {
+	var b strings.Builder
+	for _, part := range strings.Split(name, "_") {
+		if goInitialisms[strings.ToLower(part)] {
+			b.WriteString(strings.ToUpper(part))
+		} else {
+			b.WriteString(capitalize(part))
+		}
+	}
+	field := b.String()
+	if field == "" || !token.IsIdentifier(field) || !token.IsExported(field) {
+		return "X" + field
+	}
+	return field
+}
+
+// exportedName turns a snake_case table name into a PascalCase type name.
+func exportedName(name string) string {
+	var b strings.Builder
+	for _, part := range strings.Split(name, "_") {
+		b.WriteString(capitalize(part))
+	}
+	typeName := b.String()
+	if typeName == "" || !token.IsExported(typeName) {
+		return "T" + typeName
+	}
+	return typeName
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+func sortedTables(tables []Table) []Table {
+	sorted := append([]Table{}, tables...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	return sorted
+}
@@ -0,0 +1,80 @@
+package platform
+
+import (
+	"context"
+	"errors"
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+
+	"github.com/atombasedev/atombase/tools"
+)
+
+func TestDefinitionTypes(t *testing.T) {
+	api, db := setupPlatformAPI(t)
+	defer db.Close()
+
+	v1 := Schema{Tables: []Table{{Name: "user_posts", Pk: []string{"id"}, Columns: map[string]Col{
+		"id":        {Name: "id", Type: "INTEGER"},
+		"title":     {Name: "title", Type: "TEXT", NotNull: true},
+		"author_id": {Name: "author_id", Type: "INTEGER"},
+	}}}}
+	if _, err := api.createDefinition(context.Background(), CreateDefinitionRequest{Name: "blog", Type: "global", Schema: v1}); err != nil {
+		t.Fatalf("createDefinition failed: %v", err)
+	}
+	v2 := Schema{Tables: []Table{{Name: "user_posts", Pk: []string{"id"}, Columns: map[string]Col{
+		"id":        {Name: "id", Type: "INTEGER"},
+		"title":     {Name: "title", Type: "TEXT", NotNull: true},
+		"author_id": {Name: "author_id", Type: "INTEGER"},
+		"score":     {Name: "score", Type: "REAL", NotNull: true, Default: 0},
+	}}}}
+	if _, err := api.pushDefinition(context.Background(), "blog", PushDefinitionRequest{Schema: v2}); err != nil {
+		t.Fatalf("pushDefinition failed: %v", err)
+	}
+
+	ts, err := api.definitionTypes(context.Background(), "blog", "", "", 0)
+	if err != nil {
+		t.Fatalf("ts types failed: %v", err)
+	}
+	for _, want := range []string{
+		"definition blog version 2",
+		"export interface UserPosts {\n  id: number;\n  author_id: number | null;\n",
+		"  score: number;\n",
+		"export interface UserPostsInsert {\n  id?: number;\n",
+		"  score?: number;\n  title: string;\n",
+		"  user_posts: UserPosts;\n",
+	} {
+		if !strings.Contains(ts, want) {
+			t.Fatalf("ts output missing %q:\n%s", want, ts)
+		}
+	}
+
+	old, err := api.definitionTypes(context.Background(), "blog", TypesLangTS, "", 1)
+	if err != nil || strings.Contains(old, "score") {
+		t.Fatalf("expected version 1 without score, got %v:\n%s", err, old)
+	}
+
+	src, err := api.definitionTypes(context.Background(), "blog", TypesLangGo, "blogdb", 0)
+	if err != nil {
+		t.Fatalf("go types failed: %v", err)
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "types.go", src, 0); err != nil {
+		t.Fatalf("generated Go does not parse: %v\n%s", err, src)
+	}
+	for _, want := range []string{"package blogdb", "type UserPosts struct", "AuthorID *int64  `json:\"author_id\"`", "Score    float64 `json:\"score\"`"} {
+		if !strings.Contains(src, want) {
+			t.Fatalf("go output missing %q:\n%s", want, src)
+		}
+	}
+
+	if _, err := api.definitionTypes(context.Background(), "blog", TypesLangTS, "", 7); !errors.Is(err, tools.ErrVersionNotFound) {
+		t.Fatalf("expected ErrVersionNotFound, got %v", err)
+	}
+	if _, err := api.definitionTypes(context.Background(), "blog", "rust", "", 0); err == nil {
+		t.Fatal("expected unknown lang to be rejected")
+	}
+	if _, err := api.definitionTypes(context.Background(), "blog", TypesLangGo, "func", 0); err == nil {
+		t.Fatal("expected keyword package name to be rejected")
+	}
+}
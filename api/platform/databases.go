@@ -5,6 +5,8 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -12,6 +14,8 @@ import (
 	"github.com/atombasedev/atombase/tools"
 )
 
+const auditDatabaseExported = "database.exported"
+
 var (
 	ErrDatabaseNotFound = tools.ErrDatabaseNotFoundPlatform
 	ErrDatabaseExists   = tools.ErrDatabaseExists
@@ -22,14 +26,17 @@ func (api *API) listDatabases(ctx context.Context) ([]DatabaseRecord, error) {
 	if err != nil {
 		return nil, err
 	}
+	org := callerOrg(ctx)
 	rows, err := conn.QueryContext(ctx, `
 		SELECT d.id, d.definition_id, def.name, def.definition_type, d.definition_version, d.created_at, d.updated_at,
-		       COALESCE(o.owner_id, ''), COALESCE(o.id, ''), COALESCE(o.name, '')
+		       COALESCE(o.owner_id, ''), COALESCE(o.id, ''), COALESCE(o.name, ''), COALESCE(po.org_id, '')
 		FROM atombase_databases d
 		JOIN atombase_definitions def ON def.id = d.definition_id
 		LEFT JOIN atombase_organizations o ON o.database_id = d.id
+		LEFT JOIN atombase_definition_orgs po ON po.definition_id = d.definition_id
+		WHERE ? = '' OR po.org_id = ?
 		ORDER BY d.id
-	`)
+	`, org, org)
 	if err != nil {
 		return nil, err
 	}
@@ -38,7 +45,7 @@ func (api *API) listDatabases(ctx context.Context) ([]DatabaseRecord, error) {
 	for rows.Next() {
 		var item DatabaseRecord
 		var createdAt, updatedAt string
-		if err := rows.Scan(&item.ID, &item.DefinitionID, &item.DefinitionName, &item.DefinitionType, &item.DefinitionVersion, &createdAt, &updatedAt, &item.OwnerID, &item.OrganizationID, &item.OrganizationName); err != nil {
+		if err := rows.Scan(&item.ID, &item.DefinitionID, &item.DefinitionName, &item.DefinitionType, &item.DefinitionVersion, &createdAt, &updatedAt, &item.OwnerID, &item.OrganizationID, &item.OrganizationName, &item.Org); err != nil {
 			return nil, err
 		}
 		item.CreatedAt = mustParseTime(createdAt)
@@ -58,20 +65,24 @@ func (api *API) getDatabase(ctx context.Context, id string) (*DatabaseRecord, er
 	}
 	row := conn.QueryRowContext(ctx, `
 		SELECT d.id, d.definition_id, def.name, def.definition_type, d.definition_version, d.created_at, d.updated_at,
-		       COALESCE(o.owner_id, ''), COALESCE(o.id, ''), COALESCE(o.name, '')
+		       COALESCE(o.owner_id, ''), COALESCE(o.id, ''), COALESCE(o.name, ''), COALESCE(po.org_id, '')
 		FROM atombase_databases d
 		JOIN atombase_definitions def ON def.id = d.definition_id
 		LEFT JOIN atombase_organizations o ON o.database_id = d.id
+		LEFT JOIN atombase_definition_orgs po ON po.definition_id = d.definition_id
 		WHERE d.id = ?
 	`, id)
 	var item DatabaseRecord
 	var createdAt, updatedAt string
-	if err := row.Scan(&item.ID, &item.DefinitionID, &item.DefinitionName, &item.DefinitionType, &item.DefinitionVersion, &createdAt, &updatedAt, &item.OwnerID, &item.OrganizationID, &item.OrganizationName); err != nil {
+	if err := row.Scan(&item.ID, &item.DefinitionID, &item.DefinitionName, &item.DefinitionType, &item.DefinitionVersion, &createdAt, &updatedAt, &item.OwnerID, &item.OrganizationID, &item.OrganizationName, &item.Org); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrDatabaseNotFound
 		}
 		return nil, err
 	}
+	if org := callerOrg(ctx); org != "" && item.Org != org {
+		return nil, ErrDatabaseNotFound
+	}
 	item.CreatedAt = mustParseTime(createdAt)
 	item.UpdatedAt = mustParseTime(updatedAt)
 	return &item, nil
@@ -84,10 +95,11 @@ func (api *API) getDatabasesByDefinition(ctx context.Context, definitionID int32
 	}
 	rows, err := conn.QueryContext(ctx, `
 		SELECT d.id, d.definition_id, def.name, def.definition_type, d.definition_version, d.created_at, d.updated_at,
-		       COALESCE(o.owner_id, ''), COALESCE(o.id, ''), COALESCE(o.name, '')
+		       COALESCE(o.owner_id, ''), COALESCE(o.id, ''), COALESCE(o.name, ''), COALESCE(po.org_id, '')
 		FROM atombase_databases d
 		JOIN atombase_definitions def ON def.id = d.definition_id
 		LEFT JOIN atombase_organizations o ON o.database_id = d.id
+		LEFT JOIN atombase_definition_orgs po ON po.definition_id = d.definition_id
 		WHERE d.definition_id = ?
 		ORDER BY d.created_at ASC, d.id ASC
 	`, definitionID)
@@ -100,7 +112,7 @@ func (api *API) getDatabasesByDefinition(ctx context.Context, definitionID int32
 	for rows.Next() {
 		var item DatabaseRecord
 		var createdAt, updatedAt string
-		if err := rows.Scan(&item.ID, &item.DefinitionID, &item.DefinitionName, &item.DefinitionType, &item.DefinitionVersion, &createdAt, &updatedAt, &item.OwnerID, &item.OrganizationID, &item.OrganizationName); err != nil {
+		if err := rows.Scan(&item.ID, &item.DefinitionID, &item.DefinitionName, &item.DefinitionType, &item.DefinitionVersion, &createdAt, &updatedAt, &item.OwnerID, &item.OrganizationID, &item.OrganizationName, &item.Org); err != nil {
 			return nil, err
 		}
 		item.CreatedAt = mustParseTime(createdAt)
@@ -132,6 +144,85 @@ func (api *API) getDatabaseToken(ctx context.Context, id string) (string, error)
 	return decodeStoredDatabaseToken(encrypted)
 }
 
+// syncDatabaseReplica syncs a database's local read replica now rather than
+// when a read next finds it stale.
+func (api *API) syncDatabaseReplica(ctx context.Context, id string) (tools.TenantReplicaInfo, error) {
+	if !tools.TenantReplicas() {
+		return tools.TenantReplicaInfo{}, tools.InvalidRequestErr("read replicas need ATOMICBASE_TENANT_REPLICA_DIR and the turso tenant backend")
+	}
+	db, err := api.getDatabase(ctx, id)
+	if err != nil {
+		return tools.TenantReplicaInfo{}, err
+	}
+	token, err := api.getDatabaseToken(ctx, id)
+	if err != nil {
+		return tools.TenantReplicaInfo{}, err
+	}
+	return tools.SyncTenantReplica(ctx, id, token, db.DefinitionVersion)
+}
+
+// exportDatabase writes a snapshot of a database to a temporary file in
+// format, a SQLite file or a SQL dump, so a failed export is reported before
+// any of it is sent. The caller removes the file. Exports are audited.
+func (api *API) exportDatabase(ctx context.Context, id, format string) (*os.File, error) {
+	if format == "" {
+		format = tools.TenantExportSQLite
+	}
+	if format != tools.TenantExportSQLite && format != tools.TenantExportSQL {
+		return nil, tools.InvalidRequestErr("format must be sqlite or sql")
+	}
+	db, err := api.getDatabase(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	token, err := api.getDatabaseToken(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp("", "atombase-database-export-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, id+"."+format)
+	if format == tools.TenantExportSQLite {
+		err = tools.ExportTenantSQLite(ctx, id, token, db.DefinitionVersion, path)
+	} else {
+		err = dumpDatabase(ctx, id, token, db.DefinitionVersion, path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("export of %s failed: %w", id, err)
+	}
+
+	// Kept open past the directory's removal, which only unlinks it.
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if err := api.recordAudit(ctx, auditDatabaseExported, id, map[string]any{"format": format, "bytes": stat.Size()}); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+func dumpDatabase(ctx context.Context, id, token string, version int, path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := tools.DumpTenantDB(ctx, id, token, version, file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
 func (api *API) createDatabase(ctx context.Context, req CreateDatabaseRequest) (*DatabaseRecord, error) {
 	conn, err := api.dbConn()
 	if err != nil {
@@ -147,6 +238,21 @@ func (api *API) createDatabase(ctx context.Context, req CreateDatabaseRequest) (
 	if req.OrganizationID != "" && def.Type != definitions.DefinitionTypeOrganization {
 		return nil, tools.InvalidRequestErr("organizationId is only allowed for organization definitions")
 	}
+	var schema Schema
+	if err := tools.DecodeSchema(def.Schema, &schema); err != nil {
+		return nil, err
+	}
+	if req.Shared {
+		if def.Type != definitions.DefinitionTypeUser {
+			return nil, tools.InvalidRequestErr("shared is only allowed for user definitions")
+		}
+		if req.UserID != "" {
+			return nil, tools.InvalidRequestErr("userId cannot be set for a shared database")
+		}
+		if tenantColumn(schema) == "" {
+			return nil, tools.InvalidRequestErr(fmt.Sprintf("definition %s has no tenant column", def.Name))
+		}
+	}
 
 	var exists int
 	if err := conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM atombase_databases WHERE id = ?`, req.ID).Scan(&exists); err != nil {
@@ -155,7 +261,10 @@ func (api *API) createDatabase(ctx context.Context, req CreateDatabaseRequest) (
 	if exists > 0 {
 		return nil, ErrDatabaseExists
 	}
-	if def.Type == definitions.DefinitionTypeUser {
+	if err := api.checkDatabaseQuota(ctx, def.Org); err != nil {
+		return nil, err
+	}
+	if def.Type == definitions.DefinitionTypeUser && !req.Shared {
 		if req.UserID == "" {
 			return nil, tools.InvalidRequestErr("userId is required for user definitions")
 		}
@@ -175,30 +284,41 @@ func (api *API) createDatabase(ctx context.Context, req CreateDatabaseRequest) (
 		}
 	}
 
-	if err := tursoCreateDatabaseFn(ctx, req.ID); err != nil {
-		return nil, fmt.Errorf("failed to create turso database: %w", err)
+	definitionRegions, err := api.loadDefinitionResidency(ctx, def.ID)
+	if err != nil {
+		return nil, err
 	}
-	token, err := tursoCreateTokenFn(ctx, req.ID)
+	databaseRegions, err := normalizeRegions(req.AllowedRegions)
 	if err != nil {
-		_ = tursoDeleteDatabaseFn(ctx, req.ID)
+		return nil, err
+	}
+	place, err := placementForRegion(req.Region)
+	if err != nil {
+		return nil, err
+	}
+	if err := api.checkPlacement(ctx, "create", req.ID, place, definitionRegions, databaseRegions); err != nil {
+		return nil, err
+	}
+
+	if err := createTenantDatabaseFn(ctx, req.ID, place.Group); err != nil {
+		return nil, fmt.Errorf("failed to create tenant database: %w", err)
+	}
+	token, err := createTenantTokenFn(ctx, req.ID)
+	if err != nil {
+		_ = deleteTenantDatabaseFn(ctx, req.ID)
 		return nil, fmt.Errorf("failed to create database token: %w", err)
 	}
 	storedToken := []byte(token)
 	if tools.EncryptionEnabled() {
 		storedToken, err = tools.Encrypt([]byte(token))
 		if err != nil {
-			_ = tursoDeleteDatabaseFn(ctx, req.ID)
+			_ = deleteTenantDatabaseFn(ctx, req.ID)
 			return nil, err
 		}
 	}
 
-	var schema Schema
-	if err := tools.DecodeSchema(def.Schema, &schema); err != nil {
-		_ = tursoDeleteDatabaseFn(ctx, req.ID)
-		return nil, err
-	}
 	if err := batchExecuteWithTokenFn(ctx, req.ID, token, generateSchemaSQL(schema)); err != nil {
-		_ = tursodeleteDatabase(ctx, req.ID)
+		_ = tools.Tenants().DeleteDatabase(ctx, req.ID)
 		return nil, fmt.Errorf("failed to initialize database schema: %w", err)
 	}
 
@@ -215,9 +335,15 @@ func (api *API) createDatabase(ctx context.Context, req CreateDatabaseRequest) (
 	`, req.ID, def.ID, def.CurrentVersion, storedToken, now, now); err != nil {
 		return nil, err
 	}
+	if err := savePlacement(ctx, tx, req.ID, place, databaseRegions, now); err != nil {
+		return nil, err
+	}
 
 	switch def.Type {
 	case definitions.DefinitionTypeUser:
+		if req.Shared {
+			break
+		}
 		if req.UserID == "" {
 			return nil, tools.InvalidRequestErr("userId is required for user definitions")
 		}
@@ -295,7 +421,7 @@ func (api *API) deleteDatabase(ctx context.Context, id string) error {
 	if _, err := api.getDatabase(ctx, id); err != nil {
 		return err
 	}
-	if err := tursoDeleteDatabaseFn(ctx, id); err != nil {
+	if err := deleteTenantDatabaseFn(ctx, id); err != nil {
 		return fmt.Errorf("failed to delete turso database: %w", err)
 	}
 	_, err = conn.ExecContext(ctx, `DELETE FROM atombase_databases WHERE id = ?`, id)
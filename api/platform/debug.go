@@ -0,0 +1,146 @@
+package platform
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	rpprof "runtime/pprof"
+	"time"
+
+	"github.com/atombasedev/atombase/tools"
+)
+
+const auditDebugSnapshot = "debug.snapshot"
+
+// processStart is used to report uptime.
+var processStart = time.Now()
+
+// registerDebugRoutes exposes the Go profiler and runtime statistics. Like every
+// platform route they require the service key; they are only registered when
+// ATOMICBASE_DEBUG_ENDPOINTS is enabled.
+func (api *API) registerDebugRoutes(mux orgMux) {
+	mux.HandleFunc("GET /platform/debug/pprof/", pprof.Index)
+	mux.HandleFunc("GET /platform/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("GET /platform/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("GET /platform/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("POST /platform/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("GET /platform/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("GET /platform/debug/pprof/{profile}", handleNamedProfile)
+	mux.HandleFunc("GET /platform/debug/runtime", handleRuntimeStats)
+	mux.HandleFunc("GET /platform/debug/snapshot", api.handleDebugSnapshot)
+}
+
+// handleNamedProfile serves profiles such as heap, goroutine and mutex.
+// pprof.Index only resolves them under /debug/pprof/, so they are routed here.
+func handleNamedProfile(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("profile")
+	if rpprof.Lookup(name) == nil {
+		tools.RespErr(w, tools.InvalidRequestErr(fmt.Sprintf("unknown profile %q", name)))
+		return
+	}
+	pprof.Handler(name).ServeHTTP(w, r)
+}
+
+// RuntimeStats is a point-in-time summary of the process.
+type RuntimeStats struct {
+	GoVersion     string  `json:"goVersion"`
+	UptimeSeconds float64 `json:"uptimeSeconds"`
+	NumCPU        int     `json:"numCpu"`
+	GOMAXPROCS    int     `json:"gomaxprocs"`
+	Goroutines    int     `json:"goroutines"`
+	HeapAlloc     uint64  `json:"heapAllocBytes"`
+	HeapInuse     uint64  `json:"heapInuseBytes"`
+	HeapObjects   uint64  `json:"heapObjects"`
+	Sys           uint64  `json:"sysBytes"`
+	TotalAlloc    uint64  `json:"totalAllocBytes"`
+	NumGC         uint32  `json:"numGc"`
+	LastGC        string  `json:"lastGc,omitempty"`
+	PauseTotalMs  float64 `json:"gcPauseTotalMs"`
+
+	// Saturation of the request rate limit and query cost budgets.
+	RateLimits map[string]tools.TokenBucketStats `json:"rateLimits"`
+	// Callers refused most often lately, by decaying abuse score.
+	AbuseScores []tools.AbuseScore `json:"abuseScores"`
+}
+
+func collectRuntimeStats() RuntimeStats {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	stats := RuntimeStats{
+		GoVersion:     runtime.Version(),
+		UptimeSeconds: time.Since(processStart).Seconds(),
+		NumCPU:        runtime.NumCPU(),
+		GOMAXPROCS:    runtime.GOMAXPROCS(0),
+		Goroutines:    runtime.NumGoroutine(),
+		HeapAlloc:     mem.HeapAlloc,
+		HeapInuse:     mem.HeapInuse,
+		HeapObjects:   mem.HeapObjects,
+		Sys:           mem.Sys,
+		TotalAlloc:    mem.TotalAlloc,
+		NumGC:         mem.NumGC,
+		PauseTotalMs:  float64(mem.PauseTotalNs) / float64(time.Millisecond),
+		RateLimits:    tools.AllTokenBucketStats(time.Now()),
+		AbuseScores:   tools.TopAbuseScores(20, time.Now()),
+	}
+	if mem.LastGC > 0 {
+		stats.LastGC = time.Unix(0, int64(mem.LastGC)).UTC().Format(time.RFC3339)
+	}
+	return stats
+}
+
+func handleRuntimeStats(w http.ResponseWriter, r *http.Request) {
+	tools.RespondJSON(w, http.StatusOK, collectRuntimeStats())
+}
+
+// handleDebugSnapshot downloads a zip with a heap profile, a full goroutine
+// dump and the runtime statistics, taken together. Downloads are audited.
+func (api *API) handleDebugSnapshot(w http.ResponseWriter, r *http.Request) {
+	archive, err := debugSnapshot()
+	if err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	if err := api.recordAudit(r.Context(), auditDebugSnapshot, "server", map[string]int{"bytes": len(archive)}); err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	name := fmt.Sprintf("atombase-snapshot-%s.zip", time.Now().UTC().Format("20060102T150405Z"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(archive)
+}
+
+func debugSnapshot() ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	files := []struct {
+		name  string
+		write func(*bytes.Buffer) error
+	}{
+		{"heap.pb.gz", func(b *bytes.Buffer) error { return rpprof.Lookup("heap").WriteTo(b, 0) }},
+		{"goroutines.txt", func(b *bytes.Buffer) error { return rpprof.Lookup("goroutine").WriteTo(b, 2) }},
+		{"runtime.json", func(b *bytes.Buffer) error { return json.NewEncoder(b).Encode(collectRuntimeStats()) }},
+	}
+	for _, file := range files {
+		var content bytes.Buffer
+		if err := file.write(&content); err != nil {
+			return nil, fmt.Errorf("snapshot %s: %w", file.name, err)
+		}
+		f, err := zw.Create(file.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := f.Write(content.Bytes()); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
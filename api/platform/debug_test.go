@@ -0,0 +1,72 @@
+package platform
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/atombasedev/atombase/config"
+)
+
+func TestDebugRoutes(t *testing.T) {
+	api, db := setupPlatformAPI(t)
+	defer db.Close()
+
+	old := config.Cfg.DebugEndpoints
+	defer func() { config.Cfg.DebugEndpoints = old }()
+
+	get := func(mux *http.ServeMux, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	config.Cfg.DebugEndpoints = false
+	disabled := http.NewServeMux()
+	api.RegisterRoutes(disabled)
+	if rec := get(disabled, "/platform/debug/runtime"); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected debug routes to be off by default, got %d", rec.Code)
+	}
+
+	config.Cfg.DebugEndpoints = true
+	mux := http.NewServeMux()
+	api.RegisterRoutes(mux)
+
+	if rec := get(mux, "/platform/debug/pprof/goroutine?debug=1"); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "goroutine profile") {
+		t.Fatalf("unexpected goroutine profile response %d: %.100s", rec.Code, rec.Body.String())
+	}
+	if rec := get(mux, "/platform/debug/pprof/nonsense"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected an unknown profile to be rejected, got %d", rec.Code)
+	}
+
+	rec := get(mux, "/platform/debug/runtime")
+	var stats RuntimeStats
+	if err := json.Unmarshal(rec.Body.Bytes(), &stats); err != nil || stats.Goroutines == 0 || stats.HeapAlloc == 0 {
+		t.Fatalf("unexpected runtime stats %s (%v)", rec.Body.String(), err)
+	}
+
+	rec = get(mux, "/platform/debug/snapshot")
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Disposition"), "attachment;") {
+		t.Fatalf("unexpected snapshot response %d %v", rec.Code, rec.Header())
+	}
+	zr, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	if strings.Join(names, ",") != "heap.pb.gz,goroutines.txt,runtime.json" {
+		t.Fatalf("unexpected snapshot contents %v", names)
+	}
+	entries, err := api.listAuditLog(context.Background(), auditDebugSnapshot, 0)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("expected the snapshot download to be audited, got %v (%v)", entries, err)
+	}
+}
@@ -0,0 +1,250 @@
+package platform
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/atombasedev/atombase/tools"
+)
+
+const (
+	maxDefinitionSourceBytes = 5 << 20 // Largest definition document fetched from a source
+	ociSourcePrefix          = "oci://"
+)
+
+// definitionSourceClient fetches sources, which callers name, so it only
+// reaches public addresses.
+var definitionSourceClient = tools.PublicHTTPClient(30 * time.Second)
+
+// fetchDefinitionSource downloads the definition document at rawURL and
+// returns it with the hex sha256 of its bytes.
+func fetchDefinitionSource(ctx context.Context, rawURL string) (CreateDefinitionRequest, string, error) {
+	var body []byte
+	if ref, ok := strings.CutPrefix(rawURL, ociSourcePrefix); ok {
+		blob, err := tools.FetchOCIArtifact(ctx, definitionSourceClient, ref, maxDefinitionSourceBytes)
+		if err != nil {
+			return CreateDefinitionRequest{}, "", tools.InvalidRequestErr(fmt.Sprintf("failed to fetch source: %v", err))
+		}
+		body = blob
+	} else {
+		u, err := url.Parse(rawURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return CreateDefinitionRequest{}, "", tools.InvalidRequestErr("source url must be an http, https or oci:// URL")
+		}
+		if body, err = getDefinitionSource(ctx, u.String()); err != nil {
+			return CreateDefinitionRequest{}, "", tools.InvalidRequestErr(fmt.Sprintf("failed to fetch source: %v", err))
+		}
+	}
+
+	sum := sha256.Sum256(body)
+	var doc CreateDefinitionRequest
+	if err := tools.DecodeJSON(bytes.NewReader(body), &doc); err != nil {
+		return CreateDefinitionRequest{}, "", tools.InvalidRequestErr(fmt.Sprintf("source is not a definition document: %v", err))
+	}
+	if doc.Source != nil {
+		return CreateDefinitionRequest{}, "", tools.InvalidRequestErr("a source document cannot point at another source")
+	}
+	return doc, hex.EncodeToString(sum[:]), nil
+}
+
+func getDefinitionSource(ctx context.Context, rawURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := definitionSourceClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", req.URL.Redacted(), resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxDefinitionSourceBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxDefinitionSourceBytes {
+		return nil, fmt.Errorf("document exceeds %d bytes", maxDefinitionSourceBytes)
+	}
+	return body, nil
+}
+
+// fetchPinnedSource fetches a source and checks it against its pin.
+func fetchPinnedSource(ctx context.Context, source DefinitionSource) (CreateDefinitionRequest, error) {
+	if source.URL == "" || source.SHA256 == "" {
+		return CreateDefinitionRequest{}, tools.InvalidRequestErr("source needs a url and the sha256 of its document")
+	}
+	doc, sum, err := fetchDefinitionSource(ctx, source.URL)
+	if err != nil {
+		return CreateDefinitionRequest{}, err
+	}
+	if !strings.EqualFold(sum, source.SHA256) {
+		return CreateDefinitionRequest{}, fmt.Errorf("%w: %s has sha256 %s", tools.ErrChecksumMismatch, source.URL, sum)
+	}
+	return doc, nil
+}
+
+// resolveDefinitionSource fills a create request from its source. Name and
+// type given in the request win over the document's, so one starter can be
+// installed more than once.
+func resolveDefinitionSource(ctx context.Context, req CreateDefinitionRequest) (CreateDefinitionRequest, error) {
+	doc, err := fetchPinnedSource(ctx, *req.Source)
+	if err != nil {
+		return CreateDefinitionRequest{}, err
+	}
+	if req.Name != "" {
+		doc.Name = req.Name
+	}
+	if req.Type != "" {
+		doc.Type = req.Type
+	}
+	source := *req.Source
+	source.SHA256 = strings.ToLower(source.SHA256)
+	doc.Source = &source
+	return doc, nil
+}
+
+func saveDefinitionSource(ctx context.Context, exec Execer, definitionID int32, source DefinitionSource) error {
+	_, err := exec.ExecContext(ctx, `
+		INSERT INTO atombase_definition_sources (definition_id, url, sha256, updated_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(definition_id) DO UPDATE SET url = excluded.url, sha256 = excluded.sha256, updated_at = excluded.updated_at
+	`, definitionID, source.URL, strings.ToLower(source.SHA256), time.Now().UTC().Format(time.RFC3339))
+	return err
+}
+
+// loadDefinitionSource returns where a definition was installed from, or nil.
+func (api *API) loadDefinitionSource(ctx context.Context, definitionID int32) (*DefinitionSource, error) {
+	conn, err := api.dbConn()
+	if err != nil {
+		return nil, err
+	}
+	var source DefinitionSource
+	err = conn.QueryRowContext(ctx, `
+		SELECT url, sha256 FROM atombase_definition_sources WHERE definition_id = ?
+	`, definitionID).Scan(&source.URL, &source.SHA256)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &source, nil
+}
+
+// pullSource picks the URL a pull fetches: the one given, else the one the
+// definition was installed from.
+func (api *API) pullSource(ctx context.Context, current *Definition, rawURL string) (string, *DefinitionSource, error) {
+	installed, err := api.loadDefinitionSource(ctx, current.ID)
+	if err != nil {
+		return "", nil, err
+	}
+	if rawURL == "" {
+		if installed == nil {
+			return "", nil, tools.InvalidRequestErr(fmt.Sprintf("definition %s was not installed from a source; pass a url", current.Name))
+		}
+		rawURL = installed.URL
+	}
+	return rawURL, installed, nil
+}
+
+// previewDefinitionPull fetches a definition's source and reports the schema
+// changes and migration pulling it would make, without changing anything.
+func (api *API) previewDefinitionPull(ctx context.Context, name, rawURL string) (*DefinitionPullPreview, error) {
+	current, err := api.getDefinition(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	rawURL, installed, err := api.pullSource(ctx, current, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	doc, sum, err := fetchDefinitionSource(ctx, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if doc.Type != "" && doc.Type != current.Type {
+		return nil, tools.InvalidRequestErr(fmt.Sprintf("source is a %s definition, not %s", doc.Type, current.Type))
+	}
+
+	var currentSchema Schema
+	if err := tools.DecodeSchema(current.Schema, &currentSchema); err != nil {
+		return nil, err
+	}
+	if err := prepareSchema(current.Type, &currentSchema, &doc.Schema); err != nil {
+		return nil, err
+	}
+	changes := diffSchemas(currentSchema, doc.Schema)
+	plan, err := GenerateMigrationPlan(currentSchema, doc.Schema, changes, nil)
+	if err != nil {
+		return nil, tools.InvalidMigrationErr(err.Error())
+	}
+
+	preview := &DefinitionPullPreview{URL: rawURL, SHA256: sum, Changes: changes, SQL: plan.SQL}
+	if installed != nil {
+		preview.CurrentSHA256 = installed.SHA256
+	}
+	if preview.Changes == nil {
+		preview.Changes = []SchemaDiff{}
+	}
+	if preview.SQL == nil {
+		preview.SQL = []string{}
+	}
+	return preview, nil
+}
+
+// pullDefinition pushes the pinned document of a definition's source as its
+// next version and records the pin. A document that matches the current
+// version still moves the pin, and the error reports there were no changes.
+func (api *API) pullDefinition(ctx context.Context, name string, req PullDefinitionRequest) (*DefinitionVersion, error) {
+	current, err := api.getDefinition(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	rawURL, _, err := api.pullSource(ctx, current, req.URL)
+	if err != nil {
+		return nil, err
+	}
+	source := DefinitionSource{URL: rawURL, SHA256: req.SHA256}
+	doc, err := fetchPinnedSource(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+	if doc.Type != "" && doc.Type != current.Type {
+		return nil, tools.InvalidRequestErr(fmt.Sprintf("source is a %s definition, not %s", doc.Type, current.Type))
+	}
+
+	version, err := api.pushDefinition(ctx, name, PushDefinitionRequest{
+		Schema:     doc.Schema,
+		Access:     doc.Access,
+		Management: doc.Management,
+		Provision:  doc.Provision,
+		Tests:      doc.Tests,
+		Merge:      req.Merge,
+		SampleData: req.SampleData,
+		Windows:    req.Windows,
+	})
+	if err != nil && !errors.Is(err, tools.ErrNoChanges) {
+		return nil, err
+	}
+	conn, connErr := api.dbConn()
+	if connErr != nil {
+		return nil, connErr
+	}
+	if saveErr := saveDefinitionSource(ctx, conn, current.ID, source); saveErr != nil {
+		return nil, saveErr
+	}
+	return version, err
+}
@@ -0,0 +1,85 @@
+package platform
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/atombasedev/atombase/tools"
+)
+
+func TestDefinitionSource_InstallPreviewAndPull(t *testing.T) {
+	api, db := setupPlatformAPI(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	document := `{"name":"blog","type":"global","schema":{"tables":[{"name":"posts","pk":["id"],"columns":{"id":{"name":"id","type":"INTEGER"}}}]},"access":{"posts":{"select":{"field":"auth.status","op":"eq","value":"anonymous"}}}}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(document))
+	}))
+	defer srv.Close()
+	pin := func() string {
+		sum := sha256.Sum256([]byte(document))
+		return hex.EncodeToString(sum[:])
+	}
+	v1 := pin()
+
+	if _, err := resolveDefinitionSource(ctx, CreateDefinitionRequest{Source: &DefinitionSource{URL: srv.URL, SHA256: v1}}); err == nil || !strings.Contains(err.Error(), tools.ErrPrivateAddress.Error()) {
+		t.Fatalf("expected a loopback source to be refused, got %v", err)
+	}
+	// The rest of the test fetches from the loopback server.
+	oldClient := definitionSourceClient
+	defer func() { definitionSourceClient = oldClient }()
+	definitionSourceClient = srv.Client()
+
+	if _, err := resolveDefinitionSource(ctx, CreateDefinitionRequest{Source: &DefinitionSource{URL: srv.URL, SHA256: "00" + v1[2:]}}); !errors.Is(err, tools.ErrChecksumMismatch) {
+		t.Fatalf("expected a checksum mismatch, got %v", err)
+	}
+	req, err := resolveDefinitionSource(ctx, CreateDefinitionRequest{Name: "my_blog", Source: &DefinitionSource{URL: srv.URL, SHA256: v1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Name != "my_blog" || req.Type != "global" || len(req.Schema.Tables) != 1 {
+		t.Fatalf("unexpected resolved request: %+v", req)
+	}
+	created, err := api.createDefinition(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if source, err := api.loadDefinitionSource(ctx, created.ID); err != nil || source == nil || source.SHA256 != v1 {
+		t.Fatalf("expected the source to be stored, got %+v, %v", source, err)
+	}
+
+	// The publisher adds a column.
+	document = `{"name":"blog","type":"global","schema":{"tables":[{"name":"posts","pk":["id"],"columns":{"id":{"name":"id","type":"INTEGER"},"title":{"name":"title","type":"TEXT"}}}]},"access":{"posts":{"select":{"field":"auth.status","op":"eq","value":"anonymous"}}}}`
+	v2 := pin()
+	preview, err := api.previewDefinitionPull(ctx, "my_blog", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if preview.SHA256 != v2 || preview.CurrentSHA256 != v1 || len(preview.Changes) != 1 || preview.Changes[0].Type != "add_column" || len(preview.SQL) == 0 {
+		t.Fatalf("unexpected preview: %+v", preview)
+	}
+
+	if _, err := api.pullDefinition(ctx, "my_blog", PullDefinitionRequest{SHA256: v1}); !errors.Is(err, tools.ErrChecksumMismatch) {
+		t.Fatalf("expected the stale pin to be rejected, got %v", err)
+	}
+	version, err := api.pullDefinition(ctx, "my_blog", PullDefinitionRequest{SHA256: v2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version.Version != 2 {
+		t.Errorf("expected version 2, got %d", version.Version)
+	}
+	if source, _ := api.loadDefinitionSource(ctx, created.ID); source == nil || source.SHA256 != v2 {
+		t.Errorf("expected the pin to move, got %+v", source)
+	}
+	if _, err := api.pullDefinition(ctx, "my_blog", PullDefinitionRequest{SHA256: v2}); !errors.Is(err, tools.ErrNoChanges) {
+		t.Errorf("expected no changes, got %v", err)
+	}
+}
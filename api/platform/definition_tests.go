@@ -0,0 +1,83 @@
+package platform
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/atombasedev/atombase/definitions"
+)
+
+// validateDefinitionTests checks that every test query compiles against schema.
+func validateDefinitionTests(ctx context.Context, schema Schema, tests []TestCase) error {
+	if len(tests) == 0 {
+		return nil
+	}
+	probeDB, err := buildMigrationProbeDB(schema)
+	if err != nil {
+		return fmt.Errorf("failed to build local probe database: %w", err)
+	}
+	defer probeDB.Close()
+	for _, test := range tests {
+		stmt, err := probeDB.PrepareContext(ctx, test.Query)
+		if err != nil {
+			return fmt.Errorf("test %q is invalid: %w", test.Name, err)
+		}
+		stmt.Close()
+	}
+	return nil
+}
+
+func insertDefinitionTests(ctx context.Context, tx *sql.Tx, definitionID int64, version int, tests []TestCase) error {
+	for _, test := range tests {
+		var expectJSON any
+		if test.Expect != nil {
+			raw, err := json.Marshal(test.Expect)
+			if err != nil {
+				return err
+			}
+			expectJSON = string(raw)
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO atombase_definition_tests (definition_id, version, name, query, expect_json)
+			VALUES (?, ?, ?, ?, ?)
+		`, definitionID, version, test.Name, test.Query, expectJSON); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (api *API) loadDefinitionTests(ctx context.Context, definitionID int32, version int) ([]TestCase, error) {
+	conn, err := api.dbConn()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := conn.QueryContext(ctx, `
+		SELECT name, query, expect_json
+		FROM atombase_definition_tests
+		WHERE definition_id = ? AND version = ?
+		ORDER BY name
+	`, definitionID, version)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tests []definitions.TestCase
+	for rows.Next() {
+		var test definitions.TestCase
+		var expectJSON sql.NullString
+		if err := rows.Scan(&test.Name, &test.Query, &expectJSON); err != nil {
+			return nil, err
+		}
+		if expectJSON.Valid {
+			if err := json.Unmarshal([]byte(expectJSON.String), &test.Expect); err != nil {
+				return nil, err
+			}
+		}
+		tests = append(tests, test)
+	}
+	return tests, rows.Err()
+}
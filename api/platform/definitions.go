@@ -7,6 +7,7 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"reflect"
 	"time"
 
 	"github.com/atombasedev/atombase/definitions"
@@ -19,13 +20,30 @@ var (
 )
 
 func schemaTableSet(schema Schema) map[string]struct{} {
-	out := make(map[string]struct{}, len(schema.Tables))
+	out := make(map[string]struct{}, len(schema.Tables)+len(schema.Views))
 	for _, table := range schema.Tables {
 		out[table.Name] = struct{}{}
 	}
+	for _, view := range schema.Views {
+		out[view.Name] = struct{}{}
+	}
 	return out
 }
 
+// prepareSchema fills in what a created or pushed schema leaves to the
+// platform: row tenant columns, foreign key indexes and view columns. current
+// is nil when the definition is being created.
+func prepareSchema(defType definitions.DefinitionType, current, next *Schema) error {
+	if err := applyTenantColumn(defType, next); err != nil {
+		return err
+	}
+	applyForeignKeyIndexes(current, next)
+	if err := resolveViews(next); err != nil {
+		return tools.InvalidRequestErr(err.Error())
+	}
+	return nil
+}
+
 func conditionsEqual(left, right *definitions.Condition) bool {
 	leftJSON, _ := json.Marshal(left)
 	rightJSON, _ := json.Marshal(right)
@@ -121,40 +139,47 @@ func (api *API) listDefinitions(ctx context.Context) ([]Definition, error) {
 	if err != nil {
 		return nil, err
 	}
+	org := callerOrg(ctx)
 	rows, err := conn.QueryContext(ctx, `
-		SELECT id, name, definition_type, COALESCE(roles_json, '[]'), current_version, created_at, updated_at
-		FROM atombase_definitions
-		ORDER BY name
-	`)
+		SELECT d.id, d.name, d.definition_type, COALESCE(d.roles_json, '[]'), d.current_version, COALESCE(o.org_id, ''), d.created_at, d.updated_at
+		FROM atombase_definitions d
+		LEFT JOIN atombase_definition_orgs o ON o.definition_id = d.id
+		WHERE ? = '' OR o.org_id = ?
+		ORDER BY d.name
+	`, org, org)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var items []Definition
+	items := []Definition{}
 	for rows.Next() {
 		var item Definition
 		var defType string
 		var rolesJSON string
-		if err := rows.Scan(&item.ID, &item.Name, &defType, &rolesJSON, &item.CurrentVersion, &item.CreatedAt, &item.UpdatedAt); err != nil {
+		if err := rows.Scan(&item.ID, &item.Name, &defType, &rolesJSON, &item.CurrentVersion, &item.Org, &item.CreatedAt, &item.UpdatedAt); err != nil {
 			return nil, err
 		}
 		item.Type = definitions.DefinitionType(defType)
 		_ = json.Unmarshal([]byte(rolesJSON), &item.Roles)
-		item.Management, err = api.loadManagementPolicies(ctx, item.ID)
-		if err != nil {
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	// Policies are loaded once the listing is read, so the connection it held
+	// is free for their queries.
+	for i := range items {
+		if items[i].Management, err = api.loadManagementPolicies(ctx, items[i].ID); err != nil {
 			return nil, err
 		}
-		item.Provision, err = api.loadProvisionPolicy(ctx, item.ID, item.CurrentVersion)
-		if err != nil {
+		if items[i].Provision, err = api.loadProvisionPolicy(ctx, items[i].ID, items[i].CurrentVersion); err != nil {
 			return nil, err
 		}
-		items = append(items, item)
 	}
-	if items == nil {
-		items = []Definition{}
-	}
-	return items, rows.Err()
+	return items, nil
 }
 
 func (api *API) getDefinition(ctx context.Context, name string) (*Definition, error) {
@@ -163,21 +188,26 @@ func (api *API) getDefinition(ctx context.Context, name string) (*Definition, er
 		return nil, err
 	}
 	row := conn.QueryRowContext(ctx, `
-		SELECT d.id, d.name, d.definition_type, COALESCE(d.roles_json, '[]'), d.current_version, d.created_at, d.updated_at, h.schema_json
+		SELECT d.id, d.name, d.definition_type, COALESCE(d.roles_json, '[]'), d.current_version, COALESCE(o.org_id, ''), d.created_at, d.updated_at, h.schema_json
 		FROM atombase_definitions d
 		JOIN atombase_definitions_history h ON h.definition_id = d.id AND h.version = d.current_version
+		LEFT JOIN atombase_definition_orgs o ON o.definition_id = d.id
 		WHERE d.name = ?
 	`, name)
 	var item Definition
 	var defType string
 	var rolesJSON string
 	var schemaJSON string
-	if err := row.Scan(&item.ID, &item.Name, &defType, &rolesJSON, &item.CurrentVersion, &item.CreatedAt, &item.UpdatedAt, &schemaJSON); err != nil {
+	if err := row.Scan(&item.ID, &item.Name, &defType, &rolesJSON, &item.CurrentVersion, &item.Org, &item.CreatedAt, &item.UpdatedAt, &schemaJSON); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrDefinitionNotFound
 		}
 		return nil, err
 	}
+	// Definitions of other orgs do not exist for an org key.
+	if org := callerOrg(ctx); org != "" && item.Org != org {
+		return nil, ErrDefinitionNotFound
+	}
 	item.Type = definitions.DefinitionType(defType)
 	item.Schema = json.RawMessage(schemaJSON)
 	_ = json.Unmarshal([]byte(rolesJSON), &item.Roles)
@@ -193,10 +223,26 @@ func (api *API) getDefinition(ctx context.Context, name string) (*Definition, er
 }
 
 func (api *API) createDefinition(ctx context.Context, req CreateDefinitionRequest) (*Definition, error) {
+	return api.createDefinitionWith(ctx, req, nil)
+}
+
+// createDefinitionWith creates a definition and, when then is set, runs it in
+// the same transaction, so a failure there leaves no definition behind.
+func (api *API) createDefinitionWith(ctx context.Context, req CreateDefinitionRequest, then func(tx *sql.Tx, definitionID int32) error) (*Definition, error) {
 	conn, err := api.dbConn()
 	if err != nil {
 		return nil, err
 	}
+	org, err := api.requestOrg(ctx, req.Org)
+	if err != nil {
+		return nil, err
+	}
+	if err := api.checkDefinitionQuota(ctx, org); err != nil {
+		return nil, err
+	}
+	if err := prepareSchema(req.Type, nil, &req.Schema); err != nil {
+		return nil, err
+	}
 	accessRows, err := definitions.ParseAndValidateAccess(req.Type, req.Access, schemaTableSet(req.Schema))
 	if err != nil {
 		return nil, tools.InvalidRequestErr(err.Error())
@@ -209,6 +255,25 @@ func (api *API) createDefinition(ctx context.Context, req CreateDefinitionReques
 	if err != nil {
 		return nil, tools.InvalidRequestErr(err.Error())
 	}
+	tests, err := definitions.ParseAndValidateTests(req.Tests)
+	if err != nil {
+		return nil, tools.InvalidRequestErr(err.Error())
+	}
+	if err := validateDefinitionTests(ctx, req.Schema, tests); err != nil {
+		return nil, tools.InvalidRequestErr(err.Error())
+	}
+	if err := validateAPISettings(req.Schema); err != nil {
+		return nil, tools.InvalidRequestErr(err.Error())
+	}
+	if err := validateGeoColumns(req.Schema); err != nil {
+		return nil, tools.InvalidRequestErr(err.Error())
+	}
+	if err := validateSyncTables(req.Schema); err != nil {
+		return nil, tools.InvalidRequestErr(err.Error())
+	}
+	if err := validateTimeSeriesTables(req.Schema); err != nil {
+		return nil, tools.InvalidRequestErr(err.Error())
+	}
 	schemaJSON, err := encodeSchemaForStorage(req.Schema)
 	if err != nil {
 		return nil, err
@@ -248,6 +313,18 @@ func (api *API) createDefinition(ctx context.Context, req CreateDefinitionReques
 	`, defID, string(schemaJSON), checksum, now); err != nil {
 		return nil, err
 	}
+	if req.Source != nil {
+		if err := saveDefinitionSource(ctx, tx, int32(defID), *req.Source); err != nil {
+			return nil, err
+		}
+	}
+	if org != "" {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO atombase_definition_orgs (definition_id, org_id) VALUES (?, ?)
+		`, defID, org); err != nil {
+			return nil, err
+		}
+	}
 
 	for _, row := range accessRows {
 		var cond string
@@ -293,6 +370,14 @@ func (api *API) createDefinition(ctx context.Context, req CreateDefinitionReques
 			return nil, err
 		}
 	}
+	if err := insertDefinitionTests(ctx, tx, defID, 1, tests); err != nil {
+		return nil, err
+	}
+	if then != nil {
+		if err := then(tx, int32(defID)); err != nil {
+			return nil, err
+		}
+	}
 
 	if err := tx.Commit(); err != nil {
 		return nil, err
@@ -302,10 +387,6 @@ func (api *API) createDefinition(ctx context.Context, req CreateDefinitionReques
 }
 
 func (api *API) pushDefinition(ctx context.Context, name string, req PushDefinitionRequest) (*DefinitionVersion, error) {
-	conn, err := api.dbConn()
-	if err != nil {
-		return nil, err
-	}
 	current, err := api.getDefinition(ctx, name)
 	if err != nil {
 		return nil, err
@@ -314,11 +395,15 @@ func (api *API) pushDefinition(ctx context.Context, name string, req PushDefinit
 	if err := tools.DecodeSchema(current.Schema, &currentSchema); err != nil {
 		return nil, err
 	}
+	if err := prepareSchema(current.Type, &currentSchema, &req.Schema); err != nil {
+		return nil, err
+	}
 
 	changes := diffSchemas(currentSchema, req.Schema)
 	schemaChanged := len(changes) > 0
 	provisionChanged := !conditionsEqual(current.Provision, req.Provision)
-	if !schemaChanged && !provisionChanged {
+	settingsChanged := !reflect.DeepEqual(currentSchema.Settings, req.Schema.Settings)
+	if !schemaChanged && !provisionChanged && !settingsChanged {
 		return nil, tools.ErrNoChanges
 	}
 
@@ -334,8 +419,31 @@ func (api *API) pushDefinition(ctx context.Context, name string, req PushDefinit
 	if err != nil {
 		return nil, tools.InvalidRequestErr(err.Error())
 	}
+	tests, err := definitions.ParseAndValidateTests(req.Tests)
+	if err != nil {
+		return nil, tools.InvalidRequestErr(err.Error())
+	}
+	if err := validateDefinitionTests(ctx, req.Schema, tests); err != nil {
+		return nil, tools.InvalidRequestErr(err.Error())
+	}
+	if err := validateAPISettings(req.Schema); err != nil {
+		return nil, tools.InvalidRequestErr(err.Error())
+	}
+	if err := validateGeoColumns(req.Schema); err != nil {
+		return nil, tools.InvalidRequestErr(err.Error())
+	}
+	if err := validateSyncTables(req.Schema); err != nil {
+		return nil, tools.InvalidRequestErr(err.Error())
+	}
+	if err := validateTimeSeriesTables(req.Schema); err != nil {
+		return nil, tools.InvalidRequestErr(err.Error())
+	}
+	if err := validateMigrationWindows(req.Windows); err != nil {
+		return nil, err
+	}
 	plan := &MigrationPlan{}
-	if schemaChanged {
+	// Turning the change log on or off is a migration of its own.
+	if schemaChanged || pointInTime(currentSchema) != pointInTime(req.Schema) {
 		validationResult, err := ValidateMigrationPlan(ctx, req.Schema, nil)
 		if err != nil {
 			return nil, err
@@ -348,11 +456,23 @@ func (api *API) pushDefinition(ctx context.Context, name string, req PushDefinit
 		if err != nil {
 			return nil, tools.InvalidMigrationErr(err.Error())
 		}
-		if err := ValidateMigrationExecution(ctx, currentSchema, plan.SQL); err != nil {
+		if err := VerifyMigrationPlan(ctx, currentSchema, req.Schema, plan.SQL, req.SampleData); err != nil {
 			return nil, tools.InvalidMigrationErr(err.Error())
 		}
 	}
-	schemaJSON, err := encodeSchemaForStorage(req.Schema)
+	return api.publishDefinitionVersion(ctx, current, req.Schema, plan.SQL, accessRows, managementRows, req.Provision, provisionPolicy, tests, req.Windows)
+}
+
+// publishDefinitionVersion stores schema as the next version of current along with
+// its migration SQL, windows, policies and tests. The SQL is first applied to the oldest
+// existing database whose windows are open, which is moved to the new version in the
+// same transaction.
+func (api *API) publishDefinitionVersion(ctx context.Context, current *Definition, schema Schema, migrationSQL []string, accessRows []definitions.AccessPolicy, managementRows []definitions.ManagementRule, provision *Condition, provisionPolicy *definitions.ProvisionPolicy, tests []TestCase, windows []MigrationWindow) (*DefinitionVersion, error) {
+	conn, err := api.dbConn()
+	if err != nil {
+		return nil, err
+	}
+	schemaJSON, err := encodeSchemaForStorage(schema)
 	if err != nil {
 		return nil, err
 	}
@@ -365,12 +485,26 @@ func (api *API) pushDefinition(ctx context.Context, name string, req PushDefinit
 	if err != nil {
 		return nil, err
 	}
-	if len(existingDBs) > 0 && len(plan.SQL) > 0 {
-		probeToken, err := api.getDatabaseToken(ctx, existingDBs[0].ID)
+	var impact *MigrationImpact
+	if len(existingDBs) > 0 && len(migrationSQL) > 0 {
+		var currentSchema Schema
+		if err := tools.DecodeSchema(current.Schema, &currentSchema); err != nil {
+			return nil, err
+		}
+		impact = api.estimateMigrationImpact(ctx, currentSchema, existingDBs, migrationSQL)
+	}
+	probe := -1
+	if len(existingDBs) > 0 && len(migrationSQL) > 0 {
+		if probe, err = api.probeDatabase(ctx, existingDBs, windows); err != nil {
+			return nil, err
+		}
+	}
+	if probe >= 0 {
+		probeToken, err := api.getDatabaseToken(ctx, existingDBs[probe].ID)
 		if err != nil {
 			return nil, err
 		}
-		if err := batchExecuteWithTokenFn(ctx, existingDBs[0].ID, probeToken, plan.SQL); err != nil {
+		if err := batchExecuteWithTokenFn(ctx, existingDBs[probe].ID, probeToken, migrationSQL); err != nil {
 			return nil, tools.InvalidMigrationErr(err.Error())
 		}
 	}
@@ -387,15 +521,23 @@ func (api *API) pushDefinition(ctx context.Context, name string, req PushDefinit
 	`, current.ID, version, string(schemaJSON), checksum, now); err != nil {
 		return nil, err
 	}
-	if len(plan.SQL) > 0 {
-		sqlJSON, err := json.Marshal(plan.SQL)
+	if len(migrationSQL) > 0 {
+		sqlJSON, err := json.Marshal(migrationSQL)
 		if err != nil {
 			return nil, err
 		}
-		if _, err := tx.ExecContext(ctx, `
+		result, err := tx.ExecContext(ctx, `
 			INSERT INTO atombase_migrations (definition_id, from_version, to_version, sql, created_at)
 			VALUES (?, ?, ?, ?, ?)
-		`, current.ID, current.CurrentVersion, version, string(sqlJSON), now); err != nil {
+		`, current.ID, current.CurrentVersion, version, string(sqlJSON), now)
+		if err != nil {
+			return nil, err
+		}
+		migrationID, err := result.LastInsertId()
+		if err != nil {
+			return nil, err
+		}
+		if err := saveMigrationWindows(ctx, tx, migrationID, windows); err != nil {
 			return nil, err
 		}
 	}
@@ -463,6 +605,10 @@ func (api *API) pushDefinition(ctx context.Context, name string, req PushDefinit
 		}
 	}
 
+	if err := insertDefinitionTests(ctx, tx, int64(current.ID), version, tests); err != nil {
+		return nil, err
+	}
+
 	if _, err := tx.ExecContext(ctx, `
 		UPDATE atombase_definitions
 		SET current_version = ?, updated_at = ?
@@ -471,12 +617,12 @@ func (api *API) pushDefinition(ctx context.Context, name string, req PushDefinit
 		return nil, err
 	}
 
-	if len(existingDBs) > 0 && len(plan.SQL) > 0 {
+	if probe >= 0 {
 		if _, err := tx.ExecContext(ctx, `
 			UPDATE atombase_databases
 			SET definition_version = ?, updated_at = ?
 			WHERE id = ?
-		`, version, now, existingDBs[0].ID); err != nil {
+		`, version, now, existingDBs[probe].ID); err != nil {
 			return nil, err
 		}
 	}
@@ -484,14 +630,21 @@ func (api *API) pushDefinition(ctx context.Context, name string, req PushDefinit
 	if err := tx.Commit(); err != nil {
 		return nil, err
 	}
+	tools.InvalidateDefinition(current.ID)
+	if probe >= 0 {
+		tools.UpdateDatabaseVersion(existingDBs[probe].ID, version)
+	}
 
 	return &DefinitionVersion{
 		DefinitionID: current.ID,
 		Version:      version,
-		Schema:       req.Schema,
-		Provision:    req.Provision,
+		Schema:       schema,
+		Provision:    provision,
+		Tests:        tests,
 		Checksum:     checksum,
 		CreatedAt:    mustParseTime(now),
+		Windows:      windows,
+		Impact:       impact,
 	}, nil
 }
 
@@ -535,13 +688,50 @@ func (api *API) getDefinitionHistory(ctx context.Context, name string) ([]Defini
 		item.CreatedAt = mustParseTime(createdAt)
 		items = append(items, item)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+	for i := range items {
+		items[i].Tests, err = api.loadDefinitionTests(ctx, items[i].DefinitionID, items[i].Version)
+		if err != nil {
+			return nil, err
+		}
+	}
 	if items == nil {
 		items = []DefinitionVersion{}
 	}
-	return items, rows.Err()
+	return items, nil
 }
 
 func mustParseTime(raw string) time.Time {
 	parsed, _ := time.Parse(time.RFC3339, raw)
 	return parsed
 }
+
+const auditDefinitionDeleted = "definition.deleted"
+
+// DeleteDefinition removes a definition with its history, policies and
+// migrations. Definitions that databases still use are left alone.
+func (api *API) DeleteDefinition(ctx context.Context, name string) error {
+	current, err := api.getDefinition(ctx, name)
+	if err != nil {
+		return err
+	}
+	conn, err := api.dbConn()
+	if err != nil {
+		return err
+	}
+	var inUse int
+	if err := conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM atombase_databases WHERE definition_id = ?`, current.ID).Scan(&inUse); err != nil {
+		return err
+	}
+	if inUse > 0 {
+		return tools.ErrDefinitionInUse
+	}
+	if _, err := conn.ExecContext(ctx, `DELETE FROM atombase_definitions WHERE id = ?`, current.ID); err != nil {
+		return err
+	}
+	tools.InvalidateDefinition(current.ID)
+	return api.recordAudit(ctx, auditDefinitionDeleted, name, map[string]int{"version": current.CurrentVersion})
+}
@@ -52,6 +52,14 @@ CREATE TABLE atombase_provision_policies (
 	conditions_json TEXT,
 	PRIMARY KEY(definition_id, version)
 );
+CREATE TABLE atombase_definition_tests (
+	definition_id INTEGER NOT NULL,
+	version INTEGER NOT NULL,
+	name TEXT NOT NULL,
+	query TEXT NOT NULL,
+	expect_json TEXT,
+	PRIMARY KEY(definition_id, version, name)
+);
 CREATE TABLE atombase_migrations (
 	id INTEGER PRIMARY KEY,
 	definition_id INTEGER NOT NULL,
@@ -60,6 +68,60 @@ CREATE TABLE atombase_migrations (
 	sql TEXT NOT NULL,
 	created_at TEXT NOT NULL
 );
+CREATE TABLE atombase_webhooks (
+	id TEXT PRIMARY KEY NOT NULL,
+	database_id TEXT NOT NULL,
+	table_name TEXT NOT NULL DEFAULT '',
+	events_json TEXT NOT NULL,
+	url TEXT NOT NULL,
+	secret_encrypted BLOB NOT NULL,
+	created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE TABLE atombase_webhook_deliveries (
+	id INTEGER PRIMARY KEY,
+	webhook_id TEXT NOT NULL,
+	event TEXT NOT NULL,
+	table_name TEXT NOT NULL,
+	payload TEXT NOT NULL,
+	status TEXT NOT NULL DEFAULT 'pending',
+	attempts INTEGER NOT NULL DEFAULT 0,
+	next_attempt_at TEXT NOT NULL,
+	locked_until TEXT,
+	response_status INTEGER,
+	error TEXT,
+	created_at TEXT NOT NULL,
+	delivered_at TEXT
+);
+CREATE TABLE atombase_backups (
+	id TEXT PRIMARY KEY NOT NULL,
+	database_id TEXT NOT NULL,
+	definition_version INTEGER NOT NULL,
+	location TEXT NOT NULL,
+	size INTEGER NOT NULL DEFAULT 0,
+	status TEXT NOT NULL,
+	error TEXT,
+	created_at TEXT NOT NULL,
+	finished_at TEXT,
+	changelog_seq INTEGER
+);
+CREATE TABLE atombase_migration_windows (
+	migration_id INTEGER PRIMARY KEY,
+	windows_json TEXT NOT NULL
+);
+CREATE TABLE atombase_database_schedules (
+	database_id TEXT PRIMARY KEY,
+	timezone TEXT NOT NULL DEFAULT '',
+	labels_json TEXT NOT NULL DEFAULT '[]',
+	updated_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE TABLE atombase_migration_failures (
+	database_id TEXT PRIMARY KEY,
+	from_version INTEGER NOT NULL,
+	to_version INTEGER NOT NULL,
+	error TEXT,
+	atomic INTEGER NOT NULL DEFAULT 1,
+	created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
 CREATE TABLE atombase_databases (
 	id TEXT PRIMARY KEY NOT NULL,
 	definition_id INTEGER NOT NULL,
@@ -68,11 +130,118 @@ CREATE TABLE atombase_databases (
 	created_at TEXT NOT NULL,
 	updated_at TEXT NOT NULL
 );
+CREATE TABLE atombase_database_drift (
+	database_id TEXT PRIMARY KEY,
+	definition_version INTEGER NOT NULL,
+	changes_json TEXT NOT NULL,
+	detected_at TEXT NOT NULL
+);
 CREATE TABLE atombase_users (
 	id TEXT PRIMARY KEY NOT NULL,
 	database_id TEXT UNIQUE,
 	updated_at TEXT
 );
+CREATE TABLE atombase_row_tenants (
+	user_id TEXT PRIMARY KEY,
+	database_id TEXT NOT NULL,
+	created_at TEXT NOT NULL
+);
+CREATE TABLE atombase_tenant_moves (
+	user_id TEXT PRIMARY KEY,
+	from_database_id TEXT NOT NULL,
+	to_database_id TEXT NOT NULL,
+	started_at TEXT NOT NULL
+);
+CREATE TABLE atombase_definition_sources (
+	definition_id INTEGER PRIMARY KEY REFERENCES atombase_definitions(id) ON DELETE CASCADE,
+	url TEXT NOT NULL,
+	sha256 TEXT NOT NULL,
+	updated_at TEXT NOT NULL
+);
+CREATE TABLE atombase_definition_residency (
+	definition_id INTEGER PRIMARY KEY REFERENCES atombase_definitions(id) ON DELETE CASCADE,
+	regions_json TEXT NOT NULL,
+	updated_at TEXT NOT NULL
+);
+CREATE TABLE atombase_database_residency (
+	database_id TEXT PRIMARY KEY REFERENCES atombase_databases(id) ON DELETE CASCADE,
+	regions_json TEXT NOT NULL,
+	updated_at TEXT NOT NULL
+);
+CREATE TABLE atombase_database_placements (
+	database_id TEXT PRIMARY KEY REFERENCES atombase_databases(id) ON DELETE CASCADE,
+	turso_group TEXT NOT NULL,
+	region TEXT NOT NULL,
+	created_at TEXT NOT NULL
+);
+CREATE TABLE atombase_jwt_keys (
+	id TEXT PRIMARY KEY NOT NULL,
+	database_id TEXT NOT NULL REFERENCES atombase_databases(id) ON DELETE CASCADE,
+	algorithm TEXT NOT NULL,
+	key_encrypted BLOB NOT NULL,
+	created_at TEXT NOT NULL
+);
+CREATE TABLE atombase_api_keys (
+	id TEXT PRIMARY KEY NOT NULL,
+	name TEXT NOT NULL,
+	secret_hash BLOB NOT NULL,
+	database_id TEXT REFERENCES atombase_databases(id) ON DELETE CASCADE,
+	tables_json TEXT NOT NULL DEFAULT '[]',
+	verbs_json TEXT NOT NULL,
+	created_at TEXT NOT NULL
+);
+CREATE TABLE atombase_platform_orgs (
+	id TEXT PRIMARY KEY NOT NULL,
+	name TEXT UNIQUE NOT NULL,
+	max_definitions INTEGER NOT NULL DEFAULT 0,
+	max_databases INTEGER NOT NULL DEFAULT 0,
+	created_at TEXT NOT NULL
+);
+CREATE TABLE atombase_definition_orgs (
+	definition_id INTEGER PRIMARY KEY REFERENCES atombase_definitions(id) ON DELETE CASCADE,
+	org_id TEXT NOT NULL REFERENCES atombase_platform_orgs(id)
+);
+CREATE TABLE atombase_api_key_orgs (
+	key_id TEXT PRIMARY KEY REFERENCES atombase_api_keys(id) ON DELETE CASCADE,
+	org_id TEXT NOT NULL REFERENCES atombase_platform_orgs(id) ON DELETE CASCADE,
+	role TEXT NOT NULL DEFAULT 'owner',
+	member_email TEXT
+);
+CREATE TABLE atombase_platform_org_members (
+	org_id TEXT NOT NULL,
+	email TEXT NOT NULL,
+	role TEXT NOT NULL,
+	created_at TEXT NOT NULL,
+	PRIMARY KEY (org_id, email)
+);
+CREATE TABLE atombase_service_accounts (
+	id TEXT PRIMARY KEY NOT NULL,
+	name TEXT NOT NULL,
+	public_key BLOB NOT NULL UNIQUE,
+	org_id TEXT,
+	role TEXT,
+	database_id TEXT,
+	tables_json TEXT NOT NULL DEFAULT '[]',
+	verbs_json TEXT NOT NULL,
+	created_at TEXT NOT NULL
+);
+CREATE TABLE atombase_platform_org_invitations (
+	id TEXT PRIMARY KEY NOT NULL,
+	org_id TEXT NOT NULL,
+	email TEXT NOT NULL,
+	role TEXT NOT NULL,
+	token_hash BLOB NOT NULL UNIQUE,
+	invited_by TEXT NOT NULL,
+	expires_at TEXT NOT NULL,
+	created_at TEXT NOT NULL
+);
+CREATE TABLE atombase_audit_log (
+	id INTEGER PRIMARY KEY,
+	action TEXT NOT NULL,
+	target TEXT NOT NULL,
+	detail_json TEXT NOT NULL,
+	created_at TEXT NOT NULL
+);
 CREATE TABLE atombase_organizations (
 	id TEXT PRIMARY KEY NOT NULL,
 	database_id TEXT NOT NULL UNIQUE,
@@ -306,19 +475,19 @@ func TestCreateDatabase_AttachesUserAndOrgMetadata(t *testing.T) {
 		t.Fatalf("createDefinition(org) failed: %v", err)
 	}
 
-	oldCreate := tursoCreateDatabaseFn
-	oldDelete := tursoDeleteDatabaseFn
-	oldToken := tursoCreateTokenFn
+	oldCreate := createTenantDatabaseFn
+	oldDelete := deleteTenantDatabaseFn
+	oldToken := createTenantTokenFn
 	oldBatch := batchExecuteWithTokenFn
 	defer func() {
-		tursoCreateDatabaseFn = oldCreate
-		tursoDeleteDatabaseFn = oldDelete
-		tursoCreateTokenFn = oldToken
+		createTenantDatabaseFn = oldCreate
+		deleteTenantDatabaseFn = oldDelete
+		createTenantTokenFn = oldToken
 		batchExecuteWithTokenFn = oldBatch
 	}()
-	tursoCreateDatabaseFn = func(ctx context.Context, name string) error { return nil }
-	tursoDeleteDatabaseFn = func(ctx context.Context, name string) error { return nil }
-	tursoCreateTokenFn = func(ctx context.Context, name string) (string, error) { return "token", nil }
+	createTenantDatabaseFn = func(ctx context.Context, name, group string) error { return nil }
+	deleteTenantDatabaseFn = func(ctx context.Context, name string) error { return nil }
+	createTenantTokenFn = func(ctx context.Context, name string) (string, error) { return "token", nil }
 	var executed map[string][]string
 	batchExecuteWithTokenFn = func(ctx context.Context, dbName, token string, statements []string) error {
 		if executed == nil {
@@ -382,10 +551,10 @@ func TestCreateDatabase_UserDefinitionRejectsDuplicateProvisioningBeforeSideEffe
 		t.Fatalf("createDefinition(user) failed: %v", err)
 	}
 
-	oldCreate := tursoCreateDatabaseFn
-	defer func() { tursoCreateDatabaseFn = oldCreate }()
+	oldCreate := createTenantDatabaseFn
+	defer func() { createTenantDatabaseFn = oldCreate }()
 	called := false
-	tursoCreateDatabaseFn = func(ctx context.Context, name string) error {
+	createTenantDatabaseFn = func(ctx context.Context, name, group string) error {
 		called = true
 		return nil
 	}
@@ -650,3 +819,51 @@ func TestPushDefinition_LocalProbeFailureStopsRemoteProbe(t *testing.T) {
 		t.Fatal("expected local probe failure to stop remote probe")
 	}
 }
+
+func TestDefinitionTests_StoredPerVersion(t *testing.T) {
+	api, db := setupPlatformAPI(t)
+	defer db.Close()
+
+	schema := Schema{Tables: []Table{{Name: "posts", Pk: []string{"id"}, Columns: map[string]Col{
+		"id":        {Name: "id", Type: "INTEGER"},
+		"author_id": {Name: "author_id", Type: "TEXT"},
+	}}}}
+	_, err := api.createDefinition(context.Background(), CreateDefinitionRequest{
+		Name:   "posts",
+		Type:   "global",
+		Schema: schema,
+		Tests:  []TestCase{{Name: "missing", Query: "SELECT id FROM comments"}},
+	})
+	if err == nil || !strings.Contains(err.Error(), `test "missing" is invalid`) {
+		t.Fatalf("expected invalid test query to be rejected, got %v", err)
+	}
+
+	if _, err := api.createDefinition(context.Background(), CreateDefinitionRequest{
+		Name:   "posts",
+		Type:   "global",
+		Schema: schema,
+		Tests:  []TestCase{{Name: "authored", Query: "SELECT id FROM posts WHERE author_id IS NULL"}},
+	}); err != nil {
+		t.Fatalf("createDefinition failed: %v", err)
+	}
+
+	next := Schema{Tables: []Table{{Name: "posts", Pk: []string{"id"}, Columns: map[string]Col{
+		"id":        {Name: "id", Type: "INTEGER"},
+		"author_id": {Name: "author_id", Type: "TEXT"},
+		"title":     {Name: "title", Type: "TEXT"},
+	}}}}
+	if _, err := api.pushDefinition(context.Background(), "posts", PushDefinitionRequest{
+		Schema: next,
+		Tests:  []TestCase{{Name: "count", Query: "SELECT COUNT(*) AS n FROM posts", Expect: []map[string]any{{"n": float64(0)}}}},
+	}); err != nil {
+		t.Fatalf("pushDefinition failed: %v", err)
+	}
+
+	history, err := api.getDefinitionHistory(context.Background(), "posts")
+	if err != nil {
+		t.Fatalf("getDefinitionHistory failed: %v", err)
+	}
+	if len(history) != 2 || len(history[0].Tests) != 1 || history[0].Tests[0].Name != "count" || history[1].Tests[0].Name != "authored" {
+		t.Fatalf("expected tests per version, got %+v", history)
+	}
+}
@@ -0,0 +1,130 @@
+package platform
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/atombasedev/atombase/tools"
+)
+
+// Migration export layouts.
+const (
+	ExportLayoutGolangMigrate = "golang-migrate"
+	ExportLayoutAtlas         = "atlas"
+)
+
+// exportDefinitionMigrations renders a definition's history as numbered SQL files.
+// The oldest retained version is the full CREATE script and every later file holds
+// the migration SQL for one version transition, numbered by the version it produces.
+func (api *API) exportDefinitionMigrations(ctx context.Context, name, layout string) (*MigrationExport, error) {
+	switch layout {
+	case "":
+		layout = ExportLayoutGolangMigrate
+	case ExportLayoutGolangMigrate, ExportLayoutAtlas:
+	default:
+		return nil, tools.InvalidRequestErr(fmt.Sprintf("unknown layout %q (expected %s or %s)", layout, ExportLayoutGolangMigrate, ExportLayoutAtlas))
+	}
+
+	def, err := api.getDefinition(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	history, err := api.getDefinitionHistory(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(history) == 0 {
+		return nil, fmt.Errorf("definition %s has no history", name)
+	}
+	// History is newest first and may have been pruned.
+	initial := history[len(history)-1]
+
+	conn, err := api.dbConn()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := conn.QueryContext(ctx, `
+		SELECT to_version, sql
+		FROM atombase_migrations
+		WHERE definition_id = ?
+		ORDER BY to_version ASC
+	`, def.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	export := &MigrationExport{Definition: def.Name, Layout: layout}
+	export.Files = append(export.Files, newMigrationFile(layout, def.Name, initial.Version, generateSchemaSQL(initial.Schema)))
+	for rows.Next() {
+		var version int
+		var sqlJSON string
+		if err := rows.Scan(&version, &sqlJSON); err != nil {
+			return nil, err
+		}
+		var statements []string
+		if err := json.Unmarshal([]byte(sqlJSON), &statements); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal SQL: %w", err)
+		}
+		export.Files = append(export.Files, newMigrationFile(layout, def.Name, version, statements))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if layout == ExportLayoutAtlas {
+		export.Files = append(export.Files, MigrationFile{Name: "atlas.sum", SQL: atlasSum(export.Files)})
+	}
+	return export, nil
+}
+
+func newMigrationFile(layout, definition string, version int, statements []string) MigrationFile {
+	var b strings.Builder
+	for _, stmt := range statements {
+		b.WriteString(strings.TrimRight(strings.TrimSpace(stmt), ";"))
+		b.WriteString(";\n\n")
+	}
+	fileName := fmt.Sprintf("%06d_%s_v%d.up.sql", version, definition, version)
+	if layout == ExportLayoutAtlas {
+		fileName = fmt.Sprintf("%06d_%s_v%d.sql", version, definition, version)
+	}
+	return MigrationFile{Name: fileName, Version: version, SQL: strings.TrimRight(b.String(), "\n") + "\n"}
+}
+
+// atlasSum builds an atlas.sum integrity file. Each entry hashes the cumulative
+// name and content of every file up to and including it, and the header line
+// hashes the entries themselves.
+func atlasSum(files []MigrationFile) string {
+	running := sha256.New()
+	var entries strings.Builder
+	total := sha256.New()
+	for _, f := range files {
+		running.Write([]byte(f.Name))
+		running.Write([]byte(f.SQL))
+		hash := base64.StdEncoding.EncodeToString(running.Sum(nil))
+		total.Write([]byte(f.Name))
+		total.Write([]byte(hash))
+		fmt.Fprintf(&entries, "%s h1:%s\n", f.Name, hash)
+	}
+	return fmt.Sprintf("h1:%s\n%s", base64.StdEncoding.EncodeToString(total.Sum(nil)), entries.String())
+}
+
+// writeMigrationZip writes the export as a zip archive of its files.
+func writeMigrationZip(w io.Writer, export *MigrationExport) error {
+	zw := zip.NewWriter(w)
+	for _, f := range export.Files {
+		fw, err := zw.Create(f.Name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(fw, f.SQL); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
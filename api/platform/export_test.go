@@ -0,0 +1,64 @@
+package platform
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestExportDefinitionMigrations(t *testing.T) {
+	api, db := setupPlatformAPI(t)
+	defer db.Close()
+
+	v1 := Schema{Tables: []Table{{Name: "notes", Pk: []string{"id"}, Columns: map[string]Col{
+		"id": {Name: "id", Type: "INTEGER"},
+	}}}}
+	if _, err := api.createDefinition(context.Background(), CreateDefinitionRequest{Name: "notes", Type: "global", Schema: v1}); err != nil {
+		t.Fatalf("createDefinition failed: %v", err)
+	}
+	v2 := Schema{Tables: []Table{{Name: "notes", Pk: []string{"id"}, Columns: map[string]Col{
+		"id":   {Name: "id", Type: "INTEGER"},
+		"body": {Name: "body", Type: "TEXT"},
+	}}}}
+	if _, err := api.pushDefinition(context.Background(), "notes", PushDefinitionRequest{Schema: v2}); err != nil {
+		t.Fatalf("pushDefinition failed: %v", err)
+	}
+
+	export, err := api.exportDefinitionMigrations(context.Background(), "notes", "")
+	if err != nil {
+		t.Fatalf("export failed: %v", err)
+	}
+	if export.Layout != ExportLayoutGolangMigrate || len(export.Files) != 2 {
+		t.Fatalf("unexpected export: %+v", export)
+	}
+	if export.Files[0].Name != "000001_notes_v1.up.sql" || !strings.Contains(export.Files[0].SQL, "CREATE TABLE [notes]") {
+		t.Fatalf("unexpected initial file: %+v", export.Files[0])
+	}
+	if export.Files[1].Name != "000002_notes_v2.up.sql" || !strings.Contains(export.Files[1].SQL, "ADD COLUMN [body]") {
+		t.Fatalf("unexpected migration file: %+v", export.Files[1])
+	}
+
+	atlas, err := api.exportDefinitionMigrations(context.Background(), "notes", ExportLayoutAtlas)
+	if err != nil {
+		t.Fatalf("atlas export failed: %v", err)
+	}
+	sum := atlas.Files[len(atlas.Files)-1]
+	if sum.Name != "atlas.sum" || !strings.HasPrefix(sum.SQL, "h1:") || !strings.Contains(sum.SQL, "000002_notes_v2.sql h1:") {
+		t.Fatalf("unexpected atlas.sum: %+v", sum)
+	}
+
+	var buf bytes.Buffer
+	if err := writeMigrationZip(&buf, export); err != nil {
+		t.Fatalf("writeMigrationZip failed: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil || len(zr.File) != 2 {
+		t.Fatalf("expected 2 zipped files, got %v (%v)", zr, err)
+	}
+
+	if _, err := api.exportDefinitionMigrations(context.Background(), "notes", "flyway"); err == nil {
+		t.Fatal("expected unknown layout to fail")
+	}
+}
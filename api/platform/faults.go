@@ -0,0 +1,54 @@
+package platform
+
+import (
+	"net/http"
+
+	"github.com/atombasedev/atombase/tools"
+)
+
+const auditFaultsUpdated = "faults.updated"
+
+// FaultsRequest replaces the active injected faults.
+type FaultsRequest struct {
+	Faults []tools.Fault `json:"faults"`
+}
+
+// registerFaultRoutes exposes fault injection in binaries built with the faults
+// tag. Changes are audited so a test run can be correlated with what was injected.
+func (api *API) registerFaultRoutes(mux orgMux) {
+	mux.HandleFunc("GET /platform/debug/faults", api.handleListFaults)
+	mux.HandleFunc("PUT /platform/debug/faults", api.handleSetFaults)
+	mux.HandleFunc("DELETE /platform/debug/faults", api.handleClearFaults)
+}
+
+func (api *API) handleListFaults(w http.ResponseWriter, r *http.Request) {
+	tools.RespondJSON(w, http.StatusOK, FaultsRequest{Faults: tools.ListFaults()})
+}
+
+func (api *API) handleSetFaults(w http.ResponseWriter, r *http.Request) {
+	tools.LimitBody(w, r)
+	defer r.Body.Close()
+	var req FaultsRequest
+	if err := tools.DecodeJSON(r.Body, &req); err != nil {
+		tools.RespErr(w, tools.ErrInvalidJSON)
+		return
+	}
+	if err := tools.SetFaults(req.Faults); err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	if err := api.recordAudit(r.Context(), auditFaultsUpdated, "server", req); err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	tools.RespondJSON(w, http.StatusOK, FaultsRequest{Faults: tools.ListFaults()})
+}
+
+func (api *API) handleClearFaults(w http.ResponseWriter, r *http.Request) {
+	tools.ClearFaults()
+	if err := api.recordAudit(r.Context(), auditFaultsUpdated, "server", FaultsRequest{Faults: []tools.Fault{}}); err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,54 @@
+package platform
+
+import (
+	"fmt"
+	"slices"
+)
+
+// applyForeignKeyIndexes adds an index for each foreign key column the next
+// schema introduces when its settings ask for it. SQLite does not index
+// foreign keys itself, so without one every delete or update of a parent row
+// scans the child table. Columns a primary key, unique constraint or index
+// already leads with are left alone, as are foreign keys current already has,
+// so an index dropped on purpose is not brought back. current is nil when
+// the definition is being created.
+func applyForeignKeyIndexes(current *Schema, next *Schema) {
+	if next.Settings == nil || !next.Settings.IndexForeignKeys {
+		return
+	}
+	existing := map[string]Col{}
+	if current != nil {
+		for _, table := range current.Tables {
+			for name, col := range table.Columns {
+				existing[table.Name+"."+name] = col
+			}
+		}
+	}
+
+	for i := range next.Tables {
+		table := &next.Tables[i]
+		var added []Index
+		for _, name := range sortedKeys(table.Columns) {
+			col := table.Columns[name]
+			if col.References == "" || col.Unique {
+				continue
+			}
+			if old, ok := existing[table.Name+"."+name]; ok && old.References != "" {
+				continue
+			}
+			if len(table.Pk) > 0 && table.Pk[0] == name {
+				continue
+			}
+			indexName := fmt.Sprintf("idx_%s_%s", table.Name, name)
+			if slices.ContainsFunc(table.Indexes, func(index Index) bool {
+				return index.Name == indexName || (len(index.Columns) > 0 && index.Columns[0] == name)
+			}) {
+				continue
+			}
+			added = append(added, Index{Name: indexName, Columns: []string{name}})
+		}
+		if len(added) > 0 {
+			table.Indexes = append(append([]Index{}, table.Indexes...), added...)
+		}
+	}
+}
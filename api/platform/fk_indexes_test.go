@@ -0,0 +1,87 @@
+package platform
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestApplyForeignKeyIndexes(t *testing.T) {
+	current := Schema{Tables: []Table{{Name: "posts", Pk: []string{"id"}, Columns: map[string]Col{
+		"id":        {Name: "id", Type: "INTEGER"},
+		"author_id": {Name: "author_id", Type: "INTEGER", References: "users.id"},
+	}}}}
+	next := Schema{
+		Settings: &APISettings{IndexForeignKeys: true},
+		Tables: []Table{
+			{Name: "posts", Pk: []string{"id"}, Columns: map[string]Col{
+				"id":        {Name: "id", Type: "INTEGER"},
+				"author_id": {Name: "author_id", Type: "INTEGER", References: "users.id"},
+				"editor_id": {Name: "editor_id", Type: "INTEGER", References: "users.id"},
+				"topic_id":  {Name: "topic_id", Type: "INTEGER", References: "topics.id"},
+				"slug_id":   {Name: "slug_id", Type: "INTEGER", References: "slugs.id", Unique: true},
+			}, Indexes: []Index{{Name: "idx_posts_topic", Columns: []string{"topic_id", "id"}}}},
+			{Name: "post_tags", Pk: []string{"post_id", "tag_id"}, Columns: map[string]Col{
+				"post_id": {Name: "post_id", Type: "INTEGER", References: "posts.id"},
+				"tag_id":  {Name: "tag_id", Type: "INTEGER", References: "tags.id"},
+			}},
+		},
+	}
+
+	applyForeignKeyIndexes(&current, &next)
+	var names []string
+	for _, table := range next.Tables {
+		for _, index := range table.Indexes {
+			names = append(names, index.Name)
+		}
+	}
+	if got := strings.Join(names, ","); got != "idx_posts_topic,idx_posts_editor_id,idx_post_tags_tag_id" {
+		t.Fatalf("unexpected indexes: %s", got)
+	}
+
+	off := Schema{Tables: []Table{{Name: "posts", Columns: map[string]Col{
+		"author_id": {Name: "author_id", Type: "INTEGER", References: "users.id"},
+	}}}}
+	applyForeignKeyIndexes(nil, &off)
+	if len(off.Tables[0].Indexes) != 0 {
+		t.Fatal("expected no indexes without the setting")
+	}
+}
+
+func TestPushDefinition_IndexesNewForeignKeys(t *testing.T) {
+	api, db := setupPlatformAPI(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	settings := &APISettings{IndexForeignKeys: true}
+	users := Table{Name: "users", Pk: []string{"id"}, Columns: map[string]Col{"id": {Name: "id", Type: "INTEGER"}}}
+	if _, err := api.createDefinition(ctx, CreateDefinitionRequest{
+		Name:   "blog",
+		Type:   "global",
+		Schema: Schema{Settings: settings, Tables: []Table{users}},
+	}); err != nil {
+		t.Fatalf("createDefinition failed: %v", err)
+	}
+
+	version, err := api.pushDefinition(ctx, "blog", PushDefinitionRequest{Schema: Schema{Settings: settings, Tables: []Table{users, {
+		Name: "posts",
+		Pk:   []string{"id"},
+		Columns: map[string]Col{
+			"id":        {Name: "id", Type: "INTEGER"},
+			"author_id": {Name: "author_id", Type: "INTEGER", References: "users.id", OnDelete: "CASCADE"},
+		},
+	}}}})
+	if err != nil {
+		t.Fatalf("pushDefinition failed: %v", err)
+	}
+	if indexes := version.Schema.Tables[1].Indexes; len(indexes) != 1 || indexes[0].Name != "idx_posts_author_id" {
+		t.Fatalf("expected posts.author_id to be indexed, got %+v", indexes)
+	}
+	var migration string
+	if err := db.QueryRow(`SELECT sql FROM atombase_migrations WHERE to_version = 2`).Scan(&migration); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(migration, "idx_posts_author_id") {
+		t.Fatalf("expected the migration to create the index, got %s", migration)
+	}
+}
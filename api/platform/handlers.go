@@ -3,8 +3,13 @@ package platform
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	"fmt"
+	"io"
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/atombasedev/atombase/config"
 	"github.com/atombasedev/atombase/definitions"
 	"github.com/atombasedev/atombase/tools"
 )
@@ -22,17 +27,84 @@ func schemaChecksum(schema Schema) (string, []byte, error) {
 	return hex.EncodeToString(hash[:]), schemaJSON, nil
 }
 
-func (api *API) RegisterRoutes(mux *http.ServeMux) {
+func (api *API) RegisterRoutes(app *http.ServeMux) {
+	mux := orgMux{api: api, mux: app}
 	mux.HandleFunc("GET /platform/definitions", api.handleListDefinitions)
 	mux.HandleFunc("GET /platform/definitions/{name}", api.handleGetDefinition)
 	mux.HandleFunc("POST /platform/definitions", api.handleCreateDefinition)
 	mux.HandleFunc("POST /platform/definitions/{name}/push", api.handlePushDefinition)
+	mux.HandleFunc("POST /platform/definitions/{name}/migrate", api.handleMigrateDefinition)
+	mux.HandleFunc("GET /platform/definitions/{name}/pull", api.handlePreviewDefinitionPull)
+	mux.HandleFunc("POST /platform/definitions/{name}/pull", api.handlePullDefinition)
 	mux.HandleFunc("GET /platform/definitions/{name}/history", api.handleGetDefinitionHistory)
+	mux.HandleFunc("DELETE /platform/definitions/{name}/history", api.handlePruneDefinitionHistory)
+	mux.HandleFunc("GET /platform/definitions/{name}/migrations/export", api.handleExportDefinitionMigrations)
+	mux.HandleFunc("GET /platform/definitions/{name}/types", api.handleGetDefinitionTypes)
+	mux.HandleFunc("GET /platform/definitions/{name}/residency", api.handleGetDefinitionResidency)
+	mux.HandleFunc("PUT /platform/definitions/{name}/residency", api.handleSetDefinitionResidency)
+	mux.HandleFunc("POST /platform/migrations/{id}/rollback-applied", api.handleRollbackAppliedMigration)
 
 	mux.HandleFunc("GET /platform/databases", api.handleListDatabases)
 	mux.HandleFunc("GET /platform/databases/{id}", api.handleGetDatabase)
 	mux.HandleFunc("POST /platform/databases", api.handleCreateDatabase)
+	mux.HandleFunc("POST /platform/databases/adopt", api.handleAdoptDatabase)
+	mux.HandleFunc("GET /platform/databases/{id}/drift", api.handleGetDatabaseDrift)
+	mux.HandleFunc("POST /platform/databases/{id}/sync-replica", api.handleSyncDatabaseReplica)
+	mux.HandleFunc("GET /platform/databases/{id}/export", api.handleExportDatabase)
+	mux.HandleFunc("POST /platform/databases/{id}/import", api.handleImportDatabase)
+	mux.HandleFunc("POST /platform/databases/{id}/restore", api.handleRestoreDatabase)
+	mux.HandleFunc("GET /platform/databases/{id}/tenants", api.handleListRowTenants)
+	mux.HandleFunc("POST /platform/databases/{id}/tenants", api.handleAttachRowTenant)
+	mux.HandleFunc("DELETE /platform/databases/{id}/tenants/{userId}", api.handleDetachRowTenant)
+	mux.HandleFunc("POST /platform/databases/{id}/tenants/{userId}/promote", api.handlePromoteRowTenant)
+	mux.HandleFunc("POST /platform/databases/{id}/demote", api.handleDemoteDatabase)
+	mux.HandleFunc("GET /platform/databases/{id}/residency", api.handleGetDatabaseResidency)
+	mux.HandleFunc("PUT /platform/databases/{id}/residency", api.handleSetDatabaseResidency)
+	mux.HandleFunc("GET /platform/databases/{id}/schedule", api.handleGetDatabaseSchedule)
+	mux.HandleFunc("PUT /platform/databases/{id}/schedule", api.handleSetDatabaseSchedule)
+	mux.HandleFunc("GET /platform/databases/{id}/jwt-keys", api.handleListJWTKeys)
+	mux.HandleFunc("POST /platform/databases/{id}/jwt-keys", api.handleCreateJWTKey)
+	mux.HandleFunc("DELETE /platform/databases/{id}/jwt-keys/{kid}", api.handleDeleteJWTKey)
+	mux.HandleFunc("GET /platform/databases/{id}/webhooks", api.handleListWebhooks)
+	mux.HandleFunc("POST /platform/databases/{id}/webhooks", api.handleCreateWebhook)
+	mux.HandleFunc("DELETE /platform/databases/{id}/webhooks/{webhookId}", api.handleDeleteWebhook)
+	mux.HandleFunc("GET /platform/databases/{id}/webhooks/{webhookId}/deliveries", api.handleListWebhookDeliveries)
+	mux.HandleFunc("GET /platform/databases/{id}/queries", api.handleListActiveQueries)
+	mux.HandleFunc("DELETE /platform/databases/{id}/queries/{queryId}", api.handleInterruptQuery)
 	mux.HandleFunc("DELETE /platform/databases/{id}", api.handleDeleteDatabase)
+	mux.HandleFunc("GET /platform/backups", api.handleListBackups)
+	mux.HandleFunc("POST /platform/backups/{id}/restore", api.handleRestoreBackup)
+
+	mux.HandleFunc("GET /platform/keys", api.handleListAPIKeys)
+	mux.HandleFunc("POST /platform/keys", api.handleCreateAPIKey)
+	mux.HandleFunc("DELETE /platform/keys/{id}", api.handleDeleteAPIKey)
+	mux.HandleFunc("GET /platform/service-accounts", api.handleListServiceAccounts)
+	mux.HandleFunc("POST /platform/service-accounts", api.handleCreateServiceAccount)
+	mux.HandleFunc("DELETE /platform/service-accounts/{id}", api.handleDeleteServiceAccount)
+
+	mux.HandleFunc("GET /platform/orgs", api.handleListOrgs)
+	mux.HandleFunc("POST /platform/orgs", api.handleCreateOrg)
+	mux.HandleFunc("GET /platform/orgs/{id}", api.handleGetOrg)
+	mux.HandleFunc("PATCH /platform/orgs/{id}", api.handleUpdateOrg)
+	mux.HandleFunc("DELETE /platform/orgs/{id}", api.handleDeleteOrg)
+	mux.HandleFunc("GET /platform/orgs/{id}/members", api.handleListOrgMembers)
+	mux.HandleFunc("PATCH /platform/orgs/{id}/members/{email}", api.handleUpdateOrgMember)
+	mux.HandleFunc("DELETE /platform/orgs/{id}/members/{email}", api.handleRemoveOrgMember)
+	mux.HandleFunc("GET /platform/orgs/{id}/invitations", api.handleListOrgInvitations)
+	mux.HandleFunc("POST /platform/orgs/{id}/invitations", api.handleCreateOrgInvitation)
+	mux.HandleFunc("DELETE /platform/orgs/{id}/invitations/{invitationId}", api.handleDeleteOrgInvitation)
+	// The invitation token is the credential, so no org key is checked.
+	app.HandleFunc("POST /platform/invitations/accept", api.handleAcceptOrgInvitation)
+
+	mux.HandleFunc("GET /platform/audit", api.handleListAuditLog)
+	mux.HandleFunc("GET /platform/version", api.handleGetVersion)
+
+	if config.Cfg.DebugEndpoints {
+		api.registerDebugRoutes(mux)
+	}
+	if tools.FaultInjectionEnabled {
+		api.registerFaultRoutes(mux)
+	}
 }
 
 func (api *API) handleListDefinitions(w http.ResponseWriter, r *http.Request) {
@@ -67,6 +139,14 @@ func (api *API) handleCreateDefinition(w http.ResponseWriter, r *http.Request) {
 		tools.RespErr(w, tools.ErrInvalidJSON)
 		return
 	}
+	if req.Source != nil {
+		resolved, err := resolveDefinitionSource(r.Context(), req)
+		if err != nil {
+			tools.RespErr(w, err)
+			return
+		}
+		req = resolved
+	}
 	if req.Name == "" {
 		tools.RespErr(w, tools.InvalidRequestErr("name is required"))
 		return
@@ -113,6 +193,62 @@ func (api *API) handlePushDefinition(w http.ResponseWriter, r *http.Request) {
 	tools.RespondJSON(w, http.StatusOK, item)
 }
 
+func (api *API) handleMigrateDefinition(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if name == "" {
+		tools.RespErr(w, tools.InvalidRequestErr("definition name is required"))
+		return
+	}
+	tools.LimitBody(w, r)
+	defer r.Body.Close()
+	var req MigrateDefinitionRequest
+	if err := tools.DecodeJSON(r.Body, &req); err != nil {
+		tools.RespErr(w, tools.ErrInvalidJSON)
+		return
+	}
+	item, err := api.migrateDefinitionSQL(r.Context(), name, req)
+	if err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	tools.RespondJSON(w, http.StatusOK, item)
+}
+
+func (api *API) handlePreviewDefinitionPull(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if name == "" {
+		tools.RespErr(w, tools.InvalidRequestErr("definition name is required"))
+		return
+	}
+	item, err := api.previewDefinitionPull(r.Context(), name, r.URL.Query().Get("url"))
+	if err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	tools.RespondJSON(w, http.StatusOK, item)
+}
+
+func (api *API) handlePullDefinition(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if name == "" {
+		tools.RespErr(w, tools.InvalidRequestErr("definition name is required"))
+		return
+	}
+	tools.LimitBody(w, r)
+	defer r.Body.Close()
+	var req PullDefinitionRequest
+	if err := tools.DecodeJSON(r.Body, &req); err != nil {
+		tools.RespErr(w, tools.ErrInvalidJSON)
+		return
+	}
+	item, err := api.pullDefinition(r.Context(), name, req)
+	if err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	tools.RespondJSON(w, http.StatusOK, item)
+}
+
 func (api *API) handleGetDefinitionHistory(w http.ResponseWriter, r *http.Request) {
 	name := r.PathValue("name")
 	if name == "" {
@@ -127,6 +263,98 @@ func (api *API) handleGetDefinitionHistory(w http.ResponseWriter, r *http.Reques
 	tools.RespondJSON(w, http.StatusOK, items)
 }
 
+func (api *API) handlePruneDefinitionHistory(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if name == "" {
+		tools.RespErr(w, tools.InvalidRequestErr("definition name is required"))
+		return
+	}
+	keep, err := strconv.Atoi(r.URL.Query().Get("keep"))
+	if err != nil {
+		tools.RespErr(w, tools.InvalidRequestErr("keep must be a positive integer"))
+		return
+	}
+	resp, err := api.pruneDefinitionHistory(r.Context(), name, keep)
+	if err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	tools.RespondJSON(w, http.StatusOK, resp)
+}
+
+func (api *API) handleExportDefinitionMigrations(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if name == "" {
+		tools.RespErr(w, tools.InvalidRequestErr("definition name is required"))
+		return
+	}
+	export, err := api.exportDefinitionMigrations(r.Context(), name, r.URL.Query().Get("layout"))
+	if err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	if r.URL.Query().Get("format") != "zip" {
+		tools.RespondJSON(w, http.StatusOK, export)
+		return
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", export.Definition+"-migrations.zip"))
+	w.WriteHeader(http.StatusOK)
+	if err := writeMigrationZip(w, export); err != nil {
+		tools.Logger.Error("failed to write migration export", "definition", export.Definition, "error", err)
+	}
+}
+
+func (api *API) handleGetDefinitionTypes(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if name == "" {
+		tools.RespErr(w, tools.InvalidRequestErr("definition name is required"))
+		return
+	}
+	query := r.URL.Query()
+	version := 0
+	if raw := query.Get("version"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v <= 0 {
+			tools.RespErr(w, tools.InvalidRequestErr("invalid version"))
+			return
+		}
+		version = v
+	}
+	source, err := api.definitionTypes(r.Context(), name, query.Get("lang"), query.Get("package"), version)
+	if err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, source)
+}
+
+func (api *API) handleRollbackAppliedMigration(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		tools.RespErr(w, tools.InvalidRequestErr("invalid migration id"))
+		return
+	}
+	tools.LimitBody(w, r)
+	defer r.Body.Close()
+
+	var req RollbackMigrationRequest
+	if r.ContentLength != 0 {
+		if err := tools.DecodeJSON(r.Body, &req); err != nil {
+			tools.RespErr(w, tools.ErrInvalidJSON)
+			return
+		}
+	}
+	resp, err := api.rollbackAppliedMigration(r.Context(), id, req)
+	if err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	tools.RespondJSON(w, http.StatusOK, resp)
+}
+
 func (api *API) handleListDatabases(w http.ResponseWriter, r *http.Request) {
 	items, err := api.listDatabases(r.Context())
 	if err != nil {
@@ -187,15 +415,737 @@ func (api *API) handleCreateDatabase(w http.ResponseWriter, r *http.Request) {
 	tools.RespondJSON(w, http.StatusCreated, item)
 }
 
-func (api *API) handleDeleteDatabase(w http.ResponseWriter, r *http.Request) {
+func (api *API) handleAdoptDatabase(w http.ResponseWriter, r *http.Request) {
+	tools.LimitBody(w, r)
+	defer r.Body.Close()
+	var req AdoptDatabaseRequest
+	if err := tools.DecodeJSON(r.Body, &req); err != nil {
+		tools.RespErr(w, tools.ErrInvalidJSON)
+		return
+	}
+	if req.ID == "" {
+		tools.RespErr(w, tools.InvalidRequestErr("id is required"))
+		return
+	}
+	if code, msg, _ := tools.ValidateResourceName(req.ID); code != "" {
+		tools.RespErr(w, tools.InvalidRequestErr(msg))
+		return
+	}
+	if req.Definition == "" {
+		tools.RespErr(w, tools.InvalidRequestErr("definition is required"))
+		return
+	}
+	if code, msg, _ := tools.ValidateResourceName(req.Definition); code != "" {
+		tools.RespErr(w, tools.InvalidRequestErr(msg))
+		return
+	}
+	item, err := api.adoptDatabase(r.Context(), req)
+	if err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	tools.RespondJSON(w, http.StatusCreated, item)
+}
+
+func (api *API) handleGetDatabaseDrift(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
 	if id == "" {
 		tools.RespErr(w, tools.InvalidRequestErr("database id is required"))
 		return
 	}
-	if err := api.deleteDatabase(r.Context(), id); err != nil {
+	if _, err := api.getDatabase(r.Context(), id); err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	items, err := api.getDatabaseDrift(r.Context(), id)
+	if err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	tools.RespondJSON(w, http.StatusOK, items)
+}
+
+func (api *API) handleSyncDatabaseReplica(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		tools.RespErr(w, tools.InvalidRequestErr("database id is required"))
+		return
+	}
+	info, err := api.syncDatabaseReplica(r.Context(), id)
+	if err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	tools.RespondJSON(w, http.StatusOK, info)
+}
+
+func (api *API) handleExportDatabase(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		tools.RespErr(w, tools.InvalidRequestErr("database id is required"))
+		return
+	}
+	file, err := api.exportDatabase(r.Context(), id, r.URL.Query().Get("format"))
+	if err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	defer file.Close()
+	contentType, name := "application/vnd.sqlite3", id+".db"
+	if r.URL.Query().Get("format") == tools.TenantExportSQL {
+		contentType, name = "application/sql", id+".sql"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	if stat, err := file.Stat(); err == nil {
+		w.Header().Set("Content-Length", strconv.FormatInt(stat.Size(), 10))
+	}
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, file); err != nil {
+		tools.Logger.Error("failed to write database export", "database", id, "error", err)
+	}
+}
+
+// handleImportDatabase reads the import from the raw request body, bounded by
+// ATOMICBASE_IMPORT_MAX_SIZE rather than the JSON body limit.
+func (api *API) handleImportDatabase(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		tools.RespErr(w, tools.InvalidRequestErr("database id is required"))
+		return
+	}
+	query := r.URL.Query()
+	resp, err := api.importDatabase(r.Context(), id, query.Get("format"), query.Get("mode"), query.Get("dryRun") == "true", r.Body)
+	if err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	tools.RespondJSON(w, http.StatusOK, resp)
+}
+
+func (api *API) handleRestoreDatabase(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		tools.RespErr(w, tools.InvalidRequestErr("database id is required"))
+		return
+	}
+	query := r.URL.Query()
+	at, err := time.Parse(time.RFC3339, query.Get("at"))
+	if err != nil {
+		tools.RespErr(w, tools.InvalidRequestErr("at must be an RFC 3339 time such as 2024-05-01T12:00:00Z"))
+		return
+	}
+	resp, err := api.restoreDatabaseAt(r.Context(), id, at, query.Get("dryRun") == "true")
+	if err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	tools.RespondJSON(w, http.StatusOK, resp)
+}
+
+func (api *API) handleListActiveQueries(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		tools.RespErr(w, tools.InvalidRequestErr("database id is required"))
+		return
+	}
+	queries, err := api.listActiveQueries(r.Context(), id)
+	if err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	tools.RespondJSON(w, http.StatusOK, queries)
+}
+
+func (api *API) handleInterruptQuery(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		tools.RespErr(w, tools.InvalidRequestErr("database id is required"))
+		return
+	}
+	if err := api.interruptQuery(r.Context(), id, r.PathValue("queryId")); err != nil {
 		tools.RespErr(w, err)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
 }
+
+func (api *API) handleListBackups(w http.ResponseWriter, r *http.Request) {
+	backups, err := api.listBackups(r.Context(), r.URL.Query().Get("database"))
+	if err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	tools.RespondJSON(w, http.StatusOK, backups)
+}
+
+func (api *API) handleRestoreBackup(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		tools.RespErr(w, tools.InvalidRequestErr("backup id is required"))
+		return
+	}
+	resp, err := api.restoreBackup(r.Context(), id, r.URL.Query().Get("dryRun") == "true")
+	if err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	tools.RespondJSON(w, http.StatusOK, resp)
+}
+
+func (api *API) handleListRowTenants(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		tools.RespErr(w, tools.InvalidRequestErr("database id is required"))
+		return
+	}
+	items, err := api.listRowTenants(r.Context(), id)
+	if err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	tools.RespondJSON(w, http.StatusOK, items)
+}
+
+func (api *API) handleAttachRowTenant(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		tools.RespErr(w, tools.InvalidRequestErr("database id is required"))
+		return
+	}
+	tools.LimitBody(w, r)
+	defer r.Body.Close()
+	var req AttachRowTenantRequest
+	if err := tools.DecodeJSON(r.Body, &req); err != nil {
+		tools.RespErr(w, tools.ErrInvalidJSON)
+		return
+	}
+	item, err := api.attachRowTenant(r.Context(), id, req.UserID)
+	if err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	tools.RespondJSON(w, http.StatusCreated, item)
+}
+
+func (api *API) handleDetachRowTenant(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	userID := r.PathValue("userId")
+	if id == "" || userID == "" {
+		tools.RespErr(w, tools.InvalidRequestErr("database id and user id are required"))
+		return
+	}
+	if err := api.detachRowTenant(r.Context(), id, userID); err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (api *API) handlePromoteRowTenant(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	userID := r.PathValue("userId")
+	if id == "" || userID == "" {
+		tools.RespErr(w, tools.InvalidRequestErr("database id and user id are required"))
+		return
+	}
+	tools.LimitBody(w, r)
+	defer r.Body.Close()
+	var req PromoteRowTenantRequest
+	if err := tools.DecodeJSON(r.Body, &req); err != nil {
+		tools.RespErr(w, tools.ErrInvalidJSON)
+		return
+	}
+	resp, err := api.promoteRowTenant(r.Context(), id, userID, req)
+	if err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	tools.RespondJSON(w, http.StatusOK, resp)
+}
+
+func (api *API) handleDemoteDatabase(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		tools.RespErr(w, tools.InvalidRequestErr("database id is required"))
+		return
+	}
+	tools.LimitBody(w, r)
+	defer r.Body.Close()
+	var req DemoteDatabaseRequest
+	if err := tools.DecodeJSON(r.Body, &req); err != nil {
+		tools.RespErr(w, tools.ErrInvalidJSON)
+		return
+	}
+	resp, err := api.demoteDatabase(r.Context(), id, req)
+	if err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	tools.RespondJSON(w, http.StatusOK, resp)
+}
+
+func (api *API) handleDeleteDatabase(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		tools.RespErr(w, tools.InvalidRequestErr("database id is required"))
+		return
+	}
+	if err := api.deleteDatabase(r.Context(), id); err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (api *API) handleGetDefinitionResidency(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if name == "" {
+		tools.RespErr(w, tools.InvalidRequestErr("definition name is required"))
+		return
+	}
+	resp, err := api.getDefinitionResidency(r.Context(), name)
+	if err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	tools.RespondJSON(w, http.StatusOK, resp)
+}
+
+func (api *API) handleSetDefinitionResidency(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if name == "" {
+		tools.RespErr(w, tools.InvalidRequestErr("definition name is required"))
+		return
+	}
+	tools.LimitBody(w, r)
+	defer r.Body.Close()
+	var req ResidencyRules
+	if err := tools.DecodeJSON(r.Body, &req); err != nil {
+		tools.RespErr(w, tools.ErrInvalidJSON)
+		return
+	}
+	resp, err := api.setDefinitionResidency(r.Context(), name, req)
+	if err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	tools.RespondJSON(w, http.StatusOK, resp)
+}
+
+func (api *API) handleGetDatabaseResidency(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		tools.RespErr(w, tools.InvalidRequestErr("database id is required"))
+		return
+	}
+	resp, err := api.getDatabaseResidency(r.Context(), id)
+	if err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	tools.RespondJSON(w, http.StatusOK, resp)
+}
+
+func (api *API) handleSetDatabaseResidency(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		tools.RespErr(w, tools.InvalidRequestErr("database id is required"))
+		return
+	}
+	tools.LimitBody(w, r)
+	defer r.Body.Close()
+	var req ResidencyRules
+	if err := tools.DecodeJSON(r.Body, &req); err != nil {
+		tools.RespErr(w, tools.ErrInvalidJSON)
+		return
+	}
+	resp, err := api.setDatabaseResidency(r.Context(), id, req)
+	if err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	tools.RespondJSON(w, http.StatusOK, resp)
+}
+
+func (api *API) handleGetDatabaseSchedule(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		tools.RespErr(w, tools.InvalidRequestErr("database id is required"))
+		return
+	}
+	resp, err := api.getDatabaseSchedule(r.Context(), id)
+	if err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	tools.RespondJSON(w, http.StatusOK, resp)
+}
+
+func (api *API) handleSetDatabaseSchedule(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		tools.RespErr(w, tools.InvalidRequestErr("database id is required"))
+		return
+	}
+	tools.LimitBody(w, r)
+	defer r.Body.Close()
+	var req DatabaseSchedule
+	if err := tools.DecodeJSON(r.Body, &req); err != nil {
+		tools.RespErr(w, tools.ErrInvalidJSON)
+		return
+	}
+	resp, err := api.setDatabaseSchedule(r.Context(), id, req)
+	if err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	tools.RespondJSON(w, http.StatusOK, resp)
+}
+
+func (api *API) handleListJWTKeys(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		tools.RespErr(w, tools.InvalidRequestErr("database id is required"))
+		return
+	}
+	keys, err := api.listJWTKeys(r.Context(), id)
+	if err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	tools.RespondJSON(w, http.StatusOK, keys)
+}
+
+func (api *API) handleCreateJWTKey(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		tools.RespErr(w, tools.InvalidRequestErr("database id is required"))
+		return
+	}
+	tools.LimitBody(w, r)
+	defer r.Body.Close()
+	var req CreateJWTKeyRequest
+	if err := tools.DecodeJSON(r.Body, &req); err != nil {
+		tools.RespErr(w, tools.ErrInvalidJSON)
+		return
+	}
+	key, err := api.createJWTKey(r.Context(), id, req)
+	if err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	tools.RespondJSON(w, http.StatusCreated, key)
+}
+
+func (api *API) handleDeleteJWTKey(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		tools.RespErr(w, tools.InvalidRequestErr("database id is required"))
+		return
+	}
+	if err := api.deleteJWTKey(r.Context(), id, r.PathValue("kid")); err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (api *API) handleListWebhooks(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		tools.RespErr(w, tools.InvalidRequestErr("database id is required"))
+		return
+	}
+	hooks, err := api.listWebhooks(r.Context(), id)
+	if err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	tools.RespondJSON(w, http.StatusOK, hooks)
+}
+
+func (api *API) handleCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		tools.RespErr(w, tools.InvalidRequestErr("database id is required"))
+		return
+	}
+	tools.LimitBody(w, r)
+	defer r.Body.Close()
+	var req CreateWebhookRequest
+	if err := tools.DecodeJSON(r.Body, &req); err != nil {
+		tools.RespErr(w, tools.ErrInvalidJSON)
+		return
+	}
+	hook, err := api.createWebhook(r.Context(), id, req)
+	if err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	tools.RespondJSON(w, http.StatusCreated, hook)
+}
+
+func (api *API) handleDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		tools.RespErr(w, tools.InvalidRequestErr("database id is required"))
+		return
+	}
+	if err := api.deleteWebhook(r.Context(), id, r.PathValue("webhookId")); err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (api *API) handleListWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		tools.RespErr(w, tools.InvalidRequestErr("database id is required"))
+		return
+	}
+	limit := 0
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			tools.RespErr(w, tools.InvalidRequestErr("limit must be a positive integer"))
+			return
+		}
+		limit = n
+	}
+	deliveries, err := api.listWebhookDeliveries(r.Context(), id, r.PathValue("webhookId"), r.URL.Query().Get("status"), limit)
+	if err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	tools.RespondJSON(w, http.StatusOK, deliveries)
+}
+
+func (api *API) handleListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := api.listAPIKeys(r.Context())
+	if err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	tools.RespondJSON(w, http.StatusOK, keys)
+}
+
+func (api *API) handleCreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	tools.LimitBody(w, r)
+	defer r.Body.Close()
+	var req CreateAPIKeyRequest
+	if err := tools.DecodeJSON(r.Body, &req); err != nil {
+		tools.RespErr(w, tools.ErrInvalidJSON)
+		return
+	}
+	key, err := api.createAPIKey(r.Context(), req)
+	if err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	tools.RespondJSON(w, http.StatusCreated, key)
+}
+
+func (api *API) handleDeleteAPIKey(w http.ResponseWriter, r *http.Request) {
+	if err := api.deleteAPIKey(r.Context(), r.PathValue("id")); err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (api *API) handleListServiceAccounts(w http.ResponseWriter, r *http.Request) {
+	accounts, err := api.listServiceAccounts(r.Context())
+	if err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	tools.RespondJSON(w, http.StatusOK, accounts)
+}
+
+func (api *API) handleCreateServiceAccount(w http.ResponseWriter, r *http.Request) {
+	tools.LimitBody(w, r)
+	defer r.Body.Close()
+	var req CreateServiceAccountRequest
+	if err := tools.DecodeJSON(r.Body, &req); err != nil {
+		tools.RespErr(w, tools.ErrInvalidJSON)
+		return
+	}
+	account, err := api.createServiceAccount(r.Context(), req)
+	if err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	tools.RespondJSON(w, http.StatusCreated, account)
+}
+
+func (api *API) handleDeleteServiceAccount(w http.ResponseWriter, r *http.Request) {
+	if err := api.deleteServiceAccount(r.Context(), r.PathValue("id")); err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (api *API) handleListOrgs(w http.ResponseWriter, r *http.Request) {
+	orgs, err := api.listOrgs(r.Context())
+	if err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	tools.RespondJSON(w, http.StatusOK, orgs)
+}
+
+func (api *API) handleCreateOrg(w http.ResponseWriter, r *http.Request) {
+	tools.LimitBody(w, r)
+	defer r.Body.Close()
+	var req CreateOrgRequest
+	if err := tools.DecodeJSON(r.Body, &req); err != nil {
+		tools.RespErr(w, tools.ErrInvalidJSON)
+		return
+	}
+	if code, msg, _ := tools.ValidateResourceName(req.ID); code != "" {
+		tools.RespErr(w, tools.InvalidRequestErr(msg))
+		return
+	}
+	org, err := api.createOrg(r.Context(), req)
+	if err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	tools.RespondJSON(w, http.StatusCreated, org)
+}
+
+func (api *API) handleGetOrg(w http.ResponseWriter, r *http.Request) {
+	org, err := api.getOrg(r.Context(), r.PathValue("id"))
+	if err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	tools.RespondJSON(w, http.StatusOK, org)
+}
+
+func (api *API) handleUpdateOrg(w http.ResponseWriter, r *http.Request) {
+	tools.LimitBody(w, r)
+	defer r.Body.Close()
+	var req UpdateOrgRequest
+	if err := tools.DecodeJSON(r.Body, &req); err != nil {
+		tools.RespErr(w, tools.ErrInvalidJSON)
+		return
+	}
+	org, err := api.updateOrg(r.Context(), r.PathValue("id"), req)
+	if err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	tools.RespondJSON(w, http.StatusOK, org)
+}
+
+func (api *API) handleDeleteOrg(w http.ResponseWriter, r *http.Request) {
+	if err := api.deleteOrg(r.Context(), r.PathValue("id")); err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (api *API) handleListOrgMembers(w http.ResponseWriter, r *http.Request) {
+	members, err := api.listOrgMembers(r.Context(), r.PathValue("id"))
+	if err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	tools.RespondJSON(w, http.StatusOK, members)
+}
+
+func (api *API) handleUpdateOrgMember(w http.ResponseWriter, r *http.Request) {
+	tools.LimitBody(w, r)
+	defer r.Body.Close()
+	var req UpdateMemberRequest
+	if err := tools.DecodeJSON(r.Body, &req); err != nil {
+		tools.RespErr(w, tools.ErrInvalidJSON)
+		return
+	}
+	member, err := api.updateOrgMember(r.Context(), r.PathValue("id"), r.PathValue("email"), req)
+	if err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	tools.RespondJSON(w, http.StatusOK, member)
+}
+
+func (api *API) handleRemoveOrgMember(w http.ResponseWriter, r *http.Request) {
+	if err := api.removeOrgMember(r.Context(), r.PathValue("id"), r.PathValue("email")); err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (api *API) handleListOrgInvitations(w http.ResponseWriter, r *http.Request) {
+	invitations, err := api.listOrgInvitations(r.Context(), r.PathValue("id"))
+	if err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	tools.RespondJSON(w, http.StatusOK, invitations)
+}
+
+func (api *API) handleCreateOrgInvitation(w http.ResponseWriter, r *http.Request) {
+	tools.LimitBody(w, r)
+	defer r.Body.Close()
+	var req CreateInvitationRequest
+	if err := tools.DecodeJSON(r.Body, &req); err != nil {
+		tools.RespErr(w, tools.ErrInvalidJSON)
+		return
+	}
+	invitation, err := api.createOrgInvitation(r.Context(), r.PathValue("id"), req)
+	if err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	tools.RespondJSON(w, http.StatusCreated, invitation)
+}
+
+func (api *API) handleDeleteOrgInvitation(w http.ResponseWriter, r *http.Request) {
+	if err := api.deleteOrgInvitation(r.Context(), r.PathValue("id"), r.PathValue("invitationId")); err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (api *API) handleAcceptOrgInvitation(w http.ResponseWriter, r *http.Request) {
+	tools.LimitBody(w, r)
+	defer r.Body.Close()
+	var req AcceptInvitationRequest
+	if err := tools.DecodeJSON(r.Body, &req); err != nil {
+		tools.RespErr(w, tools.ErrInvalidJSON)
+		return
+	}
+	accepted, err := api.acceptOrgInvitation(r.Context(), req.Token)
+	if err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	tools.RespondJSON(w, http.StatusCreated, accepted)
+}
+
+func (api *API) handleListAuditLog(w http.ResponseWriter, r *http.Request) {
+	limit := 0
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			tools.RespErr(w, tools.InvalidRequestErr("limit must be a positive integer"))
+			return
+		}
+		limit = n
+	}
+	entries, err := api.listAuditLog(r.Context(), r.URL.Query().Get("action"), limit)
+	if err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	tools.RespondJSON(w, http.StatusOK, entries)
+}
@@ -0,0 +1,166 @@
+package platform
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Rough throughput of a tenant database working through a migration, used
+// only to estimate its impact.
+const (
+	impactCopyRowsPerSec  = 50000    // Rows a table rebuild copies per second
+	impactCopyBytesPerSec = 20 << 20 // Bytes a table rebuild copies per second
+	impactIndexRowsPerSec = 100000   // Rows an index build sorts per second
+	impactStatementCost   = 2 * time.Millisecond
+	impactSampleRows      = 1000 // Rows sampled for the average row size
+	impactWorkers         = 8    // Databases read at once
+	impactTenantTimeout   = 10 * time.Second
+)
+
+// Migration statements whose cost grows with a table's rows.
+var (
+	impactCopyPattern   = regexp.MustCompile(`(?is)^INSERT\s+INTO\s.+?\bSELECT\b.+?\bFROM\s+(\[[^\]]+\]|"[^"]+"|\w+)`)
+	impactUpdatePattern = regexp.MustCompile(`(?is)^UPDATE\s+(\[[^\]]+\]|"[^"]+"|\w+)`)
+	impactIndexPattern  = regexp.MustCompile(`(?is)^CREATE\s+(?:UNIQUE\s+)?INDEX\s.+?\bON\s+(\[[^\]]+\]|"[^"]+"|\w+)`)
+)
+
+// migrationWork is what a migration does to the existing rows of its tables.
+type migrationWork struct {
+	rewrites   map[string]int // Table -> times its rows are copied or updated
+	indexes    map[string]int // Table -> indexes built over it
+	statements int
+}
+
+// analyzeMigration finds the statements of a migration that rewrite or
+// index existing rows: mirror table copies (INSERT ... SELECT FROM), UPDATEs
+// and CREATE INDEX.
+func analyzeMigration(statements []string) migrationWork {
+	work := migrationWork{rewrites: map[string]int{}, indexes: map[string]int{}, statements: len(statements)}
+	for _, stmt := range statements {
+		stmt = strings.TrimSpace(stmt)
+		if m := impactCopyPattern.FindStringSubmatch(stmt); m != nil {
+			work.rewrites[unquoteIdent(m[1])]++
+		} else if m := impactUpdatePattern.FindStringSubmatch(stmt); m != nil {
+			work.rewrites[unquoteIdent(m[1])]++
+		} else if m := impactIndexPattern.FindStringSubmatch(stmt); m != nil {
+			work.indexes[unquoteIdent(m[1])]++
+		}
+	}
+	return work
+}
+
+func unquoteIdent(name string) string {
+	if len(name) >= 2 && (name[0] == '[' || name[0] == '"') {
+		return name[1 : len(name)-1]
+	}
+	return name
+}
+
+// estimateMigrationImpact reads the row count and average row size of the
+// tables a migration touches in every database, and estimates how long each
+// database takes to migrate and how much extra storage rebuilt tables need
+// while their old and new copies both exist. A database that cannot be read
+// is reported with its error and left out of the totals.
+func (api *API) estimateMigrationImpact(ctx context.Context, schema Schema, databases []DatabaseRecord, statements []string) *MigrationImpact {
+	work := analyzeMigration(statements)
+	impact := &MigrationImpact{Databases: len(databases), Tenants: make([]TenantImpact, len(databases))}
+	for table := range work.rewrites {
+		impact.RebuiltTables = append(impact.RebuiltTables, table)
+	}
+	sort.Strings(impact.RebuiltTables)
+
+	tables := map[string]Table{}
+	for _, table := range schema.Tables {
+		if work.rewrites[table.Name] > 0 || work.indexes[table.Name] > 0 {
+			tables[table.Name] = table
+		}
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range min(impactWorkers, len(databases)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				impact.Tenants[i] = api.estimateTenantImpact(ctx, databases[i].ID, tables, work)
+			}
+		}()
+	}
+	for i := range databases {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	for _, tenant := range impact.Tenants {
+		if tenant.Error != "" {
+			continue
+		}
+		impact.Estimated++
+		impact.TotalRows += tenant.Rows
+		impact.TotalSeconds += tenant.Seconds
+		impact.MaxSeconds = max(impact.MaxSeconds, tenant.Seconds)
+		impact.TotalTempBytes += tenant.TempBytes
+		impact.MaxTempBytes = max(impact.MaxTempBytes, tenant.TempBytes)
+	}
+	return impact
+}
+
+func (api *API) estimateTenantImpact(ctx context.Context, databaseID string, tables map[string]Table, work migrationWork) TenantImpact {
+	tenant := TenantImpact{DatabaseID: databaseID, Seconds: (time.Duration(work.statements) * impactStatementCost).Seconds()}
+	if len(tables) == 0 {
+		return tenant
+	}
+	ctx, cancel := context.WithTimeout(ctx, impactTenantTimeout)
+	defer cancel()
+
+	token, err := api.getDatabaseToken(ctx, databaseID)
+	if err != nil {
+		tenant.Error = err.Error()
+		return tenant
+	}
+	db, err := tursoOpenFn(databaseID, token)
+	if err != nil {
+		tenant.Error = err.Error()
+		return tenant
+	}
+	defer db.Close()
+
+	for _, name := range sortedKeys(tables) {
+		table := tables[name]
+		var rows int64
+		if err := db.QueryRowContext(ctx, fmt.Sprintf("SELECT COUNT(*) FROM [%s]", name)).Scan(&rows); err != nil {
+			tenant.Error = fmt.Sprintf("counting %s: %v", name, err)
+			return tenant
+		}
+		var avg float64
+		if rows > 0 {
+			sizes := make([]string, 0, len(table.Columns))
+			for _, col := range sortedKeys(table.Columns) {
+				sizes = append(sizes, fmt.Sprintf("COALESCE(length(CAST([%s] AS BLOB)), 0)", col))
+			}
+			query := fmt.Sprintf("SELECT COALESCE(AVG(%s), 0) FROM (SELECT * FROM [%s] LIMIT %d)", strings.Join(sizes, " + "), name, impactSampleRows)
+			if err := db.QueryRowContext(ctx, query).Scan(&avg); err != nil {
+				tenant.Error = fmt.Sprintf("sampling %s: %v", name, err)
+				return tenant
+			}
+		}
+		bytes := int64(float64(rows) * avg)
+		if n := work.rewrites[name]; n > 0 {
+			tenant.Rows += rows * int64(n)
+			tenant.TempBytes += bytes * int64(n)
+			tenant.Seconds += float64(n) * (float64(rows)/impactCopyRowsPerSec + float64(bytes)/impactCopyBytesPerSec)
+		}
+		if n := work.indexes[name]; n > 0 {
+			tenant.Rows += rows * int64(n)
+			tenant.Seconds += float64(n) * float64(rows) / impactIndexRowsPerSec
+		}
+	}
+	return tenant
+}
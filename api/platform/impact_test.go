@@ -0,0 +1,104 @@
+package platform
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestAnalyzeMigration(t *testing.T) {
+	work := analyzeMigration([]string{
+		"CREATE TABLE [posts_new] ([id] INTEGER PRIMARY KEY, [title] TEXT NOT NULL)",
+		"INSERT INTO [posts_new] ([id], [title]) SELECT [id], [title] FROM [posts]",
+		"DROP TABLE [posts]",
+		"ALTER TABLE [posts_new] RENAME TO [posts]",
+		`UPDATE "tags" SET label = lower(label)`,
+		"CREATE UNIQUE INDEX [idx_posts_title] ON [posts] ([title])",
+		"ALTER TABLE [tags] ADD COLUMN [color] TEXT",
+	})
+	if work.statements != 7 {
+		t.Fatalf("expected 7 statements, got %d", work.statements)
+	}
+	if work.rewrites["posts"] != 1 || work.rewrites["tags"] != 1 || len(work.rewrites) != 2 {
+		t.Fatalf("unexpected rewrites: %#v", work.rewrites)
+	}
+	if work.indexes["posts"] != 1 || len(work.indexes) != 1 {
+		t.Fatalf("unexpected indexes: %#v", work.indexes)
+	}
+}
+
+func TestEstimateMigrationImpact(t *testing.T) {
+	api, db := setupPlatformAPI(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	oldOpen := tursoOpenFn
+	defer func() { tursoOpenFn = oldOpen }()
+	tursoOpenFn = func(name, token string) (*sql.DB, error) {
+		if name == "broken" {
+			return nil, errors.New("unreachable")
+		}
+		return sql.Open("sqlite3", filepath.Join(dir, name+".db"))
+	}
+
+	for i, rows := range []int{0, 200} {
+		name := []string{"empty", "full"}[i]
+		conn, _ := tursoOpenFn(name, "")
+		if _, err := conn.Exec(`CREATE TABLE posts (id INTEGER PRIMARY KEY, title TEXT)`); err != nil {
+			t.Fatal(err)
+		}
+		for id := range rows {
+			if _, err := conn.Exec(`INSERT INTO posts (id, title) VALUES (?, 'ten bytes!')`, id+1); err != nil {
+				t.Fatal(err)
+			}
+		}
+		conn.Close()
+	}
+	for _, name := range []string{"empty", "full", "broken"} {
+		if _, err := db.Exec(`
+			INSERT INTO atombase_databases (id, definition_id, definition_version, auth_token_encrypted, created_at, updated_at)
+			VALUES (?, 1, 1, ?, '2026-01-01T00:00:00Z', '2026-01-01T00:00:00Z')
+		`, name, []byte("token")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	schema := Schema{Tables: []Table{{Name: "posts", Pk: []string{"id"}, Columns: map[string]Col{
+		"id":    {Name: "id", Type: "INTEGER"},
+		"title": {Name: "title", Type: "TEXT"},
+	}}}}
+	databases := []DatabaseRecord{{ID: "empty"}, {ID: "full"}, {ID: "broken"}}
+	impact := api.estimateMigrationImpact(ctx, schema, databases, []string{
+		"CREATE TABLE [posts_new] ([id] INTEGER PRIMARY KEY, [title] TEXT NOT NULL)",
+		"INSERT INTO [posts_new] ([id], [title]) SELECT [id], [title] FROM [posts]",
+		"DROP TABLE [posts]",
+		"ALTER TABLE [posts_new] RENAME TO [posts]",
+	})
+
+	if impact.Databases != 3 || impact.Estimated != 2 {
+		t.Fatalf("expected 2 of 3 databases estimated, got %+v", impact)
+	}
+	if len(impact.RebuiltTables) != 1 || impact.RebuiltTables[0] != "posts" {
+		t.Fatalf("unexpected rebuilt tables: %v", impact.RebuiltTables)
+	}
+	empty, full, broken := impact.Tenants[0], impact.Tenants[1], impact.Tenants[2]
+	if empty.Rows != 0 || empty.TempBytes != 0 {
+		t.Fatalf("unexpected empty estimate: %+v", empty)
+	}
+	// Ids 1-200 measure 1 to 3 bytes as text, plus the 10-byte title.
+	if full.Rows != 200 || full.TempBytes < 200*11 || full.TempBytes > 200*13 {
+		t.Fatalf("unexpected full estimate: %+v", full)
+	}
+	if full.Seconds <= empty.Seconds {
+		t.Fatalf("expected the full database to take longer: %+v vs %+v", full, empty)
+	}
+	if broken.Error == "" {
+		t.Fatalf("expected an error for the unreachable database: %+v", broken)
+	}
+	if impact.TotalRows != 200 || impact.MaxTempBytes != full.TempBytes || impact.MaxSeconds != full.Seconds {
+		t.Fatalf("unexpected totals: %+v", impact)
+	}
+}
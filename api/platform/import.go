@@ -0,0 +1,448 @@
+package platform
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/atombasedev/atombase/config"
+	"github.com/atombasedev/atombase/tools"
+	"github.com/mattn/go-sqlite3"
+)
+
+const auditDatabaseImported = "database.imported"
+
+// Modes an import applies its rows in.
+const (
+	importMerge   = "merge"   // Rows are upserted by key; other rows are kept
+	importReplace = "replace" // The database's rows are deleted first
+)
+
+// sqliteHeader starts every SQLite database file.
+var sqliteHeader = []byte("SQLite format 3\x00")
+
+// importDriver opens uploaded databases with trusted_schema off, so the
+// functions their schema can call while being read are the innocuous ones.
+const importDriver = "sqlite3_import"
+
+func init() {
+	sql.Register(importDriver, &sqlite3.SQLiteDriver{ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+		conn.SetLimit(sqlite3.SQLITE_LIMIT_ATTACHED, 0)
+		_, err := conn.Exec("PRAGMA trusted_schema = OFF", nil)
+		return err
+	}})
+}
+
+// schemaObjectName matches the name a CREATE TRIGGER or CREATE VIEW
+// statement gives, as this package writes them.
+var schemaObjectName = regexp.MustCompile(`(?is)^\s*CREATE\s+(?:TEMP\s+|TEMPORARY\s+)?(TRIGGER|VIEW)\s+(?:IF\s+NOT\s+EXISTS\s+)?\[([^\]]+)\]`)
+
+// importPragmas are the pragmas a SQL dump may run, the ones the export
+// writes.
+var importPragmas = map[string]bool{"foreign_keys": true, "defer_foreign_keys": true, "user_version": true}
+
+// importDatabase loads a SQLite file or SQL dump into a database. The import
+// must match the schema of the definition version the database is on,
+// compared the way adoption finds drift; its rows then replace the
+// database's, or are merged into them, in one transaction. A dry run stops
+// after the check and reports what would be imported.
+func (api *API) importDatabase(ctx context.Context, id, format, mode string, dryRun bool, body io.Reader) (*ImportDatabaseResponse, error) {
+	if format == "" {
+		format = tools.TenantExportSQLite
+	}
+	if format != tools.TenantExportSQLite && format != tools.TenantExportSQL {
+		return nil, tools.InvalidRequestErr("format must be sqlite or sql")
+	}
+	if mode == "" {
+		mode = importMerge
+	}
+	if mode != importMerge && mode != importReplace {
+		return nil, tools.InvalidRequestErr("mode must be merge or replace")
+	}
+	db, err := api.getDatabase(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	token, err := api.getDatabaseToken(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp("", "atombase-database-import-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "import.db")
+	if err := receiveImport(ctx, body, format, path); err != nil {
+		return nil, err
+	}
+	resp, err := api.applyImport(ctx, db, token, path, mode, dryRun)
+	if err != nil || dryRun {
+		return resp, err
+	}
+	if err := api.recordAudit(ctx, auditDatabaseImported, id, map[string]any{"format": format, "mode": mode, "rows": resp.Rows}); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// applyImport checks the SQLite database at path against the schema of the
+// version db is on and, unless dryRun, copies its rows into db in mode.
+func (api *API) applyImport(ctx context.Context, db *DatabaseRecord, token, path, mode string, dryRun bool) (*ImportDatabaseResponse, error) {
+	schema, err := api.loadDefinitionSchema(ctx, db.DefinitionID, db.DefinitionVersion)
+	if err != nil {
+		return nil, err
+	}
+	for _, table := range schema.Tables {
+		if table.TimeSeries != nil {
+			return nil, tools.InvalidRequestErr(fmt.Sprintf("time-series table %s can't be imported", table.Name))
+		}
+	}
+	src, err := sql.Open(importDriver, "file:"+path+"?mode=ro&_query_only=true")
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	if err := vetImport(ctx, src, schema); err != nil {
+		return nil, err
+	}
+	actual, err := introspectSchema(ctx, src)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &ImportDatabaseResponse{Database: db.ID, Version: db.DefinitionVersion, Mode: mode, DryRun: dryRun, Tables: map[string]int64{}}
+	resp.Changes = diffSchemas(schema, alignIntrospectedSchema(actual, schema))
+	if resp.Changes == nil {
+		resp.Changes = []SchemaDiff{}
+	}
+	resp.Valid = len(resp.Changes) == 0
+	imported := map[string]bool{}
+	for _, table := range actual.Tables {
+		imported[table.Name] = true
+	}
+	for _, table := range schema.Tables {
+		if !imported[table.Name] {
+			continue
+		}
+		var n int64
+		if err := src.QueryRowContext(ctx, fmt.Sprintf("SELECT COUNT(*) FROM [%s]", table.Name)).Scan(&n); err != nil {
+			return nil, err
+		}
+		resp.Tables[table.Name] = n
+		resp.Rows += n
+	}
+	if dryRun {
+		return resp, nil
+	}
+	if !resp.Valid {
+		return nil, tools.InvalidRequestErr(fmt.Sprintf("import does not match version %d of definition %s: %s",
+			db.DefinitionVersion, db.DefinitionName, formatSchemaDiffs(resp.Changes)))
+	}
+
+	dst, err := tursoOpenFn(db.ID, token)
+	if err != nil {
+		return nil, err
+	}
+	defer dst.Close()
+	if err := importTenantRows(ctx, src, dst, schema, mode); err != nil {
+		return nil, fmt.Errorf("import into %s failed: %w", db.ID, err)
+	}
+	return resp, nil
+}
+
+// vetImport checks an uploaded database before any of it is read: it must
+// pass PRAGMA integrity_check, and hold only the triggers and views the
+// definition's schema makes, which the import never runs but a later copy of
+// the file might.
+func vetImport(ctx context.Context, src *sql.DB, schema Schema) error {
+	var check string
+	if err := src.QueryRowContext(ctx, `PRAGMA integrity_check`).Scan(&check); err != nil {
+		return tools.InvalidRequestErr(fmt.Sprintf("import is not a valid SQLite database: %v", err))
+	} else if check != "ok" {
+		return tools.InvalidRequestErr("import is not a valid SQLite database: " + check)
+	}
+
+	allowed := map[string]bool{}
+	for _, stmt := range generateSchemaSQL(schema) {
+		if m := schemaObjectName.FindStringSubmatch(stmt); m != nil {
+			allowed[strings.ToLower(m[1])+" "+m[2]] = true
+		}
+	}
+	rows, err := src.QueryContext(ctx, `SELECT type, name FROM sqlite_master WHERE type IN ('trigger', 'view')`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var kind, name string
+		if err := rows.Scan(&kind, &name); err != nil {
+			return err
+		}
+		if !allowed[kind+" "+name] {
+			return tools.InvalidRequestErr(fmt.Sprintf("import has %s %s, which the definition does not make", kind, name))
+		}
+	}
+	return rows.Err()
+}
+
+// receiveImport writes an uploaded import to path as a SQLite database,
+// running a SQL dump into a new one. Uploads are streamed to disk and bounded
+// by ATOMICBASE_IMPORT_MAX_SIZE.
+func receiveImport(ctx context.Context, body io.Reader, format, path string) error {
+	upload := bufio.NewReader(body)
+	if format == tools.TenantExportSQLite {
+		if header, _ := upload.Peek(len(sqliteHeader)); !bytes.Equal(header, sqliteHeader) {
+			return tools.InvalidRequestErr("import is not a SQLite database file")
+		}
+		return writeImport(upload, path)
+	}
+	dumpPath := path + ".sql"
+	if err := writeImport(upload, dumpPath); err != nil {
+		return err
+	}
+	defer os.Remove(dumpPath)
+	dump, err := os.Open(dumpPath)
+	if err != nil {
+		return err
+	}
+	defer dump.Close()
+	if err := restoreSQLDump(ctx, dump, path); err != nil {
+		return tools.InvalidRequestErr(fmt.Sprintf("SQL dump failed: %v", err))
+	}
+	return nil
+}
+
+// writeImport copies an upload to a new file at path, failing once it is
+// larger than ATOMICBASE_IMPORT_MAX_SIZE.
+func writeImport(upload io.Reader, path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(f, io.LimitReader(upload, config.Cfg.ImportMaxSize+1))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if n > config.Cfg.ImportMaxSize {
+		return tools.InvalidRequestErr(fmt.Sprintf("import is larger than %d bytes", config.Cfg.ImportMaxSize))
+	}
+	return nil
+}
+
+// restoreSQLDump runs a SQL dump into a new SQLite database at path, one
+// statement at a time. The dump comes from the caller, so its connection
+// can't attach other files, which also rules out VACUUM INTO, and runs only
+// the pragmas an export writes.
+func restoreSQLDump(ctx context.Context, dump io.Reader, path string) error {
+	db, err := sql.Open("sqlite3", "file:"+path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.Raw(func(driverConn any) error {
+		sc, ok := driverConn.(*sqlite3.SQLiteConn)
+		if !ok {
+			return fmt.Errorf("unexpected driver connection %T", driverConn)
+		}
+		sc.SetLimit(sqlite3.SQLITE_LIMIT_ATTACHED, 0)
+		sc.RegisterAuthorizer(importAuthorizer)
+		return nil
+	}); err != nil {
+		return err
+	}
+	statements := bufio.NewReader(dump)
+	for {
+		stmt, err := nextSQLStatement(statements)
+		if stmt != "" {
+			if _, execErr := conn.ExecContext(ctx, stmt); execErr != nil {
+				return execErr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// nextSQLStatement reads a dump up to the semicolon ending its next
+// statement, or to the end of the dump, which it reports with io.EOF.
+// Semicolons in quotes, identifiers and comments don't end a statement, and
+// neither do those in a CREATE TRIGGER body before its END.
+func nextSQLStatement(r *bufio.Reader) (string, error) {
+	var stmt, word strings.Builder
+	var words []string
+	trigger, caseDepth, triggerEnded := false, 0, false
+	endWord := func() {
+		if word.Len() == 0 {
+			return
+		}
+		w := strings.ToUpper(word.String())
+		word.Reset()
+		if len(words) < 3 {
+			words = append(words, w)
+			trigger = len(words) >= 2 && words[0] == "CREATE" &&
+				(words[1] == "TRIGGER" || (len(words) == 3 && (words[1] == "TEMP" || words[1] == "TEMPORARY") && words[2] == "TRIGGER"))
+		}
+		triggerEnded = false
+		switch {
+		case !trigger:
+		case w == "CASE":
+			caseDepth++
+		case w == "END" && caseDepth > 0:
+			caseDepth--
+		case w == "END":
+			triggerEnded = true
+		}
+	}
+	var closing byte // The byte ending the quote, identifier or comment being read
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			endWord()
+			return strings.TrimSpace(stmt.String()), err
+		}
+		stmt.WriteByte(c)
+		switch {
+		case closing == '\n' || closing == ']' || closing == '\'' || closing == '"' || closing == '`':
+			if c == closing {
+				closing = 0
+			}
+		case closing == '/':
+			if c == '*' {
+				if next, _ := r.Peek(1); len(next) == 1 && next[0] == '/' {
+					r.ReadByte()
+					stmt.WriteByte('/')
+					closing = 0
+				}
+			}
+		case c == '_' || (c >= '0' && c <= '9') || (c|0x20 >= 'a' && c|0x20 <= 'z'):
+			word.WriteByte(c)
+		default:
+			endWord()
+			switch c {
+			case '\'', '"', '`':
+				closing = c
+			case '[':
+				closing = ']'
+			case '-', '/':
+				if next, _ := r.Peek(1); len(next) == 1 && ((c == '-' && next[0] == '-') || (c == '/' && next[0] == '*')) {
+					r.ReadByte()
+					stmt.WriteByte(next[0])
+					closing = '\n'
+					if c == '/' {
+						closing = '/'
+					}
+				}
+			case ';':
+				if !trigger || triggerEnded {
+					return strings.TrimSpace(stmt.String()), nil
+				}
+			}
+		}
+	}
+}
+
+func importAuthorizer(action int, arg1, arg2, arg3 string) int {
+	switch action {
+	case sqlite3.SQLITE_ATTACH, sqlite3.SQLITE_DETACH:
+		return sqlite3.SQLITE_DENY
+	case sqlite3.SQLITE_PRAGMA:
+		if !importPragmas[strings.ToLower(arg1)] {
+			return sqlite3.SQLITE_DENY
+		}
+	case sqlite3.SQLITE_FUNCTION:
+		if strings.EqualFold(arg2, "load_extension") {
+			return sqlite3.SQLITE_DENY
+		}
+	}
+	return sqlite3.SQLITE_OK
+}
+
+// importTenantRows copies every table of schema from src into dst in one
+// transaction. Replacing deletes dst's rows of every table first; merging
+// updates rows whose key or unique columns are already taken. Foreign keys
+// are checked at commit so tables can be copied in any order.
+func importTenantRows(ctx context.Context, src, dst *sql.DB, schema Schema, mode string) error {
+	tx, err := dst.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `PRAGMA defer_foreign_keys = ON`); err != nil {
+		return err
+	}
+	if mode == importReplace {
+		for _, table := range schema.Tables {
+			if _, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM [%s]", table.Name)); err != nil {
+				return fmt.Errorf("%s: %w", table.Name, err)
+			}
+		}
+	}
+
+	for _, table := range schema.Tables {
+		columns := storedColumns(table)
+		quoted := make([]string, len(columns))
+		updates := make([]string, 0, len(columns))
+		for i, name := range columns {
+			quoted[i] = fmt.Sprintf("[%s]", name)
+			if !slices.Contains(table.Pk, name) {
+				updates = append(updates, fmt.Sprintf("[%s] = excluded.[%s]", name, name))
+			}
+		}
+		insert := fmt.Sprintf("INSERT INTO [%s] (%s) VALUES (%s)", table.Name, strings.Join(quoted, ", "), strings.TrimRight(strings.Repeat("?, ", len(columns)), ", "))
+		if mode == importMerge {
+			if len(updates) == 0 {
+				insert += " ON CONFLICT DO NOTHING"
+			} else {
+				insert += " ON CONFLICT DO UPDATE SET " + strings.Join(updates, ", ")
+			}
+		}
+
+		rows, err := src.QueryContext(ctx, fmt.Sprintf("SELECT %s FROM [%s]", strings.Join(quoted, ", "), table.Name))
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			values := make([]any, len(columns))
+			ptrs := make([]any, len(columns))
+			for i := range values {
+				ptrs[i] = &values[i]
+			}
+			if err := rows.Scan(ptrs...); err != nil {
+				rows.Close()
+				return err
+			}
+			if _, err := tx.ExecContext(ctx, insert, values...); err != nil {
+				rows.Close()
+				return fmt.Errorf("%s: %w", table.Name, err)
+			}
+		}
+		if err := rows.Close(); err != nil {
+			return err
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,216 @@
+package platform
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/atombasedev/atombase/config"
+)
+
+func TestImportDatabase(t *testing.T) {
+	api, db := setupPlatformAPI(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	openTenant := func(name string) *sql.DB {
+		conn, err := sql.Open("sqlite3", filepath.Join(dir, name+".db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return conn
+	}
+	oldOpen, oldCreate, oldToken, oldBatch := tursoOpenFn, createTenantDatabaseFn, createTenantTokenFn, batchExecuteWithTokenFn
+	defer func() {
+		tursoOpenFn, createTenantDatabaseFn, createTenantTokenFn, batchExecuteWithTokenFn = oldOpen, oldCreate, oldToken, oldBatch
+	}()
+	tursoOpenFn = func(name, token string) (*sql.DB, error) { return openTenant(name), nil }
+	createTenantDatabaseFn = func(ctx context.Context, name, group string) error { return nil }
+	createTenantTokenFn = func(ctx context.Context, name string) (string, error) { return "token", nil }
+	batchExecuteWithTokenFn = func(ctx context.Context, name, token string, statements []string) error {
+		conn := openTenant(name)
+		defer conn.Close()
+		for _, stmt := range statements {
+			if _, err := conn.Exec(stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if _, err := api.createDefinition(ctx, CreateDefinitionRequest{
+		Name: "notes",
+		Type: "global",
+		Schema: Schema{Tables: []Table{{Name: "notes", Pk: []string{"id"}, Columns: map[string]Col{
+			"id":   {Name: "id", Type: "INTEGER"},
+			"body": {Name: "body", Type: "TEXT"},
+		}}}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := api.createDatabase(ctx, CreateDatabaseRequest{ID: "notes-1", Definition: "notes"}); err != nil {
+		t.Fatal(err)
+	}
+	tenant := openTenant("notes-1")
+	defer tenant.Close()
+	if _, err := tenant.Exec(`INSERT INTO notes (id, body) VALUES (1, 'old'), (3, 'kept')`); err != nil {
+		t.Fatal(err)
+	}
+	var createNotes string
+	if err := tenant.QueryRow(`SELECT sql FROM sqlite_master WHERE name = 'notes'`).Scan(&createNotes); err != nil {
+		t.Fatal(err)
+	}
+
+	// An import file made from the tenant's own schema.
+	sqliteFile := func(createSQL, rows string) []byte {
+		path := filepath.Join(t.TempDir(), "import.db")
+		conn, err := sql.Open("sqlite3", path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := conn.Exec(createSQL + ";" + rows); err != nil {
+			t.Fatal(err)
+		}
+		conn.Close()
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	bodies := func() map[int]string {
+		got := map[int]string{}
+		rows, err := tenant.Query(`SELECT id, body FROM notes`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var id int
+			var body string
+			rows.Scan(&id, &body)
+			got[id] = body
+		}
+		return got
+	}
+	file := sqliteFile(createNotes, `INSERT INTO notes (id, body) VALUES (1, 'new'), (2, 'added')`)
+
+	resp, err := api.importDatabase(ctx, "notes-1", "sqlite", "merge", true, bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Valid || resp.Rows != 2 || resp.Tables["notes"] != 2 || len(bodies()) != 2 {
+		t.Fatalf("expected a valid dry run that changes nothing, got %+v", resp)
+	}
+
+	if _, err := api.importDatabase(ctx, "notes-1", "sqlite", "merge", false, bytes.NewReader(file)); err != nil {
+		t.Fatal(err)
+	}
+	if got := bodies(); len(got) != 3 || got[1] != "new" || got[2] != "added" || got[3] != "kept" {
+		t.Fatalf("expected the rows merged, got %v", got)
+	}
+
+	dump := "PRAGMA foreign_keys=OFF;\nBEGIN TRANSACTION;\n" + createNotes + ";\nINSERT INTO [notes] ([body], [id]) VALUES ('only', 9);\nCOMMIT;\n"
+	if _, err := api.importDatabase(ctx, "notes-1", "sql", "replace", false, strings.NewReader(dump)); err != nil {
+		t.Fatal(err)
+	}
+	if got := bodies(); len(got) != 1 || got[9] != "only" {
+		t.Fatalf("expected the rows replaced, got %v", got)
+	}
+
+	// An import that doesn't match the definition is reported, not applied.
+	other := sqliteFile(`CREATE TABLE notes (id INTEGER PRIMARY KEY, body TEXT, extra TEXT)`, `INSERT INTO notes (id) VALUES (5)`)
+	resp, err = api.importDatabase(ctx, "notes-1", "sqlite", "replace", true, bytes.NewReader(other))
+	if err != nil || resp.Valid || len(resp.Changes) == 0 {
+		t.Fatalf("expected the extra column reported, got %+v, %v", resp, err)
+	}
+	if _, err := api.importDatabase(ctx, "notes-1", "sqlite", "replace", false, bytes.NewReader(other)); err == nil {
+		t.Fatal("expected a mismatched import to be refused")
+	}
+	if got := bodies(); len(got) != 1 {
+		t.Fatalf("expected the refused import to change nothing, got %v", got)
+	}
+
+	// Triggers and views the definition doesn't make are refused, from a file
+	// or a dump.
+	trigger := sqliteFile(createNotes, `CREATE TRIGGER notes_spy AFTER INSERT ON notes BEGIN SELECT 1; END`)
+	if _, err := api.importDatabase(ctx, "notes-1", "sqlite", "merge", true, bytes.NewReader(trigger)); err == nil || !strings.Contains(err.Error(), "trigger notes_spy") {
+		t.Errorf("expected an unknown trigger to be refused, got %v", err)
+	}
+	if _, err := api.importDatabase(ctx, "notes-1", "sql", "merge", true, strings.NewReader(createNotes+";\nCREATE VIEW peek AS SELECT * FROM notes;\n")); err == nil || !strings.Contains(err.Error(), "view peek") {
+		t.Errorf("expected an unknown view to be refused, got %v", err)
+	}
+	// A file whose pages don't add up fails the integrity check.
+	corrupt := bytes.Clone(file)
+	for i := 4096; i < len(corrupt) && i < 8192; i++ {
+		corrupt[i] = 0xff
+	}
+	if _, err := api.importDatabase(ctx, "notes-1", "sqlite", "merge", true, bytes.NewReader(corrupt)); err == nil {
+		t.Error("expected a corrupt file to be refused")
+	}
+	vetted, err := sql.Open(importDriver, "file::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vetted.Close()
+	var trusted int
+	if err := vetted.QueryRow(`PRAGMA trusted_schema`).Scan(&trusted); err != nil || trusted != 0 {
+		t.Errorf("expected imports read with trusted_schema off, got %d, %v", trusted, err)
+	}
+
+	// A dump can't reach files beyond its own database.
+	outside := filepath.Join(t.TempDir(), "outside.db")
+	for _, stmt := range []string{"ATTACH DATABASE '" + outside + "' AS x", "VACUUM INTO '" + outside + "'", "PRAGMA writable_schema = ON"} {
+		if _, err := api.importDatabase(ctx, "notes-1", "sql", "merge", true, strings.NewReader(createNotes+";\n"+stmt+";\n")); err == nil {
+			t.Errorf("expected %q to be refused", stmt)
+		}
+	}
+	if _, err := os.Stat(outside); !os.IsNotExist(err) {
+		t.Errorf("expected no file written outside the import, got %v", err)
+	}
+	if _, err := api.importDatabase(ctx, "notes-1", "sqlite", "merge", true, strings.NewReader("not a database")); err == nil {
+		t.Error("expected a file that isn't SQLite to be refused")
+	}
+	oldMax := config.Cfg.ImportMaxSize
+	defer func() { config.Cfg.ImportMaxSize = oldMax }()
+	config.Cfg.ImportMaxSize = int64(len(file) - 1)
+	if _, err := api.importDatabase(ctx, "notes-1", "sqlite", "merge", true, bytes.NewReader(file)); err == nil || !strings.Contains(err.Error(), "larger than") {
+		t.Errorf("expected an import over the size limit to be refused, got %v", err)
+	}
+}
+
+func TestNextSQLStatement(t *testing.T) {
+	dump := `CREATE TABLE [a;b] (id INTEGER PRIMARY KEY, note TEXT DEFAULT 'x;y');
+-- a comment; with a semicolon
+INSERT INTO "a;b" VALUES (1, 'it''s; fine');
+CREATE TRIGGER t AFTER INSERT ON [a;b] BEGIN
+  UPDATE [a;b] SET note = CASE WHEN NEW.id > 0 THEN 'pos' ELSE 'neg' END WHERE id = NEW.id;
+  /* end; */ SELECT 1;
+END;
+CREATE TEMP TRIGGER t2 AFTER DELETE ON [a;b] BEGIN SELECT 2; END;
+COMMIT`
+	r := bufio.NewReader(strings.NewReader(dump))
+	var got []string
+	for {
+		stmt, err := nextSQLStatement(r)
+		if stmt != "" {
+			got = append(got, stmt)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(got) != 5 || !strings.HasPrefix(got[1], "-- a comment") || !strings.HasSuffix(got[2], "END;") || !strings.HasPrefix(got[3], "CREATE TEMP TRIGGER") || got[4] != "COMMIT" {
+		t.Fatalf("unexpected statements: %q", got)
+	}
+}
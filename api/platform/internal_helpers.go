@@ -1,15 +1,9 @@
 package platform
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
-	"strings"
 
-	"github.com/atombasedev/atombase/config"
 	"github.com/atombasedev/atombase/tools"
 )
 
@@ -23,6 +17,24 @@ func generateSchemaSQL(schema Schema) []string {
 		if len(table.FTSColumns) > 0 {
 			statements = append(statements, generateFTSSQL(table.Name, table.FTSColumns, table.Pk)...)
 		}
+		if len(table.GeoColumns) > 0 {
+			statements = append(statements, generateGeoIndexSQL(table.Name, table.GeoColumns, table.Pk)...)
+		}
+		if table.Sync {
+			statements = append(statements, generateSyncSQL(table)...)
+		}
+		if table.TimeSeries != nil {
+			statements = append(statements, partitionCatalogSQL, seriesViewSQL(table.Name))
+			for _, rollup := range table.TimeSeries.Rollups {
+				statements = append(statements, generateRollupSQL(table, rollup)...)
+			}
+		}
+	}
+	for _, view := range schema.Views {
+		statements = append(statements, generateCreateViewSQL(view))
+	}
+	if pointInTime(schema) {
+		statements = append(statements, generateChangelogSQL(schema)...)
 	}
 	return statements
 }
@@ -41,54 +53,21 @@ func decodeStoredDatabaseToken(storedToken []byte) (string, error) {
 	return string(decrypted), nil
 }
 
+// Tenant database lifecycle calls, swapped out by tests.
 var (
-	tursoCreateDatabaseFn = tursocreateDatabase
-	tursoDeleteDatabaseFn = tursodeleteDatabase
-	tursoCreateTokenFn    = tursoCreateToken
-)
-
-func tursocreateDatabase(ctx context.Context, name string) error {
-	url := fmt.Sprintf("https://api.turso.tech/v1/organizations/%s/databases", config.Cfg.TursoOrganization)
-	body, _ := json.Marshal(map[string]any{"name": name})
-	return doTursoJSON(ctx, http.MethodPost, url, body, nil)
-}
-
-func tursodeleteDatabase(ctx context.Context, name string) error {
-	url := fmt.Sprintf("https://api.turso.tech/v1/organizations/%s/databases/%s", config.Cfg.TursoOrganization, name)
-	return doTursoJSON(ctx, http.MethodDelete, url, nil, nil)
-}
-
-func tursoCreateToken(ctx context.Context, name string) (string, error) {
-	url := fmt.Sprintf("https://api.turso.tech/v1/organizations/%s/databases/%s/auth/tokens", config.Cfg.TursoOrganization, name)
-	var resp struct {
-		JWT string `json:"jwt"`
+	createTenantDatabaseFn = func(ctx context.Context, name, group string) error {
+		return tools.Tenants().CreateDatabase(ctx, name, group)
 	}
-	if err := doTursoJSON(ctx, http.MethodPost, url, []byte(`{"authorization":"full-access"}`), &resp); err != nil {
-		return "", err
+	deleteTenantDatabaseFn = func(ctx context.Context, name string) error {
+		return tools.Tenants().DeleteDatabase(ctx, name)
 	}
-	return resp.JWT, nil
-}
-
-func doTursoJSON(ctx context.Context, method, url string, body []byte, out any) error {
-	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
-	if err != nil {
-		return err
-	}
-	req.Header.Set("Authorization", "Bearer "+config.Cfg.TursoAPIKey)
-	if body != nil {
-		req.Header.Set("Content-Type", "application/json")
-	}
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode >= 300 {
-		data, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("turso api returned %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	createTenantTokenFn = func(ctx context.Context, name string) (string, error) {
+		return tools.Tenants().CreateToken(ctx, name)
 	}
-	if out == nil {
+	revokeTenantTokensFn = func(ctx context.Context, name string) error {
+		if revoker, ok := tools.Tenants().(tools.TenantTokenRevoker); ok {
+			return revoker.RevokeTokens(ctx, name)
+		}
 		return nil
 	}
-	return json.NewDecoder(resp.Body).Decode(out)
-}
+)
@@ -0,0 +1,423 @@
+package platform
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/atombasedev/atombase/tools"
+	_ "github.com/tursodatabase/libsql-client-go/libsql"
+)
+
+var (
+	tursoIntrospectSchemaFn = tursoIntrospectSchema
+	tursoOpenFn             = tursoOpen
+)
+
+// tursoOpen opens a SQL connection to a Turso database using a per-database token.
+func tursoOpen(dbName, token string) (*sql.DB, error) {
+	return tools.OpenTenantDB(dbName, token)
+}
+
+func tursoIntrospectSchema(ctx context.Context, dbName, token string) (Schema, error) {
+	db, err := tursoOpenFn(dbName, token)
+	if err != nil {
+		return Schema{}, err
+	}
+	defer db.Close()
+	return introspectSchema(ctx, db)
+}
+
+// introspectSchema reads the user tables and views of a SQLite database back into a Schema.
+// Internal atombase tables, sqlite tables, FTS5 and R*Tree shadow tables and
+// time-series partitions are skipped. A time-series table is known by its
+// series view, which is not listed; its settings are left to alignIntrospectedSchema.
+// CHECK, COLLATE and generated expressions are not exposed by the table pragmas,
+// so callers comparing against a definition should use alignIntrospectedSchema.
+func introspectSchema(ctx context.Context, db *sql.DB) (Schema, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT name, COALESCE(sql, '')
+		FROM sqlite_master
+		WHERE type = 'table' AND name NOT LIKE 'sqlite_%'
+		ORDER BY name
+	`)
+	if err != nil {
+		return Schema{}, err
+	}
+	var names []string
+	ftsTables := make(map[string]bool)
+	geoTables := make(map[string]bool)
+	for rows.Next() {
+		var name, createSQL string
+		if err := rows.Scan(&name, &createSQL); err != nil {
+			rows.Close()
+			return Schema{}, err
+		}
+		if strings.HasPrefix(name, "atombase_") {
+			continue
+		}
+		if strings.Contains(strings.ToLower(createSQL), "using fts5") {
+			ftsTables[name] = true
+			continue
+		}
+		if strings.Contains(strings.ToLower(createSQL), "using rtree") {
+			geoTables[name] = true
+			continue
+		}
+		names = append(names, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return Schema{}, err
+	}
+
+	derived, err := introspectTimeSeriesTables(ctx, db)
+	if err != nil {
+		return Schema{}, err
+	}
+
+	schema := Schema{Tables: []Table{}}
+	for _, name := range names {
+		if isFTSShadowTable(name, ftsTables) || isFTSShadowTable(name, geoTables) || derived[name] {
+			continue
+		}
+		table, err := introspectTable(ctx, db, name)
+		if err != nil {
+			return Schema{}, fmt.Errorf("failed to introspect table %s: %w", name, err)
+		}
+		if ftsTables[name+"_fts"] {
+			table.FTSColumns, err = introspectColumnNames(ctx, db, name+"_fts")
+			if err != nil {
+				return Schema{}, err
+			}
+		}
+		if geoTables[name+"_geo"] {
+			table.GeoColumns, err = introspectGeoColumns(ctx, db, name)
+			if err != nil {
+				return Schema{}, err
+			}
+		}
+		if err := db.QueryRowContext(ctx,
+			`SELECT EXISTS (SELECT 1 FROM sqlite_master WHERE type = 'trigger' AND name = ?)`, name+"_sync_ai").Scan(&table.Sync); err != nil {
+			return Schema{}, err
+		}
+		schema.Tables = append(schema.Tables, table)
+	}
+	views, err := introspectViews(ctx, db)
+	if err != nil {
+		return Schema{}, err
+	}
+	for _, view := range views {
+		if i := slices.IndexFunc(schema.Tables, func(t Table) bool { return t.Name+"_series" == view.Name }); i >= 0 {
+			schema.Tables[i].TimeSeries = &TimeSeries{}
+			continue
+		}
+		schema.Views = append(schema.Views, view)
+	}
+	return schema, nil
+}
+
+// introspectTimeSeriesTables returns the tables holding time-series
+// partitions and rollups, as their catalogs list them.
+func introspectTimeSeriesTables(ctx context.Context, db *sql.DB) (map[string]bool, error) {
+	tables := map[string]bool{}
+	for _, catalog := range []string{"atombase_partitions", "atombase_rollups"} {
+		var listed bool
+		if err := db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = ?)`, catalog).Scan(&listed); err != nil {
+			return nil, err
+		}
+		if !listed {
+			continue
+		}
+		rows, err := db.QueryContext(ctx, fmt.Sprintf("SELECT name FROM %s", catalog))
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			tables[name] = true
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return tables, nil
+}
+
+func isFTSShadowTable(name string, ftsTables map[string]bool) bool {
+	for fts := range ftsTables {
+		if strings.HasPrefix(name, fts+"_") {
+			return true
+		}
+	}
+	return false
+}
+
+// geoTriggerColumns matches the NEW.<column> references of a geo insert
+// trigger; SQLite rewrites renamed columns with double quotes.
+var geoTriggerColumns = regexp.MustCompile(`NEW\.(?:\[([^\]]+)\]|"((?:[^"]|"")+)")`)
+
+// introspectGeoColumns reads a table's latitude and longitude columns back
+// from the insert trigger of its R*Tree index, which selects the primary key,
+// latitude twice and longitude twice.
+func introspectGeoColumns(ctx context.Context, db *sql.DB, table string) ([]string, error) {
+	var triggerSQL string
+	err := db.QueryRowContext(ctx,
+		`SELECT sql FROM sqlite_master WHERE type = 'trigger' AND name = ?`, table+"_geo_ai").Scan(&triggerSQL)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var cols []string
+	for _, m := range geoTriggerColumns.FindAllStringSubmatch(triggerSQL, -1) {
+		if m[1] != "" {
+			cols = append(cols, m[1])
+		} else {
+			cols = append(cols, strings.ReplaceAll(m[2], `""`, `"`))
+		}
+	}
+	if len(cols) < 5 {
+		return nil, nil
+	}
+	return []string{cols[1], cols[3]}, nil
+}
+
+func introspectTable(ctx context.Context, db *sql.DB, name string) (Table, error) {
+	table := Table{Name: name, Columns: map[string]Col{}}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT name, type, "notnull", dflt_value, pk, hidden
+		FROM pragma_table_xinfo(?)
+		ORDER BY cid
+	`, name)
+	if err != nil {
+		return table, err
+	}
+	pkOrder := map[int]string{}
+	for rows.Next() {
+		var colName, colType string
+		var notNull, pk, hidden int
+		var dflt sql.NullString
+		if err := rows.Scan(&colName, &colType, &notNull, &dflt, &pk, &hidden); err != nil {
+			rows.Close()
+			return table, err
+		}
+		colType = strings.TrimSpace(strings.TrimSuffix(strings.ToUpper(colType), "GENERATED ALWAYS"))
+		col := Col{Name: colName, Type: colType, NotNull: notNull == 1}
+		if dflt.Valid {
+			col.Default = parseIntrospectedDefault(dflt.String)
+		}
+		// hidden is 2 for VIRTUAL and 3 for STORED generated columns.
+		if hidden == 2 || hidden == 3 {
+			col.Generated = &Generated{Stored: hidden == 3}
+		}
+		if pk > 0 {
+			pkOrder[pk] = colName
+		}
+		table.Columns[colName] = col
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return table, err
+	}
+	for i := 1; i <= len(pkOrder); i++ {
+		table.Pk = append(table.Pk, pkOrder[i])
+	}
+
+	fkRows, err := db.QueryContext(ctx, `
+		SELECT "from", "table", COALESCE("to", ''), on_update, on_delete
+		FROM pragma_foreign_key_list(?)
+	`, name)
+	if err != nil {
+		return table, err
+	}
+	for fkRows.Next() {
+		var from, refTable, refCol, onUpdate, onDelete string
+		if err := fkRows.Scan(&from, &refTable, &refCol, &onUpdate, &onDelete); err != nil {
+			fkRows.Close()
+			return table, err
+		}
+		col, ok := table.Columns[from]
+		if !ok {
+			continue
+		}
+		col.References = refTable + "." + refCol
+		col.OnUpdate = normalizeFKAction(onUpdate)
+		col.OnDelete = normalizeFKAction(onDelete)
+		table.Columns[from] = col
+	}
+	fkRows.Close()
+	if err := fkRows.Err(); err != nil {
+		return table, err
+	}
+
+	idxRows, err := db.QueryContext(ctx, `
+		SELECT name, "unique", origin
+		FROM pragma_index_list(?)
+		ORDER BY name
+	`, name)
+	if err != nil {
+		return table, err
+	}
+	type indexInfo struct {
+		name   string
+		unique bool
+		origin string
+	}
+	var indexes []indexInfo
+	for idxRows.Next() {
+		var info indexInfo
+		var unique int
+		if err := idxRows.Scan(&info.name, &unique, &info.origin); err != nil {
+			idxRows.Close()
+			return table, err
+		}
+		info.unique = unique == 1
+		indexes = append(indexes, info)
+	}
+	idxRows.Close()
+	if err := idxRows.Err(); err != nil {
+		return table, err
+	}
+
+	for _, info := range indexes {
+		cols, err := introspectIndexColumns(ctx, db, info.name)
+		if err != nil {
+			return table, err
+		}
+		switch info.origin {
+		case "c":
+			table.Indexes = append(table.Indexes, Index{Name: info.name, Columns: cols, Unique: info.unique})
+		case "u":
+			if len(cols) == 1 {
+				if col, ok := table.Columns[cols[0]]; ok {
+					col.Unique = true
+					table.Columns[cols[0]] = col
+				}
+			}
+		}
+	}
+	return table, nil
+}
+
+func introspectColumnNames(ctx context.Context, db *sql.DB, table string) ([]string, error) {
+	rows, err := db.QueryContext(ctx, `SELECT name FROM pragma_table_info(?) ORDER BY cid`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+func introspectIndexColumns(ctx context.Context, db *sql.DB, index string) ([]string, error) {
+	rows, err := db.QueryContext(ctx, `SELECT COALESCE(name, '') FROM pragma_index_info(?) ORDER BY seqno`, index)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+// parseIntrospectedDefault converts a pragma dflt_value back into the value a
+// schema would declare. Anything that is not a plain literal stays raw SQL.
+func parseIntrospectedDefault(raw string) any {
+	raw = strings.TrimSpace(raw)
+	if len(raw) >= 2 && raw[0] == '\'' && raw[len(raw)-1] == '\'' {
+		return strings.ReplaceAll(raw[1:len(raw)-1], "''", "'")
+	}
+	if strings.EqualFold(raw, "NULL") {
+		return nil
+	}
+	if n, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return n
+	}
+	if f, err := strconv.ParseFloat(raw, 64); err == nil {
+		return f
+	}
+	return map[string]any{"sql": raw}
+}
+
+func normalizeFKAction(action string) string {
+	action = strings.ToUpper(strings.TrimSpace(action))
+	if action == "NO ACTION" {
+		return ""
+	}
+	return action
+}
+
+// alignIntrospectedSchema fills in details of an introspected schema that SQLite
+// does not report faithfully, using reference wherever the two are compatible.
+// Columns declared without a type, CHECK/COLLATE/generated clauses and defaults
+// that render to the same SQL are taken from reference; real differences remain.
+func alignIntrospectedSchema(actual, reference Schema) Schema {
+	refTables := make(map[string]Table, len(reference.Tables))
+	for _, table := range reference.Tables {
+		refTables[table.Name] = table
+	}
+
+	aligned := Schema{Tables: make([]Table, 0, len(actual.Tables)), Views: actual.Views}
+	for _, table := range actual.Tables {
+		ref, ok := refTables[table.Name]
+		if !ok {
+			aligned.Tables = append(aligned.Tables, table)
+			continue
+		}
+		cols := make(map[string]Col, len(table.Columns))
+		for name, col := range table.Columns {
+			refCol, ok := ref.Columns[name]
+			if !ok {
+				cols[name] = col
+				continue
+			}
+			if col.Type == "" || strings.EqualFold(col.Type, refCol.Type) {
+				col.Type = refCol.Type
+			}
+			if len(table.Pk) == 1 && table.Pk[0] == name {
+				col.NotNull = refCol.NotNull
+			}
+			if col.Default != nil && refCol.Default != nil && formatDefault(col.Default) == formatDefault(refCol.Default) {
+				col.Default = refCol.Default
+			}
+			col.Check = refCol.Check
+			col.Collate = refCol.Collate
+			if col.Generated != nil && refCol.Generated != nil && col.Generated.Stored == refCol.Generated.Stored {
+				col.Generated = refCol.Generated
+			}
+			cols[name] = col
+		}
+		table.Columns = cols
+		if table.TimeSeries != nil && ref.TimeSeries != nil {
+			table.TimeSeries = ref.TimeSeries
+		}
+		aligned.Tables = append(aligned.Tables, table)
+	}
+	return aligned
+}
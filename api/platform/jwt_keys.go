@@ -0,0 +1,143 @@
+package platform
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/atombasedev/atombase/definitions"
+	"github.com/atombasedev/atombase/tools"
+)
+
+// Audit actions recorded for JWT signing keys.
+const (
+	auditJWTKeyCreated = "jwt_key.created"
+	auditJWTKeyDeleted = "jwt_key.deleted"
+)
+
+// createJWTKey registers a signing key for a database. User definition
+// databases are reached through sessions and row tenants, so they take no keys.
+func (api *API) createJWTKey(ctx context.Context, databaseID string, req CreateJWTKeyRequest) (*JWTKey, error) {
+	db, err := api.getDatabase(ctx, databaseID)
+	if err != nil {
+		return nil, err
+	}
+	if db.DefinitionType == string(definitions.DefinitionTypeUser) {
+		return nil, tools.InvalidRequestErr("JWT keys are only available for global and organization databases")
+	}
+
+	key := &JWTKey{DatabaseID: databaseID, Algorithm: req.Algorithm, CreatedAt: time.Now().UTC()}
+	var material []byte
+	switch req.Algorithm {
+	case tools.JWTAlgHS256:
+		if req.PublicKey != "" {
+			return nil, tools.InvalidRequestErr("HS256 keys take a secret, not a public key")
+		}
+		material = []byte(req.Secret)
+		if req.Secret == "" {
+			raw := make([]byte, tools.MinJWTSecretLength)
+			if _, err := rand.Read(raw); err != nil {
+				return nil, err
+			}
+			key.Secret = base64.RawURLEncoding.EncodeToString(raw)
+			material = []byte(key.Secret)
+		}
+	case tools.JWTAlgRS256:
+		if req.Secret != "" {
+			return nil, tools.InvalidRequestErr("RS256 keys take a public key, not a secret")
+		}
+		key.PublicKey = req.PublicKey
+		material = []byte(req.PublicKey)
+	}
+	if err := tools.ValidateJWTKey(req.Algorithm, material); err != nil {
+		return nil, tools.InvalidRequestErr(err.Error())
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	key.ID = "jwk_" + hex.EncodeToString(id)
+
+	stored := material
+	if tools.EncryptionEnabled() {
+		if stored, err = tools.Encrypt(material); err != nil {
+			return nil, fmt.Errorf("failed to encrypt signing key: %w", err)
+		}
+	}
+	conn, err := api.dbConn()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.ExecContext(ctx, `
+		INSERT INTO atombase_jwt_keys (id, database_id, algorithm, key_encrypted, created_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, key.ID, databaseID, key.Algorithm, stored, key.CreatedAt.Format(time.RFC3339)); err != nil {
+		return nil, err
+	}
+	if err := api.recordAudit(ctx, auditJWTKeyCreated, "database:"+databaseID, map[string]string{"id": key.ID, "algorithm": key.Algorithm}); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// listJWTKeys returns a database's keys, oldest first. Secrets are never
+// returned; RS256 public keys are.
+func (api *API) listJWTKeys(ctx context.Context, databaseID string) ([]JWTKey, error) {
+	if _, err := api.getDatabase(ctx, databaseID); err != nil {
+		return nil, err
+	}
+	conn, err := api.dbConn()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := conn.QueryContext(ctx, `
+		SELECT id, algorithm, key_encrypted, created_at FROM atombase_jwt_keys
+		WHERE database_id = ? ORDER BY created_at ASC, id ASC
+	`, databaseID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []JWTKey{}
+	for rows.Next() {
+		key := JWTKey{DatabaseID: databaseID}
+		var stored []byte
+		var createdAt string
+		if err := rows.Scan(&key.ID, &key.Algorithm, &stored, &createdAt); err != nil {
+			return nil, err
+		}
+		key.CreatedAt = mustParseTime(createdAt)
+		if key.Algorithm == tools.JWTAlgRS256 {
+			material := stored
+			if tools.EncryptionEnabled() {
+				if material, err = tools.Decrypt(stored); err != nil {
+					return nil, fmt.Errorf("failed to decrypt signing key: %w", err)
+				}
+			}
+			key.PublicKey = string(material)
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// deleteJWTKey removes a key. Tokens it signed stop working immediately.
+func (api *API) deleteJWTKey(ctx context.Context, databaseID, keyID string) error {
+	conn, err := api.dbConn()
+	if err != nil {
+		return err
+	}
+	result, err := conn.ExecContext(ctx, `DELETE FROM atombase_jwt_keys WHERE id = ? AND database_id = ?`, keyID, databaseID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return tools.ErrJWTKeyNotFound
+	}
+	return api.recordAudit(ctx, auditJWTKeyDeleted, "database:"+databaseID, map[string]string{"id": keyID})
+}
@@ -0,0 +1,77 @@
+package platform
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/atombasedev/atombase/tools"
+)
+
+func TestJWTKeys(t *testing.T) {
+	api, db := setupPlatformAPI(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	if _, err := db.Exec(`
+		INSERT INTO atombase_definitions (id, name, definition_type, current_version, created_at, updated_at) VALUES
+			(1, 'market', 'global', 1, '2026-01-01T00:00:00Z', '2026-01-01T00:00:00Z'),
+			(2, 'notes', 'user', 1, '2026-01-01T00:00:00Z', '2026-01-01T00:00:00Z');
+		INSERT INTO atombase_databases (id, definition_id, definition_version, created_at, updated_at) VALUES
+			('market-db', 1, 1, '2026-01-01T00:00:00Z', '2026-01-01T00:00:00Z'),
+			('notes-db', 2, 1, '2026-01-01T00:00:00Z', '2026-01-01T00:00:00Z');
+	`); err != nil {
+		t.Fatal(err)
+	}
+
+	generated, err := api.createJWTKey(ctx, "market-db", CreateJWTKeyRequest{Algorithm: tools.JWTAlgHS256})
+	if err != nil {
+		t.Fatalf("createJWTKey failed: %v", err)
+	}
+	if !strings.HasPrefix(generated.ID, "jwk_") || len(generated.Secret) < tools.MinJWTSecretLength {
+		t.Fatalf("unexpected generated key %+v", generated)
+	}
+	provided, err := api.createJWTKey(ctx, "market-db", CreateJWTKeyRequest{Algorithm: tools.JWTAlgHS256, Secret: strings.Repeat("p", tools.MinJWTSecretLength)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if provided.Secret != "" {
+		t.Error("a provided secret should not be echoed back")
+	}
+
+	for name, req := range map[string]CreateJWTKeyRequest{
+		"short secret":   {Algorithm: tools.JWTAlgHS256, Secret: "short"},
+		"bad public key": {Algorithm: tools.JWTAlgRS256, PublicKey: "nope"},
+		"rs256 secret":   {Algorithm: tools.JWTAlgRS256, Secret: strings.Repeat("p", tools.MinJWTSecretLength)},
+		"unknown alg":    {Algorithm: "none"},
+	} {
+		if _, err := api.createJWTKey(ctx, "market-db", req); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if _, err := api.createJWTKey(ctx, "notes-db", CreateJWTKeyRequest{Algorithm: tools.JWTAlgHS256}); err == nil {
+		t.Error("expected user definition databases to be refused")
+	}
+	if _, err := api.createJWTKey(ctx, "missing-db", CreateJWTKeyRequest{Algorithm: tools.JWTAlgHS256}); !errors.Is(err, ErrDatabaseNotFound) {
+		t.Errorf("expected database not found, got %v", err)
+	}
+
+	keys, err := api.listJWTKeys(ctx, "market-db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || keys[0].Secret != "" || keys[1].Secret != "" {
+		t.Fatalf("listed keys = %+v", keys)
+	}
+
+	if err := api.deleteJWTKey(ctx, "notes-db", generated.ID); !errors.Is(err, tools.ErrJWTKeyNotFound) {
+		t.Errorf("deleting through another database: %v", err)
+	}
+	if err := api.deleteJWTKey(ctx, "market-db", generated.ID); err != nil {
+		t.Fatal(err)
+	}
+	if keys, _ := api.listJWTKeys(ctx, "market-db"); len(keys) != 1 || keys[0].ID != provided.ID {
+		t.Fatalf("keys after delete = %+v", keys)
+	}
+}
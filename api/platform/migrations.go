@@ -5,6 +5,8 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"reflect"
+	"slices"
 	"sort"
 	"strings"
 	"time"
@@ -12,9 +14,17 @@ import (
 
 // GenerateMigrationPlan creates a migration plan from schema diff and merges.
 // Merges convert drop+add pairs into renames by index in the changes array.
+// A column rename carries over to the objects that depend on the column;
+// newSchema must name the column's new name in them too.
 func GenerateMigrationPlan(oldSchema, newSchema Schema, changes []SchemaDiff, merges []Merge) (*MigrationPlan, error) {
 	// Apply merges to convert drop+add pairs to renames
 	renames := applyMerges(changes, merges)
+	if stale := staleRenameReferences(newSchema, renames); len(stale) > 0 {
+		return nil, fmt.Errorf("still referencing renamed columns: %s", strings.Join(stale, "; "))
+	}
+	// Compare against the old schema as the renames leave it, so changes
+	// that only follow a rename are not planned a second time.
+	oldSchema, rebuildFTS := applyColumnRenames(oldSchema, renames)
 
 	// Build sets of renamed items to skip in add/drop processing
 	renamedTables := make(map[string]string)
@@ -35,6 +45,8 @@ func GenerateMigrationPlan(oldSchema, newSchema Schema, changes []SchemaDiff, me
 		if r.Type == "rename_table" {
 			statements = append(statements, fmt.Sprintf(
 				"ALTER TABLE [%s] RENAME TO [%s]", r.OldName, r.NewName))
+			statements = append(statements, renameSyncSQL(oldSchema, newSchema, r)...)
+			statements = append(statements, renameTimeSeriesSQL(oldSchema, r)...)
 		} else if r.Type == "rename_column" {
 			statements = append(statements, fmt.Sprintf(
 				"ALTER TABLE [%s] RENAME COLUMN [%s] TO [%s]", r.Table, r.OldName, r.NewName))
@@ -45,7 +57,11 @@ func GenerateMigrationPlan(oldSchema, newSchema Schema, changes []SchemaDiff, me
 	var addColumns, dropColumns, modifyColumns []SchemaDiff
 	var addIndexes, dropIndexes []SchemaDiff
 	var addFTS, dropFTS []SchemaDiff
+	var addGeo, dropGeo []SchemaDiff
+	var addSync, dropSync []SchemaDiff
 	var pkTypeChanges []SchemaDiff
+	var addTimeSeries []SchemaDiff
+	viewsChanged := false
 
 	mergedIndices := getMergedIndices(merges)
 
@@ -81,8 +97,21 @@ func GenerateMigrationPlan(oldSchema, newSchema Schema, changes []SchemaDiff, me
 			addFTS = append(addFTS, c)
 		case "drop_fts":
 			dropFTS = append(dropFTS, c)
+		case "add_geo":
+			addGeo = append(addGeo, c)
+		case "drop_geo":
+			dropGeo = append(dropGeo, c)
+		case "add_sync":
+			addSync = append(addSync, c)
+		case "drop_sync":
+			dropSync = append(dropSync, c)
 		case "change_pk_type":
 			pkTypeChanges = append(pkTypeChanges, c)
+		case "add_time_series":
+			addTimeSeries = append(addTimeSeries, c)
+		case "add_view", "drop_view", "drop_time_series", "modify_time_series":
+			// Series views are made again with the schema's views.
+			viewsChanged = true
 		}
 	}
 
@@ -95,6 +124,39 @@ func GenerateMigrationPlan(oldSchema, newSchema Schema, changes []SchemaDiff, me
 		newTables[t.Name] = t
 	}
 
+	// Expressions SQLite rewrote on rename now match the new schema.
+	modifyColumns = slices.DeleteFunc(modifyColumns, func(c SchemaDiff) bool {
+		oldCol, ok := oldTables[c.Table].Columns[c.Column]
+		return ok && !columnModified(oldCol, newTables[c.Table].Columns[c.Column])
+	})
+	// SQLite rewrote the geo triggers along with a renamed column.
+	unchangedGeo := func(c SchemaDiff) bool {
+		return slices.Equal(oldTables[c.Table].GeoColumns, newTables[c.Table].GeoColumns)
+	}
+	addGeo = slices.DeleteFunc(addGeo, unchangedGeo)
+	dropGeo = slices.DeleteFunc(dropGeo, unchangedGeo)
+	// An FTS5 table keeps the column names it was created with, so one
+	// indexing a renamed column is dropped and created again.
+	for table := range rebuildFTS {
+		addFTS = slices.DeleteFunc(addFTS, func(c SchemaDiff) bool { return c.Table == table })
+		dropFTS = slices.DeleteFunc(dropFTS, func(c SchemaDiff) bool { return c.Table == table })
+	}
+	for _, table := range sortedKeys(rebuildFTS) {
+		statements = append(statements, generateDropFTSSQL(table)...)
+		if newTable := newTables[table]; len(newTable.FTSColumns) > 0 {
+			statements = append(statements, generateFTSSQL(table, newTable.FTSColumns, newTable.Pk)...)
+			statements = append(statements, fmt.Sprintf("INSERT INTO [%s_fts]([%s_fts]) VALUES ('rebuild')", table, table))
+		}
+	}
+
+	// Geo triggers go before the columns they read can be dropped.
+	for _, c := range dropGeo {
+		statements = append(statements, generateDropGeoIndexSQL(c.Table)...)
+	}
+	for _, c := range dropSync {
+		statements = append(statements, generateDropSyncSQL(c.Table)...)
+	}
+
 	for _, c := range addTables {
 		if table, ok := newTables[c.Table]; ok {
 			sql := generateCreateTableSQL(table)
@@ -105,6 +167,15 @@ func GenerateMigrationPlan(oldSchema, newSchema Schema, changes []SchemaDiff, me
 			if len(table.FTSColumns) > 0 {
 				statements = append(statements, generateFTSSQL(c.Table, table.FTSColumns, table.Pk)...)
 			}
+			if len(table.GeoColumns) > 0 {
+				statements = append(statements, generateGeoIndexSQL(c.Table, table.GeoColumns, table.Pk)...)
+			}
+			if table.Sync {
+				statements = append(statements, generateSyncSQL(table)...)
+			}
+			if table.TimeSeries != nil {
+				statements = append(statements, partitionCatalogSQL)
+			}
 		}
 	}
 
@@ -163,6 +234,23 @@ func GenerateMigrationPlan(oldSchema, newSchema Schema, changes []SchemaDiff, me
 		statements = append(statements, ftsSQL...)
 	}
 
+	for _, c := range addGeo {
+		if table := newTables[c.Table]; len(table.GeoColumns) > 0 {
+			statements = append(statements, generateGeoIndexSQL(c.Table, table.GeoColumns, table.Pk)...)
+		}
+	}
+
+	for _, c := range addSync {
+		if table := newTables[c.Table]; table.Sync {
+			statements = append(statements, generateSyncSQL(table)...)
+		}
+	}
+
+	if len(addTimeSeries) > 0 {
+		statements = append(statements, partitionCatalogSQL)
+	}
+	statements = append(statements, rollupMigrationSQL(oldTables, newTables, renamedTables)...)
+
 	for _, c := range dropIndexes {
 		statements = append(statements, fmt.Sprintf("DROP INDEX IF EXISTS [%s]", c.Column))
 	}
@@ -174,8 +262,23 @@ func GenerateMigrationPlan(oldSchema, newSchema Schema, changes []SchemaDiff, me
 
 	for _, c := range dropTables {
 		statements = append(statements, fmt.Sprintf("DROP TABLE IF EXISTS [%s]", c.Table))
+		if len(oldTables[c.Table].GeoColumns) > 0 {
+			statements = append(statements, fmt.Sprintf("DROP TABLE IF EXISTS [%s_geo]", c.Table))
+		}
+		if oldTables[c.Table].Sync {
+			statements = append(statements, fmt.Sprintf("DELETE FROM atombase_changes WHERE tbl = '%s'", strings.ReplaceAll(c.Table, "'", "''")))
+		}
 	}
 
+	if len(statements) > 0 || viewsChanged {
+		statements = viewMigrationSQL(oldSchema, newSchema, statements)
+	}
+	if len(statements) > 0 {
+		statements = syncMigrationSQL(oldSchema, newSchema, statements)
+	}
+	if len(statements) > 0 || pointInTime(oldSchema) != pointInTime(newSchema) {
+		statements = changelogMigrationSQL(oldSchema, newSchema, statements)
+	}
 	return &MigrationPlan{SQL: statements}, nil
 }
 
@@ -437,6 +540,15 @@ func generateMirrorTableSQL(oldTable, newTable Table) []string {
 	if len(newTable.FTSColumns) > 0 {
 		statements = append(statements, generateFTSSQL(newTable.Name, newTable.FTSColumns, newTable.Pk)...)
 	}
+	// The index outlives the dropped table but its triggers do not.
+	if len(newTable.GeoColumns) > 0 {
+		statements = append(statements, generateDropGeoIndexSQL(newTable.Name)...)
+		statements = append(statements, generateGeoIndexSQL(newTable.Name, newTable.GeoColumns, newTable.Pk)...)
+	}
+	// The log outlives the dropped table; the backfill leaves its entries be.
+	if newTable.Sync {
+		statements = append(statements, generateSyncSQL(newTable)...)
+	}
 	return statements
 }
 
@@ -501,6 +613,326 @@ func generateDropFTSSQL(table string) []string {
 	}
 }
 
+// generateGeoIndexSQL creates the R*Tree index of a table's latitude and
+// longitude columns, with triggers keeping it in step and a backfill of the
+// rows already there. Rows missing either coordinate are left out.
+func generateGeoIndexSQL(table string, geoColumns []string, pk []string) []string {
+	geoTable := table + "_geo"
+	lat, lng := geoColumns[0], geoColumns[1]
+	row := func(prefix string) string {
+		return fmt.Sprintf("SELECT %s[%s], %s[%s], %s[%s], %s[%s], %s[%s] WHERE %s[%s] IS NOT NULL AND %s[%s] IS NOT NULL",
+			prefix, pk[0], prefix, lat, prefix, lat, prefix, lng, prefix, lng, prefix, lat, prefix, lng)
+	}
+
+	createGeo := fmt.Sprintf(
+		"CREATE VIRTUAL TABLE IF NOT EXISTS [%s] USING rtree(id, min_lat, max_lat, min_lng, max_lng)", geoTable)
+
+	insertTrigger := fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS [%s_ai] AFTER INSERT ON [%s] BEGIN
+  INSERT OR REPLACE INTO [%s] (id, min_lat, max_lat, min_lng, max_lng) %s;
+END`,
+		geoTable, table, geoTable, row("NEW."))
+
+	deleteTrigger := fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS [%s_ad] AFTER DELETE ON [%s] BEGIN
+  DELETE FROM [%s] WHERE id = OLD.[%s];
+END`,
+		geoTable, table, geoTable, pk[0])
+
+	updateTrigger := fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS [%s_au] AFTER UPDATE ON [%s] BEGIN
+  DELETE FROM [%s] WHERE id = OLD.[%s];
+  INSERT OR REPLACE INTO [%s] (id, min_lat, max_lat, min_lng, max_lng) %s;
+END`,
+		geoTable, table, geoTable, pk[0], geoTable, row("NEW."))
+
+	backfill := fmt.Sprintf("INSERT OR REPLACE INTO [%s] (id, min_lat, max_lat, min_lng, max_lng) SELECT [%s], [%s], [%s], [%s], [%s] FROM [%s] WHERE [%s] IS NOT NULL AND [%s] IS NOT NULL",
+		geoTable, pk[0], lat, lat, lng, lng, table, lat, lng)
+
+	return []string{createGeo, insertTrigger, deleteTrigger, updateTrigger, backfill}
+}
+
+func generateDropGeoIndexSQL(table string) []string {
+	geoTable := table + "_geo"
+	return []string{
+		fmt.Sprintf("DROP TRIGGER IF EXISTS [%s_ai]", geoTable),
+		fmt.Sprintf("DROP TRIGGER IF EXISTS [%s_ad]", geoTable),
+		fmt.Sprintf("DROP TRIGGER IF EXISTS [%s_au]", geoTable),
+		fmt.Sprintf("DROP TABLE IF EXISTS [%s]", geoTable),
+	}
+}
+
+// syncLogSQL creates the change log shared by a database's sync tables. It
+// keeps the latest change of each row, so a row's entry moves to the end of
+// the log each time it changes, and a delete leaves a tombstone. old is the
+// row as it was before an update or delete, as JSON, so a pull can leave out
+// changes to rows the caller could not see. AUTOINCREMENT keeps seq from being
+// reused after the newest entry is replaced.
+const syncLogSQL = `CREATE TABLE IF NOT EXISTS atombase_changes (
+  seq INTEGER PRIMARY KEY AUTOINCREMENT,
+  tbl TEXT NOT NULL,
+  pk NOT NULL,
+  op TEXT NOT NULL,
+  old TEXT,
+  UNIQUE (tbl, pk)
+)`
+
+// generateSyncSQL creates the change log and a sync table's triggers, with a
+// backfill so a client's first sync sees the rows already there.
+func generateSyncSQL(table Table) []string {
+	name := strings.ReplaceAll(table.Name, "'", "''")
+	backfill := fmt.Sprintf("INSERT OR IGNORE INTO atombase_changes (tbl, pk, op) SELECT '%s', [%s], 'upsert' FROM [%s]", name, table.Pk[0], table.Name)
+	return append(append([]string{syncLogSQL}, syncTriggersSQL(table)...), backfill)
+}
+
+// syncTriggersSQL creates the triggers logging a sync table's changes. A
+// changed primary key leaves a tombstone for the old one. The old row's image
+// names every column, so migrations drop the triggers before changing tables
+// and make them again after.
+func syncTriggersSQL(table Table) []string {
+	name := strings.ReplaceAll(table.Name, "'", "''")
+	logRow := func(key, op, old string) string {
+		return fmt.Sprintf(`DELETE FROM atombase_changes WHERE tbl = '%s' AND pk = %s;
+  INSERT INTO atombase_changes (tbl, pk, op, old) VALUES ('%s', %s, '%s', %s);`, name, key, name, key, op, old)
+	}
+	oldKey, newKey := "OLD.["+table.Pk[0]+"]", "NEW.["+table.Pk[0]+"]"
+	oldRow := syncRowJSON(table)
+
+	insertTrigger := fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS [%s_sync_ai] AFTER INSERT ON [%s] BEGIN
+  %s
+END`, table.Name, table.Name, logRow(newKey, "upsert", "NULL"))
+
+	updateTrigger := fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS [%s_sync_au] AFTER UPDATE ON [%s] BEGIN
+  DELETE FROM atombase_changes WHERE tbl = '%s' AND pk = %s AND %s IS NOT %s;
+  INSERT INTO atombase_changes (tbl, pk, op, old) SELECT '%s', %s, 'delete', %s WHERE %s IS NOT %s;
+  %s
+END`, table.Name, table.Name, name, oldKey, oldKey, newKey, name, oldKey, oldRow, oldKey, newKey, logRow(newKey, "upsert", oldRow))
+
+	deleteTrigger := fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS [%s_sync_ad] AFTER DELETE ON [%s] BEGIN
+  %s
+END`, table.Name, table.Name, logRow(oldKey, "delete", oldRow))
+
+	return []string{insertTrigger, updateTrigger, deleteTrigger}
+}
+
+// syncRowJSON is the OLD row as a JSON object. JSON can't hold BLOBs, and
+// policies don't compare them, so they are left null.
+func syncRowJSON(table Table) string {
+	columns := make([]string, 0, len(table.Columns))
+	for name := range table.Columns {
+		columns = append(columns, name)
+	}
+	sort.Strings(columns)
+	args := make([]string, len(columns))
+	for i, col := range columns {
+		args[i] = fmt.Sprintf("'%s', CASE WHEN typeof(OLD.[%s]) = 'blob' THEN NULL ELSE OLD.[%s] END", strings.ReplaceAll(col, "'", "''"), col, col)
+	}
+	return "json_object(" + strings.Join(args, ", ") + ")"
+}
+
+// syncMigrationSQL wraps the table SQL of a migration so the triggers of
+// every sync table are made again from the new schema.
+func syncMigrationSQL(oldSchema, newSchema Schema, tableSQL []string) []string {
+	var statements []string
+	for _, table := range oldSchema.Tables {
+		if table.Sync {
+			statements = append(statements, dropSyncTriggersSQL(table.Name)...)
+		}
+	}
+	statements = append(statements, tableSQL...)
+	for _, table := range newSchema.Tables {
+		if table.Sync {
+			statements = append(statements, dropSyncTriggersSQL(table.Name)...)
+			statements = append(statements, syncTriggersSQL(table)...)
+		}
+	}
+	return statements
+}
+
+// renameSyncSQL moves a renamed table's part of the change log to its new
+// name. The triggers follow the table but log its old name, so they are made
+// again.
+func renameSyncSQL(oldSchema, newSchema Schema, r rename) []string {
+	var old, new Table
+	for _, t := range oldSchema.Tables {
+		if t.Name == r.OldName {
+			old = t
+		}
+	}
+	for _, t := range newSchema.Tables {
+		if t.Name == r.NewName {
+			new = t
+		}
+	}
+	if !old.Sync {
+		if new.Sync {
+			return generateSyncSQL(new)
+		}
+		return nil
+	}
+	if !new.Sync {
+		return generateDropSyncSQL(r.OldName)
+	}
+	statements := dropSyncTriggersSQL(r.OldName)
+	statements = append(statements, fmt.Sprintf("UPDATE atombase_changes SET tbl = '%s' WHERE tbl = '%s'",
+		strings.ReplaceAll(r.NewName, "'", "''"), strings.ReplaceAll(r.OldName, "'", "''")))
+	return append(statements, generateSyncSQL(new)...)
+}
+
+// partitionCatalogSQL creates the list of a database's time-series
+// partitions, which the Data API adds to as months end. Partitions belong to
+// the database rather than the definition, so migrations leave them be; the
+// Data API moves a partition's rows back when its table stops being a time
+// series and drops it when the table is dropped.
+const partitionCatalogSQL = `CREATE TABLE IF NOT EXISTS atombase_partitions (
+  tbl TEXT NOT NULL,
+  month TEXT NOT NULL,
+  name TEXT NOT NULL UNIQUE,
+  rows INTEGER NOT NULL DEFAULT 0,
+  PRIMARY KEY (tbl, month)
+)`
+
+// seriesViewSQL creates the view a time-series table is read through, over
+// the table alone. The Data API adds the table's partitions to it.
+func seriesViewSQL(table string) string {
+	return fmt.Sprintf("CREATE VIEW IF NOT EXISTS [%s_series] AS SELECT * FROM [%s]", table, table)
+}
+
+// renameTimeSeriesSQL keeps a renamed table's partitions listed under it.
+// Their tables keep the old name; its rollups are renamed with it.
+func renameTimeSeriesSQL(oldSchema Schema, r rename) []string {
+	for _, t := range oldSchema.Tables {
+		if t.Name == r.OldName && t.TimeSeries != nil {
+			statements := []string{fmt.Sprintf("UPDATE atombase_partitions SET tbl = '%s' WHERE tbl = '%s'",
+				strings.ReplaceAll(r.NewName, "'", "''"), strings.ReplaceAll(r.OldName, "'", "''"))}
+			for _, rollup := range t.TimeSeries.Rollups {
+				oldName, newName := rollupTableName(r.OldName, rollup.Resolution), rollupTableName(r.NewName, rollup.Resolution)
+				statements = append(statements,
+					fmt.Sprintf("ALTER TABLE [%s] RENAME TO [%s]", oldName, newName),
+					fmt.Sprintf("UPDATE atombase_rollups SET name = '%s', tbl = '%s' WHERE name = '%s'",
+						strings.ReplaceAll(newName, "'", "''"), strings.ReplaceAll(r.NewName, "'", "''"), strings.ReplaceAll(oldName, "'", "''")))
+			}
+			return statements
+		}
+	}
+	return nil
+}
+
+// rollupCatalogSQL creates the list of a database's rollups, with the start
+// of the first interval the Data API has yet to aggregate into each.
+const rollupCatalogSQL = `CREATE TABLE IF NOT EXISTS atombase_rollups (
+  name TEXT PRIMARY KEY,
+  tbl TEXT NOT NULL,
+  resolution TEXT NOT NULL,
+  through INTEGER
+)`
+
+func rollupTableName(table, resolution string) string {
+	return table + "_rollup_" + resolution
+}
+
+// generateRollupSQL creates a rollup's table: the start of each interval
+// under the time column's name, its groupBy columns and its aggregates.
+func generateRollupSQL(table Table, rollup Rollup) []string {
+	name := rollupTableName(table.Name, rollup.Resolution)
+	timeCol := table.TimeSeries.Column
+	cols := []string{fmt.Sprintf("[%s] %s NOT NULL", timeCol, table.Columns[timeCol].Type)}
+	pk := []string{"[" + timeCol + "]"}
+	for _, column := range rollup.GroupBy {
+		cols = append(cols, fmt.Sprintf("[%s] %s", column, table.Columns[column].Type))
+		pk = append(pk, "["+column+"]")
+	}
+	for _, agg := range sortedKeys(rollup.Aggregates) {
+		cols = append(cols, fmt.Sprintf("[%s] %s", agg, aggregateType(table, rollup.Aggregates[agg])))
+	}
+	return []string{
+		rollupCatalogSQL,
+		fmt.Sprintf("CREATE TABLE IF NOT EXISTS [%s] (%s, PRIMARY KEY (%s))", name, strings.Join(cols, ", "), strings.Join(pk, ", ")),
+		fmt.Sprintf("INSERT OR IGNORE INTO atombase_rollups (name, tbl, resolution) VALUES ('%s', '%s', '%s')",
+			strings.ReplaceAll(name, "'", "''"), strings.ReplaceAll(table.Name, "'", "''"), rollup.Resolution),
+	}
+}
+
+// aggregateType is the column type an aggregate's values are stored as.
+func aggregateType(table Table, agg Aggregate) string {
+	switch agg.Fn {
+	case "count":
+		return "INTEGER"
+	case "avg":
+		return "REAL"
+	}
+	return table.Columns[agg.Column].Type
+}
+
+func dropRollupSQL(table, resolution string) []string {
+	name := strings.ReplaceAll(rollupTableName(table, resolution), "'", "''")
+	return []string{
+		fmt.Sprintf("DROP TABLE IF EXISTS [%s]", rollupTableName(table, resolution)),
+		fmt.Sprintf("DELETE FROM atombase_rollups WHERE name = '%s'", name),
+	}
+}
+
+// rollupMigrationSQL drops the rollups a migration removes or changes and
+// creates the ones it adds or changes. A changed rollup starts over, and the
+// Data API aggregates it again from the rows the table still has.
+func rollupMigrationSQL(oldTables, newTables map[string]Table, renamedTables map[string]string) []string {
+	rollups := func(t Table) map[string]Rollup {
+		byResolution := map[string]Rollup{}
+		if t.TimeSeries != nil {
+			for _, rollup := range t.TimeSeries.Rollups {
+				byResolution[rollup.Resolution] = rollup
+			}
+		}
+		return byResolution
+	}
+	previous := make(map[string]string, len(renamedTables))
+	for oldName, newName := range renamedTables {
+		previous[newName] = oldName
+	}
+
+	var statements []string
+	for _, name := range sortedKeys(oldTables) {
+		if _, kept := newTables[name]; kept {
+			continue
+		}
+		if _, renamed := renamedTables[name]; renamed {
+			continue
+		}
+		for _, resolution := range sortedKeys(rollups(oldTables[name])) {
+			statements = append(statements, dropRollupSQL(name, resolution)...)
+		}
+	}
+	for _, name := range sortedKeys(newTables) {
+		oldName := name
+		if renamed, ok := previous[name]; ok {
+			oldName = renamed
+		}
+		before, after := rollups(oldTables[oldName]), rollups(newTables[name])
+		for _, resolution := range sortedKeys(before) {
+			if rollup, ok := after[resolution]; !ok || !reflect.DeepEqual(rollup, before[resolution]) {
+				statements = append(statements, dropRollupSQL(name, resolution)...)
+			}
+		}
+		for _, resolution := range sortedKeys(after) {
+			if rollup, ok := before[resolution]; !ok || !reflect.DeepEqual(rollup, after[resolution]) {
+				statements = append(statements, generateRollupSQL(newTables[name], after[resolution])...)
+			}
+		}
+	}
+	return statements
+}
+
+// generateDropSyncSQL drops a table's sync triggers and its part of the log.
+func generateDropSyncSQL(table string) []string {
+	return append(dropSyncTriggersSQL(table),
+		fmt.Sprintf("DELETE FROM atombase_changes WHERE tbl = '%s'", strings.ReplaceAll(table, "'", "''")))
+}
+
+func dropSyncTriggersSQL(table string) []string {
+	return []string{
+		fmt.Sprintf("DROP TRIGGER IF EXISTS [%s_sync_ai]", table),
+		fmt.Sprintf("DROP TRIGGER IF EXISTS [%s_sync_au]", table),
+		fmt.Sprintf("DROP TRIGGER IF EXISTS [%s_sync_ad]", table),
+	}
+}
+
 func prefixColumns(cols []string, prefix string) string {
 	result := make([]string, len(cols))
 	for i, c := range cols {
@@ -648,11 +1080,15 @@ func diffSchemas(old, new Schema) []SchemaDiff {
 		changes = append(changes, diffColumns(name, oldTable, newTable)...)
 		changes = append(changes, diffIndexes(name, oldTable, newTable)...)
 		changes = append(changes, diffFTS(name, oldTable, newTable)...)
+		changes = append(changes, diffGeo(name, oldTable, newTable)...)
+		changes = append(changes, diffSync(name, oldTable, newTable)...)
+		changes = append(changes, diffTimeSeries(name, oldTable, newTable)...)
 
 		if pkTypeChanged(oldTable, newTable) {
 			changes = append(changes, SchemaDiff{Type: "change_pk_type", Table: name})
 		}
 	}
+	changes = append(changes, diffViews(old, new)...)
 
 	return changes
 }
@@ -721,6 +1157,42 @@ func diffFTS(tableName string, old, new Table) []SchemaDiff {
 	return changes
 }
 
+func diffGeo(tableName string, old, new Table) []SchemaDiff {
+	if slices.Equal(old.GeoColumns, new.GeoColumns) {
+		return nil
+	}
+	var changes []SchemaDiff
+	if len(old.GeoColumns) > 0 {
+		changes = append(changes, SchemaDiff{Type: "drop_geo", Table: tableName})
+	}
+	if len(new.GeoColumns) > 0 {
+		changes = append(changes, SchemaDiff{Type: "add_geo", Table: tableName})
+	}
+	return changes
+}
+
+func diffSync(tableName string, old, new Table) []SchemaDiff {
+	switch {
+	case new.Sync && !old.Sync:
+		return []SchemaDiff{{Type: "add_sync", Table: tableName}}
+	case old.Sync && !new.Sync:
+		return []SchemaDiff{{Type: "drop_sync", Table: tableName}}
+	}
+	return nil
+}
+
+func diffTimeSeries(tableName string, old, new Table) []SchemaDiff {
+	switch {
+	case new.TimeSeries != nil && old.TimeSeries == nil:
+		return []SchemaDiff{{Type: "add_time_series", Table: tableName}}
+	case old.TimeSeries != nil && new.TimeSeries == nil:
+		return []SchemaDiff{{Type: "drop_time_series", Table: tableName}}
+	case old.TimeSeries != nil && !reflect.DeepEqual(old.TimeSeries, new.TimeSeries):
+		return []SchemaDiff{{Type: "modify_time_series", Table: tableName}}
+	}
+	return nil
+}
+
 func pkTypeChanged(old, new Table) bool {
 	if len(old.Pk) != len(new.Pk) {
 		return true
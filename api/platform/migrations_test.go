@@ -152,6 +152,114 @@ func TestGenerateMigrationPlan_RenameAndFTSOrder(t *testing.T) {
 	}
 }
 
+func TestGenerateMigrationPlan_RenamePropagatesToDependents(t *testing.T) {
+	posts := func(titleCol string, fts []string, expr, index string) Table {
+		return Table{
+			Name: "posts",
+			Pk:   []string{"id"},
+			Columns: map[string]Col{
+				"id":     {Name: "id", Type: "INTEGER"},
+				titleCol: {Name: titleCol, Type: "TEXT", Check: "length(" + titleCol + ") > 0"},
+				"slug":   {Name: "slug", Type: "TEXT", Generated: &Generated{Expr: expr}},
+			},
+			Indexes:    []Index{{Name: "idx_posts_title", Columns: []string{index}}},
+			FTSColumns: fts,
+		}
+	}
+	comments := func(ref string) Table {
+		return Table{Name: "comments", Pk: []string{"id"}, Columns: map[string]Col{
+			"id":         {Name: "id", Type: "INTEGER"},
+			"post_title": {Name: "post_title", Type: "TEXT", References: ref},
+		}}
+	}
+	oldSchema := Schema{Tables: []Table{posts("title", nil, "lower([title]) || 'title'", "title"), comments("posts.title")}}
+	merge := func(newSchema Schema) (*MigrationPlan, error) {
+		changes := diffSchemas(oldSchema, newSchema)
+		old, add := -1, -1
+		for i, c := range changes {
+			if c.Type == "drop_column" && c.Column == "title" {
+				old = i
+			}
+			if c.Type == "add_column" && c.Column == "headline" {
+				add = i
+			}
+		}
+		return GenerateMigrationPlan(oldSchema, newSchema, changes, []Merge{{Old: old, New: add}})
+	}
+
+	stale := Schema{Tables: []Table{posts("headline", nil, "lower([title]) || 'title'", "title"), comments("posts.title")}}
+	_, err := merge(stale)
+	if err == nil {
+		t.Fatal("expected dependents still naming the old column to be flagged")
+	}
+	for _, want := range []string{"index idx_posts_title", "generated column posts.slug", "foreign key comments.post_title", "renamed column posts.title, now headline"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+
+	updated := Schema{Tables: []Table{posts("headline", nil, "lower([headline]) || 'title'", "headline"), comments("posts.headline")}}
+	plan, err := merge(updated)
+	if err != nil {
+		t.Fatalf("GenerateMigrationPlan failed: %v", err)
+	}
+	if len(plan.SQL) != 1 || plan.SQL[0] != "ALTER TABLE [posts] RENAME COLUMN [title] TO [headline]" {
+		t.Fatalf("expected the rename alone to carry the dependents, got %#v", plan.SQL)
+	}
+	if err := VerifyMigrationPlan(context.Background(), oldSchema, updated, plan.SQL, map[string][]map[string]any{
+		"posts": {{"id": 1, "title": "Hello"}},
+	}); err != nil {
+		t.Fatalf("VerifyMigrationPlan failed: %v", err)
+	}
+
+	oldFTS := Schema{Tables: []Table{posts("title", []string{"title"}, "lower(title)", "title")}}
+	newFTS := Schema{Tables: []Table{posts("headline", []string{"headline"}, "lower(headline)", "headline")}}
+	changes := diffSchemas(oldFTS, newFTS)
+	var merges []Merge
+	for i, c := range changes {
+		if c.Type == "drop_column" {
+			for j, d := range changes {
+				if d.Type == "add_column" {
+					merges = append(merges, Merge{Old: i, New: j})
+				}
+			}
+		}
+	}
+	plan, err = GenerateMigrationPlan(oldFTS, newFTS, changes, merges)
+	if err != nil {
+		t.Fatalf("GenerateMigrationPlan failed: %v", err)
+	}
+	sql := strings.Join(plan.SQL, "\n")
+	drop := strings.Index(sql, "DROP TABLE IF EXISTS [posts_fts]")
+	create := strings.Index(sql, "CREATE VIRTUAL TABLE IF NOT EXISTS [posts_fts] USING fts5([headline]")
+	rebuild := strings.Index(sql, "VALUES ('rebuild')")
+	if drop < 0 || create < drop || rebuild < create || strings.Count(sql, "CREATE VIRTUAL TABLE") != 1 {
+		t.Fatalf("expected the FTS table to be dropped, created and rebuilt once, got %#v", plan.SQL)
+	}
+	if strings.Contains(sql, "posts_new") {
+		t.Fatalf("expected no mirror table for an expression SQLite rewrites, got %#v", plan.SQL)
+	}
+}
+
+func TestRenameIdentifier(t *testing.T) {
+	tests := []struct {
+		expr, want string
+		replaced   bool
+	}{
+		{"lower(title)", "lower(headline)", true},
+		{"[title] || \"TITLE\" || `title`", "[headline] || \"headline\" || `headline`", true},
+		{"posts.title <> 'title'", "posts.headline <> 'title'", true},
+		{"subtitle || title_2 || 'it''s title'", "subtitle || title_2 || 'it''s title'", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		got, replaced := renameIdentifier(tt.expr, "title", "headline")
+		if got != tt.want || replaced != tt.replaced {
+			t.Errorf("renameIdentifier(%q) = %q, %v; want %q, %v", tt.expr, got, replaced, tt.want, tt.replaced)
+		}
+	}
+}
+
 func TestCreateMigration_PersistsDefinitionID(t *testing.T) {
 	api, db := setupPlatformAPI(t)
 	defer db.Close()
@@ -172,3 +280,383 @@ func TestCreateMigration_PersistsDefinitionID(t *testing.T) {
 		t.Fatalf("expected migration row to be inserted, got %d", count)
 	}
 }
+
+func TestGenerateMigrationPlan_GeoIndex(t *testing.T) {
+	places := func(lat string, geo []string) Table {
+		return Table{
+			Name: "places",
+			Pk:   []string{"id"},
+			Columns: map[string]Col{
+				"id":  {Name: "id", Type: "INTEGER"},
+				lat:   {Name: lat, Type: "REAL"},
+				"lng": {Name: "lng", Type: "REAL"},
+			},
+			GeoColumns: geo,
+		}
+	}
+	rows := map[string][]map[string]any{"places": {{"id": 1, "lat": 51.5, "lng": -0.12}, {"id": 2}}}
+
+	plain := Schema{Tables: []Table{places("lat", nil)}}
+	indexed := Schema{Tables: []Table{places("lat", []string{"lat", "lng"})}}
+	changes := diffSchemas(plain, indexed)
+	plan, err := GenerateMigrationPlan(plain, indexed, changes, nil)
+	if err != nil {
+		t.Fatalf("GenerateMigrationPlan failed: %v", err)
+	}
+	if !strings.Contains(strings.Join(plan.SQL, "\n"), "CREATE VIRTUAL TABLE IF NOT EXISTS [places_geo] USING rtree") {
+		t.Fatalf("missing geo index sql: %#v", plan.SQL)
+	}
+	if err := VerifyMigrationPlan(context.Background(), plain, indexed, plan.SQL, rows); err != nil {
+		t.Fatalf("VerifyMigrationPlan failed: %v", err)
+	}
+
+	// A renamed geo column is carried by the rename alone.
+	renamed := Schema{Tables: []Table{places("latitude", []string{"latitude", "lng"})}}
+	changes = diffSchemas(indexed, renamed)
+	var merges []Merge
+	for i, c := range changes {
+		if c.Type == "drop_column" {
+			for j, d := range changes {
+				if d.Type == "add_column" {
+					merges = append(merges, Merge{Old: i, New: j})
+				}
+			}
+		}
+	}
+	plan, err = GenerateMigrationPlan(indexed, renamed, changes, merges)
+	if err != nil {
+		t.Fatalf("GenerateMigrationPlan failed: %v", err)
+	}
+	if len(plan.SQL) != 1 {
+		t.Fatalf("expected the rename alone, got %#v", plan.SQL)
+	}
+	if err := VerifyMigrationPlan(context.Background(), indexed, renamed, plan.SQL, rows); err != nil {
+		t.Fatalf("VerifyMigrationPlan failed: %v", err)
+	}
+
+	plan, err = GenerateMigrationPlan(indexed, plain, diffSchemas(indexed, plain), nil)
+	if err != nil {
+		t.Fatalf("GenerateMigrationPlan failed: %v", err)
+	}
+	if err := VerifyMigrationPlan(context.Background(), indexed, plain, plan.SQL, rows); err != nil {
+		t.Fatalf("VerifyMigrationPlan failed: %v", err)
+	}
+
+	db, err := buildMigrationProbeDB(indexed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, stmt := range []string{
+		`INSERT INTO places (id, lat, lng) VALUES (1, 51.5, -0.12), (2, NULL, NULL), (3, 48.8, 2.35)`,
+		`UPDATE places SET lat = 10, lng = 20 WHERE id = 2`,
+		`UPDATE places SET lat = NULL WHERE id = 3`,
+		`DELETE FROM places WHERE id = 1`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	var ids string
+	if err := db.QueryRow(`SELECT group_concat(id) FROM places_geo`).Scan(&ids); err != nil || ids != "2" {
+		t.Fatalf("expected the triggers to index only located rows, got %q %v", ids, err)
+	}
+}
+
+func TestValidateGeoColumns(t *testing.T) {
+	table := func(pk string, geo ...string) Schema {
+		return Schema{Tables: []Table{{
+			Name: "places",
+			Pk:   []string{pk},
+			Columns: map[string]Col{
+				"id":   {Name: "id", Type: "INTEGER"},
+				"uuid": {Name: "uuid", Type: "TEXT"},
+				"lat":  {Name: "lat", Type: "REAL"},
+				"lng":  {Name: "lng", Type: "REAL"},
+			},
+			GeoColumns: geo,
+		}}}
+	}
+	if err := validateGeoColumns(table("id", "lat", "lng")); err != nil {
+		t.Fatalf("expected a valid geo index, got %v", err)
+	}
+	for name, schema := range map[string]Schema{
+		"one column":     table("id", "lat"),
+		"same column":    table("id", "lat", "lat"),
+		"unknown column": table("id", "lat", "lon"),
+		"text column":    table("id", "lat", "uuid"),
+		"text key":       table("uuid", "lat", "lng"),
+	} {
+		if err := validateGeoColumns(schema); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestGenerateMigrationPlan_SyncLog(t *testing.T) {
+	notes := func(title string, sync bool) Table {
+		return Table{
+			Name: "notes",
+			Pk:   []string{"id"},
+			Columns: map[string]Col{
+				"id":   {Name: "id", Type: "INTEGER"},
+				title:  {Name: title, Type: "TEXT"},
+				"body": {Name: "body", Type: "TEXT"},
+			},
+			Sync: sync,
+		}
+	}
+	rows := map[string][]map[string]any{"notes": {{"id": 1, "title": "a"}, {"id": 2, "title": "b"}}}
+
+	plain := Schema{Tables: []Table{notes("title", false)}}
+	synced := Schema{Tables: []Table{notes("title", true)}}
+	plan, err := GenerateMigrationPlan(plain, synced, diffSchemas(plain, synced), nil)
+	if err != nil {
+		t.Fatalf("GenerateMigrationPlan failed: %v", err)
+	}
+	if !strings.Contains(strings.Join(plan.SQL, "\n"), "CREATE TRIGGER IF NOT EXISTS [notes_sync_ai]") {
+		t.Fatalf("missing sync trigger sql: %#v", plan.SQL)
+	}
+	if err := VerifyMigrationPlan(context.Background(), plain, synced, plan.SQL, rows); err != nil {
+		t.Fatalf("VerifyMigrationPlan failed: %v", err)
+	}
+
+	plan, err = GenerateMigrationPlan(synced, plain, diffSchemas(synced, plain), nil)
+	if err != nil {
+		t.Fatalf("GenerateMigrationPlan failed: %v", err)
+	}
+	if err := VerifyMigrationPlan(context.Background(), synced, plain, plan.SQL, rows); err != nil {
+		t.Fatalf("VerifyMigrationPlan failed: %v", err)
+	}
+
+	db, err := buildMigrationProbeDB(synced)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, stmt := range []string{
+		`INSERT INTO notes (id, title) VALUES (1, 'a'), (2, 'b'), (3, 'c')`,
+		`UPDATE notes SET body = 'x' WHERE id = 1`,
+		`DELETE FROM notes WHERE id = 2`,
+		`UPDATE notes SET id = 4 WHERE id = 3`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	var log string
+	if err := db.QueryRow(`SELECT group_concat(pk || ':' || op, ' ') FROM (SELECT pk, op FROM atombase_changes WHERE tbl = 'notes' ORDER BY seq)`).Scan(&log); err != nil {
+		t.Fatal(err)
+	}
+	if log != "1:upsert 2:delete 3:delete 4:upsert" {
+		t.Fatalf("expected one entry per row in change order, got %q", log)
+	}
+	var old string
+	if err := db.QueryRow(`SELECT old FROM atombase_changes WHERE tbl = 'notes' AND pk = 2`).Scan(&old); err != nil {
+		t.Fatal(err)
+	}
+	if old != `{"body":null,"id":2,"title":"b"}` {
+		t.Fatalf("expected the deleted row's image, got %s", old)
+	}
+
+	// The triggers name every column, so changing one remakes them.
+	retitled := Schema{Tables: []Table{notes("heading", true)}}
+	plan, err = GenerateMigrationPlan(synced, retitled, diffSchemas(synced, retitled), nil)
+	if err != nil {
+		t.Fatalf("GenerateMigrationPlan failed: %v", err)
+	}
+	if err := VerifyMigrationPlan(context.Background(), synced, retitled, plan.SQL, rows); err != nil {
+		t.Fatalf("VerifyMigrationPlan failed: %v", err)
+	}
+}
+
+func TestValidateSyncTables(t *testing.T) {
+	table := func(pk ...string) Schema {
+		return Schema{Tables: []Table{{
+			Name: "notes",
+			Pk:   pk,
+			Columns: map[string]Col{
+				"id":   {Name: "id", Type: "INTEGER"},
+				"slug": {Name: "slug", Type: "TEXT"},
+			},
+			Sync: true,
+		}}}
+	}
+	if err := validateSyncTables(table("id")); err != nil {
+		t.Fatalf("expected a single-column key to be valid, got %v", err)
+	}
+	if err := validateSyncTables(table("id", "slug")); err == nil {
+		t.Fatal("expected a composite key to be rejected")
+	}
+}
+
+func TestGenerateMigrationPlan_TimeSeries(t *testing.T) {
+	events := func(ts *TimeSeries) Table {
+		return Table{
+			Name: "events",
+			Pk:   []string{"id"},
+			Columns: map[string]Col{
+				"id": {Name: "id", Type: "INTEGER"},
+				"at": {Name: "at", Type: "INTEGER"},
+			},
+			TimeSeries: ts,
+		}
+	}
+	rows := map[string][]map[string]any{"events": {{"id": 1, "at": 1767225600}}}
+
+	plain := Schema{Tables: []Table{events(nil)}}
+	series := Schema{Tables: []Table{events(&TimeSeries{Column: "at"})}}
+	plan, err := GenerateMigrationPlan(plain, series, diffSchemas(plain, series), nil)
+	if err != nil {
+		t.Fatalf("GenerateMigrationPlan failed: %v", err)
+	}
+	sql := strings.Join(plan.SQL, "\n")
+	if !strings.Contains(sql, "atombase_partitions") || !strings.Contains(sql, "[events_series]") {
+		t.Fatalf("missing partition catalog or series view: %#v", plan.SQL)
+	}
+	if err := VerifyMigrationPlan(context.Background(), plain, series, plan.SQL, rows); err != nil {
+		t.Fatalf("VerifyMigrationPlan failed: %v", err)
+	}
+
+	plan, err = GenerateMigrationPlan(series, plain, diffSchemas(series, plain), nil)
+	if err != nil {
+		t.Fatalf("GenerateMigrationPlan failed: %v", err)
+	}
+	if !strings.Contains(strings.Join(plan.SQL, "\n"), "DROP VIEW IF EXISTS [events_series]") {
+		t.Fatalf("expected the series view dropped: %#v", plan.SQL)
+	}
+	if err := VerifyMigrationPlan(context.Background(), series, plain, plan.SQL, rows); err != nil {
+		t.Fatalf("VerifyMigrationPlan failed: %v", err)
+	}
+}
+
+func TestValidateTimeSeriesTables(t *testing.T) {
+	table := func(column string, ts TimeSeries) Schema {
+		return Schema{Tables: []Table{{
+			Name: "events",
+			Pk:   []string{"id"},
+			Columns: map[string]Col{
+				"id": {Name: "id", Type: "INTEGER"},
+				"at": {Name: "at", Type: column},
+			},
+			TimeSeries: &ts,
+		}}}
+	}
+	if err := validateTimeSeriesTables(table("TEXT", TimeSeries{Column: "at", Retention: 6, Archive: true})); err != nil {
+		t.Fatalf("expected a valid time series, got %v", err)
+	}
+	for name, schema := range map[string]Schema{
+		"missing column":        table("INTEGER", TimeSeries{Column: "created_at"}),
+		"real column":           table("REAL", TimeSeries{Column: "at"}),
+		"negative retention":    table("INTEGER", TimeSeries{Column: "at", Retention: -1}),
+		"archive w/o retention": table("INTEGER", TimeSeries{Column: "at", Archive: true}),
+	} {
+		if err := validateTimeSeriesTables(schema); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestGenerateMigrationPlan_Rollups(t *testing.T) {
+	events := func(rollups ...Rollup) Table {
+		return Table{
+			Name: "events",
+			Pk:   []string{"id"},
+			Columns: map[string]Col{
+				"id":    {Name: "id", Type: "INTEGER"},
+				"at":    {Name: "at", Type: "INTEGER"},
+				"value": {Name: "value", Type: "REAL"},
+			},
+			TimeSeries: &TimeSeries{Column: "at", Rollups: rollups},
+		}
+	}
+	hourly := Rollup{Resolution: "hour", Aggregates: map[string]Aggregate{"n": {Fn: "count"}}}
+	daily := Rollup{Resolution: "day", Aggregates: map[string]Aggregate{"total": {Fn: "sum", Column: "value"}}}
+	rows := map[string][]map[string]any{"events": {{"id": 1, "at": 1767225600, "value": 2.5}}}
+
+	plain := Schema{Tables: []Table{events()}}
+	rolled := Schema{Tables: []Table{events(hourly, daily)}}
+	plan, err := GenerateMigrationPlan(plain, rolled, diffSchemas(plain, rolled), nil)
+	if err != nil {
+		t.Fatalf("GenerateMigrationPlan failed: %v", err)
+	}
+	sql := strings.Join(plan.SQL, "\n")
+	if !strings.Contains(sql, "CREATE TABLE IF NOT EXISTS [events_rollup_hour] ([at] INTEGER NOT NULL, [n] INTEGER, PRIMARY KEY ([at]))") ||
+		!strings.Contains(sql, "[events_rollup_day] ([at] INTEGER NOT NULL, [total] REAL") {
+		t.Fatalf("missing rollup tables: %#v", plan.SQL)
+	}
+	if err := VerifyMigrationPlan(context.Background(), plain, rolled, plan.SQL, rows); err != nil {
+		t.Fatalf("VerifyMigrationPlan failed: %v", err)
+	}
+
+	// A changed rollup starts over; an unchanged one is left alone.
+	hourly.Aggregates = map[string]Aggregate{"peak": {Fn: "max", Column: "value"}}
+	changed := Schema{Tables: []Table{events(hourly, daily)}}
+	plan, err = GenerateMigrationPlan(rolled, changed, diffSchemas(rolled, changed), nil)
+	if err != nil {
+		t.Fatalf("GenerateMigrationPlan failed: %v", err)
+	}
+	sql = strings.Join(plan.SQL, "\n")
+	if !strings.Contains(sql, "DROP TABLE IF EXISTS [events_rollup_hour]") || strings.Contains(sql, "events_rollup_day") {
+		t.Fatalf("expected only the hourly rollup made again: %#v", plan.SQL)
+	}
+	if err := VerifyMigrationPlan(context.Background(), rolled, changed, plan.SQL, rows); err != nil {
+		t.Fatalf("VerifyMigrationPlan failed: %v", err)
+	}
+
+	// A renamed table takes its rollups along.
+	renamed := Schema{Tables: []Table{events(hourly, daily)}}
+	renamed.Tables[0].Name = "readings"
+	changes := diffSchemas(changed, renamed)
+	var merges []Merge
+	for i, c := range changes {
+		for j, d := range changes {
+			if c.Type == "drop_table" && d.Type == "add_table" {
+				merges = append(merges, Merge{Old: i, New: j})
+			}
+		}
+	}
+	plan, err = GenerateMigrationPlan(changed, renamed, changes, merges)
+	if err != nil {
+		t.Fatalf("GenerateMigrationPlan failed: %v", err)
+	}
+	if !strings.Contains(strings.Join(plan.SQL, "\n"), "ALTER TABLE [events_rollup_day] RENAME TO [readings_rollup_day]") {
+		t.Fatalf("expected the rollups renamed: %#v", plan.SQL)
+	}
+	if err := VerifyMigrationPlan(context.Background(), changed, renamed, plan.SQL, nil); err != nil {
+		t.Fatalf("VerifyMigrationPlan failed: %v", err)
+	}
+}
+
+func TestValidateRollups(t *testing.T) {
+	schema := func(rollups ...Rollup) Schema {
+		return Schema{Tables: []Table{{
+			Name: "events",
+			Pk:   []string{"id"},
+			Columns: map[string]Col{
+				"id":    {Name: "id", Type: "INTEGER"},
+				"at":    {Name: "at", Type: "INTEGER"},
+				"kind":  {Name: "kind", Type: "TEXT"},
+				"value": {Name: "value", Type: "REAL"},
+			},
+			TimeSeries: &TimeSeries{Column: "at", Rollups: rollups},
+		}}}
+	}
+	count := map[string]Aggregate{"n": {Fn: "count"}}
+	if err := validateTimeSeriesTables(schema(Rollup{Resolution: "minute", GroupBy: []string{"kind"}, Aggregates: count})); err != nil {
+		t.Fatalf("expected a valid rollup, got %v", err)
+	}
+	for name, s := range map[string]Schema{
+		"resolution":     schema(Rollup{Resolution: "week", Aggregates: count}),
+		"duplicate":      schema(Rollup{Resolution: "hour", Aggregates: count}, Rollup{Resolution: "hour", Aggregates: count}),
+		"no aggregates":  schema(Rollup{Resolution: "hour"}),
+		"group by time":  schema(Rollup{Resolution: "hour", GroupBy: []string{"at"}, Aggregates: count}),
+		"name clash":     schema(Rollup{Resolution: "hour", GroupBy: []string{"kind"}, Aggregates: map[string]Aggregate{"kind": {Fn: "count"}}}),
+		"unknown fn":     schema(Rollup{Resolution: "hour", Aggregates: map[string]Aggregate{"p": {Fn: "median", Column: "value"}}}),
+		"missing column": schema(Rollup{Resolution: "hour", Aggregates: map[string]Aggregate{"s": {Fn: "sum"}}}),
+	} {
+		if err := validateTimeSeriesTables(s); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package platform
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/atombasedev/atombase/tools"
+)
+
+// Name cases a naming policy can require.
+const (
+	NameCaseSnake  = "snake"
+	NameCaseCamel  = "camel"
+	NameCasePascal = "pascal"
+)
+
+var nameCasePatterns = map[string]*regexp.Regexp{
+	NameCaseSnake:  regexp.MustCompile(`^[a-z][a-z0-9]*(_[a-z0-9]+)*$`),
+	NameCaseCamel:  regexp.MustCompile(`^[a-z][a-zA-Z0-9]*$`),
+	NameCasePascal: regexp.MustCompile(`^[A-Z][a-zA-Z0-9]*$`),
+}
+
+// validateNaming checks the policy itself, then every table, view, column, index
+// and localized field name in the schema against it.
+func validateNaming(schema Schema, policy NamingPolicy) error {
+	if policy.Case != "" && nameCasePatterns[policy.Case] == nil {
+		return fmt.Errorf("unknown case %q, use snake, camel or pascal", policy.Case)
+	}
+	if policy.MaxLength < 0 || policy.MaxLength > tools.MaxIdentifierLength {
+		return fmt.Errorf("maxLength cannot be negative or exceed %d", tools.MaxIdentifierLength)
+	}
+	for _, prefix := range policy.ForbiddenPrefixes {
+		if prefix == "" {
+			return fmt.Errorf("forbiddenPrefixes cannot contain an empty prefix")
+		}
+	}
+	for _, word := range policy.ReservedWords {
+		if word == "" {
+			return fmt.Errorf("reservedWords cannot contain an empty word")
+		}
+	}
+
+	tables := append([]Table(nil), schema.Tables...)
+	sort.Slice(tables, func(i, j int) bool { return tables[i].Name < tables[j].Name })
+	for _, table := range tables {
+		if err := checkName(policy, "table", table.Name); err != nil {
+			return err
+		}
+		for _, name := range sortedKeys(table.Columns) {
+			if err := checkName(policy, "column", table.Name+"."+name); err != nil {
+				return err
+			}
+		}
+		for _, index := range table.Indexes {
+			if err := checkName(policy, "index", index.Name); err != nil {
+				return err
+			}
+		}
+		if schema.Settings != nil {
+			for _, name := range sortedKeys(schema.Settings.Localized[table.Name]) {
+				if err := checkName(policy, "localized field", table.Name+"."+name); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	for _, view := range schema.Views {
+		if err := checkName(policy, "view", view.Name); err != nil {
+			return err
+		}
+		for _, name := range sortedKeys(view.Columns) {
+			if err := checkName(policy, "column", view.Name+"."+name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkName checks one name; qualified is the name, or table.name for
+// columns and fields, which is only used in the error.
+func checkName(policy NamingPolicy, kind, qualified string) error {
+	name := qualified[strings.LastIndex(qualified, ".")+1:]
+	if policy.MaxLength > 0 && len(name) > policy.MaxLength {
+		return fmt.Errorf("%s %s is longer than %d characters", kind, qualified, policy.MaxLength)
+	}
+	if pattern := nameCasePatterns[policy.Case]; pattern != nil && !pattern.MatchString(name) {
+		return fmt.Errorf("%s %s is not %s case", kind, qualified, policy.Case)
+	}
+	lower := strings.ToLower(name)
+	for _, prefix := range policy.ForbiddenPrefixes {
+		if strings.HasPrefix(lower, strings.ToLower(prefix)) {
+			return fmt.Errorf("%s %s starts with the forbidden prefix %q", kind, qualified, prefix)
+		}
+	}
+	for _, word := range policy.ReservedWords {
+		if lower == strings.ToLower(word) {
+			return fmt.Errorf("%s %s is a reserved word", kind, qualified)
+		}
+	}
+	return nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
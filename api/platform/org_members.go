@@ -0,0 +1,446 @@
+package platform
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/atombasedev/atombase/config"
+	"github.com/atombasedev/atombase/tools"
+)
+
+// Audit actions recorded for the members of platform organizations.
+const (
+	auditOrgMemberInvited     = "org.member_invited"
+	auditOrgInvitationRevoked = "org.invitation_revoked"
+	auditOrgMemberJoined      = "org.member_joined"
+	auditOrgMemberRoleChanged = "org.member_role_changed"
+	auditOrgMemberRemoved     = "org.member_removed"
+)
+
+const orgInvitationTTL = 7 * 24 * time.Hour
+
+// orgRoleRanks orders the org roles; a higher rank may do what a lower can.
+var orgRoleRanks = map[string]int{
+	tools.OrgRoleViewer:    1,
+	tools.OrgRoleDeveloper: 2,
+	tools.OrgRoleAdmin:     3,
+	tools.OrgRoleOwner:     4,
+}
+
+func validateOrgRole(role string) error {
+	if orgRoleRanks[role] == 0 {
+		return tools.InvalidRequestErr(fmt.Sprintf("unknown role %q, use owner, admin, developer or viewer", role))
+	}
+	return nil
+}
+
+func roleAtLeast(role, needed string) bool {
+	return orgRoleRanks[role] >= orgRoleRanks[needed]
+}
+
+// callerRole returns the org role of the caller's key. Callers without an
+// org, such as the service key, act as owners.
+func callerRole(ctx context.Context) string {
+	if scope := tools.GetAuthContext(ctx).Scope; scope != nil && scope.Org != "" {
+		return scope.Role
+	}
+	return tools.OrgRoleOwner
+}
+
+// callerName names who sent an invitation: the caller's key, or the service.
+func callerName(ctx context.Context) string {
+	scope := tools.GetAuthContext(ctx).Scope
+	if scope == nil {
+		return "service"
+	}
+	return "api_key:" + scope.KeyID
+}
+
+// memberVerbs are the verbs of a member's key: viewers read, everyone else
+// administers what their role allows.
+func memberVerbs(role string) []string {
+	if role == tools.OrgRoleViewer {
+		return []string{tools.VerbRead}
+	}
+	return []string{tools.VerbAdmin}
+}
+
+func normalizeMemberEmail(email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email {
+		return "", tools.InvalidRequestErr("a valid email is required")
+	}
+	return email, nil
+}
+
+func (api *API) listOrgMembers(ctx context.Context, org string) ([]OrgMember, error) {
+	if _, err := api.getOrg(ctx, org); err != nil {
+		return nil, err
+	}
+	conn, err := api.dbConn()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := conn.QueryContext(ctx, `
+		SELECT email, role, created_at FROM atombase_platform_org_members WHERE org_id = ? ORDER BY email
+	`, org)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	members := []OrgMember{}
+	for rows.Next() {
+		var member OrgMember
+		var createdAt string
+		if err := rows.Scan(&member.Email, &member.Role, &createdAt); err != nil {
+			return nil, err
+		}
+		member.CreatedAt = mustParseTime(createdAt)
+		members = append(members, member)
+	}
+	return members, rows.Err()
+}
+
+func (api *API) getOrgMember(ctx context.Context, org, email string) (*OrgMember, error) {
+	conn, err := api.dbConn()
+	if err != nil {
+		return nil, err
+	}
+	member := OrgMember{Email: strings.ToLower(email)}
+	var createdAt string
+	err = conn.QueryRowContext(ctx, `
+		SELECT role, created_at FROM atombase_platform_org_members WHERE org_id = ? AND email = ?
+	`, org, member.Email).Scan(&member.Role, &createdAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, tools.ErrOrgMemberNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	member.CreatedAt = mustParseTime(createdAt)
+	return &member, nil
+}
+
+// checkOwnerChange refuses changes to an owner, or to owner, by callers below
+// owner, and org keys taking away the org's last owner.
+func (api *API) checkOwnerChange(ctx context.Context, org string, member *OrgMember, newRole string) error {
+	role := callerRole(ctx)
+	if !roleAtLeast(role, member.Role) || !roleAtLeast(role, newRole) {
+		return fmt.Errorf("%w: only owners can grant or take the owner role", tools.ErrAPIKeyScope)
+	}
+	if member.Role != tools.OrgRoleOwner || newRole == tools.OrgRoleOwner || callerOrg(ctx) == "" {
+		return nil
+	}
+	conn, err := api.dbConn()
+	if err != nil {
+		return err
+	}
+	var owners int
+	if err := conn.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM atombase_platform_org_members WHERE org_id = ? AND role = ?
+	`, org, tools.OrgRoleOwner).Scan(&owners); err != nil {
+		return err
+	}
+	if owners <= 1 {
+		return tools.InvalidRequestErr(fmt.Sprintf("%s is the last owner of %s", member.Email, org))
+	}
+	return nil
+}
+
+// updateOrgMember changes a member's role, and the role and verbs of their
+// keys with it.
+func (api *API) updateOrgMember(ctx context.Context, org, email string, req UpdateMemberRequest) (*OrgMember, error) {
+	if err := validateOrgRole(req.Role); err != nil {
+		return nil, err
+	}
+	member, err := api.getOrgMember(ctx, org, email)
+	if err != nil {
+		return nil, err
+	}
+	if member.Role == req.Role {
+		return member, nil
+	}
+	if err := api.checkOwnerChange(ctx, org, member, req.Role); err != nil {
+		return nil, err
+	}
+	conn, err := api.dbConn()
+	if err != nil {
+		return nil, err
+	}
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	verbsJSON, _ := json.Marshal(memberVerbs(req.Role))
+	for _, stmt := range []struct {
+		query string
+		args  []any
+	}{
+		{`UPDATE atombase_platform_org_members SET role = ? WHERE org_id = ? AND email = ?`, []any{req.Role, org, member.Email}},
+		{`UPDATE atombase_api_key_orgs SET role = ? WHERE org_id = ? AND member_email = ?`, []any{req.Role, org, member.Email}},
+		{`UPDATE atombase_api_keys SET verbs_json = ?
+		  WHERE id IN (SELECT key_id FROM atombase_api_key_orgs WHERE org_id = ? AND member_email = ?)`, []any{string(verbsJSON), org, member.Email}},
+	} {
+		if _, err := tx.ExecContext(ctx, stmt.query, stmt.args...); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	if err := api.recordAudit(ctx, auditOrgMemberRoleChanged, "org:"+org, map[string]string{
+		"email": member.Email, "from": member.Role, "to": req.Role,
+	}); err != nil {
+		return nil, err
+	}
+	member.Role = req.Role
+	return member, nil
+}
+
+// removeOrgMember takes a member out of an org and revokes their keys.
+func (api *API) removeOrgMember(ctx context.Context, org, email string) error {
+	member, err := api.getOrgMember(ctx, org, email)
+	if err != nil {
+		return err
+	}
+	if err := api.checkOwnerChange(ctx, org, member, ""); err != nil {
+		return err
+	}
+	conn, err := api.dbConn()
+	if err != nil {
+		return err
+	}
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, query := range []string{
+		`DELETE FROM atombase_api_keys WHERE id IN (SELECT key_id FROM atombase_api_key_orgs WHERE org_id = ? AND member_email = ?)`,
+		`DELETE FROM atombase_api_key_orgs WHERE org_id = ? AND member_email = ?`,
+		`DELETE FROM atombase_platform_org_members WHERE org_id = ? AND email = ?`,
+	} {
+		if _, err := tx.ExecContext(ctx, query, org, member.Email); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return api.recordAudit(ctx, auditOrgMemberRemoved, "org:"+org, map[string]string{"email": member.Email, "role": member.Role})
+}
+
+// createOrgInvitation invites email to org with role and emails them the
+// token. Only its hash is stored; the token is returned once.
+func (api *API) createOrgInvitation(ctx context.Context, org string, req CreateInvitationRequest) (*OrgInvitation, error) {
+	email, err := normalizeMemberEmail(req.Email)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateOrgRole(req.Role); err != nil {
+		return nil, err
+	}
+	if !roleAtLeast(callerRole(ctx), req.Role) {
+		return nil, fmt.Errorf("%w: a %s cannot invite %ss", tools.ErrAPIKeyScope, callerRole(ctx), req.Role)
+	}
+	platformOrg, err := api.getOrg(ctx, org)
+	if err != nil {
+		return nil, err
+	}
+
+	id := make([]byte, 8)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	invitation := &OrgInvitation{
+		ID:        "inv_" + hex.EncodeToString(id),
+		Org:       org,
+		Email:     email,
+		Role:      req.Role,
+		InvitedBy: callerName(ctx),
+		Token:     base64.RawURLEncoding.EncodeToString(secret),
+		ExpiresAt: now.Add(orgInvitationTTL),
+		CreatedAt: now,
+	}
+	hash := sha256.Sum256([]byte(invitation.Token))
+	conn, err := api.dbConn()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.ExecContext(ctx, `
+		INSERT INTO atombase_platform_org_invitations (id, org_id, email, role, token_hash, invited_by, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, invitation.ID, org, email, invitation.Role, hash[:], invitation.InvitedBy,
+		invitation.ExpiresAt.Format(time.RFC3339), now.Format(time.RFC3339)); err != nil {
+		return nil, err
+	}
+	if err := sendEmailFn(ctx, buildOrgInvitationEmail(platformOrg, invitation)); err != nil {
+		_, _ = conn.ExecContext(ctx, `DELETE FROM atombase_platform_org_invitations WHERE id = ?`, invitation.ID)
+		return nil, err
+	}
+	if err := api.recordAudit(ctx, auditOrgMemberInvited, "org:"+org, map[string]string{
+		"invitationId": invitation.ID, "email": email, "role": invitation.Role, "invitedBy": invitation.InvitedBy,
+	}); err != nil {
+		return nil, err
+	}
+	return invitation, nil
+}
+
+// listOrgInvitations returns an org's pending invitations, newest first.
+func (api *API) listOrgInvitations(ctx context.Context, org string) ([]OrgInvitation, error) {
+	if _, err := api.getOrg(ctx, org); err != nil {
+		return nil, err
+	}
+	conn, err := api.dbConn()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := conn.QueryContext(ctx, `
+		SELECT id, email, role, invited_by, expires_at, created_at
+		FROM atombase_platform_org_invitations
+		WHERE org_id = ? AND expires_at > ?
+		ORDER BY created_at DESC, id
+	`, org, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	invitations := []OrgInvitation{}
+	for rows.Next() {
+		invitation := OrgInvitation{Org: org}
+		var expiresAt, createdAt string
+		if err := rows.Scan(&invitation.ID, &invitation.Email, &invitation.Role, &invitation.InvitedBy, &expiresAt, &createdAt); err != nil {
+			return nil, err
+		}
+		invitation.ExpiresAt = mustParseTime(expiresAt)
+		invitation.CreatedAt = mustParseTime(createdAt)
+		invitations = append(invitations, invitation)
+	}
+	return invitations, rows.Err()
+}
+
+func (api *API) deleteOrgInvitation(ctx context.Context, org, id string) error {
+	conn, err := api.dbConn()
+	if err != nil {
+		return err
+	}
+	result, err := conn.ExecContext(ctx, `
+		DELETE FROM atombase_platform_org_invitations WHERE id = ? AND org_id = ?
+	`, id, org)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return tools.ErrOrgInvitationNotFound
+	}
+	return api.recordAudit(ctx, auditOrgInvitationRevoked, "org:"+org, map[string]string{"invitationId": id})
+}
+
+// acceptOrgInvitation redeems an invitation token: the invitee becomes a
+// member with the invited role, or takes it if they already were one, and
+// gets a platform key for the org. The invitation is used up.
+func (api *API) acceptOrgInvitation(ctx context.Context, token string) (*AcceptedInvitation, error) {
+	if token == "" {
+		return nil, tools.InvalidRequestErr("token is required")
+	}
+	conn, err := api.dbConn()
+	if err != nil {
+		return nil, err
+	}
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	hash := sha256.Sum256([]byte(token))
+	var id, org, email, role string
+	err = tx.QueryRowContext(ctx, `
+		SELECT id, org_id, email, role FROM atombase_platform_org_invitations
+		WHERE token_hash = ? AND expires_at > ?
+	`, hash[:], time.Now().UTC().Format(time.RFC3339)).Scan(&id, &org, &email, &role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, tools.ErrOrgInvitationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	if _, err := tx.ExecContext(ctx, `DELETE FROM atombase_platform_org_invitations WHERE id = ?`, id); err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO atombase_platform_org_members (org_id, email, role, created_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(org_id, email) DO UPDATE SET role = excluded.role
+	`, org, email, role, now.Format(time.RFC3339)); err != nil {
+		return nil, err
+	}
+	key := &APIKey{
+		Name:   "member " + email,
+		Org:    org,
+		Role:   role,
+		Member: email,
+		Verbs:  memberVerbs(role),
+	}
+	if err := storeAPIKey(ctx, tx, key); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	if err := api.recordAudit(ctx, auditOrgMemberJoined, "org:"+org, map[string]string{
+		"invitationId": id, "email": email, "role": role, "keyId": key.ID,
+	}); err != nil {
+		return nil, err
+	}
+	member, err := api.getOrgMember(ctx, org, email)
+	if err != nil {
+		return nil, err
+	}
+	return &AcceptedInvitation{Org: org, Member: *member, Key: *key}, nil
+}
+
+var sendEmailFn = sendEmail
+
+func sendEmail(ctx context.Context, msg tools.Email) error {
+	return tools.SendEmail(ctx, msg)
+}
+
+func buildOrgInvitationEmail(org *PlatformOrg, invitation *OrgInvitation) tools.Email {
+	lines := []string{
+		fmt.Sprintf("You have been invited to join the %s organization on Atomicbase as %s.", org.Name, invitation.Role),
+		"",
+		fmt.Sprintf("Invitation token: %s", invitation.Token),
+		fmt.Sprintf("Expires at: %s", invitation.ExpiresAt.Format(time.RFC3339)),
+	}
+	if apiURL := strings.TrimRight(strings.TrimSpace(config.Cfg.ApiURL), "/"); apiURL != "" {
+		lines = append(lines,
+			"",
+			"Accept it with:",
+			fmt.Sprintf(`POST %s/platform/invitations/accept {"token": "<invitation token>"}`, apiURL),
+		)
+	}
+	lines = append(lines, "", "If you were not expecting this invitation, you can ignore this email.")
+	return tools.Email{
+		To:      invitation.Email,
+		Subject: fmt.Sprintf("You're invited to %s on Atomicbase", org.Name),
+		Text:    strings.Join(lines, "\n"),
+	}
+}
@@ -0,0 +1,137 @@
+package platform
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/atombasedev/atombase/tools"
+)
+
+func TestPlatformOrgMembers(t *testing.T) {
+	api, db := setupPlatformAPI(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	var sent []tools.Email
+	oldSendEmail := sendEmailFn
+	sendEmailFn = func(_ context.Context, msg tools.Email) error {
+		sent = append(sent, msg)
+		return nil
+	}
+	t.Cleanup(func() { sendEmailFn = oldSendEmail })
+
+	if _, err := api.createOrg(ctx, CreateOrgRequest{ID: "acme", Name: "Acme"}); err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	api.RegisterRoutes(mux)
+	handler := tools.ScopedAuthMiddleware(api.store.LookupAPIKey)(mux)
+	do := func(token, method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	accept := func(token string) AcceptedInvitation {
+		t.Helper()
+		rec := do("", http.MethodPost, "/platform/invitations/accept", `{"token": "`+token+`"}`)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("expected the invitation to be accepted, got %d %s", rec.Code, rec.Body.String())
+		}
+		var accepted AcceptedInvitation
+		if err := json.Unmarshal(rec.Body.Bytes(), &accepted); err != nil {
+			t.Fatal(err)
+		}
+		return accepted
+	}
+
+	owner, err := api.createOrgInvitation(ctx, "acme", CreateInvitationRequest{Email: "Olga@Example.com", Role: tools.OrgRoleOwner})
+	if err != nil || owner.Email != "olga@example.com" || owner.Token == "" {
+		t.Fatalf("expected an owner invitation, got %#v, %v", owner, err)
+	}
+	if len(sent) != 1 || sent[0].To != "olga@example.com" || !strings.Contains(sent[0].Text, owner.Token) {
+		t.Fatalf("expected the invitation to be emailed, got %#v", sent)
+	}
+	olga := accept(owner.Token)
+	if olga.Member.Role != tools.OrgRoleOwner || olga.Key.Role != tools.OrgRoleOwner || olga.Key.Member != "olga@example.com" {
+		t.Fatalf("expected olga to join as an owner, got %#v", olga)
+	}
+	if rec := do("", http.MethodPost, "/platform/invitations/accept", `{"token": "`+owner.Token+`"}`); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected a used invitation to be refused, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	rec := do(olga.Key.Key, http.MethodPost, "/platform/orgs/acme/invitations", `{"email": "ada@example.com", "role": "admin"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected the owner to invite an admin, got %d %s", rec.Code, rec.Body.String())
+	}
+	var invitation OrgInvitation
+	if err := json.Unmarshal(rec.Body.Bytes(), &invitation); err != nil {
+		t.Fatal(err)
+	}
+	ada := accept(invitation.Token)
+
+	if rec := do(ada.Key.Key, http.MethodPost, "/platform/orgs/acme/invitations", `{"email": "eve@example.com", "role": "owner"}`); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected an admin to be refused inviting an owner, got %d %s", rec.Code, rec.Body.String())
+	}
+	rec = do(ada.Key.Key, http.MethodPost, "/platform/orgs/acme/invitations", `{"email": "vic@example.com", "role": "viewer"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected an admin to invite a viewer, got %d %s", rec.Code, rec.Body.String())
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &invitation); err != nil {
+		t.Fatal(err)
+	}
+	vic := accept(invitation.Token)
+	if len(vic.Key.Verbs) != 1 || vic.Key.Verbs[0] != tools.VerbRead {
+		t.Fatalf("expected a read key for a viewer, got %#v", vic.Key)
+	}
+
+	if rec := do(vic.Key.Key, http.MethodGet, "/platform/orgs/acme/members", ""); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "ada@example.com") {
+		t.Fatalf("expected a viewer to list members, got %d %s", rec.Code, rec.Body.String())
+	}
+	definition := `{"name": "shop", "type": "global",
+		"schema": {"tables": [{"name": "posts", "pk": ["id"], "columns": {"id": {"name": "id", "type": "INTEGER"}}}]}}`
+	if rec := do(vic.Key.Key, http.MethodPost, "/platform/definitions", definition); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected a viewer to be refused changes, got %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := do(ada.Key.Key, http.MethodPatch, "/platform/orgs/acme/members/vic@example.com", `{"role": "developer"}`); rec.Code != http.StatusOK {
+		t.Fatalf("expected the admin to promote vic, got %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := do(vic.Key.Key, http.MethodPost, "/platform/definitions", definition); rec.Code != http.StatusCreated {
+		t.Fatalf("expected a developer to create definitions, got %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := do(vic.Key.Key, http.MethodPost, "/platform/keys", `{"name": "mine", "verbs": ["admin"]}`); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected a developer to be refused key management, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	if rec := do(ada.Key.Key, http.MethodDelete, "/platform/orgs/acme/members/olga@example.com", ""); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected an admin to be refused removing an owner, got %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := do(olga.Key.Key, http.MethodPatch, "/platform/orgs/acme/members/olga@example.com", `{"role": "admin"}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected the last owner to be kept, got %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := do(ada.Key.Key, http.MethodDelete, "/platform/orgs/acme/members/vic@example.com", ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("expected the admin to remove vic, got %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := do(vic.Key.Key, http.MethodGet, "/platform/definitions", ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected vic's key to be revoked, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	for action, want := range map[string]int{
+		auditOrgMemberInvited:     3,
+		auditOrgMemberJoined:      3,
+		auditOrgMemberRoleChanged: 1,
+		auditOrgMemberRemoved:     1,
+	} {
+		entries, err := api.listAuditLog(ctx, action, 0)
+		if err != nil || len(entries) != want {
+			t.Fatalf("expected %d %s entries, got %v, %v", want, action, entries, err)
+		}
+	}
+}
@@ -0,0 +1,294 @@
+package platform
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/atombasedev/atombase/tools"
+)
+
+// Audit actions recorded for platform organizations.
+const (
+	auditOrgCreated = "org.created"
+	auditOrgUpdated = "org.updated"
+	auditOrgDeleted = "org.deleted"
+)
+
+// callerOrg returns the platform organization of the caller's API key, or ""
+// for the service key and keys without an org.
+func callerOrg(ctx context.Context) string {
+	if scope := tools.GetAuthContext(ctx).Scope; scope != nil {
+		return scope.Org
+	}
+	return ""
+}
+
+// requestOrg picks the org a new definition or key belongs to: the caller's
+// when it used an org key, else the requested one, which must exist.
+func (api *API) requestOrg(ctx context.Context, requested string) (string, error) {
+	if org := callerOrg(ctx); org != "" {
+		if requested != "" && requested != org {
+			return "", fmt.Errorf("%w: a key of org %s cannot act for org %s", tools.ErrAPIKeyScope, org, requested)
+		}
+		return org, nil
+	}
+	if requested == "" {
+		return "", nil
+	}
+	if _, err := api.getOrg(ctx, requested); err != nil {
+		return "", err
+	}
+	return requested, nil
+}
+
+func (api *API) createOrg(ctx context.Context, req CreateOrgRequest) (*PlatformOrg, error) {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return nil, tools.InvalidRequestErr("name is required")
+	}
+	if req.MaxDefinitions < 0 || req.MaxDatabases < 0 {
+		return nil, tools.InvalidRequestErr("quotas cannot be negative")
+	}
+	conn, err := api.dbConn()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.ExecContext(ctx, `
+		INSERT INTO atombase_platform_orgs (id, name, max_definitions, max_databases, created_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, req.ID, req.Name, req.MaxDefinitions, req.MaxDatabases, time.Now().UTC().Format(time.RFC3339)); err != nil {
+		if isUniqueConstraintError(err) {
+			return nil, tools.ErrOrgExists
+		}
+		return nil, err
+	}
+	if err := api.recordAudit(ctx, auditOrgCreated, "org:"+req.ID, req); err != nil {
+		return nil, err
+	}
+	return api.getOrg(ctx, req.ID)
+}
+
+// listOrgs returns every platform organization with its usage, by id.
+func (api *API) listOrgs(ctx context.Context) ([]PlatformOrg, error) {
+	conn, err := api.dbConn()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := conn.QueryContext(ctx, selectOrgs+` ORDER BY o.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	orgs := []PlatformOrg{}
+	for rows.Next() {
+		org, err := scanOrg(rows)
+		if err != nil {
+			return nil, err
+		}
+		orgs = append(orgs, *org)
+	}
+	return orgs, rows.Err()
+}
+
+func (api *API) getOrg(ctx context.Context, id string) (*PlatformOrg, error) {
+	conn, err := api.dbConn()
+	if err != nil {
+		return nil, err
+	}
+	org, err := scanOrg(conn.QueryRowContext(ctx, selectOrgs+` WHERE o.id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, tools.ErrOrgNotFound
+	}
+	return org, err
+}
+
+const selectOrgs = `
+	SELECT o.id, o.name, o.max_definitions, o.max_databases, o.created_at,
+	       (SELECT COUNT(*) FROM atombase_definition_orgs d WHERE d.org_id = o.id),
+	       (SELECT COUNT(*) FROM atombase_databases db JOIN atombase_definition_orgs d ON d.definition_id = db.definition_id WHERE d.org_id = o.id)
+	FROM atombase_platform_orgs o`
+
+func scanOrg(row interface{ Scan(...any) error }) (*PlatformOrg, error) {
+	var org PlatformOrg
+	var createdAt string
+	if err := row.Scan(&org.ID, &org.Name, &org.MaxDefinitions, &org.MaxDatabases, &createdAt, &org.Definitions, &org.Databases); err != nil {
+		return nil, err
+	}
+	org.CreatedAt = mustParseTime(createdAt)
+	return &org, nil
+}
+
+// updateOrg renames an org or changes its quotas. Lowering a quota below the
+// org's usage only stops new creations.
+func (api *API) updateOrg(ctx context.Context, id string, req UpdateOrgRequest) (*PlatformOrg, error) {
+	org, err := api.getOrg(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if req.Name != nil {
+		if org.Name = strings.TrimSpace(*req.Name); org.Name == "" {
+			return nil, tools.InvalidRequestErr("name cannot be empty")
+		}
+	}
+	if req.MaxDefinitions != nil {
+		org.MaxDefinitions = *req.MaxDefinitions
+	}
+	if req.MaxDatabases != nil {
+		org.MaxDatabases = *req.MaxDatabases
+	}
+	if org.MaxDefinitions < 0 || org.MaxDatabases < 0 {
+		return nil, tools.InvalidRequestErr("quotas cannot be negative")
+	}
+	conn, err := api.dbConn()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.ExecContext(ctx, `
+		UPDATE atombase_platform_orgs SET name = ?, max_definitions = ?, max_databases = ? WHERE id = ?
+	`, org.Name, org.MaxDefinitions, org.MaxDatabases, id); err != nil {
+		if isUniqueConstraintError(err) {
+			return nil, tools.ErrOrgExists
+		}
+		return nil, err
+	}
+	if err := api.recordAudit(ctx, auditOrgUpdated, "org:"+id, req); err != nil {
+		return nil, err
+	}
+	return org, nil
+}
+
+// deleteOrg removes an org that owns no definitions, with its members and
+// invitations, and revokes its keys and service accounts.
+func (api *API) deleteOrg(ctx context.Context, id string) error {
+	org, err := api.getOrg(ctx, id)
+	if err != nil {
+		return err
+	}
+	if org.Definitions > 0 {
+		return fmt.Errorf("%w: %s owns %d", tools.ErrOrgNotEmpty, id, org.Definitions)
+	}
+	conn, err := api.dbConn()
+	if err != nil {
+		return err
+	}
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, query := range []string{
+		`DELETE FROM atombase_api_keys WHERE id IN (SELECT key_id FROM atombase_api_key_orgs WHERE org_id = ?)`,
+		`DELETE FROM atombase_api_key_orgs WHERE org_id = ?`,
+		`DELETE FROM atombase_platform_org_members WHERE org_id = ?`,
+		`DELETE FROM atombase_platform_org_invitations WHERE org_id = ?`,
+		`DELETE FROM atombase_service_accounts WHERE org_id = ?`,
+		`DELETE FROM atombase_platform_orgs WHERE id = ?`,
+	} {
+		if _, err := tx.ExecContext(ctx, query, id); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return api.recordAudit(ctx, auditOrgDeleted, "org:"+id, map[string]string{})
+}
+
+// orgMux registers platform routes behind orgGuard.
+type orgMux struct {
+	api *API
+	mux *http.ServeMux
+}
+
+func (m orgMux) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	m.mux.HandleFunc(pattern, m.api.orgGuard(handler))
+}
+
+// orgGuard keeps callers with an org key inside their org. Definitions,
+// databases and migrations named in the path must belong to it; listings
+// and creations filter and assign the org themselves; deployment-wide routes
+// are refused. The key's role must then allow the request.
+func (api *API) orgGuard(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if org := callerOrg(r.Context()); org != "" {
+			if err := api.authorizeOrgRoute(r, org); err != nil {
+				tools.RespErr(w, err)
+				return
+			}
+			if err := authorizeOrgRole(r, callerRole(r.Context())); err != nil {
+				tools.RespErr(w, err)
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+// authorizeOrgRole checks role against the least role a request needs:
+// viewer to read, admin to manage keys, service accounts, members and
+// invitations, and developer for any other change.
+func authorizeOrgRole(r *http.Request, role string) error {
+	needed := tools.OrgRoleDeveloper
+	switch {
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		needed = tools.OrgRoleViewer
+	case r.URL.Path == "/platform/keys", strings.HasPrefix(r.URL.Path, "/platform/keys/"),
+		r.URL.Path == "/platform/service-accounts", strings.HasPrefix(r.URL.Path, "/platform/service-accounts/"),
+		strings.HasPrefix(r.URL.Path, "/platform/orgs/"):
+		needed = tools.OrgRoleAdmin
+	}
+	if !roleAtLeast(role, needed) {
+		return fmt.Errorf("%w: %s %s needs the %s role, the key is %s", tools.ErrAPIKeyScope, r.Method, r.URL.Path, needed, role)
+	}
+	return nil
+}
+
+func (api *API) authorizeOrgRoute(r *http.Request, org string) error {
+	ctx, path := r.Context(), r.URL.Path
+	switch {
+	case path == "/platform/databases/adopt":
+		break // Adoption takes any database of the Turso organization by name
+	case path == "/platform/definitions", path == "/platform/databases",
+		path == "/platform/keys", strings.HasPrefix(path, "/platform/keys/"),
+		path == "/platform/service-accounts", strings.HasPrefix(path, "/platform/service-accounts/"):
+		return nil
+	case strings.HasPrefix(path, "/platform/definitions/"):
+		_, err := api.getDefinition(ctx, r.PathValue("name"))
+		return err
+	case strings.HasPrefix(path, "/platform/databases/"):
+		_, err := api.getDatabase(ctx, r.PathValue("id"))
+		return err
+	case strings.HasPrefix(path, "/platform/migrations/"):
+		return api.checkMigrationOrg(ctx, r.PathValue("id"), org)
+	case strings.HasPrefix(path, "/platform/orgs/") && r.PathValue("id") == org:
+		if path == "/platform/orgs/"+org && r.Method != http.MethodGet {
+			break // Renaming, quotas and deletion are the deployment's
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: %s %s is not available to organization keys", tools.ErrAPIKeyScope, r.Method, path)
+}
+
+func (api *API) checkMigrationOrg(ctx context.Context, id, org string) error {
+	conn, err := api.dbConn()
+	if err != nil {
+		return err
+	}
+	var owned int
+	if err := conn.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM atombase_migrations m
+		JOIN atombase_definition_orgs o ON o.definition_id = m.definition_id
+		WHERE m.id = ? AND o.org_id = ?
+	`, id, org).Scan(&owned); err != nil {
+		return err
+	}
+	if owned == 0 {
+		return tools.ErrMigrationNotFound
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package platform
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/atombasedev/atombase/tools"
+)
+
+func TestPlatformOrgs(t *testing.T) {
+	api, db := setupPlatformAPI(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	if _, err := api.createOrg(ctx, CreateOrgRequest{ID: "acme", Name: "Acme", MaxDefinitions: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := api.createOrg(ctx, CreateOrgRequest{ID: "globex", Name: "Globex"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := api.createOrg(ctx, CreateOrgRequest{ID: "acme", Name: "Acme again"}); !errors.Is(err, tools.ErrOrgExists) {
+		t.Fatalf("expected a duplicate org to be refused, got %v", err)
+	}
+	if _, err := api.createDefinition(ctx, CreateDefinitionRequest{Name: "internal", Type: "global", Schema: postsSchema()}); err != nil {
+		t.Fatal(err)
+	}
+	acmeKey, err := api.createAPIKey(ctx, CreateAPIKeyRequest{Name: "acme admin", Org: "acme", Verbs: []string{tools.VerbAdmin}})
+	if err != nil || acmeKey.Org != "acme" {
+		t.Fatalf("expected an acme key, got %#v, %v", acmeKey, err)
+	}
+
+	mux := http.NewServeMux()
+	api.RegisterRoutes(mux)
+	handler := tools.ScopedAuthMiddleware(api.store.LookupAPIKey)(mux)
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+acmeKey.Key)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	definition := func(name string) string {
+		return `{"name": "` + name + `", "type": "global",
+			"schema": {"tables": [{"name": "posts", "pk": ["id"], "columns": {"id": {"name": "id", "type": "INTEGER"}}}]},
+			"access": {"posts": {"select": {"field": "auth.status", "op": "eq", "value": "anonymous"}}}}`
+	}
+
+	if rec := do(http.MethodPost, "/platform/definitions", definition("shop")); rec.Code != http.StatusCreated || !strings.Contains(rec.Body.String(), `"org":"acme"`) {
+		t.Fatalf("expected the definition to be created for acme, got %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := do(http.MethodPost, "/platform/definitions", definition("blog")); rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "organization acme") {
+		t.Fatalf("expected the org quota to be enforced, got %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := do(http.MethodGet, "/platform/definitions", ""); rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), "internal") || !strings.Contains(rec.Body.String(), "shop") {
+		t.Fatalf("expected only acme definitions, got %d %s", rec.Code, rec.Body.String())
+	}
+	for _, path := range []string{"/platform/definitions/internal", "/platform/definitions/internal/history"} {
+		if rec := do(http.MethodGet, path, ""); rec.Code != http.StatusNotFound {
+			t.Fatalf("expected %s to be hidden, got %d %s", path, rec.Code, rec.Body.String())
+		}
+	}
+	for _, path := range []string{"/platform/audit", "/platform/orgs", "/platform/orgs/globex"} {
+		if rec := do(http.MethodGet, path, ""); rec.Code != http.StatusForbidden {
+			t.Fatalf("expected %s to be refused, got %d %s", path, rec.Code, rec.Body.String())
+		}
+	}
+	if rec := do(http.MethodGet, "/platform/orgs/acme", ""); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"definitions":1`) {
+		t.Fatalf("expected acme to read its own usage, got %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := do(http.MethodPost, "/platform/databases/adopt", `{"id": "globex-db", "definition": "shop"}`); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected adoption to be refused to org keys, got %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := do(http.MethodPost, "/platform/keys", `{"name": "sneaky", "org": "globex", "verbs": ["admin"]}`); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected a key for another org to be refused, got %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := do(http.MethodPost, "/platform/keys", `{"name": "reader", "verbs": ["read"]}`); rec.Code != http.StatusCreated || !strings.Contains(rec.Body.String(), `"org":"acme"`) {
+		t.Fatalf("expected the new key to inherit the org, got %d %s", rec.Code, rec.Body.String())
+	}
+	if keys, err := api.listAPIKeys(ctx); err != nil || len(keys) != 2 {
+		t.Fatalf("expected the service key to see both keys, got %v, %v", keys, err)
+	}
+
+	if err := api.deleteOrg(ctx, "acme"); !errors.Is(err, tools.ErrOrgNotEmpty) {
+		t.Fatalf("expected an org with definitions to be kept, got %v", err)
+	}
+	globexKey, err := api.createAPIKey(ctx, CreateAPIKeyRequest{Name: "globex admin", Org: "globex", Verbs: []string{tools.VerbAdmin}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := api.deleteOrg(ctx, "globex"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := api.store.LookupAPIKey(ctx, globexKey.ID, strings.TrimPrefix(globexKey.Key, tools.APIKeyPrefix+globexKey.ID+".")); !errors.Is(err, tools.ErrAPIKeyNotFound) {
+		t.Fatalf("expected deleting the org to revoke its keys, got %v", err)
+	}
+}
+
+func postsSchema() Schema {
+	return Schema{Tables: []Table{{Name: "posts", Pk: []string{"id"}, Columns: map[string]Col{"id": {Name: "id", Type: "INTEGER"}}}}}
+}
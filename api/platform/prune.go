@@ -0,0 +1,198 @@
+package platform
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/atombasedev/atombase/tools"
+)
+
+// pruneDefinitionHistory removes old versions of a definition. The newest keep
+// versions are retained, as is every version a database is still on or a failed
+// migration starts from. Migrations are compacted so each retained version has a
+// single migration from the retained version before it.
+func (api *API) pruneDefinitionHistory(ctx context.Context, name string, keep int) (*PruneHistoryResponse, error) {
+	if keep < 1 {
+		return nil, tools.InvalidRequestErr("keep must be at least 1")
+	}
+	def, err := api.getDefinition(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := api.dbConn()
+	if err != nil {
+		return nil, err
+	}
+
+	versions, err := queryVersions(ctx, conn, `
+		SELECT version FROM atombase_definitions_history
+		WHERE definition_id = ?
+		ORDER BY version ASC
+	`, def.ID)
+	if err != nil {
+		return nil, err
+	}
+	referenced, err := queryVersions(ctx, conn, `
+		SELECT definition_version FROM atombase_databases WHERE definition_id = ?
+		UNION
+		SELECT f.from_version FROM atombase_migration_failures f
+		JOIN atombase_databases d ON d.id = f.database_id
+		WHERE d.definition_id = ?
+	`, def.ID, def.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	retain := make(map[int]bool, keep+len(referenced))
+	for i := len(versions) - 1; i >= 0 && len(versions)-i <= keep; i-- {
+		retain[versions[i]] = true
+	}
+	for _, version := range referenced {
+		retain[version] = true
+	}
+	retain[def.CurrentVersion] = true
+
+	resp := &PruneHistoryResponse{Definition: def.Name, Kept: []int{}, Pruned: []int{}}
+	for _, version := range versions {
+		if retain[version] {
+			resp.Kept = append(resp.Kept, version)
+		} else {
+			resp.Pruned = append(resp.Pruned, version)
+		}
+	}
+	if len(resp.Pruned) == 0 {
+		return resp, nil
+	}
+
+	steps, err := api.loadMigrationSteps(ctx, def.ID)
+	if err != nil {
+		return nil, err
+	}
+	compacted := compactMigrationChain(steps, resp.Kept)
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	for _, version := range resp.Pruned {
+		if err := deleteDefinitionVersionTx(ctx, tx, def.ID, version); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `
+		DELETE FROM atombase_migration_windows
+		WHERE migration_id IN (SELECT id FROM atombase_migrations WHERE definition_id = ?)
+	`, def.ID); err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM atombase_migrations WHERE definition_id = ?`, def.ID); err != nil {
+		return nil, err
+	}
+	for _, step := range compacted {
+		migration, err := createMigrationTx(ctx, tx, def.ID, step.FromVersion, step.ToVersion, step.SQL)
+		if err != nil {
+			return nil, err
+		}
+		if err := saveMigrationWindows(ctx, tx, migration.ID, step.Windows); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE atombase_definitions SET updated_at = ? WHERE id = ?
+	`, now, def.ID); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// compactMigrationChain merges consecutive migration steps so that each retained
+// version after the first is reached by one migration from the previous retained
+// version. Steps below the oldest retained version are dropped, and merged steps
+// without SQL are omitted just like version bumps that do not change the schema.
+// A merged step keeps the windows of the newest step that had any.
+func compactMigrationChain(steps []Migration, retained []int) []Migration {
+	sort.Ints(retained)
+	var compacted []Migration
+	for i := 1; i < len(retained); i++ {
+		from, to := retained[i-1], retained[i]
+		var statements []string
+		var windows []MigrationWindow
+		for _, step := range steps {
+			if step.FromVersion >= from && step.ToVersion <= to {
+				statements = append(statements, step.SQL...)
+				if len(step.Windows) > 0 {
+					windows = step.Windows
+				}
+			}
+		}
+		if len(statements) > 0 {
+			compacted = append(compacted, Migration{FromVersion: from, ToVersion: to, SQL: statements, Windows: windows})
+		}
+	}
+	return compacted
+}
+
+func (api *API) loadMigrationSteps(ctx context.Context, definitionID int32) ([]Migration, error) {
+	conn, err := api.dbConn()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := conn.QueryContext(ctx, `
+		SELECT m.from_version, m.to_version, m.sql, w.windows_json
+		FROM atombase_migrations m
+		LEFT JOIN atombase_migration_windows w ON w.migration_id = m.id
+		WHERE m.definition_id = ?
+		ORDER BY m.from_version ASC
+	`, definitionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var steps []Migration
+	for rows.Next() {
+		step := Migration{DefinitionID: definitionID}
+		var sqlJSON string
+		var windowsJSON sql.NullString
+		if err := rows.Scan(&step.FromVersion, &step.ToVersion, &sqlJSON, &windowsJSON); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(sqlJSON), &step.SQL); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal SQL: %w", err)
+		}
+		if windowsJSON.Valid {
+			if err := json.Unmarshal([]byte(windowsJSON.String), &step.Windows); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal windows: %w", err)
+			}
+		}
+		steps = append(steps, step)
+	}
+	return steps, rows.Err()
+}
+
+func queryVersions(ctx context.Context, conn *sql.DB, query string, args ...any) ([]int, error) {
+	rows, err := conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var versions []int
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		versions = append(versions, version)
+	}
+	return versions, rows.Err()
+}
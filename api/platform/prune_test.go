@@ -0,0 +1,73 @@
+package platform
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestPruneDefinitionHistory_KeepsReferencedVersionsAndCompactsChain(t *testing.T) {
+	api, db := setupPlatformAPI(t)
+	defer db.Close()
+
+	columns := map[string]Col{"id": {Name: "id", Type: "INTEGER"}}
+	schema := func() Schema {
+		cols := make(map[string]Col, len(columns))
+		for k, v := range columns {
+			cols[k] = v
+		}
+		return Schema{Tables: []Table{{Name: "posts", Pk: []string{"id"}, Columns: cols}}}
+	}
+	created, err := api.createDefinition(context.Background(), CreateDefinitionRequest{Name: "posts", Type: "global", Schema: schema()})
+	if err != nil {
+		t.Fatalf("createDefinition failed: %v", err)
+	}
+	for _, name := range []string{"title", "body", "slug"} {
+		columns[name] = Col{Name: name, Type: "TEXT"}
+		if _, err := api.pushDefinition(context.Background(), "posts", PushDefinitionRequest{Schema: schema()}); err != nil {
+			t.Fatalf("pushDefinition failed: %v", err)
+		}
+	}
+	if _, err := db.Exec(`
+		INSERT INTO atombase_databases (id, definition_id, definition_version, created_at, updated_at)
+		VALUES ('posts-db', ?, 2, '2026-01-01T00:00:00Z', '2026-01-01T00:00:00Z')
+	`, created.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := api.pruneDefinitionHistory(context.Background(), "posts", 1)
+	if err != nil {
+		t.Fatalf("pruneDefinitionHistory failed: %v", err)
+	}
+	if !reflect.DeepEqual(resp.Kept, []int{2, 4}) || !reflect.DeepEqual(resp.Pruned, []int{1, 3}) {
+		t.Fatalf("unexpected prune result: %+v", resp)
+	}
+
+	steps, err := api.loadMigrationSteps(context.Background(), created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(steps) != 1 || steps[0].FromVersion != 2 || steps[0].ToVersion != 4 || len(steps[0].SQL) != 2 {
+		t.Fatalf("expected one compacted 2->4 migration, got %+v", steps)
+	}
+	if _, err := api.loadDefinitionSchema(context.Background(), created.ID, 3); err == nil {
+		t.Fatal("expected version 3 to be removed")
+	}
+
+	export, err := api.exportDefinitionMigrations(context.Background(), "posts", "")
+	if err != nil {
+		t.Fatalf("export after prune failed: %v", err)
+	}
+	if len(export.Files) != 2 || export.Files[0].Version != 2 || export.Files[1].Version != 4 {
+		t.Fatalf("unexpected export after prune: %+v", export.Files)
+	}
+}
+
+func TestPruneDefinitionHistory_RejectsInvalidKeep(t *testing.T) {
+	api, db := setupPlatformAPI(t)
+	defer db.Close()
+
+	if _, err := api.pruneDefinitionHistory(context.Background(), "posts", 0); err == nil {
+		t.Fatal("expected keep=0 to be rejected")
+	}
+}
@@ -0,0 +1,71 @@
+package platform
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/atombasedev/atombase/config"
+	"github.com/atombasedev/atombase/tools"
+)
+
+// checkDefinitionQuota refuses a new definition once the deployment holds
+// ATOMICBASE_MAX_DEFINITIONS of them, or org, when set, its maxDefinitions.
+func (api *API) checkDefinitionQuota(ctx context.Context, org string) error {
+	if err := api.checkQuota(ctx, "definitions", "the deployment", config.Cfg.MaxDefinitions, `SELECT COUNT(*) FROM `+TableDefinitions); err != nil {
+		return err
+	}
+	if org == "" {
+		return nil
+	}
+	limits, err := api.getOrg(ctx, org)
+	if err != nil {
+		return err
+	}
+	return api.checkQuota(ctx, "definitions", "organization "+org, limits.MaxDefinitions, `
+		SELECT COUNT(*) FROM atombase_definition_orgs WHERE org_id = ?
+	`, org)
+}
+
+// checkDatabaseQuota refuses a new database once the deployment holds
+// ATOMICBASE_MAX_DATABASES of them, or org, when set, its maxDatabases.
+func (api *API) checkDatabaseQuota(ctx context.Context, org string) error {
+	if err := api.checkQuota(ctx, "databases", "the deployment", config.Cfg.MaxDatabases, `SELECT COUNT(*) FROM `+TableDatabases); err != nil {
+		return err
+	}
+	if org == "" {
+		return nil
+	}
+	limits, err := api.getOrg(ctx, org)
+	if err != nil {
+		return err
+	}
+	return api.checkQuota(ctx, "databases", "organization "+org, limits.MaxDatabases, `
+		SELECT COUNT(*) FROM atombase_databases d
+		JOIN atombase_definition_orgs o ON o.definition_id = d.definition_id
+		WHERE o.org_id = ?
+	`, org)
+}
+
+// checkQuota runs the count query against limit, 0 meaning unlimited.
+// Quotas are soft: creations running at once can each pass the check. An
+// admin key with the override_quotas verb skips it.
+func (api *API) checkQuota(ctx context.Context, kind, owner string, limit int, countQuery string, args ...any) error {
+	if limit <= 0 {
+		return nil
+	}
+	if scope := tools.GetAuthContext(ctx).Scope; scope != nil && scope.OverridesQuotas() {
+		return nil
+	}
+	conn, err := api.dbConn()
+	if err != nil {
+		return err
+	}
+	var count int
+	if err := conn.QueryRowContext(ctx, countQuery, args...).Scan(&count); err != nil {
+		return err
+	}
+	if count >= limit {
+		return fmt.Errorf("%w: %s already has %d of its %d %s", tools.ErrQuotaExceeded, owner, count, limit, kind)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package platform
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/atombasedev/atombase/config"
+	"github.com/atombasedev/atombase/tools"
+)
+
+func TestQuotas(t *testing.T) {
+	api, db := setupPlatformAPI(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	oldDefinitions, oldDatabases := config.Cfg.MaxDefinitions, config.Cfg.MaxDatabases
+	defer func() { config.Cfg.MaxDefinitions, config.Cfg.MaxDatabases = oldDefinitions, oldDatabases }()
+	config.Cfg.MaxDefinitions, config.Cfg.MaxDatabases = 1, 1
+
+	definition := func(name string) CreateDefinitionRequest {
+		return CreateDefinitionRequest{
+			Name:   name,
+			Type:   "global",
+			Schema: Schema{Tables: []Table{{Name: "posts", Pk: []string{"id"}, Columns: map[string]Col{"id": {Name: "id", Type: "INTEGER"}}}}},
+			Access: map[string]OperationPolicy{"posts": {Select: &Condition{Field: "auth.status", Op: "eq", Value: "anonymous"}}},
+		}
+	}
+	if _, err := api.createDefinition(ctx, definition("first")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := api.createDefinition(ctx, definition("second")); !errors.Is(err, tools.ErrQuotaExceeded) {
+		t.Fatalf("expected the definition quota to be enforced, got %v", err)
+	}
+
+	// Over HTTP, only an admin key with the override verb gets past it.
+	mux := http.NewServeMux()
+	api.RegisterRoutes(mux)
+	handler := tools.ScopedAuthMiddleware(api.store.LookupAPIKey)(mux)
+	create := func(verbs []string, name string) *httptest.ResponseRecorder {
+		key, err := api.createAPIKey(ctx, CreateAPIKeyRequest{Name: name, Verbs: verbs})
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/platform/definitions", strings.NewReader(`{"name": "`+name+`", "type": "global",
+			"schema": {"tables": [{"name": "posts", "pk": ["id"], "columns": {"id": {"name": "id", "type": "INTEGER"}}}]},
+			"access": {"posts": {"select": {"field": "auth.status", "op": "eq", "value": "anonymous"}}}}`))
+		req.Header.Set("Authorization", "Bearer "+key.Key)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := create([]string{tools.VerbAdmin}, "plain"); rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), tools.CodeQuotaExceeded) {
+		t.Fatalf("expected an admin key to hit the quota, got %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := create([]string{tools.VerbAdmin, tools.VerbOverrideQuotas}, "override"); rec.Code != http.StatusCreated {
+		t.Fatalf("expected the override key to pass the quota, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	oldCreate, oldToken, oldBatch := createTenantDatabaseFn, createTenantTokenFn, batchExecuteWithTokenFn
+	defer func() { createTenantDatabaseFn, createTenantTokenFn, batchExecuteWithTokenFn = oldCreate, oldToken, oldBatch }()
+	createTenantDatabaseFn = func(ctx context.Context, name, group string) error { return nil }
+	createTenantTokenFn = func(ctx context.Context, name string) (string, error) { return "token", nil }
+	batchExecuteWithTokenFn = func(ctx context.Context, dbName, token string, statements []string) error { return nil }
+
+	if _, err := api.createDatabase(ctx, CreateDatabaseRequest{ID: "first-db", Definition: "first"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := api.createDatabase(ctx, CreateDatabaseRequest{ID: "second-db", Definition: "first"}); !errors.Is(err, tools.ErrQuotaExceeded) {
+		t.Fatalf("expected the database quota to be enforced, got %v", err)
+	}
+	config.Cfg.MaxDatabases = 0
+	if _, err := api.createDatabase(ctx, CreateDatabaseRequest{ID: "second-db", Definition: "first"}); err != nil {
+		t.Fatalf("expected 0 to lift the quota, got %v", err)
+	}
+}
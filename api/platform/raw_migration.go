@@ -0,0 +1,196 @@
+package platform
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/atombasedev/atombase/definitions"
+	"github.com/atombasedev/atombase/tools"
+)
+
+// Statements that would break the batch transaction migrations run in.
+var rawMigrationForbidden = map[string]bool{
+	"BEGIN":     true,
+	"COMMIT":    true,
+	"END":       true,
+	"ROLLBACK":  true,
+	"SAVEPOINT": true,
+	"RELEASE":   true,
+	"ATTACH":    true,
+	"DETACH":    true,
+	"PRAGMA":    true,
+	"VACUUM":    true,
+}
+
+// migrateDefinitionSQL publishes a new definition version from hand-written SQL.
+// The SQL is applied to a scratch database built from the current schema and the
+// resulting schema is introspected back so the stored definition stays accurate.
+// Policies and tests that are omitted from the request carry over from the current version.
+func (api *API) migrateDefinitionSQL(ctx context.Context, name string, req MigrateDefinitionRequest) (*DefinitionVersion, error) {
+	statements, err := normalizeRawMigrationSQL(req.SQL)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateMigrationWindows(req.Windows); err != nil {
+		return nil, err
+	}
+	current, err := api.getDefinition(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	var currentSchema Schema
+	if err := tools.DecodeSchema(current.Schema, &currentSchema); err != nil {
+		return nil, err
+	}
+
+	newSchema, err := introspectMigratedSchema(ctx, currentSchema, statements)
+	if err != nil {
+		return nil, tools.InvalidMigrationErr(err.Error())
+	}
+	if len(newSchema.Tables) == 0 {
+		return nil, tools.InvalidMigrationErr("migration leaves the schema without tables")
+	}
+	if err := resolveViews(&newSchema); err != nil {
+		return nil, tools.InvalidMigrationErr(err.Error())
+	}
+	newSchema.Settings = currentSchema.Settings
+	if err := validateAPISettings(newSchema); err != nil {
+		return nil, tools.InvalidMigrationErr(err.Error())
+	}
+	validationResult, err := ValidateMigrationPlan(ctx, newSchema, nil)
+	if err != nil {
+		return nil, err
+	}
+	if !validationResult.Valid {
+		return nil, tools.InvalidMigrationErr(validationResult.Errors[0].Message)
+	}
+
+	tables := schemaTableSet(newSchema)
+	var accessRows []definitions.AccessPolicy
+	if req.Access != nil {
+		accessRows, err = definitions.ParseAndValidateAccess(current.Type, req.Access, tables)
+		if err != nil {
+			return nil, tools.InvalidRequestErr(err.Error())
+		}
+	} else {
+		accessRows, err = api.loadAccessPolicies(ctx, current.ID, current.CurrentVersion)
+		if err != nil {
+			return nil, err
+		}
+		kept := accessRows[:0]
+		for _, row := range accessRows {
+			if _, ok := tables[row.Table]; ok || definitions.IsStorageAccess(row.Table) {
+				kept = append(kept, row)
+			}
+		}
+		accessRows = kept
+	}
+	management := req.Management
+	if management == nil {
+		management = current.Management
+	}
+	managementRows, err := definitions.ParseAndValidateManagement(current.Type, current.Roles, management)
+	if err != nil {
+		return nil, tools.InvalidRequestErr(err.Error())
+	}
+	provision := req.Provision
+	if provision == nil {
+		provision = current.Provision
+	}
+	provisionPolicy, err := definitions.ParseAndValidateProvision(current.Type, provision)
+	if err != nil {
+		return nil, tools.InvalidRequestErr(err.Error())
+	}
+	tests := req.Tests
+	if tests == nil {
+		tests, err = api.loadDefinitionTests(ctx, current.ID, current.CurrentVersion)
+		if err != nil {
+			return nil, err
+		}
+	}
+	tests, err = definitions.ParseAndValidateTests(tests)
+	if err != nil {
+		return nil, tools.InvalidRequestErr(err.Error())
+	}
+	if err := validateDefinitionTests(ctx, newSchema, tests); err != nil {
+		return nil, tools.InvalidRequestErr(err.Error())
+	}
+
+	return api.publishDefinitionVersion(ctx, current, newSchema, statements, accessRows, managementRows, provision, provisionPolicy, tests, req.Windows)
+}
+
+func normalizeRawMigrationSQL(raw []string) ([]string, error) {
+	statements := make([]string, 0, len(raw))
+	for _, stmt := range raw {
+		stmt = strings.TrimSpace(stmt)
+		stmt = strings.TrimSpace(strings.TrimSuffix(stmt, ";"))
+		if stmt == "" {
+			continue
+		}
+		keyword := strings.ToUpper(strings.Fields(stmt)[0])
+		if rawMigrationForbidden[keyword] {
+			return nil, tools.InvalidMigrationErr(fmt.Sprintf("%s statements are not allowed in migrations", keyword))
+		}
+		statements = append(statements, stmt)
+	}
+	if len(statements) == 0 {
+		return nil, tools.InvalidRequestErr("sql is required")
+	}
+	return statements, nil
+}
+
+// introspectMigratedSchema applies statements to a scratch copy of schema and
+// returns the schema they produce.
+func introspectMigratedSchema(ctx context.Context, schema Schema, statements []string) (Schema, error) {
+	scratch, err := buildMigrationProbeDB(schema)
+	if err != nil {
+		return Schema{}, fmt.Errorf("failed to build scratch database: %w", err)
+	}
+	defer scratch.Close()
+	for _, stmt := range statements {
+		if _, err := scratch.ExecContext(ctx, stmt); err != nil {
+			return Schema{}, fmt.Errorf("scratch migration failed for %q: %w", stmt, err)
+		}
+	}
+	actual, err := introspectSchema(ctx, scratch)
+	if err != nil {
+		return Schema{}, err
+	}
+	return alignIntrospectedSchema(actual, schema), nil
+}
+
+func (api *API) loadAccessPolicies(ctx context.Context, definitionID int32, version int) ([]definitions.AccessPolicy, error) {
+	conn, err := api.dbConn()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := conn.QueryContext(ctx, `
+		SELECT table_name, operation, conditions_json
+		FROM atombase_access_policies
+		WHERE definition_id = ? AND version = ?
+		ORDER BY table_name, operation
+	`, definitionID, version)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []definitions.AccessPolicy
+	for rows.Next() {
+		item := definitions.AccessPolicy{DefinitionID: definitionID, Version: version}
+		var raw sql.NullString
+		if err := rows.Scan(&item.Table, &item.Operation, &raw); err != nil {
+			return nil, err
+		}
+		if raw.Valid && strings.TrimSpace(raw.String) != "" {
+			item.Condition, err = definitions.DecodeCondition(raw.String)
+			if err != nil {
+				return nil, err
+			}
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
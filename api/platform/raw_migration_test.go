@@ -0,0 +1,85 @@
+package platform
+
+import (
+	"context"
+	"testing"
+)
+
+func TestMigrateDefinitionSQL(t *testing.T) {
+	api, db := setupPlatformAPI(t)
+	defer db.Close()
+
+	v1 := Schema{Tables: []Table{{Name: "notes", Pk: []string{"id"}, Columns: map[string]Col{
+		"id":   {Name: "id", Type: "INTEGER"},
+		"body": {Name: "body", Type: "TEXT"},
+	}}}}
+	if _, err := api.createDefinition(context.Background(), CreateDefinitionRequest{
+		Name:   "notes",
+		Type:   "global",
+		Schema: v1,
+		Access: map[string]OperationPolicy{"notes": {Select: &Condition{Field: "auth.status", Op: "eq", Value: "authenticated"}}},
+	}); err != nil {
+		t.Fatalf("createDefinition failed: %v", err)
+	}
+
+	version, err := api.migrateDefinitionSQL(context.Background(), "notes", MigrateDefinitionRequest{SQL: []string{
+		"ALTER TABLE notes ADD COLUMN pinned INTEGER NOT NULL DEFAULT 0;",
+		"CREATE TABLE tags (id INTEGER PRIMARY KEY, note_id INTEGER REFERENCES notes(id) ON DELETE CASCADE, label TEXT NOT NULL)",
+		"UPDATE notes SET pinned = 1 WHERE body LIKE '!%'",
+	}})
+	if err != nil {
+		t.Fatalf("migrateDefinitionSQL failed: %v", err)
+	}
+	if version.Version != 2 {
+		t.Fatalf("expected version 2, got %d", version.Version)
+	}
+	notes, tags := version.Schema.Tables[0], version.Schema.Tables[1]
+	if notes.Name != "notes" || tags.Name != "tags" {
+		t.Fatalf("unexpected tables: %+v", version.Schema.Tables)
+	}
+	if col := notes.Columns["pinned"]; col.Type != "INTEGER" || !col.NotNull {
+		t.Fatalf("expected introspected pinned column, got %+v", col)
+	}
+	if notes.Columns["body"].Type != "TEXT" {
+		t.Fatalf("expected body type to be kept, got %+v", notes.Columns["body"])
+	}
+	if col := tags.Columns["note_id"]; col.References != "notes.id" || col.OnDelete != "CASCADE" {
+		t.Fatalf("expected introspected foreign key, got %+v", col)
+	}
+
+	statements, err := api.getMigrationSQL(context.Background(), 1, 1, 2)
+	if err != nil || len(statements) != 3 {
+		t.Fatalf("expected raw SQL to be stored, got %v (%v)", statements, err)
+	}
+	access, err := api.loadAccessPolicies(context.Background(), 1, 2)
+	if err != nil || len(access) != 1 || access[0].Table != "notes" {
+		t.Fatalf("expected access policies to carry over, got %+v (%v)", access, err)
+	}
+}
+
+func TestMigrateDefinitionSQL_RejectsInvalidSQL(t *testing.T) {
+	api, db := setupPlatformAPI(t)
+	defer db.Close()
+
+	schema := Schema{Tables: []Table{{Name: "notes", Pk: []string{"id"}, Columns: map[string]Col{
+		"id": {Name: "id", Type: "INTEGER"},
+	}}}}
+	if _, err := api.createDefinition(context.Background(), CreateDefinitionRequest{Name: "notes", Type: "global", Schema: schema}); err != nil {
+		t.Fatalf("createDefinition failed: %v", err)
+	}
+
+	tests := map[string][]string{
+		"empty":       {"  ", ";"},
+		"transaction": {"BEGIN", "ALTER TABLE notes ADD COLUMN body TEXT"},
+		"pragma":      {"PRAGMA foreign_keys = OFF"},
+		"unknown":     {"ALTER TABLE missing ADD COLUMN body TEXT"},
+		"no tables":   {"DROP TABLE notes"},
+	}
+	for name, sql := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := api.migrateDefinitionSQL(context.Background(), "notes", MigrateDefinitionRequest{SQL: sql}); err == nil {
+				t.Fatal("expected migration to be rejected")
+			}
+		})
+	}
+}
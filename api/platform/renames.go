@@ -0,0 +1,215 @@
+package platform
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// applyColumnRenames returns oldSchema as it looks after the rename
+// statements run. SQLite's RENAME COLUMN rewrites indexes, generated column
+// and CHECK expressions and foreign keys pointing at the column, so those
+// follow the new name. FTS5 tables keep their column names and have to be
+// rebuilt; the tables needing it are returned.
+func applyColumnRenames(oldSchema Schema, renames []rename) (Schema, map[string]bool) {
+	rebuildFTS := map[string]bool{}
+	tables := make([]Table, len(oldSchema.Tables))
+	for i, table := range oldSchema.Tables {
+		table.Pk = slices.Clone(table.Pk)
+		table.Columns = maps.Clone(table.Columns)
+		table.Indexes = slices.Clone(table.Indexes)
+		table.FTSColumns = slices.Clone(table.FTSColumns)
+		table.GeoColumns = slices.Clone(table.GeoColumns)
+		tables[i] = table
+	}
+
+	for _, r := range renames {
+		if r.Type != "rename_column" {
+			continue
+		}
+		for i := range tables {
+			table := &tables[i]
+			if table.Name == r.Table {
+				if col, ok := table.Columns[r.OldName]; ok {
+					delete(table.Columns, r.OldName)
+					col.Name = r.NewName
+					table.Columns[r.NewName] = col
+				}
+				replaceName(table.Pk, r.OldName, r.NewName)
+				for j := range table.Indexes {
+					table.Indexes[j].Columns = slices.Clone(table.Indexes[j].Columns)
+					replaceName(table.Indexes[j].Columns, r.OldName, r.NewName)
+				}
+				if replaceName(table.FTSColumns, r.OldName, r.NewName) {
+					rebuildFTS[table.Name] = true
+				}
+				// The geo triggers are rewritten along with the table.
+				replaceName(table.GeoColumns, r.OldName, r.NewName)
+				for name, col := range table.Columns {
+					if col.Generated != nil {
+						if expr, ok := renameIdentifier(col.Generated.Expr, r.OldName, r.NewName); ok {
+							col.Generated = &Generated{Expr: expr, Stored: col.Generated.Stored}
+						}
+					}
+					col.Check, _ = renameIdentifier(col.Check, r.OldName, r.NewName)
+					table.Columns[name] = col
+				}
+			}
+			for name, col := range table.Columns {
+				if col.References == r.Table+"."+r.OldName {
+					col.References = r.Table + "." + r.NewName
+					table.Columns[name] = col
+				}
+			}
+		}
+	}
+	oldSchema.Tables = tables
+	return oldSchema, rebuildFTS
+}
+
+// staleRenameReferences lists the objects in newSchema that still use a
+// column's name from before its rename. Pushing them as they are would store
+// a schema that no longer matches the databases.
+func staleRenameReferences(newSchema Schema, renames []rename) []string {
+	var stale []string
+	for _, r := range renames {
+		if r.Type != "rename_column" {
+			continue
+		}
+		// A new column that takes the old name is what references mean now.
+		reused := false
+		for _, table := range newSchema.Tables {
+			if table.Name == r.Table {
+				_, reused = table.Columns[r.OldName]
+			}
+		}
+		if reused {
+			continue
+		}
+		var users []string
+		for _, table := range newSchema.Tables {
+			if table.Name == r.Table {
+				if slices.Contains(table.Pk, r.OldName) {
+					users = append(users, "primary key of "+table.Name)
+				}
+				for _, idx := range table.Indexes {
+					if slices.Contains(idx.Columns, r.OldName) {
+						users = append(users, "index "+idx.Name)
+					}
+				}
+				if slices.Contains(table.FTSColumns, r.OldName) {
+					users = append(users, "full-text columns of "+table.Name)
+				}
+				if slices.Contains(table.GeoColumns, r.OldName) {
+					users = append(users, "geo columns of "+table.Name)
+				}
+				for name, col := range table.Columns {
+					if col.Generated != nil {
+						if _, ok := renameIdentifier(col.Generated.Expr, r.OldName, r.NewName); ok {
+							users = append(users, "generated column "+table.Name+"."+name)
+						}
+					}
+					if _, ok := renameIdentifier(col.Check, r.OldName, r.NewName); ok {
+						users = append(users, "check on "+table.Name+"."+name)
+					}
+				}
+			}
+			for name, col := range table.Columns {
+				if col.References == r.Table+"."+r.OldName {
+					users = append(users, "foreign key "+table.Name+"."+name)
+				}
+			}
+		}
+		if len(users) > 0 {
+			sort.Strings(users)
+			stale = append(stale, fmt.Sprintf("%s (renamed column %s.%s, now %s)", strings.Join(users, ", "), r.Table, r.OldName, r.NewName))
+		}
+	}
+	return stale
+}
+
+func replaceName(names []string, old, new string) bool {
+	replaced := false
+	for i, name := range names {
+		if name == old {
+			names[i] = new
+			replaced = true
+		}
+	}
+	return replaced
+}
+
+// renameIdentifier replaces the identifier old with new in a SQL expression,
+// bare or quoted with brackets, double quotes or backticks. String literals
+// are left alone. It reports whether anything was replaced.
+func renameIdentifier(expr, old, new string) (string, bool) {
+	var out strings.Builder
+	replaced := false
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == '\'':
+			end := i + 1
+			for end < len(expr) {
+				if expr[end] == '\'' {
+					if end+1 < len(expr) && expr[end+1] == '\'' {
+						end += 2
+						continue
+					}
+					break
+				}
+				end++
+			}
+			end = min(end+1, len(expr))
+			out.WriteString(expr[i:end])
+			i = end
+		case c == '[' || c == '"' || c == '`':
+			closer := c
+			if c == '[' {
+				closer = ']'
+			}
+			end := strings.IndexByte(expr[i+1:], closer)
+			if end < 0 {
+				out.WriteString(expr[i:])
+				i = len(expr)
+				continue
+			}
+			name := expr[i+1 : i+1+end]
+			if strings.EqualFold(name, old) {
+				out.WriteByte(c)
+				out.WriteString(new)
+				out.WriteByte(closer)
+				replaced = true
+			} else {
+				out.WriteString(expr[i : i+end+2])
+			}
+			i += end + 2
+		case isIdentByte(c):
+			end := i
+			for end < len(expr) && isIdentByte(expr[end]) {
+				end++
+			}
+			word := expr[i:end]
+			if strings.EqualFold(word, old) && (c < '0' || c > '9') {
+				out.WriteString(new)
+				replaced = true
+			} else {
+				out.WriteString(word)
+			}
+			i = end
+		default:
+			out.WriteByte(c)
+			i++
+		}
+	}
+	if !replaced {
+		return expr, false
+	}
+	return out.String(), true
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c >= 0x80
+}
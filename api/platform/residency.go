@@ -0,0 +1,293 @@
+package platform
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/atombasedev/atombase/config"
+	"github.com/atombasedev/atombase/tools"
+)
+
+// Audit actions recorded for residency.
+const (
+	auditResidencyEvaluated = "residency.evaluated"
+	auditResidencyUpdated   = "residency.updated"
+)
+
+// placement is the Turso group, and the region it serves, a database is created in.
+type placement struct {
+	Group  string
+	Region string
+}
+
+// residencyEvaluation is the audit record of one placement check.
+type residencyEvaluation struct {
+	Operation         string   `json:"operation"`
+	DatabaseID        string   `json:"databaseId"`
+	Group             string   `json:"group,omitempty"`
+	Region            string   `json:"region"`
+	DefinitionRegions []string `json:"definitionRegions,omitempty"`
+	DatabaseRegions   []string `json:"databaseRegions,omitempty"`
+	Allowed           bool     `json:"allowed"`
+	Reason            string   `json:"reason,omitempty"`
+}
+
+// normalizeRegions trims, dedupes and sorts a list of regions. An empty result
+// means no restriction.
+func normalizeRegions(regions []string) ([]string, error) {
+	out := make([]string, 0, len(regions))
+	for _, region := range regions {
+		region = strings.TrimSpace(region)
+		if region == "" || strings.ContainsAny(region, " \t\n,") {
+			return nil, tools.InvalidRequestErr(fmt.Sprintf("invalid region %q", region))
+		}
+		if !slices.Contains(out, region) {
+			out = append(out, region)
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// placementForRegion picks the Turso group to create a database in. Without a
+// requested region the configured default group is used; otherwise the default
+// group if it serves the region, else the first group that does.
+func placementForRegion(region string) (placement, error) {
+	if region == "" {
+		return placement{Group: config.Cfg.TursoGroup, Region: config.Cfg.TursoGroupRegions[config.Cfg.TursoGroup]}, nil
+	}
+	if config.Cfg.TursoGroupRegions[config.Cfg.TursoGroup] == region {
+		return placement{Group: config.Cfg.TursoGroup, Region: region}, nil
+	}
+	groups := make([]string, 0, len(config.Cfg.TursoGroupRegions))
+	for group, groupRegion := range config.Cfg.TursoGroupRegions {
+		if groupRegion == region {
+			groups = append(groups, group)
+		}
+	}
+	if len(groups) == 0 {
+		return placement{}, tools.InvalidRequestErr(fmt.Sprintf("no Turso group is configured for region %s", region))
+	}
+	sort.Strings(groups)
+	return placement{Group: groups[0], Region: region}, nil
+}
+
+// evaluateResidency reports why a region breaks the rules, or "" when every rule
+// allows it. A placement whose region is unknown only passes when there are no rules.
+func evaluateResidency(region string, definitionRegions, databaseRegions []string) string {
+	for _, rule := range []struct {
+		scope   string
+		regions []string
+	}{{"definition", definitionRegions}, {"database", databaseRegions}} {
+		if len(rule.regions) == 0 {
+			continue
+		}
+		if region == "" {
+			return fmt.Sprintf("the region is unknown and the %s only allows %s", rule.scope, strings.Join(rule.regions, ", "))
+		}
+		if !slices.Contains(rule.regions, region) {
+			return fmt.Sprintf("region %s is not allowed by the %s (allowed: %s)", region, rule.scope, strings.Join(rule.regions, ", "))
+		}
+	}
+	return ""
+}
+
+// checkPlacement evaluates a placement against the definition's and database's
+// residency rules and records the evaluation in the audit log, whether or not
+// it is allowed.
+func (api *API) checkPlacement(ctx context.Context, operation, databaseID string, place placement, definitionRegions, databaseRegions []string) error {
+	eval := residencyEvaluation{
+		Operation:         operation,
+		DatabaseID:        databaseID,
+		Group:             place.Group,
+		Region:            place.Region,
+		DefinitionRegions: definitionRegions,
+		DatabaseRegions:   databaseRegions,
+	}
+	eval.Reason = evaluateResidency(place.Region, definitionRegions, databaseRegions)
+	eval.Allowed = eval.Reason == ""
+	if err := api.recordAudit(ctx, auditResidencyEvaluated, "database:"+databaseID, eval); err != nil {
+		return err
+	}
+	if !eval.Allowed {
+		return fmt.Errorf("%w: %s", tools.ErrResidencyViolation, eval.Reason)
+	}
+	return nil
+}
+
+func (api *API) loadDefinitionResidency(ctx context.Context, definitionID int32) ([]string, error) {
+	return api.loadResidency(ctx, `SELECT regions_json FROM atombase_definition_residency WHERE definition_id = ?`, definitionID)
+}
+
+func (api *API) loadDatabaseResidency(ctx context.Context, databaseID string) ([]string, error) {
+	return api.loadResidency(ctx, `SELECT regions_json FROM atombase_database_residency WHERE database_id = ?`, databaseID)
+}
+
+func (api *API) loadResidency(ctx context.Context, query string, key any) ([]string, error) {
+	conn, err := api.dbConn()
+	if err != nil {
+		return nil, err
+	}
+	var raw string
+	if err := conn.QueryRowContext(ctx, query, key).Scan(&raw); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var regions []string
+	if err := json.Unmarshal([]byte(raw), &regions); err != nil {
+		return nil, err
+	}
+	return regions, nil
+}
+
+// loadDatabasePlacement returns where a database was placed. Databases created
+// before placements were recorded, or adopted, have no placement.
+func (api *API) loadDatabasePlacement(ctx context.Context, databaseID string) (placement, error) {
+	conn, err := api.dbConn()
+	if err != nil {
+		return placement{}, err
+	}
+	var place placement
+	err = conn.QueryRowContext(ctx, `
+		SELECT turso_group, region FROM atombase_database_placements WHERE database_id = ?
+	`, databaseID).Scan(&place.Group, &place.Region)
+	if errors.Is(err, sql.ErrNoRows) {
+		return placement{}, nil
+	}
+	return place, err
+}
+
+// savePlacement records a new database's placement and, when it has one, its
+// own residency rule inside the transaction that registers the database.
+func savePlacement(ctx context.Context, tx *sql.Tx, databaseID string, place placement, databaseRegions []string, now string) error {
+	if place.Region != "" {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO atombase_database_placements (database_id, turso_group, region, created_at)
+			VALUES (?, ?, ?, ?)
+		`, databaseID, place.Group, place.Region, now); err != nil {
+			return err
+		}
+	}
+	if len(databaseRegions) == 0 {
+		return nil
+	}
+	raw, err := json.Marshal(databaseRegions)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO atombase_database_residency (database_id, regions_json, updated_at)
+		VALUES (?, ?, ?)
+	`, databaseID, string(raw), now)
+	return err
+}
+
+func (api *API) getDefinitionResidency(ctx context.Context, name string) (*ResidencyRules, error) {
+	def, err := api.getDefinition(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	regions, err := api.loadDefinitionResidency(ctx, def.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &ResidencyRules{Regions: nonNilRegions(regions)}, nil
+}
+
+func (api *API) getDatabaseResidency(ctx context.Context, id string) (*ResidencyRules, error) {
+	if _, err := api.getDatabase(ctx, id); err != nil {
+		return nil, err
+	}
+	regions, err := api.loadDatabaseResidency(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	place, err := api.loadDatabasePlacement(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return &ResidencyRules{Regions: nonNilRegions(regions), Region: place.Region}, nil
+}
+
+// setDefinitionResidency replaces a definition's residency rule. An empty list
+// removes it. Rules apply to placements made afterwards; existing databases are
+// not moved.
+func (api *API) setDefinitionResidency(ctx context.Context, name string, req ResidencyRules) (*ResidencyRules, error) {
+	def, err := api.getDefinition(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	regions, err := normalizeRegions(req.Regions)
+	if err != nil {
+		return nil, err
+	}
+	if err := api.saveResidency(ctx, `atombase_definition_residency`, `definition_id`, def.ID, regions); err != nil {
+		return nil, err
+	}
+	if err := api.recordAudit(ctx, auditResidencyUpdated, "definition:"+def.Name, ResidencyRules{Regions: regions}); err != nil {
+		return nil, err
+	}
+	return &ResidencyRules{Regions: regions}, nil
+}
+
+// setDatabaseResidency replaces a database's own residency rule. The database's
+// current placement must satisfy the new rule.
+func (api *API) setDatabaseResidency(ctx context.Context, id string, req ResidencyRules) (*ResidencyRules, error) {
+	if _, err := api.getDatabase(ctx, id); err != nil {
+		return nil, err
+	}
+	regions, err := normalizeRegions(req.Regions)
+	if err != nil {
+		return nil, err
+	}
+	place, err := api.loadDatabasePlacement(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if reason := evaluateResidency(place.Region, nil, regions); reason != "" {
+		return nil, fmt.Errorf("%w: %s", tools.ErrResidencyViolation, reason)
+	}
+	if err := api.saveResidency(ctx, `atombase_database_residency`, `database_id`, id, regions); err != nil {
+		return nil, err
+	}
+	if err := api.recordAudit(ctx, auditResidencyUpdated, "database:"+id, ResidencyRules{Regions: regions}); err != nil {
+		return nil, err
+	}
+	return &ResidencyRules{Regions: regions, Region: place.Region}, nil
+}
+
+func (api *API) saveResidency(ctx context.Context, table, keyColumn string, key any, regions []string) error {
+	conn, err := api.dbConn()
+	if err != nil {
+		return err
+	}
+	if len(regions) == 0 {
+		_, err = conn.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE %s = ?`, table, keyColumn), key)
+		return err
+	}
+	raw, err := json.Marshal(regions)
+	if err != nil {
+		return err
+	}
+	_, err = conn.ExecContext(ctx, fmt.Sprintf(`
+		INSERT INTO %s (%s, regions_json, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT(%s) DO UPDATE SET regions_json = excluded.regions_json, updated_at = excluded.updated_at
+	`, table, keyColumn, keyColumn), key, string(raw), time.Now().UTC().Format(time.RFC3339))
+	return err
+}
+
+func nonNilRegions(regions []string) []string {
+	if regions == nil {
+		return []string{}
+	}
+	return regions
+}
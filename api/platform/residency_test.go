@@ -0,0 +1,123 @@
+package platform
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/atombasedev/atombase/config"
+	"github.com/atombasedev/atombase/tools"
+)
+
+func TestResidency_CreatePlacement(t *testing.T) {
+	api, db := setupPlatformAPI(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	oldGroup, oldRegions := config.Cfg.TursoGroup, config.Cfg.TursoGroupRegions
+	oldCreate, oldToken, oldBatch := createTenantDatabaseFn, createTenantTokenFn, batchExecuteWithTokenFn
+	defer func() {
+		config.Cfg.TursoGroup, config.Cfg.TursoGroupRegions = oldGroup, oldRegions
+		createTenantDatabaseFn, createTenantTokenFn, batchExecuteWithTokenFn = oldCreate, oldToken, oldBatch
+	}()
+	config.Cfg.TursoGroup = "default"
+	config.Cfg.TursoGroupRegions = map[string]string{"default": "aws-us-east-1", "eu": "aws-eu-west-1"}
+	var groups []string
+	createTenantDatabaseFn = func(ctx context.Context, name, group string) error {
+		groups = append(groups, group)
+		return nil
+	}
+	createTenantTokenFn = func(ctx context.Context, name string) (string, error) { return "token", nil }
+	batchExecuteWithTokenFn = func(ctx context.Context, dbName, token string, statements []string) error { return nil }
+
+	if _, err := api.createDefinition(ctx, CreateDefinitionRequest{
+		Name: "records",
+		Type: "global",
+		Schema: Schema{Tables: []Table{{Name: "records", Pk: []string{"id"}, Columns: map[string]Col{
+			"id": {Name: "id", Type: "INTEGER"},
+		}}}},
+	}); err != nil {
+		t.Fatalf("createDefinition failed: %v", err)
+	}
+	rules, err := api.setDefinitionResidency(ctx, "records", ResidencyRules{Regions: []string{" aws-eu-west-1", "aws-eu-west-1"}})
+	if err != nil {
+		t.Fatalf("setDefinitionResidency failed: %v", err)
+	}
+	if len(rules.Regions) != 1 || rules.Regions[0] != "aws-eu-west-1" {
+		t.Fatalf("expected normalized regions, got %v", rules.Regions)
+	}
+
+	if _, err := api.createDatabase(ctx, CreateDatabaseRequest{ID: "records-us", Definition: "records"}); !errors.Is(err, tools.ErrResidencyViolation) {
+		t.Fatalf("expected the default region to be refused, got %v", err)
+	}
+	if _, err := api.createDatabase(ctx, CreateDatabaseRequest{ID: "records-mars", Definition: "records", Region: "mars-1"}); err == nil {
+		t.Fatal("expected a region without a Turso group to be refused")
+	}
+	if len(groups) != 0 {
+		t.Fatalf("expected no database to be created for refused placements, got %v", groups)
+	}
+
+	if _, err := api.createDatabase(ctx, CreateDatabaseRequest{
+		ID:             "records-eu",
+		Definition:     "records",
+		Region:         "aws-eu-west-1",
+		AllowedRegions: []string{"aws-eu-west-1", "aws-eu-central-1"},
+	}); err != nil {
+		t.Fatalf("createDatabase failed: %v", err)
+	}
+	if len(groups) != 1 || groups[0] != "eu" {
+		t.Fatalf("expected the database to be created in the eu group, got %v", groups)
+	}
+	current, err := api.getDatabaseResidency(ctx, "records-eu")
+	if err != nil {
+		t.Fatalf("getDatabaseResidency failed: %v", err)
+	}
+	if current.Region != "aws-eu-west-1" || len(current.Regions) != 2 {
+		t.Fatalf("unexpected database residency: %#v", current)
+	}
+	if _, err := api.setDatabaseResidency(ctx, "records-eu", ResidencyRules{Regions: []string{"aws-us-east-1"}}); !errors.Is(err, tools.ErrResidencyViolation) {
+		t.Fatalf("expected a rule excluding the current placement to be refused, got %v", err)
+	}
+
+	entries, err := api.listAuditLog(ctx, auditResidencyEvaluated, 0)
+	if err != nil {
+		t.Fatalf("listAuditLog failed: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected two recorded evaluations, got %d", len(entries))
+	}
+	var latest, refused residencyEvaluation
+	if err := json.Unmarshal(entries[0].Detail, &latest); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(entries[1].Detail, &refused); err != nil {
+		t.Fatal(err)
+	}
+	if !latest.Allowed || latest.DatabaseID != "records-eu" || latest.Group != "eu" {
+		t.Fatalf("unexpected allowed evaluation: %#v", latest)
+	}
+	if refused.Allowed || refused.Region != "aws-us-east-1" || refused.Reason == "" || len(refused.DefinitionRegions) != 1 {
+		t.Fatalf("unexpected refused evaluation: %#v", refused)
+	}
+}
+
+func TestEvaluateResidency(t *testing.T) {
+	cases := []struct {
+		region     string
+		definition []string
+		database   []string
+		allowed    bool
+	}{
+		{region: "", allowed: true},
+		{region: "aws-us-east-1", definition: []string{"aws-us-east-1"}, allowed: true},
+		{region: "aws-us-east-1", definition: []string{"aws-us-east-1"}, database: []string{"aws-eu-west-1"}, allowed: false},
+		{region: "", database: []string{"aws-eu-west-1"}, allowed: false},
+	}
+	for _, tc := range cases {
+		reason := evaluateResidency(tc.region, tc.definition, tc.database)
+		if (reason == "") != tc.allowed {
+			t.Fatalf("evaluateResidency(%q, %v, %v) = %q, want allowed=%v", tc.region, tc.definition, tc.database, reason, tc.allowed)
+		}
+	}
+}
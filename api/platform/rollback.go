@@ -0,0 +1,201 @@
+package platform
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/atombasedev/atombase/tools"
+)
+
+// rollbackAppliedMigration aborts the rollout of a migration. The definition is
+// moved back to the migration's source version so no further databases migrate
+// lazily, and the inverse plan is applied only to databases that already reached
+// the target version. Databases still on the source version are not touched.
+//
+// Once every applied database has been rolled back the target version is retracted
+// from the history so the next push reuses its number. If any database fails, the
+// version is kept and the call can be repeated; only databases still on the target
+// version are retried.
+func (api *API) rollbackAppliedMigration(ctx context.Context, id int64, req RollbackMigrationRequest) (*RollbackMigrationResponse, error) {
+	conn, err := api.dbConn()
+	if err != nil {
+		return nil, err
+	}
+
+	var definitionID int32
+	var fromVersion, toVersion, currentVersion int
+	if err := conn.QueryRowContext(ctx, `
+		SELECT m.definition_id, m.from_version, m.to_version, d.current_version
+		FROM atombase_migrations m
+		JOIN atombase_definitions d ON d.id = m.definition_id
+		WHERE m.id = ?
+	`, id).Scan(&definitionID, &fromVersion, &toVersion, &currentVersion); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, tools.ErrMigrationNotFound
+		}
+		return nil, err
+	}
+	if currentVersion != toVersion && currentVersion != fromVersion {
+		return nil, tools.InvalidRequestErr(fmt.Sprintf("only the latest migration can be rolled back (definition is at version %d)", currentVersion))
+	}
+
+	fromSchema, err := api.loadDefinitionSchema(ctx, definitionID, fromVersion)
+	if err != nil {
+		return nil, err
+	}
+	toSchema, err := api.loadDefinitionSchema(ctx, definitionID, toVersion)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := GenerateMigrationPlan(toSchema, fromSchema, diffSchemas(toSchema, fromSchema), req.Merge)
+	if err != nil {
+		return nil, tools.InvalidMigrationErr(err.Error())
+	}
+	if err := VerifyMigrationPlan(ctx, toSchema, fromSchema, plan.SQL, nil); err != nil {
+		return nil, tools.InvalidMigrationErr(err.Error())
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	if currentVersion == toVersion {
+		if _, err := conn.ExecContext(ctx, `
+			UPDATE atombase_definitions
+			SET current_version = ?, updated_at = ?
+			WHERE id = ?
+		`, fromVersion, now, definitionID); err != nil {
+			return nil, err
+		}
+		tools.InvalidateDefinition(definitionID)
+	}
+
+	databases, err := api.getDatabasesByDefinition(ctx, definitionID)
+	if err != nil {
+		return nil, err
+	}
+	resp := &RollbackMigrationResponse{
+		MigrationID: id,
+		FromVersion: toVersion,
+		ToVersion:   fromVersion,
+		Databases:   []RollbackDatabaseResult{},
+	}
+	failed := false
+	for _, db := range databases {
+		if db.DefinitionVersion != toVersion {
+			continue
+		}
+		result := RollbackDatabaseResult{ID: db.ID, Status: DatabaseMigrationStatusSuccess}
+		if err := api.rollbackDatabase(ctx, db.ID, fromVersion, plan.SQL); err != nil {
+			tools.Logger.Error("migration rollback failed", "database_id", db.ID, "migration_id", id, "error", err)
+			result.Status = DatabaseMigrationStatusFailed
+			result.Error = err.Error()
+			failed = true
+		}
+		resp.Databases = append(resp.Databases, result)
+	}
+
+	if !failed {
+		if err := api.retractDefinitionVersion(ctx, definitionID, toVersion); err != nil {
+			return nil, err
+		}
+		resp.Retracted = true
+	}
+	return resp, nil
+}
+
+func (api *API) rollbackDatabase(ctx context.Context, databaseID string, version int, statements []string) error {
+	token, err := api.getDatabaseToken(ctx, databaseID)
+	if err != nil {
+		return err
+	}
+	if len(statements) > 0 {
+		if err := batchExecuteWithTokenFn(ctx, databaseID, token, statements); err != nil {
+			return err
+		}
+	}
+	conn, err := api.dbConn()
+	if err != nil {
+		return err
+	}
+	if _, err := conn.ExecContext(ctx, `
+		UPDATE atombase_databases
+		SET definition_version = ?, updated_at = ?
+		WHERE id = ?
+	`, version, time.Now().UTC().Format(time.RFC3339), databaseID); err != nil {
+		return err
+	}
+	tools.UpdateDatabaseVersion(databaseID, version)
+	return nil
+}
+
+// retractDefinitionVersion removes a version that no database uses anymore,
+// along with the migration that produced it and its versioned policies and tests.
+func (api *API) retractDefinitionVersion(ctx context.Context, definitionID int32, version int) error {
+	conn, err := api.dbConn()
+	if err != nil {
+		return err
+	}
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `
+		DELETE FROM atombase_migration_failures
+		WHERE to_version = ? AND database_id IN (SELECT id FROM atombase_databases WHERE definition_id = ?)
+	`, version, definitionID); err != nil {
+		return err
+	}
+	if err := deleteDefinitionVersionTx(ctx, tx, definitionID, version); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		DELETE FROM atombase_migration_windows
+		WHERE migration_id IN (SELECT id FROM atombase_migrations WHERE definition_id = ? AND to_version = ?)
+	`, definitionID, version); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		DELETE FROM atombase_migrations
+		WHERE definition_id = ? AND to_version = ?
+	`, definitionID, version); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// deleteDefinitionVersionTx removes a version's history row and the policies
+// and tests stored for it. Migrations are left to the caller.
+func deleteDefinitionVersionTx(ctx context.Context, exec Execer, definitionID int32, version int) error {
+	for _, table := range []string{TableAccessPolicies, TableProvisionPolicies, TableDefinitionTests, TableDefinitionsHistory} {
+		if _, err := exec.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE definition_id = ? AND version = ?`, table), definitionID, version); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (api *API) loadDefinitionSchema(ctx context.Context, definitionID int32, version int) (Schema, error) {
+	conn, err := api.dbConn()
+	if err != nil {
+		return Schema{}, err
+	}
+	var schemaJSON string
+	if err := conn.QueryRowContext(ctx, `
+		SELECT schema_json
+		FROM atombase_definitions_history
+		WHERE definition_id = ? AND version = ?
+	`, definitionID, version).Scan(&schemaJSON); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Schema{}, tools.VersionNotFoundErr(version)
+		}
+		return Schema{}, err
+	}
+	var schema Schema
+	if err := tools.DecodeSchema([]byte(schemaJSON), &schema); err != nil {
+		return Schema{}, err
+	}
+	return schema, nil
+}
@@ -0,0 +1,151 @@
+package platform
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/atombasedev/atombase/tools"
+)
+
+func setupRollbackFixture(t *testing.T) (*API, *sql.DB, int64) {
+	t.Helper()
+	api, db := setupPlatformAPI(t)
+
+	v1 := Schema{Tables: []Table{{Name: "posts", Pk: []string{"id"}, Columns: map[string]Col{
+		"id":    {Name: "id", Type: "INTEGER"},
+		"title": {Name: "title", Type: "TEXT"},
+	}}}}
+	created, err := api.createDefinition(context.Background(), CreateDefinitionRequest{Name: "posts", Type: "global", Schema: v1})
+	if err != nil {
+		t.Fatalf("createDefinition failed: %v", err)
+	}
+	for _, id := range []string{"db-a", "db-b", "db-c"} {
+		if _, err := db.Exec(`
+			INSERT INTO atombase_databases (id, definition_id, definition_version, auth_token_encrypted, created_at, updated_at)
+			VALUES (?, ?, 1, ?, '2026-01-01T00:00:00Z', '2026-01-01T00:00:00Z')
+		`, id, created.ID, []byte("token-"+id)); err != nil {
+			t.Fatalf("failed to insert database row: %v", err)
+		}
+	}
+
+	oldBatch := batchExecuteWithTokenFn
+	t.Cleanup(func() { batchExecuteWithTokenFn = oldBatch })
+	batchExecuteWithTokenFn = func(ctx context.Context, dbName, token string, statements []string) error { return nil }
+
+	v2 := Schema{Tables: []Table{{Name: "posts", Pk: []string{"id"}, Columns: map[string]Col{
+		"id":    {Name: "id", Type: "INTEGER"},
+		"title": {Name: "title", Type: "TEXT"},
+		"body":  {Name: "body", Type: "TEXT"},
+	}}}}
+	if _, err := api.pushDefinition(context.Background(), "posts", PushDefinitionRequest{Schema: v2}); err != nil {
+		t.Fatalf("pushDefinition failed: %v", err)
+	}
+	// db-a was probed by the push; db-b migrated lazily; db-c never migrated.
+	if _, err := db.Exec(`UPDATE atombase_databases SET definition_version = 2 WHERE id = 'db-b'`); err != nil {
+		t.Fatal(err)
+	}
+	var migrationID int64
+	if err := db.QueryRow(`SELECT id FROM atombase_migrations WHERE to_version = 2`).Scan(&migrationID); err != nil {
+		t.Fatalf("failed to load migration: %v", err)
+	}
+	return api, db, migrationID
+}
+
+func databaseVersions(t *testing.T, db *sql.DB) map[string]int {
+	t.Helper()
+	rows, err := db.Query(`SELECT id, definition_version FROM atombase_databases`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	versions := map[string]int{}
+	for rows.Next() {
+		var id string
+		var version int
+		if err := rows.Scan(&id, &version); err != nil {
+			t.Fatal(err)
+		}
+		versions[id] = version
+	}
+	return versions
+}
+
+func TestRollbackAppliedMigration_OnlyTouchesMigratedDatabases(t *testing.T) {
+	api, db, migrationID := setupRollbackFixture(t)
+	defer db.Close()
+
+	touched := map[string][]string{}
+	batchExecuteWithTokenFn = func(ctx context.Context, dbName, token string, statements []string) error {
+		touched[dbName] = statements
+		return nil
+	}
+
+	resp, err := api.rollbackAppliedMigration(context.Background(), migrationID, RollbackMigrationRequest{})
+	if err != nil {
+		t.Fatalf("rollbackAppliedMigration failed: %v", err)
+	}
+	if !resp.Retracted || resp.FromVersion != 2 || resp.ToVersion != 1 || len(resp.Databases) != 2 {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	if _, ok := touched["db-c"]; ok || len(touched) != 2 {
+		t.Fatalf("expected only migrated databases to be touched, got %v", touched)
+	}
+	if stmts := touched["db-a"]; len(stmts) != 1 || stmts[0] != "ALTER TABLE [posts] DROP COLUMN [body]" {
+		t.Fatalf("unexpected inverse plan: %#v", stmts)
+	}
+	for id, version := range databaseVersions(t, db) {
+		if version != 1 {
+			t.Fatalf("expected %s back on version 1, got %d", id, version)
+		}
+	}
+
+	def, err := api.getDefinition(context.Background(), "posts")
+	if err != nil || def.CurrentVersion != 1 {
+		t.Fatalf("expected definition back on version 1, got %+v (%v)", def, err)
+	}
+	var remaining int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM atombase_definitions_history WHERE version = 2`).Scan(&remaining); err != nil || remaining != 0 {
+		t.Fatalf("expected version 2 to be retracted, got %d (%v)", remaining, err)
+	}
+	if _, err := api.rollbackAppliedMigration(context.Background(), migrationID, RollbackMigrationRequest{}); !errors.Is(err, tools.ErrMigrationNotFound) {
+		t.Fatalf("expected retracted migration to be gone, got %v", err)
+	}
+}
+
+func TestRollbackAppliedMigration_KeepsVersionUntilAllRolledBack(t *testing.T) {
+	api, db, migrationID := setupRollbackFixture(t)
+	defer db.Close()
+
+	batchExecuteWithTokenFn = func(ctx context.Context, dbName, token string, statements []string) error {
+		if dbName == "db-b" {
+			return errors.New("connection reset")
+		}
+		return nil
+	}
+	resp, err := api.rollbackAppliedMigration(context.Background(), migrationID, RollbackMigrationRequest{})
+	if err != nil {
+		t.Fatalf("rollbackAppliedMigration failed: %v", err)
+	}
+	if resp.Retracted {
+		t.Fatal("expected version to be kept while db-b is still migrated")
+	}
+	versions := databaseVersions(t, db)
+	if versions["db-a"] != 1 || versions["db-b"] != 2 || versions["db-c"] != 1 {
+		t.Fatalf("unexpected database versions: %v", versions)
+	}
+
+	var retried []string
+	batchExecuteWithTokenFn = func(ctx context.Context, dbName, token string, statements []string) error {
+		retried = append(retried, dbName)
+		return nil
+	}
+	resp, err = api.rollbackAppliedMigration(context.Background(), migrationID, RollbackMigrationRequest{})
+	if err != nil {
+		t.Fatalf("retry failed: %v", err)
+	}
+	if !resp.Retracted || len(retried) != 1 || retried[0] != "db-b" {
+		t.Fatalf("expected only db-b to be retried, got %v (%+v)", retried, resp)
+	}
+}
@@ -0,0 +1,179 @@
+package platform
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/atombasedev/atombase/definitions"
+	"github.com/atombasedev/atombase/tools"
+)
+
+// applyTenantColumn adds the schema's tenant column, and an index on it, to every
+// table that does not declare it yet. Schemas without a tenant column are left
+// unchanged. Row tenancy is only available to user definitions.
+func applyTenantColumn(defType definitions.DefinitionType, schema *Schema) error {
+	column := tenantColumn(*schema)
+	if column == "" {
+		return nil
+	}
+	if defType != definitions.DefinitionTypeUser {
+		return tools.InvalidRequestErr("settings.tenantColumn is only allowed for user definitions")
+	}
+	for i := range schema.Tables {
+		table := &schema.Tables[i]
+		if _, ok := table.Columns[column]; ok {
+			continue
+		}
+		columns := make(map[string]Col, len(table.Columns)+1)
+		for name, col := range table.Columns {
+			columns[name] = col
+		}
+		columns[column] = Col{Name: column, Type: "TEXT"}
+		table.Columns = columns
+		table.Indexes = append(append([]Index{}, table.Indexes...), Index{
+			Name:    fmt.Sprintf("idx_%s_%s", table.Name, column),
+			Columns: []string{column},
+		})
+	}
+	return nil
+}
+
+func tenantColumn(schema Schema) string {
+	if schema.Settings == nil {
+		return ""
+	}
+	return schema.Settings.TenantColumn
+}
+
+// requireSharedDatabase checks that a database can hold row tenants: it must
+// belong to a user definition with a tenant column and not be a user's dedicated
+// database.
+func (api *API) requireSharedDatabase(ctx context.Context, databaseID string) (*DatabaseRecord, error) {
+	db, err := api.getDatabase(ctx, databaseID)
+	if err != nil {
+		return nil, err
+	}
+	if definitions.DefinitionType(db.DefinitionType) != definitions.DefinitionTypeUser {
+		return nil, tools.InvalidRequestErr("row tenants are only supported for user definitions")
+	}
+	def, err := api.getDefinition(ctx, db.DefinitionName)
+	if err != nil {
+		return nil, err
+	}
+	var schema Schema
+	if err := tools.DecodeSchema(def.Schema, &schema); err != nil {
+		return nil, err
+	}
+	if tenantColumn(schema) == "" {
+		return nil, tools.InvalidRequestErr(fmt.Sprintf("definition %s has no tenant column", def.Name))
+	}
+	conn, err := api.dbConn()
+	if err != nil {
+		return nil, err
+	}
+	var owners int
+	if err := conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM atombase_users WHERE database_id = ?`, databaseID).Scan(&owners); err != nil {
+		return nil, err
+	}
+	if owners > 0 {
+		return nil, tools.InvalidRequestErr("database is dedicated to a user")
+	}
+	return db, nil
+}
+
+// attachRowTenant routes a user without a dedicated database to a shared
+// database. Their rows are told apart by the definition's tenant column.
+func (api *API) attachRowTenant(ctx context.Context, databaseID, userID string) (*RowTenant, error) {
+	if userID == "" {
+		return nil, tools.InvalidRequestErr("userId is required")
+	}
+	if _, err := api.requireSharedDatabase(ctx, databaseID); err != nil {
+		return nil, err
+	}
+	conn, err := api.dbConn()
+	if err != nil {
+		return nil, err
+	}
+
+	var dedicated sql.NullString
+	if err := conn.QueryRowContext(ctx, `SELECT database_id FROM atombase_users WHERE id = ?`, userID).Scan(&dedicated); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, tools.InvalidRequestErr("user not found")
+		}
+		return nil, err
+	}
+	if dedicated.Valid && dedicated.String != "" {
+		return nil, tools.InvalidRequestErr("user already has a dedicated database")
+	}
+	var current string
+	err = conn.QueryRowContext(ctx, `SELECT database_id FROM atombase_row_tenants WHERE user_id = ?`, userID).Scan(&current)
+	switch {
+	case err == nil:
+		return nil, tools.InvalidRequestErr(fmt.Sprintf("user is already a row tenant of %s", current))
+	case !errors.Is(err, sql.ErrNoRows):
+		return nil, err
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	if _, err := conn.ExecContext(ctx, `
+		INSERT INTO atombase_row_tenants (user_id, database_id, created_at)
+		VALUES (?, ?, ?)
+	`, userID, databaseID, now); err != nil {
+		return nil, err
+	}
+	return &RowTenant{UserID: userID, DatabaseID: databaseID, CreatedAt: mustParseTime(now)}, nil
+}
+
+// detachRowTenant removes a user's routing to a shared database. Their rows are
+// kept, so attaching them again restores access.
+func (api *API) detachRowTenant(ctx context.Context, databaseID, userID string) error {
+	conn, err := api.dbConn()
+	if err != nil {
+		return err
+	}
+	result, err := conn.ExecContext(ctx, `
+		DELETE FROM atombase_row_tenants WHERE database_id = ? AND user_id = ?
+	`, databaseID, userID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return tools.InvalidRequestErr("user is not a row tenant of this database")
+	}
+	return nil
+}
+
+func (api *API) listRowTenants(ctx context.Context, databaseID string) ([]RowTenant, error) {
+	if _, err := api.getDatabase(ctx, databaseID); err != nil {
+		return nil, err
+	}
+	conn, err := api.dbConn()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := conn.QueryContext(ctx, `
+		SELECT user_id, database_id, created_at
+		FROM atombase_row_tenants
+		WHERE database_id = ?
+		ORDER BY created_at ASC, user_id ASC
+	`, databaseID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []RowTenant{}
+	for rows.Next() {
+		var item RowTenant
+		var createdAt string
+		if err := rows.Scan(&item.UserID, &item.DatabaseID, &createdAt); err != nil {
+			return nil, err
+		}
+		item.CreatedAt = mustParseTime(createdAt)
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
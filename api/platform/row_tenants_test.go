@@ -0,0 +1,101 @@
+package platform
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/atombasedev/atombase/tools"
+)
+
+func TestRowTenants_SharedDatabaseFlow(t *testing.T) {
+	api, db := setupPlatformAPI(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	_, _ = db.Exec(`INSERT INTO atombase_users (id) VALUES ('user-1'), ('user-2')`)
+	def, err := api.createDefinition(ctx, CreateDefinitionRequest{
+		Name: "notes",
+		Type: "user",
+		Schema: Schema{
+			Tables: []Table{{Name: "notes", Pk: []string{"id"}, Columns: map[string]Col{
+				"id": {Name: "id", Type: "INTEGER"},
+			}}},
+			Settings: &APISettings{TenantColumn: "tenant_id"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("createDefinition failed: %v", err)
+	}
+	var stored Schema
+	if err := tools.DecodeSchema(def.Schema, &stored); err != nil {
+		t.Fatal(err)
+	}
+	if col, ok := stored.Tables[0].Columns["tenant_id"]; !ok || col.Type != "TEXT" || len(stored.Tables[0].Indexes) != 1 {
+		t.Fatalf("expected tenant column and index to be injected, got %#v", stored.Tables[0])
+	}
+
+	oldCreate := createTenantDatabaseFn
+	oldToken := createTenantTokenFn
+	oldBatch := batchExecuteWithTokenFn
+	defer func() {
+		createTenantDatabaseFn = oldCreate
+		createTenantTokenFn = oldToken
+		batchExecuteWithTokenFn = oldBatch
+	}()
+	createTenantDatabaseFn = func(ctx context.Context, name, group string) error { return nil }
+	createTenantTokenFn = func(ctx context.Context, name string) (string, error) { return "token", nil }
+	var executed []string
+	batchExecuteWithTokenFn = func(ctx context.Context, dbName, token string, statements []string) error {
+		executed = append(executed, statements...)
+		return nil
+	}
+
+	if _, err := api.createDatabase(ctx, CreateDatabaseRequest{ID: "shared-db", Definition: "notes", Shared: true}); err != nil {
+		t.Fatalf("createDatabase(shared) failed: %v", err)
+	}
+	if !strings.Contains(strings.Join(executed, "\n"), "[tenant_id]") {
+		t.Fatalf("expected tenant column in initialized schema, got %v", executed)
+	}
+
+	if _, err := api.attachRowTenant(ctx, "shared-db", "user-1"); err != nil {
+		t.Fatalf("attachRowTenant failed: %v", err)
+	}
+	if _, err := api.attachRowTenant(ctx, "shared-db", "user-1"); err == nil {
+		t.Fatal("expected attaching the same user twice to fail")
+	}
+	if _, err := api.attachRowTenant(ctx, "shared-db", "missing"); err == nil {
+		t.Fatal("expected attaching an unknown user to fail")
+	}
+	tenants, err := api.listRowTenants(ctx, "shared-db")
+	if err != nil {
+		t.Fatalf("listRowTenants failed: %v", err)
+	}
+	if len(tenants) != 1 || tenants[0].UserID != "user-1" {
+		t.Fatalf("expected user-1 as the only tenant, got %#v", tenants)
+	}
+
+	if _, err := api.createDatabase(ctx, CreateDatabaseRequest{ID: "user-2-db", Definition: "notes", UserID: "user-2"}); err != nil {
+		t.Fatalf("createDatabase(user) failed: %v", err)
+	}
+	if _, err := api.attachRowTenant(ctx, "user-2-db", "user-1"); err == nil {
+		t.Fatal("expected a dedicated database to reject row tenants")
+	}
+
+	if err := api.detachRowTenant(ctx, "shared-db", "user-1"); err != nil {
+		t.Fatalf("detachRowTenant failed: %v", err)
+	}
+	if err := api.detachRowTenant(ctx, "shared-db", "user-1"); err == nil {
+		t.Fatal("expected detaching an unattached user to fail")
+	}
+}
+
+func TestApplyTenantColumn_RejectsNonUserDefinitions(t *testing.T) {
+	s := Schema{
+		Tables:   []Table{{Name: "items", Columns: map[string]Col{"id": {Name: "id", Type: "INTEGER"}}}},
+		Settings: &APISettings{TenantColumn: "tenant_id"},
+	}
+	if err := applyTenantColumn("global", &s); err == nil {
+		t.Fatal("expected global definitions to reject a tenant column")
+	}
+}
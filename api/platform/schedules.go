@@ -0,0 +1,120 @@
+package platform
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/atombasedev/atombase/tools"
+)
+
+const auditScheduleUpdated = "schedule.updated"
+
+// validateMigrationWindows checks the windows of a push or migrate request.
+func validateMigrationWindows(windows []MigrationWindow) error {
+	for i, w := range windows {
+		if err := w.Validate(); err != nil {
+			return tools.InvalidRequestErr(fmt.Sprintf("windows[%d]: %v", i, err))
+		}
+	}
+	return nil
+}
+
+// getDatabaseSchedule returns the timezone and labels migration windows are
+// matched against for a database.
+func (api *API) getDatabaseSchedule(ctx context.Context, id string) (*DatabaseSchedule, error) {
+	if _, err := api.getDatabase(ctx, id); err != nil {
+		return nil, err
+	}
+	schedule, err := api.store.GetDatabaseSchedule(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return &schedule, nil
+}
+
+// setDatabaseSchedule replaces a database's timezone and labels. An empty
+// schedule removes them. Windows of migrations already published use the new
+// schedule from the database's next request.
+func (api *API) setDatabaseSchedule(ctx context.Context, id string, req DatabaseSchedule) (*DatabaseSchedule, error) {
+	if _, err := api.getDatabase(ctx, id); err != nil {
+		return nil, err
+	}
+	if req.Timezone != "" {
+		if _, err := time.LoadLocation(req.Timezone); err != nil {
+			return nil, tools.InvalidRequestErr(fmt.Sprintf("unknown timezone %q", req.Timezone))
+		}
+	}
+	labels := make([]string, 0, len(req.Labels))
+	for _, label := range req.Labels {
+		label = strings.TrimSpace(label)
+		if label == "" {
+			return nil, tools.InvalidRequestErr("labels must not be empty")
+		}
+		if !slices.Contains(labels, label) {
+			labels = append(labels, label)
+		}
+	}
+	sort.Strings(labels)
+	schedule := DatabaseSchedule{Timezone: req.Timezone, Labels: labels}
+
+	conn, err := api.dbConn()
+	if err != nil {
+		return nil, err
+	}
+	if schedule.Timezone == "" && len(labels) == 0 {
+		_, err = conn.ExecContext(ctx, `DELETE FROM atombase_database_schedules WHERE database_id = ?`, id)
+	} else {
+		raw, _ := json.Marshal(labels)
+		_, err = conn.ExecContext(ctx, `
+			INSERT INTO atombase_database_schedules (database_id, timezone, labels_json, updated_at) VALUES (?, ?, ?, ?)
+			ON CONFLICT(database_id) DO UPDATE SET timezone = excluded.timezone, labels_json = excluded.labels_json, updated_at = excluded.updated_at
+		`, id, schedule.Timezone, string(raw), time.Now().UTC().Format(time.RFC3339))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := api.recordAudit(ctx, auditScheduleUpdated, "database:"+id, schedule); err != nil {
+		return nil, err
+	}
+	return &schedule, nil
+}
+
+// probeDatabase picks the database a new version is first applied to: the
+// oldest one whose windows are open now, or -1 when none is.
+func (api *API) probeDatabase(ctx context.Context, databases []DatabaseRecord, windows []MigrationWindow) (int, error) {
+	if len(windows) == 0 {
+		return 0, nil
+	}
+	now := time.Now()
+	for i, db := range databases {
+		schedule, err := api.store.GetDatabaseSchedule(ctx, db.ID)
+		if err != nil {
+			return -1, err
+		}
+		if tools.MigrationWindowOpen(windows, schedule, now) {
+			return i, nil
+		}
+	}
+	return -1, nil
+}
+
+// saveMigrationWindows stores the windows of the migration just inserted.
+func saveMigrationWindows(ctx context.Context, tx *sql.Tx, migrationID int64, windows []MigrationWindow) error {
+	if len(windows) == 0 {
+		return nil
+	}
+	raw, err := json.Marshal(windows)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO atombase_migration_windows (migration_id, windows_json) VALUES (?, ?)
+	`, migrationID, string(raw))
+	return err
+}
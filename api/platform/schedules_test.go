@@ -0,0 +1,141 @@
+package platform
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDatabaseSchedule_SetAndGet(t *testing.T) {
+	api, db := setupPlatformAPI(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	created, err := api.createDefinition(ctx, CreateDefinitionRequest{
+		Name: "posts",
+		Type: "global",
+		Schema: Schema{Tables: []Table{{Name: "posts", Pk: []string{"id"}, Columns: map[string]Col{
+			"id": {Name: "id", Type: "INTEGER"},
+		}}}},
+	})
+	if err != nil {
+		t.Fatalf("createDefinition failed: %v", err)
+	}
+	if _, err := db.Exec(`
+		INSERT INTO atombase_databases (id, definition_id, definition_version, created_at, updated_at)
+		VALUES ('eu-db', ?, 1, '2026-01-01T00:00:00Z', '2026-01-01T00:00:00Z')
+	`, created.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	schedule, err := api.setDatabaseSchedule(ctx, "eu-db", DatabaseSchedule{Timezone: "Europe/Berlin", Labels: []string{"eu", " blue", "eu"}})
+	if err != nil {
+		t.Fatalf("setDatabaseSchedule failed: %v", err)
+	}
+	if len(schedule.Labels) != 2 || schedule.Labels[0] != "blue" || schedule.Labels[1] != "eu" {
+		t.Fatalf("expected normalized labels, got %v", schedule.Labels)
+	}
+	got, err := api.getDatabaseSchedule(ctx, "eu-db")
+	if err != nil {
+		t.Fatalf("getDatabaseSchedule failed: %v", err)
+	}
+	if got.Timezone != "Europe/Berlin" || len(got.Labels) != 2 {
+		t.Fatalf("unexpected schedule: %+v", got)
+	}
+
+	if _, err := api.setDatabaseSchedule(ctx, "eu-db", DatabaseSchedule{Timezone: "Mars/Olympus"}); err == nil || !strings.Contains(err.Error(), "unknown timezone") {
+		t.Fatalf("expected invalid timezone to be refused, got %v", err)
+	}
+	if _, err := api.setDatabaseSchedule(ctx, "eu-db", DatabaseSchedule{}); err != nil {
+		t.Fatalf("clearing schedule failed: %v", err)
+	}
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM atombase_database_schedules`).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Fatalf("expected an empty schedule to remove its row, got %d", count)
+	}
+}
+
+func TestPushDefinition_WindowsSkipClosedProbe(t *testing.T) {
+	api, db := setupPlatformAPI(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	created, err := api.createDefinition(ctx, CreateDefinitionRequest{
+		Name: "posts",
+		Type: "global",
+		Schema: Schema{Tables: []Table{{Name: "posts", Pk: []string{"id"}, Columns: map[string]Col{
+			"id": {Name: "id", Type: "INTEGER"},
+		}}}},
+	})
+	if err != nil {
+		t.Fatalf("createDefinition failed: %v", err)
+	}
+	if _, err := db.Exec(`
+		INSERT INTO atombase_databases (id, definition_id, definition_version, auth_token_encrypted, created_at, updated_at) VALUES
+		('eu-db', ?, 1, ?, '2026-01-01T00:00:00Z', '2026-01-01T00:00:00Z'),
+		('us-db', ?, 1, ?, '2026-01-01T00:00:00Z', '2026-01-01T00:00:00Z')
+	`, created.ID, []byte("token"), created.ID, []byte("token")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := api.setDatabaseSchedule(ctx, "eu-db", DatabaseSchedule{Labels: []string{"eu"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	oldBatch := batchExecuteWithTokenFn
+	defer func() { batchExecuteWithTokenFn = oldBatch }()
+	var probed []string
+	batchExecuteWithTokenFn = func(ctx context.Context, dbName, token string, statements []string) error {
+		probed = append(probed, dbName)
+		return nil
+	}
+
+	// A window for eu databases that closed an hour ago.
+	now := time.Now().UTC()
+	windows := []MigrationWindow{{Start: now.Add(-2 * time.Hour).Format("15:04"), End: now.Add(-time.Hour).Format("15:04"), Labels: []string{"eu"}}}
+	version, err := api.pushDefinition(ctx, "posts", PushDefinitionRequest{
+		Schema: Schema{Tables: []Table{{Name: "posts", Pk: []string{"id"}, Columns: map[string]Col{
+			"id":    {Name: "id", Type: "INTEGER"},
+			"title": {Name: "title", Type: "TEXT"},
+		}}}},
+		Windows: windows,
+	})
+	if err != nil {
+		t.Fatalf("pushDefinition failed: %v", err)
+	}
+	if len(version.Windows) != 1 {
+		t.Fatalf("expected windows in response, got %+v", version.Windows)
+	}
+	if len(probed) != 1 || probed[0] != "us-db" {
+		t.Fatalf("expected the probe to skip eu-db, got %v", probed)
+	}
+
+	var raw string
+	if err := db.QueryRow(`
+		SELECT w.windows_json FROM atombase_migration_windows w
+		JOIN atombase_migrations m ON m.id = w.migration_id
+		WHERE m.definition_id = ? AND m.to_version = 2
+	`, created.ID).Scan(&raw); err != nil {
+		t.Fatalf("expected stored windows: %v", err)
+	}
+	var stored []MigrationWindow
+	if err := json.Unmarshal([]byte(raw), &stored); err != nil || len(stored) != 1 || stored[0].Labels[0] != "eu" {
+		t.Fatalf("unexpected stored windows %q: %v", raw, err)
+	}
+
+	next := Schema{Tables: []Table{{Name: "posts", Pk: []string{"id"}, Columns: map[string]Col{
+		"id":    {Name: "id", Type: "INTEGER"},
+		"title": {Name: "title", Type: "TEXT"},
+		"body":  {Name: "body", Type: "TEXT"},
+	}}}}
+	if _, err := api.pushDefinition(ctx, "posts", PushDefinitionRequest{
+		Schema:  next,
+		Windows: []MigrationWindow{{Start: "01:00", End: "nine"}},
+	}); err == nil || !strings.Contains(err.Error(), "windows[0]") {
+		t.Fatalf("expected invalid window to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,146 @@
+package platform
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/atombasedev/atombase/tools"
+)
+
+// Audit actions recorded for service accounts.
+const (
+	auditServiceAccountCreated = "service_account.created"
+	auditServiceAccountDeleted = "service_account.deleted"
+)
+
+// createServiceAccount registers a public key with the scope of req. The
+// private key never reaches the server, so there is no secret to return.
+func (api *API) createServiceAccount(ctx context.Context, req CreateServiceAccountRequest) (*ServiceAccount, error) {
+	publicKey, err := base64.StdEncoding.DecodeString(req.PublicKey)
+	if err != nil || len(publicKey) != ed25519.PublicKeySize {
+		return nil, tools.InvalidRequestErr("publicKey must be a base64 encoded 32 byte Ed25519 public key")
+	}
+	scope, err := api.resolveKeyScope(ctx, CreateAPIKeyRequest{
+		Name: req.Name, Org: req.Org, Role: req.Role, DatabaseID: req.DatabaseID, Tables: req.Tables, Verbs: req.Verbs,
+	})
+	if err != nil {
+		return nil, err
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	account := &ServiceAccount{
+		ID:         "sa_" + hex.EncodeToString(id),
+		Name:       scope.Name,
+		PublicKey:  base64.StdEncoding.EncodeToString(publicKey),
+		Org:        scope.Org,
+		Role:       scope.Role,
+		DatabaseID: scope.DatabaseID,
+		Tables:     scope.Tables,
+		Verbs:      scope.Verbs,
+		CreatedAt:  time.Now().UTC(),
+	}
+	conn, err := api.dbConn()
+	if err != nil {
+		return nil, err
+	}
+	tablesJSON, _ := json.Marshal(account.Tables)
+	verbsJSON, _ := json.Marshal(account.Verbs)
+	if _, err := conn.ExecContext(ctx, `
+		INSERT INTO atombase_service_accounts (id, name, public_key, org_id, role, database_id, tables_json, verbs_json, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, account.ID, account.Name, publicKey,
+		sql.NullString{String: account.Org, Valid: account.Org != ""},
+		sql.NullString{String: account.Role, Valid: account.Role != ""},
+		sql.NullString{String: account.DatabaseID, Valid: account.DatabaseID != ""},
+		string(tablesJSON), string(verbsJSON), account.CreatedAt.Format(time.RFC3339)); err != nil {
+		if isUniqueConstraintError(err) {
+			return nil, tools.ErrServiceAccountExists
+		}
+		return nil, err
+	}
+	if err := api.recordAudit(ctx, auditServiceAccountCreated, "service_account:"+account.ID, map[string]any{
+		"name": account.Name, "org": account.Org, "role": account.Role, "databaseId": account.DatabaseID, "tables": account.Tables, "verbs": account.Verbs,
+	}); err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+// listServiceAccounts returns the service accounts the caller can see, oldest
+// first.
+func (api *API) listServiceAccounts(ctx context.Context) ([]ServiceAccount, error) {
+	conn, err := api.dbConn()
+	if err != nil {
+		return nil, err
+	}
+	org := callerOrg(ctx)
+	rows, err := conn.QueryContext(ctx, `
+		SELECT id, name, public_key, COALESCE(org_id, ''), COALESCE(role, ''), COALESCE(database_id, ''),
+		       tables_json, verbs_json, created_at
+		FROM atombase_service_accounts
+		WHERE ? = '' OR org_id = ?
+		ORDER BY created_at ASC, id ASC
+	`, org, org)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	accounts := []ServiceAccount{}
+	for rows.Next() {
+		var account ServiceAccount
+		var publicKey []byte
+		var tablesJSON, verbsJSON, createdAt string
+		if err := rows.Scan(&account.ID, &account.Name, &publicKey, &account.Org, &account.Role, &account.DatabaseID,
+			&tablesJSON, &verbsJSON, &createdAt); err != nil {
+			return nil, err
+		}
+		account.PublicKey = base64.StdEncoding.EncodeToString(publicKey)
+		if err := json.Unmarshal([]byte(tablesJSON), &account.Tables); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(verbsJSON), &account.Verbs); err != nil {
+			return nil, err
+		}
+		account.CreatedAt = mustParseTime(createdAt)
+		accounts = append(accounts, account)
+	}
+	return accounts, rows.Err()
+}
+
+// deleteServiceAccount removes a service account. Org callers can only remove
+// their org's accounts, and none above their own role.
+func (api *API) deleteServiceAccount(ctx context.Context, id string) error {
+	conn, err := api.dbConn()
+	if err != nil {
+		return err
+	}
+	org := callerOrg(ctx)
+	var role string
+	err = conn.QueryRowContext(ctx, `
+		SELECT COALESCE(role, '') FROM atombase_service_accounts WHERE id = ? AND (? = '' OR org_id = ?)
+	`, id, org, org).Scan(&role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return tools.ErrServiceAccountNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if org != "" && !roleAtLeast(callerRole(ctx), role) {
+		return fmt.Errorf("%w: a %s cannot remove %s service accounts", tools.ErrAPIKeyScope, callerRole(ctx), role)
+	}
+	if _, err := conn.ExecContext(ctx, `DELETE FROM atombase_service_accounts WHERE id = ?`, id); err != nil {
+		return err
+	}
+	return api.recordAudit(ctx, auditServiceAccountDeleted, "service_account:"+id, map[string]string{})
+}
@@ -0,0 +1,83 @@
+package platform
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/atombasedev/atombase/tools"
+)
+
+func TestServiceAccounts(t *testing.T) {
+	api, db := setupPlatformAPI(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	if _, err := api.createOrg(ctx, CreateOrgRequest{ID: "acme", Name: "Acme"}); err != nil {
+		t.Fatal(err)
+	}
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded := base64.StdEncoding.EncodeToString(publicKey)
+
+	if _, err := api.createServiceAccount(ctx, CreateServiceAccountRequest{Name: "ci", PublicKey: "bm9wZQ==", Verbs: []string{tools.VerbRead}}); err == nil {
+		t.Fatal("expected a short public key to be refused")
+	}
+	account, err := api.createServiceAccount(ctx, CreateServiceAccountRequest{
+		Name: "ci", PublicKey: encoded, Org: "acme", Role: tools.OrgRoleDeveloper, Verbs: []string{tools.VerbRead, tools.VerbWrite, tools.VerbAdmin},
+	})
+	if err != nil || account.Org != "acme" || account.Role != tools.OrgRoleDeveloper || !strings.HasPrefix(account.ID, "sa_") {
+		t.Fatalf("expected an acme developer account, got %#v, %v", account, err)
+	}
+	if _, err := api.createServiceAccount(ctx, CreateServiceAccountRequest{Name: "again", PublicKey: encoded, Verbs: []string{tools.VerbRead}}); err != tools.ErrServiceAccountExists {
+		t.Fatalf("expected a registered public key to be refused, got %v", err)
+	}
+
+	mux := http.NewServeMux()
+	api.RegisterRoutes(mux)
+	handler := tools.SignedAuthMiddleware(api.store.LookupAPIKey, api.store.LookupServiceAccount)(mux)
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if err := tools.SignRequest(req, account.ID, privateKey, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	definition := `{"name": "shop", "type": "global",
+		"schema": {"tables": [{"name": "posts", "pk": ["id"], "columns": {"id": {"name": "id", "type": "INTEGER"}}}]}}`
+	if rec := do(http.MethodPost, "/platform/definitions", definition); rec.Code != http.StatusCreated {
+		t.Fatalf("expected the account to create a definition, got %d %s", rec.Code, rec.Body.String())
+	}
+	if definitions, err := api.listDefinitions(ctx); err != nil || len(definitions) != 1 || definitions[0].Org != "acme" {
+		t.Fatalf("expected the definition to belong to acme, got %#v, %v", definitions, err)
+	}
+	if rec := do(http.MethodGet, "/platform/service-accounts", ""); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), encoded) {
+		t.Fatalf("expected the account to list itself, got %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := do(http.MethodPost, "/platform/service-accounts", `{"name": "more", "publicKey": "`+encoded+`", "verbs": ["read"]}`); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected a developer to be refused managing service accounts, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	if err := api.deleteServiceAccount(ctx, account.ID); err != nil {
+		t.Fatal(err)
+	}
+	if rec := do(http.MethodGet, "/platform/definitions", ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected a removed account to be refused, got %d %s", rec.Code, rec.Body.String())
+	}
+	for action, want := range map[string]int{auditServiceAccountCreated: 1, auditServiceAccountDeleted: 1} {
+		if entries, err := api.listAuditLog(ctx, action, 0); err != nil || len(entries) != want {
+			t.Fatalf("expected %d %s entries, got %v, %v", want, action, entries, err)
+		}
+	}
+}
@@ -0,0 +1,436 @@
+package platform
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/atombasedev/atombase/tools"
+)
+
+// tenantMoveDrain is how long a move waits after pausing writes so requests that
+// resolved their database before the pause can finish writing.
+var tenantMoveDrain = 2 * time.Second
+
+// promoteRowTenant moves a row tenant out of a shared database into a newly
+// provisioned dedicated database on the same definition version. Writes for the
+// user are paused while their rows are copied, and routing switches to the new
+// database in one primary transaction. The rows are then removed from the
+// shared database; if that fails the move still stands and the error is reported.
+func (api *API) promoteRowTenant(ctx context.Context, sharedID, userID string, req PromoteRowTenantRequest) (*TenantMoveResponse, error) {
+	if req.DatabaseID == "" {
+		return nil, tools.InvalidRequestErr("databaseId is required")
+	}
+	if code, msg, _ := tools.ValidateResourceName(req.DatabaseID); code != "" {
+		return nil, tools.InvalidRequestErr(msg)
+	}
+	shared, err := api.requireSharedDatabase(ctx, sharedID)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := api.dbConn()
+	if err != nil {
+		return nil, err
+	}
+	var attached int
+	if err := conn.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM atombase_row_tenants WHERE user_id = ? AND database_id = ?
+	`, userID, sharedID).Scan(&attached); err != nil {
+		return nil, err
+	}
+	if attached == 0 {
+		return nil, tools.InvalidRequestErr("user is not a row tenant of this database")
+	}
+	var exists int
+	if err := conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM atombase_databases WHERE id = ?`, req.DatabaseID).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if exists > 0 {
+		return nil, ErrDatabaseExists
+	}
+	if err := api.checkDatabaseQuota(ctx, shared.Org); err != nil {
+		return nil, err
+	}
+	schema, column, err := api.loadTenantSchema(ctx, shared)
+	if err != nil {
+		return nil, err
+	}
+	sharedToken, err := api.getDatabaseToken(ctx, sharedID)
+	if err != nil {
+		return nil, err
+	}
+	// The dedicated database keeps the residency rule of the shared one.
+	definitionRegions, err := api.loadDefinitionResidency(ctx, shared.DefinitionID)
+	if err != nil {
+		return nil, err
+	}
+	databaseRegions, err := api.loadDatabaseResidency(ctx, sharedID)
+	if err != nil {
+		return nil, err
+	}
+	place, err := placementForRegion(req.Region)
+	if err != nil {
+		return nil, err
+	}
+	if err := api.checkPlacement(ctx, "promote", req.DatabaseID, place, definitionRegions, databaseRegions); err != nil {
+		return nil, err
+	}
+
+	if err := api.beginTenantMove(ctx, userID, sharedID, req.DatabaseID); err != nil {
+		return nil, err
+	}
+	defer api.endTenantMove(userID)
+
+	if err := createTenantDatabaseFn(ctx, req.DatabaseID, place.Group); err != nil {
+		return nil, fmt.Errorf("failed to create tenant database: %w", err)
+	}
+	// Until routing switches, a failed promotion only leaves the new database behind.
+	fail := func(err error) (*TenantMoveResponse, error) {
+		_ = deleteTenantDatabaseFn(ctx, req.DatabaseID)
+		return nil, err
+	}
+	token, err := createTenantTokenFn(ctx, req.DatabaseID)
+	if err != nil {
+		return fail(fmt.Errorf("failed to create database token: %w", err))
+	}
+	if err := batchExecuteWithTokenFn(ctx, req.DatabaseID, token, generateSchemaSQL(schema)); err != nil {
+		return fail(fmt.Errorf("failed to initialize database schema: %w", err))
+	}
+	rows, err := copyTenantBetween(ctx, sharedID, sharedToken, req.DatabaseID, token, schema, column, userID, true)
+	if err != nil {
+		return fail(err)
+	}
+	storedToken := []byte(token)
+	if tools.EncryptionEnabled() {
+		storedToken, err = tools.Encrypt([]byte(token))
+		if err != nil {
+			return fail(err)
+		}
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fail(err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO atombase_databases (id, definition_id, definition_version, auth_token_encrypted, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, req.DatabaseID, shared.DefinitionID, shared.DefinitionVersion, storedToken, now, now); err != nil {
+		return fail(err)
+	}
+	if err := savePlacement(ctx, tx, req.DatabaseID, place, databaseRegions, now); err != nil {
+		return fail(err)
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE atombase_users SET database_id = ?, updated_at = ? WHERE id = ?
+	`, req.DatabaseID, now, userID); err != nil {
+		return fail(err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM atombase_row_tenants WHERE user_id = ?`, userID); err != nil {
+		return fail(err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fail(err)
+	}
+
+	resp := &TenantMoveResponse{UserID: userID, FromDatabaseID: sharedID, ToDatabaseID: req.DatabaseID, Rows: rows}
+	if err := deleteTenantRows(ctx, sharedID, sharedToken, schema, column, userID); err != nil {
+		tools.Logger.Error("failed to remove promoted tenant rows", "database_id", sharedID, "user_id", userID, "error", err)
+		resp.CleanupError = err.Error()
+	}
+	return resp, nil
+}
+
+// demoteDatabase merges a user's dedicated database into a shared database of the
+// same definition version and turns the user into a row tenant of it. Every row is
+// stamped with the user's id; a primary key that collides with another tenant's
+// row aborts the move before routing changes. The dedicated database is deleted
+// once routing has switched.
+func (api *API) demoteDatabase(ctx context.Context, databaseID string, req DemoteDatabaseRequest) (*TenantMoveResponse, error) {
+	if req.SharedDatabaseID == "" {
+		return nil, tools.InvalidRequestErr("sharedDatabaseId is required")
+	}
+	dedicated, err := api.getDatabase(ctx, databaseID)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := api.dbConn()
+	if err != nil {
+		return nil, err
+	}
+	var userID string
+	if err := conn.QueryRowContext(ctx, `SELECT id FROM atombase_users WHERE database_id = ?`, databaseID).Scan(&userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, tools.InvalidRequestErr("database is not dedicated to a user")
+		}
+		return nil, err
+	}
+	shared, err := api.requireSharedDatabase(ctx, req.SharedDatabaseID)
+	if err != nil {
+		return nil, err
+	}
+	if shared.DefinitionID != dedicated.DefinitionID {
+		return nil, tools.InvalidRequestErr("databases must use the same definition")
+	}
+	if shared.DefinitionVersion != dedicated.DefinitionVersion {
+		return nil, tools.InvalidRequestErr(fmt.Sprintf("databases must be on the same definition version (%d and %d)", dedicated.DefinitionVersion, shared.DefinitionVersion))
+	}
+	schema, column, err := api.loadTenantSchema(ctx, shared)
+	if err != nil {
+		return nil, err
+	}
+	dedicatedToken, err := api.getDatabaseToken(ctx, databaseID)
+	if err != nil {
+		return nil, err
+	}
+	sharedToken, err := api.getDatabaseToken(ctx, req.SharedDatabaseID)
+	if err != nil {
+		return nil, err
+	}
+	// The shared database must be placed where the dedicated database's data may live.
+	definitionRegions, err := api.loadDefinitionResidency(ctx, dedicated.DefinitionID)
+	if err != nil {
+		return nil, err
+	}
+	databaseRegions, err := api.loadDatabaseResidency(ctx, databaseID)
+	if err != nil {
+		return nil, err
+	}
+	place, err := api.loadDatabasePlacement(ctx, req.SharedDatabaseID)
+	if err != nil {
+		return nil, err
+	}
+	if err := api.checkPlacement(ctx, "demote", req.SharedDatabaseID, place, definitionRegions, databaseRegions); err != nil {
+		return nil, err
+	}
+
+	if err := api.beginTenantMove(ctx, userID, databaseID, req.SharedDatabaseID); err != nil {
+		return nil, err
+	}
+	defer api.endTenantMove(userID)
+
+	rows, err := copyTenantBetween(ctx, databaseID, dedicatedToken, req.SharedDatabaseID, sharedToken, schema, column, userID, false)
+	if err != nil {
+		return nil, err
+	}
+	// Until routing switches, a failed demotion must take the copied rows back out.
+	fail := func(err error) (*TenantMoveResponse, error) {
+		if cleanupErr := deleteTenantRows(ctx, req.SharedDatabaseID, sharedToken, schema, column, userID); cleanupErr != nil {
+			tools.Logger.Error("failed to remove rows of aborted demotion", "database_id", req.SharedDatabaseID, "user_id", userID, "error", cleanupErr)
+		}
+		return nil, err
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fail(err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE atombase_users SET database_id = NULL, updated_at = ? WHERE id = ?
+	`, now, userID); err != nil {
+		return fail(err)
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO atombase_row_tenants (user_id, database_id, created_at) VALUES (?, ?, ?)
+	`, userID, req.SharedDatabaseID, now); err != nil {
+		return fail(err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM atombase_databases WHERE id = ?`, databaseID); err != nil {
+		return fail(err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fail(err)
+	}
+	tools.InvalidateDatabase(databaseID)
+
+	resp := &TenantMoveResponse{UserID: userID, FromDatabaseID: databaseID, ToDatabaseID: req.SharedDatabaseID, Rows: rows}
+	if err := deleteTenantDatabaseFn(ctx, databaseID); err != nil {
+		tools.Logger.Error("failed to delete demoted database", "database_id", databaseID, "error", err)
+		resp.CleanupError = err.Error()
+	}
+	return resp, nil
+}
+
+// loadTenantSchema returns the schema a database is on and its tenant column.
+func (api *API) loadTenantSchema(ctx context.Context, db *DatabaseRecord) (Schema, string, error) {
+	schema, err := api.loadDefinitionSchema(ctx, db.DefinitionID, db.DefinitionVersion)
+	if err != nil {
+		return Schema{}, "", err
+	}
+	column := tenantColumn(schema)
+	if column == "" {
+		return Schema{}, "", tools.InvalidRequestErr(fmt.Sprintf("version %d of definition %s has no tenant column", db.DefinitionVersion, db.DefinitionName))
+	}
+	return schema, column, nil
+}
+
+// beginTenantMove pauses the user's writes and waits for in-flight requests to
+// drain. Only one move per user can run at a time.
+func (api *API) beginTenantMove(ctx context.Context, userID, fromID, toID string) error {
+	conn, err := api.dbConn()
+	if err != nil {
+		return err
+	}
+	result, err := conn.ExecContext(ctx, `
+		INSERT INTO atombase_tenant_moves (user_id, from_database_id, to_database_id, started_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(user_id) DO NOTHING
+	`, userID, fromID, toID, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return tools.InvalidRequestErr("user is already being moved")
+	}
+	select {
+	case <-time.After(tenantMoveDrain):
+		return nil
+	case <-ctx.Done():
+		api.endTenantMove(userID)
+		return ctx.Err()
+	}
+}
+
+// endTenantMove resumes the user's writes. It runs even when the request context
+// is cancelled so a failed move never leaves writes paused.
+func (api *API) endTenantMove(userID string) {
+	conn, err := api.dbConn()
+	if err != nil {
+		return
+	}
+	if _, err := conn.ExecContext(context.Background(), `DELETE FROM atombase_tenant_moves WHERE user_id = ?`, userID); err != nil {
+		tools.Logger.Error("failed to resume tenant writes", "user_id", userID, "error", err)
+	}
+}
+
+func copyTenantBetween(ctx context.Context, fromID, fromToken, toID, toToken string, schema Schema, column, userID string, scoped bool) (int, error) {
+	src, err := tursoOpenFn(fromID, fromToken)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+	dst, err := tursoOpenFn(toID, toToken)
+	if err != nil {
+		return 0, err
+	}
+	defer dst.Close()
+	rows, err := copyTenantRows(ctx, src, dst, schema, column, userID, scoped)
+	if err != nil {
+		return 0, fmt.Errorf("failed to copy rows from %s to %s: %w", fromID, toID, err)
+	}
+	return rows, nil
+}
+
+// copyTenantRows copies a tenant's rows of every table from src into dst in one
+// transaction and stamps them with the tenant's id. When scoped, only src rows
+// already carrying the id are copied; otherwise every src row belongs to the
+// tenant. Foreign keys are checked at commit so tables can be copied in any order.
+func copyTenantRows(ctx context.Context, src, dst *sql.DB, schema Schema, column, userID string, scoped bool) (int, error) {
+	tx, err := dst.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `PRAGMA defer_foreign_keys = ON`); err != nil {
+		return 0, err
+	}
+
+	copied := 0
+	for _, table := range schema.Tables {
+		columns := storedColumns(table)
+		quoted := make([]string, len(columns))
+		for i, name := range columns {
+			quoted[i] = fmt.Sprintf("[%s]", name)
+		}
+		query := fmt.Sprintf("SELECT %s FROM [%s]", strings.Join(quoted, ", "), table.Name)
+		var args []any
+		if scoped {
+			query += fmt.Sprintf(" WHERE [%s] = ?", column)
+			args = append(args, userID)
+		}
+		insert := fmt.Sprintf("INSERT INTO [%s] (%s) VALUES (%s)", table.Name, strings.Join(quoted, ", "), strings.TrimRight(strings.Repeat("?, ", len(columns)), ", "))
+
+		rows, err := src.QueryContext(ctx, query, args...)
+		if err != nil {
+			return 0, err
+		}
+		for rows.Next() {
+			values := make([]any, len(columns))
+			ptrs := make([]any, len(columns))
+			for i := range values {
+				ptrs[i] = &values[i]
+			}
+			if err := rows.Scan(ptrs...); err != nil {
+				rows.Close()
+				return 0, err
+			}
+			for i, name := range columns {
+				if name == column {
+					values[i] = userID
+				} else if b, ok := values[i].([]byte); ok && !strings.EqualFold(table.Columns[name].Type, "BLOB") {
+					values[i] = string(b)
+				}
+			}
+			if _, err := tx.ExecContext(ctx, insert, values...); err != nil {
+				rows.Close()
+				return 0, fmt.Errorf("%s: %w", table.Name, err)
+			}
+			copied++
+		}
+		if err := rows.Close(); err != nil {
+			return 0, err
+		}
+		if err := rows.Err(); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return copied, nil
+}
+
+// deleteTenantRows removes a tenant's rows from every table of a shared database.
+func deleteTenantRows(ctx context.Context, dbID, token string, schema Schema, column, userID string) error {
+	db, err := tursoOpenFn(dbID, token)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `PRAGMA defer_foreign_keys = ON`); err != nil {
+		return err
+	}
+	for _, table := range schema.Tables {
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM [%s] WHERE [%s] = ?", table.Name, column), userID); err != nil {
+			return fmt.Errorf("%s: %w", table.Name, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// storedColumns returns a table's columns that accept inserted values, in a
+// stable order. Generated columns are computed by the database.
+func storedColumns(table Table) []string {
+	columns := make([]string, 0, len(table.Columns))
+	for name, col := range table.Columns {
+		if col.Generated != nil {
+			continue
+		}
+		columns = append(columns, name)
+	}
+	sort.Strings(columns)
+	return columns
+}
@@ -0,0 +1,129 @@
+package platform
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+func TestTenantMoves_PromoteAndDemote(t *testing.T) {
+	api, db := setupPlatformAPI(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	openTenant := func(name string) *sql.DB {
+		conn, err := sql.Open("sqlite3", filepath.Join(dir, name+".db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return conn
+	}
+	oldOpen, oldCreate, oldDelete, oldToken, oldBatch, oldDrain := tursoOpenFn, createTenantDatabaseFn, deleteTenantDatabaseFn, createTenantTokenFn, batchExecuteWithTokenFn, tenantMoveDrain
+	defer func() {
+		tursoOpenFn, createTenantDatabaseFn, deleteTenantDatabaseFn, createTenantTokenFn, batchExecuteWithTokenFn, tenantMoveDrain = oldOpen, oldCreate, oldDelete, oldToken, oldBatch, oldDrain
+	}()
+	tenantMoveDrain = 0
+	tursoOpenFn = func(name, token string) (*sql.DB, error) { return openTenant(name), nil }
+	createTenantDatabaseFn = func(ctx context.Context, name, group string) error { return nil }
+	var deleted []string
+	deleteTenantDatabaseFn = func(ctx context.Context, name string) error {
+		deleted = append(deleted, name)
+		return nil
+	}
+	createTenantTokenFn = func(ctx context.Context, name string) (string, error) { return "token", nil }
+	batchExecuteWithTokenFn = func(ctx context.Context, name, token string, statements []string) error {
+		conn := openTenant(name)
+		defer conn.Close()
+		for _, stmt := range statements {
+			if _, err := conn.Exec(stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	_, _ = db.Exec(`INSERT INTO atombase_users (id) VALUES ('user-1'), ('user-2')`)
+	if _, err := api.createDefinition(ctx, CreateDefinitionRequest{
+		Name: "notes",
+		Type: "user",
+		Schema: Schema{
+			Tables: []Table{{Name: "notes", Pk: []string{"id"}, Columns: map[string]Col{
+				"id":   {Name: "id", Type: "INTEGER"},
+				"body": {Name: "body", Type: "TEXT"},
+			}}},
+			Settings: &APISettings{TenantColumn: "tenant_id"},
+		},
+	}); err != nil {
+		t.Fatalf("createDefinition failed: %v", err)
+	}
+	if _, err := api.createDatabase(ctx, CreateDatabaseRequest{ID: "shared-db", Definition: "notes", Shared: true}); err != nil {
+		t.Fatalf("createDatabase failed: %v", err)
+	}
+	for _, user := range []string{"user-1", "user-2"} {
+		if _, err := api.attachRowTenant(ctx, "shared-db", user); err != nil {
+			t.Fatalf("attachRowTenant(%s) failed: %v", user, err)
+		}
+	}
+	shared := openTenant("shared-db")
+	defer shared.Close()
+	if _, err := shared.Exec(`INSERT INTO notes (id, body, tenant_id) VALUES (1, 'mine', 'user-1'), (2, 'theirs', 'user-2')`); err != nil {
+		t.Fatal(err)
+	}
+
+	promoted, err := api.promoteRowTenant(ctx, "shared-db", "user-1", PromoteRowTenantRequest{DatabaseID: "user-1-db"})
+	if err != nil {
+		t.Fatalf("promoteRowTenant failed: %v", err)
+	}
+	if promoted.Rows != 1 || promoted.CleanupError != "" {
+		t.Fatalf("unexpected promotion result: %#v", promoted)
+	}
+	dedicated := openTenant("user-1-db")
+	defer dedicated.Close()
+	var body string
+	if err := dedicated.QueryRow(`SELECT body FROM notes WHERE id = 1`).Scan(&body); err != nil || body != "mine" {
+		t.Fatalf("expected promoted row in dedicated database, got %q (%v)", body, err)
+	}
+	assertCount(t, shared, `SELECT COUNT(*) FROM notes`, 1)
+	assertCount(t, db, `SELECT COUNT(*) FROM atombase_users WHERE id = 'user-1' AND database_id = 'user-1-db'`, 1)
+	assertCount(t, db, `SELECT COUNT(*) FROM atombase_row_tenants WHERE user_id = 'user-1'`, 0)
+	assertCount(t, db, `SELECT COUNT(*) FROM atombase_tenant_moves`, 0)
+
+	// A key already used by another tenant aborts the merge without changing routing.
+	if _, err := dedicated.Exec(`INSERT INTO notes (id, body) VALUES (2, 'collides')`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := api.demoteDatabase(ctx, "user-1-db", DemoteDatabaseRequest{SharedDatabaseID: "shared-db"}); err == nil {
+		t.Fatal("expected demotion with a colliding key to fail")
+	}
+	assertCount(t, db, `SELECT COUNT(*) FROM atombase_users WHERE id = 'user-1' AND database_id = 'user-1-db'`, 1)
+	assertCount(t, db, `SELECT COUNT(*) FROM atombase_tenant_moves`, 0)
+	assertCount(t, shared, `SELECT COUNT(*) FROM notes`, 1)
+	if _, err := dedicated.Exec(`DELETE FROM notes WHERE id = 2`); err != nil {
+		t.Fatal(err)
+	}
+
+	demoted, err := api.demoteDatabase(ctx, "user-1-db", DemoteDatabaseRequest{SharedDatabaseID: "shared-db"})
+	if err != nil {
+		t.Fatalf("demoteDatabase failed: %v", err)
+	}
+	if demoted.Rows != 1 || len(deleted) != 1 || deleted[0] != "user-1-db" {
+		t.Fatalf("unexpected demotion result: %#v (deleted %v)", demoted, deleted)
+	}
+	assertCount(t, shared, `SELECT COUNT(*) FROM notes WHERE tenant_id = 'user-1'`, 1)
+	assertCount(t, db, `SELECT COUNT(*) FROM atombase_row_tenants WHERE user_id = 'user-1' AND database_id = 'shared-db'`, 1)
+	assertCount(t, db, `SELECT COUNT(*) FROM atombase_databases WHERE id = 'user-1-db'`, 0)
+	assertCount(t, db, `SELECT COUNT(*) FROM atombase_users WHERE id = 'user-1' AND database_id IS NULL`, 1)
+}
+
+func assertCount(t *testing.T, db *sql.DB, query string, want int) {
+	t.Helper()
+	var got int
+	if err := db.QueryRow(query).Scan(&got); err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	if got != want {
+		t.Fatalf("%s = %d, want %d", query, got, want)
+	}
+}
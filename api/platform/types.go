@@ -1,15 +1,37 @@
 package platform
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 import "github.com/atombasedev/atombase/definitions"
 import sharedschema "github.com/atombasedev/atombase/schema"
+import "github.com/atombasedev/atombase/tools"
 
 type Schema = sharedschema.Schema
 type Table = sharedschema.Table
+type View = sharedschema.View
 type Index = sharedschema.Index
 type Col = sharedschema.Col
 type Generated = sharedschema.Generated
+type APISettings = sharedschema.APISettings
+type BackupPolicy = sharedschema.BackupPolicy
+type TableValidation = sharedschema.TableValidation
+type ColumnRule = sharedschema.ColumnRule
+type FieldRule = sharedschema.FieldRule
+type LocalizedFields = sharedschema.LocalizedFields
+type LocalizedField = sharedschema.LocalizedField
+type Function = sharedschema.Function
+type FunctionParam = sharedschema.FunctionParam
+type NamingPolicy = sharedschema.NamingPolicy
+type RateLimit = sharedschema.RateLimit
+type PresenceChannel = sharedschema.PresenceChannel
+type BroadcastChannel = sharedschema.BroadcastChannel
+type ConflictRule = sharedschema.ConflictRule
+type TimeSeries = sharedschema.TimeSeries
+type Rollup = sharedschema.Rollup
+type Aggregate = sharedschema.Aggregate
 
 type DefinitionType = definitions.DefinitionType
 type Definition = definitions.Definition
@@ -19,14 +41,46 @@ type OperationPolicy = definitions.OperationPolicy
 type ManagementPermission = definitions.ManagementPermission
 type ManagementPolicy = definitions.ManagementPolicy
 type ManagementMap = definitions.ManagementMap
+type TestCase = definitions.TestCase
+type MigrationWindow = tools.MigrationWindow
+type DatabaseSchedule = tools.DatabaseSchedule
 type DefinitionVersion struct {
-	ID           int32      `json:"id"`
-	DefinitionID int32      `json:"definitionId"`
-	Version      int        `json:"version"`
-	Schema       Schema     `json:"schema"`
-	Provision    *Condition `json:"provision,omitempty"`
-	Checksum     string     `json:"checksum"`
-	CreatedAt    time.Time  `json:"createdAt"`
+	ID           int32             `json:"id"`
+	DefinitionID int32             `json:"definitionId"`
+	Version      int               `json:"version"`
+	Schema       Schema            `json:"schema"`
+	Provision    *Condition        `json:"provision,omitempty"`
+	Tests        []TestCase        `json:"tests,omitempty"`
+	Checksum     string            `json:"checksum"`
+	CreatedAt    time.Time         `json:"createdAt"`
+	Windows      []MigrationWindow `json:"windows,omitempty"`
+	// Impact estimates the migration's cost on existing databases. It is
+	// only set on the response of the push or migrate that published it.
+	Impact *MigrationImpact `json:"impact,omitempty"`
+}
+
+// MigrationImpact estimates what a migration costs the databases of a
+// definition, so operators can plan a window for it. Seconds assume the
+// databases migrate one at a time; they migrate lazily on first request.
+type MigrationImpact struct {
+	Databases      int            `json:"databases"`
+	Estimated      int            `json:"estimated"` // Databases whose stats could be read
+	RebuiltTables  []string       `json:"rebuiltTables,omitempty"`
+	TotalRows      int64          `json:"totalRows"` // Rows copied, updated or indexed
+	TotalSeconds   float64        `json:"totalSeconds"`
+	MaxSeconds     float64        `json:"maxSeconds"`
+	TotalTempBytes int64          `json:"totalTempBytes"` // Extra storage while rebuilt tables exist twice
+	MaxTempBytes   int64          `json:"maxTempBytes"`
+	Tenants        []TenantImpact `json:"tenants"`
+}
+
+// TenantImpact is the estimated cost of a migration on one database.
+type TenantImpact struct {
+	DatabaseID string  `json:"databaseId"`
+	Rows       int64   `json:"rows"`
+	Seconds    float64 `json:"seconds"`
+	TempBytes  int64   `json:"tempBytes"`
+	Error      string  `json:"error,omitempty"`
 }
 
 type CreateDefinitionRequest struct {
@@ -37,22 +91,66 @@ type CreateDefinitionRequest struct {
 	Provision  *definitions.Condition     `json:"provision,omitempty"`
 	Schema     Schema                     `json:"schema"`
 	Access     definitions.AccessMap      `json:"access"`
+	Tests      []definitions.TestCase     `json:"tests,omitempty"`
+	Source     *DefinitionSource          `json:"source,omitempty"` // Fetch the definition from here; name and type set alongside override it
+	Org        string                     `json:"org,omitempty"`    // Platform organization to own it; set by the caller's key when it has one
+}
+
+// DefinitionSource is a definition document published outside the platform:
+// the JSON body of a create request, served over HTTP(S) or as a single-layer
+// OCI artifact. SHA256 pins the exact document to install.
+type DefinitionSource struct {
+	URL    string `json:"url"`    // https://... or oci://registry/repository:tag
+	SHA256 string `json:"sha256"` // Hex sha256 of the document
+}
+
+// PullDefinitionRequest is the request body for POST /platform/definitions/{name}/pull.
+type PullDefinitionRequest struct {
+	URL        string                      `json:"url,omitempty"` // Switch to another source (defaults to the one installed from)
+	SHA256     string                      `json:"sha256"`        // Pin reported by the preview
+	Merge      []Merge                     `json:"merge,omitempty"`
+	SampleData map[string][]map[string]any `json:"sampleData,omitempty"`
+	Windows    []MigrationWindow           `json:"windows,omitempty"`
+}
+
+// DefinitionPullPreview is what pulling a definition's source would change.
+type DefinitionPullPreview struct {
+	URL           string       `json:"url"`
+	SHA256        string       `json:"sha256"`                  // Pin to send when applying the pull
+	CurrentSHA256 string       `json:"currentSha256,omitempty"` // Pin of the document installed now
+	Changes       []SchemaDiff `json:"changes"`
+	SQL           []string     `json:"sql"` // Migration a pull without merges would run
 }
 
 type PushDefinitionRequest struct {
-	Schema     Schema                    `json:"schema"`
-	Access     definitions.AccessMap     `json:"access"`
+	Schema     Schema                      `json:"schema"`
+	Access     definitions.AccessMap       `json:"access"`
+	Management definitions.ManagementMap   `json:"management,omitempty"`
+	Provision  *definitions.Condition      `json:"provision,omitempty"`
+	Merge      []Merge                     `json:"merge,omitempty"`
+	Tests      []definitions.TestCase      `json:"tests,omitempty"`
+	SampleData map[string][]map[string]any `json:"sampleData,omitempty"` // Rows seeded into the scratch database before verifying the plan
+	Windows    []MigrationWindow           `json:"windows,omitempty"`    // Times of day existing databases may migrate in
+}
+
+// MigrateDefinitionRequest is the request body for POST /platform/definitions/{name}/migrate.
+// Omitted policies and tests carry over from the current version.
+type MigrateDefinitionRequest struct {
+	SQL        []string                  `json:"sql"`
+	Access     definitions.AccessMap     `json:"access,omitempty"`
 	Management definitions.ManagementMap `json:"management,omitempty"`
 	Provision  *definitions.Condition    `json:"provision,omitempty"`
-	Merge      []Merge                   `json:"merge,omitempty"`
+	Tests      []definitions.TestCase    `json:"tests,omitempty"`
+	Windows    []MigrationWindow         `json:"windows,omitempty"` // Times of day existing databases may migrate in
 }
 
 // SchemaDiff represents a single schema modification.
 type SchemaDiff struct {
 	Type string `json:"type"` // add_table, drop_table, rename_table,
 	// add_column, drop_column, rename_column, modify_column,
-	// add_index, drop_index, add_fts, drop_fts,
-	// change_pk_type (requires mirror table)
+	// add_index, drop_index, add_fts, drop_fts, add_geo, drop_geo, add_sync, drop_sync,
+	// add_time_series, drop_time_series,
+	// change_pk_type (requires mirror table), add_view, drop_view
 	Table  string `json:"table,omitempty"`  // Table name
 	Column string `json:"column,omitempty"` // Column name (for column changes)
 }
@@ -76,19 +174,20 @@ type MigrationPlan struct {
 
 // Migration tracks both the SQL and execution state.
 type Migration struct {
-	ID           int64      `json:"id"`
-	DefinitionID int32      `json:"definitionId"`
-	FromVersion  int        `json:"fromVersion"`
-	ToVersion    int        `json:"toVersion"`
-	SQL          []string   `json:"sql"`    // Migration SQL statements
-	Status       string     `json:"status"` // pending, running, paused, complete
-	State        *string    `json:"state"`  // null, success, partial, failed
-	TotalDBs     int        `json:"totalDbs"`
-	CompletedDBs int        `json:"completedDbs"`
-	FailedDBs    int        `json:"failedDbs"`
-	StartedAt    *time.Time `json:"startedAt,omitempty"`
-	CompletedAt  *time.Time `json:"completedAt,omitempty"`
-	CreatedAt    time.Time  `json:"createdAt"`
+	ID           int64             `json:"id"`
+	DefinitionID int32             `json:"definitionId"`
+	FromVersion  int               `json:"fromVersion"`
+	ToVersion    int               `json:"toVersion"`
+	SQL          []string          `json:"sql"` // Migration SQL statements
+	Windows      []MigrationWindow `json:"windows,omitempty"`
+	Status       string            `json:"status"` // pending, running, paused, complete
+	State        *string           `json:"state"`  // null, success, partial, failed
+	TotalDBs     int               `json:"totalDbs"`
+	CompletedDBs int               `json:"completedDbs"`
+	FailedDBs    int               `json:"failedDbs"`
+	StartedAt    *time.Time        `json:"startedAt,omitempty"`
+	CompletedAt  *time.Time        `json:"completedAt,omitempty"`
+	CreatedAt    time.Time         `json:"createdAt"`
 }
 
 // Migration status constants.
@@ -112,6 +211,49 @@ const (
 	DatabaseMigrationStatusFailed  = "failed"
 )
 
+// RollbackMigrationRequest is the request body for POST /platform/migrations/{id}/rollback-applied.
+// Merge resolves drop+add pairs of the inverse plan into renames, as in a push.
+type RollbackMigrationRequest struct {
+	Merge []Merge `json:"merge,omitempty"`
+}
+
+// RollbackDatabaseResult reports the rollback of one database.
+type RollbackDatabaseResult struct {
+	ID     string `json:"id"`
+	Status string `json:"status"` // success, failed
+	Error  string `json:"error,omitempty"`
+}
+
+// RollbackMigrationResponse is the response for POST /platform/migrations/{id}/rollback-applied.
+type RollbackMigrationResponse struct {
+	MigrationID int64                    `json:"migrationId"`
+	FromVersion int                      `json:"fromVersion"`
+	ToVersion   int                      `json:"toVersion"`
+	Databases   []RollbackDatabaseResult `json:"databases"` // Only databases that had applied the migration
+	Retracted   bool                     `json:"retracted"` // Whether the rolled back version was removed from history
+}
+
+// PruneHistoryResponse is the response for DELETE /platform/definitions/{name}/history.
+type PruneHistoryResponse struct {
+	Definition string `json:"definition"`
+	Kept       []int  `json:"kept"`
+	Pruned     []int  `json:"pruned"`
+}
+
+// MigrationFile is one numbered SQL file of a migration export.
+type MigrationFile struct {
+	Name    string `json:"name"`
+	Version int    `json:"version,omitempty"`
+	SQL     string `json:"sql"`
+}
+
+// MigrationExport is the response for GET /platform/definitions/{name}/migrations/export.
+type MigrationExport struct {
+	Definition string          `json:"definition"`
+	Layout     string          `json:"layout"` // golang-migrate or atlas
+	Files      []MigrationFile `json:"files"`
+}
+
 // ValidationError represents a pre-migration validation error.
 type ValidationError struct {
 	Type    string `json:"type"`             // syntax, fk_reference, not_null, unique, check, fk_constraint
@@ -134,6 +276,7 @@ type DatabaseRecord struct {
 	OwnerID           string    `json:"ownerId,omitempty"`
 	OrganizationID    string    `json:"organizationId,omitempty"`
 	OrganizationName  string    `json:"organizationName,omitempty"`
+	Org               string    `json:"org,omitempty"` // Platform organization that owns the definition
 }
 
 // RetryMigrationResponse is retained for internal compatibility.
@@ -144,13 +287,308 @@ type RetryMigrationResponse struct {
 
 // CreateDatabaseRequest is the request body for POST /platform/databases.
 type CreateDatabaseRequest struct {
-	ID               string `json:"id"`
-	Definition       string `json:"definition"`
-	UserID           string `json:"userId,omitempty"`
-	OrganizationID   string `json:"organizationId,omitempty"`
-	OrganizationName string `json:"organizationName,omitempty"`
-	OwnerID          string `json:"ownerId,omitempty"`
-	MaxMembers       *int   `json:"maxMembers,omitempty"`
+	ID               string   `json:"id"`
+	Definition       string   `json:"definition"`
+	UserID           string   `json:"userId,omitempty"`
+	OrganizationID   string   `json:"organizationId,omitempty"`
+	OrganizationName string   `json:"organizationName,omitempty"`
+	OwnerID          string   `json:"ownerId,omitempty"`
+	MaxMembers       *int     `json:"maxMembers,omitempty"`
+	Shared           bool     `json:"shared,omitempty"`         // Holds row tenants of a user definition instead of one user
+	Region           string   `json:"region,omitempty"`         // Region to place the database in (default: the default Turso group's region)
+	AllowedRegions   []string `json:"allowedRegions,omitempty"` // Residency rule for this database, on top of the definition's
+}
+
+// AttachRowTenantRequest is the request body for POST /platform/databases/{id}/tenants.
+type AttachRowTenantRequest struct {
+	UserID string `json:"userId"`
+}
+
+// PromoteRowTenantRequest is the request body for
+// POST /platform/databases/{id}/tenants/{userId}/promote.
+type PromoteRowTenantRequest struct {
+	DatabaseID string `json:"databaseId"`       // ID of the dedicated database to provision
+	Region     string `json:"region,omitempty"` // Region to place it in (default: the default Turso group's region)
+}
+
+// DemoteDatabaseRequest is the request body for POST /platform/databases/{id}/demote.
+type DemoteDatabaseRequest struct {
+	SharedDatabaseID string `json:"sharedDatabaseId"`
+}
+
+// TenantMoveResponse reports a user moved between a shared and a dedicated database.
+type TenantMoveResponse struct {
+	UserID         string `json:"userId"`
+	FromDatabaseID string `json:"fromDatabaseId"`
+	ToDatabaseID   string `json:"toDatabaseId"`
+	Rows           int    `json:"rows"`                   // Rows copied to the destination
+	CleanupError   string `json:"cleanupError,omitempty"` // Set when the source could not be cleaned up after routing switched
+}
+
+// RowTenant is a user whose rows live in a shared database.
+type RowTenant struct {
+	UserID     string    `json:"userId"`
+	DatabaseID string    `json:"databaseId"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// ResidencyRules is the request and response body of the definition and database
+// residency endpoints. An empty Regions list means no restriction.
+type ResidencyRules struct {
+	Regions []string `json:"regions"`
+	Region  string   `json:"region,omitempty"` // Where the database is placed, for database rules
+}
+
+// JWTKey is a key that verifies the JWTs a tenant app issues for one database.
+// Secret is only returned when the server generated it.
+type JWTKey struct {
+	ID         string    `json:"id"` // The kid tokens must carry
+	DatabaseID string    `json:"databaseId"`
+	Algorithm  string    `json:"algorithm"`
+	Secret     string    `json:"secret,omitempty"`
+	PublicKey  string    `json:"publicKey,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// CreateJWTKeyRequest is the body of POST /platform/databases/{id}/jwt-keys.
+// HS256 keys take a secret, generated when empty; RS256 keys take a PEM
+// public key.
+type CreateJWTKeyRequest struct {
+	Algorithm string `json:"algorithm"`
+	Secret    string `json:"secret,omitempty"`
+	PublicKey string `json:"publicKey,omitempty"`
+}
+
+// Webhook is a URL called when rows of a database change through the Data
+// API. An empty Table matches every table. Secret signs deliveries and is
+// only returned when the webhook is created.
+type Webhook struct {
+	ID         string    `json:"id"`
+	DatabaseID string    `json:"databaseId"`
+	Table      string    `json:"table,omitempty"`
+	Events     []string  `json:"events"` // insert, upsert, update, delete
+	URL        string    `json:"url"`
+	Secret     string    `json:"secret,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// CreateWebhookRequest is the body of POST /platform/databases/{id}/webhooks.
+// Without events the webhook is called for every write.
+type CreateWebhookRequest struct {
+	URL    string   `json:"url"`
+	Table  string   `json:"table,omitempty"`
+	Events []string `json:"events,omitempty"`
+}
+
+// WebhookDelivery is one queued or sent call of a webhook.
+type WebhookDelivery struct {
+	ID             int64           `json:"id"`
+	WebhookID      string          `json:"webhookId"`
+	Event          string          `json:"event"`
+	Table          string          `json:"table"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"` // pending, delivered, failed
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  *time.Time      `json:"nextAttemptAt,omitempty"` // Set while pending
+	ResponseStatus *int            `json:"responseStatus,omitempty"`
+	Error          string          `json:"error,omitempty"` // Last failure
+	CreatedAt      time.Time       `json:"createdAt"`
+	DeliveredAt    *time.Time      `json:"deliveredAt,omitempty"`
+}
+
+// APIKey is a service key limited to a database, tables and verbs. An empty
+// DatabaseID or Tables means any. A key with an Org only reaches that
+// platform organization, with its Role. Member is set on the key an org
+// member got by accepting an invitation. Key, the bearer token, is only
+// returned when the key is created.
+type APIKey struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	Org        string    `json:"org,omitempty"`
+	Role       string    `json:"role,omitempty"`
+	Member     string    `json:"member,omitempty"`
+	DatabaseID string    `json:"databaseId,omitempty"`
+	Tables     []string  `json:"tables"`
+	Verbs      []string  `json:"verbs"`
+	Key        string    `json:"key,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// CreateAPIKeyRequest is the body of POST /platform/keys. Verbs are read,
+// write, admin and override_quotas. Keys created by an org key always belong
+// to its org and take its role unless a lower one is given. Org keys the
+// service key creates default to owner.
+type CreateAPIKeyRequest struct {
+	Name       string   `json:"name"`
+	Org        string   `json:"org,omitempty"`
+	Role       string   `json:"role,omitempty"`
+	DatabaseID string   `json:"databaseId,omitempty"`
+	Tables     []string `json:"tables,omitempty"`
+	Verbs      []string `json:"verbs"`
+}
+
+// ServiceAccount is a machine identity that signs its requests with an
+// Ed25519 key instead of sending a bearer token. Only the public key, base64
+// encoded, is stored. Its scope works like an APIKey's.
+type ServiceAccount struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	PublicKey  string    `json:"publicKey"`
+	Org        string    `json:"org,omitempty"`
+	Role       string    `json:"role,omitempty"`
+	DatabaseID string    `json:"databaseId,omitempty"`
+	Tables     []string  `json:"tables"`
+	Verbs      []string  `json:"verbs"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// CreateServiceAccountRequest is the body of POST /platform/service-accounts.
+// PublicKey is the base64 of a 32 byte Ed25519 public key; the scope fields
+// follow CreateAPIKeyRequest.
+type CreateServiceAccountRequest struct {
+	Name       string   `json:"name"`
+	PublicKey  string   `json:"publicKey"`
+	Org        string   `json:"org,omitempty"`
+	Role       string   `json:"role,omitempty"`
+	DatabaseID string   `json:"databaseId,omitempty"`
+	Tables     []string `json:"tables,omitempty"`
+	Verbs      []string `json:"verbs"`
+}
+
+// PlatformOrg is a customer of a multi-organization deployment. It owns
+// definitions, their databases and API keys. Quotas of 0 are unlimited.
+type PlatformOrg struct {
+	ID             string    `json:"id"`
+	Name           string    `json:"name"`
+	MaxDefinitions int       `json:"maxDefinitions"`
+	MaxDatabases   int       `json:"maxDatabases"`
+	Definitions    int       `json:"definitions"`
+	Databases      int       `json:"databases"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+// CreateOrgRequest is the body of POST /platform/orgs.
+type CreateOrgRequest struct {
+	ID             string `json:"id"`
+	Name           string `json:"name"`
+	MaxDefinitions int    `json:"maxDefinitions,omitempty"`
+	MaxDatabases   int    `json:"maxDatabases,omitempty"`
+}
+
+// UpdateOrgRequest is the body of PATCH /platform/orgs/{id}. Omitted fields
+// are unchanged.
+type UpdateOrgRequest struct {
+	Name           *string `json:"name,omitempty"`
+	MaxDefinitions *int    `json:"maxDefinitions,omitempty"`
+	MaxDatabases   *int    `json:"maxDatabases,omitempty"`
+}
+
+// OrgMember is a person in a platform organization. Their keys follow their
+// role and are revoked when they are removed.
+type OrgMember struct {
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// OrgInvitation invites an email address to a platform organization. Token
+// is only returned when the invitation is created.
+type OrgInvitation struct {
+	ID        string    `json:"id"`
+	Org       string    `json:"org"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	InvitedBy string    `json:"invitedBy"`
+	Token     string    `json:"token,omitempty"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// CreateInvitationRequest is the body of POST /platform/orgs/{id}/invitations.
+type CreateInvitationRequest struct {
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+// UpdateMemberRequest is the body of PATCH /platform/orgs/{id}/members/{email}.
+type UpdateMemberRequest struct {
+	Role string `json:"role"`
+}
+
+// AcceptInvitationRequest is the body of POST /platform/invitations/accept.
+type AcceptInvitationRequest struct {
+	Token string `json:"token"`
+}
+
+// AcceptedInvitation is the new member and the API key they use the platform
+// API with.
+type AcceptedInvitation struct {
+	Org    string    `json:"org"`
+	Member OrgMember `json:"member"`
+	Key    APIKey    `json:"key"`
+}
+
+// AuditEntry is one record of the platform audit log.
+type AuditEntry struct {
+	ID        int64           `json:"id"`
+	Action    string          `json:"action"`
+	Target    string          `json:"target"`
+	Detail    json.RawMessage `json:"detail"`
+	CreatedAt time.Time       `json:"createdAt"`
+}
+
+// AdoptDatabaseRequest is the request body for POST /platform/databases/adopt.
+// Type is only used when the definition does not exist yet.
+type AdoptDatabaseRequest struct {
+	ID         string         `json:"id"`
+	Definition string         `json:"definition"`
+	Type       DefinitionType `json:"type,omitempty"`
+	UserID     string         `json:"userId,omitempty"`
+}
+
+// AdoptDatabaseResponse is the response for POST /platform/databases/adopt.
+type AdoptDatabaseResponse struct {
+	Database          *DatabaseRecord `json:"database"`
+	MatchedVersion    int             `json:"matchedVersion"`
+	CreatedDefinition bool            `json:"createdDefinition"`
+	Drift             []SchemaDiff    `json:"drift"` // Differences between the database and the matched version
+}
+
+// ImportDatabaseResponse is the response for POST /platform/databases/{id}/import
+// and POST /platform/backups/{id}/restore.
+type ImportDatabaseResponse struct {
+	Database string           `json:"database"`
+	Version  int              `json:"version"` // Definition version the import was checked against
+	Mode     string           `json:"mode"`
+	DryRun   bool             `json:"dryRun"`
+	Valid    bool             `json:"valid"`
+	Changes  []SchemaDiff     `json:"changes"` // Differences between the import and the version's schema
+	Tables   map[string]int64 `json:"tables"`  // Rows of each table in the import
+	Rows     int64            `json:"rows"`
+}
+
+// RestoreDatabaseResponse is the response for POST
+// /platform/databases/{id}/restore: the import of the rebuilt database, with
+// the backup it was rebuilt from and the logged changes replayed onto it.
+type RestoreDatabaseResponse struct {
+	ImportDatabaseResponse
+	At       time.Time `json:"at"`
+	Backup   string    `json:"backup"`
+	Replayed int64     `json:"replayed"`
+}
+
+// Backup is a snapshot of a database taken on its definition's backup
+// schedule. It is listed with GET /platform/backups.
+type Backup struct {
+	ID         string     `json:"id"`
+	DatabaseID string     `json:"databaseId"`
+	Version    int        `json:"version"`  // Definition version the database was on
+	Location   string     `json:"location"` // local or s3
+	Size       int64      `json:"size"`     // Bytes of the SQLite file
+	Status     string     `json:"status"`   // running, done or failed
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
 }
 
 // SyncDatabaseResponse is the response for POST /platform/databases/{name}/sync.
@@ -4,8 +4,14 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"sort"
 	"strings"
 
+	"github.com/atombasedev/atombase/definitions"
+	"github.com/atombasedev/atombase/tools"
 	_ "github.com/mattn/go-sqlite3"
 )
 
@@ -15,6 +21,487 @@ type ValidationResult struct {
 	Errors []ValidationError `json:"errors,omitempty"`
 }
 
+// Filter operators the Data API understands, for validating APISettings.AllowedOperators.
+var apiFilterOperators = map[string]bool{
+	"eq": true, "neq": true, "lt": true, "lte": true, "gt": true, "gte": true,
+	"like": true, "ilike": true, "glob": true, "between": true, "not": true, "in": true,
+	"is": true, "fts": true, "or": true, "and": true, "near": true, "bbox": true,
+}
+
+// validateGeoColumns checks the tables that index a location. The R*Tree is
+// keyed by the row's primary key, so it has to be a single INTEGER column.
+func validateGeoColumns(schema Schema) error {
+	for _, table := range schema.Tables {
+		if len(table.GeoColumns) == 0 {
+			continue
+		}
+		if len(table.GeoColumns) != 2 || table.GeoColumns[0] == table.GeoColumns[1] {
+			return fmt.Errorf("table %s: geoColumns must name a latitude and a longitude column", table.Name)
+		}
+		for _, name := range table.GeoColumns {
+			col, ok := table.Columns[name]
+			if !ok {
+				return fmt.Errorf("table %s: geoColumns: unknown column %s", table.Name, name)
+			}
+			if colType := strings.ToUpper(col.Type); colType != "REAL" && colType != "INTEGER" {
+				return fmt.Errorf("table %s: geoColumns: column %s must be REAL or INTEGER", table.Name, name)
+			}
+		}
+		if len(table.Pk) != 1 || !strings.EqualFold(table.Columns[table.Pk[0]].Type, "INTEGER") {
+			return fmt.Errorf("table %s: geoColumns need a single INTEGER primary key", table.Name)
+		}
+	}
+	return nil
+}
+
+// validateSyncTables checks the tables that log their changes for offline
+// sync. The log keys a row by its primary key, so it has to be one column.
+func validateSyncTables(schema Schema) error {
+	for _, table := range schema.Tables {
+		if table.Sync && len(table.Pk) != 1 {
+			return fmt.Errorf("table %s: sync needs a single-column primary key", table.Name)
+		}
+	}
+	return nil
+}
+
+// validateTimeSeriesTables checks the tables partitioned by month. Search,
+// geo and sync indexes would only cover the current month's rows, so a
+// time-series table can't have them.
+func validateTimeSeriesTables(schema Schema) error {
+	for _, table := range schema.Tables {
+		ts := table.TimeSeries
+		if ts == nil {
+			continue
+		}
+		col, ok := table.Columns[ts.Column]
+		if !ok {
+			return fmt.Errorf("table %s: timeSeries column %q does not exist", table.Name, ts.Column)
+		}
+		if typ := strings.ToUpper(col.Type); typ != "INTEGER" && typ != "TEXT" {
+			return fmt.Errorf("table %s: timeSeries column %s must be INTEGER or TEXT", table.Name, ts.Column)
+		}
+		if ts.Retention < 0 {
+			return fmt.Errorf("table %s: timeSeries retention cannot be negative", table.Name)
+		}
+		if ts.Archive && ts.Retention == 0 {
+			return fmt.Errorf("table %s: timeSeries archive needs a retention", table.Name)
+		}
+		if len(table.FTSColumns) > 0 || len(table.GeoColumns) > 0 || table.Sync {
+			return fmt.Errorf("table %s: a timeSeries table cannot have ftsColumns, geoColumns or sync", table.Name)
+		}
+		if err := validateRollups(table); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateRollups checks a time-series table's rollups. Each rollup's
+// columns are its interval, named after the time column, then its groupBy
+// columns and its aggregates, so their names must not clash.
+func validateRollups(table Table) error {
+	ts := table.TimeSeries
+	resolutions := make(map[string]bool, len(ts.Rollups))
+	for _, rollup := range ts.Rollups {
+		if _, ok := definitions.RollupSeconds[rollup.Resolution]; !ok {
+			return fmt.Errorf("table %s: rollup resolution must be minute, hour or day, got %q", table.Name, rollup.Resolution)
+		}
+		if resolutions[rollup.Resolution] {
+			return fmt.Errorf("table %s: more than one %s rollup", table.Name, rollup.Resolution)
+		}
+		resolutions[rollup.Resolution] = true
+		if len(rollup.Aggregates) == 0 {
+			return fmt.Errorf("table %s: %s rollup has no aggregates", table.Name, rollup.Resolution)
+		}
+		names := map[string]bool{ts.Column: true}
+		for _, column := range rollup.GroupBy {
+			if _, ok := table.Columns[column]; !ok || names[column] {
+				return fmt.Errorf("table %s: %s rollup cannot group by %q", table.Name, rollup.Resolution, column)
+			}
+			names[column] = true
+		}
+		for _, name := range sortedKeys(rollup.Aggregates) {
+			agg := rollup.Aggregates[name]
+			if err := tools.ValidateIdentifier(name); err != nil || names[name] {
+				return fmt.Errorf("table %s: %s rollup cannot name an aggregate %q", table.Name, rollup.Resolution, name)
+			}
+			names[name] = true
+			switch agg.Fn {
+			case "count":
+			case "sum", "avg", "min", "max":
+				if agg.Column == "" {
+					return fmt.Errorf("table %s: %s rollup aggregate %s needs a column", table.Name, rollup.Resolution, name)
+				}
+			default:
+				return fmt.Errorf("table %s: %s rollup aggregate %s has unknown fn %q", table.Name, rollup.Resolution, name, agg.Fn)
+			}
+			if _, ok := table.Columns[agg.Column]; agg.Column != "" && !ok {
+				return fmt.Errorf("table %s: %s rollup aggregate %s reads unknown column %q", table.Name, rollup.Resolution, name, agg.Column)
+			}
+		}
+	}
+	return nil
+}
+
+// validateAPISettings checks a schema's Data API settings against its tables.
+// Soft delete columns must exist and be nullable since NULL marks live rows.
+func validateAPISettings(schema Schema) error {
+	settings := schema.Settings
+	if settings == nil {
+		return nil
+	}
+	if settings.DefaultLimit != nil && *settings.DefaultLimit < 0 {
+		return fmt.Errorf("settings.defaultLimit cannot be negative")
+	}
+	if settings.MaxLimit != nil && *settings.MaxLimit < 1 {
+		return fmt.Errorf("settings.maxLimit must be at least 1")
+	}
+	if settings.DefaultLimit != nil && settings.MaxLimit != nil && *settings.DefaultLimit > *settings.MaxLimit {
+		return fmt.Errorf("settings.defaultLimit cannot exceed settings.maxLimit")
+	}
+	for _, op := range settings.AllowedOperators {
+		if !apiFilterOperators[op] {
+			return fmt.Errorf("settings.allowedOperators: unknown operator %q", op)
+		}
+	}
+	tables := make(map[string]Table, len(schema.Tables))
+	for _, table := range schema.Tables {
+		tables[table.Name] = table
+	}
+	for tableName, column := range settings.SoftDelete {
+		table, ok := tables[tableName]
+		if !ok {
+			return fmt.Errorf("settings.softDelete: unknown table %q", tableName)
+		}
+		col, ok := table.Columns[column]
+		if !ok {
+			return fmt.Errorf("settings.softDelete: unknown column %s.%s", tableName, column)
+		}
+		if col.NotNull {
+			return fmt.Errorf("settings.softDelete: column %s.%s must be nullable", tableName, column)
+		}
+	}
+	if settings.TenantColumn != "" {
+		if err := tools.ValidateColumnName(settings.TenantColumn); err != nil {
+			return fmt.Errorf("settings.tenantColumn: %w", err)
+		}
+		for _, table := range schema.Tables {
+			col, ok := table.Columns[settings.TenantColumn]
+			if !ok {
+				return fmt.Errorf("settings.tenantColumn: table %s has no column %s", table.Name, settings.TenantColumn)
+			}
+			if !strings.EqualFold(col.Type, "TEXT") {
+				return fmt.Errorf("settings.tenantColumn: column %s.%s must be TEXT", table.Name, settings.TenantColumn)
+			}
+		}
+		for _, view := range schema.Views {
+			if _, ok := view.Columns[settings.TenantColumn]; !ok {
+				return fmt.Errorf("settings.tenantColumn: view %s must select column %s", view.Name, settings.TenantColumn)
+			}
+		}
+	}
+	for tableName, validation := range settings.Validation {
+		table, ok := tables[tableName]
+		if !ok {
+			return fmt.Errorf("settings.validation: unknown table %q", tableName)
+		}
+		if err := validateTableValidation(table, validation); err != nil {
+			return fmt.Errorf("settings.validation.%s: %w", tableName, err)
+		}
+	}
+	if settings.DefaultLanguage != "" {
+		if err := tools.ValidateLanguageTag(settings.DefaultLanguage); err != nil {
+			return fmt.Errorf("settings.defaultLanguage: %w", err)
+		}
+	}
+	if len(settings.Localized) > 0 && settings.DefaultLanguage == "" {
+		return fmt.Errorf("settings.localized requires settings.defaultLanguage")
+	}
+	for tableName, fields := range settings.Localized {
+		table, ok := tables[tableName]
+		if !ok {
+			return fmt.Errorf("settings.localized: unknown table %q", tableName)
+		}
+		for name, field := range fields {
+			if err := validateLocalizedField(table, name, field, settings.DefaultLanguage); err != nil {
+				return fmt.Errorf("settings.localized.%s.%s: %w", tableName, name, err)
+			}
+		}
+	}
+	for _, shape := range settings.QueryAllowlist {
+		fields := strings.Fields(shape)
+		if len(fields) < 2 || strings.Join(fields, " ") != shape {
+			return fmt.Errorf("settings.queryAllowlist: malformed query shape %q", shape)
+		}
+		if !queryShapeOperations[fields[0]] {
+			return fmt.Errorf("settings.queryAllowlist: unknown operation %q in %q", fields[0], shape)
+		}
+		if _, ok := tables[fields[1]]; !ok && !slices.ContainsFunc(schema.Views, func(v View) bool { return v.Name == fields[1] }) {
+			return fmt.Errorf("settings.queryAllowlist: unknown table %q in %q", fields[1], shape)
+		}
+	}
+	if settings.Naming != nil {
+		if err := validateNaming(schema, *settings.Naming); err != nil {
+			return fmt.Errorf("settings.naming: %w", err)
+		}
+	}
+	for role, limit := range settings.RateLimits {
+		if strings.TrimSpace(role) == "" {
+			return fmt.Errorf("settings.rateLimits: role cannot be empty")
+		}
+		if !(limit.Rate > 0) || math.IsInf(limit.Rate, 0) {
+			return fmt.Errorf("settings.rateLimits.%s: rate must be a positive number of requests per second", role)
+		}
+		if limit.Burst < 0 {
+			return fmt.Errorf("settings.rateLimits.%s: burst cannot be negative", role)
+		}
+	}
+	for name, channel := range settings.Presence {
+		if err := validateChannel("settings.presence", name, channel.Claims); err != nil {
+			return err
+		}
+		if channel.MaxMembers < 0 {
+			return fmt.Errorf("settings.presence.%s: maxMembers cannot be negative", name)
+		}
+	}
+	for name, channel := range settings.Broadcast {
+		if err := validateChannel("settings.broadcast", name, channel.Subscribe, channel.Publish); err != nil {
+			return err
+		}
+	}
+	for tableName, rule := range settings.Conflicts {
+		if _, ok := tables[tableName]; !ok {
+			return fmt.Errorf("settings.conflicts: unknown table %q", tableName)
+		}
+		if err := validateConflictRule(rule, settings.Functions); err != nil {
+			return fmt.Errorf("settings.conflicts.%s: %w", tableName, err)
+		}
+	}
+	if settings.Backup != nil {
+		if err := validateBackupPolicy(*settings.Backup); err != nil {
+			return fmt.Errorf("settings.backup: %w", err)
+		}
+		for _, table := range schema.Tables {
+			if table.TimeSeries != nil && settings.Backup.PointInTime {
+				return fmt.Errorf("settings.backup: pointInTime can't log time-series table %s", table.Name)
+			}
+		}
+	}
+	if len(settings.Functions) > 0 {
+		probeDB, err := buildMigrationProbeDB(schema)
+		if err != nil {
+			return err
+		}
+		defer probeDB.Close()
+		names := make([]string, 0, len(settings.Functions))
+		for name := range settings.Functions {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if err := validateFunction(probeDB, name, settings.Functions[name]); err != nil {
+				return fmt.Errorf("settings.functions.%s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// channelName is what a settings.presence or settings.broadcast key may be: a
+// channel name, or a prefix of channel names ending in *.
+var channelName = regexp.MustCompile(`^([A-Za-z0-9_.:-]{1,128}|[A-Za-z0-9_.:-]{0,127}\*)$`)
+
+// validateChannel checks a channel key and the claims its rules compare a
+// caller's token with, which must be scalars.
+func validateChannel(field, name string, rules ...map[string]any) error {
+	if !channelName.MatchString(name) {
+		return fmt.Errorf("%s: channel %q must be 1-128 letters, digits, _ . : or -, optionally ending in *", field, name)
+	}
+	for _, claims := range rules {
+		for claim, value := range claims {
+			switch value.(type) {
+			case string, float64, bool:
+			default:
+				return fmt.Errorf("%s.%s: claim %s must be a string, number or boolean", field, name, claim)
+			}
+		}
+	}
+	return nil
+}
+
+// Who a Function may be called by, and the types its params take.
+var (
+	functionAccess     = map[string]bool{"": true, "service": true, "user": true, "public": true}
+	functionParamTypes = map[string]bool{"text": true, "integer": true, "real": true, "boolean": true}
+	functionStatements = []string{"SELECT", "WITH", "VALUES", "INSERT", "REPLACE", "UPDATE", "DELETE"}
+	conflictParams     = map[string]bool{"server": true, "client": true, "pk": true}
+)
+
+// validateConflictRule checks a conflict strategy. An rpc strategy names a
+// function whose params are among those a resolution passes.
+func validateConflictRule(rule ConflictRule, functions map[string]Function) error {
+	switch rule.Strategy {
+	case "serverWins", "clientWins", "merge":
+		if rule.Function != "" {
+			return fmt.Errorf("function is only used by the rpc strategy")
+		}
+	case "rpc":
+		fn, ok := functions[rule.Function]
+		if !ok {
+			return fmt.Errorf("unknown function %q", rule.Function)
+		}
+		for param := range fn.Params {
+			if !conflictParams[param] {
+				return fmt.Errorf("function %s: param %s is not passed to conflict resolvers; they get server, client and pk", rule.Function, param)
+			}
+		}
+	default:
+		return fmt.Errorf("strategy must be serverWins, clientWins, merge or rpc, got %q", rule.Strategy)
+	}
+	return nil
+}
+
+// validateFunction checks that a function is one data statement whose
+// placeholders are its declared params, and compiles it against the schema.
+func validateFunction(probeDB *sql.DB, name string, fn Function) error {
+	if err := tools.ValidateIdentifier(name); err != nil {
+		return err
+	}
+	if !functionAccess[fn.Access] {
+		return fmt.Errorf("unknown access %q (expected service, user or public)", fn.Access)
+	}
+	stmt, placeholders, err := tools.PositionalParams(fn.SQL)
+	if err != nil {
+		return fmt.Errorf("sql: %w", err)
+	}
+	words := strings.Fields(stmt)
+	if len(words) == 0 || !slices.Contains(functionStatements, strings.ToUpper(words[0])) {
+		return fmt.Errorf("sql must be a SELECT, WITH, VALUES, INSERT, REPLACE, UPDATE or DELETE statement")
+	}
+	used := map[string]bool{}
+	for _, placeholder := range placeholders {
+		if _, ok := fn.Params[placeholder]; !ok && placeholder != "auth_id" {
+			return fmt.Errorf("sql uses :%s, which is not in params", placeholder)
+		}
+		used[placeholder] = true
+	}
+	for paramName, param := range fn.Params {
+		if paramName == "auth_id" {
+			return fmt.Errorf("params: auth_id is bound to the caller and can't be declared")
+		}
+		if !used[paramName] {
+			return fmt.Errorf("params.%s is not used in sql", paramName)
+		}
+		if !functionParamTypes[param.Type] {
+			return fmt.Errorf("params.%s: unknown type %q (expected text, integer, real or boolean)", paramName, param.Type)
+		}
+		if param.Default != nil && !functionValueMatches(param.Type, param.Default) {
+			return fmt.Errorf("params.%s: default is not a %s", paramName, param.Type)
+		}
+	}
+	prepared, err := probeDB.Prepare(stmt)
+	if err != nil {
+		return fmt.Errorf("sql: %w", err)
+	}
+	return prepared.Close()
+}
+
+func functionValueMatches(paramType string, value any) bool {
+	switch v := value.(type) {
+	case string:
+		return paramType == "text"
+	case bool:
+		return paramType == "boolean"
+	case float64:
+		return paramType == "real" || paramType == "integer" && v == float64(int64(v))
+	}
+	return false
+}
+
+// validateLocalizedField checks that a localized field doesn't shadow a column
+// and that its translations live in columns of the table.
+func validateLocalizedField(table Table, name string, field LocalizedField, defaultLanguage string) error {
+	if err := tools.ValidateIdentifier(name); err != nil {
+		return err
+	}
+	if _, ok := table.Columns[name]; ok {
+		return fmt.Errorf("field name is already a column")
+	}
+	if (len(field.Columns) > 0) == (field.JSONColumn != "") {
+		return fmt.Errorf("set exactly one of columns and jsonColumn")
+	}
+	if field.JSONColumn != "" {
+		if _, ok := table.Columns[field.JSONColumn]; !ok {
+			return fmt.Errorf("unknown column %q", field.JSONColumn)
+		}
+		return nil
+	}
+	hasDefault := false
+	for lang, column := range field.Columns {
+		if err := tools.ValidateLanguageTag(lang); err != nil {
+			return err
+		}
+		if _, ok := table.Columns[column]; !ok {
+			return fmt.Errorf("unknown column %q", column)
+		}
+		hasDefault = hasDefault || strings.EqualFold(lang, defaultLanguage)
+	}
+	if !hasDefault {
+		return fmt.Errorf("no column for the default language %q", defaultLanguage)
+	}
+	return nil
+}
+
+// validateTableValidation checks a table's request validation rules.
+func validateTableValidation(table Table, validation TableValidation) error {
+	for name, rule := range validation.Columns {
+		if _, ok := table.Columns[name]; !ok {
+			return fmt.Errorf("unknown column %q", name)
+		}
+		for _, op := range rule.Required {
+			if op != "insert" && op != "update" {
+				return fmt.Errorf("%s.required: unknown operation %q (expected insert or update)", name, op)
+			}
+		}
+		if rule.Pattern != "" {
+			if _, err := regexp.Compile(rule.Pattern); err != nil {
+				return fmt.Errorf("%s.pattern: %w", name, err)
+			}
+		}
+		if rule.Min != nil && rule.Max != nil && *rule.Min > *rule.Max {
+			return fmt.Errorf("%s: min cannot exceed max", name)
+		}
+		if (rule.MinLength != nil && *rule.MinLength < 0) || (rule.MaxLength != nil && *rule.MaxLength < 0) {
+			return fmt.Errorf("%s: lengths cannot be negative", name)
+		}
+		if rule.MinLength != nil && rule.MaxLength != nil && *rule.MinLength > *rule.MaxLength {
+			return fmt.Errorf("%s: minLength cannot exceed maxLength", name)
+		}
+	}
+	for i, rule := range validation.Rules {
+		if !fieldRuleOperators[rule.Op] {
+			return fmt.Errorf("rules[%d]: unknown operator %q", i, rule.Op)
+		}
+		for _, column := range []string{rule.Column, rule.Other} {
+			if _, ok := table.Columns[column]; !ok {
+				return fmt.Errorf("rules[%d]: unknown column %q", i, column)
+			}
+		}
+	}
+	return nil
+}
+
+// Comparisons a validation FieldRule can make.
+var fieldRuleOperators = map[string]bool{
+	"eq": true, "neq": true, "lt": true, "lte": true, "gt": true, "gte": true,
+}
+
+// Operations a query shape in APISettings.QueryAllowlist can start with.
+var queryShapeOperations = map[string]bool{
+	"select": true, "insert": true, "insert-ignore": true, "upsert": true, "update": true, "delete": true,
+}
+
 // ValidateMigrationPlan validates a migration plan before execution.
 // Performs FK reference checks and optionally data constraint checks against a probe database.
 // Note: SQL syntax is validated by executing on the first database - if it fails, the migration aborts.
@@ -58,6 +545,111 @@ func ValidateMigrationExecution(ctx context.Context, currentSchema Schema, migra
 	return nil
 }
 
+// VerifyMigrationPlan applies migrationSQL to a scratch database built from oldSchema
+// and seeded with optional sample rows, then introspects the result and checks that
+// it matches newSchema exactly. A mismatch is reported with the changes still
+// needed to reach newSchema.
+func VerifyMigrationPlan(ctx context.Context, oldSchema, newSchema Schema, migrationSQL []string, sampleData map[string][]map[string]any) error {
+	scratch, err := buildMigrationProbeDB(oldSchema)
+	if err != nil {
+		return fmt.Errorf("failed to build scratch database: %w", err)
+	}
+	defer scratch.Close()
+
+	if err := seedSampleData(ctx, scratch, oldSchema, sampleData); err != nil {
+		return err
+	}
+	for _, stmt := range migrationSQL {
+		if _, err := scratch.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("local migration probe failed for %q: %w", stmt, err)
+		}
+	}
+
+	actual, err := introspectSchema(ctx, scratch)
+	if err != nil {
+		return fmt.Errorf("failed to introspect scratch database: %w", err)
+	}
+	actual = alignIntrospectedSchema(actual, newSchema)
+	// ADD COLUMN ... NOT NULL gets a type default filled in by the planner.
+	for _, table := range actual.Tables {
+		for _, target := range newSchema.Tables {
+			if target.Name != table.Name {
+				continue
+			}
+			for name, col := range table.Columns {
+				want, ok := target.Columns[name]
+				if ok && want.NotNull && want.Default == nil && col.Default != nil && formatDefault(col.Default) == getDefaultForType(want.Type) {
+					col.Default = nil
+					table.Columns[name] = col
+				}
+			}
+		}
+	}
+	if changes := diffSchemas(actual, newSchema); len(changes) > 0 {
+		return fmt.Errorf("migration result does not match target schema: %s", formatSchemaDiffs(changes))
+	}
+	return nil
+}
+
+// seedSampleData inserts rows keyed by table name into the scratch database.
+// Tables and columns must exist in schema.
+func seedSampleData(ctx context.Context, db *sql.DB, schema Schema, sampleData map[string][]map[string]any) error {
+	tables := make(map[string]Table, len(schema.Tables))
+	for _, table := range schema.Tables {
+		tables[table.Name] = table
+	}
+	names := make([]string, 0, len(sampleData))
+	for name := range sampleData {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		table, ok := tables[name]
+		if !ok {
+			return fmt.Errorf("sample data references unknown table %s", name)
+		}
+		for _, row := range sampleData[name] {
+			cols := make([]string, 0, len(row))
+			for col := range row {
+				if _, ok := table.Columns[col]; !ok {
+					return fmt.Errorf("sample data references unknown column %s.%s", name, col)
+				}
+				cols = append(cols, col)
+			}
+			if len(cols) == 0 {
+				continue
+			}
+			sort.Strings(cols)
+			quoted := make([]string, len(cols))
+			args := make([]any, len(cols))
+			for i, col := range cols {
+				quoted[i] = "[" + col + "]"
+				args[i] = row[col]
+			}
+			placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(cols)), ", ")
+			query := fmt.Sprintf("INSERT INTO [%s] (%s) VALUES (%s)", name, strings.Join(quoted, ", "), placeholders)
+			if _, err := db.ExecContext(ctx, query, args...); err != nil {
+				return fmt.Errorf("failed to insert sample data into %s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func formatSchemaDiffs(changes []SchemaDiff) string {
+	parts := make([]string, len(changes))
+	for i, c := range changes {
+		target := c.Table
+		if c.Column != "" {
+			target += "." + c.Column
+		}
+		parts[i] = c.Type + " " + target
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ", ")
+}
+
 func buildMigrationProbeDB(schema Schema) (*sql.DB, error) {
 	probeDB, err := sql.Open("sqlite3", ":memory:")
 	if err != nil {
@@ -375,6 +967,9 @@ func AutoFixNotNullColumns(schema Schema, changes []SchemaDiff) Schema {
 			Columns:    make(map[string]Col),
 			Indexes:    table.Indexes,
 			FTSColumns: table.FTSColumns,
+			GeoColumns: table.GeoColumns,
+			Sync:       table.Sync,
+			TimeSeries: table.TimeSeries,
 		}
 
 		// Check if this column is being added
@@ -3,6 +3,7 @@ package platform
 import (
 	"context"
 	"database/sql"
+	"maps"
 	"strings"
 	"testing"
 
@@ -634,3 +635,230 @@ func setupDataTestDB(t *testing.T, initSQL string) *sql.DB {
 	}
 	return db
 }
+
+func TestVerifyMigrationPlan_MatchesTarget(t *testing.T) {
+	current := Schema{Tables: []Table{
+		{Name: "users", Pk: []string{"id"}, Columns: map[string]Col{
+			"id": {Name: "id", Type: "INTEGER"},
+		}},
+		{Name: "posts", Pk: []string{"id"}, Columns: map[string]Col{
+			"id":    {Name: "id", Type: "INTEGER"},
+			"title": {Name: "title", Type: "TEXT"},
+		}},
+	}}
+	next := Schema{Tables: []Table{
+		current.Tables[0],
+		{Name: "posts", Pk: []string{"id"}, Columns: map[string]Col{
+			"id":    {Name: "id", Type: "INTEGER"},
+			"title": {Name: "title", Type: "TEXT"},
+			"views": {Name: "views", Type: "INTEGER", NotNull: true},
+		}, Indexes: []Index{{Name: "idx_posts_title", Columns: []string{"title"}, Unique: true}}},
+		{Name: "comments", Pk: []string{"id"}, Columns: map[string]Col{
+			"id":       {Name: "id", Type: "INTEGER"},
+			"authorId": {Name: "authorId", Type: "INTEGER", References: "users.id", OnDelete: "CASCADE"},
+		}},
+	}}
+
+	changes := diffSchemas(current, next)
+	plan, err := GenerateMigrationPlan(current, next, changes, nil)
+	if err != nil {
+		t.Fatalf("GenerateMigrationPlan failed: %v", err)
+	}
+	sample := map[string][]map[string]any{
+		"users": {{"id": 1}},
+		"posts": {{"id": 1, "title": "hello"}, {"id": 2, "title": "world"}},
+	}
+	if err := VerifyMigrationPlan(context.Background(), current, next, plan.SQL, sample); err != nil {
+		t.Fatalf("expected plan to verify, got %v", err)
+	}
+}
+
+func TestVerifyMigrationPlan_ReportsDiff(t *testing.T) {
+	current := Schema{Tables: []Table{{Name: "posts", Pk: []string{"id"}, Columns: map[string]Col{
+		"id": {Name: "id", Type: "INTEGER"},
+	}}}}
+	next := Schema{Tables: []Table{{Name: "posts", Pk: []string{"id"}, Columns: map[string]Col{
+		"id":   {Name: "id", Type: "INTEGER"},
+		"body": {Name: "body", Type: "TEXT"},
+	}}}}
+
+	err := VerifyMigrationPlan(context.Background(), current, next, nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "does not match target schema: add_column posts.body") {
+		t.Fatalf("expected schema diff error, got %v", err)
+	}
+}
+
+func TestVerifyMigrationPlan_SampleData(t *testing.T) {
+	current := Schema{Tables: []Table{{Name: "posts", Pk: []string{"id"}, Columns: map[string]Col{
+		"id":    {Name: "id", Type: "INTEGER"},
+		"title": {Name: "title", Type: "TEXT"},
+	}}}}
+	next := Schema{Tables: []Table{{Name: "posts", Pk: []string{"id"}, Columns: map[string]Col{
+		"id":    {Name: "id", Type: "INTEGER"},
+		"title": {Name: "title", Type: "TEXT"},
+	}, Indexes: []Index{{Name: "idx_posts_title", Columns: []string{"title"}, Unique: true}}}}}
+	plan, err := GenerateMigrationPlan(current, next, diffSchemas(current, next), nil)
+	if err != nil {
+		t.Fatalf("GenerateMigrationPlan failed: %v", err)
+	}
+
+	duplicates := map[string][]map[string]any{"posts": {{"id": 1, "title": "same"}, {"id": 2, "title": "same"}}}
+	if err := VerifyMigrationPlan(context.Background(), current, next, plan.SQL, duplicates); err == nil {
+		t.Fatal("expected unique index to fail against sample data")
+	}
+
+	unknown := map[string][]map[string]any{"comments": {{"id": 1}}}
+	err = VerifyMigrationPlan(context.Background(), current, next, plan.SQL, unknown)
+	if err == nil || !strings.Contains(err.Error(), "unknown table comments") {
+		t.Fatalf("expected unknown table error, got %v", err)
+	}
+}
+
+func TestValidateAPISettings(t *testing.T) {
+	limit := func(v int) *int { return &v }
+	low, high := 1.0, 2.0
+	schema := Schema{Tables: []Table{{Name: "posts", Pk: []string{"id"}, Columns: map[string]Col{
+		"id":         {Name: "id", Type: "INTEGER"},
+		"deleted_at": {Name: "deleted_at", Type: "TEXT"},
+		"title":      {Name: "title", Type: "TEXT", NotNull: true},
+	}}}}
+
+	schema.Settings = &APISettings{
+		DefaultLimit:     limit(20),
+		MaxLimit:         limit(200),
+		AllowedOperators: []string{"eq", "in"},
+		SoftDelete:       map[string]string{"posts": "deleted_at"},
+		QueryAllowlist:   []string{"select posts select=id,title where=id.eq"},
+		Validation: map[string]TableValidation{"posts": {
+			Columns: map[string]ColumnRule{"title": {Required: []string{"insert", "update"}, Pattern: `^\S`, MaxLength: limit(120)}},
+			Rules:   []FieldRule{{Column: "id", Op: "gte", Other: "id"}},
+		}},
+		DefaultLanguage: "en",
+		Localized: map[string]LocalizedFields{"posts": {
+			"heading":  {Columns: map[string]string{"en": "title", "de": "deleted_at"}},
+			"headline": {JSONColumn: "title"},
+		}},
+		Functions: map[string]Function{
+			"recent_posts": {
+				SQL:    "SELECT id, title FROM posts WHERE title LIKE :prefix || '%' AND id > :after LIMIT 10",
+				Params: map[string]FunctionParam{"prefix": {Type: "text", Required: true}, "after": {Type: "integer", Default: 0.0}},
+				Access: "user",
+			},
+			"archive": {SQL: "UPDATE posts SET deleted_at = :auth_id WHERE id = :id;", Params: map[string]FunctionParam{"id": {Type: "integer"}}},
+		},
+		RateLimits: map[string]RateLimit{"anonymous": {Rate: 0.5}, "user": {Rate: 5, Burst: 20}, "premium": {Rate: 50}},
+		Presence:   map[string]PresenceChannel{"lobby": {}, "doc:*": {Claims: map[string]any{"team": "blue", "admin": true}, MaxMembers: 50}},
+		Broadcast:  map[string]BroadcastChannel{"room:*": {Subscribe: map[string]any{"team": "blue"}, Publish: map[string]any{"level": float64(2)}}},
+		Conflicts:  map[string]ConflictRule{"posts": {Strategy: "merge"}},
+	}
+	if err := validateAPISettings(schema); err != nil {
+		t.Fatalf("expected valid settings, got %v", err)
+	}
+
+	invalid := []APISettings{
+		{DefaultLimit: limit(500), MaxLimit: limit(200)},
+		{MaxLimit: limit(0)},
+		{AllowedOperators: []string{"regex"}},
+		{SoftDelete: map[string]string{"comments": "deleted_at"}},
+		{SoftDelete: map[string]string{"posts": "title"}},
+		{TenantColumn: "tenant_id"},
+		{TenantColumn: "id"},
+		{QueryAllowlist: []string{"select comments"}},
+		{QueryAllowlist: []string{"merge posts"}},
+		{QueryAllowlist: []string{"select  posts"}},
+		{Validation: map[string]TableValidation{"comments": {}}},
+		{Validation: map[string]TableValidation{"posts": {Columns: map[string]ColumnRule{"body": {}}}}},
+		{Validation: map[string]TableValidation{"posts": {Columns: map[string]ColumnRule{"title": {Pattern: "("}}}}},
+		{Validation: map[string]TableValidation{"posts": {Columns: map[string]ColumnRule{"title": {Required: []string{"delete"}}}}}},
+		{Validation: map[string]TableValidation{"posts": {Columns: map[string]ColumnRule{"id": {Min: &high, Max: &low}}}}},
+		{Validation: map[string]TableValidation{"posts": {Rules: []FieldRule{{Column: "id", Op: "like", Other: "title"}}}}},
+		{Validation: map[string]TableValidation{"posts": {Rules: []FieldRule{{Column: "id", Op: "lt", Other: "nope"}}}}},
+		{DefaultLanguage: "en_US"},
+		{Localized: map[string]LocalizedFields{"posts": {"heading": {JSONColumn: "title"}}}},
+		{DefaultLanguage: "en", Localized: map[string]LocalizedFields{"comments": {"heading": {JSONColumn: "title"}}}},
+		{DefaultLanguage: "en", Localized: map[string]LocalizedFields{"posts": {"title": {JSONColumn: "title"}}}},
+		{DefaultLanguage: "en", Localized: map[string]LocalizedFields{"posts": {"heading": {}}}},
+		{DefaultLanguage: "en", Localized: map[string]LocalizedFields{"posts": {"heading": {Columns: map[string]string{"de": "title"}}}}},
+		{DefaultLanguage: "en", Localized: map[string]LocalizedFields{"posts": {"heading": {Columns: map[string]string{"en": "nope"}}}}},
+		{Functions: map[string]Function{"bad-name": {SQL: "SELECT 1"}}},
+		{Functions: map[string]Function{"f": {SQL: "SELECT 1", Access: "admin"}}},
+		{Functions: map[string]Function{"f": {SQL: "SELECT 1; DELETE FROM posts"}}},
+		{Functions: map[string]Function{"f": {SQL: "DROP TABLE posts"}}},
+		{Functions: map[string]Function{"f": {SQL: "SELECT nope FROM posts"}}},
+		{Functions: map[string]Function{"f": {SQL: "SELECT * FROM posts WHERE id = :id"}}},
+		{Functions: map[string]Function{"f": {SQL: "SELECT 1", Params: map[string]FunctionParam{"id": {Type: "integer"}}}}},
+		{Functions: map[string]Function{"f": {SQL: "SELECT :id", Params: map[string]FunctionParam{"id": {Type: "uuid"}}}}},
+		{Functions: map[string]Function{"f": {SQL: "SELECT :id", Params: map[string]FunctionParam{"id": {Type: "integer", Default: 1.5}}}}},
+		{Functions: map[string]Function{"f": {SQL: "SELECT :auth_id", Params: map[string]FunctionParam{"auth_id": {Type: "text"}}}}},
+		{RateLimits: map[string]RateLimit{"user": {Rate: 0}}},
+		{RateLimits: map[string]RateLimit{"user": {Rate: 1, Burst: -1}}},
+		{RateLimits: map[string]RateLimit{"": {Rate: 1}}},
+		{Presence: map[string]PresenceChannel{"": {}}},
+		{Presence: map[string]PresenceChannel{"doc/*": {}}},
+		{Presence: map[string]PresenceChannel{"doc*:x": {}}},
+		{Presence: map[string]PresenceChannel{"lobby": {MaxMembers: -1}}},
+		{Presence: map[string]PresenceChannel{"lobby": {Claims: map[string]any{"teams": []any{"blue"}}}}},
+		{Broadcast: map[string]BroadcastChannel{"room/1": {}}},
+		{Broadcast: map[string]BroadcastChannel{"room": {Publish: map[string]any{"team": nil}}}},
+		{Conflicts: map[string]ConflictRule{"missing": {Strategy: "serverWins"}}},
+		{Conflicts: map[string]ConflictRule{"posts": {Strategy: "newest"}}},
+		{Conflicts: map[string]ConflictRule{"posts": {Strategy: "rpc", Function: "missing"}}},
+		{Conflicts: map[string]ConflictRule{"posts": {Strategy: "clientWins", Function: "archive"}}},
+		{
+			Functions: map[string]Function{"resolve": {SQL: "SELECT :id AS id", Params: map[string]FunctionParam{"id": {Type: "integer"}}}},
+			Conflicts: map[string]ConflictRule{"posts": {Strategy: "rpc", Function: "resolve"}},
+		},
+	}
+	for _, settings := range invalid {
+		schema.Settings = &settings
+		if err := validateAPISettings(schema); err == nil {
+			t.Fatalf("expected %+v to be rejected", settings)
+		}
+	}
+}
+
+func TestValidateAPISettings_Naming(t *testing.T) {
+	schema := Schema{Tables: []Table{{
+		Name:    "blog_posts",
+		Pk:      []string{"id"},
+		Columns: map[string]Col{"id": {Name: "id", Type: "INTEGER"}, "author_name": {Name: "author_name", Type: "TEXT"}},
+		Indexes: []Index{{Name: "idx_blog_posts_author", Columns: []string{"author_name"}}},
+	}}}
+	policy := NamingPolicy{Case: NameCaseSnake, MaxLength: 24, ForbiddenPrefixes: []string{"atombase_"}, ReservedWords: []string{"class", "type"}}
+	schema.Settings = &APISettings{Naming: &policy}
+	if err := validateAPISettings(schema); err != nil {
+		t.Fatalf("expected valid names, got %v", err)
+	}
+
+	rename := func(edit func(*Table)) Schema {
+		table := schema.Tables[0]
+		table.Columns = maps.Clone(table.Columns)
+		edit(&table)
+		return Schema{Tables: []Table{table}, Settings: schema.Settings}
+	}
+	invalid := map[string]Schema{
+		"camel column":     rename(func(tb *Table) { tb.Columns["authorId"] = Col{Name: "authorId", Type: "TEXT"} }),
+		"long table":       rename(func(tb *Table) { tb.Name = "blog_posts_with_a_long_name" }),
+		"forbidden prefix": rename(func(tb *Table) { tb.Name = "Atombase_posts" }),
+		"reserved column":  rename(func(tb *Table) { tb.Columns["Class"] = Col{Name: "Class", Type: "TEXT"} }),
+		"bad index":        rename(func(tb *Table) { tb.Indexes = []Index{{Name: "IdxAuthor", Columns: []string{"author_name"}}} }),
+	}
+	for name, bad := range invalid {
+		if err := validateAPISettings(bad); err == nil {
+			t.Errorf("%s: expected the name to be rejected", name)
+		}
+	}
+
+	for _, bad := range []NamingPolicy{{Case: "kebab"}, {MaxLength: -1}, {MaxLength: 500}, {ForbiddenPrefixes: []string{""}}, {ReservedWords: []string{""}}} {
+		schema.Settings = &APISettings{Naming: &bad}
+		if err := validateAPISettings(schema); err == nil {
+			t.Errorf("expected policy %+v to be rejected", bad)
+		}
+	}
+
+	schema.Settings = &APISettings{Naming: &NamingPolicy{Case: NameCasePascal}}
+	schema.Tables[0].Name = "BlogPosts"
+	if err := validateAPISettings(schema); err == nil || !strings.Contains(err.Error(), "column BlogPosts.author_name is not pascal case") {
+		t.Fatalf("expected the first offending column to be named, got %v", err)
+	}
+}
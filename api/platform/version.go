@@ -0,0 +1,56 @@
+package platform
+
+import (
+	"net/http"
+
+	"github.com/atombasedev/atombase/config"
+	"github.com/atombasedev/atombase/tools"
+)
+
+// APIVersion is the revision of the HTTP APIs this server implements. It goes
+// up when a route or body changes in a way older clients would misread;
+// additions that old clients can ignore are announced as features instead.
+const APIVersion = 1
+
+// SupportedAPIVersions are the revisions clients may be built against.
+var SupportedAPIVersions = []int{APIVersion}
+
+// VersionInfo is returned by GET /platform/version. Clients refuse a server
+// whose APIVersions lack the version they were built for.
+type VersionInfo struct {
+	Version     string          `json:"version"`     // Server release
+	APIVersions []int           `json:"apiVersions"` // API revisions served, oldest first
+	Features    map[string]bool `json:"features"`
+}
+
+// serverFeatures reports the optional parts of the APIs a client may rely
+// on: routes added within an API version, and those that depend on how the
+// server is configured.
+func serverFeatures() map[string]bool {
+	return map[string]bool{
+		"views":             true,
+		"functions":         true,
+		"savedQueries":      true,
+		"reports":           true,
+		"search":            true,
+		"tableEvents":       true,
+		"webhooks":          true,
+		"openapi":           true,
+		"definitionSources": true,
+		"exports":           config.Cfg.ExportS3URL != "",
+		"email":             config.Cfg.SMTPHost != "",
+		"activityLog":       config.Cfg.ActivityLogEnabled,
+		"queryAllowlist":    config.Cfg.RequireQueryAllowlist,
+		"debugEndpoints":    config.Cfg.DebugEndpoints,
+	}
+}
+
+// handleGetVersion handles GET /platform/version. It needs no service key, so
+// SDKs holding only a session can check compatibility too.
+func (api *API) handleGetVersion(w http.ResponseWriter, r *http.Request) {
+	tools.RespondJSON(w, http.StatusOK, VersionInfo{
+		Version:     config.Version,
+		APIVersions: SupportedAPIVersions,
+		Features:    serverFeatures(),
+	})
+}
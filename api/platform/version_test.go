@@ -0,0 +1,35 @@
+package platform
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/atombasedev/atombase/config"
+)
+
+func TestGetVersion(t *testing.T) {
+	api, db := setupPlatformAPI(t)
+	defer db.Close()
+
+	old := config.Cfg.ExportS3URL
+	defer func() { config.Cfg.ExportS3URL = old }()
+	config.Cfg.ExportS3URL = "https://bucket.example.com"
+
+	mux := http.NewServeMux()
+	api.RegisterRoutes(mux)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/platform/version", nil))
+
+	var info VersionInfo
+	if err := json.Unmarshal(rec.Body.Bytes(), &info); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("unexpected version response %d: %s (%v)", rec.Code, rec.Body.String(), err)
+	}
+	if info.Version != config.Version || len(info.APIVersions) == 0 || info.APIVersions[len(info.APIVersions)-1] != APIVersion {
+		t.Errorf("unexpected version info %+v", info)
+	}
+	if !info.Features["exports"] || !info.Features["openapi"] || info.Features["email"] {
+		t.Errorf("unexpected features %v", info.Features)
+	}
+}
@@ -0,0 +1,195 @@
+package platform
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/atombasedev/atombase/tools"
+)
+
+// resolveViews checks a schema's views and fills in their columns. Each view
+// is created in order on a scratch database whose tables keep their declared
+// types, so a column selected straight from a table carries its type and an
+// expression gets none. Views may read earlier views but not later ones.
+func resolveViews(schema *Schema) error {
+	if len(schema.Views) == 0 {
+		return nil
+	}
+	names := make(map[string]bool, len(schema.Tables)+len(schema.Views))
+	for _, table := range schema.Tables {
+		names[strings.ToLower(table.Name)] = true
+	}
+	for _, view := range schema.Views {
+		if err := tools.ValidateTableName(view.Name); err != nil {
+			return fmt.Errorf("views: %w", err)
+		}
+		if names[strings.ToLower(view.Name)] {
+			return fmt.Errorf("views.%s: name is already used by a table or view", view.Name)
+		}
+		names[strings.ToLower(view.Name)] = true
+	}
+
+	scratch, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		return err
+	}
+	defer scratch.Close()
+	scratch.SetMaxOpenConns(1)
+	for _, table := range schema.Tables {
+		if _, err := scratch.Exec(typedTableSQL(table)); err != nil {
+			return fmt.Errorf("failed to create table %s: %w", table.Name, err)
+		}
+		if len(table.FTSColumns) > 0 {
+			if _, err := scratch.Exec(generateFTSSQL(table.Name, table.FTSColumns, table.Pk)[0]); err != nil {
+				return fmt.Errorf("failed to create FTS table %s: %w", table.Name, err)
+			}
+		}
+	}
+
+	for i := range schema.Views {
+		view := &schema.Views[i]
+		stmt, placeholders, err := tools.PositionalParams(view.Select)
+		if err != nil {
+			return fmt.Errorf("views.%s: %w", view.Name, err)
+		}
+		if len(placeholders) > 0 {
+			return fmt.Errorf("views.%s: select cannot take params", view.Name)
+		}
+		if words := strings.Fields(stmt); len(words) == 0 || !strings.EqualFold(words[0], "SELECT") && !strings.EqualFold(words[0], "WITH") {
+			return fmt.Errorf("views.%s: select must be a SELECT or WITH statement", view.Name)
+		}
+		view.Select = strings.TrimSpace(stmt)
+		if _, err := scratch.Exec(generateCreateViewSQL(*view)); err != nil {
+			return fmt.Errorf("views.%s: %w", view.Name, err)
+		}
+		// SQLite resolves a view's names when it is read, not created.
+		rows, err := scratch.Query(`SELECT name, type FROM pragma_table_info(?)`, view.Name)
+		if err != nil {
+			return fmt.Errorf("views.%s: %w", view.Name, err)
+		}
+		view.Columns = map[string]string{}
+		for rows.Next() {
+			var name, colType string
+			if err := rows.Scan(&name, &colType); err != nil {
+				rows.Close()
+				return err
+			}
+			// Unaliased expressions and repeated names come back as columns
+			// the Data API can't address.
+			if tools.ValidateIdentifier(name) != nil {
+				rows.Close()
+				return fmt.Errorf("views.%s: result column %q needs an alias", view.Name, name)
+			}
+			view.Columns[name] = colType
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("views.%s: %w", view.Name, err)
+		}
+	}
+	return nil
+}
+
+// typedTableSQL creates a bare table with each column's declared type, which
+// the tables of a database leave off.
+func typedTableSQL(t Table) string {
+	cols := make([]string, 0, len(t.Columns))
+	for _, name := range sortedKeys(t.Columns) {
+		cols = append(cols, fmt.Sprintf("[%s] %s", name, t.Columns[name].Type))
+	}
+	return fmt.Sprintf("CREATE TABLE [%s] (%s)", t.Name, strings.Join(cols, ", "))
+}
+
+func generateCreateViewSQL(view View) string {
+	return fmt.Sprintf("CREATE VIEW [%s] AS %s", view.Name, view.Select)
+}
+
+// viewMigrationSQL wraps a migration's table statements with the schema's
+// views. Every view of the old schema is dropped first and every view of the
+// new one created last: a view can't be altered, and one left in place while
+// its tables are rebuilt or lose columns would break the ALTER TABLE
+// statements that check the schema. The series views of time-series tables
+// are handled the same way, and come back over the tables alone until the
+// Data API adds their partitions again.
+func viewMigrationSQL(oldSchema, newSchema Schema, tableSQL []string) []string {
+	statements := make([]string, 0, len(oldSchema.Views)+len(tableSQL)+len(newSchema.Views))
+	for i := len(oldSchema.Views) - 1; i >= 0; i-- {
+		statements = append(statements, fmt.Sprintf("DROP VIEW IF EXISTS [%s]", oldSchema.Views[i].Name))
+	}
+	for _, table := range oldSchema.Tables {
+		if table.TimeSeries != nil {
+			statements = append(statements, fmt.Sprintf("DROP VIEW IF EXISTS [%s_series]", table.Name))
+		}
+	}
+	statements = append(statements, tableSQL...)
+	for _, table := range newSchema.Tables {
+		if table.TimeSeries != nil {
+			statements = append(statements, seriesViewSQL(table.Name))
+		}
+	}
+	for _, view := range newSchema.Views {
+		statements = append(statements, generateCreateViewSQL(view))
+	}
+	return statements
+}
+
+// diffViews reports views that were added, removed or given a new select.
+// A changed view is dropped and created again. Changes to their order alone
+// are not reported.
+func diffViews(old, new Schema) []SchemaDiff {
+	oldViews := make(map[string]string, len(old.Views))
+	for _, view := range old.Views {
+		oldViews[view.Name] = view.Select
+	}
+	newViews := make(map[string]string, len(new.Views))
+	for _, view := range new.Views {
+		newViews[view.Name] = view.Select
+	}
+	var changes []SchemaDiff
+	for _, name := range sortedKeys(oldViews) {
+		selectSQL, ok := newViews[name]
+		if !ok || selectSQL != oldViews[name] {
+			changes = append(changes, SchemaDiff{Type: "drop_view", Table: name})
+		}
+	}
+	for _, name := range sortedKeys(newViews) {
+		selectSQL, ok := oldViews[name]
+		if !ok || selectSQL != newViews[name] {
+			changes = append(changes, SchemaDiff{Type: "add_view", Table: name})
+		}
+	}
+	return changes
+}
+
+var createViewPattern = regexp.MustCompile("(?is)^\\s*CREATE\\s+(?:TEMP(?:ORARY)?\\s+)?VIEW\\s+(?:IF\\s+NOT\\s+EXISTS\\s+)?(?:\\[[^\\]]*\\]|\"[^\"]*\"|`[^`]*`|\\w+)(?:\\s*\\([^)]*\\))?\\s+AS\\s+(.*?)\\s*;?\\s*$")
+
+// introspectViews reads a database's views back, in the order they were
+// created.
+func introspectViews(ctx context.Context, db *sql.DB) ([]View, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT name, COALESCE(sql, '')
+		FROM sqlite_master
+		WHERE type = 'view'
+		ORDER BY rowid
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var views []View
+	for rows.Next() {
+		var name, createSQL string
+		if err := rows.Scan(&name, &createSQL); err != nil {
+			return nil, err
+		}
+		match := createViewPattern.FindStringSubmatch(createSQL)
+		if match == nil {
+			return nil, fmt.Errorf("unrecognized definition of view %s", name)
+		}
+		views = append(views, View{Name: name, Select: match[1]})
+	}
+	return views, rows.Err()
+}
@@ -0,0 +1,108 @@
+package platform
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func viewTestSchema(views ...View) Schema {
+	return Schema{
+		Tables: []Table{{Name: "users", Pk: []string{"id"}, Columns: map[string]Col{
+			"id":   {Name: "id", Type: "INTEGER"},
+			"name": {Name: "name", Type: "TEXT", NotNull: true},
+			"age":  {Name: "age", Type: "INTEGER"},
+		}}},
+		Views: views,
+	}
+}
+
+func TestResolveViews(t *testing.T) {
+	schema := viewTestSchema(
+		View{Name: "adults", Select: "SELECT id, name, age * 12 AS months FROM users WHERE age >= 18;"},
+		View{Name: "adult_names", Select: "  SELECT name FROM adults"},
+	)
+	if err := resolveViews(&schema); err != nil {
+		t.Fatal(err)
+	}
+	adults := schema.Views[0]
+	if adults.Select != "SELECT id, name, age * 12 AS months FROM users WHERE age >= 18" {
+		t.Errorf("select not normalized: %q", adults.Select)
+	}
+	if len(adults.Columns) != 3 || adults.Columns["id"] != "INTEGER" || adults.Columns["name"] != "TEXT" || adults.Columns["months"] != "" {
+		t.Errorf("adults columns: %v", adults.Columns)
+	}
+	if got := schema.Views[1].Columns; len(got) != 1 || got["name"] != "TEXT" {
+		t.Errorf("adult_names columns: %v", got)
+	}
+
+	for name, view := range map[string]View{
+		"table name":     {Name: "users", Select: "SELECT 1"},
+		"unknown column": {Name: "v", Select: "SELECT nope FROM users"},
+		"param":          {Name: "v", Select: "SELECT name FROM users WHERE age > :age"},
+		"not a select":   {Name: "v", Select: "DELETE FROM users"},
+		"two statements": {Name: "v", Select: "SELECT 1; DROP TABLE users"},
+		"duplicate col":  {Name: "v", Select: "SELECT name, name FROM users"},
+		"no alias":       {Name: "v", Select: "SELECT age * 12 FROM users"},
+		"invalid name":   {Name: "my-view", Select: "SELECT 1"},
+	} {
+		schema := viewTestSchema(view)
+		if err := resolveViews(&schema); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	later := viewTestSchema(View{Name: "a", Select: "SELECT * FROM b"}, View{Name: "b", Select: "SELECT 1 AS x"})
+	if err := resolveViews(&later); err == nil {
+		t.Error("expected a view reading a later view to be rejected")
+	}
+}
+
+func TestGenerateMigrationPlan_RecreatesViews(t *testing.T) {
+	ctx := context.Background()
+	oldSchema := viewTestSchema(View{Name: "adults", Select: "SELECT id, name, age FROM users WHERE age >= 18"})
+	if err := resolveViews(&oldSchema); err != nil {
+		t.Fatal(err)
+	}
+
+	// A table change drops every view first and creates them again last.
+	newSchema := viewTestSchema(View{Name: "adults", Select: "SELECT id, full_name FROM users WHERE age >= 18"})
+	delete(newSchema.Tables[0].Columns, "name")
+	newSchema.Tables[0].Columns["full_name"] = Col{Name: "full_name", Type: "TEXT"}
+	if err := resolveViews(&newSchema); err != nil {
+		t.Fatal(err)
+	}
+	changes := diffSchemas(oldSchema, newSchema)
+	plan, err := GenerateMigrationPlan(oldSchema, newSchema, changes, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first, last := plan.SQL[0], plan.SQL[len(plan.SQL)-1]; first != "DROP VIEW IF EXISTS [adults]" || !strings.HasPrefix(last, "CREATE VIEW [adults] AS") {
+		t.Fatalf("unexpected plan: %v", plan.SQL)
+	}
+	if err := VerifyMigrationPlan(ctx, oldSchema, newSchema, plan.SQL, map[string][]map[string]any{"users": {{"id": 1, "name": "Alice", "age": 30}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A view can be added on its own.
+	withTeens := viewTestSchema(
+		View{Name: "adults", Select: "SELECT id, name, age FROM users WHERE age >= 18"},
+		View{Name: "teens", Select: "SELECT id FROM users WHERE age BETWEEN 13 AND 19"},
+	)
+	if err := resolveViews(&withTeens); err != nil {
+		t.Fatal(err)
+	}
+	changes = diffSchemas(oldSchema, withTeens)
+	if len(changes) != 1 || changes[0].Type != "add_view" || changes[0].Table != "teens" {
+		t.Fatalf("unexpected changes: %v", changes)
+	}
+	plan, err = GenerateMigrationPlan(oldSchema, withTeens, changes, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyMigrationPlan(ctx, oldSchema, withTeens, plan.SQL, nil); err != nil {
+		t.Fatal(err)
+	}
+	if changes := diffSchemas(oldSchema, oldSchema); len(changes) != 0 {
+		t.Fatalf("expected no changes, got %v", changes)
+	}
+}
@@ -0,0 +1,464 @@
+package platform
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/atombasedev/atombase/config"
+	"github.com/atombasedev/atombase/tools"
+)
+
+// Audit actions recorded for webhooks.
+const (
+	auditWebhookCreated = "webhook.created"
+	auditWebhookDeleted = "webhook.deleted"
+)
+
+// Webhook delivery statuses.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// webhookEvents are the Data API writes a webhook can listen to.
+var webhookEvents = []string{"insert", "upsert", "update", "delete"}
+
+const (
+	webhookBatchSize       = 50                 // Deliveries sent per dispatcher pass
+	webhookPollInterval    = time.Second        // Time between dispatcher passes
+	webhookLogRetention    = 7 * 24 * time.Hour // How long finished deliveries stay in the log
+	maxWebhookDeliveries   = 200                // Deliveries one log listing returns at most
+	maxWebhookResponseBody = 512                // Bytes of a failed response kept as its error
+)
+
+// webhookRetryDelay is the wait before the first retry of a failed delivery;
+// it doubles with each further attempt, up to an hour.
+var webhookRetryDelay = 30 * time.Second
+
+// webhookClient sends deliveries, only to public addresses; sendWebhook
+// bounds each one with its own timeout.
+var webhookClient = tools.PublicHTTPClient(0)
+
+// checkWebhookURL vets a webhook's URL when it is saved. Tests swap it, and
+// webhookClient, to deliver to a local server.
+var checkWebhookURL = tools.CheckPublicURL
+
+// createWebhook registers a webhook on a database. The signing secret is
+// generated and only returned here.
+func (api *API) createWebhook(ctx context.Context, databaseID string, req CreateWebhookRequest) (*Webhook, error) {
+	db, err := api.getDatabase(ctx, databaseID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkWebhookURL(req.URL); err != nil {
+		return nil, tools.InvalidRequestErr(err.Error())
+	}
+	if req.Table != "" {
+		def, err := api.getDefinition(ctx, db.DefinitionName)
+		if err != nil {
+			return nil, err
+		}
+		var schema Schema
+		if err := tools.DecodeSchema(def.Schema, &schema); err != nil {
+			return nil, err
+		}
+		if _, ok := schemaTableSet(schema)[req.Table]; !ok {
+			return nil, tools.InvalidRequestErr(fmt.Sprintf("table %q is not in definition %s", req.Table, def.Name))
+		}
+	}
+	events := []string{}
+	for _, event := range req.Events {
+		if !slices.Contains(webhookEvents, event) {
+			return nil, tools.InvalidRequestErr(fmt.Sprintf("unknown event %q, use %s", event, strings.Join(webhookEvents, ", ")))
+		}
+		if !slices.Contains(events, event) {
+			events = append(events, event)
+		}
+	}
+	if len(events) == 0 {
+		events = append(events, webhookEvents...)
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, err
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	hook := &Webhook{
+		ID:         "whk_" + hex.EncodeToString(id),
+		DatabaseID: databaseID,
+		Table:      req.Table,
+		Events:     events,
+		URL:        req.URL,
+		Secret:     "whsec_" + base64.RawURLEncoding.EncodeToString(raw),
+		CreatedAt:  time.Now().UTC(),
+	}
+
+	stored := []byte(hook.Secret)
+	if tools.EncryptionEnabled() {
+		if stored, err = tools.Encrypt(stored); err != nil {
+			return nil, fmt.Errorf("failed to encrypt webhook secret: %w", err)
+		}
+	}
+	eventsJSON, _ := json.Marshal(events)
+	conn, err := api.dbConn()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.ExecContext(ctx, `
+		INSERT INTO atombase_webhooks (id, database_id, table_name, events_json, url, secret_encrypted, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, hook.ID, databaseID, hook.Table, string(eventsJSON), hook.URL, stored, hook.CreatedAt.Format(time.RFC3339)); err != nil {
+		return nil, err
+	}
+	if err := api.recordAudit(ctx, auditWebhookCreated, "database:"+databaseID, map[string]any{"id": hook.ID, "table": hook.Table, "events": events, "url": hook.URL}); err != nil {
+		return nil, err
+	}
+	return hook, nil
+}
+
+// listWebhooks returns a database's webhooks, oldest first, without their secrets.
+func (api *API) listWebhooks(ctx context.Context, databaseID string) ([]Webhook, error) {
+	if _, err := api.getDatabase(ctx, databaseID); err != nil {
+		return nil, err
+	}
+	conn, err := api.dbConn()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := conn.QueryContext(ctx, `
+		SELECT id, table_name, events_json, url, created_at FROM atombase_webhooks
+		WHERE database_id = ? ORDER BY created_at ASC, id ASC
+	`, databaseID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hooks := []Webhook{}
+	for rows.Next() {
+		hook := Webhook{DatabaseID: databaseID}
+		var eventsJSON, createdAt string
+		if err := rows.Scan(&hook.ID, &hook.Table, &eventsJSON, &hook.URL, &createdAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(eventsJSON), &hook.Events); err != nil {
+			return nil, fmt.Errorf("failed to decode webhook %s events: %w", hook.ID, err)
+		}
+		hook.CreatedAt = mustParseTime(createdAt)
+		hooks = append(hooks, hook)
+	}
+	return hooks, rows.Err()
+}
+
+// deleteWebhook removes a webhook and its delivery log. Queued deliveries are
+// dropped.
+func (api *API) deleteWebhook(ctx context.Context, databaseID, webhookID string) error {
+	conn, err := api.dbConn()
+	if err != nil {
+		return err
+	}
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `
+		DELETE FROM atombase_webhook_deliveries
+		WHERE webhook_id IN (SELECT id FROM atombase_webhooks WHERE id = ? AND database_id = ?)
+	`, webhookID, databaseID); err != nil {
+		return err
+	}
+	result, err := tx.ExecContext(ctx, `DELETE FROM atombase_webhooks WHERE id = ? AND database_id = ?`, webhookID, databaseID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return tools.ErrWebhookNotFound
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return api.recordAudit(ctx, auditWebhookDeleted, "database:"+databaseID, map[string]string{"id": webhookID})
+}
+
+// listWebhookDeliveries returns a webhook's most recent deliveries first,
+// optionally only those with the given status.
+func (api *API) listWebhookDeliveries(ctx context.Context, databaseID, webhookID, status string, limit int) ([]WebhookDelivery, error) {
+	if status != "" && status != DeliveryPending && status != DeliveryDelivered && status != DeliveryFailed {
+		return nil, tools.InvalidRequestErr(fmt.Sprintf("status must be %s, %s or %s", DeliveryPending, DeliveryDelivered, DeliveryFailed))
+	}
+	if limit <= 0 || limit > maxWebhookDeliveries {
+		limit = maxWebhookDeliveries
+	}
+	conn, err := api.dbConn()
+	if err != nil {
+		return nil, err
+	}
+	var exists int
+	if err := conn.QueryRowContext(ctx, `SELECT 1 FROM atombase_webhooks WHERE id = ? AND database_id = ?`, webhookID, databaseID).Scan(&exists); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, tools.ErrWebhookNotFound
+		}
+		return nil, err
+	}
+	rows, err := conn.QueryContext(ctx, `
+		SELECT id, event, table_name, payload, status, attempts, next_attempt_at, response_status, error, created_at, delivered_at
+		FROM atombase_webhook_deliveries
+		WHERE webhook_id = ? AND (? = '' OR status = ?)
+		ORDER BY id DESC
+		LIMIT ?
+	`, webhookID, status, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		d := WebhookDelivery{WebhookID: webhookID}
+		var payload, nextAttemptAt, createdAt string
+		var responseStatus sql.NullInt64
+		var deliveryErr, deliveredAt sql.NullString
+		if err := rows.Scan(&d.ID, &d.Event, &d.Table, &payload, &d.Status, &d.Attempts, &nextAttemptAt, &responseStatus, &deliveryErr, &createdAt, &deliveredAt); err != nil {
+			return nil, err
+		}
+		d.Payload = json.RawMessage(payload)
+		d.CreatedAt = mustParseTime(createdAt)
+		if d.Status == DeliveryPending {
+			next := mustParseTime(nextAttemptAt)
+			d.NextAttemptAt = &next
+		}
+		if responseStatus.Valid {
+			code := int(responseStatus.Int64)
+			d.ResponseStatus = &code
+		}
+		d.Error = deliveryErr.String
+		if deliveredAt.Valid {
+			at := mustParseTime(deliveredAt.String)
+			d.DeliveredAt = &at
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// RunWebhookDispatcher sends queued webhook deliveries until stop is closed,
+// and clears finished deliveries from the log once they pass the retention.
+func (api *API) RunWebhookDispatcher(stop <-chan struct{}) {
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+	var pruned time.Time
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			if err := api.dispatchWebhooks(context.Background(), now); err != nil {
+				tools.Logger.Error("webhook dispatch failed", "error", err)
+			}
+			if now.Sub(pruned) >= time.Hour {
+				pruned = now
+				if err := api.pruneWebhookDeliveries(context.Background(), now); err != nil {
+					tools.Logger.Error("failed to prune webhook deliveries", "error", err)
+				}
+			}
+		}
+	}
+}
+
+// pendingDelivery is a queued delivery with what sending it needs.
+type pendingDelivery struct {
+	id        int64
+	webhookID string
+	event     string
+	payload   []byte
+	attempts  int
+	url       string
+	secret    []byte
+}
+
+// dispatchWebhooks sends the deliveries that are due. Each one is locked
+// while it is sent, so servers sharing the primary database don't send it twice.
+func (api *API) dispatchWebhooks(ctx context.Context, now time.Time) error {
+	conn, err := api.dbConn()
+	if err != nil {
+		return err
+	}
+	nowText := now.UTC().Format(time.RFC3339)
+	rows, err := conn.QueryContext(ctx, `
+		SELECT d.id, d.webhook_id, d.event, d.payload, d.attempts, w.url, w.secret_encrypted
+		FROM atombase_webhook_deliveries d
+		JOIN atombase_webhooks w ON w.id = d.webhook_id
+		WHERE d.status = 'pending' AND d.next_attempt_at <= ? AND (d.locked_until IS NULL OR d.locked_until <= ?)
+		ORDER BY d.id
+		LIMIT ?
+	`, nowText, nowText, webhookBatchSize)
+	if err != nil {
+		return err
+	}
+	var due []pendingDelivery
+	for rows.Next() {
+		var d pendingDelivery
+		var payload string
+		if err := rows.Scan(&d.id, &d.webhookID, &d.event, &payload, &d.attempts, &d.url, &d.secret); err != nil {
+			rows.Close()
+			return err
+		}
+		d.payload = []byte(payload)
+		due = append(due, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	timeout := webhookTimeout()
+	lockedUntil := now.Add(timeout + 30*time.Second).UTC().Format(time.RFC3339)
+	var wg sync.WaitGroup
+	for _, d := range due {
+		result, err := conn.ExecContext(ctx, `
+			UPDATE atombase_webhook_deliveries SET locked_until = ?
+			WHERE id = ? AND status = 'pending' AND (locked_until IS NULL OR locked_until <= ?)
+		`, lockedUntil, d.id, nowText)
+		if err != nil {
+			return err
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			continue
+		}
+		wg.Add(1)
+		go func(d pendingDelivery) {
+			defer wg.Done()
+			status, sendErr := sendWebhook(ctx, d, now, timeout)
+			if err := api.recordDeliveryAttempt(ctx, d, status, sendErr, time.Now()); err != nil {
+				tools.Logger.Error("failed to record webhook delivery", "delivery_id", d.id, "error", err)
+			}
+		}(d)
+	}
+	wg.Wait()
+	return nil
+}
+
+// sendWebhook POSTs a delivery's payload, signed with the webhook's secret.
+// The signature is an HMAC-SHA256 of the timestamp, a dot and the body, so
+// receivers can refuse replays of old deliveries.
+func sendWebhook(ctx context.Context, d pendingDelivery, now time.Time, timeout time.Duration) (int, error) {
+	secret := d.secret
+	if tools.EncryptionEnabled() {
+		var err error
+		if secret, err = tools.Decrypt(d.secret); err != nil {
+			return 0, fmt.Errorf("failed to decrypt webhook secret: %w", err)
+		}
+	}
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(d.payload)
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.url, bytes.NewReader(d.payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "atombase-webhooks")
+	req.Header.Set("X-Atombase-Webhook", d.webhookID)
+	req.Header.Set("X-Atombase-Delivery", strconv.FormatInt(d.id, 10))
+	req.Header.Set("X-Atombase-Event", d.event)
+	req.Header.Set("X-Atombase-Signature", "t="+timestamp+",v1="+hex.EncodeToString(mac.Sum(nil)))
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxWebhookResponseBody))
+		return resp.StatusCode, nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxWebhookResponseBody))
+	return resp.StatusCode, fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+}
+
+// recordDeliveryAttempt stores the outcome of a send. A failed delivery is
+// retried with backoff until it runs out of attempts.
+func (api *API) recordDeliveryAttempt(ctx context.Context, d pendingDelivery, responseStatus int, sendErr error, now time.Time) error {
+	conn, err := api.dbConn()
+	if err != nil {
+		return err
+	}
+	var code any
+	if responseStatus != 0 {
+		code = responseStatus
+	}
+	attempts := d.attempts + 1
+	nowText := now.UTC().Format(time.RFC3339)
+	if sendErr == nil {
+		_, err = conn.ExecContext(ctx, `
+			UPDATE atombase_webhook_deliveries
+			SET status = 'delivered', attempts = ?, response_status = ?, error = NULL, delivered_at = ?, locked_until = NULL
+			WHERE id = ?
+		`, attempts, code, nowText, d.id)
+		return err
+	}
+
+	status := DeliveryPending
+	if attempts >= max(config.Cfg.WebhookMaxAttempts, 1) {
+		status = DeliveryFailed
+	}
+	_, err = conn.ExecContext(ctx, `
+		UPDATE atombase_webhook_deliveries
+		SET status = ?, attempts = ?, response_status = ?, error = ?, next_attempt_at = ?, locked_until = NULL
+		WHERE id = ?
+	`, status, attempts, code, sendErr.Error(), now.Add(webhookBackoff(attempts)).UTC().Format(time.RFC3339), d.id)
+	return err
+}
+
+// webhookBackoff is the wait after a delivery's nth failed attempt.
+func webhookBackoff(attempts int) time.Duration {
+	delay := webhookRetryDelay
+	for i := 1; i < attempts && delay < time.Hour; i++ {
+		delay *= 2
+	}
+	return min(delay, time.Hour)
+}
+
+func webhookTimeout() time.Duration {
+	if config.Cfg.WebhookTimeout <= 0 {
+		return 10 * time.Second
+	}
+	return time.Duration(config.Cfg.WebhookTimeout) * time.Second
+}
+
+// pruneWebhookDeliveries deletes delivered and failed deliveries older than
+// the log retention.
+func (api *API) pruneWebhookDeliveries(ctx context.Context, now time.Time) error {
+	conn, err := api.dbConn()
+	if err != nil {
+		return err
+	}
+	_, err = conn.ExecContext(ctx, `
+		DELETE FROM atombase_webhook_deliveries WHERE status != 'pending' AND created_at < ?
+	`, now.Add(-webhookLogRetention).UTC().Format(time.RFC3339))
+	return err
+}
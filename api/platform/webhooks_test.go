@@ -0,0 +1,155 @@
+package platform
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/atombasedev/atombase/config"
+	"github.com/atombasedev/atombase/tools"
+)
+
+func TestWebhooks_CreateAndDispatch(t *testing.T) {
+	api, db := setupPlatformAPI(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	created, err := api.createDefinition(ctx, CreateDefinitionRequest{
+		Name: "notes",
+		Type: "global",
+		Schema: Schema{Tables: []Table{{Name: "notes", Pk: []string{"id"}, Columns: map[string]Col{
+			"id": {Name: "id", Type: "INTEGER"},
+		}}}},
+	})
+	if err != nil {
+		t.Fatalf("createDefinition failed: %v", err)
+	}
+	if _, err := db.Exec(`
+		INSERT INTO atombase_databases (id, definition_id, definition_version, created_at, updated_at)
+		VALUES ('notes-db', ?, 1, '2026-01-01T00:00:00Z', '2026-01-01T00:00:00Z')
+	`, created.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	var calls atomic.Int32
+	var signature, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := io.ReadAll(r.Body)
+		if calls.Add(1) == 1 {
+			http.Error(w, "try later", http.StatusServiceUnavailable)
+			return
+		}
+		signature, body = r.Header.Get("X-Atombase-Signature"), string(raw)
+	}))
+	defer server.Close()
+
+	if _, err := api.createWebhook(ctx, "notes-db", CreateWebhookRequest{URL: server.URL}); err == nil {
+		t.Fatal("expected a webhook to a loopback address to be refused")
+	}
+	oldClient, oldCheck := webhookClient, checkWebhookURL
+	defer func() { webhookClient, checkWebhookURL = oldClient, oldCheck }()
+	webhookClient, checkWebhookURL = server.Client(), func(string) error { return nil }
+
+	for _, req := range []CreateWebhookRequest{
+		{URL: server.URL, Table: "missing"},
+		{URL: server.URL, Events: []string{"select"}},
+	} {
+		if _, err := api.createWebhook(ctx, "notes-db", req); err == nil {
+			t.Fatalf("expected %+v to be refused", req)
+		}
+	}
+	hook, err := api.createWebhook(ctx, "notes-db", CreateWebhookRequest{URL: server.URL, Table: "notes", Events: []string{"insert"}})
+	if err != nil {
+		t.Fatalf("createWebhook failed: %v", err)
+	}
+	if !strings.HasPrefix(hook.Secret, "whsec_") {
+		t.Fatalf("expected a generated secret, got %q", hook.Secret)
+	}
+	hooks, err := api.listWebhooks(ctx, "notes-db")
+	if err != nil || len(hooks) != 1 || hooks[0].Secret != "" {
+		t.Fatalf("expected one webhook without its secret, got %+v (%v)", hooks, err)
+	}
+
+	if err := api.store.EnqueueWebhookDelivery(ctx, hook.ID, "insert", "notes", []byte(`{"rows":[{"id":1}]}`)); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	if err := api.dispatchWebhooks(ctx, now); err != nil {
+		t.Fatalf("dispatchWebhooks failed: %v", err)
+	}
+	deliveries, err := api.listWebhookDeliveries(ctx, "notes-db", hook.ID, "", 0)
+	if err != nil {
+		t.Fatalf("listWebhookDeliveries failed: %v", err)
+	}
+	if len(deliveries) != 1 || deliveries[0].Status != DeliveryPending || deliveries[0].Attempts != 1 ||
+		*deliveries[0].ResponseStatus != http.StatusServiceUnavailable || !strings.Contains(deliveries[0].Error, "try later") {
+		t.Fatalf("expected a failed attempt to be retried, got %+v", deliveries)
+	}
+	if err := api.dispatchWebhooks(ctx, now); err != nil {
+		t.Fatal(err)
+	}
+	if calls.Load() != 1 {
+		t.Fatal("expected the retry to wait for its backoff")
+	}
+
+	if err := api.dispatchWebhooks(ctx, now.Add(webhookRetryDelay+time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	deliveries, _ = api.listWebhookDeliveries(ctx, "notes-db", hook.ID, DeliveryDelivered, 0)
+	if len(deliveries) != 1 || deliveries[0].Attempts != 2 || deliveries[0].DeliveredAt == nil {
+		t.Fatalf("expected the retry to be delivered, got %+v", deliveries)
+	}
+	timestamp, sent, _ := strings.Cut(strings.TrimPrefix(signature, "t="), ",v1=")
+	mac := hmac.New(sha256.New, []byte(hook.Secret))
+	mac.Write([]byte(timestamp + "." + body))
+	if sent != hex.EncodeToString(mac.Sum(nil)) {
+		t.Fatalf("signature %q does not match the body", signature)
+	}
+
+	if err := api.deleteWebhook(ctx, "notes-db", hook.ID); err != nil {
+		t.Fatalf("deleteWebhook failed: %v", err)
+	}
+	if _, err := api.listWebhookDeliveries(ctx, "notes-db", hook.ID, "", 0); !errors.Is(err, tools.ErrWebhookNotFound) {
+		t.Fatalf("expected deleted webhook to be gone, got %v", err)
+	}
+}
+
+func TestRecordDeliveryAttempt_GivesUp(t *testing.T) {
+	api, db := setupPlatformAPI(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	oldAttempts := config.Cfg.WebhookMaxAttempts
+	defer func() { config.Cfg.WebhookMaxAttempts = oldAttempts }()
+	config.Cfg.WebhookMaxAttempts = 2
+
+	if _, err := db.Exec(`
+		INSERT INTO atombase_webhook_deliveries (id, webhook_id, event, table_name, payload, attempts, next_attempt_at, created_at)
+		VALUES (1, 'whk_1', 'insert', 'notes', '{}', 1, '2026-01-01T00:00:00Z', '2026-01-01T00:00:00Z')
+	`); err != nil {
+		t.Fatal(err)
+	}
+	if err := api.recordDeliveryAttempt(ctx, pendingDelivery{id: 1, attempts: 1}, 0, errors.New("connection refused"), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	var status string
+	if err := db.QueryRow(`SELECT status FROM atombase_webhook_deliveries WHERE id = 1`).Scan(&status); err != nil {
+		t.Fatal(err)
+	}
+	if status != DeliveryFailed {
+		t.Fatalf("expected the delivery to fail after its last attempt, got %s", status)
+	}
+
+	if webhookBackoff(1) != webhookRetryDelay || webhookBackoff(3) != 4*webhookRetryDelay || webhookBackoff(20) != time.Hour {
+		t.Fatal("unexpected backoff")
+	}
+}
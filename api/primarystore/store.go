@@ -2,6 +2,9 @@ package primarystore
 
 import (
 	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/subtle"
 	"database/sql"
 	"encoding/json"
 	"errors"
@@ -27,9 +30,46 @@ type DefinitionMigration struct {
 	FromVersion  int
 	ToVersion    int
 	SQL          []string
+	Windows      []tools.MigrationWindow // Times of day the migration may run in (empty for any time)
 	CreatedAt    string
 }
 
+// Webhook is a registered webhook as writes need it: what it listens to.
+type Webhook struct {
+	ID     string
+	Table  string   // Empty for every table
+	Events []string // Data API write kinds: insert, upsert, update, delete
+}
+
+// SavedQuery is a named select saved on a database, with its JSON kept as stored.
+type SavedQuery struct {
+	Name      string
+	Table     string
+	Query     json.RawMessage
+	Params    json.RawMessage
+	CreatedAt string
+	UpdatedAt string
+}
+
+// Report is a saved query run on a cron, with the outcome of its last run.
+type Report struct {
+	ID         string
+	DatabaseID string
+	Query      string // Saved query name
+	Cron       string
+	Timezone   string
+	Format     string
+	Webhook    string
+	Email      string
+	NextRunAt  string
+	CreatedAt  string
+	LastRunAt  string
+	LastStatus string
+	LastError  string
+	LastRows   int64
+	LastURL    string
+}
+
 type DefinitionProvisionMeta struct {
 	ID        int32
 	Name      string
@@ -239,22 +279,48 @@ func (s *Store) ResolveDatabaseTarget(ctx context.Context, principal definitions
 	if s == nil || s.conn == nil {
 		return definitions.DatabaseTarget{}, errors.New("primary store not initialized")
 	}
+	if header == "" && principal.TokenDatabase != "" {
+		// A JWT reaches the database its signing key belongs to, and a
+		// database-scoped API key the database it was created for.
+		target, err := scanDatabaseTarget(s.conn.QueryRowContext(ctx, `
+			SELECT d.id, d.definition_id, def.name, def.definition_type, d.definition_version, d.auth_token_encrypted
+			FROM atombase_databases d
+			JOIN atombase_definitions def ON def.id = d.definition_id
+			WHERE d.id = ? AND def.definition_type != 'user'
+		`, principal.TokenDatabase))
+		if err != nil {
+			return definitions.DatabaseTarget{}, err
+		}
+		return target, s.checkKeyOrg(ctx, principal, target)
+	}
 	if header == "" {
 		if principal.UserID == "" || principal.IsService {
 			return definitions.DatabaseTarget{}, tools.ErrMissingDatabase
 		}
+		// A dedicated database has no row tenant, so it sorts first and takes
+		// precedence over a shared one.
 		row := s.conn.QueryRowContext(ctx, `
-			SELECT d.id, d.definition_id, def.name, def.definition_type, d.definition_version, d.auth_token_encrypted
+			SELECT d.id, d.definition_id, def.name, def.definition_type, d.definition_version, d.auth_token_encrypted, '',
+			       EXISTS (SELECT 1 FROM atombase_tenant_moves m WHERE m.user_id = u.id)
 			FROM atombase_users u
 			JOIN atombase_databases d ON d.id = u.database_id
 			JOIN atombase_definitions def ON def.id = d.definition_id
 			WHERE u.id = ? AND def.definition_type = 'user'
-		`, principal.UserID)
+			UNION ALL
+			SELECT d.id, d.definition_id, def.name, def.definition_type, d.definition_version, d.auth_token_encrypted, t.user_id,
+			       EXISTS (SELECT 1 FROM atombase_tenant_moves m WHERE m.user_id = t.user_id)
+			FROM atombase_row_tenants t
+			JOIN atombase_databases d ON d.id = t.database_id
+			JOIN atombase_definitions def ON def.id = d.definition_id
+			WHERE t.user_id = ? AND def.definition_type = 'user'
+			ORDER BY 7
+			LIMIT 1
+		`, principal.UserID, principal.UserID)
 
 		var target definitions.DatabaseTarget
 		var defType string
 		var encrypted []byte
-		if err := row.Scan(&target.DatabaseID, &target.DefinitionID, &target.DefinitionName, &defType, &target.DefinitionVersion, &encrypted); err != nil {
+		if err := row.Scan(&target.DatabaseID, &target.DefinitionID, &target.DefinitionName, &defType, &target.DefinitionVersion, &encrypted, &target.RowTenant, &target.WritesPaused); err != nil {
 			if errors.Is(err, sql.ErrNoRows) {
 				return definitions.DatabaseTarget{}, tools.ErrDatabaseNotFound
 			}
@@ -295,6 +361,36 @@ func (s *Store) ResolveDatabaseTarget(ctx context.Context, principal definitions
 		return definitions.DatabaseTarget{}, tools.InvalidRequestErr("invalid database type")
 	}
 
+	target, err := scanDatabaseTarget(row)
+	if err != nil {
+		return definitions.DatabaseTarget{}, err
+	}
+	if principal.TokenDatabase != "" && target.DatabaseID != principal.TokenDatabase {
+		return definitions.DatabaseTarget{}, tools.UnauthorizedErr("token was not issued for this database")
+	}
+	return target, s.checkKeyOrg(ctx, principal, target)
+}
+
+// checkKeyOrg keeps an API key of a platform organization to the databases
+// of that organization's definitions. Others look like they do not exist.
+func (s *Store) checkKeyOrg(ctx context.Context, principal definitions.Principal, target definitions.DatabaseTarget) error {
+	if principal.KeyScope == nil || principal.KeyScope.Org == "" {
+		return nil
+	}
+	var owned int
+	if err := s.conn.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM atombase_definition_orgs WHERE definition_id = ? AND org_id = ?
+	`, target.DefinitionID, principal.KeyScope.Org).Scan(&owned); err != nil {
+		return err
+	}
+	if owned == 0 {
+		return tools.ErrDatabaseNotFound
+	}
+	return nil
+}
+
+// scanDatabaseTarget scans a database row selected by ResolveDatabaseTarget.
+func scanDatabaseTarget(row *sql.Row) (definitions.DatabaseTarget, error) {
 	var target definitions.DatabaseTarget
 	var defType string
 	var encrypted []byte
@@ -313,6 +409,67 @@ func (s *Store) ResolveDatabaseTarget(ctx context.Context, principal definitions
 	return target, nil
 }
 
+// LookupAPIKey returns the scope of a scoped API key whose secret matches.
+func (s *Store) LookupAPIKey(ctx context.Context, id, secret string) (*tools.APIKeyScope, error) {
+	if s == nil || s.conn == nil {
+		return nil, errors.New("primary store not initialized")
+	}
+	var hash []byte
+	var tablesJSON, verbsJSON string
+	scope := &tools.APIKeyScope{KeyID: id}
+	err := s.conn.QueryRowContext(ctx, `
+		SELECT k.secret_hash, COALESCE(o.org_id, ''), COALESCE(o.role, ''), COALESCE(k.database_id, ''), k.tables_json, k.verbs_json
+		FROM atombase_api_keys k
+		LEFT JOIN atombase_api_key_orgs o ON o.key_id = k.id
+		WHERE k.id = ?
+	`, id).Scan(&hash, &scope.Org, &scope.Role, &scope.Database, &tablesJSON, &verbsJSON)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, tools.ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(secret))
+	if subtle.ConstantTimeCompare(sum[:], hash) != 1 {
+		return nil, tools.ErrAPIKeyNotFound
+	}
+	if err := json.Unmarshal([]byte(tablesJSON), &scope.Tables); err != nil {
+		return nil, fmt.Errorf("malformed api key tables: %w", err)
+	}
+	if err := json.Unmarshal([]byte(verbsJSON), &scope.Verbs); err != nil {
+		return nil, fmt.Errorf("malformed api key verbs: %w", err)
+	}
+	return scope, nil
+}
+
+// LookupServiceAccount returns the public key and scope of a service account.
+func (s *Store) LookupServiceAccount(ctx context.Context, id string) (ed25519.PublicKey, *tools.APIKeyScope, error) {
+	if s == nil || s.conn == nil {
+		return nil, nil, errors.New("primary store not initialized")
+	}
+	var publicKey []byte
+	var tablesJSON, verbsJSON string
+	scope := &tools.APIKeyScope{KeyID: id}
+	err := s.conn.QueryRowContext(ctx, `
+		SELECT public_key, COALESCE(org_id, ''), COALESCE(role, ''), COALESCE(database_id, ''), tables_json, verbs_json
+		FROM atombase_service_accounts
+		WHERE id = ?
+	`, id).Scan(&publicKey, &scope.Org, &scope.Role, &scope.Database, &tablesJSON, &verbsJSON)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, tools.ErrServiceAccountNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := json.Unmarshal([]byte(tablesJSON), &scope.Tables); err != nil {
+		return nil, nil, fmt.Errorf("malformed service account tables: %w", err)
+	}
+	if err := json.Unmarshal([]byte(verbsJSON), &scope.Verbs); err != nil {
+		return nil, nil, fmt.Errorf("malformed service account verbs: %w", err)
+	}
+	return ed25519.PublicKey(publicKey), scope, nil
+}
+
 func (s *Store) LoadAccessPolicy(ctx context.Context, definitionID int32, version int, table, operation string) (*definitions.AccessPolicy, error) {
 	if s == nil || s.conn == nil {
 		return nil, errors.New("primary store not initialized")
@@ -399,10 +556,11 @@ func (s *Store) GetMigrationsBetween(ctx context.Context, definitionID int32, fr
 		return nil, errors.New("primary store not initialized")
 	}
 	rows, err := s.conn.QueryContext(ctx, `
-		SELECT id, definition_id, from_version, to_version, sql, created_at
-		FROM atombase_migrations
-		WHERE definition_id = ? AND from_version >= ? AND to_version <= ?
-		ORDER BY from_version ASC
+		SELECT m.id, m.definition_id, m.from_version, m.to_version, m.sql, w.windows_json, m.created_at
+		FROM atombase_migrations m
+		LEFT JOIN atombase_migration_windows w ON w.migration_id = m.id
+		WHERE m.definition_id = ? AND m.from_version >= ? AND m.to_version <= ?
+		ORDER BY m.from_version ASC
 	`, definitionID, fromVersion, toVersion)
 	if err != nil {
 		return nil, err
@@ -413,12 +571,18 @@ func (s *Store) GetMigrationsBetween(ctx context.Context, definitionID int32, fr
 	for rows.Next() {
 		var migration DefinitionMigration
 		var sqlJSON string
-		if err := rows.Scan(&migration.ID, &migration.DefinitionID, &migration.FromVersion, &migration.ToVersion, &sqlJSON, &migration.CreatedAt); err != nil {
+		var windowsJSON sql.NullString
+		if err := rows.Scan(&migration.ID, &migration.DefinitionID, &migration.FromVersion, &migration.ToVersion, &sqlJSON, &windowsJSON, &migration.CreatedAt); err != nil {
 			return nil, err
 		}
 		if err := json.Unmarshal([]byte(sqlJSON), &migration.SQL); err != nil {
 			return nil, fmt.Errorf("failed to decode migration %d sql: %w", migration.ID, err)
 		}
+		if windowsJSON.Valid {
+			if err := json.Unmarshal([]byte(windowsJSON.String), &migration.Windows); err != nil {
+				return nil, fmt.Errorf("failed to decode migration %d windows: %w", migration.ID, err)
+			}
+		}
 		migrations = append(migrations, migration)
 	}
 	expected := fromVersion
@@ -434,6 +598,104 @@ func (s *Store) GetMigrationsBetween(ctx context.Context, definitionID int32, fr
 	return migrations, rows.Err()
 }
 
+// GetDatabaseSchedule returns the timezone and labels migration windows are
+// matched against for a database. A database without one is on UTC with no
+// labels.
+func (s *Store) GetDatabaseSchedule(ctx context.Context, databaseID string) (tools.DatabaseSchedule, error) {
+	if s == nil || s.conn == nil {
+		return tools.DatabaseSchedule{}, errors.New("primary store not initialized")
+	}
+	var schedule tools.DatabaseSchedule
+	var labelsJSON string
+	err := s.conn.QueryRowContext(ctx, `
+		SELECT timezone, labels_json FROM atombase_database_schedules WHERE database_id = ?
+	`, databaseID).Scan(&schedule.Timezone, &labelsJSON)
+	if errors.Is(err, sql.ErrNoRows) {
+		return tools.DatabaseSchedule{Labels: []string{}}, nil
+	}
+	if err != nil {
+		return tools.DatabaseSchedule{}, err
+	}
+	if err := json.Unmarshal([]byte(labelsJSON), &schedule.Labels); err != nil {
+		return tools.DatabaseSchedule{}, fmt.Errorf("failed to decode database %s labels: %w", databaseID, err)
+	}
+	return schedule, nil
+}
+
+// GetDefinitionTests returns the test cases bundled with a definition version.
+func (s *Store) GetDefinitionTests(ctx context.Context, definitionID int32, version int) ([]definitions.TestCase, error) {
+	if s == nil || s.conn == nil {
+		return nil, errors.New("primary store not initialized")
+	}
+	rows, err := s.conn.QueryContext(ctx, `
+		SELECT name, query, expect_json
+		FROM atombase_definition_tests
+		WHERE definition_id = ? AND version = ?
+		ORDER BY name
+	`, definitionID, version)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tests []definitions.TestCase
+	for rows.Next() {
+		var test definitions.TestCase
+		var expectJSON sql.NullString
+		if err := rows.Scan(&test.Name, &test.Query, &expectJSON); err != nil {
+			return nil, err
+		}
+		if expectJSON.Valid {
+			if err := json.Unmarshal([]byte(expectJSON.String), &test.Expect); err != nil {
+				return nil, fmt.Errorf("failed to decode test %q expectation: %w", test.Name, err)
+			}
+		}
+		tests = append(tests, test)
+	}
+	return tests, rows.Err()
+}
+
+// ListWebhooks returns the webhooks registered on a database.
+func (s *Store) ListWebhooks(ctx context.Context, databaseID string) ([]Webhook, error) {
+	if s == nil || s.conn == nil {
+		return nil, errors.New("primary store not initialized")
+	}
+	rows, err := s.conn.QueryContext(ctx, `
+		SELECT id, table_name, events_json FROM atombase_webhooks WHERE database_id = ? ORDER BY id
+	`, databaseID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hooks []Webhook
+	for rows.Next() {
+		var hook Webhook
+		var eventsJSON string
+		if err := rows.Scan(&hook.ID, &hook.Table, &eventsJSON); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(eventsJSON), &hook.Events); err != nil {
+			return nil, fmt.Errorf("failed to decode webhook %s events: %w", hook.ID, err)
+		}
+		hooks = append(hooks, hook)
+	}
+	return hooks, rows.Err()
+}
+
+// EnqueueWebhookDelivery queues a payload for the webhook dispatcher.
+func (s *Store) EnqueueWebhookDelivery(ctx context.Context, webhookID, event, table string, payload []byte) error {
+	if s == nil || s.conn == nil {
+		return errors.New("primary store not initialized")
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	_, err := s.conn.ExecContext(ctx, `
+		INSERT INTO atombase_webhook_deliveries (webhook_id, event, table_name, payload, next_attempt_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, webhookID, event, table, string(payload), now, now)
+	return err
+}
+
 func (s *Store) UpdateDatabaseVersion(ctx context.Context, databaseID string, version int) error {
 	if s == nil || s.conn == nil {
 		return errors.New("primary store not initialized")
@@ -446,17 +708,253 @@ func (s *Store) UpdateDatabaseVersion(ctx context.Context, databaseID string, ve
 	return err
 }
 
-func (s *Store) RecordMigrationFailure(ctx context.Context, databaseID string, fromVersion, toVersion int, migrationErr error) {
+// RecordMigrationFailure stores the last failed migration of a database. atomic
+// records whether the migration ran in a transaction; when it did not, the
+// database may hold part of the migration.
+func (s *Store) RecordMigrationFailure(ctx context.Context, databaseID string, fromVersion, toVersion int, atomic bool, migrationErr error) {
 	if s == nil || s.conn == nil || migrationErr == nil {
 		return
 	}
 	_, _ = s.conn.ExecContext(ctx, `
-		INSERT INTO atombase_migration_failures (database_id, from_version, to_version, error, created_at)
-		VALUES (?, ?, ?, ?, ?)
+		INSERT INTO atombase_migration_failures (database_id, from_version, to_version, error, atomic, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
 		ON CONFLICT(database_id) DO UPDATE SET
 			from_version = excluded.from_version,
 			to_version = excluded.to_version,
 			error = excluded.error,
+			atomic = excluded.atomic,
 			created_at = excluded.created_at
-	`, databaseID, fromVersion, toVersion, migrationErr.Error(), time.Now().UTC().Format(time.RFC3339))
+	`, databaseID, fromVersion, toVersion, migrationErr.Error(), atomic, time.Now().UTC().Format(time.RFC3339))
+}
+
+// PutSavedQuery creates or replaces a database's saved query.
+func (s *Store) PutSavedQuery(ctx context.Context, databaseID string, query SavedQuery) error {
+	if s == nil || s.conn == nil {
+		return errors.New("primary store not initialized")
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	_, err := s.conn.ExecContext(ctx, `
+		INSERT INTO atombase_saved_queries (database_id, name, table_name, query_json, params_json, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (database_id, name) DO UPDATE SET
+			table_name = excluded.table_name,
+			query_json = excluded.query_json,
+			params_json = excluded.params_json,
+			updated_at = excluded.updated_at
+	`, databaseID, query.Name, query.Table, string(query.Query), string(query.Params), now, now)
+	return err
+}
+
+// GetSavedQuery returns a database's saved query by name.
+func (s *Store) GetSavedQuery(ctx context.Context, databaseID, name string) (SavedQuery, error) {
+	if s == nil || s.conn == nil {
+		return SavedQuery{}, errors.New("primary store not initialized")
+	}
+	var query SavedQuery
+	var queryJSON, paramsJSON string
+	err := s.conn.QueryRowContext(ctx, `
+		SELECT name, table_name, query_json, params_json, created_at, updated_at
+		FROM atombase_saved_queries WHERE database_id = ? AND name = ?
+	`, databaseID, name).Scan(&query.Name, &query.Table, &queryJSON, &paramsJSON, &query.CreatedAt, &query.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return SavedQuery{}, fmt.Errorf("%w: %s", tools.ErrSavedQueryNotFound, name)
+	}
+	if err != nil {
+		return SavedQuery{}, err
+	}
+	query.Query, query.Params = json.RawMessage(queryJSON), json.RawMessage(paramsJSON)
+	return query, nil
+}
+
+// ListSavedQueries returns a database's saved queries by name.
+func (s *Store) ListSavedQueries(ctx context.Context, databaseID string) ([]SavedQuery, error) {
+	if s == nil || s.conn == nil {
+		return nil, errors.New("primary store not initialized")
+	}
+	rows, err := s.conn.QueryContext(ctx, `
+		SELECT name, table_name, query_json, params_json, created_at, updated_at
+		FROM atombase_saved_queries WHERE database_id = ? ORDER BY name
+	`, databaseID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var queries []SavedQuery
+	for rows.Next() {
+		var query SavedQuery
+		var queryJSON, paramsJSON string
+		if err := rows.Scan(&query.Name, &query.Table, &queryJSON, &paramsJSON, &query.CreatedAt, &query.UpdatedAt); err != nil {
+			return nil, err
+		}
+		query.Query, query.Params = json.RawMessage(queryJSON), json.RawMessage(paramsJSON)
+		queries = append(queries, query)
+	}
+	return queries, rows.Err()
+}
+
+// DeleteSavedQuery removes a database's saved query.
+func (s *Store) DeleteSavedQuery(ctx context.Context, databaseID, name string) error {
+	if s == nil || s.conn == nil {
+		return errors.New("primary store not initialized")
+	}
+	result, err := s.conn.ExecContext(ctx, `DELETE FROM atombase_saved_queries WHERE database_id = ? AND name = ?`, databaseID, name)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("%w: %s", tools.ErrSavedQueryNotFound, name)
+	}
+	return nil
+}
+
+// CreateReport stores a new report schedule.
+func (s *Store) CreateReport(ctx context.Context, report Report) error {
+	if s == nil || s.conn == nil {
+		return errors.New("primary store not initialized")
+	}
+	_, err := s.conn.ExecContext(ctx, `
+		INSERT INTO atombase_reports (id, database_id, query_name, cron, timezone, format, webhook, email, next_run_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, report.ID, report.DatabaseID, report.Query, report.Cron, report.Timezone, report.Format, report.Webhook, report.Email, report.NextRunAt, report.CreatedAt)
+	return err
+}
+
+const reportColumns = `id, database_id, query_name, cron, timezone, format, webhook, email, next_run_at, created_at,
+	COALESCE(last_run_at, ''), COALESCE(last_status, ''), COALESCE(last_error, ''), COALESCE(last_rows, 0), COALESCE(last_url, '')`
+
+func scanReports(rows *sql.Rows) ([]Report, error) {
+	defer rows.Close()
+	var reports []Report
+	for rows.Next() {
+		var r Report
+		if err := rows.Scan(&r.ID, &r.DatabaseID, &r.Query, &r.Cron, &r.Timezone, &r.Format, &r.Webhook, &r.Email, &r.NextRunAt, &r.CreatedAt,
+			&r.LastRunAt, &r.LastStatus, &r.LastError, &r.LastRows, &r.LastURL); err != nil {
+			return nil, err
+		}
+		reports = append(reports, r)
+	}
+	return reports, rows.Err()
+}
+
+// ListReports returns a database's reports, oldest first.
+func (s *Store) ListReports(ctx context.Context, databaseID string) ([]Report, error) {
+	if s == nil || s.conn == nil {
+		return nil, errors.New("primary store not initialized")
+	}
+	rows, err := s.conn.QueryContext(ctx, `SELECT `+reportColumns+` FROM atombase_reports WHERE database_id = ? ORDER BY created_at, id`, databaseID)
+	if err != nil {
+		return nil, err
+	}
+	return scanReports(rows)
+}
+
+// DeleteReport removes a database's report.
+func (s *Store) DeleteReport(ctx context.Context, databaseID, id string) error {
+	if s == nil || s.conn == nil {
+		return errors.New("primary store not initialized")
+	}
+	result, err := s.conn.ExecContext(ctx, `DELETE FROM atombase_reports WHERE id = ? AND database_id = ?`, id, databaseID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("%w: %s", tools.ErrReportNotFound, id)
+	}
+	return nil
+}
+
+// ClaimDueReports locks up to limit reports whose next run is due and returns
+// them. A report stays locked until lockedUntil or until FinishReport, so
+// servers sharing the primary database don't run it twice.
+func (s *Store) ClaimDueReports(ctx context.Context, now, lockedUntil time.Time, limit int) ([]Report, error) {
+	if s == nil || s.conn == nil {
+		return nil, errors.New("primary store not initialized")
+	}
+	nowText := now.UTC().Format(time.RFC3339)
+	rows, err := s.conn.QueryContext(ctx, `
+		SELECT `+reportColumns+` FROM atombase_reports
+		WHERE next_run_at <= ? AND (locked_until IS NULL OR locked_until <= ?)
+		ORDER BY next_run_at LIMIT ?
+	`, nowText, nowText, limit)
+	if err != nil {
+		return nil, err
+	}
+	due, err := scanReports(rows)
+	if err != nil {
+		return nil, err
+	}
+	var claimed []Report
+	for _, r := range due {
+		result, err := s.conn.ExecContext(ctx, `
+			UPDATE atombase_reports SET locked_until = ?
+			WHERE id = ? AND (locked_until IS NULL OR locked_until <= ?)
+		`, lockedUntil.UTC().Format(time.RFC3339), r.ID, nowText)
+		if err != nil {
+			return claimed, err
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			claimed = append(claimed, r)
+		}
+	}
+	return claimed, nil
+}
+
+// FinishReport records a report's run, schedules its next one and unlocks it.
+func (s *Store) FinishReport(ctx context.Context, run Report) error {
+	if s == nil || s.conn == nil {
+		return errors.New("primary store not initialized")
+	}
+	_, err := s.conn.ExecContext(ctx, `
+		UPDATE atombase_reports
+		SET next_run_at = ?, locked_until = NULL, last_run_at = ?, last_status = ?, last_error = ?, last_rows = ?, last_url = ?
+		WHERE id = ?
+	`, run.NextRunAt, run.LastRunAt, run.LastStatus, run.LastError, run.LastRows, run.LastURL, run.ID)
+	return err
+}
+
+// ListRollupDatabases returns the databases whose definition's current
+// version has a time-series table with rollups.
+func (s *Store) ListRollupDatabases(ctx context.Context) ([]string, error) {
+	if s == nil || s.conn == nil {
+		return nil, errors.New("primary store not initialized")
+	}
+	rows, err := s.conn.QueryContext(ctx, `
+		SELECT d.id
+		FROM atombase_databases d
+		JOIN atombase_definitions def ON def.id = d.definition_id
+		JOIN atombase_definitions_history h ON h.definition_id = def.id AND h.version = def.current_version
+		WHERE EXISTS (
+			SELECT 1 FROM json_each(h.schema_json, '$.tables')
+			WHERE json_array_length(value, '$.timeSeries.rollups') > 0
+		)
+		ORDER BY d.id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// LookupDatabaseTarget returns the connection target of a database by ID, for
+// work the server does on its own rather than for a request.
+func (s *Store) LookupDatabaseTarget(ctx context.Context, databaseID string) (definitions.DatabaseTarget, error) {
+	if s == nil || s.conn == nil {
+		return definitions.DatabaseTarget{}, errors.New("primary store not initialized")
+	}
+	return scanDatabaseTarget(s.conn.QueryRowContext(ctx, `
+		SELECT d.id, d.definition_id, def.name, def.definition_type, d.definition_version, d.auth_token_encrypted
+		FROM atombase_databases d
+		JOIN atombase_definitions def ON def.id = d.definition_id
+		WHERE d.id = ?
+	`, databaseID))
 }
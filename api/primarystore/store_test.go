@@ -2,10 +2,13 @@ package primarystore
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
+	"errors"
 	"testing"
 
 	"github.com/atombasedev/atombase/definitions"
+	"github.com/atombasedev/atombase/tools"
 	_ "github.com/mattn/go-sqlite3"
 )
 
@@ -28,6 +31,17 @@ CREATE TABLE atombase_users (
 	id TEXT PRIMARY KEY NOT NULL,
 	database_id TEXT UNIQUE
 );
+CREATE TABLE atombase_row_tenants (
+	user_id TEXT PRIMARY KEY,
+	database_id TEXT NOT NULL,
+	created_at TEXT NOT NULL
+);
+CREATE TABLE atombase_tenant_moves (
+	user_id TEXT PRIMARY KEY,
+	from_database_id TEXT NOT NULL,
+	to_database_id TEXT NOT NULL,
+	started_at TEXT NOT NULL
+);
 CREATE TABLE atombase_organizations (
 	id TEXT PRIMARY KEY NOT NULL,
 	database_id TEXT NOT NULL UNIQUE,
@@ -50,13 +64,54 @@ CREATE TABLE atombase_migrations (
 	sql TEXT NOT NULL,
 	created_at TEXT NOT NULL
 );
+CREATE TABLE atombase_migration_windows (
+	migration_id INTEGER PRIMARY KEY,
+	windows_json TEXT NOT NULL
+);
 CREATE TABLE atombase_migration_failures (
 	database_id TEXT PRIMARY KEY,
 	from_version INTEGER NOT NULL,
 	to_version INTEGER NOT NULL,
 	error TEXT,
+	atomic INTEGER NOT NULL DEFAULT 1,
 	created_at TEXT NOT NULL
 );
+CREATE TABLE atombase_api_keys (
+	id TEXT PRIMARY KEY NOT NULL,
+	name TEXT NOT NULL,
+	secret_hash BLOB NOT NULL,
+	database_id TEXT,
+	tables_json TEXT NOT NULL DEFAULT '[]',
+	verbs_json TEXT NOT NULL,
+	created_at TEXT NOT NULL DEFAULT ''
+);
+CREATE TABLE atombase_service_accounts (
+	id TEXT PRIMARY KEY NOT NULL,
+	name TEXT NOT NULL,
+	public_key BLOB NOT NULL UNIQUE,
+	org_id TEXT,
+	role TEXT,
+	database_id TEXT,
+	tables_json TEXT NOT NULL DEFAULT '[]',
+	verbs_json TEXT NOT NULL,
+	created_at TEXT NOT NULL DEFAULT ''
+);
+CREATE TABLE atombase_api_key_orgs (
+	key_id TEXT PRIMARY KEY,
+	org_id TEXT NOT NULL,
+	role TEXT NOT NULL DEFAULT 'owner',
+	member_email TEXT
+);
+CREATE TABLE atombase_definition_orgs (
+	definition_id INTEGER PRIMARY KEY,
+	org_id TEXT NOT NULL
+);
+CREATE TABLE atombase_definitions_history (
+	definition_id INTEGER NOT NULL,
+	version INTEGER NOT NULL,
+	schema_json TEXT NOT NULL,
+	PRIMARY KEY(definition_id, version)
+);
 `
 
 func setupStore(t *testing.T) (*Store, *sql.DB) {
@@ -130,6 +185,116 @@ func TestResolveDatabaseTarget_MissingHeaderRules(t *testing.T) {
 	}
 }
 
+func TestResolveDatabaseTarget_TokenDatabase(t *testing.T) {
+	store, db := setupStore(t)
+	defer db.Close()
+
+	_, _ = db.Exec(`INSERT INTO atombase_definitions (id, name, definition_type, current_version) VALUES (1, 'market', 'global', 1), (2, 'notes', 'user', 1), (3, 'workspace', 'organization', 1)`)
+	_, _ = db.Exec(`INSERT INTO atombase_databases (id, definition_id, definition_version) VALUES ('global-market', 1, 1), ('global-other', 1, 1), ('user-notes-db', 2, 1), ('org-db', 3, 1)`)
+	_, _ = db.Exec(`INSERT INTO atombase_organizations (id, database_id, name, owner_id) VALUES ('org-1', 'org-db', 'Acme', 'user-1')`)
+	ctx := context.Background()
+
+	principal := definitions.Principal{UserID: "app-user", TokenDatabase: "global-market"}
+	target, err := store.ResolveDatabaseTarget(ctx, principal, "")
+	if err != nil || target.DatabaseID != "global-market" {
+		t.Fatalf("expected the token's database without a header, got %#v, %v", target, err)
+	}
+	if _, err := store.ResolveDatabaseTarget(ctx, principal, "global:global-market"); err != nil {
+		t.Fatalf("header naming the token's database: %v", err)
+	}
+	if _, err := store.ResolveDatabaseTarget(ctx, principal, "global:global-other"); err == nil {
+		t.Fatal("expected a token to be refused for another database")
+	}
+
+	orgPrincipal := definitions.Principal{UserID: "app-user", TokenDatabase: "org-db"}
+	if target, err := store.ResolveDatabaseTarget(ctx, orgPrincipal, "org:org-1"); err != nil || target.DatabaseID != "org-db" {
+		t.Fatalf("org token: %#v, %v", target, err)
+	}
+	if _, err := store.ResolveDatabaseTarget(ctx, definitions.Principal{UserID: "app-user", TokenDatabase: "user-notes-db"}, ""); err == nil {
+		t.Fatal("expected user definition databases to be unreachable by token")
+	}
+}
+
+func TestLookupAPIKey(t *testing.T) {
+	store, db := setupStore(t)
+	defer db.Close()
+
+	hash := sha256.Sum256([]byte("s3cret"))
+	_, _ = db.Exec(`INSERT INTO atombase_api_keys (id, name, secret_hash, database_id, tables_json, verbs_json) VALUES ('key_1', 'reports', ?, 'global-market', '["orders"]', '["read"]')`, hash[:])
+	_, _ = db.Exec(`INSERT INTO atombase_api_keys (id, name, secret_hash, verbs_json) VALUES ('key_2', 'ops', ?, '["admin"]')`, hash[:])
+	ctx := context.Background()
+
+	scope, err := store.LookupAPIKey(ctx, "key_1", "s3cret")
+	if err != nil {
+		t.Fatalf("lookup: %v", err)
+	}
+	if scope.KeyID != "key_1" || scope.Database != "global-market" || len(scope.Tables) != 1 || scope.Tables[0] != "orders" || len(scope.Verbs) != 1 || scope.Verbs[0] != "read" {
+		t.Fatalf("unexpected scope %#v", scope)
+	}
+	if scope, err := store.LookupAPIKey(ctx, "key_2", "s3cret"); err != nil || !scope.FullAccess() {
+		t.Fatalf("expected an unscoped admin key, got %#v, %v", scope, err)
+	}
+	if _, err := store.LookupAPIKey(ctx, "key_1", "wrong"); !errors.Is(err, tools.ErrAPIKeyNotFound) {
+		t.Fatalf("expected a wrong secret to fail, got %v", err)
+	}
+	if _, err := store.LookupAPIKey(ctx, "key_3", "s3cret"); !errors.Is(err, tools.ErrAPIKeyNotFound) {
+		t.Fatalf("expected an unknown key to fail, got %v", err)
+	}
+
+	// A database-scoped key reaches only its database.
+	_, _ = db.Exec(`INSERT INTO atombase_definitions (id, name, definition_type, current_version) VALUES (1, 'market', 'global', 1)`)
+	_, _ = db.Exec(`INSERT INTO atombase_databases (id, definition_id, definition_version) VALUES ('global-market', 1, 1), ('global-other', 1, 1)`)
+	principal := definitions.Principal{IsService: true, KeyScope: scope, TokenDatabase: scope.Database}
+	if target, err := store.ResolveDatabaseTarget(ctx, principal, ""); err != nil || target.DatabaseID != "global-market" {
+		t.Fatalf("expected the key's database, got %#v, %v", target, err)
+	}
+	if _, err := store.ResolveDatabaseTarget(ctx, principal, "global:global-other"); err == nil {
+		t.Fatal("expected a scoped key to be refused for another database")
+	}
+
+	// A key of a platform org reaches only databases of the org's definitions.
+	_, _ = db.Exec(`INSERT INTO atombase_api_keys (id, name, secret_hash, verbs_json) VALUES ('key_3', 'acme', ?, '["read"]')`, hash[:])
+	_, _ = db.Exec(`INSERT INTO atombase_api_key_orgs (key_id, org_id) VALUES ('key_3', 'acme')`)
+	orgScope, err := store.LookupAPIKey(ctx, "key_3", "s3cret")
+	if err != nil || orgScope.Org != "acme" || orgScope.Role != "owner" || orgScope.FullAccess() {
+		t.Fatalf("expected an acme key, got %#v, %v", orgScope, err)
+	}
+	orgPrincipal := definitions.Principal{IsService: true, KeyScope: orgScope}
+	if _, err := store.ResolveDatabaseTarget(ctx, orgPrincipal, "global:global-market"); !errors.Is(err, tools.ErrDatabaseNotFound) {
+		t.Fatalf("expected another org's database to be hidden, got %v", err)
+	}
+	_, _ = db.Exec(`INSERT INTO atombase_definition_orgs (definition_id, org_id) VALUES (1, 'acme')`)
+	if _, err := store.ResolveDatabaseTarget(ctx, orgPrincipal, "global:global-market"); err != nil {
+		t.Fatalf("expected the org's database, got %v", err)
+	}
+}
+
+func TestResolveDatabaseTarget_RowTenant(t *testing.T) {
+	store, db := setupStore(t)
+	defer db.Close()
+
+	_, _ = db.Exec(`INSERT INTO atombase_definitions (id, name, definition_type, current_version) VALUES (2, 'notes', 'user', 1)`)
+	_, _ = db.Exec(`INSERT INTO atombase_databases (id, definition_id, definition_version) VALUES ('shared-db', 2, 1), ('user-2-db', 2, 1)`)
+	_, _ = db.Exec(`INSERT INTO atombase_users (id, database_id) VALUES ('user-1', NULL), ('user-2', 'user-2-db')`)
+	_, _ = db.Exec(`INSERT INTO atombase_row_tenants (user_id, database_id, created_at) VALUES ('user-1', 'shared-db', ''), ('user-2', 'shared-db', '')`)
+
+	shared, err := store.ResolveDatabaseTarget(context.Background(), definitions.Principal{UserID: "user-1"}, "")
+	if err != nil {
+		t.Fatalf("resolve row tenant failed: %v", err)
+	}
+	if shared.DatabaseID != "shared-db" || shared.RowTenant != "user-1" {
+		t.Fatalf("expected shared-db scoped to user-1, got %#v", shared)
+	}
+
+	dedicated, err := store.ResolveDatabaseTarget(context.Background(), definitions.Principal{UserID: "user-2"}, "")
+	if err != nil {
+		t.Fatalf("resolve dedicated failed: %v", err)
+	}
+	if dedicated.DatabaseID != "user-2-db" || dedicated.RowTenant != "" {
+		t.Fatalf("expected dedicated database to take precedence, got %#v", dedicated)
+	}
+}
+
 func TestLoadAccessPolicyAndMigrations(t *testing.T) {
 	store, db := setupStore(t)
 	defer db.Close()
@@ -153,3 +318,28 @@ func TestLoadAccessPolicyAndMigrations(t *testing.T) {
 		t.Fatalf("expected one migration with one statement, got %#v", migrations)
 	}
 }
+
+func TestListRollupDatabases(t *testing.T) {
+	store, db := setupStore(t)
+	defer db.Close()
+
+	for _, stmt := range []string{
+		`INSERT INTO atombase_definitions (id, name, definition_type, current_version) VALUES (1, 'metrics', 'global', 2), (2, 'notes', 'global', 1)`,
+		`INSERT INTO atombase_definitions_history (definition_id, version, schema_json) VALUES
+			(1, 1, '{"tables":[{"name":"events","timeSeries":{"column":"at"}}]}'),
+			(1, 2, '{"tables":[{"name":"events","timeSeries":{"column":"at","rollups":[{"resolution":"hour","aggregates":{"n":{"fn":"count"}}}]}}]}'),
+			(2, 1, '{"tables":[{"name":"notes"}]}')`,
+		`INSERT INTO atombase_databases (id, definition_id) VALUES ('db_metrics', 1), ('db_notes', 2)`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ids, err := store.ListRollupDatabases(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 || ids[0] != "db_metrics" {
+		t.Fatalf("expected only the database with rollups, got %v", ids)
+	}
+}
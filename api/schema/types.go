@@ -2,7 +2,145 @@ package schema
 
 // Schema represents a complete database schema.
 type Schema struct {
-	Tables []Table `json:"tables"`
+	Tables   []Table      `json:"tables"`
+	Views    []View       `json:"views,omitempty"`    // Read-only tables defined by a SELECT, created in order
+	Settings *APISettings `json:"settings,omitempty"` // Data API behavior for databases using this schema
+}
+
+// View is a named SELECT over the schema's tables and earlier views. The Data
+// API serves it like a table but only for reads.
+type View struct {
+	Name    string            `json:"name"`
+	Select  string            `json:"select"`            // SELECT statement the view returns
+	Columns map[string]string `json:"columns,omitempty"` // Result column -> type, resolved from Select when the schema is saved
+}
+
+// APISettings configures how the Data API serves a schema's tables.
+// Unset fields fall back to the server configuration.
+type APISettings struct {
+	DefaultLimit     *int                        `json:"defaultLimit,omitempty"`     // Rows returned when a select has no limit
+	MaxLimit         *int                        `json:"maxLimit,omitempty"`         // Largest limit a select may request
+	AllowedOperators []string                    `json:"allowedOperators,omitempty"` // Filter operators accepted in where clauses (empty allows all)
+	AllowRawSQL      bool                        `json:"allowRawSql,omitempty"`      // Whether raw SQL execution is permitted
+	SoftDelete       map[string]string           `json:"softDelete,omitempty"`       // Table -> nullable column stamped instead of deleting rows
+	TenantColumn     string                      `json:"tenantColumn,omitempty"`     // Column scoping rows to users sharing one database (user definitions only)
+	QueryAllowlist   []string                    `json:"queryAllowlist,omitempty"`   // Query shapes the Data API accepts (empty accepts any query)
+	Validation       map[string]TableValidation  `json:"validation,omitempty"`       // Table -> checks run on insert and update data before any SQL
+	DefaultLanguage  string                      `json:"defaultLanguage,omitempty"`  // Fallback language for localized fields
+	Localized        map[string]LocalizedFields  `json:"localized,omitempty"`        // Table -> translated fields selects can return
+	Naming           *NamingPolicy               `json:"naming,omitempty"`           // Rules table, column, index and field names must follow
+	IndexForeignKeys bool                        `json:"indexForeignKeys,omitempty"` // Index each foreign key column a create or push adds
+	Functions        map[string]Function         `json:"functions,omitempty"`        // Name -> SQL statement run by POST /data/rpc/{name}
+	RateLimits       map[string]RateLimit        `json:"rateLimits,omitempty"`       // Role -> request budget of each end user: anonymous, user or a JWT role claim
+	Presence         map[string]PresenceChannel  `json:"presence,omitempty"`         // Channel name, or a prefix ending in *, -> who may join it
+	Broadcast        map[string]BroadcastChannel `json:"broadcast,omitempty"`        // Channel name, or a prefix ending in *, -> who may subscribe and publish
+	Conflicts        map[string]ConflictRule     `json:"conflicts,omitempty"`        // Table -> how writes to rows changed since the writer saw them are settled
+	Backup           *BackupPolicy               `json:"backup,omitempty"`           // How often databases of the definition are backed up
+}
+
+// BackupPolicy schedules backups of every database of a definition.
+type BackupPolicy struct {
+	Interval string `json:"interval"`         // Time between backups of a database, e.g. "6h" or "24h"
+	Retain   int    `json:"retain,omitempty"` // Backups kept per database, newest first (default 7)
+	// Log every row change so a database can be restored to any time since
+	// its oldest backup.
+	PointInTime bool `json:"pointInTime,omitempty"`
+}
+
+// ConflictRule says how a table settles a sync push to a row that changed on
+// the server after the client pulled it. serverWins also keeps existing rows
+// on upserts.
+type ConflictRule struct {
+	Strategy string `json:"strategy"`           // serverWins, clientWins, merge or rpc
+	Function string `json:"function,omitempty"` // rpc: the function in settings.functions that resolves conflicts
+}
+
+// BroadcastChannel says who may use a broadcast channel. Callers must be
+// signed in, and carry every claim of the rule with the same value; service
+// callers may do both.
+type BroadcastChannel struct {
+	Subscribe map[string]any `json:"subscribe,omitempty"` // Claim -> value a subscriber's JWT must carry
+	Publish   map[string]any `json:"publish,omitempty"`   // Claim -> value a publisher's JWT must carry
+}
+
+// PresenceChannel says who may join a presence channel. Members must be
+// signed in, and carry every claim in Claims with the same value.
+type PresenceChannel struct {
+	Claims     map[string]any `json:"claims,omitempty"`     // Claim -> value a member's JWT must carry
+	MaxMembers int            `json:"maxMembers,omitempty"` // Most members at once (0 uses the server limit)
+}
+
+// RateLimit is the request budget each end user of a role has on one
+// database: Rate requests per second on average, in bursts of up to Burst.
+type RateLimit struct {
+	Rate  float64 `json:"rate"`            // Requests per second
+	Burst int     `json:"burst,omitempty"` // Requests allowed at once (defaults to the rate, rounded up)
+}
+
+// Function is a SQL statement the Data API runs by name. Its :name
+// placeholders bind the call's params; :auth_id binds the caller's user ID.
+// The statement runs as written, without access policies, so Access decides
+// who may call it.
+type Function struct {
+	SQL    string                   `json:"sql"`
+	Params map[string]FunctionParam `json:"params,omitempty"` // Keyed by placeholder name
+	Access string                   `json:"access,omitempty"` // service (default), user or public
+}
+
+// FunctionParam declares the type of a function param and what it takes
+// when a call leaves it out.
+type FunctionParam struct {
+	Type     string `json:"type"`               // text, integer, real or boolean
+	Required bool   `json:"required,omitempty"` // Calls must pass it
+	Default  any    `json:"default,omitempty"`  // Value when not passed (null without one)
+}
+
+// NamingPolicy constrains the names a definition's schema may use, so they
+// stay valid in generated client code. Reserved words and prefixes match
+// case-insensitively.
+type NamingPolicy struct {
+	Case              string   `json:"case,omitempty"`              // snake, camel or pascal (empty allows any)
+	MaxLength         int      `json:"maxLength,omitempty"`         // Longest allowed name (0 keeps the server limit)
+	ForbiddenPrefixes []string `json:"forbiddenPrefixes,omitempty"` // Prefixes no name may start with
+	ReservedWords     []string `json:"reservedWords,omitempty"`     // Names no table, column, index or field may have
+}
+
+// LocalizedFields maps a virtual field name, like title, to its translations.
+type LocalizedFields map[string]LocalizedField
+
+// LocalizedField says where a field's translations live: one column per
+// language (title_en, title_de) or a JSON object column keyed by language.
+// Exactly one of Columns and JSONColumn is set.
+type LocalizedField struct {
+	Columns    map[string]string `json:"columns,omitempty"`    // Language -> column, e.g. {"en": "title_en"}
+	JSONColumn string            `json:"jsonColumn,omitempty"` // Column holding {"en": "...", "de": "..."}
+}
+
+// TableValidation declares the checks the Data API runs on a table's writes.
+type TableValidation struct {
+	Columns map[string]ColumnRule `json:"columns,omitempty"` // Keyed by column name
+	Rules   []FieldRule           `json:"rules,omitempty"`   // Comparisons between columns of the same row
+}
+
+// ColumnRule constrains the values written to one column. Value checks skip
+// columns a write leaves out or sets to null.
+type ColumnRule struct {
+	Required  []string `json:"required,omitempty"`  // Operations that must set a non-null value: insert, update
+	Pattern   string   `json:"pattern,omitempty"`   // Regular expression text values must match
+	Min       *float64 `json:"min,omitempty"`       // Smallest allowed number
+	Max       *float64 `json:"max,omitempty"`       // Largest allowed number
+	MinLength *int     `json:"minLength,omitempty"` // Shortest allowed text, in characters
+	MaxLength *int     `json:"maxLength,omitempty"` // Longest allowed text, in characters
+	Message   string   `json:"message,omitempty"`   // Replaces the default violation message
+}
+
+// FieldRule compares two columns of a written row, e.g. starts_at lte ends_at.
+// It applies when the write sets both columns.
+type FieldRule struct {
+	Column  string `json:"column"`
+	Op      string `json:"op"` // eq, neq, lt, lte, gt, gte
+	Other   string `json:"other"`
+	Message string `json:"message,omitempty"`
 }
 
 // Table represents a database table's schema.
@@ -12,6 +150,32 @@ type Table struct {
 	Columns    map[string]Col `json:"columns"`              // Keyed by column name
 	Indexes    []Index        `json:"indexes,omitempty"`    // Table indexes
 	FTSColumns []string       `json:"ftsColumns,omitempty"` // Columns for FTS5 full-text search
+	GeoColumns []string       `json:"geoColumns,omitempty"` // Latitude and longitude columns indexed with an R*Tree
+	Sync       bool           `json:"sync,omitempty"`       // Log row changes for offline sync clients
+	TimeSeries *TimeSeries    `json:"timeSeries,omitempty"` // Partition rows by month of a timestamp column
+}
+
+// TimeSeries moves a table's rows into a partition per month once the month
+// is over, keeping the table itself to the current month's rows.
+type TimeSeries struct {
+	Column    string   `json:"column"`              // INTEGER unix seconds or TEXT ISO-8601 timestamp rows are partitioned by
+	Retention int      `json:"retention,omitempty"` // Months of partitions kept before the current one (0 keeps all)
+	Archive   bool     `json:"archive,omitempty"`   // Upload partitions past retention to the export bucket before dropping them
+	Rollups   []Rollup `json:"rollups,omitempty"`   // Aggregates kept per interval, read with ?resolution=
+}
+
+// Rollup keeps aggregates of a time-series table's rows per interval, so
+// reads over long ranges don't scan every row.
+type Rollup struct {
+	Resolution string               `json:"resolution"`        // minute, hour or day
+	GroupBy    []string             `json:"groupBy,omitempty"` // Columns aggregated separately
+	Aggregates map[string]Aggregate `json:"aggregates"`        // Rollup columns by name
+}
+
+// Aggregate is a column of a rollup.
+type Aggregate struct {
+	Fn     string `json:"fn"`               // count, sum, avg, min or max
+	Column string `json:"column,omitempty"` // Column aggregated; count without one counts rows
 }
 
 // Index represents a database index definition.
@@ -0,0 +1,304 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/atombasedev/atombase/config"
+	"github.com/atombasedev/atombase/tools"
+)
+
+// oidcStateCookie carries the state, nonce and PKCE verifier of a sign-in in
+// progress from /admin/oidc/login to the callback.
+const oidcStateCookie = "atombase_oidc"
+
+// AdminLoginRequest is the body of POST /admin/login.
+type AdminLoginRequest struct {
+	APIKey string `json:"apiKey"`
+}
+
+// AdminSessionResponse describes the caller's admin session. CSRFToken is
+// the value to send in X-CSRF-Token, also readable from the atombase_csrf
+// cookie.
+type AdminSessionResponse struct {
+	Subject   string    `json:"subject"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	CSRFToken string    `json:"csrfToken"`
+}
+
+// registerAdminRoutes adds the browser sign-in routes when admin sessions are
+// enabled. They sit outside /platform so a browser without a session can
+// reach them.
+func registerAdminRoutes(app *http.ServeMux) {
+	if !config.Cfg.AdminSessions {
+		return
+	}
+	app.HandleFunc("POST /admin/login", handleAdminLogin)
+	app.HandleFunc("POST /admin/logout", handleAdminLogout)
+	app.HandleFunc("GET /admin/session", handleGetAdminSession)
+	if config.Cfg.AdminOIDCIssuer != "" {
+		app.HandleFunc("GET /admin/oidc/login", handleAdminOIDCLogin)
+		app.HandleFunc("GET /admin/oidc/callback", handleAdminOIDCCallback)
+	}
+}
+
+func adminSessionResponse(session *tools.AdminSession) AdminSessionResponse {
+	return AdminSessionResponse{
+		Subject:   session.Subject,
+		ExpiresAt: time.Unix(session.ExpiresAt, 0).UTC(),
+		CSRFToken: session.CSRF,
+	}
+}
+
+// handleAdminLogin handles POST /admin/login, trading the service key for a
+// session cookie.
+func handleAdminLogin(w http.ResponseWriter, r *http.Request) {
+	tools.LimitBody(w, r)
+	defer r.Body.Close()
+	var req AdminLoginRequest
+	if err := tools.DecodeJSON(r.Body, &req); err != nil {
+		tools.RespErr(w, tools.ErrInvalidJSON)
+		return
+	}
+	apiKey := config.Cfg.APIKey
+	if apiKey == "" || subtle.ConstantTimeCompare([]byte(req.APIKey), []byte(apiKey)) != 1 {
+		tools.RespErr(w, tools.ErrAdminLoginFailed)
+		return
+	}
+	session, err := tools.IssueAdminSession(w, "service", time.Now())
+	if err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	tools.RespondJSON(w, http.StatusOK, adminSessionResponse(session))
+}
+
+// handleAdminLogout handles POST /admin/logout. Sessions are stateless, so
+// this only clears the browser's cookies.
+func handleAdminLogout(w http.ResponseWriter, r *http.Request) {
+	tools.ClearAdminSession(w)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleGetAdminSession handles GET /admin/session, which pages call to learn
+// whether to show the sign-in form.
+func handleGetAdminSession(w http.ResponseWriter, r *http.Request) {
+	session, ok := tools.ReadAdminSession(r, time.Now())
+	if !ok {
+		tools.RespErr(w, fmt.Errorf("%w: no admin session", tools.ErrAdminLoginFailed))
+		return
+	}
+	tools.RespondJSON(w, http.StatusOK, adminSessionResponse(session))
+}
+
+// oidcProvider is the part of an issuer's discovery document sign-in uses.
+type oidcProvider struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+}
+
+var oidcClient = &http.Client{Timeout: 10 * time.Second}
+
+func discoverOIDC(ctx context.Context) (*oidcProvider, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, config.Cfg.AdminOIDCIssuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := oidcClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("oidc discovery: %s", res.Status)
+	}
+	var provider oidcProvider
+	if err := json.NewDecoder(res.Body).Decode(&provider); err != nil {
+		return nil, err
+	}
+	if provider.AuthorizationEndpoint == "" || provider.TokenEndpoint == "" {
+		return nil, fmt.Errorf("oidc discovery: missing endpoints")
+	}
+	return &provider, nil
+}
+
+func oidcRedirectURI() string {
+	return strings.TrimRight(config.Cfg.ApiURL, "/") + "/admin/oidc/callback"
+}
+
+func randomToken() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// handleAdminOIDCLogin handles GET /admin/oidc/login, sending the browser to
+// the issuer with a fresh state, nonce and PKCE challenge.
+func handleAdminOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	provider, err := discoverOIDC(r.Context())
+	if err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	var values [3]string // state, nonce, verifier
+	for i := range values {
+		if values[i], err = randomToken(); err != nil {
+			tools.RespErr(w, err)
+			return
+		}
+	}
+	challenge := sha256.Sum256([]byte(values[2]))
+	// Lax, not Strict: the issuer's redirect back is a cross-site navigation.
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    strings.Join(values[:], "."),
+		Path:     "/admin/oidc/",
+		MaxAge:   600,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(config.Cfg.ApiURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {config.Cfg.AdminOIDCClientID},
+		"redirect_uri":          {oidcRedirectURI()},
+		"scope":                 {"openid email"},
+		"state":                 {values[0]},
+		"nonce":                 {values[1]},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	separator := "?"
+	if strings.Contains(provider.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	http.Redirect(w, r, provider.AuthorizationEndpoint+separator+query.Encode(), http.StatusFound)
+}
+
+// handleAdminOIDCCallback handles GET /admin/oidc/callback: it redeems the
+// code, checks the ID token and signs in an allowed email.
+func handleAdminOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil {
+		tools.RespErr(w, fmt.Errorf("%w: sign-in expired, start again", tools.ErrAdminLoginFailed))
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: "/admin/oidc/", MaxAge: -1})
+	values := strings.Split(cookie.Value, ".")
+	state := r.URL.Query().Get("state")
+	if len(values) != 3 || state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(values[0])) != 1 {
+		tools.RespErr(w, fmt.Errorf("%w: state mismatch", tools.ErrAdminLoginFailed))
+		return
+	}
+	code := r.URL.Query().Get("code")
+	if code == "" {
+		tools.RespErr(w, fmt.Errorf("%w: %s", tools.ErrAdminLoginFailed, r.URL.Query().Get("error")))
+		return
+	}
+	provider, err := discoverOIDC(r.Context())
+	if err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	email, err := redeemOIDCCode(r.Context(), provider, code, values[1], values[2], time.Now())
+	if err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	if _, err := tools.IssueAdminSession(w, email, time.Now()); err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	http.Redirect(w, r, "/docs", http.StatusFound)
+}
+
+// oidcClaims are the ID token claims sign-in checks.
+type oidcClaims struct {
+	Issuer        string          `json:"iss"`
+	Audience      json.RawMessage `json:"aud"` // A string or an array
+	ExpiresAt     int64           `json:"exp"`
+	Nonce         string          `json:"nonce"`
+	Email         string          `json:"email"`
+	EmailVerified bool            `json:"email_verified"`
+}
+
+// redeemOIDCCode exchanges code for an ID token and returns its email when
+// the admin may sign in. The token comes straight from the issuer's token
+// endpoint over TLS, which OpenID Connect accepts in place of checking its
+// signature.
+func redeemOIDCCode(ctx context.Context, provider *oidcProvider, code, nonce, verifier string, now time.Time) (string, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {oidcRedirectURI()},
+		"client_id":     {config.Cfg.AdminOIDCClientID},
+		"client_secret": {config.Cfg.AdminOIDCClientSecret},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, provider.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	res, err := oidcClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%w: token endpoint answered %s", tools.ErrAdminLoginFailed, res.Status)
+	}
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&tokens); err != nil {
+		return "", err
+	}
+	parts := strings.Split(tokens.IDToken, ".")
+	if len(parts) != 3 {
+		return "", fmt.Errorf("%w: no id token", tools.ErrAdminLoginFailed)
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", fmt.Errorf("%w: malformed id token", tools.ErrAdminLoginFailed)
+	}
+	var claims oidcClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return "", fmt.Errorf("%w: malformed id token", tools.ErrAdminLoginFailed)
+	}
+	var audiences []string
+	if err := json.Unmarshal(claims.Audience, &audiences); err != nil {
+		var single string
+		json.Unmarshal(claims.Audience, &single)
+		audiences = []string{single}
+	}
+	switch {
+	case strings.TrimRight(claims.Issuer, "/") != config.Cfg.AdminOIDCIssuer:
+		return "", fmt.Errorf("%w: id token from another issuer", tools.ErrAdminLoginFailed)
+	case !slices.Contains(audiences, config.Cfg.AdminOIDCClientID):
+		return "", fmt.Errorf("%w: id token for another client", tools.ErrAdminLoginFailed)
+	case now.Unix() >= claims.ExpiresAt:
+		return "", fmt.Errorf("%w: id token expired", tools.ErrAdminLoginFailed)
+	case subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1:
+		return "", fmt.Errorf("%w: nonce mismatch", tools.ErrAdminLoginFailed)
+	}
+	email := strings.ToLower(claims.Email)
+	if !claims.EmailVerified || !slices.Contains(config.Cfg.AdminOIDCEmails, email) {
+		return "", fmt.Errorf("%w: %s is not an allowed admin", tools.ErrAdminLoginFailed, email)
+	}
+	return email, nil
+}
@@ -0,0 +1,166 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/atombasedev/atombase/config"
+	"github.com/atombasedev/atombase/tools"
+)
+
+// enableAdminSessions turns admin sessions on for a server built afterwards.
+func enableAdminSessions(t *testing.T, issuer string) {
+	t.Helper()
+	prevCfg := config.Cfg
+	config.Cfg.AdminSessions = true
+	config.Cfg.AdminSessionTTL = 60
+	config.Cfg.AdminOIDCIssuer = issuer
+	config.Cfg.AdminOIDCClientID = "atombase"
+	config.Cfg.AdminOIDCClientSecret = "client-secret"
+	config.Cfg.AdminOIDCEmails = []string{"ada@example.com"}
+	t.Cleanup(func() { config.Cfg = prevCfg })
+}
+
+func TestAdminSessionLogin(t *testing.T) {
+	enableAdminSessions(t, "")
+	srv, _ := setupSmokeServer(t, t.TempDir())
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		srv.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := serve(httptest.NewRequest(http.MethodPost, "/admin/login", strings.NewReader(`{"apiKey": "wrong"}`))); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected a wrong key to be refused, got %d %s", rec.Code, rec.Body.String())
+	}
+	rec := serve(httptest.NewRequest(http.MethodPost, "/admin/login", strings.NewReader(`{"apiKey": "smoke-key"}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected the service key to sign in, got %d %s", rec.Code, rec.Body.String())
+	}
+	var session AdminSessionResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &session); err != nil || session.Subject != "service" || session.CSRFToken == "" {
+		t.Fatalf("expected a service session, got %s (%v)", rec.Body.String(), err)
+	}
+	cookies := rec.Result().Cookies()
+	for _, cookie := range cookies {
+		if cookie.SameSite != http.SameSiteStrictMode || (cookie.Name == tools.AdminSessionCookie) != cookie.HttpOnly {
+			t.Fatalf("expected strict cookies with an HttpOnly session, got %+v", cookie)
+		}
+	}
+	withCookies := func(method, path, body string) *http.Request {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		return req
+	}
+
+	if rec := serve(withCookies(http.MethodGet, "/platform/definitions", "")); rec.Code != http.StatusOK {
+		t.Fatalf("expected the session to read the platform API, got %d %s", rec.Code, rec.Body.String())
+	}
+	definition := `{"name": "shop", "type": "global",
+		"schema": {"tables": [{"name": "posts", "pk": ["id"], "columns": {"id": {"name": "id", "type": "INTEGER"}}}]}}`
+	if rec := serve(withCookies(http.MethodPost, "/platform/definitions", definition)); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected a change without the CSRF header to be refused, got %d %s", rec.Code, rec.Body.String())
+	}
+	req := withCookies(http.MethodPost, "/platform/definitions", definition)
+	req.Header.Set(tools.CSRFHeader, session.CSRFToken)
+	if rec := serve(req); rec.Code != http.StatusCreated {
+		t.Fatalf("expected a change with the CSRF header to pass, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	rec = serve(withCookies(http.MethodPost, "/admin/logout", ""))
+	if rec.Code != http.StatusNoContent || len(rec.Result().Cookies()) != 2 || rec.Result().Cookies()[0].MaxAge >= 0 {
+		t.Fatalf("expected logout to expire the cookies, got %d %+v", rec.Code, rec.Result().Cookies())
+	}
+
+	config.Cfg.APIKey = "rotated-key"
+	if rec := serve(withCookies(http.MethodGet, "/platform/definitions", "")); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected rotating the service key to end the session, got %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestAdminSessionOIDC(t *testing.T) {
+	var challenge, nonce, email string
+	issuer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		base := "http://" + r.Host
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			json.NewEncoder(w).Encode(map[string]string{
+				"issuer": base, "authorization_endpoint": base + "/authorize", "token_endpoint": base + "/token",
+			})
+		case "/token":
+			r.ParseForm()
+			sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+			if r.PostForm.Get("code") != "the-code" || base64.RawURLEncoding.EncodeToString(sum[:]) != challenge {
+				http.Error(w, "bad grant", http.StatusBadRequest)
+				return
+			}
+			claims, _ := json.Marshal(map[string]any{
+				"iss": base, "aud": "atombase", "exp": time.Now().Add(time.Minute).Unix(),
+				"nonce": nonce, "email": email, "email_verified": true,
+			})
+			json.NewEncoder(w).Encode(map[string]string{
+				"id_token": "eyJhbGciOiJSUzI1NiJ9." + base64.RawURLEncoding.EncodeToString(claims) + ".sig",
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer issuer.Close()
+	enableAdminSessions(t, issuer.URL)
+	srv, _ := setupSmokeServer(t, t.TempDir())
+
+	signIn := func(as string) *httptest.ResponseRecorder {
+		t.Helper()
+		email = as
+		rec := httptest.NewRecorder()
+		srv.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/oidc/login", nil))
+		if rec.Code != http.StatusFound {
+			t.Fatalf("expected a redirect to the issuer, got %d %s", rec.Code, rec.Body.String())
+		}
+		location, err := url.Parse(rec.Header().Get("Location"))
+		if err != nil || !strings.HasPrefix(location.String(), issuer.URL+"/authorize?") {
+			t.Fatalf("unexpected redirect %q (%v)", rec.Header().Get("Location"), err)
+		}
+		challenge, nonce = location.Query().Get("code_challenge"), location.Query().Get("nonce")
+
+		req := httptest.NewRequest(http.MethodGet, "/admin/oidc/callback?code=the-code&state="+location.Query().Get("state"), nil)
+		for _, cookie := range rec.Result().Cookies() {
+			req.AddCookie(cookie)
+		}
+		rec = httptest.NewRecorder()
+		srv.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := signIn("eve@example.com"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected an email outside the allowlist to be refused, got %d %s", rec.Code, rec.Body.String())
+	}
+	rec := signIn("Ada@Example.com")
+	if rec.Code != http.StatusFound || rec.Header().Get("Location") != "/docs" {
+		t.Fatalf("expected ada to be signed in, got %d %s", rec.Code, rec.Body.String())
+	}
+	req := httptest.NewRequest(http.MethodGet, "/admin/session", nil)
+	for _, cookie := range rec.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+	rec = httptest.NewRecorder()
+	srv.Handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"subject":"ada@example.com"`) {
+		t.Fatalf("expected ada's session, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	srv.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/oidc/callback?code=the-code&state=forged", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected a callback without the state cookie to be refused, got %d %s", rec.Code, rec.Body.String())
+	}
+}
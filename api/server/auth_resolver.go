@@ -1,17 +1,15 @@
-package main
+package server
 
 import (
 	"context"
 	"database/sql"
 	"fmt"
-	"io"
-	"net/http"
 	"strings"
 
 	"github.com/atombasedev/atombase/auth"
-	"github.com/atombasedev/atombase/config"
 	"github.com/atombasedev/atombase/platform"
 	"github.com/atombasedev/atombase/primarystore"
+	"github.com/atombasedev/atombase/tools"
 )
 
 type authResolver struct {
@@ -23,6 +21,13 @@ func (r authResolver) DB() *sql.DB {
 	return r.store.DB()
 }
 
+func (r authResolver) RecordAudit(ctx context.Context, action, target string, detail any) error {
+	if r.platform == nil {
+		return fmt.Errorf("platform api not initialized")
+	}
+	return r.platform.RecordAudit(ctx, action, target, detail)
+}
+
 func (r authResolver) CreateOrganization(ctx context.Context, req auth.CreateOrganizationParams) (*auth.Organization, error) {
 	if r.platform == nil {
 		return nil, fmt.Errorf("platform api not initialized")
@@ -139,28 +144,9 @@ func (r authResolver) DeleteOrganization(ctx context.Context, organizationID str
 	if err != nil {
 		return err
 	}
-	if err := deleteTursoDatabase(ctx, databaseID); err != nil {
+	if err := tools.Tenants().DeleteDatabase(ctx, databaseID); err != nil {
 		return err
 	}
 	_, err = r.store.DB().ExecContext(ctx, `DELETE FROM atombase_databases WHERE id = ?`, databaseID)
 	return err
 }
-
-func deleteTursoDatabase(ctx context.Context, name string) error {
-	url := fmt.Sprintf("https://api.turso.tech/v1/organizations/%s/databases/%s", config.Cfg.TursoOrganization, name)
-	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, url, nil)
-	if err != nil {
-		return err
-	}
-	req.Header.Set("Authorization", "Bearer "+config.Cfg.TursoAPIKey)
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode >= 300 {
-		data, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("turso api returned %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
-	}
-	return nil
-}
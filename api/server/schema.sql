@@ -0,0 +1,493 @@
+-- Definitions: schema blueprints with type determining database ownership and access
+CREATE TABLE IF NOT EXISTS atombase_definitions (
+    id INTEGER PRIMARY KEY,
+    name TEXT UNIQUE NOT NULL,
+    definition_type TEXT NOT NULL CHECK(definition_type IN ('global', 'organization', 'user')),
+    roles_json TEXT,
+    current_version INTEGER DEFAULT 1,
+    created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Databases (pure storage, linked to a definition)
+CREATE TABLE IF NOT EXISTS atombase_databases (
+    id TEXT PRIMARY KEY NOT NULL,
+    definition_id INTEGER NOT NULL REFERENCES atombase_definitions(id),
+    definition_version INTEGER DEFAULT 1,
+    auth_token_encrypted BLOB,
+    created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_databases_definition ON atombase_databases(definition_id);
+
+-- Users
+CREATE TABLE IF NOT EXISTS atombase_users (
+    id TEXT PRIMARY KEY NOT NULL,
+    database_id TEXT UNIQUE REFERENCES atombase_databases(id),
+    email TEXT UNIQUE COLLATE NOCASE,
+    email_verified_at TEXT,
+    phone TEXT,
+    phone_verified_at TEXT,
+    password_hash TEXT,
+    last_sign_in_at TEXT,
+    created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_phone
+ON atombase_users(phone)
+WHERE phone IS NOT NULL;
+
+-- Organizations (identity layer on top of databases)
+CREATE TABLE IF NOT EXISTS atombase_organizations (
+    id TEXT PRIMARY KEY NOT NULL,
+    database_id TEXT NOT NULL UNIQUE REFERENCES atombase_databases(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    owner_id TEXT NOT NULL REFERENCES atombase_users(id),
+    max_members INTEGER,
+    metadata TEXT NOT NULL DEFAULT '{}',
+    created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_organizations_owner ON atombase_organizations(owner_id);
+
+-- Sessions
+CREATE TABLE IF NOT EXISTS atombase_sessions (
+    id TEXT PRIMARY KEY NOT NULL,
+    secret_hash BLOB NOT NULL,
+    user_id TEXT NOT NULL REFERENCES atombase_users(id) ON DELETE CASCADE,
+    mfa_verified INTEGER NOT NULL DEFAULT 0,
+    last_verified_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TEXT NOT NULL,
+    created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_sessions_user ON atombase_sessions(user_id);
+CREATE INDEX IF NOT EXISTS idx_sessions_expires ON atombase_sessions(expires_at);
+
+-- TOTP second factors of users. The secret is encrypted with
+-- TOKEN_ENCRYPTION_KEY like database tokens; confirmed_at stays NULL until the
+-- user proves their app has it. last_counter is the last accepted time step,
+-- so a code works once.
+CREATE TABLE IF NOT EXISTS atombase_user_totp (
+    user_id TEXT PRIMARY KEY NOT NULL REFERENCES atombase_users(id) ON DELETE CASCADE,
+    secret_encrypted BLOB NOT NULL,
+    last_counter INTEGER NOT NULL DEFAULT 0,
+    confirmed_at TEXT,
+    created_at TEXT NOT NULL
+);
+
+-- One-use backup codes, stored as SHA-256 hashes.
+CREATE TABLE IF NOT EXISTS atombase_user_backup_codes (
+    user_id TEXT NOT NULL REFERENCES atombase_users(id) ON DELETE CASCADE,
+    code_hash BLOB NOT NULL,
+    PRIMARY KEY (user_id, code_hash)
+);
+
+-- Sign-ins that passed the magic link and wait for the second factor.
+CREATE TABLE IF NOT EXISTS atombase_mfa_challenges (
+    token_hash BLOB PRIMARY KEY NOT NULL,
+    user_id TEXT NOT NULL REFERENCES atombase_users(id) ON DELETE CASCADE,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    expires_at INTEGER NOT NULL
+);
+
+-- Magic links
+CREATE TABLE IF NOT EXISTS email_magic_links (
+    id TEXT NOT NULL PRIMARY KEY,
+    email TEXT NOT NULL UNIQUE COLLATE NOCASE,
+    token_hash BLOB NOT NULL,
+    created_at INTEGER NOT NULL,
+    expires_at INTEGER NOT NULL,
+    CHECK (expires_at > created_at),
+    CHECK (length(token_hash) = 32)
+);
+CREATE INDEX IF NOT EXISTS email_magic_links_token_hash_expires_idx ON email_magic_links(token_hash, expires_at);
+CREATE INDEX IF NOT EXISTS email_magic_links_expires_at_idx ON email_magic_links(expires_at);
+
+-- Emailed six-digit sign-in codes. A code allows a few guesses before it is
+-- discarded.
+CREATE TABLE IF NOT EXISTS email_otps (
+    id TEXT NOT NULL PRIMARY KEY,
+    email TEXT NOT NULL UNIQUE COLLATE NOCASE,
+    code_hash BLOB NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    created_at INTEGER NOT NULL,
+    expires_at INTEGER NOT NULL,
+    CHECK (expires_at > created_at),
+    CHECK (length(code_hash) = 32)
+);
+CREATE INDEX IF NOT EXISTS email_otps_expires_at_idx ON email_otps(expires_at);
+
+-- Accounts at social sign-in providers, by the provider's stable subject.
+-- A user can have one identity per provider account.
+CREATE TABLE IF NOT EXISTS atombase_user_identities (
+    id TEXT PRIMARY KEY NOT NULL,
+    user_id TEXT NOT NULL REFERENCES atombase_users(id) ON DELETE CASCADE,
+    provider TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    email TEXT,
+    last_sign_in_at TEXT,
+    created_at TEXT NOT NULL,
+    UNIQUE(provider, subject)
+);
+CREATE INDEX IF NOT EXISTS idx_user_identities_user ON atombase_user_identities(user_id);
+
+-- Sign-ins sent to a provider and waiting for its callback. user_id is set
+-- when a signed-in user links the identity instead.
+CREATE TABLE IF NOT EXISTS atombase_oauth_states (
+    state_hash BLOB PRIMARY KEY NOT NULL,
+    provider TEXT NOT NULL,
+    nonce TEXT NOT NULL,
+    code_verifier TEXT NOT NULL,
+    user_id TEXT REFERENCES atombase_users(id) ON DELETE CASCADE,
+    expires_at INTEGER NOT NULL
+);
+
+-- Schema snapshots per version
+CREATE TABLE IF NOT EXISTS atombase_definitions_history (
+    id INTEGER PRIMARY KEY,
+    definition_id INTEGER NOT NULL REFERENCES atombase_definitions(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    schema_json TEXT NOT NULL,
+    checksum TEXT NOT NULL,
+    created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(definition_id, version)
+);
+CREATE INDEX IF NOT EXISTS idx_definitions_history_version ON atombase_definitions_history(definition_id, version);
+
+-- Access policies (one row per table/operation)
+CREATE TABLE IF NOT EXISTS atombase_access_policies (
+    definition_id INTEGER NOT NULL REFERENCES atombase_definitions(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    table_name TEXT NOT NULL,
+    operation TEXT NOT NULL CHECK(operation IN ('select', 'insert', 'update', 'delete')),
+    conditions_json TEXT,
+    PRIMARY KEY(definition_id, version, table_name, operation)
+);
+CREATE INDEX IF NOT EXISTS idx_access_policies_lookup
+ON atombase_access_policies(definition_id, version, operation);
+
+-- Management policies
+CREATE TABLE IF NOT EXISTS atombase_management_policies (
+    definition_id INTEGER NOT NULL REFERENCES atombase_definitions(id) ON DELETE CASCADE,
+    role TEXT NOT NULL,
+    action TEXT NOT NULL CHECK(action IN ('invite', 'assignRole', 'removeMember', 'updateOrg', 'deleteOrg', 'transferOwnership')),
+    target_roles_json TEXT,
+    PRIMARY KEY(definition_id, role, action)
+);
+
+-- Provision policies
+CREATE TABLE IF NOT EXISTS atombase_provision_policies (
+    definition_id INTEGER NOT NULL REFERENCES atombase_definitions(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    conditions_json TEXT,
+    PRIMARY KEY(definition_id, version)
+);
+
+-- Test queries run after each tenant migration to a version
+CREATE TABLE IF NOT EXISTS atombase_definition_tests (
+    definition_id INTEGER NOT NULL REFERENCES atombase_definitions(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    query TEXT NOT NULL,
+    expect_json TEXT,
+    PRIMARY KEY(definition_id, version, name)
+);
+
+-- Migrations between versions
+CREATE TABLE IF NOT EXISTS atombase_migrations (
+    id INTEGER PRIMARY KEY,
+    definition_id INTEGER NOT NULL REFERENCES atombase_definitions(id) ON DELETE CASCADE,
+    from_version INTEGER NOT NULL,
+    to_version INTEGER NOT NULL,
+    sql TEXT NOT NULL,
+    created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(definition_id, from_version, to_version)
+);
+CREATE INDEX IF NOT EXISTS idx_migrations_definition ON atombase_migrations(definition_id);
+
+-- Times of day a migration may run in. Databases outside every window that
+-- applies to them stay on their version until one opens.
+CREATE TABLE IF NOT EXISTS atombase_migration_windows (
+    migration_id INTEGER PRIMARY KEY REFERENCES atombase_migrations(id) ON DELETE CASCADE,
+    windows_json TEXT NOT NULL
+);
+
+-- Failed lazy migrations
+CREATE TABLE IF NOT EXISTS atombase_migration_failures (
+    database_id TEXT PRIMARY KEY REFERENCES atombase_databases(id) ON DELETE CASCADE,
+    from_version INTEGER NOT NULL,
+    to_version INTEGER NOT NULL,
+    error TEXT,
+    atomic INTEGER NOT NULL DEFAULT 1, -- 0 when the migration could not run in a transaction
+    created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Schema drift found when adopting an existing database
+CREATE TABLE IF NOT EXISTS atombase_database_drift (
+    database_id TEXT PRIMARY KEY REFERENCES atombase_databases(id) ON DELETE CASCADE,
+    definition_version INTEGER NOT NULL,
+    changes_json TEXT NOT NULL,
+    detected_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Users of a user definition whose rows live in a shared database, scoped by
+-- the definition's tenant column instead of a dedicated database
+CREATE TABLE IF NOT EXISTS atombase_row_tenants (
+    user_id TEXT PRIMARY KEY REFERENCES atombase_users(id) ON DELETE CASCADE,
+    database_id TEXT NOT NULL REFERENCES atombase_databases(id) ON DELETE CASCADE,
+    created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_row_tenants_database ON atombase_row_tenants(database_id);
+
+-- Users being moved between a shared and a dedicated database. Their writes
+-- are paused while a row exists.
+CREATE TABLE IF NOT EXISTS atombase_tenant_moves (
+    user_id TEXT PRIMARY KEY REFERENCES atombase_users(id) ON DELETE CASCADE,
+    from_database_id TEXT NOT NULL,
+    to_database_id TEXT NOT NULL,
+    started_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Residency rules: the regions a definition's or a database's data may be
+-- placed in. Both apply when a database has one and its definition has one.
+CREATE TABLE IF NOT EXISTS atombase_definition_residency (
+    definition_id INTEGER PRIMARY KEY REFERENCES atombase_definitions(id) ON DELETE CASCADE,
+    regions_json TEXT NOT NULL,
+    updated_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS atombase_database_residency (
+    database_id TEXT PRIMARY KEY REFERENCES atombase_databases(id) ON DELETE CASCADE,
+    regions_json TEXT NOT NULL,
+    updated_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Where a definition was installed from, pinned to the sha256 of the
+-- document last installed, so updates can be pulled from it
+CREATE TABLE IF NOT EXISTS atombase_definition_sources (
+    definition_id INTEGER PRIMARY KEY REFERENCES atombase_definitions(id) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    sha256 TEXT NOT NULL,
+    updated_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Turso group and region each database was placed in
+CREATE TABLE IF NOT EXISTS atombase_database_placements (
+    database_id TEXT PRIMARY KEY REFERENCES atombase_databases(id) ON DELETE CASCADE,
+    turso_group TEXT NOT NULL,
+    region TEXT NOT NULL,
+    created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Timezone and labels migration windows are matched against
+CREATE TABLE IF NOT EXISTS atombase_database_schedules (
+    database_id TEXT PRIMARY KEY REFERENCES atombase_databases(id) ON DELETE CASCADE,
+    timezone TEXT NOT NULL DEFAULT '',
+    labels_json TEXT NOT NULL DEFAULT '[]',
+    updated_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Keys that verify JWTs tenant apps issue for their users. A token names its
+-- key in the kid header and can only reach the key's database.
+CREATE TABLE IF NOT EXISTS atombase_jwt_keys (
+    id TEXT PRIMARY KEY NOT NULL,
+    database_id TEXT NOT NULL REFERENCES atombase_databases(id) ON DELETE CASCADE,
+    algorithm TEXT NOT NULL CHECK(algorithm IN ('HS256', 'RS256')),
+    key_encrypted BLOB NOT NULL,
+    created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_jwt_keys_database ON atombase_jwt_keys(database_id);
+
+-- Service keys limited to a database, tables and verbs. Only the SHA-256 of
+-- the secret is stored; the full token is shown once, when the key is created.
+CREATE TABLE IF NOT EXISTS atombase_api_keys (
+    id TEXT PRIMARY KEY NOT NULL,
+    name TEXT NOT NULL,
+    secret_hash BLOB NOT NULL,
+    database_id TEXT REFERENCES atombase_databases(id) ON DELETE CASCADE,
+    tables_json TEXT NOT NULL DEFAULT '[]',
+    verbs_json TEXT NOT NULL,
+    created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Platform organizations: isolated customers sharing one deployment, not the
+-- end-user organizations of atombase_organizations. An org owns definitions,
+-- the databases of those definitions, and API keys, and has its own quotas
+-- (0 means unlimited). Rows without an org are only reachable by the service
+-- key and keys without an org.
+CREATE TABLE IF NOT EXISTS atombase_platform_orgs (
+    id TEXT PRIMARY KEY NOT NULL,
+    name TEXT UNIQUE NOT NULL,
+    max_definitions INTEGER NOT NULL DEFAULT 0,
+    max_databases INTEGER NOT NULL DEFAULT 0,
+    created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS atombase_definition_orgs (
+    definition_id INTEGER PRIMARY KEY REFERENCES atombase_definitions(id) ON DELETE CASCADE,
+    org_id TEXT NOT NULL REFERENCES atombase_platform_orgs(id)
+);
+CREATE INDEX IF NOT EXISTS idx_definition_orgs_org ON atombase_definition_orgs(org_id);
+
+-- The org of an org key and the role it acts with there. member_email is set
+-- on the keys of org members, which follow their role and go with them.
+CREATE TABLE IF NOT EXISTS atombase_api_key_orgs (
+    key_id TEXT PRIMARY KEY REFERENCES atombase_api_keys(id) ON DELETE CASCADE,
+    org_id TEXT NOT NULL REFERENCES atombase_platform_orgs(id) ON DELETE CASCADE,
+    role TEXT NOT NULL DEFAULT 'owner' CHECK(role IN ('owner', 'admin', 'developer', 'viewer')),
+    member_email TEXT
+);
+CREATE INDEX IF NOT EXISTS idx_api_key_orgs_member ON atombase_api_key_orgs(org_id, member_email);
+
+-- People in a platform organization, added by accepting an invitation. Only
+-- the SHA-256 of an invitation token is stored.
+CREATE TABLE IF NOT EXISTS atombase_platform_org_members (
+    org_id TEXT NOT NULL REFERENCES atombase_platform_orgs(id) ON DELETE CASCADE,
+    email TEXT NOT NULL,
+    role TEXT NOT NULL CHECK(role IN ('owner', 'admin', 'developer', 'viewer')),
+    created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (org_id, email)
+);
+
+CREATE TABLE IF NOT EXISTS atombase_platform_org_invitations (
+    id TEXT PRIMARY KEY NOT NULL,
+    org_id TEXT NOT NULL REFERENCES atombase_platform_orgs(id) ON DELETE CASCADE,
+    email TEXT NOT NULL,
+    role TEXT NOT NULL CHECK(role IN ('owner', 'admin', 'developer', 'viewer')),
+    token_hash BLOB NOT NULL UNIQUE,
+    invited_by TEXT NOT NULL,
+    expires_at TEXT NOT NULL,
+    created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_platform_org_invitations_org ON atombase_platform_org_invitations(org_id);
+
+-- Machine identities that sign requests with an Ed25519 key instead of
+-- sending a secret. Only the public key is stored. The scope columns mean
+-- what they do for API keys.
+CREATE TABLE IF NOT EXISTS atombase_service_accounts (
+    id TEXT PRIMARY KEY NOT NULL,
+    name TEXT NOT NULL,
+    public_key BLOB NOT NULL UNIQUE,
+    org_id TEXT REFERENCES atombase_platform_orgs(id) ON DELETE CASCADE,
+    role TEXT CHECK(role IN ('owner', 'admin', 'developer', 'viewer')),
+    database_id TEXT REFERENCES atombase_databases(id) ON DELETE CASCADE,
+    tables_json TEXT NOT NULL DEFAULT '[]',
+    verbs_json TEXT NOT NULL,
+    created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Webhooks called when rows of a database change through the Data API. An
+-- empty table_name matches every table. The signing secret is encrypted like
+-- database tokens.
+CREATE TABLE IF NOT EXISTS atombase_webhooks (
+    id TEXT PRIMARY KEY NOT NULL,
+    database_id TEXT NOT NULL REFERENCES atombase_databases(id) ON DELETE CASCADE,
+    table_name TEXT NOT NULL DEFAULT '',
+    events_json TEXT NOT NULL,
+    url TEXT NOT NULL,
+    secret_encrypted BLOB NOT NULL,
+    created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_webhooks_database ON atombase_webhooks(database_id);
+
+-- Webhook deliveries, queued by data writes and sent by the dispatcher.
+-- locked_until keeps a delivery from being sent twice while one server works on it.
+CREATE TABLE IF NOT EXISTS atombase_webhook_deliveries (
+    id INTEGER PRIMARY KEY,
+    webhook_id TEXT NOT NULL REFERENCES atombase_webhooks(id) ON DELETE CASCADE,
+    event TEXT NOT NULL,
+    table_name TEXT NOT NULL,
+    payload TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK(status IN ('pending', 'delivered', 'failed')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TEXT NOT NULL,
+    locked_until TEXT,
+    response_status INTEGER,
+    error TEXT,
+    created_at TEXT NOT NULL,
+    delivered_at TEXT
+);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON atombase_webhook_deliveries(status, next_attempt_at);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook ON atombase_webhook_deliveries(webhook_id, id);
+
+-- Named selects saved per database through the Data API. query_json is the
+-- select; params_json holds the defaults of its {"$param": name} values.
+CREATE TABLE IF NOT EXISTS atombase_saved_queries (
+    database_id TEXT NOT NULL REFERENCES atombase_databases(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    table_name TEXT NOT NULL,
+    query_json TEXT NOT NULL,
+    params_json TEXT NOT NULL DEFAULT '{}',
+    created_at TEXT NOT NULL,
+    updated_at TEXT NOT NULL,
+    PRIMARY KEY (database_id, name)
+);
+
+-- Saved queries run on a cron. Each run exports the query's rows like an
+-- export job and notifies the webhook and email. locked_until keeps a report
+-- from being run by two servers at once.
+CREATE TABLE IF NOT EXISTS atombase_reports (
+    id TEXT PRIMARY KEY NOT NULL,
+    database_id TEXT NOT NULL REFERENCES atombase_databases(id) ON DELETE CASCADE,
+    query_name TEXT NOT NULL,
+    cron TEXT NOT NULL,
+    timezone TEXT NOT NULL DEFAULT 'UTC',
+    format TEXT NOT NULL,
+    webhook TEXT NOT NULL DEFAULT '',
+    email TEXT NOT NULL DEFAULT '',
+    next_run_at TEXT NOT NULL,
+    locked_until TEXT,
+    last_run_at TEXT,
+    last_status TEXT,
+    last_error TEXT,
+    last_rows INTEGER,
+    last_url TEXT,
+    created_at TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_reports_database ON atombase_reports(database_id);
+CREATE INDEX IF NOT EXISTS idx_reports_due ON atombase_reports(next_run_at);
+
+-- Metadata of objects uploaded through the storage API. Bytes live on disk
+-- or in the storage bucket under <database_id>[/<tenant>]/<bucket>/<key>;
+-- tenant is the row tenant of a shared database and empty otherwise.
+CREATE TABLE IF NOT EXISTS atombase_storage_objects (
+    database_id TEXT NOT NULL REFERENCES atombase_databases(id) ON DELETE CASCADE,
+    tenant TEXT NOT NULL DEFAULT '',
+    bucket TEXT NOT NULL,
+    object_key TEXT NOT NULL,
+    size INTEGER NOT NULL,
+    content_type TEXT NOT NULL,
+    etag TEXT NOT NULL,
+    created_at TEXT NOT NULL,
+    updated_at TEXT NOT NULL,
+    PRIMARY KEY (database_id, tenant, bucket, object_key)
+);
+
+-- Backups of tenant databases, taken on the schedule of their definition's
+-- settings.backup. Files live on disk or in the backup bucket under
+-- <database_id>/<id>.db. Backups outlive their database, so one deleted by
+-- mistake can be recreated and restored.
+CREATE TABLE IF NOT EXISTS atombase_backups (
+    id TEXT PRIMARY KEY NOT NULL,
+    database_id TEXT NOT NULL,
+    definition_version INTEGER NOT NULL,
+    location TEXT NOT NULL,
+    size INTEGER NOT NULL DEFAULT 0,
+    status TEXT NOT NULL,
+    error TEXT,
+    created_at TEXT NOT NULL,
+    finished_at TEXT,
+    changelog_seq INTEGER -- Last change log entry in the backup, for point-in-time restores
+);
+CREATE INDEX IF NOT EXISTS idx_backups_database ON atombase_backups(database_id, created_at);
+
+-- Platform audit log
+CREATE TABLE IF NOT EXISTS atombase_audit_log (
+    id INTEGER PRIMARY KEY,
+    action TEXT NOT NULL,
+    target TEXT NOT NULL,
+    detail_json TEXT NOT NULL,
+    created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_audit_log_created ON atombase_audit_log(created_at);
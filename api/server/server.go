@@ -0,0 +1,112 @@
+// Package server assembles the Data, Platform, Auth and Storage APIs and the middleware
+// chain into the HTTP handler served by atombase.
+package server
+
+import (
+	"database/sql"
+	_ "embed"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/atombasedev/atombase/auth"
+	"github.com/atombasedev/atombase/config"
+	"github.com/atombasedev/atombase/data"
+	"github.com/atombasedev/atombase/platform"
+	"github.com/atombasedev/atombase/primarystore"
+	"github.com/atombasedev/atombase/storage"
+	"github.com/atombasedev/atombase/tools"
+)
+
+// SchemaSQL creates the primary database tables.
+//
+//go:embed schema.sql
+var SchemaSQL string
+
+// Server is an assembled atombase HTTP handler over a primary database.
+type Server struct {
+	Handler  http.Handler
+	store    *primarystore.Store
+	platform *platform.API
+
+	smokeMu   sync.Mutex
+	lastSmoke atomic.Pointer[SmokeReport]
+	stop      chan struct{} // Closed by Close to stop background work
+}
+
+// New builds the server over an initialized primary database. The caller keeps
+// ownership of primaryDB and closes it after the server.
+func New(primaryDB *sql.DB) (*Server, error) {
+	primaryStore, err := primarystore.New(primaryDB)
+	if err != nil {
+		return nil, err
+	}
+
+	dataAPI, err := data.NewAPI(primaryStore)
+	if err != nil {
+		_ = primaryStore.Close()
+		return nil, err
+	}
+
+	platformAPI, err := platform.NewAPI(primaryStore)
+	if err != nil {
+		_ = primaryStore.Close()
+		return nil, err
+	}
+
+	storageAPI, err := storage.NewAPI(primaryStore)
+	if err != nil {
+		_ = primaryStore.Close()
+		return nil, err
+	}
+
+	authAPI := auth.NewAPI(authResolver{store: primaryStore, platform: platformAPI})
+	srv := &Server{store: primaryStore, platform: platformAPI, stop: make(chan struct{})}
+
+	app := http.NewServeMux()
+
+	// Health check
+	app.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"status":"healthy"}`))
+	})
+
+	// Register routes from each module
+	dataAPI.RegisterRoutes(app)
+	platformAPI.RegisterRoutes(app)
+	authAPI.RegisterRoutes(app)
+	storageAPI.RegisterRoutes(app)
+	registerAdminRoutes(app)
+	app.HandleFunc("POST /platform/smoke", srv.handleRunSmokeTest)
+	app.HandleFunc("GET /platform/smoke", srv.handleGetSmokeTest)
+
+	// Apply middleware chain: panic recovery -> logging -> timeout -> cors -> auth -> rate limit -> concurrency limit -> handler
+	srv.Handler = tools.PanicRecoveryMiddleware(
+		tools.LoggingMiddleware(
+			tools.TimeoutMiddleware(
+				tools.CORSMiddleware(
+					tools.SignedAuthMiddleware(primaryStore.LookupAPIKey, primaryStore.LookupServiceAccount)(
+						tools.RateLimitMiddleware(
+							tools.ConcurrencyLimitMiddleware(app)))))))
+
+	if config.Cfg.SmokeInterval > 0 {
+		go srv.scheduleSmokeTests(time.Duration(config.Cfg.SmokeInterval)*time.Minute, srv.stop)
+	}
+	go platformAPI.RunWebhookDispatcher(srv.stop)
+	go platformAPI.RunBackupScheduler(srv.stop)
+	go dataAPI.RunReportScheduler(srv.stop)
+	go dataAPI.RunRollupScheduler(srv.stop)
+	go tools.RunTenantPool(srv.stop)
+
+	return srv, nil
+}
+
+// Close stops scheduled smoke tests, the webhook dispatcher, the backup,
+// report and rollup schedulers and tenant pool health checks, and releases the
+// server's resources. It does not close the primary database.
+func (s *Server) Close() error {
+	close(s.stop)
+	return s.store.Close()
+}
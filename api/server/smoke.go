@@ -0,0 +1,245 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/atombasedev/atombase/config"
+	"github.com/atombasedev/atombase/data"
+	"github.com/atombasedev/atombase/platform"
+	"github.com/atombasedev/atombase/tools"
+)
+
+// SmokeReport is the outcome of an end-to-end smoke test.
+type SmokeReport struct {
+	Name       string      `json:"name"` // Definition and database created for the run
+	Trigger    string      `json:"trigger"`
+	Passed     bool        `json:"passed"`
+	StartedAt  time.Time   `json:"startedAt"`
+	DurationMs int64       `json:"durationMs"`
+	Steps      []SmokeStep `json:"steps"`
+}
+
+// SmokeStep is one stage of a smoke test.
+type SmokeStep struct {
+	Name       string `json:"name"`
+	Passed     bool   `json:"passed"`
+	DurationMs int64  `json:"durationMs"`
+	Error      string `json:"error,omitempty"`
+}
+
+const smokeTable = "smoke_items"
+
+// smokeSchema is the schema of the smoke test definition, with extra TEXT
+// columns for later versions.
+func smokeSchema(extra ...string) platform.Schema {
+	columns := map[string]platform.Col{
+		"id":    {Name: "id", Type: "INTEGER"},
+		"label": {Name: "label", Type: "TEXT"},
+	}
+	for _, name := range extra {
+		columns[name] = platform.Col{Name: name, Type: "TEXT"}
+	}
+	return platform.Schema{Tables: []platform.Table{{Name: smokeTable, Pk: []string{"id"}, Columns: columns}}}
+}
+
+// RunSmokeTest exercises the whole stack the way a client would: it creates a
+// definition and a database, reads and writes through the Data API, pushes a
+// new definition version and lets the database migrate to it, then removes
+// everything it created. Requests go through the full middleware chain, so a
+// passing run shows that auth, Turso provisioning and tenant access work.
+func (s *Server) RunSmokeTest(ctx context.Context, trigger string) (*SmokeReport, error) {
+	if !s.smokeMu.TryLock() {
+		return nil, tools.ErrSmokeTestRunning
+	}
+	defer s.smokeMu.Unlock()
+
+	suffix := make([]byte, 3)
+	_, _ = rand.Read(suffix)
+	name := fmt.Sprintf("smoke-%d-%s", time.Now().Unix(), hex.EncodeToString(suffix))
+	report := &SmokeReport{Name: name, Trigger: trigger, Passed: true, StartedAt: time.Now().UTC()}
+	run := func(step string, fn func() error) bool {
+		start := time.Now()
+		err := fn()
+		result := SmokeStep{Name: step, Passed: err == nil, DurationMs: time.Since(start).Milliseconds()}
+		if err != nil {
+			result.Error = err.Error()
+			report.Passed = false
+		}
+		report.Steps = append(report.Steps, result)
+		return err == nil
+	}
+
+	target := http.Header{"Database": {"global:" + name}}
+	var createdDefinition, createdDatabase bool
+	_ = run("create definition", func() error {
+		err := s.smokeRequest(ctx, http.MethodPost, "/platform/definitions", nil,
+			platform.CreateDefinitionRequest{Name: name, Type: "global", Schema: smokeSchema()}, nil)
+		createdDefinition = err == nil
+		return err
+	}) && run("create database", func() error {
+		err := s.smokeRequest(ctx, http.MethodPost, "/platform/databases", nil,
+			platform.CreateDatabaseRequest{ID: name, Definition: name}, nil)
+		createdDatabase = err == nil
+		return err
+	}) && run("insert", func() error {
+		return s.smokeQuery(ctx, target, "insert", data.InsertRequest{Data: data.RowData{{"id": 1, "label": "one"}, {"id": 2, "label": "two"}}}, nil)
+	}) && run("update", func() error {
+		return s.smokeQuery(ctx, target, "update", data.UpdateRequest{
+			Data:  map[string]any{"label": "uno"},
+			Where: []map[string]any{{"id": map[string]any{"eq": 1}}},
+		}, nil)
+	}) && run("delete", func() error {
+		return s.smokeQuery(ctx, target, "delete", data.DeleteRequest{Where: []map[string]any{{"id": map[string]any{"eq": 2}}}}, nil)
+	}) && run("select", func() error {
+		var rows []map[string]any
+		if err := s.smokeQuery(ctx, target, "select", data.SelectQuery{}, &rows); err != nil {
+			return err
+		}
+		if len(rows) != 1 || rows[0]["label"] != "uno" {
+			return fmt.Errorf("unexpected rows %v", rows)
+		}
+		return nil
+	}) && run("migrate", func() error {
+		return s.smokeRequest(ctx, http.MethodPost, "/platform/definitions/"+name+"/push", nil,
+			platform.PushDefinitionRequest{Schema: smokeSchema("note")}, nil)
+	}) && run("sync", func() error {
+		// A push migrates the first database of a definition itself and the
+		// rest on their next Data API request; either way the new column must
+		// be readable and the database recorded at the new version.
+		var rows []map[string]any
+		if err := s.smokeQuery(ctx, target, "select", data.SelectQuery{Select: []any{"id", "note"}}, &rows); err != nil {
+			return err
+		}
+		var db platform.DatabaseRecord
+		if err := s.smokeRequest(ctx, http.MethodGet, "/platform/databases/"+name, nil, nil, &db); err != nil {
+			return err
+		}
+		if db.DefinitionVersion != 2 {
+			return fmt.Errorf("database is at version %d, expected 2", db.DefinitionVersion)
+		}
+		return nil
+	})
+
+	// Cleanup runs whatever happened above, so a failed or timed out run
+	// leaves nothing behind.
+	cleanupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Minute)
+	defer cancel()
+	run("cleanup", func() error {
+		if createdDatabase {
+			if err := s.smokeRequest(cleanupCtx, http.MethodDelete, "/platform/databases/"+name, nil, nil, nil); err != nil {
+				return err
+			}
+		}
+		if createdDefinition {
+			return s.platform.DeleteDefinition(cleanupCtx, name)
+		}
+		return nil
+	})
+
+	report.DurationMs = time.Since(report.StartedAt).Milliseconds()
+	s.lastSmoke.Store(report)
+	if !report.Passed {
+		log.Printf("smoke test %s failed: %s", name, smokeFailure(report))
+	}
+	return report, nil
+}
+
+func smokeFailure(report *SmokeReport) string {
+	for _, step := range report.Steps {
+		if !step.Passed {
+			return step.Name + ": " + step.Error
+		}
+	}
+	return ""
+}
+
+func (s *Server) smokeQuery(ctx context.Context, header http.Header, operation string, body, out any) error {
+	header = header.Clone()
+	header.Set("Prefer", "operation="+operation)
+	return s.smokeRequest(ctx, http.MethodPost, "/data/query/"+smokeTable, header, body, out)
+}
+
+// smokeRequest sends a service-key request through the server's own handler.
+func (s *Server) smokeRequest(ctx context.Context, method, path string, header http.Header, body, out any) error {
+	var raw []byte
+	if body != nil {
+		var err error
+		if raw, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	req := httptest.NewRequestWithContext(ctx, method, path, bytes.NewReader(raw))
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer service."+config.Cfg.APIKey)
+	rec := httptest.NewRecorder()
+	s.Handler.ServeHTTP(rec, req)
+	if rec.Code >= 300 {
+		var apiErr tools.APIError
+		if json.Unmarshal(rec.Body.Bytes(), &apiErr) == nil && apiErr.Message != "" {
+			if apiErr.Hint != "" {
+				return fmt.Errorf("%s %s: %d %s: %s (%s)", method, path, rec.Code, apiErr.Code, apiErr.Message, apiErr.Hint)
+			}
+			return fmt.Errorf("%s %s: %d %s: %s", method, path, rec.Code, apiErr.Code, apiErr.Message)
+		}
+		return fmt.Errorf("%s %s: %d %s", method, path, rec.Code, bytes.TrimSpace(rec.Body.Bytes()))
+	}
+	if out != nil {
+		return json.Unmarshal(rec.Body.Bytes(), out)
+	}
+	return nil
+}
+
+// handleRunSmokeTest runs a smoke test and returns its report: 200 when it
+// passed and 503 when it failed, so deploy scripts can gate on the status.
+func (s *Server) handleRunSmokeTest(w http.ResponseWriter, r *http.Request) {
+	report, err := s.RunSmokeTest(r.Context(), "manual")
+	if err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	status := http.StatusOK
+	if !report.Passed {
+		status = http.StatusServiceUnavailable
+	}
+	tools.RespondJSON(w, status, report)
+}
+
+// handleGetSmokeTest returns the report of the latest run, or 204 before the first.
+func (s *Server) handleGetSmokeTest(w http.ResponseWriter, r *http.Request) {
+	report := s.lastSmoke.Load()
+	if report == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	tools.RespondJSON(w, http.StatusOK, report)
+}
+
+// scheduleSmokeTests runs a smoke test every interval until stop is closed.
+func (s *Server) scheduleSmokeTests(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), interval)
+			if _, err := s.RunSmokeTest(ctx, "scheduled"); err != nil {
+				log.Printf("scheduled smoke test skipped: %v", err)
+			}
+			cancel()
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/atombasedev/atombase/config"
+	"github.com/atombasedev/atombase/tools"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func setupSmokeServer(t *testing.T, tenantDir string) (*Server, *sql.DB) {
+	t.Helper()
+	prevCfg, prevCache := config.Cfg, tools.GetCache()
+	config.Cfg.APIKey = "smoke-key"
+	config.Cfg.LocalTenantDir = tenantDir
+	config.Cfg.ActivityLogEnabled = false
+	tools.InitCache(tools.NewMemoryCache())
+
+	db, err := sql.Open("sqlite3", "file:"+filepath.Join(t.TempDir(), "primary.db")+"?_foreign_keys=on")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(SchemaSQL); err != nil {
+		t.Fatal(err)
+	}
+	srv, err := New(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = srv.Close()
+		_ = db.Close()
+		config.Cfg = prevCfg
+		tools.InitCache(prevCache)
+	})
+	return srv, db
+}
+
+func TestSmokeTest_PassesAndCleansUp(t *testing.T) {
+	tenantDir := t.TempDir()
+	srv, db := setupSmokeServer(t, tenantDir)
+
+	req := httptest.NewRequest(http.MethodPost, "/platform/smoke", nil)
+	req.Header.Set("Authorization", "Bearer service.smoke-key")
+	rec := httptest.NewRecorder()
+	srv.Handler.ServeHTTP(rec, req)
+	var report SmokeReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusOK || !report.Passed || len(report.Steps) != 9 {
+		t.Fatalf("unexpected smoke result %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var leftovers int
+	if err := db.QueryRow(`SELECT (SELECT COUNT(*) FROM atombase_definitions) + (SELECT COUNT(*) FROM atombase_databases)`).Scan(&leftovers); err != nil || leftovers != 0 {
+		t.Fatalf("smoke test left %d rows behind (%v)", leftovers, err)
+	}
+	if files, _ := os.ReadDir(tenantDir); len(files) != 0 {
+		t.Fatalf("smoke test left tenant files behind: %v", files)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/platform/smoke", nil)
+	req.Header.Set("Authorization", "Bearer service.smoke-key")
+	rec = httptest.NewRecorder()
+	srv.Handler.ServeHTTP(rec, req)
+	var last SmokeReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &last); err != nil || last.Name != report.Name {
+		t.Fatalf("expected the last report, got %s (%v)", rec.Body.String(), err)
+	}
+}
+
+func TestSmokeTest_ReportsFailureAndStillCleansUp(t *testing.T) {
+	// A file where the tenant directory should be makes database creation fail.
+	blocked := filepath.Join(t.TempDir(), "tenants")
+	if err := os.WriteFile(blocked, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	srv, db := setupSmokeServer(t, blocked)
+
+	report, err := srv.RunSmokeTest(context.Background(), "manual")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Passed || len(report.Steps) != 3 || report.Steps[1].Name != "create database" || report.Steps[1].Passed || !report.Steps[2].Passed {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	var definitions int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM atombase_definitions`).Scan(&definitions); err != nil || definitions != 0 {
+		t.Fatalf("expected cleanup to remove the definition, found %d (%v)", definitions, err)
+	}
+
+	srv.smokeMu.Lock()
+	defer srv.smokeMu.Unlock()
+	if _, err := srv.RunSmokeTest(context.Background(), "manual"); err != tools.ErrSmokeTestRunning {
+		t.Fatalf("expected overlapping runs to be refused, got %v", err)
+	}
+}
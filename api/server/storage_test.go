@@ -0,0 +1,166 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/atombasedev/atombase/config"
+	"github.com/atombasedev/atombase/storage"
+)
+
+func TestStorageObjects(t *testing.T) {
+	prevCfg := config.Cfg
+	config.Cfg.StorageDir = t.TempDir()
+	config.Cfg.StorageMaxObjectSize = 64
+	config.Cfg.ApiURL = "https://api.example.com"
+	t.Cleanup(func() { config.Cfg = prevCfg })
+	srv, _ := setupSmokeServer(t, t.TempDir())
+	serve := func(method, path, database, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer service.smoke-key")
+		if database != "" {
+			req.Header.Set("Database", database)
+		}
+		req.Header.Set("Content-Type", "text/plain")
+		rec := httptest.NewRecorder()
+		srv.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	definition := `{"name": "files", "type": "global",
+		"schema": {"tables": [{"name": "notes", "pk": ["id"], "columns": {"id": {"name": "id", "type": "INTEGER"}}}]}}`
+	if rec := serve(http.MethodPost, "/platform/definitions", "", definition); rec.Code != http.StatusCreated {
+		t.Fatalf("create definition: %d %s", rec.Code, rec.Body.String())
+	}
+	for _, id := range []string{"alpha", "beta"} {
+		if rec := serve(http.MethodPost, "/platform/databases", "", `{"id": "`+id+`", "definition": "files"}`); rec.Code != http.StatusCreated {
+			t.Fatalf("create database %s: %d %s", id, rec.Code, rec.Body.String())
+		}
+	}
+
+	rec := serve(http.MethodPost, "/storage/docs?key=notes/hello.txt", "global:alpha", "hello")
+	var object storage.Object
+	if rec.Code != http.StatusCreated || json.Unmarshal(rec.Body.Bytes(), &object) != nil || object.Size != 5 || object.ContentType != "text/plain" {
+		t.Fatalf("expected the object to be stored, got %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := serve(http.MethodPost, "/storage/docs?key=notes/big.txt", "global:alpha", strings.Repeat("x", 65)); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected an oversized object to be refused, got %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := serve(http.MethodPost, "/storage/docs?key=../escape", "global:alpha", "x"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected a key leaving the bucket to be refused, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	rec = serve(http.MethodGet, "/storage/docs/notes/hello.txt", "global:alpha", "")
+	if rec.Code != http.StatusOK || rec.Body.String() != "hello" || rec.Header().Get("Content-Type") != "text/plain" {
+		t.Fatalf("expected the object back, got %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := serve(http.MethodGet, "/storage/docs/notes/hello.txt", "global:beta", ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected another database not to see the object, got %d %s", rec.Code, rec.Body.String())
+	}
+	rec = serve(http.MethodGet, "/storage/docs?prefix=notes/", "global:alpha", "")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"key":"notes/hello.txt"`) {
+		t.Fatalf("expected the listing to include the object, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	rec = serve(http.MethodPost, "/storage/docs/sign", "global:alpha", `{"key": "notes/hello.txt", "expiresIn": 60}`)
+	var signed storage.SignResponse
+	if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &signed) != nil {
+		t.Fatalf("sign: %d %s", rec.Code, rec.Body.String())
+	}
+	link, err := url.Parse(signed.URL)
+	if err != nil || !strings.HasPrefix(signed.URL, "https://api.example.com/storage/docs/notes/hello.txt?") {
+		t.Fatalf("unexpected signed url %q", signed.URL)
+	}
+	fetch := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		srv.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+	rec = fetch(link.RequestURI())
+	if body, _ := io.ReadAll(rec.Body); rec.Code != http.StatusOK || string(body) != "hello" {
+		t.Fatalf("expected the signed url to download without credentials, got %d %s", rec.Code, body)
+	}
+	forged := link.Query()
+	forged.Set("tenant", "beta")
+	if rec := fetch(link.Path + "?" + forged.Encode()); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected a signed url moved to another tenant to be refused, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	if rec := serve(http.MethodDelete, "/storage/docs/notes/hello.txt", "global:alpha", ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := fetch(link.RequestURI()); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected the deleted object to be gone, got %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestStorageBucketPolicies(t *testing.T) {
+	prevCfg := config.Cfg
+	config.Cfg.StorageDir = t.TempDir()
+	t.Cleanup(func() { config.Cfg = prevCfg })
+	srv, db := setupSmokeServer(t, t.TempDir())
+
+	// A signed-in user, with a session made the way sign-in stores it.
+	secret := sha256.Sum256([]byte("secret"))
+	if _, err := db.Exec(`INSERT INTO atombase_users (id, email) VALUES ('u1', 'u1@example.com');
+		INSERT INTO atombase_sessions (id, secret_hash, user_id, expires_at) VALUES ('s1', ?, 'u1', ?)`,
+		secret[:], time.Now().Add(time.Hour).UTC().Format(time.RFC3339)); err != nil {
+		t.Fatal(err)
+	}
+	serve := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		req.Header.Set("Database", "global:alpha")
+		rec := httptest.NewRecorder()
+		srv.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+	const service, user = "service.smoke-key", "s1.secret"
+
+	definition := `{"name": "files", "type": "global",
+		"schema": {"tables": [{"name": "notes", "pk": ["id"], "columns": {"id": {"name": "id", "type": "INTEGER"}}}]},
+		"access": {"storage:public": {"select": {"field": "auth.status", "op": "eq", "value": "authenticated"}}}}`
+	if rec := serve(http.MethodPost, "/platform/definitions", service, definition); rec.Code != http.StatusCreated {
+		t.Fatalf("create definition: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := serve(http.MethodPost, "/platform/databases", service, `{"id": "alpha", "definition": "files"}`); rec.Code != http.StatusCreated {
+		t.Fatalf("create database: %d %s", rec.Code, rec.Body.String())
+	}
+	for _, path := range []string{"/storage/public?key=a.txt", "/storage/private?key=b.txt"} {
+		if rec := serve(http.MethodPost, path, service, "x"); rec.Code != http.StatusCreated {
+			t.Fatalf("upload %s: %d %s", path, rec.Code, rec.Body.String())
+		}
+	}
+
+	if rec := serve(http.MethodGet, "/storage/public/a.txt", user, ""); rec.Code != http.StatusOK {
+		t.Fatalf("expected the policy to let the user read, got %d %s", rec.Code, rec.Body.String())
+	}
+	for _, tt := range []struct{ method, path, token, body string }{
+		{http.MethodGet, "/storage/public/a.txt", "", ""},
+		{http.MethodPost, "/storage/public?key=c.txt", user, "x"},
+		{http.MethodDelete, "/storage/public/a.txt", user, ""},
+		{http.MethodGet, "/storage/private/b.txt", user, ""},
+		{http.MethodGet, "/storage/private", user, ""},
+		{http.MethodPost, "/storage/private/sign", user, `{"key": "b.txt"}`},
+	} {
+		if rec := serve(tt.method, tt.path, tt.token, tt.body); rec.Code < 400 {
+			t.Errorf("%s %s as %q: expected a refusal, got %d %s", tt.method, tt.path, tt.token, rec.Code, rec.Body.String())
+		}
+	}
+
+	bad := `{"name": "bad", "type": "global",
+		"schema": {"tables": [{"name": "notes", "pk": ["id"], "columns": {"id": {"name": "id", "type": "INTEGER"}}}]},
+		"access": {"storage:public": {"select": {"field": "old.owner", "op": "eq", "value": "auth.id"}}}}`
+	if rec := serve(http.MethodPost, "/platform/definitions", service, bad); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected a row condition on a bucket to be refused, got %d %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,232 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/atombasedev/atombase/config"
+	"github.com/atombasedev/atombase/tools"
+)
+
+// maxKeyLength is the longest object key, S3's limit.
+const maxKeyLength = 1024
+
+// Listing limits.
+const (
+	defaultListLimit = 100
+	maxListLimit     = 1000
+)
+
+var bucketNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+// Object describes a stored object.
+type Object struct {
+	Bucket      string    `json:"bucket"`
+	Key         string    `json:"key"`
+	Size        int64     `json:"size"`
+	ContentType string    `json:"contentType"`
+	ETag        string    `json:"etag"` // Hex SHA-256 of the content
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// tenant is whose objects a request reaches: a database and, in a shared
+// database, the row tenant. Tenants never see each other's objects.
+type tenant struct {
+	DatabaseID string
+	RowTenant  string
+}
+
+// prefix is where the tenant's objects are kept in the backend.
+func (t tenant) prefix() string {
+	if t.RowTenant == "" {
+		return t.DatabaseID
+	}
+	return t.DatabaseID + "/" + t.RowTenant
+}
+
+// parseTenantPrefix reverses prefix.
+func parseTenantPrefix(prefix string) (tenant, bool) {
+	databaseID, rowTenant, _ := strings.Cut(prefix, "/")
+	return tenant{DatabaseID: databaseID, RowTenant: rowTenant}, databaseID != "" && !strings.Contains(rowTenant, "/")
+}
+
+func objectPath(t tenant, bucket, key string) string {
+	return t.prefix() + "/" + bucket + "/" + key
+}
+
+// validateBucket checks a bucket name: lowercase letters, digits, dashes and
+// underscores, starting with a letter or digit.
+func validateBucket(bucket string) error {
+	if !bucketNamePattern.MatchString(bucket) {
+		return tools.InvalidRequestErr(fmt.Sprintf("invalid bucket name %q: use up to 63 lowercase letters, digits, - and _", bucket))
+	}
+	return nil
+}
+
+// validateKey checks an object key: slash separated segments, none empty,
+// "." or "..", so a key always names a file inside its bucket.
+func validateKey(key string) error {
+	if key == "" || len(key) > maxKeyLength {
+		return tools.InvalidRequestErr(fmt.Sprintf("object key must be 1 to %d bytes", maxKeyLength))
+	}
+	if strings.ContainsAny(key, "\\\x00") {
+		return tools.InvalidRequestErr(fmt.Sprintf("invalid object key %q", key))
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return tools.InvalidRequestErr(fmt.Sprintf("invalid object key %q: empty, . and .. segments are not allowed", key))
+		}
+	}
+	return nil
+}
+
+// putObject stores body as key in bucket, replacing any object there. The
+// body is spooled to a temporary file first, to enforce the size limit and
+// hash it before the backend sees it.
+func (api *API) putObject(ctx context.Context, t tenant, bucket, key string, body io.Reader, contentType string) (*Object, error) {
+	if err := validateBucket(bucket); err != nil {
+		return nil, err
+	}
+	if err := validateKey(key); err != nil {
+		return nil, err
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	file, err := os.CreateTemp("", "atombase-object-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(file, hash), io.LimitReader(body, config.Cfg.StorageMaxObjectSize+1))
+	if err != nil {
+		var maxBytes *http.MaxBytesError
+		if errors.As(err, &maxBytes) {
+			return nil, tools.ErrObjectTooLarge
+		}
+		return nil, err
+	}
+	if size > config.Cfg.StorageMaxObjectSize {
+		return nil, tools.ErrObjectTooLarge
+	}
+	if err := api.backend.Put(ctx, objectPath(t, bucket, key), file, contentType); err != nil {
+		return nil, err
+	}
+
+	object := &Object{Bucket: bucket, Key: key, Size: size, ContentType: contentType, ETag: hex.EncodeToString(hash.Sum(nil))}
+	now := time.Now().UTC().Format(time.RFC3339)
+	var createdAt, updatedAt string
+	if err := api.db.QueryRowContext(ctx, `
+		INSERT INTO atombase_storage_objects (database_id, tenant, bucket, object_key, size, content_type, etag, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (database_id, tenant, bucket, object_key) DO UPDATE SET
+			size = excluded.size, content_type = excluded.content_type, etag = excluded.etag, updated_at = excluded.updated_at
+		RETURNING created_at, updated_at
+	`, t.DatabaseID, t.RowTenant, bucket, key, size, contentType, object.ETag, now, now).Scan(&createdAt, &updatedAt); err != nil {
+		return nil, err
+	}
+	object.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
+	object.UpdatedAt, _ = time.Parse(time.RFC3339, updatedAt)
+	return object, nil
+}
+
+// getObject returns the metadata of key in bucket.
+func (api *API) getObject(ctx context.Context, t tenant, bucket, key string) (*Object, error) {
+	if err := validateBucket(bucket); err != nil {
+		return nil, err
+	}
+	if err := validateKey(key); err != nil {
+		return nil, err
+	}
+	rows, err := api.db.QueryContext(ctx, `
+		SELECT bucket, object_key, size, content_type, etag, created_at, updated_at
+		FROM atombase_storage_objects
+		WHERE database_id = ? AND tenant = ? AND bucket = ? AND object_key = ?
+	`, t.DatabaseID, t.RowTenant, bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	objects, err := scanObjects(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(objects) == 0 {
+		return nil, tools.ErrObjectNotFound
+	}
+	return &objects[0], nil
+}
+
+// listObjects returns the objects of bucket whose keys start with prefix, in
+// key order, beginning after the key after when it is set.
+func (api *API) listObjects(ctx context.Context, t tenant, bucket, prefix, after string, limit int) ([]Object, error) {
+	if err := validateBucket(bucket); err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = defaultListLimit
+	}
+	limit = min(limit, maxListLimit)
+	rows, err := api.db.QueryContext(ctx, `
+		SELECT bucket, object_key, size, content_type, etag, created_at, updated_at
+		FROM atombase_storage_objects
+		WHERE database_id = ? AND tenant = ? AND bucket = ? AND instr(object_key, ?) = 1 AND object_key > ?
+		ORDER BY object_key
+		LIMIT ?
+	`, t.DatabaseID, t.RowTenant, bucket, prefix, after, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanObjects(rows)
+}
+
+// deleteObject removes key from bucket. The metadata goes first, so a
+// failure in the backend leaves at worst unreachable bytes.
+func (api *API) deleteObject(ctx context.Context, t tenant, bucket, key string) error {
+	if err := validateBucket(bucket); err != nil {
+		return err
+	}
+	if err := validateKey(key); err != nil {
+		return err
+	}
+	result, err := api.db.ExecContext(ctx, `
+		DELETE FROM atombase_storage_objects
+		WHERE database_id = ? AND tenant = ? AND bucket = ? AND object_key = ?
+	`, t.DatabaseID, t.RowTenant, bucket, key)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return tools.ErrObjectNotFound
+	}
+	return api.backend.Delete(ctx, objectPath(t, bucket, key))
+}
+
+func scanObjects(rows *sql.Rows) ([]Object, error) {
+	defer rows.Close()
+	objects := []Object{}
+	for rows.Next() {
+		var object Object
+		var createdAt, updatedAt string
+		if err := rows.Scan(&object.Bucket, &object.Key, &object.Size, &object.ContentType, &object.ETag, &createdAt, &updatedAt); err != nil {
+			return nil, err
+		}
+		object.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
+		object.UpdatedAt, _ = time.Parse(time.RFC3339, updatedAt)
+		objects = append(objects, object)
+	}
+	return objects, rows.Err()
+}
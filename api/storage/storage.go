@@ -0,0 +1,319 @@
+// Package storage serves files for tenant apps: buckets of objects kept on
+// local disk or in an S3-compatible bucket, with their metadata in the
+// primary database. Every database, and every row tenant of a shared
+// database, has its own objects.
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/atombasedev/atombase/config"
+	"github.com/atombasedev/atombase/definitions"
+	"github.com/atombasedev/atombase/primarystore"
+	"github.com/atombasedev/atombase/tools"
+)
+
+// API serves the /storage routes.
+type API struct {
+	db          *sql.DB
+	definitions *definitions.Service
+	backend     Backend
+}
+
+// NewAPI returns the storage API over the primary store, keeping bytes in the
+// configured backend.
+func NewAPI(primaryStore *primarystore.Store) (*API, error) {
+	if primaryStore == nil || primaryStore.DB() == nil {
+		return nil, errors.New("nil primary store")
+	}
+	return &API{
+		db:          primaryStore.DB(),
+		definitions: definitions.NewService(primaryStore),
+		backend:     newBackend(),
+	}, nil
+}
+
+func (api *API) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /storage/{bucket}", api.handleListObjects)
+	mux.HandleFunc("POST /storage/{bucket}", api.handlePutObject)
+	mux.HandleFunc("POST /storage/{bucket}/sign", api.handleSignObject)
+	mux.HandleFunc("GET /storage/{bucket}/{key...}", api.handleGetObject)
+	mux.HandleFunc("DELETE /storage/{bucket}/{key...}", api.handleDeleteObject)
+}
+
+// SignRequest is the body of POST /storage/{bucket}/sign.
+type SignRequest struct {
+	Key       string `json:"key"`
+	ExpiresIn int    `json:"expiresIn,omitempty"` // Seconds; defaults to ATOMICBASE_STORAGE_URL_TTL
+}
+
+// SignResponse is a download link for an object.
+type SignResponse struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// resolveTenant finds the tenant the caller reaches, as the Data API would
+// for the same credentials and routing headers, and checks that the caller
+// may run operation (select for reads, insert or delete for writes) on
+// bucket: the definition's storage:<bucket> access policy must admit them.
+func (api *API) resolveTenant(r *http.Request, bucket, operation string) (tenant, error) {
+	if err := validateBucket(bucket); err != nil {
+		return tenant{}, err
+	}
+	ctx := r.Context()
+	principal, err := api.definitions.ResolvePrincipal(ctx, tools.GetAuthContext(ctx))
+	if err != nil {
+		return tenant{}, err
+	}
+	route, err := tools.DatabaseRoute(r)
+	if err != nil {
+		return tenant{}, err
+	}
+	target, err := api.definitions.ResolveTarget(ctx, principal, route)
+	if err != nil {
+		return tenant{}, err
+	}
+	// A key limited to tables does not reach storage.
+	if scope := principal.KeyScope; scope != nil && !scope.Allows("", operation) {
+		return tenant{}, fmt.Errorf("%w: api key may not %s storage objects", tools.ErrAPIKeyScope, operation)
+	}
+	if target.WritesPaused && operation != "select" {
+		return tenant{}, tools.ErrWritesPaused
+	}
+	predicate, err := api.definitions.CompilePolicy(ctx, principal, target, definitions.StorageAccessTable(bucket), operation, nil)
+	if err != nil {
+		return tenant{}, err
+	}
+	if predicate.SQL != "" {
+		if err := checkMembershipPolicy(ctx, principal, target, predicate); err != nil {
+			return tenant{}, err
+		}
+	}
+	return tenant{DatabaseID: target.DatabaseID, RowTenant: target.RowTenant}, nil
+}
+
+// checkMembershipPolicy answers the membership conditions of an organization
+// bucket policy, the only ones left as SQL, from the organization's database.
+func checkMembershipPolicy(ctx context.Context, principal definitions.Principal, target definitions.DatabaseTarget, predicate definitions.CompiledPredicate) error {
+	client, release, err := tools.AcquireTenantDB(target.DatabaseID, target.AuthToken)
+	if err != nil {
+		return err
+	}
+	defer release()
+	query := "WITH __ab_membership AS (SELECT user_id, role, status FROM atombase_membership WHERE user_id = ?) SELECT " + predicate.SQL
+	var allowed bool
+	if err := client.QueryRowContext(ctx, query, append([]any{principal.UserID}, predicate.Args...)...).Scan(&allowed); err != nil {
+		return err
+	}
+	if !allowed {
+		return tools.UnauthorizedErr("request does not satisfy definition policy")
+	}
+	return nil
+}
+
+// handleListObjects handles GET /storage/{bucket}?prefix=&after=&limit=.
+func (api *API) handleListObjects(w http.ResponseWriter, r *http.Request) {
+	t, err := api.resolveTenant(r, r.PathValue("bucket"), "select")
+	if err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	query := r.URL.Query()
+	limit := 0
+	if raw := query.Get("limit"); raw != "" {
+		if limit, err = strconv.Atoi(raw); err != nil || limit < 1 {
+			tools.RespErr(w, tools.InvalidRequestErr("limit must be a positive integer"))
+			return
+		}
+	}
+	objects, err := api.listObjects(r.Context(), t, r.PathValue("bucket"), query.Get("prefix"), query.Get("after"), limit)
+	if err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	tools.RespondJSON(w, http.StatusOK, objects)
+}
+
+// handlePutObject handles POST /storage/{bucket}?key=. The body is the raw
+// content, described by its Content-Type. Without a key the object gets a
+// random one.
+func (api *API) handlePutObject(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, config.Cfg.StorageMaxObjectSize)
+	defer r.Body.Close()
+	t, err := api.resolveTenant(r, r.PathValue("bucket"), "insert")
+	if err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	key := r.URL.Query().Get("key")
+	if key == "" {
+		raw := make([]byte, 16)
+		if _, err := rand.Read(raw); err != nil {
+			tools.RespErr(w, err)
+			return
+		}
+		key = hex.EncodeToString(raw)
+	}
+	object, err := api.putObject(r.Context(), t, r.PathValue("bucket"), key, r.Body, r.Header.Get("Content-Type"))
+	if err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	tools.RespondJSON(w, http.StatusCreated, object)
+}
+
+// handleGetObject handles GET /storage/{bucket}/{key}. A signed URL stands
+// in for credentials.
+func (api *API) handleGetObject(w http.ResponseWriter, r *http.Request) {
+	bucket, key := r.PathValue("bucket"), r.PathValue("key")
+	var t tenant
+	var err error
+	if r.URL.Query().Has("signature") {
+		t, err = verifySignedURL(r.URL.Query(), bucket, key, time.Now())
+	} else {
+		t, err = api.resolveTenant(r, bucket, "select")
+	}
+	if err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	object, err := api.getObject(r.Context(), t, bucket, key)
+	if err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+
+	etag := `"` + object.ETag + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "private")
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	body, err := api.backend.Open(r.Context(), objectPath(t, bucket, key))
+	if err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	defer body.Close()
+	// Uploaded files are untrusted; keep browsers from running them as pages
+	// of the API's origin.
+	w.Header().Set("Content-Type", object.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(object.Size, 10))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	w.WriteHeader(http.StatusOK)
+	io.Copy(w, body)
+}
+
+// handleDeleteObject handles DELETE /storage/{bucket}/{key}.
+func (api *API) handleDeleteObject(w http.ResponseWriter, r *http.Request) {
+	t, err := api.resolveTenant(r, r.PathValue("bucket"), "delete")
+	if err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	if err := api.deleteObject(r.Context(), t, r.PathValue("bucket"), r.PathValue("key")); err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleSignObject handles POST /storage/{bucket}/sign, returning a link
+// that downloads an object without credentials until it expires.
+func (api *API) handleSignObject(w http.ResponseWriter, r *http.Request) {
+	tools.LimitBody(w, r)
+	defer r.Body.Close()
+	var req SignRequest
+	if err := tools.DecodeJSON(r.Body, &req); err != nil {
+		tools.RespErr(w, tools.ErrInvalidJSON)
+		return
+	}
+	bucket := r.PathValue("bucket")
+	t, err := api.resolveTenant(r, bucket, "select")
+	if err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	if _, err := api.getObject(r.Context(), t, bucket, req.Key); err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	ttl := time.Duration(config.Cfg.StorageURLTTL) * time.Second
+	if req.ExpiresIn < 0 || req.ExpiresIn > 7*24*3600 {
+		tools.RespErr(w, tools.InvalidRequestErr("expiresIn must be between 1 and 604800 seconds"))
+		return
+	}
+	if req.ExpiresIn > 0 {
+		ttl = time.Duration(req.ExpiresIn) * time.Second
+	}
+	now := time.Now()
+	signed, err := api.signURL(t, bucket, req.Key, ttl, now)
+	if err != nil {
+		tools.RespErr(w, err)
+		return
+	}
+	tools.RespondJSON(w, http.StatusOK, SignResponse{URL: signed, ExpiresAt: now.Add(ttl).UTC().Truncate(time.Second)})
+}
+
+// signURL returns a download link for an object: the backend's own when it
+// presigns, and a link to GET /storage/{bucket}/{key} otherwise.
+func (api *API) signURL(t tenant, bucket, key string, ttl time.Duration, now time.Time) (string, error) {
+	if presigner, ok := api.backend.(Presigner); ok {
+		return presigner.PresignGet(objectPath(t, bucket, key), ttl, now)
+	}
+	expires := strconv.FormatInt(now.Add(ttl).Unix(), 10)
+	signature, err := urlSignature(t, bucket, key, expires)
+	if err != nil {
+		return "", err
+	}
+	query := url.Values{"tenant": {t.prefix()}, "expires": {expires}, "signature": {signature}}
+	path := (&url.URL{Path: "/storage/" + bucket + "/" + key}).EscapedPath()
+	return strings.TrimRight(config.Cfg.ApiURL, "/") + path + "?" + query.Encode(), nil
+}
+
+// urlSignature signs a download link with a key derived from the service
+// key, so rotating ATOMICBASE_API_KEY revokes every link.
+func urlSignature(t tenant, bucket, key, expires string) (string, error) {
+	if config.Cfg.APIKey == "" {
+		return "", errors.New("signed storage urls need ATOMICBASE_API_KEY")
+	}
+	secret := sha256.Sum256([]byte("atombase storage url\n" + config.Cfg.APIKey))
+	mac := hmac.New(sha256.New, secret[:])
+	mac.Write([]byte(strings.Join([]string{t.prefix(), bucket, key, expires}, "\n")))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// verifySignedURL checks the query of a signed link to bucket and key and
+// returns the tenant it was issued for.
+func verifySignedURL(query url.Values, bucket, key string, now time.Time) (tenant, error) {
+	t, ok := parseTenantPrefix(query.Get("tenant"))
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if !ok || err != nil || now.Unix() >= expires {
+		return tenant{}, tools.ErrSignedURLInvalid
+	}
+	want, err := urlSignature(t, bucket, key, query.Get("expires"))
+	if err != nil {
+		return tenant{}, err
+	}
+	if !hmac.Equal([]byte(query.Get("signature")), []byte(want)) {
+		return tenant{}, tools.ErrSignedURLInvalid
+	}
+	return t, nil
+}
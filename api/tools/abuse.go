@@ -0,0 +1,97 @@
+package tools
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// AbuseHalfLife is how long it takes an abuse score to halve.
+const AbuseHalfLife = 10 * time.Minute
+
+// maxAbuseKeys bounds how many keys are scored before the lowest are dropped.
+const maxAbuseKeys = 100000
+
+// AbuseScore is how much a key has been refused lately.
+type AbuseScore struct {
+	Key   string  `json:"key"`
+	Score float64 `json:"score"`
+}
+
+type abuseEntry struct {
+	score   float64
+	updated time.Time
+}
+
+// abuseScores adds up the requests refused to each key, decaying by half every
+// AbuseHalfLife, so a caller that keeps hitting its limit stands out from one
+// that hit it once.
+var abuseScores = struct {
+	sync.Mutex
+	entries map[string]*abuseEntry
+}{entries: map[string]*abuseEntry{}}
+
+// decayed is the entry's score at now.
+func (e *abuseEntry) decayed(now time.Time) float64 {
+	elapsed := now.Sub(e.updated)
+	if elapsed <= 0 {
+		return e.score
+	}
+	return e.score * math.Exp2(-float64(elapsed)/float64(AbuseHalfLife))
+}
+
+// RecordAbuse adds n to key's abuse score and returns the new score.
+func RecordAbuse(key string, n float64, now time.Time) float64 {
+	abuseScores.Lock()
+	defer abuseScores.Unlock()
+	entry, ok := abuseScores.entries[key]
+	if !ok {
+		if len(abuseScores.entries) >= maxAbuseKeys {
+			sweepAbuse(now)
+		}
+		entry = &abuseEntry{updated: now}
+		abuseScores.entries[key] = entry
+	}
+	entry.score = entry.decayed(now) + n
+	entry.updated = now
+	return entry.score
+}
+
+// AbuseScoreOf returns key's abuse score at now.
+func AbuseScoreOf(key string, now time.Time) float64 {
+	abuseScores.Lock()
+	defer abuseScores.Unlock()
+	if entry, ok := abuseScores.entries[key]; ok {
+		return entry.decayed(now)
+	}
+	return 0
+}
+
+// TopAbuseScores returns the n highest scores of at least 1, highest first.
+func TopAbuseScores(n int, now time.Time) []AbuseScore {
+	abuseScores.Lock()
+	sweepAbuse(now)
+	scores := make([]AbuseScore, 0, len(abuseScores.entries))
+	for key, entry := range abuseScores.entries {
+		scores = append(scores, AbuseScore{Key: key, Score: entry.decayed(now)})
+	}
+	abuseScores.Unlock()
+	sort.Slice(scores, func(i, j int) bool {
+		if scores[i].Score != scores[j].Score {
+			return scores[i].Score > scores[j].Score
+		}
+		return scores[i].Key < scores[j].Key
+	})
+	return scores[:min(n, len(scores))]
+}
+
+// sweepAbuse drops the scores that have decayed below 1. Callers hold
+// abuseScores.
+func sweepAbuse(now time.Time) {
+	for key, entry := range abuseScores.entries {
+		if entry.decayed(now) < 1 {
+			delete(abuseScores.entries, key)
+		}
+	}
+}
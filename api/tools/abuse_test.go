@@ -0,0 +1,33 @@
+package tools
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestAbuseScores(t *testing.T) {
+	now := time.Now()
+	RecordAbuse("abuse-test:a", 8, now)
+	if got := RecordAbuse("abuse-test:a", 2, now); got != 10 {
+		t.Fatalf("expected scores to add up, got %v", got)
+	}
+	if got := AbuseScoreOf("abuse-test:a", now.Add(AbuseHalfLife)); math.Abs(got-5) > 1e-9 {
+		t.Errorf("expected the score to halve after a half-life, got %v", got)
+	}
+	if got := AbuseScoreOf("abuse-test:unknown", now); got != 0 {
+		t.Errorf("expected an unknown key to score 0, got %v", got)
+	}
+
+	RecordAbuse("abuse-test:b", 20, now)
+	top := TopAbuseScores(1, now)
+	if len(top) != 1 || top[0].Key != "abuse-test:b" {
+		t.Errorf("expected the highest score first, got %v", top)
+	}
+	// Decayed below 1, a score is dropped.
+	for _, score := range TopAbuseScores(100, now.Add(10*AbuseHalfLife)) {
+		if score.Key == "abuse-test:a" {
+			t.Errorf("expected a decayed score to be dropped, got %v", score)
+		}
+	}
+}
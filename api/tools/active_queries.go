@@ -0,0 +1,109 @@
+package tools
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ActiveQuery is a Data API request running on this server, with the query
+// it is running.
+type ActiveQuery struct {
+	ID          string    `json:"id"`
+	Database    string    `json:"database"`
+	Path        string    `json:"path"`
+	Operation   string    `json:"operation,omitempty"`
+	Table       string    `json:"table,omitempty"`
+	Shape       string    `json:"shape,omitempty"` // Query shape of the statement running, without literal values
+	Fingerprint string    `json:"fingerprint,omitempty"`
+	StartedAt   time.Time `json:"startedAt"`
+	AgeMs       int64     `json:"ageMs"`
+}
+
+type activeQueryKey struct{}
+
+type activeQuery struct {
+	info   ActiveQuery
+	cancel context.CancelCauseFunc
+}
+
+var activeQueries = struct {
+	sync.Mutex
+	byID map[string]*activeQuery
+}{byID: map[string]*activeQuery{}}
+
+// TrackQuery registers a Data API request on database until the returned
+// func is called. The returned context is canceled with ErrQueryInterrupted
+// when the request is interrupted; SQLite stops a statement whose context is
+// canceled, and remote backends abort the request running it.
+func TrackQuery(ctx context.Context, database, path string) (context.Context, func()) {
+	raw := make([]byte, 8)
+	_, _ = rand.Read(raw)
+	ctx, cancel := context.WithCancelCause(ctx)
+	q := &activeQuery{
+		info:   ActiveQuery{ID: "qry_" + hex.EncodeToString(raw), Database: database, Path: path, StartedAt: time.Now().UTC()},
+		cancel: cancel,
+	}
+	activeQueries.Lock()
+	activeQueries.byID[q.info.ID] = q
+	activeQueries.Unlock()
+	return context.WithValue(ctx, activeQueryKey{}, q), func() {
+		activeQueries.Lock()
+		delete(activeQueries.byID, q.info.ID)
+		activeQueries.Unlock()
+		cancel(nil)
+	}
+}
+
+// NoteQueryShape records the shape of the query a tracked request is about
+// to run. The operation and table are the first two words of the shape.
+func NoteQueryShape(ctx context.Context, shape string) {
+	q, ok := ctx.Value(activeQueryKey{}).(*activeQuery)
+	if !ok {
+		return
+	}
+	operation, rest, _ := strings.Cut(shape, " ")
+	table, _, _ := strings.Cut(rest, " ")
+	activeQueries.Lock()
+	q.info.Operation, q.info.Table, q.info.Shape, q.info.Fingerprint = operation, table, shape, ShapeFingerprint(shape)
+	activeQueries.Unlock()
+}
+
+// ActiveQueries returns the requests running on database on this server,
+// oldest first.
+func ActiveQueries(database string) []ActiveQuery {
+	now := time.Now()
+	queries := []ActiveQuery{}
+	activeQueries.Lock()
+	for _, q := range activeQueries.byID {
+		if q.info.Database == database {
+			info := q.info
+			info.AgeMs = now.Sub(info.StartedAt).Milliseconds()
+			queries = append(queries, info)
+		}
+	}
+	activeQueries.Unlock()
+	sort.Slice(queries, func(i, j int) bool { return queries[i].StartedAt.Before(queries[j].StartedAt) })
+	return queries
+}
+
+// InterruptQuery stops a request running on database, returning the query it
+// was running.
+func InterruptQuery(database, id string) (ActiveQuery, error) {
+	activeQueries.Lock()
+	q, ok := activeQueries.byID[id]
+	activeQueries.Unlock()
+	if !ok || q.info.Database != database {
+		return ActiveQuery{}, ErrActiveQueryNotFound
+	}
+	q.cancel(ErrQueryInterrupted)
+	activeQueries.Lock()
+	info := q.info
+	activeQueries.Unlock()
+	info.AgeMs = time.Since(info.StartedAt).Milliseconds()
+	return info, nil
+}
@@ -0,0 +1,49 @@
+package tools
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+)
+
+func TestActiveQueries(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx, done := TrackQuery(context.Background(), "acme", "/data/query/notes")
+	defer done()
+	_, doneOther := TrackQuery(context.Background(), "other", "/data/query/notes")
+	NoteQueryShape(ctx, "select notes where:id:eq")
+
+	running := ActiveQueries("acme")
+	if len(running) != 1 || running[0].Operation != "select" || running[0].Table != "notes" || running[0].Fingerprint != ShapeFingerprint("select notes where:id:eq") {
+		t.Fatalf("unexpected active queries %+v", running)
+	}
+	if _, err := InterruptQuery("other", running[0].ID); !errors.Is(err, ErrActiveQueryNotFound) {
+		t.Fatalf("expected another database's query to be hidden, got %v", err)
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		var n int64
+		errc <- db.QueryRowContext(ctx, `WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM c) SELECT count(*) FROM c`).Scan(&n)
+	}()
+	if _, err := InterruptQuery("acme", running[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errc; err == nil {
+		t.Fatal("expected the interrupted statement to fail")
+	}
+	if !errors.Is(context.Cause(ctx), ErrQueryInterrupted) {
+		t.Fatalf("expected ErrQueryInterrupted, got %v", context.Cause(ctx))
+	}
+
+	doneOther()
+	if running := ActiveQueries("other"); len(running) != 0 {
+		t.Fatalf("expected a finished query to be dropped, got %+v", running)
+	}
+}
@@ -2,6 +2,8 @@ package tools
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"log/slog"
 	"sync"
 	"time"
@@ -23,10 +25,69 @@ type ActivityLog struct {
 	Database   string
 	RequestID  string
 	Error      string
+	Queries    []QueryFingerprint
+}
+
+// QueryFingerprint describes one Data API query without its literal values.
+// Queries with the same shape share a fingerprint, so logs can be grouped by it.
+type QueryFingerprint struct {
+	Fingerprint string `json:"fingerprint"` // Short hash of Shape
+	Operation   string `json:"operation"`
+	Table       string `json:"table"`
+	Shape       string `json:"shape"`
+	Rows        int64  `json:"rows"` // Rows returned, written or affected
+}
+
+type queryLogKey struct{}
+
+// queryLog collects the fingerprints of queries run while serving a request.
+type queryLog struct {
+	mu      sync.Mutex
+	queries []QueryFingerprint
+}
+
+// WithQueryLog returns a context that collects the queries recorded with RecordQuery.
+func WithQueryLog(ctx context.Context) context.Context {
+	return context.WithValue(ctx, queryLogKey{}, &queryLog{})
+}
+
+// RecordQuery adds a query to the request's activity record. It does nothing
+// outside a context created by WithQueryLog.
+func RecordQuery(ctx context.Context, operation, table, shape string, rows int64) {
+	log, ok := ctx.Value(queryLogKey{}).(*queryLog)
+	if !ok {
+		return
+	}
+	log.mu.Lock()
+	log.queries = append(log.queries, QueryFingerprint{
+		Fingerprint: ShapeFingerprint(shape),
+		Operation:   operation,
+		Table:       table,
+		Shape:       shape,
+		Rows:        rows,
+	})
+	log.mu.Unlock()
+}
+
+// ShapeFingerprint returns the short hash queries with the same shape share.
+func ShapeFingerprint(shape string) string {
+	sum := sha256.Sum256([]byte(shape))
+	return hex.EncodeToString(sum[:8])
+}
+
+// RecordedQueries returns the queries recorded in ctx.
+func RecordedQueries(ctx context.Context) []QueryFingerprint {
+	log, ok := ctx.Value(queryLogKey{}).(*queryLog)
+	if !ok {
+		return nil
+	}
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	return append([]QueryFingerprint(nil), log.queries...)
 }
 
 // ActivityHandler implements slog.Handler for activity logging.
-// For now, it emits structured logs to stdout only.
+// It emits structured logs to stdout and to the log sink, if one is configured.
 type ActivityHandler struct {
 	mu     sync.RWMutex
 	closed bool
@@ -99,10 +160,27 @@ func (h *ActivityHandler) Handle(_ context.Context, r slog.Record) error {
 			log.RequestID = a.Value.String()
 		case "error":
 			log.Error = a.Value.String()
+		case "queries":
+			log.Queries, _ = a.Value.Any().([]QueryFingerprint)
 		}
 		return true
 	})
 
+	ShipLog(LogStreamActivity, map[string]any{
+		"time":        log.Time.UTC().Format(time.RFC3339Nano),
+		"message":     log.Message,
+		"api":         log.API,
+		"method":      log.Method,
+		"path":        log.Path,
+		"status":      log.Status,
+		"duration_ms": log.DurationMs,
+		"client_ip":   log.ClientIP,
+		"database":    log.Database,
+		"request_id":  log.RequestID,
+		"error":       log.Error,
+		"queries":     log.Queries,
+	})
+
 	Logger.Info("activity",
 		"time", log.Time.Format(time.RFC3339),
 		"level", log.Level,
@@ -116,6 +194,7 @@ func (h *ActivityHandler) Handle(_ context.Context, r slog.Record) error {
 		"database", log.Database,
 		"request_id", log.RequestID,
 		"error", log.Error,
+		"queries", log.Queries,
 	)
 
 	return nil
@@ -135,7 +214,7 @@ func (h *ActivityHandler) WithGroup(name string) slog.Handler {
 func (h *ActivityHandler) Flush() {}
 
 // LogActivity logs a request activity entry.
-func LogActivity(api, method, path string, status int, durationMs int64, clientIP, database, requestID, errMsg string) {
+func LogActivity(api, method, path string, status int, durationMs int64, clientIP, database, requestID, errMsg string, queries []QueryFingerprint) {
 	if activityHandler == nil {
 		return
 	}
@@ -151,6 +230,7 @@ func LogActivity(api, method, path string, status int, durationMs int64, clientI
 		slog.String("database", database),
 		slog.String("request_id", requestID),
 		slog.String("error", errMsg),
+		slog.Any("queries", queries),
 	)
 
 	activityHandler.Handle(context.Background(), record)
@@ -0,0 +1,145 @@
+package tools
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/atombasedev/atombase/config"
+)
+
+// Cookies and header of browser admin sessions. The session cookie is
+// HttpOnly; the CSRF cookie is readable by the page, which echoes it in
+// CSRFHeader on every request that changes something.
+const (
+	AdminSessionCookie = "atombase_admin_session"
+	CSRFCookie         = "atombase_csrf"
+	CSRFHeader         = "X-CSRF-Token"
+)
+
+// AdminSession is the signed content of an admin session cookie. Subject is
+// "service" after a service key login, or the admin's email after OIDC.
+type AdminSession struct {
+	Subject   string `json:"sub"`
+	ExpiresAt int64  `json:"exp"`
+	CSRF      string `json:"csrf"`
+}
+
+// adminSessionKey derives the cookie signing key from the service key, so
+// rotating ATOMICBASE_API_KEY ends every session.
+func adminSessionKey() ([]byte, error) {
+	if config.Cfg.APIKey == "" {
+		return nil, errors.New("admin sessions need ATOMICBASE_API_KEY")
+	}
+	sum := sha256.Sum256([]byte("atombase admin session\n" + config.Cfg.APIKey))
+	return sum[:], nil
+}
+
+// IssueAdminSession signs a session for subject and sets its cookies on w.
+func IssueAdminSession(w http.ResponseWriter, subject string, now time.Time) (*AdminSession, error) {
+	key, err := adminSessionKey()
+	if err != nil {
+		return nil, err
+	}
+	csrf := make([]byte, 32)
+	if _, err := rand.Read(csrf); err != nil {
+		return nil, err
+	}
+	ttl := time.Duration(config.Cfg.AdminSessionTTL) * time.Minute
+	session := &AdminSession{
+		Subject:   subject,
+		ExpiresAt: now.Add(ttl).Unix(),
+		CSRF:      base64.RawURLEncoding.EncodeToString(csrf),
+	}
+	payload, err := json.Marshal(session)
+	if err != nil {
+		return nil, err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(encoded))
+	value := encoded + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+
+	http.SetCookie(w, adminCookie(AdminSessionCookie, value, int(ttl.Seconds()), true))
+	http.SetCookie(w, adminCookie(CSRFCookie, session.CSRF, int(ttl.Seconds()), false))
+	return session, nil
+}
+
+// ClearAdminSession expires the session cookies on w.
+func ClearAdminSession(w http.ResponseWriter) {
+	http.SetCookie(w, adminCookie(AdminSessionCookie, "", -1, true))
+	http.SetCookie(w, adminCookie(CSRFCookie, "", -1, false))
+}
+
+// adminCookie builds a same-site strict cookie, marked Secure when the API
+// is served over HTTPS.
+func adminCookie(name, value string, maxAge int, httpOnly bool) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: httpOnly,
+		Secure:   strings.HasPrefix(config.Cfg.ApiURL, "https://"),
+		SameSite: http.SameSiteStrictMode,
+	}
+}
+
+// ReadAdminSession returns the session of r's cookie when admin sessions are
+// enabled and it is validly signed and unexpired.
+func ReadAdminSession(r *http.Request, now time.Time) (*AdminSession, bool) {
+	if !config.Cfg.AdminSessions {
+		return nil, false
+	}
+	cookie, err := r.Cookie(AdminSessionCookie)
+	if err != nil {
+		return nil, false
+	}
+	key, err := adminSessionKey()
+	if err != nil {
+		return nil, false
+	}
+	encoded, signature, ok := strings.Cut(cookie.Value, ".")
+	if !ok {
+		return nil, false
+	}
+	got, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return nil, false
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(encoded))
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return nil, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, false
+	}
+	var session AdminSession
+	if err := json.Unmarshal(payload, &session); err != nil || now.Unix() >= session.ExpiresAt {
+		return nil, false
+	}
+	return &session, true
+}
+
+// checkCSRF requires requests that can change state to echo the session's
+// CSRF token in CSRFHeader. Reads need nothing.
+func checkCSRF(r *http.Request, session *AdminSession) error {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return nil
+	}
+	token := r.Header.Get(CSRFHeader)
+	if token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(session.CSRF)) != 1 {
+		return ErrCSRFTokenInvalid
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package tools
+
+import (
+	"context"
+	"slices"
+	"strings"
+)
+
+// APIKeyPrefix starts the bearer token of a scoped API key:
+// "key.<id>.<secret>".
+const APIKeyPrefix = "key."
+
+// API key verbs. Read allows selects, write allows inserts, updates and
+// deletes, and admin allows both plus the platform and auth management APIs.
+// Override quotas lets an admin key create definitions and databases past
+// the deployment's quotas.
+const (
+	VerbRead           = "read"
+	VerbWrite          = "write"
+	VerbAdmin          = "admin"
+	VerbOverrideQuotas = "override_quotas"
+)
+
+// Roles of platform organization keys and members, from most to least
+// privileged. Viewers only read; developers change definitions, databases and
+// migrations; admins also manage keys and members; owners may grant owner.
+const (
+	OrgRoleOwner     = "owner"
+	OrgRoleAdmin     = "admin"
+	OrgRoleDeveloper = "developer"
+	OrgRoleViewer    = "viewer"
+)
+
+// APIKeyScope is what a scoped API key may do. An empty Database or Tables
+// means any. A key with an Org belongs to that platform organization and only
+// reaches its definitions, databases and keys, as far as its Role allows.
+type APIKeyScope struct {
+	KeyID    string
+	Org      string
+	Role     string // One of the OrgRole constants; set with Org
+	Database string
+	Tables   []string
+	Verbs    []string
+}
+
+// APIKeyLookup resolves the id and secret of a scoped key token to the key's
+// scope, failing when the key does not exist or the secret does not match.
+type APIKeyLookup func(ctx context.Context, id, secret string) (*APIKeyScope, error)
+
+// ParseAPIKeyToken splits a "key.<id>.<secret>" token.
+func ParseAPIKeyToken(token string) (id, secret string, ok bool) {
+	rest, found := strings.CutPrefix(token, APIKeyPrefix)
+	if !found {
+		return "", "", false
+	}
+	id, secret, ok = strings.Cut(rest, ".")
+	return id, secret, ok && id != "" && secret != ""
+}
+
+// FullAccess reports whether the key can do everything the service key can:
+// admin over every database and table of every organization.
+func (s *APIKeyScope) FullAccess() bool {
+	return s.PlatformAccess() && s.Org == ""
+}
+
+// PlatformAccess reports whether the key may use the platform API: admin, or
+// a read key of an org viewer, without database or table limits. An org key
+// manages only its org there, and its role decides what it may change.
+func (s *APIKeyScope) PlatformAccess() bool {
+	allowed := s.hasVerb(VerbAdmin) || (s.Role == OrgRoleViewer && s.hasVerb(VerbRead))
+	return allowed && s.Database == "" && len(s.Tables) == 0
+}
+
+// Allows reports whether the key may run operation (select, insert, update
+// or delete) on table.
+func (s *APIKeyScope) Allows(table, operation string) bool {
+	if len(s.Tables) > 0 && !slices.Contains(s.Tables, table) {
+		return false
+	}
+	if s.hasVerb(VerbAdmin) {
+		return true
+	}
+	if operation == "select" {
+		return s.hasVerb(VerbRead)
+	}
+	return s.hasVerb(VerbWrite)
+}
+
+// OverridesQuotas reports whether the key may exceed creation quotas.
+func (s *APIKeyScope) OverridesQuotas() bool {
+	return s.FullAccess() && s.hasVerb(VerbOverrideQuotas)
+}
+
+func (s *APIKeyScope) hasVerb(verb string) bool {
+	return slices.Contains(s.Verbs, verb)
+}
@@ -0,0 +1,126 @@
+package tools
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Kinds of constraint a ConstraintError reports.
+const (
+	ConstraintUnique     = "unique"
+	ConstraintForeignKey = "foreign_key"
+	ConstraintNotNull    = "not_null"
+	ConstraintCheck      = "check"
+)
+
+// ConstraintError is a SQLite constraint failure, with the table, columns and
+// constraint it concerns as far as the driver message and schema tell.
+type ConstraintError struct {
+	Kind       string
+	Table      string
+	Columns    []string
+	Constraint string // Index or CHECK name, or a description of the foreign keys
+	Err        error  // The driver error
+}
+
+func (e *ConstraintError) Error() string { return e.Err.Error() }
+func (e *ConstraintError) Unwrap() error { return e.Err }
+
+var constraintMessages = []struct {
+	prefix string
+	kind   string
+}{
+	{"UNIQUE constraint failed", ConstraintUnique},
+	{"FOREIGN KEY constraint failed", ConstraintForeignKey},
+	{"NOT NULL constraint failed", ConstraintNotNull},
+	{"CHECK constraint failed", ConstraintCheck},
+}
+
+// ParseConstraintError reads a SQLite constraint failure such as
+// "UNIQUE constraint failed: users.email" out of err, which may be wrapped
+// or come from a remote driver. It returns nil for other errors.
+func ParseConstraintError(err error) *ConstraintError {
+	if err == nil {
+		return nil
+	}
+	var parsed *ConstraintError
+	if errors.As(err, &parsed) {
+		return parsed
+	}
+	msg := err.Error()
+	for _, m := range constraintMessages {
+		i := strings.Index(msg, m.prefix)
+		if i < 0 {
+			continue
+		}
+		c := &ConstraintError{Kind: m.kind, Err: err}
+		detail, _, _ := strings.Cut(msg[i+len(m.prefix):], "\n")
+		detail = strings.TrimSpace(strings.TrimPrefix(detail, ":"))
+		switch m.kind {
+		case ConstraintUnique, ConstraintNotNull:
+			// table.column[, table.column...]
+			for _, qualified := range strings.Split(detail, ",") {
+				table, column, ok := strings.Cut(strings.TrimSpace(qualified), ".")
+				if !ok {
+					continue
+				}
+				c.Table = table
+				c.Columns = append(c.Columns, column)
+			}
+		case ConstraintCheck:
+			// The constraint's name, or its expression when it has none.
+			c.Constraint = detail
+		}
+		return c
+	}
+	return nil
+}
+
+// constraintAPIError describes a constraint failure: 409 when the write
+// conflicts with other rows, 422 when its own values are rejected.
+func constraintAPIError(c *ConstraintError) (int, APIError) {
+	apiErr := APIError{Table: c.Table, Columns: c.Columns, Constraint: c.Constraint}
+	target := c.Table
+	if len(c.Columns) > 0 && c.Table != "" {
+		target = c.Table + "." + strings.Join(c.Columns, ", "+c.Table+".")
+	}
+	switch c.Kind {
+	case ConstraintUnique:
+		apiErr.Code = CodeUniqueViolation
+		apiErr.Message = "record already exists"
+		if target != "" {
+			apiErr.Message = fmt.Sprintf("record already exists: %s must be unique", target)
+		}
+		apiErr.Hint = "A record with this unique value already exists. Use upsert (on-conflict=replace) to update existing records."
+		return http.StatusConflict, apiErr
+	case ConstraintForeignKey:
+		apiErr.Code = CodeForeignKeyViolation
+		apiErr.Message = "foreign key constraint violation"
+		if c.Constraint != "" {
+			apiErr.Message += ": " + c.Constraint
+		}
+		apiErr.Hint = "The referenced record does not exist, or other records still reference the one being deleted."
+		return http.StatusConflict, apiErr
+	case ConstraintNotNull:
+		apiErr.Code = CodeNotNullViolation
+		apiErr.Message = "required field is missing"
+		if target != "" {
+			apiErr.Message = fmt.Sprintf("required field is missing: %s cannot be null", target)
+		}
+		apiErr.Hint = "One or more required fields were not provided. Check your request body for missing columns."
+		return http.StatusUnprocessableEntity, apiErr
+	default:
+		apiErr.Code = CodeCheckViolation
+		apiErr.Message = "check constraint failed"
+		if c.Constraint != "" {
+			apiErr.Message += ": " + c.Constraint
+		}
+		if c.Table != "" {
+			apiErr.Message += " on " + c.Table
+		}
+		apiErr.Hint = "A value is outside what the table's CHECK constraints allow."
+		return http.StatusUnprocessableEntity, apiErr
+	}
+}
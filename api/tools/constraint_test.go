@@ -0,0 +1,63 @@
+package tools
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestParseConstraintError(t *testing.T) {
+	tests := []struct {
+		msg  string
+		want *ConstraintError
+	}{
+		{"UNIQUE constraint failed: users.email", &ConstraintError{Kind: ConstraintUnique, Table: "users", Columns: []string{"email"}}},
+		{"operation 1 (insert on members): UNIQUE constraint failed: members.org_id, members.user_id",
+			&ConstraintError{Kind: ConstraintUnique, Table: "members", Columns: []string{"org_id", "user_id"}}},
+		{"SQLITE_CONSTRAINT: SQLite error: NOT NULL constraint failed: users.name", &ConstraintError{Kind: ConstraintNotNull, Table: "users", Columns: []string{"name"}}},
+		{"CHECK constraint failed: positive_price", &ConstraintError{Kind: ConstraintCheck, Constraint: "positive_price"}},
+		{"FOREIGN KEY constraint failed", &ConstraintError{Kind: ConstraintForeignKey}},
+		{"no such table: users", nil},
+	}
+	for _, tt := range tests {
+		err := errors.New(tt.msg)
+		got := ParseConstraintError(err)
+		if tt.want == nil {
+			if got != nil {
+				t.Errorf("%q: got %+v, want nil", tt.msg, got)
+			}
+			continue
+		}
+		tt.want.Err = err
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: got %+v, want %+v", tt.msg, got, tt.want)
+		}
+	}
+
+	// A described error is found through wrapping.
+	described := &ConstraintError{Kind: ConstraintForeignKey, Table: "posts", Constraint: "author_id references users.id", Err: errors.New("FOREIGN KEY constraint failed")}
+	if got := ParseConstraintError(fmt.Errorf("operation 0: %w", described)); got != described {
+		t.Errorf("got %+v, want the wrapped error", got)
+	}
+}
+
+func TestBuildAPIError_Constraint(t *testing.T) {
+	status, apiErr := BuildAPIError(&ConstraintError{
+		Kind:       ConstraintForeignKey,
+		Table:      "posts",
+		Columns:    []string{"author_id"},
+		Constraint: "author_id references users.id",
+		Err:        errors.New("FOREIGN KEY constraint failed"),
+	})
+	if status != http.StatusConflict || apiErr.Code != CodeForeignKeyViolation || apiErr.Table != "posts" ||
+		!reflect.DeepEqual(apiErr.Columns, []string{"author_id"}) || apiErr.Message != "foreign key constraint violation: author_id references users.id" {
+		t.Errorf("got %d %+v", status, apiErr)
+	}
+
+	status, apiErr = BuildAPIError(errors.New("CHECK constraint failed: positive_price"))
+	if status != http.StatusUnprocessableEntity || apiErr.Code != CodeCheckViolation || apiErr.Constraint != "positive_price" {
+		t.Errorf("got %d %+v", status, apiErr)
+	}
+}
@@ -0,0 +1,65 @@
+package tools
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	base := time.Date(2026, 3, 13, 10, 17, 30, 0, time.UTC) // a Friday
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"* * * * *", "2026-03-13T10:18:00Z"},
+		{"*/15 * * * *", "2026-03-13T10:30:00Z"},
+		{"@hourly", "2026-03-13T11:00:00Z"},
+		{"@daily", "2026-03-14T00:00:00Z"},
+		{"30 6 * * 1-5", "2026-03-16T06:30:00Z"},
+		{"0 9 1 * *", "2026-04-01T09:00:00Z"},
+		{"0 0 29 2 *", "2028-02-29T00:00:00Z"},
+		{"0 12 * * 7", "2026-03-15T12:00:00Z"},
+		{"0 12 1 * 0", "2026-03-15T12:00:00Z"}, // either day field matches
+		{"0 8,17 * * *", "2026-03-13T17:00:00Z"},
+		{"5-10/5 10 * * *", "2026-03-14T10:05:00Z"},
+	}
+	for _, tt := range tests {
+		c, err := ParseCron(tt.expr)
+		if err != nil {
+			t.Errorf("%s: %v", tt.expr, err)
+			continue
+		}
+		if got := c.Next(base).Format(time.RFC3339); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestCronNext_Timezone(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	c, _ := ParseCron("0 9 * * *")
+	got := c.Next(time.Date(2026, 1, 5, 15, 0, 0, 0, time.UTC).In(loc))
+	if want := time.Date(2026, 1, 6, 14, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("got %s, want %s", got.UTC(), want)
+	}
+
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+	if err != nil {
+		t.Skip(err)
+	}
+	c, _ = ParseCron("0 * * * *")
+	if got := c.Next(time.Date(2026, 1, 5, 10, 10, 0, 0, kolkata)); got.Hour() != 11 || got.Minute() != 0 {
+		t.Errorf("got %s in a half-hour zone", got)
+	}
+}
+
+func TestParseCron_Invalid(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "0 0 0 * *", "*/0 * * * *", "5-1 * * * *", "0 0 30 2 *", "@often"} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("%q: expected an error", expr)
+		}
+	}
+}
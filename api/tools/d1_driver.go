@@ -0,0 +1,341 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// The "d1" driver runs statements through the D1 query API, with the
+// database UUID as its data source name. D1 has no interactive transactions:
+// a transaction holds its writes and sends them in one request on commit, or
+// together with the next query that reads, which D1 runs as one transaction.
+// Writes sent with a read are committed, and a later rollback fails with
+// errD1Sent.
+func init() {
+	sql.Register("d1", d1Driver{})
+}
+
+var errD1Sent = errors.New("d1: statements already sent cannot be rolled back")
+
+type d1Statement struct {
+	SQL    string `json:"sql"`
+	Params []any  `json:"params,omitempty"`
+}
+
+type d1Meta struct {
+	Changes   int64 `json:"changes"`
+	LastRowID int64 `json:"last_row_id"`
+}
+
+type d1Result struct {
+	Results struct {
+		Columns []string            `json:"columns"`
+		Rows    [][]json.RawMessage `json:"rows"`
+	} `json:"results"`
+	Meta d1Meta `json:"meta"`
+}
+
+// d1Query runs statements on a database through the raw query endpoint,
+// which returns rows as arrays in column order.
+func d1Query(ctx context.Context, database string, statements []d1Statement) ([]d1Result, error) {
+	var body []byte
+	if len(statements) == 1 {
+		body, _ = json.Marshal(statements[0])
+	} else {
+		body, _ = json.Marshal(map[string]any{"batch": statements})
+	}
+	var results []d1Result
+	if err := doD1JSON(ctx, http.MethodPost, "/d1/database/"+database+"/raw", body, &results); err != nil {
+		return nil, err
+	}
+	if len(results) != len(statements) {
+		return nil, fmt.Errorf("d1: %d results for %d statements", len(results), len(statements))
+	}
+	return results, nil
+}
+
+type d1Driver struct{}
+
+func (d1Driver) Open(dsn string) (driver.Conn, error) {
+	if dsn == "" {
+		return nil, errors.New("d1: database uuid is required")
+	}
+	return &d1Conn{database: dsn}, nil
+}
+
+type d1Conn struct {
+	database string
+	tx       *d1Tx
+}
+
+func (c *d1Conn) Prepare(query string) (driver.Stmt, error) {
+	return &d1Stmt{conn: c, query: query}, nil
+}
+
+func (c *d1Conn) Close() error { return nil }
+
+func (c *d1Conn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *d1Conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	c.tx = &d1Tx{conn: c}
+	return c.tx, nil
+}
+
+func (c *d1Conn) Ping(ctx context.Context) error {
+	_, err := d1Query(ctx, c.database, []d1Statement{{SQL: "SELECT 1"}})
+	return err
+}
+
+func (c *d1Conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	statement, err := newD1Statement(query, args)
+	if err != nil {
+		return nil, err
+	}
+	if c.tx != nil {
+		return c.tx.hold(statement), nil
+	}
+	results, err := d1Query(ctx, c.database, []d1Statement{statement})
+	if err != nil {
+		return nil, err
+	}
+	return &d1ExecResult{meta: &results[0].Meta}, nil
+}
+
+func (c *d1Conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	statement, err := newD1Statement(query, args)
+	if err != nil {
+		return nil, err
+	}
+	var results []d1Result
+	if c.tx != nil {
+		results, err = c.tx.send(ctx, &statement)
+	} else {
+		results, err = d1Query(ctx, c.database, []d1Statement{statement})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newD1Rows(results[len(results)-1])
+}
+
+// newD1Statement binds positional arguments, the only kind D1 takes.
+func newD1Statement(query string, args []driver.NamedValue) (d1Statement, error) {
+	statement := d1Statement{SQL: query, Params: make([]any, len(args))}
+	for i, arg := range args {
+		if arg.Name != "" {
+			return d1Statement{}, fmt.Errorf("d1: named parameter %s is not supported", arg.Name)
+		}
+		switch v := arg.Value.(type) {
+		case []byte:
+			return d1Statement{}, errors.New("d1: blob parameters are not supported")
+		case bool:
+			if v {
+				statement.Params[i] = 1
+			} else {
+				statement.Params[i] = 0
+			}
+		case time.Time:
+			statement.Params[i] = v.UTC().Format(time.RFC3339Nano)
+		default:
+			statement.Params[i] = v
+		}
+	}
+	return statement, nil
+}
+
+type d1Stmt struct {
+	conn  *d1Conn
+	query string
+}
+
+func (s *d1Stmt) Close() error  { return nil }
+func (s *d1Stmt) NumInput() int { return -1 }
+
+func (s *d1Stmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.conn.ExecContext(context.Background(), s.query, namedValues(args))
+}
+
+func (s *d1Stmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.conn.QueryContext(context.Background(), s.query, namedValues(args))
+}
+
+func (s *d1Stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return s.conn.ExecContext(ctx, s.query, args)
+}
+
+func (s *d1Stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return s.conn.QueryContext(ctx, s.query, args)
+}
+
+func namedValues(args []driver.Value) []driver.NamedValue {
+	named := make([]driver.NamedValue, len(args))
+	for i, v := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: v}
+	}
+	return named
+}
+
+// d1Tx holds a transaction's writes until they are sent.
+type d1Tx struct {
+	conn    *d1Conn
+	pending []d1Statement
+	waiting []*d1ExecResult
+	sent    bool
+}
+
+// hold queues a write and returns a result that sends it when read.
+func (tx *d1Tx) hold(statement d1Statement) *d1ExecResult {
+	result := &d1ExecResult{tx: tx}
+	tx.pending = append(tx.pending, statement)
+	tx.waiting = append(tx.waiting, result)
+	return result
+}
+
+// send runs the held writes, followed by query when given, in one request.
+func (tx *d1Tx) send(ctx context.Context, query *d1Statement) ([]d1Result, error) {
+	statements := tx.pending
+	if query != nil {
+		statements = append(statements[:len(statements):len(statements)], *query)
+	}
+	if len(statements) == 0 {
+		return nil, nil
+	}
+	waiting := tx.waiting
+	tx.pending, tx.waiting = nil, nil
+	results, err := d1Query(ctx, tx.conn.database, statements)
+	if err != nil {
+		return nil, err
+	}
+	tx.sent = tx.sent || len(waiting) > 0
+	for i, result := range waiting {
+		result.meta = &results[i].Meta
+	}
+	return results, nil
+}
+
+func (tx *d1Tx) Commit() error {
+	tx.conn.tx = nil
+	_, err := tx.send(context.Background(), nil)
+	return err
+}
+
+func (tx *d1Tx) Rollback() error {
+	tx.conn.tx = nil
+	tx.pending, tx.waiting = nil, nil
+	if tx.sent {
+		return errD1Sent
+	}
+	return nil
+}
+
+// d1ExecResult is a write's result. One held in a transaction sends the
+// transaction's writes when read.
+type d1ExecResult struct {
+	tx   *d1Tx
+	meta *d1Meta
+}
+
+func (r *d1ExecResult) resolve() (*d1Meta, error) {
+	if r.meta == nil && r.tx != nil {
+		if _, err := r.tx.send(context.Background(), nil); err != nil {
+			return nil, err
+		}
+	}
+	if r.meta == nil {
+		return nil, errors.New("d1: result of a statement that was never sent")
+	}
+	return r.meta, nil
+}
+
+func (r *d1ExecResult) LastInsertId() (int64, error) {
+	meta, err := r.resolve()
+	if err != nil {
+		return 0, err
+	}
+	return meta.LastRowID, nil
+}
+
+func (r *d1ExecResult) RowsAffected() (int64, error) {
+	meta, err := r.resolve()
+	if err != nil {
+		return 0, err
+	}
+	return meta.Changes, nil
+}
+
+type d1Rows struct {
+	columns []string
+	rows    [][]driver.Value
+	next    int
+}
+
+func newD1Rows(result d1Result) (*d1Rows, error) {
+	rows := &d1Rows{columns: result.Results.Columns, rows: make([][]driver.Value, len(result.Results.Rows))}
+	for i, raw := range result.Results.Rows {
+		row := make([]driver.Value, len(raw))
+		for j, value := range raw {
+			v, err := d1Value(value)
+			if err != nil {
+				return nil, err
+			}
+			row[j] = v
+		}
+		rows.rows[i] = row
+	}
+	return rows, nil
+}
+
+// d1Value converts a JSON value of a result row. Integers stay int64, and
+// blobs, which D1 returns as arrays of bytes, become []byte.
+func d1Value(raw json.RawMessage) (driver.Value, error) {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	switch v := value.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n, nil
+		}
+		return v.Float64()
+	case []any:
+		blob := make([]byte, len(v))
+		for i, b := range v {
+			n, ok := b.(json.Number)
+			if !ok {
+				return nil, fmt.Errorf("d1: unexpected value %s", raw)
+			}
+			octet, err := n.Int64()
+			if err != nil {
+				return nil, err
+			}
+			blob[i] = byte(octet)
+		}
+		return blob, nil
+	}
+	return value, nil
+}
+
+func (r *d1Rows) Columns() []string { return r.columns }
+func (r *d1Rows) Close() error      { return nil }
+
+func (r *d1Rows) Next(dest []driver.Value) error {
+	if r.next >= len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.next])
+	r.next++
+	return nil
+}
@@ -0,0 +1,57 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"net/smtp"
+	"strings"
+
+	"github.com/atombasedev/atombase/config"
+)
+
+// Email is a plain-text message to one recipient.
+type Email struct {
+	To      string
+	Subject string
+	Text    string
+}
+
+// SendEmail sends a message through the configured SMTP server. Without
+// SMTP_HOST and SMTP_FROM it prints the message instead, for development.
+func SendEmail(_ context.Context, msg Email) error {
+	msg.To = strings.TrimSpace(msg.To)
+	msg.Subject = strings.TrimSpace(msg.Subject)
+	if msg.To == "" {
+		return fmt.Errorf("email recipient is required")
+	}
+	if msg.Subject == "" {
+		return fmt.Errorf("email subject is required")
+	}
+
+	from := strings.TrimSpace(config.Cfg.SMTPFrom)
+	host := strings.TrimSpace(config.Cfg.SMTPHost)
+	if from == "" || host == "" {
+		fmt.Printf("Outgoing email\nTo: %s\nSubject: %s\n\n%s\n", msg.To, msg.Subject, msg.Text)
+		return nil
+	}
+
+	addr := fmt.Sprintf("%s:%d", host, config.Cfg.SMTPPort)
+	body := strings.ReplaceAll(msg.Text, "\r\n", "\n")
+	body = strings.ReplaceAll(body, "\n", "\r\n")
+	raw := strings.Join([]string{
+		fmt.Sprintf("From: %s", from),
+		fmt.Sprintf("To: %s", msg.To),
+		fmt.Sprintf("Subject: %s", msg.Subject),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		body,
+	}, "\r\n")
+
+	var auth smtp.Auth
+	if config.Cfg.SMTPUsername != "" {
+		auth = smtp.PlainAuth("", config.Cfg.SMTPUsername, config.Cfg.SMTPPassword, host)
+	}
+
+	return smtp.SendMail(addr, auth, from, []string{msg.To}, []byte(raw))
+}
@@ -0,0 +1,306 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	mrand "math/rand/v2"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/atombasedev/atombase/config"
+)
+
+// maxPendingReports bounds how many error reports are sent concurrently.
+// Reports beyond it are dropped so an error storm cannot pile up goroutines.
+const maxPendingReports = 16
+
+// errorReporter sends events to a Sentry-compatible store endpoint.
+type errorReporter struct {
+	storeURL    string
+	authHeader  string
+	environment string
+	release     string
+	sampleRate  float64
+	client      *http.Client
+	pending     chan struct{}
+}
+
+var reporter *errorReporter
+
+// InitErrorReporting enables error reporting when SENTRY_DSN is set.
+func InitErrorReporting() error {
+	if config.Cfg.SentryDSN == "" {
+		return nil
+	}
+	r, err := newErrorReporter(config.Cfg.SentryDSN)
+	if err != nil {
+		return err
+	}
+	r.environment = config.Cfg.SentryEnvironment
+	r.release = config.Cfg.SentryRelease
+	r.sampleRate = config.Cfg.SentrySampleRate
+	reporter = r
+	return nil
+}
+
+// newErrorReporter parses a DSN of the form https://<key>@<host>/<project>.
+func newErrorReporter(dsn string) (*errorReporter, error) {
+	u, err := url.Parse(dsn)
+	if err != nil || u.User == nil || u.User.Username() == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid SENTRY_DSN")
+	}
+	path := strings.Trim(u.Path, "/")
+	idx := strings.LastIndex(path, "/")
+	prefix, project := "", path
+	if idx >= 0 {
+		prefix, project = "/"+path[:idx], path[idx+1:]
+	}
+	if project == "" {
+		return nil, fmt.Errorf("invalid SENTRY_DSN: missing project id")
+	}
+	return &errorReporter{
+		storeURL:   fmt.Sprintf("%s://%s%s/api/%s/store/", u.Scheme, u.Host, prefix, project),
+		authHeader: fmt.Sprintf("Sentry sentry_version=7, sentry_client=atombase/1.0, sentry_key=%s", u.User.Username()),
+		sampleRate: 1,
+		client:     &http.Client{Timeout: 10 * time.Second},
+		pending:    make(chan struct{}, maxPendingReports),
+	}, nil
+}
+
+// ReportError sends an error to the error reporter, if one is configured,
+// together with the caller's stack and the request being served. r may be nil.
+func ReportError(r *http.Request, err any) {
+	if reporter == nil {
+		return
+	}
+	reporter.report(r, err, callerFrames(3))
+}
+
+// reportFromWriter reports an internal error from code that only has the
+// response writer. The request is recovered from the writer that
+// PanicRecoveryMiddleware installed.
+func reportFromWriter(w http.ResponseWriter, err error) {
+	if reporter == nil {
+		return
+	}
+	var r *http.Request
+	for w != nil {
+		if rw, ok := w.(*reportingWriter); ok {
+			r = rw.req
+			break
+		}
+		inner, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			break
+		}
+		w = inner.Unwrap()
+	}
+	reporter.report(r, err, callerFrames(3))
+}
+
+// reportingWriter carries the request so errors written deeper in the chain
+// can be reported with it.
+type reportingWriter struct {
+	http.ResponseWriter
+	req *http.Request
+}
+
+func (w *reportingWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+func (rep *errorReporter) report(r *http.Request, err any, frames []sentryFrame) {
+	if rep.sampleRate < 1 && mrand.Float64() >= rep.sampleRate {
+		return
+	}
+	event := rep.buildEvent(r, err, frames)
+	select {
+	case rep.pending <- struct{}{}:
+	default:
+		Logger.Warn("error reporting: too many pending reports, event dropped", "event_id", event.EventID)
+		return
+	}
+	go func() {
+		defer func() { <-rep.pending }()
+		if sendErr := rep.send(event); sendErr != nil {
+			Logger.Warn("error reporting: failed to send event", "event_id", event.EventID, "error", sendErr)
+		}
+	}()
+}
+
+type sentryEvent struct {
+	EventID     string            `json:"event_id"`
+	Timestamp   string            `json:"timestamp"`
+	Level       string            `json:"level"`
+	Platform    string            `json:"platform"`
+	Logger      string            `json:"logger"`
+	ServerName  string            `json:"server_name,omitempty"`
+	Environment string            `json:"environment,omitempty"`
+	Release     string            `json:"release,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	Exception   struct {
+		Values []sentryException `json:"values"`
+	} `json:"exception"`
+	Request *sentryRequest `json:"request,omitempty"`
+}
+
+type sentryException struct {
+	Type       string `json:"type"`
+	Value      string `json:"value"`
+	Stacktrace struct {
+		Frames []sentryFrame `json:"frames"`
+	} `json:"stacktrace"`
+}
+
+type sentryFrame struct {
+	Function string `json:"function"`
+	Module   string `json:"module,omitempty"`
+	Filename string `json:"filename"`
+	Lineno   int    `json:"lineno"`
+	InApp    bool   `json:"in_app"`
+}
+
+type sentryRequest struct {
+	Method      string            `json:"method"`
+	URL         string            `json:"url"`
+	QueryString string            `json:"query_string,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+}
+
+func (rep *errorReporter) buildEvent(r *http.Request, err any, frames []sentryFrame) sentryEvent {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	hostname, _ := os.Hostname()
+
+	event := sentryEvent{
+		EventID:     hex.EncodeToString(id),
+		Timestamp:   time.Now().UTC().Format(time.RFC3339Nano),
+		Level:       "error",
+		Platform:    "go",
+		Logger:      "atombase",
+		ServerName:  hostname,
+		Environment: rep.environment,
+		Release:     rep.release,
+	}
+	exception := sentryException{Type: fmt.Sprintf("%T", err), Value: scrubPII(fmt.Sprint(err))}
+	exception.Stacktrace.Frames = frames
+	event.Exception.Values = []sentryException{exception}
+
+	if r != nil {
+		event.Tags = map[string]string{"api": detectAPIType(r.URL.Path)}
+		if requestID := r.Header.Get("X-Request-ID"); requestID != "" {
+			event.Tags["request_id"] = requestID
+		}
+		event.Request = &sentryRequest{
+			Method:      r.Method,
+			URL:         r.URL.Path,
+			QueryString: scrubQuery(r.URL.Query()),
+			Headers:     scrubHeaders(r.Header),
+		}
+	}
+	return event
+}
+
+func (rep *errorReporter) send(event sentryEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, rep.storeURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Sentry-Auth", rep.authHeader)
+	resp, err := rep.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("store endpoint returned %s", resp.Status)
+	}
+	return nil
+}
+
+// callerFrames returns the current stack, outermost call first as Sentry expects.
+func callerFrames(skip int) []sentryFrame {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(skip, pcs)
+	iter := runtime.CallersFrames(pcs[:n])
+	var frames []sentryFrame
+	for {
+		frame, more := iter.Next()
+		module, function := splitFunctionName(frame.Function)
+		frames = append(frames, sentryFrame{
+			Function: function,
+			Module:   module,
+			Filename: frame.File,
+			Lineno:   frame.Line,
+			InApp:    strings.HasPrefix(module, "github.com/atombasedev/atombase"),
+		})
+		if !more {
+			break
+		}
+	}
+	for i, j := 0, len(frames)-1; i < j; i, j = i+1, j-1 {
+		frames[i], frames[j] = frames[j], frames[i]
+	}
+	return frames
+}
+
+// splitFunctionName splits "github.com/x/y/pkg.(*T).Method" into its package
+// path and function name.
+func splitFunctionName(name string) (string, string) {
+	slash := strings.LastIndex(name, "/")
+	dot := strings.Index(name[slash+1:], ".")
+	if dot < 0 {
+		return "", name
+	}
+	return name[:slash+1+dot], name[slash+1+dot+1:]
+}
+
+// Request details are scrubbed before they leave the server: credentials and
+// cookies are never sent, sensitive query parameters are masked, and email
+// addresses in error messages are redacted.
+var (
+	scrubbedHeaders = map[string]bool{"Authorization": true, "Cookie": true, "Set-Cookie": true, "X-Api-Key": true, "Proxy-Authorization": true}
+	sensitiveParam  = regexp.MustCompile(`(?i)token|secret|password|key|code|session|email`)
+	emailPattern    = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+)
+
+const filtered = "[Filtered]"
+
+func scrubHeaders(h http.Header) map[string]string {
+	out := make(map[string]string, len(h))
+	for name, values := range h {
+		if scrubbedHeaders[http.CanonicalHeaderKey(name)] {
+			out[name] = filtered
+			continue
+		}
+		out[name] = scrubPII(strings.Join(values, ", "))
+	}
+	return out
+}
+
+func scrubQuery(q url.Values) string {
+	for name := range q {
+		if sensitiveParam.MatchString(name) {
+			q[name] = []string{filtered}
+		}
+	}
+	return scrubPII(q.Encode())
+}
+
+func scrubPII(s string) string {
+	return emailPattern.ReplaceAllString(s, filtered)
+}
@@ -0,0 +1,96 @@
+package tools
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestErrorReporting_PanicsAndInternalErrors(t *testing.T) {
+	events := make(chan sentryEvent, 4)
+	var auth string
+	store := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/42/store/" {
+			t.Errorf("unexpected store path %s", r.URL.Path)
+		}
+		auth = r.Header.Get("X-Sentry-Auth")
+		var event sentryEvent
+		_ = json.NewDecoder(r.Body).Decode(&event)
+		events <- event
+	}))
+	defer store.Close()
+
+	rep, err := newErrorReporter("http://public@" + strings.TrimPrefix(store.URL, "http://") + "/42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := reporter
+	reporter = rep
+	defer func() { reporter = old }()
+
+	receive := func() sentryEvent {
+		t.Helper()
+		select {
+		case event := <-events:
+			return event
+		case <-time.After(5 * time.Second):
+			t.Fatal("no event reported")
+			return sentryEvent{}
+		}
+	}
+
+	panicking := PanicRecoveryMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom for ann@example.com")
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/data/query/users?token=abc&select=id", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	panicking.ServeHTTP(httptest.NewRecorder(), req)
+
+	event := receive()
+	if !strings.Contains(auth, "sentry_key=public") {
+		t.Fatalf("unexpected auth header %q", auth)
+	}
+	exc := event.Exception.Values[0]
+	if exc.Value != "boom for [Filtered]" || len(exc.Stacktrace.Frames) == 0 {
+		t.Fatalf("unexpected exception: %#v", exc)
+	}
+	if event.Request == nil || event.Request.Headers["Authorization"] != filtered || strings.Contains(event.Request.QueryString, "abc") || !strings.Contains(event.Request.QueryString, "select=id") {
+		t.Fatalf("request context not scrubbed: %#v", event.Request)
+	}
+
+	failing := PanicRecoveryMiddleware(LoggingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		RespErr(w, errors.New("disk on fire"))
+	})))
+	failing.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/platform/databases", nil))
+	event = receive()
+	if event.Exception.Values[0].Value != "disk on fire" || event.Request == nil || event.Request.URL != "/platform/databases" || event.Tags["api"] != "platform" {
+		t.Fatalf("unexpected internal error event: %#v", event)
+	}
+
+	// Known errors are client mistakes, not reported.
+	RespErr(httptest.NewRecorder(), ErrTableNotFound)
+	select {
+	case event := <-events:
+		t.Fatalf("unexpected report for a known error: %#v", event)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestNewErrorReporter_ParsesDSN(t *testing.T) {
+	rep, err := newErrorReporter("https://key@sentry.example.com/prefix/7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.storeURL != "https://sentry.example.com/prefix/api/7/store/" {
+		t.Fatalf("unexpected store URL %s", rep.storeURL)
+	}
+	for _, dsn := range []string{"https://sentry.example.com/7", "https://key@sentry.example.com/", "::"} {
+		if _, err := newErrorReporter(dsn); err == nil {
+			t.Fatalf("expected %q to be rejected", dsn)
+		}
+	}
+}
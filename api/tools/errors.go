@@ -4,6 +4,7 @@ package tools
 import (
 	"errors"
 	"fmt"
+	"time"
 )
 
 // Error codes for SDK consumption.
@@ -30,10 +31,41 @@ const (
 	CodeUniqueViolation     = "UNIQUE_VIOLATION"
 	CodeForeignKeyViolation = "FOREIGN_KEY_VIOLATION"
 	CodeNotNullViolation    = "NOT_NULL_VIOLATION"
+	CodeCheckViolation      = "CHECK_VIOLATION"
 	CodeNoFTSIndex          = "NO_FTS_INDEX"
 	CodeBatchTooLarge       = "BATCH_TOO_LARGE"
 	CodeMissingDatabase     = "MISSING_DATABASE"
+	CodeWritesPaused        = "WRITES_PAUSED"
+	CodeResidencyViolation  = "RESIDENCY_VIOLATION"
+	CodeQueryNotAllowed     = "QUERY_NOT_ALLOWED"
+	CodeQueryTooComplex     = "QUERY_TOO_COMPLEX"
+	CodeQueryBudgetExceeded = "QUERY_BUDGET_EXCEEDED"
+	CodeQueryInterrupted    = "QUERY_INTERRUPTED"
+	CodeFullScan            = "FULL_SCAN"
+	CodeTooManyConcurrent   = "TOO_MANY_CONCURRENT_REQUESTS"
+	CodeRateLimited         = "RATE_LIMITED"
+	CodeReadOnlyRequest     = "READ_ONLY_REQUEST"
+	CodeInvalidCursor       = "INVALID_CURSOR"
 	CodeInvalidName         = "INVALID_NAME"
+	CodeExportNotFound      = "EXPORT_NOT_FOUND"
+	CodeSavedQueryNotFound  = "SAVED_QUERY_NOT_FOUND"
+	CodeReportNotFound      = "REPORT_NOT_FOUND"
+	CodeFunctionNotFound    = "FUNCTION_NOT_FOUND"
+	CodeReadOnlyView        = "READ_ONLY_VIEW"
+	CodeRowNotFound         = "ROW_NOT_FOUND"
+	CodeBlobTooLarge        = "BLOB_TOO_LARGE"
+	CodeAuthLockedOut       = "AUTH_LOCKED_OUT"
+	CodeCaptchaFailed       = "CAPTCHA_FAILED"
+	CodeIdentityConflict    = "IDENTITY_CONFLICT"
+	CodeObjectNotFound      = "OBJECT_NOT_FOUND"
+	CodeObjectTooLarge      = "OBJECT_TOO_LARGE"
+	CodeSignedURLInvalid    = "SIGNED_URL_INVALID"
+	CodePresenceNotFound    = "PRESENCE_NOT_FOUND"
+	CodePresenceForbidden   = "PRESENCE_FORBIDDEN"
+	CodePresenceFull        = "PRESENCE_CHANNEL_FULL"
+	CodeBroadcastNotFound   = "BROADCAST_NOT_FOUND"
+	CodeBroadcastForbidden  = "BROADCAST_FORBIDDEN"
+	CodeSyncNotEnabled      = "SYNC_NOT_ENABLED"
 	CodeInternalError       = "INTERNAL_ERROR"
 
 	// Platform API error codes
@@ -49,6 +81,24 @@ const (
 	CodeVersionNotFound          = "VERSION_NOT_FOUND"
 	CodeInvalidMigration         = "INVALID_MIGRATION"
 	CodeValidationFailed         = "VALIDATION_FAILED"
+	CodeSmokeTestRunning         = "SMOKE_TEST_RUNNING"
+	CodeJWTKeyNotFound           = "JWT_KEY_NOT_FOUND"
+	CodeAPIKeyNotFound           = "API_KEY_NOT_FOUND"
+	CodeAPIKeyScope              = "API_KEY_SCOPE"
+	CodeWebhookNotFound          = "WEBHOOK_NOT_FOUND"
+	CodeBackupNotFound           = "BACKUP_NOT_FOUND"
+	CodeActiveQueryNotFound      = "ACTIVE_QUERY_NOT_FOUND"
+	CodeChecksumMismatch         = "CHECKSUM_MISMATCH"
+	CodeQuotaExceeded            = "QUOTA_EXCEEDED"
+	CodeOrgNotFound              = "ORG_NOT_FOUND"
+	CodeOrgExists                = "ORG_EXISTS"
+	CodeOrgNotEmpty              = "ORG_NOT_EMPTY"
+	CodeOrgMemberNotFound        = "ORG_MEMBER_NOT_FOUND"
+	CodeOrgInvitationNotFound    = "ORG_INVITATION_NOT_FOUND"
+	CodeServiceAccountNotFound   = "SERVICE_ACCOUNT_NOT_FOUND"
+	CodeServiceAccountExists     = "SERVICE_ACCOUNT_EXISTS"
+	CodeAdminLoginFailed         = "ADMIN_LOGIN_FAILED"
+	CodeCSRFTokenInvalid         = "CSRF_TOKEN_INVALID"
 
 	// Turso-specific error codes
 	CodeTursoConfigMissing = "TURSO_CONFIG_MISSING"
@@ -69,33 +119,69 @@ type APIError struct {
 	Code    string `json:"code"`
 	Message string `json:"message"`
 	Hint    string `json:"hint,omitempty"`
+
+	// Set for constraint violations.
+	Table      string   `json:"table,omitempty"`
+	Columns    []string `json:"columns,omitempty"`
+	Constraint string   `json:"constraint,omitempty"`
 }
 
 // Sentinel errors for common failure conditions.
 var (
-	ErrTableNotFound      = errors.New("table not found in schema")
-	ErrColumnNotFound     = errors.New("column not found in table")
-	ErrInvalidOperator    = errors.New("invalid filter operator")
-	ErrInvalidColumnType  = errors.New("invalid column type")
-	ErrReservedTable      = errors.New("cannot query reserved table")
-	ErrMissingWhereClause = errors.New("DELETE requires a WHERE clause")
-	ErrMissingOperation   = errors.New("No query operation specified")
-	ErrInvalidOnConflict  = errors.New("Invalid on-conflict specified")
-	ErrDatabaseNotFound   = errors.New("database not found")
-	ErrDatabaseOutOfSync  = errors.New("database out of sync")
-	ErrNoRelationship     = errors.New("no relationship exists between tables")
-	ErrInvalidIdentifier  = errors.New("invalid identifier")
-	ErrEmptyIdentifier    = errors.New("identifier cannot be empty")
-	ErrIdentifierTooLong  = errors.New("identifier exceeds maximum length")
-	ErrInvalidCharacter   = errors.New("identifier contains invalid characters")
-	ErrNotDDLQuery        = errors.New("only DDL statements are allowed (CREATE, ALTER, DROP)")
-	ErrQueryTooDeep       = errors.New("query nesting exceeds maximum depth")
-	ErrNoFTSIndex         = errors.New("no FTS index exists for table")
-	ErrDefinitionNotFound = errors.New("definition not found")
-	ErrDefinitionInUse    = errors.New("definition is in use by one or more databases")
-	ErrInArrayTooLarge    = errors.New("IN array exceeds maximum size")
-	ErrBatchTooLarge      = errors.New("batch exceeds maximum number of operations")
-	ErrMissingDatabase    = errors.New("Database header is required")
+	ErrTableNotFound             = errors.New("table not found in schema")
+	ErrColumnNotFound            = errors.New("column not found in table")
+	ErrInvalidOperator           = errors.New("invalid filter operator")
+	ErrInvalidColumnType         = errors.New("invalid column type")
+	ErrReservedTable             = errors.New("cannot query reserved table")
+	ErrMissingWhereClause        = errors.New("DELETE requires a WHERE clause")
+	ErrMissingOperation          = errors.New("No query operation specified")
+	ErrInvalidOnConflict         = errors.New("Invalid on-conflict specified")
+	ErrDatabaseNotFound          = errors.New("database not found")
+	ErrDatabaseOutOfSync         = errors.New("database out of sync")
+	ErrNoRelationship            = errors.New("no relationship exists between tables")
+	ErrInvalidIdentifier         = errors.New("invalid identifier")
+	ErrEmptyIdentifier           = errors.New("identifier cannot be empty")
+	ErrIdentifierTooLong         = errors.New("identifier exceeds maximum length")
+	ErrInvalidCharacter          = errors.New("identifier contains invalid characters")
+	ErrNotDDLQuery               = errors.New("only DDL statements are allowed (CREATE, ALTER, DROP)")
+	ErrQueryTooDeep              = errors.New("query nesting exceeds maximum depth")
+	ErrNoFTSIndex                = errors.New("no FTS index exists for table")
+	ErrDefinitionNotFound        = errors.New("definition not found")
+	ErrDefinitionInUse           = errors.New("definition is in use by one or more databases")
+	ErrInArrayTooLarge           = errors.New("IN array exceeds maximum size")
+	ErrBatchTooLarge             = errors.New("batch exceeds maximum number of operations")
+	ErrMissingDatabase           = errors.New("Database header is required")
+	ErrWritesPaused              = errors.New("writes are paused while the tenant moves between databases")
+	ErrResidencyViolation        = errors.New("placement violates data residency rules")
+	ErrQueryNotAllowed           = errors.New("query shape is not in the allowlist")
+	ErrQueryTooComplex           = errors.New("query is too complex")
+	ErrQueryBudgetExceeded       = errors.New("query cost budget exceeded")
+	ErrQueryInterrupted          = errors.New("query was interrupted by an operator")
+	ErrFullScan                  = errors.New("filter scans a large table without an index")
+	ErrTooManyConcurrentRequests = errors.New("too many concurrent requests")
+	ErrRateLimited               = errors.New("rate limit exceeded")
+	ErrReadOnlyRequest           = errors.New("request is read-only")
+	ErrInvalidCursor             = errors.New("invalid pagination cursor")
+	ErrValidationFailed          = errors.New("request validation failed")
+	ErrExportNotFound            = errors.New("export not found")
+	ErrSavedQueryNotFound        = errors.New("saved query not found")
+	ErrReportNotFound            = errors.New("report not found")
+	ErrFunctionNotFound          = errors.New("function not found")
+	ErrReadOnlyView              = errors.New("views are read-only")
+	ErrRowNotFound               = errors.New("row not found")
+	ErrBlobTooLarge              = errors.New("blob exceeds the maximum size")
+	ErrAuthLockedOut             = errors.New("too many sign-in attempts")
+	ErrCaptchaFailed             = errors.New("captcha verification failed")
+	ErrIdentityConflict          = errors.New("sign-in account conflict")
+	ErrObjectNotFound            = errors.New("object not found")
+	ErrObjectTooLarge            = errors.New("object exceeds the maximum size")
+	ErrSignedURLInvalid          = errors.New("signed url is invalid or expired")
+	ErrPresenceNotFound          = errors.New("presence channel not found")
+	ErrPresenceForbidden         = errors.New("not allowed to join this presence channel")
+	ErrPresenceFull              = errors.New("presence channel is full")
+	ErrBroadcastNotFound         = errors.New("broadcast channel not found")
+	ErrBroadcastForbidden        = errors.New("not allowed to use this broadcast channel")
+	ErrSyncNotEnabled            = errors.New("table does not log changes for sync")
 
 	// Platform API errors
 	ErrInvalidJSON              = errors.New("invalid request body")
@@ -108,6 +194,25 @@ var (
 	ErrMigrationNotFound        = errors.New("migration not found")
 	ErrVersionNotFound          = errors.New("version not found")
 	ErrInvalidMigration         = errors.New("invalid migration")
+	ErrSmokeTestRunning         = errors.New("a smoke test is already running")
+	ErrJWTKeyNotFound           = errors.New("signing key not found")
+	ErrAPIKeyNotFound           = errors.New("api key not found")
+	ErrAPIKeyScope              = errors.New("api key scope does not allow this operation")
+	ErrWebhookNotFound          = errors.New("webhook not found")
+	ErrBackupNotFound           = errors.New("backup not found")
+	ErrActiveQueryNotFound      = errors.New("query is not running on this server")
+	ErrChecksumMismatch         = errors.New("fetched document does not match its pinned sha256")
+	ErrPrivateAddress           = errors.New("address is not public")
+	ErrQuotaExceeded            = errors.New("quota exceeded")
+	ErrOrgNotFound              = errors.New("organization not found")
+	ErrOrgExists                = errors.New("organization already exists")
+	ErrOrgNotEmpty              = errors.New("organization still owns definitions")
+	ErrOrgMemberNotFound        = errors.New("organization member not found")
+	ErrOrgInvitationNotFound    = errors.New("invitation not found or expired")
+	ErrServiceAccountNotFound   = errors.New("service account not found")
+	ErrServiceAccountExists     = errors.New("public key is already registered to a service account")
+	ErrAdminLoginFailed         = errors.New("admin login failed")
+	ErrCSRFTokenInvalid         = errors.New("missing or invalid CSRF token")
 )
 
 // InvalidTypeErr returns an error indicating an invalid column type was specified.
@@ -152,3 +257,13 @@ func InvalidMigrationErr(msg string) error {
 func VersionNotFoundErr(version int) error {
 	return fmt.Errorf("%w: version %d", ErrVersionNotFound, version)
 }
+
+// RetryAfterError is an error the client may retry once Wait has passed.
+// RespErr sends Wait as the Retry-After header.
+type RetryAfterError struct {
+	Err  error
+	Wait time.Duration
+}
+
+func (e *RetryAfterError) Error() string { return e.Err.Error() }
+func (e *RetryAfterError) Unwrap() error { return e.Err }
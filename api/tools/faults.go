@@ -0,0 +1,27 @@
+package tools
+
+// Fault injection points. Faults are only injected in binaries built with the
+// faults build tag; otherwise InjectFault always returns nil.
+const (
+	FaultTursoAPI           = "turso.api"           // Turso platform API and pipeline requests
+	FaultSQLiteExec         = "sqlite.exec"         // Data API writes, before the lock retry loop checks the error
+	FaultMigrationStatement = "migration.statement" // Each statement of a lazy tenant migration
+)
+
+// Fault kinds.
+const (
+	FaultKindError   = "error"   // A generic failure
+	FaultKindBusy    = "busy"    // A SQLite "database is locked" error, which writes retry
+	FaultKindTimeout = "timeout" // A timeout, which migrations treat as retryable
+)
+
+// Fault describes a failure or delay to inject at a point.
+type Fault struct {
+	Point       string  `json:"point"`
+	Kind        string  `json:"kind,omitempty"`        // Empty to only delay
+	DelayMs     int     `json:"delayMs,omitempty"`     // Added before the call, whether or not it fails
+	Probability float64 `json:"probability,omitempty"` // Chance a hit fires, 0 meaning always
+	Skip        int     `json:"skip,omitempty"`        // Hits let through before the fault starts firing
+	Count       int     `json:"count,omitempty"`       // Times the fault fires, 0 meaning unlimited
+	Fired       int     `json:"fired"`                 // Times the fault has fired so far
+}
@@ -0,0 +1,25 @@
+//go:build !faults
+
+package tools
+
+import (
+	"context"
+	"errors"
+)
+
+// FaultInjectionEnabled reports whether this binary was built with the faults tag.
+const FaultInjectionEnabled = false
+
+var errFaultsNotBuilt = errors.New("fault injection requires a build with -tags faults")
+
+// InjectFault does nothing in normal builds.
+func InjectFault(ctx context.Context, point string) error { return nil }
+
+// SetFaults fails in normal builds.
+func SetFaults(faults []Fault) error { return errFaultsNotBuilt }
+
+// ListFaults returns nothing in normal builds.
+func ListFaults() []Fault { return nil }
+
+// ClearFaults does nothing in normal builds.
+func ClearFaults() {}
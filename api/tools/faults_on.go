@@ -0,0 +1,109 @@
+//go:build faults
+
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// FaultInjectionEnabled reports whether this binary was built with the faults tag.
+const FaultInjectionEnabled = true
+
+var faults = struct {
+	sync.Mutex
+	active []*Fault
+	hits   map[string]int
+}{hits: map[string]int{}}
+
+// SetFaults replaces the active faults.
+func SetFaults(list []Fault) error {
+	active := make([]*Fault, 0, len(list))
+	for _, f := range list {
+		switch f.Point {
+		case FaultTursoAPI, FaultSQLiteExec, FaultMigrationStatement:
+		default:
+			return InvalidRequestErr(fmt.Sprintf("unknown fault point %q", f.Point))
+		}
+		switch f.Kind {
+		case "", FaultKindError, FaultKindBusy, FaultKindTimeout:
+		default:
+			return InvalidRequestErr(fmt.Sprintf("unknown fault kind %q", f.Kind))
+		}
+		if f.Kind == "" && f.DelayMs <= 0 {
+			return InvalidRequestErr(fmt.Sprintf("fault at %s needs a kind or a delay", f.Point))
+		}
+		if f.DelayMs < 0 || f.Skip < 0 || f.Count < 0 || f.Probability < 0 || f.Probability > 1 {
+			return InvalidRequestErr(fmt.Sprintf("fault at %s has out-of-range settings", f.Point))
+		}
+		f.Fired = 0
+		active = append(active, &f)
+	}
+	faults.Lock()
+	faults.active = active
+	faults.hits = map[string]int{}
+	faults.Unlock()
+	return nil
+}
+
+// ListFaults returns the active faults with how often each has fired.
+func ListFaults() []Fault {
+	faults.Lock()
+	defer faults.Unlock()
+	out := make([]Fault, 0, len(faults.active))
+	for _, f := range faults.active {
+		out = append(out, *f)
+	}
+	return out
+}
+
+// ClearFaults removes every fault.
+func ClearFaults() {
+	_ = SetFaults(nil)
+}
+
+// InjectFault applies the first active fault at point that fires: it waits for
+// the fault's delay and returns its error, if any.
+func InjectFault(ctx context.Context, point string) error {
+	faults.Lock()
+	faults.hits[point]++
+	hit := faults.hits[point]
+	var fired *Fault
+	for _, f := range faults.active {
+		if f.Point != point || hit <= f.Skip || (f.Count > 0 && f.Fired >= f.Count) {
+			continue
+		}
+		if f.Probability > 0 && rand.Float64() >= f.Probability {
+			continue
+		}
+		f.Fired++
+		snapshot := *f
+		fired = &snapshot
+		break
+	}
+	faults.Unlock()
+	if fired == nil {
+		return nil
+	}
+
+	if fired.DelayMs > 0 {
+		select {
+		case <-time.After(time.Duration(fired.DelayMs) * time.Millisecond):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	switch fired.Kind {
+	case FaultKindError:
+		return fmt.Errorf("injected fault at %s", point)
+	case FaultKindBusy:
+		return errors.New("database is locked (injected fault)")
+	case FaultKindTimeout:
+		return fmt.Errorf("injected timeout at %s", point)
+	}
+	return nil
+}
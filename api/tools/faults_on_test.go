@@ -0,0 +1,45 @@
+//go:build faults
+
+package tools
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestInjectFault_SkipCountAndKinds(t *testing.T) {
+	defer ClearFaults()
+	if err := SetFaults([]Fault{
+		{Point: FaultMigrationStatement, Kind: FaultKindError, Skip: 1, Count: 1},
+		{Point: FaultSQLiteExec, Kind: FaultKindBusy},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if err := InjectFault(ctx, FaultMigrationStatement); err != nil {
+		t.Fatalf("expected the first hit to be skipped, got %v", err)
+	}
+	if err := InjectFault(ctx, FaultMigrationStatement); err == nil {
+		t.Fatal("expected the second hit to fail")
+	}
+	if err := InjectFault(ctx, FaultMigrationStatement); err != nil {
+		t.Fatalf("expected the fault to stop after its count, got %v", err)
+	}
+	if err := InjectFault(ctx, FaultSQLiteExec); err == nil || !strings.Contains(err.Error(), "database is locked") {
+		t.Fatalf("expected a busy error, got %v", err)
+	}
+	if err := InjectFault(ctx, FaultTursoAPI); err != nil {
+		t.Fatalf("expected no fault at an unconfigured point, got %v", err)
+	}
+	if listed := ListFaults(); listed[0].Fired != 1 || listed[1].Fired != 1 {
+		t.Fatalf("unexpected fired counts: %#v", listed)
+	}
+
+	err := SetFaults([]Fault{{Point: "nowhere", Kind: FaultKindError}})
+	if status, _ := BuildAPIError(err); status != http.StatusBadRequest {
+		t.Fatalf("expected an unknown point to be rejected, got %v", err)
+	}
+}
@@ -2,11 +2,14 @@ package tools
 
 import (
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/atombasedev/atombase/config"
 )
@@ -194,3 +197,62 @@ func TestDecodeJSON(t *testing.T) {
 		t.Fatal("expected decode error")
 	}
 }
+
+func TestPublicAddress(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"93.184.216.34":    true,
+		"2606:4700::1111":  true,
+		"127.0.0.1":        false,
+		"10.1.2.3":         false,
+		"172.16.0.1":       false,
+		"192.168.1.1":      false,
+		"169.254.169.254":  false,
+		"100.64.0.1":       false,
+		"0.0.0.0":          false,
+		"224.0.0.1":        false,
+		"::1":              false,
+		"fd00::1":          false,
+		"fe80::1":          false,
+		"::ffff:127.0.0.1": false,
+		"64:ff9b::a00:1":   false,
+	} {
+		if got := PublicAddress(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("PublicAddress(%s) = %v, want %v", addr, got, want)
+		}
+	}
+}
+
+func TestPublicHTTPClient_RefusesPrivateAddresses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+	client := PublicHTTPClient(5 * time.Second)
+
+	if _, err := client.Get(srv.URL); !errors.Is(err, ErrPrivateAddress) {
+		t.Fatalf("expected a loopback server to be refused, got %v", err)
+	}
+	// A name is checked once resolved.
+	if _, err := client.Get(strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)); !errors.Is(err, ErrPrivateAddress) {
+		t.Fatalf("expected localhost to be refused, got %v", err)
+	}
+}
+
+func TestCheckPublicURL(t *testing.T) {
+	for raw, wantErr := range map[string]bool{
+		"https://hooks.example.com/atombase": false,
+		"https://93.184.216.34/in":           false,
+		"http://hooks.example.com":           true,
+		"ftp://hooks.example.com":            true,
+		"https://":                           true,
+		"https://localhost:8443":             true,
+		"https://api.localhost.":             true,
+		"https://127.0.0.1/in":               true,
+		"https://[::1]/in":                   true,
+		"https://169.254.169.254/latest":     true,
+	} {
+		if err := CheckPublicURL(raw); (err != nil) != wantErr {
+			t.Errorf("CheckPublicURL(%q) = %v, want error %v", raw, err, wantErr)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package tools
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// JWT signing algorithms accepted for Data API tokens.
+const (
+	JWTAlgHS256 = "HS256"
+	JWTAlgRS256 = "RS256"
+)
+
+// MinJWTSecretLength is the shortest HS256 secret accepted, in bytes.
+const MinJWTSecretLength = 32
+
+// jwtLeeway absorbs clock skew between the token issuer and this server.
+const jwtLeeway = 30 * time.Second
+
+// JWTHeader is the decoded header of a JSON Web Token.
+type JWTHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Typ string `json:"typ"`
+}
+
+// IsJWT reports whether a bearer token has the three segments of a JWT.
+// Session tokens have two.
+func IsJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// ParseJWTHeader decodes a token's header without verifying the token, so the
+// key it names can be looked up.
+func ParseJWTHeader(token string) (JWTHeader, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return JWTHeader{}, UnauthorizedErr("malformed token")
+	}
+	var header JWTHeader
+	if err := decodeJWTSegment(parts[0], &header); err != nil {
+		return JWTHeader{}, UnauthorizedErr("malformed token header")
+	}
+	return header, nil
+}
+
+// ValidateJWTKey checks a signing key before it is stored: an HS256 secret of
+// at least MinJWTSecretLength bytes, or an RS256 public key in PEM.
+func ValidateJWTKey(alg string, key []byte) error {
+	switch alg {
+	case JWTAlgHS256:
+		if len(key) < MinJWTSecretLength {
+			return fmt.Errorf("HS256 secrets must be at least %d bytes", MinJWTSecretLength)
+		}
+		return nil
+	case JWTAlgRS256:
+		_, err := parseRSAPublicKey(key)
+		return err
+	default:
+		return fmt.Errorf("unsupported algorithm %q, use %s or %s", alg, JWTAlgHS256, JWTAlgRS256)
+	}
+}
+
+// VerifyJWT checks a token's signature with key, signed with alg, and its exp
+// and nbf claims, and returns its claims. The header's alg must match alg, so
+// a token cannot pick a weaker check than its key was registered for.
+func VerifyJWT(token, alg string, key []byte, now time.Time) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, UnauthorizedErr("malformed token")
+	}
+	header, err := ParseJWTHeader(token)
+	if err != nil {
+		return nil, err
+	}
+	if header.Alg != alg {
+		return nil, UnauthorizedErr(fmt.Sprintf("token is signed with %q, its key expects %s", header.Alg, alg))
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, UnauthorizedErr("malformed token signature")
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+
+	switch alg {
+	case JWTAlgHS256:
+		mac := hmac.New(sha256.New, key)
+		mac.Write(signed)
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return nil, UnauthorizedErr("invalid token signature")
+		}
+	case JWTAlgRS256:
+		pub, err := parseRSAPublicKey(key)
+		if err != nil {
+			return nil, err
+		}
+		digest := sha256.Sum256(signed)
+		if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature); err != nil {
+			return nil, UnauthorizedErr("invalid token signature")
+		}
+	default:
+		return nil, UnauthorizedErr(fmt.Sprintf("unsupported algorithm %q", alg))
+	}
+
+	var claims map[string]any
+	if err := decodeJWTSegment(parts[1], &claims); err != nil {
+		return nil, UnauthorizedErr("malformed token claims")
+	}
+	if exp, ok, err := numericDate(claims, "exp"); err != nil {
+		return nil, err
+	} else if ok && !now.Before(exp.Add(jwtLeeway)) {
+		return nil, UnauthorizedErr("token has expired")
+	}
+	if nbf, ok, err := numericDate(claims, "nbf"); err != nil {
+		return nil, err
+	} else if ok && now.Add(jwtLeeway).Before(nbf) {
+		return nil, UnauthorizedErr("token is not valid yet")
+	}
+	return claims, nil
+}
+
+func decodeJWTSegment(segment string, target any) error {
+	raw, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, target)
+}
+
+// numericDate reads a claim holding seconds since the epoch.
+func numericDate(claims map[string]any, name string) (time.Time, bool, error) {
+	raw, ok := claims[name]
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	seconds, ok := raw.(float64)
+	if !ok || math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+		return time.Time{}, false, UnauthorizedErr(fmt.Sprintf("token %s claim must be a number", name))
+	}
+	whole, frac := math.Modf(seconds)
+	return time.Unix(int64(whole), int64(frac*1e9)), true, nil
+}
+
+// parseRSAPublicKey accepts PKIX ("PUBLIC KEY") and PKCS #1 ("RSA PUBLIC KEY") PEM blocks.
+func parseRSAPublicKey(key []byte) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode(key)
+	if block == nil {
+		return nil, errors.New("RS256 keys must be PEM-encoded public keys")
+	}
+	switch block.Type {
+	case "PUBLIC KEY":
+		parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		pub, ok := parsed.(*rsa.PublicKey)
+		if !ok {
+			return nil, errors.New("RS256 keys must be RSA public keys")
+		}
+		return pub, nil
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unexpected PEM block %q, want a public key", block.Type)
+	}
+}
@@ -0,0 +1,135 @@
+package tools
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func signTestJWT(t *testing.T, header, claims map[string]any, sign func(signed []byte) []byte) string {
+	t.Helper()
+	h, _ := json.Marshal(header)
+	c, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sign([]byte(signed)))
+}
+
+func TestVerifyJWT_HS256(t *testing.T) {
+	secret := []byte(strings.Repeat("s", MinJWTSecretLength))
+	hs := func(signed []byte) []byte {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(signed)
+		return mac.Sum(nil)
+	}
+	now := time.Unix(1_700_000_000, 0)
+	header := map[string]any{"alg": "HS256", "kid": "k1"}
+
+	token := signTestJWT(t, header, map[string]any{"sub": "u1", "exp": now.Unix() + 60, "nbf": now.Unix() - 60, "plan": "pro"}, hs)
+	if !IsJWT(token) {
+		t.Fatal("expected token to look like a JWT")
+	}
+	h, err := ParseJWTHeader(token)
+	if err != nil || h.Kid != "k1" {
+		t.Fatalf("header = %+v, %v", h, err)
+	}
+	claims, err := VerifyJWT(token, JWTAlgHS256, secret, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims["sub"] != "u1" || claims["plan"] != "pro" {
+		t.Errorf("claims = %v", claims)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		alg   string
+		key   []byte
+	}{
+		{"wrong secret", token, JWTAlgHS256, []byte(strings.Repeat("x", MinJWTSecretLength))},
+		{"algorithm mismatch", token, JWTAlgRS256, secret},
+		{"expired", signTestJWT(t, header, map[string]any{"sub": "u1", "exp": now.Unix() - 60}, hs), JWTAlgHS256, secret},
+		{"not yet valid", signTestJWT(t, header, map[string]any{"sub": "u1", "nbf": now.Unix() + 120}, hs), JWTAlgHS256, secret},
+		{"exp not a number", signTestJWT(t, header, map[string]any{"sub": "u1", "exp": "soon"}, hs), JWTAlgHS256, secret},
+		{"tampered claims", token[:strings.Index(token, ".")+1] + base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"admin"}`)) + token[strings.LastIndex(token, "."):], JWTAlgHS256, secret},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := VerifyJWT(tt.token, tt.alg, tt.key, now); !errors.Is(err, ErrUnauthorized) {
+				t.Fatalf("expected unauthorized, got %v", err)
+			}
+		})
+	}
+
+	// Expiry within the leeway still passes.
+	skewed := signTestJWT(t, header, map[string]any{"sub": "u1", "exp": now.Unix() - 5}, hs)
+	if _, err := VerifyJWT(skewed, JWTAlgHS256, secret, now); err != nil {
+		t.Errorf("token expired within leeway: %v", err)
+	}
+}
+
+func TestVerifyJWT_RS256(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	if err := ValidateJWTKey(JWTAlgRS256, pub); err != nil {
+		t.Fatal(err)
+	}
+	pkcs1 := pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&priv.PublicKey)})
+
+	token := signTestJWT(t, map[string]any{"alg": "RS256", "kid": "k2"}, map[string]any{"sub": "u2"}, func(signed []byte) []byte {
+		digest := sha256.Sum256(signed)
+		sig, err := rsa.SignPKCS1v15(rand.Reader, priv, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sig
+	})
+	for _, key := range [][]byte{pub, pkcs1} {
+		claims, err := VerifyJWT(token, JWTAlgRS256, key, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if claims["sub"] != "u2" {
+			t.Errorf("claims = %v", claims)
+		}
+	}
+
+	// An RS256 public key must not verify an HS256 token using it as the secret.
+	forged := signTestJWT(t, map[string]any{"alg": "HS256", "kid": "k2"}, map[string]any{"sub": "admin"}, func(signed []byte) []byte {
+		mac := hmac.New(sha256.New, pub)
+		mac.Write(signed)
+		return mac.Sum(nil)
+	})
+	if _, err := VerifyJWT(forged, JWTAlgRS256, pub, time.Now()); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("expected forged token to be rejected, got %v", err)
+	}
+}
+
+func TestValidateJWTKey(t *testing.T) {
+	if err := ValidateJWTKey(JWTAlgHS256, []byte("short")); err == nil {
+		t.Error("expected short secret to be rejected")
+	}
+	if err := ValidateJWTKey(JWTAlgRS256, []byte("not pem")); err == nil {
+		t.Error("expected non-PEM key to be rejected")
+	}
+	if err := ValidateJWTKey("none", nil); err == nil {
+		t.Error("expected alg none to be rejected")
+	}
+}
@@ -0,0 +1,208 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/atombasedev/atombase/config"
+)
+
+// Log streams forwarded to the configured sink.
+const (
+	LogStreamActivity = "activity"
+	LogStreamAudit    = "audit"
+)
+
+// shipAttempts is how many times a batch is sent before it is dropped.
+const shipAttempts = 3
+
+// shipRetryDelay is the wait before the first retry of a failed batch; it
+// doubles with each further attempt.
+var shipRetryDelay = time.Second
+
+// LogEntry is one structured log line waiting to be shipped.
+type LogEntry struct {
+	Stream string
+	Time   time.Time
+	Line   []byte // JSON encoded record
+}
+
+// logSink delivers batches of entries to an external system.
+type logSink interface {
+	ship(ctx context.Context, entries []LogEntry) error
+}
+
+// logShipper queues entries and sends them to a sink in batches from a single
+// goroutine. The queue is bounded: while the sink is slow or down, entries that
+// do not fit are dropped and counted rather than blocking requests.
+type logShipper struct {
+	sink      logSink
+	queue     chan LogEntry
+	batchSize int
+	interval  time.Duration
+	dropped   atomic.Int64
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+var shipper atomic.Pointer[logShipper]
+
+// InitLogShipper starts forwarding activity and audit logs when a sink is configured.
+func InitLogShipper() error {
+	if config.Cfg.LogShipSink == "" {
+		return nil
+	}
+	sink, err := newLogSink(config.Cfg.LogShipSink)
+	if err != nil {
+		return err
+	}
+	startLogShipper(sink, config.Cfg.LogShipBatchSize, config.Cfg.LogShipBufferSize, time.Duration(config.Cfg.LogShipInterval)*time.Second)
+	return nil
+}
+
+func newLogSink(kind string) (logSink, error) {
+	if config.Cfg.LogShipURL == "" {
+		return nil, fmt.Errorf("ATOMICBASE_LOG_SHIP_URL is required for the %s log sink", kind)
+	}
+	switch kind {
+	case "syslog":
+		return newSyslogSink(config.Cfg.LogShipURL)
+	case "loki":
+		return &lokiSink{url: config.Cfg.LogShipURL, client: shipHTTPClient}, nil
+	case "s3":
+		if config.Cfg.LogShipS3AccessKey == "" || config.Cfg.LogShipS3SecretKey == "" {
+			return nil, fmt.Errorf("S3 log shipping requires ATOMICBASE_LOG_SHIP_S3_ACCESS_KEY and ATOMICBASE_LOG_SHIP_S3_SECRET_KEY")
+		}
+		return &s3Sink{
+			bucketURL: config.Cfg.LogShipURL,
+			region:    config.Cfg.LogShipS3Region,
+			accessKey: config.Cfg.LogShipS3AccessKey,
+			secretKey: config.Cfg.LogShipS3SecretKey,
+			client:    shipHTTPClient,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown log sink %q (expected syslog, loki or s3)", kind)
+	}
+}
+
+func startLogShipper(sink logSink, batchSize, bufferSize int, interval time.Duration) *logShipper {
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+	if bufferSize < batchSize {
+		bufferSize = batchSize
+	}
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	s := &logShipper{
+		sink:      sink,
+		queue:     make(chan LogEntry, bufferSize),
+		batchSize: batchSize,
+		interval:  interval,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	shipper.Store(s)
+	go s.run()
+	return s
+}
+
+// ShipLog queues a record for the log sink. It never blocks; without a sink it
+// does nothing.
+func ShipLog(stream string, record any) {
+	s := shipper.Load()
+	if s == nil {
+		return
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		Logger.Warn("log shipping: failed to encode record", "stream", stream, "error", err)
+		return
+	}
+	select {
+	case s.queue <- LogEntry{Stream: stream, Time: time.Now().UTC(), Line: line}:
+	default:
+		s.dropped.Add(1)
+	}
+}
+
+func (s *logShipper) run() {
+	defer close(s.done)
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	batch := make([]LogEntry, 0, s.batchSize)
+	flush := func() {
+		if n := s.dropped.Swap(0); n > 0 {
+			Logger.Warn("log shipping: queue full, entries dropped", "count", n)
+		}
+		if len(batch) == 0 {
+			return
+		}
+		s.send(batch)
+		batch = make([]LogEntry, 0, s.batchSize)
+	}
+	for {
+		select {
+		case entry := <-s.queue:
+			batch = append(batch, entry)
+			if len(batch) >= s.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-s.stop:
+			for {
+				select {
+				case entry := <-s.queue:
+					batch = append(batch, entry)
+					if len(batch) >= s.batchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// send delivers a batch, retrying with backoff. Entries keep queueing while it
+// waits, so a sink outage turns into dropped entries instead of unbounded memory.
+func (s *logShipper) send(batch []LogEntry) {
+	delay := shipRetryDelay
+	var err error
+	for attempt := 1; attempt <= shipAttempts; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		err = s.sink.ship(ctx, batch)
+		cancel()
+		if err == nil {
+			return
+		}
+		if attempt < shipAttempts {
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}
+	Logger.Error("log shipping: batch dropped", "entries", len(batch), "error", err)
+}
+
+// CloseLogShipper stops accepting entries and sends those still queued, giving
+// up when ctx is done.
+func CloseLogShipper(ctx context.Context) {
+	s := shipper.Swap(nil)
+	if s == nil {
+		return
+	}
+	close(s.stop)
+	select {
+	case <-s.done:
+	case <-ctx.Done():
+		Logger.Warn("log shipping: shutdown timed out with entries pending")
+	}
+}
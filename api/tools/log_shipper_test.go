@@ -0,0 +1,161 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordingSink struct {
+	mu      sync.Mutex
+	batches [][]LogEntry
+	fail    int
+	block   chan struct{}
+}
+
+func (s *recordingSink) ship(ctx context.Context, entries []LogEntry) error {
+	if s.block != nil {
+		<-s.block
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail > 0 {
+		s.fail--
+		return errors.New("sink unavailable")
+	}
+	s.batches = append(s.batches, append([]LogEntry(nil), entries...))
+	return nil
+}
+
+func (s *recordingSink) shipped() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, batch := range s.batches {
+		n += len(batch)
+	}
+	return n
+}
+
+func TestLogShipper_BatchesRetriesAndFlushesOnClose(t *testing.T) {
+	oldDelay := shipRetryDelay
+	defer func() { shipRetryDelay = oldDelay }()
+	shipRetryDelay = time.Millisecond
+
+	sink := &recordingSink{fail: 1}
+	startLogShipper(sink, 2, 10, time.Hour)
+	for i := 0; i < 5; i++ {
+		ShipLog(LogStreamAudit, map[string]int{"n": i})
+	}
+	CloseLogShipper(context.Background())
+
+	if got := sink.shipped(); got != 5 {
+		t.Fatalf("expected all 5 entries shipped after a retry, got %d", got)
+	}
+	if len(sink.batches[0]) != 2 {
+		t.Fatalf("expected full batches of 2, got %d", len(sink.batches[0]))
+	}
+	ShipLog(LogStreamAudit, "after close") // must not panic or block
+}
+
+func TestLogShipper_DropsWhenQueueIsFull(t *testing.T) {
+	sink := &recordingSink{block: make(chan struct{})}
+	s := startLogShipper(sink, 1, 1, time.Hour)
+	for i := 0; i < 10; i++ {
+		ShipLog(LogStreamActivity, i)
+	}
+	if s.dropped.Load() == 0 {
+		t.Fatal("expected entries to be dropped while the sink is blocked")
+	}
+	close(sink.block)
+	CloseLogShipper(context.Background())
+	if got := sink.shipped(); got == 0 || got >= 10 {
+		t.Fatalf("expected some but not all entries shipped, got %d", got)
+	}
+}
+
+func TestLokiSink_GroupsStreams(t *testing.T) {
+	var body struct {
+		Streams []lokiStream `json:"streams"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/loki/api/v1/push" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	now := time.Now()
+	sink := &lokiSink{url: server.URL + "/", client: server.Client()}
+	err := sink.ship(context.Background(), []LogEntry{
+		{Stream: LogStreamActivity, Time: now, Line: []byte(`{"a":1}`)},
+		{Stream: LogStreamAudit, Time: now, Line: []byte(`{"b":2}`)},
+		{Stream: LogStreamActivity, Time: now, Line: []byte(`{"a":3}`)},
+	})
+	if err != nil {
+		t.Fatalf("ship failed: %v", err)
+	}
+	if len(body.Streams) != 2 || body.Streams[0].Stream["stream"] != LogStreamActivity || len(body.Streams[0].Values) != 2 {
+		t.Fatalf("unexpected push body: %#v", body)
+	}
+}
+
+func TestS3Sink_SignsUploads(t *testing.T) {
+	var auth, key, payload string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth, key = r.Header.Get("Authorization"), r.URL.Path
+		raw, _ := io.ReadAll(r.Body)
+		payload = string(raw)
+	}))
+	defer server.Close()
+
+	sink := &s3Sink{bucketURL: server.URL + "/bucket/logs", region: "eu-west-1", accessKey: "AKID", secretKey: "secret", client: server.Client()}
+	if err := sink.ship(context.Background(), []LogEntry{{Stream: LogStreamAudit, Line: []byte(`{"x":1}`)}}); err != nil {
+		t.Fatalf("ship failed: %v", err)
+	}
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/") || !strings.Contains(auth, "/eu-west-1/s3/aws4_request") {
+		t.Fatalf("unexpected Authorization header %q", auth)
+	}
+	if !strings.HasPrefix(key, "/bucket/logs/audit/") || !strings.HasSuffix(key, ".ndjson") || payload != "{\"x\":1}\n" {
+		t.Fatalf("unexpected upload %s: %q", key, payload)
+	}
+}
+
+func TestSyslogSink_WritesRFC5424(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	sink, err := newSyslogSink("udp://" + conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.ship(context.Background(), []LogEntry{{Stream: LogStreamAudit, Time: time.Now(), Line: []byte(`{"x":1}`)}}); err != nil {
+		t.Fatalf("ship failed: %v", err)
+	}
+	buf := make([]byte, 1024)
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := string(buf[:n])
+	if !strings.HasPrefix(msg, "<134>1 ") || !strings.Contains(msg, " atombase ") || !strings.HasSuffix(msg, ` audit - {"x":1}`) {
+		t.Fatalf("unexpected syslog message %q", msg)
+	}
+	if _, err := newSyslogSink("http://example.com"); err == nil {
+		t.Fatal("expected a non-syslog URL to be rejected")
+	}
+}
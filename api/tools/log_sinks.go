@@ -0,0 +1,214 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var shipHTTPClient = &http.Client{Timeout: 30 * time.Second}
+
+// syslogSink writes RFC 5424 messages over UDP or TCP, one per entry. TCP
+// messages use octet-counting framing.
+type syslogSink struct {
+	network  string
+	address  string
+	hostname string
+}
+
+func newSyslogSink(rawURL string) (*syslogSink, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "udp" && u.Scheme != "tcp") || u.Host == "" {
+		return nil, fmt.Errorf("invalid syslog address %q (expected udp://host:port or tcp://host:port)", rawURL)
+	}
+	hostname, _ := os.Hostname()
+	if hostname == "" {
+		hostname = "-"
+	}
+	return &syslogSink{network: u.Scheme, address: u.Host, hostname: hostname}, nil
+}
+
+func (s *syslogSink) ship(ctx context.Context, entries []LogEntry) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, s.network, s.address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	for _, entry := range entries {
+		// Facility local0, severity informational.
+		msg := fmt.Sprintf("<134>1 %s %s atombase %d %s - %s",
+			entry.Time.Format(time.RFC3339Nano), s.hostname, os.Getpid(), entry.Stream, entry.Line)
+		if s.network == "tcp" {
+			msg = strconv.Itoa(len(msg)) + " " + msg
+		}
+		if _, err := io.WriteString(conn, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lokiSink pushes entries to Loki's push API, one stream per log stream.
+type lokiSink struct {
+	url    string
+	client *http.Client
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+func (s *lokiSink) ship(ctx context.Context, entries []LogEntry) error {
+	streams := map[string]*lokiStream{}
+	var order []string
+	for _, entry := range entries {
+		stream, ok := streams[entry.Stream]
+		if !ok {
+			stream = &lokiStream{Stream: map[string]string{"app": "atombase", "stream": entry.Stream}}
+			streams[entry.Stream] = stream
+			order = append(order, entry.Stream)
+		}
+		stream.Values = append(stream.Values, [2]string{strconv.FormatInt(entry.Time.UnixNano(), 10), string(entry.Line)})
+	}
+	payload := struct {
+		Streams []*lokiStream `json:"streams"`
+	}{}
+	for _, name := range order {
+		payload.Streams = append(payload.Streams, streams[name])
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(s.url, "/")+"/loki/api/v1/push", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return doShipRequest(s.client, req)
+}
+
+// s3Sink uploads each batch as a newline-delimited JSON object per stream,
+// keyed by stream and date, to an S3-compatible bucket.
+type s3Sink struct {
+	bucketURL string // e.g. https://my-bucket.s3.us-east-1.amazonaws.com/logs
+	region    string
+	accessKey string
+	secretKey string
+	client    *http.Client
+}
+
+func (s *s3Sink) ship(ctx context.Context, entries []LogEntry) error {
+	byStream := map[string]*bytes.Buffer{}
+	var order []string
+	for _, entry := range entries {
+		buf, ok := byStream[entry.Stream]
+		if !ok {
+			buf = &bytes.Buffer{}
+			byStream[entry.Stream] = buf
+			order = append(order, entry.Stream)
+		}
+		buf.Write(entry.Line)
+		buf.WriteByte('\n')
+	}
+	now := time.Now().UTC()
+	for _, stream := range order {
+		key := fmt.Sprintf("%s/%s/%d-%d.ndjson", stream, now.Format("2006/01/02"), now.UnixNano(), os.Getpid())
+		if err := s.put(ctx, key, byStream[stream].Bytes(), now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *s3Sink) put(ctx context.Context, key string, body []byte, now time.Time) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, strings.TrimRight(s.bucketURL, "/")+"/"+key, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	signS3Request(req, body, s.region, s.accessKey, s.secretKey, now)
+	return doShipRequest(s.client, req)
+}
+
+// signS3Request adds an AWS Signature Version 4 Authorization header for the S3 service.
+func signS3Request(req *http.Request, body []byte, region, accessKey, secretKey string, now time.Time) {
+	signS3RequestPayload(req, sha256Hex(body), region, accessKey, secretKey, now)
+}
+
+// signS3RequestPayload signs req for a payload hash, which may be
+// UNSIGNED-PAYLOAD for bodies too large to hash up front.
+func signS3RequestPayload(req *http.Request, payloadHash, region, accessKey, secretKey string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	canonicalHeaders := "host:" + req.URL.Host + "\n" +
+		"x-amz-content-sha256:" + payloadHash + "\n" +
+		"x-amz-date:" + amzDate + "\n"
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := day + "/" + region + "/s3/aws4_request"
+	signature := s3Signature(canonicalRequest, amzDate, scope, day, region, secretKey)
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
+
+// s3Signature signs a canonical request with a key derived for the day and region.
+func s3Signature(canonicalRequest, amzDate, scope, day, region, secretKey string) string {
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+	key := hmacSHA256([]byte("AWS4"+secretKey), day)
+	for _, part := range []string{region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func doShipRequest(client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s %s: %s: %s", req.Method, req.URL.Redacted(), resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
@@ -6,10 +6,14 @@ import (
 	"crypto/subtle"
 	"encoding/hex"
 	"encoding/json"
+	"math"
 	"net"
 	"net/http"
 	"runtime/debug"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/atombasedev/atombase/config"
@@ -26,6 +30,8 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
+func (rw *responseWriter) Unwrap() http.ResponseWriter { return rw.ResponseWriter }
+
 // generateRequestID creates a random request ID for tracing.
 func generateRequestID() string {
 	b := make([]byte, 8)
@@ -35,7 +41,8 @@ func generateRequestID() string {
 
 // LoggingMiddleware logs all HTTP requests with structured JSON output.
 // Logs: method, path, status, duration, client IP, and request ID.
-// Also logs activity records to stdout if activity logging is enabled.
+// Also logs activity records to stdout if activity logging is enabled, with the
+// fingerprints of the Data API queries the request ran.
 func LoggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
@@ -50,12 +57,14 @@ func LoggingMiddleware(next http.Handler) http.Handler {
 		// Wrap response writer to capture status
 		wrapped := &responseWriter{ResponseWriter: w, status: http.StatusOK}
 
-		// Process request
+		// Process request, collecting the fingerprints of the queries it runs
+		r = r.WithContext(WithQueryLog(r.Context()))
 		next.ServeHTTP(wrapped, r)
 
 		duration := time.Since(start)
 
 		clientIP := clientIPFromRequest(r)
+		database, _ := DatabaseRoute(r)
 
 		// Log the request to stdout
 		Logger.Info("request",
@@ -76,13 +85,20 @@ func LoggingMiddleware(next http.Handler) http.Handler {
 			wrapped.status,
 			duration.Milliseconds(),
 			clientIP,
-			r.Header.Get("Database"),
+			database,
 			requestID,
 			"", // error field
+			RecordedQueries(r.Context()),
 		)
 	})
 }
 
+// ClientIP returns the caller's IP address, honouring X-Forwarded-For only from
+// trusted proxies.
+func ClientIP(r *http.Request) string {
+	return clientIPFromRequest(r)
+}
+
 func clientIPFromRequest(r *http.Request) string {
 	if r == nil {
 		return ""
@@ -181,6 +197,7 @@ func CORSMiddleware(next http.Handler) http.Handler {
 			if o == "*" || o == origin {
 				allowed = true
 				w.Header().Set("Access-Control-Allow-Origin", origin)
+				w.Header().Set("Access-Control-Expose-Headers", "Content-Range, X-Total-Count, X-Next-Cursor, Link")
 				break
 			}
 		}
@@ -193,7 +210,7 @@ func CORSMiddleware(next http.Handler) http.Handler {
 		// Handle preflight requests
 		if r.Method == http.MethodOptions {
 			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PATCH, DELETE, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Database, DB-Token, Prefer")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Database, X-Atomicbase-Tenant, DB-Token, Prefer, Range, Range-Unit")
 			w.Header().Set("Access-Control-Max-Age", "86400")
 			w.WriteHeader(http.StatusNoContent)
 			return
@@ -205,17 +222,74 @@ func CORSMiddleware(next http.Handler) http.Handler {
 
 // TimeoutMiddleware adds a request timeout to prevent long-running requests.
 // Default timeout is 30 seconds, configurable via ATOMICBASE_REQUEST_TIMEOUT.
+// Streams that stay open until the client leaves lift it with
+// LiftRequestTimeout once they start.
 func TimeoutMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		timeout := time.Duration(config.Cfg.RequestTimeout) * time.Second
-		ctx, cancel := context.WithTimeout(r.Context(), timeout)
-		defer cancel()
+		parent, cancel := context.WithCancelCause(r.Context())
+		defer cancel(nil)
+		rt := &requestTimeout{deadline: time.Now().Add(timeout)}
+		rt.timer = time.AfterFunc(timeout, func() { cancel(context.DeadlineExceeded) })
+		defer rt.timer.Stop()
 
-		r = r.WithContext(ctx)
+		r = r.WithContext(timeoutContext{Context: parent, timeout: rt})
 		next.ServeHTTP(w, r)
 	})
 }
 
+type requestTimeoutKey struct{}
+
+// requestTimeout is the timer that cancels a request at its deadline.
+type requestTimeout struct {
+	deadline time.Time
+	timer    *time.Timer
+	lifted   atomic.Bool
+}
+
+// timeoutContext is a request context that reports the request's deadline
+// until the timeout is lifted.
+type timeoutContext struct {
+	context.Context
+	timeout *requestTimeout
+}
+
+func (c timeoutContext) Deadline() (time.Time, bool) {
+	if c.timeout.lifted.Load() {
+		return c.Context.Deadline()
+	}
+	return c.timeout.deadline, true
+}
+
+func (c timeoutContext) Err() error {
+	if c.Context.Err() == nil {
+		return nil
+	}
+	return context.Cause(c.Context)
+}
+
+func (c timeoutContext) Value(key any) any {
+	if key == (requestTimeoutKey{}) {
+		return c.timeout
+	}
+	return c.Context.Value(key)
+}
+
+// LiftRequestTimeout keeps ctx's request from being cancelled at the request
+// timeout, for a stream that stays open until the client leaves. It reports
+// false when the timeout has already passed.
+func LiftRequestTimeout(ctx context.Context) bool {
+	rt, ok := ctx.Value(requestTimeoutKey{}).(*requestTimeout)
+	if !ok {
+		return true
+	}
+	if !rt.timer.Stop() {
+		return rt.lifted.Load()
+	}
+	rt.lifted.Store(true)
+	return true
+}
+
 // AuthRole represents the authenticated role type.
 type AuthRole string
 
@@ -223,6 +297,7 @@ const (
 	RoleAnonymous AuthRole = "anonymous"
 	RoleService   AuthRole = "service"
 	RoleUser      AuthRole = "user"
+	RoleJWT       AuthRole = "jwt"
 )
 
 type authContextKey struct{}
@@ -230,7 +305,8 @@ type authContextKey struct{}
 // AuthContext contains authentication information set by the middleware.
 type AuthContext struct {
 	Role  AuthRole
-	Token string // Raw token (for session validation by handlers)
+	Token string       // Raw token (for session or JWT validation by handlers)
+	Scope *APIKeyScope // Set when a service caller used a scoped API key
 }
 
 // GetAuthContext retrieves auth context from request context.
@@ -250,15 +326,92 @@ func respondUnauthorized(w http.ResponseWriter, msg string) {
 	})
 }
 
-// AuthMiddleware identifies the caller and sets auth context.
+func respondForbidden(w http.ResponseWriter, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	json.NewEncoder(w).Encode(map[string]string{
+		"code":    CodeAPIKeyScope,
+		"message": msg,
+	})
+}
+
+// authenticateAPIKey resolves a scoped key token, answering 401 when it cannot.
+func authenticateAPIKey(w http.ResponseWriter, r *http.Request, lookup APIKeyLookup, token string) (*APIKeyScope, bool) {
+	if lookup == nil {
+		respondUnauthorized(w, "scoped api keys not configured")
+		return nil, false
+	}
+	id, secret, ok := ParseAPIKeyToken(token)
+	if !ok {
+		respondUnauthorized(w, "invalid api key")
+		return nil, false
+	}
+	scope, err := lookup(r.Context(), id, secret)
+	if err != nil {
+		respondUnauthorized(w, "invalid api key")
+		return nil, false
+	}
+	return scope, true
+}
+
+// AuthMiddleware identifies the caller and sets auth context, without
+// support for scoped API keys. See ScopedAuthMiddleware.
+func AuthMiddleware(next http.Handler) http.Handler {
+	return ScopedAuthMiddleware(nil)(next)
+}
+
+// ScopedAuthMiddleware identifies the caller and sets auth context, resolving
+// scoped API keys with lookup. See SignedAuthMiddleware for service accounts.
 // Token formats:
 //   - "service.<api_key>" → RoleService (admin access)
+//   - "key.<id>.<secret>" → RoleService limited to the key's scope; the platform
+//     and auth APIs need an admin key without database or table limits
+//   - "Signature account=..." → RoleService limited to the service account's
+//     scope, with the same limits (SignedAuthMiddleware only)
+//   - "<header>.<claims>.<signature>" → RoleJWT (verified by handler against the database's keys)
 //   - "<sessionId>.<secret>" → RoleUser (session validated by handler)
+//   - No header, with a valid admin session cookie → RoleService; changes need
+//     the CSRF header
 //   - No header → RoleAnonymous
-func AuthMiddleware(next http.Handler) http.Handler {
+func ScopedAuthMiddleware(lookup APIKeyLookup) func(http.Handler) http.Handler {
+	return SignedAuthMiddleware(lookup, nil)
+}
+
+// SignedAuthMiddleware is ScopedAuthMiddleware that also accepts requests
+// signed by service accounts, resolved with accounts. A signed request gets
+// RoleService with the account's scope, like a scoped API key.
+func SignedAuthMiddleware(lookup APIKeyLookup, accounts ServiceAccountLookup) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return scopedAuthHandler(lookup, accounts, next)
+	}
+}
+
+// publicPlatformPaths are the Platform API routes open without a service key:
+// GET /platform/version, which clients call before they know what to send, and
+// accepting an org invitation, whose token is the credential.
+var publicPlatformPaths = map[string]bool{
+	"/platform/version":            true,
+	"/platform/invitations/accept": true,
+}
+
+func scopedAuthHandler(lookup APIKeyLookup, accounts ServiceAccountLookup, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		auth := r.Header.Get("Authorization")
-		isPlatform := strings.HasPrefix(r.URL.Path, "/platform")
+		isPlatform := strings.HasPrefix(r.URL.Path, "/platform") && !publicPlatformPaths[r.URL.Path]
+
+		// Browser admin session: the cookie stands in for the service key
+		// when no header is sent. The /admin routes read it themselves.
+		if auth == "" && !strings.HasPrefix(r.URL.Path, "/admin/") {
+			if session, ok := ReadAdminSession(r, time.Now()); ok {
+				if err := checkCSRF(r, session); err != nil {
+					RespErr(w, err)
+					return
+				}
+				ctx := context.WithValue(r.Context(), authContextKey{}, AuthContext{Role: RoleService})
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+		}
 
 		if isPlatform {
 			if auth == "" {
@@ -266,12 +419,39 @@ func AuthMiddleware(next http.Handler) http.Handler {
 				return
 			}
 
+			if strings.HasPrefix(auth, SignatureScheme) {
+				scope, ok := authenticateSignature(w, r, accounts)
+				if !ok {
+					return
+				}
+				if !scope.PlatformAccess() {
+					respondForbidden(w, "platform API needs an admin service account without database or table limits")
+					return
+				}
+				ctx := context.WithValue(r.Context(), authContextKey{}, AuthContext{Role: RoleService, Scope: scope})
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+
 			if len(auth) < 8 || !strings.EqualFold(auth[:7], "Bearer ") {
 				respondUnauthorized(w, "invalid authorization format")
 				return
 			}
 
 			token := auth[7:]
+			if strings.HasPrefix(token, APIKeyPrefix) {
+				scope, ok := authenticateAPIKey(w, r, lookup, token)
+				if !ok {
+					return
+				}
+				if !scope.PlatformAccess() {
+					respondForbidden(w, "platform API needs an admin key without database or table limits")
+					return
+				}
+				ctx := context.WithValue(r.Context(), authContextKey{}, AuthContext{Role: RoleService, Scope: scope})
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
 			if !strings.HasPrefix(token, "service.") {
 				respondUnauthorized(w, "service key required")
 				return
@@ -301,6 +481,21 @@ func AuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		// Service account: the scope applies as for a scoped API key.
+		if strings.HasPrefix(auth, SignatureScheme) {
+			scope, ok := authenticateSignature(w, r, accounts)
+			if !ok {
+				return
+			}
+			if strings.HasPrefix(r.URL.Path, "/auth") && !scope.FullAccess() {
+				respondForbidden(w, "auth API needs an admin service account without database, table or organization limits")
+				return
+			}
+			ctx := context.WithValue(r.Context(), authContextKey{}, AuthContext{Role: RoleService, Scope: scope})
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
 		// Must be "Bearer <token>" format
 		if len(auth) < 8 || !strings.EqualFold(auth[:7], "Bearer ") {
 			respondUnauthorized(w, "invalid authorization format")
@@ -309,6 +504,22 @@ func AuthMiddleware(next http.Handler) http.Handler {
 
 		token := auth[7:]
 
+		// Scoped API key: "key.<id>.<secret>". The Data API enforces its
+		// database, tables and verbs; the auth API only takes full-access keys.
+		if strings.HasPrefix(token, APIKeyPrefix) {
+			scope, ok := authenticateAPIKey(w, r, lookup, token)
+			if !ok {
+				return
+			}
+			if strings.HasPrefix(r.URL.Path, "/auth") && !scope.FullAccess() {
+				respondForbidden(w, "auth API needs an admin key without database, table or organization limits")
+				return
+			}
+			ctx := context.WithValue(r.Context(), authContextKey{}, AuthContext{Role: RoleService, Scope: scope})
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
 		// Service role: "service.<api_key>"
 		if strings.HasPrefix(token, "service.") {
 			apiKey := config.Cfg.APIKey
@@ -328,6 +539,17 @@ func AuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		// JWT issued by a tenant app. Its signing key is registered per database,
+		// so verification happens in the handler.
+		if IsJWT(token) {
+			ctx := context.WithValue(r.Context(), authContextKey{}, AuthContext{
+				Role:  RoleJWT,
+				Token: token,
+			})
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
 		// User session token: "<sessionId>.<secret>"
 		// Session validation happens in handler
 		if strings.Contains(token, ".") {
@@ -344,13 +566,185 @@ func AuthMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// inFlight counts the requests each caller has in progress.
+var inFlight = struct {
+	sync.Mutex
+	counts map[string]int
+}{counts: map[string]int{}}
+
+// concurrencyKey identifies the caller a request counts against before its
+// credentials are verified: the key for limited API keys, which are verified
+// by then, and the client IP otherwise. Session tokens and JWTs are only
+// verified by the handler, so they count against the IP until
+// IdentifyCaller moves them to their principal; a forged token gets no
+// allowance of its own. Other service requests have no key and are not
+// limited.
+func concurrencyKey(r *http.Request) string {
+	auth := GetAuthContext(r.Context())
+	if auth.Role == RoleService {
+		if auth.Scope != nil && !auth.Scope.FullAccess() {
+			return "key:" + auth.Scope.KeyID
+		}
+		return ""
+	}
+	return "ip:" + clientIPFromRequest(r)
+}
+
+type callerContextKey struct{}
+
+// callerLimits are the per-caller limits a request counts against, each
+// moved to the verified principal by IdentifyCaller.
+type callerLimits struct {
+	mu    sync.Mutex
+	moves []func(key string) error
+}
+
+// withCallerLimits returns the request's callerLimits, adding them to its
+// context when it has none yet.
+func withCallerLimits(r *http.Request) (*http.Request, *callerLimits) {
+	if limits, ok := r.Context().Value(callerContextKey{}).(*callerLimits); ok {
+		return r, limits
+	}
+	limits := &callerLimits{}
+	return r.WithContext(context.WithValue(r.Context(), callerContextKey{}, limits)), limits
+}
+
+// IdentifyCaller moves a request's rate and concurrency limits from its
+// client IP to key, a principal whose credentials the handler has verified.
+// It fails when the principal is over its own limits.
+func IdentifyCaller(ctx context.Context, key string) error {
+	limits, ok := ctx.Value(callerContextKey{}).(*callerLimits)
+	if !ok || key == "" {
+		return nil
+	}
+	limits.mu.Lock()
+	defer limits.mu.Unlock()
+	for _, move := range limits.moves {
+		if err := move(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ConcurrencyLimitMiddleware caps how many requests one caller can have in
+// flight, so a single client cannot hold every connection. It must run after
+// AuthMiddleware. A limit of 0 disables it.
+func ConcurrencyLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit := config.Cfg.MaxConcurrentPerCaller
+		key := concurrencyKey(r)
+		if limit <= 0 || key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		inFlight.Lock()
+		if inFlight.counts[key] >= limit {
+			inFlight.Unlock()
+			w.Header().Set("Retry-After", "1")
+			RespErr(w, ErrTooManyConcurrentRequests)
+			return
+		}
+		inFlight.counts[key]++
+		inFlight.Unlock()
+		release := func(key string) {
+			if inFlight.counts[key]--; inFlight.counts[key] <= 0 {
+				delete(inFlight.counts, key)
+			}
+		}
+
+		r, limits := withCallerLimits(r)
+		limits.mu.Lock()
+		limits.moves = append(limits.moves, func(to string) error {
+			if to == key {
+				return nil
+			}
+			inFlight.Lock()
+			defer inFlight.Unlock()
+			if inFlight.counts[to] >= limit {
+				return &RetryAfterError{Err: ErrTooManyConcurrentRequests, Wait: time.Second}
+			}
+			inFlight.counts[to]++
+			release(key)
+			key = to
+			return nil
+		})
+		limits.mu.Unlock()
+		defer func() {
+			limits.mu.Lock()
+			defer limits.mu.Unlock()
+			inFlight.Lock()
+			release(key)
+			inFlight.Unlock()
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestBuckets hold each caller's request rate allowance.
+var requestBuckets = NewTokenBuckets("requests", 100000)
+
+// RateLimitMiddleware lets each caller send RateLimit requests per second on
+// average, in bursts of up to RateLimitBurst. Callers are told apart as in
+// ConcurrencyLimitMiddleware, and it must likewise run after AuthMiddleware.
+// Once IdentifyCaller names the principal, the request is charged to it
+// instead and its token handed back to the IP. A rate of 0 disables it.
+func RateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rate := config.Cfg.RateLimit
+		key := concurrencyKey(r)
+		if rate <= 0 || key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		burst := float64(config.Cfg.RateLimitBurst)
+		if burst < 1 {
+			burst = max(1, math.Ceil(rate))
+		}
+		limit := BucketLimit{Rate: rate, Burst: burst}
+
+		now := time.Now()
+		ok, _, wait := requestBuckets.Take(key, 1, limit, now)
+		if !ok {
+			RecordAbuse(key, 1, now)
+			w.Header().Set("Retry-After", strconv.Itoa(max(1, int(math.Ceil(wait.Seconds())))))
+			RespErr(w, ErrRateLimited)
+			return
+		}
+
+		r, limits := withCallerLimits(r)
+		limits.mu.Lock()
+		limits.moves = append(limits.moves, func(to string) error {
+			if to == key {
+				return nil
+			}
+			now := time.Now()
+			ok, _, wait := requestBuckets.Take(to, 1, limit, now)
+			if !ok {
+				RecordAbuse(to, 1, now)
+				return &RetryAfterError{Err: ErrRateLimited, Wait: wait}
+			}
+			requestBuckets.Give(key, 1, now)
+			key = to
+			return nil
+		})
+		limits.mu.Unlock()
+		next.ServeHTTP(w, r)
+	})
+}
+
 // PanicRecoveryMiddleware recovers from panics and returns a 500 error.
-// Logs the panic message and stack trace for debugging.
+// Logs the panic message and stack trace for debugging, and reports it to the
+// error reporter if one is configured.
 func PanicRecoveryMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w = &reportingWriter{ResponseWriter: w, req: r}
 		defer func() {
 			if err := recover(); err != nil {
 				stack := debug.Stack()
+				ReportError(r, err)
 
 				Logger.Error("panic recovered",
 					"error", err,
@@ -3,6 +3,7 @@ package tools
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -156,6 +157,38 @@ func TestTimeoutMiddleware_SetsDeadline(t *testing.T) {
 	}
 }
 
+func TestTimeoutMiddleware_LiftedForStreams(t *testing.T) {
+	originalTimeout := config.Cfg.RequestTimeout
+	config.Cfg.RequestTimeout = 1
+	defer func() {
+		config.Cfg.RequestTimeout = originalTimeout
+	}()
+
+	for _, stream := range []bool{true, false} {
+		var err error
+		handler := TimeoutMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if stream && !LiftRequestTimeout(r.Context()) {
+				t.Error("expected the timeout to be lifted before it passed")
+			}
+			select {
+			case <-r.Context().Done():
+			case <-time.After(1500 * time.Millisecond):
+			}
+			err = r.Context().Err()
+			if _, ok := r.Context().Deadline(); ok == stream {
+				t.Errorf("stream %v: unexpected deadline %v", stream, ok)
+			}
+		}))
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/data/presence/lobby", nil))
+		if stream && err != nil {
+			t.Errorf("expected a stream to outlive the timeout, got %v", err)
+		}
+		if !stream && !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected the request to time out, got %v", err)
+		}
+	}
+}
+
 func TestClientIPFromRequest(t *testing.T) {
 	originalTrusted := config.Cfg.TrustedProxyCIDRs
 	defer func() {
@@ -255,6 +288,12 @@ func TestAuthMiddleware(t *testing.T) {
 			wantStatus: http.StatusNoContent,
 			wantRole:   RoleService,
 		},
+		{
+			name:       "platform version is public",
+			path:       "/platform/version",
+			wantStatus: http.StatusNoContent,
+			wantRole:   RoleAnonymous,
+		},
 		{
 			name:       "data anonymous allowed",
 			path:       "/data/query/users",
@@ -276,6 +315,21 @@ func TestAuthMiddleware(t *testing.T) {
 			wantRole:   RoleUser,
 			wantToken:  "session.secret",
 		},
+		{
+			name:       "data jwt",
+			path:       "/data/query/users",
+			authHeader: "Bearer eyJhbGciOiJIUzI1NiJ9.eyJzdWIiOiJ1MSJ9.sig",
+			wantStatus: http.StatusNoContent,
+			wantRole:   RoleJWT,
+			wantToken:  "eyJhbGciOiJIUzI1NiJ9.eyJzdWIiOiJ1MSJ9.sig",
+		},
+		{
+			name:         "platform rejects jwt",
+			path:         "/platform/definitions",
+			authHeader:   "Bearer eyJhbGciOiJIUzI1NiJ9.eyJzdWIiOiJ1MSJ9.sig",
+			wantStatus:   http.StatusUnauthorized,
+			wantBodyCode: "UNAUTHORIZED",
+		},
 		{
 			name:         "data invalid bearer format",
 			path:         "/data/query/users",
@@ -335,6 +389,90 @@ func TestAuthMiddleware(t *testing.T) {
 	}
 }
 
+func TestScopedAuthMiddleware(t *testing.T) {
+	keys := map[string]*APIKeyScope{
+		"admin":  {KeyID: "admin", Verbs: []string{VerbAdmin}},
+		"reader": {KeyID: "reader", Database: "db1", Tables: []string{"posts"}, Verbs: []string{VerbRead}},
+	}
+	lookup := func(ctx context.Context, id, secret string) (*APIKeyScope, error) {
+		if scope, ok := keys[id]; ok && secret == "s3cret" {
+			return scope, nil
+		}
+		return nil, ErrAPIKeyNotFound
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		token      string
+		wantStatus int
+		wantKey    string
+	}{
+		{name: "data scoped key", path: "/data/query/posts", token: "key.reader.s3cret", wantStatus: http.StatusNoContent, wantKey: "reader"},
+		{name: "wrong secret", path: "/data/query/posts", token: "key.reader.nope", wantStatus: http.StatusUnauthorized},
+		{name: "unknown key", path: "/data/query/posts", token: "key.other.s3cret", wantStatus: http.StatusUnauthorized},
+		{name: "malformed key", path: "/data/query/posts", token: "key.reader", wantStatus: http.StatusUnauthorized},
+		{name: "platform admin key", path: "/platform/definitions", token: "key.admin.s3cret", wantStatus: http.StatusNoContent, wantKey: "admin"},
+		{name: "platform limited key", path: "/platform/definitions", token: "key.reader.s3cret", wantStatus: http.StatusForbidden},
+		{name: "auth limited key", path: "/auth/users", token: "key.reader.s3cret", wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotAuth AuthContext
+			handler := ScopedAuthMiddleware(lookup)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotAuth = GetAuthContext(r.Context())
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+			if tt.wantKey == "" {
+				return
+			}
+			if gotAuth.Role != RoleService || gotAuth.Scope == nil || gotAuth.Scope.KeyID != tt.wantKey {
+				t.Fatalf("expected service role with key %q, got %+v", tt.wantKey, gotAuth)
+			}
+		})
+	}
+
+	t.Run("without lookup", func(t *testing.T) {
+		handler := AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		req := httptest.NewRequest(http.MethodGet, "/data/query/posts", nil)
+		req.Header.Set("Authorization", "Bearer key.reader.s3cret")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("expected 401, got %d", rec.Code)
+		}
+	})
+}
+
+func TestAPIKeyScopeAllows(t *testing.T) {
+	reader := &APIKeyScope{Tables: []string{"posts"}, Verbs: []string{VerbRead}}
+	if !reader.Allows("posts", "select") || reader.Allows("posts", "insert") || reader.Allows("users", "select") {
+		t.Fatal("reader scope allows the wrong operations")
+	}
+	writer := &APIKeyScope{Verbs: []string{VerbWrite}}
+	if writer.Allows("posts", "select") || !writer.Allows("posts", "delete") {
+		t.Fatal("writer scope allows the wrong operations")
+	}
+	admin := &APIKeyScope{Verbs: []string{VerbAdmin}}
+	if !admin.Allows("users", "update") || !admin.FullAccess() {
+		t.Fatal("admin scope should allow everything")
+	}
+	if (&APIKeyScope{Database: "db1", Verbs: []string{VerbAdmin}}).FullAccess() {
+		t.Fatal("database-limited admin key should not have full access")
+	}
+}
+
 func TestPanicRecoveryMiddleware(t *testing.T) {
 	handler := PanicRecoveryMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		panic("boom")
@@ -355,3 +493,73 @@ func TestPanicRecoveryMiddleware(t *testing.T) {
 		t.Fatalf("expected internal server error body, got %q", rec.Body.String())
 	}
 }
+
+func TestConcurrencyLimitMiddleware(t *testing.T) {
+	original := config.Cfg.MaxConcurrentPerCaller
+	defer func() { config.Cfg.MaxConcurrentPerCaller = original }()
+	config.Cfg.MaxConcurrentPerCaller = 1
+
+	var release, entered chan struct{}
+	handler := ConcurrencyLimitMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Stands in for the handler verifying the session; forged tokens
+		// never get that far.
+		auth := GetAuthContext(r.Context())
+		if user, _, _ := strings.Cut(auth.Token, "."); auth.Role == RoleUser && user != "forged" {
+			if err := IdentifyCaller(r.Context(), "user:"+user); err != nil {
+				RespErr(w, err)
+				return
+			}
+		}
+		if r.URL.Path == "/slow" {
+			close(entered)
+			<-release
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	request := func(path, token string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		auth := AuthContext{Role: RoleUser, Token: token}
+		if token == "" {
+			auth = AuthContext{Role: RoleService}
+		}
+		return r.WithContext(context.WithValue(r.Context(), authContextKey{}, auth))
+	}
+	slow := func(token string) chan struct{} {
+		release, entered = make(chan struct{}), make(chan struct{})
+		done := make(chan struct{})
+		go func() {
+			handler.ServeHTTP(httptest.NewRecorder(), request("/slow", token))
+			close(done)
+		}()
+		<-entered
+		return done
+	}
+	expect := func(token string, code int) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, request("/fast", token))
+		if rec.Code != code {
+			t.Fatalf("expected token %q to get %d, got %d %s", token, code, rec.Code, rec.Body.String())
+		}
+		if code == http.StatusTooManyRequests && !strings.Contains(rec.Body.String(), CodeTooManyConcurrent) {
+			t.Fatalf("expected %s, got %s", CodeTooManyConcurrent, rec.Body.String())
+		}
+	}
+
+	// A verified user's request moves off the client IP onto the user.
+	done := slow("sess1.secret")
+	expect("sess1.other", http.StatusTooManyRequests)
+	expect("sess2.secret", http.StatusOK)
+	expect("", http.StatusOK)
+	close(release)
+	<-done
+	expect("sess1.secret", http.StatusOK)
+
+	// Unverified tokens all count against the client IP, however many are made up.
+	done = slow("forged.one")
+	expect("forged.two", http.StatusTooManyRequests)
+	expect("sess2.secret", http.StatusTooManyRequests)
+	close(release)
+	<-done
+	expect("forged.two", http.StatusOK)
+}
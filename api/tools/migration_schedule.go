@@ -0,0 +1,91 @@
+package tools
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// MigrationWindow is a time of day a migration may run in. Windows apply to
+// the databases carrying one of their labels, or to every database when they
+// have none.
+type MigrationWindow struct {
+	Start    string   `json:"start"`              // HH:MM
+	End      string   `json:"end"`                // HH:MM, before Start to run past midnight
+	Timezone string   `json:"timezone,omitempty"` // IANA zone; empty uses the database's own timezone
+	Labels   []string `json:"labels,omitempty"`
+}
+
+// DatabaseSchedule is what migration windows need to know about a database.
+type DatabaseSchedule struct {
+	Timezone string   `json:"timezone,omitempty"` // IANA zone windows without one are read in (empty is UTC)
+	Labels   []string `json:"labels"`
+}
+
+// Validate checks a window's times and timezone.
+func (w MigrationWindow) Validate() error {
+	start, err := parseClock(w.Start)
+	if err != nil {
+		return fmt.Errorf("start: %w", err)
+	}
+	end, err := parseClock(w.End)
+	if err != nil {
+		return fmt.Errorf("end: %w", err)
+	}
+	if start == end {
+		return fmt.Errorf("start and end are both %s", w.Start)
+	}
+	if w.Timezone != "" {
+		if _, err := time.LoadLocation(w.Timezone); err != nil {
+			return fmt.Errorf("unknown timezone %q", w.Timezone)
+		}
+	}
+	for _, label := range w.Labels {
+		if strings.TrimSpace(label) == "" {
+			return fmt.Errorf("labels must not be empty")
+		}
+	}
+	return nil
+}
+
+// MigrationWindowOpen reports whether a database may migrate at now. Only
+// the windows matching the database's labels count; with none matching, the
+// database is not restricted.
+func MigrationWindowOpen(windows []MigrationWindow, schedule DatabaseSchedule, now time.Time) bool {
+	matched := false
+	for _, w := range windows {
+		if len(w.Labels) > 0 && !slices.ContainsFunc(w.Labels, func(label string) bool { return slices.Contains(schedule.Labels, label) }) {
+			continue
+		}
+		matched = true
+		zone := w.Timezone
+		if zone == "" {
+			zone = schedule.Timezone
+		}
+		loc, err := time.LoadLocation(zone)
+		if err != nil {
+			loc = time.UTC
+		}
+		start, err1 := parseClock(w.Start)
+		end, err2 := parseClock(w.End)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		local := now.In(loc)
+		minute := local.Hour()*60 + local.Minute()
+		if start < end && minute >= start && minute < end || start > end && (minute >= start || minute < end) {
+			return true
+		}
+	}
+	return !matched
+}
+
+// parseClock returns the minute of the day an HH:MM time names.
+func parseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not an HH:MM time", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
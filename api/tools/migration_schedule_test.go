@@ -0,0 +1,58 @@
+package tools
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMigrationWindowOpen(t *testing.T) {
+	at := func(clock string) time.Time {
+		ts, _ := time.Parse(time.RFC3339, "2026-03-02T"+clock+":00Z")
+		return ts
+	}
+	night := MigrationWindow{Start: "22:00", End: "04:00"}
+	tokyo := MigrationWindow{Start: "01:00", End: "05:00", Timezone: "Asia/Tokyo"}
+	eu := MigrationWindow{Start: "01:00", End: "05:00", Labels: []string{"eu"}}
+
+	tests := []struct {
+		name     string
+		windows  []MigrationWindow
+		schedule DatabaseSchedule
+		now      time.Time
+		want     bool
+	}{
+		{name: "before midnight", windows: []MigrationWindow{night}, now: at("23:30"), want: true},
+		{name: "after midnight", windows: []MigrationWindow{night}, now: at("03:59"), want: true},
+		{name: "end is exclusive", windows: []MigrationWindow{night}, now: at("04:00"), want: false},
+		{name: "window timezone", windows: []MigrationWindow{tokyo}, now: at("17:00"), want: true},
+		{name: "database timezone", windows: []MigrationWindow{{Start: "01:00", End: "05:00"}}, schedule: DatabaseSchedule{Timezone: "America/New_York"}, now: at("07:00"), want: true},
+		{name: "label matches", windows: []MigrationWindow{eu}, schedule: DatabaseSchedule{Labels: []string{"eu"}}, now: at("12:00"), want: false},
+		{name: "label does not match", windows: []MigrationWindow{eu}, schedule: DatabaseSchedule{Labels: []string{"us"}}, now: at("12:00"), want: true},
+		{name: "any matching window", windows: []MigrationWindow{eu, night}, schedule: DatabaseSchedule{Labels: []string{"eu"}}, now: at("23:00"), want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MigrationWindowOpen(tt.windows, tt.schedule, tt.now); got != tt.want {
+				t.Fatalf("MigrationWindowOpen() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMigrationWindowValidate(t *testing.T) {
+	bad := []MigrationWindow{
+		{Start: "1am", End: "05:00"},
+		{Start: "01:00", End: "25:00"},
+		{Start: "01:00", End: "01:00"},
+		{Start: "01:00", End: "05:00", Timezone: "Mars/Olympus"},
+		{Start: "01:00", End: "05:00", Labels: []string{" "}},
+	}
+	for _, w := range bad {
+		if err := w.Validate(); err == nil {
+			t.Fatalf("expected %+v to be invalid", w)
+		}
+	}
+	if err := (MigrationWindow{Start: "22:00", End: "04:00", Timezone: "Europe/Berlin"}).Validate(); err != nil {
+		t.Fatalf("expected valid window: %v", err)
+	}
+}
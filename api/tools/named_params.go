@@ -0,0 +1,81 @@
+package tools
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PositionalParams rewrites the :name placeholders of one SQL statement to
+// ?, returning the statement and the names in placeholder order. Colons inside
+// string literals, quoted identifiers and comments are left alone. A trailing
+// semicolon is dropped; any other semicolon is an error, so a statement can't
+// smuggle in a second one.
+func PositionalParams(stmt string) (string, []string, error) {
+	var out strings.Builder
+	var names []string
+	rest := strings.TrimRight(strings.TrimSpace(stmt), ";")
+	for i := 0; i < len(rest); i++ {
+		c := rest[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`' || c == '[':
+			end := byte(c)
+			if c == '[' {
+				end = ']'
+			}
+			j := i + 1
+			for j < len(rest) {
+				if rest[j] == end {
+					// A doubled quote escapes itself inside the literal.
+					if end != ']' && j+1 < len(rest) && rest[j+1] == end {
+						j += 2
+						continue
+					}
+					break
+				}
+				j++
+			}
+			if j >= len(rest) {
+				return "", nil, fmt.Errorf("unterminated %c in statement", c)
+			}
+			out.WriteString(rest[i : j+1])
+			i = j
+		case c == '-' && i+1 < len(rest) && rest[i+1] == '-':
+			j := strings.IndexByte(rest[i:], '\n')
+			if j < 0 {
+				j = len(rest) - i
+			}
+			out.WriteString(rest[i : i+j])
+			i += j - 1
+		case c == '/' && i+1 < len(rest) && rest[i+1] == '*':
+			j := strings.Index(rest[i+2:], "*/")
+			if j < 0 {
+				return "", nil, fmt.Errorf("unterminated comment in statement")
+			}
+			out.WriteString(rest[i : i+j+4])
+			i += j + 3
+		case c == ';':
+			return "", nil, fmt.Errorf("only one statement is allowed")
+		case c == ':' && i+1 < len(rest) && isParamStart(rest[i+1]):
+			j := i + 1
+			for j < len(rest) && isParamChar(rest[j]) {
+				j++
+			}
+			names = append(names, rest[i+1:j])
+			out.WriteByte('?')
+			i = j - 1
+		case c == '?' || c == '@' || c == '$':
+			return "", nil, fmt.Errorf("use :name placeholders, not %c", c)
+		default:
+			out.WriteByte(c)
+		}
+	}
+	return out.String(), names, nil
+}
+
+func isParamStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isParamChar(c byte) bool {
+	return isParamStart(c) || c >= '0' && c <= '9'
+}
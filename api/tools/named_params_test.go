@@ -0,0 +1,35 @@
+package tools
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestPositionalParams(t *testing.T) {
+	stmt, names, err := PositionalParams(`SELECT id, ':skip' AS [a:b], "c:d" FROM t -- :comment
+		WHERE owner = :auth_id AND total > :min /* :also */ AND total < :min + 10;`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `SELECT id, ':skip' AS [a:b], "c:d" FROM t -- :comment
+		WHERE owner = ? AND total > ? /* :also */ AND total < ? + 10`
+	if stmt != want || !slices.Equal(names, []string{"auth_id", "min", "min"}) {
+		t.Errorf("got %q %v", stmt, names)
+	}
+
+	if stmt, _, err := PositionalParams(`SELECT 'it''s :not'`); err != nil || stmt != `SELECT 'it''s :not'` {
+		t.Errorf("got %q, %v", stmt, err)
+	}
+
+	for _, bad := range []string{
+		`SELECT 1; DROP TABLE t`,
+		`SELECT * FROM t WHERE id = ?`,
+		`SELECT * FROM t WHERE id = $id`,
+		`SELECT 'open`,
+		`SELECT 1 /* open`,
+	} {
+		if _, _, err := PositionalParams(bad); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ObjectStore uploads files to an S3-compatible bucket and hands out
+// presigned download links for them.
+type ObjectStore struct {
+	BucketURL string // e.g. https://my-bucket.s3.us-east-1.amazonaws.com/exports
+	Region    string
+	AccessKey string
+	SecretKey string
+	Client    *http.Client
+}
+
+// NewObjectStore returns a store for bucketURL, or nil when it is empty.
+func NewObjectStore(bucketURL, region, accessKey, secretKey string) *ObjectStore {
+	if bucketURL == "" {
+		return nil
+	}
+	return &ObjectStore{
+		BucketURL: strings.TrimRight(bucketURL, "/"),
+		Region:    region,
+		AccessKey: accessKey,
+		SecretKey: secretKey,
+		Client:    &http.Client{},
+	}
+}
+
+// PutFile uploads a file under key, streaming it from disk. The payload is
+// sent unsigned so multi-gigabyte files need not be hashed first; TLS
+// protects it in transit.
+func (s *ObjectStore) PutFile(ctx context.Context, key string, file *os.File, contentType string) error {
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if _, err := file.Seek(0, 0); err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.BucketURL+"/"+key, file)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = info.Size()
+	req.Header.Set("Content-Type", contentType)
+	signS3RequestPayload(req, "UNSIGNED-PAYLOAD", s.Region, s.AccessKey, s.SecretKey, time.Now().UTC())
+	return doShipRequest(s.Client, req)
+}
+
+// Open downloads key, returning its body and Content-Type. A missing key is
+// ErrObjectNotFound.
+func (s *ObjectStore) Open(ctx context.Context, key string) (io.ReadCloser, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.BucketURL+"/"+key, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	signS3RequestPayload(req, "UNSIGNED-PAYLOAD", s.Region, s.AccessKey, s.SecretKey, time.Now().UTC())
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, "", ErrObjectNotFound
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, "", fmt.Errorf("GET %s: %s: %s", req.URL.Redacted(), resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return resp.Body, resp.Header.Get("Content-Type"), nil
+}
+
+// Delete removes key. Deleting a missing key succeeds, as in S3.
+func (s *ObjectStore) Delete(ctx context.Context, key string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, s.BucketURL+"/"+key, nil)
+	if err != nil {
+		return err
+	}
+	signS3RequestPayload(req, "UNSIGNED-PAYLOAD", s.Region, s.AccessKey, s.SecretKey, time.Now().UTC())
+	return doShipRequest(s.Client, req)
+}
+
+// PresignGet returns a URL that downloads key without credentials until ttl
+// passes (AWS Signature Version 4 query signing).
+func (s *ObjectStore) PresignGet(key string, ttl time.Duration, now time.Time) (string, error) {
+	u, err := url.Parse(s.BucketURL + "/" + key)
+	if err != nil {
+		return "", err
+	}
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	scope := day + "/" + s.Region + "/s3/aws4_request"
+	query := map[string]string{
+		"X-Amz-Algorithm":     "AWS4-HMAC-SHA256",
+		"X-Amz-Credential":    s.AccessKey + "/" + scope,
+		"X-Amz-Date":          amzDate,
+		"X-Amz-Expires":       strconv.Itoa(int(ttl.Seconds())),
+		"X-Amz-SignedHeaders": "host",
+	}
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = s3Escape(name) + "=" + s3Escape(query[name])
+	}
+	rawQuery := strings.Join(pairs, "&")
+
+	canonicalRequest := strings.Join([]string{
+		http.MethodGet,
+		u.EscapedPath(),
+		rawQuery,
+		"host:" + u.Host + "\n",
+		"host",
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+	signature := s3Signature(canonicalRequest, amzDate, scope, day, s.Region, s.SecretKey)
+	return fmt.Sprintf("%s://%s%s?%s&X-Amz-Signature=%s", u.Scheme, u.Host, u.EscapedPath(), rawQuery, signature), nil
+}
+
+// s3Escape percent-encodes everything but unreserved characters, as SigV4 requires.
+func s3Escape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
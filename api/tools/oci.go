@@ -0,0 +1,174 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// ociManifestTypes are the manifest formats FetchOCIArtifact accepts.
+const ociManifestTypes = "application/vnd.oci.image.manifest.v1+json, application/vnd.docker.distribution.manifest.v2+json"
+
+// ociArtifact is a repository in an OCI registry being pulled from.
+type ociArtifact struct {
+	registry   string
+	repository string
+	token      string // Bearer token once the registry asked for one
+}
+
+// ParseOCIReference splits registry/repository:tag or
+// registry/repository@sha256:digest. A reference without a tag or digest
+// points at latest.
+func ParseOCIReference(ref string) (registry, repository, reference string, err error) {
+	registry, rest, ok := strings.Cut(ref, "/")
+	if !ok || registry == "" || rest == "" {
+		return "", "", "", fmt.Errorf("OCI reference %q needs a registry and repository", ref)
+	}
+	if repo, digest, ok := strings.Cut(rest, "@"); ok {
+		repository, reference = repo, digest
+	} else if i := strings.LastIndex(rest, ":"); i > strings.LastIndex(rest, "/") {
+		repository, reference = rest[:i], rest[i+1:]
+	} else {
+		repository, reference = rest, "latest"
+	}
+	if repository == "" || reference == "" {
+		return "", "", "", fmt.Errorf("OCI reference %q is malformed", ref)
+	}
+	return registry, repository, reference, nil
+}
+
+// FetchOCIArtifact downloads the payload of a single-layer OCI artifact, such
+// as one pushed with `oras push`. Anonymous pulls are supported, including the
+// token exchange public registries ask for. The layer is checked against its
+// digest and may be at most maxBytes long.
+func FetchOCIArtifact(ctx context.Context, client *http.Client, ref string, maxBytes int64) ([]byte, error) {
+	registry, repository, reference, err := ParseOCIReference(ref)
+	if err != nil {
+		return nil, err
+	}
+	artifact := &ociArtifact{registry: registry, repository: repository}
+
+	raw, err := artifact.get(ctx, client, "manifests/"+reference, ociManifestTypes, 1<<20)
+	if err != nil {
+		return nil, err
+	}
+	var manifest struct {
+		Layers []struct {
+			Digest string `json:"digest"`
+			Size   int64  `json:"size"`
+		} `json:"layers"`
+	}
+	if err := json.Unmarshal(raw, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid OCI manifest: %w", err)
+	}
+	if len(manifest.Layers) != 1 {
+		return nil, fmt.Errorf("OCI artifact %s has %d layers, expected 1", ref, len(manifest.Layers))
+	}
+	layer := manifest.Layers[0]
+	if layer.Size > maxBytes {
+		return nil, fmt.Errorf("OCI artifact %s is %d bytes, more than %d", ref, layer.Size, maxBytes)
+	}
+	blob, err := artifact.get(ctx, client, "blobs/"+layer.Digest, "", maxBytes)
+	if err != nil {
+		return nil, err
+	}
+	if algorithm, want, _ := strings.Cut(layer.Digest, ":"); algorithm == "sha256" && sha256Hex(blob) != want {
+		return nil, fmt.Errorf("OCI layer of %s does not match its digest", ref)
+	}
+	return blob, nil
+}
+
+// get reads one registry path, answering a bearer challenge once.
+func (a *ociArtifact) get(ctx context.Context, client *http.Client, path, accept string, maxBytes int64) ([]byte, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://"+a.registry+"/v2/"+a.repository+"/"+path, nil)
+		if err != nil {
+			return nil, err
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		if a.token != "" {
+			req.Header.Set("Authorization", "Bearer "+a.token)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == http.StatusUnauthorized && attempt == 0 {
+			challenge := resp.Header.Get("WWW-Authenticate")
+			resp.Body.Close()
+			if a.token, err = ociToken(ctx, client, challenge); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("GET %s: %s", req.URL.Redacted(), resp.Status)
+		}
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(body)) > maxBytes {
+			return nil, fmt.Errorf("GET %s: response exceeds %d bytes", req.URL.Redacted(), maxBytes)
+		}
+		return body, nil
+	}
+}
+
+// ociChallengeParam matches one key="value" pair of a WWW-Authenticate
+// challenge; values like scope may contain commas.
+var ociChallengeParam = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// ociToken fetches an anonymous token for a Bearer realm="...",service="...",scope="..." challenge.
+func ociToken(ctx context.Context, client *http.Client, challenge string) (string, error) {
+	scheme, params, _ := strings.Cut(challenge, " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		return "", fmt.Errorf("registry asked for unsupported %q authentication", scheme)
+	}
+	values := url.Values{}
+	var realm string
+	for _, match := range ociChallengeParam.FindAllStringSubmatch(params, -1) {
+		if match[1] == "realm" {
+			realm = match[2]
+		} else {
+			values.Set(match[1], match[2])
+		}
+	}
+	if realm == "" {
+		return "", fmt.Errorf("registry challenge has no realm")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm+"?"+values.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("registry token: %s", resp.Status)
+	}
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil {
+		return "", fmt.Errorf("registry token: %w", err)
+	}
+	if body.Token == "" {
+		body.Token = body.AccessToken
+	}
+	if body.Token == "" {
+		return "", fmt.Errorf("registry token response has no token")
+	}
+	return body.Token, nil
+}
@@ -0,0 +1,77 @@
+package tools
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseOCIReference(t *testing.T) {
+	for ref, want := range map[string][3]string{
+		"ghcr.io/acme/templates/blog:1.2":       {"ghcr.io", "acme/templates/blog", "1.2"},
+		"localhost:5000/blog":                   {"localhost:5000", "blog", "latest"},
+		"ghcr.io/acme/blog@sha256:0123456789ab": {"ghcr.io", "acme/blog", "sha256:0123456789ab"},
+	} {
+		registry, repository, reference, err := ParseOCIReference(ref)
+		if err != nil || [3]string{registry, repository, reference} != want {
+			t.Errorf("%s: got %s %s %s, %v", ref, registry, repository, reference, err)
+		}
+	}
+	for _, ref := range []string{"blog", "ghcr.io/", "ghcr.io/blog@"} {
+		if _, _, _, err := ParseOCIReference(ref); err == nil {
+			t.Errorf("%s: expected an error", ref)
+		}
+	}
+}
+
+func TestFetchOCIArtifact(t *testing.T) {
+	payload := []byte(`{"name":"blog"}`)
+	sum := sha256.Sum256(payload)
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+
+	var srv *httptest.Server
+	srv = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			if r.URL.Query().Get("scope") != "repository:acme/blog:pull,push" {
+				http.Error(w, "bad scope", http.StatusBadRequest)
+				return
+			}
+			fmt.Fprint(w, `{"token":"anon"}`)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer anon" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+srv.URL+`/token",service="test",scope="repository:acme/blog:pull,push"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/v2/acme/blog/manifests/1.0":
+			fmt.Fprintf(w, `{"schemaVersion":2,"layers":[{"digest":%q,"size":%d}]}`, digest, len(payload))
+		case "/v2/acme/blog/blobs/" + digest:
+			w.Write(payload)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "https://")
+
+	got, err := FetchOCIArtifact(context.Background(), srv.Client(), host+"/acme/blog:1.0", 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(payload) {
+		t.Errorf("got %s", got)
+	}
+	if _, err := FetchOCIArtifact(context.Background(), srv.Client(), host+"/acme/blog:1.0", 4); err == nil {
+		t.Error("expected an artifact over the size limit to be refused")
+	}
+	if _, err := FetchOCIArtifact(context.Background(), srv.Client(), host+"/acme/blog:2.0", 1024); err == nil {
+		t.Error("expected a missing tag to fail")
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
 )
 
@@ -12,8 +14,16 @@ import (
 const MaxBatchOperations = 100
 
 // RespErr writes a structured error response to the ResponseWriter.
+// Unexpected errors are also sent to the error reporter.
 func RespErr(w http.ResponseWriter, err error) {
 	status, apiErr := BuildAPIError(err)
+	if apiErr.Code == CodeInternalError {
+		reportFromWriter(w, err)
+	}
+	var retry *RetryAfterError
+	if errors.As(err, &retry) {
+		w.Header().Set("Retry-After", strconv.Itoa(max(1, int(math.Ceil(retry.Wait.Seconds())))))
+	}
 	RespondJSON(w, status, apiErr)
 }
 
@@ -59,6 +69,66 @@ func BuildAPIError(err error) (int, APIError) {
 			Message: err.Error(),
 			Hint:    "The database requested is out of sync with its definition. Use the platform API or CLI to sync it.",
 		}
+	case errors.Is(err, ErrWritesPaused):
+		return http.StatusServiceUnavailable, APIError{
+			Code:    CodeWritesPaused,
+			Message: err.Error(),
+			Hint:    "Retry the request in a few seconds. Reads are still served.",
+		}
+	case errors.Is(err, ErrResidencyViolation):
+		return http.StatusForbidden, APIError{
+			Code:    CodeResidencyViolation,
+			Message: err.Error(),
+			Hint:    "Choose a region allowed by the residency rules of the definition and database.",
+		}
+	case errors.Is(err, ErrQueryNotAllowed):
+		return http.StatusForbidden, APIError{
+			Code:    CodeQueryNotAllowed,
+			Message: err.Error(),
+			Hint:    "Add the query shape to the definition's settings.queryAllowlist.",
+		}
+	case errors.Is(err, ErrQueryTooComplex):
+		return http.StatusBadRequest, APIError{
+			Code:    CodeQueryTooComplex,
+			Message: err.Error(),
+			Hint:    "Lower the limit, drop nested relations or split the query into smaller requests.",
+		}
+	case errors.Is(err, ErrFullScan):
+		return http.StatusBadRequest, APIError{
+			Code:    CodeFullScan,
+			Message: err.Error(),
+			Hint:    "Index the filtered columns, or send allow_full_scan=true when the server requires it.",
+		}
+	case errors.Is(err, ErrQueryInterrupted):
+		return http.StatusServiceUnavailable, APIError{
+			Code:    CodeQueryInterrupted,
+			Message: err.Error(),
+			Hint:    "An operator stopped the query while it ran. Narrow it before sending it again.",
+		}
+	case errors.Is(err, ErrQueryBudgetExceeded):
+		return http.StatusTooManyRequests, APIError{
+			Code:    CodeQueryBudgetExceeded,
+			Message: err.Error(),
+			Hint:    "The budget refills every minute. Retry later or send cheaper queries.",
+		}
+	case errors.Is(err, ErrTooManyConcurrentRequests):
+		return http.StatusTooManyRequests, APIError{
+			Code:    CodeTooManyConcurrent,
+			Message: err.Error(),
+			Hint:    "Wait for in-flight requests to finish before sending more.",
+		}
+	case errors.Is(err, ErrRateLimited):
+		return http.StatusTooManyRequests, APIError{
+			Code:    CodeRateLimited,
+			Message: err.Error(),
+			Hint:    "Slow down and retry after the number of seconds in the Retry-After header.",
+		}
+	case errors.Is(err, ErrReadOnlyRequest):
+		return http.StatusMethodNotAllowed, APIError{
+			Code:    CodeReadOnlyRequest,
+			Message: err.Error(),
+			Hint:    "GET requests and requests with Prefer: tx=read-only can't write. Send writes with POST and without tx=read-only.",
+		}
 	case errors.Is(err, ErrDefinitionNotFound):
 		return http.StatusNotFound, APIError{
 			Code:    CodeDefinitionNotFound,
@@ -105,7 +175,7 @@ func BuildAPIError(err error) (int, APIError) {
 		return http.StatusBadRequest, APIError{
 			Code:    CodeInvalidOnConflict,
 			Message: err.Error(),
-			Hint:    "For Prefer on-conflict header, \"Prefer\": \"on-conflict=\", allowed values are \"\", \"replace\", and \"ignore\"",
+			Hint:    "For Prefer on-conflict header, \"Prefer\": \"on-conflict=\", allowed values are \"\", \"replace\", and \"ignore\"; or use resolution=merge-duplicates or resolution=ignore-duplicates",
 		}
 	case errors.Is(err, ErrInvalidIdentifier),
 		errors.Is(err, ErrEmptyIdentifier),
@@ -134,6 +204,132 @@ func BuildAPIError(err error) (int, APIError) {
 			Message: err.Error(),
 			Hint:    "Split large IN clauses into multiple smaller queries.",
 		}
+	case errors.Is(err, ErrValidationFailed):
+		return http.StatusBadRequest, APIError{
+			Code:    CodeValidationFailed,
+			Message: err.Error(),
+			Hint:    "The definition's settings.validation rules describe the accepted values.",
+		}
+	case errors.Is(err, ErrExportNotFound):
+		return http.StatusNotFound, APIError{
+			Code:    CodeExportNotFound,
+			Message: err.Error(),
+			Hint:    "Export jobs are kept in memory until their download link expires and do not survive a restart.",
+		}
+	case errors.Is(err, ErrSavedQueryNotFound):
+		return http.StatusNotFound, APIError{
+			Code:    CodeSavedQueryNotFound,
+			Message: err.Error(),
+			Hint:    "List the database's saved queries with GET /data/queries.",
+		}
+	case errors.Is(err, ErrReportNotFound):
+		return http.StatusNotFound, APIError{
+			Code:    CodeReportNotFound,
+			Message: err.Error(),
+			Hint:    "List the database's reports with GET /data/reports.",
+		}
+	case errors.Is(err, ErrFunctionNotFound):
+		return http.StatusNotFound, APIError{
+			Code:    CodeFunctionNotFound,
+			Message: err.Error(),
+			Hint:    "Functions are declared in the definition's settings.functions.",
+		}
+	case errors.Is(err, ErrReadOnlyView):
+		return http.StatusMethodNotAllowed, APIError{
+			Code:    CodeReadOnlyView,
+			Message: err.Error(),
+			Hint:    "Write to the tables the view selects from.",
+		}
+	case errors.Is(err, ErrRowNotFound):
+		return http.StatusNotFound, APIError{
+			Code:    CodeRowNotFound,
+			Message: err.Error(),
+			Hint:    "Check the primary key, and that the caller's policies allow the row.",
+		}
+	case errors.Is(err, ErrAuthLockedOut):
+		return http.StatusTooManyRequests, APIError{
+			Code:    CodeAuthLockedOut,
+			Message: err.Error(),
+			Hint:    "Sign-in is locked for this email or network; retry after the number of seconds in the Retry-After header.",
+		}
+	case errors.Is(err, ErrCaptchaFailed):
+		return http.StatusBadRequest, APIError{
+			Code:    CodeCaptchaFailed,
+			Message: err.Error(),
+			Hint:    "Solve the CAPTCHA again and send its token as captcha.",
+		}
+	case errors.Is(err, ErrIdentityConflict):
+		return http.StatusConflict, APIError{
+			Code:    CodeIdentityConflict,
+			Message: err.Error(),
+			Hint:    "Sign in to the account that owns the email or provider account, then link it from there.",
+		}
+	case errors.Is(err, ErrPresenceNotFound):
+		return http.StatusNotFound, APIError{
+			Code:    CodePresenceNotFound,
+			Message: err.Error(),
+			Hint:    "Declare the channel, or a prefix ending in *, in the definition's settings.presence. State updates need the ref of one of your own members.",
+		}
+	case errors.Is(err, ErrPresenceForbidden):
+		return http.StatusForbidden, APIError{
+			Code:    CodePresenceForbidden,
+			Message: err.Error(),
+			Hint:    "The channel's settings.presence entry lists claims the caller's token must carry.",
+		}
+	case errors.Is(err, ErrPresenceFull):
+		return http.StatusConflict, APIError{
+			Code:    CodePresenceFull,
+			Message: err.Error(),
+			Hint:    "Retry once members leave, or raise the channel's maxMembers.",
+		}
+	case errors.Is(err, ErrBroadcastNotFound):
+		return http.StatusNotFound, APIError{
+			Code:    CodeBroadcastNotFound,
+			Message: err.Error(),
+			Hint:    "Declare the channel, or a prefix ending in *, in the definition's settings.broadcast.",
+		}
+	case errors.Is(err, ErrBroadcastForbidden):
+		return http.StatusForbidden, APIError{
+			Code:    CodeBroadcastForbidden,
+			Message: err.Error(),
+			Hint:    "The channel's settings.broadcast entry lists the claims subscribers and publishers must carry.",
+		}
+	case errors.Is(err, ErrSyncNotEnabled):
+		return http.StatusBadRequest, APIError{
+			Code:    CodeSyncNotEnabled,
+			Message: err.Error(),
+			Hint:    "Set sync: true on the table in the definition's schema and push a new version.",
+		}
+	case errors.Is(err, ErrObjectNotFound):
+		return http.StatusNotFound, APIError{
+			Code:    CodeObjectNotFound,
+			Message: err.Error(),
+			Hint:    "List the bucket with GET /storage/{bucket} to see the keys it holds.",
+		}
+	case errors.Is(err, ErrObjectTooLarge):
+		return http.StatusRequestEntityTooLarge, APIError{
+			Code:    CodeObjectTooLarge,
+			Message: err.Error(),
+			Hint:    "Objects are limited by ATOMICBASE_STORAGE_MAX_OBJECT_SIZE.",
+		}
+	case errors.Is(err, ErrSignedURLInvalid):
+		return http.StatusForbidden, APIError{
+			Code:    CodeSignedURLInvalid,
+			Message: err.Error(),
+			Hint:    "Request a new link with POST /storage/{bucket}/sign.",
+		}
+	case errors.Is(err, ErrBlobTooLarge):
+		return http.StatusRequestEntityTooLarge, APIError{
+			Code:    CodeBlobTooLarge,
+			Message: err.Error(),
+			Hint:    "Raise ATOMICBASE_MAX_BLOB_SIZE, or store the file elsewhere and keep its URL.",
+		}
+	case errors.Is(err, ErrInvalidCursor):
+		return http.StatusBadRequest, APIError{
+			Code:    CodeInvalidCursor,
+			Message: err.Error(),
+			Hint:    "Pass back the nextCursor of the previous page unchanged, with the same order, or an empty cursor to start over.",
+		}
 	case errors.Is(err, ErrBatchTooLarge):
 		return http.StatusBadRequest, APIError{
 			Code:    CodeBatchTooLarge,
@@ -172,6 +368,114 @@ func BuildAPIError(err error) (int, APIError) {
 			Message: err.Error(),
 			Hint:    "Wait for the current migration to complete or check job status.",
 		}
+	case errors.Is(err, ErrSmokeTestRunning):
+		return http.StatusConflict, APIError{
+			Code:    CodeSmokeTestRunning,
+			Message: err.Error(),
+			Hint:    "Wait for the running smoke test and fetch its report with GET /platform/smoke.",
+		}
+	case errors.Is(err, ErrJWTKeyNotFound):
+		return http.StatusNotFound, APIError{
+			Code:    CodeJWTKeyNotFound,
+			Message: err.Error(),
+			Hint:    "List the database's keys with GET /platform/databases/{id}/jwt-keys.",
+		}
+	case errors.Is(err, ErrAPIKeyNotFound):
+		return http.StatusNotFound, APIError{
+			Code:    CodeAPIKeyNotFound,
+			Message: err.Error(),
+			Hint:    "List the existing keys with GET /platform/keys.",
+		}
+	case errors.Is(err, ErrAPIKeyScope):
+		return http.StatusForbidden, APIError{
+			Code:    CodeAPIKeyScope,
+			Message: err.Error(),
+			Hint:    "Use a key whose tables and verbs cover the request, or create one with POST /platform/keys.",
+		}
+	case errors.Is(err, ErrWebhookNotFound):
+		return http.StatusNotFound, APIError{
+			Code:    CodeWebhookNotFound,
+			Message: err.Error(),
+			Hint:    "List the database's webhooks with GET /platform/databases/{id}/webhooks.",
+		}
+	case errors.Is(err, ErrActiveQueryNotFound):
+		return http.StatusNotFound, APIError{
+			Code:    CodeActiveQueryNotFound,
+			Message: err.Error(),
+			Hint:    "The query may have finished. Queries are listed per server instance with GET /platform/databases/{id}/queries.",
+		}
+	case errors.Is(err, ErrBackupNotFound):
+		return http.StatusNotFound, APIError{
+			Code:    CodeBackupNotFound,
+			Message: err.Error(),
+			Hint:    "List a database's backups with GET /platform/backups?database={id}.",
+		}
+	case errors.Is(err, ErrChecksumMismatch):
+		return http.StatusConflict, APIError{
+			Code:    CodeChecksumMismatch,
+			Message: err.Error(),
+			Hint:    "The source changed since it was pinned. Preview it with GET /platform/definitions/{name}/pull and pin the sha256 it reports.",
+		}
+	case errors.Is(err, ErrQuotaExceeded):
+		return http.StatusForbidden, APIError{
+			Code:    CodeQuotaExceeded,
+			Message: err.Error(),
+			Hint:    "Delete unused ones, raise the limit, or retry with an API key that has the override_quotas verb.",
+		}
+	case errors.Is(err, ErrOrgNotFound):
+		return http.StatusNotFound, APIError{
+			Code:    CodeOrgNotFound,
+			Message: err.Error(),
+			Hint:    "List the platform organizations with GET /platform/orgs.",
+		}
+	case errors.Is(err, ErrOrgExists):
+		return http.StatusConflict, APIError{
+			Code:    CodeOrgExists,
+			Message: err.Error(),
+			Hint:    "Choose a different id or name.",
+		}
+	case errors.Is(err, ErrOrgNotEmpty):
+		return http.StatusConflict, APIError{
+			Code:    CodeOrgNotEmpty,
+			Message: err.Error(),
+			Hint:    "Move or remove the organization's definitions before deleting it.",
+		}
+	case errors.Is(err, ErrOrgMemberNotFound):
+		return http.StatusNotFound, APIError{
+			Code:    CodeOrgMemberNotFound,
+			Message: err.Error(),
+			Hint:    "List the organization's members with GET /platform/orgs/{id}/members.",
+		}
+	case errors.Is(err, ErrOrgInvitationNotFound):
+		return http.StatusNotFound, APIError{
+			Code:    CodeOrgInvitationNotFound,
+			Message: err.Error(),
+			Hint:    "Ask an organization admin for a new invitation.",
+		}
+	case errors.Is(err, ErrServiceAccountNotFound):
+		return http.StatusNotFound, APIError{
+			Code:    CodeServiceAccountNotFound,
+			Message: err.Error(),
+			Hint:    "List the existing service accounts with GET /platform/service-accounts.",
+		}
+	case errors.Is(err, ErrServiceAccountExists):
+		return http.StatusConflict, APIError{
+			Code:    CodeServiceAccountExists,
+			Message: err.Error(),
+			Hint:    "Generate a new key pair for each service account.",
+		}
+	case errors.Is(err, ErrAdminLoginFailed):
+		return http.StatusUnauthorized, APIError{
+			Code:    CodeAdminLoginFailed,
+			Message: err.Error(),
+			Hint:    "Sign in with the service key or an email allowed by ATOMICBASE_ADMIN_OIDC_EMAILS.",
+		}
+	case errors.Is(err, ErrCSRFTokenInvalid):
+		return http.StatusForbidden, APIError{
+			Code:    CodeCSRFTokenInvalid,
+			Message: err.Error(),
+			Hint:    "Send the value of the " + CSRFCookie + " cookie in the " + CSRFHeader + " header.",
+		}
 	case errors.Is(err, ErrDatabaseExists):
 		return http.StatusConflict, APIError{
 			Code:    CodeDatabaseExists,
@@ -227,30 +531,20 @@ func BuildAPIError(err error) (int, APIError) {
 			Message: err.Error(),
 			Hint:    "Create an FTS5 index on this table before using full-text search. See documentation for FTS setup.",
 		}
-	case strings.Contains(err.Error(), "UNIQUE constraint failed"):
-		return http.StatusConflict, APIError{
-			Code:    CodeUniqueViolation,
-			Message: "record already exists",
-			Hint:    "A record with this unique value already exists. Use upsert (on-conflict=replace) to update existing records.",
-		}
-	case strings.Contains(err.Error(), "FOREIGN KEY constraint failed"):
-		return http.StatusBadRequest, APIError{
-			Code:    CodeForeignKeyViolation,
-			Message: "foreign key constraint violation",
-			Hint:    "The referenced record does not exist. Ensure the foreign key value points to an existing record.",
-		}
-	case strings.Contains(err.Error(), "NOT NULL constraint failed"):
-		return http.StatusBadRequest, APIError{
-			Code:    CodeNotNullViolation,
-			Message: "required field is missing",
-			Hint:    "One or more required fields were not provided. Check your request body for missing columns.",
-		}
+	case ParseConstraintError(err) != nil:
+		return constraintAPIError(ParseConstraintError(err))
 	case strings.Contains(err.Error(), "no such table"):
 		return http.StatusNotFound, APIError{
 			Code:    CodeTableNotFound,
 			Message: "table not found",
 			Hint:    "The table may not exist or the schema cache may be stale. Use POST /data/schema/invalidate to update the cache.",
 		}
+	case strings.Contains(err.Error(), "ON CONFLICT clause does not match any PRIMARY KEY or UNIQUE constraint"):
+		return http.StatusBadRequest, APIError{
+			Code:    CodeInvalidOnConflict,
+			Message: "on_conflict columns are not a primary key or unique constraint",
+			Hint:    "Name exactly the columns of a primary key or unique index, e.g. ?on_conflict=email.",
+		}
 	case strings.Contains(err.Error(), "no such column"):
 		return http.StatusBadRequest, APIError{
 			Code:    CodeColumnNotFound,
@@ -147,21 +147,21 @@ func TestBuildAPIError(t *testing.T) {
 			err:        errors.New("UNIQUE constraint failed: users.email"),
 			wantStatus: http.StatusConflict,
 			wantCode:   CodeUniqueViolation,
-			wantMsg:    "record already exists",
+			wantMsg:    "record already exists: users.email must be unique",
 		},
 		{
 			name:       "foreign key constraint string match",
 			err:        errors.New("FOREIGN KEY constraint failed"),
-			wantStatus: http.StatusBadRequest,
+			wantStatus: http.StatusConflict,
 			wantCode:   CodeForeignKeyViolation,
 			wantMsg:    "foreign key constraint violation",
 		},
 		{
 			name:       "not null constraint string match",
 			err:        errors.New("NOT NULL constraint failed: users.name"),
-			wantStatus: http.StatusBadRequest,
+			wantStatus: http.StatusUnprocessableEntity,
 			wantCode:   CodeNotNullViolation,
-			wantMsg:    "required field is missing",
+			wantMsg:    "required field is missing: users.name cannot be null",
 		},
 		{
 			name:       "no such table string match",
@@ -0,0 +1,161 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/atombasedev/atombase/config"
+)
+
+// SignatureScheme starts the Authorization header of a request signed by a
+// service account:
+//
+//	Authorization: Signature account="<id>",timestamp="<unix seconds>",signature="<base64>"
+//
+// The signature is Ed25519 over SignatureMessage.
+const SignatureScheme = "Signature "
+
+// MaxSignatureSkew is how far a signed request's timestamp may be from the
+// server's clock. A signature is accepted once within that window.
+const MaxSignatureSkew = 5 * time.Minute
+
+// ServiceAccountLookup resolves a service account id to its public key and
+// scope, failing when the account does not exist.
+type ServiceAccountLookup func(ctx context.Context, id string) (ed25519.PublicKey, *APIKeyScope, error)
+
+// SignatureMessage is what a service account signs: the method, the request
+// URI with its query, the timestamp and the hex SHA-256 of the body, one per
+// line.
+func SignatureMessage(method, requestURI, timestamp string, body []byte) []byte {
+	sum := sha256.Sum256(body)
+	return []byte(strings.Join([]string{strings.ToUpper(method), requestURI, timestamp, hex.EncodeToString(sum[:])}, "\n"))
+}
+
+// SignRequest signs req as account with key, reading and restoring its body.
+func SignRequest(req *http.Request, account string, key ed25519.PrivateKey, now time.Time) error {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return err
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	signature := ed25519.Sign(key, SignatureMessage(req.Method, req.URL.RequestURI(), timestamp, body))
+	req.Header.Set("Authorization", fmt.Sprintf(`%saccount="%s",timestamp="%s",signature="%s"`,
+		SignatureScheme, account, timestamp, base64.StdEncoding.EncodeToString(signature)))
+	return nil
+}
+
+// parseSignatureHeader reads the comma separated key="value" pairs after the
+// scheme.
+func parseSignatureHeader(value string) (map[string]string, bool) {
+	params := map[string]string{}
+	for _, part := range strings.Split(strings.TrimPrefix(value, SignatureScheme), ",") {
+		key, raw, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return nil, false
+		}
+		unquoted, err := strconv.Unquote(raw)
+		if err != nil {
+			return nil, false
+		}
+		params[key] = unquoted
+	}
+	return params, params["account"] != "" && params["timestamp"] != "" && params["signature"] != ""
+}
+
+// authenticateSignature verifies a signed request, answering 401 when it
+// cannot. The body is read to be hashed and put back for the handler.
+func authenticateSignature(w http.ResponseWriter, r *http.Request, lookup ServiceAccountLookup) (*APIKeyScope, bool) {
+	if lookup == nil {
+		respondUnauthorized(w, "service accounts not configured")
+		return nil, false
+	}
+	params, ok := parseSignatureHeader(r.Header.Get("Authorization"))
+	if !ok {
+		respondUnauthorized(w, "invalid signature header")
+		return nil, false
+	}
+	seconds, err := strconv.ParseInt(params["timestamp"], 10, 64)
+	if err != nil {
+		respondUnauthorized(w, "invalid signature timestamp")
+		return nil, false
+	}
+	now := time.Now()
+	signedAt := time.Unix(seconds, 0)
+	if signedAt.Before(now.Add(-MaxSignatureSkew)) || signedAt.After(now.Add(MaxSignatureSkew)) {
+		respondUnauthorized(w, "signature timestamp is outside the allowed window")
+		return nil, false
+	}
+	signature, err := base64.StdEncoding.Strict().DecodeString(params["signature"])
+	if err != nil || len(signature) != ed25519.SignatureSize {
+		respondUnauthorized(w, "invalid signature")
+		return nil, false
+	}
+
+	var body []byte
+	if r.Body != nil {
+		body, err = io.ReadAll(io.LimitReader(r.Body, config.Cfg.MaxRequestBody+1))
+		r.Body.Close()
+		if err != nil {
+			respondUnauthorized(w, "failed to read request body")
+			return nil, false
+		}
+		if int64(len(body)) > config.Cfg.MaxRequestBody {
+			respondUnauthorized(w, "request body too large to verify")
+			return nil, false
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	publicKey, scope, err := lookup(r.Context(), params["account"])
+	if err != nil || len(publicKey) != ed25519.PublicKeySize || !ed25519.Verify(publicKey, SignatureMessage(r.Method, r.URL.RequestURI(), params["timestamp"], body), signature) {
+		respondUnauthorized(w, "invalid signature")
+		return nil, false
+	}
+	if !usedSignatures.claim(string(signature), signedAt.Add(MaxSignatureSkew)) {
+		respondUnauthorized(w, "signature already used")
+		return nil, false
+	}
+	return scope, true
+}
+
+// signatureCache remembers the signatures accepted within the skew window so
+// a captured request cannot be replayed.
+type signatureCache struct {
+	mu   sync.Mutex
+	seen map[string]time.Time // signature -> when it leaves the window
+}
+
+var usedSignatures = &signatureCache{seen: map[string]time.Time{}}
+
+// claim records signature until expires and reports whether it was new.
+func (c *signatureCache) claim(signature string, expires time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	for seen, until := range c.seen {
+		if now.After(until) {
+			delete(c.seen, seen)
+		}
+	}
+	if _, ok := c.seen[signature]; ok {
+		return false
+	}
+	c.seen[signature] = expires
+	return true
+}
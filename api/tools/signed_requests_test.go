@@ -0,0 +1,91 @@
+package tools
+
+import (
+	"context"
+	"crypto/ed25519"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const base64Alphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+
+func TestSignedAuthMiddleware(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accounts := func(ctx context.Context, id string) (ed25519.PublicKey, *APIKeyScope, error) {
+		if id != "sa_robot" {
+			return nil, nil, ErrServiceAccountNotFound
+		}
+		return publicKey, &APIKeyScope{KeyID: id, Verbs: []string{VerbRead, VerbWrite, VerbAdmin}}, nil
+	}
+	var gotBody string
+	var gotAuth AuthContext
+	handler := SignedAuthMiddleware(nil, accounts)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotBody, gotAuth = string(body), GetAuthContext(r.Context())
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	signed := func(account, body string, at time.Time) *http.Request {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/platform/definitions?dry_run=true", strings.NewReader(body))
+		if err := SignRequest(req, account, privateKey, at); err != nil {
+			t.Fatal(err)
+		}
+		return req
+	}
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	req := signed("sa_robot", `{"name": "shop"}`, time.Now())
+	if rec := serve(req); rec.Code != http.StatusNoContent {
+		t.Fatalf("expected a signed request to pass, got %d %s", rec.Code, rec.Body.String())
+	}
+	if gotBody != `{"name": "shop"}` || gotAuth.Role != RoleService || gotAuth.Scope == nil || gotAuth.Scope.KeyID != "sa_robot" {
+		t.Fatalf("expected the body and account scope to reach the handler, got %q %+v", gotBody, gotAuth)
+	}
+
+	replay := httptest.NewRequest(http.MethodPost, "/platform/definitions?dry_run=true", strings.NewReader(`{"name": "shop"}`))
+	replay.Header.Set("Authorization", req.Header.Get("Authorization"))
+	if rec := serve(replay); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected a replayed signature to be refused, got %d", rec.Code)
+	}
+
+	// Flipping the unused low bits of the last base64 digit encodes the same
+	// signature differently; it must neither decode nor dodge the replay cache.
+	header := req.Header.Get("Authorization")
+	at := strings.Index(header, "==\"") - 1
+	digit := strings.IndexByte(base64Alphabet, header[at]) ^ 1
+	reencoded := httptest.NewRequest(http.MethodPost, "/platform/definitions?dry_run=true", strings.NewReader(`{"name": "shop"}`))
+	reencoded.Header.Set("Authorization", header[:at]+base64Alphabet[digit:digit+1]+header[at+1:])
+	if rec := serve(reencoded); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected a re-encoded signature to be refused, got %d", rec.Code)
+	}
+
+	tampered := signed("sa_robot", `{"name": "shop"}`, time.Now().Add(time.Second))
+	tampered.Body = io.NopCloser(strings.NewReader(`{"name": "evil"}`))
+	if rec := serve(tampered); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected a tampered body to be refused, got %d", rec.Code)
+	}
+
+	if rec := serve(signed("sa_robot", `{}`, time.Now().Add(-2*MaxSignatureSkew))); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected a stale signature to be refused, got %d", rec.Code)
+	}
+	if rec := serve(signed("sa_other", `{}`, time.Now())); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected an unknown account to be refused, got %d", rec.Code)
+	}
+
+	malformed := httptest.NewRequest(http.MethodGet, "/platform/definitions", nil)
+	malformed.Header.Set("Authorization", `Signature account="sa_robot"`)
+	if rec := serve(malformed); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected a malformed header to be refused, got %d", rec.Code)
+	}
+}
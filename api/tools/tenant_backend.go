@@ -0,0 +1,175 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/atombasedev/atombase/config"
+)
+
+// Tenant backends ATOMICBASE_TENANT_BACKEND selects between.
+const (
+	TenantBackendTurso = "turso"
+	TenantBackendD1    = "d1"
+	TenantBackendLocal = "local"
+)
+
+// localTenantToken stands in for a database token on the local backend, where
+// databases are files and need no credentials.
+const localTenantToken = "local"
+
+// TenantBackend creates and deletes tenant databases and says how to open
+// them.
+type TenantBackend interface {
+	// CreateDatabase makes an empty database. group is where Turso places it;
+	// backends without placement ignore it.
+	CreateDatabase(ctx context.Context, name, group string) error
+	// DeleteDatabase removes a database and closes its pooled handles.
+	DeleteDatabase(ctx context.Context, name string) error
+	// CreateToken issues the token stored with a database and passed to DSN.
+	CreateToken(ctx context.Context, name string) (string, error)
+	// DSN returns the driver and data source name a database opens with.
+	DSN(name, token string) (driver, dsn string, err error)
+}
+
+// TenantBatcher is implemented by backends that apply a batch of statements,
+// such as a new database's schema, in one request of their own rather than
+// through a database handle.
+type TenantBatcher interface {
+	ExecBatch(ctx context.Context, name, token string, statements []string) error
+}
+
+// TenantTokenRevoker is implemented by backends whose tokens are credentials
+// that stay valid until revoked. Turso can only revoke a database's tokens
+// all together, by rotating its signing key.
+type TenantTokenRevoker interface {
+	RevokeTokens(ctx context.Context, name string) error
+}
+
+// Tenants returns the backend tenant databases live on: local SQLite files
+// with ATOMICBASE_TENANT_BACKEND=local or ATOMICBASE_LOCAL_TENANT_DIR set,
+// Cloudflare D1 with ATOMICBASE_TENANT_BACKEND=d1, otherwise Turso.
+func Tenants() TenantBackend {
+	if LocalTenants() {
+		return localTenantBackend{}
+	}
+	if config.Cfg.TenantBackend == TenantBackendD1 {
+		return d1TenantBackend{}
+	}
+	return tursoTenantBackend{}
+}
+
+// localTenantBackend keeps each tenant database as a SQLite file in the
+// local tenant directory, so a server can run without Turso.
+type localTenantBackend struct{}
+
+func (localTenantBackend) CreateDatabase(ctx context.Context, name, group string) error {
+	if err := os.MkdirAll(localTenantDir(), 0o755); err != nil {
+		return err
+	}
+	if _, err := os.Stat(LocalTenantPath(name)); err == nil {
+		return fmt.Errorf("local database %s already exists", name)
+	}
+	_, dsn, _ := localTenantBackend{}.DSN(name, "")
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	_, err = db.ExecContext(ctx, `PRAGMA journal_mode = WAL`)
+	return err
+}
+
+func (localTenantBackend) DeleteDatabase(ctx context.Context, name string) error {
+	return RemoveLocalTenant(name)
+}
+
+func (localTenantBackend) CreateToken(ctx context.Context, name string) (string, error) {
+	return localTenantToken, nil
+}
+
+// DSN begins transactions IMMEDIATE, taking the write lock up front: two
+// deferred transactions that both read and then write can't both upgrade
+// their locks, and one would fail with SQLITE_BUSY however long the busy
+// timeout.
+func (localTenantBackend) DSN(name, token string) (string, string, error) {
+	return "sqlite3", "file:" + LocalTenantPath(name) + "?_busy_timeout=10000&_foreign_keys=on&_txlock=immediate", nil
+}
+
+// tursoTenantBackend hosts each tenant as a Turso database of its own,
+// managed through the Turso platform API.
+type tursoTenantBackend struct{}
+
+func (tursoTenantBackend) CreateDatabase(ctx context.Context, name, group string) error {
+	url := fmt.Sprintf("https://api.turso.tech/v1/organizations/%s/databases", config.Cfg.TursoOrganization)
+	body, _ := json.Marshal(map[string]any{"name": name, "group": group})
+	return doTursoJSON(ctx, http.MethodPost, url, body, nil)
+}
+
+func (tursoTenantBackend) DeleteDatabase(ctx context.Context, name string) error {
+	EvictTenantDB(name)
+	RemoveTenantReplica(name)
+	url := fmt.Sprintf("https://api.turso.tech/v1/organizations/%s/databases/%s", config.Cfg.TursoOrganization, name)
+	return doTursoJSON(ctx, http.MethodDelete, url, nil, nil)
+}
+
+func (tursoTenantBackend) CreateToken(ctx context.Context, name string) (string, error) {
+	url := fmt.Sprintf("https://api.turso.tech/v1/organizations/%s/databases/%s/auth/tokens", config.Cfg.TursoOrganization, name)
+	var resp struct {
+		JWT string `json:"jwt"`
+	}
+	if err := doTursoJSON(ctx, http.MethodPost, url, []byte(`{"authorization":"full-access"}`), &resp); err != nil {
+		return "", err
+	}
+	return resp.JWT, nil
+}
+
+func (tursoTenantBackend) RevokeTokens(ctx context.Context, name string) error {
+	url := fmt.Sprintf("https://api.turso.tech/v1/organizations/%s/databases/%s/auth/rotate", config.Cfg.TursoOrganization, name)
+	return doTursoJSON(ctx, http.MethodPost, url, nil, nil)
+}
+
+func (tursoTenantBackend) DSN(name, token string) (string, string, error) {
+	org := config.Cfg.TursoOrganization
+	if org == "" {
+		return "", "", errors.New("TURSO_ORGANIZATION environment variable is not set but is required to access external databases")
+	}
+	return "libsql", fmt.Sprintf("libsql://%s-%s.turso.io?authToken=%s", name, org, token), nil
+}
+
+// doTursoJSON calls the Turso platform API and decodes its JSON reply into
+// out, when given.
+func doTursoJSON(ctx context.Context, method, url string, body []byte, out any) error {
+	if err := InjectFault(ctx, FaultTursoAPI); err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+config.Cfg.TursoAPIKey)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := TursoHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		data, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("turso api returned %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
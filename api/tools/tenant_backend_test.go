@@ -0,0 +1,76 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/atombasedev/atombase/config"
+)
+
+func TestTenants_Backend(t *testing.T) {
+	original := config.Cfg
+	defer func() { config.Cfg = original }()
+
+	tests := []struct {
+		backend, dir string
+		local        bool
+	}{
+		{"", "", false},
+		{"", "/tmp/tenants", true},
+		{"local", "", true},
+		{"turso", "/tmp/tenants", false},
+	}
+	for _, tt := range tests {
+		config.Cfg.TenantBackend, config.Cfg.LocalTenantDir = tt.backend, tt.dir
+		_, local := Tenants().(localTenantBackend)
+		if local != tt.local {
+			t.Errorf("backend %q dir %q: local = %v, want %v", tt.backend, tt.dir, local, tt.local)
+		}
+	}
+
+	config.Cfg.TenantBackend, config.Cfg.LocalTenantDir, config.Cfg.DataDir = "local", "", "atomicdata"
+	if got, want := LocalTenantPath("acme"), filepath.Join("atomicdata", "tenants", "acme.db"); got != want {
+		t.Errorf("LocalTenantPath = %q, want %q", got, want)
+	}
+}
+
+func TestLocalTenantBackend(t *testing.T) {
+	original := config.Cfg
+	defer func() { config.Cfg = original }()
+	config.Cfg.TenantBackend, config.Cfg.LocalTenantDir, config.Cfg.DataDir = TenantBackendLocal, "", t.TempDir()
+	ctx := context.Background()
+	backend := Tenants()
+
+	if err := backend.CreateDatabase(ctx, "acme", "default"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(config.Cfg.DataDir, "tenants", "acme.db")); err != nil {
+		t.Fatalf("expected the database file: %v", err)
+	}
+	if err := backend.CreateDatabase(ctx, "acme", "default"); err == nil {
+		t.Fatal("expected creating an existing database to fail")
+	}
+
+	token, err := backend.CreateToken(ctx, "acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := OpenTenantDB("acme", token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`CREATE TABLE notes (id INTEGER PRIMARY KEY)`); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	if err := backend.DeleteDatabase(ctx, "acme"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(LocalTenantPath("acme")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected the database file to be removed, got %v", err)
+	}
+}
@@ -0,0 +1,133 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/atombasedev/atombase/config"
+)
+
+// d1APIBase is the Cloudflare API the d1 backend calls, swapped out by tests.
+var d1APIBase = "https://api.cloudflare.com/client/v4"
+
+// D1HTTPClient sends requests to the Cloudflare D1 API.
+var D1HTTPClient = &http.Client{Timeout: 30 * time.Second}
+
+// d1TenantBackend hosts each tenant as a Cloudflare D1 database. D1 names
+// databases by UUID, which stands in for the database token: CreateToken
+// looks it up and DSN opens the database by it.
+type d1TenantBackend struct{}
+
+type d1Database struct {
+	UUID string `json:"uuid"`
+	Name string `json:"name"`
+}
+
+// CreateDatabase ignores group; D1 places databases itself.
+func (d1TenantBackend) CreateDatabase(ctx context.Context, name, group string) error {
+	body, _ := json.Marshal(map[string]any{"name": name})
+	return doD1JSON(ctx, http.MethodPost, "/d1/database", body, nil)
+}
+
+func (d1TenantBackend) DeleteDatabase(ctx context.Context, name string) error {
+	EvictTenantDB(name)
+	RemoveTenantReplica(name)
+	uuid, err := d1DatabaseUUID(ctx, name)
+	if err != nil {
+		return err
+	}
+	return doD1JSON(ctx, http.MethodDelete, "/d1/database/"+uuid, nil, nil)
+}
+
+func (d1TenantBackend) CreateToken(ctx context.Context, name string) (string, error) {
+	return d1DatabaseUUID(ctx, name)
+}
+
+func (d1TenantBackend) DSN(name, token string) (string, string, error) {
+	if token == "" {
+		return "", "", fmt.Errorf("d1 database %s has no uuid stored", name)
+	}
+	return "d1", token, nil
+}
+
+// ExecBatch applies statements in one request, which D1 runs as a single
+// transaction.
+func (d1TenantBackend) ExecBatch(ctx context.Context, name, token string, statements []string) error {
+	batch := make([]d1Statement, len(statements))
+	for i, statement := range statements {
+		batch[i] = d1Statement{SQL: statement}
+	}
+	if _, err := d1Query(ctx, token, batch); err != nil {
+		return fmt.Errorf("batch on %s failed: %w", name, err)
+	}
+	return nil
+}
+
+// d1DatabaseUUID looks up the UUID of the database called name.
+func d1DatabaseUUID(ctx context.Context, name string) (string, error) {
+	var databases []d1Database
+	if err := doD1JSON(ctx, http.MethodGet, "/d1/database?name="+url.QueryEscape(name), nil, &databases); err != nil {
+		return "", err
+	}
+	for _, db := range databases {
+		if db.Name == name {
+			return db.UUID, nil
+		}
+	}
+	return "", fmt.Errorf("d1 database %s not found", name)
+}
+
+// doD1JSON calls an account endpoint of the D1 API and decodes the result of
+// its reply into out, when given.
+func doD1JSON(ctx context.Context, method, path string, body []byte, out any) error {
+	endpoint := fmt.Sprintf("%s/accounts/%s%s", d1APIBase, config.Cfg.CloudflareAccountID, path)
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+config.Cfg.CloudflareAPIToken)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := D1HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	var envelope struct {
+		Success bool `json:"success"`
+		Errors  []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return fmt.Errorf("d1 api returned %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	if resp.StatusCode >= 300 || !envelope.Success {
+		messages := make([]string, len(envelope.Errors))
+		for i, e := range envelope.Errors {
+			messages[i] = e.Message
+		}
+		if len(messages) == 0 {
+			return fmt.Errorf("d1 api returned %d", resp.StatusCode)
+		}
+		return errors.New("d1: " + strings.Join(messages, "; "))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(envelope.Result, out)
+}
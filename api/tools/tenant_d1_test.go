@@ -0,0 +1,262 @@
+package tools
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/atombasedev/atombase/config"
+)
+
+// fakeD1 serves the D1 endpoints the d1 backend calls, running queries on
+// SQLite databases in memory.
+type fakeD1 struct {
+	t         *testing.T
+	databases map[string]*sql.DB // By uuid
+	names     map[string]string  // uuid by name
+	requests  int                // Query requests
+}
+
+func newFakeD1(t *testing.T) *fakeD1 {
+	f := &fakeD1{t: t, databases: map[string]*sql.DB{}, names: map[string]string{}}
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+
+	original, originalBase := config.Cfg, d1APIBase
+	t.Cleanup(func() { config.Cfg, d1APIBase = original, originalBase })
+	config.Cfg.TenantBackend, config.Cfg.LocalTenantDir = TenantBackendD1, ""
+	config.Cfg.CloudflareAccountID, config.Cfg.CloudflareAPIToken = "acct", "secret"
+	config.Cfg.TenantPoolSize = 0
+	d1APIBase = server.URL
+	return f
+}
+
+func (f *fakeD1) reply(w http.ResponseWriter, result any, err error) {
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]any{"success": false, "errors": []map[string]any{{"code": 7500, "message": err.Error()}}})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]any{"success": true, "errors": []any{}, "result": result})
+}
+
+func (f *fakeD1) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		f.reply(w, nil, fmt.Errorf("unauthorized"))
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/accounts/acct/d1/database")
+	switch {
+	case r.Method == http.MethodPost && path == "":
+		var body struct{ Name string }
+		json.NewDecoder(r.Body).Decode(&body)
+		if _, ok := f.names[body.Name]; ok {
+			f.reply(w, nil, fmt.Errorf("database already exists"))
+			return
+		}
+		db, err := sql.Open("sqlite3", ":memory:")
+		if err != nil {
+			f.t.Fatal(err)
+		}
+		db.SetMaxOpenConns(1)
+		uuid := fmt.Sprintf("uuid-%d", len(f.databases)+1)
+		f.databases[uuid], f.names[body.Name] = db, uuid
+		f.reply(w, d1Database{UUID: uuid, Name: body.Name}, nil)
+	case r.Method == http.MethodGet && path == "":
+		list := []d1Database{}
+		if uuid, ok := f.names[r.URL.Query().Get("name")]; ok {
+			list = append(list, d1Database{UUID: uuid, Name: r.URL.Query().Get("name")})
+		}
+		f.reply(w, list, nil)
+	case r.Method == http.MethodDelete:
+		uuid := strings.TrimPrefix(path, "/")
+		for name, id := range f.names {
+			if id == uuid {
+				delete(f.names, name)
+			}
+		}
+		delete(f.databases, uuid)
+		f.reply(w, nil, nil)
+	case r.Method == http.MethodPost && strings.HasSuffix(path, "/raw"):
+		f.requests++
+		db := f.databases[strings.TrimSuffix(strings.TrimPrefix(path, "/"), "/raw")]
+		var body struct {
+			d1Statement
+			Batch []d1Statement `json:"batch"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		if body.Batch == nil {
+			body.Batch = []d1Statement{body.d1Statement}
+		}
+		results, err := f.run(db, body.Batch)
+		f.reply(w, results, err)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		f.reply(w, nil, fmt.Errorf("not found"))
+	}
+}
+
+// run executes a request's statements in one transaction.
+func (f *fakeD1) run(db *sql.DB, statements []d1Statement) ([]map[string]any, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	var results []map[string]any
+	for _, statement := range statements {
+		rows, err := tx.Query(statement.SQL, statement.Params...)
+		if err != nil {
+			return nil, err
+		}
+		columns, _ := rows.Columns()
+		out := [][]any{}
+		for rows.Next() {
+			values := make([]any, len(columns))
+			ptrs := make([]any, len(columns))
+			for i := range values {
+				ptrs[i] = &values[i]
+			}
+			rows.Scan(ptrs...)
+			for i, v := range values {
+				if blob, ok := v.([]byte); ok {
+					octets := make([]int, len(blob))
+					for j, b := range blob {
+						octets[j] = int(b)
+					}
+					values[i] = octets // D1 returns blobs as arrays of bytes.
+				}
+			}
+			out = append(out, values)
+		}
+		rows.Close()
+		var changes, lastID int64
+		tx.QueryRow(`SELECT changes(), last_insert_rowid()`).Scan(&changes, &lastID)
+		results = append(results, map[string]any{
+			"results": map[string]any{"columns": columns, "rows": out},
+			"meta":    map[string]any{"changes": changes, "last_row_id": lastID},
+		})
+	}
+	return results, tx.Commit()
+}
+
+func TestD1TenantBackend(t *testing.T) {
+	f := newFakeD1(t)
+	ctx := context.Background()
+	backend := Tenants()
+	if _, ok := backend.(d1TenantBackend); !ok {
+		t.Fatalf("expected the d1 backend, got %T", backend)
+	}
+
+	if err := backend.CreateDatabase(ctx, "acme", "default"); err != nil {
+		t.Fatal(err)
+	}
+	if err := backend.CreateDatabase(ctx, "acme", "default"); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("expected D1's error, got %v", err)
+	}
+	token, err := backend.CreateToken(ctx, "acme")
+	if err != nil || token != "uuid-1" {
+		t.Fatalf("expected the database uuid as token, got %q, %v", token, err)
+	}
+	batch := []string{`CREATE TABLE notes (id INTEGER PRIMARY KEY, title TEXT)`, `INSERT INTO notes (title) VALUES ('schema')`}
+	if err := backend.(TenantBatcher).ExecBatch(ctx, "acme", token, batch); err != nil {
+		t.Fatal(err)
+	}
+	if f.requests != 1 {
+		t.Errorf("expected the batch in one request, sent %d", f.requests)
+	}
+
+	if err := backend.DeleteDatabase(ctx, "acme"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := backend.CreateToken(ctx, "acme"); err == nil {
+		t.Fatal("expected the database to be gone")
+	}
+}
+
+func TestD1Driver(t *testing.T) {
+	f := newFakeD1(t)
+	ctx := context.Background()
+	if err := Tenants().CreateDatabase(ctx, "acme", ""); err != nil {
+		t.Fatal(err)
+	}
+	db, err := OpenTenantDB("acme", "uuid-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`CREATE TABLE notes (id INTEGER PRIMARY KEY, title TEXT, score REAL, data BLOB)`); err != nil {
+		t.Fatal(err)
+	}
+	result, err := db.Exec(`INSERT INTO notes (title, score, data) VALUES (?, ?, x'0102')`, "first", 1.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, err := result.LastInsertId(); err != nil || id != 1 {
+		t.Fatalf("LastInsertId = %d, %v", id, err)
+	}
+	var id int64
+	var title string
+	var score float64
+	var data []byte
+	if err := db.QueryRow(`SELECT id, title, score, data FROM notes`).Scan(&id, &title, &score, &data); err != nil {
+		t.Fatal(err)
+	}
+	if id != 1 || title != "first" || score != 1.5 || string(data) != "\x01\x02" {
+		t.Fatalf("unexpected row %d %q %v %v", id, title, score, data)
+	}
+	if _, err := db.Exec(`SELECT ?`, []byte("blob")); err == nil {
+		t.Error("expected blob parameters to be refused")
+	}
+
+	// A transaction's writes go in one request on commit.
+	requests := f.requests
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.Exec(`INSERT INTO notes (title) VALUES ('second')`)
+	tx.Exec(`INSERT INTO notes (title) VALUES ('third')`)
+	if f.requests != requests {
+		t.Fatal("expected writes held until commit")
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if f.requests != requests+1 {
+		t.Fatalf("expected one request on commit, sent %d", f.requests-requests)
+	}
+
+	// A rolled back transaction sends nothing.
+	tx, _ = db.Begin()
+	tx.Exec(`DELETE FROM notes`)
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A read in a transaction sees its writes, which are then sent.
+	tx, _ = db.Begin()
+	res, _ := tx.Exec(`UPDATE notes SET title = 'updated' WHERE id = 1`)
+	var count int
+	if err := tx.QueryRow(`SELECT count(*) FROM notes WHERE title = 'updated'`).Scan(&count); err != nil || count != 1 {
+		t.Fatalf("expected the read to see the write, got %d, %v", count, err)
+	}
+	if n, err := res.RowsAffected(); err != nil || n != 1 {
+		t.Fatalf("RowsAffected = %d, %v", n, err)
+	}
+	if err := tx.Rollback(); err != errD1Sent {
+		t.Fatalf("expected rolling back sent writes to fail, got %v", err)
+	}
+
+	if err := db.QueryRow(`SELECT count(*) FROM notes`).Scan(&count); err != nil || count != 3 {
+		t.Fatalf("expected 3 notes, got %d, %v", count, err)
+	}
+}
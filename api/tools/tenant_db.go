@@ -0,0 +1,74 @@
+package tools
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/atombasedev/atombase/config"
+	_ "github.com/mattn/go-sqlite3"
+	_ "github.com/tursodatabase/libsql-client-go/libsql"
+)
+
+// LocalTenants reports whether tenant databases are SQLite files on the local
+// backend instead of Turso databases: ATOMICBASE_TENANT_BACKEND is local, or
+// it is unset and ATOMICBASE_LOCAL_TENANT_DIR is not.
+func LocalTenants() bool {
+	switch config.Cfg.TenantBackend {
+	case TenantBackendLocal:
+		return true
+	case "":
+		return config.Cfg.LocalTenantDir != ""
+	}
+	return false
+}
+
+// localTenantDir is where the local backend keeps its files:
+// ATOMICBASE_LOCAL_TENANT_DIR, or tenants in DATA_DIR.
+func localTenantDir() string {
+	if config.Cfg.LocalTenantDir != "" {
+		return config.Cfg.LocalTenantDir
+	}
+	return filepath.Join(config.Cfg.DataDir, "tenants")
+}
+
+// LocalTenantPath returns the file backing a tenant database on the local
+// backend.
+func LocalTenantPath(name string) string {
+	return filepath.Join(localTenantDir(), name+".db")
+}
+
+// OpenTenantDB opens a tenant database on the configured backend with its
+// per-database token.
+func OpenTenantDB(name, token string) (*sql.DB, error) {
+	driver, dsn, err := tenantDSN(name, token)
+	if err != nil {
+		return nil, err
+	}
+	return sql.Open(driver, dsn)
+}
+
+// tenantDSN returns the driver and data source name OpenTenantDB opens.
+func tenantDSN(name, token string) (string, string, error) {
+	return Tenants().DSN(name, token)
+}
+
+// OpenLocalTenantDBReadOnly opens a local tenant database with PRAGMA
+// query_only on every connection, so statements that would write fail.
+func OpenLocalTenantDBReadOnly(name string) (*sql.DB, error) {
+	return sql.Open("sqlite3", "file:"+LocalTenantPath(name)+"?_busy_timeout=10000&_foreign_keys=on&_query_only=true")
+}
+
+// RemoveLocalTenant deletes a local tenant database and its journal files.
+func RemoveLocalTenant(name string) error {
+	EvictTenantDB(name)
+	path := LocalTenantPath(name)
+	for _, suffix := range []string{"-wal", "-shm"} {
+		_ = os.Remove(path + suffix)
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
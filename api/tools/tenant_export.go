@@ -0,0 +1,163 @@
+package tools
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Formats a tenant database can be exported in.
+const (
+	TenantExportSQLite = "sqlite" // A SQLite database file
+	TenantExportSQL    = "sql"    // SQL statements that recreate the database
+)
+
+// ExportTenantSQLite writes a snapshot of a tenant database to a new SQLite
+// file at path, stamped with version as its user_version. Local databases
+// are copied with VACUUM INTO; other backends are read in one transaction.
+// D1 has no read transactions, so a D1 export reads each table as it is when
+// the export reaches it.
+func ExportTenantSQLite(ctx context.Context, name, token string, version int, path string) error {
+	src, err := OpenTenantDB(name, token)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	if !LocalTenants() {
+		tx, err := src.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		_, err = copyTenantReplica(ctx, tx, path, version)
+		return err
+	}
+
+	if _, err := src.ExecContext(ctx, "VACUUM INTO ?", path); err != nil {
+		return err
+	}
+	dst, err := sql.Open("sqlite3", "file:"+path)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+	_, err = dst.ExecContext(ctx, fmt.Sprintf("PRAGMA user_version = %d", version))
+	return err
+}
+
+// DumpTenantDB writes a tenant database as SQL statements that recreate it
+// in an empty SQLite database, read from one transaction like
+// ExportTenantSQLite.
+func DumpTenantDB(ctx context.Context, name, token string, version int, w io.Writer) error {
+	src, err := OpenTenantDB(name, token)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	tx, err := src.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	return dumpTenantSnapshot(ctx, tx, version, w)
+}
+
+func dumpTenantSnapshot(ctx context.Context, src tenantQuerier, version int, w io.Writer) error {
+	buf := bufio.NewWriter(w)
+	sink := dumpSink{w: buf}
+	if err := sink.exec(ctx, "PRAGMA foreign_keys=OFF;\nBEGIN TRANSACTION"); err != nil {
+		return err
+	}
+	if _, err := writeTenantSnapshot(ctx, src, sink, version); err != nil {
+		return err
+	}
+	if err := sink.exec(ctx, "COMMIT"); err != nil {
+		return err
+	}
+	return buf.Flush()
+}
+
+// dumpSink writes a snapshot as SQL text.
+type dumpSink struct{ w *bufio.Writer }
+
+func (s dumpSink) exec(ctx context.Context, stmt string) error {
+	_, err := s.w.WriteString(stmt + ";\n")
+	return err
+}
+
+func (s dumpSink) copyRows(ctx context.Context, src tenantQuerier, table string) (int64, error) {
+	rows, columns, err := selectStoredRows(ctx, src, table)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	quoted := make([]string, len(columns))
+	for i, col := range columns {
+		quoted[i] = "[" + col + "]"
+	}
+	prefix := fmt.Sprintf("INSERT INTO [%s] (%s) VALUES (", table, strings.Join(quoted, ", "))
+	values := make([]any, len(columns))
+	ptrs := make([]any, len(columns))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	literals := make([]string, len(columns))
+	var n int64
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return n, err
+		}
+		for i, v := range values {
+			literals[i] = sqlLiteral(v)
+		}
+		if _, err := s.w.WriteString(prefix + strings.Join(literals, ", ") + ");\n"); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, rows.Err()
+}
+
+// sqlLiteral writes a value scanned from SQLite as a literal of the same
+// storage class.
+func sqlLiteral(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "NULL"
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		if math.IsInf(v, 0) {
+			if v > 0 {
+				return "9e999"
+			}
+			return "-9e999"
+		}
+		s := strconv.FormatFloat(v, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".e") {
+			s += ".0" // Kept a REAL in columns without affinity.
+		}
+		return s
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	case []byte:
+		return "X'" + hex.EncodeToString(v) + "'"
+	case string:
+		return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+	case time.Time:
+		return "'" + v.Format(sqlite3.SQLiteTimestampFormats[0]) + "'"
+	}
+	return "'" + strings.ReplaceAll(fmt.Sprint(v), "'", "''") + "'"
+}
@@ -0,0 +1,98 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/atombasedev/atombase/config"
+)
+
+func TestExportTenantDB(t *testing.T) {
+	original := config.Cfg
+	defer func() { config.Cfg = original }()
+	config.Cfg.TenantBackend, config.Cfg.LocalTenantDir, config.Cfg.DataDir = TenantBackendLocal, "", t.TempDir()
+	ctx := context.Background()
+	if err := Tenants().CreateDatabase(ctx, "acme", ""); err != nil {
+		t.Fatal(err)
+	}
+	src, err := OpenTenantDB("acme", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	if _, err := src.Exec(`
+		CREATE TABLE notes (id INTEGER PRIMARY KEY, title TEXT, score REAL, data BLOB, extra, due DATE, seen DATETIME);
+		CREATE INDEX idx_notes_title ON notes(title);
+		CREATE TRIGGER notes_touch AFTER INSERT ON notes BEGIN UPDATE notes SET score = score + 100 WHERE id = new.id; END;
+		INSERT INTO notes (title, score, data, extra, due, seen) VALUES ('it''s', 1.5, x'00ff', 2.0, '2024-01-02', '2024-01-02T03:04:05Z'), (NULL, 3, NULL, 'x', NULL, NULL);
+	`); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(t *testing.T, db *sql.DB) {
+		t.Helper()
+		var title, data, extraType string
+		var score float64
+		var version, objects int
+		if err := db.QueryRow(`SELECT title, score, hex(data), typeof(extra) FROM notes WHERE id = 1`).Scan(&title, &score, &data, &extraType); err != nil {
+			t.Fatal(err)
+		}
+		if title != "it's" || score != 101.5 || data != "00FF" || extraType != "real" {
+			t.Errorf("unexpected row %q %v %q %q", title, score, data, extraType)
+		}
+		// Dates come back byte for byte, not reformatted as timestamps.
+		var due, seen string
+		if err := db.QueryRow(`SELECT due || '', seen || '' FROM notes WHERE id = 1`).Scan(&due, &seen); err != nil {
+			t.Fatal(err)
+		}
+		if due != "2024-01-02" || seen != "2024-01-02T03:04:05Z" {
+			t.Errorf("expected dates kept as written, got %q %q", due, seen)
+		}
+		if err := db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil || version != 7 {
+			t.Errorf("user_version = %d, %v", version, err)
+		}
+		if err := db.QueryRow(`SELECT count(*) FROM sqlite_master WHERE name IN ('idx_notes_title', 'notes_touch')`).Scan(&objects); err != nil || objects != 2 {
+			t.Errorf("expected the index and trigger, got %d, %v", objects, err)
+		}
+	}
+
+	t.Run("sqlite", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "acme.db")
+		if err := ExportTenantSQLite(ctx, "acme", "", 7, path); err != nil {
+			t.Fatal(err)
+		}
+		db, err := sql.Open("sqlite3", "file:"+path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		check(t, db)
+	})
+
+	t.Run("sql", func(t *testing.T) {
+		var dump bytes.Buffer
+		if err := DumpTenantDB(ctx, "acme", "", 7, &dump); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(dump.String(), "PRAGMA foreign_keys=OFF;\nBEGIN TRANSACTION;\n") || !strings.HasSuffix(dump.String(), "COMMIT;\n") {
+			t.Fatalf("unexpected dump framing:\n%s", dump.String())
+		}
+		// The trigger comes after the rows, so restoring doesn't fire it.
+		if strings.Index(dump.String(), "INSERT INTO [notes]") > strings.Index(dump.String(), "CREATE TRIGGER") {
+			t.Error("expected rows before triggers")
+		}
+		db, err := sql.Open("sqlite3", "file:"+filepath.Join(t.TempDir(), "restored.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		if _, err := db.Exec(dump.String()); err != nil {
+			t.Fatal(err)
+		}
+		check(t, db)
+	})
+}
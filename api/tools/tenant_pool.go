@@ -0,0 +1,253 @@
+package tools
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/atombasedev/atombase/config"
+)
+
+// tenantPingTimeout bounds one health check ping.
+const tenantPingTimeout = 5 * time.Second
+
+// tenantDBs keeps tenant database handles open between requests, so a
+// request to a warm tenant skips opening and pinging a connection. Handles
+// are keyed by data source name, which holds the token, so a rotated token
+// gets a new handle and the old one ages out.
+var tenantDBs = struct {
+	sync.Mutex
+	entries map[string]*list.Element // Data source name -> entry in lru
+	lru     *list.List               // Most recently used at the front
+}{entries: map[string]*list.Element{}, lru: list.New()}
+
+type pooledTenantDB struct {
+	name     string
+	driver   string
+	dsn      string
+	db       *sql.DB
+	users    int       // Callers that have not released the handle yet
+	lastUsed time.Time // When the handle was last acquired or released
+	evicted  bool      // Out of the pool; closed when the last user releases it
+}
+
+// AcquireTenantDB returns a handle to a tenant database and a func the caller
+// calls instead of closing it. With ATOMICBASE_TENANT_POOL_SIZE set, handles
+// are shared between requests and the least recently used one is closed when
+// the pool is full; otherwise each call opens its own handle. A new handle is
+// pinged before it is returned.
+func AcquireTenantDB(name, token string) (*sql.DB, func(), error) {
+	driver, dsn, err := tenantDSN(name, token)
+	if err != nil {
+		return nil, nil, err
+	}
+	return acquirePooledDB(name, driver, dsn)
+}
+
+// acquirePooledDB returns the pooled handle for dsn, opening it under name
+// when the pool has none.
+func acquirePooledDB(name, driver, dsn string) (*sql.DB, func(), error) {
+	if config.Cfg.TenantPoolSize <= 0 {
+		db, err := openPingedTenantDB(driver, dsn)
+		if err != nil {
+			return nil, nil, err
+		}
+		return db, func() { db.Close() }, nil
+	}
+
+	now := time.Now()
+	tenantDBs.Lock()
+	if el, ok := tenantDBs.entries[dsn]; ok {
+		entry := el.Value.(*pooledTenantDB)
+		entry.users++
+		entry.lastUsed = now
+		tenantDBs.lru.MoveToFront(el)
+		db := entry.db
+		tenantDBs.Unlock()
+		return db, releaseTenantDB(entry), nil
+	}
+	tenantDBs.Unlock()
+
+	db, err := openPingedTenantDB(driver, dsn)
+	if err != nil {
+		return nil, nil, err
+	}
+	tenantDBs.Lock()
+	if el, ok := tenantDBs.entries[dsn]; ok {
+		// Another request opened the same database meanwhile; share its handle.
+		entry := el.Value.(*pooledTenantDB)
+		entry.users++
+		entry.lastUsed = now
+		tenantDBs.lru.MoveToFront(el)
+		shared := entry.db
+		tenantDBs.Unlock()
+		db.Close()
+		return shared, releaseTenantDB(entry), nil
+	}
+	entry := &pooledTenantDB{name: name, driver: driver, dsn: dsn, db: db, users: 1, lastUsed: now}
+	tenantDBs.entries[dsn] = tenantDBs.lru.PushFront(entry)
+	var closing []*sql.DB
+	for tenantDBs.lru.Len() > config.Cfg.TenantPoolSize {
+		closing = append(closing, evictTenantDB(tenantDBs.lru.Back())...)
+	}
+	tenantDBs.Unlock()
+	closeTenantDBs(closing)
+	return db, releaseTenantDB(entry), nil
+}
+
+// openPooledTenantDB opens a handle sized by the pool settings.
+func openPooledTenantDB(driver, dsn string) (*sql.DB, error) {
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if n := config.Cfg.TenantPoolMaxOpen; n > 0 {
+		db.SetMaxOpenConns(n)
+		db.SetMaxIdleConns(n)
+	}
+	if idle := config.Cfg.TenantPoolIdleTimeout; idle > 0 {
+		db.SetConnMaxIdleTime(time.Duration(idle) * time.Second)
+	}
+	return db, nil
+}
+
+// openPingedTenantDB opens a handle and checks that it connects.
+func openPingedTenantDB(driver, dsn string) (*sql.DB, error) {
+	db, err := openPooledTenantDB(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// releaseTenantDB returns the func that hands an acquired handle back. Calls
+// after the first do nothing.
+func releaseTenantDB(entry *pooledTenantDB) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			tenantDBs.Lock()
+			entry.users--
+			entry.lastUsed = time.Now()
+			closeNow := entry.evicted && entry.users == 0
+			tenantDBs.Unlock()
+			if closeNow {
+				entry.db.Close()
+			}
+		})
+	}
+}
+
+// evictTenantDB takes an entry out of the pool and returns its handle when it
+// can be closed right away. Callers hold tenantDBs.
+func evictTenantDB(el *list.Element) []*sql.DB {
+	entry := tenantDBs.lru.Remove(el).(*pooledTenantDB)
+	delete(tenantDBs.entries, entry.dsn)
+	entry.evicted = true
+	if entry.users == 0 {
+		return []*sql.DB{entry.db}
+	}
+	return nil
+}
+
+func closeTenantDBs(dbs []*sql.DB) {
+	for _, db := range dbs {
+		db.Close()
+	}
+}
+
+// EvictTenantDB closes the pooled handles of a tenant database, for when it
+// is deleted. Handles in use are closed once released.
+func EvictTenantDB(name string) {
+	tenantDBs.Lock()
+	var closing []*sql.DB
+	for el := tenantDBs.lru.Front(); el != nil; {
+		next := el.Next()
+		if el.Value.(*pooledTenantDB).name == name {
+			closing = append(closing, evictTenantDB(el)...)
+		}
+		el = next
+	}
+	tenantDBs.Unlock()
+	closeTenantDBs(closing)
+}
+
+// RunTenantPool closes handles idle for longer than
+// ATOMICBASE_TENANT_POOL_IDLE_TIMEOUT and pings the other idle Turso handles
+// every ATOMICBASE_TENANT_POOL_HEALTH_INTERVAL seconds, reopening those that
+// fail, until stop is closed.
+func RunTenantPool(stop <-chan struct{}) {
+	interval := time.Duration(config.Cfg.TenantPoolHealthInterval) * time.Second
+	if config.Cfg.TenantPoolSize <= 0 || interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			checkTenantDBs(now)
+		}
+	}
+}
+
+// checkTenantDBs runs one round of RunTenantPool. Handles in use are left
+// alone: their requests find out soon enough. Local SQLite handles are not
+// pinged, as they have no connection to lose.
+func checkTenantDBs(now time.Time) {
+	idle := time.Duration(config.Cfg.TenantPoolIdleTimeout) * time.Second
+	var closing []*sql.DB
+	type pinged struct {
+		entry *pooledTenantDB
+		db    *sql.DB
+	}
+	var ping []pinged
+	tenantDBs.Lock()
+	for el := tenantDBs.lru.Front(); el != nil; {
+		next := el.Next()
+		entry := el.Value.(*pooledTenantDB)
+		switch {
+		case entry.users > 0:
+		case idle > 0 && now.Sub(entry.lastUsed) > idle:
+			closing = append(closing, evictTenantDB(el)...)
+		case entry.driver != "sqlite3":
+			ping = append(ping, pinged{entry, entry.db})
+		}
+		el = next
+	}
+	tenantDBs.Unlock()
+	closeTenantDBs(closing)
+
+	for _, p := range ping {
+		entry := p.entry
+		ctx, cancel := context.WithTimeout(context.Background(), tenantPingTimeout)
+		err := p.db.PingContext(ctx)
+		cancel()
+		if err == nil {
+			continue
+		}
+		Logger.Warn("tenant database failed its health check, reopening", "database", entry.name, "error", err)
+		db, err := openPooledTenantDB(entry.driver, entry.dsn)
+		if err != nil {
+			continue
+		}
+		tenantDBs.Lock()
+		el, ok := tenantDBs.entries[entry.dsn]
+		if !ok || el.Value != entry || entry.users > 0 || entry.db != p.db {
+			tenantDBs.Unlock()
+			db.Close()
+			continue
+		}
+		entry.db = db
+		tenantDBs.Unlock()
+		p.db.Close()
+	}
+}
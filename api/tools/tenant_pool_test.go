@@ -0,0 +1,123 @@
+package tools
+
+import (
+	"container/list"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/atombasedev/atombase/config"
+)
+
+func setupTenantPool(t *testing.T, size int) {
+	t.Helper()
+	original := config.Cfg
+	t.Cleanup(func() {
+		config.Cfg = original
+		tenantDBs.Lock()
+		for _, el := range tenantDBs.entries {
+			el.Value.(*pooledTenantDB).db.Close()
+		}
+		tenantDBs.entries, tenantDBs.lru = map[string]*list.Element{}, list.New()
+		tenantDBs.Unlock()
+	})
+	config.Cfg.LocalTenantDir = t.TempDir()
+	config.Cfg.TenantPoolSize = size
+	config.Cfg.TenantPoolIdleTimeout = 60
+}
+
+func acquireTenantDB(t *testing.T, name string) (*sql.DB, func()) {
+	t.Helper()
+	db, release, err := AcquireTenantDB(name, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, release
+}
+
+func isClosed(db *sql.DB) bool {
+	return db.Ping() != nil
+}
+
+func TestAcquireTenantDB_Pool(t *testing.T) {
+	setupTenantPool(t, 2)
+
+	a, releaseA := acquireTenantDB(t, "a")
+	again, releaseAgain := acquireTenantDB(t, "a")
+	if a != again {
+		t.Fatal("expected the same database to share a handle")
+	}
+	releaseA()
+	releaseA() // Releasing twice must not count twice.
+
+	b, releaseB := acquireTenantDB(t, "b")
+	releaseB()
+	// a is still in use, so filling the pool evicts it but leaves it open.
+	c, releaseC := acquireTenantDB(t, "c")
+	defer releaseC()
+	if isClosed(a) {
+		t.Fatal("expected a handle in use to stay open when evicted")
+	}
+	releaseAgain()
+	if !isClosed(a) {
+		t.Error("expected an evicted handle to close once released")
+	}
+	if isClosed(b) || isClosed(c) {
+		t.Error("expected the most recently used handles to stay open")
+	}
+
+	// b is idle, so a new database evicts and closes it right away.
+	_, releaseD := acquireTenantDB(t, "d")
+	defer releaseD()
+	if !isClosed(b) {
+		t.Error("expected the least recently used idle handle to be closed")
+	}
+	if reopened, release := acquireTenantDB(t, "b"); reopened == b {
+		t.Error("expected an evicted database to get a new handle")
+	} else {
+		release()
+	}
+}
+
+func TestEvictTenantDB(t *testing.T) {
+	setupTenantPool(t, 4)
+	db, release := acquireTenantDB(t, "gone")
+	release()
+	EvictTenantDB("gone")
+	if !isClosed(db) {
+		t.Error("expected the deleted database's handle to be closed")
+	}
+	if len(tenantDBs.entries) != 0 {
+		t.Error("expected the pool to be empty")
+	}
+}
+
+func TestCheckTenantDBs(t *testing.T) {
+	setupTenantPool(t, 4)
+	idle, releaseIdle := acquireTenantDB(t, "idle")
+	releaseIdle()
+	busy, releaseBusy := acquireTenantDB(t, "busy")
+	defer releaseBusy()
+
+	checkTenantDBs(time.Now().Add(2 * time.Minute))
+	if !isClosed(idle) {
+		t.Error("expected a handle idle past the timeout to be closed")
+	}
+	if isClosed(busy) {
+		t.Error("expected a handle in use to stay open")
+	}
+}
+
+func TestAcquireTenantDB_NoPool(t *testing.T) {
+	setupTenantPool(t, 0)
+	a, releaseA := acquireTenantDB(t, "a")
+	b, releaseB := acquireTenantDB(t, "a")
+	defer releaseB()
+	if a == b {
+		t.Fatal("expected a handle per call without a pool")
+	}
+	releaseA()
+	if !isClosed(a) {
+		t.Error("expected releasing to close the handle")
+	}
+}
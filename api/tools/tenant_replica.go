@@ -0,0 +1,373 @@
+package tools
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/atombasedev/atombase/config"
+)
+
+// replicaSyncTimeout bounds a sync started by a read that found its replica
+// stale.
+const replicaSyncTimeout = 5 * time.Minute
+
+// Shadow tables virtual tables keep their data in. A replica makes the
+// virtual table and fills it, which fills these.
+var replicaShadowTables = map[string][]string{
+	"fts5":  {"_data", "_idx", "_content", "_docsize", "_config"},
+	"rtree": {"_node", "_rowid", "_parent"},
+}
+
+// replicaSyncs holds the tenants whose replica is being synced, so reads that
+// find it stale start one sync between them.
+var replicaSyncs = struct {
+	sync.Mutex
+	running map[string]bool
+}{running: map[string]bool{}}
+
+// TenantReplicaInfo describes a replica after a sync.
+type TenantReplicaInfo struct {
+	Database string    `json:"database"`
+	Version  int       `json:"version"` // Definition version of the schema copied
+	Tables   int       `json:"tables"`
+	Rows     int64     `json:"rows"`
+	Bytes    int64     `json:"bytes"`
+	SyncedAt time.Time `json:"syncedAt"`
+}
+
+// TenantReplicas reports whether Turso tenant databases may have local read
+// replicas, with ATOMICBASE_TENANT_REPLICA_DIR set.
+func TenantReplicas() bool {
+	return config.Cfg.TenantReplicaDir != "" && !LocalTenants()
+}
+
+// TenantReplicaPath returns the file of a tenant database's replica.
+func TenantReplicaPath(name string) string {
+	return filepath.Join(config.Cfg.TenantReplicaDir, name+".db")
+}
+
+// SyncTenantReplica copies a Turso tenant database into its local replica
+// file, replacing the previous copy in one rename so reads never see half of
+// one. The copy is read in one transaction, so it is a single snapshot of the
+// database. version is the definition version the database is at, which
+// reads check before trusting the replica's schema. Each sync copies the
+// whole database: the remote driver cannot pull only the pages that changed.
+func SyncTenantReplica(ctx context.Context, name, token string, version int) (TenantReplicaInfo, error) {
+	if !TenantReplicas() {
+		return TenantReplicaInfo{}, errors.New("tenant replicas need ATOMICBASE_TENANT_REPLICA_DIR and the turso backend")
+	}
+	if err := os.MkdirAll(config.Cfg.TenantReplicaDir, 0o755); err != nil {
+		return TenantReplicaInfo{}, err
+	}
+	src, err := OpenTenantDB(name, token)
+	if err != nil {
+		return TenantReplicaInfo{}, err
+	}
+	defer src.Close()
+	read, err := src.BeginTx(ctx, nil)
+	if err != nil {
+		return TenantReplicaInfo{}, err
+	}
+	defer read.Rollback()
+
+	path := TenantReplicaPath(name)
+	tmp := path + ".sync"
+	_ = os.Remove(tmp)
+	info, err := copyTenantReplica(ctx, read, tmp, version)
+	if err != nil {
+		_ = os.Remove(tmp)
+		return TenantReplicaInfo{}, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return TenantReplicaInfo{}, err
+	}
+	// Pooled handles still read the file the rename replaced.
+	EvictTenantDB(replicaPoolName(name))
+	info.Database = name
+	if stat, err := os.Stat(path); err == nil {
+		info.Bytes, info.SyncedAt = stat.Size(), stat.ModTime().UTC()
+	}
+	return info, nil
+}
+
+type replicaObject struct {
+	kind, name, sql string
+}
+
+// tenantQuerier reads a tenant database: a *sql.DB, or a *sql.Tx when the
+// reads must see one snapshot.
+type tenantQuerier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// snapshotSink receives a tenant database's schema statements and rows, in
+// the order writeTenantSnapshot reads them.
+type snapshotSink interface {
+	exec(ctx context.Context, stmt string) error
+	copyRows(ctx context.Context, src tenantQuerier, table string) (int64, error)
+}
+
+// sqliteSink writes a snapshot into a SQLite database.
+type sqliteSink struct{ tx *sql.Tx }
+
+func (s sqliteSink) exec(ctx context.Context, stmt string) error {
+	_, err := s.tx.ExecContext(ctx, stmt)
+	return err
+}
+
+func (s sqliteSink) copyRows(ctx context.Context, src tenantQuerier, table string) (int64, error) {
+	return copyReplicaRows(ctx, src, s.tx, table)
+}
+
+// copyTenantReplica writes the schema and rows of src to a new SQLite file.
+func copyTenantReplica(ctx context.Context, src tenantQuerier, path string, version int) (TenantReplicaInfo, error) {
+	dst, err := sql.Open("sqlite3", "file:"+path)
+	if err != nil {
+		return TenantReplicaInfo{}, err
+	}
+	defer dst.Close()
+	tx, err := dst.BeginTx(ctx, nil)
+	if err != nil {
+		return TenantReplicaInfo{}, err
+	}
+	defer tx.Rollback()
+	info, err := writeTenantSnapshot(ctx, src, sqliteSink{tx}, version)
+	if err != nil {
+		return TenantReplicaInfo{}, err
+	}
+	return info, tx.Commit()
+}
+
+// writeTenantSnapshot reads the schema and rows of src into sink. Tables are
+// filled before indexes and triggers are made, so triggers don't fire on the
+// copy.
+func writeTenantSnapshot(ctx context.Context, src tenantQuerier, sink snapshotSink, version int) (TenantReplicaInfo, error) {
+	rows, err := src.QueryContext(ctx, `SELECT type, name, sql FROM sqlite_master WHERE sql IS NOT NULL AND name NOT LIKE 'sqlite_%' ORDER BY rowid`)
+	if err != nil {
+		return TenantReplicaInfo{}, err
+	}
+	var objects []replicaObject
+	for rows.Next() {
+		var obj replicaObject
+		if err := rows.Scan(&obj.kind, &obj.name, &obj.sql); err != nil {
+			rows.Close()
+			return TenantReplicaInfo{}, err
+		}
+		objects = append(objects, obj)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return TenantReplicaInfo{}, err
+	}
+
+	// Virtual tables by name, with their module.
+	virtual := map[string]string{}
+	for _, obj := range objects {
+		if obj.kind == "table" && strings.HasPrefix(strings.ToUpper(obj.sql), "CREATE VIRTUAL TABLE") {
+			virtual[obj.name] = replicaModule(obj.sql)
+		}
+	}
+
+	info := TenantReplicaInfo{Version: version}
+	var later []replicaObject
+	for _, obj := range objects {
+		if obj.kind != "table" {
+			later = append(later, obj)
+			continue
+		}
+		if isShadowTable(obj.name, virtual) {
+			continue
+		}
+		if err := sink.exec(ctx, obj.sql); err != nil {
+			return TenantReplicaInfo{}, fmt.Errorf("replica of %s: %w", obj.name, err)
+		}
+		info.Tables++
+		module, isVirtual := virtual[obj.name]
+		if isVirtual && module == "fts5" && strings.Contains(strings.ToLower(obj.sql), "content=") {
+			continue // Rebuilt from its content table below.
+		}
+		n, err := sink.copyRows(ctx, src, obj.name)
+		if err != nil {
+			return TenantReplicaInfo{}, fmt.Errorf("replica of %s: %w", obj.name, err)
+		}
+		info.Rows += n
+	}
+	for _, obj := range objects {
+		if virtual[obj.name] == "fts5" && strings.Contains(strings.ToLower(obj.sql), "content=") {
+			if err := sink.exec(ctx, fmt.Sprintf("INSERT INTO [%s]([%s]) VALUES('rebuild')", obj.name, obj.name)); err != nil {
+				return TenantReplicaInfo{}, fmt.Errorf("replica of %s: %w", obj.name, err)
+			}
+		}
+	}
+	for _, obj := range later {
+		if err := sink.exec(ctx, obj.sql); err != nil {
+			return TenantReplicaInfo{}, fmt.Errorf("replica of %s: %w", obj.name, err)
+		}
+	}
+	if err := sink.exec(ctx, fmt.Sprintf("PRAGMA user_version = %d", version)); err != nil {
+		return TenantReplicaInfo{}, err
+	}
+	return info, nil
+}
+
+// replicaModule returns the module a CREATE VIRTUAL TABLE statement uses.
+func replicaModule(stmt string) string {
+	upper := strings.ToUpper(stmt)
+	i := strings.Index(upper, " USING ")
+	if i < 0 {
+		return ""
+	}
+	module := strings.TrimSpace(stmt[i+len(" USING "):])
+	if j := strings.IndexAny(module, "( "); j >= 0 {
+		module = module[:j]
+	}
+	return strings.ToLower(module)
+}
+
+// isShadowTable reports whether a table holds the data of a virtual table.
+func isShadowTable(name string, virtual map[string]string) bool {
+	for vtable, module := range virtual {
+		for _, suffix := range replicaShadowTables[module] {
+			if name == vtable+suffix {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// selectStoredRows selects every row of a table as SQLite stores it. Each
+// column is read through a unary plus, which leaves the value alone but drops
+// its declared type, so the driver doesn't turn DATE and DATETIME text into
+// times that would be written back in another format.
+func selectStoredRows(ctx context.Context, src tenantQuerier, table string) (*sql.Rows, []string, error) {
+	rows, err := src.QueryContext(ctx, fmt.Sprintf("SELECT * FROM [%s] LIMIT 0", table))
+	if err != nil {
+		return nil, nil, err
+	}
+	columns, err := rows.Columns()
+	rows.Close()
+	if err != nil {
+		return nil, nil, err
+	}
+	selected := make([]string, len(columns))
+	for i, col := range columns {
+		selected[i] = fmt.Sprintf("+[%s] AS [%s]", col, col)
+	}
+	rows, err = src.QueryContext(ctx, fmt.Sprintf("SELECT %s FROM [%s]", strings.Join(selected, ", "), table))
+	if err != nil {
+		return nil, nil, err
+	}
+	return rows, columns, nil
+}
+
+// copyReplicaRows copies every row of a table and returns how many.
+func copyReplicaRows(ctx context.Context, src tenantQuerier, dst *sql.Tx, table string) (int64, error) {
+	rows, columns, err := selectStoredRows(ctx, src, table)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	quoted := make([]string, len(columns))
+	for i, col := range columns {
+		quoted[i] = "[" + col + "]"
+	}
+	insert, err := dst.PrepareContext(ctx, fmt.Sprintf("INSERT INTO [%s] (%s) VALUES (%s)",
+		table, strings.Join(quoted, ", "), strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ")))
+	if err != nil {
+		return 0, err
+	}
+	defer insert.Close()
+	values := make([]any, len(columns))
+	ptrs := make([]any, len(columns))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	var n int64
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return n, err
+		}
+		if _, err := insert.ExecContext(ctx, values...); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, rows.Err()
+}
+
+// OpenTenantReplica returns a handle to a tenant database's replica, and the
+// func that releases it, when the replica is at version and was synced within
+// ATOMICBASE_TENANT_REPLICA_MAX_AGE. Handles are pooled like AcquireTenantDB's
+// and dropped when a sync replaces the file. A replica that is out of date is
+// synced again in the background, from the Turso database the caller reads
+// meanwhile.
+func OpenTenantReplica(name, token string, version int) (*sql.DB, func(), bool) {
+	if !TenantReplicas() {
+		return nil, nil, false
+	}
+	path := TenantReplicaPath(name)
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, false
+	}
+	db, release, err := acquirePooledDB(replicaPoolName(name), "sqlite3", "file:"+path+"?mode=ro&_query_only=true")
+	if err != nil {
+		return nil, nil, false
+	}
+	var replicaVersion int
+	fresh := time.Since(stat.ModTime()) <= time.Duration(config.Cfg.TenantReplicaMaxAge)*time.Second
+	if err := db.QueryRow("PRAGMA user_version").Scan(&replicaVersion); err == nil && fresh && replicaVersion == version {
+		return db, release, true
+	}
+	release()
+	resyncTenantReplica(name, token, version)
+	return nil, nil, false
+}
+
+// replicaPoolName is the name a replica's handles are pooled under, apart
+// from the handles of the Turso database itself.
+func replicaPoolName(name string) string {
+	return "replica:" + name
+}
+
+// resyncTenantReplica syncs a replica in the background unless a sync of it
+// is running.
+func resyncTenantReplica(name, token string, version int) {
+	replicaSyncs.Lock()
+	defer replicaSyncs.Unlock()
+	if replicaSyncs.running[name] {
+		return
+	}
+	replicaSyncs.running[name] = true
+	go func() {
+		defer func() {
+			replicaSyncs.Lock()
+			delete(replicaSyncs.running, name)
+			replicaSyncs.Unlock()
+		}()
+		ctx, cancel := context.WithTimeout(context.Background(), replicaSyncTimeout)
+		defer cancel()
+		if _, err := SyncTenantReplica(ctx, name, token, version); err != nil {
+			Logger.Warn("tenant replica sync failed", "database", name, "error", err)
+		}
+	}()
+}
+
+// RemoveTenantReplica deletes a tenant database's replica, for when the
+// database is deleted.
+func RemoveTenantReplica(name string) {
+	if config.Cfg.TenantReplicaDir == "" {
+		return
+	}
+	EvictTenantDB(replicaPoolName(name))
+	_ = os.Remove(TenantReplicaPath(name))
+}
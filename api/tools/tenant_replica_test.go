@@ -0,0 +1,133 @@
+package tools
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/atombasedev/atombase/config"
+)
+
+func TestCopyTenantReplica(t *testing.T) {
+	ctx := context.Background()
+	src, err := sql.Open("sqlite3", "file:"+filepath.Join(t.TempDir(), "src.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	if _, err := src.Exec(`CREATE VIRTUAL TABLE [notes_fts] USING fts5([title], content=[notes], content_rowid=[id])`); err != nil {
+		t.Skipf("sqlite built without fts5 (use -tags fts5): %v", err)
+	}
+	if _, err := src.Exec(`
+		CREATE TABLE notes (id INTEGER PRIMARY KEY, title TEXT);
+		CREATE INDEX idx_notes_title ON notes(title);
+		CREATE TRIGGER [notes_fts_ai] AFTER INSERT ON [notes] BEGIN
+			INSERT INTO [notes_fts](rowid, [title]) VALUES (new.[id], new.[title]);
+		END;
+		INSERT INTO notes (title) VALUES ('first note'), ('second note'), ('third');
+	`); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "replica.db")
+	info, err := copyTenantReplica(ctx, src, path, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// notes and notes_fts, whose shadow tables aren't copied.
+	if info.Tables != 2 || info.Rows != 3 || info.Version != 4 {
+		t.Fatalf("unexpected info %+v", info)
+	}
+
+	replica, err := sql.Open("sqlite3", "file:"+path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer replica.Close()
+	var matches, version, objects int
+	if err := replica.QueryRow(`SELECT count(*) FROM notes_fts WHERE notes_fts MATCH 'note'`).Scan(&matches); err != nil {
+		t.Fatal(err)
+	}
+	if matches != 2 {
+		t.Errorf("expected the search index rebuilt, got %d matches", matches)
+	}
+	if err := replica.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil || version != 4 {
+		t.Errorf("user_version = %d, %v", version, err)
+	}
+	if err := replica.QueryRow(`SELECT count(*) FROM sqlite_master WHERE name IN ('idx_notes_title', 'notes_fts_ai')`).Scan(&objects); err != nil || objects != 2 {
+		t.Errorf("expected the index and trigger copied, got %d, %v", objects, err)
+	}
+}
+
+func TestOpenTenantReplica(t *testing.T) {
+	original := config.Cfg
+	defer func() { config.Cfg = original }()
+	config.Cfg.TenantBackend, config.Cfg.TenantReplicaDir, config.Cfg.TenantReplicaMaxAge = TenantBackendTurso, t.TempDir(), 60
+	config.Cfg.TenantPoolSize = 4
+	defer EvictTenantDB(replicaPoolName("acme"))
+
+	// A sync of acme is already running, so stale reads don't start one.
+	replicaSyncs.Lock()
+	replicaSyncs.running["acme"] = true
+	replicaSyncs.Unlock()
+	defer func() {
+		replicaSyncs.Lock()
+		delete(replicaSyncs.running, "acme")
+		replicaSyncs.Unlock()
+	}()
+
+	if _, _, ok := OpenTenantReplica("acme", "token", 1); ok {
+		t.Fatal("expected no replica before a sync")
+	}
+
+	src, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	if _, err := src.Exec(`CREATE TABLE notes (id INTEGER PRIMARY KEY)`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := copyTenantReplica(context.Background(), src, TenantReplicaPath("acme"), 1); err != nil {
+		t.Fatal(err)
+	}
+
+	db, release, ok := OpenTenantReplica("acme", "token", 1)
+	if !ok {
+		t.Fatal("expected the fresh replica")
+	}
+	if _, err := db.Exec(`INSERT INTO notes (id) VALUES (1)`); err == nil {
+		t.Error("expected the replica to be read-only")
+	}
+	again, releaseAgain, ok := OpenTenantReplica("acme", "token", 1)
+	if !ok || again != db {
+		t.Error("expected the replica's handle to be pooled")
+	}
+	releaseAgain()
+	release()
+
+	if _, _, ok := OpenTenantReplica("acme", "token", 2); ok {
+		t.Error("expected a replica behind the database's version to be skipped")
+	}
+	old := time.Now().Add(-2 * time.Minute)
+	if err := os.Chtimes(TenantReplicaPath("acme"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := OpenTenantReplica("acme", "token", 1); ok {
+		t.Error("expected a stale replica to be skipped")
+	}
+
+	RemoveTenantReplica("acme")
+	if _, err := os.Stat(TenantReplicaPath("acme")); !os.IsNotExist(err) {
+		t.Errorf("expected the replica removed, got %v", err)
+	}
+	tenantDBs.Lock()
+	pooled := len(tenantDBs.entries)
+	tenantDBs.Unlock()
+	if pooled != 0 {
+		t.Errorf("expected the replica's handle dropped from the pool, got %d entries", pooled)
+	}
+}
@@ -0,0 +1,56 @@
+package tools
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/atombasedev/atombase/config"
+)
+
+// TenantHeader names the organization a request targets, as a shorter
+// alternative to the Database header.
+const TenantHeader = "X-Atomicbase-Tenant"
+
+// DatabaseRoute returns the routing input of a request in the form the
+// Database header takes: the Database header itself, else X-Atomicbase-Tenant,
+// else the subdomain of ATOMICBASE_TENANT_DOMAIN the request was sent to. A
+// tenant without a type is an organization, so X-Atomicbase-Tenant: org_123 and
+// org_123.api.example.com both mean org:org_123. Empty means no routing input
+// was given.
+func DatabaseRoute(r *http.Request) (string, error) {
+	database := r.Header.Get("Database")
+	tenant := strings.TrimSpace(r.Header.Get(TenantHeader))
+	if tenant != "" && !strings.Contains(tenant, ":") {
+		tenant = "org:" + tenant
+	}
+	switch {
+	case database != "" && tenant != "" && database != tenant:
+		return "", InvalidRequestErr("the Database and " + TenantHeader + " headers name different databases")
+	case database != "":
+		return database, nil
+	case tenant != "":
+		return tenant, nil
+	}
+	if sub := tenantSubdomain(r.Host); sub != "" {
+		return "org:" + sub, nil
+	}
+	return "", nil
+}
+
+// tenantSubdomain returns the single label host has in front of
+// ATOMICBASE_TENANT_DOMAIN, or empty when it is not such a subdomain.
+func tenantSubdomain(host string) string {
+	domain := config.Cfg.TenantDomain
+	if domain == "" {
+		return ""
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	label, ok := strings.CutSuffix(strings.ToLower(strings.TrimSuffix(host, ".")), "."+domain)
+	if !ok || label == "" || strings.Contains(label, ".") {
+		return ""
+	}
+	return label
+}
@@ -0,0 +1,60 @@
+package tools
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/atombasedev/atombase/config"
+)
+
+func TestDatabaseRoute(t *testing.T) {
+	original := config.Cfg.TenantDomain
+	t.Cleanup(func() { config.Cfg.TenantDomain = original })
+	config.Cfg.TenantDomain = "api.example.com"
+
+	tests := []struct {
+		name     string
+		host     string
+		headers  map[string]string
+		want     string
+		wantFail bool
+	}{
+		{name: "database header", host: "localhost:8080", headers: map[string]string{"Database": "global:catalog"}, want: "global:catalog"},
+		{name: "tenant header", host: "localhost", headers: map[string]string{TenantHeader: "org_123"}, want: "org:org_123"},
+		{name: "typed tenant header", host: "localhost", headers: map[string]string{TenantHeader: "global:catalog"}, want: "global:catalog"},
+		{name: "same target twice", host: "localhost", headers: map[string]string{"Database": "org:org_123", TenantHeader: "org_123"}, want: "org:org_123"},
+		{name: "conflicting headers", host: "localhost", headers: map[string]string{"Database": "org:org_123", TenantHeader: "org_456"}, wantFail: true},
+		{name: "subdomain", host: "Acme.API.example.com:443", want: "org:acme"},
+		{name: "header wins over subdomain", host: "acme.api.example.com", headers: map[string]string{TenantHeader: "org_123"}, want: "org:org_123"},
+		{name: "tenant domain itself", host: "api.example.com"},
+		{name: "nested subdomain", host: "a.b.api.example.com"},
+		{name: "other domain", host: "acme.example.org"},
+		{name: "lookalike domain", host: "acme.evilapi.example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/data/query/posts", nil)
+			req.Host = tt.host
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			got, err := DatabaseRoute(req)
+			if tt.wantFail {
+				if err == nil {
+					t.Fatalf("expected an error, got %q", got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("got %q, %v; want %q", got, err, tt.want)
+			}
+		})
+	}
+
+	config.Cfg.TenantDomain = ""
+	req := httptest.NewRequest("GET", "/data/query/posts", nil)
+	req.Host = "acme.api.example.com"
+	if got, _ := DatabaseRoute(req); got != "" {
+		t.Errorf("expected subdomains to be ignored without a tenant domain, got %q", got)
+	}
+}
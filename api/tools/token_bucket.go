@@ -0,0 +1,173 @@
+package tools
+
+import (
+	"container/list"
+	"maps"
+	"math"
+	"sync"
+	"time"
+)
+
+// bucketSweepInterval is how often TokenBuckets drop the buckets of idle keys.
+const bucketSweepInterval = time.Minute
+
+// BucketLimit is the size and refill rate of a token bucket.
+type BucketLimit struct {
+	Rate  float64 // Tokens added per second
+	Burst float64 // Most tokens a bucket holds
+}
+
+// TokenBuckets keeps a token bucket per key, such as a caller or client IP.
+// A key that has been idle long enough to refill carries no state, so its
+// bucket is dropped by a sweep every bucketSweepInterval. At most maxKeys
+// buckets are kept: a new key past that evicts the least recently used one,
+// which starts full if its key comes back. It is safe for concurrent use.
+type TokenBuckets struct {
+	mu       sync.Mutex
+	buckets  map[string]*list.Element // Of *tokenBucket
+	recent   *list.List               // Buckets, most recently used first
+	maxKeys  int
+	allowed  uint64
+	rejected uint64
+	evicted  uint64
+}
+
+type tokenBucket struct {
+	key     string
+	tokens  float64
+	updated time.Time
+	limit   BucketLimit
+}
+
+// TokenBucketStats is a point-in-time view of a set of buckets.
+type TokenBucketStats struct {
+	Keys      int    `json:"keys"`      // Keys with a bucket
+	Saturated int    `json:"saturated"` // Keys with less than one token left
+	Allowed   uint64 `json:"allowed"`   // Takes that succeeded since start
+	Rejected  uint64 `json:"rejected"`  // Takes refused for lack of tokens
+	Evicted   uint64 `json:"evicted"`   // Idle buckets dropped
+}
+
+var (
+	bucketSetsMu sync.Mutex
+	bucketSets   = map[string]*TokenBuckets{}
+)
+
+// NewTokenBuckets returns an empty set of buckets, listed under name in
+// AllTokenBucketStats, and starts sweeping it. A maxKeys of 0 keeps any
+// number of buckets.
+func NewTokenBuckets(name string, maxKeys int) *TokenBuckets {
+	b := &TokenBuckets{buckets: map[string]*list.Element{}, recent: list.New(), maxKeys: maxKeys}
+	bucketSetsMu.Lock()
+	bucketSets[name] = b
+	bucketSetsMu.Unlock()
+	go func() {
+		for now := range time.Tick(bucketSweepInterval) {
+			b.mu.Lock()
+			b.sweep(now)
+			b.mu.Unlock()
+		}
+	}()
+	return b
+}
+
+// AllTokenBucketStats returns the stats of every set of buckets by name.
+func AllTokenBucketStats(now time.Time) map[string]TokenBucketStats {
+	bucketSetsMu.Lock()
+	sets := maps.Clone(bucketSets)
+	bucketSetsMu.Unlock()
+
+	stats := make(map[string]TokenBucketStats, len(sets))
+	for name, b := range sets {
+		stats[name] = b.Stats(now)
+	}
+	return stats
+}
+
+// Take spends n tokens from key's bucket, which starts full. When the bucket
+// has fewer than n tokens nothing is spent, and Take returns false with the
+// time until it will have them. remaining is what the bucket holds after.
+func (b *TokenBuckets) Take(key string, n float64, limit BucketLimit, now time.Time) (ok bool, remaining float64, wait time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	bucket := b.bucket(key, limit, now)
+	bucket.limit = limit
+	bucket.tokens = bucket.level(now)
+	bucket.updated = now
+
+	if n > bucket.tokens {
+		b.rejected++
+		wait = time.Duration(math.MaxInt64)
+		if limit.Rate > 0 && n <= limit.Burst {
+			wait = time.Duration((n - bucket.tokens) / limit.Rate * float64(time.Second))
+		}
+		return false, bucket.tokens, wait
+	}
+	bucket.tokens -= n
+	b.allowed++
+	return true, bucket.tokens, 0
+}
+
+// Give returns n tokens to key's bucket, up to its burst, such as those a
+// request took before it was known to belong to another key. Keys without a
+// bucket are already full.
+func (b *TokenBuckets) Give(key string, n float64, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if elem, ok := b.buckets[key]; ok {
+		bucket := elem.Value.(*tokenBucket)
+		bucket.tokens = min(bucket.limit.Burst, bucket.level(now)+n)
+		bucket.updated = now
+	}
+}
+
+// bucket returns key's bucket as the most recently used, making a full one
+// when there is none. Callers hold b.mu.
+func (b *TokenBuckets) bucket(key string, limit BucketLimit, now time.Time) *tokenBucket {
+	if elem, ok := b.buckets[key]; ok {
+		b.recent.MoveToFront(elem)
+		return elem.Value.(*tokenBucket)
+	}
+	if b.maxKeys > 0 && len(b.buckets) >= b.maxKeys {
+		oldest := b.recent.Back()
+		b.recent.Remove(oldest)
+		delete(b.buckets, oldest.Value.(*tokenBucket).key)
+		b.evicted++
+	}
+	bucket := &tokenBucket{key: key, tokens: limit.Burst, updated: now, limit: limit}
+	b.buckets[key] = b.recent.PushFront(bucket)
+	return bucket
+}
+
+// Stats reports the buckets' saturation and counters.
+func (b *TokenBuckets) Stats(now time.Time) TokenBucketStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	stats := TokenBucketStats{Keys: len(b.buckets), Allowed: b.allowed, Rejected: b.rejected, Evicted: b.evicted}
+	for _, elem := range b.buckets {
+		if elem.Value.(*tokenBucket).level(now) < 1 {
+			stats.Saturated++
+		}
+	}
+	return stats
+}
+
+// sweep drops the buckets that have refilled. Callers hold b.mu.
+func (b *TokenBuckets) sweep(now time.Time) {
+	for key, elem := range b.buckets {
+		if bucket := elem.Value.(*tokenBucket); bucket.level(now) >= bucket.limit.Burst {
+			b.recent.Remove(elem)
+			delete(b.buckets, key)
+			b.evicted++
+		}
+	}
+}
+
+// level is the bucket's tokens at now, refilled since its last update.
+func (t *tokenBucket) level(now time.Time) float64 {
+	elapsed := now.Sub(t.updated).Seconds()
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	return min(t.limit.Burst, t.tokens+elapsed*t.limit.Rate)
+}
@@ -0,0 +1,161 @@
+package tools
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/atombasedev/atombase/config"
+)
+
+func TestTokenBuckets_Refill(t *testing.T) {
+	b := NewTokenBuckets("test_refill", 0)
+	limit := BucketLimit{Rate: 2, Burst: 4}
+	now := time.Unix(1000, 0)
+
+	for i := 0; i < 4; i++ {
+		if ok, _, _ := b.Take("a", 1, limit, now); !ok {
+			t.Fatalf("take %d of the burst was refused", i)
+		}
+	}
+	ok, left, wait := b.Take("a", 1, limit, now)
+	if ok || left != 0 || wait != 500*time.Millisecond {
+		t.Fatalf("got %v, %v left, wait %v; want a refusal with a 500ms wait", ok, left, wait)
+	}
+	if ok, _, _ := b.Take("b", 1, limit, now); !ok {
+		t.Fatal("another key shares the first key's bucket")
+	}
+
+	// Half a second refills one token; a long idle refills only up to the burst.
+	if ok, _, _ := b.Take("a", 1, limit, now.Add(500*time.Millisecond)); !ok {
+		t.Fatal("expected a token after 500ms")
+	}
+	if _, left, _ := b.Take("a", 1, limit, now.Add(time.Hour)); left != 3 {
+		t.Fatalf("got %v left after an hour, want 3", left)
+	}
+	if ok, _, wait := b.Take("a", 5, limit, now.Add(time.Hour)); ok || wait < time.Hour {
+		t.Fatalf("a take above the burst must never succeed, got %v, wait %v", ok, wait)
+	}
+}
+
+func TestTokenBuckets_EvictsIdleKeys(t *testing.T) {
+	b := NewTokenBuckets("test_evict", 2)
+	limit := BucketLimit{Rate: 1, Burst: 1}
+	now := time.Unix(1000, 0)
+	b.Take("a", 1, limit, now)
+	b.Take("b", 1, limit, now)
+
+	// A sweep drops the refilled buckets and keeps one still refilling.
+	b.Take("c", 1, limit, now.Add(2*time.Second))
+	b.mu.Lock()
+	b.sweep(now.Add(2 * time.Second))
+	b.mu.Unlock()
+	stats := b.Stats(now.Add(2 * time.Second))
+	if stats.Keys != 1 || stats.Evicted != 2 {
+		t.Fatalf("got %+v, want a and b evicted", stats)
+	}
+
+	// Past maxKeys the least recently used bucket goes, however saturated.
+	b.Take("d", 1, limit, now.Add(2*time.Second))
+	b.Take("c", 0, limit, now.Add(2*time.Second))
+	b.Take("e", 1, limit, now.Add(2*time.Second))
+	if stats := b.Stats(now.Add(2 * time.Second)); stats.Keys != 2 || stats.Saturated != 2 || stats.Evicted != 3 {
+		t.Fatalf("got %+v, want 2 saturated keys and d evicted", stats)
+	}
+	if ok, _, _ := b.Take("c", 1, limit, now.Add(2*time.Second)); ok {
+		t.Fatal("expected c, used more recently than d, to be kept")
+	}
+	b.Give("c", 1, now.Add(2*time.Second))
+	if ok, _, _ := b.Take("c", 1, limit, now.Add(2*time.Second)); !ok {
+		t.Fatal("expected a token given back to be taken again")
+	}
+	if _, ok := AllTokenBucketStats(now)["test_evict"]; !ok {
+		t.Fatal("expected the buckets to be listed by name")
+	}
+}
+
+func TestTokenBuckets_ParallelOverflow(t *testing.T) {
+	b := NewTokenBuckets("test_parallel", 0)
+	limit := BucketLimit{Rate: 0.001, Burst: 100}
+	now := time.Unix(1000, 0)
+
+	var allowed atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if ok, _, _ := b.Take("shared", 1, limit, now); ok {
+					allowed.Add(1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	stats := b.Stats(now)
+	if allowed.Load() != 100 || stats.Allowed != 100 || stats.Rejected != 700 || stats.Saturated != 1 {
+		t.Fatalf("got %d allowed and %+v; want exactly the burst of 100 allowed", allowed.Load(), stats)
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	original := config.Cfg
+	defer func() { config.Cfg = original }()
+	config.Cfg.RateLimit = 0.01
+	config.Cfg.RateLimitBurst = 2
+
+	handler := RateLimitMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Stands in for the handler verifying the session.
+		auth := GetAuthContext(r.Context())
+		if user, ok := strings.CutPrefix(auth.Token, "verified-"); ok {
+			if err := IdentifyCaller(r.Context(), "user:"+user); err != nil {
+				RespErr(w, err)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	request := func(auth AuthContext, ip string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/data/query/users", nil)
+		r.RemoteAddr = ip + ":1234"
+		return r.WithContext(context.WithValue(r.Context(), authContextKey{}, auth))
+	}
+	expect := func(token, ip string, code int) *httptest.ResponseRecorder {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, request(AuthContext{Role: RoleUser, Token: token}, ip))
+		if rec.Code != code {
+			t.Fatalf("expected %q from %s to get %d, got %d %s", token, ip, code, rec.Code, rec.Body.String())
+		}
+		return rec
+	}
+
+	// Made-up tokens share the client IP's budget.
+	expect("forged.1", "192.0.2.10", http.StatusOK)
+	expect("forged.2", "192.0.2.10", http.StatusOK)
+	if rec := expect("forged.3", "192.0.2.10", http.StatusTooManyRequests); rec.Header().Get("Retry-After") != "100" {
+		t.Fatalf("got Retry-After %q; want 100s", rec.Header().Get("Retry-After"))
+	}
+
+	// Verified users are charged on their own, and hand the IP its token back.
+	for _, user := range []string{"verified-ann", "verified-ann", "verified-bob", "verified-bob"} {
+		expect(user, "192.0.2.11", http.StatusOK)
+	}
+	expect("verified-ann", "192.0.2.11", http.StatusTooManyRequests)
+	expect("forged.1", "192.0.2.11", http.StatusOK)
+
+	for i := 0; i < 5; i++ {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, request(AuthContext{Role: RoleService}, "192.0.2.10"))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("service request got %d", rec.Code)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/atombasedev/atombase/config"
+)
+
+// TursoHTTPClient sends requests to the Turso platform and pipeline APIs. It is
+// replaced by InitTursoCassette to record or replay those requests.
+var TursoHTTPClient = &http.Client{}
+
+const (
+	CassetteRecord = "record"
+	CassetteReplay = "replay"
+)
+
+// cassetteOrg replaces the Turso organization in recorded URLs and bodies, so a
+// cassette recorded against one organization replays under any other.
+const cassetteOrg = "{org}"
+
+const cassetteRedacted = "[redacted]"
+
+// cassetteSecretFields are JSON fields whose values never reach a cassette.
+var cassetteSecretFields = map[string]bool{"jwt": true, "token": true, "auth_token": true, "password": true}
+
+// TursoCassette is a fixture of Turso API interactions. In record mode it sends
+// requests through Base and saves each sanitized interaction to Path; in replay
+// mode it answers requests from the fixture without touching the network.
+type TursoCassette struct {
+	Mode string
+	Path string
+	Base http.RoundTripper // Transport used while recording (default http.DefaultTransport)
+
+	mu           sync.Mutex
+	interactions []CassetteInteraction
+	used         []bool
+}
+
+// CassetteInteraction is one recorded request and its response.
+type CassetteInteraction struct {
+	Request  CassetteRequest  `json:"request"`
+	Response CassetteResponse `json:"response"`
+}
+
+type CassetteRequest struct {
+	Method string          `json:"method"`
+	URL    string          `json:"url"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+type CassetteResponse struct {
+	Status      int             `json:"status"`
+	ContentType string          `json:"contentType,omitempty"`
+	Body        json.RawMessage `json:"body,omitempty"`
+}
+
+type cassetteFile struct {
+	Interactions []CassetteInteraction `json:"interactions"`
+}
+
+// InitTursoCassette routes Turso API requests through a cassette when
+// TURSO_CASSETTE_MODE is set.
+func InitTursoCassette() error {
+	mode := config.Cfg.TursoCassetteMode
+	if mode == "" {
+		return nil
+	}
+	cassette, err := NewTursoCassette(mode, config.Cfg.TursoCassette)
+	if err != nil {
+		return err
+	}
+	TursoHTTPClient = &http.Client{Transport: cassette}
+	return nil
+}
+
+// NewTursoCassette opens a cassette. Record mode starts an empty fixture at
+// path; replay mode loads the interactions recorded there.
+func NewTursoCassette(mode, path string) (*TursoCassette, error) {
+	if path == "" {
+		return nil, fmt.Errorf("TURSO_CASSETTE is required when TURSO_CASSETTE_MODE is set")
+	}
+	c := &TursoCassette{Mode: mode, Path: path}
+	switch mode {
+	case CassetteRecord:
+		return c, c.save()
+	case CassetteReplay:
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read turso cassette: %w", err)
+		}
+		var file cassetteFile
+		if err := json.Unmarshal(raw, &file); err != nil {
+			return nil, fmt.Errorf("failed to parse turso cassette %s: %w", path, err)
+		}
+		c.interactions = file.Interactions
+		c.used = make([]bool, len(file.Interactions))
+		return c, nil
+	default:
+		return nil, fmt.Errorf("unknown TURSO_CASSETTE_MODE %q (expected record or replay)", mode)
+	}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (c *TursoCassette) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	recorded := CassetteRequest{Method: req.Method, URL: sanitizeCassette(req.URL.String()), Body: cassetteBody(body)}
+
+	if c.Mode == CassetteReplay {
+		return c.replay(req, recorded)
+	}
+
+	base := c.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.interactions = append(c.interactions, CassetteInteraction{
+		Request: recorded,
+		Response: CassetteResponse{
+			Status:      resp.StatusCode,
+			ContentType: resp.Header.Get("Content-Type"),
+			Body:        cassetteBody(respBody),
+		},
+	})
+	if err := c.save(); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// replay answers with the first unused interaction recorded for the same
+// method, URL and body, so concurrent requests need not arrive in order.
+func (c *TursoCassette) replay(req *http.Request, recorded CassetteRequest) (*http.Response, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, interaction := range c.interactions {
+		if c.used[i] || !sameCassetteRequest(interaction.Request, recorded) {
+			continue
+		}
+		c.used[i] = true
+		body := restoreCassetteBody(interaction.Response.Body)
+		header := http.Header{}
+		if interaction.Response.ContentType != "" {
+			header.Set("Content-Type", interaction.Response.ContentType)
+		}
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", interaction.Response.Status, http.StatusText(interaction.Response.Status)),
+			StatusCode:    interaction.Response.Status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header,
+			Body:          io.NopCloser(bytes.NewReader(body)),
+			ContentLength: int64(len(body)),
+			Request:       req,
+		}, nil
+	}
+	return nil, fmt.Errorf("turso cassette %s has no unused interaction for %s %s", c.Path, recorded.Method, recorded.URL)
+}
+
+// Unused returns the recorded interactions that were never replayed.
+func (c *TursoCassette) Unused() []CassetteInteraction {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var unused []CassetteInteraction
+	for i, used := range c.used {
+		if !used {
+			unused = append(unused, c.interactions[i])
+		}
+	}
+	return unused
+}
+
+func (c *TursoCassette) save() error {
+	raw, err := json.MarshalIndent(cassetteFile{Interactions: c.interactions}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(c.Path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+	tmp := c.Path + ".tmp"
+	if err := os.WriteFile(tmp, append(raw, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.Path)
+}
+
+func sameCassetteRequest(a, b CassetteRequest) bool {
+	return a.Method == b.Method && a.URL == b.URL && bytes.Equal(canonicalJSON(a.Body), canonicalJSON(b.Body))
+}
+
+func canonicalJSON(raw json.RawMessage) []byte {
+	if len(raw) == 0 {
+		return nil
+	}
+	var v any
+	if json.Unmarshal(raw, &v) != nil {
+		return raw
+	}
+	out, _ := json.Marshal(v)
+	return out
+}
+
+// cassetteBody sanitizes a body for storage. JSON bodies are kept as JSON with
+// secret fields redacted; anything else is stored as a JSON string.
+func cassetteBody(body []byte) json.RawMessage {
+	if len(body) == 0 {
+		return nil
+	}
+	var v any
+	if err := json.Unmarshal(body, &v); err == nil {
+		out, _ := json.Marshal(redactCassetteJSON(v))
+		return json.RawMessage(out)
+	}
+	out, _ := json.Marshal(sanitizeCassette(string(body)))
+	return json.RawMessage(out)
+}
+
+func redactCassetteJSON(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if cassetteSecretFields[strings.ToLower(key)] {
+				v[key] = cassetteRedacted
+				continue
+			}
+			v[key] = redactCassetteJSON(value)
+		}
+		return v
+	case []any:
+		for i, value := range v {
+			v[i] = redactCassetteJSON(value)
+		}
+		return v
+	case string:
+		return sanitizeCassette(v)
+	default:
+		return v
+	}
+}
+
+// restoreCassetteBody turns a stored body back into what the server sent, with
+// the current organization in place of the placeholder.
+func restoreCassetteBody(stored json.RawMessage) []byte {
+	var text string
+	if json.Unmarshal(stored, &text) == nil {
+		return []byte(restoreCassetteOrg(text))
+	}
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, stored); err != nil {
+		return []byte(restoreCassetteOrg(string(stored)))
+	}
+	return []byte(restoreCassetteOrg(compact.String()))
+}
+
+func restoreCassetteOrg(s string) string {
+	return strings.ReplaceAll(s, cassetteOrg, config.Cfg.TursoOrganization)
+}
+
+func sanitizeCassette(s string) string {
+	if org := config.Cfg.TursoOrganization; org != "" {
+		s = strings.ReplaceAll(s, org, cassetteOrg)
+	}
+	return s
+}
@@ -0,0 +1,97 @@
+package tools
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/atombasedev/atombase/config"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestTursoCassette_RecordThenReplay(t *testing.T) {
+	old := config.Cfg.TursoOrganization
+	defer func() { config.Cfg.TursoOrganization = old }()
+	path := filepath.Join(t.TempDir(), "cassettes", "turso.json")
+
+	send := func(client *http.Client, method, url, body string) (int, string, error) {
+		req, _ := http.NewRequest(method, url, strings.NewReader(body))
+		resp, err := client.Do(req)
+		if err != nil {
+			return 0, "", err
+		}
+		defer resp.Body.Close()
+		raw, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(raw), nil
+	}
+
+	config.Cfg.TursoOrganization = "acme-prod"
+	recorder, err := NewTursoCassette(CassetteRecord, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder.Base = roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		if r.Header.Get("Authorization") != "Bearer secret-api-key" {
+			t.Errorf("recording must forward request headers, got %v", r.Header)
+		}
+		body := `{"jwt":"eyJ.secret","hostname":"db1-acme-prod.turso.io"}`
+		return &http.Response{StatusCode: 200, Header: http.Header{"Content-Type": {"application/json"}}, Body: io.NopCloser(strings.NewReader(body))}, nil
+	})
+	client := &http.Client{Transport: recorder}
+	tokenURL := "https://api.turso.tech/v1/organizations/acme-prod/databases/db1/auth/tokens"
+	req, _ := http.NewRequest(http.MethodPost, tokenURL, strings.NewReader(`{"authorization":"full-access"}`))
+	req.Header.Set("Authorization", "Bearer secret-api-key")
+	if _, err := client.Do(req); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"acme-prod", "eyJ.secret", "secret-api-key"} {
+		if bytes.Contains(raw, []byte(secret)) {
+			t.Fatalf("cassette leaks %q:\n%s", secret, raw)
+		}
+	}
+
+	// A replay under a different organization matches the sanitized request.
+	config.Cfg.TursoOrganization = "ci"
+	player, err := NewTursoCassette(CassetteReplay, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client = &http.Client{Transport: player}
+	status, body, err := send(client, http.MethodPost, "https://api.turso.tech/v1/organizations/ci/databases/db1/auth/tokens", `{ "authorization": "full-access" }`)
+	if err != nil || status != 200 || !strings.Contains(body, `"hostname":"db1-ci.turso.io"`) || !strings.Contains(body, `"jwt":"[redacted]"`) {
+		t.Fatalf("unexpected replay %d %s (%v)", status, body, err)
+	}
+	if unused := player.Unused(); len(unused) != 0 {
+		t.Fatalf("expected every interaction to be replayed, got %v", unused)
+	}
+	if _, _, err := send(client, http.MethodPost, "https://api.turso.tech/v1/organizations/ci/databases/db1/auth/tokens", `{"authorization":"full-access"}`); err == nil {
+		t.Fatal("expected an interaction to replay only once")
+	}
+	if _, _, err := send(client, http.MethodDelete, "https://api.turso.tech/v1/organizations/ci/databases/db1", ""); err == nil {
+		t.Fatal("expected an unrecorded request to fail")
+	}
+}
+
+func TestNewTursoCassette_Validates(t *testing.T) {
+	if _, err := NewTursoCassette(CassetteReplay, ""); err == nil {
+		t.Fatal("expected a missing path to be rejected")
+	}
+	if _, err := NewTursoCassette("rewind", filepath.Join(t.TempDir(), "c.json")); err == nil {
+		t.Fatal("expected an unknown mode to be rejected")
+	}
+	if _, err := NewTursoCassette(CassetteReplay, filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Fatal("expected a missing cassette to be rejected in replay mode")
+	}
+}
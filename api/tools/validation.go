@@ -53,6 +53,27 @@ func ValidateColumnName(name string) error {
 	return nil
 }
 
+// ValidateLanguageTag validates a BCP 47 style language tag such as en or
+// de-AT: subtags of 1-8 ASCII letters or digits joined by dashes, the first
+// all letters.
+func ValidateLanguageTag(tag string) error {
+	if tag == "" {
+		return fmt.Errorf("empty language tag")
+	}
+	for i, sub := range strings.Split(tag, "-") {
+		if len(sub) == 0 || len(sub) > 8 {
+			return fmt.Errorf("invalid language tag %q", tag)
+		}
+		for _, r := range sub {
+			letter := r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z'
+			if !letter && (i == 0 || r < '0' || r > '9') {
+				return fmt.Errorf("invalid language tag %q", tag)
+			}
+		}
+	}
+	return nil
+}
+
 // ValidateResourceName validates platform resource names such as template and database names.
 // Valid names are 1-64 chars and may contain only lowercase letters, numbers, and dashes.
 func ValidateResourceName(name string) (code, message, hint string) {
@@ -94,3 +115,32 @@ func ValidateDDLQuery(query string) error {
 		return fmt.Errorf("%w: got %s", ErrNotDDLQuery, firstWord)
 	}
 }
+
+// TransactionalStatement reports whether a SQL statement takes effect when run
+// inside a transaction. VACUUM fails there and ATTACH/DETACH are rejected, while
+// PRAGMA foreign_keys and journal_mode are silently ignored until commit.
+func TransactionalStatement(stmt string) bool {
+	fields := strings.Fields(strings.ToUpper(stmt))
+	if len(fields) == 0 {
+		return true
+	}
+	switch fields[0] {
+	case "VACUUM", "ATTACH", "DETACH", "BEGIN", "COMMIT", "END", "ROLLBACK":
+		return false
+	case "PRAGMA":
+		pragma := strings.TrimSpace(strings.Join(fields[1:], " "))
+		return !strings.HasPrefix(pragma, "FOREIGN_KEYS") && !strings.HasPrefix(pragma, "JOURNAL_MODE")
+	}
+	return true
+}
+
+// TransactionalStatements reports whether every statement can run inside one
+// transaction, so a failure part way through leaves nothing applied.
+func TransactionalStatements(statements []string) bool {
+	for _, stmt := range statements {
+		if !TransactionalStatement(stmt) {
+			return false
+		}
+	}
+	return true
+}
@@ -88,3 +88,39 @@ func TestValidateDDLQuery(t *testing.T) {
 		})
 	}
 }
+
+func TestTransactionalStatement(t *testing.T) {
+	tests := []struct {
+		stmt string
+		want bool
+	}{
+		{stmt: "ALTER TABLE users ADD COLUMN name TEXT", want: true},
+		{stmt: "UPDATE users SET name = ''", want: true},
+		{stmt: "PRAGMA user_version = 3", want: true},
+		{stmt: "pragma foreign_keys=OFF", want: false},
+		{stmt: "PRAGMA journal_mode = WAL", want: false},
+		{stmt: "VACUUM", want: false},
+		{stmt: "  attach database 'x.db' AS x", want: false},
+	}
+	for _, tt := range tests {
+		if got := TransactionalStatement(tt.stmt); got != tt.want {
+			t.Fatalf("TransactionalStatement(%q) = %v, want %v", tt.stmt, got, tt.want)
+		}
+	}
+	if TransactionalStatements([]string{"CREATE TABLE a (id INTEGER)", "VACUUM"}) {
+		t.Fatal("expected a batch with VACUUM to be non-transactional")
+	}
+}
+
+func TestValidateLanguageTag(t *testing.T) {
+	for _, tag := range []string{"en", "de-AT", "zh-Hant-TW", "es-419"} {
+		if err := ValidateLanguageTag(tag); err != nil {
+			t.Errorf("%q: %v", tag, err)
+		}
+	}
+	for _, tag := range []string{"", "e1", "en-", "en_US", "en-'x'", "toolongtag"} {
+		if err := ValidateLanguageTag(tag); err == nil {
+			t.Errorf("%q: expected an error", tag)
+		}
+	}
+}
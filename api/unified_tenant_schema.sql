@@ -132,5 +132,6 @@ CREATE TABLE IF NOT EXISTS atombase_migration_failures (
     from_version INTEGER NOT NULL,
     to_version INTEGER NOT NULL,
     error TEXT,
+    atomic INTEGER NOT NULL DEFAULT 1, -- 0 when the migration could not run in a transaction
     created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
 );
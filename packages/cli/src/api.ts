@@ -13,6 +13,11 @@ import type { AtomicbaseConfig } from "./config.js";
 
 export type { TableDefinition, ColumnDefinition, IndexDefinition };
 
+/** Revision of the server API this CLI is built for. */
+export const API_VERSION = 1;
+
+const VERSION_PATH = "/platform/version";
+
 export class ApiError extends Error {
   constructor(
     message: string,
@@ -48,6 +53,12 @@ export interface Merge {
   new: number;
 }
 
+export interface ServerVersion {
+  version: string;
+  apiVersions: number[];
+  features: Record<string, boolean>;
+}
+
 export interface DefinitionResponse {
   id: number;
   name: string;
@@ -140,6 +151,7 @@ export class ApiClient {
   private baseUrl: string;
   private apiKey?: string;
   private insecure: boolean;
+  private compatibility?: Promise<void>;
 
   constructor(config: Required<AtomicbaseConfig>) {
     this.baseUrl = config.url.replace(/\/$/, "");
@@ -147,7 +159,47 @@ export class ApiClient {
     this.insecure = config.insecure ?? false;
   }
 
+  /**
+   * Checks, once per client, that the server speaks this CLI's API version.
+   * Throws when it does not; warns when the server predates version
+   * negotiation or also serves a newer API.
+   */
+  checkCompatibility(): Promise<void> {
+    this.compatibility ??= this.getVersion().then(
+      (server) => {
+        const newest = Math.max(...server.apiVersions);
+        if (!server.apiVersions.includes(API_VERSION)) {
+          throw new ApiError(
+            `Server ${server.version} serves API versions ${server.apiVersions.join(", ")}, but this CLI needs version ${API_VERSION}`,
+            0,
+            "INCOMPATIBLE_SERVER",
+            newest > API_VERSION ? "Upgrade @atomicbase/cli" : "Upgrade the Atomicbase server"
+          );
+        }
+        if (newest > API_VERSION) {
+          console.warn(`Warning: server ${server.version} serves API version ${newest}; upgrade @atomicbase/cli to use it\n`);
+        }
+      },
+      (err) => {
+        if (err instanceof ApiError && err.status === 404) {
+          console.warn("Warning: server does not report its version and may not support this CLI\n");
+          return;
+        }
+        throw err;
+      }
+    );
+    return this.compatibility;
+  }
+
+  async getVersion(): Promise<ServerVersion> {
+    return this.request<ServerVersion>("GET", VERSION_PATH);
+  }
+
   private async request<T>(method: string, path: string, body?: unknown): Promise<T> {
+    if (path !== VERSION_PATH) {
+      await this.checkCompatibility();
+    }
+
     const headers: Record<string, string> = {
       "Content-Type": "application/json",
     };
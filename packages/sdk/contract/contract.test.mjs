@@ -45,6 +45,14 @@ function buildDefinition(definitionName) {
   };
 }
 
+test("SDK <-> API contract: server speaks the SDK's API version", { skip: skipReason ?? false }, async () => {
+  await assertHealthy();
+
+  const { data, error } = await createClient({ url: BASE_URL }).checkCompatibility();
+  assert.equal(error, null, `compatibility check failed: ${error?.message}`);
+  assert.ok(data.version);
+});
+
 test("SDK <-> API contract: core tenant data flows", { skip: skipReason ?? false }, async (t) => {
   await assertHealthy();
 
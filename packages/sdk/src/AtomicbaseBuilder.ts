@@ -25,6 +25,9 @@ export interface QueryState {
   data: unknown;
   returning: string[];
   onConflict: "ignore" | null;
+  conflictTarget: string[];
+  ignoreDuplicates: boolean;
+  rows: unknown[] | null;
   count: boolean;
   resultMode: ResultMode;
 }
@@ -70,6 +73,9 @@ export abstract class AtomicbaseBuilder<T> implements PromiseLike<AtomicbaseResp
       data: null,
       returning: [],
       onConflict: null,
+      conflictTarget: [],
+      ignoreDuplicates: false,
+      rows: null,
       count: false,
       resultMode: "default",
     };
@@ -365,7 +371,10 @@ export abstract class AtomicbaseBuilder<T> implements PromiseLike<AtomicbaseResp
   protected abstract buildBody(): Record<string, unknown>;
 
   protected buildRequest(): { url: string; headers: Record<string, string>; body: Record<string, unknown> } {
-    const url = `${this.baseUrl}/data/query/${encodeURIComponent(this.state.table)}`;
+    let url = `${this.baseUrl}/data/query/${encodeURIComponent(this.state.table)}`;
+    if (this.state.operation === "upsert" && this.state.conflictTarget.length > 0) {
+      url += `?on_conflict=${encodeURIComponent(this.state.conflictTarget.join(","))}`;
+    }
     const headers = this.buildHeaders();
     return { url, headers, body: this.buildBody() };
   }
@@ -399,7 +408,10 @@ export abstract class AtomicbaseBuilder<T> implements PromiseLike<AtomicbaseResp
         if (this.state.onConflict === "ignore") preferParts.push("on-conflict=ignore");
         break;
       case "upsert":
-        preferParts.push("operation=insert", "on-conflict=replace");
+        preferParts.push(
+          "operation=insert",
+          this.state.ignoreDuplicates ? "resolution=ignore-duplicates" : "resolution=merge-duplicates"
+        );
         break;
       case "update":
         preferParts.push("operation=update");
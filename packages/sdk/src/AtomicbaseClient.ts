@@ -4,7 +4,15 @@ import { AtomicbaseError } from "./AtomicbaseError.js";
 import { AuthClient, OrganizationAuthClient } from "./AuthClient.js";
 import { DatabasesClient } from "./DatabasesClient.js";
 import { DefinitionsClient } from "./DefinitionsClient.js";
-import type { AtomicbaseClientOptions, AtomicbaseBatchResponse } from "./types.js";
+import type {
+  AtomicbaseClientOptions,
+  AtomicbaseBatchResponse,
+  AtomicbaseResponse,
+  ServerVersion,
+} from "./types.js";
+
+/** Revision of the server API this SDK is built for. */
+export const API_VERSION = 1;
 
 /**
  * Database-scoped client for operations.
@@ -275,6 +283,52 @@ export class AtomicbaseClient {
     });
   }
 
+  /**
+   * Check that the server speaks the API version this SDK is built for.
+   * Fails with `INCOMPATIBLE_SERVER` when it does not, and warns when the
+   * server also serves a newer API than this SDK knows.
+   *
+   * @example
+   * ```ts
+   * const { data, error } = await client.checkCompatibility()
+   * if (data?.features.exports) { ... }
+   * ```
+   */
+  async checkCompatibility(): Promise<AtomicbaseResponse<ServerVersion>> {
+    let server: ServerVersion;
+    try {
+      const response = await this.fetchFn(`${this.baseUrl}/platform/version`, { headers: this.headers });
+      if (!response.ok) {
+        const errorBody = await response.json().catch(() => ({}));
+        const error = AtomicbaseError.fromResponse(errorBody, response.status);
+        if (response.status === 404) {
+          error.hint = "The server predates version negotiation; upgrade it to use this SDK";
+        }
+        return { data: null, error };
+      }
+      server = (await response.json()) as ServerVersion;
+    } catch (err) {
+      return { data: null, error: AtomicbaseError.networkError(err) };
+    }
+
+    const newest = Math.max(...server.apiVersions);
+    if (!server.apiVersions.includes(API_VERSION)) {
+      return {
+        data: null,
+        error: new AtomicbaseError({
+          message: `Server ${server.version} serves API versions ${server.apiVersions.join(", ")}, but this SDK needs version ${API_VERSION}`,
+          code: "INCOMPATIBLE_SERVER",
+          status: 0,
+          hint: newest > API_VERSION ? "Upgrade @atomicbase/sdk" : "Upgrade the Atomicbase server",
+        }),
+      };
+    }
+    if (newest > API_VERSION) {
+      console.warn(`Atomicbase server ${server.version} serves API version ${newest}; upgrade @atomicbase/sdk to use it`);
+    }
+    return { data: server, error: null };
+  }
+
   withSession(sessionToken: string): AtomicbaseClient {
     return new AtomicbaseClient({
       url: this.baseUrl,
@@ -1,5 +1,5 @@
 import { AtomicbaseBuilder, type BuilderConfig } from "./AtomicbaseBuilder.js";
-import type { SelectColumn, JoinClause, FilterCondition } from "./types.js";
+import type { SelectColumn, JoinClause, FilterCondition, UpsertOptions } from "./types.js";
 
 /**
  * Query builder for database operations.
@@ -137,18 +137,27 @@ export class AtomicbaseQueryBuilder<T = Record<string, unknown>> extends Atomicb
 
   /**
    * Upsert (insert or update) one or more rows.
-   * Uses the primary key to detect conflicts.
+   * Uses the primary key to detect conflicts unless `onConflict` names
+   * the columns of a unique index.
    *
    * @example
    * ```ts
    * const { data } = await client
    *   .from('users')
    *   .upsert({ id: 1, name: 'Alice Updated' })
+   *
+   * // Match on email, keeping rows that already exist
+   * await client
+   *   .from('users')
+   *   .upsert({ email: 'alice@example.com', name: 'Alice' }, { onConflict: 'email', ignoreDuplicates: true })
    * ```
    */
-  upsert(data: Partial<T> | Partial<T>[]): AtomicbaseQueryBuilder<{ rows_affected: number }> {
+  upsert(data: Partial<T> | Partial<T>[], options: UpsertOptions = {}): AtomicbaseQueryBuilder<{ rows_affected: number }> {
     this.state.operation = "upsert";
     this.state.data = Array.isArray(data) ? data : [data];
+    const target = options.onConflict ?? [];
+    this.state.conflictTarget = Array.isArray(target) ? target : target.split(",").map((col) => col.trim());
+    this.state.ignoreDuplicates = options.ignoreDuplicates ?? false;
     return this as unknown as AtomicbaseQueryBuilder<{ rows_affected: number }>;
   }
 
@@ -187,6 +196,39 @@ export class AtomicbaseQueryBuilder<T = Record<string, unknown>> extends Atomicb
     return this as unknown as AtomicbaseQueryBuilder<{ rows_affected: number }>;
   }
 
+  /**
+   * Update many rows by primary key in one transaction. Each row holds its
+   * primary key and the columns to set; if any row fails, none change.
+   *
+   * @example
+   * ```ts
+   * await client
+   *   .from('users')
+   *   .updateMany([{ id: 1, status: 'inactive' }, { id: 2, name: 'Bob' }])
+   * ```
+   */
+  updateMany(rows: Partial<T>[]): AtomicbaseQueryBuilder<{ rows_affected: number }> {
+    this.state.operation = "update";
+    this.state.rows = rows;
+    return this as unknown as AtomicbaseQueryBuilder<{ rows_affected: number }>;
+  }
+
+  /**
+   * Delete many rows by primary key in one transaction.
+   *
+   * @example
+   * ```ts
+   * await client
+   *   .from('users')
+   *   .deleteMany([{ id: 1 }, { id: 2 }])
+   * ```
+   */
+  deleteMany(keys: Partial<T>[]): AtomicbaseQueryBuilder<{ rows_affected: number }> {
+    this.state.operation = "delete";
+    this.state.rows = keys;
+    return this as unknown as AtomicbaseQueryBuilder<{ rows_affected: number }>;
+  }
+
   /**
    * Set conflict handling behavior for insert operations.
    *
@@ -225,15 +267,20 @@ export class AtomicbaseQueryBuilder<T = Record<string, unknown>> extends Atomicb
       case "upsert":
         body.data = data;
         if (returning.length > 0) body.returning = returning;
+        // Batches have no URL or Prefer header, so upserts carry these in the body.
+        if (operation === "upsert" && this.state.conflictTarget.length > 0) body.onConflict = this.state.conflictTarget;
+        if (operation === "upsert" && this.state.ignoreDuplicates) body.ignoreDuplicates = true;
         break;
 
       case "update":
-        body.data = data;
+        if (this.state.rows) body.rows = this.state.rows;
+        else body.data = data;
         if (where.length > 0) body.where = where;
         if (returning.length > 0) body.returning = returning;
         break;
 
       case "delete":
+        if (this.state.rows) body.rows = this.state.rows;
         if (where.length > 0) body.where = where;
         if (returning.length > 0) body.returning = returning;
         break;
@@ -2,7 +2,7 @@
 // Client
 // =============================================================================
 
-export { AtomicbaseClient, DatabaseClient, createClient } from "./AtomicbaseClient.js";
+export { AtomicbaseClient, DatabaseClient, createClient, API_VERSION } from "./AtomicbaseClient.js";
 export { DatabasesClient } from "./DatabasesClient.js";
 export { DefinitionsClient } from "./DefinitionsClient.js";
 export { AuthClient, OrganizationAuthClient } from "./AuthClient.js";
@@ -85,12 +85,14 @@ export type {
   Definition,
   DefinitionVersion,
   Merge,
+  ServerVersion,
   CreateDefinitionOptions,
   PushDefinitionOptions,
   // Query types
   FilterCondition,
   SelectColumn,
   OrderDirection,
+  UpsertOptions,
   // Join types
   JoinClause,
   // Database types (Platform API)
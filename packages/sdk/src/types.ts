@@ -78,6 +78,16 @@ export type QueryOperation = "select" | "insert" | "upsert" | "update" | "delete
 
 export type ResultMode = "default" | "single" | "maybeSingle" | "count" | "withCount";
 
+/**
+ * Options for upsert.
+ */
+export interface UpsertOptions {
+  /** Columns of a primary key or unique index to match rows on. Defaults to the primary key. */
+  onConflict?: string | string[];
+  /** Keep existing rows as they are instead of updating them. */
+  ignoreDuplicates?: boolean;
+}
+
 /**
  * Custom join clause for explicit joins.
  */
@@ -234,6 +244,16 @@ export interface Merge {
   new: number;
 }
 
+/** Returned by `GET /platform/version`. */
+export interface ServerVersion {
+  /** Server release */
+  version: string;
+  /** API revisions the server serves, oldest first */
+  apiVersions: number[];
+  /** Optional parts of the API the server offers, e.g. `exports` */
+  features: Record<string, boolean>;
+}
+
 export interface CreateDefinitionOptions {
   name: string;
   type: DefinitionType;